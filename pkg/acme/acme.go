@@ -144,6 +144,7 @@ type Configuration struct {
 // Initialize validates and set the configuration
 func (c *Configuration) Initialize(configDir string, checkRenew bool) error {
 	config = nil
+	common.SetACMEKeyPairs(nil)
 	setLogMode(checkRenew)
 	c.checkDomains()
 	if len(c.Domains) == 0 {
@@ -201,6 +202,7 @@ func (c *Configuration) Initialize(configDir string, checkRenew bool) error {
 
 	acmeLog(logger.LevelInfo, "configured domains: %+v", c.Domains)
 	config = c
+	common.SetACMEKeyPairs(c.getKeyPairs())
 	if checkRenew {
 		return startScheduler()
 	}
@@ -234,6 +236,21 @@ func (c *Configuration) checkDomains() {
 	c.Domains = util.RemoveDuplicates(domains, true)
 }
 
+// getKeyPairs returns the key pairs for the configured domains, the certificates
+// may not be obtained yet
+func (c *Configuration) getKeyPairs() []common.TLSKeyPair {
+	keyPairs := make([]common.TLSKeyPair, 0, len(c.Domains))
+	for _, domain := range c.Domains {
+		name := sanitizedDomain(domain)
+		keyPairs = append(keyPairs, common.TLSKeyPair{
+			Cert: filepath.Join(c.CertsPath, name+".crt"),
+			Key:  filepath.Join(c.CertsPath, name+".key"),
+			ID:   domain,
+		})
+	}
+	return keyPairs
+}
+
 func (c *Configuration) setLockTime() error {
 	lockTime := fmt.Sprintf("%v", util.GetTimeAsMsSinceEpoch(time.Now()))
 	err := os.WriteFile(c.lockPath, []byte(lockTime), 0600)
@@ -0,0 +1,263 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package circuitbreaker provides circuit breakers for the SFTPGo hooks
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/command"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/metric"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	logSender = "circuitbreaker"
+)
+
+// Circuit breaker states
+const (
+	StateClosed = iota
+	StateHalfOpen
+	StateOpen
+)
+
+var (
+	// ErrOpen is returned if a hook is not executed because its circuit breaker is open
+	ErrOpen = errors.New("the hook circuit breaker is open")
+	// supported hooks, the keyboard interactive hook is excluded, it is an interactive program
+	supportedHooks = []string{command.HookFsActions, command.HookProviderActions, command.HookPostConnect,
+		command.HookPostDisconnect, command.HookDataRetention, command.HookCheckPassword, command.HookPreLogin,
+		command.HookPostLogin, command.HookExternalAuth, command.HookSecurityEvent}
+	// an empty response from these hooks is a successful authentication so they must fail closed
+	authHooks  = []string{command.HookCheckPassword, command.HookExternalAuth}
+	breakersMu sync.RWMutex
+	breakers   = make(map[string]*Breaker)
+)
+
+// Config defines the circuit breaker configuration for a hook
+type Config struct {
+	// Hook name, for example "pre_login". The supported names are the ones
+	// also supported in the command configuration, except keyboard_interactive
+	// and startup
+	Hook string `json:"hook" mapstructure:"hook"`
+	// Number of consecutive failures that open the circuit. 0 means disabled
+	FailureThreshold int `json:"failure_threshold" mapstructure:"failure_threshold"`
+	// Time window, in seconds, for counting consecutive failures. The failures
+	// count restarts if the first failure is older than this window.
+	// 0 means no time window
+	FailureWindow int `json:"failure_window" mapstructure:"failure_window"`
+	// Time, in seconds, after which an open circuit allows a single trial
+	// request. If the trial request succeeds the circuit is closed again
+	RecoveryTimeout int `json:"recovery_timeout" mapstructure:"recovery_timeout"`
+	// If true, the operations guarded by the hook are allowed while the
+	// circuit is open, otherwise they are denied
+	FailOpen bool `json:"fail_open" mapstructure:"fail_open"`
+}
+
+func (c *Config) isEnabled() bool {
+	return c.FailureThreshold > 0
+}
+
+func (c *Config) validate() error {
+	if !util.Contains(supportedHooks, c.Hook) {
+		return fmt.Errorf("invalid hook name %q, supported values: %+v", c.Hook, supportedHooks)
+	}
+	if c.FailureWindow < 0 {
+		return fmt.Errorf("invalid failure window %d for hook %q", c.FailureWindow, c.Hook)
+	}
+	if c.RecoveryTimeout <= 0 {
+		return fmt.Errorf("invalid recovery timeout %d for hook %q", c.RecoveryTimeout, c.Hook)
+	}
+	if c.FailOpen && util.Contains(authHooks, c.Hook) {
+		return fmt.Errorf("fail open is not supported for hook %q, it would bypass the authentication", c.Hook)
+	}
+	return nil
+}
+
+// Initialize configures the circuit breakers
+func Initialize(configs []Config) error {
+	newBreakers := make(map[string]*Breaker)
+	for _, cfg := range configs {
+		if !cfg.isEnabled() {
+			continue
+		}
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		if _, ok := newBreakers[cfg.Hook]; ok {
+			return fmt.Errorf("duplicate circuit breaker for hook %q", cfg.Hook)
+		}
+		newBreakers[cfg.Hook] = NewBreaker(cfg)
+		logger.Debug(logSender, "", "circuit breaker configured for hook %q: %+v", cfg.Hook, cfg)
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	breakers = newBreakers
+	return nil
+}
+
+// Execute executes fn, for the specified hook, if the related circuit breaker
+// allows it and records the result. fn must return an error only if the hook
+// is unavailable, for example if the HTTP request fails or the command cannot
+// be executed, and not if the hook denies the operation.
+// If the circuit is open fn is not executed: nil is returned if the breaker
+// is configured to fail open, ErrOpen otherwise.
+// fn is always executed if no circuit breaker is configured for the hook
+func Execute(hook string, fn func() error) error {
+	breakersMu.RLock()
+	b, ok := breakers[hook]
+	breakersMu.RUnlock()
+
+	if !ok {
+		return fn()
+	}
+	return b.Execute(fn)
+}
+
+// GetCommandFailure returns the error to record for a command based hook.
+// A non-zero exit status is a valid hook response and so it is not a failure,
+// while errors starting the command and timeouts are failures
+func GetCommandFailure(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil
+	}
+	return err
+}
+
+// Breaker is a circuit breaker for a hook
+type Breaker struct {
+	config Config
+	mu     sync.Mutex
+	state  int
+	// number of consecutive failures
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	// true if a trial request is in progress while half-open
+	trialInProgress bool
+}
+
+// NewBreaker returns a new circuit breaker using the specified configuration
+func NewBreaker(config Config) *Breaker {
+	b := &Breaker{
+		config: config,
+		state:  StateClosed,
+	}
+	metric.UpdateHookCircuitBreakerState(config.Hook, b.state)
+	return b
+}
+
+// GetState returns the current circuit breaker state
+func (b *Breaker) GetState() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Execute executes fn if the circuit allows it and records the result
+func (b *Breaker) Execute(fn func() error) error {
+	if !b.allow() {
+		logger.Debug(logSender, "", "circuit breaker open for hook %q, fail open? %t", b.config.Hook, b.config.FailOpen)
+		if b.config.FailOpen {
+			return nil
+		}
+		return ErrOpen
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < time.Duration(b.config.RecoveryTimeout)*time.Second {
+			return false
+		}
+		b.setState(StateHalfOpen)
+		b.trialInProgress = true
+		return true
+	case StateHalfOpen:
+		if b.trialInProgress {
+			return false
+		}
+		b.trialInProgress = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialInProgress = false
+	if err == nil {
+		b.failures = 0
+		b.setState(StateClosed)
+		return
+	}
+	now := time.Now()
+	if b.state == StateHalfOpen {
+		b.open(now)
+		return
+	}
+	if b.failures == 0 || (b.config.FailureWindow > 0 &&
+		now.Sub(b.firstFailure) > time.Duration(b.config.FailureWindow)*time.Second) {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.config.FailureThreshold {
+		b.open(now)
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.failures = 0
+	b.openedAt = now
+	b.setState(StateOpen)
+	logger.Warn(logSender, "", "circuit breaker opened for hook %q, recovery timeout: %d seconds",
+		b.config.Hook, b.config.RecoveryTimeout)
+}
+
+func (b *Breaker) setState(state int) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	metric.UpdateHookCircuitBreakerState(b.config.Hook, state)
+}
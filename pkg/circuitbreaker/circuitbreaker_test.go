@@ -0,0 +1,266 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/command"
+)
+
+var errHook = errors.New("hook error")
+
+func TestInitialize(t *testing.T) {
+	err := Initialize([]Config{
+		{
+			Hook:             "unknown",
+			FailureThreshold: 1,
+			RecoveryTimeout:  10,
+		},
+	})
+	assert.Error(t, err)
+	err = Initialize([]Config{
+		{
+			Hook:             command.HookPreLogin,
+			FailureThreshold: 1,
+			FailureWindow:    -1,
+			RecoveryTimeout:  10,
+		},
+	})
+	assert.Error(t, err)
+	err = Initialize([]Config{
+		{
+			Hook:             command.HookPreLogin,
+			FailureThreshold: 1,
+		},
+	})
+	assert.Error(t, err)
+	err = Initialize([]Config{
+		{
+			Hook:             command.HookExternalAuth,
+			FailureThreshold: 1,
+			RecoveryTimeout:  10,
+			FailOpen:         true,
+		},
+	})
+	assert.ErrorContains(t, err, "bypass the authentication")
+	err = Initialize([]Config{
+		{
+			Hook:             command.HookPreLogin,
+			FailureThreshold: 1,
+			RecoveryTimeout:  10,
+		},
+		{
+			Hook:             command.HookPreLogin,
+			FailureThreshold: 2,
+			RecoveryTimeout:  10,
+		},
+	})
+	assert.ErrorContains(t, err, "duplicate")
+	err = Initialize([]Config{
+		{
+			Hook:             command.HookPreLogin,
+			FailureThreshold: 0,
+		},
+		{
+			Hook:             command.HookPostConnect,
+			FailureThreshold: 2,
+			RecoveryTimeout:  10,
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, breakers, 1)
+	assert.Contains(t, breakers, command.HookPostConnect)
+
+	err = Initialize(nil)
+	require.NoError(t, err)
+	assert.Len(t, breakers, 0)
+}
+
+func TestBreakerStates(t *testing.T) {
+	err := Initialize([]Config{
+		{
+			Hook:             command.HookPostConnect,
+			FailureThreshold: 2,
+			RecoveryTimeout:  10,
+		},
+	})
+	require.NoError(t, err)
+	b := breakers[command.HookPostConnect]
+	executions := 0
+	failingHook := func() error {
+		executions++
+		return errHook
+	}
+	successHook := func() error {
+		executions++
+		return nil
+	}
+	// no breaker configured for this hook
+	for i := 0; i < 5; i++ {
+		err = Execute(command.HookPreLogin, failingHook)
+		assert.ErrorIs(t, err, errHook)
+	}
+	assert.Equal(t, 5, executions)
+
+	executions = 0
+	err = Execute(command.HookPostConnect, failingHook)
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateClosed, b.GetState())
+	// a success resets the failures count
+	err = Execute(command.HookPostConnect, successHook)
+	assert.NoError(t, err)
+	err = Execute(command.HookPostConnect, failingHook)
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateClosed, b.GetState())
+	err = Execute(command.HookPostConnect, failingHook)
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateOpen, b.GetState())
+	assert.Equal(t, 4, executions)
+	// the circuit is open, the hook is not executed
+	err = Execute(command.HookPostConnect, successHook)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, 4, executions)
+	// after the recovery timeout a trial request is allowed, if it fails the circuit opens again
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-11 * time.Second)
+	b.mu.Unlock()
+	err = Execute(command.HookPostConnect, failingHook)
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, 5, executions)
+	assert.Equal(t, StateOpen, b.GetState())
+	err = Execute(command.HookPostConnect, successHook)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, 5, executions)
+	// a successful trial request closes the circuit
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-11 * time.Second)
+	b.mu.Unlock()
+	err = Execute(command.HookPostConnect, successHook)
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, b.GetState())
+	err = Execute(command.HookPostConnect, successHook)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, executions)
+
+	err = Initialize(nil)
+	require.NoError(t, err)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b := NewBreaker(Config{
+		Hook:             command.HookPostLogin,
+		FailureThreshold: 1,
+		RecoveryTimeout:  10,
+	})
+	err := b.Execute(func() error {
+		return errHook
+	})
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateOpen, b.GetState())
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-11 * time.Second)
+	b.mu.Unlock()
+
+	err = b.Execute(func() error {
+		assert.Equal(t, StateHalfOpen, b.GetState())
+		// only one trial request is allowed while half-open
+		err := b.Execute(func() error {
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrOpen)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, b.GetState())
+}
+
+func TestBreakerFailOpen(t *testing.T) {
+	b := NewBreaker(Config{
+		Hook:             command.HookPreLogin,
+		FailureThreshold: 1,
+		RecoveryTimeout:  10,
+		FailOpen:         true,
+	})
+	err := b.Execute(func() error {
+		return errHook
+	})
+	assert.ErrorIs(t, err, errHook)
+	executed := false
+	err = b.Execute(func() error {
+		executed = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, executed)
+	assert.Equal(t, StateOpen, b.GetState())
+}
+
+func TestBreakerFailureWindow(t *testing.T) {
+	b := NewBreaker(Config{
+		Hook:             command.HookFsActions,
+		FailureThreshold: 2,
+		FailureWindow:    5,
+		RecoveryTimeout:  10,
+	})
+	err := b.Execute(func() error {
+		return errHook
+	})
+	assert.ErrorIs(t, err, errHook)
+	// the first failure is outside the window, the count restarts
+	b.mu.Lock()
+	b.firstFailure = time.Now().Add(-6 * time.Second)
+	b.mu.Unlock()
+	err = b.Execute(func() error {
+		return errHook
+	})
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateClosed, b.GetState())
+	err = b.Execute(func() error {
+		return errHook
+	})
+	assert.ErrorIs(t, err, errHook)
+	assert.Equal(t, StateOpen, b.GetState())
+}
+
+func TestGetCommandFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test is not available on Windows")
+	}
+	ctx := context.Background()
+	assert.NoError(t, GetCommandFailure(ctx, nil))
+	// a non-zero exit code is a valid hook response
+	err := exec.CommandContext(ctx, "false").Run()
+	assert.Error(t, err)
+	assert.NoError(t, GetCommandFailure(ctx, err))
+	// the command cannot be started
+	err = exec.CommandContext(ctx, "/missing/hook/path").Run()
+	assert.Error(t, err)
+	assert.ErrorIs(t, GetCommandFailure(ctx, err), err)
+	// timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = exec.CommandContext(ctx, "sleep", "2").Run()
+	assert.Error(t, err)
+	assert.ErrorIs(t, GetCommandFailure(ctx, err), context.DeadlineExceeded)
+}
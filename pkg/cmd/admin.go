@@ -0,0 +1,183 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/sftpgo/sdk"
+	"github.com/spf13/cobra"
+
+	"github.com/drakkan/sftpgo/v2/pkg/config"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+const (
+	adminPageSize = 100
+)
+
+var (
+	adminCmd = &cobra.Command{
+		Use:   "admin",
+		Short: "Administrative maintenance tasks",
+	}
+	adminDeduplicateCmd = &cobra.Command{
+		Use:   "deduplicate",
+		Short: "Deduplicate the files already stored on local filesystems",
+		Long: `This command deduplicates the files stored inside the home directory of the
+users, and the mapped path of the virtual folders, with a local filesystem
+configured to deduplicate the uploaded files. Files with the same content
+are replaced with hard links to a single copy and the unreferenced contents
+are removed from the content store. The used quota is updated after the scan.
+
+Files modified while the command is running are not detected, so make sure
+there are no uploads in progress, for example by stopping the SFTPGo service.
+
+Please take a look at the usage below to customize the options.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			logger.DisableLogger()
+			logger.EnableConsoleLogger(zerolog.DebugLevel)
+			configDir = util.CleanDirInput(configDir)
+			err := config.LoadConfig(configDir, configFile)
+			if err != nil {
+				logger.ErrorToConsole("Unable to load configuration: %v", err)
+				os.Exit(1)
+			}
+			kmsConfig := config.GetKMSConfig()
+			err = kmsConfig.Initialize()
+			if err != nil {
+				logger.ErrorToConsole("unable to initialize KMS: %v", err)
+				os.Exit(1)
+			}
+			providerConf := config.GetProviderConf()
+			err = dataprovider.Initialize(providerConf, configDir, false)
+			if err != nil {
+				logger.ErrorToConsole("error initializing data provider: %v", err)
+				os.Exit(1)
+			}
+			defer dataprovider.Close() //nolint:errcheck
+
+			if err = deduplicateUsers(); err != nil {
+				logger.ErrorToConsole("unable to deduplicate users: %v", err)
+				os.Exit(1)
+			}
+			if err = deduplicateFolders(); err != nil {
+				logger.ErrorToConsole("unable to deduplicate virtual folders: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func isDeduplicationEnabled(fsConfig vfs.Filesystem) bool {
+	return fsConfig.Provider == sdk.LocalFilesystemProvider && fsConfig.OSConfig.DeduplicationEnabled
+}
+
+func deduplicateFs(fs vfs.Fs, name string) bool {
+	osFs, ok := fs.(*vfs.OsFs)
+	if !ok {
+		return false
+	}
+	numFiles, size, err := osFs.DeduplicateContents()
+	if err != nil {
+		logger.WarnToConsole("unable to deduplicate %q: %v", name, err)
+		return false
+	}
+	logger.InfoToConsole("%q deduplicated, files: %d, saved size: %d", name, numFiles, size)
+	return true
+}
+
+func deduplicateUsers() error {
+	for offset := 0; ; offset += adminPageSize {
+		users, err := dataprovider.GetUsers(adminPageSize, offset, dataprovider.OrderASC)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			user, err := dataprovider.GetUserWithGroupSettings(u.Username)
+			if err != nil {
+				return err
+			}
+			if !isDeduplicationEnabled(user.FsConfig) {
+				continue
+			}
+			fs, err := user.GetFilesystem("")
+			if err != nil {
+				logger.WarnToConsole("unable to get the filesystem for user %q: %v", user.Username, err)
+				continue
+			}
+			if !deduplicateFs(fs, user.Username) {
+				continue
+			}
+			numFiles, size, err := user.ScanQuota()
+			if err == nil {
+				err = dataprovider.UpdateUserQuota(&user, numFiles, size, true)
+			}
+			if err != nil {
+				logger.WarnToConsole("unable to update the quota for user %q: %v", user.Username, err)
+			}
+		}
+		if len(users) < adminPageSize {
+			return nil
+		}
+	}
+}
+
+func deduplicateFolders() error {
+	for offset := 0; ; offset += adminPageSize {
+		folders, err := dataprovider.GetFolders(adminPageSize, offset, dataprovider.OrderASC, false)
+		if err != nil {
+			return err
+		}
+		for idx := range folders {
+			folder := &folders[idx]
+			if !isDeduplicationEnabled(folder.FsConfig) {
+				continue
+			}
+			f := vfs.VirtualFolder{
+				BaseVirtualFolder: *folder,
+				VirtualPath:       "/",
+			}
+			fs, err := f.GetFilesystem("", nil)
+			if err != nil {
+				logger.WarnToConsole("unable to get the filesystem for folder %q: %v", folder.Name, err)
+				continue
+			}
+			if !deduplicateFs(fs, folder.Name) {
+				continue
+			}
+			numFiles, size, err := f.ScanQuota()
+			if err == nil {
+				err = dataprovider.UpdateVirtualFolderQuota(folder, numFiles, size, true)
+			}
+			if err != nil {
+				logger.WarnToConsole("unable to update the quota for folder %q: %v", folder.Name, err)
+			}
+		}
+		if len(folders) < adminPageSize {
+			return nil
+		}
+	}
+}
+
+func init() {
+	addConfigFlags(adminDeduplicateCmd)
+	adminCmd.AddCommand(adminDeduplicateCmd)
+	rootCmd.AddCommand(adminCmd)
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/drakkan/sftpgo/v2/pkg/config"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+var (
+	onlineMigrateBatchSize    int
+	onlineMigratePauseVersion int
+	onlineMigrateCmd          = &cobra.Command{
+		Use:   "online-migrate",
+		Short: "Update the configured data provider using online schema migrations",
+		Long: `This command reads the data provider connection details from the specified
+configuration file and updates the schema to the latest version.
+
+For PostgreSQL and MySQL, schema changes that would lock large tables are
+applied using online migrations: new columns are added as nullable, existing
+rows are backfilled in small batches, the constraints are added at the end and
+the new indexes are built without blocking writes. New tables and other schema changes and other data providers use the standard migrations.
+This command can run while an older SFTPGo version is serving requests.
+
+A running online migration can be paused using the "--pause" flag or the REST
+API. Paused and failed migrations are resumed by running this command again.
+
+To update the data provider from the configuration directory simply use:
+
+$ sftpgo online-migrate
+
+Please take a look at the usage below to customize the options.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			logger.DisableLogger()
+			logger.EnableConsoleLogger(zerolog.DebugLevel)
+			configDir = util.CleanDirInput(configDir)
+			err := config.LoadConfig(configDir, configFile)
+			if err != nil {
+				logger.ErrorToConsole("Unable to initialize data provider, config load error: %v", err)
+				os.Exit(1)
+			}
+			kmsConfig := config.GetKMSConfig()
+			err = kmsConfig.Initialize()
+			if err != nil {
+				logger.ErrorToConsole("Unable to initialize KMS: %v", err)
+				os.Exit(1)
+			}
+			providerConf := config.GetProviderConf()
+			// ignore actions
+			providerConf.Actions.Hook = ""
+			providerConf.Actions.ExecuteFor = nil
+			providerConf.Actions.ExecuteOn = nil
+			if onlineMigratePauseVersion > 0 {
+				err = dataprovider.PauseOnlineDatabaseMigration(providerConf, configDir, onlineMigratePauseVersion)
+				if err != nil {
+					logger.ErrorToConsole("Unable to pause the online migration: %v", err)
+					os.Exit(1)
+				}
+				logger.InfoToConsole("Online migration to version %d paused", onlineMigratePauseVersion)
+				return
+			}
+			logger.InfoToConsole("Updating provider: %#v config file: %#v", providerConf.Driver, viper.ConfigFileUsed())
+			err = dataprovider.OnlineMigrateDatabase(providerConf, configDir, onlineMigrateBatchSize)
+			switch {
+			case err == nil:
+				logger.InfoToConsole("Data provider successfully updated")
+			case errors.Is(err, dataprovider.ErrNoInitRequired):
+				logger.InfoToConsole("%v", err.Error())
+			case errors.Is(err, dataprovider.ErrOnlineMigrationPaused):
+				logger.WarnToConsole("The online migration is paused, run this command again to resume it")
+			default:
+				logger.ErrorToConsole("Unable to update the data provider: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	addConfigFlags(onlineMigrateCmd)
+	onlineMigrateCmd.Flags().IntVar(&onlineMigrateBatchSize, "batch-size", 1000, `Number of rows to update in each
+backfill batch`)
+	onlineMigrateCmd.Flags().IntVar(&onlineMigratePauseVersion, "pause", 0, `Pause the running online migration to
+the specified schema version and exit`)
+
+	rootCmd.AddCommand(onlineMigrateCmd)
+}
@@ -0,0 +1,295 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/version"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+// Supported access log formats
+const (
+	// W3C Extended Log File Format
+	AccessLogFormatW3C = "w3c"
+)
+
+// Access log methods
+const (
+	accessLogMethodUpload   = "UPLOAD"
+	accessLogMethodDownload = "DOWNLOAD"
+	accessLogMethodDelete   = "DELETE"
+	accessLogMethodRename   = "RENAME"
+	accessLogMethodCopy     = "COPY"
+	accessLogMethodMkdir    = "MKDIR"
+	accessLogMethodRmdir    = "RMDIR"
+	accessLogMethodLink     = "LINK"
+)
+
+const (
+	w3cAccessLogFields = "date time c-ip cs-username cs-method cs-uri-stem sc-status sc-bytes cs-bytes time-taken " +
+		"sftp-version sftp-extension"
+	sftpExtensionHardlink = "hardlink@openssh.com"
+)
+
+// result of an operation, mapped to the protocol specific status codes
+const (
+	accessLogResultOK = iota
+	accessLogResultNotFound
+	accessLogResultPermissionDenied
+	accessLogResultQuotaExceeded
+	accessLogResultUnsupported
+	accessLogResultAborted
+	accessLogResultFailure
+)
+
+var accessLog *accessLogger
+
+// AccessLogConfig defines the configuration for the access log. An entry is written
+// for each file transfer and file management command. The access log is rotated
+// independently from the main log
+type AccessLogConfig struct {
+	// Log format, supported values: "w3c". Empty means disabled
+	Format string `json:"format" mapstructure:"format"`
+	// Absolute path to the access log file
+	Path string `json:"path" mapstructure:"path"`
+	// Rotation policy: daily, weekly or size
+	RotatePolicy string `json:"rotate_policy" mapstructure:"rotate_policy"`
+	// Maximum size, in MB, before rotating the log file, used for the size policy
+	MaxSize int `json:"max_size" mapstructure:"max_size"`
+}
+
+func (c *AccessLogConfig) isEnabled() bool {
+	return c.Format != ""
+}
+
+func (c *AccessLogConfig) getRotation() vfs.FolderAuditLog {
+	return vfs.FolderAuditLog{
+		LogFile:      filepath.Base(c.Path),
+		RotatePolicy: c.RotatePolicy,
+		MaxSize:      c.MaxSize,
+	}
+}
+
+func (c *AccessLogConfig) validate() error {
+	if !c.isEnabled() {
+		return nil
+	}
+	if c.Format != AccessLogFormatW3C {
+		return fmt.Errorf("unsupported access log format %q", c.Format)
+	}
+	if !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("invalid access log path %q, it must be an absolute path", c.Path)
+	}
+	c.Path = filepath.Clean(c.Path)
+	rotation := c.getRotation()
+	if err := rotation.Validate(); err != nil {
+		return fmt.Errorf("invalid access log configuration: %w", err)
+	}
+	c.RotatePolicy = rotation.RotatePolicy
+	c.MaxSize = rotation.MaxSize
+	return nil
+}
+
+// accessLogger writes the access log entries, the log file is rotated using
+// the same policies as the folder audit logs
+type accessLogger struct {
+	rotation vfs.FolderAuditLog
+	writer   *folderAuditLogWriter
+	// tracks the background compressions
+	compressWg sync.WaitGroup
+}
+
+func newAccessLogger(c *AccessLogConfig) *accessLogger {
+	return &accessLogger{
+		rotation: c.getRotation(),
+		writer: &folderAuditLogWriter{
+			path:   c.Path,
+			header: getW3CAccessLogHeader,
+		},
+	}
+}
+
+func (l *accessLogger) write(line string) error {
+	if err := os.MkdirAll(filepath.Dir(l.writer.path), 0700); err != nil {
+		return err
+	}
+	return l.writer.write(&l.rotation, []byte(line), &l.compressWg)
+}
+
+// close closes the log file and waits for the pending compressions
+func (l *accessLogger) close() {
+	l.writer.Lock()
+	if l.writer.file != nil {
+		l.writer.file.Close()
+		l.writer.file = nil
+	}
+	l.writer.Unlock()
+
+	l.compressWg.Wait()
+}
+
+func initializeAccessLog(c *AccessLogConfig) {
+	if accessLog != nil {
+		accessLog.close()
+	}
+	accessLog = nil
+	if c.isEnabled() {
+		accessLog = newAccessLogger(c)
+	}
+}
+
+func getW3CAccessLogHeader(now time.Time) []byte {
+	return []byte(fmt.Sprintf("#Software: SFTPGo %s\n#Version: 1.0\n#Date: %s\n#Fields: %s\n",
+		version.Get().Version, now.UTC().Format("2006-01-02 15:04:05"), w3cAccessLogFields))
+}
+
+// getW3CFieldValue returns the value to use for a W3C field, "-" means no value
+func getW3CFieldValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func getW3CAccessLogLine(conn *BaseConnection, method, virtualPath string, sentBytes, receivedBytes int64,
+	elapsed time.Duration, err error,
+) string {
+	now := time.Now().UTC()
+	sftpVersion := ""
+	if conn.GetSFTPVersion() > 0 {
+		sftpVersion = strconv.Itoa(conn.GetSFTPVersion())
+	}
+	sftpExtension := ""
+	if method == accessLogMethodLink && conn.protocol == ProtocolSFTP {
+		sftpExtension = sftpExtensionHardlink
+	}
+	fields := []string{
+		now.Format("2006-01-02"),
+		now.Format("15:04:05"),
+		getW3CFieldValue(conn.GetRemoteIP()),
+		getW3CFieldValue(url.PathEscape(conn.User.Username)),
+		method,
+		getW3CFieldValue((&url.URL{Path: virtualPath}).EscapedPath()),
+		strconv.Itoa(getAccessLogStatus(conn, method, err)),
+		strconv.FormatInt(sentBytes, 10),
+		strconv.FormatInt(receivedBytes, 10),
+		strconv.FormatFloat(elapsed.Seconds(), 'f', 3, 64),
+		getW3CFieldValue(sftpVersion),
+		getW3CFieldValue(sftpExtension),
+	}
+	return strings.Join(fields, " ") + "\n"
+}
+
+// logAccess writes an access log entry for the specified operation, if the access log is enabled
+func logAccess(conn *BaseConnection, method, virtualPath string, sentBytes, receivedBytes int64,
+	elapsed time.Duration, err error,
+) {
+	if accessLog == nil {
+		return
+	}
+	line := getW3CAccessLogLine(conn, method, virtualPath, sentBytes, receivedBytes, elapsed, err)
+	if errWrite := accessLog.write(line); errWrite != nil {
+		conn.Log(logger.LevelError, "unable to write access log: %v", errWrite)
+	}
+}
+
+func getAccessLogResult(conn *BaseConnection, err error) int {
+	switch {
+	case err == nil:
+		return accessLogResultOK
+	case errors.Is(err, ErrNotExist), errors.Is(err, os.ErrNotExist), errors.Is(err, sftp.ErrSSHFxNoSuchFile):
+		return accessLogResultNotFound
+	case errors.Is(err, ErrPermissionDenied), errors.Is(err, os.ErrPermission),
+		errors.Is(err, sftp.ErrSSHFxPermissionDenied):
+		return accessLogResultPermissionDenied
+	case conn.IsQuotaExceededError(err), strings.Contains(err.Error(), ErrReadQuotaExceeded.Error()):
+		return accessLogResultQuotaExceeded
+	case errors.Is(err, ErrOpUnsupported), errors.Is(err, sftp.ErrSSHFxOpUnsupported):
+		return accessLogResultUnsupported
+	case errors.Is(err, ErrTransferAborted):
+		return accessLogResultAborted
+	default:
+		return accessLogResultFailure
+	}
+}
+
+// getAccessLogStatus returns the protocol specific result code: SFTP status codes
+// for SFTP, SCP and SSH commands, FTP reply codes for FTP and HTTP status codes
+// for the other protocols
+func getAccessLogStatus(conn *BaseConnection, method string, err error) int {
+	result := getAccessLogResult(conn, err)
+	switch conn.protocol {
+	case ProtocolSFTP, ProtocolSCP, ProtocolSSH:
+		switch result {
+		case accessLogResultOK:
+			return 0
+		case accessLogResultNotFound:
+			return 2
+		case accessLogResultPermissionDenied:
+			return 3
+		case accessLogResultUnsupported:
+			return 8
+		default:
+			return 4
+		}
+	case ProtocolFTP:
+		switch result {
+		case accessLogResultOK:
+			if method == accessLogMethodUpload || method == accessLogMethodDownload {
+				return 226
+			}
+			return 250
+		case accessLogResultQuotaExceeded:
+			return 552
+		case accessLogResultUnsupported:
+			return 502
+		case accessLogResultAborted:
+			return 426
+		default:
+			return 550
+		}
+	default:
+		switch result {
+		case accessLogResultOK:
+			if method == accessLogMethodUpload {
+				return 201
+			}
+			return 200
+		case accessLogResultNotFound:
+			return 404
+		case accessLogResultPermissionDenied:
+			return 403
+		case accessLogResultQuotaExceeded:
+			return 413
+		case accessLogResultUnsupported:
+			return 501
+		default:
+			return 500
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+func TestAccessLogConfig(t *testing.T) {
+	config := AccessLogConfig{}
+	assert.NoError(t, config.validate())
+	config.Format = "json"
+	assert.Error(t, config.validate())
+	config.Format = AccessLogFormatW3C
+	assert.Error(t, config.validate())
+	config.Path = "relative.log"
+	assert.Error(t, config.validate())
+	config.Path = filepath.Join(os.TempDir(), "logs", "..", "access.log")
+	assert.NoError(t, config.validate())
+	assert.Equal(t, filepath.Join(os.TempDir(), "access.log"), config.Path)
+	assert.Equal(t, vfs.AuditLogRotateDaily, config.RotatePolicy)
+	config.RotatePolicy = vfs.AuditLogRotateSize
+	assert.NoError(t, config.validate())
+	assert.Equal(t, 100, config.MaxSize)
+	config.RotatePolicy = "monthly"
+	assert.Error(t, config.validate())
+}
+
+func TestW3CAccessLog(t *testing.T) {
+	config := AccessLogConfig{
+		Format: AccessLogFormatW3C,
+		Path:   filepath.Join(t.TempDir(), "logs", "access.log"),
+	}
+	require.NoError(t, config.validate())
+	initializeAccessLog(&config)
+	defer initializeAccessLog(&AccessLogConfig{})
+
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Clean(os.TempDir()),
+		},
+	}
+	conn := NewBaseConnection("connid", ProtocolSFTP, "", "127.0.0.1:2222", user)
+	conn.SetSFTPVersion(3)
+	logAccess(conn, accessLogMethodUpload, "/dir/file name", 0, 1024, 1500*time.Millisecond, nil)
+	logAccess(conn, accessLogMethodDownload, "/missing", 0, 0, 0, sftp.ErrSSHFxNoSuchFile)
+	logAccess(conn, accessLogMethodLink, "/dir/file name", 0, 0, 0, nil)
+	conn = NewBaseConnection("connid", ProtocolFTP, "", "127.0.0.1:2121", user)
+	logAccess(conn, accessLogMethodDownload, "/file", 2048, 0, 0, nil)
+
+	content, err := os.ReadFile(config.Path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if assert.Len(t, lines, 8) {
+		assert.True(t, strings.HasPrefix(lines[0], "#Software: SFTPGo "))
+		assert.Equal(t, "#Version: 1.0", lines[1])
+		assert.True(t, strings.HasPrefix(lines[2], "#Date: "))
+		assert.Equal(t, "#Fields: "+w3cAccessLogFields, lines[3])
+		fields := strings.Fields(lines[4])
+		if assert.Len(t, fields, 12) {
+			assert.Equal(t, "127.0.0.1", fields[2])
+			assert.Equal(t, userTestUsername, fields[3])
+			assert.Equal(t, accessLogMethodUpload, fields[4])
+			assert.Equal(t, "/dir/file%20name", fields[5])
+			assert.Equal(t, "0", fields[6])
+			assert.Equal(t, "0", fields[7])
+			assert.Equal(t, "1024", fields[8])
+			assert.Equal(t, "1.500", fields[9])
+			assert.Equal(t, "3", fields[10])
+			assert.Equal(t, "-", fields[11])
+		}
+		assert.Equal(t, []string{accessLogMethodDownload, "/missing", "2"}, strings.Fields(lines[5])[4:7])
+		assert.Equal(t, []string{"3", sftpExtensionHardlink}, strings.Fields(lines[6])[10:])
+		assert.Equal(t, []string{accessLogMethodDownload, "/file", "226", "2048", "0", "0.000", "-", "-"},
+			strings.Fields(lines[7])[4:])
+	}
+}
+
+func TestAccessLogStatus(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+		},
+	}
+	sftpConn := NewBaseConnection("", ProtocolSFTP, "", "", user)
+	ftpConn := NewBaseConnection("", ProtocolFTP, "", "", user)
+	httpConn := NewBaseConnection("", ProtocolHTTP, "", "", user)
+
+	assert.Equal(t, 0, getAccessLogStatus(sftpConn, accessLogMethodDelete, nil))
+	assert.Equal(t, 2, getAccessLogStatus(sftpConn, accessLogMethodDownload, sftpConn.GetNotExistError()))
+	assert.Equal(t, 3, getAccessLogStatus(sftpConn, accessLogMethodUpload, sftpConn.GetPermissionDeniedError()))
+	assert.Equal(t, 4, getAccessLogStatus(sftpConn, accessLogMethodUpload, sftpConn.GetQuotaExceededError()))
+	assert.Equal(t, 8, getAccessLogStatus(sftpConn, accessLogMethodLink, sftpConn.GetOpUnsupportedError()))
+	assert.Equal(t, 4, getAccessLogStatus(sftpConn, accessLogMethodUpload, errors.New("generic error")))
+
+	assert.Equal(t, 226, getAccessLogStatus(ftpConn, accessLogMethodUpload, nil))
+	assert.Equal(t, 250, getAccessLogStatus(ftpConn, accessLogMethodRename, nil))
+	assert.Equal(t, 550, getAccessLogStatus(ftpConn, accessLogMethodDownload, ftpConn.GetNotExistError()))
+	assert.Equal(t, 552, getAccessLogStatus(ftpConn, accessLogMethodUpload, ftpConn.GetQuotaExceededError()))
+	assert.Equal(t, 426, getAccessLogStatus(ftpConn, accessLogMethodUpload, ErrTransferAborted))
+
+	assert.Equal(t, 201, getAccessLogStatus(httpConn, accessLogMethodUpload, nil))
+	assert.Equal(t, 200, getAccessLogStatus(httpConn, accessLogMethodDelete, nil))
+	assert.Equal(t, 404, getAccessLogStatus(httpConn, accessLogMethodDownload, httpConn.GetNotExistError()))
+	assert.Equal(t, 403, getAccessLogStatus(httpConn, accessLogMethodDelete, httpConn.GetPermissionDeniedError()))
+	assert.Equal(t, 413, getAccessLogStatus(httpConn, accessLogMethodUpload, httpConn.GetQuotaExceededError()))
+	assert.Equal(t, 413, getAccessLogStatus(httpConn, accessLogMethodDownload, httpConn.GetReadQuotaExceededError()))
+	assert.Equal(t, 500, getAccessLogStatus(httpConn, accessLogMethodUpload, errors.New("generic error")))
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	config := AccessLogConfig{
+		Format: AccessLogFormatW3C,
+		Path:   filepath.Join(t.TempDir(), "access.log"),
+	}
+	require.NoError(t, config.validate())
+	initializeAccessLog(&config)
+	defer initializeAccessLog(&AccessLogConfig{})
+
+	conn := NewBaseConnection("connid", ProtocolWebDAV, "", "127.0.0.1:8080", dataprovider.User{})
+	logAccess(conn, accessLogMethodMkdir, "/dir", 0, 0, 0, nil)
+	// simulate a write on the previous day
+	accessLog.writer.lastWrite = time.Now().Add(-24 * time.Hour)
+	logAccess(conn, accessLogMethodRmdir, "/dir", 0, 0, 0, nil)
+	accessLog.compressWg.Wait()
+
+	entries, err := os.ReadDir(filepath.Dir(config.Path))
+	require.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, filepath.Base(config.Path), entries[0].Name())
+		assert.True(t, strings.HasSuffix(entries[1].Name(), auditLogCompressedExt))
+	}
+	content, err := os.ReadFile(config.Path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if assert.Len(t, lines, 5) {
+		assert.Equal(t, "#Version: 1.0", lines[1])
+		assert.Equal(t, []string{"127.0.0.1", "-", accessLogMethodRmdir, "/dir", "200"}, strings.Fields(lines[4])[2:7])
+	}
+}
@@ -29,9 +29,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
 	"github.com/sftpgo/sdk/plugin/notifier"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
@@ -69,6 +71,8 @@ type ProtocolActions struct {
 	ExecuteSync []string `json:"execute_sync" mapstructure:"execute_sync"`
 	// Absolute path to an external program or an HTTP URL
 	Hook string `json:"hook" mapstructure:"hook"`
+	// Steps to execute sequentially after a successful upload
+	Pipeline []PipelineStep `json:"pipeline" mapstructure:"pipeline"`
 }
 
 var actionHandler ActionHandler = &defaultActionHandler{}
@@ -113,10 +117,12 @@ func ExecutePreAction(conn *BaseConnection, operation, filePath, virtualPath str
 func ExecuteActionNotification(conn *BaseConnection, operation, filePath, virtualPath, target, virtualTarget, sshCmd string,
 	fileSize int64, err error,
 ) error {
+	logFolderAuditEvent(conn, operation, virtualPath, virtualTarget, sshCmd, fileSize, err)
 	hasNotifiersPlugin := plugin.Handler.HasNotifiers()
 	hasHook := util.Contains(Config.Actions.ExecuteOn, operation)
 	hasRules := eventManager.hasFsRules()
-	if !hasHook && !hasNotifiersPlugin && !hasRules {
+	hasPipeline := hasPipeline(operation, err) && conn.protocol != protocolEventAction
+	if !hasHook && !hasNotifiersPlugin && !hasRules && !hasPipeline {
 		return nil
 	}
 	notification := newActionNotification(&conn.User, operation, filePath, virtualPath, target, virtualTarget, sshCmd,
@@ -138,6 +144,7 @@ func ExecuteActionNotification(conn *BaseConnection, operation, filePath, virtua
 			ObjectName:        path.Base(notification.VirtualPath),
 			FileSize:          notification.FileSize,
 			Protocol:          notification.Protocol,
+			SFTPVersion:       conn.GetSFTPVersion(),
 			IP:                notification.IP,
 			Timestamp:         notification.Timestamp,
 			Object:            nil,
@@ -161,9 +168,41 @@ func ExecuteActionNotification(conn *BaseConnection, operation, filePath, virtua
 			}()
 		}
 	}
+	if hasPipeline {
+		if util.Contains(Config.Actions.ExecuteSync, operation) {
+			if errPipeline := executePipeline(*notification, true); errPipeline != nil {
+				errRes = errPipeline
+			}
+		} else {
+			go func() {
+				startNewHook()
+				defer hookEnded()
+
+				executePipeline(*notification, false) //nolint:errcheck
+			}()
+		}
+	}
 	return errRes
 }
 
+// HandleStorageEvent logs an upload or a delete notified by the storage backend, for
+// example for a file written directly to a cloud storage bucket, and executes the defined
+// upload hooks, if any. The remote address is the address of the notification sender
+func HandleStorageEvent(user *dataprovider.User, isDelete bool, fsPath, virtualPath string, fileSize int64,
+	remoteAddr string,
+) error {
+	connectionID := fmt.Sprintf("%s_%s", ProtocolStorageEvent, xid.New().String())
+	if isDelete {
+		logger.CommandLog(removeLogSender, fsPath, "", user.Username, "", connectionID, ProtocolStorageEvent, -1, -1,
+			"", "", "", -1, "", remoteAddr)
+		return nil
+	}
+	logger.TransferLog(uploadLogSender, fsPath, 0, fileSize, user.Username, connectionID, ProtocolStorageEvent, "",
+		remoteAddr, "")
+	conn := NewBaseConnection(connectionID, ProtocolStorageEvent, "", remoteAddr, *user)
+	return ExecuteActionNotification(conn, operationUpload, fsPath, virtualPath, "", "", "", fileSize, nil)
+}
+
 // ActionHandler handles a notification for a Protocol Action.
 type ActionHandler interface {
 	Handle(notification *notifier.FsEvent) error
@@ -252,14 +291,25 @@ func (h *defaultActionHandler) handleHTTP(event *notifier.FsEvent) error {
 	var b bytes.Buffer
 	_ = json.NewEncoder(&b).Encode(event)
 
-	resp, err := httpclient.RetryablePost(Config.Actions.Hook, "application/json", &b)
-	if err == nil {
+	var hookErr error
+	err = circuitbreaker.Execute(command.HookFsActions, func() error {
+		resp, err := httpclient.RetryablePost(Config.Actions.Hook, "application/json", &b)
+		if err != nil {
+			return err
+		}
 		respCode = resp.StatusCode
 		resp.Body.Close()
 
 		if respCode != http.StatusOK {
-			err = errUnexpectedHTTResponse
+			hookErr = errUnexpectedHTTResponse
 		}
+		if respCode >= http.StatusInternalServerError {
+			return hookErr
+		}
+		return nil
+	})
+	if err == nil {
+		err = hookErr
 	}
 
 	logger.Debug(event.Protocol, "", "notified operation %q to URL: %s status code: %d, elapsed: %s err: %v",
@@ -284,7 +334,14 @@ func (h *defaultActionHandler) handleCommand(event *notifier.FsEvent) error {
 	cmd.Env = append(env, notificationAsEnvVars(event)...)
 
 	startTime := time.Now()
-	err := cmd.Run()
+	var cmdErr error
+	err := circuitbreaker.Execute(command.HookFsActions, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
 
 	logger.Debug(event.Protocol, "", "executed command %#v, elapsed: %v, error: %v",
 		Config.Actions.Hook, time.Since(startTime), err)
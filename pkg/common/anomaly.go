@@ -0,0 +1,354 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
+	"github.com/drakkan/sftpgo/v2/pkg/command"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// file operations checked against the anomaly rules
+const (
+	anomalyOpDownload = iota
+	anomalyOpUpload
+	anomalyOpDelete
+)
+
+const (
+	// max security events kept in memory for each user
+	securityEventsMaxPerUser = 100
+	// an unusual hours rule triggers at most once within this interval
+	unusualHoursTriggerInterval = time.Hour
+	// the counters for the users without file operations within this
+	// interval are removed
+	anomalyStatsMaxIdleTime = 24 * time.Hour
+)
+
+var anomalyDetector = newAnomalyRulesDetector()
+
+// SecurityEvent defines a security event emitted when an anomaly rule triggers
+type SecurityEvent struct {
+	// Unix timestamp in milliseconds
+	Timestamp   int64  `json:"timestamp"`
+	Username    string `json:"username"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	IP          string `json:"ip"`
+	Protocol    string `json:"protocol"`
+	// number of events within the rule window, not set for the unusual hours rules
+	Count int `json:"count,omitempty"`
+}
+
+// GetUserSecurityEvents returns the security events emitted for the specified user,
+// the most recent first. The events are kept in memory, they are lost on restart
+func GetUserSecurityEvents(username string) []SecurityEvent {
+	return anomalyDetector.getEvents(username)
+}
+
+// anomalyUserStats stores the recent file operations for a user
+type anomalyUserStats struct {
+	downloads    []time.Time
+	deletions    []time.Time
+	networks     map[string]time.Time
+	lastTriggers map[string]time.Time
+	lastAccess   time.Time
+}
+
+func newAnomalyUserStats() *anomalyUserStats {
+	return &anomalyUserStats{
+		networks:     make(map[string]time.Time),
+		lastTriggers: make(map[string]time.Time),
+	}
+}
+
+// addAnomalyOperation records an operation at the specified time and returns the number
+// of operations within the window
+func addAnomalyOperation(operations []time.Time, now time.Time, window time.Duration) ([]time.Time, int) {
+	idx := 0
+	for idx < len(operations) && now.Sub(operations[idx]) >= window {
+		idx++
+	}
+	operations = append(operations[idx:], now)
+	return operations, len(operations)
+}
+
+func (s *anomalyUserStats) addNetwork(network string, now time.Time, window time.Duration) int {
+	s.networks[network] = now
+	for k, v := range s.networks {
+		if now.Sub(v) >= window {
+			delete(s.networks, k)
+		}
+	}
+	return len(s.networks)
+}
+
+// canTrigger returns true, and records the trigger, if the rule did not
+// trigger within the specified interval
+func (s *anomalyUserStats) canTrigger(ruleType string, now time.Time, interval time.Duration) bool {
+	if last, ok := s.lastTriggers[ruleType]; ok && now.Sub(last) < interval {
+		return false
+	}
+	s.lastTriggers[ruleType] = now
+	return true
+}
+
+type anomalyTrigger struct {
+	rule  dataprovider.AnomalyRule
+	count int
+}
+
+// anomalyRulesDetector checks the file operations against the user anomaly rules.
+// This is a threshold based detector, the counters are kept in memory
+type anomalyRulesDetector struct {
+	mu     sync.Mutex
+	stats  map[string]*anomalyUserStats
+	events map[string][]SecurityEvent
+}
+
+func newAnomalyRulesDetector() *anomalyRulesDetector {
+	return &anomalyRulesDetector{
+		stats:  make(map[string]*anomalyUserStats),
+		events: make(map[string][]SecurityEvent),
+	}
+}
+
+// check updates the counters for the specified operation and returns the triggered rules
+func (d *anomalyRulesDetector) check(rules []dataprovider.AnomalyRule, username, ip string, op int,
+	now time.Time,
+) []anomalyTrigger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats, ok := d.stats[username]
+	if !ok {
+		stats = newAnomalyUserStats()
+		d.stats[username] = stats
+	}
+	stats.lastAccess = now
+
+	var triggers []anomalyTrigger
+	for _, rule := range rules {
+		window := time.Duration(rule.Window) * time.Minute
+		count := 0
+		switch rule.Type {
+		case dataprovider.AnomalyRuleDownloads:
+			if op != anomalyOpDownload {
+				continue
+			}
+			stats.downloads, count = addAnomalyOperation(stats.downloads, now, window)
+		case dataprovider.AnomalyRuleDeletions:
+			if op != anomalyOpDelete {
+				continue
+			}
+			stats.deletions, count = addAnomalyOperation(stats.deletions, now, window)
+		case dataprovider.AnomalyRuleMultipleNetworks:
+			network := getAnomalyNetwork(ip)
+			if network == "" {
+				continue
+			}
+			count = stats.addNetwork(network, now, window)
+		case dataprovider.AnomalyRuleUnusualHours:
+			if rule.IsAllowedHour(now.UTC().Hour()) {
+				continue
+			}
+			if stats.canTrigger(rule.Type, now, unusualHoursTriggerInterval) {
+				triggers = append(triggers, anomalyTrigger{rule: rule})
+			}
+			continue
+		default:
+			continue
+		}
+		if count > rule.Threshold && stats.canTrigger(rule.Type, now, window) {
+			triggers = append(triggers, anomalyTrigger{rule: rule, count: count})
+		}
+	}
+	return triggers
+}
+
+func (d *anomalyRulesDetector) addEvent(event SecurityEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := append([]SecurityEvent{event}, d.events[event.Username]...)
+	if len(events) > securityEventsMaxPerUser {
+		events = events[:securityEventsMaxPerUser]
+	}
+	d.events[event.Username] = events
+}
+
+func (d *anomalyRulesDetector) getEvents(username string) []SecurityEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	events := make([]SecurityEvent, len(d.events[username]))
+	copy(events, d.events[username])
+	return events
+}
+
+// cleanup removes the counters for the idle users
+func (d *anomalyRulesDetector) cleanup() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for username, stats := range d.stats {
+		if time.Since(stats.lastAccess) > anomalyStatsMaxIdleTime {
+			delete(d.stats, username)
+		}
+	}
+}
+
+// getAnomalyNetwork returns the network for the specified IP, a /16 network for
+// IPv4 and a /48 network for IPv6. Accesses from different networks within a short
+// window can indicate that the credentials are used from distant locations
+func getAnomalyNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(16, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// checkAnomalies checks the specified file operation against the user anomaly rules
+func (c *BaseConnection) checkAnomalies(op int) {
+	switch op {
+	case anomalyOpDownload:
+		c.downloadsCount.Add(1)
+	case anomalyOpDelete:
+		c.deletionsCount.Add(1)
+	}
+	if len(c.User.Filters.AnomalyRules) == 0 {
+		return
+	}
+	if c.protocol == ProtocolDataRetention || c.protocol == protocolEventAction {
+		return
+	}
+	now := time.Now()
+	for _, trigger := range anomalyDetector.check(c.User.Filters.AnomalyRules, c.User.Username, c.GetRemoteIP(), op, now) {
+		if trigger.rule.Simulate {
+			c.Log(logger.LevelInfo, "anomaly rule %q would trigger: %s, count: %d, downloads: %d, deletions: %d, simulate mode",
+				trigger.rule.Type, trigger.rule.GetDescription(), trigger.count, c.downloadsCount.Load(),
+				c.deletionsCount.Load())
+			continue
+		}
+		event := SecurityEvent{
+			Timestamp:   util.GetTimeAsMsSinceEpoch(now),
+			Username:    c.User.Username,
+			Rule:        trigger.rule.Type,
+			Description: trigger.rule.GetDescription(),
+			IP:          c.GetRemoteIP(),
+			Protocol:    c.protocol,
+			Count:       trigger.count,
+		}
+		c.Log(logger.LevelWarn, "anomaly rule %q triggered: %s, count: %d, downloads: %d, deletions: %d",
+			event.Rule, event.Description, event.Count, c.downloadsCount.Load(), c.deletionsCount.Load())
+		emitSecurityEvent(event)
+	}
+}
+
+func emitSecurityEvent(event SecurityEvent) {
+	anomalyDetector.addEvent(event)
+	smtp.AddSecurityAlert(smtp.SecurityAlert{
+		Event:     smtp.SecurityAlertFileAccessAnomaly,
+		Timestamp: util.GetTimeFromMsecSinceEpoch(event.Timestamp),
+		Username:  event.Username,
+		IP:        event.IP,
+		Protocol:  event.Protocol,
+	})
+	if Config.SecurityEventHook != "" {
+		go func() {
+			if err := notifySecurityEvent(event); err != nil {
+				logger.Warn(logSender, "", "unable to notify security event for user %q: %v", event.Username, err)
+			}
+		}()
+	}
+}
+
+func notifySecurityEvent(event SecurityEvent) error {
+	startNewHook()
+	defer hookEnded()
+
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	if strings.HasPrefix(Config.SecurityEventHook, "http") {
+		respCode := 0
+		var hookErr error
+		err = circuitbreaker.Execute(command.HookSecurityEvent, func() error {
+			resp, err := httpclient.RetryablePost(Config.SecurityEventHook, "application/json", bytes.NewBuffer(jsonData))
+			if err != nil {
+				return err
+			}
+			respCode = resp.StatusCode
+			resp.Body.Close()
+
+			if respCode != http.StatusOK {
+				hookErr = errUnexpectedHTTResponse
+			}
+			if respCode >= http.StatusInternalServerError {
+				return hookErr
+			}
+			return nil
+		})
+		if err == nil {
+			err = hookErr
+		}
+		logger.Debug(logSender, "", "security event for user %q notified to URL: %s, status code: %d, elapsed: %s, err: %v",
+			event.Username, util.GetRedactedURL(Config.SecurityEventHook), respCode, time.Since(startTime), err)
+		return err
+	}
+	if !filepath.IsAbs(Config.SecurityEventHook) {
+		return fmt.Errorf("invalid security event hook %q", Config.SecurityEventHook)
+	}
+	timeout, env, args := command.GetConfig(Config.SecurityEventHook, command.HookSecurityEvent)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, Config.SecurityEventHook, args...)
+	cmd.Env = append(env, fmt.Sprintf("SFTPGO_SECURITY_EVENT=%s", string(jsonData)))
+	var cmdErr error
+	err = circuitbreaker.Execute(command.HookSecurityEvent, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
+	logger.Debug(logSender, "", "security event for user %q notified using command: %s, elapsed: %s, err: %v",
+		event.Username, Config.SecurityEventHook, time.Since(startTime), err)
+	return err
+}
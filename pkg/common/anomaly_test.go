@@ -0,0 +1,142 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+)
+
+func TestAnomalyRulesDetector(t *testing.T) {
+	d := newAnomalyRulesDetector()
+	rules := []dataprovider.AnomalyRule{
+		{
+			Type:      dataprovider.AnomalyRuleDownloads,
+			Threshold: 2,
+			Window:    1,
+		},
+		{
+			Type:      dataprovider.AnomalyRuleMultipleNetworks,
+			Threshold: 1,
+			Window:    10,
+		},
+	}
+	now := time.Now()
+	assert.Len(t, d.check(rules, "user", "192.168.1.1", anomalyOpDownload, now), 0)
+	assert.Len(t, d.check(rules, "user", "192.168.2.1", anomalyOpDownload, now.Add(10*time.Second)), 0)
+	// the first download is outside the window
+	assert.Len(t, d.check(rules, "user", "192.168.3.1", anomalyOpUpload, now.Add(61*time.Second)), 0)
+	assert.Len(t, d.check(rules, "user", "192.168.3.1", anomalyOpDownload, now.Add(61*time.Second)), 0)
+	triggers := d.check(rules, "user", "192.168.3.1", anomalyOpDownload, now.Add(62*time.Second))
+	if assert.Len(t, triggers, 1) {
+		assert.Equal(t, dataprovider.AnomalyRuleDownloads, triggers[0].rule.Type)
+		assert.Equal(t, 3, triggers[0].count)
+	}
+	// already triggered within the window
+	assert.Len(t, d.check(rules, "user", "192.168.4.1", anomalyOpDownload, now.Add(63*time.Second)), 0)
+	// the previous downloads are outside the window
+	assert.Len(t, d.check(rules, "user", "192.168.4.1", anomalyOpDownload, now.Add(130*time.Second)), 0)
+	assert.Len(t, d.stats["user"].downloads, 1)
+
+	triggers = d.check(rules, "user", "10.1.2.3", anomalyOpDelete, now.Add(140*time.Second))
+	if assert.Len(t, triggers, 1) {
+		assert.Equal(t, dataprovider.AnomalyRuleMultipleNetworks, triggers[0].rule.Type)
+		assert.Equal(t, 2, triggers[0].count)
+	}
+	assert.Len(t, d.check(rules, "user", "172.16.1.1", anomalyOpDelete, now.Add(150*time.Second)), 0)
+	// the counters are per user
+	assert.Len(t, d.check(rules, "user1", "10.1.2.3", anomalyOpDownload, now.Add(150*time.Second)), 0)
+
+	hour := now.UTC().Hour()
+	rules = []dataprovider.AnomalyRule{
+		{
+			Type:      dataprovider.AnomalyRuleUnusualHours,
+			StartHour: (hour + 1) % 24,
+			EndHour:   (hour + 2) % 24,
+		},
+	}
+	assert.Len(t, d.check(rules, "user2", "", anomalyOpUpload, now), 1)
+	assert.Len(t, d.check(rules, "user2", "", anomalyOpUpload, now.Add(time.Minute)), 0)
+	rules[0].StartHour = hour
+	rules[0].EndHour = (hour + 1) % 24
+	assert.Len(t, d.check(rules, "user3", "", anomalyOpUpload, now), 0)
+
+	assert.Len(t, d.stats, 4)
+	d.stats["user3"].lastAccess = now.Add(-25 * time.Hour)
+	d.cleanup()
+	assert.Len(t, d.stats, 3)
+
+	for i := 0; i < securityEventsMaxPerUser+1; i++ {
+		d.addEvent(SecurityEvent{
+			Username: "user",
+			Count:    i,
+		})
+	}
+	events := d.getEvents("user")
+	if assert.Len(t, events, securityEventsMaxPerUser) {
+		assert.Equal(t, securityEventsMaxPerUser, events[0].Count)
+	}
+	assert.Len(t, d.getEvents("missing"), 0)
+}
+
+func TestAnomalyRulesSimulate(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "anomaly_user",
+		},
+		Filters: dataprovider.UserFilters{
+			AnomalyRules: []dataprovider.AnomalyRule{
+				{
+					Type:      dataprovider.AnomalyRuleDeletions,
+					Threshold: 1,
+					Window:    1,
+					Simulate:  true,
+				},
+			},
+		},
+	}
+	conn := NewBaseConnection("", ProtocolSFTP, "", "127.0.0.1:2222", user)
+	conn.checkAnomalies(anomalyOpDelete)
+	conn.checkAnomalies(anomalyOpDelete)
+	conn.checkAnomalies(anomalyOpDownload)
+	assert.Equal(t, int64(2), conn.deletionsCount.Load())
+	assert.Equal(t, int64(1), conn.downloadsCount.Load())
+	assert.Len(t, GetUserSecurityEvents(user.Username), 0)
+
+	conn.User.Filters.AnomalyRules[0].Simulate = false
+	anomalyDetector.stats[user.Username].lastTriggers = make(map[string]time.Time)
+	conn.checkAnomalies(anomalyOpDelete)
+	events := GetUserSecurityEvents(user.Username)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "127.0.0.1", events[0].IP)
+		assert.Equal(t, ProtocolSFTP, events[0].Protocol)
+		assert.Equal(t, 3, events[0].Count)
+	}
+	// the internal operations are not checked
+	conn = NewBaseConnection("", ProtocolDataRetention, "", "", user)
+	conn.checkAnomalies(anomalyOpDelete)
+	assert.Len(t, GetUserSecurityEvents(user.Username), 1)
+}
+
+func TestAnomalyNetwork(t *testing.T) {
+	assert.Equal(t, "192.168.0.0", getAnomalyNetwork("192.168.1.2"))
+	assert.Equal(t, "2001:db8:1::", getAnomalyNetwork("2001:db8:1:2::1"))
+	assert.Empty(t, getAnomalyNetwork("invalid"))
+}
@@ -0,0 +1,250 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+)
+
+const autoExtractLogSender = "autoextract"
+
+// startAutoExtract extracts, in background, the uploaded ZIP file if the
+// automatic extraction is enabled for its virtual path
+func startAutoExtract(conn *BaseConnection, virtualPath string) {
+	if !conn.User.IsAutoExtractEnabled(virtualPath) {
+		return
+	}
+	username := conn.User.Username
+	conn.Log(logger.LevelDebug, "ZIP file %q uploaded, starting automatic extraction", virtualPath)
+
+	go func() {
+		startTime := time.Now()
+		user, err := dataprovider.GetUserWithGroupSettings(username)
+		if err != nil {
+			logger.Warn(autoExtractLogSender, "", "unable to get user %q to extract %q: %v", username, virtualPath, err)
+			return
+		}
+		numFiles, size, err := executeAutoExtract(user, virtualPath)
+		if err != nil {
+			logger.Warn(autoExtractLogSender, "", "unable to extract %q for user %q: %v", virtualPath, username, err)
+			sendAutoExtractFailureNotification(&user, virtualPath, err)
+			return
+		}
+		logger.Info(autoExtractLogSender, "", "archive %q extracted for user %q to %q, files: %d, size: %d, elapsed: %s",
+			virtualPath, username, user.Filters.AutoExtract.ExtractToPath, numFiles, size, time.Since(startTime))
+	}()
+}
+
+func executeAutoExtract(user dataprovider.User, virtualPath string) (int, int64, error) {
+	connectionID := fmt.Sprintf("%s_%s", protocolEventAction, xid.New().String())
+	err := user.CheckFsRoot(connectionID)
+	defer user.CloseFs() //nolint:errcheck
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to check root fs: %w", err)
+	}
+	conn := NewBaseConnection(connectionID, protocolEventAction, "", "", user)
+	fs, fsPath, err := conn.GetFsAndResolvedPath(virtualPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	info, err := fs.Stat(fsPath)
+	if err != nil {
+		return 0, 0, conn.GetFsError(fs, err)
+	}
+	f, r, cancelFn, err := fs.Open(fsPath, 0)
+	if err != nil {
+		return 0, 0, conn.GetFsError(fs, err)
+	}
+	if cancelFn != nil {
+		defer cancelFn()
+	}
+	var readerAt io.ReaderAt = r
+	if f != nil {
+		readerAt = f
+		defer f.Close()
+	} else {
+		defer r.Close()
+	}
+	zipReader, err := zip.NewReader(readerAt, info.Size())
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read ZIP file: %w", err)
+	}
+	extractor := &zipExtractor{
+		conn:      conn,
+		targetDir: user.Filters.AutoExtract.ExtractToPath,
+		maxSize:   user.Filters.AutoExtract.MaxExtractedSize,
+	}
+	if err := extractor.extract(zipReader); err != nil {
+		return extractor.numFiles, extractor.size, err
+	}
+	if user.Filters.AutoExtract.DeleteZipAfterExtract {
+		if err := fs.Remove(fsPath, false); err != nil {
+			logger.Warn(autoExtractLogSender, connectionID, "unable to remove extracted archive %q: %v", virtualPath, err)
+		} else {
+			updateUserQuotaAfterFileWrite(conn, virtualPath, -1, -info.Size())
+			invalidateDirListing(&user, path.Dir(virtualPath))
+		}
+	}
+	return extractor.numFiles, extractor.size, nil
+}
+
+// zipExtractor extracts a ZIP file inside a target virtual directory
+type zipExtractor struct {
+	conn      *BaseConnection
+	targetDir string
+	maxSize   int64
+	numFiles  int
+	size      int64
+}
+
+// getEntryPath returns the virtual path for the specified entry, the entries
+// outside the target directory are not allowed
+func (e *zipExtractor) getEntryPath(name string) (string, error) {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) {
+		return "", fmt.Errorf("invalid entry name %q", name)
+	}
+	entryPath := path.Join(e.targetDir, name)
+	if entryPath == e.targetDir {
+		return "", fmt.Errorf("invalid entry name %q", name)
+	}
+	if e.targetDir != "/" && !strings.HasPrefix(entryPath, e.targetDir+"/") {
+		return "", fmt.Errorf("entry %q is outside the target directory", name)
+	}
+	return entryPath, nil
+}
+
+func (e *zipExtractor) extract(r *zip.Reader) error {
+	var totalSize uint64
+	for _, f := range r.File {
+		totalSize += f.UncompressedSize64
+		if _, err := e.getEntryPath(f.Name); err != nil {
+			return err
+		}
+	}
+	if e.maxSize > 0 && totalSize > uint64(e.maxSize) {
+		return fmt.Errorf("the extracted size %d exceeds the limit %d", totalSize, e.maxSize)
+	}
+	if err := e.conn.CheckParentDirs(e.targetDir); err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		entryPath, _ := e.getEntryPath(f.Name)
+		if f.FileInfo().IsDir() {
+			if err := e.conn.CheckParentDirs(entryPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			logger.Debug(autoExtractLogSender, e.conn.GetID(), "skipping entry %q, it is not a regular file", f.Name)
+			continue
+		}
+		if err := e.extractFile(f, entryPath); err != nil {
+			return fmt.Errorf("unable to extract %q: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *zipExtractor) extractFile(f *zip.File, entryPath string) error {
+	if ok, _ := e.conn.User.IsFileAllowed(entryPath); !ok {
+		return errors.New("the file name is not allowed")
+	}
+	if !e.conn.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(entryPath)) {
+		return e.conn.GetPermissionDeniedError()
+	}
+	if err := e.conn.CheckParentDirs(path.Dir(entryPath)); err != nil {
+		return err
+	}
+	fs, fsPath, err := e.conn.GetFsAndResolvedPath(entryPath)
+	if err != nil {
+		return err
+	}
+	isNewFile := true
+	var existingSize int64
+	info, err := fs.Lstat(fsPath)
+	if err == nil {
+		if !e.conn.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(entryPath)) {
+			logger.Info(autoExtractLogSender, e.conn.GetID(), "skipping entry %q, the target %q exists and "+
+				"overwrite is not allowed", f.Name, entryPath)
+			return nil
+		}
+		isNewFile = false
+		existingSize = info.Size()
+	} else if !fs.IsNotExist(err) {
+		return e.conn.GetFsError(fs, err)
+	}
+	quotaResult, _ := e.conn.HasSpace(isNewFile, false, entryPath)
+	if !quotaResult.HasSpace || (quotaResult.QuotaSize > 0 &&
+		int64(f.UncompressedSize64) > quotaResult.AllowedSize+existingSize) {
+		return e.conn.GetQuotaExceededError()
+	}
+	reader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, numFiles, truncatedSize, cancelFn, err := getFileWriter(e.conn, entryPath)
+	if err != nil {
+		return err
+	}
+	defer cancelFn()
+
+	n, err := io.Copy(writer, reader)
+	errClose := closeWriterAndUpdateQuota(writer, e.conn, entryPath, numFiles, truncatedSize, err)
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	e.numFiles++
+	e.size += n
+	return nil
+}
+
+func sendAutoExtractFailureNotification(user *dataprovider.User, virtualPath string, extractErr error) {
+	var recipients []string
+	if user.Email != "" {
+		recipients = append(recipients, user.Email)
+	}
+	recipients = append(recipients, user.Filters.AutoExtract.NotifyEmails...)
+	if len(recipients) == 0 || !smtp.IsEnabled() {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nthe automatic extraction of the archive %q failed:\n\n%v\n",
+		user.Username, virtualPath, extractErr)
+	err := smtp.SendEmail(recipients, "SFTPGo - Archive extraction failed", body, smtp.EmailContentTypeTextPlain)
+	if err != nil {
+		logger.Warn(autoExtractLogSender, "", "unable to send extraction failure notification for user %q: %v",
+			user.Username, err)
+		return
+	}
+	logger.Debug(autoExtractLogSender, "", "extraction failure notification sent for user %q, archive %q",
+		user.Username, virtualPath)
+}
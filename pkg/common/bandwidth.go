@@ -0,0 +1,72 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BandwidthBucket defines the status of a token bucket used to allow
+// bandwidth bursts
+type BandwidthBucket struct {
+	// Bucket size as bytes
+	Size int64 `json:"size"`
+	// Available tokens as bytes, they can be transferred at line speed
+	Available int64 `json:"available"`
+}
+
+// newBandwidthBucket returns a token bucket for the given bandwidth, as KB/s,
+// and burst size, as bytes. nil is returned if bursts are not enabled.
+// The bucket starts full, so an idle user can transfer burstSize bytes at
+// line speed before being throttled to the sustained rate
+func newBandwidthBucket(bandwidth, burstSize int64) *rate.Limiter {
+	if bandwidth <= 0 || burstSize <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bandwidth*1024), int(burstSize))
+}
+
+// waitBandwidthTokens blocks until the bucket allows n bytes to be transferred
+func waitBandwidthTokens(bucket *rate.Limiter, n int64) {
+	burst := int64(bucket.Burst())
+	for n > 0 {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		res := bucket.ReserveN(time.Now(), int(chunk))
+		if res.OK() {
+			time.Sleep(res.Delay())
+		}
+		n -= chunk
+	}
+}
+
+func getBandwidthBucketStatus(bucket *rate.Limiter) *BandwidthBucket {
+	if bucket == nil {
+		return nil
+	}
+	// tokens are negative if future transfers are already reserved
+	available := int64(bucket.Tokens())
+	if available < 0 {
+		available = 0
+	}
+	return &BandwidthBucket{
+		Size:      int64(bucket.Burst()),
+		Available: available,
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+// Supported checksum verification modes for uploaded files
+const (
+	ChecksumVerificationOff     = "off"
+	ChecksumVerificationWarn    = "warn"
+	ChecksumVerificationEnforce = "enforce"
+)
+
+// ChecksumSHA256Header is the HTTP header used by the clients to send the expected
+// SHA256 checksum for uploaded files
+const ChecksumSHA256Header = "X-Checksum-SHA256"
+
+var validChecksumVerificationModes = []string{ChecksumVerificationOff, ChecksumVerificationWarn,
+	ChecksumVerificationEnforce}
+
+// SetExpectedChecksum sets the SHA256 checksum, hex encoded, the uploaded file is
+// expected to have. It is verified when the transfer is closed
+func (t *BaseTransfer) SetExpectedChecksum(checksum string) {
+	t.expectedChecksum = strings.ToLower(strings.TrimSpace(checksum))
+}
+
+func (t *BaseTransfer) getUploadedFileChecksum() (string, error) {
+	file, pipeReader, cancelFn, err := t.Fs.Open(t.effectiveFsPath, 0)
+	if err != nil {
+		return "", err
+	}
+	if cancelFn == nil {
+		cancelFn = func() {}
+	}
+	defer cancelFn()
+
+	var reader io.ReadCloser
+	if file != nil {
+		reader = file
+	} else {
+		reader = pipeReader
+	}
+	defer reader.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksum compares the checksum of the uploaded file with the expected one,
+// if any. In enforce mode the transfer fails if they don't match
+func (t *BaseTransfer) verifyChecksum() {
+	if t.expectedChecksum == "" || Config.ChecksumVerification == "" ||
+		Config.ChecksumVerification == ChecksumVerificationOff {
+		return
+	}
+	checksum, err := t.getUploadedFileChecksum()
+	if err != nil {
+		t.Connection.Log(logger.LevelError, "unable to compute the checksum for the uploaded file %q: %v",
+			t.effectiveFsPath, err)
+		if Config.ChecksumVerification == ChecksumVerificationEnforce {
+			t.setChecksumError()
+		}
+		return
+	}
+	if checksum == t.expectedChecksum {
+		t.Connection.Log(logger.LevelDebug, "checksum verified for uploaded file %q", t.effectiveFsPath)
+		return
+	}
+	t.Connection.Log(logger.LevelWarn, "checksum mismatch for uploaded file %q, expected: %q, actual: %q",
+		t.effectiveFsPath, t.expectedChecksum, checksum)
+	if Config.ChecksumVerification == ChecksumVerificationEnforce {
+		t.setChecksumError()
+	}
+}
+
+func (t *BaseTransfer) setChecksumError() {
+	t.ErrTransfer = ErrChecksumMismatch
+	if t.effectiveFsPath != t.fsPath {
+		// atomic upload, the temporary file will be removed
+		return
+	}
+	err := t.Fs.Remove(t.effectiveFsPath, false)
+	if err == nil {
+		t.BytesReceived.Store(0)
+		t.MinWriteOffset = 0
+	}
+	t.Connection.Log(logger.LevelWarn, "checksum verification failed, delete uploaded file: %q, deletion error: %v",
+		t.effectiveFsPath, err)
+}
@@ -33,6 +33,7 @@ import (
 
 	"github.com/pires/go-proxyproto"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
@@ -52,11 +53,14 @@ const (
 	rmdirLogSender         = "Rmdir"
 	mkdirLogSender         = "Mkdir"
 	symlinkLogSender       = "Symlink"
+	hardlinkLogSender      = "Hardlink"
+	copyLogSender          = "Copy"
 	removeLogSender        = "Remove"
 	chownLogSender         = "Chown"
 	chmodLogSender         = "Chmod"
 	chtimesLogSender       = "Chtimes"
 	truncateLogSender      = "Truncate"
+	setMetadataLogSender   = "SetMetadata"
 	operationDownload      = "download"
 	operationUpload        = "upload"
 	operationFirstDownload = "first-download"
@@ -68,6 +72,7 @@ const (
 	OperationPreUpload = "pre-upload"
 	operationPreDelete = "pre-delete"
 	operationRename    = "rename"
+	operationCopy      = "copy"
 	operationMkdir     = "mkdir"
 	operationRmdir     = "rmdir"
 	// SSH command action name
@@ -102,6 +107,7 @@ const (
 	ProtocolHTTPShare     = "HTTPShare"
 	ProtocolDataRetention = "DataRetention"
 	ProtocolOIDC          = "OIDC"
+	ProtocolStorageEvent  = "StorageEvent"
 	protocolEventAction   = "EventAction"
 )
 
@@ -119,6 +125,9 @@ func init() {
 	Connections.perUserConns = make(map[string]int)
 	Connections.mapping = make(map[string]int)
 	Connections.sshMapping = make(map[string]int)
+	dataprovider.SetGroupUpdatedCallback(Connections.InvalidateGroupPermissionCache)
+	dataprovider.SetUserChangedCallback(onUserChanged)
+	dataprovider.RegisterNodeEventHandler(nodeEventDirListInvalidated, onDirListInvalidatedEvent)
 }
 
 // errors definitions
@@ -136,6 +145,8 @@ var (
 	ErrInternalFailure   = errors.New("internal failure")
 	ErrTransferAborted   = errors.New("transfer aborted")
 	ErrShuttingDown      = errors.New("the service is shutting down")
+	ErrChecksumMismatch  = errors.New("checksum mismatch")
+	ErrTooManySessions   = errors.New("too many open sessions")
 	errNoTransfer        = errors.New("requested transfer not found")
 	errTransferMismatch  = errors.New("transfer mismatch")
 )
@@ -157,8 +168,21 @@ var (
 	rateLimiters     map[string][]*rateLimiter
 	isShuttingDown   atomic.Bool
 	ftpLoginCommands = []string{"PASS", "USER"}
+	// nodesSessionsCounter, if set, is used to count the sessions opened
+	// on the other cluster nodes
+	nodesSessionsCounter FnNodesActiveSessions
 )
 
+// FnNodesActiveSessions defines the callback used to get the number of active
+// sessions for a user on the other cluster nodes
+type FnNodesActiveSessions func(username string) int
+
+// SetNodesSessionsCounter sets the callback to use to count the sessions
+// opened on the other cluster nodes
+func SetNodesSessionsCounter(fn FnNodesActiveSessions) {
+	nodesSessionsCounter = fn
+}
+
 // Initialize sets the common configuration
 func Initialize(c Configuration, isShared int) error {
 	isShuttingDown.Store(false)
@@ -166,6 +190,43 @@ func Initialize(c Configuration, isShared int) error {
 	Config.Actions.ExecuteOn = util.RemoveDuplicates(Config.Actions.ExecuteOn, true)
 	Config.Actions.ExecuteSync = util.RemoveDuplicates(Config.Actions.ExecuteSync, true)
 	Config.ProxyAllowed = util.RemoveDuplicates(Config.ProxyAllowed, true)
+	if Config.FileNameSanitize == "" {
+		Config.FileNameSanitize = dataprovider.FileNameSanitizeNone
+	}
+	if !util.Contains(dataprovider.ValidFileNameSanitizeModes, Config.FileNameSanitize) {
+		return fmt.Errorf("invalid file name sanitization mode %q", Config.FileNameSanitize)
+	}
+	if Config.DirListOrder.Order != "" && !util.Contains(dataprovider.ValidDirListOrders, Config.DirListOrder.Order) {
+		return fmt.Errorf("invalid directory listing order %q", Config.DirListOrder.Order)
+	}
+	if Config.ChecksumVerification == "" {
+		Config.ChecksumVerification = ChecksumVerificationOff
+	}
+	if !util.Contains(validChecksumVerificationModes, Config.ChecksumVerification) {
+		return fmt.Errorf("invalid checksum verification mode %q", Config.ChecksumVerification)
+	}
+	if err := validatePipeline(Config.Actions.Pipeline); err != nil {
+		return err
+	}
+	if Config.DiskSpaceSafetyMarginBytes < 0 {
+		return fmt.Errorf("invalid disk space safety margin: %d", Config.DiskSpaceSafetyMarginBytes)
+	}
+	if Config.FolderAuditLogsPath != "" {
+		if !filepath.IsAbs(Config.FolderAuditLogsPath) {
+			return fmt.Errorf("invalid folder audit logs path %q, it must be an absolute path", Config.FolderAuditLogsPath)
+		}
+		Config.FolderAuditLogsPath = filepath.Clean(Config.FolderAuditLogsPath)
+	}
+	if err := Config.AccessLog.validate(); err != nil {
+		return err
+	}
+	initializeAccessLog(&Config.AccessLog)
+	if err := Config.loadProtocolLogLevels(); err != nil {
+		return err
+	}
+	if err := circuitbreaker.Initialize(Config.HooksCircuitBreakers); err != nil {
+		return fmt.Errorf("hooks circuit breakers initialization error: %w", err)
+	}
 	Config.idleLoginTimeout = 2 * time.Minute
 	Config.idleTimeoutAsDuration = time.Duration(Config.IdleTimeout) * time.Minute
 	startPeriodicChecks(periodicTimeoutCheckInterval)
@@ -221,6 +282,11 @@ func Initialize(c Configuration, isShared int) error {
 	vfs.SetAllowSelfConnections(c.AllowSelfConnections)
 	dataprovider.SetAllowSelfConnections(c.AllowSelfConnections)
 	transfersChecker = getTransfersChecker(isShared)
+	dirListCache = nil
+	if c.DirListCache.IsEnabled() {
+		dirListCache = newDirListingCache(c.DirListCache)
+		logger.Info(logSender, "", "directory listings cache initialized with config %+v", c.DirListCache)
+	}
 	return nil
 }
 
@@ -243,7 +309,7 @@ func WaitForTransfers(graceTime int) {
 		return
 	}
 
-	if activeHooks.Load() == 0 && getActiveConnections() == 0 {
+	if activeHooks.Load() == 0 && Connections.GetActiveTransfers() == 0 {
 		return
 	}
 
@@ -254,8 +320,9 @@ func WaitForTransfers(graceTime int) {
 		select {
 		case <-ticker.C:
 			hooks := activeHooks.Load()
-			logger.Info(logSender, "", "active hooks: %d", hooks)
-			if hooks == 0 && getActiveConnections() == 0 {
+			transfers := Connections.GetActiveTransfers()
+			logger.Info(logSender, "", "active hooks: %d, active transfers: %d", hooks, transfers)
+			if hooks == 0 && transfers == 0 {
 				logger.Info(logSender, "", "no more active connections, graceful shutdown")
 				ticker.Stop()
 				graceTimer.Stop()
@@ -264,25 +331,38 @@ func WaitForTransfers(graceTime int) {
 		case <-graceTimer.C:
 			logger.Info(logSender, "", "grace time expired, hard shutdown")
 			ticker.Stop()
+			Connections.closeActiveTransfers()
 			return
 		}
 	}
 }
 
-// getActiveConnections returns the number of connections with active transfers
-func getActiveConnections() int {
-	var activeConns int
+// WaitForTransfersClosed waits, up to the specified timeout, for the active
+// transfers counter to reach zero. Transfers forcibly closed after the grace
+// time still need to update quota and run their actions before exiting.
+// It returns false if the timeout expires
+func WaitForTransfersClosed(timeout time.Duration) bool {
+	if Connections.GetActiveTransfers() == 0 {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 
-	Connections.RLock()
-	for _, c := range Connections.connections {
-		if len(c.GetTransfers()) > 0 {
-			activeConns++
+	for {
+		select {
+		case <-ticker.C:
+			if Connections.GetActiveTransfers() == 0 {
+				return true
+			}
+		case <-timer.C:
+			logger.Warn(logSender, "", "timeout waiting for transfers to close, active transfers: %d",
+				Connections.GetActiveTransfers())
+			return false
 		}
 	}
-	Connections.RUnlock()
-
-	logger.Info(logSender, "", "number of connections with active transfers: %d", activeConns)
-	return activeConns
 }
 
 // LimitRate blocks until all the configured rate limiters
@@ -388,6 +468,10 @@ func startPeriodicChecks(duration time.Duration) {
 	_, err := eventScheduler.AddFunc(spec, Connections.checkTransfers)
 	util.PanicOnError(err)
 	logger.Info(logSender, "", "scheduled overquota transfers check, schedule %q", spec)
+	_, err = eventScheduler.AddFunc("@daily", auditPublicKeys)
+	util.PanicOnError(err)
+	_, err = eventScheduler.AddFunc("@every 1h", anomalyDetector.cleanup)
+	util.PanicOnError(err)
 	if Config.IdleTimeout > 0 {
 		ratio := idleTimeoutCheckInterval / periodicTimeoutCheckInterval
 		spec = fmt.Sprintf("@every %s", duration*ratio)
@@ -430,6 +514,10 @@ type ActiveConnection interface {
 	AddTransfer(t ActiveTransfer)
 	RemoveTransfer(t ActiveTransfer)
 	GetTransfers() []ConnectionTransfer
+	GetBandwidthBuckets() (*BandwidthBucket, *BandwidthBucket)
+	GetSFTPVersion() int
+	HasGroupSettings(name string) bool
+	RefreshEffectivePermissions() error
 	SignalTransferClose(transferID int64, err error)
 	CloseFS() error
 }
@@ -565,6 +653,9 @@ type Configuration struct {
 	// Absolute path to an external program or an HTTP URL to invoke after a data retention check completes.
 	// Leave empty do disable.
 	DataRetentionHook string `json:"data_retention_hook" mapstructure:"data_retention_hook"`
+	// Absolute path to an external program or an HTTP URL to invoke when a user anomaly rule triggers.
+	// Leave empty do disable.
+	SecurityEventHook string `json:"security_event_hook" mapstructure:"security_event_hook"`
 	// Maximum number of concurrent client connections. 0 means unlimited
 	MaxTotalConnections int `json:"max_total_connections" mapstructure:"max_total_connections"`
 	// Maximum number of concurrent client connections from the same host (IP). 0 means unlimited
@@ -579,11 +670,90 @@ type Configuration struct {
 	// Defender configuration
 	DefenderConfig DefenderConfig `json:"defender" mapstructure:"defender"`
 	// Rate limiter configurations
-	RateLimitersConfig    []RateLimiterConfig `json:"rate_limiters" mapstructure:"rate_limiters"`
+	RateLimitersConfig []RateLimiterConfig `json:"rate_limiters" mapstructure:"rate_limiters"`
+	// Directory listings cache configuration
+	DirListCache DirListCacheConfig `json:"dir_list_cache" mapstructure:"dir_list_cache"`
+	// File name sanitization mode for new files and directories and rename targets:
+	// - "none", file names are not checked
+	// - "strip_control", control characters are removed
+	// - "replace", characters not allowed by the storage backend are replaced with "_"
+	// - "reject", file names with characters not allowed by the storage backend are rejected
+	// It can be overridden per-user
+	FileNameSanitize string `json:"file_name_sanitize" mapstructure:"file_name_sanitize"`
+	// Order for FTP and WebDAV directory listings. It can be overridden per-user
+	DirListOrder DirListOrderConfig `json:"dir_list_order" mapstructure:"dir_list_order"`
+	// Checksum verification mode for uploaded files. The expected checksum is provided by the clients:
+	// - "off", checksums are not verified
+	// - "warn", a mismatch is logged and the uploaded file is kept
+	// - "enforce", the upload fails and the uploaded file is removed on mismatch
+	ChecksumVerification string `json:"checksum_verification" mapstructure:"checksum_verification"`
+	// Circuit breakers for the hooks. An open circuit fails fast, without executing the hook,
+	// until the recovery timeout expires
+	HooksCircuitBreakers []circuitbreaker.Config `json:"hooks_circuit_breakers" mapstructure:"hooks_circuit_breakers"`
+	// If enabled the internal error details, for example database errors or filesystem paths, are
+	// not sent to SFTP, SCP, SSH commands and FTP clients, the full errors are logged
+	ObscureErrorMessages bool `json:"obscure_error_messages" mapstructure:"obscure_error_messages"`
+	// Free disk space, in bytes, to preserve on local filesystems. Uploads whose size is known in
+	// advance are rejected if the available disk space is less than the upload size plus this margin
+	DiskSpaceSafetyMarginBytes int64 `json:"disk_space_safety_margin_bytes" mapstructure:"disk_space_safety_margin_bytes"`
+	// Absolute path to the directory for the virtual folders audit logs. Access events for
+	// virtual folders with a configured audit log are written there in addition to the main log.
+	// Empty means disabled
+	FolderAuditLogsPath string `json:"folder_audit_logs_path" mapstructure:"folder_audit_logs_path"`
+	// Access log for file transfers and file management commands, written to a dedicated
+	// file, using the configured format, in addition to the main log
+	AccessLog AccessLogConfig `json:"access_log" mapstructure:"access_log"`
+	// Minimum log level for the connection and transfer logs of each protocol, for example
+	// {"SFTP": "warn"} logs only the SFTP warnings and errors. Supported levels: "debug",
+	// "info", "warn", "error". The protocols not included use the global log level
+	ProtocolLogLevel      map[string]string `json:"protocol_log_level" mapstructure:"protocol_log_level"`
 	idleTimeoutAsDuration time.Duration
 	idleLoginTimeout      time.Duration
 	defender              Defender
 	whitelist             *whitelist
+	protocolLogLevels     map[string]logger.LogLevel
+}
+
+func (c *Configuration) loadProtocolLogLevels() error {
+	c.protocolLogLevels = make(map[string]logger.LogLevel)
+	for protocol, level := range c.ProtocolLogLevel {
+		// viper lowercases the map keys, the protocols are matched ignoring the case
+		name := getProtocolName(protocol)
+		if name == "" {
+			return fmt.Errorf("invalid protocol log level, unsupported protocol %q", protocol)
+		}
+		var logLevel logger.LogLevel
+		switch strings.ToLower(strings.TrimSpace(level)) {
+		case "debug":
+			logLevel = logger.LevelDebug
+		case "info":
+			logLevel = logger.LevelInfo
+		case "warn":
+			logLevel = logger.LevelWarn
+		case "error":
+			logLevel = logger.LevelError
+		default:
+			return fmt.Errorf("invalid log level %q for protocol %q", level, protocol)
+		}
+		c.protocolLogLevels[name] = logLevel
+	}
+	return nil
+}
+
+func getProtocolName(protocol string) string {
+	for _, p := range supportedProtocols {
+		if strings.EqualFold(p, protocol) {
+			return p
+		}
+	}
+	return ""
+}
+
+// isProtocolLogLevelEnabled returns false if the specified level is lower than
+// the one configured for the protocol
+func (c *Configuration) isProtocolLogLevelEnabled(protocol string, level logger.LogLevel) bool {
+	minLevel, ok := c.protocolLogLevels[protocol]
+	return !ok || level >= minLevel
 }
 
 // IsAtomicUploadEnabled returns true if atomic upload is enabled
@@ -684,12 +854,19 @@ func (c *Configuration) executePostDisconnectHook(remoteAddr, protocol, username
 		q.Add("connection_duration", strconv.FormatInt(connDuration, 10))
 		url.RawQuery = q.Encode()
 		startTime := time.Now()
-		resp, err := httpclient.RetryableGet(url.String())
 		respCode := 0
-		if err == nil {
+		err = circuitbreaker.Execute(command.HookPostDisconnect, func() error {
+			resp, err := httpclient.RetryableGet(url.String())
+			if err != nil {
+				return err
+			}
 			respCode = resp.StatusCode
 			resp.Body.Close()
-		}
+			if respCode >= http.StatusInternalServerError {
+				return errUnexpectedHTTResponse
+			}
+			return nil
+		})
 		logger.Debug(protocol, connID, "Post disconnect hook response code: %v, elapsed: %v, err: %v",
 			respCode, time.Since(startTime), err)
 		return
@@ -709,7 +886,14 @@ func (c *Configuration) executePostDisconnectHook(remoteAddr, protocol, username
 		fmt.Sprintf("SFTPGO_CONNECTION_USERNAME=%v", username),
 		fmt.Sprintf("SFTPGO_CONNECTION_DURATION=%v", connDuration),
 		fmt.Sprintf("SFTPGO_CONNECTION_PROTOCOL=%v", protocol))
-	err := cmd.Run()
+	var cmdErr error
+	err := circuitbreaker.Execute(command.HookPostDisconnect, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
 	logger.Debug(protocol, connID, "Post disconnect hook executed, elapsed: %v error: %v", time.Since(startTime), err)
 }
 
@@ -741,14 +925,25 @@ func (c *Configuration) ExecutePostConnectHook(ipAddr, protocol string) error {
 		q.Add("protocol", protocol)
 		url.RawQuery = q.Encode()
 
-		resp, err := httpclient.RetryableGet(url.String())
+		respCode := 0
+		err = circuitbreaker.Execute(command.HookPostConnect, func() error {
+			resp, err := httpclient.RetryableGet(url.String())
+			if err != nil {
+				return err
+			}
+			respCode = resp.StatusCode
+			resp.Body.Close()
+			if respCode >= http.StatusInternalServerError {
+				return errUnexpectedHTTResponse
+			}
+			return nil
+		})
 		if err != nil {
 			logger.Warn(protocol, "", "Login from ip %#v denied, error executing post connect hook: %v", ipAddr, err)
 			return err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			logger.Warn(protocol, "", "Login from ip %#v denied, post connect hook response code: %v", ipAddr, resp.StatusCode)
+		if respCode != 0 && respCode != http.StatusOK {
+			logger.Warn(protocol, "", "Login from ip %#v denied, post connect hook response code: %v", ipAddr, respCode)
 			return errUnexpectedHTTResponse
 		}
 		return nil
@@ -766,7 +961,14 @@ func (c *Configuration) ExecutePostConnectHook(ipAddr, protocol string) error {
 	cmd.Env = append(env,
 		fmt.Sprintf("SFTPGO_CONNECTION_IP=%v", ipAddr),
 		fmt.Sprintf("SFTPGO_CONNECTION_PROTOCOL=%v", protocol))
-	err := cmd.Run()
+	var cmdErr error
+	err := circuitbreaker.Execute(command.HookPostConnect, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
 	if err != nil {
 		logger.Warn(protocol, "", "Login from ip %#v denied, connect hook error: %v", ipAddr, err)
 	}
@@ -817,6 +1019,8 @@ type ActiveConnections struct {
 	// for authentication
 	clients              clientsMap
 	transfersCheckStatus atomic.Bool
+	// number of in-flight transfers
+	activeTransfers atomic.Int32
 	sync.RWMutex
 	connections    []ActiveConnection
 	mapping        map[string]int
@@ -847,6 +1051,35 @@ func (conns *ActiveConnections) removeUserConnection(username string) {
 	}
 }
 
+// InvalidateGroupPermissionCache refreshes the effective permissions for the
+// active connections of the users inheriting the settings of the specified group
+func (conns *ActiveConnections) InvalidateGroupPermissionCache(groupName string) {
+	conns.RLock()
+	var toRefresh []ActiveConnection
+	for _, c := range conns.connections {
+		if c.HasGroupSettings(groupName) {
+			toRefresh = append(toRefresh, c)
+		}
+	}
+	conns.RUnlock()
+
+	// the users are loaded from the data provider, we don't hold the lock here
+	for _, c := range toRefresh {
+		if err := c.RefreshEffectivePermissions(); err != nil {
+			logger.Warn(logSender, c.GetID(), "unable to refresh effective permissions after the update of group %q: %v",
+				groupName, err)
+		}
+	}
+}
+
+func (conns *ActiveConnections) isActive(connectionID string) bool {
+	conns.RLock()
+	defer conns.RUnlock()
+
+	_, ok := conns.mapping[connectionID]
+	return ok
+}
+
 // GetActiveSessions returns the number of active sessions for the given username.
 // We return the open sessions for any protocol
 func (conns *ActiveConnections) GetActiveSessions(username string) int {
@@ -856,6 +1089,24 @@ func (conns *ActiveConnections) GetActiveSessions(username string) int {
 	return conns.perUserConns[username]
 }
 
+// CheckMaxSessions returns an error wrapping ErrTooManySessions if the given user
+// cannot open a new session. In a multi-node setup the sessions opened on the
+// other nodes are counted too
+func (conns *ActiveConnections) CheckMaxSessions(username string, maxSessions int) error {
+	if maxSessions <= 0 {
+		return nil
+	}
+	activeSessions := conns.GetActiveSessions(username)
+	if activeSessions < maxSessions && nodesSessionsCounter != nil {
+		activeSessions += nodesSessionsCounter(username)
+	}
+	if activeSessions >= maxSessions {
+		metric.AddSessionLimitRejection()
+		return fmt.Errorf("%w: %d/%d", ErrTooManySessions, activeSessions, maxSessions)
+	}
+	return nil
+}
+
 // Add adds a new connection to the active ones
 func (conns *ActiveConnections) Add(c ActiveConnection) error {
 	conns.Lock()
@@ -864,7 +1115,8 @@ func (conns *ActiveConnections) Add(c ActiveConnection) error {
 	if username := c.GetUsername(); username != "" {
 		if maxSessions := c.GetMaxSessions(); maxSessions > 0 {
 			if val := conns.perUserConns[username]; val >= maxSessions {
-				return fmt.Errorf("too many open sessions: %d/%d", val, maxSessions)
+				metric.AddSessionLimitRejection()
+				return fmt.Errorf("%w: %d/%d", ErrTooManySessions, val, maxSessions)
 			}
 		}
 		conns.addUserConnection(username)
@@ -874,6 +1126,7 @@ func (conns *ActiveConnections) Add(c ActiveConnection) error {
 	metric.UpdateActiveConnectionsSize(len(conns.connections))
 	logger.Debug(c.GetProtocol(), c.GetID(), "connection added, local address %q, remote address %q, num open connections: %d",
 		c.GetLocalAddress(), c.GetRemoteAddress(), len(conns.connections))
+	notifyConnectionEvent(ConnectionEventConnected, c)
 	return nil
 }
 
@@ -892,7 +1145,8 @@ func (conns *ActiveConnections) Swap(c ActiveConnection) error {
 			if maxSessions := c.GetMaxSessions(); maxSessions > 0 {
 				if val, ok := conns.perUserConns[username]; ok && val >= maxSessions {
 					conns.addUserConnection(conn.GetUsername())
-					return fmt.Errorf("too many open sessions: %d/%d", val, maxSessions)
+					metric.AddSessionLimitRejection()
+					return fmt.Errorf("%w: %d/%d", ErrTooManySessions, val, maxSessions)
 				}
 			}
 			conns.addUserConnection(username)
@@ -901,6 +1155,7 @@ func (conns *ActiveConnections) Swap(c ActiveConnection) error {
 		conns.connections[idx] = c
 		logger.Debug(logSender, c.GetID(), "connection swapped, close fs error: %v", err)
 		conn = nil
+		notifyConnectionEvent(ConnectionEventConnected, c)
 		return nil
 	}
 
@@ -927,6 +1182,7 @@ func (conns *ActiveConnections) Remove(connectionID string) {
 		metric.UpdateActiveConnectionsSize(lastIdx)
 		logger.Debug(conn.GetProtocol(), conn.GetID(), "connection removed, local address %#v, remote address %#v close fs error: %v, num open connections: %v",
 			conn.GetLocalAddress(), conn.GetRemoteAddress(), err, lastIdx)
+		notifyConnectionEvent(ConnectionEventDisconnected, conn)
 		if conn.GetProtocol() == ProtocolFTP && conn.GetUsername() == "" && !util.Contains(ftpLoginCommands, conn.GetCommand()) {
 			ip := util.GetIPFromRemoteAddress(conn.GetRemoteAddress())
 			logger.ConnectionFailedLog("", ip, dataprovider.LoginMethodNoAuthTryed, conn.GetProtocol(),
@@ -965,6 +1221,35 @@ func (conns *ActiveConnections) Close(connectionID string) bool {
 	return result
 }
 
+// GetActiveTransfers returns the number of in-flight transfers
+func (conns *ActiveConnections) GetActiveTransfers() int32 {
+	return conns.activeTransfers.Load()
+}
+
+// closeActiveTransfers closes the connections with in-flight transfers,
+// it is called if the transfers don't complete within the shutdown grace time
+func (conns *ActiveConnections) closeActiveTransfers() {
+	var toClose []ActiveConnection
+
+	conns.RLock()
+	for _, c := range conns.connections {
+		transfers := c.GetTransfers()
+		for _, t := range transfers {
+			logger.Warn(c.GetProtocol(), c.GetID(), "incomplete transfer forcibly closed, user: %q, operation: %s, "+
+				"path: %q, uploaded: %d, downloaded: %d", c.GetUsername(), t.OperationType, t.VirtualPath, t.ULSize, t.DLSize)
+		}
+		if len(transfers) > 0 {
+			toClose = append(toClose, c)
+		}
+	}
+	conns.RUnlock()
+
+	for _, c := range toClose {
+		err := c.Disconnect()
+		logger.Debug(c.GetProtocol(), c.GetID(), "connection closed after the shutdown grace time, close err: %v", err)
+	}
+}
+
 // AddSSHConnection adds a new ssh connection to the active ones
 func (conns *ActiveConnections) AddSSHConnection(c *SSHConnection) {
 	conns.Lock()
@@ -1167,21 +1452,8 @@ func (conns *ActiveConnections) GetStats() []ConnectionStatus {
 	defer conns.RUnlock()
 
 	stats := make([]ConnectionStatus, 0, len(conns.connections))
-	node := dataprovider.GetNodeName()
 	for _, c := range conns.connections {
-		stat := ConnectionStatus{
-			Username:       c.GetUsername(),
-			ConnectionID:   c.GetID(),
-			ClientVersion:  c.GetClientVersion(),
-			RemoteAddress:  c.GetRemoteAddress(),
-			ConnectionTime: util.GetTimeAsMsSinceEpoch(c.GetConnectionTime()),
-			LastActivity:   util.GetTimeAsMsSinceEpoch(c.GetLastActivity()),
-			Protocol:       c.GetProtocol(),
-			Command:        c.GetCommand(),
-			Transfers:      c.GetTransfers(),
-			Node:           node,
-		}
-		stats = append(stats, stat)
+		stats = append(stats, getConnectionStatus(c))
 	}
 	return stats
 }
@@ -1202,12 +1474,17 @@ type ConnectionStatus struct {
 	LastActivity int64 `json:"last_activity"`
 	// Protocol for this connection
 	Protocol string `json:"protocol"`
+	// Negotiated SFTP protocol version, omitted for non SFTP connections
+	SFTPVersion int `json:"sftp_version,omitempty"`
 	// active uploads/downloads
 	Transfers []ConnectionTransfer `json:"active_transfers,omitempty"`
 	// SSH command or WebDAV method
 	Command string `json:"command,omitempty"`
 	// Node identifier, omitted for single node installations
 	Node string `json:"node,omitempty"`
+	// Token buckets for bandwidth bursts, omitted if bursts are not enabled
+	UploadBucket   *BandwidthBucket `json:"upload_bucket,omitempty"`
+	DownloadBucket *BandwidthBucket `json:"download_bucket,omitempty"`
 }
 
 // GetConnectionDuration returns the connection duration as string
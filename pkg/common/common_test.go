@@ -15,16 +15,20 @@
 package common
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -33,9 +37,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
+	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
@@ -544,6 +552,60 @@ func TestUserMaxSessions(t *testing.T) {
 	assert.Len(t, Connections.GetStats(), 0)
 }
 
+func TestCheckMaxSessions(t *testing.T) {
+	c := NewBaseConnection("id", ProtocolSFTP, "", "", dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username:    userTestUsername,
+			MaxSessions: 2,
+		},
+	})
+	fakeConn := &fakeConnection{
+		BaseConnection: c,
+	}
+	assert.NoError(t, Connections.CheckMaxSessions(userTestUsername, 0))
+	assert.NoError(t, Connections.CheckMaxSessions(userTestUsername, 1))
+	err := Connections.Add(fakeConn)
+	assert.NoError(t, err)
+	assert.NoError(t, Connections.CheckMaxSessions(userTestUsername, 0))
+	assert.NoError(t, Connections.CheckMaxSessions(userTestUsername, 2))
+	err = Connections.CheckMaxSessions(userTestUsername, 1)
+	assert.ErrorIs(t, err, ErrTooManySessions)
+	// sessions on other nodes
+	SetNodesSessionsCounter(func(username string) int {
+		if username == userTestUsername {
+			return 1
+		}
+		return 0
+	})
+	err = Connections.CheckMaxSessions(userTestUsername, 2)
+	if assert.ErrorIs(t, err, ErrTooManySessions) {
+		assert.Contains(t, err.Error(), "2/2")
+	}
+	assert.NoError(t, Connections.CheckMaxSessions(userTestUsername, 3))
+	assert.NoError(t, Connections.CheckMaxSessions("otheruser", 1))
+	SetNodesSessionsCounter(nil)
+
+	Connections.Remove(fakeConn.GetID())
+	assert.Len(t, Connections.GetStats(), 0)
+}
+
+func TestWaitForTransfersClosed(t *testing.T) {
+	initialTransfers := Connections.GetActiveTransfers()
+	Connections.activeTransfers.Store(0)
+	assert.True(t, WaitForTransfersClosed(100*time.Millisecond))
+
+	Connections.activeTransfers.Add(1)
+	assert.False(t, WaitForTransfersClosed(200*time.Millisecond))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		Connections.activeTransfers.Add(-1)
+	}()
+	assert.True(t, WaitForTransfersClosed(2*time.Second))
+	assert.Equal(t, int32(0), Connections.GetActiveTransfers())
+
+	Connections.activeTransfers.Store(initialTransfers)
+}
+
 func TestMaxConnections(t *testing.T) {
 	oldValue := Config.MaxTotalConnections
 	perHost := Config.MaxPerHostConnections
@@ -754,6 +816,82 @@ func TestSwapConnection(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestConnectionEvents(t *testing.T) {
+	c := NewBaseConnection("id_events", ProtocolSFTP, "", "", dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+		},
+	})
+	fakeConn := &fakeConnection{
+		BaseConnection: c,
+	}
+	err := Connections.Add(fakeConn)
+	assert.NoError(t, err)
+
+	getEvent := func(events <-chan ConnectionEvent) ConnectionEvent {
+		for {
+			select {
+			case event := <-events:
+				if event.Type == ConnectionEventTransferProgress {
+					continue
+				}
+				return event
+			case <-time.After(1 * time.Second):
+				assert.Fail(t, "connection event not received")
+				return ConnectionEvent{}
+			}
+		}
+	}
+
+	id, events := Connections.Subscribe()
+	event := getEvent(events)
+	assert.Equal(t, ConnectionEventSnapshot, event.Type)
+	if assert.Len(t, event.Connections, 1) {
+		assert.Equal(t, fakeConn.GetID(), event.Connections[0].ConnectionID)
+	}
+	fs := vfs.NewOsFs("", os.TempDir(), "")
+	tr := NewBaseTransfer(nil, c, nil, "/p", "/p", "/r", TransferUpload, 0, 0, 0, 0, true, fs, dataprovider.TransferQuota{})
+	event = getEvent(events)
+	assert.Equal(t, ConnectionEventTransferStarted, event.Type)
+	assert.Equal(t, fakeConn.GetID(), event.ConnectionID)
+	if assert.NotNil(t, event.Transfer) {
+		assert.Equal(t, tr.GetID(), event.Transfer.ID)
+		assert.Equal(t, "/r", event.Transfer.VirtualPath)
+	}
+	c.RemoveTransfer(tr)
+	event = getEvent(events)
+	assert.Equal(t, ConnectionEventTransferCompleted, event.Type)
+	Connections.Remove(fakeConn.GetID())
+	event = getEvent(events)
+	assert.Equal(t, ConnectionEventDisconnected, event.Type)
+	assert.Equal(t, fakeConn.GetID(), event.ConnectionID)
+	err = Connections.Add(fakeConn)
+	assert.NoError(t, err)
+	event = getEvent(events)
+	assert.Equal(t, ConnectionEventConnected, event.Type)
+	if assert.NotNil(t, event.Connection) {
+		assert.Equal(t, userTestUsername, event.Connection.Username)
+	}
+	Connections.Remove(fakeConn.GetID())
+	event = getEvent(events)
+	assert.Equal(t, ConnectionEventDisconnected, event.Type)
+	Connections.Unsubscribe(id)
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.False(t, connEventsBroker.hasSubscribers())
+	// a subscriber that does not consume the events must be removed
+	_, events = Connections.Subscribe()
+	for i := 0; i < connectionEventsBufferSize; i++ {
+		connEventsBroker.publish(ConnectionEvent{Type: ConnectionEventDisconnected})
+	}
+	assert.False(t, connEventsBroker.hasSubscribers())
+	numEvents := 0
+	for range events {
+		numEvents++
+	}
+	assert.Equal(t, connectionEventsBufferSize, numEvents)
+}
+
 func TestAtomicUpload(t *testing.T) {
 	configCopy := Config
 
@@ -1005,6 +1143,82 @@ func TestPostConnectHook(t *testing.T) {
 	Config.PostConnectHook = ""
 }
 
+func TestAuditUserPublicKeys(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "keys_audit_user",
+		},
+	}
+	assert.False(t, auditUserPublicKeys(&user))
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	pubKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	user.PublicKeys = []string{string(ssh.MarshalAuthorizedKey(pubKey))}
+	results := user.AuditPublicKeys()
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, 1024, results[0].Bits)
+		assert.Len(t, results[0].Warnings, 1)
+	}
+	assert.True(t, auditUserPublicKeys(&user))
+	// the audit is disabled by default
+	auditPublicKeys()
+}
+
+func TestPostConnectHookCircuitBreaker(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	err := circuitbreaker.Initialize([]circuitbreaker.Config{
+		{
+			Hook:             command.HookPostConnect,
+			FailureThreshold: 2,
+			RecoveryTimeout:  60,
+			FailOpen:         true,
+		},
+	})
+	require.NoError(t, err)
+
+	ipAddr := "127.0.0.1"
+	// denied connections are not failures
+	Config.PostConnectHook = fmt.Sprintf("http://%v/404", httpAddr)
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, Config.ExecutePostConnectHook(ipAddr, ProtocolFTP), errUnexpectedHTTResponse)
+	}
+	hookCmd, err := exec.LookPath("false")
+	require.NoError(t, err)
+	Config.PostConnectHook = hookCmd
+	for i := 0; i < 3; i++ {
+		assert.Error(t, Config.ExecutePostConnectHook(ipAddr, ProtocolFTP))
+	}
+	// the hook cannot be executed, the circuit opens after two failures
+	Config.PostConnectHook = "/invalid/path"
+	assert.Error(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP))
+	assert.Error(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP))
+	// the circuit is open, the connection is allowed
+	assert.NoError(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP))
+
+	err = circuitbreaker.Initialize([]circuitbreaker.Config{
+		{
+			Hook:             command.HookPostConnect,
+			FailureThreshold: 1,
+			RecoveryTimeout:  60,
+		},
+	})
+	require.NoError(t, err)
+	Config.PostConnectHook = "http://invalid:1234/"
+	assert.Error(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP))
+	Config.PostConnectHook = fmt.Sprintf("http://%v", httpAddr)
+	assert.ErrorIs(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP), circuitbreaker.ErrOpen)
+
+	err = circuitbreaker.Initialize(nil)
+	require.NoError(t, err)
+	assert.NoError(t, Config.ExecutePostConnectHook(ipAddr, ProtocolSFTP))
+
+	Config.PostConnectHook = ""
+}
+
 func TestCryptoConvertFileInfo(t *testing.T) {
 	name := "name"
 	fs, err := vfs.NewCryptFs("connID1", os.TempDir(), "", vfs.CryptFsConfig{
@@ -1109,6 +1323,71 @@ func TestParseAllowedIPAndRanges(t *testing.T) {
 	assert.False(t, allow[0](net.ParseIP("192.168.2.2")))
 	assert.True(t, allow[1](net.ParseIP("172.16.0.1")))
 	assert.False(t, allow[1](net.ParseIP("172.16.1.1")))
+	// IPv6, dual stack and IPv4-mapped IPv6
+	allow, err = util.ParseAllowedIPAndRanges([]string{"::1", "2001:db8::/32", "::0/0", "0.0.0.0/0",
+		"::ffff:192.168.1.0/120", "10.8.0.1"})
+	assert.NoError(t, err)
+	assert.True(t, allow[0](net.ParseIP("::1")))
+	assert.False(t, allow[0](net.ParseIP("127.0.0.1")))
+	assert.True(t, allow[1](net.ParseIP("2001:db8:1::2")))
+	assert.False(t, allow[1](net.ParseIP("2001:db9::2")))
+	assert.True(t, allow[2](net.ParseIP("2001:db9::2")))
+	assert.False(t, allow[2](net.ParseIP("192.168.1.1")))
+	assert.True(t, allow[3](net.ParseIP("192.168.1.1")))
+	assert.True(t, allow[3](net.ParseIP("::ffff:192.168.1.1")))
+	assert.False(t, allow[3](net.ParseIP("2001:db9::2")))
+	assert.True(t, allow[4](net.ParseIP("192.168.1.1")))
+	assert.True(t, allow[4](net.ParseIP("::ffff:192.168.1.1")))
+	assert.False(t, allow[4](net.ParseIP("192.168.2.1")))
+	assert.True(t, allow[5](net.ParseIP("::ffff:10.8.0.1")))
+	assert.False(t, allow[5](net.ParseIP("10.8.0.2")))
+}
+
+func TestIPv6Addresses(t *testing.T) {
+	assert.Equal(t, "::1", util.GetIPFromRemoteAddress("[::1]:2022"))
+	assert.Equal(t, "::1", util.GetIPFromRemoteAddress("[::1]"))
+	assert.Equal(t, "::1", util.GetIPFromRemoteAddress("::1"))
+	assert.Equal(t, "2001:db8::1", util.GetIPFromRemoteAddress("[2001:DB8:0::1]:8080"))
+	assert.Equal(t, "192.168.1.1", util.GetIPFromRemoteAddress("[::ffff:192.168.1.1]:2022"))
+	assert.Equal(t, "192.168.1.1", util.GetIPFromRemoteAddress("::ffff:192.168.1.1"))
+	assert.Equal(t, "192.168.1.1", util.GetIPFromRemoteAddress("192.168.1.1:2022"))
+	assert.Equal(t, "192.168.1.1", util.GetIPFromRemoteAddress("192.168.1.1"))
+	assert.Equal(t, "fe80::1%eth0", util.GetIPFromRemoteAddress("[fe80::1%eth0]:2022"))
+	assert.Equal(t, "not an ip", util.GetIPFromRemoteAddress("not an ip"))
+	assert.Equal(t, "[not an ip]", util.GetIPFromRemoteAddress("[not an ip]"))
+
+	assert.Equal(t, "2001:db8::1", util.NormalizeIP("2001:0DB8::0001"))
+	assert.Equal(t, "10.1.1.1", util.NormalizeIP("::ffff:10.1.1.1"))
+	assert.Equal(t, "invalid", util.NormalizeIP("invalid"))
+
+	assert.Equal(t, ":2022", util.JoinHostPort("", 2022))
+	assert.Equal(t, "127.0.0.1:2022", util.JoinHostPort("127.0.0.1", 2022))
+	assert.Equal(t, "[::]:2022", util.JoinHostPort("::", 2022))
+	assert.Equal(t, "[::1]:2022", util.JoinHostPort("[::1]", 2022))
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-For", "2001:db8::5, [2001:db8::6]:1234, ::ffff:10.0.0.1")
+	trustedProxies, err := util.ParseAllowedIPAndRanges([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::6", util.GetClientIP(req, "X-Forwarded-For", 0, trustedProxies))
+	assert.Equal(t, "2001:db8::5", util.GetClientIP(req, "X-Forwarded-For", 1, trustedProxies))
+	assert.Equal(t, "10.0.0.1", util.GetRealIP(req, "X-Forwarded-For", 0))
+
+	user := dataprovider.User{}
+	user.Filters.AllowedIP = []string{"2001:db8::/32", "192.168.1.0/24"}
+	user.Filters.DeniedIP = []string{"2001:db8:1::/48"}
+	assert.True(t, user.IsLoginFromAddrAllowed("[2001:db8::1]:2022"))
+	assert.True(t, user.IsLoginFromAddrAllowed("[::ffff:192.168.1.5]:2022"))
+	assert.True(t, user.IsLoginFromAddrAllowed("192.168.1.5:2022"))
+	assert.False(t, user.IsLoginFromAddrAllowed("[2001:db9::1]:2022"))
+	assert.False(t, user.IsLoginFromAddrAllowed("[::ffff:192.168.2.5]:2022"))
+	user.Filters.AllowedIP = nil
+	assert.False(t, user.IsLoginFromAddrAllowed("[2001:db8:1::1]:2022"))
+	assert.True(t, user.IsLoginFromAddrAllowed("[2001:db8:2::1]:2022"))
+	user.Filters.DeniedIP = []string{"::0/0"}
+	assert.False(t, user.IsLoginFromAddrAllowed("[2001:db8:2::1]:2022"))
+	assert.True(t, user.IsLoginFromAddrAllowed("192.168.1.5:2022"))
 }
 
 func TestHideConfidentialData(t *testing.T) {
@@ -1363,6 +1642,130 @@ func TestUpdateTransferTimestamps(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestConcurrentQuotaFileReservations(t *testing.T) {
+	if dataprovider.GetQuotaTracking() == 0 {
+		t.Skip("this test requires quota tracking")
+	}
+	username := "user_concurrent_quota"
+	user := &dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username:   username,
+			HomeDir:    filepath.Join(os.TempDir(), username),
+			Status:     1,
+			QuotaFiles: 10,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+		},
+	}
+	err := dataprovider.AddUser(user, "", "")
+	require.NoError(t, err)
+	err = dataprovider.UpdateUserQuota(user, 5, 0, true)
+	require.NoError(t, err)
+
+	numUploaders := 100
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	var quotaErrors atomic.Int32
+	for i := 0; i < numUploaders; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			conn := NewBaseConnection(fmt.Sprintf("conn%d", idx), ProtocolSFTP, "", "", *user)
+			ok, err := conn.ReserveNewFile(fmt.Sprintf("/file%d", idx))
+			if ok {
+				reserved.Add(1)
+			}
+			if conn.IsQuotaExceededError(err) {
+				quotaErrors.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	// only the files allowed by the quota can be reserved
+	assert.Equal(t, int32(5), reserved.Load())
+	assert.Equal(t, int32(numUploaders-5), quotaErrors.Load())
+	usedFiles, _, _, _, err := dataprovider.GetUsedQuota(username)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, usedFiles)
+
+	conn := NewBaseConnection("conn", ProtocolSFTP, "", "", *user)
+	for i := 0; i < int(reserved.Load()); i++ {
+		conn.ReleaseNewFile(fmt.Sprintf("/file%d", i), true)
+	}
+	usedFiles, _, _, _, err = dataprovider.GetUsedQuota(username)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, usedFiles)
+
+	err = dataprovider.DeleteUser(username, "", "")
+	assert.NoError(t, err)
+}
+
+func TestConcurrentDirFileReservations(t *testing.T) {
+	username := "user_concurrent_dir_files"
+	homeDir := filepath.Join(os.TempDir(), username)
+	err := os.MkdirAll(filepath.Join(homeDir, "dir"), os.ModePerm)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(homeDir, "dir", "file"), []byte("data"), 0666)
+	require.NoError(t, err)
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: username,
+			HomeDir:  homeDir,
+			Status:   1,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+		},
+	}
+	user.Filters.MaxFilesPerDir = 3
+
+	numUploaders := 50
+	conns := make([]*BaseConnection, numUploaders)
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	var quotaErrors atomic.Int32
+	for i := 0; i < numUploaders; i++ {
+		conns[i] = NewBaseConnection(fmt.Sprintf("conn%d", i), ProtocolSFTP, "", "", user)
+		wg.Add(1)
+		go func(conn *BaseConnection, idx int) {
+			defer wg.Done()
+
+			_, err := conn.ReserveNewFile(fmt.Sprintf("/dir/file%d", idx))
+			if err == nil {
+				reserved.Add(1)
+			}
+			if conn.IsQuotaExceededError(err) {
+				quotaErrors.Add(1)
+			}
+		}(conns[i], i)
+	}
+	wg.Wait()
+	// the existing file uses one of the allowed entries
+	assert.Equal(t, int32(2), reserved.Load())
+	assert.Equal(t, int32(numUploaders-2), quotaErrors.Load())
+	// other directories are not affected
+	_, err = conns[0].ReserveNewFile("/file")
+	assert.NoError(t, err)
+	conns[0].ReleaseNewFile("/file", false)
+
+	for idx, conn := range conns {
+		conn.ReleaseNewFile(fmt.Sprintf("/dir/file%d", idx), false)
+		// releasing twice has no effect
+		conn.ReleaseNewFile(fmt.Sprintf("/dir/file%d", idx), false)
+	}
+	reservedDirFiles.Lock()
+	assert.Len(t, reservedDirFiles.dirs, 0)
+	reservedDirFiles.Unlock()
+	_, err = conns[0].ReserveNewFile("/dir/file0")
+	assert.NoError(t, err)
+	conns[0].ReleaseNewFile("/dir/file0", false)
+
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
+
 func TestMetadataAPI(t *testing.T) {
 	username := "metadatauser"
 	require.False(t, ActiveMetadataChecks.Remove(username))
@@ -1378,6 +1781,198 @@ func TestMetadataAPI(t *testing.T) {
 	require.Len(t, ActiveMetadataChecks.Get(), 0)
 }
 
+func TestDirListCache(t *testing.T) {
+	cache := newDirListingCache(DirListCacheConfig{
+		Size: 2,
+		TTL:  60,
+	})
+	entries := []os.FileInfo{
+		vfs.NewFileInfo("file1", false, 100, time.Now(), false),
+		vfs.NewFileInfo("dir1", true, 0, time.Now(), false),
+	}
+	_, ok := cache.get(1, "/")
+	assert.False(t, ok)
+	cache.add(1, "/", dirListFolder{}, entries)
+	cache.add(1, "/dir1", dirListFolder{}, entries[:1])
+	cached, ok := cache.get(1, "/")
+	assert.True(t, ok)
+	assert.Len(t, cached, 2)
+	// the least recently used entry must be evicted
+	cache.add(2, "/", dirListFolder{}, entries)
+	assert.Equal(t, 2, cache.size())
+	_, ok = cache.get(1, "/dir1")
+	assert.False(t, ok)
+	_, ok = cache.get(1, "/")
+	assert.True(t, ok)
+	// removing a directory must remove its subdirectories too
+	cache.add(1, "/dir1", dirListFolder{}, entries[:1])
+	cache.remove(1, "/", dirListFolder{})
+	assert.Equal(t, 0, cache.size())
+	cache.add(1, "/dir1", dirListFolder{}, entries)
+	cache.add(1, "/dir11", dirListFolder{}, entries)
+	cache.remove(1, "/dir1", dirListFolder{})
+	_, ok = cache.get(1, "/dir11")
+	assert.True(t, ok)
+	cache.removeUser(1)
+	assert.Equal(t, 0, cache.size())
+	// expired entries are not returned
+	cache.ttl = -1 * time.Second
+	cache.add(1, "/", dirListFolder{}, entries)
+	_, ok = cache.get(1, "/")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.size())
+
+	oldCache := dirListCache
+	user1 := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       1,
+			Username: "user1",
+		},
+	}
+	user11 := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       11,
+			Username: "user11",
+		},
+	}
+	dirListCache = nil
+	CacheDirListing(&user1, "/", entries)
+	_, ok = GetCachedDirListing(1, "/")
+	assert.False(t, ok)
+
+	dirListCache = newDirListingCache(DirListCacheConfig{
+		Size: 10,
+		TTL:  60,
+	})
+	CacheDirListing(&user1, "/", entries)
+	CacheDirListing(&user11, "/", entries)
+	cached, ok = GetCachedDirListing(1, "/")
+	assert.True(t, ok)
+	assert.Len(t, cached, 2)
+	invalidateDirListing(&user1, "/")
+	_, ok = GetCachedDirListing(1, "/")
+	assert.False(t, ok)
+	_, ok = GetCachedDirListing(11, "/")
+	assert.True(t, ok)
+	CacheDirListing(&user1, "/", entries)
+	RemoveCachedDirListing(&user1, "")
+	_, ok = GetCachedDirListing(1, "/")
+	assert.False(t, ok)
+	_, ok = GetCachedDirListing(11, "/")
+	assert.True(t, ok)
+	// invalidations from other nodes
+	CacheDirListing(&user1, "/dir1", entries)
+	onDirListInvalidatedEvent([]byte(`{"user_id":1,"virtual_path":"/"}`))
+	_, ok = GetCachedDirListing(1, "/dir1")
+	assert.False(t, ok)
+	onDirListInvalidatedEvent([]byte("invalid json"))
+	// user updates and deletions
+	onUserChanged(11)
+	_, ok = GetCachedDirListing(11, "/")
+	assert.False(t, ok)
+	assert.Len(t, dirListCache.users, 0)
+
+	dirListCache = oldCache
+}
+
+func TestDirListCacheSharedFolders(t *testing.T) {
+	oldCache := dirListCache
+	dirListCache = newDirListingCache(DirListCacheConfig{
+		Size: 20,
+		TTL:  60,
+	})
+	entries := []os.FileInfo{
+		vfs.NewFileInfo("file1", false, 100, time.Now(), false),
+	}
+	// the same folder is mounted on different paths
+	user1 := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       1,
+			Username: "user1",
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name: "shared",
+				},
+				VirtualPath: "/shared",
+			},
+		},
+	}
+	user1.Filters.PathAliases = []dataprovider.PathAlias{
+		{
+			Path:   "/alias",
+			Target: "/shared/sub",
+		},
+	}
+	user2 := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       2,
+			Username: "user2",
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name: "shared",
+				},
+				VirtualPath: "/data/vdir",
+			},
+		},
+	}
+	assert.Equal(t, dirListFolder{}, getDirListFolder(&user1, "/dir"))
+	assert.Equal(t, dirListFolder{name: "shared", path: "/"}, getDirListFolder(&user1, "/shared"))
+	assert.Equal(t, dirListFolder{name: "shared", path: "/sub"}, getDirListFolder(&user1, "/alias"))
+	assert.Equal(t, dirListFolder{name: "shared", path: "/sub/dir"}, getDirListFolder(&user2, "/data/vdir/sub/dir"))
+
+	for _, p := range []string{"/", "/data", "/data/vdir", "/data/vdir/sub", "/data/vdir/sub/dir", "/data/vdir/other"} {
+		CacheDirListing(&user2, p, entries)
+	}
+	CacheDirListing(&user1, "/shared/sub", entries)
+	CacheDirListing(&user1, "/dir", entries)
+	assert.Len(t, dirListCache.folders["shared"], 5)
+	// a write inside the shared folder invalidates the listings for all the users
+	invalidateDirListing(&user1, "/shared/sub")
+	for _, p := range []string{"/data/vdir/sub", "/data/vdir/sub/dir"} {
+		_, ok := GetCachedDirListing(2, p)
+		assert.False(t, ok, p)
+	}
+	for _, p := range []string{"/", "/data", "/data/vdir", "/data/vdir/other"} {
+		_, ok := GetCachedDirListing(2, p)
+		assert.True(t, ok, p)
+	}
+	_, ok := GetCachedDirListing(1, "/shared/sub")
+	assert.False(t, ok)
+	_, ok = GetCachedDirListing(1, "/dir")
+	assert.True(t, ok)
+	// paths outside the virtual folders are invalidated for the same user only
+	CacheDirListing(&user1, "/data", entries)
+	invalidateDirListing(&user2, "/data")
+	_, ok = GetCachedDirListing(2, "/data")
+	assert.False(t, ok)
+	_, ok = GetCachedDirListing(1, "/data")
+	assert.True(t, ok)
+	// the folder root
+	CacheDirListing(&user1, "/alias", entries)
+	RemoveCachedDirListing(&user2, "/data/vdir")
+	_, ok = GetCachedDirListing(1, "/alias")
+	assert.False(t, ok)
+	_, ok = GetCachedDirListing(2, "/data/vdir/other")
+	assert.False(t, ok)
+	assert.Len(t, dirListCache.folders, 0)
+	// invalidations from other nodes
+	CacheDirListing(&user1, "/shared/sub", entries)
+	onDirListInvalidatedEvent([]byte(`{"user_id":2,"virtual_path":"/data/vdir","folder":"shared","folder_path":"/"}`))
+	_, ok = GetCachedDirListing(1, "/shared/sub")
+	assert.False(t, ok)
+	// user updates remove the listings from the folders index too
+	CacheDirListing(&user1, "/shared", entries)
+	onUserChanged(1)
+	assert.Len(t, dirListCache.folders, 0)
+	assert.Len(t, dirListCache.users[1], 0)
+
+	dirListCache = oldCache
+}
+
 func BenchmarkBcryptHashing(b *testing.B) {
 	bcryptPassword := "bcryptpassword"
 	for i := 0; i < b.N; i++ {
@@ -1466,3 +2061,48 @@ func BenchmarkAddRemoveSSHConnections(b *testing.B) {
 	conn1.Close()
 	conn2.Close()
 }
+
+func TestProtocolLogLevel(t *testing.T) {
+	configCopy := Config
+
+	Config.ProtocolLogLevel = map[string]string{
+		"sftpd": "warn",
+	}
+	err := Initialize(Config, 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unsupported protocol")
+	}
+	Config.ProtocolLogLevel = map[string]string{
+		ProtocolSFTP: "verbose",
+	}
+	err = Initialize(Config, 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid log level")
+	}
+	// viper lowercases the map keys
+	Config.ProtocolLogLevel = map[string]string{
+		"sftp": "warn",
+		"dav":  "Debug",
+	}
+	err = Initialize(Config, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]logger.LogLevel{
+		ProtocolSFTP:   logger.LevelWarn,
+		ProtocolWebDAV: logger.LevelDebug,
+	}, Config.protocolLogLevels)
+
+	conn := NewBaseConnection("id", ProtocolSFTP, "", "", dataprovider.User{})
+	assert.False(t, conn.isLogLevelEnabled(logger.LevelDebug))
+	assert.False(t, conn.isLogLevelEnabled(logger.LevelInfo))
+	assert.True(t, conn.isLogLevelEnabled(logger.LevelWarn))
+	assert.True(t, conn.isLogLevelEnabled(logger.LevelError))
+	conn = NewBaseConnection("id", ProtocolFTP, "", "", dataprovider.User{})
+	assert.True(t, conn.isLogLevelEnabled(logger.LevelDebug))
+	conn = NewBaseConnection("id", ProtocolWebDAV, "", "", dataprovider.User{})
+	assert.True(t, conn.isLogLevelEnabled(logger.LevelDebug))
+
+	Config = configCopy
+	err = Initialize(Config, 0)
+	assert.NoError(t, err)
+	assert.Len(t, Config.protocolLogLevels, 0)
+}
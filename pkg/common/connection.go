@@ -17,8 +17,10 @@ package common
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -27,6 +29,7 @@ import (
 	ftpserver "github.com/fclairamb/ftpserverlib"
 	"github.com/pkg/sftp"
 	"github.com/sftpgo/sdk"
+	"golang.org/x/time/rate"
 
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
@@ -44,17 +47,33 @@ type BaseConnection struct {
 	// unique ID for a transfer.
 	// This field is accessed atomically so we put it at the beginning of the struct to achieve 64 bit alignment
 	transferID atomic.Int64
+	// negotiated SFTP protocol version, 0 for non SFTP connections or if
+	// the version is not yet negotiated
+	sftpVersion atomic.Int32
+	// file operations counters, they are reported when an anomaly rule triggers
+	downloadsCount atomic.Int64
+	deletionsCount atomic.Int64
 	// Unique identifier for the connection
 	ID string
 	// user associated with this connection if any
 	User dataprovider.User
+	// copy of the user with the refreshed effective permissions, nil until
+	// the first refresh. Use GetEffectiveUser for permission checks
+	effectiveUser atomic.Pointer[dataprovider.User]
 	// start time for this connection
 	startTime  time.Time
 	protocol   string
 	remoteAddr string
 	localAddr  string
+	// ID of the HTTP request that created this connection, if any
+	requestID string
+	// token buckets for bandwidth bursts, nil if not enabled
+	uploadBucket   *rate.Limiter
+	downloadBucket *rate.Limiter
 	sync.RWMutex
 	activeTransfers []ActiveTransfer
+	// directory entries reserved for the uploads, by virtual path
+	reservedDirFiles map[string]int
 }
 
 // NewBaseConnection returns a new BaseConnection
@@ -64,6 +83,7 @@ func NewBaseConnection(id, protocol, localAddr, remoteAddr string, user dataprov
 		connID = fmt.Sprintf("%s_%s", protocol, id)
 	}
 	user.UploadBandwidth, user.DownloadBandwidth = user.GetBandwidthForIP(util.GetIPFromRemoteAddress(remoteAddr), connID)
+	user.ApplyAutoVirtualFolders()
 	c := &BaseConnection{
 		ID:         connID,
 		User:       user,
@@ -72,6 +92,8 @@ func NewBaseConnection(id, protocol, localAddr, remoteAddr string, user dataprov
 		localAddr:  localAddr,
 		remoteAddr: remoteAddr,
 	}
+	c.uploadBucket = newBandwidthBucket(user.UploadBandwidth, user.Filters.UploadBurstSize)
+	c.downloadBucket = newBandwidthBucket(user.DownloadBandwidth, user.Filters.DownloadBurstSize)
 	c.transferID.Store(0)
 	c.lastActivity.Store(time.Now().UnixNano())
 
@@ -80,7 +102,76 @@ func NewBaseConnection(id, protocol, localAddr, remoteAddr string, user dataprov
 
 // Log outputs a log entry to the configured logger
 func (c *BaseConnection) Log(level logger.LogLevel, format string, v ...any) {
-	logger.Log(level, c.protocol, c.ID, format, v...)
+	if !c.isLogLevelEnabled(level) {
+		return
+	}
+	logger.LogWithRequestID(level, c.protocol, c.ID, c.requestID, format, v...)
+}
+
+// isLogLevelEnabled returns false if the specified level is lower than the
+// one configured for the connection protocol
+func (c *BaseConnection) isLogLevelEnabled(level logger.LogLevel) bool {
+	return Config.isProtocolLogLevelEnabled(c.protocol, level)
+}
+
+// SetRequestID sets the ID of the HTTP request associated with this connection,
+// it is included in the connection logs
+func (c *BaseConnection) SetRequestID(requestID string) {
+	c.requestID = requestID
+}
+
+// GetBandwidthBuckets returns the status of the upload and download buckets
+// used for bandwidth bursts. nil means bursts are not enabled
+func (c *BaseConnection) GetBandwidthBuckets() (*BandwidthBucket, *BandwidthBucket) {
+	return getBandwidthBucketStatus(c.uploadBucket), getBandwidthBucketStatus(c.downloadBucket)
+}
+
+// HasGroupSettings returns true if the connection user inherits the settings
+// of the specified group, membership groups are ignored
+func (c *BaseConnection) HasGroupSettings(name string) bool {
+	for _, g := range c.User.Groups {
+		if g.Name == name {
+			return g.Type != sdk.GroupTypeMembership
+		}
+	}
+	return false
+}
+
+// RefreshEffectivePermissions reloads the user and updates the connection
+// permissions by merging the user and group permissions again.
+// The connection is not dropped
+func (c *BaseConnection) RefreshEffectivePermissions() error {
+	user, err := dataprovider.GetUserWithGroupSettings(c.User.Username)
+	if err != nil {
+		return err
+	}
+	// the permissions are read without locking, we swap a new copy of the user
+	effective := *c.GetEffectiveUser()
+	effective.Permissions = user.Permissions
+	c.effectiveUser.Store(&effective)
+
+	c.Log(logger.LevelDebug, "effective permissions refreshed")
+	return nil
+}
+
+// GetEffectiveUser returns the user to use for permission checks, the effective
+// permissions can be refreshed, after a group update, while the connection is active.
+// The returned user must not be modified
+func (c *BaseConnection) GetEffectiveUser() *dataprovider.User {
+	if user := c.effectiveUser.Load(); user != nil {
+		return user
+	}
+	return &c.User
+}
+
+// SetSFTPVersion sets the negotiated SFTP protocol version
+func (c *BaseConnection) SetSFTPVersion(version int) {
+	c.sftpVersion.Store(int32(version))
+}
+
+// GetSFTPVersion returns the negotiated SFTP protocol version, 0 means not negotiated
+func (c *BaseConnection) GetSFTPVersion() int {
+	return int(c.sftpVersion.Load())
 }
 
 // GetTransferID returns an unique transfer ID for this connection
@@ -147,7 +238,9 @@ func (c *BaseConnection) AddTransfer(t ActiveTransfer) {
 	defer c.Unlock()
 
 	c.activeTransfers = append(c.activeTransfers, t)
+	Connections.activeTransfers.Add(1)
 	c.Log(logger.LevelDebug, "transfer added, id: %v, active transfers: %v", t.GetID(), len(c.activeTransfers))
+	notifyTransferEvent(ConnectionEventTransferStarted, c.ID, t)
 	if t.HasSizeLimit() {
 		folderName := ""
 		if t.GetType() == TransferUpload {
@@ -187,7 +280,9 @@ func (c *BaseConnection) RemoveTransfer(t ActiveTransfer) {
 			c.activeTransfers[idx] = c.activeTransfers[lastIdx]
 			c.activeTransfers[lastIdx] = nil
 			c.activeTransfers = c.activeTransfers[:lastIdx]
+			Connections.activeTransfers.Add(-1)
 			c.Log(logger.LevelDebug, "transfer removed, id: %v active transfers: %v", t.GetID(), len(c.activeTransfers))
+			notifyTransferEvent(ConnectionEventTransferCompleted, c.ID, t)
 			return
 		}
 	}
@@ -215,28 +310,32 @@ func (c *BaseConnection) GetTransfers() []ConnectionTransfer {
 
 	transfers := make([]ConnectionTransfer, 0, len(c.activeTransfers))
 	for _, t := range c.activeTransfers {
-		var operationType string
-		switch t.GetType() {
-		case TransferDownload:
-			operationType = operationDownload
-		case TransferUpload:
-			operationType = operationUpload
-		}
-		transfers = append(transfers, ConnectionTransfer{
-			ID:            t.GetID(),
-			OperationType: operationType,
-			StartTime:     util.GetTimeAsMsSinceEpoch(t.GetStartTime()),
-			Size:          t.GetSize(),
-			VirtualPath:   t.GetVirtualPath(),
-			HasSizeLimit:  t.HasSizeLimit(),
-			ULSize:        t.GetUploadedSize(),
-			DLSize:        t.GetDownloadedSize(),
-		})
+		transfers = append(transfers, getConnectionTransfer(t))
 	}
 
 	return transfers
 }
 
+func getConnectionTransfer(t ActiveTransfer) ConnectionTransfer {
+	var operationType string
+	switch t.GetType() {
+	case TransferDownload:
+		operationType = operationDownload
+	case TransferUpload:
+		operationType = operationUpload
+	}
+	return ConnectionTransfer{
+		ID:            t.GetID(),
+		OperationType: operationType,
+		StartTime:     util.GetTimeAsMsSinceEpoch(t.GetStartTime()),
+		Size:          t.GetSize(),
+		VirtualPath:   t.GetVirtualPath(),
+		HasSizeLimit:  t.HasSizeLimit(),
+		ULSize:        t.GetUploadedSize(),
+		DLSize:        t.GetDownloadedSize(),
+	}
+}
+
 // SignalTransfersAbort signals to the active transfers to exit as soon as possible
 func (c *BaseConnection) SignalTransfersAbort() error {
 	c.RLock()
@@ -292,7 +391,7 @@ func (c *BaseConnection) truncateOpenHandle(fsPath string, size int64) (int64, e
 
 // ListDir reads the directory matching virtualPath and returns a list of directory entries
 func (c *BaseConnection) ListDir(virtualPath string) ([]os.FileInfo, error) {
-	if !c.User.HasPerm(dataprovider.PermListItems, virtualPath) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, virtualPath) {
 		return nil, c.GetPermissionDeniedError()
 	}
 	fs, fsPath, err := c.GetFsAndResolvedPath(virtualPath)
@@ -307,6 +406,27 @@ func (c *BaseConnection) ListDir(virtualPath string) ([]os.FileInfo, error) {
 	return c.User.FilterListDir(files, virtualPath), nil
 }
 
+// ListDirCached is like ListDir but it uses the directory listings cache, if enabled.
+// The cached listings are sorted using the configured order
+func (c *BaseConnection) ListDirCached(virtualPath string) ([]os.FileInfo, error) {
+	if dirListCache == nil {
+		return c.ListDir(virtualPath)
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, virtualPath) {
+		return nil, c.GetPermissionDeniedError()
+	}
+	if entries, ok := GetCachedDirListing(c.User.ID, virtualPath); ok {
+		return entries, nil
+	}
+	files, err := c.ListDir(virtualPath)
+	if err != nil {
+		return nil, err
+	}
+	c.SortDirListing(files)
+	CacheDirListing(&c.User, virtualPath, files)
+	return files, nil
+}
+
 // CheckParentDirs tries to create the specified directory and any missing parent dirs
 func (c *BaseConnection) CheckParentDirs(virtualPath string) error {
 	fs, err := c.User.GetFilesystemForPath(virtualPath, c.GetID())
@@ -341,15 +461,110 @@ func (c *BaseConnection) GetCreateChecks(virtualPath string, isNewFile bool) int
 	if !isNewFile {
 		return 0
 	}
-	if !c.User.HasPerm(dataprovider.PermCreateDirs, path.Dir(virtualPath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(virtualPath)) {
 		return vfs.CheckParentDir
 	}
 	return 0
 }
 
+// IsAtomicUploadEnabled returns true if the uploads must be written to a temporary
+// path and renamed when they end. The user's upload mode overrides the global one
+func (c *BaseConnection) IsAtomicUploadEnabled() bool {
+	switch c.User.Filters.UploadMode {
+	case dataprovider.UploadModeDirectStream:
+		return false
+	case dataprovider.UploadModeTempFile:
+		return true
+	default:
+		return Config.IsAtomicUploadEnabled()
+	}
+}
+
+func (c *BaseConnection) getFileNameSanitizeMode() string {
+	if c.User.Filters.FileNameSanitize != "" {
+		return c.User.Filters.FileNameSanitize
+	}
+	return Config.FileNameSanitize
+}
+
+// SanitizeTargetPath applies the configured file name sanitization rules to
+// the last element of the specified virtual path and returns the virtual path
+// to use. The parent directories are not modified, they already exist.
+// An error is returned if the file name is not allowed
+func (c *BaseConnection) SanitizeTargetPath(virtualPath string) (string, error) {
+	mode := c.getFileNameSanitizeMode()
+	if mode == "" || mode == dataprovider.FileNameSanitizeNone {
+		return virtualPath, nil
+	}
+	fs, err := c.User.GetFilesystemForPath(virtualPath, c.ID)
+	if err != nil {
+		return virtualPath, err
+	}
+	dir, name := path.Split(virtualPath)
+	sanitized := name
+	switch mode {
+	case dataprovider.FileNameSanitizeStripControl:
+		sanitized = vfs.StripControlChars(name)
+	case dataprovider.FileNameSanitizeReplace:
+		sanitized = vfs.ReplaceDisallowedChars(fs, name)
+	}
+	if sanitized == "" {
+		c.Log(logger.LevelWarn, "file name %q is empty after sanitization", name)
+		return virtualPath, c.GetPermissionDeniedError()
+	}
+	if err := fs.ValidatePath(sanitized); err != nil {
+		c.Log(logger.LevelWarn, "file name %q rejected, sanitization mode %q: %v", name, mode, err)
+		return virtualPath, c.GetPermissionDeniedError()
+	}
+	if sanitized != name {
+		c.Log(logger.LevelDebug, "file name %q sanitized as %q", name, sanitized)
+	}
+	return dir + sanitized, nil
+}
+
+// getProtocolForFilters returns the connection protocol as defined in the
+// user filters, for example SFTP and SCP are both SSH
+func (c *BaseConnection) getProtocolForFilters() string {
+	switch c.protocol {
+	case ProtocolSFTP, ProtocolSCP, ProtocolSSH:
+		return ProtocolSSH
+	case ProtocolHTTPShare, ProtocolOIDC:
+		return ProtocolHTTP
+	default:
+		return c.protocol
+	}
+}
+
+// GetUploadTargetPath returns the virtual path to use for uploading the
+// specified virtual path. The path rewrite rules are applied first, the
+// missing parent directories for a rewritten path are created, then the
+// file name sanitization rules are applied
+func (c *BaseConnection) GetUploadTargetPath(virtualPath string) (string, error) {
+	rewritten, ok := c.User.RewriteUploadPath(virtualPath, c.getProtocolForFilters())
+	if ok && rewritten != virtualPath {
+		c.Log(logger.LevelDebug, "upload path %q rewritten as %q", virtualPath, rewritten)
+		if rewritten == "/" {
+			return virtualPath, c.GetPermissionDeniedError()
+		}
+		if err := c.CheckParentDirs(path.Dir(rewritten)); err != nil {
+			c.Log(logger.LevelWarn, "unable to create the parent dirs for the rewritten path %q: %v", rewritten, err)
+			if errors.Is(err, c.GetPermissionDeniedError()) {
+				return virtualPath, c.GetPermissionDeniedError()
+			}
+			return virtualPath, c.GetGenericError(err)
+		}
+		virtualPath = rewritten
+	}
+	return c.SanitizeTargetPath(virtualPath)
+}
+
 // CreateDir creates a new directory at the specified fsPath
 func (c *BaseConnection) CreateDir(virtualPath string, checkFilePatterns bool) error {
-	if !c.User.HasPerm(dataprovider.PermCreateDirs, path.Dir(virtualPath)) {
+	virtualPath, err := c.SanitizeTargetPath(virtualPath)
+	if err != nil {
+		return err
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(virtualPath)) {
 		return c.GetPermissionDeniedError()
 	}
 	if checkFilePatterns {
@@ -361,6 +576,10 @@ func (c *BaseConnection) CreateDir(virtualPath string, checkFilePatterns bool) e
 		c.Log(logger.LevelWarn, "mkdir not allowed %#v is a virtual folder", virtualPath)
 		return c.GetPermissionDeniedError()
 	}
+	if c.User.IsPathAlias(virtualPath) {
+		c.Log(logger.LevelWarn, "mkdir not allowed %q is a path alias", virtualPath)
+		return c.GetPermissionDeniedError()
+	}
 	fs, fsPath, err := c.GetFsAndResolvedPath(virtualPath)
 	if err != nil {
 		return err
@@ -370,16 +589,20 @@ func (c *BaseConnection) CreateDir(virtualPath string, checkFilePatterns bool) e
 		return c.GetFsError(fs, err)
 	}
 	vfs.SetPathPermissions(fs, fsPath, c.User.GetUID(), c.User.GetGID())
+	invalidateDirListing(&c.User, path.Dir(virtualPath))
 
-	logger.CommandLog(mkdirLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
-		c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(mkdirLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
+			c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodMkdir, virtualPath, 0, 0, 0, nil)
 	ExecuteActionNotification(c, operationMkdir, fsPath, virtualPath, "", "", "", 0, nil) //nolint:errcheck
 	return nil
 }
 
 // IsRemoveFileAllowed returns an error if removing this file is not allowed
 func (c *BaseConnection) IsRemoveFileAllowed(virtualPath string) error {
-	if !c.User.HasAnyPerm([]string{dataprovider.PermDeleteFiles, dataprovider.PermDelete}, path.Dir(virtualPath)) {
+	if !c.GetEffectiveUser().HasAnyPerm([]string{dataprovider.PermDeleteFiles, dataprovider.PermDelete}, path.Dir(virtualPath)) {
 		return c.GetPermissionDeniedError()
 	}
 	if ok, policy := c.User.IsFileAllowed(virtualPath); !ok {
@@ -389,13 +612,33 @@ func (c *BaseConnection) IsRemoveFileAllowed(virtualPath string) error {
 	return nil
 }
 
+// checkMinRetention returns an error if the file is younger than the min
+// retention defined in the user data retention policy. Retention checks and
+// event actions are not manual deletions and are not restricted
+func (c *BaseConnection) checkMinRetention(virtualPath string, info os.FileInfo) error {
+	if c.protocol == ProtocolDataRetention || c.protocol == protocolEventAction {
+		return nil
+	}
+	if !c.User.Filters.DataRetentionPolicy.IsRemoveAllowed(virtualPath, info.ModTime()) {
+		c.Log(logger.LevelInfo, "removing file %q is not allowed, min retention: %d days, modification time: %v",
+			virtualPath, c.User.Filters.DataRetentionPolicy.GetMinRetentionDays(path.Dir(virtualPath)), info.ModTime())
+		return c.GetPermissionDeniedError()
+	}
+	return nil
+}
+
 // RemoveFile removes a file at the specified fsPath
 func (c *BaseConnection) RemoveFile(fs vfs.Fs, fsPath, virtualPath string, info os.FileInfo) error {
 	if err := c.IsRemoveFileAllowed(virtualPath); err != nil {
 		return err
 	}
+	if err := c.checkMinRetention(virtualPath, info); err != nil {
+		return err
+	}
 
 	size := info.Size()
+	// must be evaluated before removing the file
+	quotaSize := vfs.GetQuotaSize(fs, fsPath, size)
 	actionErr := ExecutePreAction(c, operationPreDelete, fsPath, virtualPath, size, 0)
 	if actionErr == nil {
 		c.Log(logger.LevelDebug, "remove for path %#v handled by pre-delete action", fsPath)
@@ -405,18 +648,23 @@ func (c *BaseConnection) RemoveFile(fs vfs.Fs, fsPath, virtualPath string, info
 			return c.GetFsError(fs, err)
 		}
 	}
+	invalidateDirListing(&c.User, path.Dir(virtualPath))
 
-	logger.CommandLog(removeLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
-		c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(removeLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
+			c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodDelete, virtualPath, 0, 0, 0, nil)
+	c.checkAnomalies(anomalyOpDelete)
 	if info.Mode()&os.ModeSymlink == 0 {
 		vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(virtualPath))
 		if err == nil {
-			dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, -1, -size, false) //nolint:errcheck
+			dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, -1, -quotaSize, false) //nolint:errcheck
 			if vfolder.IsIncludedInUserQuota() {
-				dataprovider.UpdateUserQuota(&c.User, -1, -size, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.User, -1, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			dataprovider.UpdateUserQuota(&c.User, -1, -size, false) //nolint:errcheck
+			dataprovider.UpdateUserQuota(&c.User, -1, -quotaSize, false) //nolint:errcheck
 		}
 	}
 	if actionErr != nil {
@@ -427,6 +675,32 @@ func (c *BaseConnection) RemoveFile(fs vfs.Fs, fsPath, virtualPath string, info
 
 // IsRemoveDirAllowed returns an error if removing this directory is not allowed
 func (c *BaseConnection) IsRemoveDirAllowed(fs vfs.Fs, fsPath, virtualPath string) error {
+	if err := c.isRemoveDirAllowed(fs, fsPath, virtualPath); err != nil {
+		return err
+	}
+	return c.checkLockedObjects(fs, fsPath, virtualPath)
+}
+
+// checkLockedObjects returns an error if the directory contains objects
+// protected by an object lock (WORM), they cannot be removed
+func (c *BaseConnection) checkLockedObjects(fs vfs.Fs, fsPath, virtualPath string) error {
+	locker, ok := fs.(vfs.FsObjectLocker)
+	if !ok {
+		return nil
+	}
+	hasLockedObjects, err := locker.HasLockedObjects(fsPath)
+	if err != nil {
+		c.Log(logger.LevelError, "unable to check locked objects inside directory %q: %v", virtualPath, err)
+		return c.GetFsError(fs, err)
+	}
+	if hasLockedObjects {
+		c.Log(logger.LevelWarn, "removing a directory with locked objects inside is not allowed: %q", virtualPath)
+		return c.GetPermissionDeniedError()
+	}
+	return nil
+}
+
+func (c *BaseConnection) isRemoveDirAllowed(fs vfs.Fs, fsPath, virtualPath string) error {
 	if fs.GetRelativePath(fsPath) == "/" {
 		c.Log(logger.LevelWarn, "removing root dir is not allowed")
 		return c.GetPermissionDeniedError()
@@ -435,6 +709,14 @@ func (c *BaseConnection) IsRemoveDirAllowed(fs vfs.Fs, fsPath, virtualPath strin
 		c.Log(logger.LevelWarn, "removing a virtual folder is not allowed: %#v", virtualPath)
 		return c.GetPermissionDeniedError()
 	}
+	if c.User.IsReadOnlyPath(virtualPath) {
+		c.Log(logger.LevelWarn, "removing a directory inside a read-only virtual folder is not allowed: %q", virtualPath)
+		return c.GetPermissionDeniedError()
+	}
+	if c.User.IsPathAlias(virtualPath) {
+		c.Log(logger.LevelWarn, "removing a path alias is not allowed: %q", virtualPath)
+		return c.GetPermissionDeniedError()
+	}
 	if c.User.HasVirtualFoldersInside(virtualPath) {
 		c.Log(logger.LevelWarn, "removing a directory with a virtual folder inside is not allowed: %#v", virtualPath)
 		return c.GetOpUnsupportedError()
@@ -443,7 +725,7 @@ func (c *BaseConnection) IsRemoveDirAllowed(fs vfs.Fs, fsPath, virtualPath strin
 		c.Log(logger.LevelWarn, "removing a directory mapped as virtual folder is not allowed: %#v", fsPath)
 		return c.GetPermissionDeniedError()
 	}
-	if !c.User.HasAnyPerm([]string{dataprovider.PermDeleteDirs, dataprovider.PermDelete}, path.Dir(virtualPath)) {
+	if !c.GetEffectiveUser().HasAnyPerm([]string{dataprovider.PermDeleteDirs, dataprovider.PermDelete}, path.Dir(virtualPath)) {
 		return c.GetPermissionDeniedError()
 	}
 	if ok, policy := c.User.IsFileAllowed(virtualPath); !ok {
@@ -481,9 +763,14 @@ func (c *BaseConnection) RemoveDir(virtualPath string) error {
 		c.Log(logger.LevelError, "failed to remove directory %#v: %+v", fsPath, err)
 		return c.GetFsError(fs, err)
 	}
+	invalidateDirListing(&c.User, virtualPath)
+	invalidateDirListing(&c.User, path.Dir(virtualPath))
 
-	logger.CommandLog(rmdirLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
-		c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(rmdirLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "", "", -1,
+			c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodRmdir, virtualPath, 0, 0, 0, nil)
 	ExecuteActionNotification(c, operationRmdir, fsPath, virtualPath, "", "", "", 0, nil) //nolint:errcheck
 	return nil
 }
@@ -536,6 +823,10 @@ func (c *BaseConnection) removeDirTree(fs vfs.Fs, fsPath, virtualPath string) er
 	var dirsToRemove []objectToRemoveMapping
 	var filesToRemove []objectToRemoveMapping
 
+	// locked objects are checked once for the whole tree
+	if err := c.checkLockedObjects(fs, fsPath, virtualPath); err != nil {
+		return err
+	}
 	err := fs.Walk(fsPath, func(walkedPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -547,7 +838,7 @@ func (c *BaseConnection) removeDirTree(fs vfs.Fs, fsPath, virtualPath string) er
 			info:        info,
 		}
 		if info.IsDir() {
-			err = c.IsRemoveDirAllowed(fs, obj.fsPath, obj.virtualPath)
+			err = c.isRemoveDirAllowed(fs, obj.fsPath, obj.virtualPath)
 			isDuplicated := false
 			for _, d := range dirsToRemove {
 				if d.fsPath == obj.fsPath {
@@ -560,6 +851,9 @@ func (c *BaseConnection) removeDirTree(fs vfs.Fs, fsPath, virtualPath string) er
 			}
 		} else {
 			err = c.IsRemoveFileAllowed(obj.virtualPath)
+			if err == nil {
+				err = c.checkMinRetention(obj.virtualPath, info)
+			}
 			filesToRemove = append(filesToRemove, obj)
 		}
 		if err != nil {
@@ -616,6 +910,10 @@ func (c *BaseConnection) RemoveAll(virtualPath string) error {
 
 // Rename renames (moves) virtualSourcePath to virtualTargetPath
 func (c *BaseConnection) Rename(virtualSourcePath, virtualTargetPath string) error {
+	virtualTargetPath, err := c.SanitizeTargetPath(virtualTargetPath)
+	if err != nil {
+		return err
+	}
 	if virtualSourcePath == virtualTargetPath {
 		return fmt.Errorf("the rename source and target cannot be the same: %w", c.GetOpUnsupportedError())
 	}
@@ -643,9 +941,9 @@ func (c *BaseConnection) Rename(virtualSourcePath, virtualTargetPath string) err
 		}
 		// we are overwriting an existing file/symlink
 		if dstInfo.Mode().IsRegular() {
-			initialSize = dstInfo.Size()
+			initialSize = vfs.GetQuotaSize(fsDst, fsTargetPath, dstInfo.Size())
 		}
-		if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(virtualTargetPath)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(virtualTargetPath)) {
 			c.Log(logger.LevelDebug, "renaming %q -> %q is not allowed. Target exists but the user %q"+
 				"has no overwrite permission", virtualSourcePath, virtualTargetPath, c.User.Username)
 			return c.GetPermissionDeniedError()
@@ -672,17 +970,36 @@ func (c *BaseConnection) Rename(virtualSourcePath, virtualTargetPath string) err
 		return c.GetFsError(fsSrc, err)
 	}
 	vfs.SetPathPermissions(fsDst, fsTargetPath, c.User.GetUID(), c.User.GetGID())
+	c.invalidateDirListingsAfterRename(virtualSourcePath, virtualTargetPath, srcInfo.IsDir())
 	c.updateQuotaAfterRename(fsDst, virtualSourcePath, virtualTargetPath, fsTargetPath, initialSize) //nolint:errcheck
-	logger.CommandLog(renameLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1,
-		"", "", "", -1, c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(renameLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1,
+			"", "", "", -1, c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodRename, virtualSourcePath, 0, 0, 0, nil)
 	ExecuteActionNotification(c, operationRename, fsSourcePath, virtualSourcePath, fsTargetPath, //nolint:errcheck
 		virtualTargetPath, "", 0, nil)
 
 	return nil
 }
 
+func (c *BaseConnection) invalidateDirListingsAfterRename(virtualSourcePath, virtualTargetPath string, isDir bool) {
+	if isDir {
+		invalidateDirListing(&c.User, virtualSourcePath)
+		invalidateDirListing(&c.User, virtualTargetPath)
+	}
+	invalidateDirListing(&c.User, path.Dir(virtualSourcePath))
+	if path.Dir(virtualSourcePath) != path.Dir(virtualTargetPath) {
+		invalidateDirListing(&c.User, path.Dir(virtualTargetPath))
+	}
+}
+
 // CreateSymlink creates fsTargetPath as a symbolic link to fsSourcePath
 func (c *BaseConnection) CreateSymlink(virtualSourcePath, virtualTargetPath string) error {
+	virtualTargetPath, err := c.SanitizeTargetPath(virtualTargetPath)
+	if err != nil {
+		return err
+	}
 	var relativePath string
 	if !path.IsAbs(virtualSourcePath) {
 		relativePath = virtualSourcePath
@@ -699,7 +1016,7 @@ func (c *BaseConnection) CreateSymlink(virtualSourcePath, virtualTargetPath stri
 	if err != nil {
 		return err
 	}
-	fsTargetPath, err := fs.ResolvePath(virtualTargetPath)
+	fsTargetPath, err := fs.ResolvePath(c.User.ResolvePathAlias(virtualTargetPath))
 	if err != nil {
 		return c.GetFsError(fs, err)
 	}
@@ -711,7 +1028,7 @@ func (c *BaseConnection) CreateSymlink(virtualSourcePath, virtualTargetPath stri
 		c.Log(logger.LevelError, "symlinking to root dir is not allowed")
 		return c.GetPermissionDeniedError()
 	}
-	if !c.User.HasPerm(dataprovider.PermCreateSymlinks, path.Dir(virtualTargetPath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermCreateSymlinks, path.Dir(virtualTargetPath)) {
 		return c.GetPermissionDeniedError()
 	}
 	ok, policy := c.User.IsFileAllowed(virtualSourcePath)
@@ -730,11 +1047,350 @@ func (c *BaseConnection) CreateSymlink(virtualSourcePath, virtualTargetPath stri
 		c.Log(logger.LevelError, "failed to create symlink %#v -> %#v: %+v", fsSourcePath, fsTargetPath, err)
 		return c.GetFsError(fs, err)
 	}
-	logger.CommandLog(symlinkLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1, "",
-		"", "", -1, c.localAddr, c.remoteAddr)
+	invalidateDirListing(&c.User, path.Dir(virtualTargetPath))
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(symlinkLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1, "",
+			"", "", -1, c.localAddr, c.remoteAddr)
+	}
+	return nil
+}
+
+// CreateHardlink creates virtualTargetPath as a hard link to virtualSourcePath.
+// Hard links share the data with the source file so they only count as a file
+// in the quota usage
+func (c *BaseConnection) CreateHardlink(virtualSourcePath, virtualTargetPath string) error {
+	virtualTargetPath, err := c.SanitizeTargetPath(virtualTargetPath)
+	if err != nil {
+		return err
+	}
+	if c.isCrossFoldersRequest(virtualSourcePath, virtualTargetPath) {
+		c.Log(logger.LevelWarn, "cross folder hard link is not supported, src: %q dst: %q", virtualSourcePath, virtualTargetPath)
+		return c.GetOpUnsupportedError()
+	}
+	// we cannot have a cross folder request here so only one fs is enough
+	fs, fsSourcePath, err := c.GetFsAndResolvedPath(virtualSourcePath)
+	if err != nil {
+		return err
+	}
+	linker, ok := fs.(vfs.FsHardLinker)
+	if !ok {
+		c.Log(logger.LevelDebug, "hard links are not supported for fs %q", fs.Name())
+		return c.GetFsError(fs, vfs.ErrVfsUnsupported)
+	}
+	fsTargetPath, err := fs.ResolvePath(c.User.ResolvePathAlias(virtualTargetPath))
+	if err != nil {
+		return c.GetFsError(fs, err)
+	}
+	if fs.GetRelativePath(fsSourcePath) == "/" || fs.GetRelativePath(fsTargetPath) == "/" {
+		c.Log(logger.LevelError, "hard links from/to the root dir are not allowed")
+		return c.GetPermissionDeniedError()
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermCreateSymlinks, path.Dir(virtualTargetPath)) {
+		return c.GetPermissionDeniedError()
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(virtualSourcePath)) {
+		return c.GetPermissionDeniedError()
+	}
+	if ok, policy := c.User.IsFileAllowed(virtualSourcePath); !ok {
+		c.Log(logger.LevelError, "hard link source path %q is not allowed", virtualSourcePath)
+		return c.GetErrorForDeniedFile(policy)
+	}
+	if ok, _ := c.User.IsFileAllowed(virtualTargetPath); !ok {
+		c.Log(logger.LevelError, "hard link target path %q is not allowed", virtualTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	info, err := fs.Lstat(fsSourcePath)
+	if err != nil {
+		return c.GetFsError(fs, err)
+	}
+	if !info.Mode().IsRegular() {
+		c.Log(logger.LevelError, "hard links are only supported for regular files, source path %q", virtualSourcePath)
+		return c.GetOpUnsupportedError()
+	}
+	if dataprovider.GetQuotaTracking() > 0 {
+		if quotaResult, _ := c.HasSpace(true, false, virtualTargetPath); !quotaResult.HasSpace {
+			c.Log(logger.LevelInfo, "denying hard link %q -> %q due to space limit", virtualSourcePath, virtualTargetPath)
+			return c.GetQuotaExceededError()
+		}
+	}
+	if err := linker.Link(fsSourcePath, fsTargetPath); err != nil {
+		c.Log(logger.LevelError, "failed to create hard link %q -> %q: %+v", fsSourcePath, fsTargetPath, err)
+		return c.GetFsError(fs, err)
+	}
+	// the link is removed as any other file, removing a file with multiple links
+	// does not free any disk space so only the number of files is updated here
+	vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(virtualTargetPath))
+	if err == nil {
+		dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 1, 0, false) //nolint:errcheck
+		if vfolder.IsIncludedInUserQuota() {
+			dataprovider.UpdateUserQuota(&c.User, 1, 0, false) //nolint:errcheck
+		}
+	} else {
+		dataprovider.UpdateUserQuota(&c.User, 1, 0, false) //nolint:errcheck
+	}
+	invalidateDirListing(&c.User, path.Dir(virtualTargetPath))
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(hardlinkLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1, "",
+			"", "", -1, c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodLink, virtualSourcePath, 0, 0, 0, nil)
+	return nil
+}
+
+type copyEntry struct {
+	virtualSourcePath string
+	virtualTargetPath string
+	fsSourcePath      string
+	fsTargetPath      string
+	info              os.FileInfo
+}
+
+// CopyFile copies the file virtualSourcePath to virtualTargetPath without transferring
+// its contents to the client. The target must not exist
+func (c *BaseConnection) CopyFile(virtualSourcePath, virtualTargetPath string) error {
+	return c.copyPath(virtualSourcePath, virtualTargetPath, false)
+}
+
+// CopyDir recursively copies the directory virtualSourcePath to virtualTargetPath
+// without transferring its contents to the client. The target must not exist
+func (c *BaseConnection) CopyDir(virtualSourcePath, virtualTargetPath string) error {
+	return c.copyPath(virtualSourcePath, virtualTargetPath, true)
+}
+
+func (c *BaseConnection) copyPath(virtualSourcePath, virtualTargetPath string, isDir bool) error {
+	virtualTargetPath, err := c.SanitizeTargetPath(virtualTargetPath)
+	if err != nil {
+		return err
+	}
+	// path aliases must be resolved, an alias can point to the source or inside it
+	resolvedSource := c.User.ResolvePathAlias(virtualSourcePath)
+	resolvedTarget := c.User.ResolvePathAlias(virtualTargetPath)
+	if resolvedSource == resolvedTarget || resolvedSource == "/" || strings.HasPrefix(resolvedTarget, resolvedSource+"/") {
+		c.Log(logger.LevelInfo, "copying %q -> %q is not allowed, the target cannot be the source or inside it",
+			virtualSourcePath, virtualTargetPath)
+		return c.GetOpUnsupportedError()
+	}
+	fsSrc, fsSourcePath, err := c.GetFsAndResolvedPath(virtualSourcePath)
+	if err != nil {
+		return err
+	}
+	fsDst, fsTargetPath, err := c.GetFsAndResolvedPath(virtualTargetPath)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := fsSrc.Lstat(fsSourcePath)
+	if err != nil {
+		return c.GetFsError(fsSrc, err)
+	}
+	if srcInfo.IsDir() != isDir || (!isDir && !srcInfo.Mode().IsRegular()) {
+		c.Log(logger.LevelInfo, "unable to copy %q, unexpected file type, mode: %s", virtualSourcePath, srcInfo.Mode())
+		return c.GetOpUnsupportedError()
+	}
+	if _, err := fsDst.Lstat(fsTargetPath); err == nil {
+		c.Log(logger.LevelInfo, "unable to copy %q, the target %q already exists", virtualSourcePath, virtualTargetPath)
+		return c.GetOpUnsupportedError()
+	} else if !fsDst.IsNotExist(err) {
+		return c.GetFsError(fsDst, err)
+	}
+	if isDir && c.User.HasVirtualFoldersInside(virtualSourcePath) {
+		c.Log(logger.LevelInfo, "copying the folder %q is not supported: it has virtual folders inside it",
+			virtualSourcePath)
+		return c.GetOpUnsupportedError()
+	}
+	if c.User.IsMappedPath(fsTargetPath) && vfs.IsLocalOrCryptoFs(fsDst) {
+		c.Log(logger.LevelWarn, "copying to a directory mapped as virtual folder is not allowed: %q", fsTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	entries, err := c.getCopyEntries(fsSrc, fsDst, copyEntry{
+		virtualSourcePath: virtualSourcePath,
+		virtualTargetPath: virtualTargetPath,
+		fsSourcePath:      fsSourcePath,
+		fsTargetPath:      fsTargetPath,
+		info:              srcInfo,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !c.hasSpaceForCopy(virtualTargetPath, entries) {
+		c.Log(logger.LevelInfo, "denying copy %q -> %q due to space limit", virtualSourcePath, virtualTargetPath)
+		return c.GetQuotaExceededError()
+	}
+	serverSideCopy := c.isSameResourceRename(virtualSourcePath, virtualTargetPath)
+	for idx := range entries {
+		if err := c.copyEntry(fsSrc, fsDst, &entries[idx], serverSideCopy); err != nil {
+			return err
+		}
+	}
+	if isDir {
+		invalidateDirListing(&c.User, virtualTargetPath)
+	}
+	invalidateDirListing(&c.User, path.Dir(virtualTargetPath))
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(copyLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1,
+			"", "", "", -1, c.localAddr, c.remoteAddr)
+	}
+	logAccess(c, accessLogMethodCopy, virtualSourcePath, 0, 0, 0, nil)
+	ExecuteActionNotification(c, operationCopy, fsSourcePath, virtualSourcePath, fsTargetPath, //nolint:errcheck
+		virtualTargetPath, "", 0, nil)
 	return nil
 }
 
+// getCopyEntries checks the permissions for the given entry and, for directories, recursively
+// for their contents. It returns the entries to copy, directories are before their contents
+func (c *BaseConnection) getCopyEntries(fsSrc, fsDst vfs.Fs, entry copyEntry, entries []copyEntry) ([]copyEntry, error) {
+	if err := c.checkCopyPermissions(&entry); err != nil {
+		return nil, err
+	}
+	entries = append(entries, entry)
+	if !entry.info.IsDir() {
+		return entries, nil
+	}
+	contents, err := fsSrc.ReadDir(entry.fsSourcePath)
+	if err != nil {
+		return nil, c.GetFsError(fsSrc, err)
+	}
+	for _, info := range contents {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			c.Log(logger.LevelDebug, "skipping copy for non regular file %q", path.Join(entry.virtualSourcePath, info.Name()))
+			continue
+		}
+		entries, err = c.getCopyEntries(fsSrc, fsDst, copyEntry{
+			virtualSourcePath: path.Join(entry.virtualSourcePath, info.Name()),
+			virtualTargetPath: path.Join(entry.virtualTargetPath, info.Name()),
+			fsSourcePath:      fsSrc.Join(entry.fsSourcePath, info.Name()),
+			fsTargetPath:      fsDst.Join(entry.fsTargetPath, info.Name()),
+			info:              info,
+		}, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (c *BaseConnection) checkCopyPermissions(entry *copyEntry) error {
+	ok, policy := c.User.IsFileAllowed(entry.virtualSourcePath)
+	if !ok {
+		c.Log(logger.LevelDebug, "copy source path %q is not allowed", entry.virtualSourcePath)
+		return c.GetErrorForDeniedFile(policy)
+	}
+	if ok, _ = c.User.IsFileAllowed(entry.virtualTargetPath); !ok {
+		c.Log(logger.LevelDebug, "copy target path %q is not allowed", entry.virtualTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	if entry.info.IsDir() {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, entry.virtualSourcePath) ||
+			!c.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(entry.virtualTargetPath)) {
+			c.Log(logger.LevelDebug, "copying directory %q -> %q is not allowed", entry.virtualSourcePath,
+				entry.virtualTargetPath)
+			return c.GetPermissionDeniedError()
+		}
+		return nil
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(entry.virtualSourcePath)) ||
+		!c.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(entry.virtualTargetPath)) {
+		c.Log(logger.LevelDebug, "copying file %q -> %q is not allowed", entry.virtualSourcePath,
+			entry.virtualTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	if maxSize := c.User.GetMaxUploadFileSize(entry.virtualTargetPath); maxSize > 0 && entry.info.Size() > maxSize {
+		c.Log(logger.LevelDebug, "copying file %q is not allowed, size %d, max allowed: %d", entry.virtualSourcePath,
+			entry.info.Size(), maxSize)
+		return c.GetQuotaExceededError()
+	}
+	return nil
+}
+
+func (c *BaseConnection) hasSpaceForCopy(virtualTargetPath string, entries []copyEntry) bool {
+	if dataprovider.GetQuotaTracking() == 0 {
+		return true
+	}
+	var numFiles int
+	var size int64
+	for idx := range entries {
+		if entries[idx].info.Mode().IsRegular() {
+			numFiles++
+			size += entries[idx].info.Size()
+		}
+	}
+	quotaResult, _ := c.HasSpace(true, false, virtualTargetPath)
+	if !quotaResult.HasSpace {
+		return false
+	}
+	if quotaResult.QuotaFiles > 0 && quotaResult.GetRemainingFiles() < numFiles {
+		return false
+	}
+	return quotaResult.QuotaSize <= 0 || quotaResult.GetRemainingSize() >= size
+}
+
+func (c *BaseConnection) copyEntry(fsSrc, fsDst vfs.Fs, entry *copyEntry, serverSideCopy bool) error {
+	if entry.info.IsDir() {
+		if err := fsDst.Mkdir(entry.fsTargetPath); err != nil {
+			c.Log(logger.LevelError, "unable to create directory %q while copying: %v", entry.fsTargetPath, err)
+			return c.GetFsError(fsDst, err)
+		}
+		vfs.SetPathPermissions(fsDst, entry.fsTargetPath, c.User.GetUID(), c.User.GetGID())
+		return nil
+	}
+	if err := c.copyFileContents(fsSrc, fsDst, entry, serverSideCopy); err != nil {
+		c.Log(logger.LevelError, "failed to copy %q -> %q: %+v", entry.fsSourcePath, entry.fsTargetPath, err)
+		return c.GetFsError(fsDst, err)
+	}
+	vfs.SetPathPermissions(fsDst, entry.fsTargetPath, c.User.GetUID(), c.User.GetGID())
+	updateUserQuotaAfterFileWrite(c, entry.virtualTargetPath, 1, entry.info.Size())
+	return nil
+}
+
+// copyFileContents copies a file using a server side copy, if supported, or
+// streaming the contents from the source to the target filesystem
+func (c *BaseConnection) copyFileContents(fsSrc, fsDst vfs.Fs, entry *copyEntry, serverSideCopy bool) error {
+	if copier, ok := fsDst.(vfs.FsFileCopier); ok && serverSideCopy {
+		return copier.CopyFile(entry.fsSourcePath, entry.fsTargetPath, entry.info)
+	}
+	f, r, cancelFn, err := fsSrc.Open(entry.fsSourcePath, 0)
+	if err != nil {
+		return err
+	}
+	if cancelFn != nil {
+		defer cancelFn()
+	}
+	var reader io.ReadCloser = r
+	if f != nil {
+		reader = f
+	}
+	defer reader.Close()
+
+	wf, w, cancelFnDst, err := fsDst.Create(entry.fsTargetPath, 0, c.GetCreateChecks(entry.virtualTargetPath, true))
+	if err != nil {
+		return err
+	}
+	var writer io.WriteCloser = w
+	if wf != nil {
+		writer = wf
+	}
+	_, err = io.Copy(writer, reader)
+	if err != nil && cancelFnDst != nil {
+		// abort the upload
+		cancelFnDst()
+	}
+	errClose := writer.Close()
+	if cancelFnDst != nil {
+		cancelFnDst()
+	}
+	if err == nil {
+		err = errClose
+	}
+	if vfs.IsLocalOrCryptoFs(fsDst) {
+		if err != nil {
+			// remove the partial file
+			fsDst.Remove(entry.fsTargetPath, false) //nolint:errcheck
+			return err
+		}
+		fsDst.Chtimes(entry.fsTargetPath, time.Now(), entry.info.ModTime(), false) //nolint:errcheck
+	}
+	return err
+}
+
 func (c *BaseConnection) getPathForSetStatPerms(fs vfs.Fs, fsPath, virtualPath string) string {
 	pathForPerms := virtualPath
 	if fi, err := fs.Lstat(fsPath); err == nil {
@@ -807,7 +1463,7 @@ func (c *BaseConnection) ignoreSetStat(fs vfs.Fs) bool {
 }
 
 func (c *BaseConnection) handleChmod(fs vfs.Fs, fsPath, pathForPerms string, attributes *StatAttributes) error {
-	if !c.User.HasPerm(dataprovider.PermChmod, pathForPerms) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermChmod, pathForPerms) {
 		return c.GetPermissionDeniedError()
 	}
 	if c.ignoreSetStat(fs) {
@@ -817,13 +1473,15 @@ func (c *BaseConnection) handleChmod(fs vfs.Fs, fsPath, pathForPerms string, att
 		c.Log(logger.LevelError, "failed to chmod path %#v, mode: %v, err: %+v", fsPath, attributes.Mode.String(), err)
 		return c.GetFsError(fs, err)
 	}
-	logger.CommandLog(chmodLogSender, fsPath, "", c.User.Username, attributes.Mode.String(), c.ID, c.protocol,
-		-1, -1, "", "", "", -1, c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(chmodLogSender, fsPath, "", c.User.Username, attributes.Mode.String(), c.ID, c.protocol,
+			-1, -1, "", "", "", -1, c.localAddr, c.remoteAddr)
+	}
 	return nil
 }
 
 func (c *BaseConnection) handleChown(fs vfs.Fs, fsPath, pathForPerms string, attributes *StatAttributes) error {
-	if !c.User.HasPerm(dataprovider.PermChown, pathForPerms) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermChown, pathForPerms) {
 		return c.GetPermissionDeniedError()
 	}
 	if c.ignoreSetStat(fs) {
@@ -834,13 +1492,15 @@ func (c *BaseConnection) handleChown(fs vfs.Fs, fsPath, pathForPerms string, att
 			attributes.GID, err)
 		return c.GetFsError(fs, err)
 	}
-	logger.CommandLog(chownLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, attributes.UID, attributes.GID,
-		"", "", "", -1, c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(chownLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, attributes.UID, attributes.GID,
+			"", "", "", -1, c.localAddr, c.remoteAddr)
+	}
 	return nil
 }
 
 func (c *BaseConnection) handleChtimes(fs vfs.Fs, fsPath, pathForPerms string, attributes *StatAttributes) error {
-	if !c.User.HasPerm(dataprovider.PermChtimes, pathForPerms) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermChtimes, pathForPerms) {
 		return c.GetPermissionDeniedError()
 	}
 	if Config.SetstatMode == 1 {
@@ -858,8 +1518,10 @@ func (c *BaseConnection) handleChtimes(fs vfs.Fs, fsPath, pathForPerms string, a
 	}
 	accessTimeString := attributes.Atime.Format(chtimesFormat)
 	modificationTimeString := attributes.Mtime.Format(chtimesFormat)
-	logger.CommandLog(chtimesLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1,
-		accessTimeString, modificationTimeString, "", -1, c.localAddr, c.remoteAddr)
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(chtimesLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1,
+			accessTimeString, modificationTimeString, "", -1, c.localAddr, c.remoteAddr)
+	}
 	return nil
 }
 
@@ -873,6 +1535,7 @@ func (c *BaseConnection) SetStat(virtualPath string, attributes *StatAttributes)
 		return err
 	}
 	pathForPerms := c.getPathForSetStatPerms(fs, fsPath, virtualPath)
+	defer invalidateDirListing(&c.User, path.Dir(virtualPath))
 
 	if attributes.Flags&StatAttrTimes != 0 {
 		if err = c.handleChtimes(fs, fsPath, pathForPerms, attributes); err != nil {
@@ -893,7 +1556,7 @@ func (c *BaseConnection) SetStat(virtualPath string, attributes *StatAttributes)
 	}
 
 	if attributes.Flags&StatAttrSize != 0 {
-		if !c.User.HasPerm(dataprovider.PermOverwrite, pathForPerms) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, pathForPerms) {
 			return c.GetPermissionDeniedError()
 		}
 
@@ -901,13 +1564,62 @@ func (c *BaseConnection) SetStat(virtualPath string, attributes *StatAttributes)
 			c.Log(logger.LevelError, "failed to truncate path %#v, size: %v, err: %+v", fsPath, attributes.Size, err)
 			return c.GetFsError(fs, err)
 		}
-		logger.CommandLog(truncateLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "",
-			"", attributes.Size, c.localAddr, c.remoteAddr)
+		if c.isLogLevelEnabled(logger.LevelInfo) {
+			logger.CommandLog(truncateLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "",
+				"", attributes.Size, c.localAddr, c.remoteAddr)
+		}
 	}
 
 	return nil
 }
 
+// GetMetadata returns the user defined metadata for the specified virtual path
+func (c *BaseConnection) GetMetadata(virtualPath string) (map[string]string, error) {
+	if ok, policy := c.User.IsFileAllowed(virtualPath); !ok {
+		return nil, c.GetErrorForDeniedFile(policy)
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(virtualPath)) {
+		return nil, c.GetPermissionDeniedError()
+	}
+	fs, fsPath, err := c.GetFsAndResolvedPath(virtualPath)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := fs.GetMetadata(fsPath)
+	if err != nil {
+		c.Log(logger.LevelError, "failed to get metadata for path %q, err: %+v", fsPath, err)
+		return nil, c.GetFsError(fs, err)
+	}
+	return metadata, nil
+}
+
+// SetMetadata replaces the user defined metadata for the specified virtual path,
+// an empty map removes them
+func (c *BaseConnection) SetMetadata(virtualPath string, metadata map[string]string) error {
+	if err := vfs.ValidateMetadata(metadata); err != nil {
+		return err
+	}
+	if ok, policy := c.User.IsFileAllowed(virtualPath); !ok {
+		return c.GetErrorForDeniedFile(policy)
+	}
+	fs, fsPath, err := c.GetFsAndResolvedPath(virtualPath)
+	if err != nil {
+		return err
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, c.getPathForSetStatPerms(fs, fsPath, virtualPath)) {
+		return c.GetPermissionDeniedError()
+	}
+	if err := fs.SetMetadata(fsPath, metadata); err != nil {
+		c.Log(logger.LevelError, "failed to set metadata for path %q, err: %+v", fsPath, err)
+		return c.GetFsError(fs, err)
+	}
+	if c.isLogLevelEnabled(logger.LevelInfo) {
+		logger.CommandLog(setMetadataLogSender, fsPath, "", c.User.Username, "", c.ID, c.protocol, -1, -1, "", "",
+			"", -1, c.localAddr, c.remoteAddr)
+	}
+	return nil
+}
+
 func (c *BaseConnection) truncateFile(fs vfs.Fs, fsPath, virtualPath string, size int64) error {
 	// check first if we have an open transfer for the given path and try to truncate the file already opened
 	// if we found no transfer we truncate by path.
@@ -942,8 +1654,8 @@ func (c *BaseConnection) truncateFile(fs vfs.Fs, fsPath, virtualPath string, siz
 func (c *BaseConnection) checkRecursiveRenameDirPermissions(fsSrc, fsDst vfs.Fs, sourcePath, targetPath,
 	virtualSourcePath, virtualTargetPath string, fi os.FileInfo,
 ) error {
-	if !c.User.HasPermissionsInside(virtualSourcePath) &&
-		!c.User.HasPermissionsInside(virtualTargetPath) {
+	if !c.GetEffectiveUser().HasPermissionsInside(virtualSourcePath) &&
+		!c.GetEffectiveUser().HasPermissionsInside(virtualTargetPath) {
 		if !c.isRenamePermitted(fsSrc, fsDst, sourcePath, targetPath, virtualSourcePath, virtualTargetPath, fi) {
 			c.Log(logger.LevelInfo, "rename %#v -> %#v is not allowed, virtual destination path: %#v",
 				sourcePath, targetPath, virtualTargetPath)
@@ -952,7 +1664,7 @@ func (c *BaseConnection) checkRecursiveRenameDirPermissions(fsSrc, fsDst vfs.Fs,
 		// if all rename permissions are granted we have finished, otherwise we have to walk
 		// because we could have the rename dir permission but not the rename file and the dir to
 		// rename could contain files
-		if c.User.HasPermsRenameAll(path.Dir(virtualSourcePath)) && c.User.HasPermsRenameAll(path.Dir(virtualTargetPath)) {
+		if c.GetEffectiveUser().HasPermsRenameAll(path.Dir(virtualSourcePath)) && c.GetEffectiveUser().HasPermsRenameAll(path.Dir(virtualTargetPath)) {
 			return nil
 		}
 	}
@@ -978,8 +1690,8 @@ func (c *BaseConnection) checkRecursiveRenameDirPermissions(fsSrc, fsDst vfs.Fs,
 }
 
 func (c *BaseConnection) hasRenamePerms(virtualSourcePath, virtualTargetPath string, fi os.FileInfo) bool {
-	if c.User.HasPermsRenameAll(path.Dir(virtualSourcePath)) &&
-		c.User.HasPermsRenameAll(path.Dir(virtualTargetPath)) {
+	if c.GetEffectiveUser().HasPermsRenameAll(path.Dir(virtualSourcePath)) &&
+		c.GetEffectiveUser().HasPermsRenameAll(path.Dir(virtualTargetPath)) {
 		return true
 	}
 	if fi == nil {
@@ -991,16 +1703,16 @@ func (c *BaseConnection) hasRenamePerms(virtualSourcePath, virtualTargetPath str
 			dataprovider.PermRenameDirs,
 			dataprovider.PermRename,
 		}
-		return c.User.HasAnyPerm(perms, path.Dir(virtualSourcePath)) &&
-			c.User.HasAnyPerm(perms, path.Dir(virtualTargetPath))
+		return c.GetEffectiveUser().HasAnyPerm(perms, path.Dir(virtualSourcePath)) &&
+			c.GetEffectiveUser().HasAnyPerm(perms, path.Dir(virtualTargetPath))
 	}
 	// file or symlink
 	perms := []string{
 		dataprovider.PermRenameFiles,
 		dataprovider.PermRename,
 	}
-	return c.User.HasAnyPerm(perms, path.Dir(virtualSourcePath)) &&
-		c.User.HasAnyPerm(perms, path.Dir(virtualTargetPath))
+	return c.GetEffectiveUser().HasAnyPerm(perms, path.Dir(virtualSourcePath)) &&
+		c.GetEffectiveUser().HasAnyPerm(perms, path.Dir(virtualTargetPath))
 }
 
 func (c *BaseConnection) isRenamePermitted(fsSrc, fsDst vfs.Fs, fsSourcePath, fsTargetPath, virtualSourcePath,
@@ -1027,6 +1739,15 @@ func (c *BaseConnection) isRenamePermitted(fsSrc, fsDst vfs.Fs, fsSourcePath, fs
 		c.Log(logger.LevelWarn, "renaming a virtual folder is not allowed")
 		return false
 	}
+	if c.User.IsPathAlias(virtualSourcePath) || c.User.IsPathAlias(virtualTargetPath) {
+		c.Log(logger.LevelWarn, "renaming a path alias is not allowed")
+		return false
+	}
+	if c.User.IsReadOnlyPath(virtualSourcePath) || c.User.IsReadOnlyPath(virtualTargetPath) {
+		c.Log(logger.LevelWarn, "renaming from or to a read-only virtual folder is not allowed: %q->%q",
+			virtualSourcePath, virtualTargetPath)
+		return false
+	}
 	isSrcAllowed, _ := c.User.IsFileAllowed(virtualSourcePath)
 	isDstAllowed, _ := c.User.IsFileAllowed(virtualTargetPath)
 	if !isSrcAllowed || !isDstAllowed {
@@ -1129,20 +1850,21 @@ func (c *BaseConnection) hasSpaceForCrossRename(fs vfs.Fs, quotaResult vfs.Quota
 
 // GetMaxWriteSize returns the allowed size for an upload or an error
 // if no enough size is available for a resume/append
-func (c *BaseConnection) GetMaxWriteSize(quotaResult vfs.QuotaCheckResult, isResume bool, fileSize int64,
-	isUploadResumeSupported bool,
+func (c *BaseConnection) GetMaxWriteSize(virtualPath string, quotaResult vfs.QuotaCheckResult, isResume bool,
+	fileSize int64, isUploadResumeSupported bool,
 ) (int64, error) {
 	maxWriteSize := quotaResult.GetRemainingSize()
+	maxUploadFileSize := c.User.GetMaxUploadFileSize(virtualPath)
 
 	if isResume {
 		if !isUploadResumeSupported {
 			return 0, c.GetOpUnsupportedError()
 		}
-		if c.User.Filters.MaxUploadFileSize > 0 && c.User.Filters.MaxUploadFileSize <= fileSize {
+		if maxUploadFileSize > 0 && maxUploadFileSize <= fileSize {
 			return 0, c.GetQuotaExceededError()
 		}
-		if c.User.Filters.MaxUploadFileSize > 0 {
-			maxUploadSize := c.User.Filters.MaxUploadFileSize - fileSize
+		if maxUploadFileSize > 0 {
+			maxUploadSize := maxUploadFileSize - fileSize
 			if maxUploadSize < maxWriteSize || maxWriteSize == 0 {
 				maxWriteSize = maxUploadSize
 			}
@@ -1151,14 +1873,47 @@ func (c *BaseConnection) GetMaxWriteSize(quotaResult vfs.QuotaCheckResult, isRes
 		if maxWriteSize > 0 {
 			maxWriteSize += fileSize
 		}
-		if c.User.Filters.MaxUploadFileSize > 0 && (c.User.Filters.MaxUploadFileSize < maxWriteSize || maxWriteSize == 0) {
-			maxWriteSize = c.User.Filters.MaxUploadFileSize
+		if maxUploadFileSize > 0 && (maxUploadFileSize < maxWriteSize || maxWriteSize == 0) {
+			maxWriteSize = maxUploadFileSize
 		}
 	}
 
 	return maxWriteSize, nil
 }
 
+// CheckUploadSpace is a pre-flight check for uploads whose size is known in advance.
+// It returns a quota exceeded error if the upload size exceeds the maximum allowed
+// write size, as returned by GetMaxWriteSize, or, for local filesystems, if the
+// available disk space is less than the upload size plus the configured safety margin.
+// Nothing is checked if the upload size is unknown
+func (c *BaseConnection) CheckUploadSpace(fs vfs.Fs, fsPath string, uploadSize, maxWriteSize int64) error {
+	if uploadSize <= 0 {
+		return nil
+	}
+	if maxWriteSize > 0 && uploadSize > maxWriteSize {
+		c.Log(logger.LevelInfo, "denying upload to %q, size %d bytes, the maximum allowed size is %d bytes",
+			fsPath, uploadSize, maxWriteSize)
+		return c.GetQuotaExceededError()
+	}
+	if !vfs.IsLocalOrCryptoFs(fs) {
+		return nil
+	}
+	stat, err := fs.GetAvailableDiskSize(filepath.Dir(fsPath))
+	if err != nil {
+		c.Log(logger.LevelDebug, "unable to get the available disk space for %q, pre-flight check skipped: %v",
+			fsPath, err)
+		return nil
+	}
+	available := stat.Frsize * stat.Bavail
+	required := uint64(uploadSize) + uint64(Config.DiskSpaceSafetyMarginBytes)
+	if available < required {
+		c.Log(logger.LevelWarn, "not enough disk space for upload to %q, available: %d bytes, required: %d bytes",
+			fsPath, available, required)
+		return c.GetQuotaExceededError()
+	}
+	return nil
+}
+
 // GetTransferQuota returns the data transfers quota
 func (c *BaseConnection) GetTransferQuota() dataprovider.TransferQuota {
 	result, _, _ := c.checkUserQuota()
@@ -1257,6 +2012,195 @@ func (c *BaseConnection) HasSpace(checkFiles, getUsage bool, requestPath string)
 	return result, transferQuota
 }
 
+// needsQuotaFileReservation returns true if a new file uploaded to the given path
+// must be reserved in the user files quota
+func (c *BaseConnection) needsQuotaFileReservation(requestPath string) bool {
+	if dataprovider.GetQuotaTracking() == 0 || c.User.QuotaFiles <= 0 {
+		return false
+	}
+	vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(requestPath))
+	return err != nil || vfolder.IsIncludedInUserQuota()
+}
+
+// dirFilesReservations tracks the new files being uploaded to the directories
+// with a maximum number of entries. An upload in progress may not be listed, for
+// example on Cloud Storage backends, and many uploads can be started at the same
+// time, so the reserved files are added to the listed entries
+type dirFilesReservations struct {
+	sync.Mutex
+	dirs map[string]*dirFilesReservation
+}
+
+type dirFilesReservation struct {
+	// serializes the checks for the same directory
+	checkMu sync.Mutex
+	// the following fields are protected by the dirFilesReservations mutex
+	pending int
+	refs    int
+}
+
+var reservedDirFiles = dirFilesReservations{
+	dirs: make(map[string]*dirFilesReservation),
+}
+
+// reserve reserves a new file for the directory with the specified key if the
+// entries returned by countFn, plus the files already reserved, are less than
+// limit. It returns the entries found and true if a file was reserved
+func (r *dirFilesReservations) reserve(key string, limit int, countFn func(limit int) (int, error)) (int, bool, error) {
+	r.Lock()
+	res, ok := r.dirs[key]
+	if !ok {
+		res = &dirFilesReservation{}
+		r.dirs[key] = res
+	}
+	res.refs++
+	r.Unlock()
+
+	res.checkMu.Lock()
+	defer func() {
+		res.checkMu.Unlock()
+
+		r.Lock()
+		res.refs--
+		r.removeUnused(key, res)
+		r.Unlock()
+	}()
+
+	// the pending files must be read before listing the directory: a file
+	// uploaded in the meantime can be counted twice but it cannot be missed
+	r.Lock()
+	pending := res.pending
+	r.Unlock()
+
+	entries, err := countFn(limit)
+	if err != nil {
+		return 0, false, err
+	}
+	entries += pending
+	if entries >= limit {
+		return entries, false, nil
+	}
+	r.Lock()
+	res.pending++
+	r.Unlock()
+	return entries, true, nil
+}
+
+func (r *dirFilesReservations) release(key string) {
+	r.Lock()
+	defer r.Unlock()
+
+	res, ok := r.dirs[key]
+	if !ok {
+		return
+	}
+	if res.pending > 0 {
+		res.pending--
+	}
+	r.removeUnused(key, res)
+}
+
+func (r *dirFilesReservations) removeUnused(key string, res *dirFilesReservation) {
+	if res.pending == 0 && res.refs == 0 {
+		delete(r.dirs, key)
+	}
+}
+
+func (c *BaseConnection) getDirFilesKey(dirPath string) string {
+	return c.User.Username + ":" + dirPath
+}
+
+// reserveDirFile reserves a new entry in the parent directory of the specified
+// path if the user has a maximum number of entries allowed for each directory.
+// The directory entries are counted without loading their details and the checks
+// for the same directory are serialized, so concurrent uploads cannot exceed the
+// limit. Files created by other users or outside SFTPGo are only counted once
+// listed, so the limit is best effort in this case
+func (c *BaseConnection) reserveDirFile(requestPath string) error {
+	if c.User.Filters.MaxFilesPerDir <= 0 {
+		return nil
+	}
+	dirPath := path.Dir(requestPath)
+	fs, fsPath, err := c.GetFsAndResolvedPath(dirPath)
+	if err != nil {
+		return err
+	}
+	entries, reserved, err := reservedDirFiles.reserve(c.getDirFilesKey(dirPath), c.User.Filters.MaxFilesPerDir,
+		func(limit int) (int, error) {
+			return vfs.CountDirEntries(fs, fsPath, limit)
+		})
+	if err != nil {
+		c.Log(logger.LevelDebug, "unable to list directory %q to check the max files allowed: %v", dirPath, err)
+		return c.GetFsError(fs, err)
+	}
+	if !reserved {
+		c.Log(logger.LevelInfo, "denying new file in directory %q, entries: %d, max allowed: %d", dirPath,
+			entries, c.User.Filters.MaxFilesPerDir)
+		return c.GetQuotaExceededError()
+	}
+	c.Lock()
+	if c.reservedDirFiles == nil {
+		c.reservedDirFiles = make(map[string]int)
+	}
+	c.reservedDirFiles[requestPath]++
+	c.Unlock()
+	return nil
+}
+
+// releaseDirFile releases the directory entry reserved for the specified path,
+// if any. It can be called more than once
+func (c *BaseConnection) releaseDirFile(requestPath string) {
+	c.Lock()
+	reserved := c.reservedDirFiles[requestPath]
+	if reserved <= 1 {
+		delete(c.reservedDirFiles, requestPath)
+	} else {
+		c.reservedDirFiles[requestPath]--
+	}
+	c.Unlock()
+
+	if reserved > 0 {
+		reservedDirFiles.release(c.getDirFilesKey(path.Dir(requestPath)))
+	}
+}
+
+// ReserveNewFile must be called before uploading a new file. It reserves an entry
+// in the target directory, if the user has a maximum number of entries for each
+// directory, and, if the user has a files quota, atomically reserves a file in the
+// quota, so concurrent uploads cannot exceed the limits. It returns true if a file
+// was reserved in the quota, the returned value must be passed to the transfer
+// using SetQuotaFileReserved or to ReleaseNewFile if the upload does not start.
+// The transfer releases the directory entry when it is closed
+func (c *BaseConnection) ReserveNewFile(requestPath string) (bool, error) {
+	if err := c.reserveDirFile(requestPath); err != nil {
+		return false, err
+	}
+	if !c.needsQuotaFileReservation(requestPath) {
+		return false, nil
+	}
+	reserved, err := dataprovider.ReserveUserQuotaFile(&c.User)
+	if err != nil {
+		c.releaseDirFile(requestPath)
+		c.Log(logger.LevelError, "unable to reserve a quota file for path %q: %v", requestPath, err)
+		return false, c.GetGenericError(err)
+	}
+	if !reserved {
+		c.releaseDirFile(requestPath)
+		c.Log(logger.LevelInfo, "denying new file %q, the files quota is exceeded", requestPath)
+		return false, c.GetQuotaExceededError()
+	}
+	return true, nil
+}
+
+// ReleaseNewFile releases the directory entry and the quota file reserved for the
+// specified path using ReserveNewFile
+func (c *BaseConnection) ReleaseNewFile(requestPath string, reserved bool) {
+	c.releaseDirFile(requestPath)
+	if reserved {
+		dataprovider.UpdateUserQuota(&c.User, -1, 0, false) //nolint:errcheck
+	}
+}
+
 func (c *BaseConnection) isSameResourceRename(virtualSourcePath, virtualTargetPath string) bool {
 	sourceFolder, errSrc := c.User.GetVirtualFolderForPath(virtualSourcePath)
 	dstFolder, errDst := c.User.GetVirtualFolderForPath(virtualTargetPath)
@@ -1515,7 +2459,7 @@ func (c *BaseConnection) GetGenericError(err error) error {
 			return fmt.Errorf("%w: %v", sftp.ErrSSHFxFailure, err.Error())
 		}
 		if err != nil {
-			if e, ok := err.(*os.PathError); ok {
+			if e, ok := err.(*os.PathError); ok && !Config.ObscureErrorMessages {
 				c.Log(logger.LevelError, "generic path error: %+v", e)
 				return fmt.Errorf("%w: %v %v", sftp.ErrSSHFxFailure, e.Op, e.Err.Error())
 			}
@@ -1526,7 +2470,7 @@ func (c *BaseConnection) GetGenericError(err error) error {
 	default:
 		if err == ErrPermissionDenied || err == ErrNotExist || err == ErrOpUnsupported ||
 			err == ErrQuotaExceeded || err == ErrReadQuotaExceeded || err == vfs.ErrStorageSizeUnavailable ||
-			err == ErrShuttingDown {
+			err == ErrShuttingDown || err == ErrChecksumMismatch {
 			return err
 		}
 		c.Log(logger.LevelError, "generic error: %+v", err)
@@ -1534,6 +2478,89 @@ func (c *BaseConnection) GetGenericError(err error) error {
 	}
 }
 
+// clientErrorCategories maps the known error categories to the protocol specific errors
+// returned to the clients if the internal error messages must be obscured
+var clientErrorCategories = []struct {
+	match    func(c *BaseConnection, err error) bool
+	getError func(c *BaseConnection, err error) error
+}{
+	{
+		// these errors have safe messages
+		match: func(c *BaseConnection, err error) bool {
+			return errors.Is(err, ErrShuttingDown) || errors.Is(err, ErrChecksumMismatch) ||
+				errors.Is(err, ErrTransferAborted) || errors.Is(err, ErrTooManySessions) ||
+				errors.Is(err, vfs.ErrStorageSizeUnavailable)
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return err
+		},
+	},
+	{
+		match: func(c *BaseConnection, err error) bool {
+			return c.IsQuotaExceededError(err)
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return c.GetQuotaExceededError()
+		},
+	},
+	{
+		match: func(c *BaseConnection, err error) bool {
+			return errors.Is(err, ErrReadQuotaExceeded) ||
+				(errors.Is(err, sftp.ErrSSHFxFailure) && strings.Contains(err.Error(), ErrReadQuotaExceeded.Error()))
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return c.GetReadQuotaExceededError()
+		},
+	},
+	{
+		match: func(c *BaseConnection, err error) bool {
+			return errors.Is(err, ErrPermissionDenied) || errors.Is(err, os.ErrPermission) ||
+				errors.Is(err, sftp.ErrSSHFxPermissionDenied)
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return c.GetPermissionDeniedError()
+		},
+	},
+	{
+		match: func(c *BaseConnection, err error) bool {
+			return errors.Is(err, ErrNotExist) || errors.Is(err, os.ErrNotExist) ||
+				errors.Is(err, sftp.ErrSSHFxNoSuchFile)
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return c.GetNotExistError()
+		},
+	},
+	{
+		match: func(c *BaseConnection, err error) bool {
+			return errors.Is(err, ErrOpUnsupported) || errors.Is(err, vfs.ErrVfsUnsupported) ||
+				errors.Is(err, sftp.ErrSSHFxOpUnsupported)
+		},
+		getError: func(c *BaseConnection, err error) error {
+			return c.GetOpUnsupportedError()
+		},
+	},
+}
+
+// GetClientError returns the error to send to the client for errors that are not
+// converted using GetFsError. If the error messages must be obscured, the known
+// errors are mapped to the protocol specific errors and the other ones are logged
+// and replaced with a generic failure
+func (c *BaseConnection) GetClientError(err error) error {
+	if err == nil || !Config.ObscureErrorMessages {
+		return err
+	}
+	for _, category := range clientErrorCategories {
+		if category.match(c, err) {
+			return category.getError(c, err)
+		}
+	}
+	c.Log(logger.LevelError, "obscured error: %+v", err)
+	if c.protocol == ProtocolSFTP {
+		return fmt.Errorf("%w: %v", sftp.ErrSSHFxFailure, ErrGenericFailure.Error())
+	}
+	return ErrGenericFailure
+}
+
 // GetFsError converts a filesystem error to a protocol error
 func (c *BaseConnection) GetFsError(fs vfs.Fs, err error) error {
 	if fs.IsNotExist(err) {
@@ -1564,7 +2591,7 @@ func (c *BaseConnection) GetFsAndResolvedPath(virtualPath string) (vfs.Fs, strin
 		return nil, "", c.GetFsError(fs, ErrShuttingDown)
 	}
 
-	fsPath, err := fs.ResolvePath(virtualPath)
+	fsPath, err := fs.ResolvePath(c.User.ResolvePathAlias(virtualPath))
 	if err != nil {
 		return nil, "", c.GetFsError(fs, err)
 	}
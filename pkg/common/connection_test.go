@@ -16,10 +16,13 @@ package common
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -224,6 +227,66 @@ func TestRenameVirtualFolders(t *testing.T) {
 	assert.False(t, res)
 }
 
+func TestReadOnlyVirtualFolders(t *testing.T) {
+	mappedPath := filepath.Join(os.TempDir(), "vdirro")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Clean(os.TempDir()),
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name:       filepath.Base(mappedPath),
+					MappedPath: mappedPath,
+				},
+				VirtualPath: "/vdirro",
+				ReadOnly:    true,
+			},
+		},
+	}
+	assert.True(t, user.IsReadOnlyPath("/vdirro"))
+	assert.True(t, user.IsReadOnlyPath("/vdirro/sub/file"))
+	assert.False(t, user.IsReadOnlyPath("/"))
+	assert.False(t, user.IsReadOnlyPath("/vdirro1"))
+	assert.Equal(t, []string{dataprovider.PermListItems, dataprovider.PermDownload},
+		user.GetPermissionsForPath("/vdirro/sub"))
+	assert.True(t, user.HasPerm(dataprovider.PermDownload, "/vdirro"))
+	assert.False(t, user.HasPerm(dataprovider.PermUpload, "/vdirro"))
+	assert.True(t, user.HasPerm(dataprovider.PermUpload, "/"))
+
+	err := os.MkdirAll(filepath.Join(mappedPath, "sub"), os.ModePerm)
+	assert.NoError(t, err)
+	conn := NewBaseConnection("", ProtocolFTP, "", "", user)
+	_, err = conn.ListDir("/vdirro")
+	assert.NoError(t, err)
+	err = conn.CreateDir("/vdirro/newdir", false)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.RemoveDir("/vdirro/sub")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	fs, fsPath, err := conn.GetFsAndResolvedPath("/vdirro/sub")
+	assert.NoError(t, err)
+	err = conn.IsRemoveDirAllowed(fs, fsPath, "/vdirro/sub")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.IsRemoveFileAllowed("/vdirro/file")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.Rename("/vdirro/sub", "/vdirro/sub1")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	rootFs, rootPath, err := conn.GetFsAndResolvedPath("/file")
+	assert.NoError(t, err)
+	res := conn.isRenamePermitted(rootFs, fs, rootPath, filepath.Join(mappedPath, "file"), "/file", "/vdirro/file", nil)
+	assert.False(t, res)
+	res = conn.isRenamePermitted(fs, rootFs, filepath.Join(mappedPath, "file"), rootPath, "/vdirro/file", "/file", nil)
+	assert.False(t, res)
+	assert.DirExists(t, filepath.Join(mappedPath, "sub"))
+
+	err = os.RemoveAll(mappedPath)
+	assert.NoError(t, err)
+}
+
 func TestRenamePerms(t *testing.T) {
 	src := "source"
 	target := "target"
@@ -422,6 +485,348 @@ func TestErrorsMapping(t *testing.T) {
 	}
 }
 
+func TestObscureErrorMessages(t *testing.T) {
+	Config.ObscureErrorMessages = true
+	defer func() {
+		Config.ObscureErrorMessages = false
+	}()
+
+	fs := vfs.NewOsFs("", os.TempDir(), "")
+	conn := NewBaseConnection("", ProtocolSFTP, "", "", dataprovider.User{BaseUser: sdk.BaseUser{HomeDir: os.TempDir()}})
+	internalPath := filepath.Join(os.TempDir(), "internal", "path")
+	pathErr := &os.PathError{Op: "open", Path: internalPath, Err: errors.New("input/output error")}
+	sqlErr := fmt.Errorf("unable to update user: %w", errors.New(`pq: relation "users" does not exist`))
+	for _, protocol := range supportedProtocols {
+		conn.SetProtocol(protocol)
+		for _, e := range []error{pathErr, sqlErr} {
+			err := conn.GetFsError(fs, e)
+			assert.Error(t, err)
+			assert.NotContains(t, err.Error(), internalPath)
+			assert.NotContains(t, err.Error(), "input/output")
+			assert.NotContains(t, err.Error(), "pq:")
+			err = conn.GetClientError(e)
+			assert.Error(t, err)
+			assert.NotContains(t, err.Error(), internalPath)
+			assert.NotContains(t, err.Error(), "pq:")
+			assert.Contains(t, err.Error(), ErrGenericFailure.Error())
+		}
+		err := conn.GetClientError(fmt.Errorf("unable to open %q: %w", internalPath, os.ErrNotExist))
+		assert.True(t, conn.IsNotExistError(err))
+		assert.NotContains(t, err.Error(), internalPath)
+		err = conn.GetClientError(fmt.Errorf("unable to open %q: %w", internalPath, ErrQuotaExceeded))
+		assert.True(t, conn.IsQuotaExceededError(err))
+		assert.NotContains(t, err.Error(), internalPath)
+		err = conn.GetClientError(fmt.Errorf("unable to read %q: %w", internalPath, os.ErrPermission))
+		assert.Equal(t, conn.GetPermissionDeniedError(), err)
+		err = conn.GetClientError(fmt.Errorf("copy %q: %w", internalPath, vfs.ErrVfsUnsupported))
+		assert.Equal(t, conn.GetOpUnsupportedError(), err)
+		err = conn.GetClientError(ErrShuttingDown)
+		assert.ErrorIs(t, err, ErrShuttingDown)
+		assert.NoError(t, conn.GetClientError(nil))
+	}
+	conn.SetProtocol(ProtocolSFTP)
+	err := conn.GetClientError(errors.New("internal"))
+	assert.ErrorIs(t, err, sftp.ErrSSHFxFailure)
+
+	Config.ObscureErrorMessages = false
+	err = conn.GetClientError(sqlErr)
+	assert.Equal(t, sqlErr, err)
+	err = conn.GetFsError(fs, pathErr)
+	assert.Contains(t, err.Error(), "input/output")
+}
+
+func TestSanitizeTargetPath(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Clean(os.TempDir()),
+		},
+	}
+	conn := NewBaseConnection("", ProtocolFTP, "", "", user)
+	name := "/dir\x01/file\x00\x1fname\xff.txt"
+	p, err := conn.SanitizeTargetPath(name)
+	assert.NoError(t, err)
+	assert.Equal(t, name, p)
+
+	conn.User.Filters.FileNameSanitize = dataprovider.FileNameSanitizeStripControl
+	p, err = conn.SanitizeTargetPath(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dir\x01/filename.txt", p)
+	_, err = conn.SanitizeTargetPath("/\x01\x02")
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	conn.User.Filters.FileNameSanitize = dataprovider.FileNameSanitizeReplace
+	p, err = conn.SanitizeTargetPath(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dir\x01/file__name_.txt", p)
+
+	conn.User.Filters.FileNameSanitize = dataprovider.FileNameSanitizeReject
+	_, err = conn.SanitizeTargetPath(name)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	p, err = conn.SanitizeTargetPath("/dir/file name.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dir/file name.txt", p)
+	err = conn.CreateDir("/dir\x00", false)
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	fs, err := conn.User.GetFilesystem("")
+	assert.NoError(t, err)
+	err = fs.ValidatePath("name\x00")
+	assert.ErrorIs(t, err, vfs.ErrInvalidFileName)
+	s3Fs := &vfs.S3Fs{}
+	err = s3Fs.ValidatePath("name\x7f")
+	assert.ErrorIs(t, err, vfs.ErrInvalidFileName)
+	assert.Equal(t, "name_", vfs.ReplaceDisallowedChars(s3Fs, "name\x7f"))
+	azFs := &vfs.AzureBlobFs{}
+	assert.Equal(t, "a_b", vfs.ReplaceDisallowedChars(azFs, "a\\b"))
+	assert.Equal(t, "ab", vfs.StripControlChars("a\nb"))
+
+	conn.User.Filters.FileNameSanitize = ""
+	Config.FileNameSanitize = dataprovider.FileNameSanitizeReject
+	_, err = conn.SanitizeTargetPath(name)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	Config.FileNameSanitize = dataprovider.FileNameSanitizeNone
+}
+
+func TestSortDirListing(t *testing.T) {
+	now := time.Now()
+	getFiles := func() []os.FileInfo {
+		return []os.FileInfo{
+			vfs.NewFileInfo("b", false, 10, now, false),
+			vfs.NewFileInfo("dir2", true, 0, now.Add(-1*time.Hour), false),
+			vfs.NewFileInfo("a", false, 30, now.Add(-2*time.Hour), false),
+			vfs.NewFileInfo("c", false, 10, now.Add(time.Hour), false),
+			vfs.NewFileInfo("dir1", true, 0, now, false),
+		}
+	}
+	getNames := func(files []os.FileInfo) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		return names
+	}
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+		},
+	}
+	conn := NewBaseConnection("", ProtocolFTP, "", "", user)
+	files := getFiles()
+	conn.SortDirListing(files)
+	assert.Equal(t, []string{"b", "dir2", "a", "c", "dir1"}, getNames(files))
+
+	testCases := []struct {
+		order     string
+		dirsFirst bool
+		expected  []string
+	}{
+		{dataprovider.DirListOrderNameAsc, false, []string{"a", "b", "c", "dir1", "dir2"}},
+		{dataprovider.DirListOrderNameDesc, false, []string{"dir2", "dir1", "c", "b", "a"}},
+		{dataprovider.DirListOrderMtimeAsc, false, []string{"a", "dir2", "b", "dir1", "c"}},
+		{dataprovider.DirListOrderMtimeDesc, true, []string{"dir1", "dir2", "c", "b", "a"}},
+		{dataprovider.DirListOrderSizeAsc, false, []string{"dir1", "dir2", "b", "c", "a"}},
+		{dataprovider.DirListOrderSizeDesc, true, []string{"dir1", "dir2", "a", "b", "c"}},
+		{"", true, []string{"dir2", "dir1", "b", "a", "c"}},
+	}
+	for _, tc := range testCases {
+		Config.DirListOrder = DirListOrderConfig{
+			Order:     tc.order,
+			DirsFirst: tc.dirsFirst,
+		}
+		files = getFiles()
+		conn.SortDirListing(files)
+		assert.Equal(t, tc.expected, getNames(files), "order %q, dirs first %t", tc.order, tc.dirsFirst)
+	}
+	// the user setting overrides the global one
+	conn.User.Filters.DirListOrder = dataprovider.DirListOrderNameDesc
+	files = getFiles()
+	conn.SortDirListing(files)
+	assert.Equal(t, []string{"dir2", "dir1", "c", "b", "a"}, getNames(files))
+	conn.User.Filters.DirListDirsFirst = true
+	files = getFiles()
+	conn.SortDirListing(files)
+	assert.Equal(t, []string{"dir2", "dir1", "c", "b", "a"}, getNames(files))
+
+	Config.DirListOrder = DirListOrderConfig{}
+}
+
+func TestPathAliases(t *testing.T) {
+	homeDir := filepath.Join(os.TempDir(), "alias_home")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/":             {dataprovider.PermAny},
+				"/archive/2024": {dataprovider.PermListItems, dataprovider.PermDownload},
+			},
+			HomeDir: homeDir,
+		},
+	}
+	user.Filters.PathAliases = []dataprovider.PathAlias{
+		{
+			Path:   "/current",
+			Target: "/archive/2024",
+		},
+		{
+			Path:   "/latest",
+			Target: "/current",
+		},
+	}
+	assert.Equal(t, "/archive/2024", user.ResolvePathAlias("/current"))
+	assert.Equal(t, "/archive/2024/sub/file", user.ResolvePathAlias("/current/sub/file"))
+	assert.Equal(t, "/archive/2024/file", user.ResolvePathAlias("/latest/file"))
+	assert.Equal(t, "/currentfile", user.ResolvePathAlias("/currentfile"))
+	assert.True(t, user.IsPathAlias("/latest"))
+	assert.False(t, user.IsPathAlias("/latest/file"))
+	// the target permissions apply
+	assert.False(t, user.HasPerm(dataprovider.PermUpload, "/current"))
+	assert.True(t, user.HasPerm(dataprovider.PermDownload, "/latest/sub"))
+	assert.True(t, user.HasPerm(dataprovider.PermUpload, "/"))
+
+	err := os.MkdirAll(filepath.Join(homeDir, "archive", "2024"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(homeDir, "archive", "2024", "file.txt"), []byte("data"), os.ModePerm)
+	assert.NoError(t, err)
+
+	conn := NewBaseConnection("", ProtocolFTP, "", "", user)
+	_, fsPath, err := conn.GetFsAndResolvedPath("/current/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(homeDir, "archive", "2024", "file.txt"), fsPath)
+	files, err := conn.ListDir("/latest")
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 1)
+		assert.Equal(t, "file.txt", files[0].Name())
+	}
+	files, err = conn.ListDir("/")
+	if assert.NoError(t, err) {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		assert.Contains(t, names, "archive")
+		assert.Contains(t, names, "current")
+		assert.Contains(t, names, "latest")
+	}
+	info, err := conn.DoStat("/current/file.txt", 0, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(4), info.Size())
+	}
+	err = conn.CreateDir("/current", false)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.RemoveDir("/current")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.Rename("/current", "/other")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = conn.CreateDir("/current/sub", false)
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
+
+func TestPathRewriteRules(t *testing.T) {
+	homeDir := filepath.Join(os.TempDir(), "rewrite_home")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/":       {dataprovider.PermAny},
+				"/denied": {dataprovider.PermListItems, dataprovider.PermDownload},
+			},
+			HomeDir: homeDir,
+		},
+	}
+	user.Filters.PathRewriteRules = []dataprovider.PathRewrite{
+		{
+			Pattern:     `^/uploads/([^/]+\.csv)$`,
+			Replacement: "/uploads/{year}/{month}/$1",
+		},
+		{
+			Pattern:     `^/uploads/(?P<name>[^/]+)\.txt$`,
+			Replacement: "/{username}/${name}.log",
+			Protocols:   []string{dataprovider.ValidProtocols[1]},
+		},
+		{
+			Pattern:     `^.*/([^/]+\.pdf)$`,
+			Replacement: "/denied/sub/$1",
+		},
+		{
+			Pattern:     `^/uploads/`,
+			Replacement: "/",
+		},
+	}
+	err := os.MkdirAll(homeDir, os.ModePerm)
+	assert.NoError(t, err)
+	now := time.Now()
+	p, ok := user.RewriteUploadPath("/uploads/file.csv", ProtocolSSH)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf("/uploads/%s/file.csv", now.Format("2006/01")), p)
+	p, ok = user.RewriteUploadPath("/uploads/sub/file.csv", ProtocolSSH)
+	assert.True(t, ok)
+	assert.Equal(t, "/sub/file.csv", p)
+	p, ok = user.RewriteUploadPath("/file.csv", ProtocolSSH)
+	assert.False(t, ok)
+	assert.Equal(t, "/file.csv", p)
+	p, ok = user.RewriteUploadPath("/uploads/a.txt", ProtocolFTP)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf("/%s/a.log", userTestUsername), p)
+	p, ok = user.RewriteUploadPath("/uploads/a.txt", ProtocolSSH)
+	assert.True(t, ok)
+	assert.Equal(t, "/a.txt", p)
+
+	conn := NewBaseConnection("", ProtocolSFTP, "", "", user)
+	p, err = conn.GetUploadTargetPath("/uploads/file.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("/uploads/%s/file.csv", now.Format("2006/01")), p)
+	assert.DirExists(t, filepath.Join(homeDir, "uploads", now.Format("2006"), now.Format("01")))
+	p, err = conn.GetUploadTargetPath("/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "/file.txt", p)
+	// the missing parent dirs cannot be created
+	p, ok = user.RewriteUploadPath("/a/b.pdf", ProtocolHTTP)
+	assert.True(t, ok)
+	assert.Equal(t, "/denied/sub/b.pdf", p)
+	_, err = conn.GetUploadTargetPath("/a/b.pdf")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	assert.NoDirExists(t, filepath.Join(homeDir, "denied", "sub"))
+
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
+
+func TestAutoExtractEntryPath(t *testing.T) {
+	user := dataprovider.User{}
+	user.Filters.AutoExtract = dataprovider.AutoExtractConfig{
+		TriggerPath:   "/incoming/*",
+		ExtractToPath: "/extracted",
+	}
+	assert.True(t, user.IsAutoExtractEnabled("/incoming/dir/a.ZIP"))
+	assert.False(t, user.IsAutoExtractEnabled("/incoming/a.zip"))
+	assert.False(t, user.IsAutoExtractEnabled("/incoming/dir/sub/a.zip"))
+	assert.False(t, user.IsAutoExtractEnabled("/incoming/dir/a.tar"))
+
+	e := &zipExtractor{targetDir: "/extracted"}
+	p, err := e.getEntryPath("dir/file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "/extracted/dir/file.txt", p)
+	p, err = e.getEntryPath("dir/../file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "/extracted/file.txt", p)
+	for _, name := range []string{"", "/file.txt", "../file.txt", "dir/../../file.txt", "..\\file.txt", "./",
+		"../extracted2/file.txt"} {
+		_, err = e.getEntryPath(name)
+		assert.Error(t, err, name)
+	}
+	e.targetDir = "/"
+	p, err = e.getEntryPath("../../file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "/file.txt", p)
+}
+
 func TestMaxWriteSize(t *testing.T) {
 	permissions := make(map[string][]string)
 	permissions["/"] = []string{dataprovider.PermAny}
@@ -438,40 +843,105 @@ func TestMaxWriteSize(t *testing.T) {
 	quotaResult := vfs.QuotaCheckResult{
 		HasSpace: true,
 	}
-	size, err := conn.GetMaxWriteSize(quotaResult, false, 0, fs.IsUploadResumeSupported())
+	size, err := conn.GetMaxWriteSize("/", quotaResult, false, 0, fs.IsUploadResumeSupported())
 	assert.NoError(t, err)
 	assert.Equal(t, int64(0), size)
 
 	conn.User.Filters.MaxUploadFileSize = 100
-	size, err = conn.GetMaxWriteSize(quotaResult, false, 0, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, false, 0, fs.IsUploadResumeSupported())
 	assert.NoError(t, err)
 	assert.Equal(t, int64(100), size)
 
 	quotaResult.QuotaSize = 1000
-	size, err = conn.GetMaxWriteSize(quotaResult, false, 50, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, false, 50, fs.IsUploadResumeSupported())
 	assert.NoError(t, err)
 	assert.Equal(t, int64(100), size)
 
 	quotaResult.QuotaSize = 1000
 	quotaResult.UsedSize = 990
-	size, err = conn.GetMaxWriteSize(quotaResult, false, 50, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, false, 50, fs.IsUploadResumeSupported())
 	assert.NoError(t, err)
 	assert.Equal(t, int64(60), size)
 
 	quotaResult.QuotaSize = 0
 	quotaResult.UsedSize = 0
-	size, err = conn.GetMaxWriteSize(quotaResult, true, 100, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, true, 100, fs.IsUploadResumeSupported())
 	assert.True(t, conn.IsQuotaExceededError(err))
 	assert.Equal(t, int64(0), size)
 
-	size, err = conn.GetMaxWriteSize(quotaResult, true, 10, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, true, 10, fs.IsUploadResumeSupported())
 	assert.NoError(t, err)
 	assert.Equal(t, int64(90), size)
 
 	fs = newMockOsFs(true, fs.ConnectionID(), user.GetHomeDir(), "", nil)
-	size, err = conn.GetMaxWriteSize(quotaResult, true, 100, fs.IsUploadResumeSupported())
+	size, err = conn.GetMaxWriteSize("/", quotaResult, true, 100, fs.IsUploadResumeSupported())
 	assert.EqualError(t, err, ErrOpUnsupported.Error())
 	assert.Equal(t, int64(0), size)
+
+	conn.User.Filters.PathUploadLimits = []dataprovider.PathUploadLimit{
+		{
+			Path:              "/incoming",
+			MaxUploadFileSize: 0,
+		},
+		{
+			Path:              "/shared",
+			MaxUploadFileSize: 20,
+		},
+		{
+			Path:              "/shared/big",
+			MaxUploadFileSize: 500,
+		},
+	}
+	size, err = conn.GetMaxWriteSize("/incoming/file.zip", quotaResult, false, 0, fs.IsUploadResumeSupported())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+	size, err = conn.GetMaxWriteSize("/shared/file.txt", quotaResult, false, 0, fs.IsUploadResumeSupported())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), size)
+	size, err = conn.GetMaxWriteSize("/shared/big/sub/file.txt", quotaResult, false, 0, fs.IsUploadResumeSupported())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), size)
+	size, err = conn.GetMaxWriteSize("/sharedfile.txt", quotaResult, false, 0, fs.IsUploadResumeSupported())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), size)
+}
+
+func TestCheckUploadSpace(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Clean(os.TempDir()),
+		},
+	}
+	fs := vfs.NewOsFs("", user.GetHomeDir(), "")
+	conn := NewBaseConnection("", ProtocolSFTP, "", "", user)
+	fsPath := filepath.Join(user.GetHomeDir(), "upload")
+
+	err := conn.CheckUploadSpace(fs, fsPath, 0, 10)
+	assert.NoError(t, err)
+	err = conn.CheckUploadSpace(fs, fsPath, 100, 10)
+	assert.True(t, conn.IsQuotaExceededError(err))
+	err = conn.CheckUploadSpace(fs, fsPath, 100, 0)
+	assert.NoError(t, err)
+	// no local disk can satisfy this request
+	err = conn.CheckUploadSpace(fs, fsPath, math.MaxInt64/2, 0)
+	if runtime.GOOS != osWindows {
+		assert.True(t, conn.IsQuotaExceededError(err))
+	}
+
+	safetyMargin := Config.DiskSpaceSafetyMarginBytes
+	Config.DiskSpaceSafetyMarginBytes = math.MaxInt64 / 2
+	err = conn.CheckUploadSpace(fs, fsPath, 1, 0)
+	if runtime.GOOS != osWindows {
+		assert.True(t, conn.IsQuotaExceededError(err))
+	}
+	// the free space is not checked for non local filesystems
+	err = conn.CheckUploadSpace(newMockOsFs(false, "", user.GetHomeDir(), "S3Fs", nil), fsPath, 1, 0)
+	assert.NoError(t, err)
+	Config.DiskSpaceSafetyMarginBytes = safetyMargin
 }
 
 func TestCheckParentDirsErrors(t *testing.T) {
@@ -641,3 +1111,474 @@ func TestOrderDirsToRemove(t *testing.T) {
 		assert.Equal(t, "dir1", orderedDirs[3].fsPath)
 	}
 }
+
+func TestFileMetadata(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	homeDir := filepath.Join(os.TempDir(), "metadata_home")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "metadata_user",
+			HomeDir:  homeDir,
+		},
+	}
+	user.Permissions = make(map[string][]string)
+	user.Permissions["/"] = []string{dataprovider.PermAny}
+	user.Permissions["/ro"] = []string{dataprovider.PermListItems, dataprovider.PermDownload}
+	user.Permissions["/nolist"] = []string{dataprovider.PermUpload}
+	for _, dir := range []string{"ro", "nolist"} {
+		err := os.MkdirAll(filepath.Join(homeDir, dir), os.ModePerm)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(homeDir, dir, "file"), []byte("content"), os.ModePerm)
+		assert.NoError(t, err)
+	}
+	err := os.WriteFile(filepath.Join(homeDir, "file"), []byte("content"), os.ModePerm)
+	assert.NoError(t, err)
+	conn := NewBaseConnection(xid.New().String(), ProtocolHTTP, "", "", user)
+
+	metadata, err := conn.GetMetadata("/file")
+	assert.NoError(t, err)
+	assert.Len(t, metadata, 0)
+	err = conn.SetMetadata("/file", map[string]string{
+		"key1":  "value1",
+		"_key2": "value 2",
+	})
+	assert.NoError(t, err)
+	metadata, err = conn.GetMetadata("/file")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key1": "value1", "_key2": "value 2"}, metadata)
+	err = conn.SetMetadata("/file", map[string]string{"key3": "value3"})
+	assert.NoError(t, err)
+	metadata, err = conn.GetMetadata("/file")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key3": "value3"}, metadata)
+	err = conn.SetMetadata("/ro", map[string]string{"key": "dir value"})
+	assert.NoError(t, err)
+	metadata, err = conn.GetMetadata("/ro")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "dir value"}, metadata)
+	err = conn.SetMetadata("/file", nil)
+	assert.NoError(t, err)
+	metadata, err = conn.GetMetadata("/file")
+	assert.NoError(t, err)
+	assert.Len(t, metadata, 0)
+	// invalid metadata
+	for _, md := range []map[string]string{
+		{"Key": "value"},
+		{"1key": "value"},
+		{"key-1": "value"},
+		{strings.Repeat("a", vfs.MaxMetadataKeyLength+1): "value"},
+		{"key": ""},
+		{"key": "value\n"},
+		{"key": "vàlue"},
+		{"key1": strings.Repeat("a", vfs.MaxMetadataSize/2), "key2": strings.Repeat("b", vfs.MaxMetadataSize/2)},
+	} {
+		err = conn.SetMetadata("/file", md)
+		var validationErr *util.ValidationError
+		assert.ErrorAs(t, err, &validationErr, "metadata: %+v", md)
+	}
+	err = conn.SetMetadata("/ro/file", map[string]string{"key": "value"})
+	assert.ErrorIs(t, err, os.ErrPermission)
+	_, err = conn.GetMetadata("/ro/file")
+	assert.NoError(t, err)
+	_, err = conn.GetMetadata("/nolist/file")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	_, err = conn.GetMetadata("/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	err = conn.SetMetadata("/missing", map[string]string{"key": "value"})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
+
+func TestCopyFilesAndDirs(t *testing.T) {
+	homeDir := filepath.Join(os.TempDir(), "copy_home")
+	mappedPath := filepath.Join(os.TempDir(), "copy_vdir")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "copy_user",
+			HomeDir:  homeDir,
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name:       filepath.Base(mappedPath),
+					MappedPath: mappedPath,
+				},
+				VirtualPath: "/vdir",
+			},
+		},
+	}
+	user.Permissions = make(map[string][]string)
+	user.Permissions["/"] = []string{dataprovider.PermAny}
+	user.Permissions["/nodownload"] = []string{dataprovider.PermListItems, dataprovider.PermUpload,
+		dataprovider.PermCreateDirs}
+	user.Filters.PathAliases = []dataprovider.PathAlias{
+		{
+			Path:   "/alias",
+			Target: "/dir/sub",
+		},
+	}
+	err := os.MkdirAll(filepath.Join(homeDir, "dir", "sub"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(homeDir, "nodownload"), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.MkdirAll(mappedPath, os.ModePerm)
+	assert.NoError(t, err)
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{filepath.Join("dir", "file"), filepath.Join("dir", "sub", "file"),
+		filepath.Join("nodownload", "file")} {
+		p := filepath.Join(homeDir, name)
+		err = os.WriteFile(p, []byte("content"), os.ModePerm)
+		assert.NoError(t, err)
+		err = os.Chtimes(p, modTime, modTime)
+		assert.NoError(t, err)
+	}
+	conn := NewBaseConnection(xid.New().String(), ProtocolHTTP, "", "", user)
+
+	err = conn.CopyFile("/dir/file", "/filecopy")
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(homeDir, "filecopy"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(7), info.Size())
+		assert.Equal(t, modTime, info.ModTime())
+	}
+	// the target must not exist
+	err = conn.CopyFile("/dir/file", "/filecopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	// CopyFile requires a file and CopyDir a directory
+	err = conn.CopyFile("/dir", "/dircopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	err = conn.CopyDir("/dir/file", "/dircopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	// the target cannot be inside the source
+	err = conn.CopyDir("/dir", "/dir/sub/dircopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	// path aliases are resolved before checking
+	err = conn.CopyDir("/dir", "/alias/dircopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	err = conn.CopyDir("/alias", "/dir/sub/dircopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	assert.NoDirExists(t, filepath.Join(homeDir, "dir", "sub", "dircopy"))
+	err = conn.CopyFile("/missing", "/missingcopy")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	err = conn.CopyFile("/nodownload/file", "/filecopy1")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	// the copy to a virtual folder uses a different filesystem
+	err = conn.CopyDir("/dir", "/vdir/dircopy")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(mappedPath, "dircopy", "file"))
+	assert.FileExists(t, filepath.Join(mappedPath, "dircopy", "sub", "file"))
+	err = conn.CopyDir("/", "/vdir/rootcopy")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	// copy streaming the contents
+	fs, fsSourcePath, err := conn.GetFsAndResolvedPath("/dir/file")
+	assert.NoError(t, err)
+	srcInfo, err := fs.Stat(fsSourcePath)
+	assert.NoError(t, err)
+	entry := copyEntry{
+		virtualSourcePath: "/dir/file",
+		virtualTargetPath: "/filecopy2",
+		fsSourcePath:      fsSourcePath,
+		fsTargetPath:      filepath.Join(homeDir, "filecopy2"),
+		info:              srcInfo,
+	}
+	err = conn.copyFileContents(fs, fs, &entry, false)
+	assert.NoError(t, err)
+	info, err = os.Stat(filepath.Join(homeDir, "filecopy2"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(7), info.Size())
+		assert.Equal(t, modTime, info.ModTime())
+	}
+	entry.fsSourcePath = filepath.Join(homeDir, "missing")
+	entry.fsTargetPath = filepath.Join(homeDir, "filecopy3")
+	err = conn.copyFileContents(fs, fs, &entry, false)
+	assert.Error(t, err)
+	assert.NoFileExists(t, entry.fsTargetPath)
+
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+	err = os.RemoveAll(mappedPath)
+	assert.NoError(t, err)
+}
+
+func TestAutoVirtualFolders(t *testing.T) {
+	folder := vfs.BaseVirtualFolder{
+		Name:       "auto_datasets",
+		MappedPath: filepath.Join(os.TempDir(), "auto_datasets", "{username}"),
+	}
+	err := dataprovider.AddFolder(&folder, "", "")
+	assert.NoError(t, err)
+
+	oldProviderConf := dataprovider.GetProviderConfig()
+	providerConf := dataprovider.GetProviderConfig()
+	providerConf.AutoVirtualFolders = []dataprovider.AutoVirtualFolderRule{
+		{
+			Condition:   "attribute",
+			Attribute:   "email",
+			Value:       "invalid",
+			FolderName:  folder.Name,
+			VirtualPath: "/",
+		},
+	}
+	err = dataprovider.Close()
+	assert.NoError(t, err)
+	err = dataprovider.Initialize(providerConf, configDir, true)
+	assert.Error(t, err)
+
+	providerConf.AutoVirtualFolders = []dataprovider.AutoVirtualFolderRule{
+		{
+			Condition:   "group",
+			Value:       "research",
+			FolderName:  folder.Name,
+			VirtualPath: "/datasets",
+			ReadOnly:    true,
+		},
+		{
+			Condition:   "username",
+			Value:       "auto_*",
+			FolderName:  folder.Name,
+			VirtualPath: "/data/{username}",
+		},
+		{
+			Condition:   "attribute",
+			Attribute:   "email",
+			Value:       "*@example.com",
+			FolderName:  "missing_auto_folder",
+			VirtualPath: "/missing",
+		},
+	}
+	err = dataprovider.Initialize(providerConf, configDir, true)
+	assert.NoError(t, err)
+
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "auto_user",
+			Email:    "auto@example.com",
+			HomeDir:  filepath.Join(os.TempDir(), "auto_user"),
+		},
+	}
+	user.Groups = []sdk.GroupMapping{
+		{
+			Name: "research",
+			Type: sdk.GroupTypeMembership,
+		},
+	}
+	conn := NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user)
+	assert.Len(t, user.VirtualFolders, 0)
+	// the folder is already mounted, the second rule is ignored and the missing folder is skipped
+	if assert.Len(t, conn.User.VirtualFolders, 1) {
+		vfolder := conn.User.VirtualFolders[0]
+		assert.Equal(t, folder.Name, vfolder.Name)
+		assert.Equal(t, "/datasets", vfolder.VirtualPath)
+		assert.Equal(t, filepath.Join(os.TempDir(), "auto_datasets", "auto_user"), vfolder.MappedPath)
+		assert.True(t, vfolder.ReadOnly)
+	}
+
+	user.Groups = nil
+	conn = NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user)
+	if assert.Len(t, conn.User.VirtualFolders, 1) {
+		assert.Equal(t, "/data/auto_user", conn.User.VirtualFolders[0].VirtualPath)
+		assert.False(t, conn.User.VirtualFolders[0].ReadOnly)
+	}
+	// explicitly provisioned folders win
+	user.VirtualFolders = []vfs.VirtualFolder{
+		{
+			BaseVirtualFolder: vfs.BaseVirtualFolder{
+				Name:       "other",
+				MappedPath: filepath.Join(os.TempDir(), "other"),
+			},
+			VirtualPath: "/data/auto_user",
+		},
+	}
+	conn = NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user)
+	if assert.Len(t, conn.User.VirtualFolders, 1) {
+		assert.Equal(t, "other", conn.User.VirtualFolders[0].Name)
+	}
+
+	user.Username = "user_auto"
+	user.VirtualFolders = nil
+	conn = NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user)
+	assert.Len(t, conn.User.VirtualFolders, 0)
+
+	err = dataprovider.Close()
+	assert.NoError(t, err)
+	err = dataprovider.Initialize(oldProviderConf, configDir, true)
+	assert.NoError(t, err)
+	err = dataprovider.DeleteFolder(folder.Name, "", "")
+	assert.NoError(t, err)
+}
+
+func TestRefreshGroupPermissions(t *testing.T) {
+	groupName := "perm_refresh_group"
+	group := dataprovider.Group{
+		BaseGroup: sdk.BaseGroup{
+			Name: groupName,
+		},
+		UserSettings: dataprovider.GroupUserSettings{
+			BaseGroupUserSettings: sdk.BaseGroupUserSettings{
+				Permissions: map[string][]string{
+					"/sub": {dataprovider.PermListItems},
+				},
+			},
+		},
+	}
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "perm_refresh_user",
+			Password: "pwd",
+			HomeDir:  filepath.Join(os.TempDir(), "perm_refresh_user"),
+			Status:   1,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+		},
+		Groups: []sdk.GroupMapping{
+			{
+				Name: groupName,
+				Type: sdk.GroupTypeSecondary,
+			},
+		},
+	}
+	err := dataprovider.AddGroup(&group, "", "")
+	assert.NoError(t, err)
+	err = dataprovider.AddUser(&user, "", "")
+	assert.NoError(t, err)
+	user, err = dataprovider.GetUserWithGroupSettings(user.Username)
+	assert.NoError(t, err)
+
+	conn := &fakeConnection{
+		BaseConnection: NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user),
+	}
+	assert.True(t, conn.HasGroupSettings(groupName))
+	assert.False(t, conn.HasGroupSettings("missing group"))
+	err = Connections.Add(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dataprovider.PermListItems}, conn.GetEffectiveUser().GetPermissionsForPath("/sub"))
+
+	// the permissions are checked while they are refreshed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			conn.GetEffectiveUser().HasPerm(dataprovider.PermDownload, "/sub")
+		}
+	}()
+	group, err = dataprovider.GroupExists(groupName)
+	assert.NoError(t, err)
+	group.UserSettings.Permissions["/sub"] = []string{dataprovider.PermListItems, dataprovider.PermDownload}
+	err = dataprovider.UpdateGroup(&group, group.Users, "", "")
+	assert.NoError(t, err)
+	<-done
+	// the connection is refreshed without being dropped
+	assert.Equal(t, []string{dataprovider.PermListItems, dataprovider.PermDownload},
+		conn.GetEffectiveUser().GetPermissionsForPath("/sub"))
+	assert.Len(t, Connections.GetStats(), 1)
+
+	numUsers, err := dataprovider.ApplyGroupChanges(groupName, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numUsers)
+	_, err = dataprovider.ApplyGroupChanges("missing group", "", "")
+	assert.ErrorIs(t, err, util.ErrNotFound)
+
+	err = dataprovider.DeleteUser(user.Username, "", "")
+	assert.NoError(t, err)
+	// the user does not exist anymore, the permissions are not changed
+	Connections.InvalidateGroupPermissionCache(groupName)
+	assert.Equal(t, []string{dataprovider.PermListItems, dataprovider.PermDownload},
+		conn.GetEffectiveUser().GetPermissionsForPath("/sub"))
+
+	Connections.Remove(conn.GetID())
+	assert.Len(t, Connections.GetStats(), 0)
+	err = dataprovider.DeleteGroup(groupName, "", "")
+	assert.NoError(t, err)
+}
+
+func TestDirListPrefetch(t *testing.T) {
+	homeDir := filepath.Join(os.TempDir(), "prefetch_user")
+	for _, dir := range []string{"dir1/sub1/sub2", "dir2", "nolist/sub", "vdir/sub"} {
+		err := os.MkdirAll(filepath.Join(homeDir, dir), os.ModePerm)
+		assert.NoError(t, err)
+	}
+	err := os.WriteFile(filepath.Join(homeDir, "file"), []byte("data"), 0666)
+	assert.NoError(t, err)
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       1,
+			Username: "prefetch_user",
+			HomeDir:  homeDir,
+			Permissions: map[string][]string{
+				"/":       {dataprovider.PermAny},
+				"/nolist": {dataprovider.PermUpload},
+			},
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name:       "prefetch_folder",
+					MappedPath: filepath.Join(os.TempDir(), "prefetch_folder"),
+				},
+				VirtualPath: "/vdir",
+			},
+		},
+	}
+	conn := &fakeConnection{
+		BaseConnection: NewBaseConnection(xid.New().String(), ProtocolSFTP, "", "", user),
+	}
+	fs := vfs.NewOsFs(conn.GetID(), homeDir, "")
+	cache := newDirListingCache(DirListCacheConfig{
+		Size: 10,
+		TTL:  60,
+	})
+	// the connection is not active, nothing is pre-fetched
+	conn.prefetchDirListings(cache, fs, 3)
+	assert.Equal(t, 0, cache.size())
+
+	err = Connections.Add(conn)
+	assert.NoError(t, err)
+	conn.prefetchDirListings(cache, fs, 3)
+	assert.Equal(t, 4, cache.size())
+	for _, dir := range []string{"/", "/dir1", "/dir2", "/dir1/sub1"} {
+		_, ok := cache.get(user.ID, dir)
+		assert.True(t, ok, dir)
+	}
+	for _, dir := range []string{"/nolist", "/vdir", "/dir1/sub1/sub2"} {
+		_, ok := cache.get(user.ID, dir)
+		assert.False(t, ok, dir)
+	}
+	// the existing listings are preserved
+	cache.add(user.ID, "/", dirListFolder{}, nil)
+	conn.prefetchDirListings(cache, fs, 1)
+	entries, ok := cache.get(user.ID, "/")
+	assert.True(t, ok)
+	assert.Len(t, entries, 0)
+	// the pre-fetch stops if the cache is full
+	cache = newDirListingCache(DirListCacheConfig{
+		Size: 2,
+		TTL:  60,
+	})
+	conn.prefetchDirListings(cache, fs, 5)
+	assert.Equal(t, 2, cache.size())
+	// a pre-fetched listing does not evict the existing ones
+	assert.False(t, cache.addPrefetched(user.ID+1, "/", nil))
+	// the pre-fetch is only enabled for S3 users with the cache enabled
+	oldCache := dirListCache
+	dirListCache = cache
+	conn.PrefetchDirListings()
+	_, ok = cache.get(user.ID, "/dir1/sub1")
+	assert.False(t, ok)
+	// the listings are cached
+	_, err = conn.ListDirCached("/dir2")
+	assert.NoError(t, err)
+	_, ok = cache.get(user.ID, "/dir2")
+	assert.True(t, ok)
+	_, err = conn.ListDirCached("/nolist")
+	assert.ErrorIs(t, err, conn.GetPermissionDeniedError())
+	dirListCache = oldCache
+
+	Connections.Remove(conn.GetID())
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
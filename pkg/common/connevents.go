@@ -0,0 +1,281 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported connection event types
+const (
+	ConnectionEventSnapshot          = "snapshot"
+	ConnectionEventConnected         = "connected"
+	ConnectionEventDisconnected      = "disconnected"
+	ConnectionEventTransferStarted   = "transfer_started"
+	ConnectionEventTransferProgress  = "transfer_progress"
+	ConnectionEventTransferCompleted = "transfer_completed"
+)
+
+const (
+	connectionEventsBufferSize       = 256
+	connectionEventsProgressInterval = 2 * time.Second
+)
+
+var connEventsBroker = newConnectionEventsBroker()
+
+// ConnectionEventTransfer defines the transfer details for transfer events
+type ConnectionEventTransfer struct {
+	ID int64 `json:"id"`
+	ConnectionTransfer
+	UploadedSize   int64 `json:"uploaded_size"`
+	DownloadedSize int64 `json:"downloaded_size"`
+}
+
+// ConnectionEvent defines an event published to the connection events subscribers
+type ConnectionEvent struct {
+	Type string `json:"type"`
+	// Event time as unix timestamp in milliseconds
+	Timestamp    int64  `json:"timestamp"`
+	ConnectionID string `json:"connection_id,omitempty"`
+	// Set for snapshot events
+	Connections []ConnectionStatus `json:"connections,omitempty"`
+	// Set for connected events
+	Connection *ConnectionStatus `json:"connection,omitempty"`
+	// Set for transfer events
+	Transfer *ConnectionEventTransfer `json:"transfer,omitempty"`
+}
+
+type connectionEventsSubscriber struct {
+	ch chan ConnectionEvent
+	// events published before the initial snapshot is sent
+	pending []ConnectionEvent
+	ready   bool
+}
+
+type connectionEventsBroker struct {
+	numSubscribers atomic.Int32
+	mu             sync.Mutex
+	lastID         uint64
+	subscribers    map[uint64]*connectionEventsSubscriber
+	stopProgress   chan bool
+}
+
+func newConnectionEventsBroker() *connectionEventsBroker {
+	return &connectionEventsBroker{
+		subscribers: make(map[uint64]*connectionEventsSubscriber),
+	}
+}
+
+func (b *connectionEventsBroker) hasSubscribers() bool {
+	return b.numSubscribers.Load() > 0
+}
+
+func (b *connectionEventsBroker) subscribe() (uint64, <-chan ConnectionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	sub := &connectionEventsSubscriber{
+		ch: make(chan ConnectionEvent, connectionEventsBufferSize),
+	}
+	b.subscribers[b.lastID] = sub
+	b.numSubscribers.Store(int32(len(b.subscribers)))
+	if b.stopProgress == nil {
+		b.stopProgress = make(chan bool)
+		go b.notifyTransfersProgress(b.stopProgress)
+	}
+	logger.Debug(logSender, "", "connection events subscriber %d added, subscribers: %d", b.lastID, len(b.subscribers))
+	return b.lastID, sub.ch
+}
+
+// setReady sends the snapshot and the events published in the meantime
+// to the specified subscriber
+func (b *connectionEventsBroker) setReady(id uint64, snapshot ConnectionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subscribers[id]
+	if !ok {
+		return
+	}
+	sub.ready = true
+	if !b.send(id, sub, snapshot) {
+		return
+	}
+	for _, event := range sub.pending {
+		if !b.send(id, sub, event) {
+			return
+		}
+	}
+	sub.pending = nil
+}
+
+func (b *connectionEventsBroker) unsubscribe(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.removeSubscriber(id)
+}
+
+// internal method, must be called within a locked block
+func (b *connectionEventsBroker) removeSubscriber(id uint64) {
+	sub, ok := b.subscribers[id]
+	if !ok {
+		return
+	}
+	close(sub.ch)
+	delete(b.subscribers, id)
+	b.numSubscribers.Store(int32(len(b.subscribers)))
+	if len(b.subscribers) == 0 && b.stopProgress != nil {
+		close(b.stopProgress)
+		b.stopProgress = nil
+	}
+	logger.Debug(logSender, "", "connection events subscriber %d removed, subscribers: %d", id, len(b.subscribers))
+}
+
+// internal method, must be called within a locked block
+func (b *connectionEventsBroker) send(id uint64, sub *connectionEventsSubscriber, event ConnectionEvent) bool {
+	select {
+	case sub.ch <- event:
+		return true
+	default:
+		// the subscriber is too slow, dropping events would leave it with an
+		// inconsistent view so we remove it, it can resubscribe and get a new snapshot
+		logger.Warn(logSender, "", "connection events subscriber %d is too slow, removing", id)
+		b.removeSubscriber(id)
+		return false
+	}
+}
+
+func (b *connectionEventsBroker) publish(event ConnectionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.Timestamp = util.GetTimeAsMsSinceEpoch(time.Now())
+	for id, sub := range b.subscribers {
+		if !sub.ready {
+			if len(sub.pending) < connectionEventsBufferSize {
+				sub.pending = append(sub.pending, event)
+			}
+			continue
+		}
+		b.send(id, sub, event)
+	}
+}
+
+func (b *connectionEventsBroker) notifyTransfersProgress(stop chan bool) {
+	ticker := time.NewTicker(connectionEventsProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, c := range Connections.GetStats() {
+				for _, t := range c.Transfers {
+					b.publish(ConnectionEvent{
+						Type:         ConnectionEventTransferProgress,
+						ConnectionID: c.ConnectionID,
+						Transfer:     newConnectionEventTransfer(t),
+					})
+				}
+			}
+		}
+	}
+}
+
+func newConnectionEventTransfer(t ConnectionTransfer) *ConnectionEventTransfer {
+	return &ConnectionEventTransfer{
+		ID:                 t.ID,
+		ConnectionTransfer: t,
+		UploadedSize:       t.ULSize,
+		DownloadedSize:     t.DLSize,
+	}
+}
+
+func getConnectionStatus(c ActiveConnection) ConnectionStatus {
+	uploadBucket, downloadBucket := c.GetBandwidthBuckets()
+	return ConnectionStatus{
+		Username:       c.GetUsername(),
+		ConnectionID:   c.GetID(),
+		ClientVersion:  c.GetClientVersion(),
+		RemoteAddress:  c.GetRemoteAddress(),
+		ConnectionTime: util.GetTimeAsMsSinceEpoch(c.GetConnectionTime()),
+		LastActivity:   util.GetTimeAsMsSinceEpoch(c.GetLastActivity()),
+		Protocol:       c.GetProtocol(),
+		SFTPVersion:    c.GetSFTPVersion(),
+		Command:        c.GetCommand(),
+		Transfers:      c.GetTransfers(),
+		Node:           dataprovider.GetNodeName(),
+		UploadBucket:   uploadBucket,
+		DownloadBucket: downloadBucket,
+	}
+}
+
+func notifyConnectionEvent(eventType string, c ActiveConnection) {
+	if !connEventsBroker.hasSubscribers() {
+		return
+	}
+	event := ConnectionEvent{
+		Type:         eventType,
+		ConnectionID: c.GetID(),
+	}
+	if eventType == ConnectionEventConnected {
+		status := getConnectionStatus(c)
+		event.Connection = &status
+	}
+	connEventsBroker.publish(event)
+}
+
+func notifyTransferEvent(eventType, connectionID string, t ActiveTransfer) {
+	if !connEventsBroker.hasSubscribers() {
+		return
+	}
+	connEventsBroker.publish(ConnectionEvent{
+		Type:         eventType,
+		ConnectionID: connectionID,
+		Transfer:     newConnectionEventTransfer(getConnectionTransfer(t)),
+	})
+}
+
+// Subscribe registers a new subscriber for the connection events.
+// The returned channel receives a snapshot event with the active connections,
+// then the incremental updates. A "connected" event is also sent if the details
+// of an existing connection change, for example after an FTP login.
+// The channel is closed if the subscriber is too slow to consume the events.
+// Unsubscribe must be called to release the associated resources
+func (conns *ActiveConnections) Subscribe() (uint64, <-chan ConnectionEvent) {
+	// we subscribe before getting the snapshot so no event can be lost,
+	// the events published in the meantime are sent after the snapshot
+	id, ch := connEventsBroker.subscribe()
+	connEventsBroker.setReady(id, ConnectionEvent{
+		Type:        ConnectionEventSnapshot,
+		Timestamp:   util.GetTimeAsMsSinceEpoch(time.Now()),
+		Connections: conns.GetStats(),
+	})
+	return id, ch
+}
+
+// Unsubscribe removes the connection events subscriber with the given id
+func (conns *ActiveConnections) Unsubscribe(id uint64) {
+	connEventsBroker.unsubscribe(id)
+}
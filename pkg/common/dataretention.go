@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -31,6 +32,7 @@ import (
 
 	mail "github.com/xhit/go-simple-mail/v2"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
@@ -53,6 +55,8 @@ const (
 var (
 	// RetentionChecks is the list of active retention checks
 	RetentionChecks ActiveRetentionChecks
+	// ErrRetentionCheckInProgress is returned if a retention check for the same user is already active
+	ErrRetentionCheckInProgress = errors.New("another retention check is already in progress")
 )
 
 // ActiveRetentionChecks holds the active retention checks
@@ -151,6 +155,48 @@ type RetentionCheck struct {
 	// Cleanup results
 	results []folderRetentionCheckResult `json:"-"`
 	conn    *BaseConnection
+	// true if the folders are defined by the user data retention policy
+	isPolicy bool
+	// if true the files to delete are only collected
+	simulate       bool
+	simulatedFiles []RetentionPolicyFile
+}
+
+// RetentionPolicyFile defines a file that a data retention policy would delete
+type RetentionPolicyFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Last modification time as unix timestamp in milliseconds
+	LastModified int64 `json:"last_modified"`
+	// Retention, as hours, applied to the file
+	Retention int `json:"retention"`
+}
+
+// NewRetentionPolicyCheck adds a retention check that enforces the data retention
+// policy for the specified user. If simulate is true the check only reports the
+// files to delete, see GetSimulatedFiles
+func NewRetentionPolicyCheck(user *dataprovider.User, simulate bool) (*RetentionCheck, error) {
+	if !user.Filters.DataRetentionPolicy.IsEnabled() {
+		return nil, util.NewValidationError(fmt.Sprintf("no data retention policy defined for user %q", user.Username))
+	}
+	check := RetentionCheck{
+		Folders:  user.Filters.DataRetentionPolicy.GetFolderRetentions(),
+		isPolicy: true,
+		simulate: simulate,
+	}
+	c := RetentionChecks.Add(check, user)
+	if c == nil {
+		return nil, ErrRetentionCheckInProgress
+	}
+	return c, nil
+}
+
+// GetSimulatedFiles returns the files that a simulated check would delete
+func (c *RetentionCheck) GetSimulatedFiles() []RetentionPolicyFile {
+	if c.simulatedFiles == nil {
+		return []RetentionPolicyFile{}
+	}
+	return c.simulatedFiles
 }
 
 // Validate returns an error if the specified folders are not valid
@@ -279,6 +325,17 @@ func (c *RetentionCheck) cleanupFolder(folderPath string) error {
 		} else {
 			retentionTime := info.ModTime().Add(time.Duration(folderRetention.Retention) * time.Hour)
 			if retentionTime.Before(time.Now()) {
+				if c.simulate {
+					c.simulatedFiles = append(c.simulatedFiles, RetentionPolicyFile{
+						Path:         virtualPath,
+						Size:         info.Size(),
+						LastModified: util.GetTimeAsMsSinceEpoch(info.ModTime()),
+						Retention:    folderRetention.Retention,
+					})
+					result.DeletedFiles++
+					result.DeletedSize += info.Size()
+					continue
+				}
 				if err := c.removeFile(virtualPath, info); err != nil {
 					result.Elapsed = time.Since(startTime)
 					result.Error = fmt.Sprintf("unable to remove file %#v: %v", virtualPath, err)
@@ -286,15 +343,20 @@ func (c *RetentionCheck) cleanupFolder(folderPath string) error {
 						virtualPath, retentionTime, err)
 					return err
 				}
-				c.conn.Log(logger.LevelDebug, "removed file %#v, modification time: %v, retention: %v hours, retention time: %v",
-					virtualPath, info.ModTime(), folderRetention.Retention, retentionTime)
+				if c.isPolicy {
+					c.conn.Log(logger.LevelInfo, "file %q removed by the data retention policy, size: %d, modification time: %v, max age: %d days",
+						virtualPath, info.Size(), info.ModTime(), folderRetention.Retention/24)
+				} else {
+					c.conn.Log(logger.LevelDebug, "removed file %#v, modification time: %v, retention: %v hours, retention time: %v",
+						virtualPath, info.ModTime(), folderRetention.Retention, retentionTime)
+				}
 				result.DeletedFiles++
 				result.DeletedSize += info.Size()
 			}
 		}
 	}
 
-	if folderRetention.DeleteEmptyDirs {
+	if folderRetention.DeleteEmptyDirs && !c.simulate {
 		c.checkEmptyDirRemoval(folderPath)
 	}
 	result.Elapsed = time.Since(startTime)
@@ -430,14 +492,25 @@ func (c *RetentionCheck) sendHookNotification(elapsed time.Duration, errCheck er
 		}
 		respCode := 0
 
-		resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(jsonData))
-		if err == nil {
+		var hookErr error
+		err = circuitbreaker.Execute(command.HookDataRetention, func() error {
+			resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(jsonData))
+			if err != nil {
+				return err
+			}
 			respCode = resp.StatusCode
 			resp.Body.Close()
 
 			if respCode != http.StatusOK {
-				err = errUnexpectedHTTResponse
+				hookErr = errUnexpectedHTTResponse
 			}
+			if respCode >= http.StatusInternalServerError {
+				return hookErr
+			}
+			return nil
+		})
+		if err == nil {
+			err = hookErr
 		}
 
 		c.conn.Log(logger.LevelDebug, "notified result to URL: %#v, status code: %v, elapsed: %v err: %v",
@@ -457,7 +530,14 @@ func (c *RetentionCheck) sendHookNotification(elapsed time.Duration, errCheck er
 	cmd := exec.CommandContext(ctx, Config.DataRetentionHook, args...)
 	cmd.Env = append(env,
 		fmt.Sprintf("SFTPGO_DATA_RETENTION_RESULT=%v", string(jsonData)))
-	err := cmd.Run()
+	var cmdErr error
+	err := circuitbreaker.Execute(command.HookDataRetention, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
 
 	c.conn.Log(logger.LevelDebug, "notified result using command: %v, elapsed: %v err: %v",
 		Config.DataRetentionHook, time.Since(startTime), err)
@@ -180,7 +180,7 @@ type HostList struct {
 }
 
 func (h *HostList) isListed(ip string) bool {
-	if _, ok := h.IPAddresses[ip]; ok {
+	if _, ok := h.IPAddresses[util.NormalizeIP(ip)]; ok {
 		return true
 	}
 
@@ -302,7 +302,7 @@ func loadHostListFromFile(name string) (*HostList, error) {
 				logger.Warn(logSender, "", "unable to parse IP %#v", ip)
 				continue
 			}
-			result.IPAddresses[ip] = true
+			result.IPAddresses[util.NormalizeIP(ip)] = true
 			ipCount++
 		}
 		for _, cidrNet := range hostList.CIDRNetworks {
@@ -360,7 +360,7 @@ func addEntriesToList(entries []string, hostList *HostList, listName string) *Ho
 				logger.Warn(logSender, "", "unable to parse IP %#v", entry)
 				continue
 			}
-			hostList.IPAddresses[entry] = true
+			hostList.IPAddresses[util.NormalizeIP(entry)] = true
 			ipLoaded++
 		}
 	}
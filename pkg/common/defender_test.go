@@ -395,6 +395,16 @@ func TestAddEntriesToHostList(t *testing.T) {
 	assert.False(t, hostlist.isListed("192.168.6.2"))
 	assert.True(t, hostlist.isListed("10.7.0.28"))
 	assert.False(t, hostlist.isListed("10.7.0.129"))
+	// IPv6 and IPv4-mapped IPv6 addresses
+	hostlist = addEntriesToList([]string{"2001:DB8::1", "2001:db8:1::/48", "::ffff:192.168.7.1"}, nil, name)
+	require.NotNil(t, hostlist)
+	assert.True(t, hostlist.isListed("2001:db8::1"))
+	assert.True(t, hostlist.isListed("2001:0db8:0000::1"))
+	assert.False(t, hostlist.isListed("2001:db8::2"))
+	assert.True(t, hostlist.isListed("2001:db8:1:2::5"))
+	assert.False(t, hostlist.isListed("2001:db8:2::5"))
+	assert.True(t, hostlist.isListed("192.168.7.1"))
+	assert.True(t, hostlist.isListed("::ffff:192.168.7.1"))
 	// load invalid values
 	hostlist = addEntriesToList([]string{"invalidip", "invalidnet/24"}, nil, name)
 	require.NotNil(t, hostlist)
@@ -19,6 +19,7 @@ import (
 
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
@@ -114,6 +115,10 @@ func (d *dbDefender) AddEvent(ip string, event HostEvent) {
 				Timestamp: time.Now().UnixNano(),
 				Status:    1,
 			})
+			smtp.AddSecurityAlert(smtp.SecurityAlert{
+				Event: smtp.SecurityAlertIPBlocked,
+				IP:    ip,
+			})
 		}
 	}
 
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
@@ -215,6 +216,10 @@ func (d *memoryDefender) AddEvent(ip string, event HostEvent) {
 				Timestamp: time.Now().UnixNano(),
 				Status:    1,
 			})
+			smtp.AddSecurityAlert(smtp.SecurityAlert{
+				Event: smtp.SecurityAlertIPBlocked,
+				IP:    ip,
+			})
 		} else {
 			d.hosts[ip] = hs
 		}
@@ -0,0 +1,351 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/metric"
+)
+
+// node event kind used to propagate the cache invalidations to the other
+// cluster nodes
+const nodeEventDirListInvalidated = "dir_list_invalidated"
+
+var dirListCache *dirListingCache
+
+type dirListInvalidation struct {
+	UserID      int64  `json:"user_id"`
+	VirtualPath string `json:"virtual_path"`
+	// virtual folder and path inside it, if the invalidated path is
+	// inside a virtual folder
+	Folder     string `json:"folder,omitempty"`
+	FolderPath string `json:"folder_path,omitempty"`
+}
+
+// DirListCacheConfig defines the configuration for the directory listings cache.
+// Cached listings are used to serve WebDAV PROPFIND requests and SFTP and FTP
+// listings without querying the storage backend
+type DirListCacheConfig struct {
+	// Maximum number of directory listings to cache. 0 means disabled
+	Size int `json:"size" mapstructure:"size"`
+	// Time to live, in seconds, for cached listings
+	TTL int `json:"ttl" mapstructure:"ttl"`
+}
+
+// IsEnabled returns true if the directory listings cache is enabled
+func (c *DirListCacheConfig) IsEnabled() bool {
+	return c.Size > 0 && c.TTL > 0
+}
+
+// dirListFolder identifies a directory inside a virtual folder.
+// Virtual folders can be shared between users, so the cached listings for
+// directories inside them are invalidated for all the users
+type dirListFolder struct {
+	name string
+	// path relative to the virtual folder root
+	path string
+}
+
+// getDirListFolder returns the virtual folder, if any, for the specified virtual path
+func getDirListFolder(user *dataprovider.User, virtualPath string) dirListFolder {
+	virtualPath = user.ResolvePathAlias(path.Clean("/" + virtualPath))
+	folder, err := user.GetVirtualFolderForPath(virtualPath)
+	if err != nil {
+		return dirListFolder{}
+	}
+	return dirListFolder{
+		name: folder.Name,
+		path: path.Clean("/" + strings.TrimPrefix(virtualPath, folder.VirtualPath)),
+	}
+}
+
+type dirListingEntry struct {
+	userID      int64
+	virtualPath string
+	folder      dirListFolder
+	entries     []os.FileInfo
+	expiresAt   time.Time
+	// true if the listing was pre-fetched and not yet requested
+	prefetched bool
+}
+
+type dirListingCache struct {
+	sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	lru     *list.List
+	// cached listings indexed by user ID and virtual path
+	users map[int64]map[string]*list.Element
+	// cached listings for directories inside virtual folders indexed by folder name
+	folders map[string]map[*list.Element]bool
+}
+
+func newDirListingCache(config DirListCacheConfig) *dirListingCache {
+	return &dirListingCache{
+		maxSize: config.Size,
+		ttl:     time.Duration(config.TTL) * time.Second,
+		lru:     list.New(),
+		users:   make(map[int64]map[string]*list.Element),
+		folders: make(map[string]map[*list.Element]bool),
+	}
+}
+
+func (c *dirListingCache) get(userID int64, virtualPath string) ([]os.FileInfo, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.users[userID][path.Clean("/"+virtualPath)]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*dirListingEntry)
+	if time.Now().After(item.expiresAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	if item.prefetched {
+		item.prefetched = false
+		metric.AddDirListPrefetchHit()
+	}
+	// return a copy, callers are allowed to modify the returned slice
+	entries := make([]os.FileInfo, len(item.entries))
+	copy(entries, item.entries)
+	return entries, true
+}
+
+func (c *dirListingCache) add(userID int64, virtualPath string, folder dirListFolder, entries []os.FileInfo) {
+	c.Lock()
+	defer c.Unlock()
+
+	virtualPath = path.Clean("/" + virtualPath)
+	cached := make([]os.FileInfo, len(entries))
+	copy(cached, entries)
+
+	if elem, ok := c.users[userID][virtualPath]; ok {
+		c.removeElement(elem)
+	}
+	c.addElement(c.lru.PushFront(&dirListingEntry{
+		userID:      userID,
+		virtualPath: virtualPath,
+		folder:      folder,
+		entries:     cached,
+		expiresAt:   time.Now().Add(c.ttl),
+	}))
+	for c.lru.Len() > c.maxSize {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// addPrefetched adds a pre-fetched listing without evicting the existing ones.
+// The listings already cached are preserved, they could be more recent.
+// Virtual folders are not pre-fetched.
+// It returns false if the cache is full
+func (c *dirListingCache) addPrefetched(userID int64, virtualPath string, entries []os.FileInfo) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	virtualPath = path.Clean("/" + virtualPath)
+	if _, ok := c.users[userID][virtualPath]; ok {
+		return true
+	}
+	if c.lru.Len() >= c.maxSize {
+		return false
+	}
+	cached := make([]os.FileInfo, len(entries))
+	copy(cached, entries)
+	c.addElement(c.lru.PushBack(&dirListingEntry{
+		userID:      userID,
+		virtualPath: virtualPath,
+		entries:     cached,
+		expiresAt:   time.Now().Add(c.ttl),
+		prefetched:  true,
+	}))
+	metric.AddDirListPrefetched()
+	return true
+}
+
+// remove removes the listings for the specified directory and for all
+// its subdirectories. If the directory is inside a virtual folder, the
+// listings are removed for all the users sharing the folder
+func (c *dirListingCache) remove(userID int64, virtualPath string, folder dirListFolder) {
+	c.Lock()
+	defer c.Unlock()
+
+	virtualPath = path.Clean("/" + virtualPath)
+	for p, elem := range c.users[userID] {
+		if isDirListSubPath(virtualPath, p) {
+			c.removeElement(elem)
+		}
+	}
+	if folder.name == "" {
+		return
+	}
+	for elem := range c.folders[folder.name] {
+		item := elem.Value.(*dirListingEntry)
+		if isDirListSubPath(folder.path, item.folder.path) {
+			c.removeElement(elem)
+		}
+	}
+}
+
+// isDirListSubPath returns true if p is dir or one of its subdirectories,
+// both paths must be cleaned
+func isDirListSubPath(dir, p string) bool {
+	return p == dir || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+func (c *dirListingCache) removeUser(userID int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, elem := range c.users[userID] {
+		c.removeElement(elem)
+	}
+}
+
+func (c *dirListingCache) addElement(elem *list.Element) {
+	item := elem.Value.(*dirListingEntry)
+	userItems, ok := c.users[item.userID]
+	if !ok {
+		userItems = make(map[string]*list.Element)
+		c.users[item.userID] = userItems
+	}
+	userItems[item.virtualPath] = elem
+	if item.folder.name != "" {
+		folderItems, ok := c.folders[item.folder.name]
+		if !ok {
+			folderItems = make(map[*list.Element]bool)
+			c.folders[item.folder.name] = folderItems
+		}
+		folderItems[elem] = true
+	}
+}
+
+func (c *dirListingCache) removeElement(elem *list.Element) {
+	item := elem.Value.(*dirListingEntry)
+	if userItems, ok := c.users[item.userID]; ok {
+		delete(userItems, item.virtualPath)
+		if len(userItems) == 0 {
+			delete(c.users, item.userID)
+		}
+	}
+	if folderItems, ok := c.folders[item.folder.name]; ok {
+		delete(folderItems, elem)
+		if len(folderItems) == 0 {
+			delete(c.folders, item.folder.name)
+		}
+	}
+	c.lru.Remove(elem)
+}
+
+func (c *dirListingCache) size() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lru.Len()
+}
+
+// GetCachedDirListing returns the cached listing for the specified user ID
+// and virtual path, if any
+func GetCachedDirListing(userID int64, virtualPath string) ([]os.FileInfo, bool) {
+	if dirListCache == nil {
+		return nil, false
+	}
+	entries, ok := dirListCache.get(userID, virtualPath)
+	metric.DirListCacheLookup(ok)
+	return entries, ok
+}
+
+// CacheDirListing adds the listing for the specified user and virtual path
+// to the cache
+func CacheDirListing(user *dataprovider.User, virtualPath string, entries []os.FileInfo) {
+	if dirListCache == nil {
+		return
+	}
+	dirListCache.add(user.ID, virtualPath, getDirListFolder(user, virtualPath), entries)
+}
+
+// RemoveCachedDirListing removes the cached listing for the specified user
+// and virtual path without notifying the other nodes. The listings for the
+// other users sharing the same virtual folder are removed too.
+// An empty virtual path removes all the cached listings for the user
+func RemoveCachedDirListing(user *dataprovider.User, virtualPath string) {
+	if dirListCache == nil {
+		return
+	}
+	if virtualPath == "" {
+		dirListCache.removeUser(user.ID)
+		return
+	}
+	dirListCache.remove(user.ID, virtualPath, getDirListFolder(user, virtualPath))
+}
+
+// invalidateDirListing removes the cached listing for the specified
+// user and virtual path and propagates the invalidation to the other nodes
+func invalidateDirListing(user *dataprovider.User, virtualPath string) {
+	if dirListCache == nil {
+		return
+	}
+	folder := getDirListFolder(user, virtualPath)
+	dirListCache.remove(user.ID, virtualPath, folder)
+	if dataprovider.GetNodeName() == "" {
+		return
+	}
+	data, err := json.Marshal(dirListInvalidation{
+		UserID:      user.ID,
+		VirtualPath: virtualPath,
+		Folder:      folder.name,
+		FolderPath:  folder.path,
+	})
+	if err != nil {
+		return
+	}
+	go dataprovider.AddNodeEvent(nodeEventDirListInvalidated, data) //nolint:errcheck
+}
+
+// onDirListInvalidatedEvent handles the cache invalidations generated
+// on the other cluster nodes
+func onDirListInvalidatedEvent(data []byte) {
+	var event dirListInvalidation
+	if err := json.Unmarshal(data, &event); err != nil {
+		logger.Warn(logSender, "", "unable to decode directory listings cache invalidation: %v", err)
+		return
+	}
+	if dirListCache == nil {
+		return
+	}
+	dirListCache.remove(event.UserID, event.VirtualPath, dirListFolder{
+		name: event.Folder,
+		path: event.FolderPath,
+	})
+}
+
+// onUserChanged removes the cached listings for an updated or deleted user
+func onUserChanged(userID int64) {
+	if dirListCache == nil {
+		return
+	}
+	dirListCache.removeUser(userID)
+}
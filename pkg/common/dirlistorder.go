@@ -0,0 +1,119 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"os"
+	"sort"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+)
+
+// DirListOrderConfig defines the order for FTP and WebDAV directory listings
+type DirListOrderConfig struct {
+	// Supported values: name_asc, name_desc, mtime_asc, mtime_desc, size_asc, size_desc.
+	// Empty means the order returned by the storage backend
+	Order string `json:"order" mapstructure:"order"`
+	// List the directories before the files
+	DirsFirst bool `json:"dirs_first" mapstructure:"dirs_first"`
+}
+
+// getDirListOrder returns the listing order to use for the connection's user
+func (c *BaseConnection) getDirListOrder() (string, bool) {
+	if c.User.Filters.DirListOrder != "" {
+		return c.User.Filters.DirListOrder, c.User.Filters.DirListDirsFirst
+	}
+	return Config.DirListOrder.Order, Config.DirListOrder.DirsFirst
+}
+
+// SortDirListing sorts, in place, the given directory entries
+// using the configured listing order
+func (c *BaseConnection) SortDirListing(files []os.FileInfo) {
+	order, dirsFirst := c.getDirListOrder()
+	sortDirListing(files, order, dirsFirst)
+}
+
+func sortDirListing(files []os.FileInfo, order string, dirsFirst bool) {
+	if order == "" && !dirsFirst {
+		return
+	}
+	compare := getDirListCompareFunc(order)
+	// the sort is stable so, if only dirsFirst is set, the order
+	// returned by the storage backend is preserved within each group
+	sort.SliceStable(files, func(i, j int) bool {
+		if dirsFirst && files[i].IsDir() != files[j].IsDir() {
+			return files[i].IsDir()
+		}
+		if compare == nil {
+			return false
+		}
+		return compare(files[i], files[j]) < 0
+	})
+}
+
+func compareDirEntryNames(a, b os.FileInfo) int {
+	if a.Name() < b.Name() {
+		return -1
+	}
+	if a.Name() > b.Name() {
+		return 1
+	}
+	return 0
+}
+
+func getDirListCompareFunc(order string) func(a, b os.FileInfo) int {
+	switch order {
+	case dataprovider.DirListOrderNameAsc:
+		return compareDirEntryNames
+	case dataprovider.DirListOrderNameDesc:
+		return func(a, b os.FileInfo) int {
+			return compareDirEntryNames(b, a)
+		}
+	case dataprovider.DirListOrderMtimeAsc, dataprovider.DirListOrderMtimeDesc:
+		return func(a, b os.FileInfo) int {
+			res := 0
+			if a.ModTime().Before(b.ModTime()) {
+				res = -1
+			} else if a.ModTime().After(b.ModTime()) {
+				res = 1
+			}
+			if order == dataprovider.DirListOrderMtimeDesc {
+				res = -res
+			}
+			if res == 0 {
+				return compareDirEntryNames(a, b)
+			}
+			return res
+		}
+	case dataprovider.DirListOrderSizeAsc, dataprovider.DirListOrderSizeDesc:
+		return func(a, b os.FileInfo) int {
+			res := 0
+			if a.Size() < b.Size() {
+				res = -1
+			} else if a.Size() > b.Size() {
+				res = 1
+			}
+			if order == dataprovider.DirListOrderSizeDesc {
+				res = -res
+			}
+			if res == 0 {
+				return compareDirEntryNames(a, b)
+			}
+			return res
+		}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"os"
+	"path"
+
+	"github.com/sftpgo/sdk"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+// PrefetchDirListings starts, in background, the pre-fetch of the directory
+// listings if enabled for the S3 filesystem of the connection's user.
+// The pre-fetch is best-effort: it stops silently if the cache is full,
+// if a listing fails or if the connection is closed
+func (c *BaseConnection) PrefetchDirListings() {
+	cache := dirListCache
+	if cache == nil {
+		return
+	}
+	if c.User.FsConfig.Provider != sdk.S3FilesystemProvider || !c.User.FsConfig.S3Config.PrefetchEnabled {
+		return
+	}
+	if !c.canPrefetchDir("/") {
+		return
+	}
+	// the filesystem is created here, the fs cache for the user is not safe for concurrent use
+	fs, err := c.User.GetFilesystemForPath("/", c.ID)
+	if err != nil {
+		return
+	}
+	go c.prefetchDirListings(cache, fs, c.User.FsConfig.S3Config.PrefetchDepth)
+}
+
+// prefetchDirListings lists, breadth-first, the top depth directory levels.
+// Virtual folders are not pre-fetched
+func (c *BaseConnection) prefetchDirListings(cache *dirListingCache, fs vfs.Fs, depth int) {
+	dirs := []string{"/"}
+	numListings := 0
+
+	for level := 1; level <= depth && len(dirs) > 0; level++ {
+		var subDirs []string
+		for _, dir := range dirs {
+			if !Connections.isActive(c.ID) || isShuttingDown.Load() {
+				c.Log(logger.LevelDebug, "directory listings pre-fetch stopped, the connection is closed")
+				return
+			}
+			entries, err := c.readDirForPrefetch(fs, dir)
+			if err != nil {
+				c.Log(logger.LevelDebug, "directory listings pre-fetch stopped, unable to list %q: %v", dir, err)
+				return
+			}
+			if !cache.addPrefetched(c.User.ID, dir, entries) {
+				c.Log(logger.LevelDebug, "directory listings pre-fetch stopped, the cache is full")
+				return
+			}
+			numListings++
+			if level == depth {
+				continue
+			}
+			for _, info := range entries {
+				if info.IsDir() && c.canPrefetchDir(path.Join(dir, info.Name())) {
+					subDirs = append(subDirs, path.Join(dir, info.Name()))
+				}
+			}
+		}
+		dirs = subDirs
+	}
+	c.Log(logger.LevelDebug, "directory listings pre-fetch completed, listed directories: %d", numListings)
+}
+
+func (c *BaseConnection) canPrefetchDir(virtualPath string) bool {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, virtualPath) {
+		return false
+	}
+	_, err := c.User.GetVirtualFolderForPath(c.User.ResolvePathAlias(virtualPath))
+	return err != nil
+}
+
+// readDirForPrefetch is like ListDir but it uses the given filesystem,
+// the listing is sorted as expected for the cached listings
+func (c *BaseConnection) readDirForPrefetch(fs vfs.Fs, virtualPath string) ([]os.FileInfo, error) {
+	fsPath, err := fs.ResolvePath(c.User.ResolvePathAlias(virtualPath))
+	if err != nil {
+		return nil, err
+	}
+	files, err := fs.ReadDir(fsPath)
+	if err != nil {
+		return nil, err
+	}
+	files = c.User.FilterListDir(files, virtualPath)
+	c.SortDirListing(files)
+	return files, nil
+}
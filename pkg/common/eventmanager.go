@@ -438,6 +438,7 @@ type EventParams struct {
 	ObjectType            string
 	FileSize              int64
 	Protocol              string
+	SFTPVersion           int
 	IP                    string
 	Timestamp             int64
 	Object                plugin.Renderer
@@ -609,6 +610,7 @@ func (p *EventParams) getStringReplacements(addObjectData bool) []string {
 		"{{ObjectType}}", p.ObjectType,
 		"{{FileSize}}", fmt.Sprintf("%d", p.FileSize),
 		"{{Protocol}}", p.Protocol,
+		"{{SFTPVersion}}", fmt.Sprintf("%d", p.SFTPVersion),
 		"{{IP}}", p.IP,
 		"{{Timestamp}}", fmt.Sprintf("%d", p.Timestamp),
 		"{{StatusString}}", p.getStatusString(),
@@ -701,7 +703,7 @@ func getFileWriter(conn *BaseConnection, virtualPath string) (io.WriteCloser, in
 
 	info, err := fs.Lstat(fsPath)
 	if err == nil {
-		fileSize = info.Size()
+		fileSize = vfs.GetQuotaSize(fs, fsPath, info.Size())
 		if info.IsDir() {
 			return nil, numFiles, truncatedSize, nil, fmt.Errorf("cannot write to a directory: %q", virtualPath)
 		}
@@ -1800,7 +1802,7 @@ func executeTransferQuotaResetRuleAction(conditions dataprovider.ConditionOption
 }
 
 func executeDataRetentionCheckForUser(user dataprovider.User, folders []dataprovider.FolderRetention,
-	params *EventParams, actionName string,
+	isPolicy bool, params *EventParams, actionName string,
 ) error {
 	if err := user.LoadAndApplyGroupSettings(); err != nil {
 		eventManagerLog(logger.LevelDebug, "skipping scheduled retention check for user %s, cannot apply group settings: %v",
@@ -1808,7 +1810,8 @@ func executeDataRetentionCheckForUser(user dataprovider.User, folders []dataprov
 		return err
 	}
 	check := RetentionCheck{
-		Folders: folders,
+		Folders:  folders,
+		isPolicy: isPolicy,
 	}
 	c := RetentionChecks.Add(check, &user)
 	if c == nil {
@@ -1852,8 +1855,17 @@ func executeDataRetentionCheckRuleAction(config dataprovider.EventActionDataRete
 				continue
 			}
 		}
+		folders := config.Folders
+		if config.UserPolicies {
+			if !user.Filters.DataRetentionPolicy.IsEnabled() {
+				eventManagerLog(logger.LevelDebug, "skipping scheduled retention check for user %s, no data retention policy",
+					user.Username)
+				continue
+			}
+			folders = user.Filters.DataRetentionPolicy.GetFolderRetentions()
+		}
 		executed++
-		if err = executeDataRetentionCheckForUser(user, config.Folders, params, actionName); err != nil {
+		if err = executeDataRetentionCheckForUser(user, folders, config.UserPolicies, params, actionName); err != nil {
 			failedChecks = append(failedChecks, user.Username)
 			params.AddError(err)
 			continue
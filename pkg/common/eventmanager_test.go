@@ -364,7 +364,7 @@ func TestEventManagerErrors(t *testing.T) {
 				Type: sdk.GroupTypePrimary,
 			},
 		},
-	}, nil, &EventParams{}, "")
+	}, nil, false, &EventParams{}, "")
 	assert.Error(t, err)
 	err = executeDeleteFsActionForUser(nil, nil, dataprovider.User{
 		Groups: []sdk.GroupMapping{
@@ -0,0 +1,366 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+const (
+	auditLogRotatedTimeFormat = "20060102T150405.000"
+	auditLogCompressedExt     = ".gz"
+	auditLogCompressTmpExt    = ".gz.tmp"
+)
+
+var folderAuditLogs = newFolderAuditLogManager()
+
+// FolderAuditLogFile defines the metadata for a folder audit log file
+type FolderAuditLogFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Last modification time as unix timestamp in milliseconds
+	LastModified int64 `json:"last_modified"`
+	Lines        int64 `json:"lines"`
+}
+
+type folderAuditLogEntry struct {
+	Timestamp         string `json:"timestamp"`
+	Folder            string `json:"folder"`
+	Action            string `json:"action"`
+	Username          string `json:"username"`
+	VirtualPath       string `json:"virtual_path"`
+	VirtualTargetPath string `json:"virtual_target_path,omitempty"`
+	SSHCmd            string `json:"ssh_cmd,omitempty"`
+	FileSize          int64  `json:"file_size,omitempty"`
+	Protocol          string `json:"protocol"`
+	IP                string `json:"ip"`
+	SessionID         string `json:"session_id"`
+	Status            int    `json:"status"`
+	Error             string `json:"error,omitempty"`
+}
+
+// folderAuditLogWriter writes to a folder audit log file, the mutex
+// serializes the writes and the rotations for the file
+type folderAuditLogWriter struct {
+	sync.Mutex
+	path      string
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+	// optional header written at the beginning of each new log file
+	header func(now time.Time) []byte
+}
+
+func (w *folderAuditLogWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.lastWrite = info.ModTime()
+	if w.size == 0 {
+		w.lastWrite = time.Now()
+	}
+	return nil
+}
+
+func (w *folderAuditLogWriter) needsRotation(config *vfs.FolderAuditLog, now time.Time, size int) bool {
+	if w.size == 0 {
+		return false
+	}
+	switch config.RotatePolicy {
+	case vfs.AuditLogRotateSize:
+		return w.size+int64(size) > int64(config.MaxSize)*1048576
+	case vfs.AuditLogRotateWeekly:
+		lastYear, lastWeek := w.lastWrite.ISOWeek()
+		year, week := now.ISOWeek()
+		return lastYear != year || lastWeek != week
+	default:
+		return w.lastWrite.Format("2006-01-02") != now.Format("2006-01-02")
+	}
+}
+
+// rotate atomically renames the current log file and compresses it in background
+func (w *folderAuditLogWriter) rotate(now time.Time, wg *sync.WaitGroup) error {
+	if err := w.file.Close(); err != nil {
+		logger.Warn(logSender, "", "unable to close audit log file %q: %v", w.path, err)
+	}
+	w.file = nil
+	rotatedPath := fmt.Sprintf("%s-%s", w.path, now.Format(auditLogRotatedTimeFormat))
+	if err := os.Rename(w.path, rotatedPath); err != nil {
+		return err
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := compressAuditLogFile(rotatedPath); err != nil {
+			logger.Warn(logSender, "", "unable to compress audit log file %q: %v", rotatedPath, err)
+		}
+	}()
+	return w.open()
+}
+
+func (w *folderAuditLogWriter) write(config *vfs.FolderAuditLog, line []byte, wg *sync.WaitGroup) error {
+	w.Lock()
+	defer w.Unlock()
+
+	now := time.Now()
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.needsRotation(config, now, len(line)) {
+		if err := w.rotate(now, wg); err != nil {
+			return err
+		}
+	}
+	if w.size == 0 && w.header != nil {
+		line = append(w.header(now), line...)
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	w.lastWrite = now
+	return err
+}
+
+type folderAuditLogManager struct {
+	sync.Mutex
+	writers map[string]*folderAuditLogWriter
+	// tracks the background compressions
+	compressWg sync.WaitGroup
+}
+
+func newFolderAuditLogManager() *folderAuditLogManager {
+	return &folderAuditLogManager{
+		writers: make(map[string]*folderAuditLogWriter),
+	}
+}
+
+func (m *folderAuditLogManager) getWriter(logPath string) *folderAuditLogWriter {
+	m.Lock()
+	defer m.Unlock()
+
+	w, ok := m.writers[logPath]
+	if !ok {
+		w = &folderAuditLogWriter{path: logPath}
+		m.writers[logPath] = w
+	}
+	return w
+}
+
+func (m *folderAuditLogManager) write(dir string, config *vfs.FolderAuditLog, entry *folderAuditLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	return m.getWriter(filepath.Join(dir, config.LogFile)).write(config, line, &m.compressWg)
+}
+
+// closeAll closes the open log files and waits for the pending compressions
+func (m *folderAuditLogManager) closeAll() {
+	m.Lock()
+	for logPath, w := range m.writers {
+		w.Lock()
+		if w.file != nil {
+			w.file.Close()
+			w.file = nil
+		}
+		w.Unlock()
+		delete(m.writers, logPath)
+	}
+	m.Unlock()
+
+	m.compressWg.Wait()
+}
+
+// compressAuditLogFile compresses the specified file using gzip and removes the
+// uncompressed one. The compressed file is written to a temporary path and then
+// atomically renamed
+func compressAuditLogFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := name + auditLogCompressTmpExt
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	gzWriter := gzip.NewWriter(dst)
+	_, err = io.Copy(gzWriter, src)
+	if err == nil {
+		err = gzWriter.Close()
+	}
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, name+auditLogCompressedExt)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+// logFolderAuditEvent writes the specified event to the audit logs configured
+// for the virtual folders that contain the source and the target path
+func logFolderAuditEvent(conn *BaseConnection, operation, virtualPath, virtualTarget, sshCmd string, fileSize int64,
+	err error,
+) {
+	if Config.FolderAuditLogsPath == "" || operation == operationFirstUpload || operation == operationFirstDownload {
+		return
+	}
+	var folderNames []string
+	for _, p := range []string{virtualPath, virtualTarget} {
+		if p == "" {
+			continue
+		}
+		folder, errFolder := conn.User.GetVirtualFolderForPath(p)
+		if errFolder != nil || !folder.AuditLog.IsEnabled() || util.Contains(folderNames, folder.Name) {
+			continue
+		}
+		folderNames = append(folderNames, folder.Name)
+		entry := &folderAuditLogEntry{
+			Timestamp:         time.Now().UTC().Format(time.RFC3339Nano),
+			Folder:            folder.Name,
+			Action:            operation,
+			Username:          conn.User.Username,
+			VirtualPath:       virtualPath,
+			VirtualTargetPath: virtualTarget,
+			SSHCmd:            sshCmd,
+			FileSize:          fileSize,
+			Protocol:          conn.protocol,
+			IP:                conn.GetRemoteIP(),
+			SessionID:         conn.ID,
+			Status:            getNotificationStatus(err),
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if errWrite := folderAuditLogs.write(Config.FolderAuditLogsPath, &folder.AuditLog, entry); errWrite != nil {
+			conn.Log(logger.LevelError, "unable to write audit log for folder %q: %v", folder.Name, errWrite)
+		}
+	}
+}
+
+// GetFolderAuditLogs returns the metadata for the audit log files, including the
+// rotated ones, of the specified virtual folder
+func GetFolderAuditLogs(folder *vfs.BaseVirtualFolder) ([]FolderAuditLogFile, error) {
+	if Config.FolderAuditLogsPath == "" {
+		return nil, util.NewMethodDisabledError("folder audit logs are disabled")
+	}
+	if !folder.AuditLog.IsEnabled() {
+		return nil, util.NewValidationError(fmt.Sprintf("audit log is not enabled for folder %q", folder.Name))
+	}
+	entries, err := os.ReadDir(Config.FolderAuditLogsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result []FolderAuditLogFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, auditLogCompressTmpExt) {
+			continue
+		}
+		if name != folder.AuditLog.LogFile && !strings.HasPrefix(name, folder.AuditLog.LogFile+"-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		lines, err := countAuditLogLines(filepath.Join(Config.FolderAuditLogsPath, name))
+		if err != nil {
+			logger.Warn(logSender, "", "unable to count the lines for audit log file %q: %v", name, err)
+		}
+		result = append(result, FolderAuditLogFile{
+			Name:         name,
+			Size:         info.Size(),
+			LastModified: util.GetTimeAsMsSinceEpoch(info.ModTime()),
+			Lines:        lines,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func countAuditLogLines(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, auditLogCompressedExt) {
+		gzReader, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		defer gzReader.Close()
+
+		r = gzReader
+	}
+	var lines int64
+	buf := make([]byte, 32*1024)
+	reader := bufio.NewReader(r)
+	for {
+		n, err := reader.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+func TestFolderAuditLogValidation(t *testing.T) {
+	config := vfs.FolderAuditLog{
+		RotatePolicy: vfs.AuditLogRotateSize,
+		MaxSize:      10,
+	}
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, vfs.FolderAuditLog{}, config)
+
+	config.LogFile = "audit.log"
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, vfs.AuditLogRotateDaily, config.RotatePolicy)
+	config.RotatePolicy = vfs.AuditLogRotateSize
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, 100, config.MaxSize)
+	config.MaxSize = -1
+	assert.Error(t, config.Validate())
+	config.RotatePolicy = "monthly"
+	assert.Error(t, config.Validate())
+	for _, name := range []string{".", "..", "../audit.log", "dir/audit.log", `dir\audit.log`} {
+		config := vfs.FolderAuditLog{
+			LogFile: name,
+		}
+		assert.Error(t, config.Validate(), name)
+	}
+}
+
+func TestFolderAuditLogEvents(t *testing.T) {
+	logsPath := Config.FolderAuditLogsPath
+	Config.FolderAuditLogsPath = t.TempDir()
+	defer func() {
+		folderAuditLogs.closeAll()
+		Config.FolderAuditLogsPath = logsPath
+	}()
+
+	folder := vfs.BaseVirtualFolder{
+		Name:       "auditfolder",
+		MappedPath: filepath.Join(os.TempDir(), "auditfolder"),
+		AuditLog: vfs.FolderAuditLog{
+			LogFile:      "auditfolder.log",
+			RotatePolicy: vfs.AuditLogRotateDaily,
+		},
+	}
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: userTestUsername,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Clean(os.TempDir()),
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: folder,
+				VirtualPath:       "/vdir",
+			},
+		},
+	}
+	conn := NewBaseConnection("connid", ProtocolSFTP, "", "127.0.0.1:2222", user)
+
+	err := ExecuteActionNotification(conn, operationUpload, "", "/vdir/file", "", "", "", 123, nil)
+	assert.NoError(t, err)
+	// outside the virtual folder
+	err = ExecuteActionNotification(conn, operationDownload, "", "/file", "", "", "", 123, nil)
+	assert.NoError(t, err)
+	err = ExecuteActionNotification(conn, operationFirstUpload, "", "/vdir/file", "", "", "", 123, nil)
+	assert.NoError(t, err)
+	err = ExecuteActionNotification(conn, operationRename, "", "/file", "", "/vdir/file1", "", 0,
+		errors.New("rename error"))
+	assert.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(Config.FolderAuditLogsPath, folder.AuditLog.LogFile))
+	require.NoError(t, err)
+	var entries []folderAuditLogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry folderAuditLogEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		assert.NoError(t, err)
+		entries = append(entries, entry)
+	}
+	err = file.Close()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, operationUpload, entries[0].Action)
+		assert.Equal(t, folder.Name, entries[0].Folder)
+		assert.Equal(t, user.Username, entries[0].Username)
+		assert.Equal(t, "/vdir/file", entries[0].VirtualPath)
+		assert.Equal(t, int64(123), entries[0].FileSize)
+		assert.Equal(t, ProtocolSFTP, entries[0].Protocol)
+		assert.Equal(t, "127.0.0.1", entries[0].IP)
+		assert.Equal(t, 1, entries[0].Status)
+		assert.Empty(t, entries[0].Error)
+		assert.Equal(t, operationRename, entries[1].Action)
+		assert.Equal(t, "/vdir/file1", entries[1].VirtualTargetPath)
+		assert.Equal(t, 2, entries[1].Status)
+		assert.Equal(t, "rename error", entries[1].Error)
+	}
+
+	files, err := GetFolderAuditLogs(&folder)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, folder.AuditLog.LogFile, files[0].Name)
+		assert.Equal(t, int64(2), files[0].Lines)
+		assert.Greater(t, files[0].Size, int64(0))
+		assert.Greater(t, files[0].LastModified, int64(0))
+	}
+	_, err = GetFolderAuditLogs(&vfs.BaseVirtualFolder{Name: "missing"})
+	assert.Error(t, err)
+
+	Config.FolderAuditLogsPath = ""
+	_, err = GetFolderAuditLogs(&folder)
+	assert.Error(t, err)
+}
+
+func TestFolderAuditLogRotation(t *testing.T) {
+	logsPath := Config.FolderAuditLogsPath
+	Config.FolderAuditLogsPath = t.TempDir()
+	defer func() {
+		folderAuditLogs.closeAll()
+		Config.FolderAuditLogsPath = logsPath
+	}()
+
+	folder := vfs.BaseVirtualFolder{
+		Name: "rotatefolder",
+		AuditLog: vfs.FolderAuditLog{
+			LogFile:      "rotate.log",
+			RotatePolicy: vfs.AuditLogRotateDaily,
+		},
+	}
+	entry := &folderAuditLogEntry{
+		Folder: folder.Name,
+		Action: operationDownload,
+	}
+	err := folderAuditLogs.write(Config.FolderAuditLogsPath, &folder.AuditLog, entry)
+	assert.NoError(t, err)
+	err = folderAuditLogs.write(Config.FolderAuditLogsPath, &folder.AuditLog, entry)
+	assert.NoError(t, err)
+	// simulate a write on the previous day
+	writer := folderAuditLogs.getWriter(filepath.Join(Config.FolderAuditLogsPath, folder.AuditLog.LogFile))
+	writer.lastWrite = time.Now().Add(-24 * time.Hour)
+	err = folderAuditLogs.write(Config.FolderAuditLogsPath, &folder.AuditLog, entry)
+	assert.NoError(t, err)
+	folderAuditLogs.compressWg.Wait()
+
+	files, err := GetFolderAuditLogs(&folder)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.Equal(t, folder.AuditLog.LogFile, files[0].Name)
+		assert.Equal(t, int64(1), files[0].Lines)
+		assert.True(t, strings.HasPrefix(files[1].Name, folder.AuditLog.LogFile+"-"))
+		assert.True(t, strings.HasSuffix(files[1].Name, auditLogCompressedExt))
+		assert.Equal(t, int64(2), files[1].Lines)
+	}
+
+	writer.lastWrite = time.Now().Add(-7 * 24 * time.Hour)
+	assert.True(t, writer.needsRotation(&vfs.FolderAuditLog{RotatePolicy: vfs.AuditLogRotateWeekly}, time.Now(), 1))
+	writer.lastWrite = time.Now()
+	assert.False(t, writer.needsRotation(&vfs.FolderAuditLog{RotatePolicy: vfs.AuditLogRotateWeekly}, time.Now(), 1))
+	sizeConfig := &vfs.FolderAuditLog{RotatePolicy: vfs.AuditLogRotateSize, MaxSize: 1}
+	assert.False(t, writer.needsRotation(sizeConfig, time.Now(), 1))
+	assert.True(t, writer.needsRotation(sizeConfig, time.Now(), 1048576))
+
+	err = compressAuditLogFile(filepath.Join(Config.FolderAuditLogsPath, "missing"))
+	assert.Error(t, err)
+}
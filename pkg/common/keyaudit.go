@@ -0,0 +1,92 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+)
+
+const (
+	keyAuditLogSender = "keyaudit"
+	keyAuditPageSize  = 100
+)
+
+// auditPublicKeys checks the public keys for all the users and notifies
+// the users with flagged keys
+func auditPublicKeys() {
+	if !dataprovider.IsPublicKeysAuditEnabled() {
+		return
+	}
+	startTime := time.Now()
+	numFlaggedUsers := 0
+	for offset := 0; ; offset += keyAuditPageSize {
+		users, err := dataprovider.GetUsers(keyAuditPageSize, offset, dataprovider.OrderASC)
+		if err != nil {
+			logger.Error(keyAuditLogSender, "", "unable to get users: %v", err)
+			return
+		}
+		for idx := range users {
+			if auditUserPublicKeys(&users[idx]) {
+				numFlaggedUsers++
+			}
+		}
+		if len(users) < keyAuditPageSize {
+			break
+		}
+	}
+	logger.Info(keyAuditLogSender, "", "public keys audit completed, users with flagged keys: %d, elapsed: %s",
+		numFlaggedUsers, time.Since(startTime))
+}
+
+// auditUserPublicKeys returns true if the user has flagged keys
+func auditUserPublicKeys(user *dataprovider.User) bool {
+	if len(user.PublicKeys) == 0 {
+		return false
+	}
+	var flagged []string
+	for _, result := range user.AuditPublicKeys() {
+		if len(result.Warnings) == 0 {
+			continue
+		}
+		logger.Warn(keyAuditLogSender, "", "flagged public key %q for user %q: %s", result.Fingerprint,
+			user.Username, strings.Join(result.Warnings, ", "))
+		keyInfo := fmt.Sprintf("%s %s", result.Type, result.Fingerprint)
+		if result.Comment != "" {
+			keyInfo += fmt.Sprintf(" (%s)", result.Comment)
+		}
+		flagged = append(flagged, fmt.Sprintf("- %s: %s", keyInfo, strings.Join(result.Warnings, ", ")))
+	}
+	if len(flagged) == 0 {
+		return false
+	}
+	if smtp.IsEnabled() && user.Email != "" && user.Status == 1 {
+		body := fmt.Sprintf("Hello %s,\n\nthe following SSH public keys associated with your account should be "+
+			"replaced:\n\n%s\n", user.Username, strings.Join(flagged, "\n"))
+		err := smtp.SendEmail([]string{user.Email}, "SFTPGo - SSH public keys review required", body,
+			smtp.EmailContentTypeTextPlain)
+		if err != nil {
+			logger.Warn(keyAuditLogSender, "", "unable to notify user %q about flagged public keys: %v", user.Username, err)
+		} else {
+			logger.Debug(keyAuditLogSender, "", "user %q notified about %d flagged public keys", user.Username, len(flagged))
+		}
+	}
+	return true
+}
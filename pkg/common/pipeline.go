@@ -0,0 +1,551 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/sftpgo/sdk/plugin/notifier"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported pipeline step types
+const (
+	PipelineStepExec = "exec"
+	PipelineStepHTTP = "http"
+	PipelineStepLog  = "log"
+	PipelineStepMove = "move"
+	PipelineStepCopy = "copy"
+)
+
+// Supported actions on pipeline step failure
+const (
+	PipelineOnFailureAbort  = "abort"
+	PipelineOnFailureWarn   = "warn"
+	PipelineOnFailureIgnore = "ignore"
+)
+
+// Pipeline run and step states
+const (
+	pipelineStateRunning   = "running"
+	pipelineStateCompleted = "completed"
+	pipelineStateAborted   = "aborted"
+	pipelineStateSkipped   = "skipped"
+	pipelineStateFailed    = "failed"
+)
+
+const (
+	defaultPipelineStepTimeout = 30
+	maxPipelineContextSize     = 1048576
+)
+
+var (
+	validPipelineStepTypes = []string{PipelineStepExec, PipelineStepHTTP, PipelineStepLog, PipelineStepMove,
+		PipelineStepCopy}
+	validPipelineOnFailure = []string{PipelineOnFailureAbort, PipelineOnFailureWarn, PipelineOnFailureIgnore}
+	errPipelineStepTimeout = errors.New("pipeline step timed out")
+	activePipelines        = newPipelineRunsTracker()
+)
+
+// PipelineStep defines a step of the pipeline executed after successful uploads.
+// The steps are executed sequentially and can share data using a JSON context
+type PipelineStep struct {
+	// Step name, used in logs and to identify the step result in the pipeline context
+	Name string `json:"name" mapstructure:"name"`
+	// Step type: exec, http, log, move, copy
+	Type string `json:"type" mapstructure:"type"`
+	// Absolute path to the command for exec steps, URL for http steps, virtual target path
+	// for move and copy steps. Placeholders are supported
+	Target string `json:"target" mapstructure:"target"`
+	// Shell like patterns to match the uploaded file name. Empty means any file
+	FilePatterns []string `json:"file_patterns" mapstructure:"file_patterns"`
+	// Shell like patterns to match the username. Empty means any user
+	Users []string `json:"users" mapstructure:"users"`
+	// Action on failure: abort, warn or ignore. Abort skips the remaining steps
+	// and deletes the uploaded file
+	OnFailure string `json:"on_failure" mapstructure:"on_failure"`
+	// Step timeout in seconds
+	Timeout int `json:"timeout" mapstructure:"timeout"`
+}
+
+func (s *PipelineStep) validate(idx int) error {
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("step%d", idx+1)
+	}
+	if !util.Contains(validPipelineStepTypes, s.Type) {
+		return fmt.Errorf("pipeline step %q: invalid type %q", s.Name, s.Type)
+	}
+	switch s.Type {
+	case PipelineStepExec:
+		if !filepath.IsAbs(s.Target) {
+			return fmt.Errorf("pipeline step %q: invalid command %q, it must be an absolute path", s.Name, s.Target)
+		}
+	case PipelineStepHTTP:
+		if !strings.HasPrefix(s.Target, "http://") && !strings.HasPrefix(s.Target, "https://") {
+			return fmt.Errorf("pipeline step %q: invalid URL %q", s.Name, s.Target)
+		}
+	case PipelineStepMove, PipelineStepCopy:
+		if s.Target == "" {
+			return fmt.Errorf("pipeline step %q: target path is required", s.Name)
+		}
+	}
+	if s.OnFailure == "" {
+		s.OnFailure = PipelineOnFailureWarn
+	}
+	if !util.Contains(validPipelineOnFailure, s.OnFailure) {
+		return fmt.Errorf("pipeline step %q: invalid failure action %q", s.Name, s.OnFailure)
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("pipeline step %q: invalid timeout %d", s.Name, s.Timeout)
+	}
+	if s.Timeout == 0 {
+		s.Timeout = defaultPipelineStepTimeout
+	}
+	for _, patterns := range [][]string{s.FilePatterns, s.Users} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("pipeline step %q: invalid pattern %q", s.Name, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *PipelineStep) matches(username, virtualPath string) bool {
+	if len(s.Users) > 0 && !matchPipelinePatterns(s.Users, username) {
+		return false
+	}
+	if len(s.FilePatterns) > 0 && !matchPipelinePatterns(s.FilePatterns, strings.ToLower(path.Base(virtualPath))) {
+		return false
+	}
+	return true
+}
+
+func matchPipelinePatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePipeline(steps []PipelineStep) error {
+	names := make(map[string]bool)
+	for idx := range steps {
+		if err := steps[idx].validate(idx); err != nil {
+			return err
+		}
+		if names[steps[idx].Name] {
+			return fmt.Errorf("pipeline step %q: duplicated name", steps[idx].Name)
+		}
+		names[steps[idx].Name] = true
+	}
+	return nil
+}
+
+// pipelineStepState tracks the execution of a pipeline step
+type pipelineStepState struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Error   string `json:"error,omitempty"`
+	Elapsed int64  `json:"elapsed"`
+}
+
+// pipelineRun tracks a pipeline execution
+type pipelineRun struct {
+	ID          string              `json:"id"`
+	Username    string              `json:"username"`
+	VirtualPath string              `json:"virtual_path"`
+	StartedAt   int64               `json:"started_at"`
+	State       string              `json:"state"`
+	Steps       []pipelineStepState `json:"steps"`
+}
+
+type pipelineRunsTracker struct {
+	mu   sync.RWMutex
+	runs map[string]pipelineRun
+}
+
+func newPipelineRunsTracker() *pipelineRunsTracker {
+	return &pipelineRunsTracker{
+		runs: make(map[string]pipelineRun),
+	}
+}
+
+func (t *pipelineRunsTracker) update(run pipelineRun) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run.Steps = append([]pipelineStepState(nil), run.Steps...)
+	t.runs[run.ID] = run
+}
+
+func (t *pipelineRunsTracker) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.runs, id)
+}
+
+func (t *pipelineRunsTracker) get() []pipelineRun {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	runs := make([]pipelineRun, 0, len(t.runs))
+	for _, run := range t.runs {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+func hasPipeline(operation string, err error) bool {
+	return operation == operationUpload && err == nil && len(Config.Actions.Pipeline) > 0
+}
+
+// pipelineExecutor executes the configured pipeline steps for an uploaded file
+type pipelineExecutor struct {
+	run   pipelineRun
+	event notifier.FsEvent
+	// shared JSON context, each step can add data for the next steps
+	data   map[string]any
+	conn   *BaseConnection
+	isSync bool
+}
+
+func executePipeline(event notifier.FsEvent, isSync bool) error {
+	e := &pipelineExecutor{
+		run: pipelineRun{
+			ID:          xid.New().String(),
+			Username:    event.Username,
+			VirtualPath: event.VirtualPath,
+			StartedAt:   util.GetTimeAsMsSinceEpoch(time.Now()),
+			State:       pipelineStateRunning,
+		},
+		event:  event,
+		data:   make(map[string]any),
+		isSync: isSync,
+	}
+	defer func() {
+		if e.conn != nil {
+			e.conn.User.CloseFs() //nolint:errcheck
+		}
+	}()
+	return e.execute(Config.Actions.Pipeline)
+}
+
+func (e *pipelineExecutor) execute(steps []PipelineStep) error {
+	defer activePipelines.remove(e.run.ID)
+
+	e.data["pipeline_id"] = e.run.ID
+	e.data["steps"] = make(map[string]any)
+	var errRes error
+	for idx := range steps {
+		step := &steps[idx]
+		if errRes != nil || !step.matches(e.event.Username, e.event.VirtualPath) {
+			e.run.Steps = append(e.run.Steps, pipelineStepState{Name: step.Name, State: pipelineStateSkipped})
+			continue
+		}
+		e.run.Steps = append(e.run.Steps, pipelineStepState{Name: step.Name, State: pipelineStateRunning})
+		activePipelines.update(e.run)
+
+		startTime := time.Now()
+		err := e.executeStepWithTimeout(step)
+		state := &e.run.Steps[len(e.run.Steps)-1]
+		state.Elapsed = time.Since(startTime).Milliseconds()
+		state.State = pipelineStateCompleted
+		if err != nil {
+			state.State = pipelineStateFailed
+			state.Error = err.Error()
+		}
+		activePipelines.update(e.run)
+		if err == nil {
+			logger.Debug(logSender, "", "pipeline %q, step %q completed for user %q, path %q, elapsed: %d ms",
+				e.run.ID, step.Name, e.event.Username, e.event.VirtualPath, state.Elapsed)
+			continue
+		}
+		switch step.OnFailure {
+		case PipelineOnFailureAbort:
+			logger.Warn(logSender, "", "pipeline %q, step %q failed for user %q, path %q, aborting: %v",
+				e.run.ID, step.Name, e.event.Username, e.event.VirtualPath, err)
+			errRes = fmt.Errorf("pipeline step %q failed: %w", step.Name, err)
+		case PipelineOnFailureWarn:
+			logger.Warn(logSender, "", "pipeline %q, step %q failed for user %q, path %q: %v",
+				e.run.ID, step.Name, e.event.Username, e.event.VirtualPath, err)
+		default:
+			logger.Debug(logSender, "", "pipeline %q, step %q failed for user %q, path %q, error ignored: %v",
+				e.run.ID, step.Name, e.event.Username, e.event.VirtualPath, err)
+		}
+	}
+	e.run.State = pipelineStateCompleted
+	if errRes != nil {
+		e.run.State = pipelineStateAborted
+		// for synchronous pipelines the transfer removes the uploaded file and
+		// updates the quota, we only need to remove the file if it was moved
+		if !e.isSync || e.event.VirtualPath != e.run.VirtualPath {
+			if err := e.deleteFile(); err != nil {
+				logger.Warn(logSender, "", "pipeline %q aborted, unable to delete %q for user %q: %v",
+					e.run.ID, e.event.VirtualPath, e.event.Username, err)
+			}
+		}
+	}
+	summary, _ := json.Marshal(e.run)
+	logger.Info(logSender, "", "pipeline %q %s: %s", e.run.ID, e.run.State, summary)
+	return errRes
+}
+
+// pipelineStepInput is a snapshot of the pipeline state, a step that times out
+// keeps running in background so it must not access the executor
+type pipelineStepInput struct {
+	runID    string
+	event    notifier.FsEvent
+	data     []byte
+	conn     *BaseConnection
+	replacer *strings.Replacer
+}
+
+type pipelineStepResult struct {
+	data    map[string]any
+	movedTo string
+	err     error
+}
+
+func (e *pipelineExecutor) executeStepWithTimeout(step *PipelineStep) error {
+	data, err := json.Marshal(e.data)
+	if err != nil {
+		return err
+	}
+	input := pipelineStepInput{
+		runID:    e.run.ID,
+		event:    e.event,
+		data:     data,
+		replacer: e.getReplacer(),
+	}
+	if step.Type == PipelineStepMove || step.Type == PipelineStepCopy {
+		input.conn, err = e.getConnection()
+		if err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(step.Timeout)*time.Second)
+	defer cancel()
+
+	resCh := make(chan pipelineStepResult, 1)
+	go func() {
+		resCh <- executePipelineStep(ctx, step, input)
+	}()
+
+	select {
+	case res := <-resCh:
+		if res.err != nil {
+			return res.err
+		}
+		e.data["steps"].(map[string]any)[step.Name] = res.data
+		for k, v := range res.data {
+			if k != "pipeline_id" && k != "steps" {
+				e.data[k] = v
+			}
+		}
+		if res.movedTo != "" {
+			// the next steps will process the moved file
+			e.event.VirtualPath = res.movedTo
+			if _, fsPath, err := e.conn.GetFsAndResolvedPath(res.movedTo); err == nil {
+				e.event.Path = fsPath
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		return errPipelineStepTimeout
+	}
+}
+
+func (e *pipelineExecutor) getReplacer() *strings.Replacer {
+	params := EventParams{
+		Name:        e.event.Username,
+		Event:       e.event.Action,
+		Status:      e.event.Status,
+		VirtualPath: e.event.VirtualPath,
+		FsPath:      e.event.Path,
+		ObjectName:  path.Base(e.event.VirtualPath),
+		FileSize:    e.event.FileSize,
+		Protocol:    e.event.Protocol,
+		IP:          e.event.IP,
+		Timestamp:   e.event.Timestamp,
+	}
+	return strings.NewReplacer(params.getStringReplacements(false)...)
+}
+
+func (e *pipelineExecutor) getConnection() (*BaseConnection, error) {
+	if e.conn != nil {
+		return e.conn, nil
+	}
+	user, err := dataprovider.UserExists(e.event.Username)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user %q: %w", e.event.Username, err)
+	}
+	user, err = getUserForEventAction(user)
+	if err != nil {
+		return nil, err
+	}
+	connectionID := fmt.Sprintf("%s_%s", protocolEventAction, xid.New().String())
+	if err := user.CheckFsRoot(connectionID); err != nil {
+		user.CloseFs() //nolint:errcheck
+		return nil, fmt.Errorf("unable to check root fs for user %q: %w", user.Username, err)
+	}
+	e.conn = NewBaseConnection(connectionID, protocolEventAction, "", "", user)
+	return e.conn, nil
+}
+
+func executePipelineStep(ctx context.Context, step *PipelineStep, input pipelineStepInput) pipelineStepResult {
+	switch step.Type {
+	case PipelineStepExec:
+		data, err := executePipelineCommand(ctx, step, input)
+		return pipelineStepResult{data: data, err: err}
+	case PipelineStepHTTP:
+		data, err := executePipelineHTTP(ctx, step, input)
+		return pipelineStepResult{data: data, err: err}
+	case PipelineStepMove, PipelineStepCopy:
+		return executePipelineFsStep(step, input)
+	default:
+		logger.Info(logSender, "", "pipeline %q, step %q, user %q, path %q, size: %d, protocol: %s, context: %s",
+			input.runID, step.Name, input.event.Username, input.event.VirtualPath, input.event.FileSize,
+			input.event.Protocol, input.data)
+		return pipelineStepResult{}
+	}
+}
+
+func executePipelineCommand(ctx context.Context, step *PipelineStep, input pipelineStepInput) (map[string]any, error) {
+	cmd := exec.CommandContext(ctx, replaceWithReplacer(step.Target, input.replacer))
+	cmd.Env = append(notificationAsEnvVars(&input.event),
+		fmt.Sprintf("SFTPGO_PIPELINE_ID=%s", input.runID),
+		fmt.Sprintf("SFTPGO_PIPELINE_STEP=%s", step.Name),
+		fmt.Sprintf("SFTPGO_PIPELINE_CONTEXT=%s", input.data))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	startTime := time.Now()
+	err := cmd.Run()
+	logger.Debug(logSender, "", "pipeline %q, step %q, executed command %q, elapsed: %s, error: %v",
+		input.runID, step.Name, step.Target, time.Since(startTime), err)
+	if err != nil {
+		return nil, err
+	}
+	return getPipelineStepOutput(stdout.Bytes()), nil
+}
+
+func executePipelineHTTP(ctx context.Context, step *PipelineStep, input pipelineStepInput) (map[string]any, error) {
+	body, err := json.Marshal(map[string]any{
+		"pipeline_id": input.runID,
+		"step":        step.Name,
+		"event":       input.event,
+		"context":     json.RawMessage(input.data),
+	})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := replaceWithReplacer(step.Target, input.replacer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := httpclient.GetHTTPClient()
+	defer client.CloseIdleConnections()
+
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	logger.Debug(logSender, "", "pipeline %q, step %q, HTTP request sent, elapsed: %s, status code: %d",
+		input.runID, step.Name, time.Since(startTime), resp.StatusCode)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusNoContent {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxPipelineContextSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return getPipelineStepOutput(respBody), nil
+}
+
+// getPipelineStepOutput returns the step output if it is a JSON object, nil otherwise
+func getPipelineStepOutput(output []byte) map[string]any {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 || len(output) > maxPipelineContextSize {
+		return nil
+	}
+	var data map[string]any
+	if err := json.Unmarshal(output, &data); err != nil {
+		return nil
+	}
+	return data
+}
+
+func executePipelineFsStep(step *PipelineStep, input pipelineStepInput) pipelineStepResult {
+	source := input.event.VirtualPath
+	target := util.CleanPath(replaceWithReplacer(step.Target, input.replacer))
+	if strings.HasSuffix(step.Target, "/") {
+		target = path.Join(target, path.Base(source))
+	}
+	if err := input.conn.CheckParentDirs(path.Dir(target)); err != nil {
+		return pipelineStepResult{err: err}
+	}
+	if step.Type == PipelineStepCopy {
+		if err := input.conn.CopyFile(source, target); err != nil {
+			return pipelineStepResult{err: fmt.Errorf("unable to copy %q->%q: %w", source, target, err)}
+		}
+		return pipelineStepResult{data: map[string]any{"copied_to": target}}
+	}
+	if err := input.conn.Rename(source, target); err != nil {
+		return pipelineStepResult{err: fmt.Errorf("unable to move %q->%q: %w", source, target, err)}
+	}
+	return pipelineStepResult{data: map[string]any{"moved_to": target}, movedTo: target}
+}
+
+func (e *pipelineExecutor) deleteFile() error {
+	conn, err := e.getConnection()
+	if err != nil {
+		return err
+	}
+	fs, fsPath, err := conn.GetFsAndResolvedPath(e.event.VirtualPath)
+	if err != nil {
+		return err
+	}
+	info, err := fs.Lstat(fsPath)
+	if err != nil {
+		return err
+	}
+	return conn.RemoveFile(fs, fsPath, e.event.VirtualPath, info)
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+)
+
+func TestPipelineValidation(t *testing.T) {
+	steps := []PipelineStep{
+		{
+			Type: "unknown",
+		},
+	}
+	assert.Error(t, validatePipeline(steps))
+	steps[0].Type = PipelineStepExec
+	steps[0].Target = "relative"
+	assert.Error(t, validatePipeline(steps))
+	steps[0].Type = PipelineStepHTTP
+	assert.Error(t, validatePipeline(steps))
+	steps[0].Type = PipelineStepMove
+	steps[0].Target = ""
+	assert.Error(t, validatePipeline(steps))
+	steps[0].Target = "/target/"
+	steps[0].OnFailure = "stop"
+	assert.Error(t, validatePipeline(steps))
+	steps[0].OnFailure = ""
+	steps[0].Timeout = -1
+	assert.Error(t, validatePipeline(steps))
+	steps[0].Timeout = 0
+	steps[0].FilePatterns = []string{"[a-"}
+	assert.Error(t, validatePipeline(steps))
+	steps[0].FilePatterns = []string{"*.pdf"}
+	steps = append(steps, PipelineStep{Name: "step1", Type: PipelineStepLog})
+	assert.Error(t, validatePipeline(steps))
+	steps[1].Name = ""
+	require.NoError(t, validatePipeline(steps))
+	assert.Equal(t, "step1", steps[0].Name)
+	assert.Equal(t, "step2", steps[1].Name)
+	assert.Equal(t, PipelineOnFailureWarn, steps[0].OnFailure)
+	assert.Equal(t, defaultPipelineStepTimeout, steps[0].Timeout)
+
+	assert.True(t, steps[0].matches("user", "/dir/file.PDF"))
+	assert.False(t, steps[0].matches("user", "/dir/file.txt"))
+	steps[0].Users = []string{"admin*"}
+	assert.False(t, steps[0].matches("user", "/dir/file.pdf"))
+	assert.True(t, steps[0].matches("admin1", "/dir/file.pdf"))
+}
+
+func TestPipelineExecution(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	actionsCopy := Config.Actions
+	defer func() {
+		Config.Actions = actionsCopy
+	}()
+
+	username := "test_user_pipeline"
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: username,
+			Permissions: map[string][]string{
+				"/": {dataprovider.PermAny},
+			},
+			HomeDir: filepath.Join(os.TempDir(), username),
+		},
+	}
+	err := dataprovider.AddUser(&user, "", "")
+	require.NoError(t, err)
+	err = os.MkdirAll(user.GetHomeDir(), os.ModePerm)
+	require.NoError(t, err)
+	defer func() {
+		err = dataprovider.DeleteUser(username, "", "")
+		assert.NoError(t, err)
+		err = os.RemoveAll(user.GetHomeDir())
+		assert.NoError(t, err)
+	}()
+
+	scanScript := filepath.Join(user.GetHomeDir(), "..", "pipeline_scan.sh")
+	err = os.WriteFile(scanScript, []byte("#!/bin/sh\necho '{\"clean\": true}'\n"), 0755)
+	require.NoError(t, err)
+	defer os.Remove(scanScript)
+	sleepScript := filepath.Join(user.GetHomeDir(), "..", "pipeline_sleep.sh")
+	err = os.WriteFile(sleepScript, []byte("#!/bin/sh\nsleep 5\n"), 0755)
+	require.NoError(t, err)
+	defer os.Remove(sleepScript)
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := json.NewDecoder(r.Body).Decode(&received)
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"metadata": "extracted"}`)) //nolint:errcheck
+	}))
+	defer server.Close()
+
+	Config.Actions.Pipeline = []PipelineStep{
+		{
+			Name:      "scan",
+			Type:      PipelineStepExec,
+			Target:    scanScript,
+			OnFailure: PipelineOnFailureAbort,
+		},
+		{
+			Name:         "archive",
+			Type:         PipelineStepCopy,
+			Target:       "/archive/{{Name}}/",
+			FilePatterns: []string{"*.txt"},
+		},
+		{
+			Name:         "skipped",
+			Type:         PipelineStepCopy,
+			Target:       "/skipped/",
+			FilePatterns: []string{"*.pdf"},
+		},
+		{
+			Name:   "metadata",
+			Type:   PipelineStepHTTP,
+			Target: server.URL,
+		},
+		{
+			Name:   "move",
+			Type:   PipelineStepMove,
+			Target: "/processed/{{ObjectName}}",
+		},
+		{
+			Name: "log",
+			Type: PipelineStepLog,
+		},
+	}
+	require.NoError(t, validatePipeline(Config.Actions.Pipeline))
+
+	uploadFile := func(name string) notifierEventForTest {
+		err := os.WriteFile(filepath.Join(user.GetHomeDir(), name), []byte("content"), 0666)
+		require.NoError(t, err)
+		conn := NewBaseConnection("", ProtocolSFTP, "", "", user)
+		return notifierEventForTest{
+			conn:        conn,
+			fsPath:      filepath.Join(user.GetHomeDir(), name),
+			virtualPath: "/" + name,
+		}
+	}
+
+	upload := uploadFile("file.txt")
+	err = executePipeline(*newActionNotification(&user, operationUpload, upload.fsPath, upload.virtualPath,
+		"", "", "", ProtocolSFTP, "", "", 7, 0, nil), true)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "file.txt"))
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), "archive", username, "file.txt"))
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), "processed", "file.txt"))
+	assert.NoDirExists(t, filepath.Join(user.GetHomeDir(), "skipped"))
+	// the HTTP step receives the output of the previous steps
+	if assert.NotNil(t, received) {
+		ctx, ok := received["context"].(map[string]any)
+		if assert.True(t, ok) {
+			assert.Equal(t, true, ctx["clean"])
+			assert.Equal(t, "/archive/"+username+"/file.txt", ctx["copied_to"])
+		}
+	}
+	assert.Len(t, activePipelines.get(), 0)
+	// a failed step with the abort action deletes the moved file
+	Config.Actions.Pipeline[5] = PipelineStep{
+		Name:      "fail",
+		Type:      PipelineStepExec,
+		Target:    "/bad/command",
+		OnFailure: PipelineOnFailureAbort,
+	}
+	upload = uploadFile("file1.txt")
+	err = executePipeline(*newActionNotification(&user, operationUpload, upload.fsPath, upload.virtualPath,
+		"", "", "", ProtocolSFTP, "", "", 7, 0, nil), true)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "processed", "file1.txt"))
+	// step timeout, for asynchronous pipelines the uploaded file is removed
+	Config.Actions.Pipeline = []PipelineStep{
+		{
+			Name:      "sleep",
+			Type:      PipelineStepExec,
+			Target:    sleepScript,
+			OnFailure: PipelineOnFailureAbort,
+			Timeout:   1,
+		},
+		{
+			Name: "log",
+			Type: PipelineStepLog,
+		},
+	}
+	upload = uploadFile("file2.txt")
+	err = executePipeline(*newActionNotification(&user, operationUpload, upload.fsPath, upload.virtualPath,
+		"", "", "", ProtocolSFTP, "", "", 7, 0, nil), false)
+	assert.ErrorIs(t, err, errPipelineStepTimeout)
+	assert.NoFileExists(t, upload.fsPath)
+	// the failure is ignored
+	Config.Actions.Pipeline[0].OnFailure = PipelineOnFailureIgnore
+	upload = uploadFile("file3.txt")
+	err = ExecuteActionNotification(upload.conn, operationUpload, upload.fsPath, upload.virtualPath, "", "", "", 7, nil)
+	assert.NoError(t, err)
+	Config.Actions.ExecuteSync = []string{operationUpload}
+	err = ExecuteActionNotification(upload.conn, operationUpload, upload.fsPath, upload.virtualPath, "", "", "", 7, nil)
+	assert.NoError(t, err)
+	assert.FileExists(t, upload.fsPath)
+}
+
+type notifierEventForTest struct {
+	conn        *BaseConnection
+	fsPath      string
+	virtualPath string
+}
@@ -15,9 +15,11 @@
 package common_test
 
 import (
+	"archive/zip"
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -482,6 +484,139 @@ func TestCheckFsAfterUpdate(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestOsFsDeduplication(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	u := getTestUser()
+	u.QuotaFiles = 100
+	u.FsConfig.OSConfig.DeduplicationEnabled = true
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.True(t, user.FsConfig.OSConfig.DeduplicationEnabled)
+
+	content := []byte("deduplicated content")
+	conn, client, err := getSftpClient(user)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		for _, name := range []string{"file1", "file2", "file3"} {
+			f, err := client.Create(name)
+			if assert.NoError(t, err) {
+				_, err = f.Write(content)
+				assert.NoError(t, err)
+				err = f.Close()
+				assert.NoError(t, err)
+			}
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.UsedQuotaFiles)
+		assert.Equal(t, int64(len(content)), user.UsedQuotaSize)
+
+		info1, err := os.Stat(filepath.Join(user.GetHomeDir(), "file1"))
+		assert.NoError(t, err)
+		info2, err := os.Stat(filepath.Join(user.GetHomeDir(), "file2"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(info1, info2))
+		// the content store must not be visible
+		entries, err := client.ReadDir("/")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 3)
+		_, err = client.Stat("/.sftpgo_cas")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		// modifying a file must not change the other ones
+		f, err := client.OpenFile("file1", os.O_WRONLY|os.O_APPEND)
+		if assert.NoError(t, err) {
+			_, err = f.Seek(int64(len(content)), io.SeekStart)
+			assert.NoError(t, err)
+			_, err = f.Write([]byte(" modified"))
+			assert.NoError(t, err)
+			err = f.Close()
+			assert.NoError(t, err)
+		}
+		data, err := os.ReadFile(filepath.Join(user.GetHomeDir(), "file2"))
+		assert.NoError(t, err)
+		assert.Equal(t, content, data)
+		data, err = os.ReadFile(filepath.Join(user.GetHomeDir(), "file1"))
+		assert.NoError(t, err)
+		assert.Equal(t, append(content, []byte(" modified")...), data)
+
+		_, err = httpdtest.StartQuotaScan(user, http.StatusAccepted)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			scans, _, err := httpdtest.GetQuotaScans(http.StatusOK)
+			if err == nil {
+				return len(scans) == 0
+			}
+			return false
+		}, 1*time.Second, 50*time.Millisecond)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.UsedQuotaFiles)
+		assert.Equal(t, int64(2*len(content)+len(" modified")), user.UsedQuotaSize)
+		// file2 shares its content with file3, removing it does not free any space
+		err = client.Remove("file2")
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		assert.Equal(t, int64(2*len(content)+len(" modified")), user.UsedQuotaSize)
+		// file3 is now the only file using the stored content, it is overwritten in place
+		info3, err := os.Stat(filepath.Join(user.GetHomeDir(), "file3"))
+		assert.NoError(t, err)
+		otherContent := []byte("other content")
+		err = writeSFTPFileContent("file3", otherContent, client)
+		assert.NoError(t, err)
+		info, err := os.Stat(filepath.Join(user.GetHomeDir(), "file3"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(info3, info))
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		assert.Equal(t, int64(len(content)+len(" modified")+len(otherContent)), user.UsedQuotaSize)
+		// the modified file1 was added to the store too
+		assert.Equal(t, 2, getDeduplicatedContents(t, user))
+		err = writeSFTPFileContent("file4", otherContent, client)
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.UsedQuotaFiles)
+		assert.Equal(t, int64(len(content)+len(" modified")+len(otherContent)), user.UsedQuotaSize)
+		// overwriting a file sharing its content does not free any space
+		err = writeSFTPFileContent("file4", content, client)
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.UsedQuotaFiles)
+		assert.Equal(t, int64(2*len(content)+len(" modified")+len(otherContent)), user.UsedQuotaSize)
+		assert.Equal(t, 3, getDeduplicatedContents(t, user))
+		// removing the last file using a content frees the space and removes it from the store
+		for _, name := range []string{"file3", "file4"} {
+			err = client.Remove(name)
+			assert.NoError(t, err)
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, user.UsedQuotaFiles)
+		assert.Equal(t, int64(len(content)+len(" modified")), user.UsedQuotaSize)
+		assert.Equal(t, 1, getDeduplicatedContents(t, user))
+		err = client.Remove("file1")
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, user.UsedQuotaFiles)
+		assert.Equal(t, int64(0), user.UsedQuotaSize)
+		assert.Equal(t, 0, getDeduplicatedContents(t, user))
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestSetStat(t *testing.T) {
 	u := getTestUser()
 	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
@@ -659,6 +794,8 @@ func TestChtimesOpenHandle(t *testing.T) {
 }
 
 func TestWaitForConnections(t *testing.T) {
+	// transfers started by other test cases without a connection could be still tracked
+	initialTransfers := common.Connections.GetActiveTransfers()
 	u := getTestUser()
 	u.UploadBandwidth = 128
 	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
@@ -724,11 +861,14 @@ func TestWaitForConnections(t *testing.T) {
 			common.WaitForTransfers(1)
 		}()
 
+		// the transfer cannot complete within the grace time, the connection is forcibly closed
 		err = writeSFTPFileNoCheck(testFileName, testFileSize, client)
-		// we don't have an error here because the service won't really stop
-		assert.NoError(t, err)
+		assert.Error(t, err)
 		wg.Wait()
 	}
+	assert.Eventually(t, func() bool {
+		return common.Connections.GetActiveTransfers() == initialTransfers
+	}, 2*time.Second, 100*time.Millisecond)
 
 	err = common.Initialize(common.Config, 0)
 	assert.NoError(t, err)
@@ -3851,7 +3991,7 @@ func TestEventRuleProviderEvents(t *testing.T) {
 	// no action is triggered on add
 	assert.NoFileExists(t, outPath)
 	// update the folder
-	_, _, err = httpdtest.UpdateFolder(folder, http.StatusOK)
+	folder, _, err = httpdtest.UpdateFolder(folder, http.StatusOK)
 	assert.NoError(t, err)
 	if assert.Eventually(t, func() bool {
 		_, err := os.Stat(outPath)
@@ -5807,6 +5947,391 @@ func TestQuotaTrackDisabled(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestQuotaWarningEmails(t *testing.T) {
+	smtpCfg := smtp.Config{
+		Host:          "127.0.0.1",
+		Port:          2525,
+		From:          "notification@example.com",
+		TemplatesPath: "templates",
+	}
+	err := smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+	err = dataprovider.Close()
+	assert.NoError(t, err)
+	err = config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	providerConf := config.GetProviderConf()
+	providerConf.QuotaWarnings.BCC = []string{"admin@example.com"}
+	providerConf.QuotaWarnings.WebClientURL = "https://sftpgo.example.com/web/client"
+	err = dataprovider.Initialize(providerConf, configDir, true)
+	assert.NoError(t, err)
+
+	u := getTestUser()
+	u.Email = "user@example.com"
+	u.QuotaSize = 100 * 1024
+	u.Filters.QuotaWarningThresholds = []int{80, 50, 80}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{50, 80}, user.Filters.QuotaWarningThresholds)
+	assert.Equal(t, 0, user.LastQuotaWarning)
+	conn, client, err := getSftpClient(user)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		lastReceivedEmail.reset()
+		err = writeSFTPFile(testFileName, 40*1024, client)
+		assert.NoError(t, err)
+		// below the first threshold
+		time.Sleep(200 * time.Millisecond)
+		assert.Empty(t, lastReceivedEmail.get().From)
+
+		err = writeSFTPFile(testFileName+"1", 20*1024, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return lastReceivedEmail.get().From != ""
+		}, 3000*time.Millisecond, 100*time.Millisecond)
+		email := lastReceivedEmail.get()
+		assert.Len(t, email.To, 2)
+		assert.True(t, util.Contains(email.To, "user@example.com"))
+		assert.True(t, util.Contains(email.To, "admin@example.com"))
+		assert.Contains(t, email.Data, "Subject: SFTPGo - Your account is using 60% of its quota")
+		assert.Contains(t, email.Data, providerConf.QuotaWarnings.WebClientURL)
+		assert.Eventually(t, func() bool {
+			user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+			return err == nil && user.LastQuotaWarning == 50
+		}, 1000*time.Millisecond, 50*time.Millisecond)
+		assert.True(t, user.QuotaWarningEmailSent(50))
+		assert.False(t, user.QuotaWarningEmailSent(80))
+		// the same threshold is notified only once
+		lastReceivedEmail.reset()
+		err = writeSFTPFile(testFileName+"2", 5*1024, client)
+		assert.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+		assert.Empty(t, lastReceivedEmail.get().From)
+
+		err = writeSFTPFile(testFileName+"3", 20*1024, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return lastReceivedEmail.get().From != ""
+		}, 3000*time.Millisecond, 100*time.Millisecond)
+		email = lastReceivedEmail.get()
+		assert.Contains(t, email.Data, "Subject: SFTPGo - Your account is using 85% of its quota")
+		assert.Eventually(t, func() bool {
+			user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+			return err == nil && user.LastQuotaWarning == 80
+		}, 1000*time.Millisecond, 50*time.Millisecond)
+		// freeing space re-arms the thresholds without sending emails
+		lastReceivedEmail.reset()
+		for _, name := range []string{testFileName + "1", testFileName + "2", testFileName + "3"} {
+			err = client.Remove(name)
+			assert.NoError(t, err)
+		}
+		assert.Eventually(t, func() bool {
+			user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+			return err == nil && user.LastQuotaWarning == 0
+		}, 1000*time.Millisecond, 50*time.Millisecond)
+		assert.Empty(t, lastReceivedEmail.get().From)
+		// updating the user preserves the last notified threshold
+		err = writeSFTPFile(testFileName+"1", 20*1024, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return lastReceivedEmail.get().From != ""
+		}, 3000*time.Millisecond, 100*time.Millisecond)
+		user.Filters.QuotaWarningThresholds = []int{50, 90}
+		user, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 50, user.LastQuotaWarning)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+
+	err = dataprovider.Close()
+	assert.NoError(t, err)
+	err = config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	providerConf = config.GetProviderConf()
+	err = dataprovider.Initialize(providerConf, configDir, true)
+	assert.NoError(t, err)
+	smtpCfg = smtp.Config{}
+	err = smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+}
+
+func TestTLSUsernameSubjectAltName(t *testing.T) {
+	u := getTestUser()
+	u.Username = "user@san.example.com"
+	u.Filters.TLSUsername = dataprovider.TLSUsernameSAN
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+
+	crt := &x509.Certificate{
+		DNSNames: []string{"san.example.com", user.Username},
+	}
+	_, err = dataprovider.CheckUserAndTLSCert(user.Username, "127.0.0.1", common.ProtocolFTP, crt)
+	assert.NoError(t, err)
+	_, err = dataprovider.CheckUserAndTLSCert(user.Username, "127.0.0.1", common.ProtocolWebDAV, crt)
+	assert.NoError(t, err)
+	crt = &x509.Certificate{
+		EmailAddresses: []string{user.Username},
+	}
+	_, err = dataprovider.CheckUserAndTLSCert(user.Username, "127.0.0.1", common.ProtocolFTP, crt)
+	assert.NoError(t, err)
+	// the common name is ignored
+	crt.Subject.CommonName = user.Username
+	crt.EmailAddresses = []string{"other@san.example.com"}
+	_, err = dataprovider.CheckUserAndTLSCert(user.Username, "127.0.0.1", common.ProtocolFTP, crt)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no subject alternative name matches username")
+	}
+	// certificate authentication is not supported for SSH
+	crt.EmailAddresses = []string{user.Username}
+	_, err = dataprovider.CheckUserAndTLSCert(user.Username, "127.0.0.1", common.ProtocolSSH, crt)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestLoginCooldown(t *testing.T) {
+	smtpCfg := smtp.Config{
+		Host:          "127.0.0.1",
+		Port:          2525,
+		From:          "notification@example.com",
+		TemplatesPath: "templates",
+	}
+	err := smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+
+	u := getTestUser()
+	u.Email = "user@example.com"
+	u.Filters.LoginCooldown = dataprovider.LoginCooldown{
+		MaxAttempts:       2,
+		CooldownSeconds:   60,
+		ResetAfterSeconds: 1,
+		Notify:            true,
+	}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	wrongPwdUser := user
+	wrongPwdUser.Password = "wrong password"
+
+	lastReceivedEmail.reset()
+	_, _, err = getSftpClient(wrongPwdUser)
+	assert.Error(t, err)
+	// the failed attempts counter is reset after one second without failures
+	time.Sleep(1100 * time.Millisecond)
+	_, _, err = getSftpClient(wrongPwdUser)
+	assert.Error(t, err)
+	conn, client, err := getSftpClient(user)
+	if assert.NoError(t, err) {
+		err = checkBasicSFTP(client)
+		assert.NoError(t, err)
+		client.Close()
+		conn.Close()
+	}
+	assert.Empty(t, lastReceivedEmail.get().From)
+	for i := 0; i < 2; i++ {
+		_, _, err = getSftpClient(wrongPwdUser)
+		assert.Error(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		return lastReceivedEmail.get().From != ""
+	}, 3000*time.Millisecond, 100*time.Millisecond)
+	email := lastReceivedEmail.get()
+	assert.Len(t, email.To, 1)
+	assert.True(t, util.Contains(email.To, user.Email))
+	assert.Contains(t, email.Data, "Subject: SFTPGo - Your account is temporarily locked")
+	// the right credentials are refused too
+	_, _, err = getSftpClient(user)
+	assert.Error(t, err)
+	_, err = httpdtest.ResetUserLoginCooldown(user.Username, http.StatusOK)
+	assert.NoError(t, err)
+	conn, client, err = getSftpClient(user)
+	if assert.NoError(t, err) {
+		err = checkBasicSFTP(client)
+		assert.NoError(t, err)
+		client.Close()
+		conn.Close()
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	smtpCfg = smtp.Config{}
+	err = smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+}
+
+func TestPathRewriteUpload(t *testing.T) {
+	u := getTestUser()
+	u.Filters.PathRewriteRules = []dataprovider.PathRewrite{
+		{
+			Pattern:     `^/([^/]+\.csv)$`,
+			Replacement: "/reports/{username}/$1",
+		},
+		{
+			Pattern:     `^/([^/]+\.txt)$`,
+			Replacement: "/texts/$1",
+			Protocols:   []string{common.ProtocolFTP},
+		},
+	}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		err = writeSFTPFileNoCheck("file.csv", 100, client)
+		assert.NoError(t, err)
+		_, err = client.Stat("file.csv")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		info, err := client.Stat(path.Join("reports", user.Username, "file.csv"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(100), info.Size())
+		}
+		// the second rule does not apply to SFTP
+		err = writeSFTPFile("file.txt", 100, client)
+		assert.NoError(t, err)
+		_, err = client.Stat("texts")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestAutoExtract(t *testing.T) {
+	smtpCfg := smtp.Config{
+		Host:          "127.0.0.1",
+		Port:          2525,
+		From:          "notification@example.com",
+		TemplatesPath: "templates",
+	}
+	err := smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+
+	u := getTestUser()
+	u.Email = "user@example.com"
+	u.QuotaFiles = 100
+	u.Filters.AutoExtract = dataprovider.AutoExtractConfig{
+		TriggerPath:           "/incoming/*",
+		ExtractToPath:         "/extracted",
+		DeleteZipAfterExtract: true,
+		MaxExtractedSize:      1024,
+		NotifyEmails:          []string{"admin@example.com"},
+	}
+	u.Permissions["/extracted"] = []string{dataprovider.PermListItems, dataprovider.PermDownload,
+		dataprovider.PermUpload, dataprovider.PermCreateDirs}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		err = client.MkdirAll("/incoming/expand")
+		assert.NoError(t, err)
+		zipContent, err := getZipContent(map[string]int{"file1.txt": 100, "sub/dir/file2.txt": 200})
+		assert.NoError(t, err)
+		err = writeSFTPFileContent("/incoming/expand/archive.zip", zipContent, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			_, err := client.Stat("/incoming/expand/archive.zip")
+			return errors.Is(err, os.ErrNotExist)
+		}, 2*time.Second, 100*time.Millisecond)
+		info, err := client.Stat("/extracted/file1.txt")
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(100), info.Size())
+		}
+		info, err = client.Stat("/extracted/sub/dir/file2.txt")
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(200), info.Size())
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		assert.Equal(t, int64(300), user.UsedQuotaSize)
+		// existing files are not overwritten without the overwrite permission
+		zipContent, err = getZipContent(map[string]int{"file1.txt": 50, "file5.txt": 10})
+		assert.NoError(t, err)
+		err = writeSFTPFileContent("/incoming/expand/archive.zip", zipContent, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			_, err := client.Stat("/incoming/expand/archive.zip")
+			return errors.Is(err, os.ErrNotExist)
+		}, 2*time.Second, 100*time.Millisecond)
+		info, err = client.Stat("/extracted/file1.txt")
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(100), info.Size())
+		}
+		info, err = client.Stat("/extracted/file5.txt")
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(10), info.Size())
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, user.UsedQuotaFiles)
+		assert.Equal(t, int64(310), user.UsedQuotaSize)
+		// ZIP files outside the trigger path are not extracted
+		err = writeSFTPFileContent("/archive.zip", zipContent, client)
+		assert.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+		_, err = client.Stat("/archive.zip")
+		assert.NoError(t, err)
+		// entries outside the target directory are not allowed
+		lastReceivedEmail.reset()
+		zipContent, err = getZipContent(map[string]int{"file3.txt": 10, "../escaped.txt": 10})
+		assert.NoError(t, err)
+		err = writeSFTPFileContent("/incoming/expand/slip.zip", zipContent, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return lastReceivedEmail.get().From != ""
+		}, 2*time.Second, 100*time.Millisecond)
+		email := lastReceivedEmail.get()
+		assert.Len(t, email.To, 2)
+		assert.True(t, util.Contains(email.To, "user@example.com"))
+		assert.True(t, util.Contains(email.To, "admin@example.com"))
+		assert.Contains(t, email.Data, "Subject: SFTPGo - Archive extraction failed")
+		assert.Contains(t, email.Data, "outside the target directory")
+		_, err = client.Stat("/incoming/expand/slip.zip")
+		assert.NoError(t, err)
+		_, err = client.Stat("/extracted/file3.txt")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = client.Stat("/escaped.txt")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		// max extracted size exceeded
+		lastReceivedEmail.reset()
+		zipContent, err = getZipContent(map[string]int{"file4.txt": 1025})
+		assert.NoError(t, err)
+		err = writeSFTPFileContent("/incoming/expand/big.zip", zipContent, client)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return lastReceivedEmail.get().From != ""
+		}, 2*time.Second, 100*time.Millisecond)
+		assert.Contains(t, lastReceivedEmail.get().Data, "exceeds the limit")
+		_, err = client.Stat("/extracted/file4.txt")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	smtpCfg = smtp.Config{}
+	err = smtpCfg.Initialize(configDir)
+	require.NoError(t, err)
+}
+
 func TestGetQuotaError(t *testing.T) {
 	if dataprovider.GetProviderStatus().Driver == "memory" {
 		t.Skip("this test is not available with the memory provider")
@@ -6774,6 +7299,51 @@ func writeSFTPFile(name string, size int64, client *sftp.Client) error {
 	return nil
 }
 
+func getZipContent(files map[string]int) ([]byte, error) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, size := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(bytes.Repeat([]byte("a"), size)); err != nil {
+			return nil, err
+		}
+	}
+	err := w.Close()
+	return b.Bytes(), err
+}
+
+// getDeduplicatedContents returns the number of contents inside the content store
+func getDeduplicatedContents(t *testing.T, user dataprovider.User) int {
+	numContents := 0
+	err := filepath.Walk(filepath.Join(user.GetHomeDir(), ".sftpgo_cas"), func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			numContents++
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return numContents
+}
+
+func writeSFTPFileContent(name string, content []byte, client *sftp.Client) error {
+	f, err := client.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, bytes.NewBuffer(content))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func writeSFTPFileNoCheck(name string, size int64, client *sftp.Client) error {
 	content := make([]byte, size)
 	_, err := rand.Read(content)
@@ -0,0 +1,116 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported security headers presets
+const (
+	SecurityHeadersPresetNone   = "none"
+	SecurityHeadersPresetStrict = "strict"
+	SecurityHeadersPresetAPI    = "api"
+)
+
+const (
+	securityHeadersSTSValue = "max-age=31536000; includeSubDomains"
+	securityHeadersCSPValue = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'self'"
+)
+
+var securityHeadersPresets = map[string][]HTTPResponseHeader{
+	"":                        nil,
+	SecurityHeadersPresetNone: nil,
+	SecurityHeadersPresetStrict: {
+		{Key: "Strict-Transport-Security", Value: securityHeadersSTSValue},
+		{Key: "Content-Security-Policy", Value: securityHeadersCSPValue},
+		{Key: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+	},
+	SecurityHeadersPresetAPI: {
+		{Key: "Strict-Transport-Security", Value: securityHeadersSTSValue},
+	},
+}
+
+// HTTPResponseHeader defines an HTTP header to add to the responses
+type HTTPResponseHeader struct {
+	Key   string `json:"key" mapstructure:"key"`
+	Value string `json:"value" mapstructure:"value"`
+}
+
+// SecurityHeaders defines the headers to add to every HTTP response
+type SecurityHeaders struct {
+	// Preset defines a predefined set of headers. Supported values:
+	// - "" or "none", no predefined headers
+	// - "strict", Strict-Transport-Security, Content-Security-Policy and Referrer-Policy
+	// - "api", Strict-Transport-Security only
+	Preset string `json:"preset" mapstructure:"preset"`
+	// Headers to add to the responses, they override the preset ones with the
+	// same name. A header with an empty value removes the preset one
+	Headers []HTTPResponseHeader `json:"headers" mapstructure:"headers"`
+}
+
+// IsEnabled returns true if at least a header must be added to the responses
+func (s *SecurityHeaders) IsEnabled() bool {
+	return len(s.getHeaders()) > 0
+}
+
+// Validate returns an error if the configured preset or headers are not valid
+func (s *SecurityHeaders) Validate() error {
+	if _, ok := securityHeadersPresets[s.Preset]; !ok {
+		return util.NewValidationError(fmt.Sprintf("invalid security headers preset %q", s.Preset))
+	}
+	for _, header := range s.Headers {
+		if !httpguts.ValidHeaderFieldName(header.Key) {
+			return util.NewValidationError(fmt.Sprintf("invalid security header name %q", header.Key))
+		}
+		if !httpguts.ValidHeaderFieldValue(header.Value) {
+			return util.NewValidationError(fmt.Sprintf("invalid value for security header %q", header.Key))
+		}
+	}
+	return nil
+}
+
+func (s *SecurityHeaders) getHeaders() http.Header {
+	headers := make(http.Header)
+	for _, header := range securityHeadersPresets[s.Preset] {
+		headers.Set(header.Key, header.Value)
+	}
+	for _, header := range s.Headers {
+		if header.Value == "" {
+			headers.Del(header.Key)
+			continue
+		}
+		headers.Set(header.Key, header.Value)
+	}
+	return headers
+}
+
+// Handler returns a middleware that adds the configured headers to the responses
+func (s *SecurityHeaders) Handler(next http.Handler) http.Handler {
+	headers := s.getHeaders()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key := range headers {
+			w.Header().Set(key, headers.Get(key))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
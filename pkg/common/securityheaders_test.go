@@ -0,0 +1,87 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	s := SecurityHeaders{}
+	assert.NoError(t, s.Validate())
+	assert.False(t, s.IsEnabled())
+	s.Preset = SecurityHeadersPresetNone
+	assert.NoError(t, s.Validate())
+	assert.False(t, s.IsEnabled())
+	s.Preset = "invalid"
+	assert.Error(t, s.Validate())
+	s.Preset = SecurityHeadersPresetAPI
+	assert.NoError(t, s.Validate())
+	assert.True(t, s.IsEnabled())
+	s.Headers = []HTTPResponseHeader{
+		{
+			Key:   "invalid header",
+			Value: "value",
+		},
+	}
+	assert.Error(t, s.Validate())
+	s.Headers = []HTTPResponseHeader{
+		{
+			Key:   "X-Test",
+			Value: "value\n",
+		},
+	}
+	assert.Error(t, s.Validate())
+
+	s.Preset = SecurityHeadersPresetStrict
+	s.Headers = []HTTPResponseHeader{
+		{
+			Key:   "referrer-policy",
+			Value: "",
+		},
+		{
+			Key:   "content-security-policy",
+			Value: "default-src 'none'",
+		},
+		{
+			Key:   "X-Frame-Options",
+			Value: "DENY",
+		},
+	}
+	assert.NoError(t, s.Validate())
+	handler := s.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, securityHeadersSTSValue, rr.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'none'", rr.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", rr.Header().Get("X-Frame-Options"))
+	assert.Empty(t, rr.Header().Get("Referrer-Policy"))
+
+	s.Preset = SecurityHeadersPresetAPI
+	s.Headers = []HTTPResponseHeader{
+		{
+			Key:   "Strict-Transport-Security",
+			Value: "",
+		},
+	}
+	assert.False(t, s.IsEnabled())
+}
@@ -18,13 +18,19 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
@@ -41,6 +47,19 @@ type TLSKeyPair struct {
 	ID   string
 }
 
+// TLSCertificateInfo defines the metadata for a loaded TLS certificate
+type TLSCertificateInfo struct {
+	ID           string   `json:"id"`
+	Subject      string   `json:"subject"`
+	Issuer       string   `json:"issuer"`
+	SerialNumber string   `json:"serial_number"`
+	DNSNames     []string `json:"dns_names,omitempty"`
+	IPAddresses  []string `json:"ip_addresses,omitempty"`
+	// NotBefore and NotAfter are unix timestamps in milliseconds
+	NotBefore int64 `json:"not_before"`
+	NotAfter  int64 `json:"not_after"`
+}
+
 // CertManager defines a TLS certificate manager
 type CertManager struct {
 	keyPairs  []TLSKeyPair
@@ -95,6 +114,41 @@ func (m *CertManager) loadCertificates() error {
 	return nil
 }
 
+// GetCertificatesInfo returns the metadata for the loaded certificates
+func (m *CertManager) GetCertificatesInfo() []TLSCertificateInfo {
+	m.RLock()
+	defer m.RUnlock()
+
+	result := make([]TLSCertificateInfo, 0, len(m.certs))
+	for id, cert := range m.certs {
+		if len(cert.Certificate) == 0 {
+			continue
+		}
+		x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			logger.Warn(m.logSender, "", "unable to parse TLS certificate with id %q: %v", id, err)
+			continue
+		}
+		info := TLSCertificateInfo{
+			ID:           id,
+			Subject:      x509Cert.Subject.String(),
+			Issuer:       x509Cert.Issuer.String(),
+			SerialNumber: x509Cert.SerialNumber.String(),
+			DNSNames:     x509Cert.DNSNames,
+			NotBefore:    util.GetTimeAsMsSinceEpoch(x509Cert.NotBefore),
+			NotAfter:     util.GetTimeAsMsSinceEpoch(x509Cert.NotAfter),
+		}
+		for _, ip := range x509Cert.IPAddresses {
+			info.IPAddresses = append(info.IPAddresses, ip.String())
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
 // GetCertificateFunc returns the loaded certificate
 func (m *CertManager) GetCertificateFunc(certID string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
 	return func(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -241,3 +295,139 @@ func NewCertManager(keyPairs []TLSKeyPair, configDir, logSender string) (*CertMa
 	}
 	return manager, nil
 }
+
+// acmeKeyPairs stores the key pairs for the certificates managed by the ACME module,
+// the services can use them instead of the configured certificate files
+var acmeKeyPairs struct {
+	sync.RWMutex
+	keyPairs map[string]TLSKeyPair
+}
+
+// SetACMEKeyPairs sets the key pairs for the certificates managed by the ACME module.
+// The key pair ID is the domain, as defined in the ACME configuration
+func SetACMEKeyPairs(keyPairs []TLSKeyPair) {
+	pairs := make(map[string]TLSKeyPair)
+	for _, keyPair := range keyPairs {
+		pairs[keyPair.ID] = keyPair
+	}
+
+	acmeKeyPairs.Lock()
+	defer acmeKeyPairs.Unlock()
+
+	acmeKeyPairs.keyPairs = pairs
+}
+
+// GetACMEKeyPair returns the key pair for the certificate obtained by the ACME module
+// for the specified domain. The returned key pair has the specified ID
+func GetACMEKeyPair(domain, id string) (TLSKeyPair, error) {
+	acmeKeyPairs.RLock()
+	defer acmeKeyPairs.RUnlock()
+
+	keyPair, ok := acmeKeyPairs.keyPairs[domain]
+	if !ok {
+		return keyPair, fmt.Errorf("no ACME certificate configured for domain %q", domain)
+	}
+	keyPair.ID = id
+	return keyPair, nil
+}
+
+const (
+	maxCRLDistributionPointSize = 10 * 1024 * 1024
+	// defaultCRLCacheDuration is used for the downloaded CRLs without a next update time
+	defaultCRLCacheDuration = time.Hour
+)
+
+// crlDistributionPoints caches the CRLs downloaded from the distribution points
+// defined in the client certificates, the key is the distribution point URL
+var crlDistributionPoints struct {
+	sync.Mutex
+	crls map[string]cachedCRL
+}
+
+type cachedCRL struct {
+	crl       *x509.RevocationList
+	expiresAt time.Time
+}
+
+// CheckCRLDistributionPoints checks the revocation status of the given certificate
+// using the CRLs published at its HTTP(S) distribution points. The CRLs must be signed
+// by the issuer and are cached until their next update. ErrCrtRevoked is returned if
+// the certificate is revoked, any other error means that a CRL cannot be fetched or
+// verified and so the revocation status is unknown
+func CheckCRLDistributionPoints(crt, issuer *x509.Certificate) error {
+	if crt == nil || len(crt.CRLDistributionPoints) == 0 {
+		return nil
+	}
+	if issuer == nil {
+		return errors.New("unable to check the CRL distribution points: issuer certificate not available")
+	}
+	for _, dp := range crt.CRLDistributionPoints {
+		if !strings.HasPrefix(dp, "http://") && !strings.HasPrefix(dp, "https://") {
+			logger.Debug(logSender, "", "unsupported CRL distribution point %q, skipped", dp)
+			continue
+		}
+		crl, err := getCRLFromDistributionPoint(dp, issuer)
+		if err != nil {
+			return err
+		}
+		for _, rc := range crl.RevokedCertificates { //nolint:staticcheck
+			if rc.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+				return ErrCrtRevoked
+			}
+		}
+	}
+	return nil
+}
+
+func getCRLFromDistributionPoint(url string, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	crlDistributionPoints.Lock()
+	defer crlDistributionPoints.Unlock()
+
+	if cached, ok := crlDistributionPoints.crls[url]; ok && time.Now().Before(cached.expiresAt) {
+		if err := cached.crl.CheckSignatureFrom(issuer); err == nil {
+			return cached.crl, nil
+		}
+	}
+	crl, err := fetchCRL(url)
+	if err != nil {
+		logger.Warn(logSender, "", "unable to fetch the CRL from distribution point %q: %v", url, err)
+		return nil, fmt.Errorf("unable to fetch the CRL from distribution point %q: %w", url, err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		logger.Warn(logSender, "", "invalid signature for the CRL from distribution point %q: %v", url, err)
+		return nil, fmt.Errorf("invalid signature for the CRL from distribution point %q: %w", url, err)
+	}
+	expiresAt := crl.NextUpdate
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(defaultCRLCacheDuration)
+	}
+	if crlDistributionPoints.crls == nil {
+		crlDistributionPoints.crls = make(map[string]cachedCRL)
+	}
+	crlDistributionPoints.crls[url] = cachedCRL{
+		crl:       crl,
+		expiresAt: expiresAt,
+	}
+	logger.Debug(logSender, "", "CRL from distribution point %q loaded, next update: %v", url, crl.NextUpdate)
+	return crl, nil
+}
+
+func fetchCRL(url string) (*x509.RevocationList, error) {
+	resp, err := httpclient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCRLDistributionPointSize))
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
@@ -15,13 +15,22 @@
 package common
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -332,6 +341,12 @@ func TestLoadCertificate(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, certManager.certs[DefaultTLSKeyPaidID], cert)
 	}
+	certsInfo := certManager.GetCertificatesInfo()
+	if assert.Len(t, certsInfo, 1) {
+		assert.Equal(t, DefaultTLSKeyPaidID, certsInfo[0].ID)
+		assert.Equal(t, "CN=localhost", certsInfo[0].Subject)
+		assert.Greater(t, certsInfo[0].NotAfter, certsInfo[0].NotBefore)
+	}
 	certFunc = certManager.GetCertificateFunc("unknownID")
 	if assert.NotNil(t, certFunc) {
 		hello := &tls.ClientHelloInfo{
@@ -459,3 +474,81 @@ func TestLoadInvalidCert(t *testing.T) {
 	}
 	assert.Nil(t, certManager)
 }
+
+func TestCRLDistributionPoints(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CRL test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCrt, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{ //nolint:staticcheck
+			{
+				SerialNumber:   big.NewInt(3),
+				RevocationTime: time.Now().Add(-time.Minute),
+			},
+		},
+	}, caCrt, caKey)
+	require.NoError(t, err)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/ca.crl" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write(crlDER)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	getClientCrt := func(serial int64, crlURL string) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "client"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			CRLDistributionPoints: []string{crlURL},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCrt, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		crt, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return crt
+	}
+
+	err = CheckCRLDistributionPoints(getClientCrt(2, server.URL+"/ca.crl"), caCrt)
+	assert.NoError(t, err)
+	err = CheckCRLDistributionPoints(getClientCrt(3, server.URL+"/ca.crl"), caCrt)
+	assert.ErrorIs(t, err, ErrCrtRevoked)
+	// the CRL is cached until its next update
+	assert.Equal(t, 1, requests)
+	// the CRL must be signed by the issuer
+	err = CheckCRLDistributionPoints(getClientCrt(2, server.URL+"/ca.crl"), getClientCrt(4, ""))
+	assert.ErrorContains(t, err, "invalid signature")
+	err = CheckCRLDistributionPoints(getClientCrt(2, server.URL+"/missing.crl"), caCrt)
+	assert.ErrorContains(t, err, "unexpected status code 404")
+	err = CheckCRLDistributionPoints(getClientCrt(3, server.URL+"/ca.crl"), nil)
+	assert.Error(t, err)
+	// non HTTP distribution points are skipped
+	err = CheckCRLDistributionPoints(getClientCrt(3, "ldap://example.com/ca.crl"), caCrt)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckCRLDistributionPoints(nil, nil))
+}
@@ -21,6 +21,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/metric"
@@ -51,11 +53,17 @@ type BaseTransfer struct { //nolint:maligned
 	InitialSize     int64
 	truncatedSize   int64
 	isNewFile       bool
-	transferType    int
-	AbortTransfer   atomic.Bool
-	aTime           time.Time
-	mTime           time.Time
-	transferQuota   dataprovider.TransferQuota
+	// a file was reserved in the user quota before starting the upload
+	quotaFileReserved bool
+	// SHA256 checksum, hex encoded, provided by the client for the uploaded file
+	expectedChecksum string
+	transferType     int
+	AbortTransfer    atomic.Bool
+	aTime            time.Time
+	mTime            time.Time
+	transferQuota    dataprovider.TransferQuota
+	// bytes already accounted in the bandwidth bucket
+	throttledBytes atomic.Int64
 	sync.Mutex
 	errAbort    error
 	ErrTransfer error
@@ -92,6 +100,12 @@ func NewBaseTransfer(file vfs.File, conn *BaseConnection, cancelFn func(), fsPat
 	return t
 }
 
+// SetQuotaFileReserved sets if a file was reserved in the user quota,
+// using ReserveNewFile, before starting the upload
+func (t *BaseTransfer) SetQuotaFileReserved(reserved bool) {
+	t.quotaFileReserved = reserved
+}
+
 // GetTransferQuota returns data transfer quota limits
 func (t *BaseTransfer) GetTransferQuota() dataprovider.TransferQuota {
 	return t.transferQuota
@@ -340,6 +354,22 @@ func (t *BaseTransfer) getUploadFileSize() (int64, int, error) {
 	return fileSize, deletedFiles, err
 }
 
+// removePartialUpload removes a file uploaded in direct stream mode if the upload fails.
+// For resumed uploads the file is truncated to the size it had before the upload started
+func (t *BaseTransfer) removePartialUpload() {
+	var err error
+	if t.MinWriteOffset > 0 {
+		err = t.Fs.Truncate(t.fsPath, t.MinWriteOffset)
+	} else {
+		err = t.Fs.Remove(t.fsPath, false)
+	}
+	if err == nil {
+		t.BytesReceived.Store(0)
+	}
+	t.Connection.Log(logger.LevelWarn, "direct upload completed with error: \"%v\", remove partial data from file: %q, error: %v",
+		t.ErrTransfer, t.fsPath, err)
+}
+
 // return 1 if the file is outside the user home dir
 func (t *BaseTransfer) checkUploadOutsideHomeDir(err error) int {
 	if err == nil {
@@ -366,6 +396,9 @@ func (t *BaseTransfer) Close() error {
 	defer t.Connection.RemoveTransfer(t)
 
 	var err error
+	if t.transferType == TransferUpload && t.ErrTransfer == nil {
+		t.verifyChecksum()
+	}
 	numFiles := t.getUploadedFiles()
 	metric.TransferCompleted(t.BytesSent.Load(), t.BytesReceived.Load(),
 		t.transferType, t.ErrTransfer, vfs.IsSFTPFs(t.Fs))
@@ -383,7 +416,8 @@ func (t *BaseTransfer) Close() error {
 		t.Connection.Log(logger.LevelWarn, "upload denied due to space limit, delete temporary file: %#v, deletion error: %v",
 			t.File.Name(), err)
 	} else if t.transferType == TransferUpload && t.effectiveFsPath != t.fsPath {
-		if t.ErrTransfer == nil || Config.UploadMode == UploadModeAtomicWithResume {
+		if t.ErrTransfer == nil || (Config.UploadMode == UploadModeAtomicWithResume &&
+			!errors.Is(t.ErrTransfer, ErrChecksumMismatch)) {
 			err = t.Fs.Rename(t.effectiveFsPath, t.fsPath)
 			t.Connection.Log(logger.LevelDebug, "atomic upload completed, rename: %#v -> %#v, error: %v",
 				t.effectiveFsPath, t.fsPath, err)
@@ -398,12 +432,21 @@ func (t *BaseTransfer) Close() error {
 				t.MinWriteOffset = 0
 			}
 		}
+	} else if t.transferType == TransferUpload && t.ErrTransfer != nil && !errors.Is(t.ErrTransfer, ErrChecksumMismatch) &&
+		t.Connection.User.Filters.UploadMode == dataprovider.UploadModeDirectStream {
+		t.removePartialUpload()
+	}
+	if t.transferType == TransferUpload {
+		// the uploaded file, if any, is now in place
+		t.Connection.releaseDirFile(t.requestPath)
 	}
 	elapsed := time.Since(t.start).Nanoseconds() / 1000000
 	var uploadFileSize int64
 	if t.transferType == TransferDownload {
-		logger.TransferLog(downloadLogSender, t.fsPath, elapsed, t.BytesSent.Load(), t.Connection.User.Username,
-			t.Connection.ID, t.Connection.protocol, t.Connection.localAddr, t.Connection.remoteAddr, t.ftpMode)
+		if t.Connection.isLogLevelEnabled(logger.LevelInfo) {
+			logger.TransferLog(downloadLogSender, t.fsPath, elapsed, t.BytesSent.Load(), t.Connection.User.Username,
+				t.Connection.ID, t.Connection.protocol, t.Connection.localAddr, t.Connection.remoteAddr, t.ftpMode)
+		}
 		ExecuteActionNotification(t.Connection, operationDownload, t.fsPath, t.requestPath, "", "", "", //nolint:errcheck
 			t.BytesSent.Load(), t.ErrTransfer)
 	} else {
@@ -421,10 +464,21 @@ func (t *BaseTransfer) Close() error {
 		t.Connection.Log(logger.LevelDebug, "upload file size %d, num files %d, deleted files %d, fs path %q",
 			uploadFileSize, numFiles, deletedFiles, t.fsPath)
 		numFiles, uploadFileSize = t.executeUploadHook(numFiles, uploadFileSize)
-		t.updateQuota(numFiles, uploadFileSize)
+		quotaSize := uploadFileSize
+		if errStat == nil && t.deduplicateUpload() {
+			// the content is already stored, no additional disk space is used
+			quotaSize = 0
+		}
+		t.updateQuota(numFiles, quotaSize)
 		t.updateTimes()
-		logger.TransferLog(uploadLogSender, t.fsPath, elapsed, t.BytesReceived.Load(), t.Connection.User.Username,
-			t.Connection.ID, t.Connection.protocol, t.Connection.localAddr, t.Connection.remoteAddr, t.ftpMode)
+		invalidateDirListing(&t.Connection.User, path.Dir(t.requestPath))
+		if t.ErrTransfer == nil && err == nil {
+			startAutoExtract(t.Connection, t.requestPath)
+		}
+		if t.Connection.isLogLevelEnabled(logger.LevelInfo) {
+			logger.TransferLog(uploadLogSender, t.fsPath, elapsed, t.BytesReceived.Load(), t.Connection.User.Username,
+				t.Connection.ID, t.Connection.protocol, t.Connection.localAddr, t.Connection.remoteAddr, t.ftpMode)
+		}
 	}
 	if t.ErrTransfer != nil {
 		t.Connection.Log(logger.LevelError, "transfer error: %v, path: %#v", t.ErrTransfer, t.fsPath)
@@ -432,10 +486,26 @@ func (t *BaseTransfer) Close() error {
 			err = t.ErrTransfer
 		}
 	}
+	t.logAccess(err)
+	if err == nil {
+		if t.transferType == TransferDownload {
+			t.Connection.checkAnomalies(anomalyOpDownload)
+		} else {
+			t.Connection.checkAnomalies(anomalyOpUpload)
+		}
+	}
 	t.updateTransferTimestamps(uploadFileSize)
 	return err
 }
 
+func (t *BaseTransfer) logAccess(err error) {
+	method := accessLogMethodUpload
+	if t.transferType == TransferDownload {
+		method = accessLogMethodDownload
+	}
+	logAccess(t.Connection, method, t.requestPath, t.BytesSent.Load(), t.BytesReceived.Load(), time.Since(t.start), err)
+}
+
 func (t *BaseTransfer) updateTransferTimestamps(uploadFileSize int64) {
 	if t.ErrTransfer != nil {
 		return
@@ -480,6 +550,28 @@ func (t *BaseTransfer) executeUploadHook(numFiles int, fileSize int64) (int, int
 	return numFiles, fileSize
 }
 
+// deduplicateUpload replaces the uploaded file with a link to an identical
+// content, if the filesystem supports deduplication and it is enabled.
+// It returns true if the upload was deduplicated
+func (t *BaseTransfer) deduplicateUpload() bool {
+	if t.ErrTransfer != nil {
+		return false
+	}
+	deduplicator, ok := t.Fs.(vfs.FsDeduplicator)
+	if !ok {
+		return false
+	}
+	deduplicated, err := deduplicator.DeduplicateFile(t.fsPath)
+	if err != nil {
+		t.Connection.Log(logger.LevelWarn, "unable to deduplicate file %q: %v", t.fsPath, err)
+		return false
+	}
+	if deduplicated {
+		t.Connection.Log(logger.LevelDebug, "file %q deduplicated", t.fsPath)
+	}
+	return deduplicated
+}
+
 func (t *BaseTransfer) getUploadedFiles() int {
 	numFiles := 0
 	if t.isNewFile {
@@ -497,21 +589,27 @@ func (t *BaseTransfer) updateTimes() {
 }
 
 func (t *BaseTransfer) updateQuota(numFiles int, fileSize int64) bool {
+	// the reserved file is already included in the user quota
+	userFiles := numFiles
+	if t.quotaFileReserved {
+		userFiles--
+	}
 	// Uploads on some filesystem (S3 and similar) are atomic, if there is an error nothing is uploaded
 	if t.File == nil && t.ErrTransfer != nil && vfs.HasImplicitAtomicUploads(t.Fs) {
+		t.Connection.ReleaseNewFile(t.requestPath, t.quotaFileReserved)
 		return false
 	}
 	sizeDiff := fileSize - t.InitialSize
-	if t.transferType == TransferUpload && (numFiles != 0 || sizeDiff != 0) {
+	if t.transferType == TransferUpload && (numFiles != 0 || userFiles != 0 || sizeDiff != 0) {
 		vfolder, err := t.Connection.User.GetVirtualFolderForPath(path.Dir(t.requestPath))
 		if err == nil {
 			dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, numFiles, //nolint:errcheck
 				sizeDiff, false)
 			if vfolder.IsIncludedInUserQuota() {
-				dataprovider.UpdateUserQuota(&t.Connection.User, numFiles, sizeDiff, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&t.Connection.User, userFiles, sizeDiff, false) //nolint:errcheck
 			}
 		} else {
-			dataprovider.UpdateUserQuota(&t.Connection.User, numFiles, sizeDiff, false) //nolint:errcheck
+			dataprovider.UpdateUserQuota(&t.Connection.User, userFiles, sizeDiff, false) //nolint:errcheck
 		}
 		return true
 	}
@@ -522,12 +620,22 @@ func (t *BaseTransfer) updateQuota(numFiles int, fileSize int64) bool {
 func (t *BaseTransfer) HandleThrottle() {
 	var wantedBandwidth int64
 	var trasferredBytes int64
+	var bucket *rate.Limiter
 	if t.transferType == TransferDownload {
 		wantedBandwidth = t.Connection.User.DownloadBandwidth
 		trasferredBytes = t.BytesSent.Load()
+		bucket = t.Connection.downloadBucket
 	} else {
 		wantedBandwidth = t.Connection.User.UploadBandwidth
 		trasferredBytes = t.BytesReceived.Load()
+		bucket = t.Connection.uploadBucket
+	}
+	if bucket != nil {
+		// the bucket is shared by all the transfers within the connection
+		if n := trasferredBytes - t.throttledBytes.Swap(trasferredBytes); n > 0 {
+			waitBandwidthTokens(bucket, n)
+		}
+		return
 	}
 	if wantedBandwidth > 0 {
 		// real and wanted elapsed as milliseconds, bytes as kilobytes
@@ -105,6 +105,51 @@ func TestTransferThrottling(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestTransferThrottlingBurst(t *testing.T) {
+	u := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username:          "test",
+			UploadBandwidth:   64,
+			DownloadBandwidth: 64,
+		},
+		Filters: dataprovider.UserFilters{
+			UploadBurstSize: 131072,
+		},
+	}
+	fs := vfs.NewOsFs("", os.TempDir(), "")
+	conn := NewBaseConnection("id", ProtocolSFTP, "", "", u)
+	uploadBucket, downloadBucket := conn.GetBandwidthBuckets()
+	assert.Nil(t, downloadBucket)
+	if assert.NotNil(t, uploadBucket) {
+		assert.Equal(t, int64(131072), uploadBucket.Size)
+		assert.Equal(t, int64(131072), uploadBucket.Available)
+	}
+	transfer := NewBaseTransfer(nil, conn, nil, "", "", "", TransferUpload, 0, 0, 0, 0, true, fs, dataprovider.TransferQuota{})
+	// the bucket is full so the burst is transferred at line speed
+	startTime := time.Now()
+	transfer.BytesReceived.Store(131072)
+	transfer.HandleThrottle()
+	assert.Less(t, time.Since(startTime), 500*time.Millisecond)
+	uploadBucket, _ = conn.GetBandwidthBuckets()
+	if assert.NotNil(t, uploadBucket) {
+		assert.Less(t, uploadBucket.Available, int64(131072))
+	}
+	// the bucket is empty, 64 KB require about 1 second at 64 KB/s
+	transfer.BytesReceived.Store(131072 + 65536)
+	transfer.HandleThrottle()
+	assert.GreaterOrEqual(t, time.Since(startTime), 900*time.Millisecond)
+	err := transfer.Close()
+	assert.NoError(t, err)
+	// without burst the sustained rate is enforced from the start
+	transfer = NewBaseTransfer(nil, conn, nil, "", "", "", TransferDownload, 0, 0, 0, 0, true, fs, dataprovider.TransferQuota{})
+	startTime = time.Now()
+	transfer.BytesSent.Store(65536)
+	transfer.HandleThrottle()
+	assert.GreaterOrEqual(t, time.Since(startTime), 900*time.Millisecond)
+	err = transfer.Close()
+	assert.NoError(t, err)
+}
+
 func TestRealPath(t *testing.T) {
 	testFile := filepath.Join(os.TempDir(), "afile.txt")
 	fs := vfs.NewOsFs("123", os.TempDir(), "")
@@ -316,6 +361,58 @@ func TestRemovePartialCryptoFile(t *testing.T) {
 	assert.NoFileExists(t, testFile)
 }
 
+func TestDirectStreamUploadError(t *testing.T) {
+	testFile := filepath.Join(os.TempDir(), "direct_upload_test_file")
+	fs := vfs.NewOsFs("id", os.TempDir(), "")
+	u := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "test",
+			HomeDir:  os.TempDir(),
+		},
+		Filters: dataprovider.UserFilters{
+			UploadMode: dataprovider.UploadModeDirectStream,
+		},
+	}
+	conn := NewBaseConnection("id", ProtocolSFTP, "", "", u)
+	assert.False(t, conn.IsAtomicUploadEnabled())
+
+	err := os.WriteFile(testFile, []byte("partial data"), os.ModePerm)
+	assert.NoError(t, err)
+	transfer := NewBaseTransfer(nil, conn, nil, testFile, testFile, "/direct_upload_test_file", TransferUpload,
+		0, 0, 0, 0, true, fs, dataprovider.TransferQuota{})
+	transfer.BytesReceived.Store(12)
+	transfer.TransferError(errors.New("upload error"))
+	err = transfer.Close()
+	assert.Error(t, err)
+	assert.NoFileExists(t, testFile)
+	// resumed upload, the file is truncated to the initial size
+	err = os.WriteFile(testFile, []byte("initial data, partial data"), os.ModePerm)
+	assert.NoError(t, err)
+	transfer = NewBaseTransfer(nil, conn, nil, testFile, testFile, "/direct_upload_test_file", TransferUpload,
+		12, 12, 0, 0, false, fs, dataprovider.TransferQuota{})
+	transfer.BytesReceived.Store(14)
+	transfer.TransferError(errors.New("upload error"))
+	err = transfer.Close()
+	assert.Error(t, err)
+	info, err := os.Stat(testFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(12), info.Size())
+	}
+	// without errors the file is preserved
+	transfer = NewBaseTransfer(nil, conn, nil, testFile, testFile, "/direct_upload_test_file", TransferUpload,
+		0, 0, 0, 0, false, fs, dataprovider.TransferQuota{})
+	err = transfer.Close()
+	assert.NoError(t, err)
+	assert.FileExists(t, testFile)
+	err = os.Remove(testFile)
+	assert.NoError(t, err)
+
+	conn.User.Filters.UploadMode = dataprovider.UploadModeTempFile
+	assert.True(t, conn.IsAtomicUploadEnabled())
+	conn.User.Filters.UploadMode = ""
+	assert.Equal(t, Config.IsAtomicUploadEnabled(), conn.IsAtomicUploadEnabled())
+}
+
 func TestFTPMode(t *testing.T) {
 	conn := NewBaseConnection("", ProtocolFTP, "", "", dataprovider.User{})
 	transfer := BaseTransfer{
@@ -476,3 +573,53 @@ func TestUploadOutsideHomeRenameError(t *testing.T) {
 
 	Config.TempPath = oldTempPath
 }
+
+func benchmarkUpload(b *testing.B, uploadMode string) {
+	data := make([]byte, 1024*1024)
+	homeDir := b.TempDir()
+	fs := vfs.NewOsFs("id", homeDir, "")
+	u := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "test",
+			HomeDir:  homeDir,
+		},
+		Filters: dataprovider.UserFilters{
+			UploadMode: uploadMode,
+		},
+	}
+	conn := NewBaseConnection("id", ProtocolSFTP, "", "", u)
+	fsPath := filepath.Join(homeDir, "upload_file")
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		effectiveFsPath := fsPath
+		if conn.IsAtomicUploadEnabled() {
+			effectiveFsPath = fs.GetAtomicUploadPath(fsPath)
+		}
+		file, _, _, err := fs.Create(effectiveFsPath, 0, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		transfer := NewBaseTransfer(file, conn, nil, fsPath, effectiveFsPath, "/upload_file", TransferUpload,
+			0, 0, 0, 0, true, fs, dataprovider.TransferQuota{})
+		if _, err := file.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		transfer.BytesReceived.Store(int64(len(data)))
+		if err := file.Close(); err != nil {
+			b.Fatal(err)
+		}
+		if err := transfer.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUploadDirectStream(b *testing.B) {
+	benchmarkUpload(b, dataprovider.UploadModeDirectStream)
+}
+
+func BenchmarkUploadTempFile(b *testing.B) {
+	benchmarkUpload(b, dataprovider.UploadModeTempFile)
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/subosito/gotenv"
 
 	"github.com/drakkan/sftpgo/v2/pkg/acme"
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
@@ -74,8 +75,10 @@ var (
 		CertificateKeyFile:         "",
 		MinTLSVersion:              12,
 		ForcePassiveIP:             "",
+		PassiveIPResolver:          "",
 		PassiveIPOverrides:         nil,
 		ClientAuthType:             0,
+		CheckCRLDistributionPoints: false,
 		TLSCipherSuites:            nil,
 		PassiveConnectionsSecurity: 0,
 		ActiveConnectionsSecurity:  0,
@@ -95,6 +98,7 @@ var (
 		ClientIPProxyHeader:  "",
 		ClientIPHeaderDepth:  0,
 		DisableWWWAuthHeader: false,
+		SecurityHeaders:      common.SecurityHeaders{},
 	}
 	defaultHTTPDBinding = httpd.Binding{
 		Address:               "",
@@ -115,6 +119,7 @@ var (
 		HideLoginURL:          0,
 		RenderOpenAPI:         true,
 		WebClientIntegrations: nil,
+		VirtualHosts:          nil,
 		OIDC: httpd.OIDC{
 			ClientID:                   "",
 			ClientSecret:               "",
@@ -145,7 +150,8 @@ var (
 			CrossOriginOpenerPolicy: "",
 			ExpectCTHeader:          "",
 		},
-		Branding: httpd.Branding{},
+		SecurityHeaders: common.SecurityHeaders{},
+		Branding:        httpd.Branding{},
 	}
 	defaultRateLimiter = common.RateLimiterConfig{
 		Average:                0,
@@ -199,6 +205,7 @@ func Init() {
 				ExecuteOn:   []string{},
 				ExecuteSync: []string{},
 				Hook:        "",
+				Pipeline:    []common.PipelineStep{},
 			},
 			SetstatMode:           0,
 			TempPath:              "",
@@ -207,6 +214,7 @@ func Init() {
 			PostConnectHook:       "",
 			PostDisconnectHook:    "",
 			DataRetentionHook:     "",
+			SecurityEventHook:     "",
 			MaxTotalConnections:   0,
 			MaxPerHostConnections: 20,
 			WhiteListFile:         "",
@@ -230,6 +238,27 @@ func Init() {
 				BlockList:          []string{},
 			},
 			RateLimitersConfig: []common.RateLimiterConfig{defaultRateLimiter},
+			DirListCache: common.DirListCacheConfig{
+				Size: 0,
+				TTL:  30,
+			},
+			FileNameSanitize: dataprovider.FileNameSanitizeNone,
+			DirListOrder: common.DirListOrderConfig{
+				Order:     "",
+				DirsFirst: false,
+			},
+			ChecksumVerification:       common.ChecksumVerificationOff,
+			HooksCircuitBreakers:       []circuitbreaker.Config{},
+			ObscureErrorMessages:       false,
+			DiskSpaceSafetyMarginBytes: 0,
+			FolderAuditLogsPath:        "",
+			ProtocolLogLevel:           map[string]string{},
+			AccessLog: common.AccessLogConfig{
+				Format:       "",
+				Path:         "",
+				RotatePolicy: "daily",
+				MaxSize:      0,
+			},
 		},
 		ACME: acme.Configuration{
 			Email:      "",
@@ -266,6 +295,10 @@ func Init() {
 			KeyboardInteractiveHook:           "",
 			PasswordAuthentication:            true,
 			FolderPrefix:                      "",
+			AllowTCPForwarding:                false,
+			MaxTCPForwardings:                 10,
+			MinSFTPVersion:                    0,
+			MaxSFTPVersion:                    0,
 		},
 		FTPD: ftpd.Configuration{
 			Bindings:                 []ftpd.Binding{defaultFTPDBinding},
@@ -276,14 +309,18 @@ func Init() {
 				Start: 50000,
 				End:   50100,
 			},
-			DisableActiveMode:  false,
-			EnableSite:         false,
-			HASHSupport:        0,
-			CombineSupport:     0,
-			CertificateFile:    "",
-			CertificateKeyFile: "",
-			CACertificates:     []string{},
-			CARevocationLists:  []string{},
+			DisableActiveMode:            false,
+			EnableSite:                   false,
+			HASHSupport:                  0,
+			CombineSupport:               0,
+			DisableMLSD:                  false,
+			DisableMLST:                  false,
+			CertificateFile:              "",
+			CertificateKeyFile:           "",
+			CACertificates:               []string{},
+			CARevocationLists:            []string{},
+			ACMEDomain:                   "",
+			CertificateExpiryWarningDays: 7,
 		},
 		WebDAVD: webdavd.Configuration{
 			Bindings:           []webdavd.Binding{defaultWebDAVDBinding},
@@ -313,6 +350,12 @@ func Init() {
 					MaxSize: 1000,
 				},
 			},
+			EnableReport: false,
+			PresignedUploads: webdavd.PresignedUploadsConfig{
+				Enabled:       false,
+				SigningKey:    "",
+				MaxExpiration: 3600,
+			},
 		},
 		ProviderConf: dataprovider.Config{
 			Driver:             "sqlite",
@@ -332,6 +375,7 @@ func Init() {
 			TrackQuota:         2,
 			PoolSize:           0,
 			UsersBaseDir:       "",
+			HomeDirTemplate:    "",
 			Actions: dataprovider.ObjectsActions{
 				ExecuteOn:  []string{},
 				ExecuteFor: []string{},
@@ -357,10 +401,24 @@ func Init() {
 			},
 			PasswordValidation: dataprovider.PasswordValidation{
 				Admins: dataprovider.PasswordValidationRules{
-					MinEntropy: 0,
+					MinEntropy:         0,
+					MinLength:          0,
+					RequireUppercase:   false,
+					RequireLowercase:   false,
+					RequireDigit:       false,
+					RequireSpecial:     false,
+					DisallowUsername:   false,
+					PwnedPasswordCheck: false,
 				},
 				Users: dataprovider.PasswordValidationRules{
-					MinEntropy: 0,
+					MinEntropy:         0,
+					MinLength:          0,
+					RequireUppercase:   false,
+					RequireLowercase:   false,
+					RequireDigit:       false,
+					RequireSpecial:     false,
+					DisallowUsername:   false,
+					PwnedPasswordCheck: false,
 				},
 			},
 			PasswordCaching:    true,
@@ -375,20 +433,43 @@ func Init() {
 				Proto: "http",
 			},
 			BackupsPath: "backups",
+			PublicKeysAudit: dataprovider.PublicKeysAudit{
+				Enabled:         false,
+				MinimumRSABits:  0,
+				MaxAge:          0,
+				RevokedKeysFile: "",
+			},
+			LoginNotifications: dataprovider.LoginNotificationsConfig{
+				KnownIPsRetention: 90,
+				MinInterval:       15,
+				WebClientURL:      "",
+			},
+			UploadSessionsMaxAge: 72,
+			Admins: dataprovider.AdminsConfig{
+				InactivityLockAfterDays: 0,
+				InactivityWarningDays:   0,
+			},
+			AutoVirtualFolders: []dataprovider.AutoVirtualFolderRule{},
+			QuotaWarnings: dataprovider.QuotaWarningsConfig{
+				BCC:          []string{},
+				WebClientURL: "",
+			},
 		},
 		HTTPDConfig: httpd.Conf{
-			Bindings:           []httpd.Binding{defaultHTTPDBinding},
-			TemplatesPath:      "templates",
-			StaticFilesPath:    "static",
-			OpenAPIPath:        "openapi",
-			WebRoot:            "",
-			CertificateFile:    "",
-			CertificateKeyFile: "",
-			CACertificates:     nil,
-			CARevocationLists:  nil,
-			SigningPassphrase:  "",
-			TokenValidation:    0,
-			MaxUploadFileSize:  1048576000,
+			Bindings:              []httpd.Binding{defaultHTTPDBinding},
+			TemplatesPath:         "templates",
+			StaticFilesPath:       "static",
+			OpenAPIPath:           "openapi",
+			WebRoot:               "",
+			CertificateFile:       "",
+			CertificateKeyFile:    "",
+			CACertificates:        nil,
+			CARevocationLists:     nil,
+			SigningPassphrase:     "",
+			TokenValidation:       0,
+			ImpersonationTokenTTL: 15,
+			MaxUploadFileSize:     1048576000,
+			MaxArchiveSize:        0,
 			Cors: httpd.CorsConfig{
 				Enabled:              false,
 				AllowedOrigins:       []string{},
@@ -400,12 +481,36 @@ func Init() {
 				OptionsPassthrough:   false,
 				OptionsSuccessStatus: 0,
 				AllowPrivateNetwork:  false,
+				SharesAllowedOrigins: []string{"*"},
 			},
 			Setup: httpd.SetupConfig{
 				InstallationCode:     "",
 				InstallationCodeHint: defaultInstallCodeHint,
 			},
-			HideSupportLink: false,
+			FilesystemCheck: httpd.FilesystemCheckConfig{
+				Timeout:     5,
+				MinInterval: 10,
+			},
+			OAuth2ResourceServer: httpd.OAuth2ResourceServerConfig{
+				IntrospectionEndpoint: "",
+				ClientID:              "",
+				ClientSecret:          "",
+				Audience:              "",
+				RequiredScopes:        []string{},
+			},
+			GCSNotifications: httpd.GCSNotificationsConfig{
+				Audience:            "",
+				ServiceAccountEmail: "",
+			},
+			HideSupportLink:  false,
+			DisableHTTP2Push: false,
+			RequestSizeLimits: httpd.RequestSizeLimits{
+				Default:        httpd.DefaultRequestSizeLimit,
+				UserBulkImport: httpd.DefaultUserBulkImportSizeLimit,
+				FileUploadMeta: httpd.DefaultFileUploadMetaSizeLimit,
+				AdminConfig:    httpd.DefaultAdminConfigSizeLimit,
+			},
+			LogsStreamBufferSize: 0,
 		},
 		HTTPConfig: httpclient.Config{
 			Timeout:        20,
@@ -427,6 +532,33 @@ func Init() {
 				URL:             "",
 				MasterKeyString: "",
 				MasterKeyPath:   "",
+				AzureKeyVault: kms.AzureKeyVault{
+					VaultURL:   "",
+					KeyName:    "",
+					KeyVersion: "",
+					Algorithm:  "",
+					Credentials: kms.AzureKeyVaultCredentials{
+						Type:          "",
+						TenantID:      "",
+						ClientID:      "",
+						ClientSecret:  "",
+						TokenFilePath: "",
+					},
+					CacheTTL: 300,
+				},
+				Vault: kms.Vault{
+					Address:   "",
+					Namespace: "",
+					Token:     "",
+					AppRole: kms.VaultAppRole{
+						RoleID:    "",
+						SecretID:  "",
+						MountPath: "",
+					},
+					MountPath:           "",
+					KeyName:             "",
+					HealthCheckInterval: 30,
+				},
 			},
 		},
 		MFAConfig: mfa.Config{
@@ -443,15 +575,16 @@ func Init() {
 			TLSCipherSuites:    nil,
 		},
 		SMTPConfig: smtp.Config{
-			Host:          "",
-			Port:          25,
-			From:          "",
-			User:          "",
-			Password:      "",
-			AuthType:      0,
-			Encryption:    0,
-			Domain:        "",
-			TemplatesPath: "templates",
+			Host:               "",
+			Port:               25,
+			From:               "",
+			User:               "",
+			Password:           "",
+			AuthType:           0,
+			Encryption:         0,
+			Domain:             "",
+			TemplatesPath:      "templates",
+			SecurityAlertEmail: "",
 		},
 		PluginsConfig: nil,
 	}
@@ -612,6 +745,7 @@ func getRedactedGlobalConf() globalConfig {
 	conf.Common.PostConnectHook = util.GetRedactedURL(conf.Common.PostConnectHook)
 	conf.Common.PostDisconnectHook = util.GetRedactedURL(conf.Common.PostDisconnectHook)
 	conf.Common.DataRetentionHook = util.GetRedactedURL(conf.Common.DataRetentionHook)
+	conf.Common.SecurityEventHook = util.GetRedactedURL(conf.Common.SecurityEventHook)
 	conf.SFTPD.KeyboardInteractiveHook = util.GetRedactedURL(conf.SFTPD.KeyboardInteractiveHook)
 	conf.HTTPDConfig.SigningPassphrase = getRedactedPassword(conf.HTTPDConfig.SigningPassphrase)
 	conf.HTTPDConfig.Setup.InstallationCode = getRedactedPassword(conf.HTTPDConfig.Setup.InstallationCode)
@@ -765,6 +899,12 @@ func resetInvalidConfigs() {
 		logger.Warn(logSender, "", "Non-fatal configuration error: %v", warn)
 		logger.WarnToConsole("Non-fatal configuration error: %v", warn)
 	}
+	if err := dataprovider.ValidateHomeDirTemplate(globalConf.ProviderConf.HomeDirTemplate); err != nil {
+		warn := fmt.Sprintf("invalid home dir template will be ignored: %v", err)
+		globalConf.ProviderConf.HomeDirTemplate = ""
+		logger.Warn(logSender, "", "Non-fatal configuration error: %v", warn)
+		logger.WarnToConsole("Non-fatal configuration error: %v", warn)
+	}
 	if !isUploadModeValid() {
 		warn := fmt.Sprintf("invalid upload_mode 0, 1 and 2 are supported, configured: %v reset upload_mode to 0",
 			globalConf.Common.UploadMode)
@@ -810,6 +950,24 @@ func loadBindingsFromEnv() {
 		getHTTPClientCertificatesFromEnv(idx)
 		getHTTPClientHeadersFromEnv(idx)
 		getCommandConfigsFromEnv(idx)
+		getHooksCircuitBreakersFromEnv(idx)
+		getPipelineStepsFromEnv(idx)
+		getAutoVirtualFoldersFromEnv(idx)
+	}
+	getProtocolLogLevelFromEnv()
+}
+
+func getProtocolLogLevelFromEnv() {
+	protocols := []string{common.ProtocolSFTP, common.ProtocolSCP, common.ProtocolSSH, common.ProtocolFTP,
+		common.ProtocolWebDAV, common.ProtocolHTTP, common.ProtocolHTTPShare, common.ProtocolOIDC}
+	for _, protocol := range protocols {
+		level, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__PROTOCOL_LOG_LEVEL__%s", strings.ToUpper(protocol)))
+		if ok {
+			if globalConf.Common.ProtocolLogLevel == nil {
+				globalConf.Common.ProtocolLogLevel = make(map[string]string)
+			}
+			globalConf.Common.ProtocolLogLevel[protocol] = level
+		}
 	}
 }
 
@@ -1176,6 +1334,12 @@ func getFTPDBindingFromEnv(idx int) {
 		isSet = true
 	}
 
+	passiveIPResolver, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_FTPD__BINDINGS__%v__PASSIVE_IP_RESOLVER", idx))
+	if ok {
+		binding.PassiveIPResolver = passiveIPResolver
+		isSet = true
+	}
+
 	passiveIPOverrides := getFTPDPassiveIPOverridesFromEnv(idx)
 	if len(passiveIPOverrides) > 0 {
 		binding.PassiveIPOverrides = passiveIPOverrides
@@ -1188,6 +1352,12 @@ func getFTPDBindingFromEnv(idx int) {
 		isSet = true
 	}
 
+	checkCRLDistributionPoints, ok := lookupBoolFromEnv(fmt.Sprintf("SFTPGO_FTPD__BINDINGS__%v__CHECK_CRL_DISTRIBUTION_POINTS", idx))
+	if ok {
+		binding.CheckCRLDistributionPoints = checkCRLDistributionPoints
+		isSet = true
+	}
+
 	tlsCiphers, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_FTPD__BINDINGS__%v__TLS_CIPHER_SUITES", idx))
 	if ok {
 		binding.TLSCipherSuites = tlsCiphers
@@ -1321,6 +1491,13 @@ func getWebDAVDBindingFromEnv(idx int) {
 		isSet = true
 	}
 
+	securityHeaders, ok := getSecurityHeadersFromEnv(fmt.Sprintf("SFTPGO_WEBDAVD__BINDINGS__%v__SECURITY_HEADERS", idx),
+		binding.SecurityHeaders)
+	if ok {
+		binding.SecurityHeaders = securityHeaders
+		isSet = true
+	}
+
 	if isSet {
 		if len(globalConf.WebDAVD.Bindings) > idx {
 			globalConf.WebDAVD.Bindings[idx] = binding
@@ -1365,6 +1542,49 @@ func getHTTPDSecurityProxyHeadersFromEnv(idx int) []httpd.HTTPSProxyHeader {
 	return httpsProxyHeaders
 }
 
+func getSecurityHeadersFromEnv(prefix string, current common.SecurityHeaders) (common.SecurityHeaders, bool) {
+	result := current
+	isSet := false
+
+	preset, ok := os.LookupEnv(fmt.Sprintf("%v__PRESET", prefix))
+	if ok {
+		result.Preset = preset
+		isSet = true
+	}
+
+	var headers []common.HTTPResponseHeader
+	headers = append(headers, current.Headers...)
+	for subIdx := 0; subIdx < 20; subIdx++ {
+		var header common.HTTPResponseHeader
+		var replace bool
+		if len(headers) > subIdx {
+			header = headers[subIdx]
+			replace = true
+		}
+		headerKey, okKey := os.LookupEnv(fmt.Sprintf("%v__HEADERS__%v__KEY", prefix, subIdx))
+		if okKey {
+			header.Key = headerKey
+		}
+		headerVal, okVal := os.LookupEnv(fmt.Sprintf("%v__HEADERS__%v__VALUE", prefix, subIdx))
+		if okVal {
+			header.Value = headerVal
+		}
+		if (okKey || okVal) && header.Key != "" {
+			if replace {
+				headers[subIdx] = header
+			} else {
+				headers = append(headers, header)
+			}
+			isSet = true
+		}
+	}
+	if isSet {
+		result.Headers = headers
+	}
+
+	return result, isSet
+}
+
 func getHTTPDSecurityConfFromEnv(idx int) (httpd.SecurityConf, bool) { //nolint:gocyclo
 	result := defaultHTTPDBinding.Security
 	if len(globalConf.HTTPDConfig.Bindings) > idx {
@@ -1663,6 +1883,60 @@ func getHTTPDWebClientIntegrationsFromEnv(idx int) []httpd.WebClientIntegration
 	return integrations
 }
 
+func getHTTPDVirtualHostsFromEnv(idx int) []httpd.VirtualHost {
+	var vhosts []httpd.VirtualHost
+	if len(globalConf.HTTPDConfig.Bindings) > idx {
+		vhosts = globalConf.HTTPDConfig.Bindings[idx].VirtualHosts
+	}
+
+	for subIdx := 0; subIdx < 20; subIdx++ {
+		var vhost httpd.VirtualHost
+		var replace bool
+		if len(globalConf.HTTPDConfig.Bindings) > idx &&
+			len(globalConf.HTTPDConfig.Bindings[idx].VirtualHosts) > subIdx {
+			vhost = vhosts[subIdx]
+			replace = true
+		}
+		isSet := false
+
+		domain, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_HTTPD__BINDINGS__%v__VIRTUAL_HOSTS__%v__DOMAIN", idx, subIdx))
+		if ok {
+			vhost.Domain = domain
+			isSet = true
+		}
+
+		certFile, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_HTTPD__BINDINGS__%v__VIRTUAL_HOSTS__%v__CERTIFICATE_FILE",
+			idx, subIdx))
+		if ok {
+			vhost.CertificateFile = certFile
+			isSet = true
+		}
+
+		keyFile, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_HTTPD__BINDINGS__%v__VIRTUAL_HOSTS__%v__CERTIFICATE_KEY_FILE",
+			idx, subIdx))
+		if ok {
+			vhost.CertificateKeyFile = keyFile
+			isSet = true
+		}
+
+		basePath, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_HTTPD__BINDINGS__%v__VIRTUAL_HOSTS__%v__BASE_PATH", idx, subIdx))
+		if ok {
+			vhost.BasePath = basePath
+			isSet = true
+		}
+
+		if isSet && vhost.Domain != "" {
+			if replace {
+				vhosts[subIdx] = vhost
+			} else {
+				vhosts = append(vhosts, vhost)
+			}
+		}
+	}
+
+	return vhosts
+}
+
 func getDefaultHTTPBinding(idx int) httpd.Binding {
 	binding := defaultHTTPDBinding
 	if len(globalConf.HTTPDConfig.Bindings) > idx {
@@ -1680,6 +1954,12 @@ func getHTTPDNestedObjectsFromEnv(idx int, binding *httpd.Binding) bool {
 		isSet = true
 	}
 
+	virtualHosts := getHTTPDVirtualHostsFromEnv(idx)
+	if len(virtualHosts) > 0 {
+		binding.VirtualHosts = virtualHosts
+		isSet = true
+	}
+
 	oidc, ok := getHTTPDOIDCFromEnv(idx)
 	if ok {
 		binding.OIDC = oidc
@@ -1692,6 +1972,13 @@ func getHTTPDNestedObjectsFromEnv(idx int, binding *httpd.Binding) bool {
 		isSet = true
 	}
 
+	securityHeaders, ok := getSecurityHeadersFromEnv(fmt.Sprintf("SFTPGO_HTTPD__BINDINGS__%v__SECURITY_HEADERS", idx),
+		binding.SecurityHeaders)
+	if ok {
+		binding.SecurityHeaders = securityHeaders
+		isSet = true
+	}
+
 	brandingConf, ok := getHTTPDBrandingFromEnv(idx)
 	if ok {
 		binding.Branding = brandingConf
@@ -1919,12 +2206,184 @@ func getCommandConfigsFromEnv(idx int) {
 	}
 }
 
+func getPipelineStepsFromEnv(idx int) {
+	step := common.PipelineStep{}
+	if len(globalConf.Common.Actions.Pipeline) > idx {
+		step = globalConf.Common.Actions.Pipeline[idx]
+	}
+
+	isSet := false
+
+	name, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__NAME", idx))
+	if ok {
+		step.Name = name
+		isSet = true
+	}
+
+	stepType, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__TYPE", idx))
+	if ok {
+		step.Type = stepType
+		isSet = true
+	}
+
+	target, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__TARGET", idx))
+	if ok {
+		step.Target = target
+		isSet = true
+	}
+
+	filePatterns, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__FILE_PATTERNS", idx))
+	if ok {
+		step.FilePatterns = filePatterns
+		isSet = true
+	}
+
+	users, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__USERS", idx))
+	if ok {
+		step.Users = users
+		isSet = true
+	}
+
+	onFailure, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__ON_FAILURE", idx))
+	if ok {
+		step.OnFailure = onFailure
+		isSet = true
+	}
+
+	timeout, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__PIPELINE__%v__TIMEOUT", idx))
+	if ok {
+		step.Timeout = int(timeout)
+		isSet = true
+	}
+
+	if isSet {
+		if len(globalConf.Common.Actions.Pipeline) > idx {
+			globalConf.Common.Actions.Pipeline[idx] = step
+		} else {
+			globalConf.Common.Actions.Pipeline = append(globalConf.Common.Actions.Pipeline, step)
+		}
+	}
+}
+
+func getHooksCircuitBreakersFromEnv(idx int) {
+	cfg := circuitbreaker.Config{}
+	if len(globalConf.Common.HooksCircuitBreakers) > idx {
+		cfg = globalConf.Common.HooksCircuitBreakers[idx]
+	}
+
+	isSet := false
+
+	hook, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__%v__HOOK", idx))
+	if ok {
+		cfg.Hook = hook
+		isSet = true
+	}
+
+	threshold, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__%v__FAILURE_THRESHOLD", idx))
+	if ok {
+		cfg.FailureThreshold = int(threshold)
+		isSet = true
+	}
+
+	window, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__%v__FAILURE_WINDOW", idx))
+	if ok {
+		cfg.FailureWindow = int(window)
+		isSet = true
+	}
+
+	recoveryTimeout, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__%v__RECOVERY_TIMEOUT", idx))
+	if ok {
+		cfg.RecoveryTimeout = int(recoveryTimeout)
+		isSet = true
+	}
+
+	failOpen, ok := lookupBoolFromEnv(fmt.Sprintf("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__%v__FAIL_OPEN", idx))
+	if ok {
+		cfg.FailOpen = failOpen
+		isSet = true
+	}
+
+	if isSet {
+		if len(globalConf.Common.HooksCircuitBreakers) > idx {
+			globalConf.Common.HooksCircuitBreakers[idx] = cfg
+		} else {
+			globalConf.Common.HooksCircuitBreakers = append(globalConf.Common.HooksCircuitBreakers, cfg)
+		}
+	}
+}
+
+func getAutoVirtualFoldersFromEnv(idx int) {
+	rule := dataprovider.AutoVirtualFolderRule{}
+	if len(globalConf.ProviderConf.AutoVirtualFolders) > idx {
+		rule = globalConf.ProviderConf.AutoVirtualFolders[idx]
+	}
+
+	isSet := false
+
+	condition, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__CONDITION", idx))
+	if ok {
+		rule.Condition = condition
+		isSet = true
+	}
+
+	attribute, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__ATTRIBUTE", idx))
+	if ok {
+		rule.Attribute = attribute
+		isSet = true
+	}
+
+	value, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__VALUE", idx))
+	if ok {
+		rule.Value = value
+		isSet = true
+	}
+
+	folderName, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__FOLDER_NAME", idx))
+	if ok {
+		rule.FolderName = folderName
+		isSet = true
+	}
+
+	virtualPath, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__VIRTUAL_PATH", idx))
+	if ok {
+		rule.VirtualPath = virtualPath
+		isSet = true
+	}
+
+	quotaSize, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__QUOTA_SIZE", idx))
+	if ok {
+		rule.QuotaSize = quotaSize
+		isSet = true
+	}
+
+	quotaFiles, ok := lookupIntFromEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__QUOTA_FILES", idx))
+	if ok {
+		rule.QuotaFiles = int(quotaFiles)
+		isSet = true
+	}
+
+	readOnly, ok := lookupBoolFromEnv(fmt.Sprintf("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__%v__READ_ONLY", idx))
+	if ok {
+		rule.ReadOnly = readOnly
+		isSet = true
+	}
+
+	if isSet {
+		if len(globalConf.ProviderConf.AutoVirtualFolders) > idx {
+			globalConf.ProviderConf.AutoVirtualFolders[idx] = rule
+		} else {
+			globalConf.ProviderConf.AutoVirtualFolders = append(globalConf.ProviderConf.AutoVirtualFolders, rule)
+		}
+	}
+}
+
 func setViperDefaults() {
 	viper.SetDefault("common.idle_timeout", globalConf.Common.IdleTimeout)
 	viper.SetDefault("common.upload_mode", globalConf.Common.UploadMode)
 	viper.SetDefault("common.actions.execute_on", globalConf.Common.Actions.ExecuteOn)
 	viper.SetDefault("common.actions.execute_sync", globalConf.Common.Actions.ExecuteSync)
 	viper.SetDefault("common.actions.hook", globalConf.Common.Actions.Hook)
+	viper.SetDefault("common.actions.pipeline", globalConf.Common.Actions.Pipeline)
 	viper.SetDefault("common.setstat_mode", globalConf.Common.SetstatMode)
 	viper.SetDefault("common.temp_path", globalConf.Common.TempPath)
 	viper.SetDefault("common.proxy_protocol", globalConf.Common.ProxyProtocol)
@@ -1932,6 +2391,7 @@ func setViperDefaults() {
 	viper.SetDefault("common.post_connect_hook", globalConf.Common.PostConnectHook)
 	viper.SetDefault("common.post_disconnect_hook", globalConf.Common.PostDisconnectHook)
 	viper.SetDefault("common.data_retention_hook", globalConf.Common.DataRetentionHook)
+	viper.SetDefault("common.security_event_hook", globalConf.Common.SecurityEventHook)
 	viper.SetDefault("common.max_total_connections", globalConf.Common.MaxTotalConnections)
 	viper.SetDefault("common.max_per_host_connections", globalConf.Common.MaxPerHostConnections)
 	viper.SetDefault("common.whitelist_file", globalConf.Common.WhiteListFile)
@@ -1952,6 +2412,20 @@ func setViperDefaults() {
 	viper.SetDefault("common.defender.blocklist_file", globalConf.Common.DefenderConfig.BlockListFile)
 	viper.SetDefault("common.defender.safelist", globalConf.Common.DefenderConfig.SafeList)
 	viper.SetDefault("common.defender.blocklist", globalConf.Common.DefenderConfig.BlockList)
+	viper.SetDefault("common.dir_list_cache.size", globalConf.Common.DirListCache.Size)
+	viper.SetDefault("common.dir_list_cache.ttl", globalConf.Common.DirListCache.TTL)
+	viper.SetDefault("common.file_name_sanitize", globalConf.Common.FileNameSanitize)
+	viper.SetDefault("common.dir_list_order.order", globalConf.Common.DirListOrder.Order)
+	viper.SetDefault("common.dir_list_order.dirs_first", globalConf.Common.DirListOrder.DirsFirst)
+	viper.SetDefault("common.checksum_verification", globalConf.Common.ChecksumVerification)
+	viper.SetDefault("common.obscure_error_messages", globalConf.Common.ObscureErrorMessages)
+	viper.SetDefault("common.disk_space_safety_margin_bytes", globalConf.Common.DiskSpaceSafetyMarginBytes)
+	viper.SetDefault("common.folder_audit_logs_path", globalConf.Common.FolderAuditLogsPath)
+	viper.SetDefault("common.access_log.format", globalConf.Common.AccessLog.Format)
+	viper.SetDefault("common.access_log.path", globalConf.Common.AccessLog.Path)
+	viper.SetDefault("common.access_log.rotate_policy", globalConf.Common.AccessLog.RotatePolicy)
+	viper.SetDefault("common.access_log.max_size", globalConf.Common.AccessLog.MaxSize)
+	viper.SetDefault("common.protocol_log_level", globalConf.Common.ProtocolLogLevel)
 	viper.SetDefault("acme.email", globalConf.ACME.Email)
 	viper.SetDefault("acme.key_type", globalConf.ACME.KeyType)
 	viper.SetDefault("acme.certs_path", globalConf.ACME.CertsPath)
@@ -1979,6 +2453,10 @@ func setViperDefaults() {
 	viper.SetDefault("sftpd.keyboard_interactive_auth_hook", globalConf.SFTPD.KeyboardInteractiveHook)
 	viper.SetDefault("sftpd.password_authentication", globalConf.SFTPD.PasswordAuthentication)
 	viper.SetDefault("sftpd.folder_prefix", globalConf.SFTPD.FolderPrefix)
+	viper.SetDefault("sftpd.allow_tcp_forwarding", globalConf.SFTPD.AllowTCPForwarding)
+	viper.SetDefault("sftpd.max_tcp_forwardings", globalConf.SFTPD.MaxTCPForwardings)
+	viper.SetDefault("sftpd.min_sftp_version", globalConf.SFTPD.MinSFTPVersion)
+	viper.SetDefault("sftpd.max_sftp_version", globalConf.SFTPD.MaxSFTPVersion)
 	viper.SetDefault("ftpd.banner", globalConf.FTPD.Banner)
 	viper.SetDefault("ftpd.banner_file", globalConf.FTPD.BannerFile)
 	viper.SetDefault("ftpd.active_transfers_port_non_20", globalConf.FTPD.ActiveTransfersPortNon20)
@@ -1988,10 +2466,14 @@ func setViperDefaults() {
 	viper.SetDefault("ftpd.enable_site", globalConf.FTPD.EnableSite)
 	viper.SetDefault("ftpd.hash_support", globalConf.FTPD.HASHSupport)
 	viper.SetDefault("ftpd.combine_support", globalConf.FTPD.CombineSupport)
+	viper.SetDefault("ftpd.disable_mlsd", globalConf.FTPD.DisableMLSD)
+	viper.SetDefault("ftpd.disable_mlst", globalConf.FTPD.DisableMLST)
 	viper.SetDefault("ftpd.certificate_file", globalConf.FTPD.CertificateFile)
 	viper.SetDefault("ftpd.certificate_key_file", globalConf.FTPD.CertificateKeyFile)
 	viper.SetDefault("ftpd.ca_certificates", globalConf.FTPD.CACertificates)
 	viper.SetDefault("ftpd.ca_revocation_lists", globalConf.FTPD.CARevocationLists)
+	viper.SetDefault("ftpd.acme_domain", globalConf.FTPD.ACMEDomain)
+	viper.SetDefault("ftpd.certificate_expiry_warning_days", globalConf.FTPD.CertificateExpiryWarningDays)
 	viper.SetDefault("webdavd.certificate_file", globalConf.WebDAVD.CertificateFile)
 	viper.SetDefault("webdavd.certificate_key_file", globalConf.WebDAVD.CertificateKeyFile)
 	viper.SetDefault("webdavd.ca_certificates", globalConf.WebDAVD.CACertificates)
@@ -2010,6 +2492,10 @@ func setViperDefaults() {
 	viper.SetDefault("webdavd.cache.users.max_size", globalConf.WebDAVD.Cache.Users.MaxSize)
 	viper.SetDefault("webdavd.cache.mime_types.enabled", globalConf.WebDAVD.Cache.MimeTypes.Enabled)
 	viper.SetDefault("webdavd.cache.mime_types.max_size", globalConf.WebDAVD.Cache.MimeTypes.MaxSize)
+	viper.SetDefault("webdavd.enable_report", globalConf.WebDAVD.EnableReport)
+	viper.SetDefault("webdavd.presigned_uploads.enabled", globalConf.WebDAVD.PresignedUploads.Enabled)
+	viper.SetDefault("webdavd.presigned_uploads.signing_key", globalConf.WebDAVD.PresignedUploads.SigningKey)
+	viper.SetDefault("webdavd.presigned_uploads.max_expiration", globalConf.WebDAVD.PresignedUploads.MaxExpiration)
 	viper.SetDefault("data_provider.driver", globalConf.ProviderConf.Driver)
 	viper.SetDefault("data_provider.name", globalConf.ProviderConf.Name)
 	viper.SetDefault("data_provider.host", globalConf.ProviderConf.Host)
@@ -2027,6 +2513,7 @@ func setViperDefaults() {
 	viper.SetDefault("data_provider.track_quota", globalConf.ProviderConf.TrackQuota)
 	viper.SetDefault("data_provider.pool_size", globalConf.ProviderConf.PoolSize)
 	viper.SetDefault("data_provider.users_base_dir", globalConf.ProviderConf.UsersBaseDir)
+	viper.SetDefault("data_provider.home_dir_template", globalConf.ProviderConf.HomeDirTemplate)
 	viper.SetDefault("data_provider.actions.execute_on", globalConf.ProviderConf.Actions.ExecuteOn)
 	viper.SetDefault("data_provider.actions.execute_for", globalConf.ProviderConf.Actions.ExecuteFor)
 	viper.SetDefault("data_provider.actions.hook", globalConf.ProviderConf.Actions.Hook)
@@ -2044,6 +2531,34 @@ func setViperDefaults() {
 	viper.SetDefault("data_provider.password_hashing.algo", globalConf.ProviderConf.PasswordHashing.Algo)
 	viper.SetDefault("data_provider.password_validation.admins.min_entropy", globalConf.ProviderConf.PasswordValidation.Admins.MinEntropy)
 	viper.SetDefault("data_provider.password_validation.users.min_entropy", globalConf.ProviderConf.PasswordValidation.Users.MinEntropy)
+	viper.SetDefault("data_provider.password_validation.admins.min_length",
+		globalConf.ProviderConf.PasswordValidation.Admins.MinLength)
+	viper.SetDefault("data_provider.password_validation.admins.require_uppercase",
+		globalConf.ProviderConf.PasswordValidation.Admins.RequireUppercase)
+	viper.SetDefault("data_provider.password_validation.admins.require_lowercase",
+		globalConf.ProviderConf.PasswordValidation.Admins.RequireLowercase)
+	viper.SetDefault("data_provider.password_validation.admins.require_digit",
+		globalConf.ProviderConf.PasswordValidation.Admins.RequireDigit)
+	viper.SetDefault("data_provider.password_validation.admins.require_special",
+		globalConf.ProviderConf.PasswordValidation.Admins.RequireSpecial)
+	viper.SetDefault("data_provider.password_validation.admins.disallow_username",
+		globalConf.ProviderConf.PasswordValidation.Admins.DisallowUsername)
+	viper.SetDefault("data_provider.password_validation.admins.pwned_password_check",
+		globalConf.ProviderConf.PasswordValidation.Admins.PwnedPasswordCheck)
+	viper.SetDefault("data_provider.password_validation.users.min_length",
+		globalConf.ProviderConf.PasswordValidation.Users.MinLength)
+	viper.SetDefault("data_provider.password_validation.users.require_uppercase",
+		globalConf.ProviderConf.PasswordValidation.Users.RequireUppercase)
+	viper.SetDefault("data_provider.password_validation.users.require_lowercase",
+		globalConf.ProviderConf.PasswordValidation.Users.RequireLowercase)
+	viper.SetDefault("data_provider.password_validation.users.require_digit",
+		globalConf.ProviderConf.PasswordValidation.Users.RequireDigit)
+	viper.SetDefault("data_provider.password_validation.users.require_special",
+		globalConf.ProviderConf.PasswordValidation.Users.RequireSpecial)
+	viper.SetDefault("data_provider.password_validation.users.disallow_username",
+		globalConf.ProviderConf.PasswordValidation.Users.DisallowUsername)
+	viper.SetDefault("data_provider.password_validation.users.pwned_password_check",
+		globalConf.ProviderConf.PasswordValidation.Users.PwnedPasswordCheck)
 	viper.SetDefault("data_provider.password_caching", globalConf.ProviderConf.PasswordCaching)
 	viper.SetDefault("data_provider.update_mode", globalConf.ProviderConf.UpdateMode)
 	viper.SetDefault("data_provider.delayed_quota_update", globalConf.ProviderConf.DelayedQuotaUpdate)
@@ -2054,6 +2569,18 @@ func setViperDefaults() {
 	viper.SetDefault("data_provider.node.port", globalConf.ProviderConf.Node.Port)
 	viper.SetDefault("data_provider.node.proto", globalConf.ProviderConf.Node.Proto)
 	viper.SetDefault("data_provider.backups_path", globalConf.ProviderConf.BackupsPath)
+	viper.SetDefault("data_provider.public_keys_audit.enabled", globalConf.ProviderConf.PublicKeysAudit.Enabled)
+	viper.SetDefault("data_provider.public_keys_audit.minimum_rsa_bits", globalConf.ProviderConf.PublicKeysAudit.MinimumRSABits)
+	viper.SetDefault("data_provider.public_keys_audit.max_age", globalConf.ProviderConf.PublicKeysAudit.MaxAge)
+	viper.SetDefault("data_provider.public_keys_audit.revoked_keys_file", globalConf.ProviderConf.PublicKeysAudit.RevokedKeysFile)
+	viper.SetDefault("data_provider.login_notifications.known_ips_retention", globalConf.ProviderConf.LoginNotifications.KnownIPsRetention)
+	viper.SetDefault("data_provider.login_notifications.min_interval", globalConf.ProviderConf.LoginNotifications.MinInterval)
+	viper.SetDefault("data_provider.login_notifications.web_client_url", globalConf.ProviderConf.LoginNotifications.WebClientURL)
+	viper.SetDefault("data_provider.upload_sessions_max_age", globalConf.ProviderConf.UploadSessionsMaxAge)
+	viper.SetDefault("data_provider.admins.inactivity_lock_after_days", globalConf.ProviderConf.Admins.InactivityLockAfterDays)
+	viper.SetDefault("data_provider.admins.inactivity_warning_days", globalConf.ProviderConf.Admins.InactivityWarningDays)
+	viper.SetDefault("data_provider.quota_warnings.bcc", globalConf.ProviderConf.QuotaWarnings.BCC)
+	viper.SetDefault("data_provider.quota_warnings.web_client_url", globalConf.ProviderConf.QuotaWarnings.WebClientURL)
 	viper.SetDefault("httpd.templates_path", globalConf.HTTPDConfig.TemplatesPath)
 	viper.SetDefault("httpd.static_files_path", globalConf.HTTPDConfig.StaticFilesPath)
 	viper.SetDefault("httpd.openapi_path", globalConf.HTTPDConfig.OpenAPIPath)
@@ -2064,7 +2591,9 @@ func setViperDefaults() {
 	viper.SetDefault("httpd.ca_revocation_lists", globalConf.HTTPDConfig.CARevocationLists)
 	viper.SetDefault("httpd.signing_passphrase", globalConf.HTTPDConfig.SigningPassphrase)
 	viper.SetDefault("httpd.token_validation", globalConf.HTTPDConfig.TokenValidation)
+	viper.SetDefault("httpd.impersonation_token_ttl", globalConf.HTTPDConfig.ImpersonationTokenTTL)
 	viper.SetDefault("httpd.max_upload_file_size", globalConf.HTTPDConfig.MaxUploadFileSize)
+	viper.SetDefault("httpd.max_archive_size", globalConf.HTTPDConfig.MaxArchiveSize)
 	viper.SetDefault("httpd.cors.enabled", globalConf.HTTPDConfig.Cors.Enabled)
 	viper.SetDefault("httpd.cors.allowed_origins", globalConf.HTTPDConfig.Cors.AllowedOrigins)
 	viper.SetDefault("httpd.cors.allowed_methods", globalConf.HTTPDConfig.Cors.AllowedMethods)
@@ -2075,9 +2604,28 @@ func setViperDefaults() {
 	viper.SetDefault("httpd.cors.options_passthrough", globalConf.HTTPDConfig.Cors.OptionsPassthrough)
 	viper.SetDefault("httpd.cors.options_success_status", globalConf.HTTPDConfig.Cors.OptionsSuccessStatus)
 	viper.SetDefault("httpd.cors.allow_private_network", globalConf.HTTPDConfig.Cors.AllowPrivateNetwork)
+	viper.SetDefault("httpd.cors.shares_allowed_origins", globalConf.HTTPDConfig.Cors.SharesAllowedOrigins)
 	viper.SetDefault("httpd.setup.installation_code", globalConf.HTTPDConfig.Setup.InstallationCode)
 	viper.SetDefault("httpd.setup.installation_code_hint", globalConf.HTTPDConfig.Setup.InstallationCodeHint)
+	viper.SetDefault("httpd.filesystem_check.timeout", globalConf.HTTPDConfig.FilesystemCheck.Timeout)
+	viper.SetDefault("httpd.filesystem_check.min_interval", globalConf.HTTPDConfig.FilesystemCheck.MinInterval)
+	viper.SetDefault("httpd.oauth2_resource_server.introspection_endpoint",
+		globalConf.HTTPDConfig.OAuth2ResourceServer.IntrospectionEndpoint)
+	viper.SetDefault("httpd.oauth2_resource_server.client_id", globalConf.HTTPDConfig.OAuth2ResourceServer.ClientID)
+	viper.SetDefault("httpd.oauth2_resource_server.client_secret", globalConf.HTTPDConfig.OAuth2ResourceServer.ClientSecret)
+	viper.SetDefault("httpd.oauth2_resource_server.audience", globalConf.HTTPDConfig.OAuth2ResourceServer.Audience)
+	viper.SetDefault("httpd.oauth2_resource_server.required_scopes",
+		globalConf.HTTPDConfig.OAuth2ResourceServer.RequiredScopes)
+	viper.SetDefault("httpd.gcs_notifications.audience", globalConf.HTTPDConfig.GCSNotifications.Audience)
+	viper.SetDefault("httpd.gcs_notifications.service_account_email",
+		globalConf.HTTPDConfig.GCSNotifications.ServiceAccountEmail)
 	viper.SetDefault("httpd.hide_support_link", globalConf.HTTPDConfig.HideSupportLink)
+	viper.SetDefault("httpd.disable_http2_push", globalConf.HTTPDConfig.DisableHTTP2Push)
+	viper.SetDefault("httpd.request_size_limits.default", globalConf.HTTPDConfig.RequestSizeLimits.Default)
+	viper.SetDefault("httpd.request_size_limits.user_bulk_import", globalConf.HTTPDConfig.RequestSizeLimits.UserBulkImport)
+	viper.SetDefault("httpd.request_size_limits.file_upload_meta", globalConf.HTTPDConfig.RequestSizeLimits.FileUploadMeta)
+	viper.SetDefault("httpd.request_size_limits.admin_config", globalConf.HTTPDConfig.RequestSizeLimits.AdminConfig)
+	viper.SetDefault("httpd.logs_stream_buffer_size", globalConf.HTTPDConfig.LogsStreamBufferSize)
 	viper.SetDefault("http.timeout", globalConf.HTTPConfig.Timeout)
 	viper.SetDefault("http.retry_wait_min", globalConf.HTTPConfig.RetryWaitMin)
 	viper.SetDefault("http.retry_wait_max", globalConf.HTTPConfig.RetryWaitMax)
@@ -2089,6 +2637,25 @@ func setViperDefaults() {
 	viper.SetDefault("kms.secrets.url", globalConf.KMSConfig.Secrets.URL)
 	viper.SetDefault("kms.secrets.master_key", globalConf.KMSConfig.Secrets.MasterKeyString)
 	viper.SetDefault("kms.secrets.master_key_path", globalConf.KMSConfig.Secrets.MasterKeyPath)
+	viper.SetDefault("kms.secrets.azure_key_vault.vault_url", globalConf.KMSConfig.Secrets.AzureKeyVault.VaultURL)
+	viper.SetDefault("kms.secrets.azure_key_vault.key_name", globalConf.KMSConfig.Secrets.AzureKeyVault.KeyName)
+	viper.SetDefault("kms.secrets.azure_key_vault.key_version", globalConf.KMSConfig.Secrets.AzureKeyVault.KeyVersion)
+	viper.SetDefault("kms.secrets.azure_key_vault.algorithm", globalConf.KMSConfig.Secrets.AzureKeyVault.Algorithm)
+	viper.SetDefault("kms.secrets.azure_key_vault.credentials.type", globalConf.KMSConfig.Secrets.AzureKeyVault.Credentials.Type)
+	viper.SetDefault("kms.secrets.azure_key_vault.credentials.tenant_id", globalConf.KMSConfig.Secrets.AzureKeyVault.Credentials.TenantID)
+	viper.SetDefault("kms.secrets.azure_key_vault.credentials.client_id", globalConf.KMSConfig.Secrets.AzureKeyVault.Credentials.ClientID)
+	viper.SetDefault("kms.secrets.azure_key_vault.credentials.client_secret", globalConf.KMSConfig.Secrets.AzureKeyVault.Credentials.ClientSecret)
+	viper.SetDefault("kms.secrets.azure_key_vault.credentials.token_file_path", globalConf.KMSConfig.Secrets.AzureKeyVault.Credentials.TokenFilePath)
+	viper.SetDefault("kms.secrets.azure_key_vault.cache_ttl", globalConf.KMSConfig.Secrets.AzureKeyVault.CacheTTL)
+	viper.SetDefault("kms.secrets.vault.address", globalConf.KMSConfig.Secrets.Vault.Address)
+	viper.SetDefault("kms.secrets.vault.namespace", globalConf.KMSConfig.Secrets.Vault.Namespace)
+	viper.SetDefault("kms.secrets.vault.token", globalConf.KMSConfig.Secrets.Vault.Token)
+	viper.SetDefault("kms.secrets.vault.approle.role_id", globalConf.KMSConfig.Secrets.Vault.AppRole.RoleID)
+	viper.SetDefault("kms.secrets.vault.approle.secret_id", globalConf.KMSConfig.Secrets.Vault.AppRole.SecretID)
+	viper.SetDefault("kms.secrets.vault.approle.mount_path", globalConf.KMSConfig.Secrets.Vault.AppRole.MountPath)
+	viper.SetDefault("kms.secrets.vault.mount_path", globalConf.KMSConfig.Secrets.Vault.MountPath)
+	viper.SetDefault("kms.secrets.vault.key_name", globalConf.KMSConfig.Secrets.Vault.KeyName)
+	viper.SetDefault("kms.secrets.vault.health_check_interval", globalConf.KMSConfig.Secrets.Vault.HealthCheckInterval)
 	viper.SetDefault("telemetry.bind_port", globalConf.TelemetryConfig.BindPort)
 	viper.SetDefault("telemetry.bind_address", globalConf.TelemetryConfig.BindAddress)
 	viper.SetDefault("telemetry.enable_profiler", globalConf.TelemetryConfig.EnableProfiler)
@@ -2106,6 +2673,7 @@ func setViperDefaults() {
 	viper.SetDefault("smtp.encryption", globalConf.SMTPConfig.Encryption)
 	viper.SetDefault("smtp.domain", globalConf.SMTPConfig.Domain)
 	viper.SetDefault("smtp.templates_path", globalConf.SMTPConfig.TemplatesPath)
+	viper.SetDefault("smtp.security_alert_email", globalConf.SMTPConfig.SecurityAlertEmail)
 }
 
 func lookupBoolFromEnv(envName string) (bool, bool) {
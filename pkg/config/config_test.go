@@ -268,6 +268,35 @@ func TestInvalidUsersBaseDir(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHomeDirTemplate(t *testing.T) {
+	reset()
+
+	confName := tempConfigName + ".json"
+	configFilePath := filepath.Join(configDir, confName)
+	err := config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	providerConf := config.GetProviderConf()
+	for _, tpl := range []string{"{username}", "/srv/{user}/{username}", "/srv/{username", "/srv/{group}"} {
+		providerConf.HomeDirTemplate = tpl
+		c := make(map[string]dataprovider.Config)
+		c["data_provider"] = providerConf
+		jsonConf, err := json.Marshal(c)
+		assert.NoError(t, err)
+		err = os.WriteFile(configFilePath, jsonConf, os.ModePerm)
+		assert.NoError(t, err)
+		err = config.LoadConfig(configDir, confName)
+		assert.NoError(t, err)
+		assert.Empty(t, config.GetProviderConf().HomeDirTemplate, tpl)
+	}
+	tpl := filepath.Join(os.TempDir(), "{group}", "{first_char}", "{date}", "{username}")
+	t.Setenv("SFTPGO_DATA_PROVIDER__HOME_DIR_TEMPLATE", tpl)
+	err = config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, tpl, config.GetProviderConf().HomeDirTemplate)
+	err = os.Remove(configFilePath)
+	assert.NoError(t, err)
+}
+
 func TestInvalidInstallationHint(t *testing.T) {
 	reset()
 
@@ -629,21 +658,35 @@ func TestHTTPDSubObjectsFromEnv(t *testing.T) {
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY__HTTPS_PROXY_HEADERS__0__VALUE", "https")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__WEB_CLIENT_INTEGRATIONS__0__URL", "http://127.0.0.1/")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__WEB_CLIENT_INTEGRATIONS__0__FILE_EXTENSIONS", ".pdf, .txt")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__DOMAIN", "files.example.com")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__CERTIFICATE_FILE", "files.crt")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__CERTIFICATE_KEY_FILE", "files.key")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__BASE_PATH", "/web/client")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CLIENT_ID", "client_id")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CLIENT_SECRET", "client_secret")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CONFIG_URL", "config_url")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__REDIRECT_BASE_URL", "redirect_base_url")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__USERNAME_FIELD", "email")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__PRESET", "strict")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__HEADERS__0__KEY", "Permissions-Policy")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__HEADERS__0__VALUE", "camera=()")
 	cleanup := func() {
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY__HTTPS_PROXY_HEADERS__0__KEY")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY__HTTPS_PROXY_HEADERS__0__VALUE")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__WEB_CLIENT_INTEGRATIONS__0__URL")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__WEB_CLIENT_INTEGRATIONS__0__FILE_EXTENSIONS")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__DOMAIN")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__CERTIFICATE_FILE")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__CERTIFICATE_KEY_FILE")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__BASE_PATH")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CLIENT_ID")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CLIENT_SECRET")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CONFIG_URL")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__REDIRECT_BASE_URL")
 		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__USERNAME_FIELD")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__PRESET")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__HEADERS__0__KEY")
+		os.Unsetenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__HEADERS__0__VALUE")
 	}
 	t.Cleanup(cleanup)
 
@@ -653,11 +696,19 @@ func TestHTTPDSubObjectsFromEnv(t *testing.T) {
 	require.Len(t, httpdConf.Bindings, 1)
 	require.Len(t, httpdConf.Bindings[0].Security.HTTPSProxyHeaders, 1)
 	require.Len(t, httpdConf.Bindings[0].WebClientIntegrations, 1)
+	require.Len(t, httpdConf.Bindings[0].VirtualHosts, 1)
+	require.Equal(t, "files.example.com", httpdConf.Bindings[0].VirtualHosts[0].Domain)
+	require.Equal(t, "files.crt", httpdConf.Bindings[0].VirtualHosts[0].CertificateFile)
+	require.Equal(t, "files.key", httpdConf.Bindings[0].VirtualHosts[0].CertificateKeyFile)
+	require.Equal(t, "/web/client", httpdConf.Bindings[0].VirtualHosts[0].BasePath)
 	require.Equal(t, "client_id", httpdConf.Bindings[0].OIDC.ClientID)
 	require.Equal(t, "client_secret", httpdConf.Bindings[0].OIDC.ClientSecret)
 	require.Equal(t, "config_url", httpdConf.Bindings[0].OIDC.ConfigURL)
 	require.Equal(t, "redirect_base_url", httpdConf.Bindings[0].OIDC.RedirectBaseURL)
 	require.Equal(t, "email", httpdConf.Bindings[0].OIDC.UsernameField)
+	require.Equal(t, "strict", httpdConf.Bindings[0].SecurityHeaders.Preset)
+	require.Len(t, httpdConf.Bindings[0].SecurityHeaders.Headers, 1)
+	require.Equal(t, "camera=()", httpdConf.Bindings[0].SecurityHeaders.Headers[0].Value)
 
 	cleanup()
 	cfg := make(map[string]any)
@@ -671,7 +722,9 @@ func TestHTTPDSubObjectsFromEnv(t *testing.T) {
 
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY__HTTPS_PROXY_HEADERS__0__VALUE", "http")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__WEB_CLIENT_INTEGRATIONS__0__URL", "http://127.0.1.1/")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__VIRTUAL_HOSTS__0__BASE_PATH", "/web/admin")
 	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__OIDC__CLIENT_SECRET", "new_client_secret")
+	os.Setenv("SFTPGO_HTTPD__BINDINGS__0__SECURITY_HEADERS__HEADERS__0__VALUE", "")
 	err = config.LoadConfig(configDir, confName)
 	assert.NoError(t, err)
 	httpdConf = config.GetHTTPDConfig()
@@ -680,11 +733,18 @@ func TestHTTPDSubObjectsFromEnv(t *testing.T) {
 	require.Equal(t, "http", httpdConf.Bindings[0].Security.HTTPSProxyHeaders[0].Value)
 	require.Len(t, httpdConf.Bindings[0].WebClientIntegrations, 1)
 	require.Equal(t, "http://127.0.1.1/", httpdConf.Bindings[0].WebClientIntegrations[0].URL)
+	require.Len(t, httpdConf.Bindings[0].VirtualHosts, 1)
+	require.Equal(t, "files.example.com", httpdConf.Bindings[0].VirtualHosts[0].Domain)
+	require.Equal(t, "/web/admin", httpdConf.Bindings[0].VirtualHosts[0].BasePath)
 	require.Equal(t, "client_id", httpdConf.Bindings[0].OIDC.ClientID)
 	require.Equal(t, "new_client_secret", httpdConf.Bindings[0].OIDC.ClientSecret)
 	require.Equal(t, "config_url", httpdConf.Bindings[0].OIDC.ConfigURL)
 	require.Equal(t, "redirect_base_url", httpdConf.Bindings[0].OIDC.RedirectBaseURL)
 	require.Equal(t, "email", httpdConf.Bindings[0].OIDC.UsernameField)
+	require.Equal(t, "strict", httpdConf.Bindings[0].SecurityHeaders.Preset)
+	require.Len(t, httpdConf.Bindings[0].SecurityHeaders.Headers, 1)
+	require.Equal(t, "Permissions-Policy", httpdConf.Bindings[0].SecurityHeaders.Headers[0].Key)
+	require.Empty(t, httpdConf.Bindings[0].SecurityHeaders.Headers[0].Value)
 
 	err = os.Remove(configFilePath)
 	assert.NoError(t, err)
@@ -884,6 +944,91 @@ func TestSFTPDBindingsFromEnv(t *testing.T) {
 	require.True(t, bindings[1].ApplyProxyConfig) // default value
 }
 
+func TestHooksCircuitBreakersFromEnv(t *testing.T) {
+	reset()
+
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__HOOK", "pre_login")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAILURE_THRESHOLD", "5")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAILURE_WINDOW", "60")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__RECOVERY_TIMEOUT", "30")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAIL_OPEN", "1")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__2__HOOK", "post_connect")
+	os.Setenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__2__FAILURE_THRESHOLD", "3")
+	t.Cleanup(func() {
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__HOOK")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAILURE_THRESHOLD")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAILURE_WINDOW")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__RECOVERY_TIMEOUT")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__0__FAIL_OPEN")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__2__HOOK")
+		os.Unsetenv("SFTPGO_COMMON__HOOKS_CIRCUIT_BREAKERS__2__FAILURE_THRESHOLD")
+	})
+
+	err := config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	breakers := config.GetCommonConfig().HooksCircuitBreakers
+	require.Len(t, breakers, 2)
+	require.Equal(t, "pre_login", breakers[0].Hook)
+	require.Equal(t, 5, breakers[0].FailureThreshold)
+	require.Equal(t, 60, breakers[0].FailureWindow)
+	require.Equal(t, 30, breakers[0].RecoveryTimeout)
+	require.True(t, breakers[0].FailOpen)
+	require.Equal(t, "post_connect", breakers[1].Hook)
+	require.Equal(t, 3, breakers[1].FailureThreshold)
+	require.Equal(t, 0, breakers[1].RecoveryTimeout)
+	require.False(t, breakers[1].FailOpen)
+}
+
+func TestAutoVirtualFoldersFromEnv(t *testing.T) {
+	reset()
+
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__CONDITION", "group")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__VALUE", "research")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__FOLDER_NAME", "datasets")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__VIRTUAL_PATH", "/datasets")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__QUOTA_SIZE", "-1")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__QUOTA_FILES", "-1")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__READ_ONLY", "true")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__CONDITION", "attribute")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__ATTRIBUTE", "email")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__VALUE", "*@example.com")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__FOLDER_NAME", "scratch")
+	os.Setenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__VIRTUAL_PATH", "/scratch/{username}")
+	t.Cleanup(func() {
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__CONDITION")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__VALUE")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__FOLDER_NAME")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__VIRTUAL_PATH")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__QUOTA_SIZE")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__QUOTA_FILES")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__0__READ_ONLY")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__CONDITION")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__ATTRIBUTE")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__VALUE")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__FOLDER_NAME")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__AUTO_VIRTUAL_FOLDERS__1__VIRTUAL_PATH")
+	})
+
+	err := config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	rules := config.GetProviderConf().AutoVirtualFolders
+	require.Len(t, rules, 2)
+	require.Equal(t, "group", rules[0].Condition)
+	require.Equal(t, "research", rules[0].Value)
+	require.Equal(t, "datasets", rules[0].FolderName)
+	require.Equal(t, "/datasets", rules[0].VirtualPath)
+	require.Equal(t, int64(-1), rules[0].QuotaSize)
+	require.Equal(t, -1, rules[0].QuotaFiles)
+	require.True(t, rules[0].ReadOnly)
+	require.Equal(t, "attribute", rules[1].Condition)
+	require.Equal(t, "email", rules[1].Attribute)
+	require.Equal(t, "*@example.com", rules[1].Value)
+	require.Equal(t, "scratch", rules[1].FolderName)
+	require.Equal(t, "/scratch/{username}", rules[1].VirtualPath)
+	require.Equal(t, int64(0), rules[1].QuotaSize)
+	require.False(t, rules[1].ReadOnly)
+}
+
 func TestCommandsFromEnv(t *testing.T) {
 	reset()
 
@@ -962,9 +1107,11 @@ func TestFTPDBindingsFromEnv(t *testing.T) {
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__TLS_MODE", "1")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__MIN_TLS_VERSION", "13")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__FORCE_PASSIVE_IP", "127.0.1.1")
+	os.Setenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_RESOLVER", "https://api.ipify.org")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_OVERRIDES__3__IP", "192.168.1.1")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_OVERRIDES__3__NETWORKS", "192.168.1.0/24, 192.168.3.0/25")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__CLIENT_AUTH_TYPE", "2")
+	os.Setenv("SFTPGO_FTPD__BINDINGS__9__CHECK_CRL_DISTRIBUTION_POINTS", "true")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__DEBUG", "1")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__ACTIVE_CONNECTIONS_SECURITY", "1")
 	os.Setenv("SFTPGO_FTPD__BINDINGS__9__CERTIFICATE_FILE", "cert.crt")
@@ -984,9 +1131,11 @@ func TestFTPDBindingsFromEnv(t *testing.T) {
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__TLS_MODE")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__MIN_TLS_VERSION")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__FORCE_PASSIVE_IP")
+		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_RESOLVER")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_OVERRIDES__3__IP")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__PASSIVE_IP_OVERRIDES__3__NETWORKS")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__CLIENT_AUTH_TYPE")
+		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__CHECK_CRL_DISTRIBUTION_POINTS")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__DEBUG")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__ACTIVE_CONNECTIONS_SECURITY")
 		os.Unsetenv("SFTPGO_FTPD__BINDINGS__9__CERTIFICATE_FILE")
@@ -1003,8 +1152,10 @@ func TestFTPDBindingsFromEnv(t *testing.T) {
 	require.Equal(t, 2, bindings[0].TLSMode)
 	require.Equal(t, 12, bindings[0].MinTLSVersion)
 	require.Equal(t, "127.0.1.2", bindings[0].ForcePassiveIP)
+	require.Empty(t, bindings[0].PassiveIPResolver)
 	require.Len(t, bindings[0].PassiveIPOverrides, 0)
 	require.Equal(t, 0, bindings[0].ClientAuthType)
+	require.False(t, bindings[0].CheckCRLDistributionPoints)
 	require.Len(t, bindings[0].TLSCipherSuites, 2)
 	require.Equal(t, "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256", bindings[0].TLSCipherSuites[0])
 	require.Equal(t, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", bindings[0].TLSCipherSuites[1])
@@ -1017,12 +1168,14 @@ func TestFTPDBindingsFromEnv(t *testing.T) {
 	require.Equal(t, 1, bindings[1].TLSMode)
 	require.Equal(t, 13, bindings[1].MinTLSVersion)
 	require.Equal(t, "127.0.1.1", bindings[1].ForcePassiveIP)
+	require.Equal(t, "https://api.ipify.org", bindings[1].PassiveIPResolver)
 	require.Len(t, bindings[1].PassiveIPOverrides, 1)
 	require.Equal(t, "192.168.1.1", bindings[1].PassiveIPOverrides[0].IP)
 	require.Len(t, bindings[1].PassiveIPOverrides[0].Networks, 2)
 	require.Equal(t, "192.168.1.0/24", bindings[1].PassiveIPOverrides[0].Networks[0])
 	require.Equal(t, "192.168.3.0/25", bindings[1].PassiveIPOverrides[0].Networks[1])
 	require.Equal(t, 2, bindings[1].ClientAuthType)
+	require.True(t, bindings[1].CheckCRLDistributionPoints)
 	require.Nil(t, bindings[1].TLSCipherSuites)
 	require.Equal(t, 0, bindings[1].PassiveConnectionsSecurity)
 	require.Equal(t, 1, bindings[1].ActiveConnectionsSecurity)
@@ -1050,6 +1203,9 @@ func TestWebDAVBindingsFromEnv(t *testing.T) {
 	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__CERTIFICATE_FILE", "webdav.crt")
 	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__CERTIFICATE_KEY_FILE", "webdav.key")
 	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__DISABLE_WWW_AUTH_HEADER", "1")
+	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__PRESET", "api")
+	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__HEADERS__0__KEY", "X-Frame-Options")
+	os.Setenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__HEADERS__0__VALUE", "DENY")
 
 	t.Cleanup(func() {
 		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__1__ADDRESS")
@@ -1068,6 +1224,9 @@ func TestWebDAVBindingsFromEnv(t *testing.T) {
 		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__CERTIFICATE_FILE")
 		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__CERTIFICATE_KEY_FILE")
 		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__DISABLE_WWW_AUTH_HEADER")
+		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__PRESET")
+		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__HEADERS__0__KEY")
+		os.Unsetenv("SFTPGO_WEBDAVD__BINDINGS__2__SECURITY_HEADERS__HEADERS__0__VALUE")
 	})
 
 	err := config.LoadConfig(configDir, "")
@@ -1105,6 +1264,12 @@ func TestWebDAVBindingsFromEnv(t *testing.T) {
 	require.Equal(t, "webdav.key", bindings[2].CertificateKeyFile)
 	require.Equal(t, 0, bindings[2].ClientIPHeaderDepth)
 	require.True(t, bindings[2].DisableWWWAuthHeader)
+	require.Empty(t, bindings[1].SecurityHeaders.Preset)
+	require.Len(t, bindings[1].SecurityHeaders.Headers, 0)
+	require.Equal(t, "api", bindings[2].SecurityHeaders.Preset)
+	require.Len(t, bindings[2].SecurityHeaders.Headers, 1)
+	require.Equal(t, "X-Frame-Options", bindings[2].SecurityHeaders.Headers[0].Key)
+	require.Equal(t, "DENY", bindings[2].SecurityHeaders.Headers[0].Value)
 }
 
 func TestHTTPDBindingsFromEnv(t *testing.T) {
@@ -1498,10 +1663,15 @@ func TestConfigFromEnv(t *testing.T) {
 	os.Setenv("SFTPGO_DATA_PROVIDER__POOL_SIZE", "10")
 	os.Setenv("SFTPGO_DATA_PROVIDER__IS_SHARED", "1")
 	os.Setenv("SFTPGO_DATA_PROVIDER__ACTIONS__EXECUTE_ON", "add")
+	os.Setenv("SFTPGO_DATA_PROVIDER__LOGIN_NOTIFICATIONS__MIN_INTERVAL", "5")
 	os.Setenv("SFTPGO_KMS__SECRETS__URL", "local")
 	os.Setenv("SFTPGO_KMS__SECRETS__MASTER_KEY_PATH", "path")
 	os.Setenv("SFTPGO_TELEMETRY__TLS_CIPHER_SUITES", "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA")
 	os.Setenv("SFTPGO_HTTPD__SETUP__INSTALLATION_CODE", "123")
+	os.Setenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__INTROSPECTION_ENDPOINT", "https://auth.example.com/introspect")
+	os.Setenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__REQUIRED_SCOPES", "sftpgo,api")
+	os.Setenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__AUDIENCE", "sftpgo-api")
+	os.Setenv("SFTPGO_HTTPD__REQUEST_SIZE_LIMITS__USER_BULK_IMPORT", "20971520")
 	os.Setenv("SFTPGO_ACME__HTTP01_CHALLENGE__PORT", "5002")
 	t.Cleanup(func() {
 		os.Unsetenv("SFTPGO_SFTPD__BINDINGS__0__ADDRESS")
@@ -1510,10 +1680,15 @@ func TestConfigFromEnv(t *testing.T) {
 		os.Unsetenv("SFTPGO_DATA_PROVIDER__POOL_SIZE")
 		os.Unsetenv("SFTPGO_DATA_PROVIDER__IS_SHARED")
 		os.Unsetenv("SFTPGO_DATA_PROVIDER__ACTIONS__EXECUTE_ON")
+		os.Unsetenv("SFTPGO_DATA_PROVIDER__LOGIN_NOTIFICATIONS__MIN_INTERVAL")
 		os.Unsetenv("SFTPGO_KMS__SECRETS__URL")
 		os.Unsetenv("SFTPGO_KMS__SECRETS__MASTER_KEY_PATH")
 		os.Unsetenv("SFTPGO_TELEMETRY__TLS_CIPHER_SUITES")
 		os.Unsetenv("SFTPGO_HTTPD__SETUP__INSTALLATION_CODE")
+		os.Unsetenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__INTROSPECTION_ENDPOINT")
+		os.Unsetenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__REQUIRED_SCOPES")
+		os.Unsetenv("SFTPGO_HTTPD__OAUTH2_RESOURCE_SERVER__AUDIENCE")
+		os.Unsetenv("SFTPGO_HTTPD__REQUEST_SIZE_LIMITS__USER_BULK_IMPORT")
 		os.Unsetenv("SFTPGO_ACME__HTTP01_CHALLENGE_PORT")
 	})
 	err := config.LoadConfig(".", "invalid config")
@@ -1527,6 +1702,8 @@ func TestConfigFromEnv(t *testing.T) {
 	assert.Equal(t, 1, dataProviderConf.IsShared)
 	assert.Len(t, dataProviderConf.Actions.ExecuteOn, 1)
 	assert.Contains(t, dataProviderConf.Actions.ExecuteOn, "add")
+	assert.Equal(t, 5, dataProviderConf.LoginNotifications.MinInterval)
+	assert.Equal(t, 90, dataProviderConf.LoginNotifications.KnownIPsRetention)
 	kmsConfig := config.GetKMSConfig()
 	assert.Equal(t, "local", kmsConfig.Secrets.URL)
 	assert.Equal(t, "path", kmsConfig.Secrets.MasterKeyPath)
@@ -1535,6 +1712,32 @@ func TestConfigFromEnv(t *testing.T) {
 	assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", telemetryConfig.TLSCipherSuites[0])
 	assert.Equal(t, "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA", telemetryConfig.TLSCipherSuites[1])
 	assert.Equal(t, "123", config.GetHTTPDConfig().Setup.InstallationCode)
+	oauth2RSConfig := config.GetHTTPDConfig().OAuth2ResourceServer
+	assert.Equal(t, "https://auth.example.com/introspect", oauth2RSConfig.IntrospectionEndpoint)
+	assert.Equal(t, []string{"sftpgo", "api"}, oauth2RSConfig.RequiredScopes)
+	assert.Equal(t, "sftpgo-api", oauth2RSConfig.Audience)
+	requestSizeLimits := config.GetHTTPDConfig().RequestSizeLimits
+	assert.Equal(t, int64(20971520), requestSizeLimits.UserBulkImport)
+	assert.Equal(t, int64(httpd.DefaultRequestSizeLimit), requestSizeLimits.Default)
+	assert.Equal(t, int64(httpd.DefaultAdminConfigSizeLimit), requestSizeLimits.AdminConfig)
 	acmeConfig := config.GetACMEConfig()
 	assert.Equal(t, 5002, acmeConfig.HTTP01Challenge.Port)
 }
+
+func TestProtocolLogLevelFromEnv(t *testing.T) {
+	reset()
+
+	os.Setenv("SFTPGO_COMMON__PROTOCOL_LOG_LEVEL__SFTP", "warn")
+	os.Setenv("SFTPGO_COMMON__PROTOCOL_LOG_LEVEL__DAV", "error")
+	t.Cleanup(func() {
+		os.Unsetenv("SFTPGO_COMMON__PROTOCOL_LOG_LEVEL__SFTP")
+		os.Unsetenv("SFTPGO_COMMON__PROTOCOL_LOG_LEVEL__DAV")
+	})
+
+	err := config.LoadConfig(configDir, "")
+	assert.NoError(t, err)
+	levels := config.GetCommonConfig().ProtocolLogLevel
+	require.Len(t, levels, 2)
+	require.Equal(t, "warn", levels[common.ProtocolSFTP])
+	require.Equal(t, "error", levels[common.ProtocolWebDAV])
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os/exec"
 	"path/filepath"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/sftpgo/sdk/plugin/notifier"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
@@ -107,12 +109,19 @@ func executeAction(operation, executor, ip, objectType, objectName string, objec
 			q.Add("timestamp", fmt.Sprintf("%d", time.Now().UnixNano()))
 			url.RawQuery = q.Encode()
 			startTime := time.Now()
-			resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(dataAsJSON))
 			respCode := 0
-			if err == nil {
+			err = circuitbreaker.Execute(command.HookProviderActions, func() error {
+				resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(dataAsJSON))
+				if err != nil {
+					return err
+				}
 				respCode = resp.StatusCode
 				resp.Body.Close()
-			}
+				if respCode >= http.StatusInternalServerError {
+					return fmt.Errorf("unexpected status code: %d", respCode)
+				}
+				return nil
+			})
 			providerLog(logger.LevelDebug, "notified operation %#v to URL: %v status code: %v, elapsed: %v err: %v",
 				operation, url.Redacted(), respCode, time.Since(startTime), err)
 		} else {
@@ -143,7 +152,14 @@ func executeNotificationCommand(operation, executor, ip, objectType, objectName
 		fmt.Sprintf("SFTPGO_PROVIDER_OBJECT=%s", string(objectAsJSON)))
 
 	startTime := time.Now()
-	err := cmd.Run()
+	var cmdErr error
+	err := circuitbreaker.Execute(command.HookProviderActions, func() error {
+		cmdErr = cmd.Run()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
 	providerLog(logger.LevelDebug, "executed command %#v, elapsed: %v, error: %v", config.Actions.Hook,
 		time.Since(startTime), err)
 	return err
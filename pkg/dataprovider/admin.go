@@ -26,7 +26,6 @@ import (
 
 	"github.com/alexedwards/argon2id"
 	"github.com/sftpgo/sdk"
-	passwordvalidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
@@ -47,6 +46,7 @@ const (
 	PermAdminViewServerStatus = "view_status"
 	PermAdminManageAdmins     = "manage_admins"
 	PermAdminManageGroups     = "manage_groups"
+	PermAdminManageFolders    = "manage_folders"
 	PermAdminManageAPIKeys    = "manage_apikeys"
 	PermAdminQuotaScans       = "quota_scans"
 	PermAdminManageSystem     = "manage_system"
@@ -56,6 +56,7 @@ const (
 	PermAdminMetadataChecks   = "metadata_checks"
 	PermAdminViewEvents       = "view_events"
 	PermAdminManageEventRules = "manage_event_rules"
+	PermAdminManageCaches     = "manage_caches"
 )
 
 const (
@@ -69,10 +70,10 @@ const (
 
 var (
 	validAdminPerms = []string{PermAdminAny, PermAdminAddUsers, PermAdminChangeUsers, PermAdminDeleteUsers,
-		PermAdminViewUsers, PermAdminManageGroups, PermAdminViewConnections, PermAdminCloseConnections,
+		PermAdminViewUsers, PermAdminManageGroups, PermAdminManageFolders, PermAdminViewConnections, PermAdminCloseConnections,
 		PermAdminViewServerStatus, PermAdminManageAdmins, PermAdminManageEventRules, PermAdminManageAPIKeys,
 		PermAdminQuotaScans, PermAdminManageSystem, PermAdminManageDefender, PermAdminViewDefender,
-		PermAdminRetentionChecks, PermAdminMetadataChecks, PermAdminViewEvents}
+		PermAdminRetentionChecks, PermAdminMetadataChecks, PermAdminViewEvents, PermAdminManageCaches}
 )
 
 // AdminTOTPConfig defines the time-based one time password configuration
@@ -191,6 +192,9 @@ type AdminFilters struct {
 	AllowList []string `json:"allow_list,omitempty"`
 	// API key auth allows to impersonate this administrator with an API key
 	AllowAPIKeyAuth bool `json:"allow_api_key_auth,omitempty"`
+	// Allow to authenticate to the REST API using access tokens issued by the
+	// configured external OAuth2 authorization server
+	AllowExternalTokenAuth bool `json:"allow_external_token_auth,omitempty"`
 	// Time-based one time passwords configuration
 	TOTPConfig AdminTOTPConfig `json:"totp_config,omitempty"`
 	// Recovery codes to use if the user loses access to their second factor auth device.
@@ -252,6 +256,9 @@ type Admin struct {
 	UpdatedAt int64 `json:"updated_at"`
 	// Last login as unix timestamp in milliseconds
 	LastLogin int64 `json:"last_login"`
+	// Locked is set for admins locked for inactivity, login is not allowed
+	// until a super admin unlocks the account
+	Locked bool `json:"locked,omitempty"`
 }
 
 // CountUnusedRecoveryCodes returns the number of unused recovery codes
@@ -267,10 +274,8 @@ func (a *Admin) CountUnusedRecoveryCodes() int {
 
 func (a *Admin) hashPassword() error {
 	if a.Password != "" && !util.IsStringPrefixInSlice(a.Password, internalHashPwdPrefixes) {
-		if config.PasswordValidation.Admins.MinEntropy > 0 {
-			if err := passwordvalidator.Validate(a.Password, config.PasswordValidation.Admins.MinEntropy); err != nil {
-				return util.NewValidationError(err.Error())
-			}
+		if err := config.PasswordValidation.Admins.checkPassword(a.Username, a.Password); err != nil {
+			return err
 		}
 		if config.PasswordHashing.Algo == HashingAlgoBcrypt {
 			pwd, err := bcrypt.GenerateFromPassword([]byte(a.Password), config.PasswordHashing.BcryptOptions.Cost)
@@ -439,6 +444,13 @@ func (a *Admin) CanLoginFromIP(ip string) bool {
 
 // CanLogin returns an error if the login is not allowed
 func (a *Admin) CanLogin(ip string) error {
+	if err := a.checkLoginConditions(ip); err != nil {
+		return err
+	}
+	return a.checkLocked()
+}
+
+func (a *Admin) checkLoginConditions(ip string) error {
 	if a.Status != 1 {
 		return fmt.Errorf("admin %#v is disabled", a.Username)
 	}
@@ -448,8 +460,28 @@ func (a *Admin) CanLogin(ip string) error {
 	return nil
 }
 
+func (a *Admin) checkLocked() error {
+	if a.Locked {
+		return fmt.Errorf("%w: %q", ErrAdminLocked, a.Username)
+	}
+	return nil
+}
+
+// getLastActivity returns the last login or, if more recent, the creation
+// or the last update time. Unlocking an admin updates the last update time
+func (a *Admin) getLastActivity() int64 {
+	lastActivity := a.LastLogin
+	if a.CreatedAt > lastActivity {
+		lastActivity = a.CreatedAt
+	}
+	if a.UpdatedAt > lastActivity {
+		lastActivity = a.UpdatedAt
+	}
+	return lastActivity
+}
+
 func (a *Admin) checkUserAndPass(password, ip string) error {
-	if err := a.CanLogin(ip); err != nil {
+	if err := a.checkLoginConditions(ip); err != nil {
 		return err
 	}
 	if a.Password == "" || password == "" {
@@ -462,7 +494,8 @@ func (a *Admin) checkUserAndPass(password, ip string) error {
 	if !match {
 		return ErrInvalidCredentials
 	}
-	return nil
+	// the lock status is only revealed to admins providing valid credentials
+	return a.checkLocked()
 }
 
 // RenderAsJSON implements the renderer interface used within plugins
@@ -518,6 +551,16 @@ func (a *Admin) HasPermission(perm string) bool {
 	return util.Contains(a.Permissions, perm)
 }
 
+// HasAnyPermission returns true if the admin has at least one of the specified permissions
+func (a *Admin) HasAnyPermission(perms ...string) bool {
+	for _, perm := range perms {
+		if a.HasPermission(perm) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetPermissionsAsString returns permission as string
 func (a *Admin) GetPermissionsAsString() string {
 	return strings.Join(a.Permissions, ", ")
@@ -559,6 +602,7 @@ func (a *Admin) getACopy() Admin {
 	filters := AdminFilters{}
 	filters.AllowList = make([]string, len(a.Filters.AllowList))
 	filters.AllowAPIKeyAuth = a.Filters.AllowAPIKeyAuth
+	filters.AllowExternalTokenAuth = a.Filters.AllowExternalTokenAuth
 	filters.TOTPConfig.Enabled = a.Filters.TOTPConfig.Enabled
 	filters.TOTPConfig.ConfigName = a.Filters.TOTPConfig.ConfigName
 	filters.TOTPConfig.Secret = a.Filters.TOTPConfig.Secret.Clone()
@@ -600,6 +644,7 @@ func (a *Admin) getACopy() Admin {
 		LastLogin:      a.LastLogin,
 		CreatedAt:      a.CreatedAt,
 		UpdatedAt:      a.UpdatedAt,
+		Locked:         a.Locked,
 	}
 }
 
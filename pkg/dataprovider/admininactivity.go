@@ -0,0 +1,112 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// AdminsConfig defines the configuration for the admin accounts
+type AdminsConfig struct {
+	// Admins that have not logged in for the specified number of days are locked.
+	// The first created admin is never locked. 0 means no automatic lock
+	InactivityLockAfterDays int `json:"inactivity_lock_after_days" mapstructure:"inactivity_lock_after_days"`
+	// If an SMTP server is configured, the admins are notified via email the
+	// specified number of days before locking. 0 means no notification
+	InactivityWarningDays int `json:"inactivity_warning_days" mapstructure:"inactivity_warning_days"`
+}
+
+func (c *AdminsConfig) validate() error {
+	if c.InactivityLockAfterDays < 0 {
+		return fmt.Errorf("invalid admins inactivity lock days: %d", c.InactivityLockAfterDays)
+	}
+	if c.InactivityWarningDays < 0 || (c.InactivityWarningDays > 0 && c.InactivityWarningDays >= c.InactivityLockAfterDays) {
+		return fmt.Errorf("invalid admins inactivity warning days: %d, it must be lower than the lock days", c.InactivityWarningDays)
+	}
+	return nil
+}
+
+func (c *AdminsConfig) isInactivityLockEnabled() bool {
+	return c.InactivityLockAfterDays > 0
+}
+
+// lockInactiveAdmins locks the admins that have not logged in for the configured
+// number of days and warns the ones that will be locked soon.
+// It is executed once a day so the warning is sent once
+func lockInactiveAdmins() {
+	if !config.Admins.isInactivityLockEnabled() {
+		return
+	}
+	admins, err := provider.dumpAdmins()
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get admins for the inactivity check: %v", err)
+		return
+	}
+	if len(admins) < 2 {
+		return
+	}
+	firstAdminID := admins[0].ID
+	for idx := range admins {
+		if admins[idx].ID < firstAdminID {
+			firstAdminID = admins[idx].ID
+		}
+	}
+	now := time.Now()
+	numLocked := 0
+	for idx := range admins {
+		admin := &admins[idx]
+		if admin.ID == firstAdminID || admin.Locked {
+			continue
+		}
+		inactiveDays := int(now.Sub(util.GetTimeFromMsecSinceEpoch(admin.getLastActivity())) / (24 * time.Hour))
+		if inactiveDays >= config.Admins.InactivityLockAfterDays {
+			if err := provider.setAdminLocked(admin.Username, true); err != nil {
+				providerLog(logger.LevelError, "unable to lock inactive admin %q: %v", admin.Username, err)
+				continue
+			}
+			providerLog(logger.LevelInfo, "admin %q locked, inactive for %d days", admin.Username, inactiveDays)
+			admin.Locked = true
+			executeAction(operationUpdate, ActionExecutorSystem, "", actionObjectAdmin, admin.Username, admin)
+			numLocked++
+			continue
+		}
+		if config.Admins.InactivityWarningDays > 0 &&
+			inactiveDays == config.Admins.InactivityLockAfterDays-config.Admins.InactivityWarningDays {
+			notifyInactiveAdmin(admin)
+		}
+	}
+	providerLog(logger.LevelDebug, "admins inactivity check completed, locked admins: %d", numLocked)
+}
+
+func notifyInactiveAdmin(admin *Admin) {
+	if admin.Email == "" || admin.Status != 1 || !smtp.IsEnabled() {
+		return
+	}
+	body := fmt.Sprintf("Hello %s,\n\nyour SFTPGo admin account has not been used for %d days and it will be "+
+		"locked in %d days. Log in to keep your account active.\n", admin.Username,
+		config.Admins.InactivityLockAfterDays-config.Admins.InactivityWarningDays, config.Admins.InactivityWarningDays)
+	err := smtp.SendEmail([]string{admin.Email}, "SFTPGo - Admin account inactivity", body,
+		smtp.EmailContentTypeTextPlain)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to notify inactive admin %q: %v", admin.Username, err)
+		return
+	}
+	providerLog(logger.LevelDebug, "inactive admin %q notified", admin.Username)
+}
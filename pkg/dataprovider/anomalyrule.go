@@ -0,0 +1,131 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported anomaly rule types
+const (
+	// More than the threshold downloaded files within the window
+	AnomalyRuleDownloads = "downloads"
+	// More than the threshold deleted files within the window
+	AnomalyRuleDeletions = "deletions"
+	// File access outside the allowed hours
+	AnomalyRuleUnusualHours = "unusual_hours"
+	// File access from more than the threshold distinct networks within the window
+	AnomalyRuleMultipleNetworks = "multiple_networks"
+)
+
+var supportedAnomalyRuleTypes = []string{AnomalyRuleDownloads, AnomalyRuleDeletions, AnomalyRuleUnusualHours,
+	AnomalyRuleMultipleNetworks}
+
+// AnomalyRule defines a threshold based rule to detect unusual file access patterns
+type AnomalyRule struct {
+	// Rule type
+	Type string `json:"type"`
+	// The rule triggers if the events within the window exceed this threshold.
+	// Not used for the unusual hours rules
+	Threshold int `json:"threshold,omitempty"`
+	// Window as minutes. Not used for the unusual hours rules
+	Window int `json:"window,omitempty"`
+	// Allowed hours, as UTC, for the unusual hours rules. The file accesses
+	// outside the [StartHour, EndHour) range trigger the rule. If StartHour
+	// is greater than EndHour the range spans midnight
+	StartHour int `json:"start_hour,omitempty"`
+	EndHour   int `json:"end_hour,omitempty"`
+	// Only log the triggers without emitting security events
+	Simulate bool `json:"simulate,omitempty"`
+}
+
+func (r *AnomalyRule) validate() error {
+	if !util.Contains(supportedAnomalyRuleTypes, r.Type) {
+		return util.NewValidationError(fmt.Sprintf("invalid anomaly rule type %q", r.Type))
+	}
+	if r.Type == AnomalyRuleUnusualHours {
+		if r.StartHour < 0 || r.StartHour > 23 || r.EndHour < 0 || r.EndHour > 23 {
+			return util.NewValidationError(fmt.Sprintf("invalid anomaly rule hours %d-%d, allowed values: 0-23",
+				r.StartHour, r.EndHour))
+		}
+		if r.StartHour == r.EndHour {
+			return util.NewValidationError("invalid anomaly rule hours, the start and end hours must be different")
+		}
+		r.Threshold = 0
+		r.Window = 0
+		return nil
+	}
+	if r.Threshold <= 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid anomaly rule threshold: %d", r.Threshold))
+	}
+	if r.Window <= 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid anomaly rule window: %d", r.Window))
+	}
+	r.StartHour = 0
+	r.EndHour = 0
+	return nil
+}
+
+// IsAllowedHour returns true if the specified hour is inside the allowed hours
+func (r *AnomalyRule) IsAllowedHour(hour int) bool {
+	if r.StartHour < r.EndHour {
+		return hour >= r.StartHour && hour < r.EndHour
+	}
+	return hour >= r.StartHour || hour < r.EndHour
+}
+
+// GetDescription returns a human readable description for this rule
+func (r *AnomalyRule) GetDescription() string {
+	switch r.Type {
+	case AnomalyRuleDownloads:
+		return fmt.Sprintf("more than %d downloads in %d minutes", r.Threshold, r.Window)
+	case AnomalyRuleDeletions:
+		return fmt.Sprintf("more than %d deletions in %d minutes", r.Threshold, r.Window)
+	case AnomalyRuleUnusualHours:
+		return fmt.Sprintf("access outside the allowed hours %02d:00-%02d:00 UTC", r.StartHour, r.EndHour)
+	case AnomalyRuleMultipleNetworks:
+		return fmt.Sprintf("access from more than %d networks in %d minutes", r.Threshold, r.Window)
+	default:
+		return r.Type
+	}
+}
+
+func validateAnomalyRules(user *User) error {
+	seen := make(map[string]bool)
+	for idx := range user.Filters.AnomalyRules {
+		rule := &user.Filters.AnomalyRules[idx]
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if seen[rule.Type] {
+			return util.NewValidationError(fmt.Sprintf("duplicated anomaly rule type %q", rule.Type))
+		}
+		seen[rule.Type] = true
+	}
+	return nil
+}
+
+// GetAnomalyRule returns the anomaly rule with the specified type, the
+// returned rule has an empty type if the user has no such rule
+func (u *User) GetAnomalyRule(ruleType string) AnomalyRule {
+	for _, rule := range u.Filters.AnomalyRules {
+		if rule.Type == ruleType {
+			return rule
+		}
+	}
+	return AnomalyRule{}
+}
@@ -17,6 +17,8 @@ package dataprovider
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"path"
 	"strings"
 	"time"
 
@@ -38,6 +40,84 @@ const (
 	APIKeyScopeUser
 )
 
+// Supported API key operations
+const (
+	APIKeyOperationCreate = "create"
+	APIKeyOperationRead   = "read"
+	APIKeyOperationUpdate = "update"
+	APIKeyOperationDelete = "delete"
+)
+
+// maximum number of users patterns for an API key, the patterns are used
+// as query arguments to list the allowed users
+const maxAPIKeyUsersPatterns = 40
+
+var (
+	validAPIKeyOperations = []string{APIKeyOperationCreate, APIKeyOperationRead, APIKeyOperationUpdate,
+		APIKeyOperationDelete}
+)
+
+// APIKeyFilters defines optional restrictions for API keys
+type APIKeyFilters struct {
+	// Usernames, or shell like patterns, of the users that can be managed using
+	// this key. "*" and "?" wildcards are supported, character classes are not.
+	// Only supported for keys with admin scope. Empty means no restrictions
+	Users []string `json:"users,omitempty"`
+	// Allowed operations. Empty means all operations are allowed
+	Operations []string `json:"operations,omitempty"`
+	// IP addresses/networks, in CIDR notation, allowed to use this key.
+	// Empty means no restrictions
+	AllowedIP []string `json:"allowed_ip,omitempty"`
+}
+
+func (f *APIKeyFilters) getACopy() APIKeyFilters {
+	users := make([]string, len(f.Users))
+	copy(users, f.Users)
+	operations := make([]string, len(f.Operations))
+	copy(operations, f.Operations)
+	allowedIP := make([]string, len(f.AllowedIP))
+	copy(allowedIP, f.AllowedIP)
+
+	return APIKeyFilters{
+		Users:      users,
+		Operations: operations,
+		AllowedIP:  allowedIP,
+	}
+}
+
+func (f *APIKeyFilters) validate(scope APIKeyScope) error {
+	if scope != APIKeyScopeAdmin {
+		f.Users = nil
+	}
+	f.Users = util.RemoveDuplicates(f.Users, false)
+	if len(f.Users) > maxAPIKeyUsersPatterns {
+		return util.NewValidationError(fmt.Sprintf("too many users patterns, the maximum allowed is %d",
+			maxAPIKeyUsersPatterns))
+	}
+	for _, pattern := range f.Users {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return util.NewValidationError(fmt.Sprintf("invalid users pattern %q: %v", pattern, err))
+		}
+		if hasCharacterClass(pattern) {
+			return util.NewValidationError(fmt.Sprintf("invalid users pattern %q: character classes are not supported",
+				pattern))
+		}
+	}
+	f.Operations = util.RemoveDuplicates(f.Operations, true)
+	for _, op := range f.Operations {
+		if !util.Contains(validAPIKeyOperations, op) {
+			return util.NewValidationError(fmt.Sprintf("invalid operation %q", op))
+		}
+	}
+	f.AllowedIP = util.RemoveDuplicates(f.AllowedIP, false)
+	for _, IPMask := range f.AllowedIP {
+		if _, _, err := net.ParseCIDR(IPMask); err != nil {
+			return util.NewValidationError(fmt.Sprintf("could not parse allow list entry %q : %v", IPMask, err))
+		}
+	}
+	return nil
+}
+
 // APIKey defines a SFTPGo API key.
 // API keys can be used as authentication alternative to short lived tokens
 // for REST API
@@ -66,6 +146,8 @@ type APIKey struct {
 	// Admin username associated with this API key.
 	// If empty and the scope is APIKeyScopeAdmin the key is valid for any admin
 	Admin string `json:"admin,omitempty"`
+	// Optional restrictions
+	Filters APIKeyFilters `json:"filters"`
 	// these fields are for internal use
 	userID   int64
 	adminID  int64
@@ -86,6 +168,7 @@ func (k *APIKey) getACopy() APIKey {
 		Description: k.Description,
 		User:        k.User,
 		Admin:       k.Admin,
+		Filters:     k.Filters.getACopy(),
 		userID:      k.userID,
 		adminID:     k.adminID,
 	}
@@ -164,6 +247,9 @@ func (k *APIKey) validate() error {
 	if k.Scope == APIKeyScopeUser {
 		k.Admin = ""
 	}
+	if err := k.Filters.validate(k.Scope); err != nil {
+		return err
+	}
 	if k.User != "" {
 		_, err := provider.userExists(k.User)
 		if err != nil {
@@ -198,3 +284,71 @@ func (k *APIKey) Authenticate(plainKey string) error {
 
 	return nil
 }
+
+// IsIPAllowed returns true if the key can be used from the specified IP address
+func (k *APIKey) IsIPAllowed(ip string) bool {
+	if len(k.Filters.AllowedIP) == 0 {
+		return true
+	}
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, ipMask := range k.Filters.AllowedIP {
+		_, network, err := net.ParseCIDR(ipMask)
+		if err != nil {
+			continue
+		}
+		if network.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOperationAllowed returns true if the key can be used for the specified operation
+func (k *APIKey) IsOperationAllowed(operation string) bool {
+	if len(k.Filters.Operations) == 0 {
+		return true
+	}
+	return util.Contains(k.Filters.Operations, operation)
+}
+
+// HasUsersRestrictions returns true if the key can be used to manage a subset of users only
+func (k *APIKey) HasUsersRestrictions() bool {
+	return len(k.Filters.Users) > 0
+}
+
+// IsUserAllowed returns true if the key can be used to manage the specified user
+func (k *APIKey) IsUserAllowed(username string) bool {
+	if !k.HasUsersRestrictions() {
+		return true
+	}
+	return matchUsernamePatterns(k.Filters.Users, username)
+}
+
+func hasCharacterClass(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			return true
+		}
+	}
+	return false
+}
+
+// matchUsernamePatterns returns true if the username matches at least one of
+// the specified patterns or if no pattern is specified
+func matchUsernamePatterns(patterns []string, username string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, username); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
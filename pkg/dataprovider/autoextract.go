@@ -0,0 +1,82 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// AutoExtractConfig defines the automatic extraction of the uploaded ZIP files
+type AutoExtractConfig struct {
+	// Shell like pattern to match the virtual directory where the ZIP files are
+	// uploaded, for example "/incoming/expand". Empty means disabled
+	TriggerPath string `json:"trigger_path,omitempty"`
+	// Virtual directory where the archives are extracted
+	ExtractToPath string `json:"extract_to_path,omitempty"`
+	// Delete the ZIP file after a successful extraction
+	DeleteZipAfterExtract bool `json:"delete_zip_after_extract,omitempty"`
+	// Maximum total size of the extracted files as bytes. 0 means no limit,
+	// the user quota is checked anyway
+	MaxExtractedSize int64 `json:"max_extracted_size,omitempty"`
+	// Additional email addresses, for example the admins ones, to notify if
+	// the extraction fails. The user is notified if an email address is set
+	NotifyEmails []string `json:"notify_emails,omitempty"`
+}
+
+func (c *AutoExtractConfig) validate() error {
+	if c.TriggerPath == "" {
+		*c = AutoExtractConfig{}
+		return nil
+	}
+	c.TriggerPath = util.CleanPath(c.TriggerPath)
+	if _, err := path.Match(c.TriggerPath, ""); err != nil {
+		return util.NewValidationError(fmt.Sprintf("invalid auto extract trigger path %q: %v", c.TriggerPath, err))
+	}
+	if c.ExtractToPath == "" {
+		return util.NewValidationError("the auto extract target path is mandatory")
+	}
+	c.ExtractToPath = util.CleanPath(c.ExtractToPath)
+	if c.MaxExtractedSize < 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid auto extract max size: %d", c.MaxExtractedSize))
+	}
+	c.NotifyEmails = util.RemoveDuplicates(c.NotifyEmails, false)
+	for _, email := range c.NotifyEmails {
+		if !util.IsEmailValid(email) {
+			return util.NewValidationError(fmt.Sprintf("invalid auto extract notification email %q", email))
+		}
+	}
+	return nil
+}
+
+// GetNotifyEmailsAsString returns the notification emails as comma separated string
+func (c *AutoExtractConfig) GetNotifyEmailsAsString() string {
+	return strings.Join(c.NotifyEmails, ",")
+}
+
+// IsAutoExtractEnabled returns true if the specified uploaded file must be extracted
+func (u *User) IsAutoExtractEnabled(virtualPath string) bool {
+	if u.Filters.AutoExtract.TriggerPath == "" {
+		return false
+	}
+	if !strings.EqualFold(path.Ext(virtualPath), ".zip") {
+		return false
+	}
+	matched, _ := path.Match(u.Filters.AutoExtract.TriggerPath, path.Dir(virtualPath))
+	return matched
+}
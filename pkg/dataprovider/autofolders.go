@@ -0,0 +1,182 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+// Supported conditions for the automatic virtual folders
+const (
+	autoFolderConditionGroup     = "group"
+	autoFolderConditionUsername  = "username"
+	autoFolderConditionAttribute = "attribute"
+)
+
+// Supported user attributes for the automatic virtual folders
+const (
+	autoFolderAttributeEmail          = "email"
+	autoFolderAttributeDescription    = "description"
+	autoFolderAttributeAdditionalInfo = "additional_info"
+)
+
+var (
+	autoFolderConditions = []string{autoFolderConditionGroup, autoFolderConditionUsername,
+		autoFolderConditionAttribute}
+	autoFolderAttributes = []string{autoFolderAttributeEmail, autoFolderAttributeDescription,
+		autoFolderAttributeAdditionalInfo}
+)
+
+// AutoVirtualFolderRule defines a virtual folder to add, at login, to the users
+// matching the rule condition. The virtual folder must exist
+type AutoVirtualFolderRule struct {
+	// Condition type: "group", "username" or "attribute"
+	Condition string `json:"condition" mapstructure:"condition"`
+	// User attribute to match for the "attribute" condition: "email",
+	// "description" or "additional_info"
+	Attribute string `json:"attribute" mapstructure:"attribute"`
+	// Group name for the "group" condition, shell pattern to match
+	// for the "username" and "attribute" conditions
+	Value string `json:"value" mapstructure:"value"`
+	// Name of the virtual folder to add
+	FolderName string `json:"folder_name" mapstructure:"folder_name"`
+	// Virtual path, {username} is replaced with the username. The same
+	// replacement is done for the folder mapped path and key prefix
+	VirtualPath string `json:"virtual_path" mapstructure:"virtual_path"`
+	// Maximum size allowed as bytes. 0 means unlimited, -1 included in user quota
+	QuotaSize int64 `json:"quota_size" mapstructure:"quota_size"`
+	// Maximum number of files allowed. 0 means unlimited, -1 included in user quota
+	QuotaFiles int `json:"quota_files" mapstructure:"quota_files"`
+	// If enabled any write operation inside the virtual folder is denied
+	ReadOnly bool `json:"read_only" mapstructure:"read_only"`
+}
+
+func (r *AutoVirtualFolderRule) validate() error {
+	if !util.Contains(autoFolderConditions, r.Condition) {
+		return fmt.Errorf("invalid auto virtual folder condition %q, allowed: %s", r.Condition,
+			strings.Join(autoFolderConditions, ", "))
+	}
+	if r.Condition == autoFolderConditionAttribute && !util.Contains(autoFolderAttributes, r.Attribute) {
+		return fmt.Errorf("invalid auto virtual folder attribute %q, allowed: %s", r.Attribute,
+			strings.Join(autoFolderAttributes, ", "))
+	}
+	if r.Value == "" {
+		return fmt.Errorf("auto virtual folder condition %q: the value is required", r.Condition)
+	}
+	if _, err := path.Match(r.Value, ""); err != nil {
+		return fmt.Errorf("auto virtual folder condition %q: invalid value %q: %w", r.Condition, r.Value, err)
+	}
+	if r.FolderName == "" {
+		return fmt.Errorf("auto virtual folder condition %q: the folder name is required", r.Condition)
+	}
+	if !path.IsAbs(r.VirtualPath) || path.Clean(r.VirtualPath) == "/" {
+		return fmt.Errorf("auto virtual folder %q: invalid virtual path %q", r.FolderName, r.VirtualPath)
+	}
+	if r.QuotaSize < -1 || r.QuotaFiles < -1 || (r.QuotaSize == -1) != (r.QuotaFiles == -1) {
+		return fmt.Errorf("auto virtual folder %q: invalid quota, size %d files %d", r.FolderName,
+			r.QuotaSize, r.QuotaFiles)
+	}
+	return nil
+}
+
+func (r *AutoVirtualFolderRule) getUserAttribute(user *User) string {
+	switch r.Attribute {
+	case autoFolderAttributeEmail:
+		return user.Email
+	case autoFolderAttributeDescription:
+		return user.Description
+	default:
+		return user.AdditionalInfo
+	}
+}
+
+func (r *AutoVirtualFolderRule) matches(user *User) bool {
+	switch r.Condition {
+	case autoFolderConditionGroup:
+		for _, g := range user.Groups {
+			if g.Name == r.Value {
+				return true
+			}
+		}
+		return false
+	case autoFolderConditionUsername:
+		matched, _ := path.Match(r.Value, user.Username)
+		return matched
+	default:
+		matched, _ := path.Match(r.Value, r.getUserAttribute(user))
+		return matched
+	}
+}
+
+func validateAutoVirtualFolders(rules []AutoVirtualFolderRule) error {
+	for idx := range rules {
+		if err := rules[idx].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyAutoVirtualFolders adds the virtual folders defined by the matching rules.
+// The rules that refer to a folder already mounted, by name or virtual path,
+// are ignored so the folders explicitly provisioned for the user always win
+func (u *User) ApplyAutoVirtualFolders() {
+	if len(config.AutoVirtualFolders) == 0 {
+		return
+	}
+	// the user could be a shallow copy, make sure to never append to a shared array
+	u.VirtualFolders = u.VirtualFolders[:len(u.VirtualFolders):len(u.VirtualFolders)]
+	replacer := strings.NewReplacer(homeDirTemplateUsername, u.Username)
+	for idx := range config.AutoVirtualFolders {
+		rule := &config.AutoVirtualFolders[idx]
+		if !rule.matches(u) {
+			continue
+		}
+		virtualPath := util.CleanPath(replacer.Replace(rule.VirtualPath))
+		if u.hasVirtualFolder(rule.FolderName, virtualPath) {
+			continue
+		}
+		folder, err := provider.getFolderByName(rule.FolderName)
+		if err != nil {
+			providerLog(logger.LevelWarn, "unable to get auto virtual folder %q for user %q: %v",
+				rule.FolderName, u.Username, err)
+			continue
+		}
+		folder.MappedPath = u.replacePlaceholder(folder.MappedPath, replacer)
+		folder.FsConfig = u.replaceFsConfigPlaceholders(folder.FsConfig, replacer)
+		u.VirtualFolders = append(u.VirtualFolders, vfs.VirtualFolder{
+			BaseVirtualFolder: folder,
+			VirtualPath:       virtualPath,
+			QuotaSize:         rule.QuotaSize,
+			QuotaFiles:        rule.QuotaFiles,
+			ReadOnly:          rule.ReadOnly,
+		})
+	}
+}
+
+func (u *User) hasVirtualFolder(name, virtualPath string) bool {
+	for idx := range u.VirtualFolders {
+		if u.VirtualFolders[idx].Name == name || u.VirtualFolders[idx].VirtualPath == virtualPath {
+			return true
+		}
+	}
+	return false
+}
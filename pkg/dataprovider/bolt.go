@@ -18,12 +18,14 @@
 package dataprovider
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -39,23 +41,31 @@ const (
 )
 
 var (
-	usersBucket     = []byte("users")
-	groupsBucket    = []byte("groups")
-	foldersBucket   = []byte("folders")
-	adminsBucket    = []byte("admins")
-	apiKeysBucket   = []byte("api_keys")
-	sharesBucket    = []byte("shares")
-	actionsBucket   = []byte("events_actions")
-	rulesBucket     = []byte("events_rules")
-	dbVersionBucket = []byte("db_version")
-	dbVersionKey    = []byte("version")
-	boltBuckets     = [][]byte{usersBucket, groupsBucket, foldersBucket, adminsBucket, apiKeysBucket,
-		sharesBucket, actionsBucket, rulesBucket, dbVersionBucket}
+	usersBucket          = []byte("users")
+	groupsBucket         = []byte("groups")
+	foldersBucket        = []byte("folders")
+	adminsBucket         = []byte("admins")
+	apiKeysBucket        = []byte("api_keys")
+	sharesBucket         = []byte("shares")
+	actionsBucket        = []byte("events_actions")
+	rulesBucket          = []byte("events_rules")
+	knownIPsBucket       = []byte("known_ips")
+	contentIndexBucket   = []byte("content_index")
+	uploadSessionsBucket = []byte("upload_sessions")
+	replicationsBucket   = []byte("replications")
+	dbVersionBucket      = []byte("db_version")
+	dbVersionKey         = []byte("version")
+	boltBuckets          = [][]byte{usersBucket, groupsBucket, foldersBucket, adminsBucket, apiKeysBucket,
+		sharesBucket, actionsBucket, rulesBucket, knownIPsBucket, contentIndexBucket, uploadSessionsBucket,
+		replicationsBucket, dbVersionBucket}
 )
 
 // BoltProvider defines the auth provider for bolt key/value store
 type BoltProvider struct {
 	dbHandle *bolt.DB
+	// the leases are only accessed within read-write transactions, bolt
+	// allows a single read-write transaction at a time
+	uploadSessionLeases uploadSessionLeases
 }
 
 func init() {
@@ -88,7 +98,10 @@ func initializeBoltProvider(basePath string) error {
 			}
 		}
 
-		provider = &BoltProvider{dbHandle: dbHandle}
+		provider = &BoltProvider{
+			dbHandle:            dbHandle,
+			uploadSessionLeases: make(uploadSessionLeases),
+		}
 	} else {
 		providerLog(logger.LevelError, "error creating bolt key/value store handler: %v", err)
 	}
@@ -175,6 +188,31 @@ func (p *BoltProvider) updateAPIKeyLastUse(keyID string) error {
 	})
 }
 
+func (p *BoltProvider) updateAPIKeySecret(keyID, key string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getAPIKeysBucket(tx)
+		if err != nil {
+			return err
+		}
+		var u []byte
+		if u = bucket.Get([]byte(keyID)); u == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("key %#v does not exist, unable to rotate", keyID))
+		}
+		var apiKey APIKey
+		err = json.Unmarshal(u, &apiKey)
+		if err != nil {
+			return err
+		}
+		apiKey.Key = key
+		apiKey.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+		buf, err := json.Marshal(apiKey)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(keyID), buf)
+	})
+}
+
 func (p *BoltProvider) setUpdatedAt(username string) {
 	p.dbHandle.Update(func(tx *bolt.Tx) error { //nolint:errcheck
 		bucket, err := p.getUsersBucket(tx)
@@ -266,6 +304,65 @@ func (p *BoltProvider) updateAdminLastLogin(username string) error {
 	})
 }
 
+func (p *BoltProvider) setAdminLocked(username string, locked bool) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getAdminsBucket(tx)
+		if err != nil {
+			return err
+		}
+		var a []byte
+		if a = bucket.Get([]byte(username)); a == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("admin %q does not exist, unable to update lock status", username))
+		}
+		var admin Admin
+		err = json.Unmarshal(a, &admin)
+		if err != nil {
+			return err
+		}
+		admin.Locked = locked
+		admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+		buf, err := json.Marshal(admin)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(username), buf)
+	})
+}
+
+func (p *BoltProvider) reserveQuotaFile(username string, maxUsedFiles int) (bool, error) {
+	reserved := false
+	err := p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		var u []byte
+		if u = bucket.Get([]byte(username)); u == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("username %q does not exist, unable to reserve quota file", username))
+		}
+		var user User
+		err = json.Unmarshal(u, &user)
+		if err != nil {
+			return err
+		}
+		if user.UsedQuotaFiles >= maxUsedFiles {
+			return nil
+		}
+		user.UsedQuotaFiles++
+		user.LastQuotaUpdate = util.GetTimeAsMsSinceEpoch(time.Now())
+		buf, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		err = bucket.Put([]byte(username), buf)
+		reserved = err == nil
+		return err
+	})
+	providerLog(logger.LevelDebug, "quota file reservation for user %q, max used files: %d, reserved? %t, err: %v",
+		username, maxUsedFiles, reserved, err)
+	return reserved, err
+}
+
 func (p *BoltProvider) updateTransferQuota(username string, uploadSize, downloadSize int64, reset bool) error {
 	return p.dbHandle.Update(func(tx *bolt.Tx) error {
 		bucket, err := p.getUsersBucket(tx)
@@ -385,6 +482,7 @@ func (p *BoltProvider) addAdmin(admin *Admin) error {
 		}
 		admin.ID = int64(id)
 		admin.LastLogin = 0
+		admin.Locked = false
 		admin.CreatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		for idx := range admin.Groups {
@@ -440,6 +538,7 @@ func (p *BoltProvider) updateAdmin(admin *Admin) error {
 		admin.ID = oldAdmin.ID
 		admin.CreatedAt = oldAdmin.CreatedAt
 		admin.LastLogin = oldAdmin.LastLogin
+		admin.Locked = oldAdmin.Locked
 		admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		buf, err := json.Marshal(admin)
 		if err != nil {
@@ -615,6 +714,7 @@ func (p *BoltProvider) addUser(user *User) error {
 		user.LastLogin = 0
 		user.FirstDownload = 0
 		user.FirstUpload = 0
+		user.LastQuotaWarning = 0
 		user.CreatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		user.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		for idx := range user.VirtualFolders {
@@ -668,6 +768,7 @@ func (p *BoltProvider) updateUser(user *User) error {
 		user.LastLogin = oldUser.LastLogin
 		user.FirstDownload = oldUser.FirstDownload
 		user.FirstUpload = oldUser.FirstUpload
+		user.LastQuotaWarning = oldUser.LastQuotaWarning
 		user.CreatedAt = oldUser.CreatedAt
 		user.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		buf, err := json.Marshal(user)
@@ -729,6 +830,9 @@ func (p *BoltProvider) deleteUser(user User, softDelete bool) error {
 		if err := p.deleteRelatedShares(tx, user.Username); err != nil {
 			return err
 		}
+		if err := p.deleteRelatedKnownIPs(tx, user.Username); err != nil {
+			return err
+		}
 		return bucket.Delete([]byte(user.Username))
 	})
 }
@@ -831,6 +935,9 @@ func (p *BoltProvider) getRecentlyUpdatedUsers(after int64) ([]User, error) {
 					}
 					groupMapping[group.Name] = group
 				}
+				expandGroupsHierarchy(groupMapping, func(name string) (Group, error) {
+					return p.groupExistsInternal(name, groupsBucket)
+				})
 				user.applyGroupSettings(groupMapping)
 			}
 			user.SetEmptySecretsIfNil()
@@ -887,6 +994,9 @@ func (p *BoltProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User, e
 						}
 						groupMapping[group.Name] = group
 					}
+					expandGroupsHierarchy(groupMapping, func(name string) (Group, error) {
+						return p.groupExistsInternal(name, groupsBucket)
+					})
 					user.applyGroupSettings(groupMapping)
 				}
 
@@ -901,7 +1011,7 @@ func (p *BoltProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User, e
 	return users, err
 }
 
-func (p *BoltProvider) getUsers(limit int, offset int, order string) ([]User, error) {
+func (p *BoltProvider) getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error) {
 	users := make([]User, 0, limit)
 	var err error
 	if limit <= 0 {
@@ -920,6 +1030,9 @@ func (p *BoltProvider) getUsers(limit int, offset int, order string) ([]User, er
 		itNum := 0
 		if order == OrderASC {
 			for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+				if !matchUsernamePatterns(usernamePatterns, string(k)) {
+					continue
+				}
 				itNum++
 				if itNum <= offset {
 					continue
@@ -936,6 +1049,9 @@ func (p *BoltProvider) getUsers(limit int, offset int, order string) ([]User, er
 			}
 		} else {
 			for k, v := cursor.Last(); k != nil; k, v = cursor.Prev() {
+				if !matchUsernamePatterns(usernamePatterns, string(k)) {
+					continue
+				}
 				itNum++
 				if itNum <= offset {
 					continue
@@ -1089,6 +1205,7 @@ func (p *BoltProvider) updateFolder(folder *vfs.BaseVirtualFolder) error {
 		folder.UsedQuotaSize = oldFolder.UsedQuotaSize
 		folder.Users = oldFolder.Users
 		folder.Groups = oldFolder.Groups
+		folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		buf, err := json.Marshal(folder)
 		if err != nil {
 			return err
@@ -1333,6 +1450,34 @@ func (p *BoltProvider) getUsersInGroups(names []string) ([]string, error) {
 	return usernames, err
 }
 
+func (p *BoltProvider) getChildGroups(names []string) ([]string, error) {
+	var children []string
+	if len(names) == 0 {
+		return children, nil
+	}
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getGroupsBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			// only the parent group is needed, we avoid to decode the whole group
+			var group struct {
+				ParentGroup string `json:"parent_group"`
+			}
+			if err := json.Unmarshal(v, &group); err != nil {
+				return err
+			}
+			if group.ParentGroup != "" && util.Contains(names, group.ParentGroup) {
+				children = append(children, string(k))
+			}
+		}
+		return nil
+	})
+	return children, err
+}
+
 func (p *BoltProvider) groupExists(name string) (Group, error) {
 	var group Group
 	err := p.dbHandle.View(func(tx *bolt.Tx) error {
@@ -2015,6 +2160,10 @@ func (p *BoltProvider) cleanupSharedSessions(sessionType SessionType, before int
 	return ErrNotImplemented
 }
 
+func (p *BoltProvider) getSharedSessions(sessionType SessionType, after int64) ([]Session, error) {
+	return nil, ErrNotImplemented
+}
+
 func (p *BoltProvider) getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error) {
 	if limit <= 0 {
 		return nil, nil
@@ -2122,6 +2271,7 @@ func (p *BoltProvider) addEventAction(action *BaseEventAction) error {
 			return err
 		}
 		action.ID = int64(id)
+		action.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		action.Rules = nil
 		buf, err := json.Marshal(action)
 		if err != nil {
@@ -2153,6 +2303,7 @@ func (p *BoltProvider) updateEventAction(action *BaseEventAction) error {
 		}
 		action.ID = oldAction.ID
 		action.Name = oldAction.Name
+		action.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		action.Rules = nil
 		if len(oldAction.Rules) > 0 {
 			rulesBucket, err := p.getRulesBucket(tx)
@@ -2511,10 +2662,569 @@ func (*BoltProvider) getNodes() ([]Node, error) {
 	return nil, ErrNotImplemented
 }
 
+func (*BoltProvider) getOnlineMigrations() ([]OnlineMigration, error) {
+	return nil, ErrNotImplemented
+}
+
+func (*BoltProvider) pauseOnlineMigration(_ int) error {
+	return ErrNotImplemented
+}
+
 func (*BoltProvider) updateNodeTimestamp() error {
 	return ErrNotImplemented
 }
 
+func (p *BoltProvider) updateKnownIP(username, ip string, cutoff int64) (bool, error) {
+	isNew := false
+	err := p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getKnownIPsBucket(tx)
+		if err != nil {
+			return err
+		}
+		userBucket, err := bucket.CreateBucketIfNotExists([]byte(username))
+		if err != nil {
+			return err
+		}
+		now := util.GetTimeAsMsSinceEpoch(time.Now())
+		knownIP := KnownIP{
+			IP:        ip,
+			FirstSeen: now,
+		}
+		if v := userBucket.Get([]byte(ip)); v != nil {
+			if err := json.Unmarshal(v, &knownIP); err != nil {
+				return err
+			}
+			isNew = knownIP.LastSeen < cutoff
+		} else {
+			isNew = true
+		}
+		knownIP.LastSeen = now
+		buf, err := json.Marshal(knownIP)
+		if err != nil {
+			return err
+		}
+		return userBucket.Put([]byte(ip), buf)
+	})
+	return isNew, err
+}
+
+func (p *BoltProvider) cleanupKnownIPs(before int64) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getKnownIPsBucket(tx)
+		if err != nil {
+			return err
+		}
+		var emptyBuckets [][]byte
+		err = bucket.ForEachBucket(func(k []byte) error {
+			userBucket := bucket.Bucket(k)
+			var toRemove [][]byte
+			numIPs := 0
+			err := userBucket.ForEach(func(ip, v []byte) error {
+				numIPs++
+				var knownIP KnownIP
+				if err := json.Unmarshal(v, &knownIP); err != nil {
+					return err
+				}
+				if knownIP.LastSeen < before {
+					toRemove = append(toRemove, ip)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, ip := range toRemove {
+				if err := userBucket.Delete(ip); err != nil {
+					return err
+				}
+			}
+			if numIPs == len(toRemove) {
+				emptyBuckets = append(emptyBuckets, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range emptyBuckets {
+			if err := bucket.DeleteBucket(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *BoltProvider) getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	var entry vfs.ContentIndexEntry
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		var v []byte
+		if storageBucket := bucket.Bucket([]byte(storageID)); storageBucket != nil {
+			v = storageBucket.Get([]byte(name))
+		}
+		if v == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", name))
+		}
+		return json.Unmarshal(v, &entry)
+	})
+	return entry, err
+}
+
+func (p *BoltProvider) getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	var entries []vfs.ContentIndexEntry
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket := bucket.Bucket([]byte(storageID))
+		if storageBucket == nil {
+			return nil
+		}
+		var prefix []byte
+		if dirName != "" {
+			prefix = []byte(dirName + "/")
+		}
+		cursor := storageBucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var entry vfs.ContentIndexEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if isContentEntryInDir(&entry, dirName, recursive) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (p *BoltProvider) addContentEntry(entry *vfs.ContentIndexEntry) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket, err := bucket.CreateBucketIfNotExists([]byte(entry.StorageID))
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return storageBucket.Put([]byte(entry.Path), buf)
+	})
+}
+
+func (p *BoltProvider) renameContentEntries(storageID, source, target string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket := bucket.Bucket([]byte(storageID))
+		if storageBucket == nil || storageBucket.Get([]byte(source)) == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", source))
+		}
+		var renamed []vfs.ContentIndexEntry
+		prefix := []byte(source + "/")
+		cursor := storageBucket.Cursor()
+		for k, v := cursor.Seek([]byte(source)); k != nil; k, v = cursor.Next() {
+			if string(k) != source && !bytes.HasPrefix(k, prefix) {
+				if bytes.Compare(k, prefix) > 0 {
+					break
+				}
+				continue
+			}
+			var entry vfs.ContentIndexEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			renamed = append(renamed, entry)
+		}
+		if err := storageBucket.Delete([]byte(target)); err != nil {
+			return err
+		}
+		for _, entry := range renamed {
+			if err := storageBucket.Delete([]byte(entry.Path)); err != nil {
+				return err
+			}
+			entry.Path = target + strings.TrimPrefix(entry.Path, source)
+			buf, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := storageBucket.Put([]byte(entry.Path), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *BoltProvider) deleteContentEntry(storageID, name string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket := bucket.Bucket([]byte(storageID))
+		if storageBucket == nil || storageBucket.Get([]byte(name)) == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", name))
+		}
+		return storageBucket.Delete([]byte(name))
+	})
+}
+
+func (p *BoltProvider) getContentHashes(storageID string) ([]string, error) {
+	var hashes []string
+	found := make(map[string]bool)
+	err := p.iterateContentEntries(storageID, func(entry *vfs.ContentIndexEntry) error {
+		if !entry.IsDir && !found[entry.Hash] {
+			found[entry.Hash] = true
+			hashes = append(hashes, entry.Hash)
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+func (p *BoltProvider) isContentReferenced(storageID, hash string) (bool, error) {
+	isReferenced := false
+	err := p.iterateContentEntries(storageID, func(entry *vfs.ContentIndexEntry) error {
+		if !entry.IsDir && entry.Hash == hash {
+			isReferenced = true
+		}
+		return nil
+	})
+	return isReferenced, err
+}
+
+func (p *BoltProvider) deleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	var deleted int64
+	err := p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket := bucket.Bucket([]byte(storageID))
+		if storageBucket == nil {
+			return nil
+		}
+		var toRemove [][]byte
+		err = storageBucket.ForEach(func(k, v []byte) error {
+			var entry vfs.ContentIndexEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !entry.IsDir && entry.Hash == hash {
+				toRemove = append(toRemove, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range toRemove {
+			if err := storageBucket.Delete(k); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (p *BoltProvider) addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(session.ID)) != nil {
+			return fmt.Errorf("upload session %v already exists", session.ID)
+		}
+		err = bucket.ForEach(func(k, v []byte) error {
+			var s vfs.UploadSession
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			if s.Username == session.Username && s.Path == session.Path {
+				return fmt.Errorf("an upload session for path %q already exists", session.Path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(session.ID), buf); err != nil {
+			return err
+		}
+		p.uploadSessionLeases.claim(session.ID, owner, leaseExpiresAt, 0)
+		return nil
+	})
+}
+
+func (p *BoltProvider) updateUploadSession(session *vfs.UploadSession, owner string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bucket.Get([]byte(session.ID))
+		if v == nil || !p.uploadSessionLeases.isOwner(session.ID, owner) {
+			return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", session.ID))
+		}
+		var oldSession vfs.UploadSession
+		if err := json.Unmarshal(v, &oldSession); err != nil {
+			return err
+		}
+		oldSession.LastSeenAt = session.LastSeenAt
+		oldSession.UploadedBytes = session.UploadedBytes
+		oldSession.TotalBytes = session.TotalBytes
+		oldSession.Parts = session.Parts
+		buf, err := json.Marshal(oldSession)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(session.ID), buf)
+	})
+}
+
+func (p *BoltProvider) getUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	var session vfs.UploadSession
+	found := false
+	err := p.iterateUploadSessions(func(s *vfs.UploadSession) bool {
+		if s.Username == username && s.Path == virtualPath {
+			session = *s
+			found = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return session, err
+	}
+	if !found {
+		return session, util.NewRecordNotFoundError(fmt.Sprintf("no upload session for path %q", virtualPath))
+	}
+	return session, nil
+}
+
+func (p *BoltProvider) getUploadSessionByID(id string) (vfs.UploadSession, error) {
+	var session vfs.UploadSession
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bucket.Get([]byte(id))
+		if v == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+		}
+		return json.Unmarshal(v, &session)
+	})
+	return session, err
+}
+
+func (p *BoltProvider) getUploadSessions(username string) ([]vfs.UploadSession, error) {
+	sessions := make([]vfs.UploadSession, 0, 10)
+	err := p.iterateUploadSessions(func(s *vfs.UploadSession) bool {
+		if s.Username == username {
+			sessions = append(sessions, *s)
+		}
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt < sessions[j].StartedAt
+	})
+	return sessions, err
+}
+
+func (p *BoltProvider) getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error) {
+	var sessions []vfs.UploadSession
+	err := p.iterateUploadSessions(func(s *vfs.UploadSession) bool {
+		if s.LastSeenAt < lastSeenBefore {
+			sessions = append(sessions, *s)
+		}
+		return true
+	})
+	return sessions, err
+}
+
+func (p *BoltProvider) deleteUploadSession(id string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(id)) == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		delete(p.uploadSessionLeases, id)
+		return nil
+	})
+}
+
+func (p *BoltProvider) claimUploadSession(id, owner string, leaseExpiresAt, now int64) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(id)) == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+		}
+		if !p.uploadSessionLeases.claim(id, owner, leaseExpiresAt, now) {
+			return vfs.ErrUploadSessionInUse
+		}
+		return nil
+	})
+}
+
+func (p *BoltProvider) releaseUploadSession(id, owner string) error {
+	return p.dbHandle.Update(func(_ *bolt.Tx) error {
+		p.uploadSessionLeases.release(id, owner)
+		return nil
+	})
+}
+
+// iterateUploadSessions calls fn for each upload session, the iteration stops if fn returns false
+func (p *BoltProvider) iterateUploadSessions(fn func(s *vfs.UploadSession) bool) error {
+	return p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getUploadSessionsBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var session vfs.UploadSession
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if !fn(&session) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func (p *BoltProvider) setReplicationStatus(status *vfs.ReplicationStatus) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getReplicationsBucket(tx)
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(getReplicationStatusKey(status.Username, status.Path)), buf)
+	})
+}
+
+func (p *BoltProvider) getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	var status vfs.ReplicationStatus
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getReplicationsBucket(tx)
+		if err != nil {
+			return err
+		}
+		v := bucket.Get([]byte(getReplicationStatusKey(username, virtualPath)))
+		if v == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("no replication status for path %q", virtualPath))
+		}
+		return json.Unmarshal(v, &status)
+	})
+	return status, err
+}
+
+func (p *BoltProvider) getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error) {
+	var statuses []vfs.ReplicationStatus
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getReplicationsBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var status vfs.ReplicationStatus
+			if err := json.Unmarshal(v, &status); err != nil {
+				return err
+			}
+			if status.NextRetryAt > 0 && status.NextRetryAt <= nextRetryBefore {
+				statuses = append(statuses, status)
+			}
+		}
+		return nil
+	})
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NextRetryAt < statuses[j].NextRetryAt
+	})
+	return statuses, err
+}
+
+func (p *BoltProvider) deleteReplicationStatus(username, virtualPath string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getReplicationsBucket(tx)
+		if err != nil {
+			return err
+		}
+		key := []byte(getReplicationStatusKey(username, virtualPath))
+		if bucket.Get(key) == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("no replication status for path %q", virtualPath))
+		}
+		return bucket.Delete(key)
+	})
+}
+
+func (p *BoltProvider) iterateContentEntries(storageID string, fn func(entry *vfs.ContentIndexEntry) error) error {
+	return p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := p.getContentIndexBucket(tx)
+		if err != nil {
+			return err
+		}
+		storageBucket := bucket.Bucket([]byte(storageID))
+		if storageBucket == nil {
+			return nil
+		}
+		return storageBucket.ForEach(func(_, v []byte) error {
+			var entry vfs.ContentIndexEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			return fn(&entry)
+		})
+	})
+}
+
+func (p *BoltProvider) deleteRelatedKnownIPs(tx *bolt.Tx, username string) error {
+	bucket, err := p.getKnownIPsBucket(tx)
+	if err != nil {
+		return err
+	}
+	err = bucket.DeleteBucket([]byte(username))
+	if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	return nil
+}
+
 func (*BoltProvider) cleanupNodes() error {
 	return ErrNotImplemented
 }
@@ -2576,6 +3286,36 @@ func (p *BoltProvider) setFirstUploadTimestamp(username string) error {
 	})
 }
 
+func (p *BoltProvider) updateQuotaWarning(username string, threshold int) (bool, error) {
+	increased := false
+	err := p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := p.getUsersBucket(tx)
+		if err != nil {
+			return err
+		}
+		var u []byte
+		if u = bucket.Get([]byte(username)); u == nil {
+			return util.NewRecordNotFoundError(fmt.Sprintf("username %q does not exist, unable to update quota warning",
+				username))
+		}
+		var user User
+		if err = json.Unmarshal(u, &user); err != nil {
+			return err
+		}
+		if user.LastQuotaWarning == threshold {
+			return nil
+		}
+		increased = threshold > user.LastQuotaWarning
+		user.LastQuotaWarning = threshold
+		buf, err := json.Marshal(user)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(username), buf)
+	})
+	return increased, err
+}
+
 func (p *BoltProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -2761,6 +3501,7 @@ func (p *BoltProvider) addFolderInternal(folder vfs.BaseVirtualFolder, bucket *b
 		return err
 	}
 	folder.ID = int64(id)
+	folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	buf, err := json.Marshal(folder)
 	if err != nil {
 		return err
@@ -2958,6 +3699,7 @@ func (p *BoltProvider) addRelationToFolderMapping(baseFolder *vfs.BaseVirtualFol
 	baseFolder.UsedQuotaSize = oldFolder.UsedQuotaSize
 	baseFolder.Users = oldFolder.Users
 	baseFolder.Groups = oldFolder.Groups
+	baseFolder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	if user != nil && !util.Contains(baseFolder.Users, user.Username) {
 		baseFolder.Users = append(baseFolder.Users, user.Username)
 	}
@@ -3174,6 +3916,42 @@ func (p *BoltProvider) getUsersBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	return bucket, err
 }
 
+func (p *BoltProvider) getKnownIPsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+	bucket := tx.Bucket(knownIPsBucket)
+	if bucket == nil {
+		err = errors.New("unable to find known IPs bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
+func (p *BoltProvider) getContentIndexBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+	bucket := tx.Bucket(contentIndexBucket)
+	if bucket == nil {
+		err = errors.New("unable to find content index bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
+func (p *BoltProvider) getUploadSessionsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+	bucket := tx.Bucket(uploadSessionsBucket)
+	if bucket == nil {
+		err = errors.New("unable to find upload sessions bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
+func (p *BoltProvider) getReplicationsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+	bucket := tx.Bucket(replicationsBucket)
+	if bucket == nil {
+		err = errors.New("unable to find replications bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
 func (p *BoltProvider) getGroupsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	var err error
 	bucket := tx.Bucket(groupsBucket)
@@ -0,0 +1,161 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+var isReconcilingContents atomic.Bool
+
+// contentIndex implements vfs.ContentIndex using the configured data provider
+type contentIndex struct{}
+
+func (*contentIndex) GetContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	entry, err := provider.getContentEntry(storageID, name)
+	return entry, convertNotFoundError(err)
+}
+
+func (*contentIndex) ListContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	return provider.getContentEntries(storageID, dirName, recursive)
+}
+
+func (*contentIndex) AddContentEntry(entry *vfs.ContentIndexEntry) error {
+	return provider.addContentEntry(entry)
+}
+
+func (*contentIndex) RenameContentEntries(storageID, source, target string) error {
+	return convertNotFoundError(provider.renameContentEntries(storageID, source, target))
+}
+
+func (*contentIndex) DeleteContentEntry(storageID, name string) error {
+	return convertNotFoundError(provider.deleteContentEntry(storageID, name))
+}
+
+func (*contentIndex) GetContentHashes(storageID string) ([]string, error) {
+	return provider.getContentHashes(storageID)
+}
+
+func (*contentIndex) IsContentReferenced(storageID, hash string) (bool, error) {
+	return provider.isContentReferenced(storageID, hash)
+}
+
+func (*contentIndex) DeleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	return provider.deleteContentEntriesByHash(storageID, hash)
+}
+
+// convertNotFoundError returns an error wrapping os.ErrNotExist for
+// missing entries, as required by the vfs.ContentIndex and
+// vfs.UploadSessionStore interfaces
+func convertNotFoundError(err error) error {
+	var nfErr *util.RecordNotFoundError
+	if errors.As(err, &nfErr) {
+		return fmt.Errorf("%w: %v", os.ErrNotExist, err)
+	}
+	return err
+}
+
+// isContentEntryInDir returns true if the entry is a direct child of
+// the specified directory or a descendant if recursive is true
+func isContentEntryInDir(entry *vfs.ContentIndexEntry, dirName string, recursive bool) bool {
+	if !recursive {
+		return entry.GetParent() == dirName
+	}
+	if dirName == "" {
+		return true
+	}
+	return strings.HasPrefix(entry.Path, dirName+"/")
+}
+
+// reconcileContentIndex checks the content addressed filesystems defined for
+// users and folders and reconciles their index with the stored objects.
+// Filesystems sharing the same bucket/container are checked once
+func reconcileContentIndex() {
+	if !isReconcilingContents.CompareAndSwap(false, true) {
+		providerLog(logger.LevelDebug, "content index reconciliation already in progress")
+		return
+	}
+	defer isReconcilingContents.Store(false)
+
+	filesystems, err := getContentAddressedFilesystems()
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get content addressed filesystems: %v", err)
+		return
+	}
+	for _, fs := range filesystems {
+		removedObjects, removedEntries, err := fs.ReconcileContents()
+		if err != nil {
+			providerLog(logger.LevelError, "unable to reconcile content index for storage %q: %v",
+				fs.GetContentStorageID(), err)
+		} else {
+			providerLog(logger.LevelInfo, "content index reconciled for storage %q, removed objects: %d, "+
+				"removed index entries: %d", fs.GetContentStorageID(), removedObjects, removedEntries)
+		}
+		fs.Close()
+	}
+}
+
+func getContentAddressedFilesystems() ([]vfs.FsContentAddressed, error) {
+	connectionID := fmt.Sprintf("cas_reconcile_%s", xid.New().String())
+	var filesystems []vfs.FsContentAddressed
+	storageIDs := make(map[string]bool)
+
+	addFs := func(fs vfs.Fs, err error) {
+		if err != nil {
+			providerLog(logger.LevelWarn, "unable to create filesystem for content reconciliation: %v", err)
+			return
+		}
+		casFs, ok := fs.(vfs.FsContentAddressed)
+		if !ok || storageIDs[casFs.GetContentStorageID()] {
+			fs.Close()
+			return
+		}
+		storageIDs[casFs.GetContentStorageID()] = true
+		filesystems = append(filesystems, casFs)
+	}
+
+	users, err := provider.dumpUsers()
+	if err != nil {
+		return nil, err
+	}
+	for idx := range users {
+		if users[idx].FsConfig.IsContentAddressed() {
+			addFs(users[idx].getRootFs(connectionID))
+		}
+	}
+	folders, err := provider.dumpFolders()
+	if err != nil {
+		return nil, err
+	}
+	for idx := range folders {
+		if folders[idx].FsConfig.IsContentAddressed() {
+			folder := vfs.VirtualFolder{
+				BaseVirtualFolder: folders[idx],
+			}
+			addFs(folder.GetFilesystem(connectionID, nil))
+		}
+	}
+	return filesystems, nil
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+// withTestProviders runs the specified function using the memory, the bolt
+// and, if enabled at build time, the SQLite providers. The current provider
+// is restored at the end
+func withTestProviders(t *testing.T, fn func(t *testing.T)) {
+	oldProvider := provider
+	oldConfig := config
+	oldPlaceholders := sqlPlaceholders
+	defer func() {
+		provider = oldProvider
+		config = oldConfig
+		sqlPlaceholders = oldPlaceholders
+	}()
+
+	config.Driver = MemoryDataProviderName
+	config.Name = ""
+	initializeMemoryProvider(t.TempDir())
+	t.Run(MemoryDataProviderName, fn)
+	provider.close() //nolint:errcheck
+
+	config.Driver = BoltDataProviderName
+	config.Name = "sftpgo.db"
+	err := initializeBoltProvider(t.TempDir())
+	require.NoError(t, err)
+	t.Run(BoltDataProviderName, fn)
+	provider.close() //nolint:errcheck
+
+	config.Driver = SQLiteDataProviderName
+	config.SQLTablesPrefix = ""
+	if err := initializeSQLiteProvider(t.TempDir()); err != nil {
+		t.Logf("SQLite provider not tested: %v", err)
+		return
+	}
+	sqlPlaceholders = getSQLPlaceholders()
+	require.NoError(t, validateSQLTablesPrefix())
+	require.NoError(t, provider.initializeDatabase())
+	err = provider.migrateDatabase()
+	if !errors.Is(err, ErrNoInitRequired) {
+		require.NoError(t, err)
+	}
+	t.Run(SQLiteDataProviderName, fn)
+	provider.close() //nolint:errcheck
+}
+
+func TestContentIndexReferences(t *testing.T) {
+	withTestProviders(t, func(t *testing.T) {
+		index := &contentIndex{}
+		entries := []vfs.ContentIndexEntry{
+			{StorageID: "s1", Path: "dir", IsDir: true},
+			{StorageID: "s1", Path: "dir/file1", Hash: "hash1", Size: 1},
+			{StorageID: "s1", Path: "file2", Hash: "hash1", Size: 1},
+			{StorageID: "s1", Path: "file3", Hash: "hash2", Size: 2},
+			{StorageID: "s2", Path: "file1", Hash: "hash1", Size: 1},
+		}
+		for idx := range entries {
+			require.NoError(t, index.AddContentEntry(&entries[idx]))
+		}
+		hashes, err := index.GetContentHashes("s1")
+		assert.NoError(t, err)
+		sort.Strings(hashes)
+		assert.Equal(t, []string{"hash1", "hash2"}, hashes)
+		isReferenced, err := index.IsContentReferenced("s1", "hash1")
+		assert.NoError(t, err)
+		assert.True(t, isReferenced)
+		// the content is referenced while at least an entry uses it
+		assert.NoError(t, index.DeleteContentEntry("s1", "file2"))
+		isReferenced, err = index.IsContentReferenced("s1", "hash1")
+		assert.NoError(t, err)
+		assert.True(t, isReferenced)
+		err = index.DeleteContentEntry("s1", "file2")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		n, err := index.DeleteContentEntriesByHash("s1", "hash1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		isReferenced, err = index.IsContentReferenced("s1", "hash1")
+		assert.NoError(t, err)
+		assert.False(t, isReferenced)
+		_, err = index.GetContentEntry("s1", "dir/file1")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		// directories and other storages are not affected
+		_, err = index.GetContentEntry("s1", "dir")
+		assert.NoError(t, err)
+		isReferenced, err = index.IsContentReferenced("s2", "hash1")
+		assert.NoError(t, err)
+		assert.True(t, isReferenced)
+		hashes, err = index.GetContentHashes("s1")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"hash2"}, hashes)
+		// an entry added again references the content
+		require.NoError(t, index.AddContentEntry(&entries[1]))
+		isReferenced, err = index.IsContentReferenced("s1", "hash1")
+		assert.NoError(t, err)
+		assert.True(t, isReferenced)
+	})
+}
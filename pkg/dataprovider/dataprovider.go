@@ -55,13 +55,14 @@ import (
 	"github.com/GehirnInc/crypt/sha512_crypt"
 	"github.com/alexedwards/argon2id"
 	"github.com/go-chi/render"
+	"github.com/google/shlex"
 	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
-	passwordvalidator "github.com/wagslane/go-password-validator"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/drakkan/sftpgo/v2/pkg/circuitbreaker"
 	"github.com/drakkan/sftpgo/v2/pkg/command"
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
@@ -155,10 +156,12 @@ var (
 	ErrNoInitRequired = errors.New("the data provider is up to date")
 	// ErrInvalidCredentials defines the error to return if the supplied credentials are invalid
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAdminLocked defines the error to return if the admin is locked for inactivity
+	ErrAdminLocked = errors.New("admin account locked for inactivity")
 	// ErrLoginNotAllowedFromIP defines the error to return if login is denied from the current IP
 	ErrLoginNotAllowedFromIP = errors.New("login is not allowed from this IP")
 	isAdminCreated           atomic.Bool
-	validTLSUsernames        = []string{string(sdk.TLSUsernameNone), string(sdk.TLSUsernameCN)}
+	validTLSUsernames        = []string{string(sdk.TLSUsernameNone), string(sdk.TLSUsernameCN), string(TLSUsernameSAN)}
 	config                   Config
 	provider                 Provider
 	sqlPlaceholders          []string
@@ -191,6 +194,11 @@ var (
 	sqlTableTasks                string
 	sqlTableNodes                string
 	sqlTableSchemaVersion        string
+	sqlTableOnlineMigrations     string
+	sqlTableKnownIPs             string
+	sqlTableContentIndex         string
+	sqlTableUploadSessions       string
+	sqlTableReplications         string
 	argon2Params                 *argon2id.Params
 	lastLoginMinDelay            = 10 * time.Minute
 	usernameRegex                = regexp.MustCompile("^[a-zA-Z0-9-_.~]+$")
@@ -199,6 +207,8 @@ var (
 	fnReloadRules                FnReloadRules
 	fnRemoveRule                 FnRemoveRule
 	fnHandleRuleForProviderEvent FnHandleRuleForProviderEvent
+	fnGroupUpdated               FnGroupUpdated
+	fnUserChanged                FnUserChanged
 )
 
 func initSQLTables() {
@@ -222,6 +232,11 @@ func initSQLTables() {
 	sqlTableTasks = "tasks"
 	sqlTableNodes = "nodes"
 	sqlTableSchemaVersion = "schema_version"
+	sqlTableOnlineMigrations = "schema_migrations"
+	sqlTableKnownIPs = "known_ips"
+	sqlTableContentIndex = "content_index"
+	sqlTableUploadSessions = "upload_sessions"
+	sqlTableReplications = "replications"
 }
 
 // FnReloadRules defined the callback to reload event rules
@@ -240,6 +255,31 @@ func SetEventRulesCallbacks(reload FnReloadRules, remove FnRemoveRule, handle Fn
 	fnHandleRuleForProviderEvent = handle
 }
 
+// FnGroupUpdated defines the callback to invalidate the effective permissions
+// of the active connections for the users in the specified group
+type FnGroupUpdated func(groupName string)
+
+// SetGroupUpdatedCallback sets the callback executed after a group update
+func SetGroupUpdatedCallback(fn FnGroupUpdated) {
+	fnGroupUpdated = fn
+}
+
+// FnUserChanged defines the callback to invalidate the node-specific caches
+// for the user with the specified ID
+type FnUserChanged func(userID int64)
+
+// SetUserChangedCallback sets the callback executed after a user is updated
+// or deleted, on this node or on the other cluster nodes
+func SetUserChangedCallback(fn FnUserChanged) {
+	fnUserChanged = fn
+}
+
+func notifyUserChanged(userID int64) {
+	if fnUserChanged != nil && userID > 0 {
+		fnUserChanged(userID)
+	}
+}
+
 type schemaVersion struct {
 	Version int
 }
@@ -271,6 +311,21 @@ type PasswordValidationRules struct {
 	// Take a look at the following link for more details
 	// https://github.com/wagslane/go-password-validator#what-entropy-value-should-i-use
 	MinEntropy float64 `json:"min_entropy" mapstructure:"min_entropy"`
+	// Minimum number of characters, 0 means no limit
+	MinLength int `json:"min_length" mapstructure:"min_length"`
+	// Require at least an uppercase letter
+	RequireUppercase bool `json:"require_uppercase" mapstructure:"require_uppercase"`
+	// Require at least a lowercase letter
+	RequireLowercase bool `json:"require_lowercase" mapstructure:"require_lowercase"`
+	// Require at least a digit
+	RequireDigit bool `json:"require_digit" mapstructure:"require_digit"`
+	// Require at least a special character, for example a punctuation or a symbol
+	RequireSpecial bool `json:"require_special" mapstructure:"require_special"`
+	// Reject passwords equal to the username
+	DisallowUsername bool `json:"disallow_username" mapstructure:"disallow_username"`
+	// Reject passwords found in data breaches using the Have I Been Pwned API.
+	// Only the first 5 characters of the password SHA-1 hash are sent
+	PwnedPasswordCheck bool `json:"pwned_password_check" mapstructure:"pwned_password_check"`
 }
 
 // PasswordValidation defines the password validation rules for admins and protocol users
@@ -371,6 +426,12 @@ type Config struct {
 	// a valid absolute path, then the user home dir will be automatically
 	// defined as the path obtained joining the base dir and the username
 	UsersBaseDir string `json:"users_base_dir" mapstructure:"users_base_dir"`
+	// Template for the home dir of new users without an explicit home dir.
+	// The following variables are supported: {username}, {group} (primary group name),
+	// {first_char} (first character of the username) and {date} (YYYY-MM-DD).
+	// If set, it takes precedence over UsersBaseDir. It is also used to generate the
+	// mapped path for local virtual folders, {username} is replaced with the folder name
+	HomeDirTemplate string `json:"home_dir_template" mapstructure:"home_dir_template"`
 	// Actions to execute on objects add, update, delete.
 	// The supported objects are user, admin, api_key.
 	// Update action will not be fired for internal updates such as the last login or the user quota fields.
@@ -475,6 +536,19 @@ type Config struct {
 	Node NodeConfig `json:"node" mapstructure:"node"`
 	// Path to the backup directory. This can be an absolute path or a path relative to the config dir
 	BackupsPath string `json:"backups_path" mapstructure:"backups_path"`
+	// PublicKeysAudit defines the audit rules for the users SSH public keys
+	PublicKeysAudit PublicKeysAudit `json:"public_keys_audit" mapstructure:"public_keys_audit"`
+	// LoginNotifications defines the configuration for the users login notifications
+	LoginNotifications LoginNotificationsConfig `json:"login_notifications" mapstructure:"login_notifications"`
+	// Resumable upload sessions not updated for more than this number of hours are
+	// aborted and removed. 0 means no automatic cleanup
+	UploadSessionsMaxAge int `json:"upload_sessions_max_age" mapstructure:"upload_sessions_max_age"`
+	// Admins defines the configuration for the admin accounts
+	Admins AdminsConfig `json:"admins" mapstructure:"admins"`
+	// Virtual folders to add, at login, to the users matching the rules
+	AutoVirtualFolders []AutoVirtualFolderRule `json:"auto_virtual_folders" mapstructure:"auto_virtual_folders"`
+	// QuotaWarnings defines the configuration for the quota warning emails
+	QuotaWarnings QuotaWarningsConfig `json:"quota_warnings" mapstructure:"quota_warnings"`
 }
 
 // GetShared returns the provider share mode.
@@ -661,6 +735,9 @@ type BackupData struct {
 	EventActions []BaseEventAction       `json:"event_actions"`
 	EventRules   []EventRule             `json:"event_rules"`
 	Version      int                     `json:"version"`
+	// For differential dumps, the lower bound for the objects update time
+	// as unix timestamp in milliseconds
+	Since int64 `json:"since,omitempty"`
 }
 
 // HasFolder returns true if the folder with the given name is included
@@ -704,6 +781,7 @@ type Provider interface {
 	validateUserAndPubKey(username string, pubKey []byte, isSSHCert bool) (User, string, error)
 	validateUserAndTLSCert(username, protocol string, tlsCert *x509.Certificate) (User, error)
 	updateQuota(username string, filesAdd int, sizeAdd int64, reset bool) error
+	reserveQuotaFile(username string, maxUsedFiles int) (bool, error)
 	updateTransferQuota(username string, uploadSize, downloadSize int64, reset bool) error
 	getUsedQuota(username string) (int, int64, int64, int64, error)
 	userExists(username string) (User, error)
@@ -711,12 +789,13 @@ type Provider interface {
 	updateUser(user *User) error
 	deleteUser(user User, softDelete bool) error
 	updateUserPassword(username, password string) error
-	getUsers(limit int, offset int, order string) ([]User, error)
+	getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error)
 	dumpUsers() ([]User, error)
 	getRecentlyUpdatedUsers(after int64) ([]User, error)
 	getUsersForQuotaCheck(toFetch map[string]bool) ([]User, error)
 	updateLastLogin(username string) error
 	updateAdminLastLogin(username string) error
+	setAdminLocked(username string, locked bool) error
 	setUpdatedAt(username string)
 	getFolders(limit, offset int, order string, minimal bool) ([]vfs.BaseVirtualFolder, error)
 	getFolderByName(name string) (vfs.BaseVirtualFolder, error)
@@ -729,6 +808,7 @@ type Provider interface {
 	getGroups(limit, offset int, order string, minimal bool) ([]Group, error)
 	getGroupsWithNames(names []string) ([]Group, error)
 	getUsersInGroups(names []string) ([]string, error)
+	getChildGroups(names []string) ([]string, error)
 	groupExists(name string) (Group, error)
 	addGroup(group *Group) error
 	updateGroup(group *Group) error
@@ -748,6 +828,7 @@ type Provider interface {
 	getAPIKeys(limit int, offset int, order string) ([]APIKey, error)
 	dumpAPIKeys() ([]APIKey, error)
 	updateAPIKeyLastUse(keyID string) error
+	updateAPIKeySecret(keyID, key string) error
 	shareExists(shareID, username string) (Share, error)
 	addShare(share *Share) error
 	updateShare(share *Share) error
@@ -772,6 +853,7 @@ type Provider interface {
 	deleteSharedSession(key string) error
 	getSharedSession(key string) (Session, error)
 	cleanupSharedSessions(sessionType SessionType, before int64) error
+	getSharedSessions(sessionType SessionType, after int64) ([]Session, error)
 	getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error)
 	dumpEventActions() ([]BaseEventAction, error)
 	eventActionExists(name string) (BaseEventAction, error)
@@ -791,10 +873,36 @@ type Provider interface {
 	updateTaskTimestamp(name string) error
 	setFirstDownloadTimestamp(username string) error
 	setFirstUploadTimestamp(username string) error
+	updateQuotaWarning(username string, threshold int) (bool, error)
 	addNode() error
 	getNodeByName(name string) (Node, error)
 	getNodes() ([]Node, error)
 	updateNodeTimestamp() error
+	getOnlineMigrations() ([]OnlineMigration, error)
+	pauseOnlineMigration(version int) error
+	updateKnownIP(username, ip string, cutoff int64) (bool, error)
+	cleanupKnownIPs(before int64) error
+	getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error)
+	getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error)
+	addContentEntry(entry *vfs.ContentIndexEntry) error
+	renameContentEntries(storageID, source, target string) error
+	deleteContentEntry(storageID, name string) error
+	getContentHashes(storageID string) ([]string, error)
+	isContentReferenced(storageID, hash string) (bool, error)
+	deleteContentEntriesByHash(storageID, hash string) (int64, error)
+	addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error
+	updateUploadSession(session *vfs.UploadSession, owner string) error
+	claimUploadSession(id, owner string, leaseExpiresAt, now int64) error
+	releaseUploadSession(id, owner string) error
+	getUploadSession(username, virtualPath string) (vfs.UploadSession, error)
+	getUploadSessionByID(id string) (vfs.UploadSession, error)
+	getUploadSessions(username string) ([]vfs.UploadSession, error)
+	getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error)
+	deleteUploadSession(id string) error
+	setReplicationStatus(status *vfs.ReplicationStatus) error
+	getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error)
+	getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error)
+	deleteReplicationStatus(username, virtualPath string) error
 	cleanupNodes() error
 	checkAvailability() error
 	close() error
@@ -846,6 +954,30 @@ func Initialize(cnf Config, basePath string, checkAdmins bool) error {
 	if err := validateHooks(); err != nil {
 		return err
 	}
+	if err := config.PublicKeysAudit.initialize(basePath); err != nil {
+		return err
+	}
+	if err := config.LoginNotifications.validate(); err != nil {
+		return err
+	}
+	if err := config.Admins.validate(); err != nil {
+		return err
+	}
+	if err := config.QuotaWarnings.validate(); err != nil {
+		return err
+	}
+	if err := validateAutoVirtualFolders(config.AutoVirtualFolders); err != nil {
+		return err
+	}
+	if config.UploadSessionsMaxAge < 0 {
+		return fmt.Errorf("invalid upload sessions max age: %d", config.UploadSessionsMaxAge)
+	}
+	if err := config.PasswordValidation.Admins.validate(); err != nil {
+		return err
+	}
+	if err := config.PasswordValidation.Users.validate(); err != nil {
+		return err
+	}
 	if err := createProvider(basePath); err != nil {
 		return err
 	}
@@ -861,6 +993,9 @@ func Initialize(cnf Config, basePath string, checkAdmins bool) error {
 		return err
 	}
 	delayedQuotaUpdater.start()
+	vfs.SetContentIndex(&contentIndex{})
+	vfs.SetUploadSessionStore(&uploadSessionStore{})
+	vfs.SetReplicationStore(&replicationStore{})
 	return startScheduler()
 }
 
@@ -975,6 +1110,11 @@ func validateSQLTablesPrefix() error {
 		sqlTableTasks = config.SQLTablesPrefix + sqlTableTasks
 		sqlTableNodes = config.SQLTablesPrefix + sqlTableNodes
 		sqlTableSchemaVersion = config.SQLTablesPrefix + sqlTableSchemaVersion
+		sqlTableOnlineMigrations = config.SQLTablesPrefix + sqlTableOnlineMigrations
+		sqlTableKnownIPs = config.SQLTablesPrefix + sqlTableKnownIPs
+		sqlTableContentIndex = config.SQLTablesPrefix + sqlTableContentIndex
+		sqlTableUploadSessions = config.SQLTablesPrefix + sqlTableUploadSessions
+		sqlTableReplications = config.SQLTablesPrefix + sqlTableReplications
 		providerLog(logger.LevelDebug, "sql table for users %q, folders %q users folders mapping %q admins %q "+
 			"api keys %q shares %q defender hosts %q defender events %q transfers %q  groups %q "+
 			"users groups mapping %q admins groups mapping %q groups folders mapping %q shared sessions %q "+
@@ -1057,6 +1197,9 @@ func CheckAdminAndPass(username, password, ip string) (Admin, error) {
 
 // CheckCachedUserCredentials checks the credentials for a cached user
 func CheckCachedUserCredentials(user *CachedUser, password, loginMethod, protocol string, tlsCert *x509.Certificate) error {
+	if err := checkLoginCooldown(user.User.Username); err != nil {
+		return err
+	}
 	if err := user.User.CheckLoginConditions(); err != nil {
 		return err
 	}
@@ -1134,6 +1277,9 @@ func CheckCompositeCredentials(username, password, ip, loginMethod, protocol str
 // CheckUserBeforeTLSAuth checks if a user exits before trying mutual TLS
 func CheckUserBeforeTLSAuth(username, ip, protocol string, tlsCert *x509.Certificate) (User, error) {
 	username = config.convertName(username)
+	if err := checkLoginCooldown(username); err != nil {
+		return User{}, err
+	}
 	if plugin.Handler.HasAuthScope(plugin.AuthScopeTLSCertificate) {
 		user, err := doPluginAuth(username, "", nil, ip, protocol, tlsCert, plugin.AuthScopeTLSCertificate)
 		if err != nil {
@@ -1170,6 +1316,9 @@ func CheckUserBeforeTLSAuth(username, ip, protocol string, tlsCert *x509.Certifi
 // given TLS certificate allow authentication without password
 func CheckUserAndTLSCert(username, ip, protocol string, tlsCert *x509.Certificate) (User, error) {
 	username = config.convertName(username)
+	if err := checkLoginCooldown(username); err != nil {
+		return User{}, err
+	}
 	if plugin.Handler.HasAuthScope(plugin.AuthScopeTLSCertificate) {
 		user, err := doPluginAuth(username, "", nil, ip, protocol, tlsCert, plugin.AuthScopeTLSCertificate)
 		if err != nil {
@@ -1197,6 +1346,9 @@ func CheckUserAndTLSCert(username, ip, protocol string, tlsCert *x509.Certificat
 // CheckUserAndPass retrieves the SFTPGo user with the given username and password if a match is found or an error
 func CheckUserAndPass(username, password, ip, protocol string) (User, error) {
 	username = config.convertName(username)
+	if err := checkLoginCooldown(username); err != nil {
+		return User{}, err
+	}
 	if plugin.Handler.HasAuthScope(plugin.AuthScopePassword) {
 		user, err := doPluginAuth(username, password, nil, ip, protocol, nil, plugin.AuthScopePassword)
 		if err != nil {
@@ -1224,6 +1376,9 @@ func CheckUserAndPass(username, password, ip, protocol string) (User, error) {
 // CheckUserAndPubKey retrieves the SFTP user with the given username and public key if a match is found or an error
 func CheckUserAndPubKey(username string, pubKey []byte, ip, protocol string, isSSHCert bool) (User, string, error) {
 	username = config.convertName(username)
+	if err := checkLoginCooldown(username); err != nil {
+		return User{}, "", err
+	}
 	if plugin.Handler.HasAuthScope(plugin.AuthScopePublicKey) {
 		user, err := doPluginAuth(username, "", pubKey, ip, protocol, nil, plugin.AuthScopePublicKey)
 		if err != nil {
@@ -1254,6 +1409,9 @@ func CheckKeyboardInteractiveAuth(username, authHook string, client ssh.Keyboard
 	var user User
 	var err error
 	username = config.convertName(username)
+	if err = checkLoginCooldown(username); err != nil {
+		return user, err
+	}
 	if plugin.Handler.HasAuthScope(plugin.AuthScopeKeyboardInteractive) {
 		user, err = doPluginAuth(username, "", nil, ip, protocol, nil, plugin.AuthScopeKeyboardInteractive)
 	} else if config.ExternalAuthHook != "" && (config.ExternalAuthScope == 0 || config.ExternalAuthScope&4 != 0) {
@@ -1402,9 +1560,14 @@ func UpdateUserQuota(user *User, filesAdd int, sizeAdd int64, reset bool) error
 		if reset {
 			delayedQuotaUpdater.resetUserQuota(user.Username)
 		}
-		return provider.updateQuota(user.Username, filesAdd, sizeAdd, reset)
+		if err := provider.updateQuota(user.Username, filesAdd, sizeAdd, reset); err != nil {
+			return err
+		}
+		checkQuotaWarning(user)
+		return nil
 	}
 	delayedQuotaUpdater.updateUserQuota(user.Username, filesAdd, sizeAdd)
+	checkQuotaWarning(user)
 	return nil
 }
 
@@ -1464,6 +1627,18 @@ func UpdateUserTransferTimestamps(username string, isUpload bool) error {
 	return err
 }
 
+// ReserveUserQuotaFile atomically adds a file to the used quota for the given user
+// if the files quota is not exceeded. It returns false if the quota is exceeded.
+// The check and the update are done in the data provider so concurrent uploads,
+// even from different instances, cannot exceed the files quota
+func ReserveUserQuotaFile(user *User) (bool, error) {
+	if config.TrackQuota == 0 {
+		return false, util.NewMethodDisabledError(trackQuotaDisabledError)
+	}
+	delayedFiles, _ := delayedQuotaUpdater.getUserPendingQuota(user.Username)
+	return provider.reserveQuotaFile(user.Username, user.QuotaFiles-delayedFiles)
+}
+
 // GetUsedQuota returns the used quota for the given SFTPGo user.
 func GetUsedQuota(username string) (int, int64, int64, int64, error) {
 	if config.TrackQuota == 0 {
@@ -1546,21 +1721,63 @@ func AddGroup(group *Group, executor, ipAddress string) error {
 func UpdateGroup(group *Group, users []string, executor, ipAddress string) error {
 	err := provider.updateGroup(group)
 	if err == nil {
-		for _, user := range users {
-			provider.setUpdatedAt(user)
-			u, err := provider.userExists(user)
-			if err == nil {
-				webDAVUsersCache.swap(&u)
-				executeAction(operationUpdate, executor, ipAddress, actionObjectUser, u.Username, &u)
-			} else {
-				RemoveCachedWebDAVUser(user)
-			}
-		}
+		refreshGroupUsers(group.Name, users, executor, ipAddress)
+		OnGroupUpdate(group)
 		executeAction(operationUpdate, executor, ipAddress, actionObjectGroup, group.Name, group)
 	}
 	return err
 }
 
+// ApplyGroupChanges refreshes the stored users of the specified group, and of its
+// descendant groups, and the effective permissions of their active connections.
+// It returns the number of refreshed users
+func ApplyGroupChanges(name, executor, ipAddress string) (int, error) {
+	group, err := GroupExists(name)
+	if err != nil {
+		return 0, err
+	}
+	numUsers := refreshGroupUsers(group.Name, group.Users, executor, ipAddress)
+	OnGroupUpdate(&group)
+	providerLog(logger.LevelDebug, "changes for group %q applied, refreshed users: %d", group.Name, numUsers)
+	return numUsers, nil
+}
+
+// OnGroupUpdate marks the effective permissions of the active connections for
+// the users in the specified group, and in its descendant groups, as stale
+func OnGroupUpdate(group *Group) {
+	if fnGroupUpdated == nil {
+		return
+	}
+	names := []string{group.Name}
+	descendants, err := getDescendantGroups(group.Name)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get child groups for group %q: %v", group.Name, err)
+	}
+	names = append(names, descendants...)
+	for _, name := range names {
+		fnGroupUpdated(name)
+	}
+}
+
+// refreshGroupUsers updates the cached users and notifies the update for the
+// specified users and the users of the child groups, they inherit the group
+// settings too. It returns the number of refreshed users
+func refreshGroupUsers(name string, users []string, executor, ipAddress string) int {
+	users = util.RemoveDuplicates(append(users, getUsersInDescendantGroups(name)...), false)
+	for _, user := range users {
+		provider.setUpdatedAt(user)
+		u, err := provider.userExists(user)
+		if err == nil {
+			webDAVUsersCache.swap(&u)
+			notifyUserChanged(u.ID)
+			executeAction(operationUpdate, executor, ipAddress, actionObjectUser, u.Username, &u)
+		} else {
+			RemoveCachedWebDAVUser(user)
+		}
+	}
+	return len(users)
+}
+
 // DeleteGroup deletes an existing Group
 func DeleteGroup(name string, executor, ipAddress string) error {
 	name = config.convertName(name)
@@ -1572,6 +1789,9 @@ func DeleteGroup(name string, executor, ipAddress string) error {
 		errorString := fmt.Sprintf("the group %#v is referenced, it cannot be removed", group.Name)
 		return util.NewValidationError(errorString)
 	}
+	if err := checkGroupHasNoChildren(group.Name); err != nil {
+		return err
+	}
 	err = provider.deleteGroup(group)
 	if err == nil {
 		for _, user := range group.Users {
@@ -1587,6 +1807,78 @@ func DeleteGroup(name string, executor, ipAddress string) error {
 	return err
 }
 
+// AddGroupMembers adds the specified users to the group with the given name.
+// Users that are already members of the group are skipped, it returns the
+// usernames actually added
+func AddGroupMembers(name string, usernames []string, groupType int, executor, ipAddress string) ([]string, error) {
+	group, err := GroupExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(usernames) == 0 {
+		return nil, util.NewValidationError("no user specified")
+	}
+	if !util.Contains([]int{sdk.GroupTypePrimary, sdk.GroupTypeSecondary, sdk.GroupTypeMembership}, groupType) {
+		return nil, util.NewValidationError(fmt.Sprintf("invalid group type: %d", groupType))
+	}
+	var added []string
+	for _, username := range util.RemoveDuplicates(usernames, false) {
+		user, err := UserExists(username)
+		if err != nil {
+			return added, err
+		}
+		if isUserInGroup(&user, group.Name) {
+			continue
+		}
+		user.Groups = append(user.Groups, sdk.GroupMapping{
+			Name: group.Name,
+			Type: groupType,
+		})
+		if err := UpdateUser(&user, executor, ipAddress); err != nil {
+			return added, err
+		}
+		added = append(added, user.Username)
+	}
+	return added, nil
+}
+
+func isUserInGroup(user *User, groupName string) bool {
+	for _, g := range user.Groups {
+		if g.Name == groupName {
+			return true
+		}
+	}
+	return false
+}
+
+func checkGroupHasNoChildren(name string) error {
+	children, err := provider.getChildGroups([]string{name})
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return util.NewValidationError(fmt.Sprintf("the group %q is the parent of the group %q, it cannot be removed",
+			name, children[0]))
+	}
+	return nil
+}
+
+func getUsersInDescendantGroups(name string) []string {
+	descendants, err := getDescendantGroups(name)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get child groups for group %q: %v", name, err)
+	}
+	if len(descendants) == 0 {
+		return nil
+	}
+	users, err := provider.getUsersInGroups(descendants)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get users in the child groups of group %q: %v", name, err)
+		return nil
+	}
+	return users
+}
+
 // GroupExists returns the Group with the given name if it exists
 func GroupExists(name string) (Group, error) {
 	name = config.convertName(name)
@@ -1611,6 +1903,25 @@ func UpdateAPIKey(apiKey *APIKey, executor, ipAddress string) error {
 	return err
 }
 
+// RotateAPIKey generates a new secret for an existing API key.
+// The returned key contains the new plain secret
+func RotateAPIKey(keyID string, executor, ipAddress string) (APIKey, error) {
+	apiKey, err := provider.apiKeyExists(keyID)
+	if err != nil {
+		return apiKey, err
+	}
+	apiKey.Key = util.GenerateUniqueID()
+	apiKey.plainKey = apiKey.Key
+	if err := apiKey.hashKey(); err != nil {
+		return apiKey, err
+	}
+	err = provider.updateAPIKeySecret(apiKey.KeyID, apiKey.Key)
+	if err == nil {
+		executeAction(operationUpdate, executor, ipAddress, actionObjectAPIKey, apiKey.KeyID, &apiKey)
+	}
+	return apiKey, err
+}
+
 // DeleteAPIKey deletes an existing API key
 func DeleteAPIKey(keyID string, executor, ipAddress string) error {
 	apiKey, err := provider.apiKeyExists(keyID)
@@ -1819,6 +2130,24 @@ func UpdateAdmin(admin *Admin, executor, ipAddress string) error {
 	return err
 }
 
+// UnlockAdmin unlocks an admin locked for inactivity
+func UnlockAdmin(username, executor, ipAddress string) error {
+	username = config.convertName(username)
+	admin, err := provider.adminExists(username)
+	if err != nil {
+		return err
+	}
+	if !admin.Locked {
+		return util.NewValidationError(fmt.Sprintf("admin %q is not locked", admin.Username))
+	}
+	if err := provider.setAdminLocked(admin.Username, false); err != nil {
+		return err
+	}
+	admin.Locked = false
+	executeAction(operationUpdate, executor, ipAddress, actionObjectAdmin, admin.Username, &admin)
+	return nil
+}
+
 // DeleteAdmin deletes an existing SFTPGo admin
 func DeleteAdmin(username, executor, ipAddress string) error {
 	username = config.convertName(username)
@@ -1873,6 +2202,7 @@ func GetUserVariants(username string) (User, User, error) {
 // AddUser adds a new SFTPGo user.
 func AddUser(user *User, executor, ipAddress string) error {
 	user.Username = config.convertName(user.Username)
+	updatePublicKeysInfo(user, nil)
 	err := provider.addUser(user)
 	if err == nil {
 		executeAction(operationAdd, executor, ipAddress, actionObjectUser, user.Username, user)
@@ -1882,10 +2212,8 @@ func AddUser(user *User, executor, ipAddress string) error {
 
 // UpdateUserPassword updates the user password
 func UpdateUserPassword(username, plainPwd, executor, ipAddress string) error {
-	if config.PasswordValidation.Users.MinEntropy > 0 {
-		if err := passwordvalidator.Validate(plainPwd, config.PasswordValidation.Users.MinEntropy); err != nil {
-			return util.NewValidationError(err.Error())
-		}
+	if err := config.PasswordValidation.Users.checkPassword(username, plainPwd); err != nil {
+		return err
 	}
 	hashedPwd, err := hashPlainPassword(plainPwd)
 	if err != nil {
@@ -1905,10 +2233,16 @@ func UpdateUser(user *User, executor, ipAddress string) error {
 	if user.groupSettingsApplied {
 		return errors.New("cannot save a user with group settings applied")
 	}
+	var existingKeysInfo []PublicKeyInfo
+	if existing, err := provider.userExists(user.Username); err == nil {
+		existingKeysInfo = existing.Filters.PublicKeysInfo
+	}
+	updatePublicKeysInfo(user, existingKeysInfo)
 	err := provider.updateUser(user)
 	if err == nil {
 		webDAVUsersCache.swap(user)
 		cachedPasswords.Remove(user.Username)
+		notifyUserChanged(user.ID)
 		executeAction(operationUpdate, executor, ipAddress, actionObjectUser, user.Username, user)
 	}
 	return err
@@ -1926,11 +2260,98 @@ func DeleteUser(username, executor, ipAddress string) error {
 		RemoveCachedWebDAVUser(user.Username)
 		delayedQuotaUpdater.resetUserQuota(user.Username)
 		cachedPasswords.Remove(username)
+		notifyUserChanged(user.ID)
 		executeAction(operationDelete, executor, ipAddress, actionObjectUser, user.Username, &user)
 	}
 	return err
 }
 
+// AnonymizeUser replaces the specified user with a disabled copy without personal data.
+// The filesystem configuration, virtual folders, groups and permissions are preserved
+// so the user files remain available to the administrators. The home directory is
+// renamed, since it usually contains the username. Shares and API keys are removed
+// with the original user. The anonymized username is returned
+func AnonymizeUser(username, executor, ipAddress string) (string, error) {
+	username = config.convertName(username)
+	user, err := provider.userExists(username)
+	if err != nil {
+		return "", err
+	}
+	anonymized := user.getACopy()
+	// the secrets are encrypted using the username as additional data
+	if err := anonymized.FsConfig.DecryptSecrets(); err != nil {
+		return "", util.NewGenericError(fmt.Sprintf("unable to decrypt the filesystem secrets: %v", err))
+	}
+	anonymized.ID = 0
+	anonymized.Username = config.convertName(fmt.Sprintf("anonymized-%s", util.GenerateUniqueID()))
+	anonymized.HomeDir = filepath.Join(filepath.Dir(user.HomeDir), anonymized.Username)
+	anonymized.Password = base64.RawURLEncoding.EncodeToString(util.GenerateRandomBytes(32))
+	anonymized.PublicKeys = nil
+	anonymized.Email = ""
+	anonymized.Description = ""
+	anonymized.AdditionalInfo = ""
+	anonymized.Status = 0
+	anonymized.LastLogin = 0
+	anonymized.FirstDownload = 0
+	anonymized.FirstUpload = 0
+	anonymized.Filters.TOTPConfig = UserTOTPConfig{}
+	anonymized.Filters.RecoveryCodes = nil
+	if err := renameHomeDir(&user, anonymized.HomeDir); err != nil {
+		return "", err
+	}
+	if err := AddUser(&anonymized, executor, ipAddress); err != nil {
+		restoreHomeDir(&user, anonymized.HomeDir)
+		return "", err
+	}
+	if err := UpdateUserQuota(&anonymized, user.UsedQuotaFiles, user.UsedQuotaSize, true); err != nil {
+		providerLog(logger.LevelWarn, "unable to update the quota for the anonymized user %q: %v", anonymized.Username, err)
+	}
+	if err := DeleteUser(username, executor, ipAddress); err != nil {
+		if errDel := DeleteUser(anonymized.Username, executor, ipAddress); errDel != nil {
+			providerLog(logger.LevelError, "unable to remove the anonymized user %q: %v", anonymized.Username, errDel)
+		} else {
+			restoreHomeDir(&user, anonymized.HomeDir)
+		}
+		return "", err
+	}
+	return anonymized.Username, nil
+}
+
+// renameHomeDir moves the local home directory of the specified user, if
+// any, to the new path. For cloud based filesystems the home directory only
+// contains temporary files
+func renameHomeDir(user *User, newHomeDir string) error {
+	if !user.hasLocalHomeDir() {
+		return nil
+	}
+	if _, err := os.Stat(user.HomeDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return util.NewGenericError(fmt.Sprintf("unable to stat the home directory: %v", err))
+	}
+	if _, err := os.Lstat(newHomeDir); err == nil {
+		return util.NewGenericError(fmt.Sprintf("the anonymized home directory %q already exists", newHomeDir))
+	}
+	if err := os.Rename(user.HomeDir, newHomeDir); err != nil {
+		return util.NewGenericError(fmt.Sprintf("unable to rename the home directory: %v", err))
+	}
+	return nil
+}
+
+func restoreHomeDir(user *User, newHomeDir string) {
+	if !user.hasLocalHomeDir() {
+		return
+	}
+	if _, err := os.Stat(newHomeDir); err != nil {
+		return
+	}
+	if err := os.Rename(newHomeDir, user.HomeDir); err != nil {
+		providerLog(logger.LevelError, "unable to restore the home directory %q for user %q: %v",
+			user.HomeDir, user.Username, err)
+	}
+}
+
 // AddActiveTransfer stores the specified transfer
 func AddActiveTransfer(transfer ActiveTransfer) {
 	if err := provider.addActiveTransfer(transfer); err != nil {
@@ -1995,6 +2416,12 @@ func GetSharedSession(key string) (Session, error) {
 	return provider.getSharedSession(key)
 }
 
+// GetSharedSessions retrieves the sessions with the specified type and a
+// timestamp after the specified time
+func GetSharedSessions(sessionType SessionType, after time.Time) ([]Session, error) {
+	return provider.getSharedSessions(sessionType, util.GetTimeAsMsSinceEpoch(after))
+}
+
 // CleanupSharedSessions removes the shared session with the specified type and
 // before the specified time
 func CleanupSharedSessions(sessionType SessionType, before time.Time) error {
@@ -2036,7 +2463,23 @@ func GetGroups(limit, offset int, order string, minimal bool) ([]Group, error) {
 
 // GetUsers returns an array of users respecting limit and offset
 func GetUsers(limit, offset int, order string) ([]User, error) {
-	return provider.getUsers(limit, offset, order)
+	return provider.getUsers(limit, offset, order, nil)
+}
+
+// GetUsersMatchingPatterns returns an array of users, whose usernames match
+// at least one of the specified patterns, respecting limit and offset.
+// The patterns are applied before limit and offset, "*" and "?" wildcards
+// are supported
+func GetUsersMatchingPatterns(limit, offset int, order string, usernamePatterns []string) ([]User, error) {
+	for _, pattern := range usernamePatterns {
+		if hasCharacterClass(pattern) {
+			return nil, util.NewValidationError(fmt.Sprintf("unsupported username pattern %q", pattern))
+		}
+	}
+	if len(usernamePatterns) > maxAPIKeyUsersPatterns {
+		return nil, util.NewValidationError("too many username patterns")
+	}
+	return provider.getUsers(limit, offset, order, usernamePatterns)
 }
 
 // GetUsersForQuotaCheck returns the users with the fields required for a quota check
@@ -2179,6 +2622,88 @@ func DumpData() (BackupData, error) {
 	return data, err
 }
 
+// DumpDataSince returns a differential backup including only the objects
+// added or modified after the specified time. Deleted objects are not tracked
+// so they are not included. A differential backup can be restored, on top of
+// the full backup it is based on, using the loaddata modes that update
+// existing objects
+func DumpDataSince(since time.Time) (BackupData, error) {
+	data, err := DumpData()
+	if err != nil {
+		return data, err
+	}
+	after := util.GetTimeAsMsSinceEpoch(since)
+	data.Since = after
+
+	users := make([]User, 0, len(data.Users))
+	for _, user := range data.Users {
+		if user.UpdatedAt > after {
+			users = append(users, user)
+		}
+	}
+	data.Users = users
+	groups := make([]Group, 0, len(data.Groups))
+	for _, group := range data.Groups {
+		if group.UpdatedAt > after {
+			groups = append(groups, group)
+		}
+	}
+	data.Groups = groups
+	folders := make([]vfs.BaseVirtualFolder, 0, len(data.Folders))
+	for _, folder := range data.Folders {
+		if folder.UpdatedAt > after {
+			folders = append(folders, folder)
+		}
+	}
+	data.Folders = folders
+	admins := make([]Admin, 0, len(data.Admins))
+	for _, admin := range data.Admins {
+		if admin.UpdatedAt > after {
+			admins = append(admins, admin)
+		}
+	}
+	data.Admins = admins
+	apiKeys := make([]APIKey, 0, len(data.APIKeys))
+	for _, apiKey := range data.APIKeys {
+		if apiKey.UpdatedAt > after {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	data.APIKeys = apiKeys
+	shares := make([]Share, 0, len(data.Shares))
+	for _, share := range data.Shares {
+		if share.UpdatedAt > after {
+			shares = append(shares, share)
+		}
+	}
+	data.Shares = shares
+	actions := make([]BaseEventAction, 0, len(data.EventActions))
+	for _, action := range data.EventActions {
+		if action.UpdatedAt > after {
+			actions = append(actions, action)
+		}
+	}
+	data.EventActions = actions
+	rules := make([]EventRule, 0, len(data.EventRules))
+	for _, rule := range data.EventRules {
+		if rule.UpdatedAt > after {
+			rules = append(rules, rule)
+		}
+	}
+	data.EventRules = rules
+	return data, nil
+}
+
+// DeltaExport returns the JSON serialized differential backup for the
+// objects added or modified after the specified time
+func DeltaExport(since time.Time) ([]byte, error) {
+	data, err := DumpDataSince(since)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
 // ParseDumpData tries to parse data as BackupData
 func ParseDumpData(data []byte) (BackupData, error) {
 	var dump BackupData
@@ -2296,6 +2821,10 @@ func copyBaseUserFilters(in sdk.BaseUserFilters) sdk.BaseUserFilters {
 
 func buildUserHomeDir(user *User) {
 	if user.HomeDir == "" {
+		if config.HomeDirTemplate != "" {
+			user.HomeDir = getUserHomeDirFromTemplate(user)
+			return
+		}
 		if config.UsersBaseDir != "" {
 			user.HomeDir = filepath.Join(config.UsersBaseDir, user.Username)
 			return
@@ -2424,6 +2953,7 @@ func validateAssociatedVirtualFolders(vfolders []vfs.VirtualFolder) ([]vfs.Virtu
 			VirtualPath:       cleanedVPath,
 			QuotaSize:         v.QuotaSize,
 			QuotaFiles:        v.QuotaFiles,
+			ReadOnly:          v.ReadOnly,
 		})
 		folderNames[folder.Name] = true
 	}
@@ -2537,10 +3067,13 @@ func validatePublicKeys(user *User) error {
 		if k == "" {
 			continue
 		}
-		_, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
 		if err != nil {
 			return util.NewValidationError(fmt.Sprintf("could not parse key nr. %d: %s", i+1, err))
 		}
+		if err := validatePublicKeyStrength(parsedKey); err != nil {
+			return util.NewValidationError(fmt.Sprintf("invalid key nr. %d: %s", i+1, err))
+		}
 		validatedKeys = append(validatedKeys, k)
 	}
 	user.PublicKeys = util.RemoveDuplicates(validatedKeys, false)
@@ -2702,6 +3235,163 @@ func validateFilterProtocols(filters *sdk.BaseUserFilters) error {
 	return nil
 }
 
+// parseForwardTarget parses a forwarding target in the format "CIDR:port".
+// A zero port means any port
+func parseForwardTarget(target string) (*net.IPNet, int, error) {
+	idx := strings.LastIndex(target, ":")
+	if idx <= 0 {
+		return nil, 0, fmt.Errorf("invalid forward target %q, the expected format is CIDR:port", target)
+	}
+	_, ipNet, err := net.ParseCIDR(target[:idx])
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid forward target %q: %w", target, err)
+	}
+	portStr := target[idx+1:]
+	if portStr == "*" {
+		return ipNet, 0, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, 0, fmt.Errorf("invalid port in forward target %q", target)
+	}
+	return ipNet, port, nil
+}
+
+func validateForwardTargets(user *User) error {
+	if !user.Filters.AllowTCPForwarding {
+		user.Filters.AllowedForwardTargets = nil
+		return nil
+	}
+	user.Filters.AllowedForwardTargets = util.RemoveDuplicates(user.Filters.AllowedForwardTargets, true)
+	if len(user.Filters.AllowedForwardTargets) == 0 {
+		return util.NewValidationError("TCP forwarding requires at least an allowed forward target")
+	}
+	for _, target := range user.Filters.AllowedForwardTargets {
+		if _, _, err := parseForwardTarget(target); err != nil {
+			return util.NewValidationError(err.Error())
+		}
+	}
+	return nil
+}
+
+func validateSSHExecCommands(user *User) error {
+	commands := make([]string, 0, len(user.Filters.SSHExec.AllowedCommands))
+	for _, command := range user.Filters.SSHExec.AllowedCommands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		if strings.ContainsAny(command, "\r\n") {
+			return util.NewValidationError(fmt.Sprintf("invalid SSH exec command %q", command))
+		}
+		if parts, err := shlex.Split(command); err != nil || len(parts) == 0 {
+			return util.NewValidationError(fmt.Sprintf("invalid SSH exec command %q", command))
+		}
+		commands = append(commands, command)
+	}
+	user.Filters.SSHExec.AllowedCommands = util.RemoveDuplicates(commands, false)
+	scpPaths := make([]string, 0, len(user.Filters.SSHExec.AllowedSCPPaths))
+	for _, scpPath := range user.Filters.SSHExec.AllowedSCPPaths {
+		scpPath = strings.TrimSpace(scpPath)
+		if scpPath == "" {
+			continue
+		}
+		scpPaths = append(scpPaths, util.CleanPath(scpPath))
+	}
+	user.Filters.SSHExec.AllowedSCPPaths = util.RemoveDuplicates(scpPaths, false)
+	return nil
+}
+
+func validatePathUploadLimits(user *User) error {
+	paths := make(map[string]bool)
+	limits := make([]PathUploadLimit, 0, len(user.Filters.PathUploadLimits))
+	for _, limit := range user.Filters.PathUploadLimits {
+		if limit.Path == "" {
+			return util.NewValidationError("empty path for upload size limit")
+		}
+		limit.Path = util.CleanPath(limit.Path)
+		if limit.MaxUploadFileSize < 0 {
+			return util.NewValidationError(fmt.Sprintf("invalid max upload file size %d for path %q",
+				limit.MaxUploadFileSize, limit.Path))
+		}
+		if paths[limit.Path] {
+			return util.NewValidationError(fmt.Sprintf("duplicate upload size limit for path %q", limit.Path))
+		}
+		paths[limit.Path] = true
+		limits = append(limits, limit)
+	}
+	user.Filters.PathUploadLimits = limits
+	return nil
+}
+
+func validatePathAliases(user *User) error {
+	paths := make(map[string]bool)
+	aliases := make([]PathAlias, 0, len(user.Filters.PathAliases))
+	for _, alias := range user.Filters.PathAliases {
+		if alias.Path == "" || alias.Target == "" {
+			return util.NewValidationError("path alias and target are mandatory")
+		}
+		alias.Path = util.CleanPath(alias.Path)
+		alias.Target = util.CleanPath(alias.Target)
+		if alias.Path == "/" {
+			return util.NewValidationError("the root directory cannot be a path alias")
+		}
+		if paths[alias.Path] {
+			return util.NewValidationError(fmt.Sprintf("duplicate path alias %q", alias.Path))
+		}
+		for idx := range user.VirtualFolders {
+			v := &user.VirtualFolders[idx]
+			if v.VirtualPath == alias.Path || strings.HasPrefix(v.VirtualPath, alias.Path+"/") {
+				return util.NewValidationError(fmt.Sprintf("path alias %q overlaps the virtual folder %q",
+					alias.Path, v.VirtualPath))
+			}
+		}
+		paths[alias.Path] = true
+		aliases = append(aliases, alias)
+	}
+	user.Filters.PathAliases = aliases
+	return checkPathAliasesCycles(aliases)
+}
+
+// checkPathAliasesCycles returns an error if resolving an alias could lead
+// to resolve the same alias again. An alias depends on another one if its
+// target and the other alias path overlap
+func checkPathAliasesCycles(aliases []PathAlias) error {
+	isOverlapping := func(p1, p2 string) bool {
+		return p1 == p2 || strings.HasPrefix(p1, p2+"/") || strings.HasPrefix(p2, p1+"/")
+	}
+	// 0 not visited, 1 visiting, 2 visited
+	states := make([]int, len(aliases))
+	var visit func(idx int) error
+	visit = func(idx int) error {
+		states[idx] = 1
+		for next := range aliases {
+			if !isOverlapping(aliases[idx].Target, aliases[next].Path) {
+				continue
+			}
+			if states[next] == 1 {
+				return util.NewValidationError(fmt.Sprintf("path alias %q creates a cycle with path alias %q",
+					aliases[idx].Path, aliases[next].Path))
+			}
+			if states[next] == 0 {
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		states[idx] = 2
+		return nil
+	}
+	for idx := range aliases {
+		if states[idx] == 0 {
+			if err := visit(idx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func validateBaseFilters(filters *sdk.BaseUserFilters) error {
 	checkEmptyFiltersStruct(filters)
 	if err := validateIPFilters(filters); err != nil {
@@ -2800,10 +3490,8 @@ func hashPlainPassword(plainPwd string) (string, error) {
 
 func createUserPasswordHash(user *User) error {
 	if user.Password != "" && !user.IsPasswordHashed() {
-		if config.PasswordValidation.Users.MinEntropy > 0 {
-			if err := passwordvalidator.Validate(user.Password, config.PasswordValidation.Users.MinEntropy); err != nil {
-				return util.NewValidationError(err.Error())
-			}
+		if err := checkUserPassword(user, user.Password); err != nil {
+			return err
 		}
 		hashedPwd, err := hashPlainPassword(user.Password)
 		if err != nil {
@@ -2825,6 +3513,10 @@ func ValidateFolder(folder *vfs.BaseVirtualFolder) error {
 		return util.NewValidationError(fmt.Sprintf("folder name %#v is not valid, the following characters are allowed: a-zA-Z0-9-_.~",
 			folder.Name))
 	}
+	if folder.MappedPath == "" && config.HomeDirTemplate != "" &&
+		(folder.FsConfig.Provider == sdk.LocalFilesystemProvider || folder.FsConfig.Provider == sdk.CryptedFilesystemProvider) {
+		folder.MappedPath = expandHomeDirTemplate(config.HomeDirTemplate, folder.Name, "")
+	}
 	if folder.FsConfig.Provider == sdk.LocalFilesystemProvider || folder.FsConfig.Provider == sdk.CryptedFilesystemProvider ||
 		folder.MappedPath != "" {
 		cleanedMPath := filepath.Clean(folder.MappedPath)
@@ -2836,6 +3528,9 @@ func ValidateFolder(folder *vfs.BaseVirtualFolder) error {
 	if folder.HasRedactedSecret() {
 		return errors.New("cannot save a folder with a redacted secret")
 	}
+	if err := folder.AuditLog.Validate(); err != nil {
+		return err
+	}
 	return folder.FsConfig.Validate(folder.GetEncryptionAdditionalData())
 }
 
@@ -2877,6 +3572,63 @@ func ValidateUser(user *User) error {
 	if err := validateBaseFilters(&user.Filters.BaseUserFilters); err != nil {
 		return err
 	}
+	if err := validateForwardTargets(user); err != nil {
+		return err
+	}
+	if err := validateSSHExecCommands(user); err != nil {
+		return err
+	}
+	if err := user.Filters.LoginCooldown.validate(); err != nil {
+		return err
+	}
+	if err := validatePathUploadLimits(user); err != nil {
+		return err
+	}
+	if err := validatePathAliases(user); err != nil {
+		return err
+	}
+	if err := validatePathRewriteRules(user); err != nil {
+		return err
+	}
+	if err := user.Filters.AutoExtract.validate(); err != nil {
+		return err
+	}
+	if err := user.Filters.DataRetentionPolicy.validate(); err != nil {
+		return err
+	}
+	if err := validateAnomalyRules(user); err != nil {
+		return err
+	}
+	if err := validateQuotaWarningThresholds(user); err != nil {
+		return err
+	}
+	if user.Filters.FileNameSanitize != "" && !util.Contains(ValidFileNameSanitizeModes, user.Filters.FileNameSanitize) {
+		return util.NewValidationError(fmt.Sprintf("invalid file name sanitization mode %q", user.Filters.FileNameSanitize))
+	}
+	if user.Filters.DirListOrder != "" && !util.Contains(ValidDirListOrders, user.Filters.DirListOrder) {
+		return util.NewValidationError(fmt.Sprintf("invalid directory listing order %q", user.Filters.DirListOrder))
+	}
+	if user.Filters.DirListOrder == "" {
+		user.Filters.DirListDirsFirst = false
+	}
+	if user.Filters.MaxFilesPerDir < 0 {
+		return util.NewValidationError("max files per directory cannot be negative")
+	}
+	if user.Filters.MaxOpenHandles < 0 {
+		return util.NewValidationError("max open handles cannot be negative")
+	}
+	if user.Filters.MaxActiveSessions < 0 {
+		return util.NewValidationError("max active sessions cannot be negative")
+	}
+	if user.Filters.UploadBurstSize < 0 || user.Filters.DownloadBurstSize < 0 {
+		return util.NewValidationError("bandwidth burst size cannot be negative")
+	}
+	if user.Filters.UploadMode != "" && !util.Contains(ValidUploadModes, user.Filters.UploadMode) {
+		return util.NewValidationError(fmt.Sprintf("invalid upload mode %q", user.Filters.UploadMode))
+	}
+	if user.Filters.UploadMode == UploadModeDefault {
+		user.Filters.UploadMode = ""
+	}
 	if !user.HasExternalAuth() {
 		user.Filters.ExternalAuthCacheTime = 0
 	}
@@ -2957,11 +3709,17 @@ func checkUserAndTLSCertificate(user *User, protocol string, tlsCert *x509.Certi
 	}
 	switch protocol {
 	case protocolFTP, protocolWebDAV:
-		if user.Filters.TLSUsername == sdk.TLSUsernameCN {
+		switch user.Filters.TLSUsername {
+		case sdk.TLSUsernameCN:
 			if user.Username == tlsCert.Subject.CommonName {
 				return *user, nil
 			}
 			return *user, fmt.Errorf("CN %#v does not match username %#v", tlsCert.Subject.CommonName, user.Username)
+		case TLSUsernameSAN:
+			if util.Contains(tlsCert.DNSNames, user.Username) || util.Contains(tlsCert.EmailAddresses, user.Username) {
+				return *user, nil
+			}
+			return *user, fmt.Errorf("no subject alternative name matches username %q", user.Username)
 		}
 		return *user, errors.New("TLS certificate is not valid")
 	default:
@@ -3077,6 +3835,7 @@ func checkUserAndPubKey(user *User, pubKey []byte, isSSHCert bool) (User, string
 			return *user, "", err
 		}
 		if bytes.Equal(storedPubKey.Marshal(), pubKey) {
+			logPublicKeyWarnings(user, storedPubKey, comment)
 			return *user, fmt.Sprintf("%s:%s", ssh.FingerprintSHA256(storedPubKey), comment), nil
 		}
 	}
@@ -3515,11 +4274,14 @@ func getPasswordHookResponse(username, password, ip, protocol string) ([]byte, e
 		if err != nil {
 			return result, err
 		}
-		resp, err := httpclient.Post(config.CheckPasswordHook, "application/json", bytes.NewBuffer(reqAsJSON))
+		resp, err := postToHookWithBreaker(command.HookCheckPassword, config.CheckPasswordHook, reqAsJSON)
 		if err != nil {
 			providerLog(logger.LevelError, "error getting check password hook response: %v", err)
 			return result, err
 		}
+		if resp == nil {
+			return result, circuitbreaker.ErrOpen
+		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
 			return result, fmt.Errorf("wrong http status code from chek password hook: %v, expected 200", resp.StatusCode)
@@ -3537,7 +4299,7 @@ func getPasswordHookResponse(username, password, ip, protocol string) ([]byte, e
 		fmt.Sprintf("SFTPGO_AUTHD_IP=%v", ip),
 		fmt.Sprintf("SFTPGO_AUTHD_PROTOCOL=%v", protocol),
 	)
-	return cmd.Output()
+	return getHookCommandOutput(ctx, command.HookCheckPassword, cmd)
 }
 
 func executeCheckPasswordHook(username, password, ip, protocol string) (checkPasswordResponse, error) {
@@ -3573,11 +4335,15 @@ func getPreLoginHookResponse(loginMethod, ip, protocol string, userAsJSON []byte
 		q.Add("protocol", protocol)
 		url.RawQuery = q.Encode()
 
-		resp, err := httpclient.Post(url.String(), "application/json", bytes.NewBuffer(userAsJSON))
+		resp, err := postToHookWithBreaker(command.HookPreLogin, url.String(), userAsJSON)
 		if err != nil {
 			providerLog(logger.LevelWarn, "error getting pre-login hook response: %v", err)
 			return result, err
 		}
+		if resp == nil {
+			// circuit open, fail open: no modification requested
+			return result, nil
+		}
 		defer resp.Body.Close()
 		if resp.StatusCode == http.StatusNoContent {
 			return result, nil
@@ -3598,7 +4364,7 @@ func getPreLoginHookResponse(loginMethod, ip, protocol string, userAsJSON []byte
 		fmt.Sprintf("SFTPGO_LOGIND_IP=%v", ip),
 		fmt.Sprintf("SFTPGO_LOGIND_PROTOCOL=%v", protocol),
 	)
-	return cmd.Output()
+	return getHookCommandOutput(ctx, command.HookPreLogin, cmd)
 }
 
 func executePreLoginHook(username, loginMethod, ip, protocol string, oidcTokenFields *map[string]any) (User, error) {
@@ -3638,6 +4404,7 @@ func executePreLoginHook(username, loginMethod, ip, protocol string, oidcTokenFi
 	userCreatedAt := u.CreatedAt
 	totpConfig := u.Filters.TOTPConfig
 	recoveryCodes := u.Filters.RecoveryCodes
+	keysInfo := u.Filters.PublicKeysInfo
 	err = json.Unmarshal(out, &u)
 	if err != nil {
 		return u, fmt.Errorf("invalid pre-login hook response %#v, error: %v", string(out), err)
@@ -3652,6 +4419,7 @@ func executePreLoginHook(username, loginMethod, ip, protocol string, oidcTokenFi
 	u.FirstDownload = userFirstDownload
 	u.FirstUpload = userFirstUpload
 	u.CreatedAt = userCreatedAt
+	updatePublicKeysInfo(&u, keysInfo)
 	if userID == 0 {
 		err = provider.addUser(&u)
 	} else {
@@ -3677,8 +4445,13 @@ func executePreLoginHook(username, loginMethod, ip, protocol string, oidcTokenFi
 	return u, nil
 }
 
-// ExecutePostLoginHook executes the post login hook if defined
+// ExecutePostLoginHook executes the post login hook if defined and
+// notifies the user about successful logins if enabled
 func ExecutePostLoginHook(user *User, loginMethod, ip, protocol string, err error) {
+	updateLoginCooldown(user, loginMethod, ip, protocol, err)
+	if err == nil {
+		checkLoginNotification(user, loginMethod, ip, protocol)
+	}
 	if config.PostLoginHook == "" {
 		return
 	}
@@ -3722,11 +4495,18 @@ func ExecutePostLoginHook(user *User, loginMethod, ip, protocol string, err erro
 
 			startTime := time.Now()
 			respCode := 0
-			resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(userAsJSON))
-			if err == nil {
+			err = circuitbreaker.Execute(command.HookPostLogin, func() error {
+				resp, err := httpclient.RetryablePost(url.String(), "application/json", bytes.NewBuffer(userAsJSON))
+				if err != nil {
+					return err
+				}
 				respCode = resp.StatusCode
 				resp.Body.Close()
-			}
+				if respCode >= http.StatusInternalServerError {
+					return fmt.Errorf("unexpected status code: %d", respCode)
+				}
+				return nil
+			})
 			providerLog(logger.LevelDebug, "post login hook executed for user %#v, ip %v, protocol %v, response code: %v, elapsed: %v err: %v",
 				user.Username, ip, protocol, respCode, time.Since(startTime), err)
 			return
@@ -3743,7 +4523,7 @@ func ExecutePostLoginHook(user *User, loginMethod, ip, protocol string, err erro
 			fmt.Sprintf("SFTPGO_LOGIND_STATUS=%v", status),
 			fmt.Sprintf("SFTPGO_LOGIND_PROTOCOL=%v", protocol))
 		startTime := time.Now()
-		err = cmd.Run()
+		_, err = getHookCommandOutput(ctx, command.HookPostLogin, cmd)
 		providerLog(logger.LevelDebug, "post login hook executed for user %#v, ip %v, protocol %v, elapsed %v err: %v",
 			user.Username, ip, protocol, time.Since(startTime), err)
 	}()
@@ -3778,11 +4558,14 @@ func getExternalAuthResponse(username, password, pkey, keyboardInteractive, ip,
 			providerLog(logger.LevelError, "error serializing external auth request: %v", err)
 			return result, err
 		}
-		resp, err := httpclient.Post(config.ExternalAuthHook, "application/json", bytes.NewBuffer(authRequestAsJSON))
+		resp, err := postToHookWithBreaker(command.HookExternalAuth, config.ExternalAuthHook, authRequestAsJSON)
 		if err != nil {
 			providerLog(logger.LevelWarn, "error getting external auth hook HTTP response: %v", err)
 			return result, err
 		}
+		if resp == nil {
+			return result, circuitbreaker.ErrOpen
+		}
 		defer resp.Body.Close()
 		providerLog(logger.LevelDebug, "external auth hook executed, response code: %v", resp.StatusCode)
 		if resp.StatusCode != http.StatusOK {
@@ -3813,7 +4596,44 @@ func getExternalAuthResponse(username, password, pkey, keyboardInteractive, ip,
 		fmt.Sprintf("SFTPGO_AUTHD_PROTOCOL=%v", protocol),
 		fmt.Sprintf("SFTPGO_AUTHD_TLS_CERT=%v", strings.ReplaceAll(tlsCert, "\n", "\\n")),
 		fmt.Sprintf("SFTPGO_AUTHD_KEYBOARD_INTERACTIVE=%v", keyboardInteractive))
-	return cmd.Output()
+	return getHookCommandOutput(ctx, command.HookExternalAuth, cmd)
+}
+
+// postToHookWithBreaker sends a POST request to an HTTP hook using the circuit breaker
+// configured for the hook, if any. A nil response and a nil error are returned
+// if the circuit is open and the breaker is configured to fail open
+func postToHookWithBreaker(hook, url string, body []byte) (*http.Response, error) {
+	var resp *http.Response
+	err := circuitbreaker.Execute(hook, func() error {
+		var err error
+		resp, err = httpclient.Post(url, "application/json", bytes.NewBuffer(body))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			err = fmt.Errorf("wrong %s hook http status code: %v, expected 200", hook, resp.StatusCode)
+			resp = nil
+			return err
+		}
+		return nil
+	})
+	return resp, err
+}
+
+// getHookCommandOutput runs a command based hook using the circuit breaker configured
+// for the hook, if any, and returns its standard output
+func getHookCommandOutput(ctx context.Context, hook string, cmd *exec.Cmd) ([]byte, error) {
+	var out []byte
+	var cmdErr error
+	err := circuitbreaker.Execute(hook, func() error {
+		out, cmdErr = cmd.Output()
+		return circuitbreaker.GetCommandFailure(ctx, cmdErr)
+	})
+	if err == nil {
+		err = cmdErr
+	}
+	return out, err
 }
 
 func updateUserFromExtAuthResponse(user *User, password, pkey string) {
@@ -3893,6 +4713,7 @@ func doExternalAuth(username, password string, pubKey []byte, keyboardInteractiv
 		// preserve TOTP config and recovery codes
 		user.Filters.TOTPConfig = u.Filters.TOTPConfig
 		user.Filters.RecoveryCodes = u.Filters.RecoveryCodes
+		updatePublicKeysInfo(&user, u.Filters.PublicKeysInfo)
 		err = provider.updateUser(&user)
 		if err == nil {
 			webDAVUsersCache.swap(&user)
@@ -3900,6 +4721,7 @@ func doExternalAuth(username, password string, pubKey []byte, keyboardInteractiv
 		}
 		return user, err
 	}
+	updatePublicKeysInfo(&user, nil)
 	err = provider.addUser(&user)
 	if err != nil {
 		return user, err
@@ -3965,6 +4787,7 @@ func doPluginAuth(username, password string, pubKey []byte, ip, protocol string,
 		// preserve TOTP config and recovery codes
 		user.Filters.TOTPConfig = u.Filters.TOTPConfig
 		user.Filters.RecoveryCodes = u.Filters.RecoveryCodes
+		updatePublicKeysInfo(&user, u.Filters.PublicKeysInfo)
 		err = provider.updateUser(&user)
 		if err == nil {
 			webDAVUsersCache.swap(&user)
@@ -3972,6 +4795,7 @@ func doPluginAuth(username, password string, pubKey []byte, ip, protocol string,
 		}
 		return user, err
 	}
+	updatePublicKeysInfo(&user, nil)
 	err = provider.addUser(&user)
 	if err != nil {
 		return user, err
@@ -0,0 +1,205 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// DataRetentionPolicy defines the retention rules for the files of a user.
+// The rules are defined for virtual path prefixes, the most specific prefix applies
+// to the files inside it and inside its sub directories
+type DataRetentionPolicy struct {
+	// Maps virtual path prefixes to the maximum age, as days, for their files.
+	// Older files are deleted by the data retention checks that enforce the
+	// user policies. 0 means no maximum age for the prefix
+	MaxAgeDays map[string]int `json:"max_age_days,omitempty"`
+	// Maps virtual path prefixes to the minimum age, as days, before their files
+	// can be deleted by the user. 0 means no minimum age for the prefix
+	MinRetentionDays map[string]int `json:"min_retention_days,omitempty"`
+}
+
+func cleanRetentionPolicyPaths(policy map[string]int, name string) (map[string]int, error) {
+	if len(policy) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]int)
+	for p, days := range policy {
+		if days < 0 {
+			return nil, util.NewValidationError(fmt.Sprintf("invalid data retention %s for path %q: %d", name, p, days))
+		}
+		cleanedPath := util.CleanPath(p)
+		if _, ok := result[cleanedPath]; ok {
+			return nil, util.NewValidationError(fmt.Sprintf("duplicated data retention %s path %q", name, cleanedPath))
+		}
+		result[cleanedPath] = days
+	}
+	return result, nil
+}
+
+func getRetentionPolicyDays(policy map[string]int, virtualPath string) int {
+	for _, dirPath := range util.GetDirsForVirtualPath(virtualPath) {
+		if days, ok := policy[dirPath]; ok {
+			return days
+		}
+	}
+	return 0
+}
+
+func (p *DataRetentionPolicy) validate() error {
+	var err error
+
+	p.MaxAgeDays, err = cleanRetentionPolicyPaths(p.MaxAgeDays, "max age")
+	if err != nil {
+		return err
+	}
+	p.MinRetentionDays, err = cleanRetentionPolicyPaths(p.MinRetentionDays, "min retention")
+	if err != nil {
+		return err
+	}
+	// the policy must not delete files that the user cannot delete yet
+	for dirPath := range p.MinRetentionDays {
+		if err := p.checkConflict(dirPath); err != nil {
+			return err
+		}
+	}
+	for dirPath := range p.MaxAgeDays {
+		if err := p.checkConflict(dirPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *DataRetentionPolicy) checkConflict(dirPath string) error {
+	maxAge := p.GetMaxAgeDays(dirPath)
+	minRetention := p.GetMinRetentionDays(dirPath)
+	if maxAge > 0 && minRetention > maxAge {
+		return util.NewValidationError(fmt.Sprintf("the data retention min retention for path %q (%d days) exceeds the max age (%d days)",
+			dirPath, minRetention, maxAge))
+	}
+	return nil
+}
+
+// IsEnabled returns true if the policy defines at least a max age
+func (p *DataRetentionPolicy) IsEnabled() bool {
+	for _, days := range p.MaxAgeDays {
+		if days > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaxAgeDays returns the max age, as days, for the specified virtual directory.
+// 0 means no max age
+func (p *DataRetentionPolicy) GetMaxAgeDays(virtualDir string) int {
+	return getRetentionPolicyDays(p.MaxAgeDays, virtualDir)
+}
+
+// GetMinRetentionDays returns the min retention, as days, for the specified
+// virtual directory. 0 means no min retention
+func (p *DataRetentionPolicy) GetMinRetentionDays(virtualDir string) int {
+	return getRetentionPolicyDays(p.MinRetentionDays, virtualDir)
+}
+
+// IsRemoveAllowed returns false if the file with the specified virtual path
+// and modification time is younger than the min retention
+func (p *DataRetentionPolicy) IsRemoveAllowed(virtualPath string, modTime time.Time) bool {
+	days := p.GetMinRetentionDays(path.Dir(virtualPath))
+	if days == 0 {
+		return true
+	}
+	return time.Since(modTime) >= time.Duration(days)*24*time.Hour
+}
+
+// GetFolderRetentions returns the folder retentions to use to enforce the
+// max age of this policy. The retentions are sorted by path
+func (p *DataRetentionPolicy) GetFolderRetentions() []FolderRetention {
+	folders := make([]FolderRetention, 0, len(p.MaxAgeDays))
+	for dirPath, days := range p.MaxAgeDays {
+		folders = append(folders, FolderRetention{
+			Path:                  dirPath,
+			Retention:             days * 24,
+			IgnoreUserPermissions: true,
+		})
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Path < folders[j].Path
+	})
+	return folders
+}
+
+// DataRetentionRule defines the max age and the min retention for a virtual path
+type DataRetentionRule struct {
+	Path             string
+	MaxAgeDays       int
+	HasMaxAge        bool
+	MinRetentionDays int
+	HasMinRetention  bool
+}
+
+// GetRules returns the policy rules sorted by path
+func (p *DataRetentionPolicy) GetRules() []DataRetentionRule {
+	rules := make(map[string]*DataRetentionRule)
+	getRule := func(dirPath string) *DataRetentionRule {
+		rule, ok := rules[dirPath]
+		if !ok {
+			rule = &DataRetentionRule{Path: dirPath}
+			rules[dirPath] = rule
+		}
+		return rule
+	}
+	for dirPath, days := range p.MaxAgeDays {
+		rule := getRule(dirPath)
+		rule.MaxAgeDays = days
+		rule.HasMaxAge = true
+	}
+	for dirPath, days := range p.MinRetentionDays {
+		rule := getRule(dirPath)
+		rule.MinRetentionDays = days
+		rule.HasMinRetention = true
+	}
+	result := make([]DataRetentionRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, *rule)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+func (p *DataRetentionPolicy) getACopy() DataRetentionPolicy {
+	var policy DataRetentionPolicy
+	if len(p.MaxAgeDays) > 0 {
+		policy.MaxAgeDays = make(map[string]int)
+		for k, v := range p.MaxAgeDays {
+			policy.MaxAgeDays[k] = v
+		}
+	}
+	if len(p.MinRetentionDays) > 0 {
+		policy.MinRetentionDays = make(map[string]int)
+		for k, v := range p.MinRetentionDays {
+			policy.MinRetentionDays[k] = v
+		}
+	}
+	return policy
+}
@@ -159,7 +159,7 @@ func getFsActionTypeAsString(value int) string {
 var (
 	// SupportedFsEvents defines the supported filesystem events
 	SupportedFsEvents = []string{"upload", "first-upload", "download", "first-download", "delete", "rename",
-		"mkdir", "rmdir", "ssh_cmd"}
+		"copy", "mkdir", "rmdir", "ssh_cmd"}
 	// SupportedProviderEvents defines the supported provider events
 	SupportedProviderEvents = []string{operationAdd, operationUpdate, operationDelete}
 	// SupportedRuleConditionProtocols defines the supported protcols for rule conditions
@@ -518,9 +518,18 @@ func (f *FolderRetention) Validate() error {
 // EventActionDataRetentionConfig defines the configuration for a data retention check
 type EventActionDataRetentionConfig struct {
 	Folders []FolderRetention `json:"folders,omitempty"`
+	// Enforce the data retention policy defined for each user instead of the
+	// specified folders. Users without a retention policy are skipped
+	UserPolicies bool `json:"user_policies,omitempty"`
 }
 
 func (c *EventActionDataRetentionConfig) validate() error {
+	if c.UserPolicies {
+		if len(c.Folders) > 0 {
+			return util.NewValidationError("folders cannot be set if the user data retention policies are enforced")
+		}
+		return nil
+	}
 	folderPaths := make(map[string]bool)
 	nothingToDo := true
 	for idx := range c.Folders {
@@ -817,7 +826,8 @@ func (o *BaseEventActionOptions) getACopy() BaseEventActionOptions {
 			Attachments: emailAttachments,
 		},
 		RetentionConfig: EventActionDataRetentionConfig{
-			Folders: folders,
+			Folders:      folders,
+			UserPolicies: o.RetentionConfig.UserPolicies,
 		},
 		FsConfig: o.FsConfig.getACopy(),
 	}
@@ -897,6 +907,8 @@ type BaseEventAction struct {
 	Type int `json:"type"`
 	// Configuration options specific for the action type
 	Options BaseEventActionOptions `json:"options"`
+	// last update time as unix timestamp in milliseconds
+	UpdatedAt int64 `json:"updated_at,omitempty"`
 	// list of rule names associated with this event action
 	Rules []string `json:"rules,omitempty"`
 }
@@ -910,6 +922,7 @@ func (a *BaseEventAction) getACopy() BaseEventAction {
 		Description: a.Description,
 		Type:        a.Type,
 		Options:     a.Options.getACopy(),
+		UpdatedAt:   a.UpdatedAt,
 		Rules:       rules,
 	}
 }
@@ -28,6 +28,12 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
+const (
+	// maxGroupHierarchyDepth defines the max number of levels for nested groups,
+	// the group itself is included
+	maxGroupHierarchyDepth = 5
+)
+
 // GroupUserSettings defines the settings to apply to users
 type GroupUserSettings struct {
 	sdk.BaseGroupUserSettings
@@ -43,6 +49,9 @@ type Group struct {
 	UserSettings GroupUserSettings `json:"user_settings,omitempty"`
 	// Mapping between virtual paths and virtual folders
 	VirtualFolders []vfs.VirtualFolder `json:"virtual_folders,omitempty"`
+	// Optional parent group. The settings not defined in this group are
+	// inherited from the parent groups
+	ParentGroup string `json:"parent_group,omitempty"`
 }
 
 // GetPermissions returns the permissions as list
@@ -143,6 +152,9 @@ func (g *Group) validate() error {
 	if g.hasRedactedSecret() {
 		return util.NewValidationError("cannot save a user with a redacted secret")
 	}
+	if err := g.validateParentGroup(); err != nil {
+		return err
+	}
 	vfolders, err := validateAssociatedVirtualFolders(g.VirtualFolders)
 	if err != nil {
 		return err
@@ -151,6 +163,29 @@ func (g *Group) validate() error {
 	return g.validateUserSettings()
 }
 
+func (g *Group) validateParentGroup() error {
+	if g.ParentGroup == "" {
+		return nil
+	}
+	g.ParentGroup = config.convertName(g.ParentGroup)
+	if g.ParentGroup == g.Name {
+		return util.NewValidationError("a group cannot be its own parent")
+	}
+	groups, err := provider.dumpGroups()
+	if err != nil {
+		return err
+	}
+	groupsMapping := make(map[string]Group)
+	for _, group := range groups {
+		groupsMapping[group.Name] = group
+	}
+	if _, ok := groupsMapping[g.ParentGroup]; !ok {
+		return util.NewValidationError(fmt.Sprintf("parent group %q does not exist", g.ParentGroup))
+	}
+	groupsMapping[g.Name] = *g
+	return checkGroupHierarchy(groupsMapping)
+}
+
 func (g *Group) validateUserSettings() error {
 	if g.UserSettings.HomeDir != "" {
 		g.UserSettings.HomeDir = filepath.Clean(g.UserSettings.HomeDir)
@@ -228,6 +263,7 @@ func (g *Group) getACopy() Group {
 			FsConfig: g.UserSettings.FsConfig.GetACopy(),
 		},
 		VirtualFolders: virtualFolders,
+		ParentGroup:    g.ParentGroup,
 	}
 }
 
@@ -242,3 +278,228 @@ func (g *Group) GetMembersAsString() string {
 	}
 	return sb.String()
 }
+
+// checkGroupHierarchy returns an error if the hierarchy of any of the specified
+// groups has a cycle or exceeds the max allowed depth
+func checkGroupHierarchy(groupsMapping map[string]Group) error {
+	for name := range groupsMapping {
+		visited := make(map[string]bool)
+		for current := name; current != ""; current = groupsMapping[current].ParentGroup {
+			if visited[current] {
+				return util.NewValidationError(fmt.Sprintf("cycle detected in the hierarchy of the group %q", name))
+			}
+			visited[current] = true
+			if len(visited) > maxGroupHierarchyDepth {
+				return util.NewValidationError(fmt.Sprintf("the hierarchy of the group %q exceeds the max allowed depth: %d",
+					name, maxGroupHierarchyDepth))
+			}
+		}
+	}
+	return nil
+}
+
+// SortGroupsByHierarchy returns the specified groups ordered so that the parent
+// groups come before their children, this is the order to follow to restore them
+func SortGroupsByHierarchy(groups []Group) []Group {
+	result := make([]Group, 0, len(groups))
+	added := make(map[string]bool)
+	for depth := 0; depth < maxGroupHierarchyDepth && len(result) < len(groups); depth++ {
+		for _, group := range groups {
+			if added[group.Name] {
+				continue
+			}
+			if group.ParentGroup == "" || added[group.ParentGroup] || !containsGroup(groups, group.ParentGroup) {
+				result = append(result, group)
+				added[group.Name] = true
+			}
+		}
+	}
+	// invalid hierarchies will be rejected while restoring
+	for _, group := range groups {
+		if !added[group.Name] {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+func containsGroup(groups []Group, name string) bool {
+	for _, group := range groups {
+		if group.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getDescendantGroups returns the names of the groups that inherit, directly or
+// indirectly, from the group with the specified name. The hierarchy is walked
+// one level at a time using the parent group lookups, the groups found before
+// an error are returned too
+func getDescendantGroups(name string) ([]string, error) {
+	var result []string
+	parents := []string{name}
+	for depth := 1; depth < maxGroupHierarchyDepth && len(parents) > 0; depth++ {
+		children, err := provider.getChildGroups(parents)
+		if err != nil {
+			return result, err
+		}
+		parents = nil
+		for _, child := range children {
+			if child != name && !util.Contains(result, child) {
+				parents = append(parents, child)
+			}
+		}
+		result = append(result, parents...)
+	}
+	return result, nil
+}
+
+// expandGroupHierarchy returns the group with the settings inherited from its
+// ancestors, the settings defined in the nearest group take precedence.
+// getGroup is used to load the parent groups, this way the expansion can be
+// done within the provider transactions
+func expandGroupHierarchy(group Group, getGroup func(name string) (Group, error)) Group {
+	if group.ParentGroup == "" {
+		return group
+	}
+	group = group.getACopy()
+	visited := map[string]bool{group.Name: true}
+	parentName := group.ParentGroup
+	for depth := 1; parentName != "" && depth < maxGroupHierarchyDepth; depth++ {
+		if visited[parentName] {
+			providerLog(logger.LevelError, "cycle detected in the hierarchy of the group %q", group.Name)
+			break
+		}
+		visited[parentName] = true
+		parent, err := getGroup(parentName)
+		if err != nil {
+			providerLog(logger.LevelError, "unable to get parent group %q for group %q: %v", parentName, group.Name, err)
+			break
+		}
+		group.mergeWithParent(parent)
+		parentName = parent.ParentGroup
+	}
+	return group
+}
+
+// expandGroupsHierarchy expands the hierarchy for the groups in the specified mapping
+func expandGroupsHierarchy(groupsMapping map[string]Group, getGroup func(name string) (Group, error)) {
+	for name, group := range groupsMapping {
+		groupsMapping[name] = expandGroupHierarchy(group, getGroup)
+	}
+}
+
+// mergeWithParent merges the settings not defined in this group from the parent one
+func (g *Group) mergeWithParent(parent Group) {
+	settings := &g.UserSettings
+	if settings.HomeDir == "" {
+		settings.HomeDir = parent.UserSettings.HomeDir
+	}
+	if settings.FsConfig.Provider == sdk.LocalFilesystemProvider {
+		settings.FsConfig = parent.UserSettings.FsConfig.GetACopy()
+	}
+	if settings.MaxSessions == 0 {
+		settings.MaxSessions = parent.UserSettings.MaxSessions
+	}
+	if settings.QuotaSize == 0 {
+		settings.QuotaSize = parent.UserSettings.QuotaSize
+	}
+	if settings.QuotaFiles == 0 {
+		settings.QuotaFiles = parent.UserSettings.QuotaFiles
+	}
+	if settings.UploadBandwidth == 0 {
+		settings.UploadBandwidth = parent.UserSettings.UploadBandwidth
+	}
+	if settings.DownloadBandwidth == 0 {
+		settings.DownloadBandwidth = parent.UserSettings.DownloadBandwidth
+	}
+	if settings.UploadDataTransfer == 0 && settings.DownloadDataTransfer == 0 && settings.TotalDataTransfer == 0 {
+		settings.UploadDataTransfer = parent.UserSettings.UploadDataTransfer
+		settings.DownloadDataTransfer = parent.UserSettings.DownloadDataTransfer
+		settings.TotalDataTransfer = parent.UserSettings.TotalDataTransfer
+	}
+	g.mergeParentFilters(parent.UserSettings.Filters)
+	g.mergeParentAdditiveProperties(parent)
+}
+
+func (g *Group) mergeParentFilters(filters sdk.BaseUserFilters) {
+	current := &g.UserSettings.Filters
+	if current.MaxUploadFileSize == 0 {
+		current.MaxUploadFileSize = filters.MaxUploadFileSize
+	}
+	if current.TLSUsername == "" || current.TLSUsername == sdk.TLSUsernameNone {
+		current.TLSUsername = filters.TLSUsername
+	}
+	if !current.Hooks.CheckPasswordDisabled {
+		current.Hooks.CheckPasswordDisabled = filters.Hooks.CheckPasswordDisabled
+	}
+	if !current.Hooks.PreLoginDisabled {
+		current.Hooks.PreLoginDisabled = filters.Hooks.PreLoginDisabled
+	}
+	if !current.Hooks.ExternalAuthDisabled {
+		current.Hooks.ExternalAuthDisabled = filters.Hooks.ExternalAuthDisabled
+	}
+	if !current.DisableFsChecks {
+		current.DisableFsChecks = filters.DisableFsChecks
+	}
+	if !current.AllowAPIKeyAuth {
+		current.AllowAPIKeyAuth = filters.AllowAPIKeyAuth
+	}
+	if !current.IsAnonymous {
+		current.IsAnonymous = filters.IsAnonymous
+	}
+	if current.ExternalAuthCacheTime == 0 {
+		current.ExternalAuthCacheTime = filters.ExternalAuthCacheTime
+	}
+	if current.FTPSecurity == 0 {
+		current.FTPSecurity = filters.FTPSecurity
+	}
+	if current.StartDirectory == "" {
+		current.StartDirectory = filters.StartDirectory
+	}
+	if current.DefaultSharesExpiration == 0 {
+		current.DefaultSharesExpiration = filters.DefaultSharesExpiration
+	}
+}
+
+// mergeParentAdditiveProperties adds the parent permissions, virtual folders and
+// file patterns for the paths not defined in this group and the parent list filters
+func (g *Group) mergeParentAdditiveProperties(parent Group) {
+	if g.UserSettings.Permissions == nil {
+		g.UserSettings.Permissions = make(map[string][]string)
+	}
+	for k, v := range parent.UserSettings.Permissions {
+		if _, ok := g.UserSettings.Permissions[k]; !ok {
+			g.UserSettings.Permissions[k] = v
+		}
+	}
+	folderPaths := make(map[string]bool)
+	for _, folder := range g.VirtualFolders {
+		folderPaths[folder.VirtualPath] = true
+	}
+	for _, folder := range parent.VirtualFolders {
+		if !folderPaths[folder.VirtualPath] {
+			g.VirtualFolders = append(g.VirtualFolders, folder.GetACopy())
+		}
+	}
+	current := &g.UserSettings.Filters
+	filters := parent.UserSettings.Filters
+	patternPaths := make(map[string]bool)
+	for _, pattern := range current.FilePatterns {
+		patternPaths[pattern.Path] = true
+	}
+	for _, pattern := range filters.FilePatterns {
+		if !patternPaths[pattern.Path] {
+			current.FilePatterns = append(current.FilePatterns, pattern)
+		}
+	}
+	current.BandwidthLimits = append(current.BandwidthLimits, filters.BandwidthLimits...)
+	current.DataTransferLimits = append(current.DataTransferLimits, filters.DataTransferLimits...)
+	current.AllowedIP = append(current.AllowedIP, filters.AllowedIP...)
+	current.DeniedIP = append(current.DeniedIP, filters.DeniedIP...)
+	current.DeniedLoginMethods = append(current.DeniedLoginMethods, filters.DeniedLoginMethods...)
+	current.DeniedProtocols = append(current.DeniedProtocols, filters.DeniedProtocols...)
+	current.WebClient = append(current.WebClient, filters.WebClient...)
+	current.TwoFactorAuthProtocols = append(current.TwoFactorAuthProtocols, filters.TwoFactorAuthProtocols...)
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sftpgo/sdk"
+)
+
+// Supported home dir template variables
+const (
+	homeDirTemplateUsername  = "{username}"
+	homeDirTemplateGroup     = "{group}"
+	homeDirTemplateFirstChar = "{first_char}"
+	homeDirTemplateDate      = "{date}"
+)
+
+var homeDirTemplateVars = []string{homeDirTemplateUsername, homeDirTemplateGroup, homeDirTemplateFirstChar,
+	homeDirTemplateDate}
+
+// ValidateHomeDirTemplate returns an error if the specified home dir template
+// is not valid. A valid template is an absolute path and can only contain
+// the supported variables
+func ValidateHomeDirTemplate(tpl string) error {
+	if tpl == "" {
+		return nil
+	}
+	if !filepath.IsAbs(tpl) {
+		return fmt.Errorf("home dir template %q must be an absolute path", tpl)
+	}
+	remaining := tpl
+	for _, v := range homeDirTemplateVars {
+		remaining = strings.ReplaceAll(remaining, v, "")
+	}
+	if strings.ContainsAny(remaining, "{}") {
+		return fmt.Errorf("home dir template %q contains unsupported variables, allowed: %s", tpl,
+			strings.Join(homeDirTemplateVars, ", "))
+	}
+	if !strings.Contains(tpl, homeDirTemplateUsername) {
+		return errors.New("home dir template must contain the {username} variable")
+	}
+	return nil
+}
+
+// expandHomeDirTemplate returns the path obtained replacing the template
+// variables with the specified values
+func expandHomeDirTemplate(tpl, name, group string) string {
+	firstChar := ""
+	if r, _ := utf8.DecodeRuneInString(name); r != utf8.RuneError {
+		firstChar = string(r)
+	}
+	replacer := strings.NewReplacer(
+		homeDirTemplateUsername, name,
+		homeDirTemplateGroup, group,
+		homeDirTemplateFirstChar, firstChar,
+		homeDirTemplateDate, time.Now().Format("2006-01-02"),
+	)
+	return filepath.Clean(replacer.Replace(tpl))
+}
+
+func getUserHomeDirFromTemplate(user *User) string {
+	var group string
+	for _, g := range user.Groups {
+		if g.Type == sdk.GroupTypePrimary {
+			group = g.Name
+			break
+		}
+	}
+	return expandHomeDirTemplate(config.HomeDirTemplate, user.Username, group)
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	// RSA keys shorter than this are flagged even if no minimum length is configured
+	weakRSABits = 2048
+)
+
+var (
+	revokedKeys = revokedPublicKeys{
+		keys: map[string]bool{},
+	}
+)
+
+// PublicKeysAudit defines the audit rules for the SSH public keys of the users
+type PublicKeysAudit struct {
+	// Enable the daily audit of the users public keys. Flagged keys are logged
+	// and, if an SMTP server is configured, the users are notified via email
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// Minimum length for RSA keys. Shorter keys cannot be added and the existing
+	// ones are flagged. 0 means no minimum length
+	MinimumRSABits int `json:"minimum_rsa_bits" mapstructure:"minimum_rsa_bits"`
+	// Keys added more than the specified number of days ago are flagged.
+	// 0 means no age check
+	MaxAge int `json:"max_age" mapstructure:"max_age"`
+	// Path to a JSON file containing the SHA256 fingerprints of revoked public keys.
+	// This can be an absolute path or a path relative to the config dir
+	RevokedKeysFile string `json:"revoked_keys_file" mapstructure:"revoked_keys_file"`
+}
+
+func (a *PublicKeysAudit) initialize(configDir string) error {
+	if a.MinimumRSABits < 0 {
+		return fmt.Errorf("invalid minimum RSA bits: %d", a.MinimumRSABits)
+	}
+	if a.MaxAge < 0 {
+		return fmt.Errorf("invalid public keys max age: %d", a.MaxAge)
+	}
+	revokedKeys.filePath = ""
+	if a.RevokedKeysFile != "" {
+		revokedKeys.filePath = getConfigPath(a.RevokedKeysFile, configDir)
+		if revokedKeys.filePath == "" {
+			return fmt.Errorf("invalid revoked keys file: %q", a.RevokedKeysFile)
+		}
+	}
+	return revokedKeys.load()
+}
+
+// IsPublicKeysAuditEnabled returns true if the periodic audit of the users
+// public keys is enabled
+func IsPublicKeysAuditEnabled() bool {
+	return config.PublicKeysAudit.Enabled
+}
+
+type revokedPublicKeys struct {
+	filePath string
+	mu       sync.RWMutex
+	keys     map[string]bool
+}
+
+func (r *revokedPublicKeys) load() error {
+	var keys []string
+	if r.filePath != "" {
+		info, err := os.Stat(r.filePath)
+		if err != nil {
+			return fmt.Errorf("unable to load revoked keys file %q: %w", r.filePath, err)
+		}
+		maxSize := int64(1048576 * 5) // 5MB
+		if info.Size() > maxSize {
+			return fmt.Errorf("unable to load revoked keys file %q size too big: %v/%v bytes",
+				r.filePath, info.Size(), maxSize)
+		}
+		content, err := os.ReadFile(r.filePath)
+		if err != nil {
+			return fmt.Errorf("unable to read revoked keys file %q: %w", r.filePath, err)
+		}
+		if err := json.Unmarshal(content, &keys); err != nil {
+			return fmt.Errorf("unable to parse revoked keys file %q: %w", r.filePath, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = map[string]bool{}
+	for _, fp := range keys {
+		r.keys[fp] = true
+	}
+	providerLog(logger.LevelDebug, "revoked keys file %q loaded, entries: %d", r.filePath, len(r.keys))
+	return nil
+}
+
+func (r *revokedPublicKeys) isRevoked(fp string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.keys[fp]
+}
+
+// PublicKeyInfo defines the metadata stored for a public key
+type PublicKeyInfo struct {
+	// SHA256 fingerprint
+	Fingerprint string `json:"fingerprint"`
+	// key registration as unix timestamp in milliseconds
+	AddedAt int64 `json:"added_at"`
+}
+
+// PublicKeyAudit defines the audit results for a public key
+type PublicKeyAudit struct {
+	Fingerprint string   `json:"fingerprint"`
+	Type        string   `json:"type"`
+	Bits        int      `json:"bits,omitempty"`
+	Comment     string   `json:"comment,omitempty"`
+	AddedAt     int64    `json:"added_at,omitempty"`
+	Warnings    []string `json:"warnings"`
+}
+
+func getPublicKeyBits(key ssh.PublicKey) int {
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+		return rsaKey.N.BitLen()
+	}
+	return 0
+}
+
+func validatePublicKeyStrength(key ssh.PublicKey) error {
+	if config.PublicKeysAudit.MinimumRSABits > 0 && key.Type() == ssh.KeyAlgoRSA {
+		bits := getPublicKeyBits(key)
+		if bits < config.PublicKeysAudit.MinimumRSABits {
+			return fmt.Errorf("RSA keys must be at least %d bits, got %d", config.PublicKeysAudit.MinimumRSABits, bits)
+		}
+	}
+	return nil
+}
+
+func auditPublicKey(key ssh.PublicKey, comment string, addedAt int64) PublicKeyAudit {
+	result := PublicKeyAudit{
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Type:        key.Type(),
+		Bits:        getPublicKeyBits(key),
+		Comment:     comment,
+		AddedAt:     addedAt,
+		Warnings:    []string{},
+	}
+	switch result.Type {
+	case ssh.KeyAlgoDSA:
+		result.Warnings = append(result.Warnings, "DSA keys are deprecated, please use an Ed25519 key")
+	case ssh.KeyAlgoRSA:
+		if config.PublicKeysAudit.MinimumRSABits > 0 && result.Bits < config.PublicKeysAudit.MinimumRSABits {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("the RSA key is shorter than the required minimum of %d bits",
+				config.PublicKeysAudit.MinimumRSABits))
+		} else if result.Bits < weakRSABits {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("RSA keys shorter than %d bits are weak, please use an Ed25519 key",
+				weakRSABits))
+		}
+	}
+	if config.PublicKeysAudit.MaxAge > 0 && addedAt > 0 {
+		maxAge := time.Duration(config.PublicKeysAudit.MaxAge) * 24 * time.Hour
+		if util.GetTimeFromMsecSinceEpoch(addedAt).Add(maxAge).Before(time.Now()) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("the key is older than %d days, please replace it",
+				config.PublicKeysAudit.MaxAge))
+		}
+	}
+	if revokedKeys.isRevoked(result.Fingerprint) {
+		result.Warnings = append(result.Warnings, "the key is revoked")
+	}
+	return result
+}
+
+func logPublicKeyWarnings(user *User, key ssh.PublicKey, comment string) {
+	var addedAt int64
+	fp := ssh.FingerprintSHA256(key)
+	for _, info := range user.Filters.PublicKeysInfo {
+		if info.Fingerprint == fp {
+			addedAt = info.AddedAt
+			break
+		}
+	}
+	result := auditPublicKey(key, comment, addedAt)
+	if len(result.Warnings) > 0 {
+		providerLog(logger.LevelWarn, "user %q authenticated using the public key %q with warnings: %s",
+			user.Username, fp, strings.Join(result.Warnings, ", "))
+	}
+}
+
+// AuditPublicKeys returns the audit results for the user public keys
+func (u *User) AuditPublicKeys() []PublicKeyAudit {
+	addedAt := make(map[string]int64)
+	for _, info := range u.Filters.PublicKeysInfo {
+		addedAt[info.Fingerprint] = info.AddedAt
+	}
+	results := make([]PublicKeyAudit, 0, len(u.PublicKeys))
+	for _, k := range u.PublicKeys {
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err != nil {
+			continue
+		}
+		results = append(results, auditPublicKey(key, comment, addedAt[ssh.FingerprintSHA256(key)]))
+	}
+	return results
+}
+
+// updatePublicKeysInfo sets the metadata for the user public keys. The metadata
+// from the existing keys are preserved, otherwise the provided ones are used if
+// valid, for example when restoring a backup. New keys are registered now
+func updatePublicKeysInfo(user *User, existing []PublicKeyInfo) {
+	known := make(map[string]int64)
+	for _, info := range user.Filters.PublicKeysInfo {
+		if info.AddedAt > 0 {
+			known[info.Fingerprint] = info.AddedAt
+		}
+	}
+	for _, info := range existing {
+		if info.AddedAt > 0 {
+			known[info.Fingerprint] = info.AddedAt
+		}
+	}
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	seen := make(map[string]bool)
+	var keysInfo []PublicKeyInfo
+	for _, k := range user.PublicKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k))
+		if err != nil {
+			continue
+		}
+		fp := ssh.FingerprintSHA256(key)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		addedAt, ok := known[fp]
+		if !ok {
+			addedAt = now
+		}
+		keysInfo = append(keysInfo, PublicKeyInfo{
+			Fingerprint: fp,
+			AddedAt:     addedAt,
+		})
+	}
+	user.Filters.PublicKeysInfo = keysInfo
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+var (
+	loginCooldowns = loginCooldownTracker{
+		entries: make(map[string]*loginCooldownEntry),
+	}
+)
+
+// LoginCooldown defines the temporary login block applied to a user
+// after too many consecutive failed login attempts
+type LoginCooldown struct {
+	// Number of consecutive failed login attempts that start the cooldown.
+	// 0 means disabled
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// Cooldown duration as seconds, any login is denied in this period
+	CooldownSeconds int `json:"cooldown_seconds,omitempty"`
+	// The failed attempts counter is reset after this number of seconds
+	// without failed attempts. 0 means the counter is only reset after a
+	// successful login or a cooldown
+	ResetAfterSeconds int `json:"reset_after_seconds,omitempty"`
+	// Send an email notification to the user when the cooldown starts
+	Notify bool `json:"notify,omitempty"`
+}
+
+func (c *LoginCooldown) validate() error {
+	if c.MaxAttempts < 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid login cooldown max attempts: %d", c.MaxAttempts))
+	}
+	if c.MaxAttempts == 0 {
+		*c = LoginCooldown{}
+		return nil
+	}
+	if c.CooldownSeconds <= 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid login cooldown duration: %d", c.CooldownSeconds))
+	}
+	if c.ResetAfterSeconds < 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid login cooldown reset interval: %d", c.ResetAfterSeconds))
+	}
+	return nil
+}
+
+// LoginCooldownError is returned if a user tries to login during a cooldown
+type LoginCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginCooldownError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %d seconds", e.GetRetryAfterSeconds())
+}
+
+// GetRetryAfterSeconds returns the remaining cooldown as seconds, rounded up
+func (e *LoginCooldownError) GetRetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+type loginCooldownEntry struct {
+	failures    int
+	lastAttempt time.Time
+	resetAfter  time.Duration
+	until       time.Time
+}
+
+func (e *loginCooldownEntry) isExpired(now time.Time) bool {
+	if now.Before(e.until) {
+		return false
+	}
+	if !e.until.IsZero() {
+		// the cooldown ended
+		return true
+	}
+	return e.resetAfter > 0 && now.Sub(e.lastAttempt) >= e.resetAfter
+}
+
+// loginCooldownTracker keeps, in memory, the failed login attempts for the
+// users with a login cooldown configured
+type loginCooldownTracker struct {
+	mu      sync.Mutex
+	entries map[string]*loginCooldownEntry
+}
+
+// getRemaining returns the remaining cooldown for the specified user, 0 if
+// the user is not in cooldown
+func (t *loginCooldownTracker) getRemaining(username string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[username]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	if entry.isExpired(now) {
+		delete(t.entries, username)
+		return 0
+	}
+	if entry.until.IsZero() {
+		return 0
+	}
+	return entry.until.Sub(now)
+}
+
+// addFailure records a failed login attempt and returns true if the
+// cooldown started
+func (t *loginCooldownTracker) addFailure(username string, cooldown LoginCooldown) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range t.entries {
+		if v.isExpired(now) {
+			delete(t.entries, k)
+		}
+	}
+	entry, ok := t.entries[username]
+	if !ok {
+		entry = &loginCooldownEntry{}
+		t.entries[username] = entry
+	}
+	if !entry.until.IsZero() {
+		// already in cooldown
+		return false
+	}
+	entry.failures++
+	entry.lastAttempt = now
+	entry.resetAfter = time.Duration(cooldown.ResetAfterSeconds) * time.Second
+	if entry.failures < cooldown.MaxAttempts {
+		return false
+	}
+	entry.until = now.Add(time.Duration(cooldown.CooldownSeconds) * time.Second)
+	return true
+}
+
+func (t *loginCooldownTracker) reset(username string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.entries[username]
+	delete(t.entries, username)
+	return ok
+}
+
+// checkLoginCooldown returns an error if the specified user is in cooldown
+func checkLoginCooldown(username string) error {
+	if remaining := loginCooldowns.getRemaining(username); remaining > 0 {
+		providerLog(logger.LevelDebug, "login denied for user %q, cooldown in progress, remaining: %s",
+			username, remaining)
+		return &LoginCooldownError{RetryAfter: remaining}
+	}
+	return nil
+}
+
+// ResetLoginCooldown resets the failed login attempts and ends the cooldown,
+// if any, for the specified user. It returns false if there was nothing to reset
+func ResetLoginCooldown(username string) bool {
+	return loginCooldowns.reset(username)
+}
+
+func updateLoginCooldown(user *User, loginMethod, ip, protocol string, err error) {
+	if user.Username == "" {
+		return
+	}
+	if err == nil {
+		loginCooldowns.reset(user.Username)
+		return
+	}
+	if user.Filters.LoginCooldown.MaxAttempts == 0 {
+		return
+	}
+	if errors.As(err, new(*LoginCooldownError)) || errors.As(err, new(*util.RecordNotFoundError)) {
+		return
+	}
+	if loginMethod == SSHLoginMethodPublicKey || loginMethod == LoginMethodNoAuthTryed {
+		// some clients try all the available public keys
+		return
+	}
+	if !loginCooldowns.addFailure(user.Username, user.Filters.LoginCooldown) {
+		return
+	}
+	providerLog(logger.LevelWarn, "login cooldown started for user %q after %d failed attempts, last ip %q, protocol %q, duration: %d seconds",
+		user.Username, user.Filters.LoginCooldown.MaxAttempts, ip, protocol, user.Filters.LoginCooldown.CooldownSeconds)
+	smtp.AddSecurityAlert(smtp.SecurityAlert{
+		Event:    smtp.SecurityAlertLoginCooldown,
+		Username: user.Username,
+		IP:       ip,
+		Protocol: protocol,
+	})
+	if user.Filters.LoginCooldown.Notify {
+		sendLoginCooldownNotification(user, ip, protocol)
+	}
+}
+
+func sendLoginCooldownNotification(user *User, ip, protocol string) {
+	if user.Email == "" || !smtp.IsEnabled() {
+		providerLog(logger.LevelDebug, "unable to send login cooldown notification to user %q, no email or SMTP configuration",
+			user.Username)
+		return
+	}
+	username := user.Username
+	email := user.Email
+	cooldown := user.Filters.LoginCooldown
+	startTime := time.Now()
+
+	go func() {
+		err := smtp.SendEmail([]string{email}, "SFTPGo - Your account is temporarily locked",
+			getLoginCooldownBody(username, ip, protocol, cooldown, startTime), smtp.EmailContentTypeTextPlain)
+		if err != nil {
+			providerLog(logger.LevelError, "unable to send login cooldown notification to user %q: %v", username, err)
+			return
+		}
+		providerLog(logger.LevelDebug, "login cooldown notification sent to user %q", username)
+	}()
+}
+
+func getLoginCooldownBody(username, ip, protocol string, cooldown LoginCooldown, startTime time.Time) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Hello %s,\n\n%d consecutive failed login attempts to your account were detected.\n\n",
+		username, cooldown.MaxAttempts))
+	sb.WriteString(fmt.Sprintf("Time: %s\n", startTime.UTC().Format(time.RFC1123)))
+	sb.WriteString(fmt.Sprintf("Last IP address: %s\n", ip))
+	sb.WriteString(fmt.Sprintf("Protocol: %s\n", protocol))
+	sb.WriteString(fmt.Sprintf("\nAny login is denied until %s.\n",
+		startTime.Add(time.Duration(cooldown.CooldownSeconds)*time.Second).UTC().Format(time.RFC1123)))
+	sb.WriteString("\nIf these attempts were not made by you, please change your credentials ")
+	sb.WriteString("as soon as possible and contact your administrator.\n")
+	return sb.String()
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+var (
+	loginNotificationsLimiter = loginNotificationsRateLimiter{
+		lastSent: make(map[string]time.Time),
+	}
+)
+
+// LoginNotification defines the login notifications settings for a user
+type LoginNotification struct {
+	// Send an email notification to the user after a successful login
+	Enabled bool `json:"enabled,omitempty"`
+	// Notify only the logins from IP addresses not recently used by the user
+	NewIPOnly bool `json:"new_ip_only,omitempty"`
+}
+
+// LoginNotificationsConfig defines the configuration for the user login notifications
+type LoginNotificationsConfig struct {
+	// IP addresses not used by a user for the specified number of days are
+	// considered new and are removed from the known IP addresses.
+	// 0 means IP addresses are never forgotten
+	KnownIPsRetention int `json:"known_ips_retention" mapstructure:"known_ips_retention"`
+	// Minimum interval, in minutes, between two notifications for the same user.
+	// 0 means no limit
+	MinInterval int `json:"min_interval" mapstructure:"min_interval"`
+	// URL for the WebClient, it is included in the notifications so users
+	// can review their account activity
+	WebClientURL string `json:"web_client_url" mapstructure:"web_client_url"`
+}
+
+func (c *LoginNotificationsConfig) validate() error {
+	if c.KnownIPsRetention < 0 {
+		return fmt.Errorf("invalid known IPs retention: %d", c.KnownIPsRetention)
+	}
+	if c.MinInterval < 0 {
+		return fmt.Errorf("invalid login notifications min interval: %d", c.MinInterval)
+	}
+	if c.WebClientURL != "" && !strings.HasPrefix(c.WebClientURL, "http") {
+		return fmt.Errorf("invalid login notifications WebClient URL: %q", c.WebClientURL)
+	}
+	return nil
+}
+
+// getKnownIPsCutoff returns the time, as unix timestamp in milliseconds, before
+// which a known IP address is considered new
+func (c *LoginNotificationsConfig) getKnownIPsCutoff() int64 {
+	if c.KnownIPsRetention == 0 {
+		return 0
+	}
+	return util.GetTimeAsMsSinceEpoch(time.Now().Add(-time.Duration(c.KnownIPsRetention) * 24 * time.Hour))
+}
+
+type loginNotificationsRateLimiter struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// isAllowed returns true if a notification can be sent to the specified user
+// and records the send time
+func (l *loginNotificationsRateLimiter) isAllowed(username string, minInterval time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if minInterval > 0 {
+		if lastSent, ok := l.lastSent[username]; ok && now.Sub(lastSent) < minInterval {
+			return false
+		}
+		for k, v := range l.lastSent {
+			if now.Sub(v) >= minInterval {
+				delete(l.lastSent, k)
+			}
+		}
+	}
+	l.lastSent[username] = now
+	return true
+}
+
+// KnownIP defines an IP address used by a user to login
+type KnownIP struct {
+	IP string `json:"ip"`
+	// first and last login as unix timestamp in milliseconds
+	FirstSeen int64 `json:"first_seen"`
+	LastSeen  int64 `json:"last_seen"`
+}
+
+func cleanupKnownIPs() {
+	cutoff := config.LoginNotifications.getKnownIPsCutoff()
+	if cutoff == 0 {
+		return
+	}
+	if err := provider.cleanupKnownIPs(cutoff); err != nil {
+		providerLog(logger.LevelError, "unable to cleanup known IP addresses: %v", err)
+	} else {
+		providerLog(logger.LevelDebug, "cleanup known IP addresses ok")
+	}
+}
+
+func checkLoginNotification(user *User, loginMethod, ip, protocol string) {
+	if !user.Filters.LoginNotification.Enabled || ip == "" {
+		return
+	}
+	username := user.Username
+	email := user.Email
+	newIPOnly := user.Filters.LoginNotification.NewIPOnly
+	loginTime := time.Now()
+
+	go func() {
+		isNew, err := provider.updateKnownIP(username, ip, config.LoginNotifications.getKnownIPsCutoff())
+		if err != nil {
+			providerLog(logger.LevelError, "unable to update the known IP %q for user %q: %v", ip, username, err)
+			return
+		}
+		if newIPOnly && !isNew {
+			return
+		}
+		if email == "" || !smtp.IsEnabled() {
+			providerLog(logger.LevelDebug, "unable to send login notification to user %q, no email or SMTP configuration",
+				username)
+			return
+		}
+		minInterval := time.Duration(config.LoginNotifications.MinInterval) * time.Minute
+		if !loginNotificationsLimiter.isAllowed(username, minInterval) {
+			providerLog(logger.LevelDebug, "login notification for user %q not sent, rate limit exceeded", username)
+			return
+		}
+		subject := "SFTPGo - New login to your account"
+		if isNew {
+			subject = "SFTPGo - New login to your account from a new IP address"
+		}
+		err = smtp.SendEmail([]string{email}, subject, getLoginNotificationBody(username, loginMethod, ip, protocol,
+			loginTime, isNew), smtp.EmailContentTypeTextPlain)
+		if err != nil {
+			providerLog(logger.LevelError, "unable to send login notification to user %q: %v", username, err)
+			return
+		}
+		providerLog(logger.LevelDebug, "login notification sent to user %q, ip %q, new ip? %t", username, ip, isNew)
+	}()
+}
+
+func getLoginNotificationBody(username, loginMethod, ip, protocol string, loginTime time.Time, isNewIP bool) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Hello %s,\n\na new login to your account was detected.\n\n", username))
+	sb.WriteString(fmt.Sprintf("Time: %s\n", loginTime.UTC().Format(time.RFC1123)))
+	sb.WriteString(fmt.Sprintf("IP address: %s", ip))
+	if isNewIP {
+		sb.WriteString(" (not recently used)")
+	}
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf("Protocol: %s\n", protocol))
+	sb.WriteString(fmt.Sprintf("Login method: %s\n", loginMethod))
+	sb.WriteString("\nIf this was you, you can ignore this email. Otherwise please change your credentials ")
+	sb.WriteString("as soon as possible and contact your administrator.\n")
+	if config.LoginNotifications.WebClientURL != "" {
+		sb.WriteString(fmt.Sprintf("\nYou can review your account here: %s\n", config.LoginNotifications.WebClientURL))
+	}
+	return sb.String()
+}
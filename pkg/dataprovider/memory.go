@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -70,6 +71,16 @@ type memoryProviderHandle struct {
 	rules map[string]EventRule
 	// slice with ordered rules
 	rulesNames []string
+	// map for known IP addresses, username is the key
+	knownIPs map[string]map[string]KnownIP
+	// map for the content index, the storage ID is the key
+	contentIndex map[string]map[string]vfs.ContentIndexEntry
+	// map for the resumable upload sessions, the upload ID is the key
+	uploadSessions map[string]vfs.UploadSession
+	// map for the upload sessions leases, the upload ID is the key
+	uploadSessionLeases uploadSessionLeases
+	// map for the replication statuses, username and virtual path are the key
+	replications map[string]vfs.ReplicationStatus
 }
 
 // MemoryProvider defines the auth provider for a memory store
@@ -87,24 +98,29 @@ func initializeMemoryProvider(basePath string) {
 	}
 	provider = &MemoryProvider{
 		dbHandle: &memoryProviderHandle{
-			isClosed:        false,
-			usernames:       []string{},
-			users:           make(map[string]User),
-			groupnames:      []string{},
-			groups:          make(map[string]Group),
-			vfolders:        make(map[string]vfs.BaseVirtualFolder),
-			vfoldersNames:   []string{},
-			admins:          make(map[string]Admin),
-			adminsUsernames: []string{},
-			apiKeys:         make(map[string]APIKey),
-			apiKeysIDs:      []string{},
-			shares:          make(map[string]Share),
-			sharesIDs:       []string{},
-			actions:         make(map[string]BaseEventAction),
-			actionsNames:    []string{},
-			rules:           make(map[string]EventRule),
-			rulesNames:      []string{},
-			configFile:      configFile,
+			isClosed:            false,
+			usernames:           []string{},
+			users:               make(map[string]User),
+			groupnames:          []string{},
+			groups:              make(map[string]Group),
+			vfolders:            make(map[string]vfs.BaseVirtualFolder),
+			vfoldersNames:       []string{},
+			admins:              make(map[string]Admin),
+			adminsUsernames:     []string{},
+			apiKeys:             make(map[string]APIKey),
+			apiKeysIDs:          []string{},
+			shares:              make(map[string]Share),
+			sharesIDs:           []string{},
+			actions:             make(map[string]BaseEventAction),
+			actionsNames:        []string{},
+			rules:               make(map[string]EventRule),
+			rulesNames:          []string{},
+			knownIPs:            make(map[string]map[string]KnownIP),
+			contentIndex:        make(map[string]map[string]vfs.ContentIndexEntry),
+			uploadSessions:      make(map[string]vfs.UploadSession),
+			uploadSessionLeases: make(uploadSessionLeases),
+			replications:        make(map[string]vfs.ReplicationStatus),
+			configFile:          configFile,
 		},
 	}
 	if err := provider.reloadConfig(); err != nil {
@@ -192,6 +208,22 @@ func (p *MemoryProvider) updateAPIKeyLastUse(keyID string) error {
 	return nil
 }
 
+func (p *MemoryProvider) updateAPIKeySecret(keyID, key string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	apiKey, err := p.apiKeyExistsInternal(keyID)
+	if err != nil {
+		return err
+	}
+	apiKey.Key = key
+	apiKey.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	p.dbHandle.apiKeys[apiKey.KeyID] = apiKey
+	return nil
+}
+
 func (p *MemoryProvider) setUpdatedAt(username string) {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
@@ -237,6 +269,22 @@ func (p *MemoryProvider) updateAdminLastLogin(username string) error {
 	return nil
 }
 
+func (p *MemoryProvider) setAdminLocked(username string, locked bool) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	admin, err := p.adminExistsInternal(username)
+	if err != nil {
+		return err
+	}
+	admin.Locked = locked
+	admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	p.dbHandle.admins[admin.Username] = admin
+	return nil
+}
+
 func (p *MemoryProvider) updateTransferQuota(username string, uploadSize, downloadSize int64, reset bool) error {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
@@ -262,6 +310,26 @@ func (p *MemoryProvider) updateTransferQuota(username string, uploadSize, downlo
 	return nil
 }
 
+func (p *MemoryProvider) reserveQuotaFile(username string, maxUsedFiles int) (bool, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return false, errMemoryProviderClosed
+	}
+	user, err := p.userExistsInternal(username)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to reserve quota file for user %q error: %v", username, err)
+		return false, err
+	}
+	if user.UsedQuotaFiles >= maxUsedFiles {
+		return false, nil
+	}
+	user.UsedQuotaFiles++
+	user.LastQuotaUpdate = util.GetTimeAsMsSinceEpoch(time.Now())
+	p.dbHandle.users[user.Username] = user
+	return true, nil
+}
+
 func (p *MemoryProvider) updateQuota(username string, filesAdd int, sizeAdd int64, reset bool) error {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
@@ -328,6 +396,7 @@ func (p *MemoryProvider) addUser(user *User) error {
 	user.LastLogin = 0
 	user.FirstUpload = 0
 	user.FirstDownload = 0
+	user.LastQuotaWarning = 0
 	user.CreatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	user.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	var mappedGroups []string
@@ -393,6 +462,7 @@ func (p *MemoryProvider) updateUser(user *User) error {
 	user.LastLogin = u.LastLogin
 	user.FirstDownload = u.FirstDownload
 	user.FirstUpload = u.FirstUpload
+	user.LastQuotaWarning = u.LastQuotaWarning
 	user.CreatedAt = u.CreatedAt
 	user.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	user.ID = u.ID
@@ -427,6 +497,7 @@ func (p *MemoryProvider) deleteUser(user User, softDelete bool) error {
 	sort.Strings(p.dbHandle.usernames)
 	p.deleteAPIKeysWithUser(user.Username)
 	p.deleteSharesWithUser(user.Username)
+	delete(p.dbHandle.knownIPs, user.Username)
 	return nil
 }
 
@@ -502,6 +573,7 @@ func (p *MemoryProvider) getRecentlyUpdatedUsers(after int64) ([]User, error) {
 				}
 				groupMapping[group.Name] = group
 			}
+			expandGroupsHierarchy(groupMapping, p.groupExistsInternal)
 			user.applyGroupSettings(groupMapping)
 		}
 
@@ -535,6 +607,7 @@ func (p *MemoryProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User,
 					}
 					groupMapping[group.Name] = group
 				}
+				expandGroupsHierarchy(groupMapping, p.groupExistsInternal)
 				user.applyGroupSettings(groupMapping)
 			}
 			user.SetEmptySecretsIfNil()
@@ -546,7 +619,7 @@ func (p *MemoryProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User,
 	return users, nil
 }
 
-func (p *MemoryProvider) getUsers(limit int, offset int, order string) ([]User, error) {
+func (p *MemoryProvider) getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error) {
 	users := make([]User, 0, limit)
 	var err error
 	p.dbHandle.Lock()
@@ -560,6 +633,9 @@ func (p *MemoryProvider) getUsers(limit int, offset int, order string) ([]User,
 	itNum := 0
 	if order == OrderASC {
 		for _, username := range p.dbHandle.usernames {
+			if !matchUsernamePatterns(usernamePatterns, username) {
+				continue
+			}
 			itNum++
 			if itNum <= offset {
 				continue
@@ -575,11 +651,14 @@ func (p *MemoryProvider) getUsers(limit int, offset int, order string) ([]User,
 		}
 	} else {
 		for i := len(p.dbHandle.usernames) - 1; i >= 0; i-- {
+			username := p.dbHandle.usernames[i]
+			if !matchUsernamePatterns(usernamePatterns, username) {
+				continue
+			}
 			itNum++
 			if itNum <= offset {
 				continue
 			}
-			username := p.dbHandle.usernames[i]
 			u := p.dbHandle.users[username]
 			user := u.getACopy()
 			p.addVirtualFoldersToUser(&user)
@@ -653,6 +732,7 @@ func (p *MemoryProvider) addAdmin(admin *Admin) error {
 	admin.CreatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	admin.LastLogin = 0
+	admin.Locked = false
 	var mappedAdmins []string
 	for idx := range admin.Groups {
 		if err = p.addAdminToGroupMapping(admin.Username, admin.Groups[idx].Name); err != nil {
@@ -702,6 +782,7 @@ func (p *MemoryProvider) updateAdmin(admin *Admin) error {
 	admin.ID = a.ID
 	admin.CreatedAt = a.CreatedAt
 	admin.LastLogin = a.LastLogin
+	admin.Locked = a.Locked
 	admin.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	p.dbHandle.admins[admin.Username] = admin.getACopy()
 	return nil
@@ -913,6 +994,22 @@ func (p *MemoryProvider) getUsersInGroups(names []string) ([]string, error) {
 	return users, nil
 }
 
+func (p *MemoryProvider) getChildGroups(names []string) ([]string, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	var children []string
+	for _, name := range p.dbHandle.groupnames {
+		if group := p.dbHandle.groups[name]; group.ParentGroup != "" && util.Contains(names, group.ParentGroup) {
+			children = append(children, name)
+		}
+	}
+
+	return children, nil
+}
+
 func (p *MemoryProvider) groupExists(name string) (Group, error) {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
@@ -1254,6 +1351,8 @@ func (p *MemoryProvider) addOrUpdateFolderInternal(baseFolder *vfs.BaseVirtualFo
 		folder.MappedPath = baseFolder.MappedPath
 		folder.Description = baseFolder.Description
 		folder.FsConfig = baseFolder.FsConfig.GetACopy()
+		folder.AuditLog = baseFolder.AuditLog
+		folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		if username != "" && !util.Contains(folder.Users, username) {
 			folder.Users = append(folder.Users, username)
 		}
@@ -1269,6 +1368,7 @@ func (p *MemoryProvider) addOrUpdateFolderInternal(baseFolder *vfs.BaseVirtualFo
 		folder.UsedQuotaSize = usedQuotaSize
 		folder.UsedQuotaFiles = usedQuotaFiles
 		folder.LastQuotaUpdate = lastQuotaUpdate
+		folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 		if username != "" {
 			folder.Users = []string{username}
 		}
@@ -1363,6 +1463,7 @@ func (p *MemoryProvider) addFolder(folder *vfs.BaseVirtualFolder) error {
 		return fmt.Errorf("folder %#v already exists", folder.Name)
 	}
 	folder.ID = p.getNextFolderID()
+	folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	folder.Users = nil
 	folder.Groups = nil
 	p.dbHandle.vfolders[folder.Name] = folder.GetACopy()
@@ -1392,6 +1493,7 @@ func (p *MemoryProvider) updateFolder(folder *vfs.BaseVirtualFolder) error {
 	folder.UsedQuotaSize = f.UsedQuotaSize
 	folder.Users = f.Users
 	folder.Groups = f.Groups
+	folder.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	p.dbHandle.vfolders[folder.Name] = folder.GetACopy()
 	// now update the related users
 	for _, username := range folder.Users {
@@ -1940,6 +2042,10 @@ func (p *MemoryProvider) cleanupSharedSessions(sessionType SessionType, before i
 	return ErrNotImplemented
 }
 
+func (p *MemoryProvider) getSharedSessions(sessionType SessionType, after int64) ([]Session, error) {
+	return nil, ErrNotImplemented
+}
+
 func (p *MemoryProvider) getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error) {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
@@ -2023,6 +2129,7 @@ func (p *MemoryProvider) addEventAction(action *BaseEventAction) error {
 		return fmt.Errorf("event action %q already exists", action.Name)
 	}
 	action.ID = p.getNextActionID()
+	action.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	action.Rules = nil
 	p.dbHandle.actions[action.Name] = action.getACopy()
 	p.dbHandle.actionsNames = append(p.dbHandle.actionsNames, action.Name)
@@ -2046,6 +2153,7 @@ func (p *MemoryProvider) updateEventAction(action *BaseEventAction) error {
 	}
 	action.ID = oldAction.ID
 	action.Name = oldAction.Name
+	action.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
 	action.Rules = nil
 	if len(oldAction.Rules) > 0 {
 		var relatedRules []string
@@ -2314,10 +2422,397 @@ func (*MemoryProvider) getNodes() ([]Node, error) {
 	return nil, ErrNotImplemented
 }
 
+func (*MemoryProvider) getOnlineMigrations() ([]OnlineMigration, error) {
+	return nil, ErrNotImplemented
+}
+
+func (*MemoryProvider) pauseOnlineMigration(_ int) error {
+	return ErrNotImplemented
+}
+
 func (*MemoryProvider) updateNodeTimestamp() error {
 	return ErrNotImplemented
 }
 
+func (p *MemoryProvider) updateKnownIP(username, ip string, cutoff int64) (bool, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return false, errMemoryProviderClosed
+	}
+	userIPs, ok := p.dbHandle.knownIPs[username]
+	if !ok {
+		userIPs = make(map[string]KnownIP)
+		p.dbHandle.knownIPs[username] = userIPs
+	}
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	knownIP, ok := userIPs[ip]
+	if !ok {
+		knownIP = KnownIP{
+			IP:        ip,
+			FirstSeen: now,
+		}
+	}
+	isNew := !ok || knownIP.LastSeen < cutoff
+	knownIP.LastSeen = now
+	userIPs[ip] = knownIP
+	return isNew, nil
+}
+
+func (p *MemoryProvider) getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return vfs.ContentIndexEntry{}, errMemoryProviderClosed
+	}
+	entry, ok := p.dbHandle.contentIndex[storageID][name]
+	if !ok {
+		return entry, util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", name))
+	}
+	return entry, nil
+}
+
+func (p *MemoryProvider) getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	var entries []vfs.ContentIndexEntry
+	for _, entry := range p.dbHandle.contentIndex[storageID] {
+		if isContentEntryInDir(&entry, dirName, recursive) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func (p *MemoryProvider) addContentEntry(entry *vfs.ContentIndexEntry) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	entries, ok := p.dbHandle.contentIndex[entry.StorageID]
+	if !ok {
+		entries = make(map[string]vfs.ContentIndexEntry)
+		p.dbHandle.contentIndex[entry.StorageID] = entries
+	}
+	entries[entry.Path] = *entry
+	return nil
+}
+
+func (p *MemoryProvider) renameContentEntries(storageID, source, target string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	entries := p.dbHandle.contentIndex[storageID]
+	sourceEntry, ok := entries[source]
+	if !ok {
+		return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", source))
+	}
+	renamed := []vfs.ContentIndexEntry{sourceEntry}
+	for _, entry := range entries {
+		if isContentEntryInDir(&entry, source, true) {
+			renamed = append(renamed, entry)
+		}
+	}
+	delete(entries, target)
+	for _, entry := range renamed {
+		delete(entries, entry.Path)
+		entry.Path = target + strings.TrimPrefix(entry.Path, source)
+		entries[entry.Path] = entry
+	}
+	return nil
+}
+
+func (p *MemoryProvider) deleteContentEntry(storageID, name string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	if _, ok := p.dbHandle.contentIndex[storageID][name]; !ok {
+		return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", name))
+	}
+	delete(p.dbHandle.contentIndex[storageID], name)
+	return nil
+}
+
+func (p *MemoryProvider) getContentHashes(storageID string) ([]string, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	hashes := make(map[string]bool)
+	for _, entry := range p.dbHandle.contentIndex[storageID] {
+		if !entry.IsDir {
+			hashes[entry.Hash] = true
+		}
+	}
+	result := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		result = append(result, hash)
+	}
+	return result, nil
+}
+
+func (p *MemoryProvider) isContentReferenced(storageID, hash string) (bool, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return false, errMemoryProviderClosed
+	}
+	for _, entry := range p.dbHandle.contentIndex[storageID] {
+		if !entry.IsDir && entry.Hash == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *MemoryProvider) deleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return 0, errMemoryProviderClosed
+	}
+	var deleted int64
+	entries := p.dbHandle.contentIndex[storageID]
+	for name, entry := range entries {
+		if !entry.IsDir && entry.Hash == hash {
+			delete(entries, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (p *MemoryProvider) addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	if _, ok := p.dbHandle.uploadSessions[session.ID]; ok {
+		return fmt.Errorf("upload session %v already exists", session.ID)
+	}
+	for _, s := range p.dbHandle.uploadSessions {
+		if s.Username == session.Username && s.Path == session.Path {
+			return fmt.Errorf("an upload session for path %q already exists", session.Path)
+		}
+	}
+	p.dbHandle.uploadSessions[session.ID] = getUploadSessionCopy(session)
+	p.dbHandle.uploadSessionLeases.claim(session.ID, owner, leaseExpiresAt, 0)
+	return nil
+}
+
+func (p *MemoryProvider) updateUploadSession(session *vfs.UploadSession, owner string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	oldSession, ok := p.dbHandle.uploadSessions[session.ID]
+	if !ok || !p.dbHandle.uploadSessionLeases.isOwner(session.ID, owner) {
+		return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", session.ID))
+	}
+	updated := getUploadSessionCopy(session)
+	updated.Username = oldSession.Username
+	updated.Path = oldSession.Path
+	updated.StartedAt = oldSession.StartedAt
+	updated.BackendToken = oldSession.BackendToken
+	p.dbHandle.uploadSessions[session.ID] = updated
+	return nil
+}
+
+func (p *MemoryProvider) getUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return vfs.UploadSession{}, errMemoryProviderClosed
+	}
+	for _, session := range p.dbHandle.uploadSessions {
+		if session.Username == username && session.Path == virtualPath {
+			return getUploadSessionCopy(&session), nil
+		}
+	}
+	return vfs.UploadSession{}, util.NewRecordNotFoundError(fmt.Sprintf("no upload session for path %q", virtualPath))
+}
+
+func (p *MemoryProvider) getUploadSessionByID(id string) (vfs.UploadSession, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return vfs.UploadSession{}, errMemoryProviderClosed
+	}
+	session, ok := p.dbHandle.uploadSessions[id]
+	if !ok {
+		return session, util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+	}
+	return getUploadSessionCopy(&session), nil
+}
+
+func (p *MemoryProvider) getUploadSessions(username string) ([]vfs.UploadSession, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	sessions := make([]vfs.UploadSession, 0, 10)
+	for _, session := range p.dbHandle.uploadSessions {
+		if session.Username == username {
+			sessions = append(sessions, getUploadSessionCopy(&session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt < sessions[j].StartedAt
+	})
+	return sessions, nil
+}
+
+func (p *MemoryProvider) getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	var sessions []vfs.UploadSession
+	for _, session := range p.dbHandle.uploadSessions {
+		if session.LastSeenAt < lastSeenBefore {
+			sessions = append(sessions, getUploadSessionCopy(&session))
+		}
+	}
+	return sessions, nil
+}
+
+func (p *MemoryProvider) deleteUploadSession(id string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	if _, ok := p.dbHandle.uploadSessions[id]; !ok {
+		return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+	}
+	delete(p.dbHandle.uploadSessions, id)
+	delete(p.dbHandle.uploadSessionLeases, id)
+	return nil
+}
+
+func (p *MemoryProvider) claimUploadSession(id, owner string, leaseExpiresAt, now int64) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	if _, ok := p.dbHandle.uploadSessions[id]; !ok {
+		return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+	}
+	if !p.dbHandle.uploadSessionLeases.claim(id, owner, leaseExpiresAt, now) {
+		return vfs.ErrUploadSessionInUse
+	}
+	return nil
+}
+
+func (p *MemoryProvider) releaseUploadSession(id, owner string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	p.dbHandle.uploadSessionLeases.release(id, owner)
+	return nil
+}
+
+func (p *MemoryProvider) setReplicationStatus(status *vfs.ReplicationStatus) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	p.dbHandle.replications[getReplicationStatusKey(status.Username, status.Path)] = *status
+	return nil
+}
+
+func (p *MemoryProvider) getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return vfs.ReplicationStatus{}, errMemoryProviderClosed
+	}
+	status, ok := p.dbHandle.replications[getReplicationStatusKey(username, virtualPath)]
+	if !ok {
+		return status, util.NewRecordNotFoundError(fmt.Sprintf("no replication status for path %q", virtualPath))
+	}
+	return status, nil
+}
+
+func (p *MemoryProvider) getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return nil, errMemoryProviderClosed
+	}
+	var statuses []vfs.ReplicationStatus
+	for _, status := range p.dbHandle.replications {
+		if status.NextRetryAt > 0 && status.NextRetryAt <= nextRetryBefore {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NextRetryAt < statuses[j].NextRetryAt
+	})
+	return statuses, nil
+}
+
+func (p *MemoryProvider) deleteReplicationStatus(username, virtualPath string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	key := getReplicationStatusKey(username, virtualPath)
+	if _, ok := p.dbHandle.replications[key]; !ok {
+		return util.NewRecordNotFoundError(fmt.Sprintf("no replication status for path %q", virtualPath))
+	}
+	delete(p.dbHandle.replications, key)
+	return nil
+}
+
+// getUploadSessionCopy returns a copy of the session that does not share the parts
+func getUploadSessionCopy(session *vfs.UploadSession) vfs.UploadSession {
+	s := *session
+	s.Parts = make([]vfs.UploadSessionPart, len(session.Parts))
+	copy(s.Parts, session.Parts)
+	return s
+}
+
+func (p *MemoryProvider) cleanupKnownIPs(before int64) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	for username, userIPs := range p.dbHandle.knownIPs {
+		for ip, knownIP := range userIPs {
+			if knownIP.LastSeen < before {
+				delete(userIPs, ip)
+			}
+		}
+		if len(userIPs) == 0 {
+			delete(p.dbHandle.knownIPs, username)
+		}
+	}
+	return nil
+}
+
 func (*MemoryProvider) cleanupNodes() error {
 	return ErrNotImplemented
 }
@@ -2360,6 +2855,25 @@ func (p *MemoryProvider) setFirstUploadTimestamp(username string) error {
 	return nil
 }
 
+func (p *MemoryProvider) updateQuotaWarning(username string, threshold int) (bool, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return false, errMemoryProviderClosed
+	}
+	user, err := p.userExistsInternal(username)
+	if err != nil {
+		return false, err
+	}
+	if user.LastQuotaWarning == threshold {
+		return false, nil
+	}
+	increased := threshold > user.LastQuotaWarning
+	user.LastQuotaWarning = threshold
+	p.dbHandle.users[user.Username] = user
+	return increased, nil
+}
+
 func (p *MemoryProvider) getNextID() int64 {
 	nextID := int64(1)
 	for _, v := range p.dbHandle.users {
@@ -2440,6 +2954,7 @@ func (p *MemoryProvider) clear() {
 	p.dbHandle.actionsNames = []string{}
 	p.dbHandle.rules = map[string]EventRule{}
 	p.dbHandle.rulesNames = []string{}
+	p.dbHandle.knownIPs = make(map[string]map[string]KnownIP)
 }
 
 func (p *MemoryProvider) reloadConfig() error {
@@ -2627,7 +3142,7 @@ func (p *MemoryProvider) restoreAdmins(dump BackupData) error {
 }
 
 func (p *MemoryProvider) restoreGroups(dump BackupData) error {
-	for _, group := range dump.Groups {
+	for _, group := range SortGroupsByHierarchy(dump.Groups) {
 		group := group // pin
 		group.Name = config.convertName(group.Name)
 		g, err := p.groupExists(group.Name)
@@ -57,7 +57,12 @@ const (
 		"DROP TABLE IF EXISTS `{{events_rules}}` CASCADE;" +
 		"DROP TABLE IF EXISTS `{{tasks}}` CASCADE;" +
 		"DROP TABLE IF EXISTS `{{nodes}}` CASCADE;" +
-		"DROP TABLE IF EXISTS `{{schema_version}}` CASCADE;"
+		"DROP TABLE IF EXISTS `{{known_ips}}` CASCADE;" +
+		"DROP TABLE IF EXISTS `{{content_index}}` CASCADE;" +
+		"DROP TABLE IF EXISTS `{{upload_sessions}}` CASCADE;" +
+		"DROP TABLE IF EXISTS `{{replications}}` CASCADE;" +
+		"DROP TABLE IF EXISTS `{{schema_version}}` CASCADE;" +
+		"DROP TABLE IF EXISTS `{{schema_migrations}}` CASCADE;"
 	mysqlInitialSQL = "CREATE TABLE `{{schema_version}}` (`id` integer AUTO_INCREMENT NOT NULL PRIMARY KEY, `version` integer NOT NULL);" +
 		"CREATE TABLE `{{admins}}` (`id` integer AUTO_INCREMENT NOT NULL PRIMARY KEY, `username` varchar(255) NOT NULL UNIQUE, " +
 		"`description` varchar(512) NULL, `password` varchar(255) NOT NULL, `email` varchar(255) NULL, `status` integer NOT NULL, " +
@@ -187,6 +192,65 @@ const (
 		"`name` varchar(255) NOT NULL UNIQUE, `data` longtext NOT NULL, `created_at` bigint NOT NULL, " +
 		"`updated_at` bigint NOT NULL);"
 	mysqlV23DownSQL = "DROP TABLE `{{nodes}}` CASCADE;"
+	mysqlV24SQL     = "ALTER TABLE `{{api_keys}}` ADD COLUMN `filters` longtext NULL;"
+	mysqlV24DownSQL = "ALTER TABLE `{{api_keys}}` DROP COLUMN `filters`;"
+	mysqlV25SQL     = "ALTER TABLE `{{shares}}` ADD COLUMN `display_name` varchar(255) NULL; ALTER TABLE `{{shares}}` ADD COLUMN `disposition` varchar(20) NULL;"
+	mysqlV25DownSQL = "ALTER TABLE `{{shares}}` DROP COLUMN `disposition`; ALTER TABLE `{{shares}}` DROP COLUMN `display_name`;"
+	mysqlV26SQL     = "CREATE TABLE `{{known_ips}}` (`id` bigint AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`user_id` integer NOT NULL, `ip` varchar(50) NOT NULL, `first_seen` bigint NOT NULL, " +
+		"`last_seen` bigint NOT NULL, CONSTRAINT `{{prefix}}unique_known_ip` UNIQUE (`user_id`, `ip`)); " +
+		"ALTER TABLE `{{known_ips}}` ADD CONSTRAINT `{{prefix}}known_ips_user_id_fk_users_id` " +
+		"FOREIGN KEY (`user_id`) REFERENCES `{{users}}` (`id`) ON DELETE CASCADE; " +
+		"CREATE INDEX `{{prefix}}known_ips_last_seen_idx` ON `{{known_ips}}` (`last_seen`);"
+	mysqlV26DownSQL = "DROP TABLE `{{known_ips}}` CASCADE;"
+	mysqlV27SQL     = "ALTER TABLE `{{folders}}` ADD COLUMN `updated_at` bigint DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{folders}}` ALTER COLUMN `updated_at` DROP DEFAULT; " +
+		"ALTER TABLE `{{events_actions}}` ADD COLUMN `updated_at` bigint DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{events_actions}}` ALTER COLUMN `updated_at` DROP DEFAULT; " +
+		"CREATE INDEX `{{prefix}}folders_updated_at_idx` ON `{{folders}}` (`updated_at`); " +
+		"CREATE INDEX `{{prefix}}events_actions_updated_at_idx` ON `{{events_actions}}` (`updated_at`);"
+	mysqlV27DownSQL = "ALTER TABLE `{{events_actions}}` DROP COLUMN `updated_at`; " +
+		"ALTER TABLE `{{folders}}` DROP COLUMN `updated_at`;"
+	mysqlV28SQL     = "ALTER TABLE `{{groups}}` ADD COLUMN `parent_group` varchar(255) NULL;"
+	mysqlV28DownSQL = "ALTER TABLE `{{groups}}` DROP COLUMN `parent_group`;"
+	mysqlV29SQL     = "CREATE TABLE `{{content_index}}` (`id` bigint AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`storage_id` varchar(255) NOT NULL, `path` varchar(512) NOT NULL, `parent` varchar(512) NOT NULL, " +
+		"`hash` varchar(64) NOT NULL, `size` bigint NOT NULL, `is_dir` integer NOT NULL, `mtime` bigint NOT NULL, " +
+		"CONSTRAINT `{{prefix}}unique_content_path` UNIQUE (`storage_id`, `path`)); " +
+		"CREATE INDEX `{{prefix}}content_index_parent_idx` ON `{{content_index}}` (`storage_id`, `parent`); " +
+		"CREATE INDEX `{{prefix}}content_index_hash_idx` ON `{{content_index}}` (`storage_id`, `hash`);"
+	mysqlV29DownSQL = "DROP TABLE `{{content_index}}` CASCADE;"
+	mysqlV30SQL     = "CREATE TABLE `{{upload_sessions}}` (`id` bigint AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`upload_id` varchar(255) NOT NULL UNIQUE, `username` varchar(255) NOT NULL, `path` varchar(512) NOT NULL, " +
+		"`started_at` bigint NOT NULL, `last_seen_at` bigint NOT NULL, `uploaded_bytes` bigint NOT NULL, " +
+		"`total_bytes` bigint NOT NULL, `backend_token` longtext NOT NULL, `parts` longtext NULL, " +
+		"CONSTRAINT `{{prefix}}unique_upload_session_path` UNIQUE (`username`, `path`)); " +
+		"CREATE INDEX `{{prefix}}upload_sessions_last_seen_at_idx` ON `{{upload_sessions}}` (`last_seen_at`);"
+	mysqlV30DownSQL = "DROP TABLE `{{upload_sessions}}` CASCADE;"
+	mysqlV31SQL     = "ALTER TABLE `{{folders}}` ADD COLUMN `audit_log` longtext NULL;"
+	mysqlV31DownSQL = "ALTER TABLE `{{folders}}` DROP COLUMN `audit_log`;"
+	mysqlV32SQL     = "ALTER TABLE `{{users_folders_mapping}}` ADD COLUMN `read_only` integer DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{users_folders_mapping}}` ALTER COLUMN `read_only` DROP DEFAULT; " +
+		"ALTER TABLE `{{groups_folders_mapping}}` ADD COLUMN `read_only` integer DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{groups_folders_mapping}}` ALTER COLUMN `read_only` DROP DEFAULT;"
+	mysqlV32DownSQL = "ALTER TABLE `{{groups_folders_mapping}}` DROP COLUMN `read_only`; " +
+		"ALTER TABLE `{{users_folders_mapping}}` DROP COLUMN `read_only`;"
+	mysqlV33SQL = "ALTER TABLE `{{admins}}` ADD COLUMN `locked` integer DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{admins}}` ALTER COLUMN `locked` DROP DEFAULT;"
+	mysqlV33DownSQL = "ALTER TABLE `{{admins}}` DROP COLUMN `locked`;"
+	mysqlV34SQL     = "ALTER TABLE `{{users}}` ADD COLUMN `last_quota_warning` integer DEFAULT 0 NOT NULL; " +
+		"ALTER TABLE `{{users}}` ALTER COLUMN `last_quota_warning` DROP DEFAULT;"
+	mysqlV34DownSQL = "ALTER TABLE `{{users}}` DROP COLUMN `last_quota_warning`;"
+	mysqlV35SQL     = "CREATE TABLE `{{replications}}` (`id` bigint AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`username` varchar(255) NOT NULL, `path` varchar(512) NOT NULL, `destination_bucket` varchar(255) NOT NULL, " +
+		"`status` varchar(20) NOT NULL, `attempts` integer NOT NULL, `last_error` longtext NULL, " +
+		"`created_at` bigint NOT NULL, `updated_at` bigint NOT NULL, `next_retry_at` bigint NOT NULL, " +
+		"CONSTRAINT `{{prefix}}unique_replication_path` UNIQUE (`username`, `path`)); " +
+		"CREATE INDEX `{{prefix}}replications_next_retry_at_idx` ON `{{replications}}` (`next_retry_at`);"
+	mysqlV35DownSQL = "DROP TABLE `{{replications}}` CASCADE;"
+	mysqlV36SQL     = "ALTER TABLE `{{upload_sessions}}` ADD COLUMN `lease_owner` varchar(255) DEFAULT '' NOT NULL, " +
+		"ADD COLUMN `lease_expires_at` bigint DEFAULT 0 NOT NULL;"
+	mysqlV36DownSQL = "ALTER TABLE `{{upload_sessions}}` DROP COLUMN `lease_expires_at`, DROP COLUMN `lease_owner`;"
 )
 
 // MySQLProvider defines the auth provider for MySQL/MariaDB database
@@ -312,6 +376,10 @@ func (p *MySQLProvider) updateQuota(username string, filesAdd int, sizeAdd int64
 	return sqlCommonUpdateQuota(username, filesAdd, sizeAdd, reset, p.dbHandle)
 }
 
+func (p *MySQLProvider) reserveQuotaFile(username string, maxUsedFiles int) (bool, error) {
+	return sqlCommonReserveQuotaFile(username, maxUsedFiles, p.dbHandle)
+}
+
 func (p *MySQLProvider) getUsedQuota(username string) (int, int64, int64, int64, error) {
 	return sqlCommonGetUsedQuota(username, p.dbHandle)
 }
@@ -328,6 +396,10 @@ func (p *MySQLProvider) updateAdminLastLogin(username string) error {
 	return sqlCommonUpdateAdminLastLogin(username, p.dbHandle)
 }
 
+func (p *MySQLProvider) setAdminLocked(username string, locked bool) error {
+	return sqlCommonSetAdminLocked(username, locked, p.dbHandle)
+}
+
 func (p *MySQLProvider) userExists(username string) (User, error) {
 	return sqlCommonGetUserByUsername(username, p.dbHandle)
 }
@@ -356,8 +428,8 @@ func (p *MySQLProvider) getRecentlyUpdatedUsers(after int64) ([]User, error) {
 	return sqlCommonGetRecentlyUpdatedUsers(after, p.dbHandle)
 }
 
-func (p *MySQLProvider) getUsers(limit int, offset int, order string) ([]User, error) {
-	return sqlCommonGetUsers(limit, offset, order, p.dbHandle)
+func (p *MySQLProvider) getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error) {
+	return sqlCommonGetUsers(limit, offset, order, usernamePatterns, p.dbHandle)
 }
 
 func (p *MySQLProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User, error) {
@@ -410,6 +482,10 @@ func (p *MySQLProvider) getUsersInGroups(names []string) ([]string, error) {
 	return sqlCommonGetUsersInGroups(names, p.dbHandle)
 }
 
+func (p *MySQLProvider) getChildGroups(names []string) ([]string, error) {
+	return sqlCommonGetChildGroups(names, p.dbHandle)
+}
+
 func (p *MySQLProvider) groupExists(name string) (Group, error) {
 	return sqlCommonGetGroupByName(name, p.dbHandle)
 }
@@ -486,6 +562,10 @@ func (p *MySQLProvider) updateAPIKeyLastUse(keyID string) error {
 	return sqlCommonUpdateAPIKeyLastUse(keyID, p.dbHandle)
 }
 
+func (p *MySQLProvider) updateAPIKeySecret(keyID, key string) error {
+	return sqlCommonUpdateAPIKeySecret(keyID, key, p.dbHandle)
+}
+
 func (p *MySQLProvider) shareExists(shareID, username string) (Share, error) {
 	return sqlCommonGetShareByID(shareID, username, p.dbHandle)
 }
@@ -582,6 +662,10 @@ func (p *MySQLProvider) cleanupSharedSessions(sessionType SessionType, before in
 	return sqlCommonCleanupSessions(sessionType, before, p.dbHandle)
 }
 
+func (p *MySQLProvider) getSharedSessions(sessionType SessionType, after int64) ([]Session, error) {
+	return sqlCommonGetSessions(sessionType, after, p.dbHandle)
+}
+
 func (p *MySQLProvider) getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error) {
 	return sqlCommonGetEventActions(limit, offset, order, minimal, p.dbHandle)
 }
@@ -662,10 +746,110 @@ func (p *MySQLProvider) getNodes() ([]Node, error) {
 	return sqlCommonGetNodes(p.dbHandle)
 }
 
+func (p *MySQLProvider) getOnlineMigrations() ([]OnlineMigration, error) {
+	return sqlCommonGetOnlineMigrations(p.dbHandle)
+}
+
+func (p *MySQLProvider) pauseOnlineMigration(version int) error {
+	return sqlCommonPauseOnlineMigration(p.dbHandle, version)
+}
+
 func (p *MySQLProvider) updateNodeTimestamp() error {
 	return sqlCommonUpdateNodeTimestamp(p.dbHandle)
 }
 
+func (p *MySQLProvider) updateKnownIP(username, ip string, cutoff int64) (bool, error) {
+	return sqlCommonUpdateKnownIP(username, ip, cutoff, p.dbHandle)
+}
+
+func (p *MySQLProvider) cleanupKnownIPs(before int64) error {
+	return sqlCommonCleanupKnownIPs(before, p.dbHandle)
+}
+
+func (p *MySQLProvider) getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *MySQLProvider) getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntries(storageID, dirName, recursive, p.dbHandle)
+}
+
+func (p *MySQLProvider) addContentEntry(entry *vfs.ContentIndexEntry) error {
+	return sqlCommonAddContentEntry(entry, p.dbHandle)
+}
+
+func (p *MySQLProvider) renameContentEntries(storageID, source, target string) error {
+	return sqlCommonRenameContentEntries(storageID, source, target, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteContentEntry(storageID, name string) error {
+	return sqlCommonDeleteContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *MySQLProvider) getContentHashes(storageID string) ([]string, error) {
+	return sqlCommonGetContentHashes(storageID, p.dbHandle)
+}
+
+func (p *MySQLProvider) isContentReferenced(storageID, hash string) (bool, error) {
+	return sqlCommonIsContentReferenced(storageID, hash, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	return sqlCommonDeleteContentEntriesByHash(storageID, hash, p.dbHandle)
+}
+
+func (p *MySQLProvider) addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	return sqlCommonAddUploadSession(session, owner, leaseExpiresAt, p.dbHandle)
+}
+
+func (p *MySQLProvider) updateUploadSession(session *vfs.UploadSession, owner string) error {
+	return sqlCommonUpdateUploadSession(session, owner, p.dbHandle)
+}
+
+func (p *MySQLProvider) claimUploadSession(id, owner string, leaseExpiresAt, now int64) error {
+	return sqlCommonClaimUploadSession(id, owner, leaseExpiresAt, now, p.dbHandle)
+}
+
+func (p *MySQLProvider) releaseUploadSession(id, owner string) error {
+	return sqlCommonReleaseUploadSession(id, owner, p.dbHandle)
+}
+
+func (p *MySQLProvider) getUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSession(username, virtualPath, p.dbHandle)
+}
+
+func (p *MySQLProvider) getUploadSessionByID(id string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessionByID(id, p.dbHandle)
+}
+
+func (p *MySQLProvider) getUploadSessions(username string) ([]vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessions(username, p.dbHandle)
+}
+
+func (p *MySQLProvider) getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error) {
+	return sqlCommonGetStaleUploadSessions(lastSeenBefore, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteUploadSession(id string) error {
+	return sqlCommonDeleteUploadSession(id, p.dbHandle)
+}
+
+func (p *MySQLProvider) setReplicationStatus(status *vfs.ReplicationStatus) error {
+	return sqlCommonSetReplicationStatus(status, p.dbHandle)
+}
+
+func (p *MySQLProvider) getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
+func (p *MySQLProvider) getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationsToRetry(nextRetryBefore, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteReplicationStatus(username, virtualPath string) error {
+	return sqlCommonDeleteReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
 func (p *MySQLProvider) cleanupNodes() error {
 	return sqlCommonCleanupNodes(p.dbHandle)
 }
@@ -678,6 +862,10 @@ func (p *MySQLProvider) setFirstUploadTimestamp(username string) error {
 	return sqlCommonSetFirstUploadTimestamp(username, p.dbHandle)
 }
 
+func (p *MySQLProvider) updateQuotaWarning(username string, threshold int) (bool, error) {
+	return sqlCommonUpdateQuotaWarning(username, threshold, p.dbHandle)
+}
+
 func (p *MySQLProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -725,6 +913,32 @@ func (p *MySQLProvider) migrateDatabase() error { //nolint:dupl
 		return updateMySQLDatabaseFromV21(p.dbHandle)
 	case version == 22:
 		return updateMySQLDatabaseFromV22(p.dbHandle)
+	case version == 23:
+		return updateMySQLDatabaseFromV23(p.dbHandle)
+	case version == 24:
+		return updateMySQLDatabaseFromV24(p.dbHandle)
+	case version == 25:
+		return updateMySQLDatabaseFromV25(p.dbHandle)
+	case version == 26:
+		return updateMySQLDatabaseFromV26(p.dbHandle)
+	case version == 27:
+		return updateMySQLDatabaseFromV27(p.dbHandle)
+	case version == 28:
+		return updateMySQLDatabaseFromV28(p.dbHandle)
+	case version == 29:
+		return updateMySQLDatabaseFromV29(p.dbHandle)
+	case version == 30:
+		return updateMySQLDatabaseFromV30(p.dbHandle)
+	case version == 31:
+		return updateMySQLDatabaseFromV31(p.dbHandle)
+	case version == 32:
+		return updateMySQLDatabaseFromV32(p.dbHandle)
+	case version == 33:
+		return updateMySQLDatabaseFromV33(p.dbHandle)
+	case version == 34:
+		return updateMySQLDatabaseFromV34(p.dbHandle)
+	case version == 35:
+		return updateMySQLDatabaseFromV35(p.dbHandle)
 	default:
 		if version > sqlDatabaseVersion {
 			providerLog(logger.LevelError, "database schema version %v is newer than the supported one: %v", version,
@@ -755,6 +969,32 @@ func (p *MySQLProvider) revertDatabase(targetVersion int) error {
 		return downgradeMySQLDatabaseFromV22(p.dbHandle)
 	case 23:
 		return downgradeMySQLDatabaseFromV23(p.dbHandle)
+	case 24:
+		return downgradeMySQLDatabaseFromV24(p.dbHandle)
+	case 25:
+		return downgradeMySQLDatabaseFromV25(p.dbHandle)
+	case 26:
+		return downgradeMySQLDatabaseFromV26(p.dbHandle)
+	case 27:
+		return downgradeMySQLDatabaseFromV27(p.dbHandle)
+	case 28:
+		return downgradeMySQLDatabaseFromV28(p.dbHandle)
+	case 29:
+		return downgradeMySQLDatabaseFromV29(p.dbHandle)
+	case 30:
+		return downgradeMySQLDatabaseFromV30(p.dbHandle)
+	case 31:
+		return downgradeMySQLDatabaseFromV31(p.dbHandle)
+	case 32:
+		return downgradeMySQLDatabaseFromV32(p.dbHandle)
+	case 33:
+		return downgradeMySQLDatabaseFromV33(p.dbHandle)
+	case 34:
+		return downgradeMySQLDatabaseFromV34(p.dbHandle)
+	case 35:
+		return downgradeMySQLDatabaseFromV35(p.dbHandle)
+	case 36:
+		return downgradeMySQLDatabaseFromV36(p.dbHandle)
 	default:
 		return fmt.Errorf("database schema version not handled: %v", dbVersion.Version)
 	}
@@ -787,7 +1027,98 @@ func updateMySQLDatabaseFromV21(dbHandle *sql.DB) error {
 }
 
 func updateMySQLDatabaseFromV22(dbHandle *sql.DB) error {
-	return updateMySQLDatabaseFrom22To23(dbHandle)
+	if err := updateMySQLDatabaseFrom22To23(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV23(dbHandle)
+}
+
+func updateMySQLDatabaseFromV23(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom23To24(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV24(dbHandle)
+}
+
+func updateMySQLDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom24To25(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV25(dbHandle)
+}
+
+func updateMySQLDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom25To26(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV26(dbHandle)
+}
+
+func updateMySQLDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom26To27(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV27(dbHandle)
+}
+
+func updateMySQLDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom27To28(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV28(dbHandle)
+}
+
+func updateMySQLDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom28To29(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV29(dbHandle)
+}
+
+func updateMySQLDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom29To30(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV30(dbHandle)
+}
+
+func updateMySQLDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom30To31(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV31(dbHandle)
+}
+
+func updateMySQLDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom31To32(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV32(dbHandle)
+}
+
+func updateMySQLDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom32To33(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV33(dbHandle)
+}
+
+func updateMySQLDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom33To34(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV34(dbHandle)
+}
+
+func updateMySQLDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := updateMySQLDatabaseFrom34To35(dbHandle); err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV35(dbHandle)
+}
+
+func updateMySQLDatabaseFromV35(dbHandle *sql.DB) error {
+	return updateMySQLDatabaseFrom35To36(dbHandle)
 }
 
 func downgradeMySQLDatabaseFromV20(dbHandle *sql.DB) error {
@@ -815,6 +1146,97 @@ func downgradeMySQLDatabaseFromV23(dbHandle *sql.DB) error {
 	return downgradeMySQLDatabaseFromV22(dbHandle)
 }
 
+func downgradeMySQLDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom24To23(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV23(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom25To24(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV24(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom26To25(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV25(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom27To26(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV26(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom28To27(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV27(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom29To28(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV28(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom30To29(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV29(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom31To30(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV30(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom32To31(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV31(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom33To32(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV32(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom34To33(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV33(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV35(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom35To34(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV34(dbHandle)
+}
+
+func downgradeMySQLDatabaseFromV36(dbHandle *sql.DB) error {
+	if err := downgradeMySQLDatabaseFrom36To35(dbHandle); err != nil {
+		return err
+	}
+	return downgradeMySQLDatabaseFromV35(dbHandle)
+}
+
 func updateMySQLDatabaseFrom19To20(dbHandle *sql.DB) error {
 	logger.InfoToConsole("updating database schema version: 19 -> 20")
 	providerLog(logger.LevelInfo, "updating database schema version: 19 -> 20")
@@ -831,7 +1253,7 @@ func updateMySQLDatabaseFrom20To21(dbHandle *sql.DB) error {
 	logger.InfoToConsole("updating database schema version: 20 -> 21")
 	providerLog(logger.LevelInfo, "updating database schema version: 20 -> 21")
 	sql := strings.ReplaceAll(mysqlV21SQL, "{{users}}", sqlTableUsers)
-	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 21, true)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 21)
 }
 
 func updateMySQLDatabaseFrom21To22(dbHandle *sql.DB) error {
@@ -851,6 +1273,105 @@ func updateMySQLDatabaseFrom22To23(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 23, true)
 }
 
+func updateMySQLDatabaseFrom23To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 23 -> 24")
+	providerLog(logger.LevelInfo, "updating database schema version: 23 -> 24")
+	sql := strings.ReplaceAll(mysqlV24SQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 24)
+}
+
+func updateMySQLDatabaseFrom24To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 24 -> 25")
+	providerLog(logger.LevelInfo, "updating database schema version: 24 -> 25")
+	sql := strings.ReplaceAll(mysqlV25SQL, "{{shares}}", sqlTableShares)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 25)
+}
+
+func updateMySQLDatabaseFrom25To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 25 -> 26")
+	providerLog(logger.LevelInfo, "updating database schema version: 25 -> 26")
+	sql := strings.ReplaceAll(mysqlV26SQL, "{{known_ips}}", sqlTableKnownIPs)
+	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 26, true)
+}
+
+func updateMySQLDatabaseFrom26To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 26 -> 27")
+	providerLog(logger.LevelInfo, "updating database schema version: 26 -> 27")
+	sql := strings.ReplaceAll(mysqlV27SQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 27)
+}
+
+func updateMySQLDatabaseFrom27To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 27 -> 28")
+	providerLog(logger.LevelInfo, "updating database schema version: 27 -> 28")
+	sql := strings.ReplaceAll(mysqlV28SQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 28)
+}
+
+func updateMySQLDatabaseFrom28To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 28 -> 29")
+	providerLog(logger.LevelInfo, "updating database schema version: 28 -> 29")
+	sql := strings.ReplaceAll(mysqlV29SQL, "{{content_index}}", sqlTableContentIndex)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 29, true)
+}
+
+func updateMySQLDatabaseFrom29To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 29 -> 30")
+	providerLog(logger.LevelInfo, "updating database schema version: 29 -> 30")
+	sql := strings.ReplaceAll(mysqlV30SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 30, true)
+}
+
+func updateMySQLDatabaseFrom30To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 30 -> 31")
+	providerLog(logger.LevelInfo, "updating database schema version: 30 -> 31")
+	sql := strings.ReplaceAll(mysqlV31SQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 31)
+}
+
+func updateMySQLDatabaseFrom31To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 31 -> 32")
+	providerLog(logger.LevelInfo, "updating database schema version: 31 -> 32")
+	sql := strings.ReplaceAll(mysqlV32SQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 32)
+}
+
+func updateMySQLDatabaseFrom32To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 32 -> 33")
+	providerLog(logger.LevelInfo, "updating database schema version: 32 -> 33")
+	sql := strings.ReplaceAll(mysqlV33SQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 33)
+}
+
+func updateMySQLDatabaseFrom33To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 33 -> 34")
+	providerLog(logger.LevelInfo, "updating database schema version: 33 -> 34")
+	sql := strings.ReplaceAll(mysqlV34SQL, "{{users}}", sqlTableUsers)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, strings.Split(sql, ";"), 34)
+}
+
+func updateMySQLDatabaseFrom34To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 34 -> 35")
+	providerLog(logger.LevelInfo, "updating database schema version: 34 -> 35")
+	sql := strings.ReplaceAll(mysqlV35SQL, "{{replications}}", sqlTableReplications)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 35, true)
+}
+
+func updateMySQLDatabaseFrom35To36(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 35 -> 36")
+	providerLog(logger.LevelInfo, "updating database schema version: 35 -> 36")
+	sql := strings.ReplaceAll(mysqlV36SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 36, true)
+}
+
 func downgradeMySQLDatabaseFrom20To19(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database schema version: 20 -> 19")
 	providerLog(logger.LevelInfo, "downgrading database schema version: 20 -> 19")
@@ -883,3 +1404,97 @@ func downgradeMySQLDatabaseFrom23To22(dbHandle *sql.DB) error {
 	sql := strings.ReplaceAll(mysqlV23DownSQL, "{{nodes}}", sqlTableNodes)
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 22, false)
 }
+
+func downgradeMySQLDatabaseFrom24To23(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 24 -> 23")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 24 -> 23")
+	sql := strings.ReplaceAll(mysqlV24DownSQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 23, false)
+}
+
+func downgradeMySQLDatabaseFrom25To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 25 -> 24")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 25 -> 24")
+	sql := strings.ReplaceAll(mysqlV25DownSQL, "{{shares}}", sqlTableShares)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 24, false)
+}
+
+func downgradeMySQLDatabaseFrom26To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 26 -> 25")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 26 -> 25")
+	sql := strings.ReplaceAll(mysqlV26DownSQL, "{{known_ips}}", sqlTableKnownIPs)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 25, false)
+}
+
+func downgradeMySQLDatabaseFrom27To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 27 -> 26")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 27 -> 26")
+	sql := strings.ReplaceAll(mysqlV27DownSQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 26, false)
+}
+
+func downgradeMySQLDatabaseFrom28To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 28 -> 27")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 28 -> 27")
+	sql := strings.ReplaceAll(mysqlV28DownSQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 27, false)
+}
+
+func downgradeMySQLDatabaseFrom29To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 29 -> 28")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 29 -> 28")
+	sql := strings.ReplaceAll(mysqlV29DownSQL, "{{content_index}}", sqlTableContentIndex)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 28, false)
+}
+
+func downgradeMySQLDatabaseFrom30To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 30 -> 29")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 30 -> 29")
+	sql := strings.ReplaceAll(mysqlV30DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 29, false)
+}
+
+func downgradeMySQLDatabaseFrom31To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 31 -> 30")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 31 -> 30")
+	sql := strings.ReplaceAll(mysqlV31DownSQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 30, false)
+}
+
+func downgradeMySQLDatabaseFrom32To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 32 -> 31")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 32 -> 31")
+	sql := strings.ReplaceAll(mysqlV32DownSQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 31, false)
+}
+
+func downgradeMySQLDatabaseFrom33To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 33 -> 32")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 33 -> 32")
+	sql := strings.ReplaceAll(mysqlV33DownSQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 32, false)
+}
+
+func downgradeMySQLDatabaseFrom34To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 34 -> 33")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 34 -> 33")
+	sql := strings.ReplaceAll(mysqlV34DownSQL, "{{users}}", sqlTableUsers)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 33, false)
+}
+
+func downgradeMySQLDatabaseFrom35To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 35 -> 34")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 35 -> 34")
+	sql := strings.ReplaceAll(mysqlV35DownSQL, "{{replications}}", sqlTableReplications)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 34, false)
+}
+
+func downgradeMySQLDatabaseFrom36To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 36 -> 35")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 36 -> 35")
+	sql := strings.ReplaceAll(mysqlV36DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 35, false)
+}
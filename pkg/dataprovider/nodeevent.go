@@ -0,0 +1,179 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	nodeEventKeyPrefix = "nodeevent_"
+	nodeEventsMaxAge   = 10 * time.Minute
+	// events are read again for this interval so events stored with a
+	// slightly different clock or committed late are not lost
+	nodeEventsCheckOverlap = 5 * time.Second
+)
+
+var (
+	nodeEventHandlers   = newNodeEventHandlers()
+	lastNodeEventsCheck atomic.Int64
+)
+
+// FnNodeEventHandler defines the callback to handle an event generated by
+// another cluster node. The same event could be handled more than once,
+// so handlers must be idempotent
+type FnNodeEventHandler func(data []byte)
+
+// nodeEvent defines an event to propagate to the other cluster nodes.
+// Node events are stored as shared sessions and each node periodically
+// loads the events generated by the other nodes
+type nodeEvent struct {
+	Node string `json:"node"`
+	Kind string `json:"kind"`
+	Data []byte `json:"data"`
+}
+
+type nodeEventsHandlers struct {
+	sync.RWMutex
+	handlers map[string]FnNodeEventHandler
+	// keys of the events handled in the previous check
+	handled map[string]bool
+}
+
+func newNodeEventHandlers() *nodeEventsHandlers {
+	return &nodeEventsHandlers{
+		handlers: make(map[string]FnNodeEventHandler),
+		handled:  make(map[string]bool),
+	}
+}
+
+func (h *nodeEventsHandlers) add(kind string, fn FnNodeEventHandler) {
+	h.Lock()
+	defer h.Unlock()
+
+	if fn == nil {
+		delete(h.handlers, kind)
+		return
+	}
+	h.handlers[kind] = fn
+}
+
+func (h *nodeEventsHandlers) get(kind string) (FnNodeEventHandler, bool) {
+	h.RLock()
+	defer h.RUnlock()
+
+	fn, ok := h.handlers[kind]
+	return fn, ok
+}
+
+func (h *nodeEventsHandlers) isHandled(key string) bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.handled[key]
+}
+
+func (h *nodeEventsHandlers) setHandled(keys map[string]bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.handled = keys
+}
+
+// RegisterNodeEventHandler sets the handler for the node events of the
+// specified kind. A nil handler removes the existing one
+func RegisterNodeEventHandler(kind string, fn FnNodeEventHandler) {
+	nodeEventHandlers.add(kind, fn)
+}
+
+// AddNodeEvent stores an event for the other cluster nodes.
+// It does nothing if inter-node communications are disabled
+func AddNodeEvent(kind string, data []byte) error {
+	if currentNode == nil {
+		return nil
+	}
+	session := Session{
+		Key: nodeEventKeyPrefix + util.GenerateUniqueID(),
+		Data: nodeEvent{
+			Node: currentNode.Name,
+			Kind: kind,
+			Data: data,
+		},
+		Type:      SessionTypeNodeEvent,
+		Timestamp: util.GetTimeAsMsSinceEpoch(time.Now()),
+	}
+	if err := provider.addSharedSession(session); err != nil {
+		providerLog(logger.LevelError, "unable to add node event %q: %v", kind, err)
+		return err
+	}
+	return nil
+}
+
+func addScheduledNodeEventsCheck() error {
+	lastNodeEventsCheck.Store(util.GetTimeAsMsSinceEpoch(time.Now()))
+	_, err := scheduler.AddFunc("@every 10s", checkNodeEvents)
+	if err != nil {
+		return fmt.Errorf("unable to schedule node events check: %w", err)
+	}
+	return nil
+}
+
+func checkNodeEvents() {
+	checkTime := util.GetTimeAsMsSinceEpoch(time.Now())
+	after := lastNodeEventsCheck.Load() - nodeEventsCheckOverlap.Milliseconds()
+	sessions, err := provider.getSharedSessions(SessionTypeNodeEvent, after)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get node events: %v", err)
+		return
+	}
+	handled := make(map[string]bool)
+	for _, session := range sessions {
+		handled[session.Key] = true
+		if nodeEventHandlers.isHandled(session.Key) {
+			continue
+		}
+		data, ok := session.Data.([]byte)
+		if !ok {
+			continue
+		}
+		var event nodeEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			providerLog(logger.LevelError, "unable to decode node event %q: %v", session.Key, err)
+			continue
+		}
+		if event.Node == GetNodeName() {
+			continue
+		}
+		if fn, ok := nodeEventHandlers.get(event.Kind); ok {
+			providerLog(logger.LevelDebug, "handling node event %q, kind %q, from node %q", session.Key,
+				event.Kind, event.Node)
+			fn(event.Data)
+		}
+	}
+	nodeEventHandlers.setHandled(handled)
+	lastNodeEventsCheck.Store(checkTime)
+}
+
+func cleanupNodeEvents() error {
+	return provider.cleanupSharedSessions(SessionTypeNodeEvent,
+		util.GetTimeAsMsSinceEpoch(time.Now().Add(-nodeEventsMaxAge)))
+}
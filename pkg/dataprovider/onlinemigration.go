@@ -0,0 +1,629 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported online migration statuses
+const (
+	OnlineMigrationStatusPending  = "pending"
+	OnlineMigrationStatusRunning  = "running"
+	OnlineMigrationStatusPaused   = "paused"
+	OnlineMigrationStatusComplete = "complete"
+	OnlineMigrationStatusFailed   = "failed"
+)
+
+const (
+	defaultOnlineMigrationBatchSize = 1000
+	onlineMigrationBatchDelay       = 50 * time.Millisecond
+)
+
+var (
+	// ErrOnlineMigrationPaused is returned if an online migration was paused
+	ErrOnlineMigrationPaused = errors.New("the online migration is paused")
+	onlineMigrationBatchSize = defaultOnlineMigrationBatchSize
+)
+
+// OnlineMigration defines the state of an online schema migration.
+// Online migrations apply schema changes in small, non-locking steps,
+// so they can run while SFTPGo is serving requests
+type OnlineMigration struct {
+	// Target schema version
+	Version int `json:"version"`
+	// Status: pending, running, paused, complete or failed
+	Status string `json:"status"`
+	// Number of completed steps
+	Step int `json:"step"`
+	// Total number of steps
+	Steps int `json:"steps"`
+	// Last error for failed migrations
+	Error string `json:"error,omitempty"`
+	// Creation and last update time as unix timestamp in milliseconds
+	CreatedAt int64 `json:"created_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// onlineMigrationStep defines a single step of an online migration
+type onlineMigrationStep struct {
+	sql string
+	// batched steps are executed repeatedly until no row is affected,
+	// the SQL must have a "%d" verb for the batch size
+	batched bool
+	// the step is skipped if the specified column already exists,
+	// it allows to safely resume interrupted migrations
+	skipIfColumnExists string
+	// the step is skipped if the specified index already exists
+	skipIfIndexExists string
+	table             string
+}
+
+// GetOnlineMigrations returns the state of the online schema migrations
+func GetOnlineMigrations() ([]OnlineMigration, error) {
+	return provider.getOnlineMigrations()
+}
+
+// PauseOnlineMigration pauses the running online migration, if any.
+// The migration stops after the current batch and can be resumed using the
+// "online-migrate" command or restarting SFTPGo
+func PauseOnlineMigration(version int) error {
+	return provider.pauseOnlineMigration(version)
+}
+
+// OnlineMigrateDatabase migrates the database schema to the latest version preferring
+// online migrations, if available
+func OnlineMigrateDatabase(cnf Config, basePath string, batchSize int) error {
+	if batchSize > 0 {
+		onlineMigrationBatchSize = batchSize
+	}
+	return InitializeDatabase(cnf, basePath)
+}
+
+// PauseOnlineDatabaseMigration pauses the running online migration to the specified
+// version using the given configuration
+func PauseOnlineDatabaseMigration(cnf Config, basePath string, version int) error {
+	config = cnf
+
+	if err := createProvider(basePath); err != nil {
+		return err
+	}
+	return provider.pauseOnlineMigration(version)
+}
+
+func isOnlineMigrationSupported() bool {
+	return config.Driver == PGSQLDataProviderName || config.Driver == MySQLDataProviderName
+}
+
+// getOnlineMigrationSteps returns the steps to upgrade the schema to the
+// specified version without locking the tables for long time.
+// An empty result means that there is no online migration for this version
+func getOnlineMigrationSteps(version int) []onlineMigrationStep {
+	switch config.Driver {
+	case PGSQLDataProviderName:
+		switch version {
+		case 21:
+			var steps []onlineMigrationStep
+			for _, column := range []string{"first_download", "first_upload"} {
+				steps = append(steps, getPgSQLAddNotNullColumnSteps(sqlTableUsers, column, "bigint", "0")...)
+			}
+			return steps
+		case 24:
+			return []onlineMigrationStep{getPgSQLAddNullableColumnStep(sqlTableAPIKeys, "filters", "text")}
+		case 25:
+			return []onlineMigrationStep{
+				getPgSQLAddNullableColumnStep(sqlTableShares, "display_name", "varchar(255)"),
+				getPgSQLAddNullableColumnStep(sqlTableShares, "disposition", "varchar(20)"),
+			}
+		case 27:
+			var steps []onlineMigrationStep
+			for _, table := range []string{sqlTableFolders, sqlTableEventsActions} {
+				steps = append(steps, getPgSQLAddNotNullColumnSteps(table, "updated_at", "bigint", "0")...)
+			}
+			steps = append(steps, getPgSQLCreateIndexSteps(sqlTableFolders, "folders_updated_at_idx", "updated_at")...)
+			steps = append(steps, getPgSQLCreateIndexSteps(sqlTableEventsActions, "events_actions_updated_at_idx",
+				"updated_at")...)
+			return steps
+		case 28:
+			return []onlineMigrationStep{getPgSQLAddNullableColumnStep(sqlTableGroups, "parent_group", "varchar(255)")}
+		case 31:
+			return []onlineMigrationStep{getPgSQLAddNullableColumnStep(sqlTableFolders, "audit_log", "text")}
+		case 32:
+			var steps []onlineMigrationStep
+			for _, table := range []string{sqlTableUsersFoldersMapping, sqlTableGroupsFoldersMapping} {
+				steps = append(steps, getPgSQLAddNotNullColumnSteps(table, "read_only", "integer", "0")...)
+			}
+			return steps
+		case 33:
+			return getPgSQLAddNotNullColumnSteps(sqlTableAdmins, "locked", "integer", "0")
+		case 34:
+			return getPgSQLAddNotNullColumnSteps(sqlTableUsers, "last_quota_warning", "integer", "0")
+		}
+	case MySQLDataProviderName:
+		switch version {
+		case 21:
+			var steps []onlineMigrationStep
+			for _, column := range []string{"first_download", "first_upload"} {
+				steps = append(steps, getMySQLAddNotNullColumnSteps(sqlTableUsers, column, "bigint", "0")...)
+			}
+			return steps
+		case 24:
+			return []onlineMigrationStep{getMySQLAddNullableColumnStep(sqlTableAPIKeys, "filters", "longtext")}
+		case 25:
+			return []onlineMigrationStep{
+				getMySQLAddNullableColumnStep(sqlTableShares, "display_name", "varchar(255)"),
+				getMySQLAddNullableColumnStep(sqlTableShares, "disposition", "varchar(20)"),
+			}
+		case 27:
+			var steps []onlineMigrationStep
+			for _, table := range []string{sqlTableFolders, sqlTableEventsActions} {
+				steps = append(steps, getMySQLAddNotNullColumnSteps(table, "updated_at", "bigint", "0")...)
+			}
+			steps = append(steps,
+				getMySQLCreateIndexStep(sqlTableFolders, "folders_updated_at_idx", "updated_at"),
+				getMySQLCreateIndexStep(sqlTableEventsActions, "events_actions_updated_at_idx", "updated_at"),
+			)
+			return steps
+		case 28:
+			return []onlineMigrationStep{getMySQLAddNullableColumnStep(sqlTableGroups, "parent_group", "varchar(255)")}
+		case 31:
+			return []onlineMigrationStep{getMySQLAddNullableColumnStep(sqlTableFolders, "audit_log", "longtext")}
+		case 32:
+			var steps []onlineMigrationStep
+			for _, table := range []string{sqlTableUsersFoldersMapping, sqlTableGroupsFoldersMapping} {
+				steps = append(steps, getMySQLAddNotNullColumnSteps(table, "read_only", "integer", "0")...)
+			}
+			return steps
+		case 33:
+			return getMySQLAddNotNullColumnSteps(sqlTableAdmins, "locked", "integer", "0")
+		case 34:
+			return getMySQLAddNotNullColumnSteps(sqlTableUsers, "last_quota_warning", "integer", "0")
+		}
+	}
+	return nil
+}
+
+// getPgSQLAddNullableColumnStep returns the step to add a nullable column, PostgreSQL
+// only needs to update the catalog, the table is not rewritten
+func getPgSQLAddNullableColumnStep(table, column, columnType string) onlineMigrationStep {
+	return onlineMigrationStep{
+		sql:                fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s NULL`, table, column, columnType),
+		skipIfColumnExists: column,
+		table:              table,
+	}
+}
+
+// getPgSQLCreateIndexSteps returns the steps to build an index without blocking writes.
+// A failed concurrent build leaves an invalid index, so any existing index is dropped first
+func getPgSQLCreateIndexSteps(table, index, column string) []onlineMigrationStep {
+	index = config.SQLTablesPrefix + index
+	return []onlineMigrationStep{
+		{
+			sql: fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS "%s"`, index),
+		},
+		{
+			sql: fmt.Sprintf(`CREATE INDEX CONCURRENTLY "%s" ON "%s" ("%s")`, index, table, column),
+		},
+	}
+}
+
+// getPgSQLAddNotNullColumnSteps returns the steps to add a not null column without
+// a default value. The column is added as nullable, backfilled in batches and then
+// the not null constraint is added using a validated check constraint, this way
+// PostgreSQL does not need to scan the table while holding an exclusive lock
+func getPgSQLAddNotNullColumnSteps(table, column, columnType, value string) []onlineMigrationStep {
+	constraint := fmt.Sprintf("%s%s_%s_not_null", config.SQLTablesPrefix, strings.TrimPrefix(table,
+		config.SQLTablesPrefix), column)
+	return []onlineMigrationStep{
+		{
+			sql:                fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s NULL`, table, column, columnType),
+			skipIfColumnExists: column,
+			table:              table,
+		},
+		{
+			sql: fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" SET DEFAULT %s`, table, column, value),
+		},
+		{
+			sql: fmt.Sprintf(`UPDATE "%s" SET "%s" = %s WHERE "id" IN (SELECT "id" FROM "%s" WHERE "%s" IS NULL LIMIT %%d)`,
+				table, column, value, table, column),
+			batched: true,
+		},
+		{
+			sql: fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT IF EXISTS "%s", ADD CONSTRAINT "%s" CHECK ("%s" IS NOT NULL) NOT VALID`,
+				table, constraint, constraint, column),
+		},
+		{
+			sql: fmt.Sprintf(`ALTER TABLE "%s" VALIDATE CONSTRAINT "%s"`, table, constraint),
+		},
+		{
+			sql: fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" SET NOT NULL`, table, column),
+		},
+		{
+			sql: fmt.Sprintf(`ALTER TABLE "%s" DROP CONSTRAINT IF EXISTS "%s", ALTER COLUMN "%s" DROP DEFAULT`,
+				table, constraint, column),
+		},
+	}
+}
+
+// getMySQLAddNotNullColumnSteps returns the steps to add a not null column without
+// a default value. The column is added as nullable, backfilled in batches and then
+// modified to be not null. Schema changes require concurrent DML to be allowed
+func getMySQLAddNotNullColumnSteps(table, column, columnType, value string) []onlineMigrationStep {
+	return []onlineMigrationStep{
+		{
+			sql:                fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s NULL, LOCK=NONE", table, column, columnType),
+			skipIfColumnExists: column,
+			table:              table,
+		},
+		{
+			sql: fmt.Sprintf("ALTER TABLE `%s` ALTER COLUMN `%s` SET DEFAULT %s", table, column, value),
+		},
+		{
+			sql:     fmt.Sprintf("UPDATE `%s` SET `%s` = %s WHERE `%s` IS NULL LIMIT %%d", table, column, value, column),
+			batched: true,
+		},
+		{
+			sql: fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s NOT NULL DEFAULT %s, LOCK=NONE", table, column,
+				columnType, value),
+		},
+		{
+			sql: fmt.Sprintf("ALTER TABLE `%s` ALTER COLUMN `%s` DROP DEFAULT", table, column),
+		},
+	}
+}
+
+// getMySQLAddNullableColumnStep returns the step to add a nullable column allowing
+// concurrent DML
+func getMySQLAddNullableColumnStep(table, column, columnType string) onlineMigrationStep {
+	return onlineMigrationStep{
+		sql:                fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s NULL, LOCK=NONE", table, column, columnType),
+		skipIfColumnExists: column,
+		table:              table,
+	}
+}
+
+// getMySQLCreateIndexStep returns the step to build an index allowing concurrent DML
+func getMySQLCreateIndexStep(table, index, column string) onlineMigrationStep {
+	index = config.SQLTablesPrefix + index
+	return onlineMigrationStep{
+		sql: fmt.Sprintf("CREATE INDEX `%s` ON `%s` (`%s`) ALGORITHM=INPLACE LOCK=NONE", index, table,
+			column),
+		skipIfIndexExists: index,
+		table:             table,
+	}
+}
+
+// sqlCommonUpdateDatabaseVersionOnline upgrades the schema to the specified version using
+// an online migration if available, otherwise the specified queries are executed in a
+// single transaction
+func sqlCommonUpdateDatabaseVersionOnline(dbHandle *sql.DB, sqlQueries []string, newVersion int) error {
+	if isOnlineMigrationSupported() {
+		if steps := getOnlineMigrationSteps(newVersion); len(steps) > 0 {
+			return sqlCommonRunOnlineMigration(dbHandle, newVersion, steps)
+		}
+	}
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, sqlQueries, newVersion, true)
+}
+
+func sqlCommonRunOnlineMigration(dbHandle *sql.DB, version int, steps []onlineMigrationStep) error {
+	ctx := context.Background()
+	conn, err := dbHandle.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := sqlAcquireOnlineMigrationLock(ctx, conn); err != nil {
+		return err
+	}
+	defer sqlReleaseOnlineMigrationLock(conn)
+
+	if err := sqlCommonCreateOnlineMigrationsTable(dbHandle); err != nil {
+		return err
+	}
+	migration, err := sqlCommonGetOnlineMigration(dbHandle, version, len(steps))
+	if err != nil {
+		return err
+	}
+	switch migration.Status {
+	case OnlineMigrationStatusComplete:
+		// the schema was reverted after a completed migration, all the steps can be safely executed again
+		migration.Step = 0
+	case OnlineMigrationStatusPaused:
+		logger.InfoToConsole("resuming paused online migration to version %d", version)
+	}
+	logger.InfoToConsole("updating database schema version to %d using an online migration, completed steps: %d/%d",
+		version, migration.Step, len(steps))
+	providerLog(logger.LevelInfo, "updating database schema version to %d using an online migration, completed steps: %d/%d",
+		version, migration.Step, len(steps))
+
+	migration.Status = OnlineMigrationStatusRunning
+	migration.Error = ""
+	if err := sqlCommonUpdateOnlineMigration(dbHandle, &migration); err != nil {
+		return err
+	}
+	for idx := migration.Step; idx < len(steps); idx++ {
+		if err := sqlCommonRunOnlineMigrationStep(dbHandle, version, &steps[idx]); err != nil {
+			if errors.Is(err, ErrOnlineMigrationPaused) {
+				logger.WarnToConsole("online migration to version %d paused, completed steps: %d/%d", version,
+					idx, len(steps))
+				providerLog(logger.LevelInfo, "online migration to version %d paused, completed steps: %d/%d",
+					version, idx, len(steps))
+				return err
+			}
+			providerLog(logger.LevelError, "online migration to version %d failed at step %d: %v", version, idx+1, err)
+			migration.Status = OnlineMigrationStatusFailed
+			migration.Error = err.Error()
+			sqlCommonUpdateOnlineMigration(dbHandle, &migration) //nolint:errcheck
+			return fmt.Errorf("online migration to version %d failed at step %d: %w", version, idx+1, err)
+		}
+		migration.Step = idx + 1
+		if err := sqlCommonUpdateOnlineMigration(dbHandle, &migration); err != nil {
+			return err
+		}
+	}
+	if err := sqlCommonExecSQLAndUpdateDBVersion(dbHandle, nil, version, true); err != nil {
+		return err
+	}
+	migration.Status = OnlineMigrationStatusComplete
+	return sqlCommonUpdateOnlineMigration(dbHandle, &migration)
+}
+
+func sqlCommonRunOnlineMigrationStep(dbHandle *sql.DB, version int, step *onlineMigrationStep) error {
+	if err := sqlCommonCheckOnlineMigrationPaused(dbHandle, version); err != nil {
+		return err
+	}
+	if step.skipIfColumnExists != "" {
+		exists, err := sqlCommonColumnExists(dbHandle, step.table, step.skipIfColumnExists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			providerLog(logger.LevelDebug, "column %q already exists in table %q, step skipped",
+				step.skipIfColumnExists, step.table)
+			return nil
+		}
+	}
+	if step.skipIfIndexExists != "" {
+		exists, err := sqlCommonIndexExists(dbHandle, step.table, step.skipIfIndexExists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			providerLog(logger.LevelDebug, "index %q already exists in table %q, step skipped",
+				step.skipIfIndexExists, step.table)
+			return nil
+		}
+	}
+	if !step.batched {
+		ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+		defer cancel()
+
+		_, err := dbHandle.ExecContext(ctx, step.sql)
+		return err
+	}
+	q := fmt.Sprintf(step.sql, onlineMigrationBatchSize)
+	var total int64
+	for {
+		affected, err := sqlCommonExecBatch(dbHandle, q)
+		if err != nil {
+			return err
+		}
+		total += affected
+		if affected == 0 {
+			providerLog(logger.LevelDebug, "backfill completed, updated rows: %d", total)
+			return nil
+		}
+		if err := sqlCommonCheckOnlineMigrationPaused(dbHandle, version); err != nil {
+			return err
+		}
+		time.Sleep(onlineMigrationBatchDelay)
+	}
+}
+
+func sqlCommonExecBatch(dbHandle *sql.DB, q string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	res, err := dbHandle.ExecContext(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func sqlCommonColumnExists(dbHandle *sql.DB, table, column string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	var count int
+	err := dbHandle.QueryRowContext(ctx, getColumnExistsQuery(), table, column).Scan(&count)
+	return count > 0, err
+}
+
+func sqlCommonIndexExists(dbHandle *sql.DB, table, index string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	var count int
+	err := dbHandle.QueryRowContext(ctx, getIndexExistsQuery(), table, index).Scan(&count)
+	return count > 0, err
+}
+
+func sqlCommonCheckOnlineMigrationPaused(dbHandle *sql.DB, version int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	var status string
+	err := dbHandle.QueryRowContext(ctx, getOnlineMigrationStatusQuery(), version).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status == OnlineMigrationStatusPaused {
+		return ErrOnlineMigrationPaused
+	}
+	return nil
+}
+
+func sqlCommonCreateOnlineMigrationsTable(dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	_, err := dbHandle.ExecContext(ctx, getCreateOnlineMigrationsTableQuery())
+	return err
+}
+
+// sqlCommonGetOnlineMigration returns the state for the specified migration, a
+// pending migration is added if none is found
+func sqlCommonGetOnlineMigration(dbHandle *sql.DB, version, steps int) (OnlineMigration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	migration := OnlineMigration{
+		Version: version,
+		Steps:   steps,
+	}
+	var errorMsg sql.NullString
+	err := dbHandle.QueryRowContext(ctx, getOnlineMigrationQuery(), version).Scan(&migration.Status, &migration.Step,
+		&migration.Steps, &errorMsg, &migration.CreatedAt, &migration.UpdatedAt)
+	if err == nil {
+		migration.Error = errorMsg.String
+		if migration.Steps != steps {
+			return migration, fmt.Errorf("the recorded online migration to version %d has %d steps, expected: %d",
+				version, migration.Steps, steps)
+		}
+		return migration, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return migration, err
+	}
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	migration.Status = OnlineMigrationStatusPending
+	migration.CreatedAt = now
+	migration.UpdatedAt = now
+	_, err = dbHandle.ExecContext(ctx, getAddOnlineMigrationQuery(), version, migration.Status, migration.Step,
+		migration.Steps, migration.CreatedAt, migration.UpdatedAt)
+	return migration, err
+}
+
+func sqlCommonUpdateOnlineMigration(dbHandle *sql.DB, migration *OnlineMigration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	migration.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	_, err := dbHandle.ExecContext(ctx, getUpdateOnlineMigrationQuery(), migration.Status, migration.Step,
+		migration.Error, migration.UpdatedAt, migration.Version)
+	return err
+}
+
+func sqlCommonGetOnlineMigrations(dbHandle *sql.DB) ([]OnlineMigration, error) {
+	migrations := make([]OnlineMigration, 0, 5)
+	if err := sqlCommonCreateOnlineMigrationsTable(dbHandle); err != nil {
+		return migrations, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	rows, err := dbHandle.QueryContext(ctx, getOnlineMigrationsQuery())
+	if err != nil {
+		return migrations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var migration OnlineMigration
+		var errorMsg sql.NullString
+		if err := rows.Scan(&migration.Version, &migration.Status, &migration.Step, &migration.Steps, &errorMsg,
+			&migration.CreatedAt, &migration.UpdatedAt); err != nil {
+			return migrations, err
+		}
+		migration.Error = errorMsg.String
+		migrations = append(migrations, migration)
+	}
+	return migrations, rows.Err()
+}
+
+func sqlCommonPauseOnlineMigration(dbHandle *sql.DB, version int) error {
+	if err := sqlCommonCreateOnlineMigrationsTable(dbHandle); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	res, err := dbHandle.ExecContext(ctx, getPauseOnlineMigrationQuery(), OnlineMigrationStatusPaused,
+		util.GetTimeAsMsSinceEpoch(time.Now()), version, OnlineMigrationStatusRunning)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err == nil && affected == 0 {
+		return util.NewRecordNotFoundError(fmt.Sprintf("no running online migration to version %d", version))
+	}
+	return err
+}
+
+func sqlAcquireOnlineMigrationLock(ctx context.Context, conn *sql.Conn) error {
+	var acquired sql.NullInt64
+	var err error
+
+	switch config.Driver {
+	case PGSQLDataProviderName:
+		var res bool
+		err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(101,2)`).Scan(&res)
+		if res {
+			acquired = sql.NullInt64{Int64: 1, Valid: true}
+		}
+	case MySQLDataProviderName:
+		err = conn.QueryRowContext(ctx, `SELECT GET_LOCK('sftpgo.online_migration',0)`).Scan(&acquired)
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get the online migration lock: %w", err)
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return errors.New("unable to get the online migration lock, is another migration running?")
+	}
+	providerLog(logger.LevelInfo, "acquired online migration lock")
+	return nil
+}
+
+func sqlReleaseOnlineMigrationLock(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	var err error
+	switch config.Driver {
+	case PGSQLDataProviderName:
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_unlock(101,2)`)
+	case MySQLDataProviderName:
+		_, err = conn.ExecContext(ctx, `SELECT RELEASE_LOCK('sftpgo.online_migration')`)
+	default:
+		return
+	}
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to release the online migration lock: %v", err)
+	} else {
+		providerLog(logger.LevelInfo, "released online migration lock")
+	}
+}
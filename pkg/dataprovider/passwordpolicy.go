@@ -0,0 +1,208 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	passwordvalidator "github.com/wagslane/go-password-validator"
+
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Password policy criteria
+const (
+	PasswordCriterionMinLength = "min_length"
+	PasswordCriterionUppercase = "uppercase"
+	PasswordCriterionLowercase = "lowercase"
+	PasswordCriterionDigit     = "digit"
+	PasswordCriterionSpecial   = "special"
+	PasswordCriterionUsername  = "username"
+	PasswordCriterionEntropy   = "entropy"
+	PasswordCriterionPwned     = "pwned"
+)
+
+var (
+	// k-anonymity API, only the first 5 characters of the SHA-1 hash are sent
+	pwnedPasswordsRangeURL = "https://api.pwnedpasswords.com/range/"
+)
+
+// PasswordPolicyViolation defines a password policy criterion not satisfied
+type PasswordPolicyViolation struct {
+	Criterion string `json:"criterion"`
+	Reason    string `json:"reason"`
+}
+
+// PasswordPolicyError is returned if a password does not satisfy the configured
+// policy, it includes all the failed criteria
+type PasswordPolicyError struct {
+	Violations []PasswordPolicyViolation
+}
+
+func (e *PasswordPolicyError) getErrorString() string {
+	reasons := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return fmt.Sprintf("the password does not satisfy the policy: %s", strings.Join(reasons, "; "))
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Unwrap().Error()
+}
+
+// Unwrap returns the validation error for the failed criteria
+func (e *PasswordPolicyError) Unwrap() error {
+	return util.NewValidationError(e.getErrorString())
+}
+
+func (r *PasswordValidationRules) validate() error {
+	if r.MinLength < 0 {
+		return fmt.Errorf("invalid password min length: %d", r.MinLength)
+	}
+	if r.MinEntropy < 0 {
+		return fmt.Errorf("invalid password min entropy: %v", r.MinEntropy)
+	}
+	return nil
+}
+
+func (r *PasswordValidationRules) isEnabled() bool {
+	return r.MinLength > 0 || r.RequireUppercase || r.RequireLowercase || r.RequireDigit || r.RequireSpecial ||
+		r.DisallowUsername || r.MinEntropy > 0 || r.PwnedPasswordCheck
+}
+
+// checkPassword returns a *PasswordPolicyError if the specified password
+// does not satisfy the rules
+func (r *PasswordValidationRules) checkPassword(username, password string) error {
+	if !r.isEnabled() {
+		return nil
+	}
+	violations := r.checkPasswordComposition(password)
+	addViolation := func(criterion, reason string) {
+		violations = append(violations, PasswordPolicyViolation{
+			Criterion: criterion,
+			Reason:    reason,
+		})
+	}
+	if r.DisallowUsername && username != "" && strings.EqualFold(password, username) {
+		addViolation(PasswordCriterionUsername, "the password cannot be equal to the username")
+	}
+	if r.MinEntropy > 0 {
+		if err := passwordvalidator.Validate(password, r.MinEntropy); err != nil {
+			addViolation(PasswordCriterionEntropy, err.Error())
+		}
+	}
+	if r.PwnedPasswordCheck {
+		isPwned, err := isPwnedPassword(password)
+		if err != nil {
+			// we don't want to block password changes if the API is not available
+			providerLog(logger.LevelWarn, "unable to check if the password for %q is pwned: %v", username, err)
+		} else if isPwned {
+			addViolation(PasswordCriterionPwned, "the password was found in a data breach")
+		}
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+// checkPasswordComposition checks the password length and the required character classes
+func (r *PasswordValidationRules) checkPasswordComposition(password string) []PasswordPolicyViolation {
+	var violations []PasswordPolicyViolation
+	addViolation := func(criterion, reason string) {
+		violations = append(violations, PasswordPolicyViolation{
+			Criterion: criterion,
+			Reason:    reason,
+		})
+	}
+
+	if r.MinLength > 0 && len([]rune(password)) < r.MinLength {
+		addViolation(PasswordCriterionMinLength, fmt.Sprintf("at least %d characters are required", r.MinLength))
+	}
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			hasSpecial = true
+		}
+	}
+	if r.RequireUppercase && !hasUpper {
+		addViolation(PasswordCriterionUppercase, "at least an uppercase letter is required")
+	}
+	if r.RequireLowercase && !hasLower {
+		addViolation(PasswordCriterionLowercase, "at least a lowercase letter is required")
+	}
+	if r.RequireDigit && !hasDigit {
+		addViolation(PasswordCriterionDigit, "at least a digit is required")
+	}
+	if r.RequireSpecial && !hasSpecial {
+		addViolation(PasswordCriterionSpecial, "at least a special character is required")
+	}
+	return violations
+}
+
+// isPwnedPassword checks the password using the Have I Been Pwned range API.
+// Only the first 5 characters of the hex encoded SHA-1 are sent
+func isPwnedPassword(password string) (bool, error) {
+	h := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(h[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	resp, err := httpclient.Get(pwnedPasswordsRangeURL + prefix)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 5*1024*1024))
+	for scanner.Scan() {
+		hashSuffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hashSuffix == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func checkUserPassword(user *User, password string) error {
+	err := config.PasswordValidation.Users.checkPassword(user.Username, password)
+	if err != nil && user.skipPasswordPolicy {
+		providerLog(logger.LevelWarn, "the password for user %q does not satisfy the policy, it is accepted anyway: %v",
+			user.Username, err)
+		return nil
+	}
+	return err
+}
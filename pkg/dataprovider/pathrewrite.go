@@ -0,0 +1,145 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported placeholders for the path rewrite replacements
+const (
+	pathRewritePlaceholderUsername = "{username}"
+	pathRewritePlaceholderYear     = "{year}"
+	pathRewritePlaceholderMonth    = "{month}"
+	pathRewritePlaceholderDay      = "{day}"
+)
+
+// PathRewrite defines a rule to transparently redirect the uploads to a
+// different virtual path
+type PathRewrite struct {
+	// Regular expression matched against the upload virtual path, for example
+	// "^/uploads/([^/]+\.csv)$"
+	Pattern string `json:"pattern"`
+	// Replacement for the matched text. Capture groups can be referenced using
+	// $1 or ${name}, the {username}, {year}, {month} and {day} placeholders
+	// are supported, for example "/uploads/{year}/{month}/$1"
+	Replacement string `json:"replacement"`
+	// Protocols to apply the rule to, empty means all protocols
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// GetProtocolsAsString returns the protocols as comma separated string
+func (r *PathRewrite) GetProtocolsAsString() string {
+	return strings.Join(r.Protocols, ",")
+}
+
+func (r *PathRewrite) isProtocolAllowed(protocol string) bool {
+	return len(r.Protocols) == 0 || util.Contains(r.Protocols, protocol)
+}
+
+func (r *PathRewrite) hasCommonProtocols(other *PathRewrite) bool {
+	if len(r.Protocols) == 0 || len(other.Protocols) == 0 {
+		return true
+	}
+	for _, p := range r.Protocols {
+		if util.Contains(other.Protocols, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PathRewrite) getReplacement(username string, now time.Time) string {
+	replacer := strings.NewReplacer(
+		pathRewritePlaceholderUsername, username,
+		pathRewritePlaceholderYear, now.Format("2006"),
+		pathRewritePlaceholderMonth, now.Format("01"),
+		pathRewritePlaceholderDay, now.Format("02"),
+	)
+	return replacer.Replace(r.Replacement)
+}
+
+func validatePathRewriteRules(user *User) error {
+	rules := make([]PathRewrite, 0, len(user.Filters.PathRewriteRules))
+	regexps := make([]*regexp.Regexp, 0, len(user.Filters.PathRewriteRules))
+	for _, rule := range user.Filters.PathRewriteRules {
+		if rule.Pattern == "" || rule.Replacement == "" {
+			return util.NewValidationError("path rewrite pattern and replacement are mandatory")
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return util.NewValidationError(fmt.Sprintf("invalid path rewrite pattern %q: %v", rule.Pattern, err))
+		}
+		rule.Protocols = util.RemoveDuplicates(rule.Protocols, false)
+		for _, p := range rule.Protocols {
+			if !util.Contains(ValidProtocols, p) {
+				return util.NewValidationError(fmt.Sprintf("invalid path rewrite protocol %q", p))
+			}
+		}
+		rules = append(rules, rule)
+		regexps = append(regexps, re)
+	}
+	user.Filters.PathRewriteRules = rules
+	checkPathRewriteConflicts(user.Username, rules, regexps)
+	return nil
+}
+
+// checkPathRewriteConflicts logs a warning for the rules that can never be
+// applied because a previous rule matches the same paths. Only identical
+// patterns and literal patterns are detected
+func checkPathRewriteConflicts(username string, rules []PathRewrite, regexps []*regexp.Regexp) {
+	for idx := range rules {
+		literal, complete := regexps[idx].LiteralPrefix()
+		for prev := 0; prev < idx; prev++ {
+			if !rules[prev].hasCommonProtocols(&rules[idx]) {
+				continue
+			}
+			if rules[prev].Pattern == rules[idx].Pattern || (complete && regexps[prev].MatchString(literal)) {
+				providerLog(logger.LevelWarn, "user %q: path rewrite rule %q conflicts with the previous rule %q, it will never match",
+					username, rules[idx].Pattern, rules[prev].Pattern)
+				break
+			}
+		}
+	}
+}
+
+// RewriteUploadPath applies the first path rewrite rule matching the
+// specified virtual path and protocol. It returns the virtual path to use
+// and true if a rule was applied
+func (u *User) RewriteUploadPath(virtualPath, protocol string) (string, bool) {
+	for idx := range u.Filters.PathRewriteRules {
+		rule := &u.Filters.PathRewriteRules[idx]
+		if !rule.isProtocolAllowed(protocol) {
+			continue
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			providerLog(logger.LevelError, "user %q: invalid path rewrite pattern %q: %v", u.Username, rule.Pattern, err)
+			continue
+		}
+		if !re.MatchString(virtualPath) {
+			continue
+		}
+		rewritten := re.ReplaceAllString(virtualPath, rule.getReplacement(u.Username, time.Now()))
+		return util.CleanPath(rewritten), true
+	}
+	return virtualPath, false
+}
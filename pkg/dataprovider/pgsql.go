@@ -55,7 +55,12 @@ DROP TABLE IF EXISTS "{{events_actions}}" CASCADE;
 DROP TABLE IF EXISTS "{{events_rules}}" CASCADE;
 DROP TABLE IF EXISTS "{{tasks}}" CASCADE;
 DROP TABLE IF EXISTS "{{nodes}}" CASCADE;
+DROP TABLE IF EXISTS "{{known_ips}}" CASCADE;
+DROP TABLE IF EXISTS "{{content_index}}" CASCADE;
+DROP TABLE IF EXISTS "{{upload_sessions}}" CASCADE;
+DROP TABLE IF EXISTS "{{replications}}" CASCADE;
 DROP TABLE IF EXISTS "{{schema_version}}" CASCADE;
+DROP TABLE IF EXISTS "{{schema_migrations}}" CASCADE;
 `
 	pgsqlInitial = `CREATE TABLE "{{schema_version}}" ("id" serial NOT NULL PRIMARY KEY, "version" integer NOT NULL);
 CREATE TABLE "{{admins}}" ("id" serial NOT NULL PRIMARY KEY, "username" varchar(255) NOT NULL UNIQUE,
@@ -202,6 +207,81 @@ DROP TABLE "{{admins_groups_mapping}}" CASCADE;
 	pgsqlV23SQL = `CREATE TABLE "{{nodes}}" ("id" serial NOT NULL PRIMARY KEY, "name" varchar(255) NOT NULL UNIQUE,
 "data" text NOT NULL, "created_at" bigint NOT NULL, "updated_at" bigint NOT NULL);`
 	pgsqlV23DownSQL = `DROP TABLE "{{nodes}}" CASCADE;`
+	pgsqlV24SQL     = `ALTER TABLE "{{api_keys}}" ADD COLUMN "filters" text NULL;`
+	pgsqlV24DownSQL = `ALTER TABLE "{{api_keys}}" DROP COLUMN "filters" CASCADE;`
+	pgsqlV25SQL     = `ALTER TABLE "{{shares}}" ADD COLUMN "display_name" varchar(255) NULL;
+ALTER TABLE "{{shares}}" ADD COLUMN "disposition" varchar(20) NULL;`
+	pgsqlV25DownSQL = `ALTER TABLE "{{shares}}" DROP COLUMN "disposition" CASCADE;
+ALTER TABLE "{{shares}}" DROP COLUMN "display_name" CASCADE;`
+	pgsqlV26SQL = `CREATE TABLE "{{known_ips}}" ("id" bigserial NOT NULL PRIMARY KEY, "user_id" integer NOT NULL,
+"ip" varchar(50) NOT NULL, "first_seen" bigint NOT NULL, "last_seen" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_known_ip" UNIQUE ("user_id", "ip"));
+ALTER TABLE "{{known_ips}}" ADD CONSTRAINT "{{prefix}}known_ips_user_id_fk_users_id"
+FOREIGN KEY ("user_id") REFERENCES "{{users}}" ("id") MATCH SIMPLE ON UPDATE NO ACTION ON DELETE CASCADE;
+CREATE INDEX "{{prefix}}known_ips_user_id_idx" ON "{{known_ips}}" ("user_id");
+CREATE INDEX "{{prefix}}known_ips_last_seen_idx" ON "{{known_ips}}" ("last_seen");
+`
+	pgsqlV26DownSQL = `DROP TABLE "{{known_ips}}" CASCADE;`
+	pgsqlV27SQL     = `ALTER TABLE "{{folders}}" ADD COLUMN "updated_at" bigint DEFAULT 0 NOT NULL;
+ALTER TABLE "{{folders}}" ALTER COLUMN "updated_at" DROP DEFAULT;
+ALTER TABLE "{{events_actions}}" ADD COLUMN "updated_at" bigint DEFAULT 0 NOT NULL;
+ALTER TABLE "{{events_actions}}" ALTER COLUMN "updated_at" DROP DEFAULT;
+CREATE INDEX "{{prefix}}folders_updated_at_idx" ON "{{folders}}" ("updated_at");
+CREATE INDEX "{{prefix}}events_actions_updated_at_idx" ON "{{events_actions}}" ("updated_at");
+`
+	pgsqlV27DownSQL = `ALTER TABLE "{{events_actions}}" DROP COLUMN "updated_at" CASCADE;
+ALTER TABLE "{{folders}}" DROP COLUMN "updated_at" CASCADE;
+`
+	pgsqlV28SQL     = `ALTER TABLE "{{groups}}" ADD COLUMN "parent_group" varchar(255) NULL;`
+	pgsqlV28DownSQL = `ALTER TABLE "{{groups}}" DROP COLUMN "parent_group" CASCADE;`
+	pgsqlV29SQL     = `CREATE TABLE "{{content_index}}" ("id" bigserial NOT NULL PRIMARY KEY,
+"storage_id" varchar(255) NOT NULL, "path" varchar(512) NOT NULL, "parent" varchar(512) NOT NULL,
+"hash" varchar(64) NOT NULL, "size" bigint NOT NULL, "is_dir" integer NOT NULL, "mtime" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_content_path" UNIQUE ("storage_id", "path"));
+CREATE INDEX "{{prefix}}content_index_parent_idx" ON "{{content_index}}" ("storage_id", "parent");
+CREATE INDEX "{{prefix}}content_index_hash_idx" ON "{{content_index}}" ("storage_id", "hash");
+`
+	pgsqlV29DownSQL = `DROP TABLE "{{content_index}}" CASCADE;`
+	pgsqlV30SQL     = `CREATE TABLE "{{upload_sessions}}" ("id" bigserial NOT NULL PRIMARY KEY,
+"upload_id" varchar(255) NOT NULL UNIQUE, "username" varchar(255) NOT NULL, "path" varchar(512) NOT NULL,
+"started_at" bigint NOT NULL, "last_seen_at" bigint NOT NULL, "uploaded_bytes" bigint NOT NULL,
+"total_bytes" bigint NOT NULL, "backend_token" text NOT NULL, "parts" text NULL,
+CONSTRAINT "{{prefix}}unique_upload_session_path" UNIQUE ("username", "path"));
+CREATE INDEX "{{prefix}}upload_sessions_last_seen_at_idx" ON "{{upload_sessions}}" ("last_seen_at");
+`
+	pgsqlV30DownSQL = `DROP TABLE "{{upload_sessions}}" CASCADE;`
+	pgsqlV31SQL     = `ALTER TABLE "{{folders}}" ADD COLUMN "audit_log" text NULL;`
+	pgsqlV31DownSQL = `ALTER TABLE "{{folders}}" DROP COLUMN "audit_log" CASCADE;`
+	pgsqlV32SQL     = `ALTER TABLE "{{users_folders_mapping}}" ADD COLUMN "read_only" integer DEFAULT 0 NOT NULL;
+ALTER TABLE "{{users_folders_mapping}}" ALTER COLUMN "read_only" DROP DEFAULT;
+ALTER TABLE "{{groups_folders_mapping}}" ADD COLUMN "read_only" integer DEFAULT 0 NOT NULL;
+ALTER TABLE "{{groups_folders_mapping}}" ALTER COLUMN "read_only" DROP DEFAULT;
+`
+	pgsqlV32DownSQL = `ALTER TABLE "{{groups_folders_mapping}}" DROP COLUMN "read_only" CASCADE;
+ALTER TABLE "{{users_folders_mapping}}" DROP COLUMN "read_only" CASCADE;
+`
+	pgsqlV33SQL = `ALTER TABLE "{{admins}}" ADD COLUMN "locked" integer DEFAULT 0 NOT NULL;
+ALTER TABLE "{{admins}}" ALTER COLUMN "locked" DROP DEFAULT;
+`
+	pgsqlV33DownSQL = `ALTER TABLE "{{admins}}" DROP COLUMN "locked" CASCADE;`
+	pgsqlV34SQL     = `ALTER TABLE "{{users}}" ADD COLUMN "last_quota_warning" integer DEFAULT 0 NOT NULL;
+ALTER TABLE "{{users}}" ALTER COLUMN "last_quota_warning" DROP DEFAULT;
+`
+	pgsqlV34DownSQL = `ALTER TABLE "{{users}}" DROP COLUMN "last_quota_warning" CASCADE;`
+	pgsqlV35SQL     = `CREATE TABLE "{{replications}}" ("id" bigserial NOT NULL PRIMARY KEY,
+"username" varchar(255) NOT NULL, "path" varchar(512) NOT NULL, "destination_bucket" varchar(255) NOT NULL,
+"status" varchar(20) NOT NULL, "attempts" integer NOT NULL, "last_error" text NULL, "created_at" bigint NOT NULL,
+"updated_at" bigint NOT NULL, "next_retry_at" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_replication_path" UNIQUE ("username", "path"));
+CREATE INDEX "{{prefix}}replications_next_retry_at_idx" ON "{{replications}}" ("next_retry_at");
+`
+	pgsqlV35DownSQL = `DROP TABLE "{{replications}}" CASCADE;`
+	pgsqlV36SQL     = `ALTER TABLE "{{upload_sessions}}" ADD COLUMN "lease_owner" varchar(255) DEFAULT '' NOT NULL;
+ALTER TABLE "{{upload_sessions}}" ADD COLUMN "lease_expires_at" bigint DEFAULT 0 NOT NULL;
+`
+	pgsqlV36DownSQL = `ALTER TABLE "{{upload_sessions}}" DROP COLUMN "lease_expires_at" CASCADE;
+ALTER TABLE "{{upload_sessions}}" DROP COLUMN "lease_owner" CASCADE;
+`
 )
 
 // PGSQLProvider defines the auth provider for PostgreSQL database
@@ -286,6 +366,10 @@ func (p *PGSQLProvider) updateQuota(username string, filesAdd int, sizeAdd int64
 	return sqlCommonUpdateQuota(username, filesAdd, sizeAdd, reset, p.dbHandle)
 }
 
+func (p *PGSQLProvider) reserveQuotaFile(username string, maxUsedFiles int) (bool, error) {
+	return sqlCommonReserveQuotaFile(username, maxUsedFiles, p.dbHandle)
+}
+
 func (p *PGSQLProvider) getUsedQuota(username string) (int, int64, int64, int64, error) {
 	return sqlCommonGetUsedQuota(username, p.dbHandle)
 }
@@ -302,6 +386,10 @@ func (p *PGSQLProvider) updateAdminLastLogin(username string) error {
 	return sqlCommonUpdateAdminLastLogin(username, p.dbHandle)
 }
 
+func (p *PGSQLProvider) setAdminLocked(username string, locked bool) error {
+	return sqlCommonSetAdminLocked(username, locked, p.dbHandle)
+}
+
 func (p *PGSQLProvider) userExists(username string) (User, error) {
 	return sqlCommonGetUserByUsername(username, p.dbHandle)
 }
@@ -330,8 +418,8 @@ func (p *PGSQLProvider) getRecentlyUpdatedUsers(after int64) ([]User, error) {
 	return sqlCommonGetRecentlyUpdatedUsers(after, p.dbHandle)
 }
 
-func (p *PGSQLProvider) getUsers(limit int, offset int, order string) ([]User, error) {
-	return sqlCommonGetUsers(limit, offset, order, p.dbHandle)
+func (p *PGSQLProvider) getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error) {
+	return sqlCommonGetUsers(limit, offset, order, usernamePatterns, p.dbHandle)
 }
 
 func (p *PGSQLProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User, error) {
@@ -384,6 +472,10 @@ func (p *PGSQLProvider) getUsersInGroups(names []string) ([]string, error) {
 	return sqlCommonGetUsersInGroups(names, p.dbHandle)
 }
 
+func (p *PGSQLProvider) getChildGroups(names []string) ([]string, error) {
+	return sqlCommonGetChildGroups(names, p.dbHandle)
+}
+
 func (p *PGSQLProvider) groupExists(name string) (Group, error) {
 	return sqlCommonGetGroupByName(name, p.dbHandle)
 }
@@ -460,6 +552,10 @@ func (p *PGSQLProvider) updateAPIKeyLastUse(keyID string) error {
 	return sqlCommonUpdateAPIKeyLastUse(keyID, p.dbHandle)
 }
 
+func (p *PGSQLProvider) updateAPIKeySecret(keyID, key string) error {
+	return sqlCommonUpdateAPIKeySecret(keyID, key, p.dbHandle)
+}
+
 func (p *PGSQLProvider) shareExists(shareID, username string) (Share, error) {
 	return sqlCommonGetShareByID(shareID, username, p.dbHandle)
 }
@@ -556,6 +652,10 @@ func (p *PGSQLProvider) cleanupSharedSessions(sessionType SessionType, before in
 	return sqlCommonCleanupSessions(sessionType, before, p.dbHandle)
 }
 
+func (p *PGSQLProvider) getSharedSessions(sessionType SessionType, after int64) ([]Session, error) {
+	return sqlCommonGetSessions(sessionType, after, p.dbHandle)
+}
+
 func (p *PGSQLProvider) getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error) {
 	return sqlCommonGetEventActions(limit, offset, order, minimal, p.dbHandle)
 }
@@ -636,10 +736,110 @@ func (p *PGSQLProvider) getNodes() ([]Node, error) {
 	return sqlCommonGetNodes(p.dbHandle)
 }
 
+func (p *PGSQLProvider) getOnlineMigrations() ([]OnlineMigration, error) {
+	return sqlCommonGetOnlineMigrations(p.dbHandle)
+}
+
+func (p *PGSQLProvider) pauseOnlineMigration(version int) error {
+	return sqlCommonPauseOnlineMigration(p.dbHandle, version)
+}
+
 func (p *PGSQLProvider) updateNodeTimestamp() error {
 	return sqlCommonUpdateNodeTimestamp(p.dbHandle)
 }
 
+func (p *PGSQLProvider) updateKnownIP(username, ip string, cutoff int64) (bool, error) {
+	return sqlCommonUpdateKnownIP(username, ip, cutoff, p.dbHandle)
+}
+
+func (p *PGSQLProvider) cleanupKnownIPs(before int64) error {
+	return sqlCommonCleanupKnownIPs(before, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntries(storageID, dirName, recursive, p.dbHandle)
+}
+
+func (p *PGSQLProvider) addContentEntry(entry *vfs.ContentIndexEntry) error {
+	return sqlCommonAddContentEntry(entry, p.dbHandle)
+}
+
+func (p *PGSQLProvider) renameContentEntries(storageID, source, target string) error {
+	return sqlCommonRenameContentEntries(storageID, source, target, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteContentEntry(storageID, name string) error {
+	return sqlCommonDeleteContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getContentHashes(storageID string) ([]string, error) {
+	return sqlCommonGetContentHashes(storageID, p.dbHandle)
+}
+
+func (p *PGSQLProvider) isContentReferenced(storageID, hash string) (bool, error) {
+	return sqlCommonIsContentReferenced(storageID, hash, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	return sqlCommonDeleteContentEntriesByHash(storageID, hash, p.dbHandle)
+}
+
+func (p *PGSQLProvider) addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	return sqlCommonAddUploadSession(session, owner, leaseExpiresAt, p.dbHandle)
+}
+
+func (p *PGSQLProvider) updateUploadSession(session *vfs.UploadSession, owner string) error {
+	return sqlCommonUpdateUploadSession(session, owner, p.dbHandle)
+}
+
+func (p *PGSQLProvider) claimUploadSession(id, owner string, leaseExpiresAt, now int64) error {
+	return sqlCommonClaimUploadSession(id, owner, leaseExpiresAt, now, p.dbHandle)
+}
+
+func (p *PGSQLProvider) releaseUploadSession(id, owner string) error {
+	return sqlCommonReleaseUploadSession(id, owner, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSession(username, virtualPath, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getUploadSessionByID(id string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessionByID(id, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getUploadSessions(username string) ([]vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessions(username, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error) {
+	return sqlCommonGetStaleUploadSessions(lastSeenBefore, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteUploadSession(id string) error {
+	return sqlCommonDeleteUploadSession(id, p.dbHandle)
+}
+
+func (p *PGSQLProvider) setReplicationStatus(status *vfs.ReplicationStatus) error {
+	return sqlCommonSetReplicationStatus(status, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationsToRetry(nextRetryBefore, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteReplicationStatus(username, virtualPath string) error {
+	return sqlCommonDeleteReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
 func (p *PGSQLProvider) cleanupNodes() error {
 	return sqlCommonCleanupNodes(p.dbHandle)
 }
@@ -652,6 +852,10 @@ func (p *PGSQLProvider) setFirstUploadTimestamp(username string) error {
 	return sqlCommonSetFirstUploadTimestamp(username, p.dbHandle)
 }
 
+func (p *PGSQLProvider) updateQuotaWarning(username string, threshold int) (bool, error) {
+	return sqlCommonUpdateQuotaWarning(username, threshold, p.dbHandle)
+}
+
 func (p *PGSQLProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -698,7 +902,33 @@ func (p *PGSQLProvider) migrateDatabase() error { //nolint:dupl
 	case version == 21:
 		return updatePgSQLDatabaseFromV21(p.dbHandle)
 	case version == 22:
-		return updatePgSQLDatabaseFromV21(p.dbHandle)
+		return updatePgSQLDatabaseFromV22(p.dbHandle)
+	case version == 23:
+		return updatePgSQLDatabaseFromV23(p.dbHandle)
+	case version == 24:
+		return updatePgSQLDatabaseFromV24(p.dbHandle)
+	case version == 25:
+		return updatePgSQLDatabaseFromV25(p.dbHandle)
+	case version == 26:
+		return updatePgSQLDatabaseFromV26(p.dbHandle)
+	case version == 27:
+		return updatePgSQLDatabaseFromV27(p.dbHandle)
+	case version == 28:
+		return updatePgSQLDatabaseFromV28(p.dbHandle)
+	case version == 29:
+		return updatePgSQLDatabaseFromV29(p.dbHandle)
+	case version == 30:
+		return updatePgSQLDatabaseFromV30(p.dbHandle)
+	case version == 31:
+		return updatePgSQLDatabaseFromV31(p.dbHandle)
+	case version == 32:
+		return updatePgSQLDatabaseFromV32(p.dbHandle)
+	case version == 33:
+		return updatePgSQLDatabaseFromV33(p.dbHandle)
+	case version == 34:
+		return updatePgSQLDatabaseFromV34(p.dbHandle)
+	case version == 35:
+		return updatePgSQLDatabaseFromV35(p.dbHandle)
 	default:
 		if version > sqlDatabaseVersion {
 			providerLog(logger.LevelError, "database schema version %v is newer than the supported one: %v", version,
@@ -729,6 +959,32 @@ func (p *PGSQLProvider) revertDatabase(targetVersion int) error {
 		return downgradePgSQLDatabaseFromV22(p.dbHandle)
 	case 23:
 		return downgradePgSQLDatabaseFromV23(p.dbHandle)
+	case 24:
+		return downgradePgSQLDatabaseFromV24(p.dbHandle)
+	case 25:
+		return downgradePgSQLDatabaseFromV25(p.dbHandle)
+	case 26:
+		return downgradePgSQLDatabaseFromV26(p.dbHandle)
+	case 27:
+		return downgradePgSQLDatabaseFromV27(p.dbHandle)
+	case 28:
+		return downgradePgSQLDatabaseFromV28(p.dbHandle)
+	case 29:
+		return downgradePgSQLDatabaseFromV29(p.dbHandle)
+	case 30:
+		return downgradePgSQLDatabaseFromV30(p.dbHandle)
+	case 31:
+		return downgradePgSQLDatabaseFromV31(p.dbHandle)
+	case 32:
+		return downgradePgSQLDatabaseFromV32(p.dbHandle)
+	case 33:
+		return downgradePgSQLDatabaseFromV33(p.dbHandle)
+	case 34:
+		return downgradePgSQLDatabaseFromV34(p.dbHandle)
+	case 35:
+		return downgradePgSQLDatabaseFromV35(p.dbHandle)
+	case 36:
+		return downgradePgSQLDatabaseFromV36(p.dbHandle)
 	default:
 		return fmt.Errorf("database schema version not handled: %v", dbVersion.Version)
 	}
@@ -761,7 +1017,98 @@ func updatePgSQLDatabaseFromV21(dbHandle *sql.DB) error {
 }
 
 func updatePgSQLDatabaseFromV22(dbHandle *sql.DB) error {
-	return updatePgSQLDatabaseFrom22To23(dbHandle)
+	if err := updatePgSQLDatabaseFrom22To23(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV23(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV23(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom23To24(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV24(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom24To25(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV25(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom25To26(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV26(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom26To27(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV27(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom27To28(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV28(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom28To29(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV29(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom29To30(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV30(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom30To31(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV31(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom31To32(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV32(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom32To33(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV33(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom33To34(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV34(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := updatePgSQLDatabaseFrom34To35(dbHandle); err != nil {
+		return err
+	}
+	return updatePgSQLDatabaseFromV35(dbHandle)
+}
+
+func updatePgSQLDatabaseFromV35(dbHandle *sql.DB) error {
+	return updatePgSQLDatabaseFrom35To36(dbHandle)
 }
 
 func downgradePgSQLDatabaseFromV20(dbHandle *sql.DB) error {
@@ -789,6 +1136,97 @@ func downgradePgSQLDatabaseFromV23(dbHandle *sql.DB) error {
 	return downgradePgSQLDatabaseFromV22(dbHandle)
 }
 
+func downgradePgSQLDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom24To23(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV23(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom25To24(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV24(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom26To25(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV25(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom27To26(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV26(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom28To27(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV27(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom29To28(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV28(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom30To29(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV29(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom31To30(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV30(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom32To31(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV31(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom33To32(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV32(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom34To33(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV33(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV35(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom35To34(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV34(dbHandle)
+}
+
+func downgradePgSQLDatabaseFromV36(dbHandle *sql.DB) error {
+	if err := downgradePgSQLDatabaseFrom36To35(dbHandle); err != nil {
+		return err
+	}
+	return downgradePgSQLDatabaseFromV35(dbHandle)
+}
+
 func updatePgSQLDatabaseFrom19To20(dbHandle *sql.DB) error {
 	logger.InfoToConsole("updating database schema version: 19 -> 20")
 	providerLog(logger.LevelInfo, "updating database schema version: 19 -> 20")
@@ -814,7 +1252,7 @@ func updatePgSQLDatabaseFrom20To21(dbHandle *sql.DB) error {
 		sql = strings.ReplaceAll(sql, `ALTER TABLE "{{users}}" ALTER COLUMN "first_upload" DROP DEFAULT;`, "")
 	}
 	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
-	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 21, true)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 21)
 }
 
 func updatePgSQLDatabaseFrom21To22(dbHandle *sql.DB) error {
@@ -834,6 +1272,109 @@ func updatePgSQLDatabaseFrom22To23(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 23, true)
 }
 
+func updatePgSQLDatabaseFrom23To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 23 -> 24")
+	providerLog(logger.LevelInfo, "updating database schema version: 23 -> 24")
+	sql := strings.ReplaceAll(pgsqlV24SQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 24)
+}
+
+func updatePgSQLDatabaseFrom24To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 24 -> 25")
+	providerLog(logger.LevelInfo, "updating database schema version: 24 -> 25")
+	sql := strings.ReplaceAll(pgsqlV25SQL, "{{shares}}", sqlTableShares)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 25)
+}
+
+func updatePgSQLDatabaseFrom25To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 25 -> 26")
+	providerLog(logger.LevelInfo, "updating database schema version: 25 -> 26")
+	sql := strings.ReplaceAll(pgsqlV26SQL, "{{known_ips}}", sqlTableKnownIPs)
+	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 26, true)
+}
+
+func updatePgSQLDatabaseFrom26To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 26 -> 27")
+	providerLog(logger.LevelInfo, "updating database schema version: 26 -> 27")
+	sql := strings.ReplaceAll(pgsqlV27SQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 27)
+}
+
+func updatePgSQLDatabaseFrom27To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 27 -> 28")
+	providerLog(logger.LevelInfo, "updating database schema version: 27 -> 28")
+	sql := strings.ReplaceAll(pgsqlV28SQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 28)
+}
+
+func updatePgSQLDatabaseFrom28To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 28 -> 29")
+	providerLog(logger.LevelInfo, "updating database schema version: 28 -> 29")
+	sql := strings.ReplaceAll(pgsqlV29SQL, "{{content_index}}", sqlTableContentIndex)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 29, true)
+}
+
+func updatePgSQLDatabaseFrom29To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 29 -> 30")
+	providerLog(logger.LevelInfo, "updating database schema version: 29 -> 30")
+	sql := strings.ReplaceAll(pgsqlV30SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 30, true)
+}
+
+func updatePgSQLDatabaseFrom30To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 30 -> 31")
+	providerLog(logger.LevelInfo, "updating database schema version: 30 -> 31")
+	sql := strings.ReplaceAll(pgsqlV31SQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 31)
+}
+
+func updatePgSQLDatabaseFrom31To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 31 -> 32")
+	providerLog(logger.LevelInfo, "updating database schema version: 31 -> 32")
+	sql := strings.ReplaceAll(pgsqlV32SQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 32)
+}
+
+func updatePgSQLDatabaseFrom32To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 32 -> 33")
+	providerLog(logger.LevelInfo, "updating database schema version: 32 -> 33")
+	sql := strings.ReplaceAll(pgsqlV33SQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 33)
+}
+
+func updatePgSQLDatabaseFrom33To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 33 -> 34")
+	providerLog(logger.LevelInfo, "updating database schema version: 33 -> 34")
+	sql := pgsqlV34SQL
+	if config.Driver == CockroachDataProviderName {
+		sql = strings.ReplaceAll(sql, `ALTER TABLE "{{users}}" ALTER COLUMN "last_quota_warning" DROP DEFAULT;`, "")
+	}
+	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
+	return sqlCommonUpdateDatabaseVersionOnline(dbHandle, []string{sql}, 34)
+}
+
+func updatePgSQLDatabaseFrom34To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 34 -> 35")
+	providerLog(logger.LevelInfo, "updating database schema version: 34 -> 35")
+	sql := strings.ReplaceAll(pgsqlV35SQL, "{{replications}}", sqlTableReplications)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 35, true)
+}
+
+func updatePgSQLDatabaseFrom35To36(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 35 -> 36")
+	providerLog(logger.LevelInfo, "updating database schema version: 35 -> 36")
+	sql := strings.ReplaceAll(pgsqlV36SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 36, true)
+}
+
 func downgradePgSQLDatabaseFrom20To19(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database schema version: 20 -> 19")
 	providerLog(logger.LevelInfo, "downgrading database schema version: 20 -> 19")
@@ -871,3 +1412,97 @@ func downgradePgSQLDatabaseFrom23To22(dbHandle *sql.DB) error {
 	sql := strings.ReplaceAll(pgsqlV23DownSQL, "{{nodes}}", sqlTableNodes)
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 22, false)
 }
+
+func downgradePgSQLDatabaseFrom24To23(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 24 -> 23")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 24 -> 23")
+	sql := strings.ReplaceAll(pgsqlV24DownSQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 23, false)
+}
+
+func downgradePgSQLDatabaseFrom25To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 25 -> 24")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 25 -> 24")
+	sql := strings.ReplaceAll(pgsqlV25DownSQL, "{{shares}}", sqlTableShares)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 24, false)
+}
+
+func downgradePgSQLDatabaseFrom26To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 26 -> 25")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 26 -> 25")
+	sql := strings.ReplaceAll(pgsqlV26DownSQL, "{{known_ips}}", sqlTableKnownIPs)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 25, false)
+}
+
+func downgradePgSQLDatabaseFrom27To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 27 -> 26")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 27 -> 26")
+	sql := strings.ReplaceAll(pgsqlV27DownSQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 26, false)
+}
+
+func downgradePgSQLDatabaseFrom28To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 28 -> 27")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 28 -> 27")
+	sql := strings.ReplaceAll(pgsqlV28DownSQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 27, false)
+}
+
+func downgradePgSQLDatabaseFrom29To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 29 -> 28")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 29 -> 28")
+	sql := strings.ReplaceAll(pgsqlV29DownSQL, "{{content_index}}", sqlTableContentIndex)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 28, false)
+}
+
+func downgradePgSQLDatabaseFrom30To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 30 -> 29")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 30 -> 29")
+	sql := strings.ReplaceAll(pgsqlV30DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 29, false)
+}
+
+func downgradePgSQLDatabaseFrom31To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 31 -> 30")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 31 -> 30")
+	sql := strings.ReplaceAll(pgsqlV31DownSQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 30, false)
+}
+
+func downgradePgSQLDatabaseFrom32To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 32 -> 31")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 32 -> 31")
+	sql := strings.ReplaceAll(pgsqlV32DownSQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 31, false)
+}
+
+func downgradePgSQLDatabaseFrom33To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 33 -> 32")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 33 -> 32")
+	sql := strings.ReplaceAll(pgsqlV33DownSQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 32, false)
+}
+
+func downgradePgSQLDatabaseFrom34To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 34 -> 33")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 34 -> 33")
+	sql := strings.ReplaceAll(pgsqlV34DownSQL, "{{users}}", sqlTableUsers)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 33, false)
+}
+
+func downgradePgSQLDatabaseFrom35To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 35 -> 34")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 35 -> 34")
+	sql := strings.ReplaceAll(pgsqlV35DownSQL, "{{replications}}", sqlTableReplications)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 34, false)
+}
+
+func downgradePgSQLDatabaseFrom36To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 36 -> 35")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 36 -> 35")
+	sql := strings.ReplaceAll(pgsqlV36DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 35, false)
+}
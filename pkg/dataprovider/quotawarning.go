@@ -0,0 +1,168 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// QuotaWarningsConfig defines the configuration for the quota warning emails
+type QuotaWarningsConfig struct {
+	// Email addresses, for example the admins ones, to add in BCC to the quota warnings
+	BCC []string `json:"bcc" mapstructure:"bcc"`
+	// URL included in the quota warnings so users can manage their files,
+	// for example the WebClient URL
+	WebClientURL string `json:"web_client_url" mapstructure:"web_client_url"`
+}
+
+func (c *QuotaWarningsConfig) validate() error {
+	for _, email := range c.BCC {
+		if !util.IsEmailValid(email) {
+			return fmt.Errorf("invalid quota warnings BCC email address %q", email)
+		}
+	}
+	if c.WebClientURL != "" && !strings.HasPrefix(c.WebClientURL, "http") {
+		return fmt.Errorf("invalid quota warnings WebClient URL: %q", c.WebClientURL)
+	}
+	return nil
+}
+
+type quotaWarningData struct {
+	Username   string
+	Threshold  int
+	Percentage int
+	UsedSize   string
+	QuotaSize  string
+	UsedFiles  int
+	QuotaFiles int
+	URL        string
+}
+
+func validateQuotaWarningThresholds(user *User) error {
+	thresholds := make([]int, 0, len(user.Filters.QuotaWarningThresholds))
+	for _, threshold := range user.Filters.QuotaWarningThresholds {
+		if threshold < 1 || threshold > 100 {
+			return util.NewValidationError(fmt.Sprintf("invalid quota warning threshold %d, it must be between 1 and 100",
+				threshold))
+		}
+		if !util.Contains(thresholds, threshold) {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.Ints(thresholds)
+	user.Filters.QuotaWarningThresholds = thresholds
+	return nil
+}
+
+// QuotaWarningEmailSent returns true if the warning for the specified threshold
+// was already sent and the quota usage did not go below the threshold since then
+func (u *User) QuotaWarningEmailSent(threshold int) bool {
+	return threshold > 0 && threshold <= u.LastQuotaWarning
+}
+
+// getQuotaUsagePercentage returns the highest usage percentage between
+// the size and the files quota
+func (u *User) getQuotaUsagePercentage(usedFiles int, usedSize int64) int {
+	percentage := 0
+	if u.QuotaSize > 0 {
+		percentage = int(usedSize * 100 / u.QuotaSize)
+	}
+	if u.QuotaFiles > 0 {
+		if p := usedFiles * 100 / u.QuotaFiles; p > percentage {
+			percentage = p
+		}
+	}
+	return percentage
+}
+
+// getCrossedQuotaWarningThreshold returns the highest threshold crossed
+// for the specified usage percentage, 0 if none
+func (u *User) getCrossedQuotaWarningThreshold(percentage int) int {
+	crossed := 0
+	for _, threshold := range u.Filters.QuotaWarningThresholds {
+		if percentage >= threshold && threshold > crossed {
+			crossed = threshold
+		}
+	}
+	return crossed
+}
+
+// checkQuotaWarning checks, in background, the quota usage for the specified
+// user and sends a warning email if a new threshold was crossed. The last
+// notified threshold is lowered, without notifications, if the usage decreases
+// so the warning will be sent again the next time the threshold is crossed
+func checkQuotaWarning(user *User) {
+	if len(user.Filters.QuotaWarningThresholds) == 0 || !user.HasQuotaRestrictions() {
+		return
+	}
+	if user.Email == "" || !smtp.IsEnabled() {
+		return
+	}
+	u := user.getACopy()
+
+	go func() {
+		usedFiles, usedSize, _, _, err := GetUsedQuota(u.Username)
+		if err != nil {
+			providerLog(logger.LevelError, "unable to get the used quota for user %q: %v", u.Username, err)
+			return
+		}
+		percentage := u.getQuotaUsagePercentage(usedFiles, usedSize)
+		threshold := u.getCrossedQuotaWarningThreshold(percentage)
+		notify, err := provider.updateQuotaWarning(u.Username, threshold)
+		if err != nil {
+			providerLog(logger.LevelError, "unable to update the quota warning threshold for user %q: %v",
+				u.Username, err)
+			return
+		}
+		if !notify {
+			return
+		}
+		if err := sendQuotaWarning(&u, threshold, percentage, usedFiles, usedSize); err != nil {
+			providerLog(logger.LevelError, "unable to send quota warning to user %q: %v", u.Username, err)
+			return
+		}
+		providerLog(logger.LevelDebug, "quota warning sent to user %q, threshold: %d%%, usage: %d%%",
+			u.Username, threshold, percentage)
+	}()
+}
+
+func sendQuotaWarning(user *User, threshold, percentage, usedFiles int, usedSize int64) error {
+	data := quotaWarningData{
+		Username:   user.Username,
+		Threshold:  threshold,
+		Percentage: percentage,
+		UsedSize:   util.ByteCountIEC(usedSize),
+		UsedFiles:  usedFiles,
+		QuotaFiles: user.QuotaFiles,
+		URL:        config.QuotaWarnings.WebClientURL,
+	}
+	if user.QuotaSize > 0 {
+		data.QuotaSize = util.ByteCountIEC(user.QuotaSize)
+	}
+	body := new(bytes.Buffer)
+	if err := smtp.RenderQuotaWarningTemplate(body, data); err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("SFTPGo - Your account is using %d%% of its quota", percentage)
+	return smtp.SendEmailWithBCC([]string{user.Email}, config.QuotaWarnings.BCC, subject, body.String(),
+		smtp.EmailContentTypeTextHTML)
+}
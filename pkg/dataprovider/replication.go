@@ -0,0 +1,125 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+var isRetryingReplications atomic.Bool
+
+// replicationStore implements vfs.ReplicationStore using the configured data provider
+type replicationStore struct{}
+
+func (*replicationStore) SetReplicationStatus(status *vfs.ReplicationStatus) error {
+	return provider.setReplicationStatus(status)
+}
+
+func (*replicationStore) GetReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	status, err := provider.getReplicationStatus(username, virtualPath)
+	return status, convertNotFoundError(err)
+}
+
+func (*replicationStore) DeleteReplicationStatus(username, virtualPath string) error {
+	return convertNotFoundError(provider.deleteReplicationStatus(username, virtualPath))
+}
+
+// getReplicationStatusKey returns the key for the replication statuses inside
+// the bolt and memory providers. The virtual path is absolute and the username
+// cannot contain a slash, so the key is unique
+func getReplicationStatusKey(username, virtualPath string) string {
+	return username + virtualPath
+}
+
+// GetReplicationStatus returns the replication status for the specified user and virtual path
+func GetReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	username = config.convertName(username)
+	return provider.getReplicationStatus(username, util.CleanPath(virtualPath))
+}
+
+// retryReplication replicates again the object for the specified status.
+// The statuses for users that no longer exist, or no longer replicate the
+// object, are removed
+func retryReplication(status *vfs.ReplicationStatus) error {
+	user, err := GetUserWithGroupSettings(status.Username)
+	if err != nil {
+		if errors.Is(err, util.ErrNotFound) {
+			providerLog(logger.LevelDebug, "removing replication status for path %q, missing user %q", status.Path,
+				status.Username)
+			return provider.deleteReplicationStatus(status.Username, status.Path)
+		}
+		return err
+	}
+	defer user.CloseFs() //nolint:errcheck
+
+	fs, err := user.GetFilesystemForPath(status.Path, fmt.Sprintf("replication_%s", xid.New().String()))
+	if err != nil {
+		return err
+	}
+	replicator, ok := fs.(vfs.FsReplicator)
+	if !ok {
+		providerLog(logger.LevelWarn, "removing replication status, replication is not supported for path %q, user %q",
+			status.Path, status.Username)
+		return provider.deleteReplicationStatus(status.Username, status.Path)
+	}
+	fsPath, err := fs.ResolvePath(status.Path)
+	if err != nil {
+		return err
+	}
+	err = replicator.ReplicateObject(fsPath)
+	if errors.Is(err, vfs.ErrVfsUnsupported) {
+		providerLog(logger.LevelWarn, "removing replication status, replication is disabled for path %q, user %q",
+			status.Path, status.Username)
+		return provider.deleteReplicationStatus(status.Username, status.Path)
+	}
+	return err
+}
+
+// retryReplications retries the failed, or interrupted, replications whose
+// next attempt is due. The attempts are scheduled using an exponential backoff
+func retryReplications() {
+	if !isRetryingReplications.CompareAndSwap(false, true) {
+		providerLog(logger.LevelDebug, "replications retry already in progress")
+		return
+	}
+	defer isRetryingReplications.Store(false)
+
+	statuses, err := provider.getReplicationsToRetry(util.GetTimeAsMsSinceEpoch(time.Now()))
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get the replications to retry: %v", err)
+		return
+	}
+	for idx := range statuses {
+		status := &statuses[idx]
+		if vfs.IsReplicationActive(status.Username, status.Path) {
+			continue
+		}
+		if err := retryReplication(status); err != nil {
+			providerLog(logger.LevelError, "unable to retry replication for user %q path %q, attempts: %d: %v",
+				status.Username, status.Path, status.Attempts, err)
+		} else {
+			providerLog(logger.LevelInfo, "replication retried for user %q path %q", status.Username, status.Path)
+		}
+	}
+}
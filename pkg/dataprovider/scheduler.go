@@ -57,6 +57,28 @@ func startScheduler() error {
 	if fnReloadRules != nil {
 		fnReloadRules()
 	}
+	_, err = scheduler.AddFunc("@every 12h", cleanupKnownIPs)
+	if err != nil {
+		return fmt.Errorf("unable to schedule known IP addresses cleanup: %w", err)
+	}
+	_, err = scheduler.AddFunc("@every 12h", reconcileContentIndex)
+	if err != nil {
+		return fmt.Errorf("unable to schedule content index reconciliation: %w", err)
+	}
+	_, err = scheduler.AddFunc("@every 1h", cleanupUploadSessions)
+	if err != nil {
+		return fmt.Errorf("unable to schedule upload sessions cleanup: %w", err)
+	}
+	_, err = scheduler.AddFunc("@every 5m", retryReplications)
+	if err != nil {
+		return fmt.Errorf("unable to schedule replications retry: %w", err)
+	}
+	if config.Admins.isInactivityLockEnabled() {
+		_, err = scheduler.AddFunc("@daily", lockInactiveAdmins)
+		if err != nil {
+			return fmt.Errorf("unable to schedule admins inactivity check: %w", err)
+		}
+	}
 	if currentNode != nil {
 		_, err = scheduler.AddFunc("@every 30m", func() {
 			err := provider.cleanupNodes()
@@ -65,11 +87,19 @@ func startScheduler() error {
 			} else {
 				providerLog(logger.LevelDebug, "cleanup nodes ok")
 			}
+			if err := cleanupNodeEvents(); err != nil {
+				providerLog(logger.LevelError, "unable to cleanup node events: %v", err)
+			}
 		})
 	}
 	if err != nil {
 		return fmt.Errorf("unable to schedule nodes cleanup: %w", err)
 	}
+	if currentNode != nil {
+		if err := addScheduledNodeEventsCheck(); err != nil {
+			return err
+		}
+	}
 	scheduler.Start()
 	return nil
 }
@@ -121,6 +151,7 @@ func checkCacheUpdates() {
 			webDAVUsersCache.swap(&user)
 		}
 		cachedPasswords.Remove(user.Username)
+		notifyUserChanged(user.ID)
 	}
 
 	lastUserCacheUpdate.Store(checkTime)
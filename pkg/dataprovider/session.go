@@ -17,6 +17,9 @@ package dataprovider
 import (
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
 // SessionType defines the supported session types
@@ -27,6 +30,9 @@ const (
 	SessionTypeOIDCAuth SessionType = iota + 1
 	SessionTypeOIDCToken
 	SessionTypeResetCode
+	SessionTypeOneTimeToken
+	SessionTypeNodeEvent
+	SessionTypeUserSession
 )
 
 // Session defines a shared session persisted in the data provider
@@ -41,8 +47,32 @@ func (s *Session) validate() error {
 	if s.Key == "" {
 		return errors.New("unable to save a session with an empty key")
 	}
-	if s.Type < SessionTypeOIDCAuth || s.Type > SessionTypeResetCode {
+	if s.Type < SessionTypeOIDCAuth || s.Type > SessionTypeUserSession {
 		return fmt.Errorf("invalid session type: %v", s.Type)
 	}
 	return nil
 }
+
+// UserSession defines an active session for a token issued by the
+// user token API
+type UserSession struct {
+	// Unique session identifier, it is included in the JWT
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// IP address that requested the token
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// Hash of the client headers that identify the device
+	DeviceFingerprint string `json:"device_fingerprint"`
+	// creation time as unix timestamp in milliseconds
+	CreatedAt int64 `json:"created_at"`
+	// last use time as unix timestamp in milliseconds
+	LastUsedAt int64 `json:"last_used_at"`
+	// expiration time as unix timestamp in milliseconds
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// IsExpired returns true if the session is expired
+func (s *UserSession) IsExpired() bool {
+	return s.ExpiresAt < util.GetTimeAsMsSinceEpoch(time.Now())
+}
@@ -20,6 +20,7 @@ import (
 	"net"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/alexedwards/argon2id"
 	"golang.org/x/crypto/bcrypt"
@@ -38,10 +39,18 @@ const (
 	ShareScopeReadWrite
 )
 
+// Supported content dispositions for files downloaded from a share
+const (
+	ShareDispositionAttachment = "attachment"
+	ShareDispositionInline     = "inline"
+)
+
 const (
 	redactedPassword = "[**redacted**]"
 )
 
+var validShareDispositions = []string{ShareDispositionAttachment, ShareDispositionInline}
+
 // Share defines files and or directories shared with external users
 type Share struct {
 	// Database unique identifier
@@ -69,6 +78,11 @@ type Share struct {
 	UsedTokens int `json:"used_tokens,omitempty"`
 	// Limit the share availability to these IPs/CIDR networks
 	AllowFrom []string `json:"allow_from,omitempty"`
+	// Optional file name to use for downloads instead of the name of the shared file
+	DisplayName string `json:"display_name,omitempty"`
+	// Content disposition for downloaded files, "attachment" or "inline".
+	// Empty means "attachment"
+	Disposition string `json:"disposition,omitempty"`
 	// set for restores, we don't have to validate the expiration date
 	// otherwise we fail to restore existing shares and we have to insert
 	// all the previous values with no modifications
@@ -146,6 +160,8 @@ func (s *Share) getACopy() Share {
 		MaxTokens:   s.MaxTokens,
 		UsedTokens:  s.UsedTokens,
 		AllowFrom:   allowFrom,
+		DisplayName: s.DisplayName,
+		Disposition: s.Disposition,
 	}
 }
 
@@ -269,6 +285,20 @@ func (s *Share) validate() error {
 			return util.NewValidationError(fmt.Sprintf("could not parse allow from entry %#v : %v", IPMask, err))
 		}
 	}
+	return s.validateDownloadOptions()
+}
+
+func (s *Share) validateDownloadOptions() error {
+	s.DisplayName = strings.TrimSpace(s.DisplayName)
+	if len(s.DisplayName) > 255 {
+		return util.NewValidationError("display name must not exceed 255 characters")
+	}
+	if strings.ContainsAny(s.DisplayName, "/\\\"") || strings.IndexFunc(s.DisplayName, unicode.IsControl) >= 0 {
+		return util.NewValidationError(fmt.Sprintf("invalid display name %q", s.DisplayName))
+	}
+	if s.Disposition != "" && !util.Contains(validShareDispositions, s.Disposition) {
+		return util.NewValidationError(fmt.Sprintf("invalid disposition %q", s.Disposition))
+	}
 	return nil
 }
 
@@ -34,7 +34,7 @@ import (
 )
 
 const (
-	sqlDatabaseVersion     = 23
+	sqlDatabaseVersion     = 36
 	defaultSQLQueryTimeout = 10 * time.Second
 	longSQLQueryTimeout    = 60 * time.Second
 )
@@ -59,6 +59,7 @@ type sqlScanner interface {
 
 func sqlReplaceAll(sql string) string {
 	sql = strings.ReplaceAll(sql, "{{schema_version}}", sqlTableSchemaVersion)
+	sql = strings.ReplaceAll(sql, "{{schema_migrations}}", sqlTableOnlineMigrations)
 	sql = strings.ReplaceAll(sql, "{{admins}}", sqlTableAdmins)
 	sql = strings.ReplaceAll(sql, "{{folders}}", sqlTableFolders)
 	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
@@ -78,6 +79,10 @@ func sqlReplaceAll(sql string) string {
 	sql = strings.ReplaceAll(sql, "{{rules_actions_mapping}}", sqlTableRulesActionsMapping)
 	sql = strings.ReplaceAll(sql, "{{tasks}}", sqlTableTasks)
 	sql = strings.ReplaceAll(sql, "{{nodes}}", sqlTableNodes)
+	sql = strings.ReplaceAll(sql, "{{known_ips}}", sqlTableKnownIPs)
+	sql = strings.ReplaceAll(sql, "{{content_index}}", sqlTableContentIndex)
+	sql = strings.ReplaceAll(sql, "{{upload_sessions}}", sqlTableUploadSessions)
+	sql = strings.ReplaceAll(sql, "{{replications}}", sqlTableReplications)
 	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
 	return sql
 }
@@ -142,7 +147,7 @@ func sqlCommonAddShare(share *Share, dbHandle *sql.DB) error {
 	}
 	_, err = dbHandle.ExecContext(ctx, q, share.ShareID, share.Name, share.Description, share.Scope,
 		string(paths), createdAt, updatedAt, lastUseAt, share.ExpiresAt, share.Password,
-		share.MaxTokens, usedTokens, allowFrom, user.ID)
+		share.MaxTokens, usedTokens, allowFrom, user.ID, share.DisplayName, share.Disposition)
 	return err
 }
 
@@ -189,11 +194,11 @@ func sqlCommonUpdateShare(share *Share, dbHandle *sql.DB) error {
 		}
 		_, err = dbHandle.ExecContext(ctx, q, share.Name, share.Description, share.Scope, string(paths),
 			share.CreatedAt, share.UpdatedAt, share.LastUseAt, share.ExpiresAt, share.Password, share.MaxTokens,
-			share.UsedTokens, allowFrom, user.ID, share.ShareID)
+			share.UsedTokens, allowFrom, user.ID, share.DisplayName, share.Disposition, share.ShareID)
 	} else {
 		_, err = dbHandle.ExecContext(ctx, q, share.Name, share.Description, share.Scope, string(paths),
 			util.GetTimeAsMsSinceEpoch(time.Now()), share.ExpiresAt, share.Password, share.MaxTokens,
-			allowFrom, user.ID, share.ShareID)
+			allowFrom, user.ID, share.DisplayName, share.Disposition, share.ShareID)
 	}
 	return err
 }
@@ -281,6 +286,10 @@ func sqlCommonAddAPIKey(apiKey *APIKey, dbHandle *sql.DB) error {
 	if err != nil {
 		return err
 	}
+	filters, err := json.Marshal(apiKey.Filters)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -288,7 +297,7 @@ func sqlCommonAddAPIKey(apiKey *APIKey, dbHandle *sql.DB) error {
 	q := getAddAPIKeyQuery()
 	_, err = dbHandle.ExecContext(ctx, q, apiKey.KeyID, apiKey.Name, apiKey.Key, apiKey.Scope,
 		util.GetTimeAsMsSinceEpoch(time.Now()), util.GetTimeAsMsSinceEpoch(time.Now()), apiKey.LastUseAt,
-		apiKey.ExpiresAt, apiKey.Description, userID, adminID)
+		apiKey.ExpiresAt, apiKey.Description, userID, adminID, string(filters))
 	return err
 }
 
@@ -302,13 +311,17 @@ func sqlCommonUpdateAPIKey(apiKey *APIKey, dbHandle *sql.DB) error {
 	if err != nil {
 		return err
 	}
+	filters, err := json.Marshal(apiKey.Filters)
+	if err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
 
 	q := getUpdateAPIKeyQuery()
 	_, err = dbHandle.ExecContext(ctx, q, apiKey.Name, apiKey.Scope, apiKey.ExpiresAt, userID, adminID,
-		apiKey.Description, util.GetTimeAsMsSinceEpoch(time.Now()), apiKey.KeyID)
+		apiKey.Description, util.GetTimeAsMsSinceEpoch(time.Now()), string(filters), apiKey.KeyID)
 	return err
 }
 
@@ -617,6 +630,37 @@ func sqlCommonGetUsersInGroups(names []string, dbHandle sqlQuerier) ([]string, e
 	return usernames, rows.Err()
 }
 
+func sqlCommonGetChildGroups(names []string, dbHandle sqlQuerier) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getChildGroupsQuery(len(names))
+	args := make([]any, 0, len(names))
+	for _, name := range names {
+		args = append(args, name)
+	}
+
+	var groupNames []string
+	rows, err := dbHandle.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return groupNames, err
+		}
+		groupNames = append(groupNames, name)
+	}
+	return groupNames, rows.Err()
+}
+
 func sqlCommonGetGroupsWithNames(names []string, dbHandle sqlQuerier) ([]Group, error) {
 	if len(names) == 0 {
 		return nil, nil
@@ -714,7 +758,7 @@ func sqlCommonAddGroup(group *Group, dbHandle *sql.DB) error {
 	return sqlCommonExecuteTx(ctx, dbHandle, func(tx *sql.Tx) error {
 		q := getAddGroupQuery()
 		_, err := tx.ExecContext(ctx, q, group.Name, group.Description, util.GetTimeAsMsSinceEpoch(time.Now()),
-			util.GetTimeAsMsSinceEpoch(time.Now()), string(settings))
+			util.GetTimeAsMsSinceEpoch(time.Now()), string(settings), group.ParentGroup)
 		if err != nil {
 			return err
 		}
@@ -736,7 +780,8 @@ func sqlCommonUpdateGroup(group *Group, dbHandle *sql.DB) error {
 
 	return sqlCommonExecuteTx(ctx, dbHandle, func(tx *sql.Tx) error {
 		q := getUpdateGroupQuery()
-		_, err := tx.ExecContext(ctx, q, group.Description, settings, util.GetTimeAsMsSinceEpoch(time.Now()), group.Name)
+		_, err := tx.ExecContext(ctx, q, group.Description, settings, util.GetTimeAsMsSinceEpoch(time.Now()),
+			group.ParentGroup, group.Name)
 		if err != nil {
 			return err
 		}
@@ -853,6 +898,25 @@ func sqlCommonUpdateQuota(username string, filesAdd int, sizeAdd int64, reset bo
 	return err
 }
 
+func sqlCommonReserveQuotaFile(username string, maxUsedFiles int, dbHandle *sql.DB) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getReserveQuotaFileQuery()
+	res, err := dbHandle.ExecContext(ctx, q, util.GetTimeAsMsSinceEpoch(time.Now()), username, maxUsedFiles)
+	if err != nil {
+		providerLog(logger.LevelError, "error reserving quota file for user %q: %v", username, err)
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	providerLog(logger.LevelDebug, "quota file reservation for user %q, max used files: %d, reserved? %t",
+		username, maxUsedFiles, affected > 0)
+	return affected > 0, nil
+}
+
 func sqlCommonGetUsedQuota(username string, dbHandle *sql.DB) (int, int64, int64, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -896,6 +960,18 @@ func sqlCommonUpdateAPIKeyLastUse(keyID string, dbHandle *sql.DB) error {
 	return err
 }
 
+func sqlCommonUpdateAPIKeySecret(keyID, key string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getUpdateAPIKeySecretQuery()
+	res, err := dbHandle.ExecContext(ctx, q, key, util.GetTimeAsMsSinceEpoch(time.Now()), keyID)
+	if err != nil {
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
 func sqlCommonUpdateAdminLastLogin(username string, dbHandle *sql.DB) error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -910,6 +986,23 @@ func sqlCommonUpdateAdminLastLogin(username string, dbHandle *sql.DB) error {
 	return err
 }
 
+func sqlCommonSetAdminLocked(username string, locked bool, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	lockedValue := 0
+	if locked {
+		lockedValue = 1
+	}
+	q := getSetAdminLockedQuery()
+	res, err := dbHandle.ExecContext(ctx, q, lockedValue, util.GetTimeAsMsSinceEpoch(time.Now()), username)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error updating lock status for admin %q: %v", username, err)
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
 func sqlCommonSetUpdatedAt(username string, dbHandle *sql.DB) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -947,6 +1040,23 @@ func sqlCommonSetFirstUploadTimestamp(username string, dbHandle *sql.DB) error {
 	return sqlCommonRequireRowAffected(res)
 }
 
+func sqlCommonUpdateQuotaWarning(username string, threshold int, dbHandle *sql.DB) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getIncreaseQuotaWarningQuery()
+	res, err := dbHandle.ExecContext(ctx, q, threshold, username, threshold)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+		return true, nil
+	}
+	q = getDecreaseQuotaWarningQuery()
+	_, err = dbHandle.ExecContext(ctx, q, threshold, username, threshold)
+	return false, err
+}
+
 func sqlCommonUpdateLastLogin(username string, dbHandle *sql.DB) error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -1168,6 +1278,9 @@ func sqlCommonGetRecentlyUpdatedUsers(after int64, dbHandle sqlQuerier) ([]User,
 	for idx := range groups {
 		groupsMapping[groups[idx].Name] = groups[idx]
 	}
+	expandGroupsHierarchy(groupsMapping, func(name string) (Group, error) {
+		return sqlCommonGetGroupByName(name, dbHandle)
+	})
 	for idx := range users {
 		ref := &users[idx]
 		ref.applyGroupSettings(groupsMapping)
@@ -1238,6 +1351,9 @@ func sqlCommonGetUsersForQuotaCheck(toFetch map[string]bool, dbHandle sqlQuerier
 	for idx := range groups {
 		groupsMapping[groups[idx].Name] = groups[idx]
 	}
+	expandGroupsHierarchy(groupsMapping, func(name string) (Group, error) {
+		return sqlCommonGetGroupByName(name, dbHandle)
+	})
 	for idx := range users {
 		ref := &users[idx]
 		ref.applyGroupSettings(groupsMapping)
@@ -1353,13 +1469,19 @@ func sqlCommonGetActiveTransfers(from time.Time, dbHandle sqlQuerier) ([]ActiveT
 	return transfers, rows.Err()
 }
 
-func sqlCommonGetUsers(limit int, offset int, order string, dbHandle sqlQuerier) ([]User, error) {
+func sqlCommonGetUsers(limit int, offset int, order string, usernamePatterns []string, dbHandle sqlQuerier,
+) ([]User, error) {
 	users := make([]User, 0, limit)
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
 
-	q := getUsersQuery(order)
-	rows, err := dbHandle.QueryContext(ctx, q, limit, offset)
+	q := getUsersQuery(order, len(usernamePatterns))
+	args := make([]any, 0, len(usernamePatterns)+2)
+	for _, pattern := range usernamePatterns {
+		args = append(args, getSQLUsernamePattern(pattern))
+	}
+	args = append(args, limit, offset)
+	rows, err := dbHandle.QueryContext(ctx, q, args...)
 	if err != nil {
 		return users, err
 	}
@@ -1593,12 +1715,12 @@ func sqlCommonCleanupDefenderEvents(from int64, dbHandle *sql.DB) error {
 
 func getShareFromDbRow(row sqlScanner) (Share, error) {
 	var share Share
-	var description, password, allowFrom, paths sql.NullString
+	var description, password, allowFrom, paths, displayName, disposition sql.NullString
 
 	err := row.Scan(&share.ShareID, &share.Name, &description, &share.Scope,
 		&paths, &share.Username, &share.CreatedAt, &share.UpdatedAt,
 		&share.LastUseAt, &share.ExpiresAt, &password, &share.MaxTokens,
-		&share.UsedTokens, &allowFrom)
+		&share.UsedTokens, &allowFrom, &displayName, &disposition)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return share, util.NewRecordNotFoundError(err.Error())
@@ -1628,16 +1750,22 @@ func getShareFromDbRow(row sqlScanner) (Share, error) {
 			share.AllowFrom = list
 		}
 	}
+	if displayName.Valid {
+		share.DisplayName = displayName.String
+	}
+	if disposition.Valid {
+		share.Disposition = disposition.String
+	}
 	return share, nil
 }
 
 func getAPIKeyFromDbRow(row sqlScanner) (APIKey, error) {
 	var apiKey APIKey
 	var userID, adminID sql.NullInt64
-	var description sql.NullString
+	var description, filters sql.NullString
 
 	err := row.Scan(&apiKey.KeyID, &apiKey.Name, &apiKey.Key, &apiKey.Scope, &apiKey.CreatedAt, &apiKey.UpdatedAt,
-		&apiKey.LastUseAt, &apiKey.ExpiresAt, &description, &userID, &adminID)
+		&apiKey.LastUseAt, &apiKey.ExpiresAt, &description, &userID, &adminID, &filters)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1655,6 +1783,12 @@ func getAPIKeyFromDbRow(row sqlScanner) (APIKey, error) {
 	if description.Valid {
 		apiKey.Description = description.String
 	}
+	if filters.Valid && filters.String != "" {
+		var apiKeyFilters APIKeyFilters
+		if err := json.Unmarshal([]byte(filters.String), &apiKeyFilters); err == nil {
+			apiKey.Filters = apiKeyFilters
+		}
+	}
 
 	return apiKey, nil
 }
@@ -1662,9 +1796,10 @@ func getAPIKeyFromDbRow(row sqlScanner) (APIKey, error) {
 func getAdminFromDbRow(row sqlScanner) (Admin, error) {
 	var admin Admin
 	var email, filters, additionalInfo, permissions, description sql.NullString
+	var locked int
 
 	err := row.Scan(&admin.ID, &admin.Username, &admin.Password, &admin.Status, &email, &permissions,
-		&filters, &additionalInfo, &description, &admin.CreatedAt, &admin.UpdatedAt, &admin.LastLogin)
+		&filters, &additionalInfo, &description, &admin.CreatedAt, &admin.UpdatedAt, &admin.LastLogin, &locked)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -1698,6 +1833,7 @@ func getAdminFromDbRow(row sqlScanner) (Admin, error) {
 	if description.Valid {
 		admin.Description = description.String
 	}
+	admin.Locked = locked == 1
 
 	admin.SetEmptySecretsIfNil()
 	return admin, nil
@@ -1708,7 +1844,7 @@ func getEventActionFromDbRow(row sqlScanner) (BaseEventAction, error) {
 	var description sql.NullString
 	var options []byte
 
-	err := row.Scan(&action.ID, &action.Name, &description, &action.Type, &options)
+	err := row.Scan(&action.ID, &action.Name, &description, &action.Type, &options, &action.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return action, util.NewRecordNotFoundError(err.Error())
@@ -1754,9 +1890,10 @@ func getEventRuleFromDbRow(row sqlScanner) (EventRule, error) {
 
 func getGroupFromDbRow(row sqlScanner) (Group, error) {
 	var group Group
-	var userSettings, description sql.NullString
+	var userSettings, description, parentGroup sql.NullString
 
-	err := row.Scan(&group.ID, &group.Name, &description, &group.CreatedAt, &group.UpdatedAt, &userSettings)
+	err := row.Scan(&group.ID, &group.Name, &description, &group.CreatedAt, &group.UpdatedAt, &userSettings,
+		&parentGroup)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return group, util.NewRecordNotFoundError(err.Error())
@@ -1766,6 +1903,9 @@ func getGroupFromDbRow(row sqlScanner) (Group, error) {
 	if description.Valid {
 		group.Description = description.String
 	}
+	if parentGroup.Valid {
+		group.ParentGroup = parentGroup.String
+	}
 	if userSettings.Valid {
 		var settings GroupUserSettings
 		err = json.Unmarshal([]byte(userSettings.String), &settings)
@@ -1791,7 +1931,7 @@ func getUserFromDbRow(row sqlScanner) (User, error) {
 		&user.UploadBandwidth, &user.DownloadBandwidth, &user.ExpirationDate, &user.LastLogin, &user.Status, &filters, &fsConfig,
 		&additionalInfo, &description, &email, &user.CreatedAt, &user.UpdatedAt, &user.UploadDataTransfer, &user.DownloadDataTransfer,
 		&user.TotalDataTransfer, &user.UsedUploadDataTransfer, &user.UsedDownloadDataTransfer, &user.DeletedAt, &user.FirstDownload,
-		&user.FirstUpload)
+		&user.FirstUpload, &user.LastQuotaWarning)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return user, util.NewRecordNotFoundError(err.Error())
@@ -1851,9 +1991,9 @@ func sqlCommonGetFolder(ctx context.Context, name string, dbHandle sqlQuerier) (
 	var folder vfs.BaseVirtualFolder
 	q := getFolderByNameQuery()
 	row := dbHandle.QueryRowContext(ctx, q, name)
-	var mappedPath, description, fsConfig sql.NullString
+	var mappedPath, description, fsConfig, auditLog sql.NullString
 	err := row.Scan(&folder.ID, &mappedPath, &folder.UsedQuotaSize, &folder.UsedQuotaFiles, &folder.LastQuotaUpdate,
-		&folder.Name, &description, &fsConfig)
+		&folder.Name, &description, &fsConfig, &folder.UpdatedAt, &auditLog)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return folder, util.NewRecordNotFoundError(err.Error())
@@ -1873,6 +2013,7 @@ func sqlCommonGetFolder(ctx context.Context, name string, dbHandle sqlQuerier) (
 			folder.FsConfig = fs
 		}
 	}
+	setFolderAuditLog(&folder, auditLog)
 	return folder, err
 }
 
@@ -1905,9 +2046,14 @@ func sqlCommonAddOrUpdateFolder(ctx context.Context, baseFolder *vfs.BaseVirtual
 	if err != nil {
 		return err
 	}
+	auditLog, err := getFolderAuditLogAsJSON(baseFolder)
+	if err != nil {
+		return err
+	}
 	q := getUpsertFolderQuery()
 	_, err = dbHandle.ExecContext(ctx, q, baseFolder.MappedPath, usedQuotaSize, usedQuotaFiles,
-		lastQuotaUpdate, baseFolder.Name, baseFolder.Description, string(fsConfig))
+		lastQuotaUpdate, baseFolder.Name, baseFolder.Description, string(fsConfig), util.GetTimeAsMsSinceEpoch(time.Now()),
+		auditLog)
 	return err
 }
 
@@ -1920,12 +2066,17 @@ func sqlCommonAddFolder(folder *vfs.BaseVirtualFolder, dbHandle sqlQuerier) erro
 	if err != nil {
 		return err
 	}
+	auditLog, err := getFolderAuditLogAsJSON(folder)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
 
 	q := getAddFolderQuery()
 	_, err = dbHandle.ExecContext(ctx, q, folder.MappedPath, folder.UsedQuotaSize, folder.UsedQuotaFiles,
-		folder.LastQuotaUpdate, folder.Name, folder.Description, string(fsConfig))
+		folder.LastQuotaUpdate, folder.Name, folder.Description, string(fsConfig), util.GetTimeAsMsSinceEpoch(time.Now()),
+		auditLog)
 	return err
 }
 
@@ -1938,14 +2089,39 @@ func sqlCommonUpdateFolder(folder *vfs.BaseVirtualFolder, dbHandle sqlQuerier) e
 	if err != nil {
 		return err
 	}
+	auditLog, err := getFolderAuditLogAsJSON(folder)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
 
 	q := getUpdateFolderQuery()
-	_, err = dbHandle.ExecContext(ctx, q, folder.MappedPath, folder.Description, string(fsConfig), folder.Name)
+	_, err = dbHandle.ExecContext(ctx, q, folder.MappedPath, folder.Description, string(fsConfig),
+		util.GetTimeAsMsSinceEpoch(time.Now()), auditLog, folder.Name)
 	return err
 }
 
+func getFolderAuditLogAsJSON(folder *vfs.BaseVirtualFolder) (sql.NullString, error) {
+	if !folder.AuditLog.IsEnabled() {
+		return sql.NullString{}, nil
+	}
+	auditLog, err := json.Marshal(folder.AuditLog)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(auditLog), Valid: true}, nil
+}
+
+func setFolderAuditLog(folder *vfs.BaseVirtualFolder, auditLog sql.NullString) {
+	if auditLog.Valid {
+		var config vfs.FolderAuditLog
+		if err := json.Unmarshal([]byte(auditLog.String), &config); err == nil {
+			folder.AuditLog = config
+		}
+	}
+}
+
 func sqlCommonDeleteFolder(folder vfs.BaseVirtualFolder, dbHandle sqlQuerier) error {
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
 	defer cancel()
@@ -1971,9 +2147,9 @@ func sqlCommonDumpFolders(dbHandle sqlQuerier) ([]vfs.BaseVirtualFolder, error)
 	defer rows.Close()
 	for rows.Next() {
 		var folder vfs.BaseVirtualFolder
-		var mappedPath, description, fsConfig sql.NullString
+		var mappedPath, description, fsConfig, auditLog sql.NullString
 		err = rows.Scan(&folder.ID, &mappedPath, &folder.UsedQuotaSize, &folder.UsedQuotaFiles,
-			&folder.LastQuotaUpdate, &folder.Name, &description, &fsConfig)
+			&folder.LastQuotaUpdate, &folder.Name, &description, &fsConfig, &folder.UpdatedAt, &auditLog)
 		if err != nil {
 			return folders, err
 		}
@@ -1990,6 +2166,7 @@ func sqlCommonDumpFolders(dbHandle sqlQuerier) ([]vfs.BaseVirtualFolder, error)
 				folder.FsConfig = fs
 			}
 		}
+		setFolderAuditLog(&folder, auditLog)
 		folders = append(folders, folder)
 	}
 	return folders, rows.Err()
@@ -2014,9 +2191,9 @@ func sqlCommonGetFolders(limit, offset int, order string, minimal bool, dbHandle
 				return folders, err
 			}
 		} else {
-			var mappedPath, description, fsConfig sql.NullString
+			var mappedPath, description, fsConfig, auditLog sql.NullString
 			err = rows.Scan(&folder.ID, &mappedPath, &folder.UsedQuotaSize, &folder.UsedQuotaFiles,
-				&folder.LastQuotaUpdate, &folder.Name, &description, &fsConfig)
+				&folder.LastQuotaUpdate, &folder.Name, &description, &fsConfig, &folder.UpdatedAt, &auditLog)
 			if err != nil {
 				return folders, err
 			}
@@ -2033,6 +2210,7 @@ func sqlCommonGetFolders(limit, offset int, order string, minimal bool, dbHandle
 					folder.FsConfig = fs
 				}
 			}
+			setFolderAuditLog(&folder, auditLog)
 		}
 		folder.PrepareForRendering()
 		folders = append(folders, folder)
@@ -2072,10 +2250,18 @@ func sqlCommonClearUserGroupMapping(ctx context.Context, user *User, dbHandle sq
 
 func sqlCommonAddUserFolderMapping(ctx context.Context, user *User, folder *vfs.VirtualFolder, dbHandle sqlQuerier) error {
 	q := getAddUserFolderMappingQuery()
-	_, err := dbHandle.ExecContext(ctx, q, folder.VirtualPath, folder.QuotaSize, folder.QuotaFiles, folder.Name, user.Username)
+	_, err := dbHandle.ExecContext(ctx, q, folder.VirtualPath, folder.QuotaSize, folder.QuotaFiles,
+		getFolderReadOnlyValue(folder), folder.Name, user.Username)
 	return err
 }
 
+func getFolderReadOnlyValue(folder *vfs.VirtualFolder) int {
+	if folder.ReadOnly {
+		return 1
+	}
+	return 0
+}
+
 func sqlCommonClearAdminGroupMapping(ctx context.Context, admin *Admin, dbHandle sqlQuerier) error {
 	q := getClearAdminGroupMappingQuery()
 	_, err := dbHandle.ExecContext(ctx, q, admin.Username)
@@ -2084,7 +2270,8 @@ func sqlCommonClearAdminGroupMapping(ctx context.Context, admin *Admin, dbHandle
 
 func sqlCommonAddGroupFolderMapping(ctx context.Context, group *Group, folder *vfs.VirtualFolder, dbHandle sqlQuerier) error {
 	q := getAddGroupFolderMappingQuery()
-	_, err := dbHandle.ExecContext(ctx, q, folder.VirtualPath, folder.QuotaSize, folder.QuotaFiles, folder.Name, group.Name)
+	_, err := dbHandle.ExecContext(ctx, q, folder.VirtualPath, folder.QuotaSize, folder.QuotaFiles,
+		getFolderReadOnlyValue(folder), folder.Name, group.Name)
 	return err
 }
 
@@ -2297,10 +2484,11 @@ func getUsersWithVirtualFolders(ctx context.Context, users []User, dbHandle sqlQ
 	for rows.Next() {
 		var folder vfs.VirtualFolder
 		var userID int64
-		var mappedPath, fsConfig, description sql.NullString
+		var mappedPath, fsConfig, description, auditLog sql.NullString
+		var readOnly int
 		err = rows.Scan(&folder.ID, &folder.Name, &mappedPath, &folder.UsedQuotaSize, &folder.UsedQuotaFiles,
-			&folder.LastQuotaUpdate, &folder.VirtualPath, &folder.QuotaSize, &folder.QuotaFiles, &userID, &fsConfig,
-			&description)
+			&folder.LastQuotaUpdate, &folder.VirtualPath, &folder.QuotaSize, &folder.QuotaFiles, &readOnly, &userID,
+			&fsConfig, &description, &auditLog)
 		if err != nil {
 			return users, err
 		}
@@ -2317,6 +2505,8 @@ func getUsersWithVirtualFolders(ctx context.Context, users []User, dbHandle sqlQ
 				folder.FsConfig = fs
 			}
 		}
+		setFolderAuditLog(&folder.BaseVirtualFolder, auditLog)
+		folder.ReadOnly = readOnly == 1
 		usersVirtualFolders[userID] = append(usersVirtualFolders[userID], folder)
 	}
 	err = rows.Err()
@@ -2427,10 +2617,11 @@ func getGroupsWithVirtualFolders(ctx context.Context, groups []Group, dbHandle s
 	for rows.Next() {
 		var groupID int64
 		var folder vfs.VirtualFolder
-		var mappedPath, fsConfig, description sql.NullString
+		var mappedPath, fsConfig, description, auditLog sql.NullString
+		var readOnly int
 		err = rows.Scan(&folder.ID, &folder.Name, &mappedPath, &folder.UsedQuotaSize, &folder.UsedQuotaFiles,
-			&folder.LastQuotaUpdate, &folder.VirtualPath, &folder.QuotaSize, &folder.QuotaFiles, &groupID, &fsConfig,
-			&description)
+			&folder.LastQuotaUpdate, &folder.VirtualPath, &folder.QuotaSize, &folder.QuotaFiles, &readOnly, &groupID,
+			&fsConfig, &description, &auditLog)
 		if err != nil {
 			return groups, err
 		}
@@ -2447,6 +2638,8 @@ func getGroupsWithVirtualFolders(ctx context.Context, groups []Group, dbHandle s
 				folder.FsConfig = fs
 			}
 		}
+		setFolderAuditLog(&folder.BaseVirtualFolder, auditLog)
+		folder.ReadOnly = readOnly == 1
 		groupsVirtualFolders[groupID] = append(groupsVirtualFolders[groupID], folder)
 	}
 	err = rows.Err()
@@ -2771,6 +2964,30 @@ func sqlCommonCleanupSessions(sessionType SessionType, before int64, dbHandle *s
 	return err
 }
 
+func sqlCommonGetSessions(sessionType SessionType, after int64, dbHandle sqlQuerier) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getSessionsQuery()
+	rows, err := dbHandle.QueryContext(ctx, q, sessionType, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		var data []byte
+		if err := rows.Scan(&session.Key, &data, &session.Type, &session.Timestamp); err != nil {
+			return nil, err
+		}
+		session.Data = data
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
 func getActionsWithRuleNames(ctx context.Context, actions []BaseEventAction, dbHandle sqlQuerier,
 ) ([]BaseEventAction, error) {
 	if len(actions) == 0 {
@@ -2976,7 +3193,8 @@ func sqlCommonAddEventAction(action *BaseEventAction, dbHandle *sql.DB) error {
 	if err != nil {
 		return err
 	}
-	_, err = dbHandle.ExecContext(ctx, q, action.Name, action.Description, action.Type, string(options))
+	_, err = dbHandle.ExecContext(ctx, q, action.Name, action.Description, action.Type, string(options),
+		util.GetTimeAsMsSinceEpoch(time.Now()))
 	return err
 }
 
@@ -2993,7 +3211,8 @@ func sqlCommonUpdateEventAction(action *BaseEventAction, dbHandle *sql.DB) error
 
 	return sqlCommonExecuteTx(ctx, dbHandle, func(tx *sql.Tx) error {
 		q := getUpdateEventActionQuery()
-		_, err = tx.ExecContext(ctx, q, action.Description, action.Type, string(options), action.Name)
+		_, err = tx.ExecContext(ctx, q, action.Description, action.Type, string(options),
+			util.GetTimeAsMsSinceEpoch(time.Now()), action.Name)
 		if err != nil {
 			return err
 		}
@@ -3358,6 +3577,460 @@ func sqlCommonCleanupNodes(dbHandle *sql.DB) error {
 	return err
 }
 
+func sqlCommonUpdateKnownIP(username, ip string, cutoff int64, dbHandle *sql.DB) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	var lastSeen int64
+	q := getKnownIPLastSeenQuery()
+	err := dbHandle.QueryRowContext(ctx, q, username, ip).Scan(&lastSeen)
+	if err == nil {
+		q = getUpdateKnownIPQuery()
+		_, err = dbHandle.ExecContext(ctx, q, now, ip, username)
+		return lastSeen < cutoff, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	q = getAddKnownIPQuery()
+	_, err = dbHandle.ExecContext(ctx, q, username, ip, now, now)
+	if err != nil {
+		// the IP could be added by a concurrent login
+		q = getUpdateKnownIPQuery()
+		_, errUpdate := dbHandle.ExecContext(ctx, q, now, ip, username)
+		if errUpdate != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func sqlCommonCleanupKnownIPs(before int64, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getCleanupKnownIPsQuery()
+	_, err := dbHandle.ExecContext(ctx, q, before)
+	return err
+}
+
+func sqlCommonGetContentEntry(storageID, name string, dbHandle sqlQuerier) (vfs.ContentIndexEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getContentEntryQuery()
+	row := dbHandle.QueryRowContext(ctx, q, storageID, name)
+	return getContentEntryFromDbRow(row)
+}
+
+func sqlCommonGetContentEntries(storageID, dirName string, recursive bool, dbHandle sqlQuerier) ([]vfs.ContentIndexEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	q := getContentEntriesQuery(dirName, recursive)
+	args := []any{storageID}
+	if !recursive {
+		args = append(args, dirName)
+	} else if dirName != "" {
+		args = append(args, sqlEscapeLikePattern(dirName)+"/%")
+	}
+	rows, err := dbHandle.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []vfs.ContentIndexEntry
+	for rows.Next() {
+		entry, err := getContentEntryFromDbRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func sqlCommonAddContentEntry(entry *vfs.ContentIndexEntry, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	isDir := 0
+	if entry.IsDir {
+		isDir = 1
+	}
+	updateEntry := func() (int64, error) {
+		q := getUpdateContentEntryQuery()
+		res, err := dbHandle.ExecContext(ctx, q, entry.Hash, entry.Size, isDir, entry.ModTime, entry.StorageID, entry.Path)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	affected, err := updateEntry()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	q := getAddContentEntryQuery()
+	_, err = dbHandle.ExecContext(ctx, q, entry.StorageID, entry.Path, entry.GetParent(), entry.Hash, entry.Size,
+		isDir, entry.ModTime)
+	if err != nil {
+		// the entry could be unchanged, MySQL returns 0 rows affected in this case,
+		// or added by a concurrent request
+		if _, errUpdate := updateEntry(); errUpdate != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqlCommonRenameContentEntries(storageID, source, target string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	return sqlCommonExecuteTx(ctx, dbHandle, func(tx *sql.Tx) error {
+		q := getDeleteContentEntryQuery()
+		if _, err := tx.ExecContext(ctx, q, storageID, target); err != nil {
+			return err
+		}
+		q = getContentEntriesToRenameQuery()
+		rows, err := tx.QueryContext(ctx, q, storageID, source, sqlEscapeLikePattern(source)+"/%")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		type renamedEntry struct {
+			id   int64
+			path string
+		}
+		var entries []renamedEntry
+		for rows.Next() {
+			var entry renamedEntry
+			if err := rows.Scan(&entry.id, &entry.path); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return util.NewRecordNotFoundError(fmt.Sprintf("path %q does not exist", source))
+		}
+		q = getRenameContentEntryQuery()
+		for _, entry := range entries {
+			renamed := vfs.ContentIndexEntry{
+				Path: target + strings.TrimPrefix(entry.path, source),
+			}
+			if _, err := tx.ExecContext(ctx, q, renamed.Path, renamed.GetParent(), entry.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func sqlCommonDeleteContentEntry(storageID, name string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getDeleteContentEntryQuery()
+	res, err := dbHandle.ExecContext(ctx, q, storageID, name)
+	if err != nil {
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
+func sqlCommonGetContentHashes(storageID string, dbHandle *sql.DB) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	q := getContentHashesQuery()
+	rows, err := dbHandle.QueryContext(ctx, q, storageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+func sqlCommonIsContentReferenced(storageID, hash string, dbHandle *sql.DB) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	var id int64
+	q := getContentReferenceQuery()
+	err := dbHandle.QueryRowContext(ctx, q, storageID, hash).Scan(&id)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return false, err
+}
+
+func sqlCommonDeleteContentEntriesByHash(storageID, hash string, dbHandle *sql.DB) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getDeleteContentEntriesByHashQuery()
+	res, err := dbHandle.ExecContext(ctx, q, storageID, hash)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func getContentEntryFromDbRow(row sqlScanner) (vfs.ContentIndexEntry, error) {
+	var entry vfs.ContentIndexEntry
+	var isDir int
+
+	err := row.Scan(&entry.StorageID, &entry.Path, &entry.Hash, &entry.Size, &isDir, &entry.ModTime)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entry, util.NewRecordNotFoundError(err.Error())
+		}
+		return entry, err
+	}
+	entry.IsDir = isDir == 1
+	return entry, nil
+}
+
+// sqlEscapeLikePattern escapes the LIKE wildcards using "!" as escape character
+func sqlEscapeLikePattern(value string) string {
+	value = strings.ReplaceAll(value, "!", "!!")
+	value = strings.ReplaceAll(value, "%", "!%")
+	return strings.ReplaceAll(value, "_", "!_")
+}
+
+func sqlCommonAddUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	parts, err := json.Marshal(session.Parts)
+	if err != nil {
+		return err
+	}
+	q := getAddUploadSessionQuery()
+	_, err = dbHandle.ExecContext(ctx, q, session.ID, session.Username, session.Path, session.StartedAt,
+		session.LastSeenAt, session.UploadedBytes, session.TotalBytes, session.BackendToken, string(parts), owner,
+		leaseExpiresAt)
+	return err
+}
+
+func sqlCommonUpdateUploadSession(session *vfs.UploadSession, owner string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	parts, err := json.Marshal(session.Parts)
+	if err != nil {
+		return err
+	}
+	q := getUpdateUploadSessionQuery()
+	res, err := dbHandle.ExecContext(ctx, q, session.LastSeenAt, session.UploadedBytes, session.TotalBytes,
+		string(parts), session.ID, owner)
+	if err != nil {
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
+// sqlCommonClaimUploadSession sets the lease owner using a conditional update,
+// only one of the concurrent claims, from any instance, can succeed
+func sqlCommonClaimUploadSession(id, owner string, leaseExpiresAt, now int64, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getClaimUploadSessionQuery()
+	res, err := dbHandle.ExecContext(ctx, q, owner, leaseExpiresAt, id, owner, now)
+	if err != nil {
+		return err
+	}
+	if err := sqlCommonRequireRowAffected(res); err != nil {
+		if _, errGet := sqlCommonGetUploadSessionByID(id, dbHandle); errGet != nil {
+			return errGet
+		}
+		return vfs.ErrUploadSessionInUse
+	}
+	return nil
+}
+
+func sqlCommonReleaseUploadSession(id, owner string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getReleaseUploadSessionQuery()
+	_, err := dbHandle.ExecContext(ctx, q, id, owner)
+	return err
+}
+
+func sqlCommonGetUploadSession(username, virtualPath string, dbHandle sqlQuerier) (vfs.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getUploadSessionQuery()
+	row := dbHandle.QueryRowContext(ctx, q, username, virtualPath)
+	return getUploadSessionFromDbRow(row)
+}
+
+func sqlCommonGetUploadSessionByID(id string, dbHandle sqlQuerier) (vfs.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getUploadSessionByIDQuery()
+	row := dbHandle.QueryRowContext(ctx, q, id)
+	return getUploadSessionFromDbRow(row)
+}
+
+func sqlCommonGetUploadSessions(username string, dbHandle sqlQuerier) ([]vfs.UploadSession, error) {
+	return sqlCommonQueryUploadSessions(getUploadSessionsQuery(), username, dbHandle)
+}
+
+func sqlCommonGetStaleUploadSessions(lastSeenBefore int64, dbHandle sqlQuerier) ([]vfs.UploadSession, error) {
+	return sqlCommonQueryUploadSessions(getStaleUploadSessionsQuery(), lastSeenBefore, dbHandle)
+}
+
+func sqlCommonQueryUploadSessions(q string, arg any, dbHandle sqlQuerier) ([]vfs.UploadSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	rows, err := dbHandle.QueryContext(ctx, q, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]vfs.UploadSession, 0, 10)
+	for rows.Next() {
+		session, err := getUploadSessionFromDbRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func sqlCommonDeleteUploadSession(id string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getDeleteUploadSessionQuery()
+	res, err := dbHandle.ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
+func getUploadSessionFromDbRow(row sqlScanner) (vfs.UploadSession, error) {
+	var session vfs.UploadSession
+	var parts sql.NullString
+
+	err := row.Scan(&session.ID, &session.Username, &session.Path, &session.StartedAt, &session.LastSeenAt,
+		&session.UploadedBytes, &session.TotalBytes, &session.BackendToken, &parts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return session, util.NewRecordNotFoundError(err.Error())
+		}
+		return session, err
+	}
+	if parts.Valid && parts.String != "" {
+		if err := json.Unmarshal([]byte(parts.String), &session.Parts); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+func sqlCommonSetReplicationStatus(status *vfs.ReplicationStatus, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getSetReplicationStatusQuery()
+	_, err := dbHandle.ExecContext(ctx, q, status.Username, status.Path, status.DestinationBucket, status.Status,
+		status.Attempts, status.LastError, status.CreatedAt, status.UpdatedAt, status.NextRetryAt)
+	return err
+}
+
+func sqlCommonGetReplicationStatus(username, virtualPath string, dbHandle sqlQuerier) (vfs.ReplicationStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getReplicationStatusQuery()
+	row := dbHandle.QueryRowContext(ctx, q, username, virtualPath)
+	return getReplicationStatusFromDbRow(row)
+}
+
+func sqlCommonGetReplicationsToRetry(nextRetryBefore int64, dbHandle sqlQuerier) ([]vfs.ReplicationStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+
+	q := getReplicationsToRetryQuery()
+	rows, err := dbHandle.QueryContext(ctx, q, nextRetryBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []vfs.ReplicationStatus
+	for rows.Next() {
+		status, err := getReplicationStatusFromDbRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
+
+func sqlCommonDeleteReplicationStatus(username, virtualPath string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+
+	q := getDeleteReplicationStatusQuery()
+	res, err := dbHandle.ExecContext(ctx, q, username, virtualPath)
+	if err != nil {
+		return err
+	}
+	return sqlCommonRequireRowAffected(res)
+}
+
+func getReplicationStatusFromDbRow(row sqlScanner) (vfs.ReplicationStatus, error) {
+	var status vfs.ReplicationStatus
+	var lastError sql.NullString
+
+	err := row.Scan(&status.Username, &status.Path, &status.DestinationBucket, &status.Status, &status.Attempts,
+		&lastError, &status.CreatedAt, &status.UpdatedAt, &status.NextRetryAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status, util.NewRecordNotFoundError(err.Error())
+		}
+		return status, err
+	}
+	if lastError.Valid {
+		status.LastError = lastError.String
+	}
+	return status, nil
+}
+
 func sqlCommonGetDatabaseVersion(dbHandle sqlQuerier, showInitWarn bool) (schemaVersion, error) {
 	var result schemaVersion
 	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
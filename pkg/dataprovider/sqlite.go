@@ -37,7 +37,11 @@ import (
 )
 
 const (
-	sqliteResetSQL = `DROP TABLE IF EXISTS "{{api_keys}}";
+	sqliteResetSQL = `DROP TABLE IF EXISTS "{{replications}}";
+DROP TABLE IF EXISTS "{{upload_sessions}}";
+DROP TABLE IF EXISTS "{{content_index}}";
+DROP TABLE IF EXISTS "{{known_ips}}";
+DROP TABLE IF EXISTS "{{api_keys}}";
 DROP TABLE IF EXISTS "{{folders_mapping}}";
 DROP TABLE IF EXISTS "{{users_folders_mapping}}";
 DROP TABLE IF EXISTS "{{users_groups_mapping}}";
@@ -177,6 +181,74 @@ CREATE INDEX "{{prefix}}admins_groups_mapping_admin_id_idx" ON "{{admins_groups_
 CREATE INDEX "{{prefix}}admins_groups_mapping_group_id_idx" ON "{{admins_groups_mapping}}" ("group_id");
 `
 	sqliteV22DownSQL = `DROP TABLE "{{admins_groups_mapping}}";`
+	sqliteV24SQL     = `ALTER TABLE "{{api_keys}}" ADD COLUMN "filters" text NULL;`
+	sqliteV24DownSQL = `ALTER TABLE "{{api_keys}}" DROP COLUMN "filters";`
+	sqliteV25SQL     = `ALTER TABLE "{{shares}}" ADD COLUMN "display_name" varchar(255) NULL;
+ALTER TABLE "{{shares}}" ADD COLUMN "disposition" varchar(20) NULL;`
+	sqliteV25DownSQL = `ALTER TABLE "{{shares}}" DROP COLUMN "disposition";
+ALTER TABLE "{{shares}}" DROP COLUMN "display_name";`
+	sqliteV26SQL = `CREATE TABLE "{{known_ips}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"user_id" integer NOT NULL REFERENCES "{{users}}" ("id") ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+"ip" varchar(50) NOT NULL, "first_seen" bigint NOT NULL, "last_seen" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_known_ip" UNIQUE ("user_id", "ip"));
+CREATE INDEX "{{prefix}}known_ips_user_id_idx" ON "{{known_ips}}" ("user_id");
+CREATE INDEX "{{prefix}}known_ips_last_seen_idx" ON "{{known_ips}}" ("last_seen");
+`
+	sqliteV26DownSQL = `DROP TABLE "{{known_ips}}";`
+	sqliteV27SQL     = `ALTER TABLE "{{folders}}" ADD COLUMN "updated_at" bigint DEFAULT 0 NOT NULL;
+ALTER TABLE "{{events_actions}}" ADD COLUMN "updated_at" bigint DEFAULT 0 NOT NULL;
+CREATE INDEX "{{prefix}}folders_updated_at_idx" ON "{{folders}}" ("updated_at");
+CREATE INDEX "{{prefix}}events_actions_updated_at_idx" ON "{{events_actions}}" ("updated_at");
+`
+	sqliteV27DownSQL = `DROP INDEX "{{prefix}}events_actions_updated_at_idx";
+DROP INDEX "{{prefix}}folders_updated_at_idx";
+ALTER TABLE "{{events_actions}}" DROP COLUMN "updated_at";
+ALTER TABLE "{{folders}}" DROP COLUMN "updated_at";
+`
+	sqliteV28SQL     = `ALTER TABLE "{{groups}}" ADD COLUMN "parent_group" varchar(255) NULL;`
+	sqliteV28DownSQL = `ALTER TABLE "{{groups}}" DROP COLUMN "parent_group";`
+	sqliteV29SQL     = `CREATE TABLE "{{content_index}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"storage_id" varchar(255) NOT NULL, "path" varchar(512) NOT NULL, "parent" varchar(512) NOT NULL,
+"hash" varchar(64) NOT NULL, "size" bigint NOT NULL, "is_dir" integer NOT NULL, "mtime" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_content_path" UNIQUE ("storage_id", "path"));
+CREATE INDEX "{{prefix}}content_index_parent_idx" ON "{{content_index}}" ("storage_id", "parent");
+CREATE INDEX "{{prefix}}content_index_hash_idx" ON "{{content_index}}" ("storage_id", "hash");
+`
+	sqliteV29DownSQL = `DROP TABLE "{{content_index}}";`
+	sqliteV30SQL     = `CREATE TABLE "{{upload_sessions}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"upload_id" varchar(255) NOT NULL UNIQUE, "username" varchar(255) NOT NULL, "path" varchar(512) NOT NULL,
+"started_at" bigint NOT NULL, "last_seen_at" bigint NOT NULL, "uploaded_bytes" bigint NOT NULL,
+"total_bytes" bigint NOT NULL, "backend_token" text NOT NULL, "parts" text NULL,
+CONSTRAINT "{{prefix}}unique_upload_session_path" UNIQUE ("username", "path"));
+CREATE INDEX "{{prefix}}upload_sessions_last_seen_at_idx" ON "{{upload_sessions}}" ("last_seen_at");
+`
+	sqliteV30DownSQL = `DROP TABLE "{{upload_sessions}}";`
+	sqliteV31SQL     = `ALTER TABLE "{{folders}}" ADD COLUMN "audit_log" text NULL;`
+	sqliteV31DownSQL = `ALTER TABLE "{{folders}}" DROP COLUMN "audit_log";`
+	sqliteV32SQL     = `ALTER TABLE "{{users_folders_mapping}}" ADD COLUMN "read_only" integer DEFAULT 0 NOT NULL;
+ALTER TABLE "{{groups_folders_mapping}}" ADD COLUMN "read_only" integer DEFAULT 0 NOT NULL;
+`
+	sqliteV32DownSQL = `ALTER TABLE "{{groups_folders_mapping}}" DROP COLUMN "read_only";
+ALTER TABLE "{{users_folders_mapping}}" DROP COLUMN "read_only";
+`
+	sqliteV33SQL     = `ALTER TABLE "{{admins}}" ADD COLUMN "locked" integer DEFAULT 0 NOT NULL;`
+	sqliteV33DownSQL = `ALTER TABLE "{{admins}}" DROP COLUMN "locked";`
+	sqliteV34SQL     = `ALTER TABLE "{{users}}" ADD COLUMN "last_quota_warning" integer DEFAULT 0 NOT NULL;`
+	sqliteV34DownSQL = `ALTER TABLE "{{users}}" DROP COLUMN "last_quota_warning";`
+	sqliteV35SQL     = `CREATE TABLE "{{replications}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"username" varchar(255) NOT NULL, "path" varchar(512) NOT NULL, "destination_bucket" varchar(255) NOT NULL,
+"status" varchar(20) NOT NULL, "attempts" integer NOT NULL, "last_error" text NULL, "created_at" bigint NOT NULL,
+"updated_at" bigint NOT NULL, "next_retry_at" bigint NOT NULL,
+CONSTRAINT "{{prefix}}unique_replication_path" UNIQUE ("username", "path"));
+CREATE INDEX "{{prefix}}replications_next_retry_at_idx" ON "{{replications}}" ("next_retry_at");
+`
+	sqliteV35DownSQL = `DROP TABLE "{{replications}}";`
+	sqliteV36SQL     = `ALTER TABLE "{{upload_sessions}}" ADD COLUMN "lease_owner" varchar(255) DEFAULT '' NOT NULL;
+ALTER TABLE "{{upload_sessions}}" ADD COLUMN "lease_expires_at" bigint DEFAULT 0 NOT NULL;
+`
+	sqliteV36DownSQL = `ALTER TABLE "{{upload_sessions}}" DROP COLUMN "lease_expires_at";
+ALTER TABLE "{{upload_sessions}}" DROP COLUMN "lease_owner";
+`
 )
 
 // SQLiteProvider defines the auth provider for SQLite database
@@ -240,6 +312,10 @@ func (p *SQLiteProvider) updateQuota(username string, filesAdd int, sizeAdd int6
 	return sqlCommonUpdateQuota(username, filesAdd, sizeAdd, reset, p.dbHandle)
 }
 
+func (p *SQLiteProvider) reserveQuotaFile(username string, maxUsedFiles int) (bool, error) {
+	return sqlCommonReserveQuotaFile(username, maxUsedFiles, p.dbHandle)
+}
+
 func (p *SQLiteProvider) getUsedQuota(username string) (int, int64, int64, int64, error) {
 	return sqlCommonGetUsedQuota(username, p.dbHandle)
 }
@@ -256,6 +332,10 @@ func (p *SQLiteProvider) updateAdminLastLogin(username string) error {
 	return sqlCommonUpdateAdminLastLogin(username, p.dbHandle)
 }
 
+func (p *SQLiteProvider) setAdminLocked(username string, locked bool) error {
+	return sqlCommonSetAdminLocked(username, locked, p.dbHandle)
+}
+
 func (p *SQLiteProvider) userExists(username string) (User, error) {
 	return sqlCommonGetUserByUsername(username, p.dbHandle)
 }
@@ -284,8 +364,8 @@ func (p *SQLiteProvider) getRecentlyUpdatedUsers(after int64) ([]User, error) {
 	return sqlCommonGetRecentlyUpdatedUsers(after, p.dbHandle)
 }
 
-func (p *SQLiteProvider) getUsers(limit int, offset int, order string) ([]User, error) {
-	return sqlCommonGetUsers(limit, offset, order, p.dbHandle)
+func (p *SQLiteProvider) getUsers(limit int, offset int, order string, usernamePatterns []string) ([]User, error) {
+	return sqlCommonGetUsers(limit, offset, order, usernamePatterns, p.dbHandle)
 }
 
 func (p *SQLiteProvider) getUsersForQuotaCheck(toFetch map[string]bool) ([]User, error) {
@@ -338,6 +418,10 @@ func (p *SQLiteProvider) getUsersInGroups(names []string) ([]string, error) {
 	return sqlCommonGetUsersInGroups(names, p.dbHandle)
 }
 
+func (p *SQLiteProvider) getChildGroups(names []string) ([]string, error) {
+	return sqlCommonGetChildGroups(names, p.dbHandle)
+}
+
 func (p *SQLiteProvider) groupExists(name string) (Group, error) {
 	return sqlCommonGetGroupByName(name, p.dbHandle)
 }
@@ -414,6 +498,10 @@ func (p *SQLiteProvider) updateAPIKeyLastUse(keyID string) error {
 	return sqlCommonUpdateAPIKeyLastUse(keyID, p.dbHandle)
 }
 
+func (p *SQLiteProvider) updateAPIKeySecret(keyID, key string) error {
+	return sqlCommonUpdateAPIKeySecret(keyID, key, p.dbHandle)
+}
+
 func (p *SQLiteProvider) shareExists(shareID, username string) (Share, error) {
 	return sqlCommonGetShareByID(shareID, username, p.dbHandle)
 }
@@ -510,6 +598,10 @@ func (p *SQLiteProvider) cleanupSharedSessions(sessionType SessionType, before i
 	return sqlCommonCleanupSessions(sessionType, before, p.dbHandle)
 }
 
+func (p *SQLiteProvider) getSharedSessions(sessionType SessionType, after int64) ([]Session, error) {
+	return sqlCommonGetSessions(sessionType, after, p.dbHandle)
+}
+
 func (p *SQLiteProvider) getEventActions(limit, offset int, order string, minimal bool) ([]BaseEventAction, error) {
 	return sqlCommonGetEventActions(limit, offset, order, minimal, p.dbHandle)
 }
@@ -590,10 +682,110 @@ func (*SQLiteProvider) getNodes() ([]Node, error) {
 	return nil, ErrNotImplemented
 }
 
+func (*SQLiteProvider) getOnlineMigrations() ([]OnlineMigration, error) {
+	return nil, ErrNotImplemented
+}
+
+func (*SQLiteProvider) pauseOnlineMigration(_ int) error {
+	return ErrNotImplemented
+}
+
 func (*SQLiteProvider) updateNodeTimestamp() error {
 	return ErrNotImplemented
 }
 
+func (p *SQLiteProvider) updateKnownIP(username, ip string, cutoff int64) (bool, error) {
+	return sqlCommonUpdateKnownIP(username, ip, cutoff, p.dbHandle)
+}
+
+func (p *SQLiteProvider) cleanupKnownIPs(before int64) error {
+	return sqlCommonCleanupKnownIPs(before, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getContentEntry(storageID, name string) (vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getContentEntries(storageID, dirName string, recursive bool) ([]vfs.ContentIndexEntry, error) {
+	return sqlCommonGetContentEntries(storageID, dirName, recursive, p.dbHandle)
+}
+
+func (p *SQLiteProvider) addContentEntry(entry *vfs.ContentIndexEntry) error {
+	return sqlCommonAddContentEntry(entry, p.dbHandle)
+}
+
+func (p *SQLiteProvider) renameContentEntries(storageID, source, target string) error {
+	return sqlCommonRenameContentEntries(storageID, source, target, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteContentEntry(storageID, name string) error {
+	return sqlCommonDeleteContentEntry(storageID, name, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getContentHashes(storageID string) ([]string, error) {
+	return sqlCommonGetContentHashes(storageID, p.dbHandle)
+}
+
+func (p *SQLiteProvider) isContentReferenced(storageID, hash string) (bool, error) {
+	return sqlCommonIsContentReferenced(storageID, hash, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	return sqlCommonDeleteContentEntriesByHash(storageID, hash, p.dbHandle)
+}
+
+func (p *SQLiteProvider) addUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	return sqlCommonAddUploadSession(session, owner, leaseExpiresAt, p.dbHandle)
+}
+
+func (p *SQLiteProvider) updateUploadSession(session *vfs.UploadSession, owner string) error {
+	return sqlCommonUpdateUploadSession(session, owner, p.dbHandle)
+}
+
+func (p *SQLiteProvider) claimUploadSession(id, owner string, leaseExpiresAt, now int64) error {
+	return sqlCommonClaimUploadSession(id, owner, leaseExpiresAt, now, p.dbHandle)
+}
+
+func (p *SQLiteProvider) releaseUploadSession(id, owner string) error {
+	return sqlCommonReleaseUploadSession(id, owner, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSession(username, virtualPath, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getUploadSessionByID(id string) (vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessionByID(id, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getUploadSessions(username string) ([]vfs.UploadSession, error) {
+	return sqlCommonGetUploadSessions(username, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getStaleUploadSessions(lastSeenBefore int64) ([]vfs.UploadSession, error) {
+	return sqlCommonGetStaleUploadSessions(lastSeenBefore, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteUploadSession(id string) error {
+	return sqlCommonDeleteUploadSession(id, p.dbHandle)
+}
+
+func (p *SQLiteProvider) setReplicationStatus(status *vfs.ReplicationStatus) error {
+	return sqlCommonSetReplicationStatus(status, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getReplicationStatus(username, virtualPath string) (vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getReplicationsToRetry(nextRetryBefore int64) ([]vfs.ReplicationStatus, error) {
+	return sqlCommonGetReplicationsToRetry(nextRetryBefore, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteReplicationStatus(username, virtualPath string) error {
+	return sqlCommonDeleteReplicationStatus(username, virtualPath, p.dbHandle)
+}
+
 func (*SQLiteProvider) cleanupNodes() error {
 	return ErrNotImplemented
 }
@@ -606,6 +798,10 @@ func (p *SQLiteProvider) setFirstUploadTimestamp(username string) error {
 	return sqlCommonSetFirstUploadTimestamp(username, p.dbHandle)
 }
 
+func (p *SQLiteProvider) updateQuotaWarning(username string, threshold int) (bool, error) {
+	return sqlCommonUpdateQuotaWarning(username, threshold, p.dbHandle)
+}
+
 func (p *SQLiteProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -653,6 +849,32 @@ func (p *SQLiteProvider) migrateDatabase() error { //nolint:dupl
 		return updateSQLiteDatabaseFromV21(p.dbHandle)
 	case version == 22:
 		return updateSQLiteDatabaseFromV22(p.dbHandle)
+	case version == 23:
+		return updateSQLiteDatabaseFromV23(p.dbHandle)
+	case version == 24:
+		return updateSQLiteDatabaseFromV24(p.dbHandle)
+	case version == 25:
+		return updateSQLiteDatabaseFromV25(p.dbHandle)
+	case version == 26:
+		return updateSQLiteDatabaseFromV26(p.dbHandle)
+	case version == 27:
+		return updateSQLiteDatabaseFromV27(p.dbHandle)
+	case version == 28:
+		return updateSQLiteDatabaseFromV28(p.dbHandle)
+	case version == 29:
+		return updateSQLiteDatabaseFromV29(p.dbHandle)
+	case version == 30:
+		return updateSQLiteDatabaseFromV30(p.dbHandle)
+	case version == 31:
+		return updateSQLiteDatabaseFromV31(p.dbHandle)
+	case version == 32:
+		return updateSQLiteDatabaseFromV32(p.dbHandle)
+	case version == 33:
+		return updateSQLiteDatabaseFromV33(p.dbHandle)
+	case version == 34:
+		return updateSQLiteDatabaseFromV34(p.dbHandle)
+	case version == 35:
+		return updateSQLiteDatabaseFromV35(p.dbHandle)
 	default:
 		if version > sqlDatabaseVersion {
 			providerLog(logger.LevelError, "database schema version %v is newer than the supported one: %v", version,
@@ -683,6 +905,32 @@ func (p *SQLiteProvider) revertDatabase(targetVersion int) error {
 		return downgradeSQLiteDatabaseFromV22(p.dbHandle)
 	case 23:
 		return downgradeSQLiteDatabaseFromV23(p.dbHandle)
+	case 24:
+		return downgradeSQLiteDatabaseFromV24(p.dbHandle)
+	case 25:
+		return downgradeSQLiteDatabaseFromV25(p.dbHandle)
+	case 26:
+		return downgradeSQLiteDatabaseFromV26(p.dbHandle)
+	case 27:
+		return downgradeSQLiteDatabaseFromV27(p.dbHandle)
+	case 28:
+		return downgradeSQLiteDatabaseFromV28(p.dbHandle)
+	case 29:
+		return downgradeSQLiteDatabaseFromV29(p.dbHandle)
+	case 30:
+		return downgradeSQLiteDatabaseFromV30(p.dbHandle)
+	case 31:
+		return downgradeSQLiteDatabaseFromV31(p.dbHandle)
+	case 32:
+		return downgradeSQLiteDatabaseFromV32(p.dbHandle)
+	case 33:
+		return downgradeSQLiteDatabaseFromV33(p.dbHandle)
+	case 34:
+		return downgradeSQLiteDatabaseFromV34(p.dbHandle)
+	case 35:
+		return downgradeSQLiteDatabaseFromV35(p.dbHandle)
+	case 36:
+		return downgradeSQLiteDatabaseFromV36(p.dbHandle)
 	default:
 		return fmt.Errorf("database schema version not handled: %v", dbVersion.Version)
 	}
@@ -715,7 +963,98 @@ func updateSQLiteDatabaseFromV21(dbHandle *sql.DB) error {
 }
 
 func updateSQLiteDatabaseFromV22(dbHandle *sql.DB) error {
-	return updateSQLiteDatabaseFrom22To23(dbHandle)
+	if err := updateSQLiteDatabaseFrom22To23(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV23(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV23(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom23To24(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV24(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom24To25(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV25(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom25To26(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV26(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom26To27(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV27(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom27To28(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV28(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom28To29(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV29(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom29To30(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV30(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom30To31(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV31(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom31To32(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV32(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom32To33(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV33(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom33To34(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV34(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := updateSQLiteDatabaseFrom34To35(dbHandle); err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV35(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV35(dbHandle *sql.DB) error {
+	return updateSQLiteDatabaseFrom35To36(dbHandle)
 }
 
 func downgradeSQLiteDatabaseFromV20(dbHandle *sql.DB) error {
@@ -743,6 +1082,97 @@ func downgradeSQLiteDatabaseFromV23(dbHandle *sql.DB) error {
 	return downgradeSQLiteDatabaseFromV22(dbHandle)
 }
 
+func downgradeSQLiteDatabaseFromV24(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom24To23(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV23(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV25(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom25To24(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV24(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV26(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom26To25(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV25(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV27(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom27To26(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV26(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV28(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom28To27(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV27(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV29(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom29To28(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV28(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV30(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom30To29(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV29(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV31(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom31To30(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV30(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV32(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom32To31(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV31(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV33(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom33To32(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV32(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV34(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom34To33(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV33(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV35(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom35To34(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV34(dbHandle)
+}
+
+func downgradeSQLiteDatabaseFromV36(dbHandle *sql.DB) error {
+	if err := downgradeSQLiteDatabaseFrom36To35(dbHandle); err != nil {
+		return err
+	}
+	return downgradeSQLiteDatabaseFromV35(dbHandle)
+}
+
 func updateSQLiteDatabaseFrom19To20(dbHandle *sql.DB) error {
 	logger.InfoToConsole("updating database schema version: 19 -> 20")
 	providerLog(logger.LevelInfo, "updating database schema version: 19 -> 20")
@@ -779,6 +1209,105 @@ func updateSQLiteDatabaseFrom22To23(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{`SELECT 1`}, 23, true)
 }
 
+func updateSQLiteDatabaseFrom23To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 23 -> 24")
+	providerLog(logger.LevelInfo, "updating database schema version: 23 -> 24")
+	sql := strings.ReplaceAll(sqliteV24SQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 24, true)
+}
+
+func updateSQLiteDatabaseFrom24To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 24 -> 25")
+	providerLog(logger.LevelInfo, "updating database schema version: 24 -> 25")
+	sql := strings.ReplaceAll(sqliteV25SQL, "{{shares}}", sqlTableShares)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 25, true)
+}
+
+func updateSQLiteDatabaseFrom25To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 25 -> 26")
+	providerLog(logger.LevelInfo, "updating database schema version: 25 -> 26")
+	sql := strings.ReplaceAll(sqliteV26SQL, "{{known_ips}}", sqlTableKnownIPs)
+	sql = strings.ReplaceAll(sql, "{{users}}", sqlTableUsers)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 26, true)
+}
+
+func updateSQLiteDatabaseFrom26To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 26 -> 27")
+	providerLog(logger.LevelInfo, "updating database schema version: 26 -> 27")
+	sql := strings.ReplaceAll(sqliteV27SQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 27, true)
+}
+
+func updateSQLiteDatabaseFrom27To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 27 -> 28")
+	providerLog(logger.LevelInfo, "updating database schema version: 27 -> 28")
+	sql := strings.ReplaceAll(sqliteV28SQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 28, true)
+}
+
+func updateSQLiteDatabaseFrom28To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 28 -> 29")
+	providerLog(logger.LevelInfo, "updating database schema version: 28 -> 29")
+	sql := strings.ReplaceAll(sqliteV29SQL, "{{content_index}}", sqlTableContentIndex)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 29, true)
+}
+
+func updateSQLiteDatabaseFrom29To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 29 -> 30")
+	providerLog(logger.LevelInfo, "updating database schema version: 29 -> 30")
+	sql := strings.ReplaceAll(sqliteV30SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 30, true)
+}
+
+func updateSQLiteDatabaseFrom30To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 30 -> 31")
+	providerLog(logger.LevelInfo, "updating database schema version: 30 -> 31")
+	sql := strings.ReplaceAll(sqliteV31SQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 31, true)
+}
+
+func updateSQLiteDatabaseFrom31To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 31 -> 32")
+	providerLog(logger.LevelInfo, "updating database schema version: 31 -> 32")
+	sql := strings.ReplaceAll(sqliteV32SQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 32, true)
+}
+
+func updateSQLiteDatabaseFrom32To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 32 -> 33")
+	providerLog(logger.LevelInfo, "updating database schema version: 32 -> 33")
+	sql := strings.ReplaceAll(sqliteV33SQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 33, true)
+}
+
+func updateSQLiteDatabaseFrom33To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 33 -> 34")
+	providerLog(logger.LevelInfo, "updating database schema version: 33 -> 34")
+	sql := strings.ReplaceAll(sqliteV34SQL, "{{users}}", sqlTableUsers)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 34, true)
+}
+
+func updateSQLiteDatabaseFrom34To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 34 -> 35")
+	providerLog(logger.LevelInfo, "updating database schema version: 34 -> 35")
+	sql := strings.ReplaceAll(sqliteV35SQL, "{{replications}}", sqlTableReplications)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 35, true)
+}
+
+func updateSQLiteDatabaseFrom35To36(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database schema version: 35 -> 36")
+	providerLog(logger.LevelInfo, "updating database schema version: 35 -> 36")
+	sql := strings.ReplaceAll(sqliteV36SQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 36, true)
+}
+
 func downgradeSQLiteDatabaseFrom20To19(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database schema version: 20 -> 19")
 	providerLog(logger.LevelInfo, "downgrading database schema version: 20 -> 19")
@@ -811,6 +1340,100 @@ func downgradeSQLiteDatabaseFrom23To22(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{`SELECT 1`}, 22, false)
 }
 
+func downgradeSQLiteDatabaseFrom24To23(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 24 -> 23")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 24 -> 23")
+	sql := strings.ReplaceAll(sqliteV24DownSQL, "{{api_keys}}", sqlTableAPIKeys)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 23, false)
+}
+
+func downgradeSQLiteDatabaseFrom25To24(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 25 -> 24")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 25 -> 24")
+	sql := strings.ReplaceAll(sqliteV25DownSQL, "{{shares}}", sqlTableShares)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 24, false)
+}
+
+func downgradeSQLiteDatabaseFrom26To25(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 26 -> 25")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 26 -> 25")
+	sql := strings.ReplaceAll(sqliteV26DownSQL, "{{known_ips}}", sqlTableKnownIPs)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 25, false)
+}
+
+func downgradeSQLiteDatabaseFrom27To26(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 27 -> 26")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 27 -> 26")
+	sql := strings.ReplaceAll(sqliteV27DownSQL, "{{folders}}", sqlTableFolders)
+	sql = strings.ReplaceAll(sql, "{{events_actions}}", sqlTableEventsActions)
+	sql = strings.ReplaceAll(sql, "{{prefix}}", config.SQLTablesPrefix)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 26, false)
+}
+
+func downgradeSQLiteDatabaseFrom28To27(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 28 -> 27")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 28 -> 27")
+	sql := strings.ReplaceAll(sqliteV28DownSQL, "{{groups}}", sqlTableGroups)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 27, false)
+}
+
+func downgradeSQLiteDatabaseFrom29To28(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 29 -> 28")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 29 -> 28")
+	sql := strings.ReplaceAll(sqliteV29DownSQL, "{{content_index}}", sqlTableContentIndex)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 28, false)
+}
+
+func downgradeSQLiteDatabaseFrom30To29(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 30 -> 29")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 30 -> 29")
+	sql := strings.ReplaceAll(sqliteV30DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 29, false)
+}
+
+func downgradeSQLiteDatabaseFrom31To30(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 31 -> 30")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 31 -> 30")
+	sql := strings.ReplaceAll(sqliteV31DownSQL, "{{folders}}", sqlTableFolders)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 30, false)
+}
+
+func downgradeSQLiteDatabaseFrom32To31(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 32 -> 31")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 32 -> 31")
+	sql := strings.ReplaceAll(sqliteV32DownSQL, "{{users_folders_mapping}}", sqlTableUsersFoldersMapping)
+	sql = strings.ReplaceAll(sql, "{{groups_folders_mapping}}", sqlTableGroupsFoldersMapping)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 31, false)
+}
+
+func downgradeSQLiteDatabaseFrom33To32(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 33 -> 32")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 33 -> 32")
+	sql := strings.ReplaceAll(sqliteV33DownSQL, "{{admins}}", sqlTableAdmins)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 32, false)
+}
+
+func downgradeSQLiteDatabaseFrom34To33(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 34 -> 33")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 34 -> 33")
+	sql := strings.ReplaceAll(sqliteV34DownSQL, "{{users}}", sqlTableUsers)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 33, false)
+}
+
+func downgradeSQLiteDatabaseFrom35To34(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 35 -> 34")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 35 -> 34")
+	sql := strings.ReplaceAll(sqliteV35DownSQL, "{{replications}}", sqlTableReplications)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 34, false)
+}
+
+func downgradeSQLiteDatabaseFrom36To35(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database schema version: 36 -> 35")
+	providerLog(logger.LevelInfo, "downgrading database schema version: 36 -> 35")
+	sql := strings.ReplaceAll(sqliteV36DownSQL, "{{upload_sessions}}", sqlTableUploadSessions)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 35, false)
+}
+
 /*func setPragmaFK(dbHandle *sql.DB, value string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
 	defer cancel()
@@ -26,14 +26,14 @@ const (
 	selectUserFields = "id,username,password,public_keys,home_dir,uid,gid,max_sessions,quota_size,quota_files,permissions,used_quota_size," +
 		"used_quota_files,last_quota_update,upload_bandwidth,download_bandwidth,expiration_date,last_login,status,filters,filesystem," +
 		"additional_info,description,email,created_at,updated_at,upload_data_transfer,download_data_transfer,total_data_transfer," +
-		"used_upload_data_transfer,used_download_data_transfer,deleted_at,first_download,first_upload"
-	selectFolderFields = "id,path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem"
-	selectAdminFields  = "id,username,password,status,email,permissions,filters,additional_info,description,created_at,updated_at,last_login"
-	selectAPIKeyFields = "key_id,name,api_key,scope,created_at,updated_at,last_use_at,expires_at,description,user_id,admin_id"
+		"used_upload_data_transfer,used_download_data_transfer,deleted_at,first_download,first_upload,last_quota_warning"
+	selectFolderFields = "id,path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem,updated_at,audit_log"
+	selectAdminFields  = "id,username,password,status,email,permissions,filters,additional_info,description,created_at,updated_at,last_login,locked"
+	selectAPIKeyFields = "key_id,name,api_key,scope,created_at,updated_at,last_use_at,expires_at,description,user_id,admin_id,filters"
 	selectShareFields  = "s.share_id,s.name,s.description,s.scope,s.paths,u.username,s.created_at,s.updated_at,s.last_use_at," +
-		"s.expires_at,s.password,s.max_tokens,s.used_tokens,s.allow_from"
-	selectGroupFields       = "id,name,description,created_at,updated_at,user_settings"
-	selectEventActionFields = "id,name,description,type,options"
+		"s.expires_at,s.password,s.max_tokens,s.used_tokens,s.allow_from,s.display_name,s.disposition"
+	selectGroupFields       = "id,name,description,created_at,updated_at,user_settings,parent_group"
+	selectEventActionFields = "id,name,description,type,options,updated_at"
 	selectMinimalFields     = "id,name"
 )
 
@@ -92,6 +92,15 @@ func getSessionQuery() string {
 		sqlPlaceholders[0])
 }
 
+func getSessionsQuery() string {
+	if config.Driver == MySQLDataProviderName {
+		return fmt.Sprintf("SELECT `key`,`data`,`type`,`timestamp` FROM %s WHERE `type` = %s AND `timestamp` > %s "+
+			"ORDER BY `timestamp` ASC", sqlTableSharedSessions, sqlPlaceholders[0], sqlPlaceholders[1])
+	}
+	return fmt.Sprintf(`SELECT key,data,type,timestamp FROM %s WHERE type = %s AND timestamp > %s ORDER BY timestamp ASC`,
+		sqlTableSharedSessions, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
 func getCleanupSessionsQuery() string {
 	return fmt.Sprintf(`DELETE from %s WHERE type = %s AND timestamp < %s`,
 		sqlTableSharedSessions, sqlPlaceholders[0], sqlPlaceholders[1])
@@ -219,24 +228,42 @@ func getUsersInGroupsQuery(numArgs int) string {
 	} else {
 		sb.WriteString("('')")
 	}
-	return fmt.Sprintf(`SELECT username FROM %s WHERE id IN (SELECT user_id from %s WHERE group_id IN (SELECT id FROM %s WHERE name IN (%s)))`,
+	return fmt.Sprintf(`SELECT username FROM %s WHERE id IN (SELECT user_id from %s WHERE group_id IN (SELECT id FROM %s WHERE name IN %s))`,
 		sqlTableUsers, sqlTableUsersGroupsMapping, getSQLQuotedName(sqlTableGroups), sb.String())
 }
 
+func getChildGroupsQuery(numArgs int) string {
+	var sb strings.Builder
+	for idx := 0; idx < numArgs; idx++ {
+		if sb.Len() == 0 {
+			sb.WriteString("(")
+		} else {
+			sb.WriteString(",")
+		}
+		sb.WriteString(sqlPlaceholders[idx])
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(")")
+	} else {
+		sb.WriteString("('')")
+	}
+	return fmt.Sprintf(`SELECT name FROM %s WHERE parent_group IN %s`, getSQLQuotedName(sqlTableGroups), sb.String())
+}
+
 func getDumpGroupsQuery() string {
 	return fmt.Sprintf(`SELECT %s FROM %s`, selectGroupFields, getSQLQuotedName(sqlTableGroups))
 }
 
 func getAddGroupQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (name,description,created_at,updated_at,user_settings)
-		VALUES (%s,%s,%s,%s,%s)`, getSQLQuotedName(sqlTableGroups), sqlPlaceholders[0], sqlPlaceholders[1],
-		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4])
+	return fmt.Sprintf(`INSERT INTO %s (name,description,created_at,updated_at,user_settings,parent_group)
+		VALUES (%s,%s,%s,%s,%s,%s)`, getSQLQuotedName(sqlTableGroups), sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5])
 }
 
 func getUpdateGroupQuery() string {
-	return fmt.Sprintf(`UPDATE %s SET description=%s,user_settings=%s,updated_at=%s
+	return fmt.Sprintf(`UPDATE %s SET description=%s,user_settings=%s,updated_at=%s,parent_group=%s
 		WHERE name = %s`, getSQLQuotedName(sqlTableGroups), sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
-		sqlPlaceholders[3])
+		sqlPlaceholders[3], sqlPlaceholders[4])
 }
 
 func getDeleteGroupQuery() string {
@@ -257,8 +284,8 @@ func getDumpAdminsQuery() string {
 }
 
 func getAddAdminQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (username,password,status,email,permissions,filters,additional_info,description,created_at,updated_at,last_login)
-		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0)`, sqlTableAdmins, sqlPlaceholders[0], sqlPlaceholders[1],
+	return fmt.Sprintf(`INSERT INTO %s (username,password,status,email,permissions,filters,additional_info,description,created_at,updated_at,last_login,locked)
+		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0,0)`, sqlTableAdmins, sqlPlaceholders[0], sqlPlaceholders[1],
 		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7],
 		sqlPlaceholders[8], sqlPlaceholders[9])
 }
@@ -294,27 +321,30 @@ func getDumpSharesQuery() string {
 
 func getAddShareQuery() string {
 	return fmt.Sprintf(`INSERT INTO %s (share_id,name,description,scope,paths,created_at,updated_at,last_use_at,
-		expires_at,password,max_tokens,used_tokens,allow_from,user_id) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)`,
+		expires_at,password,max_tokens,used_tokens,allow_from,user_id,display_name,disposition)
+		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)`,
 		sqlTableShares, sqlPlaceholders[0], sqlPlaceholders[1],
 		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6],
 		sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9], sqlPlaceholders[10], sqlPlaceholders[11],
-		sqlPlaceholders[12], sqlPlaceholders[13])
+		sqlPlaceholders[12], sqlPlaceholders[13], sqlPlaceholders[14], sqlPlaceholders[15])
 }
 
 func getUpdateShareRestoreQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET name=%s,description=%s,scope=%s,paths=%s,created_at=%s,updated_at=%s,
-		last_use_at=%s,expires_at=%s,password=%s,max_tokens=%s,used_tokens=%s,allow_from=%s,user_id=%s WHERE share_id = %s`, sqlTableShares,
+		last_use_at=%s,expires_at=%s,password=%s,max_tokens=%s,used_tokens=%s,allow_from=%s,user_id=%s,
+		display_name=%s,disposition=%s WHERE share_id = %s`, sqlTableShares,
 		sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
 		sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9],
-		sqlPlaceholders[10], sqlPlaceholders[11], sqlPlaceholders[12], sqlPlaceholders[13])
+		sqlPlaceholders[10], sqlPlaceholders[11], sqlPlaceholders[12], sqlPlaceholders[13], sqlPlaceholders[14],
+		sqlPlaceholders[15])
 }
 
 func getUpdateShareQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET name=%s,description=%s,scope=%s,paths=%s,updated_at=%s,expires_at=%s,
-		password=%s,max_tokens=%s,allow_from=%s,user_id=%s WHERE share_id = %s`, sqlTableShares,
-		sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
-		sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9],
-		sqlPlaceholders[10])
+		password=%s,max_tokens=%s,allow_from=%s,user_id=%s,display_name=%s,disposition=%s WHERE share_id = %s`,
+		sqlTableShares, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8],
+		sqlPlaceholders[9], sqlPlaceholders[10], sqlPlaceholders[11], sqlPlaceholders[12])
 }
 
 func getDeleteShareQuery() string {
@@ -335,16 +365,17 @@ func getDumpAPIKeysQuery() string {
 }
 
 func getAddAPIKeyQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (key_id,name,api_key,scope,created_at,updated_at,last_use_at,expires_at,description,user_id,admin_id)
-		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)`, sqlTableAPIKeys, sqlPlaceholders[0], sqlPlaceholders[1],
+	return fmt.Sprintf(`INSERT INTO %s (key_id,name,api_key,scope,created_at,updated_at,last_use_at,expires_at,description,user_id,admin_id,filters)
+		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)`, sqlTableAPIKeys, sqlPlaceholders[0], sqlPlaceholders[1],
 		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6],
-		sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9], sqlPlaceholders[10])
+		sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9], sqlPlaceholders[10], sqlPlaceholders[11])
 }
 
 func getUpdateAPIKeyQuery() string {
-	return fmt.Sprintf(`UPDATE %s SET name=%s,scope=%s,expires_at=%s,user_id=%s,admin_id=%s,description=%s,updated_at=%s
-		WHERE key_id = %s`, sqlTableAPIKeys, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
-		sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7])
+	return fmt.Sprintf(`UPDATE %s SET name=%s,scope=%s,expires_at=%s,user_id=%s,admin_id=%s,description=%s,updated_at=%s,
+		filters=%s WHERE key_id = %s`, sqlTableAPIKeys, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
+		sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7],
+		sqlPlaceholders[8])
 }
 
 func getDeleteAPIKeyQuery() string {
@@ -398,9 +429,79 @@ func getUserByUsernameQuery() string {
 		selectUserFields, sqlTableUsers, sqlPlaceholders[0])
 }
 
-func getUsersQuery(order string) string {
-	return fmt.Sprintf(`SELECT %s FROM %s WHERE deleted_at = 0 ORDER BY username %s LIMIT %s OFFSET %s`,
-		selectUserFields, sqlTableUsers, order, sqlPlaceholders[0], sqlPlaceholders[1])
+func getUsersQuery(order string, numPatterns int) string {
+	var sb strings.Builder
+	for idx := 0; idx < numPatterns; idx++ {
+		if sb.Len() == 0 {
+			sb.WriteString(" AND (")
+		} else {
+			sb.WriteString(" OR ")
+		}
+		switch config.Driver {
+		case SQLiteDataProviderName:
+			sb.WriteString("username GLOB ")
+		case MySQLDataProviderName:
+			sb.WriteString("CAST(username AS BINARY) LIKE ")
+		default:
+			sb.WriteString("username LIKE ")
+		}
+		sb.WriteString(sqlPlaceholders[idx])
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(")")
+	}
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE deleted_at = 0%s ORDER BY username %s LIMIT %s OFFSET %s`,
+		selectUserFields, sqlTableUsers, sb.String(), order, sqlPlaceholders[numPatterns], sqlPlaceholders[numPatterns+1])
+}
+
+// getSQLUsernamePattern converts a shell like pattern, supporting "*" and "?"
+// wildcards, to a pattern usable in a case sensitive SQL match. SQLite uses GLOB,
+// the other databases LIKE with the default backslash escape character
+func getSQLUsernamePattern(pattern string) string {
+	var sb strings.Builder
+	isGlob := config.Driver == SQLiteDataProviderName
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if isGlob {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteByte('%')
+			}
+			continue
+		case '?':
+			if isGlob {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteByte('_')
+			}
+			continue
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				c = pattern[i]
+			}
+		}
+		// literal character
+		if isGlob {
+			switch c {
+			case '*', '?', '[':
+				sb.WriteByte('[')
+				sb.WriteByte(c)
+				sb.WriteByte(']')
+			default:
+				sb.WriteByte(c)
+			}
+		} else {
+			switch c {
+			case '%', '_', '\\':
+				sb.WriteByte('\\')
+			}
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
 }
 
 func getUsersForQuotaCheckQuery(numArgs int) string {
@@ -453,6 +554,12 @@ func getUpdateQuotaQuery(reset bool) string {
 		WHERE username = %s`, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
 }
 
+func getReserveQuotaFileQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET used_quota_files = used_quota_files + 1,last_quota_update = %s
+		WHERE username = %s AND used_quota_files < %s`, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2])
+}
+
 func getSetUpdateAtQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET updated_at = %s WHERE username = %s`, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1])
 }
@@ -475,6 +582,26 @@ func getUpdateAdminLastLoginQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET last_login = %s WHERE username = %s`, sqlTableAdmins, sqlPlaceholders[0], sqlPlaceholders[1])
 }
 
+func getIncreaseQuotaWarningQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET last_quota_warning = %s WHERE username = %s AND last_quota_warning < %s`,
+		sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getDecreaseQuotaWarningQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET last_quota_warning = %s WHERE username = %s AND last_quota_warning > %s`,
+		sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getSetAdminLockedQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET locked = %s,updated_at = %s WHERE username = %s`, sqlTableAdmins, sqlPlaceholders[0],
+		sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getUpdateAPIKeySecretQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET api_key = %s,updated_at = %s WHERE key_id = %s`, sqlTableAPIKeys,
+		sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
 func getUpdateAPIKeyLastUseQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET last_use_at = %s WHERE key_id = %s`, sqlTableAPIKeys, sqlPlaceholders[0], sqlPlaceholders[1])
 }
@@ -494,8 +621,8 @@ func getAddUserQuery() string {
 	return fmt.Sprintf(`INSERT INTO %s (username,password,public_keys,home_dir,uid,gid,max_sessions,quota_size,quota_files,permissions,
 		used_quota_size,used_quota_files,last_quota_update,upload_bandwidth,download_bandwidth,status,last_login,expiration_date,filters,
 		filesystem,additional_info,description,email,created_at,updated_at,upload_data_transfer,download_data_transfer,total_data_transfer,
-		used_upload_data_transfer,used_download_data_transfer,deleted_at,first_download,first_upload)
-		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0,0,0,%s,%s,%s,0,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0,0,0,0,0)`,
+		used_upload_data_transfer,used_download_data_transfer,deleted_at,first_download,first_upload,last_quota_warning)
+		VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0,0,0,%s,%s,%s,0,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,0,0,0,0,0,0)`,
 		sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
 		sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9],
 		sqlPlaceholders[10], sqlPlaceholders[11], sqlPlaceholders[12], sqlPlaceholders[13], sqlPlaceholders[14],
@@ -536,14 +663,16 @@ func getFolderByNameQuery() string {
 }
 
 func getAddFolderQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem)
-		VALUES (%s,%s,%s,%s,%s,%s,%s)`, sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
-		sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6])
+	return fmt.Sprintf(`INSERT INTO %s (path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem,
+		updated_at,audit_log) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s)`, sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7],
+		sqlPlaceholders[8])
 }
 
 func getUpdateFolderQuery() string {
-	return fmt.Sprintf(`UPDATE %s SET path=%s,description=%s,filesystem=%s WHERE name = %s`, sqlTableFolders, sqlPlaceholders[0],
-		sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+	return fmt.Sprintf(`UPDATE %s SET path=%s,description=%s,filesystem=%s,updated_at=%s,audit_log=%s WHERE name = %s`,
+		sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
+		sqlPlaceholders[5])
 }
 
 func getDeleteFolderQuery() string {
@@ -553,15 +682,17 @@ func getDeleteFolderQuery() string {
 func getUpsertFolderQuery() string {
 	if config.Driver == MySQLDataProviderName {
 		return fmt.Sprintf("INSERT INTO %s (`path`,`used_quota_size`,`used_quota_files`,`last_quota_update`,`name`,"+
-			"`description`,`filesystem`) VALUES (%s,%s,%s,%s,%s,%s,%s) ON DUPLICATE KEY UPDATE "+
-			"`path`=VALUES(`path`),`description`=VALUES(`description`),`filesystem`=VALUES(`filesystem`)",
+			"`description`,`filesystem`,`updated_at`,`audit_log`) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s) ON DUPLICATE KEY UPDATE "+
+			"`path`=VALUES(`path`),`description`=VALUES(`description`),`filesystem`=VALUES(`filesystem`),"+
+			"`updated_at`=VALUES(`updated_at`),`audit_log`=VALUES(`audit_log`)",
 			sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
-			sqlPlaceholders[5], sqlPlaceholders[6])
+			sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8])
 	}
-	return fmt.Sprintf(`INSERT INTO %s (path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem)
-		VALUES (%s,%s,%s,%s,%s,%s,%s) ON CONFLICT (name) DO UPDATE SET path = EXCLUDED.path,description=EXCLUDED.description,
-		filesystem=EXCLUDED.filesystem`, sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
-		sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6])
+	return fmt.Sprintf(`INSERT INTO %s (path,used_quota_size,used_quota_files,last_quota_update,name,description,filesystem,
+		updated_at,audit_log) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s) ON CONFLICT (name) DO UPDATE SET path = EXCLUDED.path,
+		description=EXCLUDED.description,filesystem=EXCLUDED.filesystem,updated_at=EXCLUDED.updated_at,
+		audit_log=EXCLUDED.audit_log`, sqlTableFolders, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2],
+		sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8])
 }
 
 func getClearUserGroupMappingQuery() string {
@@ -594,10 +725,10 @@ func getClearGroupFolderMappingQuery() string {
 }
 
 func getAddGroupFolderMappingQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (virtual_path,quota_size,quota_files,folder_id,group_id)
-		VALUES (%s,%s,%s,(SELECT id FROM %s WHERE name = %s),(SELECT id FROM %s WHERE name = %s))`,
-		sqlTableGroupsFoldersMapping, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlTableFolders,
-		sqlPlaceholders[3], getSQLQuotedName(sqlTableGroups), sqlPlaceholders[4])
+	return fmt.Sprintf(`INSERT INTO %s (virtual_path,quota_size,quota_files,read_only,folder_id,group_id)
+		VALUES (%s,%s,%s,%s,(SELECT id FROM %s WHERE name = %s),(SELECT id FROM %s WHERE name = %s))`,
+		sqlTableGroupsFoldersMapping, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlTableFolders, sqlPlaceholders[4], getSQLQuotedName(sqlTableGroups), sqlPlaceholders[5])
 }
 
 func getClearUserFolderMappingQuery() string {
@@ -606,10 +737,10 @@ func getClearUserFolderMappingQuery() string {
 }
 
 func getAddUserFolderMappingQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (virtual_path,quota_size,quota_files,folder_id,user_id)
-		VALUES (%s,%s,%s,(SELECT id FROM %s WHERE name = %s),(SELECT id FROM %s WHERE username = %s))`,
-		sqlTableUsersFoldersMapping, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlTableFolders,
-		sqlPlaceholders[3], sqlTableUsers, sqlPlaceholders[4])
+	return fmt.Sprintf(`INSERT INTO %s (virtual_path,quota_size,quota_files,read_only,folder_id,user_id)
+		VALUES (%s,%s,%s,%s,(SELECT id FROM %s WHERE name = %s),(SELECT id FROM %s WHERE username = %s))`,
+		sqlTableUsersFoldersMapping, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlTableFolders, sqlPlaceholders[4], sqlTableUsers, sqlPlaceholders[5])
 }
 
 func getFoldersQuery(order string, minimal bool) string {
@@ -685,7 +816,7 @@ func getRelatedFoldersForUsersQuery(users []User) string {
 		sb.WriteString(")")
 	}
 	return fmt.Sprintf(`SELECT f.id,f.name,f.path,f.used_quota_size,f.used_quota_files,f.last_quota_update,fm.virtual_path,
-		fm.quota_size,fm.quota_files,fm.user_id,f.filesystem,f.description FROM %s f INNER JOIN %s fm ON f.id = fm.folder_id WHERE
+		fm.quota_size,fm.quota_files,fm.read_only,fm.user_id,f.filesystem,f.description,f.audit_log FROM %s f INNER JOIN %s fm ON f.id = fm.folder_id WHERE
 		fm.user_id IN %s ORDER BY fm.user_id`, sqlTableFolders, sqlTableUsersFoldersMapping, sb.String())
 }
 
@@ -772,7 +903,7 @@ func getRelatedFoldersForGroupsQuery(groups []Group) string {
 		sb.WriteString(")")
 	}
 	return fmt.Sprintf(`SELECT f.id,f.name,f.path,f.used_quota_size,f.used_quota_files,f.last_quota_update,fm.virtual_path,
-		fm.quota_size,fm.quota_files,fm.group_id,f.filesystem,f.description FROM %s f INNER JOIN %s fm ON f.id = fm.folder_id WHERE
+		fm.quota_size,fm.quota_files,fm.read_only,fm.group_id,f.filesystem,f.description,f.audit_log FROM %s f INNER JOIN %s fm ON f.id = fm.folder_id WHERE
 		fm.group_id IN %s ORDER BY fm.group_id`, sqlTableFolders, sqlTableGroupsFoldersMapping, sb.String())
 }
 
@@ -842,13 +973,15 @@ func getEventActionByNameQuery() string {
 }
 
 func getAddEventActionQuery() string {
-	return fmt.Sprintf(`INSERT INTO %s (name,description,type,options) VALUES (%s,%s,%s,%s)`,
-		sqlTableEventsActions, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+	return fmt.Sprintf(`INSERT INTO %s (name,description,type,options,updated_at) VALUES (%s,%s,%s,%s,%s)`,
+		sqlTableEventsActions, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4])
 }
 
 func getUpdateEventActionQuery() string {
-	return fmt.Sprintf(`UPDATE %s SET description=%s,type=%s,options=%s WHERE name = %s`, sqlTableEventsActions,
-		sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+	return fmt.Sprintf(`UPDATE %s SET description=%s,type=%s,options=%s,updated_at=%s WHERE name = %s`,
+		sqlTableEventsActions, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4])
 }
 
 func getDeleteEventActionQuery() string {
@@ -984,6 +1117,87 @@ func getNodesQuery() string {
 		sqlTableNodes, sqlPlaceholders[0], sqlPlaceholders[1])
 }
 
+func getKnownIPLastSeenQuery() string {
+	return fmt.Sprintf(`SELECT k.last_seen FROM %s k INNER JOIN %s u ON k.user_id = u.id WHERE u.username = %s AND k.ip = %s`,
+		sqlTableKnownIPs, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getAddKnownIPQuery() string {
+	return fmt.Sprintf(`INSERT INTO %s (user_id,ip,first_seen,last_seen) VALUES ((SELECT id FROM %s WHERE username = %s),%s,%s,%s)`,
+		sqlTableKnownIPs, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+}
+
+func getUpdateKnownIPQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET last_seen = %s WHERE ip = %s AND user_id = (SELECT id FROM %s WHERE username = %s)`,
+		sqlTableKnownIPs, sqlPlaceholders[0], sqlPlaceholders[1], sqlTableUsers, sqlPlaceholders[2])
+}
+
+func getCleanupKnownIPsQuery() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE last_seen < %s`, sqlTableKnownIPs, sqlPlaceholders[0])
+}
+
+const selectContentEntryFields = "storage_id,path,hash,size,is_dir,mtime"
+
+func getContentEntryQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE storage_id = %s AND path = %s`, selectContentEntryFields,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getContentEntriesQuery(dirName string, recursive bool) string {
+	if !recursive {
+		return fmt.Sprintf(`SELECT %s FROM %s WHERE storage_id = %s AND parent = %s ORDER BY path`,
+			selectContentEntryFields, sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+	}
+	if dirName == "" {
+		return fmt.Sprintf(`SELECT %s FROM %s WHERE storage_id = %s ORDER BY path`,
+			selectContentEntryFields, sqlTableContentIndex, sqlPlaceholders[0])
+	}
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE storage_id = %s AND path LIKE %s ESCAPE '!' ORDER BY path`,
+		selectContentEntryFields, sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getAddContentEntryQuery() string {
+	return fmt.Sprintf(`INSERT INTO %s (storage_id,path,parent,hash,size,is_dir,mtime) VALUES (%s,%s,%s,%s,%s,%s,%s)`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6])
+}
+
+func getUpdateContentEntryQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET hash = %s,size = %s,is_dir = %s,mtime = %s WHERE storage_id = %s AND path = %s`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4], sqlPlaceholders[5])
+}
+
+func getContentEntriesToRenameQuery() string {
+	return fmt.Sprintf(`SELECT id,path FROM %s WHERE storage_id = %s AND (path = %s OR path LIKE %s ESCAPE '!')`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getRenameContentEntryQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET path = %s,parent = %s WHERE id = %s`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getDeleteContentEntryQuery() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE storage_id = %s AND path = %s`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getContentHashesQuery() string {
+	return fmt.Sprintf(`SELECT DISTINCT hash FROM %s WHERE storage_id = %s AND is_dir = 0`,
+		sqlTableContentIndex, sqlPlaceholders[0])
+}
+
+func getContentReferenceQuery() string {
+	return fmt.Sprintf(`SELECT id FROM %s WHERE storage_id = %s AND hash = %s LIMIT 1`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getDeleteContentEntriesByHashQuery() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE storage_id = %s AND hash = %s AND is_dir = 0`,
+		sqlTableContentIndex, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
 func getCleanupNodesQuery() string {
 	return fmt.Sprintf(`DELETE FROM %s WHERE updated_at < %s`, sqlTableNodes, sqlPlaceholders[0])
 }
@@ -995,3 +1209,152 @@ func getDatabaseVersionQuery() string {
 func getUpdateDBVersionQuery() string {
 	return fmt.Sprintf(`UPDATE %s SET version=%s`, sqlTableSchemaVersion, sqlPlaceholders[0])
 }
+
+func getCreateOnlineMigrationsTableQuery() string {
+	if config.Driver == MySQLDataProviderName {
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (`version` integer NOT NULL PRIMARY KEY, "+
+			"`status` varchar(20) NOT NULL, `step` integer NOT NULL, `steps` integer NOT NULL, `error` longtext NULL, "+
+			"`created_at` bigint NOT NULL, `updated_at` bigint NOT NULL)", sqlTableOnlineMigrations)
+	}
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" ("version" integer NOT NULL PRIMARY KEY,
+"status" varchar(20) NOT NULL, "step" integer NOT NULL, "steps" integer NOT NULL, "error" text NULL,
+"created_at" bigint NOT NULL, "updated_at" bigint NOT NULL)`, sqlTableOnlineMigrations)
+}
+
+func getOnlineMigrationQuery() string {
+	return fmt.Sprintf(`SELECT status,step,steps,error,created_at,updated_at FROM %s WHERE version = %s`,
+		sqlTableOnlineMigrations, sqlPlaceholders[0])
+}
+
+func getOnlineMigrationStatusQuery() string {
+	return fmt.Sprintf(`SELECT status FROM %s WHERE version = %s`, sqlTableOnlineMigrations, sqlPlaceholders[0])
+}
+
+func getOnlineMigrationsQuery() string {
+	return fmt.Sprintf(`SELECT version,status,step,steps,error,created_at,updated_at FROM %s ORDER BY version ASC`,
+		sqlTableOnlineMigrations)
+}
+
+func getAddOnlineMigrationQuery() string {
+	return fmt.Sprintf(`INSERT INTO %s (version,status,step,steps,created_at,updated_at) VALUES (%s,%s,%s,%s,%s,%s)`,
+		sqlTableOnlineMigrations, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4], sqlPlaceholders[5])
+}
+
+func getUpdateOnlineMigrationQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET status=%s,step=%s,error=%s,updated_at=%s WHERE version = %s`,
+		sqlTableOnlineMigrations, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4])
+}
+
+func getPauseOnlineMigrationQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET status=%s,updated_at=%s WHERE version = %s AND status = %s`,
+		sqlTableOnlineMigrations, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+}
+
+func getColumnExistsQuery() string {
+	schema := "current_schema()"
+	if config.Driver == MySQLDataProviderName {
+		schema = "DATABASE()"
+	}
+	return fmt.Sprintf(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = %s AND table_name = %s AND column_name = %s`,
+		schema, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getIndexExistsQuery() string {
+	if config.Driver == MySQLDataProviderName {
+		return fmt.Sprintf(`SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = %s AND index_name = %s`,
+			sqlPlaceholders[0], sqlPlaceholders[1])
+	}
+	return fmt.Sprintf(`SELECT COUNT(*) FROM pg_indexes WHERE schemaname = current_schema() AND tablename = %s AND indexname = %s`,
+		sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+const selectUploadSessionFields = "upload_id,username,path,started_at,last_seen_at,uploaded_bytes,total_bytes," +
+	"backend_token,parts"
+
+func getUploadSessionQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE username = %s AND path = %s`, selectUploadSessionFields,
+		sqlTableUploadSessions, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getUploadSessionByIDQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE upload_id = %s`, selectUploadSessionFields,
+		sqlTableUploadSessions, sqlPlaceholders[0])
+}
+
+func getUploadSessionsQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE username = %s ORDER BY started_at`, selectUploadSessionFields,
+		sqlTableUploadSessions, sqlPlaceholders[0])
+}
+
+func getStaleUploadSessionsQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE last_seen_at < %s`, selectUploadSessionFields,
+		sqlTableUploadSessions, sqlPlaceholders[0])
+}
+
+func getAddUploadSessionQuery() string {
+	return fmt.Sprintf(`INSERT INTO %s (upload_id,username,path,started_at,last_seen_at,uploaded_bytes,total_bytes,
+backend_token,parts,lease_owner,lease_expires_at) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s)`, sqlTableUploadSessions,
+		sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4],
+		sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9],
+		sqlPlaceholders[10])
+}
+
+func getUpdateUploadSessionQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET last_seen_at = %s,uploaded_bytes = %s,total_bytes = %s,parts = %s
+WHERE upload_id = %s AND lease_owner = %s`, sqlTableUploadSessions, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5])
+}
+
+func getClaimUploadSessionQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET lease_owner = %s,lease_expires_at = %s WHERE upload_id = %s
+AND (lease_owner = %s OR lease_expires_at < %s)`, sqlTableUploadSessions, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4])
+}
+
+func getReleaseUploadSessionQuery() string {
+	return fmt.Sprintf(`UPDATE %s SET lease_owner = '',lease_expires_at = 0 WHERE upload_id = %s AND lease_owner = %s`,
+		sqlTableUploadSessions, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getDeleteUploadSessionQuery() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE upload_id = %s`, sqlTableUploadSessions, sqlPlaceholders[0])
+}
+
+const selectReplicationFields = "username,path,destination_bucket,status,attempts,last_error,created_at,updated_at," +
+	"next_retry_at"
+
+func getReplicationStatusQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE username = %s AND path = %s`, selectReplicationFields,
+		sqlTableReplications, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getReplicationsToRetryQuery() string {
+	return fmt.Sprintf(`SELECT %s FROM %s WHERE next_retry_at > 0 AND next_retry_at <= %s ORDER BY next_retry_at`,
+		selectReplicationFields, sqlTableReplications, sqlPlaceholders[0])
+}
+
+func getSetReplicationStatusQuery() string {
+	if config.Driver == MySQLDataProviderName {
+		return fmt.Sprintf("INSERT INTO %s (`username`,`path`,`destination_bucket`,`status`,`attempts`,`last_error`,"+
+			"`created_at`,`updated_at`,`next_retry_at`) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s) ON DUPLICATE KEY UPDATE "+
+			"`destination_bucket`=VALUES(`destination_bucket`),`status`=VALUES(`status`),`attempts`=VALUES(`attempts`),"+
+			"`last_error`=VALUES(`last_error`),`created_at`=VALUES(`created_at`),`updated_at`=VALUES(`updated_at`),"+
+			"`next_retry_at`=VALUES(`next_retry_at`)",
+			sqlTableReplications, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+			sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8])
+	}
+	return fmt.Sprintf(`INSERT INTO %s (username,path,destination_bucket,status,attempts,last_error,created_at,
+updated_at,next_retry_at) VALUES (%s,%s,%s,%s,%s,%s,%s,%s,%s) ON CONFLICT(username,path) DO UPDATE SET
+destination_bucket=EXCLUDED.destination_bucket,status=EXCLUDED.status,attempts=EXCLUDED.attempts,
+last_error=EXCLUDED.last_error,created_at=EXCLUDED.created_at,updated_at=EXCLUDED.updated_at,
+next_retry_at=EXCLUDED.next_retry_at`, sqlTableReplications, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6],
+		sqlPlaceholders[7], sqlPlaceholders[8])
+}
+
+func getDeleteReplicationStatusQuery() string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE username = %s AND path = %s`, sqlTableReplications,
+		sqlPlaceholders[0], sqlPlaceholders[1])
+}
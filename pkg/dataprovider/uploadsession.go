@@ -0,0 +1,188 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+var isCleaningUploadSessions atomic.Bool
+
+// uploadSessionStore implements vfs.UploadSessionStore using the configured data provider
+type uploadSessionStore struct{}
+
+func (*uploadSessionStore) AddUploadSession(session *vfs.UploadSession, owner string, leaseExpiresAt int64) error {
+	return provider.addUploadSession(session, owner, leaseExpiresAt)
+}
+
+func (*uploadSessionStore) UpdateUploadSession(session *vfs.UploadSession, owner string) error {
+	return convertNotFoundError(provider.updateUploadSession(session, owner))
+}
+
+func (*uploadSessionStore) GetUploadSession(username, virtualPath string) (vfs.UploadSession, error) {
+	session, err := provider.getUploadSession(username, virtualPath)
+	return session, convertNotFoundError(err)
+}
+
+func (*uploadSessionStore) DeleteUploadSession(id string) error {
+	return convertNotFoundError(provider.deleteUploadSession(id))
+}
+
+func (*uploadSessionStore) ClaimUploadSession(id, owner string, leaseExpiresAt int64) error {
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	return convertNotFoundError(provider.claimUploadSession(id, owner, leaseExpiresAt, now))
+}
+
+func (*uploadSessionStore) ReleaseUploadSession(id, owner string) error {
+	return convertNotFoundError(provider.releaseUploadSession(id, owner))
+}
+
+// uploadSessionLease defines the owner of an upload session. The bolt and
+// memory providers cannot be shared among multiple instances, so they keep
+// the leases in memory
+type uploadSessionLease struct {
+	owner     string
+	expiresAt int64
+}
+
+// uploadSessionLeases maps the upload ID to the session lease, it is not
+// safe for concurrent use
+type uploadSessionLeases map[string]uploadSessionLease
+
+func (l uploadSessionLeases) claim(id, owner string, leaseExpiresAt, now int64) bool {
+	if lease, ok := l[id]; ok && lease.owner != owner && lease.expiresAt >= now {
+		return false
+	}
+	l[id] = uploadSessionLease{
+		owner:     owner,
+		expiresAt: leaseExpiresAt,
+	}
+	return true
+}
+
+func (l uploadSessionLeases) isOwner(id, owner string) bool {
+	return l[id].owner == owner
+}
+
+func (l uploadSessionLeases) release(id, owner string) {
+	if l.isOwner(id, owner) {
+		delete(l, id)
+	}
+}
+
+// GetUploadSessions returns the resumable upload sessions for the specified user
+func GetUploadSessions(username string) ([]vfs.UploadSession, error) {
+	username = config.convertName(username)
+	return provider.getUploadSessions(username)
+}
+
+// AbortUploadSession aborts the resumable upload session with the specified
+// id, the session must belong to the specified user
+func AbortUploadSession(username, id string) error {
+	username = config.convertName(username)
+	session, err := provider.getUploadSessionByID(id)
+	if err != nil {
+		return err
+	}
+	if session.Username != username {
+		return util.NewRecordNotFoundError(fmt.Sprintf("upload session %q does not exist", id))
+	}
+	return abortUploadSession(&session)
+}
+
+// abortUploadSession releases the backend resources for the specified session
+// and removes it. Sessions for users that no longer exist are simply removed
+func abortUploadSession(session *vfs.UploadSession) error {
+	user, err := GetUserWithGroupSettings(session.Username)
+	if err != nil {
+		if errors.Is(err, util.ErrNotFound) {
+			providerLog(logger.LevelDebug, "removing upload session %q for missing user %q", session.ID,
+				session.Username)
+			return removeUploadSession(session)
+		}
+		return err
+	}
+	defer user.CloseFs() //nolint:errcheck
+
+	fs, err := user.GetFilesystemForPath(session.Path, fmt.Sprintf("upload_session_%s", xid.New().String()))
+	if err != nil {
+		return err
+	}
+	aborter, ok := fs.(vfs.FsUploadSessionAborter)
+	if !ok {
+		// the filesystem configuration changed, the backend resources, if any,
+		// will be removed by the storage lifecycle rules
+		providerLog(logger.LevelWarn, "unable to abort upload session %q, resumable uploads are not supported "+
+			"for path %q, user %q", session.ID, session.Path, session.Username)
+		return removeUploadSession(session)
+	}
+	return aborter.AbortUploadSession(session)
+}
+
+// removeUploadSession removes the specified session without releasing the
+// backend resources, sessions in use are not removed
+func removeUploadSession(session *vfs.UploadSession) error {
+	now := time.Now()
+	leaseExpiresAt := util.GetTimeAsMsSinceEpoch(now.Add(time.Minute))
+	err := provider.claimUploadSession(session.ID, xid.New().String(), leaseExpiresAt, util.GetTimeAsMsSinceEpoch(now))
+	if err != nil {
+		return err
+	}
+	return provider.deleteUploadSession(session.ID)
+}
+
+// cleanupUploadSessions aborts the resumable upload sessions not updated
+// within the configured max age
+func cleanupUploadSessions() {
+	if config.UploadSessionsMaxAge <= 0 {
+		return
+	}
+	if !isCleaningUploadSessions.CompareAndSwap(false, true) {
+		providerLog(logger.LevelDebug, "upload sessions cleanup already in progress")
+		return
+	}
+	defer isCleaningUploadSessions.Store(false)
+
+	cutoff := util.GetTimeAsMsSinceEpoch(time.Now().Add(-time.Duration(config.UploadSessionsMaxAge) * time.Hour))
+	sessions, err := provider.getStaleUploadSessions(cutoff)
+	if err != nil {
+		providerLog(logger.LevelError, "unable to get stale upload sessions: %v", err)
+		return
+	}
+	for idx := range sessions {
+		session := &sessions[idx]
+		if err := abortUploadSession(session); err != nil {
+			if errors.Is(err, vfs.ErrUploadSessionInUse) {
+				providerLog(logger.LevelDebug, "stale upload session %q is in use, user %q path %q", session.ID,
+					session.Username, session.Path)
+				continue
+			}
+			providerLog(logger.LevelError, "unable to abort stale upload session %q, user %q path %q: %v",
+				session.ID, session.Username, session.Path, err)
+		} else {
+			providerLog(logger.LevelInfo, "stale upload session %q aborted, user %q path %q", session.ID,
+				session.Username, session.Path)
+		}
+	}
+}
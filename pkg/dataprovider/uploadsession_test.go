@@ -0,0 +1,146 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package dataprovider
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+func TestUploadSessionStore(t *testing.T) {
+	withTestProviders(t, func(t *testing.T) {
+		store := &uploadSessionStore{}
+		session := vfs.UploadSession{
+			ID:           "id1",
+			Username:     "user",
+			Path:         "/dir/file.dat",
+			StartedAt:    100,
+			LastSeenAt:   100,
+			BackendToken: "token1",
+		}
+		leaseExpiresAt := util.GetTimeAsMsSinceEpoch(time.Now().Add(time.Minute))
+		require.NoError(t, store.AddUploadSession(&session, "owner1", leaseExpiresAt))
+		// a single session is allowed for each path
+		duplicated := session
+		duplicated.ID = "id2"
+		assert.Error(t, store.AddUploadSession(&duplicated, "owner1", leaseExpiresAt))
+
+		_, err := store.GetUploadSession("user", "/dir/missing.dat")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = store.GetUploadSession("otheruser", session.Path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		stored, err := store.GetUploadSession("user", session.Path)
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, stored.ID)
+		assert.Equal(t, session.BackendToken, stored.BackendToken)
+		assert.Len(t, stored.Parts, 0)
+		// the parts are updated, the session identity cannot be changed
+		stored.AddPart(vfs.UploadSessionPart{Number: 1, ETag: `"etag1"`, Size: 10})
+		stored.AddPart(vfs.UploadSessionPart{Number: 2, ETag: `"etag2"`, Size: 5})
+		stored.LastSeenAt = 200
+		stored.Path = "/dir/other.dat"
+		stored.BackendToken = "token2"
+		// only the lease owner can update the session
+		assert.ErrorIs(t, store.UpdateUploadSession(&stored, "owner2"), os.ErrNotExist)
+		require.NoError(t, store.UpdateUploadSession(&stored, "owner1"))
+		stored, err = store.GetUploadSession("user", session.Path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(15), stored.UploadedBytes)
+		assert.Equal(t, int64(200), stored.LastSeenAt)
+		assert.Equal(t, session.BackendToken, stored.BackendToken)
+		assert.Equal(t, []vfs.UploadSessionPart{
+			{Number: 1, ETag: `"etag1"`, Size: 10},
+			{Number: 2, ETag: `"etag2"`, Size: 5},
+		}, stored.Parts)
+		_, err = store.GetUploadSession("user", "/dir/other.dat")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		missing := stored
+		missing.ID = "missing"
+		err = store.UpdateUploadSession(&missing, "owner1")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		err = store.ClaimUploadSession(missing.ID, "owner1", leaseExpiresAt)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		sessions, err := GetUploadSessions("user")
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, session.ID, sessions[0].ID)
+		sessions, err = provider.getStaleUploadSessions(200)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 0)
+		sessions, err = provider.getStaleUploadSessions(201)
+		require.NoError(t, err)
+		assert.Len(t, sessions, 1)
+
+		require.NoError(t, store.DeleteUploadSession(session.ID))
+		err = store.ClaimUploadSession(session.ID, "owner1", leaseExpiresAt)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		err = store.DeleteUploadSession(session.ID)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = store.GetUploadSession("user", session.Path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		// the path can be used for a new session
+		require.NoError(t, store.AddUploadSession(&duplicated, "", 0))
+		require.NoError(t, store.DeleteUploadSession(duplicated.ID))
+	})
+}
+
+func TestUploadSessionLeases(t *testing.T) {
+	withTestProviders(t, func(t *testing.T) {
+		store := &uploadSessionStore{}
+		session := vfs.UploadSession{
+			ID:           "id1",
+			Username:     "user",
+			Path:         "/file.dat",
+			StartedAt:    100,
+			LastSeenAt:   100,
+			BackendToken: "token1",
+		}
+		getLeaseExpiration := func(d time.Duration) int64 {
+			return util.GetTimeAsMsSinceEpoch(time.Now().Add(d))
+		}
+		require.NoError(t, store.AddUploadSession(&session, "owner1", getLeaseExpiration(time.Minute)))
+		// the lease can be renewed by the owner only
+		assert.NoError(t, store.ClaimUploadSession(session.ID, "owner1", getLeaseExpiration(2*time.Minute)))
+		err := store.ClaimUploadSession(session.ID, "owner2", getLeaseExpiration(time.Minute))
+		assert.ErrorIs(t, err, vfs.ErrUploadSessionInUse)
+		// releasing a lease owned by someone else has no effect
+		assert.NoError(t, store.ReleaseUploadSession(session.ID, "owner2"))
+		err = store.ClaimUploadSession(session.ID, "owner2", getLeaseExpiration(time.Minute))
+		assert.ErrorIs(t, err, vfs.ErrUploadSessionInUse)
+		assert.NoError(t, store.ReleaseUploadSession(session.ID, "owner1"))
+		assert.NoError(t, store.ClaimUploadSession(session.ID, "owner2", getLeaseExpiration(-time.Second)))
+		// the lease is expired and it can be claimed by another owner
+		assert.NoError(t, store.ClaimUploadSession(session.ID, "owner1", getLeaseExpiration(time.Minute)))
+		assert.ErrorIs(t, store.UpdateUploadSession(&session, "owner2"), os.ErrNotExist)
+		assert.NoError(t, store.UpdateUploadSession(&session, "owner1"))
+		err = AbortUploadSession("user", session.ID)
+		assert.ErrorIs(t, err, vfs.ErrUploadSessionInUse)
+
+		require.NoError(t, store.DeleteUploadSession(session.ID))
+		// a new session with the same ID is not claimed
+		require.NoError(t, store.AddUploadSession(&session, "", 0))
+		assert.NoError(t, store.ClaimUploadSession(session.ID, "owner2", getLeaseExpiration(time.Minute)))
+		require.NoError(t, store.DeleteUploadSession(session.ID))
+	})
+}
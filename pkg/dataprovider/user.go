@@ -22,10 +22,12 @@ import (
 	"net"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/shlex"
 	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
 
@@ -88,10 +90,56 @@ const (
 	LoginMethodIDP                    = "IDP"
 )
 
+// TLSUsernameSAN defines that the username must match one of the DNS names
+// or email addresses included in the subject alternative names of the TLS
+// client certificate
+const TLSUsernameSAN sdk.TLSUsername = "SubjectAltName"
+
+// Supported file name sanitization modes
+const (
+	// file names are not checked
+	FileNameSanitizeNone = "none"
+	// control characters are removed from file names
+	FileNameSanitizeStripControl = "strip_control"
+	// characters not allowed by the storage backend are replaced with "_"
+	FileNameSanitizeReplace = "replace"
+	// file names with characters not allowed by the storage backend are rejected
+	FileNameSanitizeReject = "reject"
+)
+
+// Supported per-user upload modes
+const (
+	// use the global upload mode
+	UploadModeDefault = "default"
+	// files are written directly to the requested path
+	UploadModeDirectStream = "direct_stream"
+	// files are written to a temporary path and renamed to the requested
+	// path when the upload ends
+	UploadModeTempFile = "temp_file"
+)
+
+// Supported directory listing orders
+const (
+	DirListOrderNameAsc   = "name_asc"
+	DirListOrderNameDesc  = "name_desc"
+	DirListOrderMtimeAsc  = "mtime_asc"
+	DirListOrderMtimeDesc = "mtime_desc"
+	DirListOrderSizeAsc   = "size_asc"
+	DirListOrderSizeDesc  = "size_desc"
+)
+
 var (
 	errNoMatchingVirtualFolder = errors.New("no matching virtual folder found")
 	permsRenameAny             = []string{PermRename, PermRenameDirs, PermRenameFiles}
 	permsDeleteAny             = []string{PermDelete, PermDeleteDirs, PermDeleteFiles}
+	// ValidFileNameSanitizeModes defines the supported file name sanitization modes
+	ValidFileNameSanitizeModes = []string{FileNameSanitizeNone, FileNameSanitizeStripControl, FileNameSanitizeReplace,
+		FileNameSanitizeReject}
+	// ValidUploadModes defines the supported per-user upload modes
+	ValidUploadModes = []string{UploadModeDefault, UploadModeDirectStream, UploadModeTempFile}
+	// ValidDirListOrders defines the supported directory listing orders
+	ValidDirListOrders = []string{DirListOrderNameAsc, DirListOrderNameDesc, DirListOrderMtimeAsc,
+		DirListOrderMtimeDesc, DirListOrderSizeAsc, DirListOrderSizeDesc}
 )
 
 // RecoveryCode defines a 2FA recovery code
@@ -115,6 +163,85 @@ type UserTOTPConfig struct {
 	Protocols []string `json:"protocols,omitempty"`
 }
 
+// PathUploadLimit defines the maximum upload file size for a virtual path
+// and its subdirectories
+type PathUploadLimit struct {
+	// Virtual path, for example "/incoming"
+	Path string `json:"path"`
+	// Maximum allowed size, as bytes, for a single file upload. 0 means unlimited
+	MaxUploadFileSize int64 `json:"max_upload_file_size"`
+}
+
+// UserSSHExec defines the commands a user can run using the SSH exec channel
+type UserSSHExec struct {
+	// Allowed command lines as exact match or glob patterns, for example
+	// "git-upload-pack *". Patterns are split into arguments as a shell would do
+	// and each pattern argument must match a single command argument: "*" matches
+	// any sequence of characters within the argument, "?" matches any single character
+	AllowedCommands []string `json:"allowed_commands,omitempty"`
+	// Virtual paths the SCP command can read from and write to, subdirectories
+	// included. Empty means no restrictions
+	AllowedSCPPaths []string `json:"allowed_scp_paths,omitempty"`
+}
+
+// IsAllowed returns true if the specified command and arguments match an allowed command
+func (e *UserSSHExec) IsAllowed(name string, args []string) bool {
+	command := append([]string{name}, args...)
+	for _, pattern := range e.AllowedCommands {
+		parts, err := shlex.Split(pattern)
+		if err != nil || len(parts) != len(command) {
+			continue
+		}
+		if isSSHExecPatternMatch(parts, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSCPPathAllowed returns true if the SCP command can access the specified virtual path
+func (e *UserSSHExec) IsSCPPathAllowed(virtualPath string) bool {
+	if len(e.AllowedSCPPaths) == 0 {
+		return true
+	}
+	virtualPath = path.Clean(virtualPath)
+	for _, allowedPath := range e.AllowedSCPPaths {
+		if allowedPath == "/" || virtualPath == allowedPath || strings.HasPrefix(virtualPath, allowedPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isSSHExecPatternMatch(patterns, command []string) bool {
+	for idx, pattern := range patterns {
+		if pattern == command[idx] {
+			continue
+		}
+		matched, err := regexp.MatchString(getSSHExecPatternRegexp(pattern), command[idx])
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func getSSHExecPatternRegexp(pattern string) string {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, `\*`, ".*")
+	re = strings.ReplaceAll(re, `\?`, ".")
+	return "^" + re + "$"
+}
+
+// PathAlias maps a virtual path to another virtual path inside the same user's tree.
+// An alias works like a symbolic link resolved server side
+type PathAlias struct {
+	// Alias virtual path, for example "/current"
+	Path string `json:"path"`
+	// Virtual path the alias points to, for example "/archive/2024"
+	Target string `json:"target"`
+}
+
 // UserFilters defines additional restrictions for a user
 // TODO: rename to UserOptions in v3
 type UserFilters struct {
@@ -125,6 +252,73 @@ type UserFilters struct {
 	// Each code can only be used once, you should use these codes to login and disable or
 	// reset 2FA for your account
 	RecoveryCodes []RecoveryCode `json:"recovery_codes,omitempty"`
+	// Allow SSH TCP port forwarding, both local (direct-tcpip) and remote (tcpip-forward)
+	AllowTCPForwarding bool `json:"allow_tcp_forwarding,omitempty"`
+	// Allowed forwarding targets in the format "CIDR:port", for example "10.0.0.0/8:22".
+	// Use "*" as port to allow any port. For remote forwarding the patterns apply to
+	// the requested bind address
+	AllowedForwardTargets []string `json:"allowed_forward_targets,omitempty"`
+	// Commands the user can run using the SSH exec channel. They are executed
+	// without a shell, inside the home directory, for local filesystem users only
+	SSHExec UserSSHExec `json:"ssh_exec,omitempty"`
+	// Per-path upload size limits. The most specific path wins and
+	// overrides the global max_upload_file_size setting
+	PathUploadLimits []PathUploadLimit `json:"path_upload_limits,omitempty"`
+	// File name sanitization mode, it overrides the global setting.
+	// Empty means use the global setting
+	FileNameSanitize string `json:"file_name_sanitize,omitempty"`
+	// Order for FTP and WebDAV directory listings, it overrides the global setting.
+	// Empty means use the global setting
+	DirListOrder string `json:"dir_list_order,omitempty"`
+	// List the directories before the files. Ignored if DirListOrder is empty
+	DirListDirsFirst bool `json:"dir_list_dirs_first,omitempty"`
+	// Maximum number of entries in a directory to allow the upload of new files.
+	// 0 means no limit
+	MaxFilesPerDir int `json:"max_files_per_dir,omitempty"`
+	// Maximum number of files that can be open at the same time within
+	// a single SFTP session. 0 means no limit
+	MaxOpenHandles int `json:"max_open_handles,omitempty"`
+	// Maximum number of active sessions for the tokens issued by the
+	// user token API. The oldest session is revoked when the limit is
+	// exceeded. 0 means no limit
+	MaxActiveSessions int `json:"max_active_sessions,omitempty"`
+	// Burst sizes, as bytes, for the upload and download bandwidth limits.
+	// An idle connection can transfer up to the burst size at line speed and
+	// is then throttled to the configured bandwidth. 0 means no burst
+	UploadBurstSize   int64 `json:"upload_burst_size,omitempty"`
+	DownloadBurstSize int64 `json:"download_burst_size,omitempty"`
+	// Allow the admins to impersonate this user in the REST API, for example
+	// to diagnose issues as the user sees them. nil means allowed, users can
+	// opt out by setting it to false
+	AllowImpersonation *bool `json:"allow_impersonation,omitempty"`
+	// Allow to authenticate to the REST API using access tokens issued by the
+	// configured external OAuth2 authorization server
+	AllowExternalTokenAuth bool `json:"allow_external_token_auth,omitempty"`
+	// Path aliases, they are resolved before any filesystem access so
+	// permissions, file patterns and quota apply to the target path
+	PathAliases []PathAlias `json:"path_aliases,omitempty"`
+	// Upload mode, it overrides the global setting.
+	// Empty means use the global setting
+	UploadMode string `json:"upload_mode,omitempty"`
+	// Metadata for the public keys, such as their registration date.
+	// They are automatically updated when the public keys change
+	PublicKeysInfo []PublicKeyInfo `json:"public_keys_info,omitempty"`
+	// Email notifications for successful logins
+	LoginNotification LoginNotification `json:"login_notification,omitempty"`
+	// Quota usage percentages that trigger a warning email, for example 80, 90, 95.
+	// An email is sent when a new threshold is crossed
+	QuotaWarningThresholds []int `json:"quota_warning_thresholds,omitempty"`
+	// Temporary login block after too many consecutive failed login attempts
+	LoginCooldown LoginCooldown `json:"login_cooldown,omitempty"`
+	// Rules to redirect the uploads to a different virtual path.
+	// The rules are applied in order, the first matching rule wins
+	PathRewriteRules []PathRewrite `json:"path_rewrite_rules,omitempty"`
+	// Automatic extraction of the uploaded ZIP files
+	AutoExtract AutoExtractConfig `json:"auto_extract,omitempty"`
+	// Max age and min retention for the files inside the specified paths
+	DataRetentionPolicy DataRetentionPolicy `json:"data_retention_policy,omitempty"`
+	// Threshold based rules to detect unusual file access patterns
+	AnomalyRules []AnomalyRule `json:"anomaly_rules,omitempty"`
 }
 
 // User defines a SFTPGo user
@@ -142,8 +336,12 @@ type User struct {
 	fsCache map[string]vfs.Fs `json:"-"`
 	// true if group settings are already applied for this user
 	groupSettingsApplied bool `json:"-"`
+	// true if the password can be set even if it does not satisfy the password policy
+	skipPasswordPolicy bool `json:"-"`
 	// in multi node setups we mark the user as deleted to be able to update the webdav cache
 	DeletedAt int64 `json:"-"`
+	// Last quota warning threshold notified via email, 0 means none
+	LastQuotaWarning int `json:"last_quota_warning,omitempty"`
 }
 
 // GetFilesystem returns the base filesystem for this user
@@ -154,9 +352,13 @@ func (u *User) GetFilesystem(connectionID string) (fs vfs.Fs, err error) {
 func (u *User) getRootFs(connectionID string) (fs vfs.Fs, err error) {
 	switch u.FsConfig.Provider {
 	case sdk.S3FilesystemProvider:
-		return vfs.NewS3Fs(connectionID, u.GetHomeDir(), "", u.FsConfig.S3Config)
+		config := u.FsConfig.S3Config
+		config.SetUsername(u.Username)
+		return vfs.NewS3Fs(connectionID, u.GetHomeDir(), "", config)
 	case sdk.GCSFilesystemProvider:
-		return vfs.NewGCSFs(connectionID, u.GetHomeDir(), "", u.FsConfig.GCSConfig)
+		config := u.FsConfig.GCSConfig
+		config.SetUsername(u.Username)
+		return vfs.NewGCSFs(connectionID, u.GetHomeDir(), "", config)
 	case sdk.AzureBlobFilesystemProvider:
 		return vfs.NewAzBlobFs(connectionID, u.GetHomeDir(), "", u.FsConfig.AzBlobConfig)
 	case sdk.CryptedFilesystemProvider:
@@ -171,7 +373,7 @@ func (u *User) getRootFs(connectionID string) (fs vfs.Fs, err error) {
 	case sdk.HTTPFilesystemProvider:
 		return vfs.NewHTTPFs(connectionID, u.GetHomeDir(), "", u.FsConfig.HTTPConfig)
 	default:
-		return vfs.NewOsFs(connectionID, u.GetHomeDir(), ""), nil
+		return vfs.NewOsFsWithConfig(connectionID, u.GetHomeDir(), "", u.FsConfig.OSConfig), nil
 	}
 }
 
@@ -460,6 +662,42 @@ func (u *User) IsTLSUsernameVerificationEnabled() bool {
 	return false
 }
 
+// IsForwardTargetAllowed returns true if TCP port forwarding is allowed for
+// the specified IP address and port
+func (u *User) IsForwardTargetAllowed(ip net.IP, port int) bool {
+	if !u.Filters.AllowTCPForwarding || ip == nil {
+		return false
+	}
+	for _, target := range u.Filters.AllowedForwardTargets {
+		ipNet, allowedPort, err := parseForwardTarget(target)
+		if err != nil {
+			continue
+		}
+		if ipNet.Contains(ip) && (allowedPort == 0 || allowedPort == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMaxUploadFileSize returns the maximum allowed size for a single file
+// upload to the specified virtual path. The most specific path upload limit,
+// if any, overrides the global limit. 0 means unlimited
+func (u *User) GetMaxUploadFileSize(virtualPath string) int64 {
+	maxSize := u.Filters.MaxUploadFileSize
+	matchedLen := -1
+	for _, limit := range u.Filters.PathUploadLimits {
+		if limit.Path != "/" && virtualPath != limit.Path && !strings.HasPrefix(virtualPath, limit.Path+"/") {
+			continue
+		}
+		if len(limit.Path) > matchedLen {
+			matchedLen = len(limit.Path)
+			maxSize = limit.MaxUploadFileSize
+		}
+	}
+	return maxSize
+}
+
 // SetEmptySecrets sets to empty any user secret
 func (u *User) SetEmptySecrets() {
 	u.FsConfig.SetEmptySecrets()
@@ -470,9 +708,78 @@ func (u *User) SetEmptySecrets() {
 	u.Filters.TOTPConfig.Secret = kms.NewEmptySecret()
 }
 
+// SetOIDCTokenSource sets the source for the OpenID Connect access token to the
+// user filesystem and to the virtual folders filesystems
+func (u *User) SetOIDCTokenSource(source vfs.OIDCTokenSource) {
+	u.FsConfig.SetOIDCTokenSource(source)
+	for idx := range u.VirtualFolders {
+		folder := &u.VirtualFolders[idx]
+		folder.FsConfig.SetOIDCTokenSource(source)
+	}
+}
+
+// getPathAlias returns the most specific alias matching the specified virtual path
+func (u *User) getPathAlias(virtualPath string) (PathAlias, bool) {
+	var result PathAlias
+	for _, alias := range u.Filters.PathAliases {
+		if virtualPath != alias.Path && !strings.HasPrefix(virtualPath, alias.Path+"/") {
+			continue
+		}
+		if len(alias.Path) > len(result.Path) {
+			result = alias
+		}
+	}
+	return result, result.Path != ""
+}
+
+// IsPathAlias returns true if the specified virtual path is a path alias
+func (u *User) IsPathAlias(virtualPath string) bool {
+	for _, alias := range u.Filters.PathAliases {
+		if virtualPath == alias.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePathAlias returns the virtual path obtained by resolving the path aliases,
+// if any, for the specified virtual path
+func (u *User) ResolvePathAlias(virtualPath string) string {
+	// aliases cannot have cycles, this is checked while saving the user,
+	// limiting the iterations is just an additional safety measure
+	for idx := 0; idx <= len(u.Filters.PathAliases); idx++ {
+		alias, ok := u.getPathAlias(virtualPath)
+		if !ok {
+			return virtualPath
+		}
+		virtualPath = path.Join(alias.Target, strings.TrimPrefix(virtualPath, alias.Path))
+	}
+	return virtualPath
+}
+
 // GetPermissionsForPath returns the permissions for the given path.
-// The path must be a SFTPGo exposed path
+// The path must be a SFTPGo exposed path.
+// Inside read-only virtual folders only the read permissions are returned
 func (u *User) GetPermissionsForPath(p string) []string {
+	p = u.ResolvePathAlias(p)
+	permissions := u.getPermissionsForPath(p)
+	if u.IsReadOnlyPath(p) {
+		return getReadOnlyPermissions(permissions)
+	}
+	return permissions
+}
+
+func getReadOnlyPermissions(permissions []string) []string {
+	var result []string
+	for _, perm := range []string{PermListItems, PermDownload} {
+		if util.Contains(permissions, PermAny) || util.Contains(permissions, perm) {
+			result = append(result, perm)
+		}
+	}
+	return result
+}
+
+func (u *User) getPermissionsForPath(p string) []string {
 	permissions := []string{}
 	if perms, ok := u.Permissions["/"]; ok {
 		// if only root permissions are defined returns them unconditionally
@@ -559,6 +866,12 @@ func (u *User) GetFilesystemForPath(virtualPath, connectionID string) (vfs.Fs, e
 				}
 				forbiddenSelfUsers = append(forbiddenSelfUsers, forbiddens...)
 			}
+			switch folder.FsConfig.Provider {
+			case sdk.GCSFilesystemProvider:
+				folder.FsConfig.GCSConfig.SetUsername(u.Username)
+			case sdk.S3FilesystemProvider:
+				folder.FsConfig.S3Config.SetUsername(u.Username)
+			}
 			fs, err := folder.GetFilesystem(connectionID, forbiddenSelfUsers)
 			if err == nil {
 				u.fsCache[folder.VirtualPath] = fs
@@ -585,7 +898,7 @@ func (u *User) GetVirtualFolderForPath(virtualPath string) (vfs.VirtualFolder, e
 	if len(u.VirtualFolders) == 0 {
 		return folder, errNoMatchingVirtualFolder
 	}
-	dirsForPath := util.GetDirsForVirtualPath(virtualPath)
+	dirsForPath := util.GetDirsForVirtualPath(u.ResolvePathAlias(virtualPath))
 	for index := range dirsForPath {
 		for idx := range u.VirtualFolders {
 			v := &u.VirtualFolders[idx]
@@ -597,6 +910,22 @@ func (u *User) GetVirtualFolderForPath(virtualPath string) (vfs.VirtualFolder, e
 	return folder, errNoMatchingVirtualFolder
 }
 
+// IsReadOnlyPath returns true if the specified virtual path is inside a read-only virtual folder
+func (u *User) IsReadOnlyPath(virtualPath string) bool {
+	hasReadOnlyFolders := false
+	for idx := range u.VirtualFolders {
+		if u.VirtualFolders[idx].ReadOnly {
+			hasReadOnlyFolders = true
+			break
+		}
+	}
+	if !hasReadOnlyFolders {
+		return false
+	}
+	folder, err := u.GetVirtualFolderForPath(virtualPath)
+	return err == nil && folder.ReadOnly
+}
+
 // CheckMetadataConsistency checks the consistency between the metadata stored
 // in the configured metadata plugin and the filesystem
 func (u *User) CheckMetadataConsistency() error {
@@ -647,6 +976,37 @@ func (u *User) ScanQuota() (int, int64, error) {
 	return numFiles, size, nil
 }
 
+// ScanDiskUsage returns the number of files and the real disk usage for the
+// user home dir and the virtual folders included in the user quota.
+// Unlike ScanQuota symbolic links to files are resolved and files with
+// multiple hard links are counted once, for each filesystem, on local filesystems
+func (u *User) ScanDiskUsage() (int, int64, error) {
+	fs, err := u.getRootFs(xid.New().String())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fs.Close()
+
+	numFiles, size, err := vfs.ScanDiskUsage(fs)
+	if err != nil {
+		return numFiles, size, err
+	}
+	for idx := range u.VirtualFolders {
+		v := &u.VirtualFolders[idx]
+		if !v.IsIncludedInUserQuota() {
+			continue
+		}
+		num, s, err := v.ScanDiskUsage()
+		if err != nil {
+			return numFiles, size, err
+		}
+		numFiles += num
+		size += s
+	}
+
+	return numFiles, size, nil
+}
+
 // GetVirtualFoldersInPath returns the virtual folders inside virtualPath including
 // any parents
 func (u *User) GetVirtualFoldersInPath(virtualPath string) map[string]bool {
@@ -683,7 +1043,7 @@ func (u *User) GetVirtualFoldersInPath(virtualPath string) map[string]bool {
 }
 
 func (u *User) hasVirtualDirs() bool {
-	if u.Filters.StartDirectory != "" {
+	if u.Filters.StartDirectory != "" || len(u.Filters.PathAliases) > 0 {
 		return true
 	}
 	numFolders := len(u.VirtualFolders)
@@ -693,15 +1053,22 @@ func (u *User) hasVirtualDirs() bool {
 	return numFolders > 0
 }
 
-// FilterListDir adds virtual folders and remove hidden items from the given files list
+// FilterListDir adds virtual folders and path aliases and remove hidden items from the given files list
 func (u *User) FilterListDir(dirContents []os.FileInfo, virtualPath string) []os.FileInfo {
+	virtualPath = u.ResolvePathAlias(virtualPath)
 	filter := u.getPatternsFilterForPath(virtualPath)
 	if !u.hasVirtualDirs() && filter.DenyPolicy != sdk.DenyPolicyHide {
 		return dirContents
 	}
 
 	vdirs := make(map[string]bool)
-	for dir := range u.GetVirtualFoldersInPath(virtualPath) {
+	virtualDirs := u.GetVirtualFoldersInPath(virtualPath)
+	for _, alias := range u.Filters.PathAliases {
+		if u.ResolvePathAlias(path.Dir(alias.Path)) == virtualPath {
+			virtualDirs[alias.Path] = true
+		}
+	}
+	for dir := range virtualDirs {
 		dirName := path.Base(dir)
 		if filter.DenyPolicy == sdk.DenyPolicyHide {
 			if !filter.CheckAllowed(dirName) {
@@ -1010,6 +1377,7 @@ func (u *User) isDirHidden(virtualPath string) bool {
 // IsFileAllowed returns true if the specified file is allowed by the file restrictions filters.
 // The second parameter returned is the deny policy
 func (u *User) IsFileAllowed(virtualPath string) (bool, int) {
+	virtualPath = u.ResolvePathAlias(virtualPath)
 	dirPath := path.Dir(virtualPath)
 	if u.isDirHidden(dirPath) {
 		return false, sdk.DenyPolicyHide
@@ -1026,6 +1394,11 @@ func (u *User) CanManageMFA() bool {
 	return len(mfa.GetAvailableTOTPConfigs()) > 0
 }
 
+// hasLocalHomeDir returns true if the user files are stored inside the home directory
+func (u *User) hasLocalHomeDir() bool {
+	return u.FsConfig.Provider == sdk.LocalFilesystemProvider || u.FsConfig.Provider == sdk.CryptedFilesystemProvider
+}
+
 func (u *User) isExternalAuthCached() bool {
 	if u.ID <= 0 {
 		return false
@@ -1057,6 +1430,12 @@ func (u *User) CanChangeAPIKeyAuth() bool {
 	return !util.Contains(u.Filters.WebClient, sdk.WebClientAPIKeyAuthChangeDisabled)
 }
 
+// IsImpersonationAllowed returns true if the admins can impersonate this user,
+// impersonation is allowed unless the user opted out
+func (u *User) IsImpersonationAllowed() bool {
+	return u.Filters.AllowImpersonation == nil || *u.Filters.AllowImpersonation
+}
+
 // CanChangeInfo returns true if this user is allowed to change its info such as email and description
 func (u *User) CanChangeInfo() bool {
 	return !util.Contains(u.Filters.WebClient, sdk.WebClientInfoChangeDisabled)
@@ -1498,6 +1877,33 @@ func (u *User) GetAllowedIPAsString() string {
 	return strings.Join(u.Filters.AllowedIP, ",")
 }
 
+// GetSSHExecAllowedCommandsAsString returns the commands allowed using the
+// SSH exec channel, one per line
+func (u *User) GetSSHExecAllowedCommandsAsString() string {
+	return strings.Join(u.Filters.SSHExec.AllowedCommands, "\n")
+}
+
+// GetSSHExecAllowedSCPPathsAsString returns the virtual paths the SCP
+// command can access, one per line
+func (u *User) GetSSHExecAllowedSCPPathsAsString() string {
+	return strings.Join(u.Filters.SSHExec.AllowedSCPPaths, "\n")
+}
+
+// GetAllowedForwardTargetsAsString returns the allowed TCP forwarding targets
+// as comma separated string
+func (u *User) GetAllowedForwardTargetsAsString() string {
+	return strings.Join(u.Filters.AllowedForwardTargets, ",")
+}
+
+// GetQuotaWarningThresholdsAsString returns the quota warning thresholds as comma separated string
+func (u *User) GetQuotaWarningThresholdsAsString() string {
+	thresholds := make([]string, 0, len(u.Filters.QuotaWarningThresholds))
+	for _, threshold := range u.Filters.QuotaWarningThresholds {
+		thresholds = append(thresholds, strconv.Itoa(threshold))
+	}
+	return strings.Join(thresholds, ",")
+}
+
 // GetDeniedIPAsString returns the denied IP as comma separated string
 func (u *User) GetDeniedIPAsString() string {
 	return strings.Join(u.Filters.DeniedIP, ",")
@@ -1633,6 +2039,10 @@ func (u *User) LoadAndApplyGroupSettings() error {
 	if err != nil {
 		return fmt.Errorf("unable to get groups: %w", err)
 	}
+	// the group hierarchy is expanded once, when the user is loaded
+	for idx := range groups {
+		groups[idx] = expandGroupHierarchy(groups[idx], provider.groupExists)
+	}
 	replacer := u.getGroupPlacehodersReplacer()
 	// make sure to always merge with the primary group first
 	for idx, g := range groups {
@@ -1828,6 +2238,12 @@ func (u *User) removeDuplicatesAfterGroupMerge() {
 	u.groupSettingsApplied = true
 }
 
+// SkipPasswordPolicy allows to save a password that does not satisfy the
+// configured password policy, a warning is logged
+func (u *User) SkipPasswordPolicy() {
+	u.skipPasswordPolicy = true
+}
+
 func (u *User) getACopy() User {
 	u.SetEmptySecretsIfNil()
 	pubKeys := make([]string, len(u.PublicKeys))
@@ -1858,6 +2274,53 @@ func (u *User) getACopy() User {
 	filters.TOTPConfig.Secret = u.Filters.TOTPConfig.Secret.Clone()
 	filters.TOTPConfig.Protocols = make([]string, len(u.Filters.TOTPConfig.Protocols))
 	copy(filters.TOTPConfig.Protocols, u.Filters.TOTPConfig.Protocols)
+	filters.AllowTCPForwarding = u.Filters.AllowTCPForwarding
+	filters.AllowedForwardTargets = make([]string, len(u.Filters.AllowedForwardTargets))
+	copy(filters.AllowedForwardTargets, u.Filters.AllowedForwardTargets)
+	filters.SSHExec.AllowedCommands = make([]string, len(u.Filters.SSHExec.AllowedCommands))
+	copy(filters.SSHExec.AllowedCommands, u.Filters.SSHExec.AllowedCommands)
+	filters.SSHExec.AllowedSCPPaths = make([]string, len(u.Filters.SSHExec.AllowedSCPPaths))
+	copy(filters.SSHExec.AllowedSCPPaths, u.Filters.SSHExec.AllowedSCPPaths)
+	filters.PathUploadLimits = make([]PathUploadLimit, len(u.Filters.PathUploadLimits))
+	copy(filters.PathUploadLimits, u.Filters.PathUploadLimits)
+	filters.FileNameSanitize = u.Filters.FileNameSanitize
+	filters.DirListOrder = u.Filters.DirListOrder
+	filters.DirListDirsFirst = u.Filters.DirListDirsFirst
+	filters.MaxFilesPerDir = u.Filters.MaxFilesPerDir
+	filters.MaxOpenHandles = u.Filters.MaxOpenHandles
+	filters.MaxActiveSessions = u.Filters.MaxActiveSessions
+	filters.UploadBurstSize = u.Filters.UploadBurstSize
+	filters.DownloadBurstSize = u.Filters.DownloadBurstSize
+	if u.Filters.AllowImpersonation != nil {
+		allowImpersonation := *u.Filters.AllowImpersonation
+		filters.AllowImpersonation = &allowImpersonation
+	}
+	filters.AllowExternalTokenAuth = u.Filters.AllowExternalTokenAuth
+	filters.LoginNotification = u.Filters.LoginNotification
+	filters.LoginCooldown = u.Filters.LoginCooldown
+	filters.QuotaWarningThresholds = make([]int, len(u.Filters.QuotaWarningThresholds))
+	copy(filters.QuotaWarningThresholds, u.Filters.QuotaWarningThresholds)
+	filters.UploadMode = u.Filters.UploadMode
+	filters.PathAliases = make([]PathAlias, len(u.Filters.PathAliases))
+	copy(filters.PathAliases, u.Filters.PathAliases)
+	filters.AutoExtract = u.Filters.AutoExtract
+	filters.AutoExtract.NotifyEmails = make([]string, len(u.Filters.AutoExtract.NotifyEmails))
+	copy(filters.AutoExtract.NotifyEmails, u.Filters.AutoExtract.NotifyEmails)
+	filters.DataRetentionPolicy = u.Filters.DataRetentionPolicy.getACopy()
+	filters.AnomalyRules = make([]AnomalyRule, len(u.Filters.AnomalyRules))
+	copy(filters.AnomalyRules, u.Filters.AnomalyRules)
+	filters.PathRewriteRules = make([]PathRewrite, 0, len(u.Filters.PathRewriteRules))
+	for _, rule := range u.Filters.PathRewriteRules {
+		protocols := make([]string, len(rule.Protocols))
+		copy(protocols, rule.Protocols)
+		filters.PathRewriteRules = append(filters.PathRewriteRules, PathRewrite{
+			Pattern:     rule.Pattern,
+			Replacement: rule.Replacement,
+			Protocols:   protocols,
+		})
+	}
+	filters.PublicKeysInfo = make([]PublicKeyInfo, len(u.Filters.PublicKeysInfo))
+	copy(filters.PublicKeysInfo, u.Filters.PublicKeysInfo)
 	filters.RecoveryCodes = make([]RecoveryCode, 0, len(u.Filters.RecoveryCodes))
 	for _, code := range u.Filters.RecoveryCodes {
 		if code.Secret == nil {
@@ -1907,6 +2370,7 @@ func (u *User) getACopy() User {
 		VirtualFolders:       virtualFolders,
 		Groups:               groups,
 		FsConfig:             u.FsConfig.GetACopy(),
+		LastQuotaWarning:     u.LastQuotaWarning,
 		groupSettingsApplied: u.groupSettingsApplied,
 	}
 }
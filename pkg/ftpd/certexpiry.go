@@ -0,0 +1,88 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ftpd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	certificateExpiryCheckInterval = 12 * time.Hour
+	certificateExpiryEvent         = "Certificate expiry"
+)
+
+var certificateExpiryCheckOnce sync.Once
+
+// checkCertificatesExpiry triggers a certificate event for each loaded certificate
+// expiring within the specified days and returns the number of expiring certificates.
+// The check is independent from the ACME renewals, it also applies to the certificates
+// renewed outside SFTPGo
+func checkCertificatesExpiry(mgr *common.CertManager, warningDays int) int {
+	expiring := 0
+	for _, info := range mgr.GetCertificatesInfo() {
+		notAfter := util.GetTimeFromMsecSinceEpoch(info.NotAfter)
+		remaining := time.Until(notAfter)
+		if remaining > time.Duration(warningDays)*24*time.Hour {
+			continue
+		}
+		expiring++
+		name := info.ID
+		if len(info.DNSNames) > 0 {
+			name = strings.Join(info.DNSNames, ",")
+		}
+		var err error
+		if remaining <= 0 {
+			err = fmt.Errorf("the FTP TLS certificate %q, id %q, expired on %s", name, info.ID,
+				notAfter.UTC().Format(time.RFC3339))
+		} else {
+			err = fmt.Errorf("the FTP TLS certificate %q, id %q, expires in %d days, on %s", name, info.ID,
+				int(remaining.Hours()/24), notAfter.UTC().Format(time.RFC3339))
+		}
+		logger.Warn(logSender, "", "%v", err)
+		params := common.EventParams{
+			Name:      name,
+			Event:     certificateExpiryEvent,
+			Status:    2,
+			Timestamp: time.Now().UnixNano(),
+		}
+		params.AddError(err)
+		common.HandleCertificateEvent(params)
+	}
+	return expiring
+}
+
+// startCertificateExpiryCheck checks the loaded certificates now and then periodically
+func startCertificateExpiryCheck(mgr *common.CertManager, warningDays int) {
+	certificateExpiryCheckOnce.Do(func() {
+		logger.Info(logSender, "", "starting TLS certificates expiry check, warning days: %d", warningDays)
+		checkCertificatesExpiry(mgr, warningDays)
+
+		go func() {
+			ticker := time.NewTicker(certificateExpiryCheckInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				checkCertificatesExpiry(mgr, warningDays)
+			}
+		}()
+	})
+}
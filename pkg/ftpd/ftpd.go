@@ -70,6 +70,10 @@ type Binding struct {
 	MinTLSVersion int `json:"min_tls_version" mapstructure:"min_tls_version"`
 	// External IP address to expose for passive connections.
 	ForcePassiveIP string `json:"force_passive_ip" mapstructure:"force_passive_ip"`
+	// URL of an HTTP service returning the external IP as plain text, for example
+	// https://api.ipify.org. The external IP is fetched at startup and periodically
+	// refreshed. If the IP cannot be fetched ForcePassiveIP, if any, is used
+	PassiveIPResolver string `json:"passive_ip_resolver" mapstructure:"passive_ip_resolver"`
 	// PassiveIPOverrides allows to define different IP addresses to expose for passive connections
 	// based on the client IP address
 	PassiveIPOverrides []PassiveIPOverride `json:"passive_ip_overrides" mapstructure:"passive_ip_overrides"`
@@ -78,6 +82,10 @@ type Binding struct {
 	// the client is allowed not to send a certificate.
 	// You need to define at least a certificate authority for this to work
 	ClientAuthType int `json:"client_auth_type" mapstructure:"client_auth_type"`
+	// CheckCRLDistributionPoints enables the revocation check of the client certificates
+	// using the CRLs published at their HTTP distribution points. The connection is
+	// rejected if a CRL cannot be fetched or verified
+	CheckCRLDistributionPoints bool `json:"check_crl_distribution_points" mapstructure:"check_crl_distribution_points"`
 	// TLSCipherSuites is a list of supported cipher suites for TLS version 1.2.
 	// If CipherSuites is nil/empty, a default list of secure cipher suites
 	// is used, with a preference order based on hardware performance.
@@ -100,8 +108,9 @@ type Binding struct {
 	// on active data connections, so change the default value only if you are on a trusted/internal network
 	ActiveConnectionsSecurity int `json:"active_connections_security" mapstructure:"active_connections_security"`
 	// Debug enables the FTP debug mode. In debug mode, every FTP command will be logged
-	Debug   bool `json:"debug" mapstructure:"debug"`
-	ciphers []uint16
+	Debug      bool `json:"debug" mapstructure:"debug"`
+	ciphers    []uint16
+	externalIP *externalIPResolver
 }
 
 func (b *Binding) setCiphers() {
@@ -117,7 +126,7 @@ func (b *Binding) isMutualTLSEnabled() bool {
 
 // GetAddress returns the binding address
 func (b *Binding) GetAddress() string {
-	return fmt.Sprintf("%s:%d", b.Address, b.Port)
+	return util.JoinHostPort(b.Address, b.Port)
 }
 
 // IsValid returns true if the binding port is > 0
@@ -143,6 +152,13 @@ func (b *Binding) checkPassiveIP() error {
 		}
 		b.ForcePassiveIP = ip
 	}
+	if b.PassiveIPResolver != "" {
+		resolver, err := newExternalIPResolver(b.PassiveIPResolver)
+		if err != nil {
+			return err
+		}
+		b.externalIP = resolver
+	}
 	for idx, passiveOverride := range b.PassiveIPOverrides {
 		var ip string
 
@@ -167,10 +183,15 @@ func (b *Binding) checkPassiveIP() error {
 }
 
 func (b *Binding) getPassiveIP(cc ftpserver.ClientContext) string {
+	if b.externalIP != nil {
+		if ip := b.externalIP.getIP(); ip != "" {
+			return ip
+		}
+	}
 	if b.ForcePassiveIP != "" {
 		return b.ForcePassiveIP
 	}
-	return strings.Split(cc.LocalAddr().String(), ":")[0]
+	return util.GetIPFromRemoteAddress(cc.LocalAddr().String())
 }
 
 func (b *Binding) passiveIPResolver(cc ftpserver.ClientContext) (string, error) {
@@ -181,7 +202,7 @@ func (b *Binding) passiveIPResolver(cc ftpserver.ClientContext) (string, error)
 				for _, fn := range override.parsedNetworks {
 					if fn(clientIP) {
 						if override.IP == "" {
-							return strings.Split(cc.LocalAddr().String(), ":")[0], nil
+							return util.GetIPFromRemoteAddress(cc.LocalAddr().String()), nil
 						}
 						return override.IP, nil
 					}
@@ -247,6 +268,14 @@ type Configuration struct {
 	// CARevocationLists defines a set a revocation lists, one for each root CA, to be used to check
 	// if a client certificate has been revoked
 	CARevocationLists []string `json:"ca_revocation_lists" mapstructure:"ca_revocation_lists"`
+	// ACMEDomain defines the domain, as configured in the ACME section, whose certificate
+	// will be used instead of CertificateFile and CertificateKeyFile. This way HTTPS and FTPS
+	// can use the same certificate. The certificate is reloaded after each ACME renewal
+	ACMEDomain string `json:"acme_domain" mapstructure:"acme_domain"`
+	// Number of days before the expiration of a loaded TLS certificate to start warning about it.
+	// The certificates are periodically checked, regardless of how they are renewed, and a
+	// certificate event is triggered for each expiring certificate. 0 means disabled
+	CertificateExpiryWarningDays int `json:"certificate_expiry_warning_days" mapstructure:"certificate_expiry_warning_days"`
 	// Do not impose the port 20 for active data transfer. Enabling this option allows to run SFTPGo with less privilege
 	ActiveTransfersPortNon20 bool `json:"active_transfers_port_non_20" mapstructure:"active_transfers_port_non_20"`
 	// Set to true to disable active FTP
@@ -265,6 +294,12 @@ type Configuration struct {
 	// no advantage as it will download the partial files and will upload the
 	// combined one. Cloud backends natively support multipart uploads.
 	CombineSupport int `json:"combine_support" mapstructure:"combine_support"`
+	// Set to true to disable the MLSD command. MLSD returns machine readable
+	// directory listings with the type, size and modify facts.
+	// Some clients send MLSD if advertised in FEAT but then fail to parse the response
+	DisableMLSD bool `json:"disable_mlsd" mapstructure:"disable_mlsd"`
+	// Set to true to disable the MLST command
+	DisableMLST bool `json:"disable_mlst" mapstructure:"disable_mlst"`
 	// Port Range for data connections. Random if not specified
 	PassivePortRange PortRange `json:"passive_port_range" mapstructure:"passive_port_range"`
 }
@@ -280,7 +315,7 @@ func (c *Configuration) ShouldBind() bool {
 	return false
 }
 
-func (c *Configuration) getKeyPairs(configDir string) []common.TLSKeyPair {
+func (c *Configuration) getKeyPairs(configDir string) ([]common.TLSKeyPair, error) {
 	var keyPairs []common.TLSKeyPair
 
 	for _, binding := range c.Bindings {
@@ -294,6 +329,13 @@ func (c *Configuration) getKeyPairs(configDir string) []common.TLSKeyPair {
 			})
 		}
 	}
+	if c.ACMEDomain != "" {
+		keyPair, err := common.GetACMEKeyPair(c.ACMEDomain, common.DefaultTLSKeyPaidID)
+		if err != nil {
+			return nil, err
+		}
+		return append(keyPairs, keyPair), nil
+	}
 	certificateFile := getConfigPath(c.CertificateFile, configDir)
 	certificateKeyFile := getConfigPath(c.CertificateKeyFile, configDir)
 	if certificateFile != "" && certificateKeyFile != "" {
@@ -303,7 +345,7 @@ func (c *Configuration) getKeyPairs(configDir string) []common.TLSKeyPair {
 			ID:   common.DefaultTLSKeyPaidID,
 		})
 	}
-	return keyPairs
+	return keyPairs, nil
 }
 
 // Initialize configures and starts the FTP server
@@ -313,7 +355,10 @@ func (c *Configuration) Initialize(configDir string) error {
 		return common.ErrNoBinding
 	}
 
-	keyPairs := c.getKeyPairs(configDir)
+	keyPairs, err := c.getKeyPairs(configDir)
+	if err != nil {
+		return err
+	}
 	if len(keyPairs) > 0 {
 		mgr, err := common.NewCertManager(keyPairs, configDir, logSender)
 		if err != nil {
@@ -328,6 +373,9 @@ func (c *Configuration) Initialize(configDir string) error {
 			return err
 		}
 		certMgr = mgr
+		if c.CertificateExpiryWarningDays > 0 {
+			startCertificateExpiryCheck(mgr, c.CertificateExpiryWarningDays)
+		}
 	}
 	serviceStatus = ServiceStatus{
 		Bindings:         nil,
@@ -368,6 +416,14 @@ func ReloadCertificateMgr() error {
 	return nil
 }
 
+// GetCertificatesInfo returns the metadata for the loaded TLS certificates
+func GetCertificatesInfo() []common.TLSCertificateInfo {
+	if certMgr != nil {
+		return certMgr.GetCertificatesInfo()
+	}
+	return nil
+}
+
 // GetStatus returns the server status
 func GetStatus() ServiceStatus {
 	return serviceStatus
@@ -2573,6 +2573,84 @@ func TestSymlink(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestMLSxFacts(t *testing.T) {
+	mlsxDir := "mlsxdir"
+	u := getTestUser()
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	client, err := getFTPClient(user, false, nil)
+	if assert.NoError(t, err) {
+		err = ftpUploadFile(testFilePath, testFileName, testFileSize, client, 0)
+		assert.NoError(t, err)
+		err = client.MakeDir(mlsxDir)
+		assert.NoError(t, err)
+		code, _, err := client.SendCustomCommand(fmt.Sprintf("SITE SYMLINK %v %v", testFileName, testFileName+".link"))
+		assert.NoError(t, err)
+		assert.Equal(t, ftp.StatusCommandOK, code)
+		code, _, err = client.SendCustomCommand(fmt.Sprintf("SITE SYMLINK %v %v", mlsxDir, mlsxDir+".link"))
+		assert.NoError(t, err)
+		assert.Equal(t, ftp.StatusCommandOK, code)
+		getFacts := func(name string, info os.FileInfo, fileType string) string {
+			return fmt.Sprintf("Type=%s;Size=%d;Modify=%s; %s", fileType, info.Size(),
+				info.ModTime().UTC().Format("20060102150405"), name)
+		}
+		fileInfo, err := os.Stat(filepath.Join(user.GetHomeDir(), testFileName))
+		assert.NoError(t, err)
+		dirInfo, err := os.Stat(filepath.Join(user.GetHomeDir(), mlsxDir))
+		assert.NoError(t, err)
+		// MLST follows the symlinks and returns the facts of the target
+		for _, name := range []string{testFileName, testFileName + ".link"} {
+			code, response, err := client.SendCustomCommand("MLST " + name)
+			assert.NoError(t, err)
+			assert.Equal(t, ftp.StatusRequestedFileActionOK, code)
+			assert.Contains(t, response, getFacts(name, fileInfo, "file"))
+		}
+		for _, name := range []string{mlsxDir, mlsxDir + ".link"} {
+			code, response, err := client.SendCustomCommand("MLST " + name)
+			assert.NoError(t, err)
+			assert.Equal(t, ftp.StatusRequestedFileActionOK, code)
+			assert.Contains(t, response, getFacts(name, dirInfo, "dir"))
+		}
+		code, _, err = client.SendCustomCommand("MLST missing")
+		assert.NoError(t, err)
+		assert.Equal(t, ftp.StatusFileUnavailable, code)
+		// MLSD does not follow the symlinks, they are listed as files with the link size
+		entries, err := client.List("/")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 4)
+		for _, entry := range entries {
+			info, err := os.Lstat(filepath.Join(user.GetHomeDir(), entry.Name))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			expectedType := ftp.EntryTypeFile
+			if info.IsDir() {
+				expectedType = ftp.EntryTypeFolder
+			}
+			assert.Equal(t, expectedType, entry.Type, entry.Name)
+			assert.Equal(t, uint64(info.Size()), entry.Size, entry.Name)
+			assert.Equal(t, info.ModTime().UTC().Truncate(time.Second), entry.Time.UTC(), entry.Name)
+		}
+		for _, entry := range entries {
+			if entry.Name == mlsxDir+".link" {
+				assert.Equal(t, ftp.EntryTypeFile, entry.Type)
+			}
+		}
+		err = client.Quit()
+		assert.NoError(t, err)
+	}
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestStat(t *testing.T) {
 	u := getTestUser()
 	u.Permissions["/subdir"] = []string{dataprovider.PermUpload}
@@ -3366,6 +3444,14 @@ func TestClientCertificateAuth(t *testing.T) {
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "does not match username")
 	}
+	// the test certificate has no subject alternative names
+	user2.Filters.TLSUsername = dataprovider.TLSUsernameSAN
+	user2, _, err = httpdtest.UpdateUser(user2, http.StatusOK, "")
+	assert.NoError(t, err)
+	_, err = getFTPClient(user2, true, tlsConfig)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no subject alternative name matches username")
+	}
 
 	// now disable certificate authentication
 	user.Filters.DeniedLoginMethods = append(user.Filters.DeniedLoginMethods, dataprovider.LoginMethodTLSCertificate,
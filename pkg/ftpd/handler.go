@@ -157,7 +157,7 @@ func (c *Connection) Stat(name string) (os.FileInfo, error) {
 	c.UpdateLastActivity()
 	c.doWildcardListDir = false
 
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
@@ -227,10 +227,11 @@ func (c *Connection) GetAvailableSpace(dirName string) (int64, error) {
 		return 0, nil
 	}
 
+	maxUploadFileSize := c.User.GetMaxUploadFileSize(path.Join(dirName, "fakefile.txt"))
 	if diskQuota.AllowedSize == 0 && transferQuota.AllowedULSize == 0 && transferQuota.AllowedTotalSize == 0 {
 		// no quota restrictions
-		if c.User.Filters.MaxUploadFileSize > 0 {
-			return c.User.Filters.MaxUploadFileSize, nil
+		if maxUploadFileSize > 0 {
+			return maxUploadFileSize, nil
 		}
 
 		fs, p, err := c.GetFsAndResolvedPath(dirName)
@@ -260,9 +261,9 @@ func (c *Connection) GetAvailableSpace(dirName string) (int64, error) {
 	}
 	// the available space is the minimum between MaxUploadFileSize, if setted,
 	// and quota allowed size
-	if c.User.Filters.MaxUploadFileSize > 0 {
-		if c.User.Filters.MaxUploadFileSize < allowedSize {
-			return c.User.Filters.MaxUploadFileSize, nil
+	if maxUploadFileSize > 0 {
+		if maxUploadFileSize < allowedSize {
+			return maxUploadFileSize, nil
 		}
 	}
 
@@ -305,13 +306,25 @@ func (c *Connection) ReadDir(name string) ([]os.FileInfo, error) {
 		return c.getListDirWithWildcards(name, baseName)
 	}
 
-	return c.ListDir(name)
+	files, err := c.ListDirCached(name)
+	if err != nil {
+		return files, err
+	}
+	c.SortDirListing(files)
+	return files, nil
 }
 
 // GetHandle implements ClientDriverExtentionFileTransfer
 func (c *Connection) GetHandle(name string, flags int, offset int64) (ftpserver.FileTransfer, error) {
 	c.UpdateLastActivity()
 
+	if flags&os.O_WRONLY != 0 {
+		var err error
+		name, err = c.GetUploadTargetPath(name)
+		if err != nil {
+			return nil, err
+		}
+	}
 	fs, p, err := c.GetFsAndResolvedPath(name)
 	if err != nil {
 		return nil, err
@@ -328,7 +341,7 @@ func (c *Connection) GetHandle(name string, flags int, offset int64) (ftpserver.
 }
 
 func (c *Connection) downloadFile(fs vfs.Fs, fsPath, ftpPath string, offset int64) (ftpserver.FileTransfer, error) {
-	if !c.User.HasPerm(dataprovider.PermDownload, path.Dir(ftpPath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(ftpPath)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 	transferQuota := c.GetTransferQuota()
@@ -368,13 +381,13 @@ func (c *Connection) uploadFile(fs vfs.Fs, fsPath, ftpPath string, flags int) (f
 	}
 
 	filePath := fsPath
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		filePath = fs.GetAtomicUploadPath(fsPath)
 	}
 
 	stat, statErr := fs.Lstat(fsPath)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || fs.IsNotExist(statErr) {
-		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(ftpPath)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(ftpPath)) {
 			return nil, fmt.Errorf("%w, no upload permission", ftpserver.ErrFileNameNotAllowed)
 		}
 		return c.handleFTPUploadToNewFile(fs, flags, fsPath, filePath, ftpPath)
@@ -391,7 +404,7 @@ func (c *Connection) uploadFile(fs vfs.Fs, fsPath, ftpPath string, flags int) (f
 		return nil, c.GetOpUnsupportedError()
 	}
 
-	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(ftpPath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(ftpPath)) {
 		return nil, fmt.Errorf("%w, no overwrite permission", ftpserver.ErrFileNameNotAllowed)
 	}
 
@@ -408,8 +421,13 @@ func (c *Connection) handleFTPUploadToNewFile(fs vfs.Fs, flags int, resolvedPath
 		c.Log(logger.LevelDebug, "upload for file %#v denied by pre action: %v", requestPath, err)
 		return nil, fmt.Errorf("%w, denied by pre-upload action", ftpserver.ErrFileNameNotAllowed)
 	}
+	quotaFileReserved, err := c.ReserveNewFile(requestPath)
+	if err != nil {
+		return nil, err
+	}
 	file, w, cancelFn, err := fs.Create(filePath, flags, c.GetCreateChecks(requestPath, true))
 	if err != nil {
+		c.ReleaseNewFile(requestPath, quotaFileReserved)
 		c.Log(logger.LevelError, "error creating file %#v, flags %v: %+v", resolvedPath, flags, err)
 		return nil, c.GetFsError(fs, err)
 	}
@@ -417,10 +435,11 @@ func (c *Connection) handleFTPUploadToNewFile(fs vfs.Fs, flags int, resolvedPath
 	vfs.SetPathPermissions(fs, filePath, c.User.GetUID(), c.User.GetGID())
 
 	// we can get an error only for resume
-	maxWriteSize, _ := c.GetMaxWriteSize(diskQuota, false, 0, fs.IsUploadResumeSupported())
+	maxWriteSize, _ := c.GetMaxWriteSize(requestPath, diskQuota, false, 0, fs.IsUploadResumeSupported())
 
 	baseTransfer := common.NewBaseTransfer(file, c.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, 0, maxWriteSize, 0, true, fs, transferQuota)
+	baseTransfer.SetQuotaFileReserved(quotaFileReserved)
 	baseTransfer.SetFtpMode(c.getFTPMode())
 	t := newTransfer(baseTransfer, w, nil, 0)
 
@@ -444,7 +463,7 @@ func (c *Connection) handleFTPUploadToExistingFile(fs vfs.Fs, flags int, resolve
 	isResume := flags&os.O_TRUNC == 0
 	// if there is a size limit remaining size cannot be 0 here, since quotaResult.HasSpace
 	// will return false in this case and we deny the upload before
-	maxWriteSize, err := c.GetMaxWriteSize(diskQuota, isResume, fileSize, fs.IsUploadResumeSupported())
+	maxWriteSize, err := c.GetMaxWriteSize(requestPath, diskQuota, isResume, fileSize, fs.IsUploadResumeSupported())
 	if err != nil {
 		c.Log(logger.LevelDebug, "unable to get max write size: %v", err)
 		return nil, err
@@ -454,7 +473,7 @@ func (c *Connection) handleFTPUploadToExistingFile(fs vfs.Fs, flags int, resolve
 		return nil, fmt.Errorf("%w, denied by pre-upload action", ftpserver.ErrFileNameNotAllowed)
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		err = fs.Rename(resolvedPath, filePath)
 		if err != nil {
 			c.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
@@ -463,6 +482,7 @@ func (c *Connection) handleFTPUploadToExistingFile(fs vfs.Fs, flags int, resolve
 		}
 	}
 
+	quotaSize := vfs.GetQuotaSize(fs, filePath, fileSize)
 	file, w, cancelFn, err := fs.Create(filePath, flags, c.GetCreateChecks(requestPath, false))
 	if err != nil {
 		c.Log(logger.LevelError, "error opening existing file, flags: %v, source: %#v, err: %+v", flags, filePath, err)
@@ -474,25 +494,25 @@ func (c *Connection) handleFTPUploadToExistingFile(fs vfs.Fs, flags int, resolve
 	if isResume {
 		c.Log(logger.LevelDebug, "resuming upload requested, file path: %#v initial size: %v", filePath, fileSize)
 		minWriteOffset = fileSize
-		initialSize = fileSize
+		initialSize = quotaSize
 		if vfs.IsSFTPFs(fs) && fs.IsUploadResumeSupported() {
 			// we need this since we don't allow resume with wrong offset, we should fix this in pkg/sftp
-			file.Seek(initialSize, io.SeekStart) //nolint:errcheck // for sftp seek simply set the offset
+			file.Seek(fileSize, io.SeekStart) //nolint:errcheck // for sftp seek simply set the offset
 		}
 	} else {
 		if vfs.HasTruncateSupport(fs) {
 			vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(requestPath))
 			if err == nil {
-				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -quotaSize, false) //nolint:errcheck
 				if vfolder.IsIncludedInUserQuota() {
-					dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+					dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 				}
 			} else {
-				dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			initialSize = fileSize
-			truncatedSize = fileSize
+			initialSize = quotaSize
+			truncatedSize = quotaSize
 		}
 	}
 
@@ -527,8 +547,9 @@ func (c *Connection) getListDirWithWildcards(dirName, pattern string) ([]os.File
 			validIdx++
 		}
 	}
-
-	return files[:validIdx], nil
+	files = files[:validIdx]
+	c.SortDirListing(files)
+	return files, nil
 }
 
 func (c *Connection) isListDirWithWildcards(name string) bool {
@@ -15,12 +15,19 @@
 package ftpd
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"io/fs"
+	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -496,11 +503,23 @@ func TestServerGetSettings(t *testing.T) {
 		},
 	}
 	assert.False(t, binding.HasProxy())
+	assert.Equal(t, ":2121", binding.GetAddress())
+	binding.Address = "::1"
+	assert.Equal(t, "[::1]:2121", binding.GetAddress())
+	binding.Address = ""
 	server := NewServer(c, configDir, binding, 0)
 	settings, err := server.GetSettings()
 	assert.NoError(t, err)
 	assert.Equal(t, 10000, settings.PassiveTransferPortRange.Start)
 	assert.Equal(t, 11000, settings.PassiveTransferPortRange.End)
+	assert.False(t, settings.DisableMLSD)
+	assert.False(t, settings.DisableMLST)
+	c.DisableMLSD = true
+	c.DisableMLST = true
+	settings, err = server.GetSettings()
+	assert.NoError(t, err)
+	assert.True(t, settings.DisableMLSD)
+	assert.True(t, settings.DisableMLST)
 
 	common.Config.ProxyProtocol = 1
 	common.Config.ProxyAllowed = []string{"invalid"}
@@ -944,6 +963,35 @@ func TestVerifyTLSConnection(t *testing.T) {
 	state.PeerCertificates = []*x509.Certificate{x509crtRevoked}
 	err = server.verifyTLSConnection(state)
 	assert.EqualError(t, err, common.ErrCrtRevoked.Error())
+	// the CRL distribution points are checked only if enabled for the binding
+	crlServer := httptest.NewServer(http.NotFoundHandler())
+	defer crlServer.Close()
+
+	crt, err = tls.X509KeyPair([]byte(caCRT), []byte(caKey))
+	assert.NoError(t, err)
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "client3"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		CRLDistributionPoints: []string{crlServer.URL + "/ca.crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, x509CAcrt, &clientKey.PublicKey, crt.PrivateKey)
+	assert.NoError(t, err)
+	x509crtDP, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	state = tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{x509crtDP},
+		VerifiedChains:   [][]*x509.Certificate{{x509crtDP, x509CAcrt}},
+	}
+	err = server.verifyTLSConnection(state)
+	assert.NoError(t, err)
+	server.binding.CheckCRLDistributionPoints = true
+	err = server.verifyTLSConnection(state)
+	assert.ErrorContains(t, err, "unable to fetch the CRL")
 
 	err = os.Remove(caCrlPath)
 	assert.NoError(t, err)
@@ -967,6 +1015,57 @@ func TestCiphers(t *testing.T) {
 	require.Equal(t, []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384}, b.ciphers)
 }
 
+func TestACMECertificate(t *testing.T) {
+	certPath := filepath.Join(os.TempDir(), "acme.crt")
+	keyPath := filepath.Join(os.TempDir(), "acme.key")
+	err := os.WriteFile(certPath, []byte(ftpsCert), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(keyPath, []byte(ftpsKey), os.ModePerm)
+	assert.NoError(t, err)
+
+	c := Configuration{
+		Bindings: []Binding{
+			{
+				Port: 2121,
+			},
+		},
+		CertificateFile:    "missing.crt",
+		CertificateKeyFile: "missing.key",
+		ACMEDomain:         "example.com",
+	}
+	_, err = c.getKeyPairs(configDir)
+	assert.ErrorContains(t, err, "no ACME certificate configured")
+
+	common.SetACMEKeyPairs([]common.TLSKeyPair{
+		{
+			Cert: certPath,
+			Key:  keyPath,
+			ID:   "example.com",
+		},
+	})
+	defer common.SetACMEKeyPairs(nil)
+
+	keyPairs, err := c.getKeyPairs(configDir)
+	assert.NoError(t, err)
+	if assert.Len(t, keyPairs, 1) {
+		assert.Equal(t, common.TLSKeyPair{
+			Cert: certPath,
+			Key:  keyPath,
+			ID:   common.DefaultTLSKeyPaidID,
+		}, keyPairs[0])
+	}
+	mgr, err := common.NewCertManager(keyPairs, configDir, logSender)
+	require.NoError(t, err)
+	// the test certificate expires in 2030
+	assert.Equal(t, 0, checkCertificatesExpiry(mgr, 7))
+	assert.Equal(t, 1, checkCertificatesExpiry(mgr, 10000))
+
+	err = os.Remove(certPath)
+	assert.NoError(t, err)
+	err = os.Remove(keyPath)
+	assert.NoError(t, err)
+}
+
 func TestPassiveIPResolver(t *testing.T) {
 	b := Binding{
 		PassiveIPOverrides: []PassiveIPOverride{
@@ -1034,6 +1133,68 @@ func TestPassiveIPResolver(t *testing.T) {
 	assert.Equal(t, b.ForcePassiveIP, passiveIP)
 }
 
+func TestExternalIPResolver(t *testing.T) {
+	externalIP := "203.0.113.7"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			_, _ = w.Write([]byte("not an ip"))
+			return
+		}
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(externalIP + "\n"))
+	}))
+	defer ts.Close()
+
+	b := Binding{
+		PassiveIPResolver: "ftp://invalid",
+	}
+	err := b.checkPassiveIP()
+	assert.ErrorContains(t, err, "invalid passive IP resolver URL")
+
+	mockCC := mockFTPClientContext{
+		remoteIP: "192.168.1.10",
+		localIP:  "192.168.1.3",
+	}
+	b = Binding{
+		ForcePassiveIP:    "192.168.2.1",
+		PassiveIPResolver: ts.URL + "/error",
+	}
+	err = b.checkPassiveIP()
+	require.NoError(t, err)
+	require.NotNil(t, b.externalIP)
+	b.externalIP.refresh()
+	// the resolver failed, the forced IP is used
+	passiveIP, err := b.passiveIPResolver(mockCC)
+	assert.NoError(t, err)
+	assert.Equal(t, b.ForcePassiveIP, passiveIP)
+	b.ForcePassiveIP = ""
+	passiveIP, err = b.passiveIPResolver(mockCC)
+	assert.NoError(t, err)
+	assert.Equal(t, mockCC.localIP, passiveIP)
+	// IPv6 local address
+	passiveIP, err = b.passiveIPResolver(mockFTPClientContext{
+		remoteIP: "2001:db8::10",
+		localIP:  "2001:db8::3",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::3", passiveIP)
+
+	b.externalIP.url = ts.URL
+	b.externalIP.refresh()
+	passiveIP, err = b.passiveIPResolver(mockCC)
+	assert.NoError(t, err)
+	assert.Equal(t, externalIP, passiveIP)
+	// the last fetched IP is preserved on errors
+	b.externalIP.url = ts.URL + "/invalid"
+	b.externalIP.refresh()
+	passiveIP, err = b.passiveIPResolver(mockCC)
+	assert.NoError(t, err)
+	assert.Equal(t, externalIP, passiveIP)
+}
+
 func TestRelativePath(t *testing.T) {
 	rel := getPathRelativeTo("/testpath", "/testpath")
 	assert.Empty(t, rel)
@@ -0,0 +1,107 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package ftpd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const (
+	externalIPRefreshInterval = 30 * time.Minute
+	maxExternalIPResponseSize = 256
+)
+
+// externalIPResolver fetches the external IP to expose for passive connections
+// from an HTTP service, such as https://api.ipify.org, that returns the client
+// IP as plain text
+type externalIPResolver struct {
+	url       string
+	ip        atomic.Pointer[string]
+	startOnce sync.Once
+}
+
+func newExternalIPResolver(url string) (*externalIPResolver, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid passive IP resolver URL %q", url)
+	}
+	return &externalIPResolver{
+		url: url,
+	}, nil
+}
+
+// getIP returns the last fetched external IP or an empty string
+// if no IP was fetched yet
+func (r *externalIPResolver) getIP() string {
+	ip := r.ip.Load()
+	if ip == nil {
+		return ""
+	}
+	return *ip
+}
+
+func (r *externalIPResolver) fetchIP() (string, error) {
+	resp, err := httpclient.Get(r.url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxExternalIPResponseSize))
+	if err != nil {
+		return "", err
+	}
+	return parsePassiveIP(strings.TrimSpace(string(body)))
+}
+
+// refresh fetches the external IP, the last fetched IP, if any, is preserved on error
+func (r *externalIPResolver) refresh() {
+	ip, err := r.fetchIP()
+	if err != nil {
+		logger.Warn(logSender, "", "unable to fetch the external IP from %q: %v", r.url, err)
+		return
+	}
+	if previousIP := r.getIP(); previousIP != ip {
+		logger.Info(logSender, "", "external IP for passive connections changed from %q to %q", previousIP, ip)
+	}
+	r.ip.Store(&ip)
+}
+
+// start fetches the external IP and periodically refreshes it
+func (r *externalIPResolver) start() {
+	r.startOnce.Do(func() {
+		r.refresh()
+
+		go func() {
+			ticker := time.NewTicker(externalIPRefreshInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				r.refresh()
+			}
+		}()
+	})
+}
@@ -100,6 +100,9 @@ func (s *Server) GetSettings() (*ftpserver.Settings, error) {
 	if err := s.binding.checkPassiveIP(); err != nil {
 		return nil, err
 	}
+	if s.binding.externalIP != nil {
+		s.binding.externalIP.start()
+	}
 	if err := s.binding.checkSecuritySettings(); err != nil {
 		return nil, err
 	}
@@ -149,6 +152,8 @@ func (s *Server) GetSettings() (*ftpserver.Settings, error) {
 		DisableActiveMode:        s.config.DisableActiveMode,
 		EnableHASH:               s.config.HASHSupport > 0,
 		EnableCOMB:               s.config.CombineSupport > 0,
+		DisableMLSD:              s.config.DisableMLSD,
+		DisableMLST:              s.config.DisableMLST,
 		DefaultTransferType:      ftpserver.TransferTypeBinary,
 		ActiveConnectionsCheck:   ftpserver.DataConnectionRequirement(s.binding.ActiveConnectionsSecurity),
 		PasvConnectionsCheck:     ftpserver.DataConnectionRequirement(s.binding.PassiveConnectionsSecurity),
@@ -281,8 +286,8 @@ func (s *Server) VerifyConnection(cc ftpserver.ClientContext, user string, tlsCo
 						return nil, err
 					}
 					setStartDirectory(dbUser.Filters.StartDirectory, cc)
-					connection.Log(logger.LevelInfo, "User id: %d, logged in with FTP using a TLS certificate, username: %#v, home_dir: %#v remote addr: %#v",
-						dbUser.ID, dbUser.Username, dbUser.HomeDir, ipAddr)
+					connection.Log(logger.LevelInfo, "User id: %d, logged in with FTP using a TLS certificate, username: %#v, home_dir: %#v remote addr: %#v, certificate subject: %q",
+						dbUser.ID, dbUser.Username, dbUser.HomeDir, ipAddr, state.PeerCertificates[0].Subject.String())
 					dataprovider.UpdateLastLogin(&dbUser)
 					return connection, nil
 				}
@@ -352,6 +357,13 @@ func (s *Server) verifyTLSConnection(state tls.ConnectionState) error {
 				logger.Debug(logSender, "", "tls handshake error, client certificate %#v has beed revoked", clientCrtName)
 				return common.ErrCrtRevoked
 			}
+			if s.binding.CheckCRLDistributionPoints && len(verifiedChain) > 1 {
+				if err := common.CheckCRLDistributionPoints(clientCrt, verifiedChain[1]); err != nil {
+					logger.Debug(logSender, "", "tls handshake error, unable to verify the revocation status of client certificate %q: %v",
+						clientCrtName, err)
+					return err
+				}
+			}
 		}
 	}
 
@@ -379,13 +391,9 @@ func (s *Server) validateUser(user dataprovider.User, cc ftpserver.ClientContext
 			user.Username)
 		return nil, fmt.Errorf("second factor authentication is not set for user %#v", user.Username)
 	}
-	if user.MaxSessions > 0 {
-		activeSessions := common.Connections.GetActiveSessions(user.Username)
-		if activeSessions >= user.MaxSessions {
-			logger.Info(logSender, connectionID, "authentication refused for user: %#v, too many open sessions: %v/%v",
-				user.Username, activeSessions, user.MaxSessions)
-			return nil, fmt.Errorf("too many open sessions: %v", activeSessions)
-		}
+	if err := common.Connections.CheckMaxSessions(user.Username, user.MaxSessions); err != nil {
+		logger.Info(logSender, connectionID, "authentication refused for user: %q, %v", user.Username, err)
+		return nil, err
 	}
 	remoteAddr := cc.RemoteAddr().String()
 	if !user.IsLoginFromAddrAllowed(remoteAddr) {
@@ -410,6 +418,7 @@ func (s *Server) validateUser(user dataprovider.User, cc ftpserver.ClientContext
 		logger.Warn(logSender, connectionID, "unable to swap connection: %v, close fs error: %v", err, errClose)
 		return nil, err
 	}
+	connection.PrefetchDirListings()
 	return connection, nil
 }
 
@@ -106,6 +106,10 @@ func (t *transfer) Seek(offset int64, whence int) (int64, error) {
 	if t.reader != nil && t.expectedOffset == offset && whence == io.SeekStart {
 		return offset, nil
 	}
+	if t.writer != nil && t.MinWriteOffset > 0 && t.MinWriteOffset == offset && whence == io.SeekStart {
+		// resumed upload to a cloud backend, the pipe already starts at the resume offset
+		return offset, nil
+	}
 	t.TransferError(errors.New("seek is unsupported for this transfer"))
 	return 0, common.ErrOpUnsupported
 }
@@ -28,7 +28,6 @@ import (
 )
 
 func getAdmins(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit, offset, order, err := getSearchFilters(w, r)
 	if err != nil {
 		return
@@ -43,7 +42,6 @@ func getAdmins(w http.ResponseWriter, r *http.Request) {
 }
 
 func getAdminByUsername(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	renderAdmin(w, r, username, http.StatusOK)
 }
@@ -64,7 +62,6 @@ func renderAdmin(w http.ResponseWriter, r *http.Request, username string, status
 }
 
 func addAdmin(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -85,7 +82,6 @@ func addAdmin(w http.ResponseWriter, r *http.Request) {
 }
 
 func disableAdmin2FA(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -96,6 +92,7 @@ func disableAdmin2FA(w http.ResponseWriter, r *http.Request) {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
 		return
 	}
+	wasEnabled := admin.Filters.TOTPConfig.Enabled
 	admin.Filters.RecoveryCodes = nil
 	admin.Filters.TOTPConfig = dataprovider.AdminTOTPConfig{
 		Enabled: false,
@@ -104,11 +101,27 @@ func disableAdmin2FA(w http.ResponseWriter, r *http.Request) {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
 		return
 	}
+	if wasEnabled {
+		addAdmin2FADisabledAlert(admin.Username, r)
+	}
 	sendAPIResponse(w, r, nil, "2FA disabled", http.StatusOK)
 }
 
+func unlockAdmin(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	err = dataprovider.UnlockAdmin(getURLParam(r, "username"), claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, "Admin unlocked", http.StatusOK)
+}
+
 func updateAdmin(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	admin, err := dataprovider.AdminExists(username)
 	if err != nil {
@@ -139,6 +152,11 @@ func updateAdmin(w http.ResponseWriter, r *http.Request) {
 				http.StatusBadRequest)
 			return
 		}
+		if claims.ExternalToken {
+			sendAPIResponse(w, r, errors.New("updating the admin authenticated with an external token is not allowed"), "",
+				http.StatusBadRequest)
+			return
+		}
 		if claims.isCriticalPermRemoved(admin.Permissions) {
 			sendAPIResponse(w, r, errors.New("you cannot remove these permissions to yourself"), "", http.StatusBadRequest)
 			return
@@ -160,7 +178,6 @@ func updateAdmin(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteAdmin(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
@@ -181,7 +198,6 @@ func deleteAdmin(w http.ResponseWriter, r *http.Request) {
 }
 
 func getAdminProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -203,7 +219,6 @@ func getAdminProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateAdminProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -231,7 +246,6 @@ func updateAdminProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func forgotAdminPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	if !smtp.IsEnabled() {
 		sendAPIResponse(w, r, nil, "No SMTP configuration", http.StatusBadRequest)
 		return
@@ -247,8 +261,6 @@ func forgotAdminPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func resetAdminPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	var req pwdReset
 	err := render.DecodeJSON(r.Body, &req)
 	if err != nil {
@@ -264,8 +276,6 @@ func resetAdminPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func changeAdminPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	var pwd pwdChange
 	err := render.DecodeJSON(r.Body, &pwd)
 	if err != nil {
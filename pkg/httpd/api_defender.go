@@ -25,10 +25,10 @@ import (
 
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
 func getDefenderHosts(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	hosts, err := common.GetDefenderHosts()
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -42,7 +42,6 @@ func getDefenderHosts(w http.ResponseWriter, r *http.Request) {
 }
 
 func getDefenderHostByID(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	ip, err := getIPFromID(r)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
@@ -57,7 +56,6 @@ func getDefenderHostByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteDefenderHostByID(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	ip, err := getIPFromID(r)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
@@ -81,7 +79,7 @@ func getIPFromID(r *http.Request) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return ip, nil
+	return util.NormalizeIP(ip), nil
 }
 
 func validateIPAddress(ip string) error {
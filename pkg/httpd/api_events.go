@@ -118,8 +118,6 @@ func getProviderSearchParamsFromRequest(r *http.Request) (eventsearcher.Provider
 }
 
 func searchFsEvents(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	filters, err := getFsSearchParamsFromRequest(r)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -137,8 +135,6 @@ func searchFsEvents(w http.ResponseWriter, r *http.Request) {
 }
 
 func searchProviderEvents(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	filters, err := getProviderSearchParamsFromRequest(r)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
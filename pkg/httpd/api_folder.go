@@ -20,13 +20,13 @@ import (
 
 	"github.com/go-chi/render"
 
+	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
 func getFolders(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit, offset, order, err := getSearchFilters(w, r)
 	if err != nil {
 		return
@@ -41,7 +41,6 @@ func getFolders(w http.ResponseWriter, r *http.Request) {
 }
 
 func addFolder(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -63,7 +62,6 @@ func addFolder(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateFolder(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -81,6 +79,7 @@ func updateFolder(w http.ResponseWriter, r *http.Request) {
 	folderID := folder.ID
 	name = folder.Name
 	currentS3AccessSecret := folder.FsConfig.S3Config.AccessSecret
+	currentS3ReplicationSecret := folder.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret
 	currentAzAccountKey := folder.FsConfig.AzBlobConfig.AccountKey
 	currentAzSASUrl := folder.FsConfig.AzBlobConfig.SASURL
 	currentGCSCredentials := folder.FsConfig.GCSConfig.Credentials
@@ -90,6 +89,7 @@ func updateFolder(w http.ResponseWriter, r *http.Request) {
 	currentSFTPKeyPassphrase := folder.FsConfig.SFTPConfig.KeyPassphrase
 	currentHTTPPassword := folder.FsConfig.HTTPConfig.Password
 	currentHTTPAPIKey := folder.FsConfig.HTTPConfig.APIKey
+	currentHTTPSigningKey := folder.FsConfig.HTTPConfig.SigningKey
 
 	folder.FsConfig.S3Config = vfs.S3FsConfig{}
 	folder.FsConfig.AzBlobConfig = vfs.AzBlobFsConfig{}
@@ -97,6 +97,8 @@ func updateFolder(w http.ResponseWriter, r *http.Request) {
 	folder.FsConfig.CryptConfig = vfs.CryptFsConfig{}
 	folder.FsConfig.SFTPConfig = vfs.SFTPFsConfig{}
 	folder.FsConfig.HTTPConfig = vfs.HTTPFsConfig{}
+	folder.FsConfig.OSConfig = vfs.OsFsConfig{}
+	folder.AuditLog = vfs.FolderAuditLog{}
 	err = render.DecodeJSON(r.Body, &folder)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
@@ -105,9 +107,9 @@ func updateFolder(w http.ResponseWriter, r *http.Request) {
 	folder.ID = folderID
 	folder.Name = name
 	folder.FsConfig.SetEmptySecretsIfNil()
-	updateEncryptedSecrets(&folder.FsConfig, currentS3AccessSecret, currentAzAccountKey, currentAzSASUrl, currentGCSCredentials,
-		currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase, currentHTTPPassword,
-		currentHTTPAPIKey)
+	updateEncryptedSecrets(&folder.FsConfig, currentS3AccessSecret, currentS3ReplicationSecret, currentAzAccountKey,
+		currentAzSASUrl, currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey,
+		currentSFTPKeyPassphrase, currentHTTPPassword, currentHTTPAPIKey, currentHTTPSigningKey)
 	err = dataprovider.UpdateFolder(&folder, users, groups, claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -132,13 +134,29 @@ func renderFolder(w http.ResponseWriter, r *http.Request, name string, status in
 }
 
 func getFolderByName(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	renderFolder(w, r, name, http.StatusOK)
 }
 
+func getFolderAuditLogs(w http.ResponseWriter, r *http.Request) {
+	name := getURLParam(r, "name")
+	folder, err := dataprovider.GetFolderByName(name)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	files, err := common.GetFolderAuditLogs(&folder)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if files == nil {
+		files = []common.FolderAuditLogFile{}
+	}
+	render.JSON(w, r, files)
+}
+
 func deleteFolder(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -0,0 +1,291 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/rs/xid"
+	"github.com/sftpgo/sdk"
+	"golang.org/x/time/rate"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+var fsHealthChecks = newFsHealthCheckCache()
+
+type fsHealthCheckResult struct {
+	Healthy   bool   `json:"healthy"`
+	LatencyMs int64  `json:"latency_ms"`
+	Details   string `json:"details"`
+	// Check time as unix timestamp in milliseconds
+	CheckedAt int64 `json:"checked_at"`
+}
+
+// fsHealthCheckCache stores the last health check result for each user,
+// it is used to limit the number of checks
+type fsHealthCheckCache struct {
+	sync.RWMutex
+	timeout     time.Duration
+	minInterval time.Duration
+	results     map[string]fsHealthCheckResult
+}
+
+func newFsHealthCheckCache() *fsHealthCheckCache {
+	return &fsHealthCheckCache{
+		timeout:     5 * time.Second,
+		minInterval: 10 * time.Second,
+		results:     make(map[string]fsHealthCheckResult),
+	}
+}
+
+func (c *fsHealthCheckCache) setConfig(config FilesystemCheckConfig) {
+	c.Lock()
+	defer c.Unlock()
+
+	if config.Timeout > 0 {
+		c.timeout = time.Duration(config.Timeout) * time.Second
+	}
+	if config.MinInterval >= 0 {
+		c.minInterval = time.Duration(config.MinInterval) * time.Second
+	}
+}
+
+func (c *fsHealthCheckCache) getTimeout() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.timeout
+}
+
+func (c *fsHealthCheckCache) get(username string) (fsHealthCheckResult, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	result, ok := c.results[username]
+	if !ok {
+		return result, false
+	}
+	if time.Since(util.GetTimeFromMsecSinceEpoch(result.CheckedAt)) >= c.minInterval {
+		return result, false
+	}
+	return result, true
+}
+
+func (c *fsHealthCheckCache) add(username string, result fsHealthCheckResult) {
+	c.Lock()
+	defer c.Unlock()
+
+	for k, v := range c.results {
+		if time.Since(util.GetTimeFromMsecSinceEpoch(v.CheckedAt)) >= c.minInterval {
+			delete(c.results, k)
+		}
+	}
+	if c.minInterval > 0 {
+		c.results[username] = result
+	}
+}
+
+func checkUserFilesystem(w http.ResponseWriter, r *http.Request) {
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if result, ok := fsHealthChecks.get(user.Username); ok {
+		render.JSON(w, r, result)
+		return
+	}
+	result := fsHealthCheckResult{
+		Healthy: true,
+		Details: "ok",
+	}
+	// the latency includes the filesystem initialization, for some
+	// backends, for example SFTP, the connection is established here
+	start := time.Now()
+	fs, err := user.GetFilesystem(xid.New().String())
+	if err == nil {
+		err = vfs.CheckFsHealth(fs, fsHealthChecks.getTimeout())
+		fs.Close() //nolint:errcheck
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Healthy = false
+		result.Details = err.Error()
+	}
+	if !result.Healthy {
+		logForRequest(r, logger.LevelWarn, "filesystem health check failed for user %q: %s", user.Username, result.Details)
+	}
+	result.CheckedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	fsHealthChecks.add(user.Username, result)
+	render.JSON(w, r, result)
+}
+
+const (
+	fsTestRateLimit       = 10
+	fsTestRateLimitPeriod = time.Minute
+)
+
+var (
+	fsTestLimiters = newFsTestRateLimiters()
+	// absolute paths, not preceded by a host as in URLs
+	fsTestPathRegex = regexp.MustCompile(`(^|[\s"'(=])(/|[A-Za-z]:\\)[^\s"')]*`)
+	fsTestURLRegex  = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"')]+`)
+)
+
+// fsTestRequest defines a filesystem configuration to test, plain text
+// secrets are only accepted if they are explicitly marked as test only
+type fsTestRequest struct {
+	vfs.Filesystem
+	TestOnlyCredentials bool `json:"test_only_credentials"`
+}
+
+type fsTestResult struct {
+	Success   bool   `json:"success"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error"`
+}
+
+type fsTestRateLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// fsTestRateLimiters limits the filesystem tests for each admin
+type fsTestRateLimiters struct {
+	sync.Mutex
+	limiters map[string]*fsTestRateLimiter
+}
+
+func newFsTestRateLimiters() *fsTestRateLimiters {
+	return &fsTestRateLimiters{
+		limiters: make(map[string]*fsTestRateLimiter),
+	}
+}
+
+func (l *fsTestRateLimiters) allow(username string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	for k, v := range l.limiters {
+		// an idle limiter is full again, it can be removed
+		if now.Sub(v.lastUsed) >= fsTestRateLimitPeriod {
+			delete(l.limiters, k)
+		}
+	}
+	rl, ok := l.limiters[username]
+	if !ok {
+		rl = &fsTestRateLimiter{
+			limiter: rate.NewLimiter(rate.Every(fsTestRateLimitPeriod/fsTestRateLimit), fsTestRateLimit),
+		}
+		l.limiters[username] = rl
+	}
+	rl.lastUsed = now
+	return rl.limiter.AllowN(now, 1)
+}
+
+func testFilesystem(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	if !fsTestLimiters.allow(claims.Username) {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("Only %d filesystem tests per minute are allowed", fsTestRateLimit),
+			http.StatusTooManyRequests)
+		return
+	}
+	var req fsTestRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	fsConfig := req.Filesystem
+	fsConfig.SetEmptySecretsIfNil()
+	if !util.Contains([]sdk.FilesystemProvider{sdk.S3FilesystemProvider, sdk.GCSFilesystemProvider,
+		sdk.AzureBlobFilesystemProvider, sdk.SFTPFilesystemProvider, sdk.HTTPFilesystemProvider}, fsConfig.Provider) {
+		sendAPIResponse(w, r, errors.New("only remote filesystems can be tested"), "", http.StatusBadRequest)
+		return
+	}
+	if fsConfig.HasRedactedSecret() {
+		sendAPIResponse(w, r, errors.New("cannot test a filesystem with redacted secrets"), "", http.StatusBadRequest)
+		return
+	}
+	var secrets []string
+	for _, secret := range fsConfig.GetSecrets() {
+		if secret.IsPlain() && secret.GetPayload() != "" {
+			secrets = append(secrets, secret.GetPayload())
+		}
+	}
+	if len(secrets) > 0 && !req.TestOnlyCredentials {
+		sendAPIResponse(w, r, errors.New("plain text secrets are only allowed for test only credentials"), "",
+			http.StatusBadRequest)
+		return
+	}
+	secrets = append(secrets, fsConfig.S3Config.AccessKey, fsConfig.AzBlobConfig.AccountName)
+
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "test-" + xid.New().String(),
+			HomeDir:  os.TempDir(),
+		},
+		FsConfig: fsConfig,
+	}
+	if err := user.FsConfig.Validate(user.GetEncryptionAdditionalData()); err != nil {
+		sendAPIResponse(w, r, errors.New(sanitizeFsTestError(err, secrets)), "", http.StatusBadRequest)
+		return
+	}
+	result := fsTestResult{
+		Success: true,
+	}
+	start := time.Now()
+	fs, err := user.GetFilesystem(user.Username)
+	if err == nil {
+		err = vfs.CheckFsHealth(fs, fsHealthChecks.getTimeout())
+		fs.Close() //nolint:errcheck
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		logForRequest(r, logger.LevelDebug, "filesystem test failed, provider %s: %v", fsConfig.Provider.Name(), err)
+		result.Success = false
+		result.Error = sanitizeFsTestError(err, secrets)
+	}
+	render.JSON(w, r, result)
+}
+
+// sanitizeFsTestError removes the secrets, the URL credentials and the paths
+// from the specified error
+func sanitizeFsTestError(err error, secrets []string) string {
+	msg := err.Error()
+	for _, secret := range secrets {
+		if secret != "" {
+			msg = strings.ReplaceAll(msg, secret, "[redacted]")
+		}
+	}
+	msg = fsTestURLRegex.ReplaceAllStringFunc(msg, util.GetRedactedURL)
+	return fsTestPathRegex.ReplaceAllString(msg, "$1[redacted path]")
+}
@@ -16,17 +16,24 @@ package httpd
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/render"
+	"github.com/sftpgo/sdk"
 
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
+type groupMembers struct {
+	Users []string `json:"users"`
+	// 1 primary, 2 secondary, 3 membership only. Default: secondary
+	GroupType int `json:"group_type"`
+}
+
 func getGroups(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit, offset, order, err := getSearchFilters(w, r)
 	if err != nil {
 		return
@@ -41,8 +48,6 @@ func getGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 func addGroup(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -63,7 +68,6 @@ func addGroup(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateGroup(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -80,6 +84,7 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 	groupID := group.ID
 	name = group.Name
 	currentS3AccessSecret := group.UserSettings.FsConfig.S3Config.AccessSecret
+	currentS3ReplicationSecret := group.UserSettings.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret
 	currentAzAccountKey := group.UserSettings.FsConfig.AzBlobConfig.AccountKey
 	currentAzSASUrl := group.UserSettings.FsConfig.AzBlobConfig.SASURL
 	currentGCSCredentials := group.UserSettings.FsConfig.GCSConfig.Credentials
@@ -89,6 +94,7 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 	currentSFTPKeyPassphrase := group.UserSettings.FsConfig.SFTPConfig.KeyPassphrase
 	currentHTTPPassword := group.UserSettings.FsConfig.HTTPConfig.Password
 	currentHTTPAPIKey := group.UserSettings.FsConfig.HTTPConfig.APIKey
+	currentHTTPSigningKey := group.UserSettings.FsConfig.HTTPConfig.SigningKey
 
 	group.UserSettings.FsConfig.S3Config = vfs.S3FsConfig{}
 	group.UserSettings.FsConfig.AzBlobConfig = vfs.AzBlobFsConfig{}
@@ -96,6 +102,7 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 	group.UserSettings.FsConfig.CryptConfig = vfs.CryptFsConfig{}
 	group.UserSettings.FsConfig.SFTPConfig = vfs.SFTPFsConfig{}
 	group.UserSettings.FsConfig.HTTPConfig = vfs.HTTPFsConfig{}
+	group.UserSettings.FsConfig.OSConfig = vfs.OsFsConfig{}
 	err = render.DecodeJSON(r.Body, &group)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
@@ -104,9 +111,9 @@ func updateGroup(w http.ResponseWriter, r *http.Request) {
 	group.ID = groupID
 	group.Name = name
 	group.UserSettings.FsConfig.SetEmptySecretsIfNil()
-	updateEncryptedSecrets(&group.UserSettings.FsConfig, currentS3AccessSecret, currentAzAccountKey, currentAzSASUrl,
-		currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase,
-		currentHTTPPassword, currentHTTPAPIKey)
+	updateEncryptedSecrets(&group.UserSettings.FsConfig, currentS3AccessSecret, currentS3ReplicationSecret,
+		currentAzAccountKey, currentAzSASUrl, currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword,
+		currentSFTPKey, currentSFTPKeyPassphrase, currentHTTPPassword, currentHTTPAPIKey, currentHTTPSigningKey)
 	err = dataprovider.UpdateGroup(&group, users, claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -131,13 +138,11 @@ func renderGroup(w http.ResponseWriter, r *http.Request, name string, status int
 }
 
 func getGroupByName(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	renderGroup(w, r, name, http.StatusOK)
 }
 
 func deleteGroup(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -151,3 +156,43 @@ func deleteGroup(w http.ResponseWriter, r *http.Request) {
 	}
 	sendAPIResponse(w, r, err, "Group deleted", http.StatusOK)
 }
+
+func addGroupMembers(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	var members groupMembers
+	err = render.DecodeJSON(r.Body, &members)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	if members.GroupType == 0 {
+		members.GroupType = sdk.GroupTypeSecondary
+	}
+	name := getURLParam(r, "name")
+	added, err := dataprovider.AddGroupMembers(name, members.Users, members.GroupType, claims.Username,
+		util.GetIPFromRemoteAddress(r.RemoteAddr))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, fmt.Sprintf("%d user(s) added to the group", len(added)), http.StatusOK)
+}
+
+func applyGroupChanges(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	name := getURLParam(r, "name")
+	numUsers, err := dataprovider.ApplyGroupChanges(name, claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, fmt.Sprintf("Group changes applied to %d user(s)", numUsers), http.StatusOK)
+}
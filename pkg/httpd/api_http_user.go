@@ -52,20 +52,16 @@ func getUserConnection(w http.ResponseWriter, r *http.Request) (*Connection, err
 		sendAPIResponse(w, r, err, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return nil, err
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return connection, err
 	}
 	return connection, nil
 }
 
 func readUserFolder(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -82,7 +78,6 @@ func readUserFolder(w http.ResponseWriter, r *http.Request) {
 }
 
 func createUserDir(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -106,12 +101,10 @@ func createUserDir(w http.ResponseWriter, r *http.Request) {
 }
 
 func renameUserDir(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	renameItem(w, r)
 }
 
 func deleteUserDir(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -128,7 +121,6 @@ func deleteUserDir(w http.ResponseWriter, r *http.Request) {
 }
 
 func getUserFile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -149,6 +141,10 @@ func getUserFile(w http.ResponseWriter, r *http.Request) {
 		sendAPIResponse(w, r, nil, fmt.Sprintf("Please set the path to a valid file, %#v is a directory", name), http.StatusBadRequest)
 		return
 	}
+	if requested := getParallelChunksPreference(r); requested > 0 {
+		renderFileChunksManifest(w, r, connection, name, info, requested, userFilesChunksPath)
+		return
+	}
 
 	inline := r.URL.Query().Get("inline") != ""
 	if status, err := downloadFile(w, r, connection, name, info, inline, nil); err != nil {
@@ -164,18 +160,26 @@ func getUserFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func setFileDirMetadata(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+func getUserFileChunk(w http.ResponseWriter, r *http.Request) {
+	connection, err := getUserConnection(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
 
-	metadata := make(map[string]int64)
+	serveFileChunk(w, r, connection)
+}
+
+func setFileDirMetadata(w http.ResponseWriter, r *http.Request) {
+	var metadata fileMetadataRequest
 	err := render.DecodeJSON(r.Body, &metadata)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
 		return
 	}
-	mTime, ok := metadata["modification_time"]
-	if !ok || !r.URL.Query().Has("path") {
-		sendAPIResponse(w, r, errors.New("please set a modification_time and a path"), "", http.StatusBadRequest)
+	if (metadata.ModificationTime == nil && len(metadata.Metadata) == 0) || !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set a modification_time or some metadata and a path"), "",
+			http.StatusBadRequest)
 		return
 	}
 
@@ -186,17 +190,48 @@ func setFileDirMetadata(w http.ResponseWriter, r *http.Request) {
 	defer common.Connections.Remove(connection.GetID())
 
 	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
-	attrs := common.StatAttributes{
-		Flags: common.StatAttrTimes,
-		Atime: util.GetTimeFromMsecSinceEpoch(mTime),
-		Mtime: util.GetTimeFromMsecSinceEpoch(mTime),
+	// for some storage backends setting the metadata updates the modification time
+	// so we set it before any modification time change
+	if len(metadata.Metadata) > 0 {
+		if err = patchFileMetadata(connection, name, metadata.Metadata); err != nil {
+			sendAPIResponse(w, r, err, fmt.Sprintf("Unable to set metadata for path %#v", name), getMappedStatusCode(err))
+			return
+		}
+	}
+	if metadata.ModificationTime != nil {
+		attrs := common.StatAttributes{
+			Flags: common.StatAttrTimes,
+			Atime: util.GetTimeFromMsecSinceEpoch(*metadata.ModificationTime),
+			Mtime: util.GetTimeFromMsecSinceEpoch(*metadata.ModificationTime),
+		}
+		err = connection.SetStat(name, &attrs)
+		if err != nil {
+			sendAPIResponse(w, r, err, fmt.Sprintf("Unable to set metadata for path %#v", name), getMappedStatusCode(err))
+			return
+		}
 	}
-	err = connection.SetStat(name, &attrs)
+	sendAPIResponse(w, r, nil, "OK", http.StatusOK)
+}
+
+func getFileDirMetadata(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+
+	connection, err := getUserConnection(w, r)
 	if err != nil {
-		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to set metadata for path %#v", name), getMappedStatusCode(err))
 		return
 	}
-	sendAPIResponse(w, r, nil, "OK", http.StatusOK)
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	metadata, err := connection.GetMetadata(name)
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to get metadata for path %#v", name), getMappedStatusCode(err))
+		return
+	}
+	render.JSON(w, r, metadata)
 }
 
 func uploadUserFile(w http.ResponseWriter, r *http.Request) {
@@ -227,11 +262,14 @@ func uploadUserFile(w http.ResponseWriter, r *http.Request) {
 
 func doUploadFile(w http.ResponseWriter, r *http.Request, connection *Connection, filePath string) error {
 	connection.User.CheckFsRoot(connection.ID) //nolint:errcheck
-	writer, err := connection.getFileWriter(filePath)
+	writer, err := connection.getFileWriter(filePath, r.ContentLength)
 	if err != nil {
 		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to write file %#v", filePath), getMappedStatusCode(err))
 		return err
 	}
+	if f, ok := writer.(*httpdFile); ok {
+		f.SetExpectedChecksum(r.Header.Get(common.ChecksumSHA256Header))
+	}
 	_, err = io.Copy(writer, r.Body)
 	if err != nil {
 		writer.Close() //nolint:errcheck
@@ -269,7 +307,7 @@ func uploadUserFiles(w http.ResponseWriter, r *http.Request) {
 
 	t := newThrottledReader(r.Body, connection.User.UploadBandwidth, connection)
 	r.Body = t
-	err = r.ParseMultipartForm(maxMultipartMem)
+	err = r.ParseMultipartForm(requestSizeLimits.FileUploadMeta)
 	if err != nil {
 		connection.RemoveTransfer(t)
 		sendAPIResponse(w, r, err, "Unable to parse multipart form", http.StatusBadRequest)
@@ -308,7 +346,7 @@ func doUploadFiles(w http.ResponseWriter, r *http.Request, connection *Connectio
 		defer file.Close()
 
 		filePath := path.Join(parentDir, path.Base(util.CleanPath(f.Filename)))
-		writer, err := connection.getFileWriter(filePath)
+		writer, err := connection.getFileWriter(filePath, f.Size)
 		if err != nil {
 			sendAPIResponse(w, r, err, fmt.Sprintf("Unable to write file %#v", f.Filename), getMappedStatusCode(err))
 			return uploaded
@@ -331,12 +369,10 @@ func doUploadFiles(w http.ResponseWriter, r *http.Request, connection *Connectio
 }
 
 func renameUserFile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	renameItem(w, r)
 }
 
 func deleteUserFile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -372,7 +408,6 @@ func deleteUserFile(w http.ResponseWriter, r *http.Request) {
 }
 
 func getUserFilesAsZipStream(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	connection, err := getUserConnection(w, r)
 	if err != nil {
 		return
@@ -395,11 +430,10 @@ func getUserFilesAsZipStream(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"",
 		getCompressedFileName(connection.GetUsername(), filesList)))
-	renderCompressedFiles(w, connection, baseDir, filesList, nil)
+	renderCompressedFiles(w, connection, baseDir, filesList, nil, archiveFormatZip)
 }
 
 func getUserProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -416,13 +450,14 @@ func getUserProfile(w http.ResponseWriter, r *http.Request) {
 			Description:     user.Description,
 			AllowAPIKeyAuth: user.Filters.AllowAPIKeyAuth,
 		},
-		PublicKeys: user.PublicKeys,
+		PublicKeys:         user.PublicKeys,
+		AllowImpersonation: util.BoolPtr(user.IsImpersonationAllowed()),
+		LoginNotification:  &user.Filters.LoginNotification,
 	}
 	render.JSON(w, r, resp)
 }
 
 func updateUserProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -452,6 +487,12 @@ func updateUserProfile(w http.ResponseWriter, r *http.Request) {
 	if userMerged.CanChangeInfo() {
 		user.Email = req.Email
 		user.Description = req.Description
+		if req.AllowImpersonation != nil {
+			user.Filters.AllowImpersonation = req.AllowImpersonation
+		}
+		if req.LoginNotification != nil {
+			user.Filters.LoginNotification = *req.LoginNotification
+		}
 	}
 	if err := dataprovider.UpdateUser(&user, dataprovider.ActionExecutorSelf, util.GetIPFromRemoteAddress(r.RemoteAddr)); err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -461,8 +502,6 @@ func updateUserProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func changeUserPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	var pwd pwdChange
 	err := render.DecodeJSON(r.Body, &pwd)
 	if err != nil {
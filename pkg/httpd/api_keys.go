@@ -26,7 +26,6 @@ import (
 )
 
 func getAPIKeys(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit, offset, order, err := getSearchFilters(w, r)
 	if err != nil {
 		return
@@ -41,7 +40,6 @@ func getAPIKeys(w http.ResponseWriter, r *http.Request) {
 }
 
 func getAPIKeyByID(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	keyID := getURLParam(r, "id")
 	apiKey, err := dataprovider.APIKeyExists(keyID)
 	if err != nil {
@@ -54,7 +52,6 @@ func getAPIKeyByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func addAPIKey(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -85,7 +82,6 @@ func addAPIKey(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateAPIKey(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -112,8 +108,25 @@ func updateAPIKey(w http.ResponseWriter, r *http.Request) {
 	sendAPIResponse(w, r, nil, "API key updated", http.StatusOK)
 }
 
+func rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	keyID := getURLParam(r, "id")
+	apiKey, err := dataprovider.RotateAPIKey(keyID, claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	response := make(map[string]string)
+	response["message"] = "API key rotated. This is the only time the new API key is visible, please save it."
+	response["key"] = apiKey.DisplayKey()
+	render.JSON(w, r, response)
+}
+
 func deleteAPIKey(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	keyID := getURLParam(r, "id")
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/render"
 
@@ -49,8 +50,8 @@ func validateBackupFile(outputFile string) (string, error) {
 }
 
 func dumpData(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var outputFile, outputData, indent string
+	var since time.Time
 	if _, ok := r.URL.Query()["output-file"]; ok {
 		outputFile = strings.TrimSpace(r.URL.Query().Get("output-file"))
 	}
@@ -60,6 +61,14 @@ func dumpData(w http.ResponseWriter, r *http.Request) {
 	if _, ok := r.URL.Query()["indent"]; ok {
 		indent = strings.TrimSpace(r.URL.Query().Get("indent"))
 	}
+	if val := strings.TrimSpace(r.URL.Query().Get("since")); val != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, val)
+		if err != nil {
+			sendAPIResponse(w, r, err, "Invalid since parameter, it must be a RFC3339 date time", http.StatusBadRequest)
+			return
+		}
+	}
 
 	if outputData != "1" {
 		var err error
@@ -71,16 +80,22 @@ func dumpData(w http.ResponseWriter, r *http.Request) {
 
 		err = os.MkdirAll(filepath.Dir(outputFile), 0700)
 		if err != nil {
-			logger.Error(logSender, "", "dumping data error: %v, output file: %#v", err, outputFile)
+			logForRequest(r, logger.LevelError, "dumping data error: %v, output file: %#v", err, outputFile)
 			sendAPIResponse(w, r, err, "", getRespStatus(err))
 			return
 		}
-		logger.Debug(logSender, "", "dumping data to: %#v", outputFile)
+		logForRequest(r, logger.LevelDebug, "dumping data to: %#v", outputFile)
 	}
 
-	backup, err := dataprovider.DumpData()
+	var backup dataprovider.BackupData
+	var err error
+	if since.IsZero() {
+		backup, err = dataprovider.DumpData()
+	} else {
+		backup, err = dataprovider.DumpDataSince(since)
+	}
 	if err != nil {
-		logger.Error(logSender, "", "dumping data error: %v, output file: %#v", err, outputFile)
+		logForRequest(r, logger.LevelError, "dumping data error: %v, output file: %#v", err, outputFile)
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
 		return
 	}
@@ -101,16 +116,15 @@ func dumpData(w http.ResponseWriter, r *http.Request) {
 		err = os.WriteFile(outputFile, dump, 0600)
 	}
 	if err != nil {
-		logger.Warn(logSender, "", "dumping data error: %v, output file: %#v", err, outputFile)
+		logForRequest(r, logger.LevelWarn, "dumping data error: %v, output file: %#v", err, outputFile)
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
 		return
 	}
-	logger.Debug(logSender, "", "dumping data completed, output file: %#v, error: %v", outputFile, err)
+	logForRequest(r, logger.LevelDebug, "dumping data completed, output file: %#v, error: %v", outputFile, err)
 	sendAPIResponse(w, r, err, "Data saved", http.StatusOK)
 }
 
 func loadDataFromRequest(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, MaxRestoreSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -138,7 +152,6 @@ func loadDataFromRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func loadData(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -158,9 +171,10 @@ func loadData(w http.ResponseWriter, r *http.Request) {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
 		return
 	}
-	if fi.Size() > MaxRestoreSize {
+	maxRestoreSize := requestSizeLimits.getLimit(requestSizeUserBulkImport)
+	if fi.Size() > maxRestoreSize {
 		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to restore input file: %#v size too big: %v/%v bytes",
-			inputFile, fi.Size(), MaxRestoreSize), http.StatusBadRequest)
+			inputFile, fi.Size(), maxRestoreSize), http.StatusBadRequest)
 		return
 	}
 
@@ -408,7 +422,7 @@ func RestoreAdmins(admins []dataprovider.Admin, inputFile string, mode int, exec
 
 // RestoreGroups restores the specified groups
 func RestoreGroups(groups []dataprovider.Group, inputFile string, mode int, executor, ipAddress string) error {
-	for _, group := range groups {
+	for _, group := range dataprovider.SortGroupsByHierarchy(groups) {
 		group := group // pin
 		g, err := dataprovider.GroupExists(group.Name)
 		if err == nil {
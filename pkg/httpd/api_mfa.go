@@ -22,9 +22,11 @@ import (
 
 	"github.com/go-chi/render"
 
+	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/mfa"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
@@ -55,12 +57,10 @@ type recoveryCode struct {
 }
 
 func getTOTPConfigs(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	render.JSON(w, r, mfa.GetAvailableTOTPConfigs())
 }
 
 func generateTOTPSecret(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -93,7 +93,6 @@ func generateTOTPSecret(w http.ResponseWriter, r *http.Request) {
 }
 
 func saveTOTPConfig(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -127,7 +126,6 @@ func saveTOTPConfig(w http.ResponseWriter, r *http.Request) {
 }
 
 func validateTOTPPasscode(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var req validateTOTPRequest
 	err := render.DecodeJSON(r.Body, &req)
 	if err != nil {
@@ -143,7 +141,6 @@ func validateTOTPPasscode(w http.ResponseWriter, r *http.Request) {
 }
 
 func getRecoveryCodes(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -189,7 +186,6 @@ func getRecoveryCodes(w http.ResponseWriter, r *http.Request) {
 }
 
 func generateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -279,6 +275,7 @@ func saveAdminTOTPConfig(username string, r *http.Request, recoveryCodes []datap
 	if err != nil {
 		return err
 	}
+	wasEnabled := admin.Filters.TOTPConfig.Enabled
 	currentTOTPSecret := admin.Filters.TOTPConfig.Secret
 	admin.Filters.TOTPConfig.Secret = nil
 	err = render.DecodeJSON(r.Body, &admin.Filters.TOTPConfig)
@@ -295,5 +292,20 @@ func saveAdminTOTPConfig(username string, r *http.Request, recoveryCodes []datap
 	if admin.Filters.TOTPConfig.Secret == nil || !admin.Filters.TOTPConfig.Secret.IsPlain() {
 		admin.Filters.TOTPConfig.Secret = currentTOTPSecret
 	}
-	return dataprovider.UpdateAdmin(&admin, dataprovider.ActionExecutorSelf, util.GetIPFromRemoteAddress(r.RemoteAddr))
+	if err := dataprovider.UpdateAdmin(&admin, dataprovider.ActionExecutorSelf, util.GetIPFromRemoteAddress(r.RemoteAddr)); err != nil {
+		return err
+	}
+	if wasEnabled && !admin.Filters.TOTPConfig.Enabled {
+		addAdmin2FADisabledAlert(admin.Username, r)
+	}
+	return nil
+}
+
+func addAdmin2FADisabledAlert(username string, r *http.Request) {
+	smtp.AddSecurityAlert(smtp.SecurityAlert{
+		Event:    smtp.SecurityAlertAdmin2FADisabled,
+		Username: username,
+		IP:       util.GetIPFromRemoteAddress(r.RemoteAddr),
+		Protocol: common.ProtocolHTTP,
+	})
 }
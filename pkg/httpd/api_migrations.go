@@ -0,0 +1,47 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+)
+
+func getOnlineMigrations(w http.ResponseWriter, r *http.Request) {
+	migrations, err := dataprovider.GetOnlineMigrations()
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, migrations)
+}
+
+func pauseOnlineMigration(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(getURLParam(r, "version"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "Invalid version", http.StatusBadRequest)
+		return
+	}
+	if err := dataprovider.PauseOnlineMigration(version); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, fmt.Sprintf("Online migration to version %d paused", version), http.StatusOK)
+}
@@ -0,0 +1,394 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/klauspost/compress/zip"
+	"github.com/rs/xid"
+	"github.com/sftpgo/sdk/plugin/eventsearcher"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/plugin"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	personalDataExportInterval = time.Hour
+	personalDataPageSize       = 100
+	personalDataMaxFsEvents    = 1000
+	personalDataReadme         = `This archive contains the data SFTPGo stores about the user %q.
+It was generated on %s.
+
+account.json
+  The account record. The password hash and the other secrets are not included.
+
+login_history.json
+  The last login time and the first upload and download times.
+  SFTPGo does not store a full login history, the login events are only
+  available in the server logs.
+
+transfer_logs.json
+  The most recent %d filesystem events recorded for the user, such as uploads,
+  downloads, renames and deletes. This file is empty if the events are not
+  stored by an event search plugin.
+
+quota.json
+  The current quota usage and limits. Quota usage history is not stored.
+
+shares.json
+  The share links created by the user. The share passwords are not included.
+
+api_keys.json
+  The metadata of the API keys associated with the user. The key values are
+  not included.
+`
+)
+
+var personalDataExports = newPersonalDataExportTracker(personalDataExportInterval)
+
+type loginHistory struct {
+	Username      string `json:"username"`
+	LastLogin     int64  `json:"last_login"`
+	FirstUpload   int64  `json:"first_upload"`
+	FirstDownload int64  `json:"first_download"`
+}
+
+type personalDataQuota struct {
+	Username                 string `json:"username"`
+	UsedQuotaSize            int64  `json:"used_quota_size"`
+	UsedQuotaFiles           int    `json:"used_quota_files"`
+	LastQuotaUpdate          int64  `json:"last_quota_update"`
+	QuotaSize                int64  `json:"quota_size"`
+	QuotaFiles               int    `json:"quota_files"`
+	UsedUploadDataTransfer   int64  `json:"used_upload_data_transfer"`
+	UsedDownloadDataTransfer int64  `json:"used_download_data_transfer"`
+}
+
+// personalDataExportTracker limits the number of personal data exports
+// allowed for each user
+type personalDataExportTracker struct {
+	sync.Mutex
+	interval time.Duration
+	exports  map[string]time.Time
+}
+
+func newPersonalDataExportTracker(interval time.Duration) *personalDataExportTracker {
+	return &personalDataExportTracker{
+		interval: interval,
+		exports:  make(map[string]time.Time),
+	}
+}
+
+// reserve returns 0 if an export is allowed for the specified user, otherwise
+// the time to wait before the next export is allowed
+func (t *personalDataExportTracker) reserve(username string) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+	for k, v := range t.exports {
+		if now.Sub(v) >= t.interval {
+			delete(t.exports, k)
+		}
+	}
+	if last, ok := t.exports[username]; ok {
+		return t.interval - now.Sub(last)
+	}
+	t.exports[username] = now
+	return 0
+}
+
+func (t *personalDataExportTracker) release(username string) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.exports, username)
+}
+
+func exportUserData(w http.ResponseWriter, r *http.Request) {
+	renderPersonalData(w, r, getURLParam(r, "username"))
+}
+
+func exportUserDataSelf(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	password := r.Header.Get(passwordHeader)
+	if password == "" {
+		sendAPIResponse(w, r, nil, "Your current password is required to export your data", http.StatusBadRequest)
+		return
+	}
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	if _, err := dataprovider.CheckUserAndPass(claims.Username, password, ipAddr, getProtocolFromRequest(r)); err != nil {
+		sendAPIResponse(w, r, dataprovider.ErrInvalidCredentials, "", http.StatusForbidden)
+		return
+	}
+
+	renderPersonalData(w, r, claims.Username)
+}
+
+func renderPersonalData(w http.ResponseWriter, r *http.Request, username string) {
+	user, err := dataprovider.UserExists(username)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if delay := personalDataExports.reserve(user.Username); delay > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", delay.Seconds()))
+		sendAPIResponse(w, r, nil, "Only one export per hour is allowed", http.StatusTooManyRequests)
+		return
+	}
+	data, err := getPersonalDataArchive(user)
+	if err != nil {
+		personalDataExports.release(user.Username)
+		logForRequest(r, logger.LevelWarn, "unable to export the data for user %q: %v", user.Username, err)
+		sendAPIResponse(w, r, err, "Unable to export the user data", getRespStatus(err))
+		return
+	}
+	logForRequest(r, logger.LevelInfo, "exported personal data for user %q, requested from IP %q",
+		user.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-personal-data.zip\"", user.Username))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data) //nolint:errcheck
+}
+
+func getPersonalDataArchive(user dataprovider.User) ([]byte, error) {
+	transferLogs, err := getUserFsEvents(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := getUserSharesForExport(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := getUserAPIKeysForExport(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	history := loginHistory{
+		Username:      user.Username,
+		LastLogin:     user.LastLogin,
+		FirstUpload:   user.FirstUpload,
+		FirstDownload: user.FirstDownload,
+	}
+	quota := personalDataQuota{
+		Username:                 user.Username,
+		UsedQuotaSize:            user.UsedQuotaSize,
+		UsedQuotaFiles:           user.UsedQuotaFiles,
+		LastQuotaUpdate:          user.LastQuotaUpdate,
+		QuotaSize:                user.QuotaSize,
+		QuotaFiles:               user.QuotaFiles,
+		UsedUploadDataTransfer:   user.UsedUploadDataTransfer,
+		UsedDownloadDataTransfer: user.UsedDownloadDataTransfer,
+	}
+	user.PrepareForRendering()
+
+	var buf bytes.Buffer
+	wr := zip.NewWriter(&buf)
+	readme := fmt.Sprintf(personalDataReadme, user.Username, time.Now().UTC().Format(time.RFC3339), personalDataMaxFsEvents)
+	if err := addPersonalDataZipEntry(wr, "README.txt", []byte(readme)); err != nil {
+		return nil, err
+	}
+	for _, entry := range []struct {
+		name string
+		data any
+	}{
+		{"account.json", user},
+		{"login_history.json", history},
+		{"transfer_logs.json", transferLogs},
+		{"quota.json", quota},
+		{"shares.json", shares},
+		{"api_keys.json", apiKeys},
+	} {
+		data, err := json.MarshalIndent(entry.data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := addPersonalDataZipEntry(wr, entry.name, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := wr.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func addPersonalDataZipEntry(wr *zip.Writer, name string, data []byte) error {
+	f, err := wr.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func getUserFsEvents(username string) (json.RawMessage, error) {
+	data, _, _, err := plugin.Handler.SearchFsEvents(&eventsearcher.FsEventSearch{
+		CommonSearchParams: eventsearcher.CommonSearchParams{
+			Username: username,
+			Limit:    personalDataMaxFsEvents,
+		},
+		FsProvider: -1,
+	})
+	if err != nil {
+		if errors.Is(err, plugin.ErrNoSearcher) {
+			return json.RawMessage("[]"), nil
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return json.RawMessage("[]"), nil
+	}
+	return json.RawMessage(data), nil
+}
+
+func getUserSharesForExport(username string) ([]dataprovider.Share, error) {
+	var result []dataprovider.Share
+	for offset := 0; ; offset += personalDataPageSize {
+		shares, err := dataprovider.GetShares(personalDataPageSize, offset, dataprovider.OrderASC, username)
+		if err != nil {
+			return nil, err
+		}
+		for idx := range shares {
+			shares[idx].HideConfidentialData()
+			result = append(result, shares[idx])
+		}
+		if len(shares) < personalDataPageSize {
+			break
+		}
+	}
+	if result == nil {
+		result = []dataprovider.Share{}
+	}
+	return result, nil
+}
+
+func getUserAPIKeysForExport(username string) ([]dataprovider.APIKey, error) {
+	result := []dataprovider.APIKey{}
+	for offset := 0; ; offset += personalDataPageSize {
+		keys, err := dataprovider.GetAPIKeys(personalDataPageSize, offset, dataprovider.OrderASC)
+		if err != nil {
+			return nil, err
+		}
+		for idx := range keys {
+			if keys[idx].User != username {
+				continue
+			}
+			keys[idx].HideConfidentialData()
+			result = append(result, keys[idx])
+		}
+		if len(keys) < personalDataPageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+func deleteUserPersonalData(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	preserveFiles := false
+	if val := r.URL.Query().Get("preserve_files"); val != "" {
+		preserveFiles, err = strconv.ParseBool(val)
+		if err != nil {
+			sendAPIResponse(w, r, err, "Invalid preserve_files parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	// disconnect the user before removing the files, active transfers
+	// could recreate them
+	disconnectUser(user.Username, claims.Username)
+
+	if preserveFiles {
+		anonymizedUsername, err := dataprovider.AnonymizeUser(user.Username, claims.Username, ipAddr)
+		if err != nil {
+			sendAPIResponse(w, r, err, "", getRespStatus(err))
+			return
+		}
+		logForRequest(r, logger.LevelInfo, "personal data for user %q erased, files preserved for user %q",
+			user.Username, anonymizedUsername)
+		render.JSON(w, r, map[string]string{
+			"message":  "Personal data erased, files preserved",
+			"username": anonymizedUsername,
+		})
+		return
+	}
+	if err := removeUserFiles(user); err != nil {
+		sendAPIResponse(w, r, err, "Unable to remove the user files", getRespStatus(err))
+		return
+	}
+	if err := dataprovider.DeleteUser(user.Username, claims.Username, ipAddr); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	logForRequest(r, logger.LevelInfo, "personal data and files for user %q erased", user.Username)
+	sendAPIResponse(w, r, nil, "Personal data and files erased", http.StatusOK)
+}
+
+// removeUserFiles removes the contents of the user home directory.
+// Virtual folders can be shared among users so they are not modified
+func removeUserFiles(user dataprovider.User) error {
+	user.Permissions = map[string][]string{
+		"/": {dataprovider.PermAny},
+	}
+	user.VirtualFolders = nil
+	connection := common.NewBaseConnection(xid.New().String(), common.ProtocolHTTP, "", "", user)
+	if err := connection.User.CheckFsRoot(connection.ID); err != nil {
+		return err
+	}
+	defer connection.User.CloseFs() //nolint:errcheck
+
+	entries, err := connection.ListDir("/")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := connection.RemoveAll("/" + entry.Name()); err != nil {
+			return fmt.Errorf("unable to remove %q: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
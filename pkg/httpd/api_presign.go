@@ -0,0 +1,80 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/webdavd"
+)
+
+type presignUploadRequest struct {
+	Path             string `json:"path"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
+	MaxSize          int64  `json:"max_size"`
+}
+
+func presignUpload(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	var req presignUploadRequest
+	if err = render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		sendAPIResponse(w, r, nil, "Invalid expiration", http.StatusBadRequest)
+		return
+	}
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if util.Contains(user.Filters.DeniedProtocols, common.ProtocolWebDAV) {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("Protocol %s is not allowed for user %q", common.ProtocolWebDAV, user.Username),
+			http.StatusBadRequest)
+		return
+	}
+	name := user.GetCleanedPath(req.Path)
+	signedURL, expiresAt, err := webdavd.SignUploadURL(user.Username, name,
+		time.Duration(req.ExpiresInSeconds)*time.Second, req.MaxSize)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	logger.Info(logSender, "", "admin %q generated a presigned upload URL for user %q, path %q, expires at: %v",
+		claims.Username, user.Username, name, expiresAt.UTC())
+	render.JSON(w, r, map[string]any{
+		"url":        signedURL,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -42,18 +42,63 @@ type transferQuotaUsage struct {
 	UsedDownloadDataTransfer int64 `json:"used_download_data_transfer"`
 }
 
+// userQuotaStats defines the stored quota usage for a user and, if requested,
+// the real usage calculated scanning the user filesystems
+type userQuotaStats struct {
+	Username    string      `json:"username"`
+	QuotaSize   int64       `json:"quota_size"`
+	QuotaFiles  int         `json:"quota_files"`
+	StoredQuota quotaUsage  `json:"stored_quota"`
+	RealQuota   *quotaUsage `json:"real_quota,omitempty"`
+	DriftBytes  *int64      `json:"drift_bytes,omitempty"`
+	DriftFiles  *int        `json:"drift_files,omitempty"`
+}
+
+func getUserQuotaStats(w http.ResponseWriter, r *http.Request) {
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	stats := userQuotaStats{
+		Username:   user.Username,
+		QuotaSize:  user.QuotaSize,
+		QuotaFiles: user.QuotaFiles,
+		StoredQuota: quotaUsage{
+			UsedQuotaSize:  user.UsedQuotaSize,
+			UsedQuotaFiles: user.UsedQuotaFiles,
+		},
+	}
+	if getBoolQueryParam(r, "recalculate") {
+		numFiles, size, err := user.ScanDiskUsage()
+		if err != nil {
+			logger.Warn(logSender, "", "error scanning disk usage for user %q: %v", user.Username, err)
+			sendAPIResponse(w, r, err, "Unable to calculate the real quota usage", getMappedStatusCode(err))
+			return
+		}
+		driftBytes := size - user.UsedQuotaSize
+		driftFiles := numFiles - user.UsedQuotaFiles
+		stats.RealQuota = &quotaUsage{
+			UsedQuotaSize:  size,
+			UsedQuotaFiles: numFiles,
+		}
+		stats.DriftBytes = &driftBytes
+		stats.DriftFiles = &driftFiles
+		logger.Debug(logSender, "", "disk usage scanned for user %q, files: %d, size: %d, drift files: %d, drift bytes: %d",
+			user.Username, numFiles, size, driftFiles, driftBytes)
+	}
+	render.JSON(w, r, stats)
+}
+
 func getUsersQuotaScans(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	render.JSON(w, r, common.QuotaScans.GetUsersQuotaScans())
 }
 
 func getFoldersQuotaScans(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	render.JSON(w, r, common.QuotaScans.GetVFoldersQuotaScans())
 }
 
 func updateUserQuotaUsage(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var usage quotaUsage
 	err := render.DecodeJSON(r.Body, &usage)
 	if err != nil {
@@ -64,7 +109,6 @@ func updateUserQuotaUsage(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateFolderQuotaUsage(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var usage quotaUsage
 	err := render.DecodeJSON(r.Body, &usage)
 	if err != nil {
@@ -75,17 +119,14 @@ func updateFolderQuotaUsage(w http.ResponseWriter, r *http.Request) {
 }
 
 func startUserQuotaScan(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	doStartUserQuotaScan(w, r, getURLParam(r, "username"))
 }
 
 func startFolderQuotaScan(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	doStartFolderQuotaScan(w, r, getURLParam(r, "name"))
 }
 
 func updateUserTransferQuotaUsage(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var usage transferQuotaUsage
 	err := render.DecodeJSON(r.Body, &usage)
 	if err != nil {
@@ -0,0 +1,45 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+type rcloneImportRequest struct {
+	// Rclone remote, it can include a path, for example "myremote:bucket/prefix"
+	Remote string `json:"remote"`
+	// Rclone config file contents
+	ConfigFile string `json:"config_file"`
+}
+
+func importRcloneRemote(w http.ResponseWriter, r *http.Request) {
+	var req rcloneImportRequest
+	err := render.DecodeJSON(r.Body, &req)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	fs, err := vfs.ImportRcloneRemote(req.Remote, req.ConfigFile)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, fs)
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+)
+
+func getUserReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	username := getURLParam(r, "username")
+	virtualPath := r.URL.Query().Get("path")
+	if virtualPath == "" {
+		sendAPIResponse(w, r, errors.New("the path is mandatory"), "", http.StatusBadRequest)
+		return
+	}
+	if _, err := dataprovider.UserExists(username); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	status, err := dataprovider.GetReplicationStatus(username, virtualPath)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, status)
+}
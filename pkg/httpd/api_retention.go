@@ -15,6 +15,7 @@
 package httpd
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -25,12 +26,10 @@ import (
 )
 
 func getRetentionChecks(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	render.JSON(w, r, common.RetentionChecks.Get())
 }
 
 func startRetentionCheck(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	user, err := dataprovider.GetUserWithGroupSettings(username)
 	if err != nil {
@@ -74,3 +73,33 @@ func startRetentionCheck(w http.ResponseWriter, r *http.Request) {
 	go c.Start() //nolint:errcheck
 	sendAPIResponse(w, r, err, "Check started", http.StatusAccepted)
 }
+
+func scanUserDataRetention(w http.ResponseWriter, r *http.Request) {
+	username := getURLParam(r, "username")
+	user, err := dataprovider.GetUserWithGroupSettings(username)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	simulate := getBoolQueryParam(r, "simulate")
+	c, err := common.NewRetentionPolicyCheck(&user, simulate)
+	if err != nil {
+		if errors.Is(err, common.ErrRetentionCheckInProgress) {
+			sendAPIResponse(w, r, err, fmt.Sprintf("Another check is already in progress for user %q", username),
+				http.StatusConflict)
+			return
+		}
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if !simulate {
+		go c.Start() //nolint:errcheck
+		sendAPIResponse(w, r, nil, "Check started", http.StatusAccepted)
+		return
+	}
+	if err := c.Start(); err != nil {
+		sendAPIResponse(w, r, err, "Unable to scan the user files", getMappedStatusCode(err))
+		return
+	}
+	render.JSON(w, r, c.GetSimulatedFiles())
+}
@@ -0,0 +1,41 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"net/http"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/smtp"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+func testSecurityAlert(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	if !smtp.IsSecurityAlertEnabled() {
+		sendAPIResponse(w, r, nil, "No SMTP configuration or security alert email", http.StatusBadRequest)
+		return
+	}
+	err = smtp.SendTestSecurityAlert(claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr), common.ProtocolHTTP)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to send the test security alert", http.StatusInternalServerError)
+		return
+	}
+	sendAPIResponse(w, r, nil, "Test security alert sent", http.StatusOK)
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+func getUserSessionsSelf(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	renderUserSessions(w, r, claims.Username)
+}
+
+func revokeUserSessionSelf(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	doRevokeUserSession(w, r, claims.Username, getURLParam(r, "id"))
+}
+
+func getUserSessions(w http.ResponseWriter, r *http.Request) {
+	username := getURLParam(r, "username")
+	if _, err := dataprovider.UserExists(username); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	renderUserSessions(w, r, username)
+}
+
+func revokeUserSession(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	username := getURLParam(r, "username")
+	if _, err := dataprovider.UserExists(username); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	logForRequest(r, logger.LevelInfo, "admin %q is revoking the session %q for user %q", claims.Username,
+		getURLParam(r, "id"), username)
+	doRevokeUserSession(w, r, username, getURLParam(r, "id"))
+}
+
+func renderUserSessions(w http.ResponseWriter, r *http.Request, username string) {
+	sessions, err := userSessionsMgr.List(username)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to get the sessions", getRespStatus(err))
+		return
+	}
+	if sessions == nil {
+		sessions = []dataprovider.UserSession{}
+	}
+	render.JSON(w, r, sessions)
+}
+
+func doRevokeUserSession(w http.ResponseWriter, r *http.Request, username, id string) {
+	if err := userSessionsMgr.Revoke(username, id); err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, "Session revoked", http.StatusOK)
+}
@@ -35,7 +35,6 @@ import (
 )
 
 func getShares(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -55,7 +54,6 @@ func getShares(w http.ResponseWriter, r *http.Request) {
 }
 
 func getShareByID(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -73,7 +71,6 @@ func getShareByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func addShare(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -118,7 +115,6 @@ func addShare(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateShare(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -158,7 +154,6 @@ func updateShare(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteShare(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	shareID := getURLParam(r, "id")
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
@@ -175,7 +170,6 @@ func deleteShare(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *httpdServer) readBrowsableShareContents(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, false)
 	if err != nil {
@@ -192,7 +186,7 @@ func (s *httpdServer) readBrowsableShareContents(w http.ResponseWriter, r *http.
 	}
 
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -206,7 +200,6 @@ func (s *httpdServer) readBrowsableShareContents(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) downloadBrowsableSharedFile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, false)
 	if err != nil {
@@ -223,7 +216,7 @@ func (s *httpdServer) downloadBrowsableSharedFile(w http.ResponseWriter, r *http
 	}
 
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -256,7 +249,6 @@ func (s *httpdServer) downloadBrowsableSharedFile(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) downloadFromShare(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, false)
 	if err != nil {
@@ -264,7 +256,7 @@ func (s *httpdServer) downloadFromShare(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -297,8 +289,8 @@ func (s *httpdServer) downloadFromShare(w http.ResponseWriter, r *http.Request)
 			baseDir = share.Paths[0]
 			share.Paths[0] = "/"
 		}
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"share-%v.zip\"", share.Name))
-		renderCompressedFiles(w, connection, baseDir, share.Paths, &share)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%#v", getShareArchiveName(&share)))
+		renderCompressedFiles(w, connection, baseDir, share.Paths, &share, archiveFormatZip)
 		return
 	}
 	if status, err := downloadFile(w, r, connection, share.Paths[0], info, false, &share); err != nil {
@@ -337,7 +329,7 @@ func (s *httpdServer) uploadFileToShare(w http.ResponseWriter, r *http.Request)
 	dataprovider.UpdateShareLastUse(&share, 1) //nolint:errcheck
 
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -365,14 +357,14 @@ func (s *httpdServer) uploadFilesToShare(w http.ResponseWriter, r *http.Request)
 	}
 
 	if err = common.Connections.Add(connection); err != nil {
-		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusTooManyRequests)
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
 
 	t := newThrottledReader(r.Body, connection.User.UploadBandwidth, connection)
 	r.Body = t
-	err = r.ParseMultipartForm(maxMultipartMem)
+	err = r.ParseMultipartForm(requestSizeLimits.FileUploadMeta)
 	if err != nil {
 		connection.RemoveTransfer(t)
 		sendAPIResponse(w, r, err, "Unable to parse multipart form", http.StatusBadRequest)
@@ -451,11 +443,8 @@ func (s *httpdServer) checkPublicShare(w http.ResponseWriter, r *http.Request, v
 		return share, nil, err
 	}
 	connID := xid.New().String()
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, common.ProtocolHTTPShare, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, common.ProtocolHTTPShare, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 
 	return share, connection, nil
 }
@@ -502,3 +491,13 @@ func getBrowsableSharedPath(share dataprovider.Share, r *http.Request) (string,
 	}
 	return name, nil
 }
+
+func getShareArchiveName(share *dataprovider.Share) string {
+	if share.DisplayName == "" {
+		return fmt.Sprintf("share-%v.zip", share.Name)
+	}
+	if strings.HasSuffix(strings.ToLower(share.DisplayName), ".zip") {
+		return share.DisplayName
+	}
+	return share.DisplayName + ".zip"
+}
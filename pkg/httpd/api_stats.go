@@ -0,0 +1,249 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sftpgo/sdk/plugin/eventsearcher"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/plugin"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	transferStatsFormatCSV  = "csv"
+	transferStatsFormatJSON = "json"
+	// number of events requested to the events searcher for each page
+	transferStatsPageSize = 1000
+)
+
+var transferStatsCSVHeader = []string{"timestamp", "username", "protocol", "operation", "virtual_path", "bytes",
+	"duration_ms", "source_ip", "status"}
+
+// transferEvent defines the fields we need from the events returned by the events searcher
+type transferEvent struct {
+	Timestamp   int64  `json:"timestamp"`
+	Action      string `json:"action"`
+	Username    string `json:"username"`
+	VirtualPath string `json:"virtual_path"`
+	FileSize    int64  `json:"file_size"`
+	Elapsed     int64  `json:"elapsed"`
+	Status      int    `json:"status"`
+	Protocol    string `json:"protocol"`
+	IP          string `json:"ip"`
+}
+
+type transferStatsEntry struct {
+	Timestamp   string `json:"timestamp"`
+	Username    string `json:"username"`
+	Protocol    string `json:"protocol"`
+	Operation   string `json:"operation"`
+	VirtualPath string `json:"virtual_path"`
+	Bytes       int64  `json:"bytes"`
+	DurationMs  int64  `json:"duration_ms"`
+	SourceIP    string `json:"source_ip"`
+	Status      string `json:"status"`
+}
+
+func (e *transferStatsEntry) getCSVRecord() []string {
+	return []string{e.Timestamp, e.Username, e.Protocol, e.Operation, e.VirtualPath,
+		strconv.FormatInt(e.Bytes, 10), strconv.FormatInt(e.DurationMs, 10), e.SourceIP, e.Status}
+}
+
+func newTransferStatsEntry(ev *transferEvent) transferStatsEntry {
+	return transferStatsEntry{
+		Timestamp:   time.Unix(0, ev.Timestamp).UTC().Format(time.RFC3339Nano),
+		Username:    ev.Username,
+		Protocol:    ev.Protocol,
+		Operation:   ev.Action,
+		VirtualPath: ev.VirtualPath,
+		Bytes:       ev.FileSize,
+		DurationMs:  ev.Elapsed,
+		SourceIP:    ev.IP,
+		Status:      getTransferStatusAsString(ev.Status),
+	}
+}
+
+func getTransferStatusAsString(status int) string {
+	switch status {
+	case 1:
+		return "ok"
+	case 3:
+		return "quota_exceeded"
+	default:
+		return "error"
+	}
+}
+
+// transferStatsWriter writes the transfer statistics in the requested format
+type transferStatsWriter interface {
+	writeHeader() error
+	write(entry *transferStatsEntry) error
+	flush() error
+}
+
+type csvTransferStatsWriter struct {
+	wr *csv.Writer
+}
+
+func (w *csvTransferStatsWriter) writeHeader() error {
+	return w.wr.Write(transferStatsCSVHeader)
+}
+
+func (w *csvTransferStatsWriter) write(entry *transferStatsEntry) error {
+	return w.wr.Write(entry.getCSVRecord())
+}
+
+func (w *csvTransferStatsWriter) flush() error {
+	w.wr.Flush()
+	return w.wr.Error()
+}
+
+type jsonTransferStatsWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonTransferStatsWriter) writeHeader() error {
+	return nil
+}
+
+func (w *jsonTransferStatsWriter) write(entry *transferStatsEntry) error {
+	// Encode adds a newline after each entry as required for NDJSON
+	return w.enc.Encode(entry)
+}
+
+func (w *jsonTransferStatsWriter) flush() error {
+	return nil
+}
+
+func newTransferStatsWriter(w io.Writer, format string) transferStatsWriter {
+	if format == transferStatsFormatJSON {
+		return &jsonTransferStatsWriter{enc: json.NewEncoder(w)}
+	}
+	return &csvTransferStatsWriter{wr: csv.NewWriter(w)}
+}
+
+func getTransferStatsTimeParam(r *http.Request, name string) (int64, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return 0, util.NewValidationError(fmt.Sprintf("invalid %s time %q, RFC 3339 format is required", name, val))
+	}
+	return t.UnixNano(), nil
+}
+
+func getTransferStatsSearchFromRequest(r *http.Request) (eventsearcher.FsEventSearch, string, error) {
+	s := eventsearcher.FsEventSearch{
+		CommonSearchParams: eventsearcher.CommonSearchParams{
+			Actions:  []string{"upload", "download"},
+			Username: r.URL.Query().Get("username"),
+			Limit:    transferStatsPageSize,
+			Order:    1,
+		},
+		FsProvider: -1,
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transferStatsFormatCSV
+	}
+	if format != transferStatsFormatCSV && format != transferStatsFormatJSON {
+		return s, format, util.NewValidationError(fmt.Sprintf("unsupported format %q", format))
+	}
+	var err error
+	s.StartTimestamp, err = getTransferStatsTimeParam(r, "from")
+	if err != nil {
+		return s, format, err
+	}
+	s.EndTimestamp, err = getTransferStatsTimeParam(r, "to")
+	if err != nil {
+		return s, format, err
+	}
+	if s.EndTimestamp > 0 && s.EndTimestamp < s.StartTimestamp {
+		return s, format, util.NewValidationError("the \"to\" time must be after the \"from\" one")
+	}
+	return s, format, nil
+}
+
+func exportTransferStats(w http.ResponseWriter, r *http.Request) {
+	filters, format, err := getTransferStatsSearchFromRequest(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	// we get the first page before writing the response headers so we can
+	// return a proper error if the events searcher is not available
+	data, _, sameTsAtEnd, err := plugin.Handler.SearchFsEvents(&filters)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	fileExt := "csv"
+	if format == transferStatsFormatJSON {
+		contentType = "application/x-ndjson"
+		fileExt = "ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"transfers-%s.%s\"",
+		time.Now().UTC().Format("20060102150405"), fileExt))
+	w.WriteHeader(http.StatusOK)
+
+	wr := newTransferStatsWriter(w, format)
+	if err := wr.writeHeader(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	for {
+		events := make([]transferEvent, 0, transferStatsPageSize)
+		if err := json.Unmarshal(data, &events); err != nil {
+			logForRequest(r, logger.LevelWarn, "unable to decode transfer events: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+		for idx := range events {
+			entry := newTransferStatsEntry(&events[idx])
+			if err := wr.write(&entry); err != nil {
+				panic(http.ErrAbortHandler)
+			}
+		}
+		if err := wr.flush(); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if len(events) < filters.Limit {
+			return
+		}
+		// the next page starts from the last timestamp, excluding the events
+		// with that timestamp already sent
+		filters.StartTimestamp = events[len(events)-1].Timestamp
+		filters.ExcludeIDs = sameTsAtEnd
+		data, _, sameTsAtEnd, err = plugin.Handler.SearchFsEvents(&filters)
+		if err != nil {
+			logForRequest(r, logger.LevelWarn, "unable to get transfer events: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
@@ -15,13 +15,24 @@
 package httpd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/go-chi/render"
+	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
@@ -33,26 +44,38 @@ import (
 )
 
 func getUsers(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit, offset, order, err := getSearchFilters(w, r)
 	if err != nil {
 		return
 	}
 
-	users, err := dataprovider.GetUsers(limit, offset, order)
+	var users []dataprovider.User
+	if k := getAPIKeyFromContext(r); k != nil && k.HasUsersRestrictions() {
+		users, err = dataprovider.GetUsersMatchingPatterns(limit, offset, order, k.Filters.Users)
+	} else {
+		users, err = dataprovider.GetUsers(limit, offset, order)
+	}
 	if err == nil {
 		render.JSON(w, r, users)
 	} else {
-		sendAPIResponse(w, r, err, "", http.StatusInternalServerError)
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
 	}
 }
 
 func getUserByUsername(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	renderUser(w, r, username, http.StatusOK)
 }
 
+func auditUserPublicKeys(w http.ResponseWriter, r *http.Request) {
+	user, err := dataprovider.UserExists(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, user.AuditPublicKeys())
+}
+
 func renderUser(w http.ResponseWriter, r *http.Request, username string, status int) {
 	user, err := dataprovider.UserExists(username)
 	if err != nil {
@@ -69,8 +92,6 @@ func renderUser(w http.ResponseWriter, r *http.Request, username string, status
 }
 
 func addUser(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -82,6 +103,11 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
 		return
 	}
+	if k := getAPIKeyFromContext(r); k != nil && k.HasUsersRestrictions() && !k.IsUserAllowed(user.Username) {
+		sendAPIResponse(w, r, fmt.Errorf("the provided api key is not allowed to manage user %q", user.Username),
+			"", http.StatusForbidden)
+		return
+	}
 	user.Filters.RecoveryCodes = nil
 	user.Filters.TOTPConfig = dataprovider.UserTOTPConfig{
 		Enabled: false,
@@ -95,7 +121,6 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func disableUser2FA(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -118,8 +143,28 @@ func disableUser2FA(w http.ResponseWriter, r *http.Request) {
 	sendAPIResponse(w, r, nil, "2FA disabled", http.StatusOK)
 }
 
+func resetUserLoginCooldown(w http.ResponseWriter, r *http.Request) {
+	user, err := dataprovider.UserExists(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if dataprovider.ResetLoginCooldown(user.Username) {
+		logForRequest(r, logger.LevelInfo, "login cooldown reset for user %q", user.Username)
+	}
+	sendAPIResponse(w, r, nil, "Login cooldown reset", http.StatusOK)
+}
+
+func getUserSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := dataprovider.UserExists(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, common.GetUserSecurityEvents(user.Username))
+}
+
 func updateUser(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -136,6 +181,15 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	force := 0
+	if _, ok := r.URL.Query()["force"]; ok {
+		force, err = strconv.Atoi(r.URL.Query().Get("force"))
+		if err != nil {
+			err = fmt.Errorf("invalid force parameter: %v", err)
+			sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+	}
 	user, err := dataprovider.UserExists(username)
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -147,6 +201,7 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	recoveryCodes := user.Filters.RecoveryCodes
 	currentPermissions := user.Permissions
 	currentS3AccessSecret := user.FsConfig.S3Config.AccessSecret
+	currentS3ReplicationSecret := user.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret
 	currentAzAccountKey := user.FsConfig.AzBlobConfig.AccountKey
 	currentAzSASUrl := user.FsConfig.AzBlobConfig.SASURL
 	currentGCSCredentials := user.FsConfig.GCSConfig.Credentials
@@ -156,6 +211,7 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	currentSFTPKeyPassphrase := user.FsConfig.SFTPConfig.KeyPassphrase
 	currentHTTPPassword := user.FsConfig.HTTPConfig.Password
 	currentHTTPAPIKey := user.FsConfig.HTTPConfig.APIKey
+	currentHTTPSigningKey := user.FsConfig.HTTPConfig.SigningKey
 
 	user.Permissions = make(map[string][]string)
 	user.FsConfig.S3Config = vfs.S3FsConfig{}
@@ -164,8 +220,10 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	user.FsConfig.CryptConfig = vfs.CryptFsConfig{}
 	user.FsConfig.SFTPConfig = vfs.SFTPFsConfig{}
 	user.FsConfig.HTTPConfig = vfs.HTTPFsConfig{}
+	user.FsConfig.OSConfig = vfs.OsFsConfig{}
 	user.Filters.TOTPConfig = dataprovider.UserTOTPConfig{}
 	user.Filters.RecoveryCodes = nil
+	user.Filters.AutoExtract = dataprovider.AutoExtractConfig{}
 	user.VirtualFolders = nil
 	err = render.DecodeJSON(r.Body, &user)
 	if err != nil {
@@ -181,9 +239,12 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	if len(user.Permissions) == 0 {
 		user.Permissions = currentPermissions
 	}
-	updateEncryptedSecrets(&user.FsConfig, currentS3AccessSecret, currentAzAccountKey, currentAzSASUrl,
-		currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase,
-		currentHTTPPassword, currentHTTPAPIKey)
+	updateEncryptedSecrets(&user.FsConfig, currentS3AccessSecret, currentS3ReplicationSecret, currentAzAccountKey,
+		currentAzSASUrl, currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey,
+		currentSFTPKeyPassphrase, currentHTTPPassword, currentHTTPAPIKey, currentHTTPSigningKey)
+	if force == 1 {
+		user.SkipPasswordPolicy()
+	}
 	err = dataprovider.UpdateUser(&user, claims.Username, util.GetIPFromRemoteAddress(r.RemoteAddr))
 	if err != nil {
 		sendAPIResponse(w, r, err, "", getRespStatus(err))
@@ -196,7 +257,6 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func deleteUser(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -213,8 +273,6 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func forgotUserPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	if !smtp.IsEnabled() {
 		sendAPIResponse(w, r, nil, "No SMTP configuration", http.StatusBadRequest)
 		return
@@ -230,8 +288,6 @@ func forgotUserPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func resetUserPassword(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	var req pwdReset
 	err := render.DecodeJSON(r.Body, &req)
 	if err != nil {
@@ -246,6 +302,319 @@ func resetUserPassword(w http.ResponseWriter, r *http.Request) {
 	sendAPIResponse(w, r, err, "Password reset successful", http.StatusOK)
 }
 
+func getUserDirArchive(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = archiveFormatZip
+	}
+	if !util.Contains(supportedArchiveFormats, format) {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("Unsupported archive format %q", format), http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	info, err := connection.Stat(name, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the requested path", getMappedStatusCode(err))
+		return
+	}
+	if !info.IsDir() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a directory", name), http.StatusBadRequest)
+		return
+	}
+	if maxArchiveSize > 0 {
+		size, err := getArchiveContentSize(connection, name)
+		if err != nil {
+			sendAPIResponse(w, r, err, "Unable to get the archive size", getMappedStatusCode(err))
+			return
+		}
+		if size > maxArchiveSize {
+			sendAPIResponse(w, r, errArchiveTooLarge,
+				fmt.Sprintf("The directory size %d exceeds the maximum allowed size %d", size, maxArchiveSize),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+	archiveName := connection.User.Username
+	if name != "/" {
+		archiveName = path.Base(name)
+	}
+	connection.Log(logger.LevelInfo, "admin %q requested a %s archive for directory %q", claims.Username, format, name)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", archiveName, format))
+	renderCompressedFiles(w, connection, name, []string{"/"}, nil, format)
+}
+
+func copyUserFiles(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	var req copyFilesRequest
+	if err = render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	if req.Source == "" || req.Target == "" {
+		sendAPIResponse(w, r, nil, "Source and target paths are required", http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	source := connection.User.GetCleanedPath(req.Source)
+	target := connection.User.GetCleanedPath(req.Target)
+	info, err := connection.Stat(source, 0)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the source path", getMappedStatusCode(err))
+		return
+	}
+	if info.IsDir() {
+		err = connection.CopyDir(source, target)
+	} else {
+		err = connection.CopyFile(source, target)
+	}
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to copy %q -> %q", source, target), getMappedStatusCode(err))
+		return
+	}
+	connection.Log(logger.LevelInfo, "admin %q copied %q -> %q", claims.Username, source, target)
+	sendAPIResponse(w, r, nil, "Copy completed", http.StatusOK)
+}
+
+func getUserFilesMetadata(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	metadata, err := connection.GetMetadata(name)
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to get metadata for path %q", name), getMappedStatusCode(err))
+		return
+	}
+	render.JSON(w, r, metadata)
+}
+
+func getUserFileChunks(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	if !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	if r.URL.Query().Has("chunk") {
+		serveFileChunk(w, r, connection)
+		return
+	}
+	requested := getParallelChunksPreference(r)
+	if r.URL.Query().Has("total") {
+		requested, err = strconv.Atoi(r.URL.Query().Get("total"))
+		if err != nil || requested < 1 {
+			sendAPIResponse(w, r, err, "Invalid total", http.StatusBadRequest)
+			return
+		}
+	}
+	if requested == 0 {
+		requested = defaultParallelChunks
+	}
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	info, err := connection.Stat(name, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the requested file", getMappedStatusCode(err))
+		return
+	}
+	if !info.Mode().IsRegular() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a regular file", name), http.StatusBadRequest)
+		return
+	}
+	chunksURL := fmt.Sprintf("%s/%s/files/chunks", userPath, url.PathEscape(connection.User.Username))
+	renderFileChunksManifest(w, r, connection, name, info, requested, chunksURL)
+}
+
+func previewUserFile(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	if !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+	maxBytes, err := getFilePreviewMaxBytes(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	info, err := connection.Stat(name, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the requested path", getMappedStatusCode(err))
+		return
+	}
+	if !info.Mode().IsRegular() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a regular file", name), http.StatusBadRequest)
+		return
+	}
+	reader, err := connection.getFileReader(name, 0, r.Method)
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to read file %q", name), getMappedStatusCode(err))
+		return
+	}
+	// read one more byte to find out if the file is larger than the requested size
+	data, err := io.ReadAll(io.LimitReader(reader, maxBytes+1))
+	reader.Close()
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to read file %q", name), getMappedStatusCode(err))
+		return
+	}
+	isTruncated := int64(len(data)) > maxBytes
+	if isTruncated {
+		data = data[:maxBytes]
+	}
+	connection.Log(logger.LevelInfo, "admin %q previewed file %q for user %q, bytes read: %d", claims.Username,
+		name, connection.User.Username, len(data))
+	data = getPreviewContent(data, isTruncated)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if isTruncated {
+		w.Header().Set(filePreviewTruncatedHeader, "true")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data) //nolint:errcheck
+}
+
+// getFilePreviewMaxBytes returns the requested preview size capped to maxFilePreviewSize
+func getFilePreviewMaxBytes(r *http.Request) (int64, error) {
+	val := r.URL.Query().Get("max_bytes")
+	if val == "" {
+		return defaultFilePreviewSize, nil
+	}
+	maxBytes, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || maxBytes <= 0 {
+		return 0, fmt.Errorf("invalid max_bytes %q", val)
+	}
+	if maxBytes > maxFilePreviewSize {
+		return maxFilePreviewSize, nil
+	}
+	return maxBytes, nil
+}
+
+// getPreviewContent converts text contents to UTF-8, binary contents are
+// returned unchanged. UTF-16 is detected using the BOM, text that is not
+// valid UTF-8 is assumed to be Windows-1252, a superset of ISO-8859-1
+func getPreviewContent(data []byte, isTruncated bool) []byte {
+	if !strings.HasPrefix(http.DetectContentType(data), "text/") {
+		return data
+	}
+	if bytes.HasPrefix(data, []byte{0xfe, 0xff}) || bytes.HasPrefix(data, []byte{0xff, 0xfe}) {
+		decoded, _, err := transform.Bytes(unicode.BOMOverride(unicode.UTF8.NewDecoder()), data)
+		if err == nil {
+			return decoded
+		}
+		return data
+	}
+	if utf8.Valid(data) {
+		return data
+	}
+	// truncated content could end in the middle of a multi-byte sequence
+	for i := len(data) - 1; isTruncated && i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) && utf8.Valid(data[:i]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	decoded, _, err := transform.Bytes(charmap.Windows1252.NewDecoder(), data)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+func updateUserFilesMetadata(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	var metadata map[string]*string
+	if err = render.DecodeJSON(r.Body, &metadata); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	if len(metadata) == 0 || !r.URL.Query().Has("path") {
+		sendAPIResponse(w, r, errors.New("please set the metadata to update and a path"), "", http.StatusBadRequest)
+		return
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	if err = patchFileMetadata(connection, name, metadata); err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to set metadata for path %q", name), getMappedStatusCode(err))
+		return
+	}
+	connection.Log(logger.LevelInfo, "admin %q updated the metadata for path %q", claims.Username, name)
+	sendAPIResponse(w, r, nil, "Metadata updated", http.StatusOK)
+}
+
+// getUserConnectionForAdmin returns a connection for the user specified in the
+// URL. It is used by the APIs that allow admins to manage the user's files
+func getUserConnectionForAdmin(w http.ResponseWriter, r *http.Request) (*Connection, error) {
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return nil, err
+	}
+	connection := newConnection(common.NewBaseConnection(xid.New().String(), getProtocolFromRequest(r),
+		util.GetHTTPLocalAddress(r), r.RemoteAddr, user), r)
+	if err = common.Connections.Add(connection); err != nil {
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
+		return nil, err
+	}
+	return connection, nil
+}
+
 func disconnectUser(username, admin string) {
 	for _, stat := range common.Connections.GetStats() {
 		if stat.Username == username {
@@ -266,15 +635,18 @@ func disconnectUser(username, admin string) {
 	}
 }
 
-func updateEncryptedSecrets(fsConfig *vfs.Filesystem, currentS3AccessSecret, currentAzAccountKey, currentAzSASUrl,
-	currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase,
-	currentHTTPPassword, currentHTTPAPIKey *kms.Secret) {
+func updateEncryptedSecrets(fsConfig *vfs.Filesystem, currentS3AccessSecret, currentS3ReplicationSecret,
+	currentAzAccountKey, currentAzSASUrl, currentGCSCredentials, currentCryptoPassphrase, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase,
+	currentHTTPPassword, currentHTTPAPIKey, currentHTTPSigningKey *kms.Secret) {
 	// we use the new access secret if plain or empty, otherwise the old value
 	switch fsConfig.Provider {
 	case sdk.S3FilesystemProvider:
 		if fsConfig.S3Config.AccessSecret.IsNotPlainAndNotEmpty() {
 			fsConfig.S3Config.AccessSecret = currentS3AccessSecret
 		}
+		if fsConfig.S3Config.Replication.DestinationCredentials.AccessSecret.IsNotPlainAndNotEmpty() {
+			fsConfig.S3Config.Replication.DestinationCredentials.AccessSecret = currentS3ReplicationSecret
+		}
 	case sdk.AzureBlobFilesystemProvider:
 		if fsConfig.AzBlobConfig.AccountKey.IsNotPlainAndNotEmpty() {
 			fsConfig.AzBlobConfig.AccountKey = currentAzAccountKey
@@ -295,7 +667,7 @@ func updateEncryptedSecrets(fsConfig *vfs.Filesystem, currentS3AccessSecret, cur
 	case sdk.SFTPFilesystemProvider:
 		updateSFTPFsEncryptedSecrets(fsConfig, currentSFTPPassword, currentSFTPKey, currentSFTPKeyPassphrase)
 	case sdk.HTTPFilesystemProvider:
-		updateHTTPFsEncryptedSecrets(fsConfig, currentHTTPPassword, currentHTTPAPIKey)
+		updateHTTPFsEncryptedSecrets(fsConfig, currentHTTPPassword, currentHTTPAPIKey, currentHTTPSigningKey)
 	}
 }
 
@@ -313,11 +685,16 @@ func updateSFTPFsEncryptedSecrets(fsConfig *vfs.Filesystem, currentSFTPPassword,
 	}
 }
 
-func updateHTTPFsEncryptedSecrets(fsConfig *vfs.Filesystem, currentHTTPPassword, currentHTTPAPIKey *kms.Secret) {
+func updateHTTPFsEncryptedSecrets(fsConfig *vfs.Filesystem, currentHTTPPassword, currentHTTPAPIKey,
+	currentHTTPSigningKey *kms.Secret,
+) {
 	if fsConfig.HTTPConfig.Password.IsNotPlainAndNotEmpty() {
 		fsConfig.HTTPConfig.Password = currentHTTPPassword
 	}
 	if fsConfig.HTTPConfig.APIKey.IsNotPlainAndNotEmpty() {
 		fsConfig.HTTPConfig.APIKey = currentHTTPAPIKey
 	}
+	if fsConfig.HTTPConfig.SigningKey.IsNotPlainAndNotEmpty() {
+		fsConfig.HTTPConfig.SigningKey = currentHTTPSigningKey
+	}
 }
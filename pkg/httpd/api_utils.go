@@ -20,7 +20,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"mime"
 	"net/http"
 	"net/url"
@@ -32,17 +31,17 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
-	"github.com/klauspost/compress/zip"
+	"github.com/gorilla/websocket"
 
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/metric"
-	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 	"github.com/drakkan/sftpgo/v2/pkg/smtp"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
 type pwdChange struct {
@@ -55,6 +54,16 @@ type pwdReset struct {
 	Password string `json:"password"`
 }
 
+type copyFilesRequest struct {
+	Source string `json:"src"`
+	Target string `json:"dst"`
+}
+
+type fileMetadataRequest struct {
+	ModificationTime *int64             `json:"modification_time"`
+	Metadata         map[string]*string `json:"metadata"`
+}
+
 type baseProfile struct {
 	Email           string `json:"email,omitempty"`
 	Description     string `json:"description,omitempty"`
@@ -68,6 +77,10 @@ type adminProfile struct {
 type userProfile struct {
 	baseProfile
 	PublicKeys []string `json:"public_keys,omitempty"`
+	// nil means unchanged, impersonation is allowed by default
+	AllowImpersonation *bool `json:"allow_impersonation,omitempty"`
+	// nil means unchanged, so older clients do not disable the notifications
+	LoginNotification *dataprovider.LoginNotification `json:"login_notification,omitempty"`
 }
 
 func sendAPIResponse(w http.ResponseWriter, r *http.Request, err error, message string, code int) {
@@ -81,30 +94,17 @@ func sendAPIResponse(w http.ResponseWriter, r *http.Request, err error, message
 		Error:   errorString,
 		Message: message,
 	}
+	if code >= http.StatusBadRequest {
+		sendProblemResponse(w, r, err, resp, code)
+		return
+	}
 	ctx := context.WithValue(r.Context(), render.StatusCtxKey, code)
 	render.JSON(w, r.WithContext(ctx), resp)
 }
 
 func getRespStatus(err error) int {
-	if _, ok := err.(*util.ValidationError); ok {
-		return http.StatusBadRequest
-	}
-	if _, ok := err.(*util.MethodDisabledError); ok {
-		return http.StatusForbidden
-	}
-	if _, ok := err.(*util.RecordNotFoundError); ok {
-		return http.StatusNotFound
-	}
-	if errors.Is(err, fs.ErrNotExist) {
-		return http.StatusBadRequest
-	}
-	if errors.Is(err, fs.ErrPermission) || errors.Is(err, dataprovider.ErrLoginNotAllowedFromIP) {
-		return http.StatusForbidden
-	}
-	if errors.Is(err, plugin.ErrNoSearcher) || errors.Is(err, dataprovider.ErrNotImplemented) {
-		return http.StatusNotImplemented
-	}
-	return http.StatusInternalServerError
+	code, _ := getErrorProblem(err)
+	return code
 }
 
 // mappig between fs errors for HTTP protocol and HTTP response status codes
@@ -121,6 +121,10 @@ func getMappedStatusCode(err error) int {
 		statusCode = http.StatusRequestEntityTooLarge
 	case errors.Is(err, common.ErrOpUnsupported):
 		statusCode = http.StatusBadRequest
+	case errors.Is(err, common.ErrChecksumMismatch):
+		statusCode = http.StatusBadRequest
+	case errors.As(err, new(*util.ValidationError)):
+		statusCode = http.StatusBadRequest
 	default:
 		statusCode = http.StatusInternalServerError
 	}
@@ -154,7 +158,6 @@ func getBoolQueryParam(r *http.Request, param string) bool {
 }
 
 func getActiveConnections(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -167,8 +170,237 @@ func getActiveConnections(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, stats)
 }
 
+type userActiveSessions struct {
+	Username string `json:"username"`
+	Sessions int    `json:"sessions"`
+}
+
+func getUserActiveSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	username := getURLParam(r, "username")
+	sessions := common.Connections.GetActiveSessions(username)
+	if claims.NodeID == "" {
+		sessions += getNodesActiveSessions(username)
+	}
+	render.JSON(w, r, userActiveSessions{
+		Username: username,
+		Sessions: sessions,
+	})
+}
+
+const (
+	connectionsStreamWriteTimeout = 10 * time.Second
+	connectionsStreamPingInterval = 30 * time.Second
+)
+
+var connectionsStreamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// streamActiveConnections pushes the connection events for this node over a
+// WebSocket connection. The stream is closed when the token expires
+func streamActiveConnections(w http.ResponseWriter, r *http.Request) {
+	token, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil || token == nil {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	tokenClaims := jwtTokenClaims{}
+	tokenClaims.Decode(claims)
+	if tokenClaims.Username == "" {
+		sendAPIResponse(w, r, nil, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	conn, err := connectionsStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied to the client
+		logForRequest(r, logger.LevelDebug, "unable to upgrade connections stream for admin %q: %v", tokenClaims.Username, err)
+		return
+	}
+	defer conn.Close()
+
+	id, events := common.Connections.Subscribe()
+	defer common.Connections.Unsubscribe(id)
+
+	logForRequest(r, logger.LevelDebug, "connections stream started for admin %q, subscriber id: %d", tokenClaims.Username, id)
+
+	// we don't expect messages from the client, we only need to process control frames
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		conn.SetReadLimit(512)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if exp := token.Expiration(); !exp.IsZero() {
+		expirationTimer := time.NewTimer(time.Until(exp))
+		defer expirationTimer.Stop()
+		expired = expirationTimer.C
+	}
+	pingTicker := time.NewTicker(connectionsStreamPingInterval)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-done:
+			logForRequest(r, logger.LevelDebug, "connections stream closed by admin %q", tokenClaims.Username)
+			return
+		case <-expired:
+			closeConnectionsStream(conn, websocket.ClosePolicyViolation, "token expired")
+			return
+		case event, ok := <-events:
+			if !ok {
+				closeConnectionsStream(conn, websocket.CloseTryAgainLater, "too many pending events")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(connectionsStreamWriteTimeout)) //nolint:errcheck
+			if err := conn.WriteJSON(event); err != nil {
+				logForRequest(r, logger.LevelDebug, "unable to write connections stream event: %v", err)
+				return
+			}
+		case <-pingTicker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(connectionsStreamWriteTimeout))
+			if err != nil {
+				logForRequest(r, logger.LevelDebug, "unable to ping connections stream: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func closeConnectionsStream(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(connectionsStreamWriteTimeout)) //nolint:errcheck
+}
+
+func getLogsStreamLevel(r *http.Request) (logger.LogLevel, error) {
+	switch level := r.URL.Query().Get("level"); level {
+	case "", "debug":
+		return logger.LevelDebug, nil
+	case "info":
+		return logger.LevelInfo, nil
+	case "warn":
+		return logger.LevelWarn, nil
+	case "error":
+		return logger.LevelError, nil
+	default:
+		return logger.LevelDebug, util.NewValidationError(fmt.Sprintf("invalid log level %q", level))
+	}
+}
+
+// streamLogs sends the requested number of recent log lines and then the new
+// ones over a WebSocket connection. The stream is closed when the token expires
+func streamLogs(w http.ResponseWriter, r *http.Request) {
+	token, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil || token == nil {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	tokenClaims := jwtTokenClaims{}
+	tokenClaims.Decode(claims)
+	if tokenClaims.Username == "" {
+		sendAPIResponse(w, r, nil, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	if !logger.IsLogTailerEnabled() {
+		sendAPIResponse(w, r, nil, "The logs stream is disabled", http.StatusForbidden)
+		return
+	}
+	minLevel, err := getLogsStreamLevel(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if _, ok := r.URL.Query()["limit"]; ok {
+		limit, err = strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit < 0 {
+			sendAPIResponse(w, r, err, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	conn, err := connectionsStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logForRequest(r, logger.LevelDebug, "unable to upgrade logs stream for admin %q: %v", tokenClaims.Username, err)
+		return
+	}
+	defer conn.Close()
+
+	id, recentLines, lines, err := logger.SubscribeLogs(minLevel, limit)
+	if err != nil {
+		closeConnectionsStream(conn, websocket.CloseTryAgainLater, err.Error())
+		return
+	}
+	defer logger.UnsubscribeLogs(id)
+
+	logForRequest(r, logger.LevelDebug, "logs stream started for admin %q, subscriber id: %d", tokenClaims.Username, id)
+
+	for _, line := range recentLines {
+		conn.SetWriteDeadline(time.Now().Add(connectionsStreamWriteTimeout)) //nolint:errcheck
+		if err := conn.WriteMessage(websocket.TextMessage, line.Data); err != nil {
+			return
+		}
+	}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+
+		conn.SetReadLimit(512)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if exp := token.Expiration(); !exp.IsZero() {
+		expirationTimer := time.NewTimer(time.Until(exp))
+		defer expirationTimer.Stop()
+		expired = expirationTimer.C
+	}
+	pingTicker := time.NewTicker(connectionsStreamPingInterval)
+	defer pingTicker.Stop()
+
+	// we must not log while writing the log lines, the new lines would be streamed too
+	for {
+		select {
+		case <-done:
+			return
+		case <-expired:
+			closeConnectionsStream(conn, websocket.ClosePolicyViolation, "token expired")
+			return
+		case line, ok := <-lines:
+			if !ok {
+				closeConnectionsStream(conn, websocket.CloseTryAgainLater, "too many pending log lines")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(connectionsStreamWriteTimeout)) //nolint:errcheck
+			if err := conn.WriteMessage(websocket.TextMessage, line.Data); err != nil {
+				return
+			}
+		case <-pingTicker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(connectionsStreamWriteTimeout))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
 func handleCloseConnection(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
@@ -190,19 +422,31 @@ func handleCloseConnection(w http.ResponseWriter, r *http.Request) {
 	}
 	n, err := dataprovider.GetNodeByName(node)
 	if err != nil {
-		logger.Warn(logSender, "", "unable to get node with name %q: %v", node, err)
+		logForRequest(r, logger.LevelWarn, "unable to get node with name %q: %v", node, err)
 		status := getRespStatus(err)
 		sendAPIResponse(w, r, nil, http.StatusText(status), status)
 		return
 	}
 	if err := n.SendDeleteRequest(claims.Username, fmt.Sprintf("%s/%s", activeConnectionsPath, connectionID)); err != nil {
-		logger.Warn(logSender, "", "unable to delete connection id %q from node %q: %v", connectionID, n.Name, err)
+		logForRequest(r, logger.LevelWarn, "unable to delete connection id %q from node %q: %v", connectionID, n.Name, err)
 		sendAPIResponse(w, r, nil, "Not Found", http.StatusNotFound)
 		return
 	}
 	sendAPIResponse(w, r, nil, "Connection closed", http.StatusOK)
 }
 
+func invalidateDirListCache(w http.ResponseWriter, r *http.Request) {
+	username := getURLParam(r, "username")
+	// the group settings are required to resolve the virtual folders
+	user, err := dataprovider.GetUserWithGroupSettings(username)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	common.RemoveCachedDirListing(&user, r.URL.Query().Get("path"))
+	sendAPIResponse(w, r, nil, "Cache invalidated", http.StatusOK)
+}
+
 // getNodesConnections returns the active connections from other nodes.
 // Errors are silently ignored
 func getNodesConnections(admin string) []common.ConnectionStatus {
@@ -236,6 +480,111 @@ func getNodesConnections(admin string) []common.ConnectionStatus {
 	return results
 }
 
+const (
+	// maximum time to wait for the other nodes when counting the sessions of a user,
+	// the nodes that do not reply in time are ignored
+	nodesSessionsTimeout = 2 * time.Second
+	// the sessions counted on the other nodes are cached for this duration, so
+	// logins do not query all the nodes each time
+	nodesSessionsCacheTTL = 5 * time.Second
+)
+
+var nodesSessions = nodesSessionsCache{
+	counters: make(map[string]nodesSessionsCounter),
+}
+
+type nodesSessionsCounter struct {
+	sessions  int
+	expiresAt time.Time
+}
+
+type nodesSessionsCache struct {
+	sync.RWMutex
+	counters map[string]nodesSessionsCounter
+}
+
+func (c *nodesSessionsCache) get(username string) (int, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	counter, ok := c.counters[username]
+	if !ok || !time.Now().Before(counter.expiresAt) {
+		return 0, false
+	}
+	return counter.sessions, true
+}
+
+func (c *nodesSessionsCache) add(username string, sessions int) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	for k, v := range c.counters {
+		if !now.Before(v.expiresAt) {
+			delete(c.counters, k)
+		}
+	}
+	c.counters[username] = nodesSessionsCounter{
+		sessions:  sessions,
+		expiresAt: now.Add(nodesSessionsCacheTTL),
+	}
+}
+
+// getNodesActiveSessions returns the number of active sessions for the given
+// user on the other nodes. Results are cached for a few seconds and the nodes
+// not replying within nodesSessionsTimeout are ignored.
+// Errors are logged and otherwise ignored
+func getNodesActiveSessions(username string) int {
+	nodeName := dataprovider.GetNodeName()
+	if nodeName == "" {
+		return 0
+	}
+	if sessions, ok := nodesSessions.get(username); ok {
+		return sessions
+	}
+	nodes, err := dataprovider.GetNodes()
+	if err != nil || len(nodes) == 0 {
+		return 0
+	}
+	relativeURL := fmt.Sprintf("%s/%s", activeSessionsPath, url.PathEscape(username))
+	results := make(chan int, len(nodes))
+
+	for _, n := range nodes {
+		go func(node dataprovider.Node) {
+			var sessions userActiveSessions
+			if err := node.SendGetRequest(nodeName, relativeURL, &sessions); err != nil {
+				logger.Warn(logSender, "", "unable to get active sessions for user %q from node %s: %v",
+					username, node.Name, err)
+				results <- 0
+				return
+			}
+			results <- sessions.Sessions
+		}(n)
+	}
+
+	timer := time.NewTimer(nodesSessionsTimeout)
+	defer timer.Stop()
+
+	total := 0
+	received := 0
+	for received < len(nodes) {
+		select {
+		case sessions := <-results:
+			total += sessions
+			received++
+		case <-timer.C:
+			logger.Warn(logSender, "", "unable to get active sessions for user %q from %d/%d nodes within %s",
+				username, len(nodes)-received, len(nodes), nodesSessionsTimeout)
+			// the partial result is cached too, so a slow node does not delay each login
+			nodesSessions.add(username, total)
+			return total
+		}
+	}
+	nodesSessions.add(username, total)
+
+	return total
+}
+
 func getSearchFilters(w http.ResponseWriter, r *http.Request) (int, int, string, error) {
 	var err error
 	limit := 100
@@ -300,19 +649,23 @@ func getCompressedFileName(username string, files []string) string {
 }
 
 func renderCompressedFiles(w http.ResponseWriter, conn *Connection, baseDir string, files []string,
-	share *dataprovider.Share,
+	share *dataprovider.Share, format string,
 ) {
 	conn.User.CheckFsRoot(conn.ID) //nolint:errcheck
-	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Type", getArchiveContentType(format))
 	w.Header().Set("Accept-Ranges", "none")
 	w.Header().Set("Content-Transfer-Encoding", "binary")
 	w.WriteHeader(http.StatusOK)
 
-	wr := zip.NewWriter(w)
+	wr := newArchiveWriter(w, format, maxArchiveSize)
 
 	for _, file := range files {
 		fullPath := util.CleanPath(path.Join(baseDir, file))
-		if err := addZipEntry(wr, conn, fullPath, baseDir); err != nil {
+		if err := addArchiveEntry(wr, conn, fullPath, baseDir); err != nil {
+			if errors.Is(err, errArchiveTooLarge) {
+				conn.Log(logger.LevelWarn, "unable to complete the archive, the maximum allowed size %d is exceeded",
+					maxArchiveSize)
+			}
 			if share != nil {
 				dataprovider.UpdateShareLastUse(share, -1) //nolint:errcheck
 			}
@@ -320,7 +673,7 @@ func renderCompressedFiles(w http.ResponseWriter, conn *Connection, baseDir stri
 		}
 	}
 	if err := wr.Close(); err != nil {
-		conn.Log(logger.LevelError, "unable to close zip file: %v", err)
+		conn.Log(logger.LevelError, "unable to close archive: %v", err)
 		if share != nil {
 			dataprovider.UpdateShareLastUse(share, -1) //nolint:errcheck
 		}
@@ -328,35 +681,33 @@ func renderCompressedFiles(w http.ResponseWriter, conn *Connection, baseDir stri
 	}
 }
 
-func addZipEntry(wr *zip.Writer, conn *Connection, entryPath, baseDir string) error {
+func addArchiveEntry(wr archiveWriter, conn *Connection, entryPath, baseDir string) error {
 	info, err := conn.Stat(entryPath, 1)
 	if err != nil {
-		conn.Log(logger.LevelDebug, "unable to add zip entry %#v, stat error: %v", entryPath, err)
+		conn.Log(logger.LevelDebug, "unable to add archive entry %#v, stat error: %v", entryPath, err)
 		return err
 	}
-	entryName, err := getZipEntryName(entryPath, baseDir)
+	entryName, err := getArchiveEntryName(entryPath, baseDir)
 	if err != nil {
-		conn.Log(logger.LevelError, "unable to get zip entry name: %v", err)
+		conn.Log(logger.LevelError, "unable to get archive entry name: %v", err)
 		return err
 	}
 	if info.IsDir() {
-		_, err = wr.CreateHeader(&zip.FileHeader{
-			Name:     entryName + "/",
-			Method:   zip.Deflate,
-			Modified: info.ModTime(),
-		})
-		if err != nil {
-			conn.Log(logger.LevelError, "unable to create zip entry %#v: %v", entryPath, err)
-			return err
+		// the base dir itself has no entry, we only add its contents
+		if entryName != "" {
+			if err = wr.addDir(entryName, info.ModTime()); err != nil {
+				conn.Log(logger.LevelError, "unable to create archive entry %#v: %v", entryPath, err)
+				return err
+			}
 		}
 		contents, err := conn.ReadDir(entryPath)
 		if err != nil {
-			conn.Log(logger.LevelDebug, "unable to add zip entry %#v, read dir error: %v", entryPath, err)
+			conn.Log(logger.LevelDebug, "unable to add archive entry %#v, read dir error: %v", entryPath, err)
 			return err
 		}
 		for _, info := range contents {
 			fullPath := util.CleanPath(path.Join(entryPath, info.Name()))
-			if err := addZipEntry(wr, conn, fullPath, baseDir); err != nil {
+			if err := addArchiveEntry(wr, conn, fullPath, baseDir); err != nil {
 				return err
 			}
 		}
@@ -364,30 +715,47 @@ func addZipEntry(wr *zip.Writer, conn *Connection, entryPath, baseDir string) er
 	}
 	if !info.Mode().IsRegular() {
 		// we only allow regular files
-		conn.Log(logger.LevelInfo, "skipping zip entry for non regular file %#v", entryPath)
+		conn.Log(logger.LevelInfo, "skipping archive entry for non regular file %#v", entryPath)
 		return nil
 	}
 	reader, err := conn.getFileReader(entryPath, 0, http.MethodGet)
 	if err != nil {
-		conn.Log(logger.LevelDebug, "unable to add zip entry %#v, cannot open file: %v", entryPath, err)
+		conn.Log(logger.LevelDebug, "unable to add archive entry %#v, cannot open file: %v", entryPath, err)
 		return err
 	}
 	defer reader.Close()
 
-	f, err := wr.CreateHeader(&zip.FileHeader{
-		Name:     entryName,
-		Method:   zip.Deflate,
-		Modified: info.ModTime(),
-	})
-	if err != nil {
-		conn.Log(logger.LevelError, "unable to create zip entry %#v: %v", entryPath, err)
-		return err
+	if err = wr.addFile(entryName, info, reader); err != nil {
+		conn.Log(logger.LevelError, "unable to add archive entry %#v: %v", entryPath, err)
 	}
-	_, err = io.Copy(f, reader)
 	return err
 }
 
-func getZipEntryName(entryPath, baseDir string) (string, error) {
+// getArchiveContentSize returns the total size of the regular files
+// included in the specified directory tree
+func getArchiveContentSize(conn *Connection, dirPath string) (int64, error) {
+	contents, err := conn.ReadDir(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, info := range contents {
+		if info.IsDir() {
+			dirSize, err := getArchiveContentSize(conn, util.CleanPath(path.Join(dirPath, info.Name())))
+			if err != nil {
+				return 0, err
+			}
+			size += dirSize
+			continue
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+func getArchiveEntryName(entryPath, baseDir string) (string, error) {
 	if !strings.HasPrefix(entryPath, baseDir) {
 		return "", fmt.Errorf("entry path %q is outside base dir %q", entryPath, baseDir)
 	}
@@ -402,6 +770,20 @@ func checkDownloadFileFromShare(share *dataprovider.Share, info os.FileInfo) err
 	return nil
 }
 
+// getShareContentDisposition returns the Content-Disposition header for a file downloaded
+// from a share. The display name, if any, is used only for single file shares
+func getShareContentDisposition(share *dataprovider.Share, name string, inline bool) string {
+	disposition := dataprovider.ShareDispositionAttachment
+	if inline || share.Disposition == dataprovider.ShareDispositionInline {
+		disposition = dataprovider.ShareDispositionInline
+	}
+	fileName := path.Base(name)
+	if share.DisplayName != "" && len(share.Paths) == 1 && share.Paths[0] == name {
+		fileName = share.DisplayName
+	}
+	return fmt.Sprintf("%s; filename=%#v", disposition, fileName)
+}
+
 func downloadFile(w http.ResponseWriter, r *http.Request, connection *Connection, name string,
 	info os.FileInfo, inline bool, share *dataprovider.Share,
 ) (int, error) {
@@ -446,7 +828,9 @@ func downloadFile(w http.ResponseWriter, r *http.Request, connection *Connection
 	}
 	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 	w.Header().Set("Content-Type", ctype)
-	if !inline {
+	if share != nil {
+		w.Header().Set("Content-Disposition", getShareContentDisposition(share, name, inline))
+	} else if !inline {
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%#v", path.Base(name)))
 	}
 	w.Header().Set("Accept-Ranges", "bytes")
@@ -618,18 +1002,20 @@ func checkHTTPClientUser(user *dataprovider.User, r *http.Request, connectionID
 		logger.Info(logSender, connectionID, "cannot login user %#v, password login method is not allowed", user.Username)
 		return fmt.Errorf("login method password is not allowed for user %#v", user.Username)
 	}
-	if checkSessions && user.MaxSessions > 0 {
-		activeSessions := common.Connections.GetActiveSessions(user.Username)
-		if activeSessions >= user.MaxSessions {
-			logger.Info(logSender, connectionID, "authentication refused for user: %#v, too many open sessions: %v/%v", user.Username,
-				activeSessions, user.MaxSessions)
-			return fmt.Errorf("too many open sessions: %v", activeSessions)
+	if checkSessions {
+		if err := common.Connections.CheckMaxSessions(user.Username, user.MaxSessions); err != nil {
+			logger.Info(logSender, connectionID, "authentication refused for user: %q, %v", user.Username, err)
+			return err
 		}
 	}
 	if !user.IsLoginFromAddrAllowed(r.RemoteAddr) {
 		logger.Info(logSender, connectionID, "cannot login user %#v, remote address is not allowed: %v", user.Username, r.RemoteAddr)
 		return fmt.Errorf("login for user %#v is not allowed from this address: %v", user.Username, r.RemoteAddr)
 	}
+	// filesystems configured to use the OIDC access token get it from the session
+	if source, ok := r.Context().Value(oidcTokenSourceKey).(vfs.OIDCTokenSource); ok {
+		user.SetOIDCTokenSource(source)
+	}
 	return nil
 }
 
@@ -658,7 +1044,7 @@ func handleForgotPassword(r *http.Request, username string, isAdmin bool) error
 	}
 	if err != nil {
 		if _, ok := err.(*util.RecordNotFoundError); ok {
-			logger.Debug(logSender, middleware.GetReqID(r.Context()), "username %#v does not exists, reset password request silently ignored, is admin? %v",
+			logForRequest(r, logger.LevelDebug, "username %#v does not exists, reset password request silently ignored, is admin? %v",
 				username, isAdmin)
 			return nil
 		}
@@ -672,16 +1058,16 @@ func handleForgotPassword(r *http.Request, username string, isAdmin bool) error
 	data := make(map[string]string)
 	data["Code"] = c.Code
 	if err := smtp.RenderPasswordResetTemplate(body, data); err != nil {
-		logger.Warn(logSender, middleware.GetReqID(r.Context()), "unable to render password reset template: %v", err)
+		logForRequest(r, logger.LevelWarn, "unable to render password reset template: %v", err)
 		return util.NewGenericError("Unable to render password reset template")
 	}
 	startTime := time.Now()
 	if err := smtp.SendEmail([]string{email}, subject, body.String(), smtp.EmailContentTypeTextHTML); err != nil {
-		logger.Warn(logSender, middleware.GetReqID(r.Context()), "unable to send password reset code via email: %v, elapsed: %v",
+		logForRequest(r, logger.LevelWarn, "unable to send password reset code via email: %v, elapsed: %v",
 			err, time.Since(startTime))
 		return util.NewGenericError(fmt.Sprintf("Unable to send confirmation code via email: %v", err))
 	}
-	logger.Debug(logSender, middleware.GetReqID(r.Context()), "reset code sent via email to %#v, email: %#v, is admin? %v, elapsed: %v",
+	logForRequest(r, logger.LevelDebug, "reset code sent via email to %#v, email: %#v, is admin? %v, elapsed: %v",
 		username, email, isAdmin, time.Since(startTime))
 	return resetCodesMgr.Add(c)
 }
@@ -758,3 +1144,20 @@ func getProtocolFromRequest(r *http.Request) string {
 	}
 	return common.ProtocolHTTP
 }
+
+// patchFileMetadata merges the given user defined metadata with the existing
+// ones for the specified path, keys with a null or empty value are removed
+func patchFileMetadata(connection *Connection, name string, patch map[string]*string) error {
+	metadata, err := connection.GetMetadata(name)
+	if err != nil {
+		return err
+	}
+	for k, v := range patch {
+		if v == nil || *v == "" {
+			delete(metadata, k)
+			continue
+		}
+		metadata[k] = *v
+	}
+	return connection.SetMetadata(name, metadata)
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zip"
+)
+
+// Supported archive formats for compressed downloads
+const (
+	archiveFormatZip   = "zip"
+	archiveFormatTarGz = "tar.gz"
+)
+
+var (
+	supportedArchiveFormats = []string{archiveFormatZip, archiveFormatTarGz}
+	errArchiveTooLarge      = errors.New("the archive exceeds the maximum allowed size")
+)
+
+// archiveWriter defines the interface for the writers used for compressed downloads
+type archiveWriter interface {
+	addDir(name string, modTime time.Time) error
+	addFile(name string, info os.FileInfo, reader io.Reader) error
+	Close() error
+}
+
+// archiveSizeLimit tracks the size of the files added to an archive
+type archiveSizeLimit struct {
+	maxSize int64
+	size    int64
+}
+
+func (l *archiveSizeLimit) add(size int64) error {
+	l.size += size
+	if l.maxSize > 0 && l.size > l.maxSize {
+		return errArchiveTooLarge
+	}
+	return nil
+}
+
+func newArchiveWriter(w io.Writer, format string, maxSize int64) archiveWriter {
+	if format == archiveFormatTarGz {
+		gw := gzip.NewWriter(w)
+		return &tarGzArchiveWriter{
+			archiveSizeLimit: archiveSizeLimit{maxSize: maxSize},
+			gw:               gw,
+			tw:               tar.NewWriter(gw),
+		}
+	}
+	return &zipArchiveWriter{
+		archiveSizeLimit: archiveSizeLimit{maxSize: maxSize},
+		wr:               zip.NewWriter(w),
+	}
+}
+
+func getArchiveContentType(format string) string {
+	if format == archiveFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+type zipArchiveWriter struct {
+	archiveSizeLimit
+	wr *zip.Writer
+}
+
+func (a *zipArchiveWriter) addDir(name string, modTime time.Time) error {
+	_, err := a.wr.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+	return err
+}
+
+func (a *zipArchiveWriter) addFile(name string, info os.FileInfo, reader io.Reader) error {
+	if err := a.add(info.Size()); err != nil {
+		return err
+	}
+	f, err := a.wr.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+func (a *zipArchiveWriter) Close() error {
+	return a.wr.Close()
+}
+
+type tarGzArchiveWriter struct {
+	archiveSizeLimit
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzArchiveWriter) addDir(name string, modTime time.Time) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modTime,
+	})
+}
+
+func (a *tarGzArchiveWriter) addFile(name string, info os.FileInfo, reader io.Reader) error {
+	if err := a.add(info.Size()); err != nil {
+		return err
+	}
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     0644,
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	// the size is written in the header so we must copy exactly the
+	// stat size even if the file was modified in the meantime
+	_, err = io.CopyN(a.tw, reader, info.Size())
+	return err
+}
+
+func (a *tarGzArchiveWriter) Close() error {
+	err := a.tw.Close()
+	if errGz := a.gw.Close(); err == nil {
+		err = errGz
+	}
+	return err
+}
@@ -39,6 +39,7 @@ const (
 	tokenAudienceAPI              tokenAudience = "API"
 	tokenAudienceAPIUser          tokenAudience = "APIUser"
 	tokenAudienceCSRF             tokenAudience = "CSRF"
+	tokenAudienceOneTimeDownload  tokenAudience = "OneTimeDownload"
 )
 
 type tokenValidation = int
@@ -56,6 +57,9 @@ const (
 	claimMustSetSecondFactorKey     = "2fa_required"
 	claimRequiredTwoFactorProtocols = "2fa_protos"
 	claimHideUserPageSection        = "hus"
+	claimImpersonatedBy             = "impersonated_by"
+	claimExternalToken              = "ext_token"
+	claimSessionID                  = "sid"
 	basicRealm                      = "Basic realm=\"SFTPGo\""
 	jwtCookieKey                    = "jwt"
 )
@@ -67,6 +71,9 @@ var (
 	csrfTokenDuration     = 6 * time.Hour
 	tokenRefreshThreshold = 10 * time.Minute
 	tokenValidationMode   = tokenValidationFull
+	// tokens that allow an admin to impersonate a user have a shorter duration
+	defaultImpersonationTokenDuration = 15 * time.Minute
+	impersonationTokenDuration        = defaultImpersonationTokenDuration
 )
 
 type jwtTokenClaims struct {
@@ -79,6 +86,13 @@ type jwtTokenClaims struct {
 	MustSetTwoFactorAuth       bool
 	RequiredTwoFactorProtocols []string
 	HideUserPageSections       int
+	// username of the admin impersonating the user
+	ImpersonatedBy string
+	// true if the token was issued after validating an access token
+	// obtained from an external OAuth2 authorization server
+	ExternalToken bool
+	// ID of the user session for tokens issued by the user token API
+	SessionID string
 }
 
 func (c *jwtTokenClaims) hasUserAudience() bool {
@@ -112,6 +126,15 @@ func (c *jwtTokenClaims) asMap() map[string]any {
 	if c.HideUserPageSections > 0 {
 		claims[claimHideUserPageSection] = c.HideUserPageSections
 	}
+	if c.ImpersonatedBy != "" {
+		claims[claimImpersonatedBy] = c.ImpersonatedBy
+	}
+	if c.ExternalToken {
+		claims[claimExternalToken] = c.ExternalToken
+	}
+	if c.SessionID != "" {
+		claims[claimSessionID] = c.SessionID
+	}
 
 	return claims
 }
@@ -189,6 +212,27 @@ func (c *jwtTokenClaims) Decode(token map[string]any) {
 			c.HideUserPageSections = int(v)
 		}
 	}
+
+	if val, ok := token[claimImpersonatedBy]; ok {
+		switch v := val.(type) {
+		case string:
+			c.ImpersonatedBy = v
+		}
+	}
+
+	if val, ok := token[claimExternalToken]; ok {
+		switch v := val.(type) {
+		case bool:
+			c.ExternalToken = v
+		}
+	}
+
+	if val, ok := token[claimSessionID]; ok {
+		switch v := val.(type) {
+		case string:
+			c.SessionID = v
+		}
+	}
 }
 
 func (c *jwtTokenClaims) isCriticalPermRemoved(permissions []string) bool {
@@ -204,12 +248,16 @@ func (c *jwtTokenClaims) isCriticalPermRemoved(permissions []string) bool {
 	return false
 }
 
-func (c *jwtTokenClaims) hasPerm(perm string) bool {
+func (c *jwtTokenClaims) hasPerm(perms ...string) bool {
 	if util.Contains(c.Permissions, dataprovider.PermAdminAny) {
 		return true
 	}
-
-	return util.Contains(c.Permissions, perm)
+	for _, perm := range perms {
+		if util.Contains(c.Permissions, perm) {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *jwtTokenClaims) createToken(tokenAuth *jwtauth.JWTAuth, audience tokenAudience, ip string) (jwt.Token, string, error) {
@@ -218,7 +266,11 @@ func (c *jwtTokenClaims) createToken(tokenAuth *jwtauth.JWTAuth, audience tokenA
 
 	claims[jwt.JwtIDKey] = xid.New().String()
 	claims[jwt.NotBeforeKey] = now.Add(-30 * time.Second)
-	claims[jwt.ExpirationKey] = now.Add(tokenDuration)
+	if c.ImpersonatedBy != "" {
+		claims[jwt.ExpirationKey] = now.Add(impersonationTokenDuration)
+	} else {
+		claims[jwt.ExpirationKey] = now.Add(tokenDuration)
+	}
 	claims[jwt.AudienceKey] = []string{audience, ip, tokenAudienceAPIUser}
 
 	return tokenAuth.Encode(claims)
@@ -285,6 +337,16 @@ func tokenFromContext(r *http.Request) string {
 	return ""
 }
 
+// tokenFromStreamQuery allows to pass the JWT as query parameter for the
+// connections and logs streams, browsers cannot set custom headers for
+// WebSocket upgrade requests
+func tokenFromStreamQuery(r *http.Request) string {
+	if r.URL.Path != activeConnectionsStreamPath && r.URL.Path != logsStreamPath {
+		return ""
+	}
+	return jwtauth.TokenFromQuery(r)
+}
+
 func isTLS(r *http.Request) bool {
 	if r.TLS != nil {
 		return true
@@ -316,6 +378,15 @@ func isTokenInvalidated(r *http.Request) bool {
 	return !isTokenFound
 }
 
+func isUserSessionRevoked(token jwt.Token) bool {
+	if val, ok := token.Get(claimSessionID); ok {
+		if sessionID, ok := val.(string); ok {
+			return !userSessionsMgr.Use(sessionID)
+		}
+	}
+	return false
+}
+
 func invalidateToken(r *http.Request) {
 	tokenString := jwtauth.TokenFromHeader(r)
 	if tokenString != "" {
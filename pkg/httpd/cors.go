@@ -0,0 +1,84 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/cors"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const corsWildcardOrigin = "*"
+
+func (c *CorsConfig) validate() error {
+	c.SharesAllowedOrigins = util.RemoveDuplicates(c.SharesAllowedOrigins, true)
+	if !c.Enabled {
+		return nil
+	}
+	c.AllowedOrigins = util.RemoveDuplicates(c.AllowedOrigins, true)
+	// an empty list allows any origin
+	if c.AllowCredentials && (len(c.AllowedOrigins) == 0 || util.Contains(c.AllowedOrigins, corsWildcardOrigin)) {
+		return errors.New("CORS: allowing credentials for any origin is not allowed, please define the allowed origins")
+	}
+	return nil
+}
+
+func (c *CorsConfig) getHandler() func(http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins:       util.RemoveDuplicates(c.AllowedOrigins, true),
+		AllowedMethods:       util.RemoveDuplicates(c.AllowedMethods, true),
+		AllowedHeaders:       util.RemoveDuplicates(c.AllowedHeaders, true),
+		ExposedHeaders:       util.RemoveDuplicates(c.ExposedHeaders, true),
+		MaxAge:               c.MaxAge,
+		AllowCredentials:     c.AllowCredentials,
+		OptionsPassthrough:   c.OptionsPassthrough,
+		OptionsSuccessStatus: c.OptionsSuccessStatus,
+		AllowPrivateNetwork:  c.AllowPrivateNetwork,
+	}).Handler
+}
+
+// getSharesHandler returns the CORS handler for the public share downloads.
+// Credentials are never allowed, shares can be password protected using the
+// Authorization header
+func (c *CorsConfig) getSharesHandler() func(http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins: util.RemoveDuplicates(c.SharesAllowedOrigins, true),
+		AllowedMethods: []string{http.MethodGet, http.MethodHead},
+		AllowedHeaders: []string{"Authorization", "Range"},
+		ExposedHeaders: []string{"Accept-Ranges", "Content-Disposition", "Content-Length", "Content-Range",
+			"Last-Modified"},
+		MaxAge: c.MaxAge,
+	}).Handler
+}
+
+func (c *CorsConfig) hasSharesPolicy() bool {
+	return len(c.SharesAllowedOrigins) > 0
+}
+
+// isShareDownloadRequest returns true for the public share downloads and their preflight requests
+func isShareDownloadRequest(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, sharesPath+"/") {
+		return false
+	}
+	method := r.Method
+	if method == http.MethodOptions {
+		method = r.Header.Get("Access-Control-Request-Method")
+	}
+	return method == http.MethodGet || method == http.MethodHead
+}
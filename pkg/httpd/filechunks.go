@@ -0,0 +1,242 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	parallelChunksPreference = "parallel-chunks"
+	defaultParallelChunks    = 4
+	maxParallelChunks        = 16
+	// files smaller than this size are never split
+	minParallelChunkSize = 1048576
+)
+
+// fileChunk defines a byte range of a file that can be downloaded independently
+type fileChunk struct {
+	Chunk  int    `json:"chunk"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+}
+
+// fileChunksManifest describes how to download a file using parallel requests
+type fileChunksManifest struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Total  int         `json:"total"`
+	Chunks []fileChunk `json:"chunks"`
+}
+
+// getParallelChunksPreference returns the number of chunks requested using
+// the "Prefer: parallel-chunks=N" header or 0 if parallel mode is not requested
+func getParallelChunksPreference(r *http.Request) int {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			name, value, found := strings.Cut(strings.TrimSpace(pref), "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(name), parallelChunksPreference) {
+				continue
+			}
+			total, err := strconv.Atoi(strings.Trim(strings.TrimSpace(value), `"`))
+			if err != nil || total < 1 {
+				return 0
+			}
+			return total
+		}
+	}
+	return 0
+}
+
+// getParallelChunksNumber limits the requested number of chunks so that
+// each chunk, except for very small files, is at least minParallelChunkSize
+func getParallelChunksNumber(requested int, size int64) int {
+	total := requested
+	if total > maxParallelChunks {
+		total = maxParallelChunks
+	}
+	if maxBySize := size / minParallelChunkSize; int64(total) > maxBySize {
+		total = int(maxBySize)
+	}
+	if total < 1 {
+		total = 1
+	}
+	return total
+}
+
+// getFileChunkRange returns the offset and the size of the specified chunk,
+// the chunk sizes differ by at most one byte
+func getFileChunkRange(size int64, chunk, total int) (int64, int64) {
+	start := size * int64(chunk) / int64(total)
+	end := size * int64(chunk+1) / int64(total)
+	return start, end - start
+}
+
+func getFileChunkParams(r *http.Request, size int64) (int, int, error) {
+	chunk, err := strconv.Atoi(r.URL.Query().Get("chunk"))
+	if err != nil {
+		return 0, 0, util.NewValidationError(fmt.Sprintf("invalid chunk %q", r.URL.Query().Get("chunk")))
+	}
+	total, err := strconv.Atoi(r.URL.Query().Get("total"))
+	if err != nil {
+		return 0, 0, util.NewValidationError(fmt.Sprintf("invalid total %q", r.URL.Query().Get("total")))
+	}
+	if total < 1 || total > maxParallelChunks || (size > 0 && int64(total) > size) {
+		return 0, 0, util.NewValidationError(fmt.Sprintf("invalid total %d, it must be between 1 and %d",
+			total, maxParallelChunks))
+	}
+	if chunk < 0 || chunk >= total {
+		return 0, 0, util.NewValidationError(fmt.Sprintf("invalid chunk %d, it must be between 0 and %d",
+			chunk, total-1))
+	}
+	return chunk, total, nil
+}
+
+func getFileChunkChecksum(connection *Connection, name string, offset, size int64, method string) (string, error) {
+	reader, err := connection.getFileRangeReader(name, offset, size, method)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, reader)
+	errClose := reader.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// getFileChunksManifest splits the specified file in chunks and computes, in
+// parallel, the checksum for each chunk
+func getFileChunksManifest(r *http.Request, connection *Connection, name string, info os.FileInfo, requested int,
+	chunksURL string,
+) (fileChunksManifest, error) {
+	size := info.Size()
+	total := getParallelChunksNumber(requested, size)
+	manifest := fileChunksManifest{
+		Path:   name,
+		Size:   size,
+		Total:  total,
+		Chunks: make([]fileChunk, total),
+	}
+	errs := make([]error, total)
+	var wg sync.WaitGroup
+
+	for idx := 0; idx < total; idx++ {
+		offset, chunkSize := getFileChunkRange(size, idx, total)
+		params := url.Values{}
+		params.Set("path", name)
+		params.Set("chunk", strconv.Itoa(idx))
+		params.Set("total", strconv.Itoa(total))
+		manifest.Chunks[idx] = fileChunk{
+			Chunk:  idx,
+			Offset: offset,
+			Size:   chunkSize,
+			URL:    fmt.Sprintf("%s?%s", chunksURL, params.Encode()),
+		}
+
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			chunk := &manifest.Chunks[idx]
+			chunk.SHA256, errs[idx] = getFileChunkChecksum(connection, name, chunk.Offset, chunk.Size, r.Method)
+		}(idx)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, nil
+}
+
+func renderFileChunksManifest(w http.ResponseWriter, r *http.Request, connection *Connection, name string,
+	info os.FileInfo, requested int, chunksURL string,
+) {
+	manifest, err := getFileChunksManifest(r, connection, name, info, requested, chunksURL)
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to split file %q in chunks", name), getMappedStatusCode(err))
+		return
+	}
+	w.Header().Set("Preference-Applied", fmt.Sprintf("%s=%d", parallelChunksPreference, manifest.Total))
+	render.JSON(w, r, manifest)
+}
+
+// serveFileChunk sends the byte range for the chunk specified in the query string
+func serveFileChunk(w http.ResponseWriter, r *http.Request, connection *Connection) {
+	name := connection.User.GetCleanedPath(r.URL.Query().Get("path"))
+	info, err := connection.Stat(name, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the requested file", getMappedStatusCode(err))
+		return
+	}
+	if !info.Mode().IsRegular() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a regular file", name), http.StatusBadRequest)
+		return
+	}
+	size := info.Size()
+	chunk, total, err := getFileChunkParams(r, size)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	offset, chunkSize := getFileChunkRange(size, chunk, total)
+	reader, err := connection.getFileRangeReader(name, offset, chunkSize, r.Method)
+	if err != nil {
+		sendAPIResponse(w, r, err, fmt.Sprintf("Unable to read file %q", name), getMappedStatusCode(err))
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(chunkSize, 10))
+	w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	if chunkSize > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+chunkSize-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, err = io.CopyN(w, reader, chunkSize)
+	if err != nil {
+		connection.Log(logger.LevelDebug, "error reading chunk %d/%d for file %q: %v", chunk, total, name, err)
+		panic(http.ErrAbortHandler)
+	}
+}
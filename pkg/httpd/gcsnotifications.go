@@ -0,0 +1,319 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-chi/render"
+	"github.com/sftpgo/sdk"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+const (
+	// Google public keys, as JWK set, used to sign the Pub/Sub push tokens
+	googleCertsURL         = "https://www.googleapis.com/oauth2/v3/certs"
+	gcsEventObjectFinalize = "OBJECT_FINALIZE"
+	gcsEventObjectDelete   = "OBJECT_DELETE"
+	gcsDirMimeType         = "inode/directory"
+	gcsFoldersPageSize     = 100
+)
+
+var (
+	gcsNotifications = newGCSNotificationsHandler()
+	// Pub/Sub push tokens can use both issuers
+	googleTokenIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+)
+
+// GCSNotificationsConfig defines the configuration to receive Google Cloud Storage
+// object change notifications as Pub/Sub push messages. The notified objects are
+// mapped to the virtual folders using the configured bucket and key prefix
+type GCSNotificationsConfig struct {
+	// Expected audience for the tokens included in the push requests, as configured
+	// for the Pub/Sub push subscription. Leave empty to disable
+	Audience string `json:"audience" mapstructure:"audience"`
+	// If set, the push requests must be authenticated using this service account
+	ServiceAccountEmail string `json:"service_account_email" mapstructure:"service_account_email"`
+}
+
+func (c *GCSNotificationsConfig) isEnabled() bool {
+	return c.Audience != ""
+}
+
+func (c *GCSNotificationsConfig) validate() error {
+	c.ServiceAccountEmail = strings.TrimSpace(c.ServiceAccountEmail)
+	if !c.isEnabled() {
+		if c.ServiceAccountEmail != "" {
+			return errors.New("GCS notifications: the audience is required if a service account is set")
+		}
+		return nil
+	}
+	if c.ServiceAccountEmail != "" && !strings.Contains(c.ServiceAccountEmail, "@") {
+		return fmt.Errorf("GCS notifications: invalid service account email %q", c.ServiceAccountEmail)
+	}
+	return nil
+}
+
+// gcsPubSubPushRequest defines the body of a Pub/Sub push request
+type gcsPubSubPushRequest struct {
+	Message struct {
+		Attributes map[string]string `json:"attributes"`
+		// base64 encoded JSON object, decoded while unmarshaling
+		Data        []byte `json:"data"`
+		MessageID   string `json:"messageId"`
+		PublishTime string `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// gcsObjectResource defines the object fields, from the JSON_API_V1 payload, we are interested in
+type gcsObjectResource struct {
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size,string"`
+}
+
+type gcsNotificationsHandler struct {
+	sync.RWMutex
+	config   GCSNotificationsConfig
+	verifier *oidc.IDTokenVerifier
+}
+
+func newGCSNotificationsHandler() *gcsNotificationsHandler {
+	return &gcsNotificationsHandler{}
+}
+
+// setConfig sets the configuration and the keys used to verify the push tokens.
+// The remote key set fetches and caches the keys on demand
+func (h *gcsNotificationsHandler) setConfig(config GCSNotificationsConfig, keySet oidc.KeySet) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.config = config
+	h.verifier = nil
+	if config.isEnabled() {
+		h.verifier = oidc.NewVerifier(googleTokenIssuers[0], keySet, &oidc.Config{
+			ClientID:        config.Audience,
+			SkipIssuerCheck: true,
+		})
+	}
+}
+
+func (h *gcsNotificationsHandler) isEnabled() bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.config.isEnabled()
+}
+
+// verifyRequest validates the signature and the claims of the token included in the push request
+func (h *gcsNotificationsHandler) verifyRequest(r *http.Request) error {
+	h.RLock()
+	verifier := h.verifier
+	serviceAccount := h.config.ServiceAccountEmail
+	h.RUnlock()
+
+	if verifier == nil {
+		return errors.New("GCS notifications are disabled")
+	}
+	token := jwtauth.TokenFromHeader(r)
+	if token == "" {
+		return errors.New("no token found")
+	}
+	idToken, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		return err
+	}
+	if !util.Contains(googleTokenIssuers, idToken.Issuer) {
+		return fmt.Errorf("unexpected token issuer %q", idToken.Issuer)
+	}
+	if serviceAccount == "" {
+		return nil
+	}
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return err
+	}
+	if !claims.EmailVerified || claims.Email != serviceAccount {
+		return fmt.Errorf("unexpected token email %q", claims.Email)
+	}
+	return nil
+}
+
+func handleGCSNotification(w http.ResponseWriter, r *http.Request) {
+	if !gcsNotifications.isEnabled() {
+		sendAPIResponse(w, r, nil, "GCS notifications are disabled", http.StatusForbidden)
+		return
+	}
+	if err := gcsNotifications.verifyRequest(r); err != nil {
+		logger.Debug(logSender, "", "unable to validate GCS notification: %v", err)
+		sendAPIResponse(w, r, errors.New("the provided token cannot be authenticated"), "", http.StatusUnauthorized)
+		return
+	}
+	var req gcsPubSubPushRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	eventType := req.Message.Attributes["eventType"]
+	if eventType != gcsEventObjectFinalize && eventType != gcsEventObjectDelete {
+		// the message is acknowledged, Pub/Sub retries the other status codes
+		sendAPIResponse(w, r, nil, "Event ignored", http.StatusOK)
+		return
+	}
+	bucket := req.Message.Attributes["bucketId"]
+	objectKey := req.Message.Attributes["objectId"]
+	if bucket == "" || objectKey == "" {
+		sendAPIResponse(w, r, errors.New("bucket and object are required"), "", http.StatusBadRequest)
+		return
+	}
+	var object gcsObjectResource
+	if err := json.Unmarshal(req.Message.Data, &object); err != nil {
+		sendAPIResponse(w, r, fmt.Errorf("invalid object data: %w", err), "", http.StatusBadRequest)
+		return
+	}
+	if strings.HasSuffix(objectKey, "/") || object.ContentType == gcsDirMimeType {
+		sendAPIResponse(w, r, nil, "Event ignored", http.StatusOK)
+		return
+	}
+	logger.Debug(logSender, "", "received GCS notification %q, event %q, bucket %q, object %q, size %d",
+		req.Message.MessageID, eventType, bucket, objectKey, object.Size)
+	err := processGCSObjectEvent(eventType == gcsEventObjectDelete, bucket, objectKey, object.Size, r.RemoteAddr)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, nil, "Event processed", http.StatusOK)
+}
+
+// processGCSObjectEvent updates the quota of the virtual folders mapped to the
+// specified object and of the users that mount them and executes the upload hooks
+func processGCSObjectEvent(isDelete bool, bucket, objectKey string, size int64, remoteAddr string) error {
+	folders, err := getGCSFoldersForObject(bucket, objectKey)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		logger.Debug(logSender, "", "no virtual folder mapped to GCS bucket %q, object %q", bucket, objectKey)
+		return nil
+	}
+	filesAdd, sizeAdd := 1, size
+	if isDelete {
+		filesAdd, sizeAdd = -1, -size
+	}
+	trackQuota := dataprovider.GetQuotaTracking() != 0
+	for idx := range folders {
+		folder := &folders[idx]
+		if trackQuota {
+			if err := dataprovider.UpdateVirtualFolderQuota(folder, filesAdd, sizeAdd, false); err != nil {
+				return err
+			}
+		}
+		relPath := strings.TrimPrefix(objectKey, folder.FsConfig.GCSConfig.KeyPrefix)
+		for _, username := range getGCSFolderUsers(folder) {
+			user, err := dataprovider.GetUserWithGroupSettings(username)
+			if err != nil {
+				logger.Warn(logSender, "", "unable to get user %q for GCS object %q: %v", username, objectKey, err)
+				continue
+			}
+			for _, vfolder := range user.VirtualFolders {
+				if vfolder.Name != folder.Name {
+					continue
+				}
+				if trackQuota && vfolder.IsIncludedInUserQuota() {
+					if err := dataprovider.UpdateUserQuota(&user, filesAdd, sizeAdd, false); err != nil {
+						logger.Warn(logSender, "", "unable to update quota for user %q: %v", username, err)
+					}
+				}
+				virtualPath := path.Join(vfolder.VirtualPath, relPath)
+				if err := common.HandleStorageEvent(&user, isDelete, objectKey, virtualPath, size, remoteAddr); err != nil {
+					logger.Warn(logSender, "", "unable to execute hooks for user %q, path %q: %v", username,
+						virtualPath, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getGCSFoldersForObject returns the GCS virtual folders for the specified bucket
+// with the longest key prefix that matches the specified object
+func getGCSFoldersForObject(bucket, objectKey string) ([]vfs.BaseVirtualFolder, error) {
+	var result []vfs.BaseVirtualFolder
+	prefixLen := -1
+	for offset := 0; ; offset += gcsFoldersPageSize {
+		folders, err := dataprovider.GetFolders(gcsFoldersPageSize, offset, dataprovider.OrderASC, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			if folder.FsConfig.Provider != sdk.GCSFilesystemProvider || folder.FsConfig.GCSConfig.Bucket != bucket {
+				continue
+			}
+			keyPrefix := folder.FsConfig.GCSConfig.KeyPrefix
+			if !strings.HasPrefix(objectKey, keyPrefix) || len(keyPrefix) < prefixLen {
+				continue
+			}
+			if len(keyPrefix) > prefixLen {
+				prefixLen = len(keyPrefix)
+				result = nil
+			}
+			result = append(result, folder)
+		}
+		if len(folders) < gcsFoldersPageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+// getGCSFolderUsers returns the users that mount the specified folder directly
+// or using a group
+func getGCSFolderUsers(folder *vfs.BaseVirtualFolder) []string {
+	users := util.RemoveDuplicates(folder.Users, false)
+	for _, groupName := range folder.Groups {
+		group, err := dataprovider.GroupExists(groupName)
+		if err != nil {
+			logger.Warn(logSender, "", "unable to get group %q for folder %q: %v", groupName, folder.Name, err)
+			continue
+		}
+		for _, username := range group.Users {
+			if !util.Contains(users, username) {
+				users = append(users, username)
+			}
+		}
+	}
+	return users
+}
+
+func newGoogleKeySet() oidc.KeySet {
+	return oidc.NewRemoteKeySet(context.Background(), googleCertsURL)
+}
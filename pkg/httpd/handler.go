@@ -24,6 +24,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
+
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
@@ -37,6 +39,16 @@ type Connection struct {
 	request *http.Request
 }
 
+// newConnection returns a connection for the specified request, the request ID
+// is included in the connection logs
+func newConnection(baseConnection *common.BaseConnection, r *http.Request) *Connection {
+	baseConnection.SetRequestID(middleware.GetReqID(r.Context()))
+	return &Connection{
+		BaseConnection: baseConnection,
+		request:        r,
+	}
+}
+
 // GetClientVersion returns the connected client's version.
 func (c *Connection) GetClientVersion() string {
 	if c.request != nil {
@@ -76,7 +88,7 @@ func (c *Connection) GetCommand() string {
 func (c *Connection) Stat(name string, mode int) (os.FileInfo, error) {
 	c.UpdateLastActivity()
 
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
@@ -103,7 +115,7 @@ func (c *Connection) getFileReader(name string, offset int64, method string) (io
 		return nil, c.GetReadQuotaExceededError()
 	}
 
-	if !c.User.HasPerm(dataprovider.PermDownload, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
@@ -135,9 +147,62 @@ func (c *Connection) getFileReader(name string, offset int64, method string) (io
 	return newHTTPDFile(baseTransfer, nil, r), nil
 }
 
-func (c *Connection) getFileWriter(name string) (io.WriteCloser, error) {
+// getFileRangeReader returns a reader for the specified byte range, the
+// filesystem must support range reads
+func (c *Connection) getFileRangeReader(name string, offset, length int64, method string) (io.ReadCloser, error) {
 	c.UpdateLastActivity()
 
+	transferQuota := c.GetTransferQuota()
+	if !transferQuota.HasDownloadSpace() {
+		c.Log(logger.LevelInfo, "denying file read due to quota limits")
+		return nil, c.GetReadQuotaExceededError()
+	}
+
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(name)) {
+		return nil, c.GetPermissionDeniedError()
+	}
+
+	if ok, policy := c.User.IsFileAllowed(name); !ok {
+		c.Log(logger.LevelWarn, "reading file %#v is not allowed", name)
+		return nil, c.GetErrorForDeniedFile(policy)
+	}
+
+	fs, p, err := c.GetFsAndResolvedPath(name)
+	if err != nil {
+		return nil, err
+	}
+	rangeReader, ok := fs.(vfs.FsRangeReader)
+	if !ok {
+		return nil, c.GetOpUnsupportedError()
+	}
+
+	if method != http.MethodHead {
+		if err := common.ExecutePreAction(c.BaseConnection, common.OperationPreDownload, p, name, 0, 0); err != nil {
+			c.Log(logger.LevelDebug, "download for file %#v denied by pre action: %v", name, err)
+			return nil, c.GetPermissionDeniedError()
+		}
+	}
+
+	r, err := rangeReader.OpenRange(p, offset, length)
+	if err != nil {
+		c.Log(logger.LevelError, "could not open file %#v for reading range %d-%d: %+v", p, offset, length, err)
+		return nil, c.GetFsError(fs, err)
+	}
+
+	baseTransfer := common.NewBaseTransfer(nil, c.BaseConnection, nil, p, p, name, common.TransferDownload,
+		0, 0, 0, 0, false, fs, transferQuota)
+	file := newHTTPDFile(baseTransfer, nil, nil)
+	file.reader = r
+	return file, nil
+}
+
+func (c *Connection) getFileWriter(name string, uploadSize int64) (io.WriteCloser, error) {
+	c.UpdateLastActivity()
+
+	name, err := c.GetUploadTargetPath(name)
+	if err != nil {
+		return nil, err
+	}
 	if ok, _ := c.User.IsFileAllowed(name); !ok {
 		c.Log(logger.LevelWarn, "writing file %#v is not allowed", name)
 		return nil, c.GetPermissionDeniedError()
@@ -148,16 +213,16 @@ func (c *Connection) getFileWriter(name string) (io.WriteCloser, error) {
 		return nil, err
 	}
 	filePath := p
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		filePath = fs.GetAtomicUploadPath(p)
 	}
 
 	stat, statErr := fs.Lstat(p)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || fs.IsNotExist(statErr) {
-		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(name)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(name)) {
 			return nil, c.GetPermissionDeniedError()
 		}
-		return c.handleUploadFile(fs, p, filePath, name, true, 0)
+		return c.handleUploadFile(fs, p, filePath, name, true, 0, uploadSize)
 	}
 
 	if statErr != nil {
@@ -171,11 +236,11 @@ func (c *Connection) getFileWriter(name string) (io.WriteCloser, error) {
 		return nil, c.GetOpUnsupportedError()
 	}
 
-	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		err = fs.Rename(p, filePath)
 		if err != nil {
 			c.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
@@ -184,10 +249,12 @@ func (c *Connection) getFileWriter(name string) (io.WriteCloser, error) {
 		}
 	}
 
-	return c.handleUploadFile(fs, p, filePath, name, false, stat.Size())
+	return c.handleUploadFile(fs, p, filePath, name, false, stat.Size(), uploadSize)
 }
 
-func (c *Connection) handleUploadFile(fs vfs.Fs, resolvedPath, filePath, requestPath string, isNewFile bool, fileSize int64) (io.WriteCloser, error) {
+func (c *Connection) handleUploadFile(fs vfs.Fs, resolvedPath, filePath, requestPath string, isNewFile bool,
+	fileSize, uploadSize int64,
+) (io.WriteCloser, error) {
 	diskQuota, transferQuota := c.HasSpace(isNewFile, false, requestPath)
 	if !diskQuota.HasSpace || !transferQuota.HasUploadSpace() {
 		c.Log(logger.LevelInfo, "denying file write due to quota limits")
@@ -199,10 +266,27 @@ func (c *Connection) handleUploadFile(fs vfs.Fs, resolvedPath, filePath, request
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	maxWriteSize, _ := c.GetMaxWriteSize(diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	maxWriteSize, _ := c.GetMaxWriteSize(requestPath, diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	if err := c.CheckUploadSpace(fs, resolvedPath, uploadSize, maxWriteSize); err != nil {
+		if !isNewFile && filePath != resolvedPath {
+			// restore the file renamed for the atomic upload
+			fs.Rename(filePath, resolvedPath) //nolint:errcheck
+		}
+		return nil, err
+	}
+
+	quotaFileReserved := false
+	if isNewFile {
+		quotaFileReserved, err = c.ReserveNewFile(requestPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	quotaSize := vfs.GetQuotaSize(fs, filePath, fileSize)
 	file, w, cancelFn, err := fs.Create(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.GetCreateChecks(requestPath, isNewFile))
 	if err != nil {
+		c.ReleaseNewFile(requestPath, quotaFileReserved)
 		c.Log(logger.LevelError, "error opening existing file, source: %#v, err: %+v", filePath, err)
 		return nil, c.GetFsError(fs, err)
 	}
@@ -213,16 +297,16 @@ func (c *Connection) handleUploadFile(fs vfs.Fs, resolvedPath, filePath, request
 		if vfs.HasTruncateSupport(fs) {
 			vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(requestPath))
 			if err == nil {
-				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -quotaSize, false) //nolint:errcheck
 				if vfolder.IsIncludedInUserQuota() {
-					dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+					dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 				}
 			} else {
-				dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			initialSize = fileSize
-			truncatedSize = fileSize
+			initialSize = quotaSize
+			truncatedSize = quotaSize
 		}
 		if maxWriteSize > 0 {
 			maxWriteSize += fileSize
@@ -233,6 +317,7 @@ func (c *Connection) handleUploadFile(fs vfs.Fs, resolvedPath, filePath, request
 
 	baseTransfer := common.NewBaseTransfer(file, c.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, initialSize, maxWriteSize, truncatedSize, isNewFile, fs, transferQuota)
+	baseTransfer.SetQuotaFileReserved(quotaFileReserved)
 	return newHTTPDFile(baseTransfer, w, nil), nil
 }
 
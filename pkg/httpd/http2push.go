@@ -0,0 +1,165 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+// assets included in every web admin and web client page, the branding CSS files are added
+var http2PushCommonAssets = []string{
+	"/vendor/fontawesome-free/css/fontawesome.min.css",
+	"/vendor/fontawesome-free/css/solid.min.css",
+	"/vendor/fontawesome-free/css/regular.min.css",
+	"/vendor/jquery/jquery.min.js",
+	"/vendor/bootstrap/js/bootstrap.bundle.min.js",
+	"/vendor/jquery-easing/jquery.easing.min.js",
+	"/js/sb-admin-2.min.js",
+}
+
+// http2PushManifest defines the static assets to push for the web admin and
+// web client pages
+type http2PushManifest struct {
+	webAdmin  []string
+	webClient []string
+}
+
+func (m *http2PushManifest) isEmpty() bool {
+	return len(m.webAdmin) == 0 && len(m.webClient) == 0
+}
+
+func (m *http2PushManifest) getAssets(r *http.Request) []string {
+	if isWebClientRequest(r) {
+		return m.webClient
+	}
+	return m.webAdmin
+}
+
+// newHTTP2PushManifest returns the manifest for the given branding.
+// The static filesystem is scanned once and the missing assets are skipped
+func newHTTP2PushManifest(fs http.FileSystem, branding Branding) http2PushManifest {
+	return http2PushManifest{
+		webAdmin:  getHTTP2PushAssets(fs, branding.WebAdmin),
+		webClient: getHTTP2PushAssets(fs, branding.WebClient),
+	}
+}
+
+func getHTTP2PushAssets(fs http.FileSystem, branding UIBranding) []string {
+	candidates := []string{branding.DefaultCSS}
+	candidates = append(candidates, http2PushCommonAssets...)
+	candidates = append(candidates, branding.ExtraCSS...)
+
+	var assets []string
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		f, err := fs.Open(name)
+		if err != nil {
+			logger.Debug(logSender, "", "static asset %q not found, it will not be pushed: %v", name, err)
+			continue
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		assets = append(assets, path.Join(webStaticFilesPath, name))
+	}
+	return assets
+}
+
+// pushStaticAssets pushes the static assets for the web pages to HTTP/2 clients.
+// The assets are pushed only for successful HTML responses and only if the
+// client supports push, otherwise the request is served as usual
+func (s *httpdServer) pushStaticAssets(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.ProtoMajor < 2 || !isWebRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pusher, ok := w.(http.Pusher)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		assets := s.pushManifest.getAssets(r)
+		if len(assets) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&http2PushResponseWriter{
+			ResponseWriter: w,
+			pusher:         pusher,
+			assets:         assets,
+			acceptEncoding: r.Header.Values("Accept-Encoding"),
+		}, r)
+	})
+}
+
+type http2PushResponseWriter struct {
+	http.ResponseWriter
+	pusher         http.Pusher
+	assets         []string
+	acceptEncoding []string
+	wroteHeader    bool
+}
+
+func (w *http2PushResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if statusCode == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			w.push()
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *http2PushResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// responses without an explicit content type are not web pages
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *http2PushResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *http2PushResponseWriter) push() {
+	var opts *http.PushOptions
+	if len(w.acceptEncoding) > 0 {
+		opts = &http.PushOptions{
+			Header: http.Header{"Accept-Encoding": w.acceptEncoding},
+		}
+	}
+	for _, asset := range w.assets {
+		if err := w.pusher.Push(asset, opts); err != nil {
+			if !errors.Is(err, http.ErrNotSupported) {
+				logger.Debug(logSender, "", "unable to push asset %q: %v", asset, err)
+			}
+			// push is disabled by the client or the stream is closed
+			return
+		}
+	}
+}
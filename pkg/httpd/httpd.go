@@ -51,12 +51,21 @@ const (
 	userTokenPath                         = "/api/v2/user/token"
 	userLogoutPath                        = "/api/v2/user/logout"
 	activeConnectionsPath                 = "/api/v2/connections"
+	activeConnectionsStreamPath           = "/api/v2/connections/stream"
+	logsStreamPath                        = "/api/v2/admin/logs/stream"
+	activeSessionsPath                    = "/api/v2/connections/sessions"
+	dirListCachePath                      = "/api/v2/dircache"
+	rcloneImportPath                      = "/api/v2/utils/rclone-import"
+	filesystemTestPath                    = "/api/v2/utils/filesystem/test"
+	securityAlertTestPath                 = "/api/v2/utils/securityalert/test"
+	onlineMigrationsPath                  = "/api/v2/admin/migrations"
 	quotasBasePath                        = "/api/v2/quotas"
 	userPath                              = "/api/v2/users"
 	versionPath                           = "/api/v2/version"
 	folderPath                            = "/api/v2/folders"
 	groupPath                             = "/api/v2/groups"
 	serverStatusPath                      = "/api/v2/status"
+	serverTLSCertificatesPath             = "/api/v2/server/tls/certificates"
 	dumpDataPath                          = "/api/v2/dumpdata"
 	loadDataPath                          = "/api/v2/loaddata"
 	defenderHosts                         = "/api/v2/defender/hosts"
@@ -66,6 +75,7 @@ const (
 	userPwdPath                           = "/api/v2/user/changepwd"
 	userDirsPath                          = "/api/v2/user/dirs"
 	userFilesPath                         = "/api/v2/user/files"
+	userFilesChunksPath                   = "/api/v2/user/files/chunks"
 	userStreamZipPath                     = "/api/v2/user/streamzip"
 	userUploadFilePath                    = "/api/v2/user/files/upload"
 	userFilesDirsMetadataPath             = "/api/v2/user/files/metadata"
@@ -82,15 +92,22 @@ const (
 	user2FARecoveryCodesPath              = "/api/v2/user/2fa/recoverycodes"
 	userProfilePath                       = "/api/v2/user/profile"
 	userSharesPath                        = "/api/v2/user/shares"
+	userExportPath                        = "/api/v2/user/export"
+	userSessionsPath                      = "/api/v2/user/sessions"
 	retentionBasePath                     = "/api/v2/retention/users"
 	retentionChecksPath                   = "/api/v2/retention/users/checks"
 	metadataBasePath                      = "/api/v2/metadata/users"
 	metadataChecksPath                    = "/api/v2/metadata/users/checks"
 	fsEventsPath                          = "/api/v2/events/fs"
 	providerEventsPath                    = "/api/v2/events/provider"
+	transferStatsPath                     = "/api/v2/stats/transfers"
 	sharesPath                            = "/api/v2/shares"
 	eventActionsPath                      = "/api/v2/eventactions"
 	eventRulesPath                        = "/api/v2/eventrules"
+	publicDownloadPath                    = "/public/download"
+	gcsNotificationsPath                  = "/api/v2/notifications/gcs"
+	openAPISpecPath                       = "/api/v2/openapi.yaml"
+	apiDocsPath                           = "/api/v2/docs"
 	healthzPath                           = "/healthz"
 	robotsTxtPath                         = "/robots.txt"
 	webRootPathDefault                    = "/"
@@ -162,16 +179,18 @@ const (
 	webClientGetPDFPathDefault            = "/web/client/getpdf"
 	webStaticFilesPathDefault             = "/static"
 	webOpenAPIPathDefault                 = "/openapi"
-	// MaxRestoreSize defines the max size for the loaddata input file
-	MaxRestoreSize         = 10485760 // 10 MB
-	maxRequestSize         = 1048576  // 1MB
-	maxLoginBodySize       = 262144   // 256 KB
-	httpdMaxEditFileSize   = 1048576  // 1 MB
-	maxMultipartMem        = 10485760 // 10 MB
+	// maxLoginBodySize defines the max request size for the login and password reset requests
+	maxLoginBodySize       = 262144  // 256 KB
+	httpdMaxEditFileSize   = 1048576 // 1 MB
 	osWindows              = "windows"
 	otpHeaderCode          = "X-SFTPGO-OTP"
+	passwordHeader         = "X-SFTPGO-PASSWORD"
 	mTimeHeader            = "X-SFTPGO-MTIME"
 	onlyOfficeCallbackPath = "/api/v2/user/onlyoffice"
+	// default and max number of bytes returned by the admin file preview API
+	defaultFilePreviewSize     = 65536   // 64 KB
+	maxFilePreviewSize         = 1048576 // 1 MB
+	filePreviewTruncatedHeader = "X-SFTPGo-Truncated"
 )
 
 var (
@@ -251,7 +270,9 @@ var (
 	webOpenAPIPath                 string
 	// max upload size for http clients, 1GB by default
 	maxUploadFileSize          = int64(1048576000)
+	maxArchiveSize             int64
 	hideSupportLink            bool
+	disableHTTP2Push           bool
 	installationCode           string
 	installationCodeHint       string
 	fnInstallationCodeResolver FnInstallationCodeResolver
@@ -401,6 +422,30 @@ type WebClientIntegration struct {
 	URL string `json:"url" mapstructure:"url"`
 }
 
+// VirtualHost defines a host name served by a binding with its own TLS certificate
+type VirtualHost struct {
+	// Domain to match against the TLS SNI extension and the Host header.
+	// A leading "*." matches any subdomain, for example "*.example.com"
+	Domain string `json:"domain" mapstructure:"domain"`
+	// Certificate and matching private key for this virtual host
+	CertificateFile    string `json:"certificate_file" mapstructure:"certificate_file"`
+	CertificateKeyFile string `json:"certificate_key_file" mapstructure:"certificate_key_file"`
+	// BasePath is the landing page for this virtual host, for example "/web/client".
+	// Requests to the web root are redirected here. Leave empty to use the default
+	BasePath string `json:"base_path" mapstructure:"base_path"`
+}
+
+func (v *VirtualHost) matches(host string) bool {
+	if strings.HasPrefix(v.Domain, "*.") {
+		return strings.HasSuffix(host, v.Domain[1:]) && len(host) > len(v.Domain)-1
+	}
+	return host == v.Domain
+}
+
+func (v *VirtualHost) getCertID(bindingAddress string) string {
+	return fmt.Sprintf("%s#%s", bindingAddress, v.Domain)
+}
+
 // Binding defines the configuration for a network listener
 type Binding struct {
 	// The address to listen on. A blank value means listen on all available network interfaces.
@@ -474,6 +519,12 @@ type Binding struct {
 	OIDC OIDC `json:"oidc" mapstructure:"oidc"`
 	// Security defines security headers to add to HTTP responses and allows to restrict allowed hosts
 	Security SecurityConf `json:"security" mapstructure:"security"`
+	// SecurityHeaders defines additional headers, for example Content-Security-Policy or
+	// Strict-Transport-Security, to add to every HTTP response
+	SecurityHeaders common.SecurityHeaders `json:"security_headers" mapstructure:"security_headers"`
+	// VirtualHosts allows to serve multiple domains on this binding, each one with its own TLS
+	// certificate selected using SNI. The binding certificate is used if no virtual host matches
+	VirtualHosts []VirtualHost `json:"virtual_hosts" mapstructure:"virtual_hosts"`
 	// Branding defines customizations to suit your brand
 	Branding         Branding `json:"branding" mapstructure:"branding"`
 	allowHeadersFrom []func(net.IP) bool
@@ -489,6 +540,62 @@ func (b *Binding) checkWebClientIntegrations() {
 	b.WebClientIntegrations = integrations
 }
 
+func (b *Binding) checkVirtualHosts() error {
+	domains := make(map[string]bool)
+	for idx := range b.VirtualHosts {
+		vhost := &b.VirtualHosts[idx]
+		vhost.Domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(vhost.Domain), "."))
+		if vhost.Domain == "" || vhost.Domain == "*." {
+			return fmt.Errorf("binding %q: virtual host domain is required", b.GetAddress())
+		}
+		if domains[vhost.Domain] {
+			return fmt.Errorf("binding %q: duplicated virtual host %q", b.GetAddress(), vhost.Domain)
+		}
+		domains[vhost.Domain] = true
+		if vhost.CertificateFile == "" || vhost.CertificateKeyFile == "" {
+			return fmt.Errorf("binding %q: certificate and key are required for virtual host %q",
+				b.GetAddress(), vhost.Domain)
+		}
+		if vhost.BasePath != "" {
+			if !strings.HasPrefix(vhost.BasePath, "/") {
+				return fmt.Errorf("binding %q: invalid base path %q for virtual host %q, it must be an absolute path",
+					b.GetAddress(), vhost.BasePath, vhost.Domain)
+			}
+			vhost.BasePath = path.Clean(vhost.BasePath)
+			if vhost.BasePath == "/" {
+				vhost.BasePath = ""
+			}
+		}
+	}
+	return nil
+}
+
+// getVirtualHost returns the virtual host matching the specified host name, if any.
+// Exact domains take precedence over wildcard ones
+func (b *Binding) getVirtualHost(host string) *VirtualHost {
+	if len(b.VirtualHosts) == 0 || host == "" {
+		return nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	var wildcard *VirtualHost
+	for idx := range b.VirtualHosts {
+		vhost := &b.VirtualHosts[idx]
+		if !vhost.matches(host) {
+			continue
+		}
+		if !strings.HasPrefix(vhost.Domain, "*.") {
+			return vhost
+		}
+		if wildcard == nil || len(vhost.Domain) > len(wildcard.Domain) {
+			wildcard = vhost
+		}
+	}
+	return wildcard
+}
+
 func (b *Binding) checkBranding() {
 	b.Branding.WebAdmin.check()
 	b.Branding.WebClient.check()
@@ -520,9 +627,19 @@ func (b *Binding) parseAllowedProxy() error {
 	return nil
 }
 
+// getTrustedProxies returns the functions to check if an IP address, included
+// in the client IP proxy header, is a trusted proxy that must be skipped
+func (b *Binding) getTrustedProxies() []func(net.IP) bool {
+	if filepath.IsAbs(b.Address) {
+		// unix domain socket, any address is allowed to set the proxy headers
+		return nil
+	}
+	return b.allowHeadersFrom
+}
+
 // GetAddress returns the binding address
 func (b *Binding) GetAddress() string {
-	return fmt.Sprintf("%s:%d", b.Address, b.Port)
+	return util.JoinHostPort(b.Address, b.Port)
 }
 
 // IsValid returns true if the binding is valid
@@ -633,6 +750,13 @@ type ServicesStatus struct {
 	MFA          mfa.ServiceStatus           `json:"mfa"`
 }
 
+// TLSCertificatesStatus defines the TLS certificates loaded by the services
+type TLSCertificatesStatus struct {
+	HTTP   []common.TLSCertificateInfo `json:"http"`
+	FTP    []common.TLSCertificateInfo `json:"ftp"`
+	WebDAV []common.TLSCertificateInfo `json:"webdav"`
+}
+
 // SetupConfig defines the configuration parameters for the initial web admin setup
 type SetupConfig struct {
 	// Installation code to require when creating the first admin account.
@@ -645,6 +769,16 @@ type SetupConfig struct {
 	InstallationCodeHint string `json:"installation_code_hint" mapstructure:"installation_code_hint"`
 }
 
+// FilesystemCheckConfig defines the configuration for the users filesystem health checks
+type FilesystemCheckConfig struct {
+	// Timeout, in seconds, for a health check
+	Timeout int `json:"timeout" mapstructure:"timeout"`
+	// Minimum interval, in seconds, between two health checks for the same user.
+	// The last result is returned for requests within this interval, so cloud storage
+	// APIs are not called too often
+	MinInterval int `json:"min_interval" mapstructure:"min_interval"`
+}
+
 // CorsConfig defines the CORS configuration
 type CorsConfig struct {
 	AllowedOrigins       []string `json:"allowed_origins" mapstructure:"allowed_origins"`
@@ -657,6 +791,9 @@ type CorsConfig struct {
 	OptionsPassthrough   bool     `json:"options_passthrough" mapstructure:"options_passthrough"`
 	OptionsSuccessStatus int      `json:"options_success_status" mapstructure:"options_success_status"`
 	AllowPrivateNetwork  bool     `json:"allow_private_network" mapstructure:"allow_private_network"`
+	// Origins allowed to download public shares using the REST API. This policy
+	// applies even if CORS is disabled and it never allows credentials
+	SharesAllowedOrigins []string `json:"shares_allowed_origins" mapstructure:"shares_allowed_origins"`
 }
 
 // Conf httpd daemon configuration
@@ -695,15 +832,33 @@ type Conf struct {
 	// By default all the available security checks are enabled. Set to 1 to disable the requirement
 	// that a token must be used by the same IP for which it was issued.
 	TokenValidation int `json:"token_validation" mapstructure:"token_validation"`
+	// ImpersonationTokenTTL defines the validity, in minutes, for the tokens that
+	// allow an admin to impersonate a user. 0 means the default, 15 minutes
+	ImpersonationTokenTTL int `json:"impersonation_token_ttl" mapstructure:"impersonation_token_ttl"`
 	// MaxUploadFileSize Defines the maximum request body size, in bytes, for Web Client/API HTTP upload requests.
 	// 0 means no limit
 	MaxUploadFileSize int64 `json:"max_upload_file_size" mapstructure:"max_upload_file_size"`
+	// MaxArchiveSize defines the maximum size, in bytes, of the files that can be included in
+	// compressed downloads. The size is calculated before compression. 0 means no limit
+	MaxArchiveSize int64 `json:"max_archive_size" mapstructure:"max_archive_size"`
 	// CORS configuration
 	Cors CorsConfig `json:"cors" mapstructure:"cors"`
 	// Initial setup configuration
 	Setup SetupConfig `json:"setup" mapstructure:"setup"`
+	// Users filesystem health checks configuration
+	FilesystemCheck FilesystemCheckConfig `json:"filesystem_check" mapstructure:"filesystem_check"`
+	// Configuration to accept REST API access tokens issued by an external OAuth2 authorization server
+	OAuth2ResourceServer OAuth2ResourceServerConfig `json:"oauth2_resource_server" mapstructure:"oauth2_resource_server"`
+	// Configuration to receive Google Cloud Storage object notifications as Pub/Sub push messages
+	GCSNotifications GCSNotificationsConfig `json:"gcs_notifications" mapstructure:"gcs_notifications"`
 	// If enabled, the link to the sponsors section will not appear on the setup screen page
 	HideSupportLink bool `json:"hide_support_link" mapstructure:"hide_support_link"`
+	// If set, the static assets for the web pages are not pushed to HTTP/2 clients
+	DisableHTTP2Push bool `json:"disable_http2_push" mapstructure:"disable_http2_push"`
+	// Maximum request body size for the different endpoint categories
+	RequestSizeLimits RequestSizeLimits `json:"request_size_limits" mapstructure:"request_size_limits"`
+	// Number of recent log lines kept in memory for the logs stream. 0 disables the logs stream
+	LogsStreamBufferSize int `json:"logs_stream_buffer_size" mapstructure:"logs_stream_buffer_size"`
 }
 
 type apiResponse struct {
@@ -757,6 +912,9 @@ func (c *Conf) getRedacted() Conf {
 	if conf.Setup.InstallationCode != "" {
 		conf.Setup.InstallationCode = redacted
 	}
+	if conf.OAuth2ResourceServer.ClientSecret != "" {
+		conf.OAuth2ResourceServer.ClientSecret = redacted
+	}
 	conf.Bindings = nil
 	for _, binding := range c.Bindings {
 		if binding.OIDC.ClientID != "" {
@@ -783,6 +941,13 @@ func (c *Conf) getKeyPairs(configDir string) []common.TLSKeyPair {
 				ID:   binding.GetAddress(),
 			})
 		}
+		for _, vhost := range binding.VirtualHosts {
+			keyPairs = append(keyPairs, common.TLSKeyPair{
+				Cert: getConfigPath(vhost.CertificateFile, configDir),
+				Key:  getConfigPath(vhost.CertificateKeyFile, configDir),
+				ID:   vhost.getCertID(binding.GetAddress()),
+			})
+		}
 	}
 	certificateFile := getConfigPath(c.CertificateFile, configDir)
 	certificateKeyFile := getConfigPath(c.CertificateKeyFile, configDir)
@@ -796,6 +961,14 @@ func (c *Conf) getKeyPairs(configDir string) []common.TLSKeyPair {
 	return keyPairs
 }
 
+func (c *Conf) setImpersonationTokenDuration() {
+	if c.ImpersonationTokenTTL > 0 {
+		impersonationTokenDuration = time.Duration(c.ImpersonationTokenTTL) * time.Minute
+	} else {
+		impersonationTokenDuration = defaultImpersonationTokenDuration
+	}
+}
+
 func (c *Conf) setTokenValidationMode() {
 	if c.TokenValidation == 1 {
 		tokenValidationMode = tokenValidationNoIPMatch
@@ -808,7 +981,10 @@ func (c *Conf) setTokenValidationMode() {
 func (c *Conf) Initialize(configDir string, isShared int) error {
 	logger.Info(logSender, "", "initializing HTTP server with config %+v", c.getRedacted())
 	resetCodesMgr = newResetCodeManager(isShared)
+	oneTimeTokensMgr = newOneTimeTokenManager(isShared)
 	oidcMgr = newOIDCManager(isShared)
+	userSessionsMgr = newUserSessionsManager(isShared)
+	common.SetNodesSessionsCounter(getNodesActiveSessions)
 	staticFilesPath := util.FindSharedDataPath(c.StaticFilesPath, configDir)
 	templatesPath := util.FindSharedDataPath(c.TemplatesPath, configDir)
 	openAPIPath := util.FindSharedDataPath(c.OpenAPIPath, configDir)
@@ -827,6 +1003,32 @@ func (c *Conf) Initialize(configDir string, isShared int) error {
 	} else {
 		logger.Info(logSender, "", "built-in web client interface disabled")
 	}
+	for idx := range c.Bindings {
+		if err := c.Bindings[idx].checkVirtualHosts(); err != nil {
+			return err
+		}
+		if err := c.Bindings[idx].SecurityHeaders.Validate(); err != nil {
+			return fmt.Errorf("binding %q: %w", c.Bindings[idx].GetAddress(), err)
+		}
+	}
+	if err := c.RequestSizeLimits.validate(); err != nil {
+		return err
+	}
+	if err := c.OAuth2ResourceServer.validate(); err != nil {
+		return err
+	}
+	if err := c.GCSNotifications.validate(); err != nil {
+		return err
+	}
+	if err := c.Cors.validate(); err != nil {
+		return err
+	}
+	if c.LogsStreamBufferSize < 0 {
+		return fmt.Errorf("invalid logs stream buffer size: %d", c.LogsStreamBufferSize)
+	}
+	oauth2Introspector.setConfig(c.OAuth2ResourceServer)
+	gcsNotifications.setConfig(c.GCSNotifications, newGoogleKeySet())
+	logger.SetLogTailerBufferSize(c.LogsStreamBufferSize)
 	keyPairs := c.getKeyPairs(configDir)
 	if len(keyPairs) > 0 {
 		mgr, err := common.NewCertManager(keyPairs, configDir, logSender)
@@ -846,6 +1048,8 @@ func (c *Conf) Initialize(configDir string, isShared int) error {
 
 	csrfTokenAuth = jwtauth.New(jwa.HS256.String(), getSigningKey(c.SigningPassphrase), nil)
 	hideSupportLink = c.HideSupportLink
+	disableHTTP2Push = c.DisableHTTP2Push
+	requestSizeLimits = c.RequestSizeLimits
 
 	exitChannel := make(chan error, 1)
 
@@ -877,10 +1081,13 @@ func (c *Conf) Initialize(configDir string, isShared int) error {
 	}
 
 	maxUploadFileSize = c.MaxUploadFileSize
+	maxArchiveSize = c.MaxArchiveSize
 	installationCode = c.Setup.InstallationCode
 	installationCodeHint = c.Setup.InstallationCodeHint
 	startCleanupTicker(tokenDuration / 2)
 	c.setTokenValidationMode()
+	c.setImpersonationTokenDuration()
+	fsHealthChecks.setConfig(c.FilesystemCheck)
 	return <-exitChannel
 }
 
@@ -900,6 +1107,14 @@ func ReloadCertificateMgr() error {
 	return nil
 }
 
+// GetCertificatesInfo returns the metadata for the loaded TLS certificates
+func GetCertificatesInfo() []common.TLSCertificateInfo {
+	if certMgr != nil {
+		return certMgr.GetCertificatesInfo()
+	}
+	return nil
+}
+
 func getConfigPath(name, configDir string) string {
 	if !util.IsFileInputValid(name) {
 		return ""
@@ -924,6 +1139,14 @@ func getServicesStatus() *ServicesStatus {
 	return status
 }
 
+func getTLSCertificatesStatus() *TLSCertificatesStatus {
+	return &TLSCertificatesStatus{
+		HTTP:   GetCertificatesInfo(),
+		FTP:    ftpd.GetCertificatesInfo(),
+		WebDAV: webdavd.GetCertificatesInfo(),
+	}
+}
+
 func fileServer(r chi.Router, path string, root http.FileSystem) {
 	if path != "/" && path[len(path)-1] != '/' {
 		r.Get(path, http.RedirectHandler(path+"/", http.StatusMovedPermanently).ServeHTTP)
@@ -1046,6 +1269,8 @@ func startCleanupTicker(duration time.Duration) {
 				counter++
 				cleanupExpiredJWTTokens()
 				resetCodesMgr.Cleanup()
+				oneTimeTokensMgr.Cleanup()
+				userSessionsMgr.Cleanup()
 				if counter%2 == 0 {
 					oidcMgr.cleanup()
 				}
@@ -15,12 +15,15 @@
 package httpd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
@@ -31,8 +34,14 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
 var (
 	forwardedProtoKey = &contextKey{"forwarded proto"}
+	apiKeyCtxKey      = &contextKey{"API key"}
 	errInvalidToken   = errors.New("invalid JWT token")
 )
 
@@ -65,39 +74,48 @@ func validateJWTToken(w http.ResponseWriter, r *http.Request, audience tokenAudi
 	}
 
 	if err != nil || token == nil {
-		logger.Debug(logSender, "", "error getting jwt token: %v", err)
+		logForRequest(r, logger.LevelDebug, "error getting jwt token: %v", err)
 		doRedirect(http.StatusText(http.StatusUnauthorized), err)
 		return errInvalidToken
 	}
 
 	err = jwt.Validate(token)
 	if err != nil {
-		logger.Debug(logSender, "", "error validating jwt token: %v", err)
+		logForRequest(r, logger.LevelDebug, "error validating jwt token: %v", err)
 		doRedirect(http.StatusText(http.StatusUnauthorized), err)
 		return errInvalidToken
 	}
 	if isTokenInvalidated(r) {
-		logger.Debug(logSender, "", "the token has been invalidated")
+		logForRequest(r, logger.LevelDebug, "the token has been invalidated")
 		doRedirect("Your token is no longer valid", nil)
 		return errInvalidToken
 	}
+	if isUserSessionRevoked(token) {
+		logForRequest(r, logger.LevelDebug, "the session for the token with id %q has been revoked", token.JwtID())
+		doRedirect("Your session has been revoked", nil)
+		return errInvalidToken
+	}
 	// a user with a partial token will be always redirected to the appropriate two factor auth page
 	if err := checkPartialAuth(w, r, audience, token.Audience()); err != nil {
 		return err
 	}
 	if !util.Contains(token.Audience(), audience) {
-		logger.Debug(logSender, "", "the token is not valid for audience %#v", audience)
+		logForRequest(r, logger.LevelDebug, "the token is not valid for audience %#v", audience)
 		doRedirect("Your token audience is not valid", nil)
 		return errInvalidToken
 	}
 	if tokenValidationMode != tokenValidationNoIPMatch {
 		ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
 		if !util.Contains(token.Audience(), ipAddr) {
-			logger.Debug(logSender, "", "the token with id %#v is not valid for the ip address %#v", token.JwtID(), ipAddr)
+			logForRequest(r, logger.LevelDebug, "the token with id %#v is not valid for the ip address %#v", token.JwtID(), ipAddr)
 			doRedirect("Your token is not valid", nil)
 			return errInvalidToken
 		}
 	}
+	if impersonatedBy, ok := token.Get(claimImpersonatedBy); ok {
+		logForRequest(r, logger.LevelInfo, "request %s %q for user %q, impersonated_by: %q", r.Method, r.URL.Path,
+			token.PrivateClaims()[claimUsernameKey], impersonatedBy)
+	}
 	return nil
 }
 
@@ -118,7 +136,7 @@ func (s *httpdServer) validateJWTPartialToken(w http.ResponseWriter, r *http.Req
 		return errInvalidToken
 	}
 	if !util.Contains(token.Audience(), audience) {
-		logger.Debug(logSender, "", "the token is not valid for audience %#v", audience)
+		logForRequest(r, logger.LevelDebug, "the token is not valid for audience %#v", audience)
 		notFoundFunc(w, r, nil)
 		return errInvalidToken
 	}
@@ -254,7 +272,8 @@ func (s *httpdServer) requireBuiltinLogin(next http.Handler) http.Handler {
 	})
 }
 
-func (s *httpdServer) checkPerm(perm string) func(next http.Handler) http.Handler {
+// checkPerm allows the request if the logged in admin has at least one of the specified permissions
+func (s *httpdServer) checkPerm(perms ...string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			_, claims, err := jwtauth.FromContext(r.Context())
@@ -269,7 +288,7 @@ func (s *httpdServer) checkPerm(perm string) func(next http.Handler) http.Handle
 			tokenClaims := jwtTokenClaims{}
 			tokenClaims.Decode(claims)
 
-			if !tokenClaims.hasPerm(perm) {
+			if !tokenClaims.hasPerm(perms...) {
 				if isWebRequest(r) {
 					s.renderForbiddenPage(w, r, "You don't have permission for this action")
 				} else {
@@ -377,6 +396,11 @@ func checkAPIKeyAuth(tokenAuth *jwtauth.JWTAuth, scope dataprovider.APIKeyScope)
 				sendAPIResponse(w, r, fmt.Errorf("the provided api key cannot be authenticated"), "", http.StatusUnauthorized)
 				return
 			}
+			if code, err := checkAPIKeyRestrictions(&k, r); err != nil {
+				logger.Debug(logSender, "", "api key %#v not allowed: %v", keyID, err)
+				sendAPIResponse(w, r, err, "", code)
+				return
+			}
 			if scope == dataprovider.APIKeyScopeAdmin {
 				if k.Admin != "" {
 					apiUser = k.Admin
@@ -406,11 +430,60 @@ func checkAPIKeyAuth(tokenAuth *jwtauth.JWTAuth, scope dataprovider.APIKeyScope)
 			}
 			dataprovider.UpdateAPIKeyLastUse(&k) //nolint:errcheck
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey, &k)))
 		})
 	}
 }
 
+// checkAPIKeyRestrictions enforces the source IP, operations and users
+// restrictions configured for the specified API key
+func checkAPIKeyRestrictions(k *dataprovider.APIKey, r *http.Request) (int, error) {
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	if !k.IsIPAllowed(ipAddr) {
+		return http.StatusForbidden, fmt.Errorf("the provided api key cannot be used from IP address %q", ipAddr)
+	}
+	if !k.IsOperationAllowed(getAPIKeyOperation(r.Method)) {
+		return http.StatusForbidden, fmt.Errorf("the provided api key does not allow %s requests", r.Method)
+	}
+	if k.Scope != dataprovider.APIKeyScopeAdmin || !k.HasUsersRestrictions() {
+		return 0, nil
+	}
+	if r.URL.Path == userPath {
+		// users list and creation are checked within the handlers
+		return 0, nil
+	}
+	for _, prefix := range []string{userPath, quotasBasePath + "/users", retentionBasePath, metadataBasePath} {
+		if strings.HasPrefix(r.URL.Path, prefix+"/") {
+			username := strings.Split(strings.TrimPrefix(r.URL.Path, prefix+"/"), "/")[0]
+			if username != "" && k.IsUserAllowed(username) {
+				return 0, nil
+			}
+			return http.StatusForbidden, fmt.Errorf("the provided api key is not allowed to manage user %q", username)
+		}
+	}
+	return http.StatusForbidden, errors.New("the provided api key is restricted to users management")
+}
+
+func getAPIKeyOperation(method string) string {
+	switch method {
+	case http.MethodPost:
+		return dataprovider.APIKeyOperationCreate
+	case http.MethodPut, http.MethodPatch:
+		return dataprovider.APIKeyOperationUpdate
+	case http.MethodDelete:
+		return dataprovider.APIKeyOperationDelete
+	default:
+		return dataprovider.APIKeyOperationRead
+	}
+}
+
+func getAPIKeyFromContext(r *http.Request) *dataprovider.APIKey {
+	if k, ok := r.Context().Value(apiKeyCtxKey).(*dataprovider.APIKey); ok {
+		return k
+	}
+	return nil
+}
+
 func forbidAPIKeyAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		claims, err := getTokenClaims(r)
@@ -422,6 +495,28 @@ func forbidAPIKeyAuthentication(next http.Handler) http.Handler {
 			sendAPIResponse(w, r, nil, "API key authentication is not allowed", http.StatusForbidden)
 			return
 		}
+		if claims.ExternalToken {
+			sendAPIResponse(w, r, nil, "External token authentication is not allowed", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forbidImpersonation rejects the tokens issued to admins impersonating a user,
+// they must not be able to change the user credentials
+func forbidImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := getTokenClaims(r)
+		if err != nil || claims.Username == "" {
+			sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+			return
+		}
+		if claims.ImpersonatedBy != "" {
+			sendAPIResponse(w, r, nil, "This action is not allowed while impersonating a user", http.StatusForbidden)
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
@@ -515,6 +610,191 @@ func authenticateUserWithAPIKey(username, keyID string, tokenAuth *jwtauth.JWTAu
 	return nil
 }
 
+// checkOAuth2ResourceServerAuth validates the bearer tokens issued by an external
+// OAuth2 authorization server and replaces them with an SFTPGo token.
+// The SFTPGo tokens issued for an external token are cached and reused, until
+// the associated admin or user is updated, so the full login is not repeated
+// for each request. Tokens issued by SFTPGo, including expired or tampered ones,
+// are passed through unchanged and validated by the next middlewares.
+// Rejected tokens count as failed logins for the defender
+func checkOAuth2ResourceServerAuth(tokenAuth *jwtauth.JWTAuth, scope dataprovider.APIKeyScope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !oauth2Introspector.isEnabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token := jwtauth.TokenFromHeader(r)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if isSFTPGoToken(token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+			cacheKey := getOAuth2TokenCacheKey(token)
+			subject, err := oauth2Introspector.introspect(r.Context(), token, cacheKey)
+			if err != nil {
+				logger.Debug(logSender, "", "unable to validate external token: %v", err)
+				if errors.Is(err, errOAuth2InvalidToken) {
+					updateLoginMetrics(&dataprovider.User{}, dataprovider.LoginMethodIDP, ipAddr, err)
+				}
+				sendAPIResponse(w, r, errors.New("the provided token cannot be authenticated"), "", http.StatusUnauthorized)
+				return
+			}
+			if issued, ok := oauth2Introspector.getIssuedToken(cacheKey, scope, ipAddr); ok {
+				if isOAuth2IssuedTokenValid(subject, issued, scope, r) {
+					r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", issued.token))
+					next.ServeHTTP(w, r)
+					return
+				}
+				oauth2Introspector.removeIssuedToken(cacheKey, scope, ipAddr)
+			}
+			if scope == dataprovider.APIKeyScopeAdmin {
+				issuedToken, signature, err := authenticateAdminWithExternalToken(subject, tokenAuth, r)
+				if err != nil {
+					logger.Debug(logSender, "", "unable to authenticate admin %q associated with the external token: %v",
+						subject, err)
+					sendAPIResponse(w, r, errors.New("the admin associated with the provided token cannot be authenticated"),
+						"", http.StatusUnauthorized)
+					return
+				}
+				oauth2Introspector.addIssuedToken(cacheKey, scope, ipAddr, issuedToken, signature)
+			} else {
+				issuedToken, signature, err := authenticateUserWithExternalToken(subject, tokenAuth, r)
+				if err != nil {
+					logger.Debug(logSender, "", "unable to authenticate user %q associated with the external token: %v",
+						subject, err)
+					code := http.StatusUnauthorized
+					if errors.Is(err, common.ErrInternalFailure) {
+						code = http.StatusInternalServerError
+					}
+					sendAPIResponse(w, r, errors.New("the user associated with the provided token cannot be authenticated"),
+						"", code)
+					return
+				}
+				oauth2Introspector.addIssuedToken(cacheKey, scope, ipAddr, issuedToken, signature)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isOAuth2IssuedTokenValid returns true if a cached SFTPGo token can be reused.
+// Any update to the admin or user changes its signature and so a new login
+// is required
+func isOAuth2IssuedTokenValid(username string, issued oauth2IssuedToken, scope dataprovider.APIKeyScope,
+	r *http.Request,
+) bool {
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	if scope == dataprovider.APIKeyScopeAdmin {
+		admin, err := dataprovider.AdminExists(username)
+		if err != nil {
+			return false
+		}
+		return admin.GetSignature() == issued.signature && admin.CanLogin(ipAddr) == nil
+	}
+	user, err := dataprovider.UserExists(username)
+	if err != nil {
+		return false
+	}
+	return user.GetSignature() == issued.signature && user.CheckLoginConditions() == nil &&
+		user.IsLoginFromAddrAllowed(r.RemoteAddr)
+}
+
+func authenticateAdminWithExternalToken(username string, tokenAuth *jwtauth.JWTAuth, r *http.Request) (string, string, error) {
+	admin, err := dataprovider.AdminExists(username)
+	if err != nil {
+		return "", "", err
+	}
+	if !admin.Filters.AllowExternalTokenAuth {
+		return "", "", errors.New("external token authentication is not allowed")
+	}
+	if admin.Filters.TOTPConfig.Enabled {
+		return "", "", errors.New("external token authentication is not allowed if two-factor authentication is enabled")
+	}
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	if err := admin.CanLogin(ipAddr); err != nil {
+		return "", "", err
+	}
+	c := jwtTokenClaims{
+		Username:      admin.Username,
+		Permissions:   admin.Permissions,
+		Signature:     admin.GetSignature(),
+		ExternalToken: true,
+	}
+
+	resp, err := c.createTokenResponse(tokenAuth, tokenAudienceAPI, ipAddr)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken := resp["access_token"].(string)
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	dataprovider.UpdateAdminLastLogin(&admin)
+	return accessToken, c.Signature, nil
+}
+
+func authenticateUserWithExternalToken(username string, tokenAuth *jwtauth.JWTAuth, r *http.Request) (string, string, error) {
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	protocol := common.ProtocolHTTP
+	if err := common.Config.ExecutePostConnectHook(ipAddr, protocol); err != nil {
+		return "", "", err
+	}
+	user, err := dataprovider.GetUserWithGroupSettings(username)
+	if err != nil {
+		updateLoginMetrics(&dataprovider.User{BaseUser: sdk.BaseUser{Username: username}},
+			dataprovider.LoginMethodIDP, ipAddr, err)
+		return "", "", err
+	}
+	if !user.Filters.AllowExternalTokenAuth {
+		err = errors.New("external token authentication is not allowed")
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, err)
+		return "", "", err
+	}
+	if (user.Filters.TOTPConfig.Enabled && util.Contains(user.Filters.TOTPConfig.Protocols, protocol)) ||
+		user.MustSetSecondFactorForProtocol(protocol) {
+		err = errors.New("external token authentication is not allowed if two-factor authentication is enabled or required")
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, err)
+		return "", "", err
+	}
+	if err := user.CheckLoginConditions(); err != nil {
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, err)
+		return "", "", err
+	}
+	connectionID := fmt.Sprintf("%v_%v", protocol, xid.New().String())
+	if err := checkHTTPClientUser(&user, r, connectionID, true); err != nil {
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, err)
+		return "", "", err
+	}
+	defer user.CloseFs() //nolint:errcheck
+	err = user.CheckFsRoot(connectionID)
+	if err != nil {
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, common.ErrInternalFailure)
+		return "", "", common.ErrInternalFailure
+	}
+	c := jwtTokenClaims{
+		Username:      user.Username,
+		Permissions:   user.Filters.WebClient,
+		Signature:     user.GetSignature(),
+		ExternalToken: true,
+	}
+
+	resp, err := c.createTokenResponse(tokenAuth, tokenAudienceAPIUser, ipAddr)
+	if err != nil {
+		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, common.ErrInternalFailure)
+		return "", "", err
+	}
+	accessToken := resp["access_token"].(string)
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", accessToken))
+	dataprovider.UpdateLastLogin(&user)
+	updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, nil)
+
+	return accessToken, c.Signature, nil
+}
+
 func checkPartialAuth(w http.ResponseWriter, r *http.Request, audience string, tokenAudience []string) error {
 	if audience == tokenAudienceWebAdmin && util.Contains(tokenAudience, tokenAudienceWebAdminPartial) {
 		http.Redirect(w, r, webAdminTwoFactorPath, http.StatusFound)
@@ -526,3 +806,41 @@ func checkPartialAuth(w http.ResponseWriter, r *http.Request, audience string, t
 	}
 	return nil
 }
+
+// requestIDMiddleware uses the X-Request-ID header, if valid, as request ID or
+// generates a new one. The request ID is stored in the request context, so it can
+// be retrieved using middleware.GetReqID, and it is sent back in the response headers
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, requestID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isValidRequestID returns true if the request ID received from the client can be
+// safely included in the logs and in the response headers
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logForRequest logs at the specified level including the ID of the specified request
+func logForRequest(r *http.Request, level logger.LogLevel, format string, v ...any) {
+	logger.LogWithRequestID(level, logSender, "", middleware.GetReqID(r.Context()), format, v...)
+}
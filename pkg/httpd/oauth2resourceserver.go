@@ -0,0 +1,390 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	oauth2IntrospectionTimeout = 10 * time.Second
+	// issued SFTPGo tokens are reused until this margin before their expiration
+	oauth2IssuedTokenMargin = 2 * time.Minute
+	// tokens rejected by the authorization server are rejected without a new
+	// introspection request for this duration
+	oauth2FailedLookupTTL = 5 * time.Minute
+	// maximum number of cached failed lookups
+	oauth2MaxFailedLookups = 10000
+)
+
+var (
+	oauth2Introspector = newOAuth2TokenIntrospector()
+	// returned if the authorization server rejects the token, as opposed to
+	// errors contacting the introspection endpoint
+	errOAuth2InvalidToken = errors.New("invalid token")
+	// audiences used for the tokens issued by SFTPGo
+	sftpgoTokenAudiences = []string{tokenAudienceWebAdmin, tokenAudienceWebClient, tokenAudienceWebAdminPartial,
+		tokenAudienceWebClientPartial, tokenAudienceAPI, tokenAudienceAPIUser, tokenAudienceCSRF,
+		tokenAudienceOneTimeDownload}
+)
+
+// OAuth2ResourceServerConfig defines the configuration to accept, for the REST API,
+// access tokens issued by an external OAuth2 authorization server.
+// Tokens are validated using the token introspection endpoint (RFC 7662) and the
+// "sub" claim must match an existing SFTPGo admin or user
+type OAuth2ResourceServerConfig struct {
+	// Token introspection endpoint. Leave empty to disable
+	IntrospectionEndpoint string `json:"introspection_endpoint" mapstructure:"introspection_endpoint"`
+	// Client ID and secret used to authenticate against the introspection endpoint
+	ClientID     string `json:"client_id" mapstructure:"client_id"`
+	ClientSecret string `json:"client_secret" mapstructure:"client_secret"`
+	// Audience that must be included in the "aud" claim of the introspected tokens.
+	// Empty means the client ID
+	Audience string `json:"audience" mapstructure:"audience"`
+	// Scopes that must be granted to a token, all of them are required
+	RequiredScopes []string `json:"required_scopes" mapstructure:"required_scopes"`
+}
+
+func (c *OAuth2ResourceServerConfig) isEnabled() bool {
+	return c.IntrospectionEndpoint != ""
+}
+
+func (c *OAuth2ResourceServerConfig) validate() error {
+	if !c.isEnabled() {
+		return nil
+	}
+	if !strings.HasPrefix(c.IntrospectionEndpoint, "http") {
+		return fmt.Errorf("invalid OAuth2 introspection endpoint %q", c.IntrospectionEndpoint)
+	}
+	if c.ClientID == "" {
+		return errors.New("OAuth2 resource server: client ID is required")
+	}
+	if c.Audience == "" {
+		c.Audience = c.ClientID
+	}
+	c.RequiredScopes = util.RemoveDuplicates(c.RequiredScopes, true)
+	return nil
+}
+
+// oauth2IntrospectionResponse defines the RFC 7662 fields we are interested in
+type oauth2IntrospectionResponse struct {
+	Active  bool   `json:"active"`
+	Scope   string `json:"scope"`
+	Subject string `json:"sub"`
+	// Audience, a string or an array of strings
+	Audience json.RawMessage `json:"aud"`
+	// Expiration time as unix timestamp
+	ExpiresAt int64 `json:"exp"`
+}
+
+func (r *oauth2IntrospectionResponse) getAudience() []string {
+	if len(r.Audience) == 0 {
+		return nil
+	}
+	var audience string
+	if err := json.Unmarshal(r.Audience, &audience); err == nil {
+		return []string{audience}
+	}
+	var audiences []string
+	if err := json.Unmarshal(r.Audience, &audiences); err == nil {
+		return audiences
+	}
+	return nil
+}
+
+type oauth2IntrospectionResult struct {
+	subject   string
+	expiresAt time.Time
+}
+
+// oauth2IssuedToken is an SFTPGo access token issued for an external token
+type oauth2IssuedToken struct {
+	token string
+	// signature of the admin or user at issue time
+	signature string
+	expiresAt time.Time
+}
+
+// oauth2TokenIntrospector validates external access tokens and caches the
+// results, and the SFTPGo tokens issued for them, until the token expiration.
+// Rejected tokens are cached too, so they are not introspected again for each request
+type oauth2TokenIntrospector struct {
+	sync.RWMutex
+	config        OAuth2ResourceServerConfig
+	cache         map[string]oauth2IntrospectionResult
+	issuedTokens  map[string]oauth2IssuedToken
+	failedLookups map[string]time.Time
+}
+
+func newOAuth2TokenIntrospector() *oauth2TokenIntrospector {
+	return &oauth2TokenIntrospector{
+		cache:         make(map[string]oauth2IntrospectionResult),
+		issuedTokens:  make(map[string]oauth2IssuedToken),
+		failedLookups: make(map[string]time.Time),
+	}
+}
+
+func (i *oauth2TokenIntrospector) setConfig(config OAuth2ResourceServerConfig) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.config = config
+	i.cache = make(map[string]oauth2IntrospectionResult)
+	i.issuedTokens = make(map[string]oauth2IssuedToken)
+	i.failedLookups = make(map[string]time.Time)
+}
+
+func (i *oauth2TokenIntrospector) isEnabled() bool {
+	i.RLock()
+	defer i.RUnlock()
+
+	return i.config.isEnabled()
+}
+
+func (i *oauth2TokenIntrospector) getFromCache(key string) (string, bool) {
+	i.RLock()
+	defer i.RUnlock()
+
+	result, ok := i.cache[key]
+	if !ok || !time.Now().Before(result.expiresAt) {
+		return "", false
+	}
+	return result.subject, true
+}
+
+func (i *oauth2TokenIntrospector) addToCache(key string, result oauth2IntrospectionResult) {
+	i.Lock()
+	defer i.Unlock()
+
+	now := time.Now()
+	for k, v := range i.cache {
+		if !now.Before(v.expiresAt) {
+			delete(i.cache, k)
+		}
+	}
+	i.cache[key] = result
+}
+
+func (i *oauth2TokenIntrospector) isFailedLookup(key string) bool {
+	i.RLock()
+	defer i.RUnlock()
+
+	expiresAt, ok := i.failedLookups[key]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (i *oauth2TokenIntrospector) addFailedLookup(key string) {
+	i.Lock()
+	defer i.Unlock()
+
+	now := time.Now()
+	for k, v := range i.failedLookups {
+		if !now.Before(v) {
+			delete(i.failedLookups, k)
+		}
+	}
+	if len(i.failedLookups) >= oauth2MaxFailedLookups {
+		// the defender should ban the clients sending so many invalid tokens,
+		// we just avoid unbounded memory usage here
+		for k := range i.failedLookups {
+			delete(i.failedLookups, k)
+			if len(i.failedLookups) < oauth2MaxFailedLookups {
+				break
+			}
+		}
+	}
+	i.failedLookups[key] = now.Add(oauth2FailedLookupTTL)
+}
+
+func (i *oauth2TokenIntrospector) getIssuedToken(key string, scope dataprovider.APIKeyScope, ipAddr string,
+) (oauth2IssuedToken, bool) {
+	i.RLock()
+	defer i.RUnlock()
+
+	issued, ok := i.issuedTokens[getOAuth2IssuedTokenKey(key, scope, ipAddr)]
+	if !ok || !time.Now().Before(issued.expiresAt) {
+		return issued, false
+	}
+	return issued, true
+}
+
+// addIssuedToken caches the SFTPGo token issued for the external token identified
+// by the given key. The token is cached only if the external token is cached too.
+// SFTPGo tokens are bound to the client IP address, so it is part of the cache key
+func (i *oauth2TokenIntrospector) addIssuedToken(key string, scope dataprovider.APIKeyScope, ipAddr, token, signature string) {
+	i.Lock()
+	defer i.Unlock()
+
+	result, ok := i.cache[key]
+	if !ok {
+		return
+	}
+	expiresAt := time.Now().Add(tokenDuration - oauth2IssuedTokenMargin)
+	if result.expiresAt.Before(expiresAt) {
+		expiresAt = result.expiresAt
+	}
+	now := time.Now()
+	for k, v := range i.issuedTokens {
+		if !now.Before(v.expiresAt) {
+			delete(i.issuedTokens, k)
+		}
+	}
+	i.issuedTokens[getOAuth2IssuedTokenKey(key, scope, ipAddr)] = oauth2IssuedToken{
+		token:     token,
+		signature: signature,
+		expiresAt: expiresAt,
+	}
+}
+
+func (i *oauth2TokenIntrospector) removeIssuedToken(key string, scope dataprovider.APIKeyScope, ipAddr string) {
+	i.Lock()
+	defer i.Unlock()
+
+	delete(i.issuedTokens, getOAuth2IssuedTokenKey(key, scope, ipAddr))
+}
+
+// introspect validates the token identified by the given cache key and returns
+// the associated subject. The returned error wraps errOAuth2InvalidToken if the
+// token is rejected
+func (i *oauth2TokenIntrospector) introspect(ctx context.Context, token, cacheKey string) (string, error) {
+	if subject, ok := i.getFromCache(cacheKey); ok {
+		return subject, nil
+	}
+	if i.isFailedLookup(cacheKey) {
+		return "", fmt.Errorf("%w: the token was already rejected", errOAuth2InvalidToken)
+	}
+
+	i.RLock()
+	config := i.config
+	i.RUnlock()
+
+	resp, err := doOAuth2Introspection(ctx, &config, token)
+	if err != nil {
+		return "", err
+	}
+	if err := checkOAuth2IntrospectionResponse(&config, &resp); err != nil {
+		i.addFailedLookup(cacheKey)
+		return "", fmt.Errorf("%w: %v", errOAuth2InvalidToken, err)
+	}
+	// tokens without an expiration are never cached
+	if resp.ExpiresAt > 0 {
+		expiresAt := time.Unix(resp.ExpiresAt, 0)
+		i.addToCache(cacheKey, oauth2IntrospectionResult{
+			subject:   resp.Subject,
+			expiresAt: expiresAt,
+		})
+	}
+	return resp.Subject, nil
+}
+
+func checkOAuth2IntrospectionResponse(config *OAuth2ResourceServerConfig, resp *oauth2IntrospectionResponse) error {
+	if !resp.Active {
+		return errors.New("the token is not active")
+	}
+	if resp.Subject == "" {
+		return errors.New("the token has no subject")
+	}
+	if !util.Contains(resp.getAudience(), config.Audience) {
+		return fmt.Errorf("the token audience does not include %q", config.Audience)
+	}
+	grantedScopes := strings.Fields(resp.Scope)
+	for _, scope := range config.RequiredScopes {
+		if !util.Contains(grantedScopes, scope) {
+			return fmt.Errorf("the token does not grant the required scope %q", scope)
+		}
+	}
+	if resp.ExpiresAt > 0 && !time.Now().Before(time.Unix(resp.ExpiresAt, 0)) {
+		return errors.New("the token is expired")
+	}
+	return nil
+}
+
+// isSFTPGoToken returns true if the token is a JWT with an SFTPGo audience.
+// The signature and the expiration are not verified here, these tokens are
+// validated by the SFTPGo authentication middlewares and are never sent to
+// the introspection endpoint
+func isSFTPGoToken(token string) bool {
+	t, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return false
+	}
+	for _, audience := range t.Audience() {
+		if util.Contains(sftpgoTokenAudiences, audience) {
+			return true
+		}
+	}
+	return false
+}
+
+func getOAuth2TokenCacheKey(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func getOAuth2IssuedTokenKey(key string, scope dataprovider.APIKeyScope, ipAddr string) string {
+	return fmt.Sprintf("%d_%s_%s", scope, ipAddr, key)
+}
+
+func doOAuth2Introspection(ctx context.Context, config *OAuth2ResourceServerConfig, token string,
+) (oauth2IntrospectionResponse, error) {
+	var result oauth2IntrospectionResponse
+
+	ctx, cancel := context.WithTimeout(ctx, oauth2IntrospectionTimeout)
+	defer cancel()
+
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.IntrospectionEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+
+	resp, err := httpclient.GetHTTPClient().Do(req)
+	if err != nil {
+		return result, fmt.Errorf("unable to connect to the introspection endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected introspection response status code: %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, DefaultRequestSizeLimit)).Decode(&result)
+	if err != nil {
+		return result, fmt.Errorf("unable to decode the introspection response: %w", err)
+	}
+	return result, nil
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/httpclient"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
 const (
@@ -45,6 +46,7 @@ const (
 var (
 	oidcTokenKey       = &contextKey{"OIDC token key"}
 	oidcGeneratedToken = &contextKey{"OIDC generated token"}
+	oidcTokenSourceKey = &contextKey{"OIDC token source"}
 )
 
 // OAuth2Config defines an interface for OAuth2 methods, so we can mock them
@@ -306,6 +308,23 @@ func (t *oidcToken) isAdmin() bool {
 	}
 }
 
+// getTokenSource returns the source for the access token of the OIDC session
+// associated with the specified cookie. The token is refreshed if expired
+func (o *OIDC) getTokenSource(cookie string, r *http.Request) vfs.OIDCTokenSource {
+	return func() (string, error) {
+		token, err := oidcMgr.getToken(cookie)
+		if err != nil {
+			return "", err
+		}
+		if token.isExpired() {
+			if err := token.refresh(o.oauth2Config, o.verifier, r); err != nil {
+				return "", err
+			}
+		}
+		return token.AccessToken, nil
+	}
+}
+
 func (t *oidcToken) isExpired() bool {
 	if t.ExpiresAt == 0 {
 		return false
@@ -315,7 +334,7 @@ func (t *oidcToken) isExpired() bool {
 
 func (t *oidcToken) refresh(config OAuth2Config, verifier OIDCTokenVerifier, r *http.Request) error {
 	if t.RefreshToken == "" {
-		logger.Debug(logSender, "", "refresh token not set, unable to refresh cookie %#v", t.Cookie)
+		logForRequest(r, logger.LevelDebug, "refresh token not set, unable to refresh cookie %#v", t.Cookie)
 		return errors.New("refresh token not set")
 	}
 	oauth2Token := oauth2.Token{
@@ -331,12 +350,12 @@ func (t *oidcToken) refresh(config OAuth2Config, verifier OIDCTokenVerifier, r *
 
 	newToken, err := config.TokenSource(ctx, &oauth2Token).Token()
 	if err != nil {
-		logger.Debug(logSender, "", "unable to refresh token for cookie %#v: %v", t.Cookie, err)
+		logForRequest(r, logger.LevelDebug, "unable to refresh token for cookie %#v: %v", t.Cookie, err)
 		return err
 	}
 	rawIDToken, ok := newToken.Extra("id_token").(string)
 	if !ok {
-		logger.Debug(logSender, "", "the refreshed token has no id token, cookie %#v", t.Cookie)
+		logForRequest(r, logger.LevelDebug, "the refreshed token has no id token, cookie %#v", t.Cookie)
 		return errors.New("the refreshed token has no id token")
 	}
 
@@ -351,17 +370,17 @@ func (t *oidcToken) refresh(config OAuth2Config, verifier OIDCTokenVerifier, r *
 	}
 	idToken, err := verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		logger.Debug(logSender, "", "unable to verify refreshed id token for cookie %#v: %v", t.Cookie, err)
+		logForRequest(r, logger.LevelDebug, "unable to verify refreshed id token for cookie %#v: %v", t.Cookie, err)
 		return err
 	}
 	if idToken.Nonce != t.Nonce {
-		logger.Debug(logSender, "", "unable to verify refreshed id token for cookie %#v: nonce mismatch", t.Cookie)
+		logForRequest(r, logger.LevelDebug, "unable to verify refreshed id token for cookie %#v: nonce mismatch", t.Cookie)
 		return errors.New("the refreshed token nonce mismatch")
 	}
 	claims := make(map[string]any)
 	err = idToken.Claims(&claims)
 	if err != nil {
-		logger.Debug(logSender, "", "unable to get refreshed id token claims for cookie %#v: %v", t.Cookie, err)
+		logForRequest(r, logger.LevelDebug, "unable to get refreshed id token claims for cookie %#v: %v", t.Cookie, err)
 		return err
 	}
 	sid, ok := claims["sid"].(string)
@@ -370,10 +389,10 @@ func (t *oidcToken) refresh(config OAuth2Config, verifier OIDCTokenVerifier, r *
 	}
 	err = t.refreshUser(r)
 	if err != nil {
-		logger.Debug(logSender, "", "unable to refresh user after token refresh for cookie %#v: %v", t.Cookie, err)
+		logForRequest(r, logger.LevelDebug, "unable to refresh user after token refresh for cookie %#v: %v", t.Cookie, err)
 		return err
 	}
-	logger.Debug(logSender, "", "oidc token refreshed for user %#v, cookie %#v", t.Username, t.Cookie)
+	logForRequest(r, logger.LevelDebug, "oidc token refreshed for user %#v, cookie %#v", t.Username, t.Cookie)
 	oidcMgr.addToken(*t)
 
 	return nil
@@ -438,6 +457,10 @@ func (t *oidcToken) getUser(r *http.Request) error {
 		updateLoginMetrics(&user, dataprovider.LoginMethodIDP, ipAddr, err)
 		return err
 	}
+	// the token was just obtained, no refresh is required
+	user.SetOIDCTokenSource(func() (string, error) {
+		return t.AccessToken, nil
+	})
 	defer user.CloseFs() //nolint:errcheck
 	err = user.CheckFsRoot(connectionID)
 	if err != nil {
@@ -463,18 +486,18 @@ func (s *httpdServer) validateOIDCToken(w http.ResponseWriter, r *http.Request,
 
 	cookie, err := r.Cookie(oidcCookieKey)
 	if err != nil {
-		logger.Debug(logSender, "", "no oidc cookie, redirecting to login page")
+		logForRequest(r, logger.LevelDebug, "no oidc cookie, redirecting to login page")
 		doRedirect()
 		return oidcToken{}, errInvalidToken
 	}
 	token, err := oidcMgr.getToken(cookie.Value)
 	if err != nil {
-		logger.Debug(logSender, "", "error getting oidc token associated with cookie %#v: %v", cookie.Value, err)
+		logForRequest(r, logger.LevelDebug, "error getting oidc token associated with cookie %#v: %v", cookie.Value, err)
 		doRedirect()
 		return oidcToken{}, errInvalidToken
 	}
 	if token.isExpired() {
-		logger.Debug(logSender, "", "oidc token associated with cookie %#v is expired", token.Cookie)
+		logForRequest(r, logger.LevelDebug, "oidc token associated with cookie %#v is expired", token.Cookie)
 		if err = token.refresh(s.binding.OIDC.oauth2Config, s.binding.OIDC.verifier, r); err != nil {
 			setFlashMessage(w, r, "Your OpenID token is expired, please log-in again")
 			doRedirect()
@@ -485,7 +508,7 @@ func (s *httpdServer) validateOIDCToken(w http.ResponseWriter, r *http.Request,
 	}
 	if isAdmin {
 		if !token.isAdmin() {
-			logger.Debug(logSender, "", "oidc token associated with cookie %#v is not valid for admin users", token.Cookie)
+			logForRequest(r, logger.LevelDebug, "oidc token associated with cookie %#v is not valid for admin users", token.Cookie)
 			setFlashMessage(w, r, "Your OpenID token is not valid for the SFTPGo Web Admin UI. Please logout from your OpenID server and log-in as an SFTPGo admin")
 			doRedirect()
 			return oidcToken{}, errInvalidToken
@@ -493,7 +516,7 @@ func (s *httpdServer) validateOIDCToken(w http.ResponseWriter, r *http.Request,
 		return token, nil
 	}
 	if token.isAdmin() {
-		logger.Debug(logSender, "", "oidc token associated with cookie %#v is valid for admin users", token.Cookie)
+		logForRequest(r, logger.LevelDebug, "oidc token associated with cookie %#v is valid for admin users", token.Cookie)
 		setFlashMessage(w, r, "Your OpenID token is not valid for the SFTPGo Web Client UI. Please logout from your OpenID server and log-in as an SFTPGo user")
 		doRedirect()
 		return oidcToken{}, errInvalidToken
@@ -529,6 +552,7 @@ func (s *httpdServer) oidcTokenAuthenticator(audience tokenAudience) func(next h
 			}
 			ctx := context.WithValue(r.Context(), oidcTokenKey, token.Cookie)
 			ctx = context.WithValue(ctx, oidcGeneratedToken, tokenString)
+			ctx = context.WithValue(ctx, oidcTokenSourceKey, s.binding.OIDC.getTokenSource(token.Cookie, r))
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -564,7 +588,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	state := r.URL.Query().Get("state")
 	authReq, err := oidcMgr.getPendingAuth(state)
 	if err != nil {
-		logger.Debug(logSender, "", "oidc authentication state did not match")
+		logForRequest(r, logger.LevelDebug, "oidc authentication state did not match")
 		s.renderClientMessagePage(w, r, "Invalid authentication request", "Authentication state did not match",
 			http.StatusBadRequest, nil, "")
 		return
@@ -587,14 +611,14 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 
 	oauth2Token, err := s.binding.OIDC.oauth2Config.Exchange(ctx, r.URL.Query().Get("code"))
 	if err != nil {
-		logger.Debug(logSender, "", "failed to exchange oidc token: %v", err)
+		logForRequest(r, logger.LevelDebug, "failed to exchange oidc token: %v", err)
 		setFlashMessage(w, r, "Failed to exchange OpenID token")
 		doRedirect()
 		return
 	}
 	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
 	if !ok {
-		logger.Debug(logSender, "", "no id_token field in OAuth2 OpenID token")
+		logForRequest(r, logger.LevelDebug, "no id_token field in OAuth2 OpenID token")
 		setFlashMessage(w, r, "No id_token field in OAuth2 OpenID token")
 		doRedirect()
 		return
@@ -602,14 +626,14 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	s.debugTokenClaims(nil, rawIDToken)
 	idToken, err := s.binding.OIDC.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		logger.Debug(logSender, "", "failed to verify oidc token: %v", err)
+		logForRequest(r, logger.LevelDebug, "failed to verify oidc token: %v", err)
 		setFlashMessage(w, r, "Failed to verify OpenID token")
 		doRedirect()
 		doLogout(rawIDToken)
 		return
 	}
 	if idToken.Nonce != authReq.Nonce {
-		logger.Debug(logSender, "", "oidc authentication nonce did not match")
+		logForRequest(r, logger.LevelDebug, "oidc authentication nonce did not match")
 		setFlashMessage(w, r, "OpenID authentication nonce did not match")
 		doRedirect()
 		doLogout(rawIDToken)
@@ -619,7 +643,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	claims := make(map[string]any)
 	err = idToken.Claims(&claims)
 	if err != nil {
-		logger.Debug(logSender, "", "unable to get oidc token claims: %v", err)
+		logForRequest(r, logger.LevelDebug, "unable to get oidc token claims: %v", err)
 		setFlashMessage(w, r, "Unable to get OpenID token claims")
 		doRedirect()
 		doLogout(rawIDToken)
@@ -640,7 +664,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	err = token.parseClaims(claims, s.binding.OIDC.UsernameField, s.binding.OIDC.RoleField,
 		s.binding.OIDC.CustomFields, s.binding.OIDC.getForcedRole(authReq.Audience))
 	if err != nil {
-		logger.Debug(logSender, "", "unable to parse oidc token claims: %v", err)
+		logForRequest(r, logger.LevelDebug, "unable to parse oidc token claims: %v", err)
 		setFlashMessage(w, r, fmt.Sprintf("Unable to parse OpenID token claims: %v", err))
 		doRedirect()
 		doLogout(rawIDToken)
@@ -649,7 +673,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	switch authReq.Audience {
 	case tokenAudienceWebAdmin:
 		if !token.isAdmin() {
-			logger.Debug(logSender, "", "wrong oidc token role, the mapped user is not an SFTPGo admin")
+			logForRequest(r, logger.LevelDebug, "wrong oidc token role, the mapped user is not an SFTPGo admin")
 			setFlashMessage(w, r, "Wrong OpenID role, the logged in user is not an SFTPGo admin")
 			doRedirect()
 			doLogout(rawIDToken)
@@ -657,7 +681,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 		}
 	case tokenAudienceWebClient:
 		if token.isAdmin() {
-			logger.Debug(logSender, "", "wrong oidc token role, the mapped user is an SFTPGo admin")
+			logForRequest(r, logger.LevelDebug, "wrong oidc token role, the mapped user is an SFTPGo admin")
 			setFlashMessage(w, r, "Wrong OpenID role, the logged in user is an SFTPGo admin")
 			doRedirect()
 			doLogout(rawIDToken)
@@ -666,7 +690,7 @@ func (s *httpdServer) handleOIDCRedirect(w http.ResponseWriter, r *http.Request)
 	}
 	err = token.getUser(r)
 	if err != nil {
-		logger.Debug(logSender, "", "unable to get the sftpgo user associated with oidc token: %v", err)
+		logForRequest(r, logger.LevelDebug, "unable to get the sftpgo user associated with oidc token: %v", err)
 		setFlashMessage(w, r, "Unable to get the user associated with the OpenID token")
 		doRedirect()
 		doLogout(rawIDToken)
@@ -794,6 +794,81 @@ func TestValidateOIDCToken(t *testing.T) {
 	assert.Len(t, oidcMgr.tokens, 0)
 }
 
+func TestOIDCTokenSource(t *testing.T) {
+	oidcMgr, ok := oidcMgr.(*memoryOIDCManager)
+	require.True(t, ok)
+	server := getTestOIDCServer()
+	err := server.binding.OIDC.initialize()
+	assert.NoError(t, err)
+	server.binding.OIDC.oauth2Config = &mockOAuth2Config{
+		tokenSource: &mockTokenSource{
+			err: common.ErrGenericFailure,
+		},
+	}
+	r, err := http.NewRequest(http.MethodGet, webClientFilesPath, nil)
+	assert.NoError(t, err)
+
+	token := oidcToken{
+		Cookie:       xid.New().String(),
+		AccessToken:  xid.New().String(),
+		RefreshToken: xid.New().String(),
+		ExpiresAt:    util.GetTimeAsMsSinceEpoch(time.Now().Add(2 * time.Minute)),
+	}
+	source := server.binding.OIDC.getTokenSource(token.Cookie, r)
+	_, err = source()
+	assert.Error(t, err)
+	oidcMgr.addToken(token)
+
+	httpFsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token.AccessToken || r.Header.Get("X-API-KEY") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer httpFsServer.Close()
+
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: xid.New().String(),
+			HomeDir:  filepath.Join(os.TempDir(), "oidc_token_source"),
+		},
+		FsConfig: vfs.Filesystem{
+			Provider: sdk.HTTPFilesystemProvider,
+			HTTPConfig: vfs.HTTPFsConfig{
+				BaseHTTPFsConfig: sdk.BaseHTTPFsConfig{
+					Endpoint: httpFsServer.URL,
+				},
+				APIKey:       kms.NewPlainSecret("key"),
+				UseOIDCToken: true,
+			},
+		},
+	}
+	fs, err := user.GetFilesystem(xid.New().String())
+	if assert.NoError(t, err) {
+		_, err = fs.Stat("/file")
+		assert.ErrorIs(t, err, vfs.ErrOIDCTokenUnavailable)
+	}
+	user = dataprovider.User{
+		BaseUser: user.BaseUser,
+		FsConfig: user.FsConfig,
+	}
+	user.SetOIDCTokenSource(source)
+	fs, err = user.GetFilesystem(xid.New().String())
+	if assert.NoError(t, err) {
+		_, err = fs.Stat("/file")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+	// the expired token is refreshed before each request
+	token.ExpiresAt = util.GetTimeAsMsSinceEpoch(time.Now().Add(-1 * time.Minute))
+	oidcMgr.addToken(token)
+	_, err = fs.Stat("/file")
+	assert.ErrorIs(t, err, common.ErrGenericFailure)
+
+	oidcMgr.removeToken(token.Cookie)
+	assert.Len(t, oidcMgr.tokens, 0)
+}
+
 func TestSkipOIDCAuth(t *testing.T) {
 	server := getTestOIDCServer()
 	err := server.binding.OIDC.initialize()
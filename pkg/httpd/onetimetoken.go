@@ -0,0 +1,343 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-chi/render"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	claimPathKey             = "path"
+	claimIssuedByKey         = "issued_by"
+	defaultOneTimeTokenLife  = time.Hour
+	maxOneTimeTokenLife      = 7 * 24 * time.Hour
+	oneTimeTokenQueryParam   = "token"
+	errOneTimeTokenNotUsable = "The token is invalid, expired or already used"
+)
+
+var oneTimeTokensMgr oneTimeTokenManager
+
+type oneTimeTokenManager interface {
+	Add(token *oneTimeToken) error
+	Get(id string) (*oneTimeToken, error)
+	// Consume removes and returns the token with the specified ID.
+	// It fails if the token was already consumed
+	Consume(id string) (*oneTimeToken, error)
+	Cleanup()
+}
+
+func newOneTimeTokenManager(isShared int) oneTimeTokenManager {
+	if isShared == 1 {
+		logger.Info(logSender, "", "using provider one-time token manager")
+		return &dbOneTimeTokenManager{}
+	}
+	logger.Info(logSender, "", "using memory one-time token manager")
+	return &memoryOneTimeTokenManager{}
+}
+
+// oneTimeToken defines a not yet used one-time download token
+type oneTimeToken struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Path      string    `json:"path"`
+	IssuedBy  string    `json:"issued_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (t *oneTimeToken) isExpired() bool {
+	return t.ExpiresAt.Before(time.Now().UTC())
+}
+
+type memoryOneTimeTokenManager struct {
+	tokens sync.Map
+}
+
+func (m *memoryOneTimeTokenManager) Add(token *oneTimeToken) error {
+	m.tokens.Store(token.ID, token)
+	return nil
+}
+
+func (m *memoryOneTimeTokenManager) Get(id string) (*oneTimeToken, error) {
+	t, ok := m.tokens.Load(id)
+	if !ok {
+		return nil, util.NewRecordNotFoundError("one-time token not found")
+	}
+	return t.(*oneTimeToken), nil
+}
+
+func (m *memoryOneTimeTokenManager) Consume(id string) (*oneTimeToken, error) {
+	t, ok := m.tokens.LoadAndDelete(id)
+	if !ok {
+		return nil, util.NewRecordNotFoundError("one-time token not found")
+	}
+	return t.(*oneTimeToken), nil
+}
+
+func (m *memoryOneTimeTokenManager) Cleanup() {
+	m.tokens.Range(func(key, value any) bool {
+		t, ok := value.(*oneTimeToken)
+		if !ok || t.isExpired() {
+			m.tokens.Delete(key)
+		}
+		return true
+	})
+}
+
+type dbOneTimeTokenManager struct{}
+
+func (m *dbOneTimeTokenManager) Add(token *oneTimeToken) error {
+	session := dataprovider.Session{
+		Key:       token.ID,
+		Data:      token,
+		Type:      dataprovider.SessionTypeOneTimeToken,
+		Timestamp: util.GetTimeAsMsSinceEpoch(token.ExpiresAt),
+	}
+	return dataprovider.AddSharedSession(session)
+}
+
+func (m *dbOneTimeTokenManager) Get(id string) (*oneTimeToken, error) {
+	session, err := dataprovider.GetSharedSession(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.decodeData(session.Data)
+}
+
+func (m *dbOneTimeTokenManager) Consume(id string) (*oneTimeToken, error) {
+	token, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	// the delete only succeeds for the first request, concurrent
+	// requests for the same token will fail here
+	if err := dataprovider.DeleteSharedSession(id); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (m *dbOneTimeTokenManager) decodeData(data any) (*oneTimeToken, error) {
+	if val, ok := data.([]byte); ok {
+		t := &oneTimeToken{}
+		err := json.Unmarshal(val, t)
+		return t, err
+	}
+	logger.Error(logSender, "", "invalid one-time token data type %T", data)
+	return nil, util.NewRecordNotFoundError("invalid one-time token")
+}
+
+func (m *dbOneTimeTokenManager) Cleanup() {
+	dataprovider.CleanupSharedSessions(dataprovider.SessionTypeOneTimeToken, time.Now()) //nolint:errcheck
+}
+
+type oneTimeTokenRequest struct {
+	Path             string `json:"path"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
+}
+
+func (s *httpdServer) generateOneTimeToken(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	var req oneTimeTokenRequest
+	if err = render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		sendAPIResponse(w, r, errors.New("please set a path"), "", http.StatusBadRequest)
+		return
+	}
+	duration := defaultOneTimeTokenLife
+	if req.ExpiresInSeconds < 0 {
+		sendAPIResponse(w, r, nil, "Invalid expiration", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInSeconds > 0 {
+		duration = time.Duration(req.ExpiresInSeconds) * time.Second
+		if duration > maxOneTimeTokenLife {
+			sendAPIResponse(w, r, nil, fmt.Sprintf("The maximum allowed expiration is %d seconds",
+				int64(maxOneTimeTokenLife/time.Second)), http.StatusBadRequest)
+			return
+		}
+	}
+	connection, err := getUserConnectionForAdmin(w, r)
+	if err != nil {
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	name := connection.User.GetCleanedPath(req.Path)
+	info, err := connection.Stat(name, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to stat the requested path", getMappedStatusCode(err))
+		return
+	}
+	if !info.Mode().IsRegular() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a regular file", name), http.StatusBadRequest)
+		return
+	}
+	token := &oneTimeToken{
+		ID:        xid.New().String(),
+		Username:  connection.User.Username,
+		Path:      name,
+		IssuedBy:  claims.Username,
+		ExpiresAt: time.Now().Add(duration).UTC(),
+	}
+	tokenClaims := map[string]any{
+		jwt.JwtIDKey:      token.ID,
+		jwt.AudienceKey:   []string{tokenAudienceOneTimeDownload},
+		jwt.NotBeforeKey:  time.Now().UTC().Add(-30 * time.Second),
+		jwt.ExpirationKey: token.ExpiresAt,
+		claimUsernameKey:  token.Username,
+		claimPathKey:      token.Path,
+		claimIssuedByKey:  token.IssuedBy,
+	}
+	_, tokenString, err := s.tokenAuth.Encode(tokenClaims)
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to create the token", http.StatusInternalServerError)
+		return
+	}
+	if err := oneTimeTokensMgr.Add(token); err != nil {
+		sendAPIResponse(w, r, err, "Unable to save the token", getRespStatus(err))
+		return
+	}
+	connection.Log(logger.LevelInfo, "admin %q generated a one-time download token for file %q, id: %q, expires at: %v",
+		claims.Username, name, token.ID, token.ExpiresAt)
+	render.JSON(w, r, map[string]any{
+		"token":      tokenString,
+		"expires_at": token.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (s *httpdServer) downloadWithOneTimeToken(w http.ResponseWriter, r *http.Request) {
+	// a partial download would consume the token, so range requests are not allowed
+	if r.Header.Get("Range") != "" {
+		sendAPIResponse(w, r, nil, "Range requests are not supported for one-time downloads", http.StatusBadRequest)
+		return
+	}
+	token, err := s.checkOneTimeToken(r)
+	if err != nil {
+		logger.Debug(logSender, "", "invalid one-time download token from ip %q: %v",
+			util.GetIPFromRemoteAddress(r.RemoteAddr), err)
+		sendAPIResponse(w, r, err, errOneTimeTokenNotUsable, http.StatusForbidden)
+		return
+	}
+	user, err := dataprovider.GetUserWithGroupSettings(token.Username)
+	if err != nil {
+		sendAPIResponse(w, r, err, errOneTimeTokenNotUsable, http.StatusForbidden)
+		return
+	}
+	if err := user.CheckLoginConditions(); err != nil {
+		sendAPIResponse(w, r, err, errOneTimeTokenNotUsable, http.StatusForbidden)
+		return
+	}
+	if util.Contains(user.Filters.DeniedProtocols, common.ProtocolHTTP) {
+		sendAPIResponse(w, r, nil, "Protocol HTTP is not allowed", http.StatusForbidden)
+		return
+	}
+	connection := newConnection(common.NewBaseConnection(xid.New().String(), common.ProtocolHTTP,
+		util.GetHTTPLocalAddress(r), r.RemoteAddr, user), r)
+	if err = common.Connections.Add(connection); err != nil {
+		sendAPIResponse(w, r, err, "Unable to add connection", http.StatusServiceUnavailable)
+		return
+	}
+	defer common.Connections.Remove(connection.GetID())
+
+	info, err := connection.Stat(token.Path, 1)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getMappedStatusCode(err))
+		return
+	}
+	if !info.Mode().IsRegular() {
+		sendAPIResponse(w, r, nil, fmt.Sprintf("%q is not a regular file", token.Path), http.StatusBadRequest)
+		return
+	}
+	isHead := r.Method == http.MethodHead
+	if !isHead {
+		if _, err := oneTimeTokensMgr.Consume(token.ID); err != nil {
+			sendAPIResponse(w, r, err, errOneTimeTokenNotUsable, http.StatusForbidden)
+			return
+		}
+		connection.Log(logger.LevelInfo, "one-time download for file %q started, token id: %q, issued by admin %q, ip: %q",
+			token.Path, token.ID, token.IssuedBy, connection.GetRemoteIP())
+	}
+	if status, err := downloadFile(w, r, connection, token.Path, info, false, nil); err != nil {
+		if !isHead {
+			// nothing was sent, the token can be used again
+			if errAdd := oneTimeTokensMgr.Add(token); errAdd != nil {
+				connection.Log(logger.LevelError, "unable to restore one-time token %q: %v", token.ID, errAdd)
+			}
+		}
+		resp := apiResponse{
+			Error:   err.Error(),
+			Message: http.StatusText(status),
+		}
+		ctx := r.Context()
+		if status != 0 {
+			ctx = context.WithValue(ctx, render.StatusCtxKey, status)
+		}
+		render.JSON(w, r.WithContext(ctx), resp)
+	}
+}
+
+// checkOneTimeToken validates the signature, the expiration and the audience for the
+// token in the request and returns the related not yet used one-time token
+func (s *httpdServer) checkOneTimeToken(r *http.Request) (*oneTimeToken, error) {
+	tokenString := r.URL.Query().Get(oneTimeTokenQueryParam)
+	if tokenString == "" {
+		return nil, errors.New("no token provided")
+	}
+	token, err := jwtauth.VerifyToken(s.tokenAuth, tokenString)
+	if err != nil || token == nil {
+		return nil, fmt.Errorf("unable to verify token: %v", err)
+	}
+	if !util.Contains(token.Audience(), tokenAudienceOneTimeDownload) {
+		return nil, errors.New("invalid token audience")
+	}
+	t, err := oneTimeTokensMgr.Get(token.JwtID())
+	if err != nil {
+		return nil, err
+	}
+	if t.isExpired() {
+		return nil, errors.New("token expired")
+	}
+	claims := token.PrivateClaims()
+	if username, _ := claims[claimUsernameKey].(string); username != t.Username {
+		return nil, errors.New("token username mismatch")
+	}
+	if name, _ := claims[claimPathKey].(string); name != t.Path {
+		return nil, errors.New("token path mismatch")
+	}
+	return t, nil
+}
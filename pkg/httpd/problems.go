@@ -0,0 +1,177 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/plugin"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const problemContentType = "application/problem+json; charset=utf-8"
+
+// Problem types returned in error responses
+const (
+	ProblemTypeInvalidRequest     = "urn:sftpgo:problem:invalid-request"
+	ProblemTypeUnauthorized       = "urn:sftpgo:problem:unauthorized"
+	ProblemTypeInvalidCredentials = "urn:sftpgo:problem:invalid-credentials"
+	ProblemTypePermissionDenied   = "urn:sftpgo:problem:permission-denied"
+	ProblemTypeMethodDisabled     = "urn:sftpgo:problem:method-disabled"
+	ProblemTypeNotFound           = "urn:sftpgo:problem:not-found"
+	ProblemTypeConflict           = "urn:sftpgo:problem:conflict"
+	ProblemTypeQuotaExceeded      = "urn:sftpgo:problem:quota-exceeded"
+	ProblemTypeTooManyRequests    = "urn:sftpgo:problem:too-many-requests"
+	ProblemTypeNotImplemented     = "urn:sftpgo:problem:not-implemented"
+	ProblemTypeInternalError      = "urn:sftpgo:problem:internal-error"
+	// ProblemTypeGeneric is used if there is no more specific type,
+	// as defined in RFC 7807
+	ProblemTypeGeneric = "about:blank"
+)
+
+// ProblemDetails defines an error response as described in RFC 7807
+type ProblemDetails struct {
+	// URI reference that identifies the problem type
+	Type string `json:"type"`
+	// Short summary of the problem type
+	Title string `json:"title"`
+	// HTTP status code
+	Status int `json:"status"`
+	// Explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// URI reference that identifies this occurrence of the problem,
+	// the request path
+	Instance string `json:"instance,omitempty"`
+}
+
+// problemResponse includes the legacy error and message fields,
+// so existing clients continue to work
+type problemResponse struct {
+	ProblemDetails
+	apiResponse
+	// Failed criteria if a password does not satisfy the password policy
+	PasswordPolicyViolations []dataprovider.PasswordPolicyViolation `json:"password_policy_violations,omitempty"`
+}
+
+// getErrorProblem returns the HTTP status code and the problem type for the given error.
+// An empty problem type means that the error has no specific type
+func getErrorProblem(err error) (int, string) {
+	if _, ok := err.(*util.ValidationError); ok {
+		return http.StatusBadRequest, ProblemTypeInvalidRequest
+	}
+	if _, ok := err.(*dataprovider.PasswordPolicyError); ok {
+		return http.StatusBadRequest, ProblemTypeInvalidRequest
+	}
+	if _, ok := err.(*util.MethodDisabledError); ok {
+		return http.StatusForbidden, ProblemTypeMethodDisabled
+	}
+	if _, ok := err.(*util.RecordNotFoundError); ok {
+		return http.StatusNotFound, ProblemTypeNotFound
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return http.StatusBadRequest, ProblemTypeNotFound
+	}
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, dataprovider.ErrLoginNotAllowedFromIP) {
+		return http.StatusForbidden, ProblemTypePermissionDenied
+	}
+	if errors.Is(err, plugin.ErrNoSearcher) || errors.Is(err, dataprovider.ErrNotImplemented) {
+		return http.StatusNotImplemented, ProblemTypeNotImplemented
+	}
+	if errors.Is(err, common.ErrQuotaExceeded) || errors.Is(err, common.ErrReadQuotaExceeded) {
+		return http.StatusInternalServerError, ProblemTypeQuotaExceeded
+	}
+	if errors.Is(err, dataprovider.ErrInvalidCredentials) {
+		return http.StatusInternalServerError, ProblemTypeInvalidCredentials
+	}
+	return http.StatusInternalServerError, ""
+}
+
+func getStatusProblemType(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return ProblemTypeInvalidRequest
+	case http.StatusUnauthorized:
+		return ProblemTypeUnauthorized
+	case http.StatusForbidden:
+		return ProblemTypePermissionDenied
+	case http.StatusNotFound:
+		return ProblemTypeNotFound
+	case http.StatusConflict:
+		return ProblemTypeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ProblemTypeQuotaExceeded
+	case http.StatusTooManyRequests:
+		return ProblemTypeTooManyRequests
+	case http.StatusNotImplemented:
+		return ProblemTypeNotImplemented
+	case http.StatusInternalServerError:
+		return ProblemTypeInternalError
+	default:
+		return ProblemTypeGeneric
+	}
+}
+
+func getProblemDetails(r *http.Request, err error, detail string, code int) ProblemDetails {
+	problemType := ""
+	if err != nil {
+		_, problemType = getErrorProblem(err)
+	}
+	if problemType == "" {
+		problemType = getStatusProblemType(code)
+	}
+	return ProblemDetails{
+		Type:     problemType,
+		Title:    http.StatusText(code),
+		Status:   code,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+}
+
+func sendProblemResponse(w http.ResponseWriter, r *http.Request, err error, resp apiResponse, code int) {
+	detail := resp.Error
+	// the problem details include the error without the type prefix,
+	// the problem type already identifies the error category
+	switch e := err.(type) {
+	case *util.ValidationError:
+		detail = e.GetErrorString()
+	case *util.MethodDisabledError:
+		detail = e.GetErrorString()
+	}
+	if detail == "" {
+		detail = resp.Message
+	}
+	problem := problemResponse{
+		ProblemDetails: getProblemDetails(r, err, detail, code),
+		apiResponse:    resp,
+	}
+	var policyErr *dataprovider.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		problem.PasswordPolicyViolations = policyErr.Violations
+	}
+	data, errMarshal := json.Marshal(problem)
+	if errMarshal != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(code)
+	w.Write(data) //nolint:errcheck
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Default request size limits, as bytes
+const (
+	DefaultRequestSizeLimit        = 1048576  // 1 MB
+	DefaultUserBulkImportSizeLimit = 10485760 // 10 MB
+	DefaultFileUploadMetaSizeLimit = 10485760 // 10 MB
+	DefaultAdminConfigSizeLimit    = 1048576  // 1 MB
+)
+
+// endpoint categories for the request size limits
+const (
+	requestSizeDefault = iota
+	requestSizeUserBulkImport
+	requestSizeAdminConfig
+	// file uploads are limited by the max upload file size, if any
+	requestSizeFileUpload
+)
+
+var (
+	requestBodyKey      = &contextKey{"request body"}
+	requestSizeLimitKey = &contextKey{"request size limit"}
+	requestSizeLimits   = RequestSizeLimits{
+		Default:        DefaultRequestSizeLimit,
+		UserBulkImport: DefaultUserBulkImportSizeLimit,
+		FileUploadMeta: DefaultFileUploadMetaSizeLimit,
+		AdminConfig:    DefaultAdminConfigSizeLimit,
+	}
+)
+
+// RequestSizeLimits defines the maximum request body size, as bytes,
+// for the different endpoint categories. 0 means the default limit
+type RequestSizeLimits struct {
+	// Limit for the requests not included in any of the following categories
+	Default int64 `json:"default" mapstructure:"default"`
+	// Limit for the bulk import requests: data restore and users/folders templates
+	UserBulkImport int64 `json:"user_bulk_import" mapstructure:"user_bulk_import"`
+	// Limit for the form fields, other than the files, of the multipart uploads.
+	// The uploaded files are limited by max_upload_file_size
+	FileUploadMeta int64 `json:"file_upload_meta" mapstructure:"file_upload_meta"`
+	// Limit for the requests that add or update users, groups, folders, admins,
+	// API keys, event actions and event rules
+	AdminConfig int64 `json:"admin_config" mapstructure:"admin_config"`
+}
+
+func (l *RequestSizeLimits) validate() error {
+	if l.Default < 0 || l.UserBulkImport < 0 || l.FileUploadMeta < 0 || l.AdminConfig < 0 {
+		return fmt.Errorf("invalid request size limits: %+v", *l)
+	}
+	if l.Default == 0 {
+		l.Default = DefaultRequestSizeLimit
+	}
+	if l.UserBulkImport == 0 {
+		l.UserBulkImport = DefaultUserBulkImportSizeLimit
+	}
+	if l.FileUploadMeta == 0 {
+		l.FileUploadMeta = DefaultFileUploadMetaSizeLimit
+	}
+	if l.AdminConfig == 0 {
+		l.AdminConfig = DefaultAdminConfigSizeLimit
+	}
+	return nil
+}
+
+// getLimit returns the limit for the specified category, 0 means no limit
+func (l *RequestSizeLimits) getLimit(category int) int64 {
+	switch category {
+	case requestSizeUserBulkImport:
+		return l.UserBulkImport
+	case requestSizeAdminConfig:
+		return l.AdminConfig
+	case requestSizeFileUpload:
+		return 0
+	default:
+		return l.Default
+	}
+}
+
+// limitRequestSize returns a middleware that limits the request body size based on
+// the endpoint category. It can be applied to a router and then to specific routes,
+// the limit defined by the innermost middleware wins
+func limitRequestSize(category int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			body, ok := ctx.Value(requestBodyKey).(io.ReadCloser)
+			if !ok {
+				body = r.Body
+				ctx = context.WithValue(ctx, requestBodyKey, body)
+			}
+			limit := requestSizeLimits.getLimit(category)
+			ctx = context.WithValue(ctx, requestSizeLimitKey, limit)
+			r = r.WithContext(ctx)
+			if limit > 0 && body != nil {
+				r.Body = http.MaxBytesReader(w, body, limit)
+			} else {
+				r.Body = body
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// getRequestSizeLimit returns the request size limit applied to the specified
+// request, it can be used as max memory for multipart forms
+func getRequestSizeLimit(r *http.Request) int64 {
+	if limit, ok := r.Context().Value(requestSizeLimitKey).(int64); ok && limit > 0 {
+		return limit
+	}
+	return requestSizeLimits.Default
+}
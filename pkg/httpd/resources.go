@@ -26,3 +26,11 @@ import (
 func serveStaticDir(router chi.Router, path, fsDirPath string) {
 	fileServer(router, path, http.Dir(fsDirPath))
 }
+
+func getStaticFs(fsDirPath string) http.FileSystem {
+	return http.Dir(fsDirPath)
+}
+
+func getOpenAPIFs(fsDirPath string) http.FileSystem {
+	return http.Dir(fsDirPath)
+}
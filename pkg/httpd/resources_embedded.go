@@ -18,6 +18,8 @@
 package httpd
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 
 	"github.com/drakkan/sftpgo/v2/pkg/bundle"
@@ -31,3 +33,11 @@ func serveStaticDir(router chi.Router, path, _ string) {
 		fileServer(router, path, bundle.GetOpenAPIFs())
 	}
 }
+
+func getStaticFs(_ string) http.FileSystem {
+	return bundle.GetStaticFs()
+}
+
+func getOpenAPIFs(_ string) http.FileSystem {
+	return bundle.GetOpenAPIFs()
+}
@@ -24,6 +24,7 @@ import (
 	"net"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,13 +33,13 @@ import (
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
 	"github.com/lestrrat-go/jwx/v2/jwa"
-	"github.com/rs/cors"
 	"github.com/rs/xid"
 	"github.com/sftpgo/sdk"
 	"github.com/unrolled/secure"
 
 	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/mfa"
 	"github.com/drakkan/sftpgo/v2/pkg/smtp"
@@ -48,6 +49,7 @@ import (
 
 var (
 	compressor      = middleware.NewCompressor(5)
+	statsCompressor = middleware.NewCompressor(5, "text/csv", "application/x-ndjson")
 	xForwardedProto = http.CanonicalHeaderKey("X-Forwarded-Proto")
 )
 
@@ -64,6 +66,7 @@ type httpdServer struct {
 	tokenAuth         *jwtauth.JWTAuth
 	signingPassphrase string
 	cors              CorsConfig
+	pushManifest      http2PushManifest
 }
 
 func newHttpdServer(b Binding, staticFilesPath, signingPassphrase string, cors CorsConfig,
@@ -106,7 +109,7 @@ func (s *httpdServer) listenAndServe() error {
 			certID = s.binding.GetAddress()
 		}
 		config := &tls.Config{
-			GetCertificate:           certMgr.GetCertificateFunc(certID),
+			GetCertificate:           s.getCertificateFunc(certID),
 			MinVersion:               util.GetTLSVersion(s.binding.MinTLSVersion),
 			NextProtos:               []string{"http/1.1", "h2"},
 			CipherSuites:             util.GetTLSCiphersFromNames(s.binding.TLSCipherSuites),
@@ -125,6 +128,45 @@ func (s *httpdServer) listenAndServe() error {
 	return util.HTTPListenAndServe(httpServer, s.binding.Address, s.binding.Port, false, logSender)
 }
 
+// getCertificateFunc returns a function that selects the certificate of the
+// virtual host matching the SNI server name, or the binding certificate if none matches
+func (s *httpdServer) getCertificateFunc(certID string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	defaultFn := certMgr.GetCertificateFunc(certID)
+	if len(s.binding.VirtualHosts) == 0 {
+		return defaultFn
+	}
+	return func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if vhost := s.binding.getVirtualHost(info.ServerName); vhost != nil {
+			return certMgr.GetCertificateFunc(vhost.getCertID(s.binding.GetAddress()))(info)
+		}
+		return defaultFn(info)
+	}
+}
+
+// checkVirtualHost rejects requests whose Host header does not belong to the
+// virtual host negotiated using SNI, so a TLS session established for a domain
+// cannot be used to reach another one
+func (s *httpdServer) checkVirtualHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.TLS.ServerName != "" {
+			if s.binding.getVirtualHost(r.TLS.ServerName) != s.binding.getVirtualHost(r.Host) {
+				s.sendForbiddenResponse(w, r, fmt.Sprintf("The host %q does not match the TLS server name %q",
+					r.Host, r.TLS.ServerName))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getWebLandingPath returns the page to redirect to for requests to the web root
+func (s *httpdServer) getWebLandingPath(r *http.Request, defaultPath string) string {
+	if vhost := s.binding.getVirtualHost(r.Host); vhost != nil && vhost.BasePath != "" {
+		return vhost.BasePath
+	}
+	return defaultPath
+}
+
 func (s *httpdServer) verifyTLSConnection(state tls.ConnectionState) error {
 	if certMgr != nil {
 		var clientCrt *x509.Certificate
@@ -192,7 +234,6 @@ func (s *httpdServer) handleWebClientLogout(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *httpdServer) handleWebClientChangePwdPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	err := r.ParseForm()
 	if err != nil {
 		s.renderClientChangePasswordPage(w, r, err.Error())
@@ -252,6 +293,10 @@ func (s *httpdServer) handleWebClientLoginPost(w http.ResponseWriter, r *http.Re
 	user, err := dataprovider.CheckUserAndPass(username, password, ipAddr, protocol)
 	if err != nil {
 		updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, err)
+		if errors.As(err, new(*dataprovider.LoginCooldownError)) {
+			s.renderClientLoginPage(w, err.Error(), ipAddr)
+			return
+		}
 		s.renderClientLoginPage(w, dataprovider.ErrInvalidCredentials.Error(), ipAddr)
 		return
 	}
@@ -351,7 +396,7 @@ func (s *httpdServer) handleWebClientTwoFactorRecoveryPost(w http.ResponseWriter
 			user.Filters.RecoveryCodes[idx].Used = true
 			err = dataprovider.UpdateUser(&user, dataprovider.ActionExecutorSelf, ipAddr)
 			if err != nil {
-				logger.Warn(logSender, "", "unable to set the recovery code %#v as used: %v", recoveryCode, err)
+				logForRequest(r, logger.LevelWarn, "unable to set the recovery code %#v as used: %v", recoveryCode, err)
 				s.renderClientInternalServerErrorPage(w, r, errors.New("unable to set the recovery code as used"))
 				return
 			}
@@ -455,7 +500,7 @@ func (s *httpdServer) handleWebAdminTwoFactorRecoveryPost(w http.ResponseWriter,
 			admin.Filters.RecoveryCodes[idx].Used = true
 			err = dataprovider.UpdateAdmin(&admin, dataprovider.ActionExecutorSelf, ipAddr)
 			if err != nil {
-				logger.Warn(logSender, "", "unable to set the recovery code %#v as used: %v", recoveryCode, err)
+				logForRequest(r, logger.LevelWarn, "unable to set the recovery code %#v as used: %v", recoveryCode, err)
 				s.renderInternalServerErrorPage(w, r, errors.New("unable to set the recovery code as used"))
 				return
 			}
@@ -570,7 +615,6 @@ func (s *httpdServer) handleWebAdminLogin(w http.ResponseWriter, r *http.Request
 }
 
 func (s *httpdServer) handleWebAdminLogout(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	c := jwtTokenClaims{}
 	c.removeCookie(w, r, webBaseAdminPath)
 	s.logoutOIDCUser(w, r)
@@ -579,7 +623,6 @@ func (s *httpdServer) handleWebAdminLogout(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleWebAdminChangePwdPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	err := r.ParseForm()
 	if err != nil {
 		s.renderChangePasswordPage(w, r, err.Error())
@@ -613,7 +656,8 @@ func (s *httpdServer) handleWebAdminPasswordResetPost(w http.ResponseWriter, r *
 	}
 	admin, _, err := handleResetPassword(r, r.Form.Get("code"), r.Form.Get("password"), true)
 	if err != nil {
-		if e, ok := err.(*util.ValidationError); ok {
+		var e *util.ValidationError
+		if errors.As(err, &e) {
 			s.renderResetPwdPage(w, e.GetErrorString(), ipAddr)
 			return
 		}
@@ -730,7 +774,7 @@ func (s *httpdServer) loginAdmin(
 
 	err := c.createAndSetCookie(w, r, s.tokenAuth, audience, ipAddr)
 	if err != nil {
-		logger.Warn(logSender, "", "unable to set admin login cookie %v", err)
+		logForRequest(r, logger.LevelWarn, "unable to set admin login cookie %v", err)
 		if errorFunc == nil {
 			s.renderAdminSetupPage(w, r, admin.Username, err.Error())
 			return
@@ -752,6 +796,9 @@ func (s *httpdServer) loginAdmin(
 func (s *httpdServer) logout(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxLoginBodySize)
 	invalidateToken(r)
+	if claims, err := getTokenClaims(r); err == nil && claims.SessionID != "" {
+		userSessionsMgr.Revoke(claims.Username, claims.SessionID) //nolint:errcheck
+	}
 	sendAPIResponse(w, r, nil, "Your token has been invalidated", http.StatusOK)
 }
 
@@ -780,8 +827,14 @@ func (s *httpdServer) getUserToken(w http.ResponseWriter, r *http.Request) {
 	}
 	user, err := dataprovider.CheckUserAndPass(username, password, ipAddr, protocol)
 	if err != nil {
-		w.Header().Set(common.HTTPAuthenticationHeader, basicRealm)
 		updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, err)
+		var cooldownErr *dataprovider.LoginCooldownError
+		if errors.As(err, &cooldownErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(cooldownErr.GetRetryAfterSeconds()))
+			sendAPIResponse(w, r, err, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set(common.HTTPAuthenticationHeader, basicRealm)
 		sendAPIResponse(w, r, dataprovider.ErrInvalidCredentials, http.StatusText(http.StatusUnauthorized),
 			http.StatusUnauthorized)
 		return
@@ -789,14 +842,18 @@ func (s *httpdServer) getUserToken(w http.ResponseWriter, r *http.Request) {
 	connectionID := fmt.Sprintf("%v_%v", protocol, xid.New().String())
 	if err := checkHTTPClientUser(&user, r, connectionID, true); err != nil {
 		updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, err)
-		sendAPIResponse(w, r, err, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		statusCode := http.StatusForbidden
+		if errors.Is(err, common.ErrTooManySessions) {
+			statusCode = http.StatusServiceUnavailable
+		}
+		sendAPIResponse(w, r, err, http.StatusText(statusCode), statusCode)
 		return
 	}
 
 	if user.Filters.TOTPConfig.Enabled && util.Contains(user.Filters.TOTPConfig.Protocols, common.ProtocolHTTP) {
 		passcode := r.Header.Get(otpHeaderCode)
 		if passcode == "" {
-			logger.Debug(logSender, "", "TOTP enabled for user %#v and not passcode provided, authentication refused", user.Username)
+			logForRequest(r, logger.LevelDebug, "TOTP enabled for user %#v and not passcode provided, authentication refused", user.Username)
 			w.Header().Set(common.HTTPAuthenticationHeader, basicRealm)
 			updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, dataprovider.ErrInvalidCredentials)
 			sendAPIResponse(w, r, dataprovider.ErrInvalidCredentials, http.StatusText(http.StatusUnauthorized),
@@ -834,12 +891,14 @@ func (s *httpdServer) getUserToken(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *httpdServer) generateAndSendUserToken(w http.ResponseWriter, r *http.Request, ipAddr string, user dataprovider.User) {
+	session := newUserSession(r, user.Username, time.Now().Add(tokenDuration))
 	c := jwtTokenClaims{
 		Username:                   user.Username,
 		Permissions:                user.Filters.WebClient,
 		Signature:                  user.GetSignature(),
 		MustSetTwoFactorAuth:       user.MustSetSecondFactor(),
 		RequiredTwoFactorProtocols: user.Filters.TwoFactorAuthProtocols,
+		SessionID:                  session.ID,
 	}
 
 	resp, err := c.createTokenResponse(s.tokenAuth, tokenAudienceAPIUser, ipAddr)
@@ -849,12 +908,67 @@ func (s *httpdServer) generateAndSendUserToken(w http.ResponseWriter, r *http.Re
 		sendAPIResponse(w, r, err, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
+	if err := userSessionsMgr.Add(session, user.Filters.MaxActiveSessions); err != nil {
+		updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, common.ErrInternalFailure)
+		sendAPIResponse(w, r, err, "Unable to save the session", http.StatusInternalServerError)
+		return
+	}
 	updateLoginMetrics(&user, dataprovider.LoginMethodPassword, ipAddr, err)
 	dataprovider.UpdateLastLogin(&user)
 
 	render.JSON(w, r, resp)
 }
 
+func (s *httpdServer) impersonateUser(w http.ResponseWriter, r *http.Request) {
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		sendAPIResponse(w, r, err, "Invalid token claims", http.StatusBadRequest)
+		return
+	}
+	user, err := dataprovider.GetUserWithGroupSettings(getURLParam(r, "username"))
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	if !user.IsImpersonationAllowed() {
+		sendAPIResponse(w, r, nil, "Impersonation is not allowed for this user", http.StatusForbidden)
+		return
+	}
+	if user.Status != 1 {
+		sendAPIResponse(w, r, nil, "The user is disabled", http.StatusBadRequest)
+		return
+	}
+	connectionID := fmt.Sprintf("%v_%v", common.ProtocolHTTP, xid.New().String())
+	if err := checkHTTPClientUser(&user, r, connectionID, false); err != nil {
+		sendAPIResponse(w, r, err, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	defer user.CloseFs() //nolint:errcheck
+	if err := user.CheckFsRoot(connectionID); err != nil {
+		logger.Warn(logSender, connectionID, "unable to check fs root: %v", err)
+		sendAPIResponse(w, r, err, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
+	c := jwtTokenClaims{
+		Username:                   user.Username,
+		Permissions:                user.Filters.WebClient,
+		Signature:                  user.GetSignature(),
+		MustSetTwoFactorAuth:       user.MustSetSecondFactor(),
+		RequiredTwoFactorProtocols: user.Filters.TwoFactorAuthProtocols,
+		ImpersonatedBy:             claims.Username,
+	}
+	resp, err := c.createTokenResponse(s.tokenAuth, tokenAudienceAPIUser, ipAddr)
+	if err != nil {
+		sendAPIResponse(w, r, err, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logForRequest(r, logger.LevelInfo, "admin %q impersonated user %q from IP %q at %s, token expires at %v",
+		claims.Username, user.Username, ipAddr, time.Now().UTC().Format(time.RFC3339), resp["expires_at"])
+
+	render.JSON(w, r, resp)
+}
+
 func (s *httpdServer) getToken(w http.ResponseWriter, r *http.Request) {
 	username, password, ok := r.BasicAuth()
 	if !ok {
@@ -865,6 +979,10 @@ func (s *httpdServer) getToken(w http.ResponseWriter, r *http.Request) {
 	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
 	admin, err := dataprovider.CheckAdminAndPass(username, password, ipAddr)
 	if err != nil {
+		if errors.Is(err, dataprovider.ErrAdminLocked) {
+			sendAPIResponse(w, r, err, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
 		w.Header().Set(common.HTTPAuthenticationHeader, basicRealm)
 		sendAPIResponse(w, r, err, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
@@ -872,7 +990,7 @@ func (s *httpdServer) getToken(w http.ResponseWriter, r *http.Request) {
 	if admin.Filters.TOTPConfig.Enabled {
 		passcode := r.Header.Get(otpHeaderCode)
 		if passcode == "" {
-			logger.Debug(logSender, "", "TOTP enabled for admin %#v and not passcode provided, authentication refused", admin.Username)
+			logForRequest(r, logger.LevelDebug, "TOTP enabled for admin %#v and not passcode provided, authentication refused", admin.Username)
 			w.Header().Set(common.HTTPAuthenticationHeader, basicRealm)
 			sendAPIResponse(w, r, dataprovider.ErrInvalidCredentials, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
@@ -944,16 +1062,16 @@ func (s *httpdServer) refreshClientToken(w http.ResponseWriter, r *http.Request,
 		return
 	}
 	if user.GetSignature() != tokenClaims.Signature {
-		logger.Debug(logSender, "", "signature mismatch for user %#v, unable to refresh cookie", user.Username)
+		logForRequest(r, logger.LevelDebug, "signature mismatch for user %#v, unable to refresh cookie", user.Username)
 		return
 	}
 	if err := checkHTTPClientUser(&user, r, xid.New().String(), true); err != nil {
-		logger.Debug(logSender, "", "unable to refresh cookie for user %#v: %v", user.Username, err)
+		logForRequest(r, logger.LevelDebug, "unable to refresh cookie for user %#v: %v", user.Username, err)
 		return
 	}
 
 	tokenClaims.Permissions = user.Filters.WebClient
-	logger.Debug(logSender, "", "cookie refreshed for user %#v", user.Username)
+	logForRequest(r, logger.LevelDebug, "cookie refreshed for user %#v", user.Username)
 	tokenClaims.createAndSetCookie(w, r, s.tokenAuth, tokenAudienceWebClient, util.GetIPFromRemoteAddress(r.RemoteAddr)) //nolint:errcheck
 }
 
@@ -963,21 +1081,21 @@ func (s *httpdServer) refreshAdminToken(w http.ResponseWriter, r *http.Request,
 		return
 	}
 	if admin.Status != 1 {
-		logger.Debug(logSender, "", "admin %#v is disabled, unable to refresh cookie", admin.Username)
+		logForRequest(r, logger.LevelDebug, "admin %#v is disabled, unable to refresh cookie", admin.Username)
 		return
 	}
 	if admin.GetSignature() != tokenClaims.Signature {
-		logger.Debug(logSender, "", "signature mismatch for admin %#v, unable to refresh cookie", admin.Username)
+		logForRequest(r, logger.LevelDebug, "signature mismatch for admin %#v, unable to refresh cookie", admin.Username)
 		return
 	}
 	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
 	if !admin.CanLoginFromIP(ipAddr) {
-		logger.Debug(logSender, "", "admin %#v cannot login from %v, unable to refresh cookie", admin.Username, r.RemoteAddr)
+		logForRequest(r, logger.LevelDebug, "admin %#v cannot login from %v, unable to refresh cookie", admin.Username, r.RemoteAddr)
 		return
 	}
 	tokenClaims.Permissions = admin.Permissions
 	tokenClaims.HideUserPageSections = admin.Filters.Preferences.HideUserPageSections
-	logger.Debug(logSender, "", "cookie refreshed for admin %#v", admin.Username)
+	logForRequest(r, logger.LevelDebug, "cookie refreshed for admin %#v", admin.Username)
 	tokenClaims.createAndSetCookie(w, r, s.tokenAuth, tokenAudienceWebAdmin, ipAddr) //nolint:errcheck
 }
 
@@ -1007,7 +1125,8 @@ func (s *httpdServer) checkConnection(next http.Handler) http.Handler {
 		if isUnixSocket || ip != nil {
 			for _, allow := range s.binding.allowHeadersFrom {
 				if allow(ip) {
-					parsedIP := util.GetRealIP(r, s.binding.ClientIPProxyHeader, s.binding.ClientIPHeaderDepth)
+					parsedIP := util.GetClientIP(r, s.binding.ClientIPProxyHeader, s.binding.ClientIPHeaderDepth,
+						s.binding.getTrustedProxies())
 					if parsedIP != "" {
 						ipAddr = parsedIP
 						r.RemoteAddr = ipAddr
@@ -1032,6 +1151,10 @@ func (s *httpdServer) checkConnection(next http.Handler) http.Handler {
 
 		if err := common.Connections.IsNewConnectionAllowed(ipAddr); err != nil {
 			logger.Log(logger.LevelDebug, common.ProtocolHTTP, "", "connection not allowed from ip %q: %v", ipAddr, err)
+			if errors.Is(err, common.ErrShuttingDown) {
+				s.sendServiceUnavailableResponse(w, r, err)
+				return
+			}
 			s.sendForbiddenResponse(w, r, err.Error())
 			return
 		}
@@ -1066,6 +1189,21 @@ func (s *httpdServer) sendTooManyRequestResponse(w http.ResponseWriter, r *http.
 	sendAPIResponse(w, r, err, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 }
 
+func (s *httpdServer) sendServiceUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if (s.enableWebAdmin || s.enableWebClient) && isWebRequest(r) {
+		r = s.updateContextFromCookie(r)
+		if s.enableWebClient && (isWebClientRequest(r) || !s.enableWebAdmin) {
+			s.renderClientMessagePage(w, r, http.StatusText(http.StatusServiceUnavailable), "",
+				http.StatusServiceUnavailable, err, "")
+			return
+		}
+		s.renderMessagePage(w, r, http.StatusText(http.StatusServiceUnavailable), "", http.StatusServiceUnavailable,
+			err, "")
+		return
+	}
+	sendAPIResponse(w, r, err, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
 func (s *httpdServer) sendForbiddenResponse(w http.ResponseWriter, r *http.Request, message string) {
 	if (s.enableWebAdmin || s.enableWebClient) && isWebRequest(r) {
 		r = s.updateContextFromCookie(r)
@@ -1100,6 +1238,24 @@ func (s *httpdServer) redirectToWebPath(w http.ResponseWriter, r *http.Request,
 	}
 }
 
+// serveOpenAPISpec serves the OpenAPI schema for the REST API
+func (s *httpdServer) serveOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	f, err := getOpenAPIFs(s.openAPIPath).Open("openapi.yaml")
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
 func (s *httpdServer) isStaticFileURL(r *http.Request) bool {
 	var urlPath string
 	rctx := chi.RouteContext(r.Context())
@@ -1115,10 +1271,13 @@ func (s *httpdServer) initializeRouter() {
 	s.tokenAuth = jwtauth.New(jwa.HS256.String(), getSigningKey(s.signingPassphrase), nil)
 	s.router = chi.NewRouter()
 
-	s.router.Use(middleware.RequestID)
+	s.router.Use(requestIDMiddleware)
 	s.router.Use(s.checkConnection)
 	s.router.Use(logger.NewStructuredLogger(logger.GetLogger()))
 	s.router.Use(middleware.Recoverer)
+	if s.binding.SecurityHeaders.IsEnabled() {
+		s.router.Use(s.binding.SecurityHeaders.Handler)
+	}
 	if s.binding.Security.Enabled {
 		secureMiddleware := secure.New(secure.Options{
 			AllowedHosts:            s.binding.Security.AllowedHosts,
@@ -1141,25 +1300,32 @@ func (s *httpdServer) initializeRouter() {
 		s.router.Use(secureMiddleware.Handler)
 	}
 	if s.cors.Enabled {
-		c := cors.New(cors.Options{
-			AllowedOrigins:       util.RemoveDuplicates(s.cors.AllowedOrigins, true),
-			AllowedMethods:       util.RemoveDuplicates(s.cors.AllowedMethods, true),
-			AllowedHeaders:       util.RemoveDuplicates(s.cors.AllowedHeaders, true),
-			ExposedHeaders:       util.RemoveDuplicates(s.cors.ExposedHeaders, true),
-			MaxAge:               s.cors.MaxAge,
-			AllowCredentials:     s.cors.AllowCredentials,
-			OptionsPassthrough:   s.cors.OptionsPassthrough,
-			OptionsSuccessStatus: s.cors.OptionsSuccessStatus,
-			AllowPrivateNetwork:  s.cors.AllowPrivateNetwork,
-		})
-		s.router.Use(c.Handler)
+		if s.enableRESTAPI && s.cors.hasSharesPolicy() {
+			// public share downloads use their own policy
+			s.router.Use(middleware.Maybe(s.cors.getHandler(), func(r *http.Request) bool {
+				return !isShareDownloadRequest(r)
+			}))
+		} else {
+			s.router.Use(s.cors.getHandler())
+		}
+	}
+	if len(s.binding.VirtualHosts) > 0 {
+		s.router.Use(s.checkVirtualHost)
 	}
 	s.router.Use(middleware.GetHead)
 	// StripSlashes causes infinite redirects at the root path if used with http.FileServer
 	s.router.Use(middleware.Maybe(middleware.StripSlashes, s.isStaticFileURL))
+	// the default limit can be overridden for specific routes
+	s.router.Use(limitRequestSize(requestSizeDefault))
+	// HTTP/2 is only negotiated over TLS
+	if (s.enableWebAdmin || s.enableWebClient) && s.binding.EnableHTTPS && !disableHTTP2Push {
+		s.pushManifest = newHTTP2PushManifest(getStaticFs(s.staticFilesPath), s.binding.Branding)
+		if !s.pushManifest.isEmpty() {
+			s.router.Use(s.pushStaticAssets)
+		}
+	}
 
 	s.router.NotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 		if (s.enableWebAdmin || s.enableWebClient) && isWebRequest(r) {
 			r = s.updateContextFromCookie(r)
 			if s.enableWebClient && (isWebClientRequest(r) || !s.enableWebAdmin) {
@@ -1173,6 +1339,11 @@ func (s *httpdServer) initializeRouter() {
 	}))
 
 	s.router.Get(healthzPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := kms.CheckHealth(); err != nil {
+			render.Status(r, http.StatusServiceUnavailable)
+			render.PlainText(w, r, "KMS unavailable")
+			return
+		}
 		render.PlainText(w, r, "ok")
 	})
 
@@ -1182,11 +1353,28 @@ func (s *httpdServer) initializeRouter() {
 
 	if s.enableRESTAPI {
 		// share API exposed to external users
-		s.router.Get(sharesPath+"/{id}", s.downloadFromShare)
-		s.router.Post(sharesPath+"/{id}", s.uploadFilesToShare)
-		s.router.Post(sharesPath+"/{id}/{name}", s.uploadFileToShare)
-		s.router.With(compressor.Handler).Get(sharesPath+"/{id}/dirs", s.readBrowsableShareContents)
-		s.router.Get(sharesPath+"/{id}/files", s.downloadBrowsableSharedFile)
+		var sharesCors []func(http.Handler) http.Handler
+		if s.cors.hasSharesPolicy() {
+			sharesCors = append(sharesCors, s.cors.getSharesHandler())
+			for _, p := range []string{sharesPath + "/{id}", sharesPath + "/{id}/dirs", sharesPath + "/{id}/files"} {
+				s.router.With(sharesCors...).Options(p, func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNoContent)
+				})
+			}
+		}
+		s.router.With(sharesCors...).Get(sharesPath+"/{id}", s.downloadFromShare)
+		s.router.With(limitRequestSize(requestSizeFileUpload)).Post(sharesPath+"/{id}", s.uploadFilesToShare)
+		s.router.With(limitRequestSize(requestSizeFileUpload)).Post(sharesPath+"/{id}/{name}", s.uploadFileToShare)
+		s.router.With(sharesCors...).With(compressor.Handler).Get(sharesPath+"/{id}/dirs", s.readBrowsableShareContents)
+		s.router.With(sharesCors...).Get(sharesPath+"/{id}/files", s.downloadBrowsableSharedFile)
+		s.router.Get(publicDownloadPath, s.downloadWithOneTimeToken)
+		s.router.Post(gcsNotificationsPath, handleGCSNotification)
+		if s.renderOpenAPI {
+			s.router.With(compressor.Handler).Get(openAPISpecPath, s.serveOpenAPISpec)
+			s.router.Get(apiDocsPath, func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, webOpenAPIPath+"/", http.StatusFound)
+			})
+		}
 
 		s.router.Get(tokenPath, s.getToken)
 		s.router.Post(adminPath+"/{username}/forgot-password", forgotAdminPassword)
@@ -1197,11 +1385,11 @@ func (s *httpdServer) initializeRouter() {
 		s.router.Group(func(router chi.Router) {
 			router.Use(checkNodeToken(s.tokenAuth))
 			router.Use(checkAPIKeyAuth(s.tokenAuth, dataprovider.APIKeyScopeAdmin))
-			router.Use(jwtauth.Verify(s.tokenAuth, jwtauth.TokenFromHeader))
+			router.Use(checkOAuth2ResourceServerAuth(s.tokenAuth, dataprovider.APIKeyScopeAdmin))
+			router.Use(jwtauth.Verify(s.tokenAuth, jwtauth.TokenFromHeader, tokenFromStreamQuery))
 			router.Use(jwtAuthenticatorAPI)
 
 			router.Get(versionPath, func(w http.ResponseWriter, r *http.Request) {
-				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 				render.JSON(w, r, version.Get())
 			})
 
@@ -1219,36 +1407,113 @@ func (s *httpdServer) initializeRouter() {
 
 			router.With(s.checkPerm(dataprovider.PermAdminViewServerStatus)).
 				Get(serverStatusPath, func(w http.ResponseWriter, r *http.Request) {
-					r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 					render.JSON(w, r, getServicesStatus())
 				})
+			router.With(s.checkPerm(dataprovider.PermAdminViewServerStatus)).
+				Get(serverTLSCertificatesPath, func(w http.ResponseWriter, r *http.Request) {
+					render.JSON(w, r, getTLSCertificatesStatus())
+				})
 
 			router.With(s.checkPerm(dataprovider.PermAdminViewConnections)).Get(activeConnectionsPath, getActiveConnections)
+			router.With(s.checkPerm(dataprovider.PermAdminViewConnections)).
+				Get(activeConnectionsStreamPath, streamActiveConnections)
+			router.With(s.checkPerm(dataprovider.PermAdminAny)).Get(logsStreamPath, streamLogs)
+			router.With(s.checkPerm(dataprovider.PermAdminViewConnections)).
+				Get(activeSessionsPath+"/{username}", getUserActiveSessions)
 			router.With(s.checkPerm(dataprovider.PermAdminCloseConnections)).
 				Delete(activeConnectionsPath+"/{connectionID}", handleCloseConnection)
+			router.With(s.checkPerm(dataprovider.PermAdminManageCaches)).
+				Delete(dirListCachePath+"/{username}", invalidateDirListCache)
 			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans)).Get(quotasBasePath+"/users/scans", getUsersQuotaScans)
 			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans)).Post(quotasBasePath+"/users/{username}/scan", startUserQuotaScan)
+			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans)).Get(userPath+"/{username}/quota", getUserQuotaStats)
 			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans)).Get(quotasBasePath+"/folders/scans", getFoldersQuotaScans)
 			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans)).Post(quotasBasePath+"/folders/{name}/scan", startFolderQuotaScan)
 			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(userPath, getUsers)
-			router.With(s.checkPerm(dataprovider.PermAdminAddUsers)).Post(userPath, addUser)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers), limitRequestSize(requestSizeAdminConfig)).
+				Post(userPath, addUser)
 			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(userPath+"/{username}", getUserByUsername)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Put(userPath+"/{username}", updateUser)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers), limitRequestSize(requestSizeAdminConfig)).
+				Put(userPath+"/{username}", updateUser)
 			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers)).Delete(userPath+"/{username}", deleteUser)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Put(userPath+"/{username}/2fa/disable", disableUser2FA)
-			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(folderPath, getFolders)
-			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(folderPath+"/{name}", getFolderByName)
-			router.With(s.checkPerm(dataprovider.PermAdminAddUsers)).Post(folderPath, addFolder)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Put(folderPath+"/{name}", updateFolder)
-			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers)).Delete(folderPath+"/{name}", deleteFolder)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).
+				Put(userPath+"/{username}/2fa/disable", disableUser2FA)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).
+				Post(userPath+"/{username}/reset-login-cooldown", resetUserLoginCooldown)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Post(userPath+"/{username}/impersonate", s.impersonateUser)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(userPath+"/{username}/export", exportUserData)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).Get(userPath+"/{username}/sessions", getUserSessions)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/security-events", getUserSecurityEvents)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).
+				Delete(userPath+"/{username}/sessions/{id}", revokeUserSession)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/ssh-keys/audit", auditUserPublicKeys)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/uploads/sessions", getUserUploadSessions)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Delete(userPath+"/{username}/uploads/sessions/{id}", abortUserUploadSession)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/replication/status", getUserReplicationStatus)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/filesystem/check", checkUserFilesystem)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Get(userPath+"/{username}/files/archive", getUserDirArchive)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Post(userPath+"/{username}/files/copy", copyUserFiles)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Post(userPath+"/{username}/files/one-time-token", s.generateOneTimeToken)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Post(userPath+"/{username}/files/presign-upload", presignUpload)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Get(userPath+"/{username}/files/metadata", getUserFilesMetadata)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers)).
+				Get(userPath+"/{username}/files/preview", previewUserFile)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Get(userPath+"/{username}/files/chunks", getUserFileChunks)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Patch(userPath+"/{username}/files/metadata", updateUserFilesMetadata)
+			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers)).
+				Delete(userPath+"/{username}/personal-data", deleteUserPersonalData)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers, dataprovider.PermAdminManageFolders)).
+				Get(folderPath, getFolders)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers, dataprovider.PermAdminManageFolders)).
+				Get(folderPath+"/{name}", getFolderByName)
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers, dataprovider.PermAdminManageFolders)).
+				Get(folderPath+"/{name}/auditlogs", getFolderAuditLogs)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers, dataprovider.PermAdminManageFolders),
+				limitRequestSize(requestSizeAdminConfig)).
+				Post(folderPath, addFolder)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers, dataprovider.PermAdminManageFolders),
+				limitRequestSize(requestSizeAdminConfig)).
+				Put(folderPath+"/{name}", updateFolder)
+			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers, dataprovider.PermAdminManageFolders)).
+				Delete(folderPath+"/{name}", deleteFolder)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers, dataprovider.PermAdminManageFolders)).
+				Post(rcloneImportPath, importRcloneRemote)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers, dataprovider.PermAdminManageFolders),
+				limitRequestSize(requestSizeAdminConfig)).
+				Post(filesystemTestPath, testFilesystem)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Post(securityAlertTestPath, testSecurityAlert)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Get(groupPath, getGroups)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Get(groupPath+"/{name}", getGroupByName)
-			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Post(groupPath, addGroup)
-			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Put(groupPath+"/{name}", updateGroup)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), limitRequestSize(requestSizeAdminConfig)).
+				Post(groupPath, addGroup)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), limitRequestSize(requestSizeAdminConfig)).
+				Put(groupPath+"/{name}", updateGroup)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Delete(groupPath+"/{name}", deleteGroup)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), s.checkPerm(dataprovider.PermAdminChangeUsers),
+				limitRequestSize(requestSizeAdminConfig)).Post(groupPath+"/{name}/members", addGroupMembers)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).
+				Post(groupPath+"/{name}/apply-changes", applyGroupChanges)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Get(dumpDataPath, dumpData)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Get(loadDataPath, loadData)
-			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Post(loadDataPath, loadDataFromRequest)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), limitRequestSize(requestSizeUserBulkImport)).
+				Post(loadDataPath, loadDataFromRequest)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Get(onlineMigrationsPath, getOnlineMigrations)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).
+				Put(onlineMigrationsPath+"/{version}/pause", pauseOnlineMigration)
 			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Put(quotasBasePath+"/users/{username}/usage",
 				updateUserQuotaUsage)
 			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Put(quotasBasePath+"/users/{username}/transfer-usage",
@@ -1259,14 +1524,19 @@ func (s *httpdServer) initializeRouter() {
 			router.With(s.checkPerm(dataprovider.PermAdminViewDefender)).Get(defenderHosts+"/{id}", getDefenderHostByID)
 			router.With(s.checkPerm(dataprovider.PermAdminManageDefender)).Delete(defenderHosts+"/{id}", deleteDefenderHostByID)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Get(adminPath, getAdmins)
-			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Post(adminPath, addAdmin)
+			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), limitRequestSize(requestSizeAdminConfig)).
+				Post(adminPath, addAdmin)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Get(adminPath+"/{username}", getAdminByUsername)
-			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Put(adminPath+"/{username}", updateAdmin)
+			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), limitRequestSize(requestSizeAdminConfig)).
+				Put(adminPath+"/{username}", updateAdmin)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Delete(adminPath+"/{username}", deleteAdmin)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Put(adminPath+"/{username}/2fa/disable", disableAdmin2FA)
+			router.With(s.checkPerm(dataprovider.PermAdminAny)).Put(adminPath+"/{username}/unlock", unlockAdmin)
 			router.With(s.checkPerm(dataprovider.PermAdminRetentionChecks)).Get(retentionChecksPath, getRetentionChecks)
 			router.With(s.checkPerm(dataprovider.PermAdminRetentionChecks)).Post(retentionBasePath+"/{username}/check",
 				startRetentionCheck)
+			router.With(s.checkPerm(dataprovider.PermAdminRetentionChecks)).
+				Post(userPath+"/{username}/data-retention/scan", scanUserDataRetention)
 			router.With(s.checkPerm(dataprovider.PermAdminMetadataChecks)).Get(metadataChecksPath, getMetadataChecks)
 			router.With(s.checkPerm(dataprovider.PermAdminMetadataChecks)).Post(metadataBasePath+"/{username}/check",
 				startMetadataCheck)
@@ -1274,25 +1544,35 @@ func (s *httpdServer) initializeRouter() {
 				Get(fsEventsPath, searchFsEvents)
 			router.With(s.checkPerm(dataprovider.PermAdminViewEvents), compressor.Handler).
 				Get(providerEventsPath, searchProviderEvents)
+			router.With(s.checkPerm(dataprovider.PermAdminViewEvents), statsCompressor.Handler).
+				Get(transferStatsPath, exportTransferStats)
 			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
 				Get(apiKeysPath, getAPIKeys)
-			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
+			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys),
+				limitRequestSize(requestSizeAdminConfig)).
 				Post(apiKeysPath, addAPIKey)
 			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
 				Get(apiKeysPath+"/{id}", getAPIKeyByID)
-			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
+			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys),
+				limitRequestSize(requestSizeAdminConfig)).
 				Put(apiKeysPath+"/{id}", updateAPIKey)
 			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
 				Delete(apiKeysPath+"/{id}", deleteAPIKey)
+			router.With(forbidAPIKeyAuthentication, s.checkPerm(dataprovider.PermAdminManageAPIKeys)).
+				Post(apiKeysPath+"/{id}/rotate", rotateAPIKey)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Get(eventActionsPath, getEventActions)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Get(eventActionsPath+"/{name}", getEventActionByName)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(eventActionsPath, addEventAction)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Put(eventActionsPath+"/{name}", updateEventAction)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(eventActionsPath, addEventAction)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Put(eventActionsPath+"/{name}", updateEventAction)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Delete(eventActionsPath+"/{name}", deleteEventAction)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Get(eventRulesPath, getEventRules)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Get(eventRulesPath+"/{name}", getEventRuleByName)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(eventRulesPath, addEventRule)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Put(eventRulesPath+"/{name}", updateEventRule)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(eventRulesPath, addEventRule)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Put(eventRulesPath+"/{name}", updateEventRule)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Delete(eventRulesPath+"/{name}", deleteEventRule)
 		})
 
@@ -1300,27 +1580,33 @@ func (s *httpdServer) initializeRouter() {
 
 		s.router.Group(func(router chi.Router) {
 			router.Use(checkAPIKeyAuth(s.tokenAuth, dataprovider.APIKeyScopeUser))
+			router.Use(checkOAuth2ResourceServerAuth(s.tokenAuth, dataprovider.APIKeyScopeUser))
 			// Query is put before header due to only office server sending its token in the header
 			router.Use(jwtauth.Verify(s.tokenAuth, jwtauth.TokenFromQuery, jwtauth.TokenFromHeader))
 			router.Use(jwtAuthenticatorAPIUser)
 
 			router.With(forbidAPIKeyAuthentication).Get(userLogoutPath, s.logout)
-			router.With(forbidAPIKeyAuthentication, s.checkSecondFactorRequirement,
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkSecondFactorRequirement,
 				s.checkHTTPUserPerm(sdk.WebClientPasswordChangeDisabled)).Put(userPwdPath, changeUserPassword)
 			router.With(forbidAPIKeyAuthentication).Get(userProfilePath, getUserProfile)
-			router.With(forbidAPIKeyAuthentication, s.checkSecondFactorRequirement).Put(userProfilePath, updateUserProfile)
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkSecondFactorRequirement).
+				Put(userProfilePath, updateUserProfile)
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation).Get(userExportPath, exportUserDataSelf)
+			router.With(forbidAPIKeyAuthentication).Get(userSessionsPath, getUserSessionsSelf)
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation).
+				Delete(userSessionsPath+"/{id}", revokeUserSessionSelf)
 			// user TOTP APIs
 			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Get(userTOTPConfigsPath, getTOTPConfigs)
-			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Post(userTOTPGeneratePath, generateTOTPSecret)
-			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Post(userTOTPValidatePath, validateTOTPPasscode)
-			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Post(userTOTPSavePath, saveTOTPConfig)
-			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Get(user2FARecoveryCodesPath, getRecoveryCodes)
-			router.With(forbidAPIKeyAuthentication, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
+			router.With(forbidAPIKeyAuthentication, forbidImpersonation, s.checkHTTPUserPerm(sdk.WebClientMFADisabled)).
 				Post(user2FARecoveryCodesPath, generateRecoveryCodes)
 
 			router.With(s.checkSecondFactorRequirement, compressor.Handler).Get(userDirsPath, readUserFolder)
@@ -1331,7 +1617,9 @@ func (s *httpdServer) initializeRouter() {
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled)).
 				Delete(userDirsPath, deleteUserDir)
 			router.With(s.checkSecondFactorRequirement).Get(userFilesPath, getUserFile)
-			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled)).
+			router.With(s.checkSecondFactorRequirement).Get(userFilesChunksPath, getUserFileChunk)
+			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled),
+				limitRequestSize(requestSizeFileUpload)).
 				Post(userFilesPath, uploadUserFiles)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled)).
 				Patch(userFilesPath, renameUserFile)
@@ -1341,17 +1629,19 @@ func (s *httpdServer) initializeRouter() {
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientSharesDisabled)).
 				Get(userSharesPath, getShares)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientSharesDisabled)).
-				Post(userSharesPath, addShare)
+				With(forbidImpersonation).Post(userSharesPath, addShare)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientSharesDisabled)).
 				Get(userSharesPath+"/{id}", getShareByID)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientSharesDisabled)).
-				Put(userSharesPath+"/{id}", updateShare)
+				With(forbidImpersonation).Put(userSharesPath+"/{id}", updateShare)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientSharesDisabled)).
 				Delete(userSharesPath+"/{id}", deleteShare)
-			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled)).
+			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled),
+				limitRequestSize(requestSizeFileUpload)).
 				Post(userUploadFilePath, uploadUserFile)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled)).
 				Patch(userFilesDirsMetadataPath, setFileDirMetadata)
+			router.With(s.checkSecondFactorRequirement).Get(userFilesDirsMetadataPath, getFileDirMetadata)
 			router.With(s.checkSecondFactorRequirement).Post(onlyOfficeCallbackPath, onlyOfficeWriteCallback)
 		})
 
@@ -1373,21 +1663,17 @@ func (s *httpdServer) initializeRouter() {
 		}
 		if s.enableWebClient {
 			s.router.Get(webRootPath, func(w http.ResponseWriter, r *http.Request) {
-				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-				s.redirectToWebPath(w, r, webClientLoginPath)
+				s.redirectToWebPath(w, r, s.getWebLandingPath(r, webClientLoginPath))
 			})
 			s.router.Get(webBasePath, func(w http.ResponseWriter, r *http.Request) {
-				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-				s.redirectToWebPath(w, r, webClientLoginPath)
+				s.redirectToWebPath(w, r, s.getWebLandingPath(r, webClientLoginPath))
 			})
 		} else {
 			s.router.Get(webRootPath, func(w http.ResponseWriter, r *http.Request) {
-				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-				s.redirectToWebPath(w, r, webAdminLoginPath)
+				s.redirectToWebPath(w, r, s.getWebLandingPath(r, webAdminLoginPath))
 			})
 			s.router.Get(webBasePath, func(w http.ResponseWriter, r *http.Request) {
-				r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-				s.redirectToWebPath(w, r, webAdminLoginPath)
+				s.redirectToWebPath(w, r, s.getWebLandingPath(r, webAdminLoginPath))
 			})
 		}
 	}
@@ -1399,7 +1685,6 @@ func (s *httpdServer) initializeRouter() {
 func (s *httpdServer) setupWebClientRoutes() {
 	if s.enableWebClient {
 		s.router.Get(webBaseClientPath, func(w http.ResponseWriter, r *http.Request) {
-			r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 			http.Redirect(w, r, webClientLoginPath, http.StatusFound)
 		})
 		s.router.Get(webClientLoginPath, s.handleClientWebLogin)
@@ -1431,8 +1716,10 @@ func (s *httpdServer) setupWebClientRoutes() {
 		s.router.Get(webClientPubSharesPath+"/{id}/browse", s.handleShareGetFiles)
 		s.router.Get(webClientPubSharesPath+"/{id}/upload", s.handleClientUploadToShare)
 		s.router.With(compressor.Handler).Get(webClientPubSharesPath+"/{id}/dirs", s.handleShareGetDirContents)
-		s.router.Post(webClientPubSharesPath+"/{id}", s.uploadFilesToShare)
-		s.router.Post(webClientPubSharesPath+"/{id}/{name}", s.uploadFileToShare)
+		s.router.With(limitRequestSize(requestSizeFileUpload)).
+			Post(webClientPubSharesPath+"/{id}", s.uploadFilesToShare)
+		s.router.With(limitRequestSize(requestSizeFileUpload)).
+			Post(webClientPubSharesPath+"/{id}/{name}", s.uploadFileToShare)
 
 		s.router.Group(func(router chi.Router) {
 			if s.binding.OIDC.isEnabled() {
@@ -1446,7 +1733,8 @@ func (s *httpdServer) setupWebClientRoutes() {
 			router.With(s.checkSecondFactorRequirement, s.refreshCookie).Get(webClientViewPDFPath, s.handleClientViewPDF)
 			router.With(s.checkSecondFactorRequirement, s.refreshCookie).Get(webClientGetPDFPath, s.handleClientGetPDF)
 			router.With(s.checkSecondFactorRequirement, s.refreshCookie, verifyCSRFHeader).Get(webClientFilePath, getUserFile)
-			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled), verifyCSRFHeader).
+			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled), verifyCSRFHeader,
+				limitRequestSize(requestSizeFileUpload)).
 				Post(webClientFilePath, uploadUserFile)
 			router.With(s.checkSecondFactorRequirement, s.refreshCookie).Get(webClientEditFilePath, s.handleClientEditFile)
 			router.With(s.checkSecondFactorRequirement, s.checkHTTPUserPerm(sdk.WebClientWriteDisabled), verifyCSRFHeader).
@@ -1557,27 +1845,31 @@ func (s *httpdServer) setupWebAdminRoutes() {
 				Get(webUserPath, s.handleWebAddUserGet)
 			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers), s.refreshCookie).
 				Get(webUserPath+"/{username}", s.handleWebUpdateUserGet)
-			router.With(s.checkPerm(dataprovider.PermAdminAddUsers)).Post(webUserPath, s.handleWebAddUserPost)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Post(webUserPath+"/{username}",
-				s.handleWebUpdateUserPost)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers), limitRequestSize(requestSizeAdminConfig)).
+				Post(webUserPath, s.handleWebAddUserPost)
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers), limitRequestSize(requestSizeAdminConfig)).
+				Post(webUserPath+"/{username}", s.handleWebUpdateUserPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), s.refreshCookie).
 				Get(webGroupsPath, s.handleWebGetGroups)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), s.refreshCookie).
 				Get(webGroupPath, s.handleWebAddGroupGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Post(webGroupPath, s.handleWebAddGroupPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), limitRequestSize(requestSizeAdminConfig)).
+				Post(webGroupPath, s.handleWebAddGroupPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), s.refreshCookie).
 				Get(webGroupPath+"/{name}", s.handleWebUpdateGroupGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageGroups)).Post(webGroupPath+"/{name}",
-				s.handleWebUpdateGroupPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), limitRequestSize(requestSizeAdminConfig)).
+				Post(webGroupPath+"/{name}", s.handleWebUpdateGroupPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageGroups), verifyCSRFHeader).
 				Delete(webGroupPath+"/{name}", deleteGroup)
 			router.With(s.checkPerm(dataprovider.PermAdminViewConnections), s.refreshCookie).
 				Get(webConnectionsPath, s.handleWebGetConnections)
-			router.With(s.checkPerm(dataprovider.PermAdminViewUsers), s.refreshCookie).
+			router.With(s.checkPerm(dataprovider.PermAdminViewUsers, dataprovider.PermAdminManageFolders), s.refreshCookie).
 				Get(webFoldersPath, s.handleWebGetFolders)
-			router.With(s.checkPerm(dataprovider.PermAdminAddUsers), s.refreshCookie).
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers, dataprovider.PermAdminManageFolders), s.refreshCookie).
 				Get(webFolderPath, s.handleWebAddFolderGet)
-			router.With(s.checkPerm(dataprovider.PermAdminAddUsers)).Post(webFolderPath, s.handleWebAddFolderPost)
+			router.With(s.checkPerm(dataprovider.PermAdminAddUsers, dataprovider.PermAdminManageFolders),
+				limitRequestSize(requestSizeAdminConfig)).
+				Post(webFolderPath, s.handleWebAddFolderPost)
 			router.With(s.checkPerm(dataprovider.PermAdminViewServerStatus), s.refreshCookie).
 				Get(webStatusPath, s.handleWebGetStatus)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), s.refreshCookie).
@@ -1586,18 +1878,20 @@ func (s *httpdServer) setupWebAdminRoutes() {
 				Get(webAdminPath, s.handleWebAddAdminGet)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), s.refreshCookie).
 				Get(webAdminPath+"/{username}", s.handleWebUpdateAdminGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Post(webAdminPath, s.handleWebAddAdminPost)
-			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins)).Post(webAdminPath+"/{username}",
-				s.handleWebUpdateAdminPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminPath, s.handleWebAddAdminPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminPath+"/{username}", s.handleWebUpdateAdminPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageAdmins), verifyCSRFHeader).
 				Delete(webAdminPath+"/{username}", deleteAdmin)
 			router.With(s.checkPerm(dataprovider.PermAdminCloseConnections), verifyCSRFHeader).
 				Delete(webConnectionsPath+"/{connectionID}", handleCloseConnection)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers), s.refreshCookie).
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers, dataprovider.PermAdminManageFolders), s.refreshCookie).
 				Get(webFolderPath+"/{name}", s.handleWebUpdateFolderGet)
-			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers)).Post(webFolderPath+"/{name}",
-				s.handleWebUpdateFolderPost)
-			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers), verifyCSRFHeader).
+			router.With(s.checkPerm(dataprovider.PermAdminChangeUsers, dataprovider.PermAdminManageFolders),
+				limitRequestSize(requestSizeAdminConfig)).
+				Post(webFolderPath+"/{name}", s.handleWebUpdateFolderPost)
+			router.With(s.checkPerm(dataprovider.PermAdminDeleteUsers, dataprovider.PermAdminManageFolders), verifyCSRFHeader).
 				Delete(webFolderPath+"/{name}", deleteFolder)
 			router.With(s.checkPerm(dataprovider.PermAdminQuotaScans), verifyCSRFHeader).
 				Post(webScanVFolderPath+"/{name}", startFolderQuotaScan)
@@ -1607,13 +1901,16 @@ func (s *httpdServer) setupWebAdminRoutes() {
 				Post(webQuotaScanPath+"/{username}", startUserQuotaScan)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Get(webMaintenancePath, s.handleWebMaintenance)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Get(webBackupPath, dumpData)
-			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Post(webRestorePath, s.handleWebRestore)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), limitRequestSize(requestSizeUserBulkImport)).
+				Post(webRestorePath, s.handleWebRestore)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), s.refreshCookie).
 				Get(webTemplateUser, s.handleWebTemplateUserGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Post(webTemplateUser, s.handleWebTemplateUserPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), limitRequestSize(requestSizeUserBulkImport)).
+				Post(webTemplateUser, s.handleWebTemplateUserPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), s.refreshCookie).
 				Get(webTemplateFolder, s.handleWebTemplateFolderGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageSystem)).Post(webTemplateFolder, s.handleWebTemplateFolderPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageSystem), limitRequestSize(requestSizeUserBulkImport)).
+				Post(webTemplateFolder, s.handleWebTemplateFolderPost)
 			router.With(s.checkPerm(dataprovider.PermAdminViewDefender)).Get(webDefenderPath, s.handleWebDefenderPage)
 			router.With(s.checkPerm(dataprovider.PermAdminViewDefender)).Get(webDefenderHostsPath, getDefenderHosts)
 			router.With(s.checkPerm(dataprovider.PermAdminManageDefender)).Delete(webDefenderHostsPath+"/{id}",
@@ -1622,24 +1919,24 @@ func (s *httpdServer) setupWebAdminRoutes() {
 				Get(webAdminEventActionsPath, s.handleWebGetEventActions)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), s.refreshCookie).
 				Get(webAdminEventActionPath, s.handleWebAddEventActionGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(webAdminEventActionPath,
-				s.handleWebAddEventActionPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminEventActionPath, s.handleWebAddEventActionPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), s.refreshCookie).
 				Get(webAdminEventActionPath+"/{name}", s.handleWebUpdateEventActionGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(webAdminEventActionPath+"/{name}",
-				s.handleWebUpdateEventActionPost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminEventActionPath+"/{name}", s.handleWebUpdateEventActionPost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), verifyCSRFHeader).
 				Delete(webAdminEventActionPath+"/{name}", deleteEventAction)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), s.refreshCookie).
 				Get(webAdminEventRulesPath, s.handleWebGetEventRules)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), s.refreshCookie).
 				Get(webAdminEventRulePath, s.handleWebAddEventRuleGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(webAdminEventRulePath,
-				s.handleWebAddEventRulePost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminEventRulePath, s.handleWebAddEventRulePost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), s.refreshCookie).
 				Get(webAdminEventRulePath+"/{name}", s.handleWebUpdateEventRuleGet)
-			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules)).Post(webAdminEventRulePath+"/{name}",
-				s.handleWebUpdateEventRulePost)
+			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), limitRequestSize(requestSizeAdminConfig)).
+				Post(webAdminEventRulePath+"/{name}", s.handleWebUpdateEventRulePost)
 			router.With(s.checkPerm(dataprovider.PermAdminManageEventRules), verifyCSRFHeader).
 				Delete(webAdminEventRulePath+"/{name}", deleteEventRule)
 		})
@@ -0,0 +1,309 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package httpd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	userSessionKeyPrefix = "usersession_"
+)
+
+var userSessionsMgr userSessionsManager = newMemoryUserSessionsManager()
+
+// userSessionsManager tracks the sessions for the tokens issued by the user
+// token API. Tokens with a session ID are valid only while the session exists,
+// so a revoked session is simply removed
+type userSessionsManager interface {
+	// Add tracks a new session. If maxActive is greater than 0, the oldest sessions
+	// for the same user are revoked so that no more than maxActive sessions are active
+	Add(session dataprovider.UserSession, maxActive int) error
+	// List returns the active sessions for the specified user, the oldest first
+	List(username string) ([]dataprovider.UserSession, error)
+	// Revoke revokes the session with the specified ID for the specified user
+	Revoke(username, id string) error
+	// Use returns false if the session with the specified ID does not exist,
+	// for example because it has been revoked, otherwise the last use time
+	// is updated and true is returned
+	Use(id string) bool
+	Cleanup()
+}
+
+func newUserSessionsManager(isShared int) userSessionsManager {
+	if isShared == 1 {
+		logger.Info(logSender, "", "using provider user sessions manager")
+		return &dbUserSessionsManager{}
+	}
+	logger.Info(logSender, "", "using memory user sessions manager")
+	return newMemoryUserSessionsManager()
+}
+
+func newUserSession(r *http.Request, username string, expiresAt time.Time) dataprovider.UserSession {
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	return dataprovider.UserSession{
+		ID:                xid.New().String(),
+		Username:          username,
+		IP:                util.GetIPFromRemoteAddress(r.RemoteAddr),
+		UserAgent:         r.UserAgent(),
+		DeviceFingerprint: getDeviceFingerprint(r),
+		CreatedAt:         now,
+		LastUsedAt:        now,
+		ExpiresAt:         util.GetTimeAsMsSinceEpoch(expiresAt),
+	}
+}
+
+// getDeviceFingerprint returns an hash of the headers identifying the client device.
+// The client IP is not included, so the fingerprint does not change if the same
+// device connects from a different network
+func getDeviceFingerprint(r *http.Request) string {
+	h := sha256.New()
+	for _, header := range []string{"User-Agent", "Accept-Language", "Accept-Encoding", "Sec-CH-UA-Platform"} {
+		h.Write([]byte(r.Header.Get(header)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+type memoryUserSessionsManager struct {
+	mu       sync.RWMutex
+	sessions map[string]dataprovider.UserSession
+}
+
+func newMemoryUserSessionsManager() *memoryUserSessionsManager {
+	return &memoryUserSessionsManager{
+		sessions: make(map[string]dataprovider.UserSession),
+	}
+}
+
+func (m *memoryUserSessionsManager) Add(session dataprovider.UserSession, maxActive int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.ID] = session
+	if maxActive <= 0 {
+		return nil
+	}
+	sessions := m.getUserSessions(session.Username)
+	for idx := 0; idx < len(sessions)-maxActive; idx++ {
+		logger.Info(logSender, "", "max active sessions exceeded for user %q, revoking the oldest session %q",
+			session.Username, sessions[idx].ID)
+		delete(m.sessions, sessions[idx].ID)
+	}
+	return nil
+}
+
+func (m *memoryUserSessionsManager) List(username string) ([]dataprovider.UserSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.getUserSessions(username), nil
+}
+
+func (m *memoryUserSessionsManager) Revoke(username, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.Username != username || session.IsExpired() {
+		return util.NewRecordNotFoundError("session not found")
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memoryUserSessionsManager) Use(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.IsExpired() {
+		return false
+	}
+	session.LastUsedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	m.sessions[id] = session
+	return true
+}
+
+// Cleanup removes the expired sessions
+func (m *memoryUserSessionsManager) Cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if session.IsExpired() {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func (m *memoryUserSessionsManager) getUserSessions(username string) []dataprovider.UserSession {
+	var sessions []dataprovider.UserSession
+	for _, session := range m.sessions {
+		if session.Username == username && !session.IsExpired() {
+			sessions = append(sessions, session)
+		}
+	}
+	sortUserSessions(sessions)
+	return sessions
+}
+
+// dbUserSessionsManager stores the sessions within the data provider so they
+// are shared between the cluster nodes. The sessions are stored with their
+// expiration as timestamp. The last use time is tracked by each node in memory:
+// updating the stored session for each request would be expensive and could
+// restore a session revoked in the meantime
+type dbUserSessionsManager struct {
+	lastUsed sync.Map
+}
+
+func (m *dbUserSessionsManager) Add(session dataprovider.UserSession, maxActive int) error {
+	err := dataprovider.AddSharedSession(dataprovider.Session{
+		Key:       userSessionKeyPrefix + session.ID,
+		Data:      session,
+		Type:      dataprovider.SessionTypeUserSession,
+		Timestamp: session.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	if maxActive <= 0 {
+		return nil
+	}
+	sessions, err := m.getUserSessions(session.Username)
+	if err != nil {
+		return err
+	}
+	for idx := 0; idx < len(sessions)-maxActive; idx++ {
+		logger.Info(logSender, "", "max active sessions exceeded for user %q, revoking the oldest session %q",
+			session.Username, sessions[idx].ID)
+		if err := m.delete(sessions[idx].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *dbUserSessionsManager) List(username string) ([]dataprovider.UserSession, error) {
+	sessions, err := m.getUserSessions(username)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range sessions {
+		if val, ok := m.lastUsed.Load(sessions[idx].ID); ok {
+			if lastUsed := val.(int64); lastUsed > sessions[idx].LastUsedAt {
+				sessions[idx].LastUsedAt = lastUsed
+			}
+		}
+	}
+	return sessions, nil
+}
+
+func (m *dbUserSessionsManager) Revoke(username, id string) error {
+	session, err := m.get(id)
+	if err != nil || session.Username != username || session.IsExpired() {
+		return util.NewRecordNotFoundError("session not found")
+	}
+	return m.delete(id)
+}
+
+func (m *dbUserSessionsManager) Use(id string) bool {
+	session, err := m.get(id)
+	if err != nil || session.IsExpired() {
+		return false
+	}
+	m.lastUsed.Store(id, util.GetTimeAsMsSinceEpoch(time.Now()))
+	return true
+}
+
+func (m *dbUserSessionsManager) Cleanup() {
+	dataprovider.CleanupSharedSessions(dataprovider.SessionTypeUserSession, time.Now()) //nolint:errcheck
+
+	// tokens are valid for tokenDuration at most, so a session not used
+	// for tokenDuration is expired
+	limit := util.GetTimeAsMsSinceEpoch(time.Now().Add(-tokenDuration))
+	m.lastUsed.Range(func(key, value any) bool {
+		if lastUsed, ok := value.(int64); !ok || lastUsed < limit {
+			m.lastUsed.Delete(key)
+		}
+		return true
+	})
+}
+
+func (m *dbUserSessionsManager) get(id string) (dataprovider.UserSession, error) {
+	session, err := dataprovider.GetSharedSession(userSessionKeyPrefix + id)
+	if err != nil {
+		return dataprovider.UserSession{}, err
+	}
+	if session.Type != dataprovider.SessionTypeUserSession {
+		return dataprovider.UserSession{}, util.NewRecordNotFoundError("session not found")
+	}
+	return m.decodeData(session.Data)
+}
+
+func (m *dbUserSessionsManager) delete(id string) error {
+	m.lastUsed.Delete(id)
+	return dataprovider.DeleteSharedSession(userSessionKeyPrefix + id)
+}
+
+func (m *dbUserSessionsManager) getUserSessions(username string) ([]dataprovider.UserSession, error) {
+	stored, err := dataprovider.GetSharedSessions(dataprovider.SessionTypeUserSession, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var sessions []dataprovider.UserSession
+	for _, s := range stored {
+		session, err := m.decodeData(s.Data)
+		if err != nil {
+			continue
+		}
+		if session.Username == username && !session.IsExpired() {
+			sessions = append(sessions, session)
+		}
+	}
+	sortUserSessions(sessions)
+	return sessions, nil
+}
+
+func (m *dbUserSessionsManager) decodeData(data any) (dataprovider.UserSession, error) {
+	var session dataprovider.UserSession
+	if val, ok := data.([]byte); ok {
+		err := json.Unmarshal(val, &session)
+		return session, err
+	}
+	logger.Error(logSender, "", "invalid user session data type %T", data)
+	return session, util.NewRecordNotFoundError("invalid user session")
+}
+
+func sortUserSessions(sessions []dataprovider.UserSession) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].CreatedAt == sessions[j].CreatedAt {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].CreatedAt < sessions[j].CreatedAt
+	})
+}
@@ -301,6 +301,7 @@ type groupPage struct {
 	TwoFactorProtocols []string
 	WebClientOptions   []string
 	VirtualFolders     []vfs.BaseVirtualFolder
+	Groups             []dataprovider.Group
 	FsWrapper          fsWrapper
 }
 
@@ -610,6 +611,9 @@ func (s *httpdServer) getBasePageData(title, currentURL string, r *http.Request)
 }
 
 func renderAdminTemplate(w http.ResponseWriter, tmplName string, data any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
 	err := adminTemplates[tmplName].ExecuteTemplate(w, tmplName, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -871,6 +875,10 @@ func (s *httpdServer) renderGroupPage(w http.ResponseWriter, r *http.Request, gr
 	if err != nil {
 		return
 	}
+	groups, err := s.getWebGroups(w, r, defaultQueryLimit, true)
+	if err != nil {
+		return
+	}
 	group.SetEmptySecretsIfNil()
 	group.UserSettings.FsConfig.RedactedSecret = redactedSecret
 	var title, currentURL string
@@ -896,6 +904,7 @@ func (s *httpdServer) renderGroupPage(w http.ResponseWriter, r *http.Request, gr
 		TwoFactorProtocols: dataprovider.MFAProtocols,
 		WebClientOptions:   sdk.WebClientOptions,
 		VirtualFolders:     folders,
+		Groups:             groups,
 		FsWrapper: fsWrapper{
 			Filesystem:      group.UserSettings.FsConfig,
 			IsUserPage:      false,
@@ -1066,6 +1075,7 @@ func getVirtualFoldersFromPostFields(r *http.Request) []vfs.VirtualFolder {
 	folderNames := r.Form["vfolder_name"]
 	folderQuotaSizes := r.Form["vfolder_quota_size"]
 	folderQuotaFiles := r.Form["vfolder_quota_files"]
+	folderAccess := r.Form["vfolder_access"]
 	for idx, p := range folderPaths {
 		p = strings.TrimSpace(p)
 		name := ""
@@ -1093,6 +1103,9 @@ func getVirtualFoldersFromPostFields(r *http.Request) []vfs.VirtualFolder {
 					vfolder.QuotaFiles = quotaFiles
 				}
 			}
+			if len(folderAccess) > idx {
+				vfolder.ReadOnly = folderAccess[idx] == "readonly"
+			}
 			virtualFolders = append(virtualFolders, vfolder)
 		}
 	}
@@ -1202,6 +1215,176 @@ func getBandwidthLimitsFromPostFields(r *http.Request) ([]sdk.BandwidthLimit, er
 	return result, nil
 }
 
+func getPathUploadLimitsFromPostFields(r *http.Request) ([]dataprovider.PathUploadLimit, error) {
+	var result []dataprovider.PathUploadLimit
+
+	for k := range r.Form {
+		if strings.HasPrefix(k, "upload_limit_path") {
+			p := strings.TrimSpace(r.Form.Get(k))
+			if p == "" {
+				continue
+			}
+			idx := strings.TrimPrefix(k, "upload_limit_path")
+			limit := dataprovider.PathUploadLimit{
+				Path: p,
+			}
+			if size := strings.TrimSpace(r.Form.Get(fmt.Sprintf("upload_limit_size%v", idx))); size != "" {
+				maxSize, err := util.ParseBytes(size)
+				if err != nil {
+					return result, fmt.Errorf("invalid upload size limit for path %q: %w", p, err)
+				}
+				limit.MaxUploadFileSize = maxSize
+			}
+			result = append(result, limit)
+		}
+	}
+
+	return result, nil
+}
+
+func getDataRetentionPolicyFromPostFields(r *http.Request) (dataprovider.DataRetentionPolicy, error) {
+	var policy dataprovider.DataRetentionPolicy
+
+	for k := range r.Form {
+		if strings.HasPrefix(k, "data_retention_path") {
+			p := strings.TrimSpace(r.Form.Get(k))
+			if p == "" {
+				continue
+			}
+			idx := strings.TrimPrefix(k, "data_retention_path")
+			if val := strings.TrimSpace(r.Form.Get(fmt.Sprintf("data_retention_max_age%s", idx))); val != "" {
+				days, err := strconv.Atoi(val)
+				if err != nil {
+					return policy, fmt.Errorf("invalid data retention max age for path %q: %w", p, err)
+				}
+				if policy.MaxAgeDays == nil {
+					policy.MaxAgeDays = make(map[string]int)
+				}
+				policy.MaxAgeDays[p] = days
+			}
+			if val := strings.TrimSpace(r.Form.Get(fmt.Sprintf("data_retention_min%s", idx))); val != "" {
+				days, err := strconv.Atoi(val)
+				if err != nil {
+					return policy, fmt.Errorf("invalid data retention min retention for path %q: %w", p, err)
+				}
+				if policy.MinRetentionDays == nil {
+					policy.MinRetentionDays = make(map[string]int)
+				}
+				policy.MinRetentionDays[p] = days
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+func getAnomalyRulesFromPostFields(r *http.Request) ([]dataprovider.AnomalyRule, error) {
+	var rules []dataprovider.AnomalyRule
+
+	for _, ruleType := range []string{dataprovider.AnomalyRuleDownloads, dataprovider.AnomalyRuleDeletions,
+		dataprovider.AnomalyRuleMultipleNetworks} {
+		threshold := strings.TrimSpace(r.Form.Get(fmt.Sprintf("anomaly_%s_threshold", ruleType)))
+		if threshold == "" || threshold == "0" {
+			continue
+		}
+		rule := dataprovider.AnomalyRule{
+			Type:     ruleType,
+			Simulate: r.Form.Get(fmt.Sprintf("anomaly_%s_simulate", ruleType)) != "",
+		}
+		var err error
+		rule.Threshold, err = strconv.Atoi(threshold)
+		if err != nil {
+			return rules, fmt.Errorf("invalid anomaly rule %q threshold: %w", ruleType, err)
+		}
+		rule.Window, err = strconv.Atoi(strings.TrimSpace(r.Form.Get(fmt.Sprintf("anomaly_%s_window", ruleType))))
+		if err != nil {
+			return rules, fmt.Errorf("invalid anomaly rule %q window: %w", ruleType, err)
+		}
+		rules = append(rules, rule)
+	}
+	startHour := strings.TrimSpace(r.Form.Get("anomaly_unusual_hours_start"))
+	endHour := strings.TrimSpace(r.Form.Get("anomaly_unusual_hours_end"))
+	if startHour != "" || endHour != "" {
+		rule := dataprovider.AnomalyRule{
+			Type:     dataprovider.AnomalyRuleUnusualHours,
+			Simulate: r.Form.Get("anomaly_unusual_hours_simulate") != "",
+		}
+		var err error
+		rule.StartHour, err = strconv.Atoi(startHour)
+		if err != nil {
+			return rules, fmt.Errorf("invalid anomaly rule start hour: %w", err)
+		}
+		rule.EndHour, err = strconv.Atoi(endHour)
+		if err != nil {
+			return rules, fmt.Errorf("invalid anomaly rule end hour: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func getPathAliasesFromPostFields(r *http.Request) []dataprovider.PathAlias {
+	var result []dataprovider.PathAlias
+
+	for k := range r.Form {
+		if strings.HasPrefix(k, "path_alias_path") {
+			p := strings.TrimSpace(r.Form.Get(k))
+			if p == "" {
+				continue
+			}
+			idx := strings.TrimPrefix(k, "path_alias_path")
+			result = append(result, dataprovider.PathAlias{
+				Path:   p,
+				Target: strings.TrimSpace(r.Form.Get(fmt.Sprintf("path_alias_target%v", idx))),
+			})
+		}
+	}
+
+	return result
+}
+
+// getPathRewriteRulesFromPostFields returns the path rewrite rules ordered as
+// in the form, the order matters since the first matching rule wins
+func getPathRewriteRulesFromPostFields(r *http.Request) []dataprovider.PathRewrite {
+	type indexedRule struct {
+		idx  int
+		rule dataprovider.PathRewrite
+	}
+	var rules []indexedRule
+
+	for k := range r.Form {
+		if strings.HasPrefix(k, "path_rewrite_pattern") {
+			pattern := strings.TrimSpace(r.Form.Get(k))
+			if pattern == "" {
+				continue
+			}
+			idx := strings.TrimPrefix(k, "path_rewrite_pattern")
+			order, err := strconv.Atoi(idx)
+			if err != nil {
+				continue
+			}
+			rules = append(rules, indexedRule{
+				idx: order,
+				rule: dataprovider.PathRewrite{
+					Pattern:     pattern,
+					Replacement: strings.TrimSpace(r.Form.Get(fmt.Sprintf("path_rewrite_replacement%v", idx))),
+					Protocols:   getSliceFromDelimitedValues(r.Form.Get(fmt.Sprintf("path_rewrite_protocols%v", idx)), ","),
+				},
+			})
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].idx < rules[j].idx
+	})
+	result := make([]dataprovider.PathRewrite, 0, len(rules))
+	for _, item := range rules {
+		result = append(result, item.rule)
+	}
+
+	return result
+}
+
 func getPatterDenyPolicyFromString(policy string) int {
 	denyPolicy := sdk.DenyPolicyDefault
 	if policy == "1" {
@@ -1374,6 +1557,15 @@ func getS3Config(r *http.Request) (vfs.S3FsConfig, error) {
 	config.Endpoint = strings.TrimSpace(r.Form.Get("s3_endpoint"))
 	config.StorageClass = strings.TrimSpace(r.Form.Get("s3_storage_class"))
 	config.ACL = strings.TrimSpace(r.Form.Get("s3_acl"))
+	config.SSEAlgorithm = strings.TrimSpace(r.Form.Get("s3_sse_algorithm"))
+	config.ObjectLockEnabled = r.Form.Get("s3_object_lock_enabled") != ""
+	if config.ObjectLockEnabled {
+		config.ObjectLockMode = strings.TrimSpace(r.Form.Get("s3_object_lock_mode"))
+		config.RetentionDays, err = strconv.Atoi(r.Form.Get("s3_object_lock_retention_days"))
+		if err != nil {
+			return config, fmt.Errorf("invalid s3 object lock retention days: %w", err)
+		}
+	}
 	config.KeyPrefix = r.Form.Get("s3_key_prefix")
 	config.UploadPartSize, err = strconv.ParseInt(r.Form.Get("s3_upload_part_size"), 10, 64)
 	if err != nil {
@@ -1392,6 +1584,20 @@ func getS3Config(r *http.Request) (vfs.S3FsConfig, error) {
 		return config, fmt.Errorf("invalid s3 download concurrency: %w", err)
 	}
 	config.ForcePathStyle = r.Form.Get("s3_force_path_style") != ""
+	config.TransferAcceleration = r.Form.Get("s3_transfer_acceleration") != ""
+	config.ContentAddressed = r.Form.Get("s3_content_addressed") != ""
+	config.ResumableUploads = r.Form.Get("s3_resumable_uploads") != ""
+	config.PrefetchEnabled = r.Form.Get("s3_prefetch_enabled") != ""
+	if config.PrefetchEnabled {
+		config.PrefetchDepth, err = strconv.Atoi(r.Form.Get("s3_prefetch_depth"))
+		if err != nil {
+			return config, fmt.Errorf("invalid s3 prefetch depth: %w", err)
+		}
+	}
+	config.Replication.DestinationBucket = strings.TrimSpace(r.Form.Get("s3_replication_bucket"))
+	config.Replication.DestinationRegion = strings.TrimSpace(r.Form.Get("s3_replication_region"))
+	config.Replication.DestinationCredentials.AccessKey = strings.TrimSpace(r.Form.Get("s3_replication_access_key"))
+	config.Replication.DestinationCredentials.AccessSecret = getSecretFromFormField(r, "s3_replication_access_secret")
 	config.DownloadPartMaxTime, err = strconv.Atoi(r.Form.Get("s3_download_part_max_time"))
 	if err != nil {
 		return config, fmt.Errorf("invalid s3 download part max time: %w", err)
@@ -1411,6 +1617,9 @@ func getGCSConfig(r *http.Request) (vfs.GCSFsConfig, error) {
 	config.StorageClass = strings.TrimSpace(r.Form.Get("gcs_storage_class"))
 	config.ACL = strings.TrimSpace(r.Form.Get("gcs_acl"))
 	config.KeyPrefix = r.Form.Get("gcs_key_prefix")
+	config.PubSubTopic = strings.TrimSpace(r.Form.Get("gcs_pubsub_topic"))
+	config.PubSubProjectID = strings.TrimSpace(r.Form.Get("gcs_pubsub_project_id"))
+	config.ContentAddressed = r.Form.Get("gcs_content_addressed") != ""
 	autoCredentials := r.Form.Get("gcs_auto_credentials")
 	if autoCredentials != "" {
 		config.AutomaticCredentials = 1
@@ -1449,6 +1658,8 @@ func getSFTPConfig(r *http.Request) (vfs.SFTPFsConfig, error) {
 	config.Fingerprints = getSliceFromDelimitedValues(fingerprintsFormValue, "\n")
 	config.Prefix = r.Form.Get("sftp_prefix")
 	config.DisableCouncurrentReads = r.Form.Get("sftp_disable_concurrent_reads") != ""
+	config.UseOIDCToken = r.Form.Get("sftp_use_oidc_token") != ""
+	config.LocalAddress = strings.TrimSpace(r.Form.Get("sftp_local_address"))
 	config.BufferSize, err = strconv.ParseInt(r.Form.Get("sftp_buffer_size"), 10, 64)
 	if r.Form.Get("sftp_equality_check_mode") != "" {
 		config.EqualityCheckMode = 1
@@ -1468,6 +1679,9 @@ func getHTTPFsConfig(r *http.Request) vfs.HTTPFsConfig {
 	config.SkipTLSVerify = r.Form.Get("http_skip_tls_verify") != ""
 	config.Password = getSecretFromFormField(r, "http_password")
 	config.APIKey = getSecretFromFormField(r, "http_api_key")
+	config.SigningKey = getSecretFromFormField(r, "http_signing_key")
+	config.PingPath = strings.TrimSpace(r.Form.Get("http_ping_path"))
+	config.UseOIDCToken = r.Form.Get("http_use_oidc_token") != ""
 	if r.Form.Get("http_equality_check_mode") != "" {
 		config.EqualityCheckMode = 1
 	} else {
@@ -1487,6 +1701,7 @@ func getAzureConfig(r *http.Request) (vfs.AzBlobFsConfig, error) {
 	config.KeyPrefix = r.Form.Get("az_key_prefix")
 	config.AccessTier = strings.TrimSpace(r.Form.Get("az_access_tier"))
 	config.UseEmulator = r.Form.Get("az_use_emulator") != ""
+	config.ContentAddressed = r.Form.Get("az_content_addressed") != ""
 	config.UploadPartSize, err = strconv.ParseInt(r.Form.Get("az_upload_part_size"), 10, 64)
 	if err != nil {
 		return config, fmt.Errorf("invalid azure upload part size: %w", err)
@@ -1510,6 +1725,8 @@ func getFsConfigFromPostFields(r *http.Request) (vfs.Filesystem, error) {
 	var fs vfs.Filesystem
 	fs.Provider = sdk.GetProviderByName(r.Form.Get("fs_provider"))
 	switch fs.Provider {
+	case sdk.LocalFilesystemProvider:
+		fs.OSConfig.DeduplicationEnabled = r.Form.Get("os_deduplication_enabled") != ""
 	case sdk.S3FilesystemProvider:
 		config, err := getS3Config(r)
 		if err != nil {
@@ -1584,6 +1801,7 @@ func getAdminFromPostFields(r *http.Request) (dataprovider.Admin, error) {
 	admin.Status = status
 	admin.Filters.AllowList = getSliceFromDelimitedValues(r.Form.Get("allowed_ip"), ",")
 	admin.Filters.AllowAPIKeyAuth = r.Form.Get("allow_api_key_auth") != ""
+	admin.Filters.AllowExternalTokenAuth = r.Form.Get("allow_external_token_auth") != ""
 	admin.AdditionalInfo = r.Form.Get("additional_info")
 	admin.Description = r.Form.Get("description")
 	admin.Filters.Preferences.HideUserPageSections = getAdminHiddenUserPageSections(r)
@@ -1750,6 +1968,24 @@ func getTransferLimits(r *http.Request) (int64, int64, int64, error) {
 	return dataTransferUL, dataTransferDL, dataTransferTotal, nil
 }
 
+func getBandwidthBurstSizes(r *http.Request) (int64, int64, error) {
+	var uploadBurst, downloadBurst int64
+	var err error
+	if val := r.Form.Get("upload_burst_size"); val != "" {
+		uploadBurst, err = util.ParseBytes(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid upload burst size: %w", err)
+		}
+	}
+	if val := r.Form.Get("download_burst_size"); val != "" {
+		downloadBurst, err = util.ParseBytes(val)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid download burst size: %w", err)
+		}
+	}
+	return uploadBurst, downloadBurst, nil
+}
+
 func getQuotaLimits(r *http.Request) (int64, int, error) {
 	quotaSize, err := util.ParseBytes(r.Form.Get("quota_size"))
 	if err != nil {
@@ -1762,9 +1998,63 @@ func getQuotaLimits(r *http.Request) (int64, int, error) {
 	return quotaSize, quotaFiles, nil
 }
 
+func getAutoExtractFromPostFields(r *http.Request) (dataprovider.AutoExtractConfig, error) {
+	config := dataprovider.AutoExtractConfig{
+		TriggerPath:           strings.TrimSpace(r.Form.Get("auto_extract_trigger_path")),
+		ExtractToPath:         strings.TrimSpace(r.Form.Get("auto_extract_to_path")),
+		DeleteZipAfterExtract: r.Form.Get("auto_extract_delete_zip") != "",
+		NotifyEmails:          getSliceFromDelimitedValues(r.Form.Get("auto_extract_notify_emails"), ","),
+	}
+	if val := r.Form.Get("auto_extract_max_size"); val != "" {
+		maxSize, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid auto extract max size: %w", err)
+		}
+		config.MaxExtractedSize = maxSize
+	}
+	return config, nil
+}
+
+func getLoginCooldownFromPostFields(r *http.Request) (dataprovider.LoginCooldown, error) {
+	var cooldown dataprovider.LoginCooldown
+	var err error
+	if val := r.Form.Get("login_cooldown_max_attempts"); val != "" {
+		cooldown.MaxAttempts, err = strconv.Atoi(val)
+		if err != nil {
+			return cooldown, fmt.Errorf("invalid login cooldown max attempts: %w", err)
+		}
+	}
+	if val := r.Form.Get("login_cooldown_seconds"); val != "" {
+		cooldown.CooldownSeconds, err = strconv.Atoi(val)
+		if err != nil {
+			return cooldown, fmt.Errorf("invalid login cooldown duration: %w", err)
+		}
+	}
+	if val := r.Form.Get("login_cooldown_reset_after"); val != "" {
+		cooldown.ResetAfterSeconds, err = strconv.Atoi(val)
+		if err != nil {
+			return cooldown, fmt.Errorf("invalid login cooldown reset interval: %w", err)
+		}
+	}
+	cooldown.Notify = r.Form.Get("login_cooldown_notify") != ""
+	return cooldown, nil
+}
+
+func getQuotaWarningThresholdsFromPostFields(r *http.Request) ([]int, error) {
+	var thresholds []int
+	for _, val := range getSliceFromDelimitedValues(r.Form.Get("quota_warning_thresholds"), ",") {
+		threshold, err := strconv.Atoi(strings.TrimSuffix(val, "%"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota warning threshold: %w", err)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	return thresholds, nil
+}
+
 func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 	user := dataprovider.User{}
-	err := r.ParseMultipartForm(maxRequestSize)
+	err := r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		return user, err
 	}
@@ -1785,6 +2075,39 @@ func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 	if err != nil {
 		return user, err
 	}
+	quotaWarningThresholds, err := getQuotaWarningThresholdsFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
+	loginCooldown, err := getLoginCooldownFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
+	autoExtract, err := getAutoExtractFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
+	var maxFilesPerDir int
+	if val := r.Form.Get("max_files_per_dir"); val != "" {
+		maxFilesPerDir, err = strconv.Atoi(val)
+		if err != nil {
+			return user, fmt.Errorf("invalid max files per directory: %w", err)
+		}
+	}
+	var maxOpenHandles int
+	if val := r.Form.Get("max_open_handles"); val != "" {
+		maxOpenHandles, err = strconv.Atoi(val)
+		if err != nil {
+			return user, fmt.Errorf("invalid max open handles: %w", err)
+		}
+	}
+	var maxActiveSessions int
+	if val := r.Form.Get("max_active_sessions"); val != "" {
+		maxActiveSessions, err = strconv.Atoi(val)
+		if err != nil {
+			return user, fmt.Errorf("invalid max active sessions: %w", err)
+		}
+	}
 	bandwidthUL, err := strconv.ParseInt(r.Form.Get("upload_bandwidth"), 10, 64)
 	if err != nil {
 		return user, fmt.Errorf("invalid upload bandwidth: %w", err)
@@ -1793,6 +2116,10 @@ func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 	if err != nil {
 		return user, fmt.Errorf("invalid download bandwidth: %w", err)
 	}
+	uploadBurst, downloadBurst, err := getBandwidthBurstSizes(r)
+	if err != nil {
+		return user, err
+	}
 	dataTransferUL, dataTransferDL, dataTransferTotal, err := getTransferLimits(r)
 	if err != nil {
 		return user, err
@@ -1818,6 +2145,18 @@ func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 	if err != nil {
 		return user, err
 	}
+	uploadLimits, err := getPathUploadLimitsFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
+	retentionPolicy, err := getDataRetentionPolicyFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
+	anomalyRules, err := getAnomalyRulesFromPostFields(r)
+	if err != nil {
+		return user, err
+	}
 	user = dataprovider.User{
 		BaseUser: sdk.BaseUser{
 			Username:             r.Form.Get("username"),
@@ -1842,7 +2181,36 @@ func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 			Description:          r.Form.Get("description"),
 		},
 		Filters: dataprovider.UserFilters{
-			BaseUserFilters: filters,
+			BaseUserFilters:        filters,
+			AllowTCPForwarding:     r.Form.Get("allow_tcp_forwarding") != "",
+			AllowedForwardTargets:  getSliceFromDelimitedValues(r.Form.Get("allowed_forward_targets"), ","),
+			PathUploadLimits:       uploadLimits,
+			FileNameSanitize:       strings.TrimSpace(r.Form.Get("file_name_sanitize")),
+			DirListOrder:           strings.TrimSpace(r.Form.Get("dir_list_order")),
+			DirListDirsFirst:       r.Form.Get("dir_list_dirs_first") != "",
+			MaxFilesPerDir:         maxFilesPerDir,
+			MaxOpenHandles:         maxOpenHandles,
+			MaxActiveSessions:      maxActiveSessions,
+			UploadBurstSize:        uploadBurst,
+			DownloadBurstSize:      downloadBurst,
+			UploadMode:             strings.TrimSpace(r.Form.Get("upload_mode")),
+			AllowImpersonation:     util.BoolPtr(r.Form.Get("allow_impersonation") != ""),
+			AllowExternalTokenAuth: r.Form.Get("allow_external_token_auth") != "",
+			PathAliases:            getPathAliasesFromPostFields(r),
+			PathRewriteRules:       getPathRewriteRulesFromPostFields(r),
+			QuotaWarningThresholds: quotaWarningThresholds,
+			SSHExec: dataprovider.UserSSHExec{
+				AllowedCommands: getSliceFromDelimitedValues(r.Form.Get("ssh_exec_allowed_commands"), "\n"),
+				AllowedSCPPaths: getSliceFromDelimitedValues(r.Form.Get("ssh_exec_allowed_scp_paths"), "\n"),
+			},
+			LoginNotification: dataprovider.LoginNotification{
+				Enabled:   r.Form.Get("login_notification") != "",
+				NewIPOnly: r.Form.Get("login_notification_new_ip_only") != "",
+			},
+			LoginCooldown:       loginCooldown,
+			AutoExtract:         autoExtract,
+			DataRetentionPolicy: retentionPolicy,
+			AnomalyRules:        anomalyRules,
 		},
 		VirtualFolders: getVirtualFoldersFromPostFields(r),
 		FsConfig:       fsConfig,
@@ -1853,7 +2221,7 @@ func getUserFromPostFields(r *http.Request) (dataprovider.User, error) {
 
 func getGroupFromPostFields(r *http.Request) (dataprovider.Group, error) {
 	group := dataprovider.Group{}
-	err := r.ParseMultipartForm(maxRequestSize)
+	err := r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		return group, err
 	}
@@ -1909,6 +2277,7 @@ func getGroupFromPostFields(r *http.Request) (dataprovider.Group, error) {
 			FsConfig: fsConfig,
 		},
 		VirtualFolders: getVirtualFoldersFromPostFields(r),
+		ParentGroup:    r.Form.Get("parent_group"),
 	}
 	return group, nil
 }
@@ -2046,7 +2415,8 @@ func getEventActionOptionsFromPostFields(r *http.Request) (dataprovider.BaseEven
 			Attachments: emailAttachments,
 		},
 		RetentionConfig: dataprovider.EventActionDataRetentionConfig{
-			Folders: foldersRetention,
+			Folders:      foldersRetention,
+			UserPolicies: r.Form.Get("retention_user_policies") != "",
 		},
 		FsConfig: dataprovider.EventActionFilesystemConfig{
 			Type:    fsActionType,
@@ -2221,7 +2591,6 @@ func getEventRuleFromPostFields(r *http.Request) (dataprovider.EventRule, error)
 }
 
 func (s *httpdServer) handleWebAdminForgotPwd(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	if !smtp.IsEnabled() {
 		s.renderNotFoundPage(w, r, errors.New("this page does not exist"))
 		return
@@ -2230,8 +2599,6 @@ func (s *httpdServer) handleWebAdminForgotPwd(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleWebAdminForgotPwdPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
 	err := r.ParseForm()
 	if err != nil {
@@ -2264,32 +2631,26 @@ func (s *httpdServer) handleWebAdminPasswordReset(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) handleWebAdminTwoFactor(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderTwoFactorPage(w, "", util.GetIPFromRemoteAddress(r.RemoteAddr))
 }
 
 func (s *httpdServer) handleWebAdminTwoFactorRecovery(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderTwoFactorRecoveryPage(w, "", util.GetIPFromRemoteAddress(r.RemoteAddr))
 }
 
 func (s *httpdServer) handleWebAdminMFA(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderMFAPage(w, r)
 }
 
 func (s *httpdServer) handleWebAdminProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderProfilePage(w, r, "")
 }
 
 func (s *httpdServer) handleWebAdminChangePwd(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderChangePasswordPage(w, r, "")
 }
 
 func (s *httpdServer) handleWebAdminProfilePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	err := r.ParseForm()
 	if err != nil {
 		s.renderProfilePage(w, r, err.Error())
@@ -2323,18 +2684,16 @@ func (s *httpdServer) handleWebAdminProfilePost(w http.ResponseWriter, r *http.R
 }
 
 func (s *httpdServer) handleWebMaintenance(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderMaintenancePage(w, r, "")
 }
 
 func (s *httpdServer) handleWebRestore(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, MaxRestoreSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
 		return
 	}
-	err = r.ParseMultipartForm(MaxRestoreSize)
+	err = r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		s.renderMaintenancePage(w, r, err.Error())
 		return
@@ -2381,7 +2740,6 @@ func (s *httpdServer) handleWebRestore(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *httpdServer) handleGetWebAdmins(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit := defaultQueryLimit
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		var err error
@@ -2419,7 +2777,6 @@ func (s *httpdServer) handleWebAdminSetupGet(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *httpdServer) handleWebAddAdminGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	admin := &dataprovider.Admin{
 		Status:      1,
 		Permissions: []string{dataprovider.PermAdminAny},
@@ -2428,7 +2785,6 @@ func (s *httpdServer) handleWebAddAdminGet(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleWebUpdateAdminGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	admin, err := dataprovider.AdminExists(username)
 	if err == nil {
@@ -2441,7 +2797,6 @@ func (s *httpdServer) handleWebUpdateAdminGet(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleWebAddAdminPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2469,8 +2824,6 @@ func (s *httpdServer) handleWebAddAdminPost(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *httpdServer) handleWebUpdateAdminPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	username := getURLParam(r, "username")
 	admin, err := dataprovider.AdminExists(username)
 	if _, ok := err.(*util.RecordNotFoundError); ok {
@@ -2522,7 +2875,6 @@ func (s *httpdServer) handleWebUpdateAdminPost(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebDefenderPage(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	data := defenderHostsPage{
 		basePage:         s.getBasePageData(pageDefenderTitle, webDefenderPath, r),
 		DefenderHostsURL: webDefenderHostsPath,
@@ -2532,7 +2884,6 @@ func (s *httpdServer) handleWebDefenderPage(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *httpdServer) handleGetWebUsers(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	var limit int
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		var err error
@@ -2563,7 +2914,6 @@ func (s *httpdServer) handleGetWebUsers(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *httpdServer) handleWebTemplateFolderGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	if r.URL.Query().Get("from") != "" {
 		name := r.URL.Query().Get("from")
 		folder, err := dataprovider.GetFolderByName(name)
@@ -2582,14 +2932,13 @@ func (s *httpdServer) handleWebTemplateFolderGet(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) handleWebTemplateFolderPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
 		return
 	}
 	templateFolder := vfs.BaseVirtualFolder{}
-	err = r.ParseMultipartForm(maxRequestSize)
+	err = r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		s.renderMessagePage(w, r, "Error parsing folders fields", "", http.StatusBadRequest, err, "")
 		return
@@ -2645,7 +2994,6 @@ func (s *httpdServer) handleWebTemplateFolderPost(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) handleWebTemplateUserGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	if r.URL.Query().Get("from") != "" {
 		username := r.URL.Query().Get("from")
 		user, err := dataprovider.UserExists(username)
@@ -2672,7 +3020,6 @@ func (s *httpdServer) handleWebTemplateUserGet(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebTemplateUserPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2728,7 +3075,6 @@ func (s *httpdServer) handleWebTemplateUserPost(w http.ResponseWriter, r *http.R
 }
 
 func (s *httpdServer) handleWebAddUserGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	user := dataprovider.User{BaseUser: sdk.BaseUser{
 		Status: 1,
 		Permissions: map[string][]string{
@@ -2739,7 +3085,6 @@ func (s *httpdServer) handleWebAddUserGet(w http.ResponseWriter, r *http.Request
 }
 
 func (s *httpdServer) handleWebUpdateUserGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	username := getURLParam(r, "username")
 	user, err := dataprovider.UserExists(username)
 	if err == nil {
@@ -2752,7 +3097,6 @@ func (s *httpdServer) handleWebUpdateUserGet(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *httpdServer) handleWebAddUserPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2786,7 +3130,6 @@ func (s *httpdServer) handleWebAddUserPost(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleWebUpdateUserPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2819,10 +3162,11 @@ func (s *httpdServer) handleWebUpdateUserPost(w http.ResponseWriter, r *http.Req
 	if updatedUser.Password == redactedSecret {
 		updatedUser.Password = user.Password
 	}
-	updateEncryptedSecrets(&updatedUser.FsConfig, user.FsConfig.S3Config.AccessSecret, user.FsConfig.AzBlobConfig.AccountKey,
+	updateEncryptedSecrets(&updatedUser.FsConfig, user.FsConfig.S3Config.AccessSecret,
+		user.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret, user.FsConfig.AzBlobConfig.AccountKey,
 		user.FsConfig.AzBlobConfig.SASURL, user.FsConfig.GCSConfig.Credentials, user.FsConfig.CryptConfig.Passphrase,
 		user.FsConfig.SFTPConfig.Password, user.FsConfig.SFTPConfig.PrivateKey, user.FsConfig.SFTPConfig.KeyPassphrase,
-		user.FsConfig.HTTPConfig.Password, user.FsConfig.HTTPConfig.APIKey)
+		user.FsConfig.HTTPConfig.Password, user.FsConfig.HTTPConfig.APIKey, user.FsConfig.HTTPConfig.SigningKey)
 
 	updatedUser = getUserFromTemplate(updatedUser, userTemplateFields{
 		Username:   updatedUser.Username,
@@ -2842,7 +3186,6 @@ func (s *httpdServer) handleWebUpdateUserPost(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleWebGetStatus(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	data := statusPage{
 		basePage: s.getBasePageData(pageStatusTitle, webStatusPath, r),
 		Status:   getServicesStatus(),
@@ -2851,7 +3194,6 @@ func (s *httpdServer) handleWebGetStatus(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *httpdServer) handleWebGetConnections(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2867,19 +3209,17 @@ func (s *httpdServer) handleWebGetConnections(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleWebAddFolderGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderFolderPage(w, r, vfs.BaseVirtualFolder{}, folderPageModeAdd, "")
 }
 
 func (s *httpdServer) handleWebAddFolderPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
 		return
 	}
 	folder := vfs.BaseVirtualFolder{}
-	err = r.ParseMultipartForm(maxRequestSize)
+	err = r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		s.renderFolderPage(w, r, folder, folderPageModeAdd, err.Error())
 		return
@@ -2911,7 +3251,6 @@ func (s *httpdServer) handleWebAddFolderPost(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *httpdServer) handleWebUpdateFolderGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	folder, err := dataprovider.GetFolderByName(name)
 	if err == nil {
@@ -2924,7 +3263,6 @@ func (s *httpdServer) handleWebUpdateFolderGet(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebUpdateFolderPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -2940,7 +3278,7 @@ func (s *httpdServer) handleWebUpdateFolderPost(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = r.ParseMultipartForm(maxRequestSize)
+	err = r.ParseMultipartForm(getRequestSizeLimit(r))
 	if err != nil {
 		s.renderFolderPage(w, r, folder, folderPageModeUpdate, err.Error())
 		return
@@ -2963,12 +3301,15 @@ func (s *httpdServer) handleWebUpdateFolderPost(w http.ResponseWriter, r *http.R
 	}
 	updatedFolder.ID = folder.ID
 	updatedFolder.Name = folder.Name
+	// the audit log configuration is not editable using the web admin
+	updatedFolder.AuditLog = folder.AuditLog
 	updatedFolder.FsConfig = fsConfig
 	updatedFolder.FsConfig.SetEmptySecretsIfNil()
-	updateEncryptedSecrets(&updatedFolder.FsConfig, folder.FsConfig.S3Config.AccessSecret, folder.FsConfig.AzBlobConfig.AccountKey,
+	updateEncryptedSecrets(&updatedFolder.FsConfig, folder.FsConfig.S3Config.AccessSecret,
+		folder.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret, folder.FsConfig.AzBlobConfig.AccountKey,
 		folder.FsConfig.AzBlobConfig.SASURL, folder.FsConfig.GCSConfig.Credentials, folder.FsConfig.CryptConfig.Passphrase,
 		folder.FsConfig.SFTPConfig.Password, folder.FsConfig.SFTPConfig.PrivateKey, folder.FsConfig.SFTPConfig.KeyPassphrase,
-		folder.FsConfig.HTTPConfig.Password, folder.FsConfig.HTTPConfig.APIKey)
+		folder.FsConfig.HTTPConfig.Password, folder.FsConfig.HTTPConfig.APIKey, folder.FsConfig.HTTPConfig.SigningKey)
 
 	updatedFolder = getFolderFromTemplate(updatedFolder, updatedFolder.Name)
 
@@ -2997,7 +3338,6 @@ func (s *httpdServer) getWebVirtualFolders(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleWebGetFolders(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit := defaultQueryLimit
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		var err error
@@ -3035,7 +3375,6 @@ func (s *httpdServer) getWebGroups(w http.ResponseWriter, r *http.Request, limit
 }
 
 func (s *httpdServer) handleWebGetGroups(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit := defaultQueryLimit
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		var err error
@@ -3057,12 +3396,10 @@ func (s *httpdServer) handleWebGetGroups(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *httpdServer) handleWebAddGroupGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderGroupPage(w, r, dataprovider.Group{}, genericPageModeAdd, "")
 }
 
 func (s *httpdServer) handleWebAddGroupPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -3087,7 +3424,6 @@ func (s *httpdServer) handleWebAddGroupPost(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *httpdServer) handleWebUpdateGroupGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	group, err := dataprovider.GroupExists(name)
 	if err == nil {
@@ -3100,7 +3436,6 @@ func (s *httpdServer) handleWebUpdateGroupGet(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleWebUpdateGroupPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -3130,11 +3465,12 @@ func (s *httpdServer) handleWebUpdateGroupPost(w http.ResponseWriter, r *http.Re
 	updatedGroup.SetEmptySecretsIfNil()
 
 	updateEncryptedSecrets(&updatedGroup.UserSettings.FsConfig, group.UserSettings.FsConfig.S3Config.AccessSecret,
+		group.UserSettings.FsConfig.S3Config.Replication.DestinationCredentials.AccessSecret,
 		group.UserSettings.FsConfig.AzBlobConfig.AccountKey, group.UserSettings.FsConfig.AzBlobConfig.SASURL,
 		group.UserSettings.FsConfig.GCSConfig.Credentials, group.UserSettings.FsConfig.CryptConfig.Passphrase,
 		group.UserSettings.FsConfig.SFTPConfig.Password, group.UserSettings.FsConfig.SFTPConfig.PrivateKey,
 		group.UserSettings.FsConfig.SFTPConfig.KeyPassphrase, group.UserSettings.FsConfig.HTTPConfig.Password,
-		group.UserSettings.FsConfig.HTTPConfig.APIKey)
+		group.UserSettings.FsConfig.HTTPConfig.APIKey, group.UserSettings.FsConfig.HTTPConfig.SigningKey)
 
 	err = dataprovider.UpdateGroup(&updatedGroup, group.Users, claims.Username, ipAddr)
 	if err != nil {
@@ -3162,7 +3498,6 @@ func (s *httpdServer) getWebEventActions(w http.ResponseWriter, r *http.Request,
 }
 
 func (s *httpdServer) handleWebGetEventActions(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit := defaultQueryLimit
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		var err error
@@ -3184,7 +3519,6 @@ func (s *httpdServer) handleWebGetEventActions(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebAddEventActionGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	action := dataprovider.BaseEventAction{
 		Type: dataprovider.ActionTypeHTTP,
 	}
@@ -3192,7 +3526,6 @@ func (s *httpdServer) handleWebAddEventActionGet(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) handleWebAddEventActionPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -3216,7 +3549,6 @@ func (s *httpdServer) handleWebAddEventActionPost(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) handleWebUpdateEventActionGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	action, err := dataprovider.EventActionExists(name)
 	if err == nil {
@@ -3229,7 +3561,6 @@ func (s *httpdServer) handleWebUpdateEventActionGet(w http.ResponseWriter, r *ht
 }
 
 func (s *httpdServer) handleWebUpdateEventActionPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -3272,7 +3603,6 @@ func (s *httpdServer) handleWebUpdateEventActionPost(w http.ResponseWriter, r *h
 }
 
 func (s *httpdServer) handleWebGetEventRules(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	limit := defaultQueryLimit
 	if _, ok := r.URL.Query()["qlimit"]; ok {
 		if lim, err := strconv.Atoi(r.URL.Query().Get("qlimit")); err == nil {
@@ -3300,7 +3630,6 @@ func (s *httpdServer) handleWebGetEventRules(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *httpdServer) handleWebAddEventRuleGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	rule := dataprovider.EventRule{
 		Trigger: dataprovider.EventTriggerFsEvent,
 	}
@@ -3308,7 +3637,6 @@ func (s *httpdServer) handleWebAddEventRuleGet(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebAddEventRulePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
@@ -3333,7 +3661,6 @@ func (s *httpdServer) handleWebAddEventRulePost(w http.ResponseWriter, r *http.R
 }
 
 func (s *httpdServer) handleWebUpdateEventRuleGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	name := getURLParam(r, "name")
 	rule, err := dataprovider.EventRuleExists(name)
 	if err == nil {
@@ -3346,7 +3673,6 @@ func (s *httpdServer) handleWebUpdateEventRuleGet(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) handleWebUpdateEventRulePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderBadRequestPage(w, r, errors.New("invalid token claims"))
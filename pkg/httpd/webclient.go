@@ -183,12 +183,14 @@ type clientMessagePage struct {
 
 type clientProfilePage struct {
 	baseClientPage
-	PublicKeys      []string
-	CanSubmit       bool
-	AllowAPIKeyAuth bool
-	Email           string
-	Description     string
-	Error           string
+	PublicKeys         []string
+	CanSubmit          bool
+	AllowAPIKeyAuth    bool
+	AllowImpersonation bool
+	LoginNotification  dataprovider.LoginNotification
+	Email              string
+	Description        string
+	Error              string
 }
 
 type changeClientPasswordPage struct {
@@ -407,6 +409,9 @@ func (s *httpdServer) renderClientResetPwdPage(w http.ResponseWriter, error, ip
 }
 
 func renderClientTemplate(w http.ResponseWriter, tmplName string, data any) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
 	err := clientTemplates[tmplName].ExecuteTemplate(w, tmplName, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -632,6 +637,8 @@ func (s *httpdServer) renderClientProfilePage(w http.ResponseWriter, r *http.Req
 	}
 	data.PublicKeys = user.PublicKeys
 	data.AllowAPIKeyAuth = user.Filters.AllowAPIKeyAuth
+	data.AllowImpersonation = user.IsImpersonationAllowed()
+	data.LoginNotification = user.Filters.LoginNotification
 	data.Email = user.Email
 	data.Description = user.Description
 	data.CanSubmit = userMerged.CanChangeAPIKeyAuth() || userMerged.CanManagePublicKeys() || userMerged.CanChangeInfo()
@@ -648,7 +655,6 @@ func (s *httpdServer) renderClientChangePasswordPage(w http.ResponseWriter, r *h
 }
 
 func (s *httpdServer) handleWebClientDownloadZip(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientMessagePage(w, r, "Invalid token claims", "", http.StatusForbidden, nil, "")
@@ -668,13 +674,10 @@ func (s *httpdServer) handleWebClientDownloadZip(w http.ResponseWriter, r *http.
 		s.renderClientForbiddenPage(w, r, err.Error())
 		return
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -690,11 +693,10 @@ func (s *httpdServer) handleWebClientDownloadZip(w http.ResponseWriter, r *http.
 
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"",
 		getCompressedFileName(connection.GetUsername(), filesList)))
-	renderCompressedFiles(w, connection, name, filesList, nil)
+	renderCompressedFiles(w, connection, name, filesList, nil, archiveFormatZip)
 }
 
 func (s *httpdServer) handleClientSharePartialDownload(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, true)
 	if err != nil {
@@ -710,7 +712,7 @@ func (s *httpdServer) handleClientSharePartialDownload(w http.ResponseWriter, r
 		return
 	}
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -733,11 +735,10 @@ func (s *httpdServer) handleClientSharePartialDownload(w http.ResponseWriter, r
 	dataprovider.UpdateShareLastUse(&share, 1) //nolint:errcheck
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"",
 		getCompressedFileName(fmt.Sprintf("share-%s", share.Name), filesList)))
-	renderCompressedFiles(w, connection, name, filesList, &share)
+	renderCompressedFiles(w, connection, name, filesList, &share, archiveFormatZip)
 }
 
 func (s *httpdServer) handleShareGetDirContents(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, true)
 	if err != nil {
@@ -753,7 +754,7 @@ func (s *httpdServer) handleShareGetDirContents(w http.ResponseWriter, r *http.R
 		return
 	}
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -788,7 +789,6 @@ func (s *httpdServer) handleShareGetDirContents(w http.ResponseWriter, r *http.R
 }
 
 func (s *httpdServer) handleClientUploadToShare(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeWrite, dataprovider.ShareScopeReadWrite}
 	share, _, err := s.checkPublicShare(w, r, validScopes, true)
 	if err != nil {
@@ -802,7 +802,6 @@ func (s *httpdServer) handleClientUploadToShare(w http.ResponseWriter, r *http.R
 }
 
 func (s *httpdServer) handleShareGetFiles(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	validScopes := []dataprovider.ShareScope{dataprovider.ShareScopeRead, dataprovider.ShareScopeReadWrite}
 	share, connection, err := s.checkPublicShare(w, r, validScopes, true)
 	if err != nil {
@@ -819,7 +818,7 @@ func (s *httpdServer) handleShareGetFiles(w http.ResponseWriter, r *http.Request
 	}
 
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -848,7 +847,6 @@ func (s *httpdServer) handleShareGetFiles(w http.ResponseWriter, r *http.Request
 }
 
 func (s *httpdServer) handleClientGetDirContents(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		sendAPIResponse(w, r, nil, "invalid token claims", http.StatusForbidden)
@@ -868,13 +866,10 @@ func (s *httpdServer) handleClientGetDirContents(w http.ResponseWriter, r *http.
 		sendAPIResponse(w, r, err, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -925,7 +920,6 @@ func (s *httpdServer) handleClientGetDirContents(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) handleClientGetFiles(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -945,13 +939,10 @@ func (s *httpdServer) handleClientGetFiles(w http.ResponseWriter, r *http.Reques
 		s.renderClientForbiddenPage(w, r, err.Error())
 		return
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -984,7 +975,6 @@ func (s *httpdServer) handleClientGetFiles(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleClientEditFile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1004,13 +994,10 @@ func (s *httpdServer) handleClientEditFile(w http.ResponseWriter, r *http.Reques
 		s.renderClientForbiddenPage(w, r, err.Error())
 		return
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -1054,7 +1041,6 @@ func (s *httpdServer) handleClientEditFile(w http.ResponseWriter, r *http.Reques
 }
 
 func (s *httpdServer) handleClientAddShareGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1093,7 +1079,6 @@ func (s *httpdServer) handleClientAddShareGet(w http.ResponseWriter, r *http.Req
 }
 
 func (s *httpdServer) handleClientUpdateShareGet(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1112,7 +1097,6 @@ func (s *httpdServer) handleClientUpdateShareGet(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) handleClientAddSharePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1147,7 +1131,6 @@ func (s *httpdServer) handleClientAddSharePost(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleClientUpdateSharePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1192,7 +1175,6 @@ func (s *httpdServer) handleClientUpdateSharePost(w http.ResponseWriter, r *http
 }
 
 func (s *httpdServer) handleClientGetShares(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	claims, err := getTokenClaims(r)
 	if err != nil || claims.Username == "" {
 		s.renderClientForbiddenPage(w, r, "Invalid token claims")
@@ -1227,17 +1209,14 @@ func (s *httpdServer) handleClientGetShares(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *httpdServer) handleClientGetProfile(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderClientProfilePage(w, r, "")
 }
 
 func (s *httpdServer) handleWebClientChangePwd(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderClientChangePasswordPage(w, r, "")
 }
 
 func (s *httpdServer) handleWebClientProfilePost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	err := r.ParseForm()
 	if err != nil {
 		s.renderClientProfilePage(w, r, err.Error())
@@ -1271,6 +1250,9 @@ func (s *httpdServer) handleWebClientProfilePost(w http.ResponseWriter, r *http.
 	if userMerged.CanChangeInfo() {
 		user.Email = r.Form.Get("email")
 		user.Description = r.Form.Get("description")
+		user.Filters.AllowImpersonation = util.BoolPtr(r.Form.Get("allow_impersonation") != "")
+		user.Filters.LoginNotification.Enabled = r.Form.Get("login_notification") != ""
+		user.Filters.LoginNotification.NewIPOnly = r.Form.Get("login_notification_new_ip_only") != ""
 	}
 	err = dataprovider.UpdateUser(&user, dataprovider.ActionExecutorSelf, ipAddr)
 	if err != nil {
@@ -1282,17 +1264,14 @@ func (s *httpdServer) handleWebClientProfilePost(w http.ResponseWriter, r *http.
 }
 
 func (s *httpdServer) handleWebClientMFA(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderClientMFAPage(w, r)
 }
 
 func (s *httpdServer) handleWebClientTwoFactor(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderClientTwoFactorPage(w, "", util.GetIPFromRemoteAddress(r.RemoteAddr))
 }
 
 func (s *httpdServer) handleWebClientTwoFactorRecovery(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	s.renderClientTwoFactorRecoveryPage(w, "", util.GetIPFromRemoteAddress(r.RemoteAddr))
 }
 
@@ -1306,6 +1285,8 @@ func getShareFromPostFields(r *http.Request) (*dataprovider.Share, error) {
 	share.Paths = r.Form["paths"]
 	share.Password = r.Form.Get("password")
 	share.AllowFrom = getSliceFromDelimitedValues(r.Form.Get("allowed_ip"), ",")
+	share.DisplayName = r.Form.Get("display_name")
+	share.Disposition = r.Form.Get("disposition")
 	scope, err := strconv.Atoi(r.Form.Get("scope"))
 	if err != nil {
 		return share, err
@@ -1330,7 +1311,6 @@ func getShareFromPostFields(r *http.Request) (*dataprovider.Share, error) {
 }
 
 func (s *httpdServer) handleWebClientForgotPwd(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	if !smtp.IsEnabled() {
 		s.renderClientNotFoundPage(w, r, errors.New("this page does not exist"))
 		return
@@ -1339,8 +1319,6 @@ func (s *httpdServer) handleWebClientForgotPwd(w http.ResponseWriter, r *http.Re
 }
 
 func (s *httpdServer) handleWebClientForgotPwdPost(w http.ResponseWriter, r *http.Request) {
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
-
 	ipAddr := util.GetIPFromRemoteAddress(r.RemoteAddr)
 	err := r.ParseForm()
 	if err != nil {
@@ -1416,13 +1394,10 @@ func (s *httpdServer) handleClientGetPDF(w http.ResponseWriter, r *http.Request)
 		s.renderClientForbiddenPage(w, r, err.Error())
 		return
 	}
-	connection := &Connection{
-		BaseConnection: common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
-			r.RemoteAddr, user),
-		request: r,
-	}
+	connection := newConnection(common.NewBaseConnection(connID, protocol, util.GetHTTPLocalAddress(r),
+		r.RemoteAddr, user), r)
 	if err = common.Connections.Add(connection); err != nil {
-		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusTooManyRequests, err, "")
+		s.renderClientMessagePage(w, r, "Unable to add connection", "", http.StatusServiceUnavailable, err, "")
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -216,6 +216,99 @@ func RemoveUser(user dataprovider.User, expectedStatusCode int) ([]byte, error)
 	return body, checkResponse(resp.StatusCode, expectedStatusCode)
 }
 
+// ResetUserLoginCooldown resets the login cooldown for the specified user
+// and checks the received HTTP Status code against expectedStatusCode.
+func ResetUserLoginCooldown(username string, expectedStatusCode int) ([]byte, error) {
+	var body []byte
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(userPath, url.PathEscape(username),
+		"reset-login-cooldown"), nil, "", getDefaultToken())
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+	body, _ = getResponseBody(resp)
+	return body, checkResponse(resp.StatusCode, expectedStatusCode)
+}
+
+// GetUserSecurityEvents returns the security events for the specified user and checks
+// the received HTTP Status code against expectedStatusCode.
+func GetUserSecurityEvents(username string, expectedStatusCode int) ([]common.SecurityEvent, []byte, error) {
+	var events []common.SecurityEvent
+	var body []byte
+	resp, err := sendHTTPRequest(http.MethodGet, buildURLRelativeToBase(userPath, url.PathEscape(username),
+		"security-events"), nil, "", getDefaultToken())
+	if err != nil {
+		return events, body, err
+	}
+	defer resp.Body.Close()
+	err = checkResponse(resp.StatusCode, expectedStatusCode)
+	if err == nil && expectedStatusCode == http.StatusOK {
+		err = render.DecodeJSON(resp.Body, &events)
+	} else {
+		body, _ = getResponseBody(resp)
+	}
+	return events, body, err
+}
+
+// PresignUpload generates a presigned WebDAV upload URL for the specified user and path
+// and checks the received HTTP Status code against expectedStatusCode.
+// The returned URL is relative to the WebDAV binding root
+func PresignUpload(username, path string, expiresInSeconds, maxSize int64, expectedStatusCode int) (string, []byte, error) {
+	var body []byte
+	asJSON, _ := json.Marshal(map[string]any{
+		"path":               path,
+		"expires_in_seconds": expiresInSeconds,
+		"max_size":           maxSize,
+	})
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(userPath, url.PathEscape(username),
+		"files", "presign-upload"), bytes.NewBuffer(asJSON), "application/json", getDefaultToken())
+	if err != nil {
+		return "", body, err
+	}
+	defer resp.Body.Close()
+	body, _ = getResponseBody(resp)
+	if err := checkResponse(resp.StatusCode, expectedStatusCode); err != nil {
+		return "", body, err
+	}
+	var result map[string]any
+	if expectedStatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", body, err
+		}
+		signedURL, _ := result["url"].(string)
+		return signedURL, body, nil
+	}
+	return "", body, nil
+}
+
+// GetUserQuotaStats returns the quota usage for the specified user, if recalculate
+// is true the real usage is calculated and returned too
+func GetUserQuotaStats(username string, recalculate bool, expectedStatusCode int) (map[string]any, []byte, error) {
+	var stats map[string]any
+	var body []byte
+	url, err := url.Parse(buildURLRelativeToBase(userPath, url.PathEscape(username), "quota"))
+	if err != nil {
+		return stats, body, err
+	}
+	if recalculate {
+		q := url.Query()
+		q.Add("recalculate", "true")
+		url.RawQuery = q.Encode()
+	}
+	resp, err := sendHTTPRequest(http.MethodGet, url.String(), nil, "", getDefaultToken())
+	if err != nil {
+		return stats, body, err
+	}
+	defer resp.Body.Close()
+	err = checkResponse(resp.StatusCode, expectedStatusCode)
+	if err == nil && expectedStatusCode == http.StatusOK {
+		err = render.DecodeJSON(resp.Body, &stats)
+	} else {
+		body, _ = getResponseBody(resp)
+	}
+	return stats, body, err
+}
+
 // GetUserByUsername gets a user by username and checks the received HTTP Status code against expectedStatusCode.
 func GetUserByUsername(username string, expectedStatusCode int) (dataprovider.User, []byte, error) {
 	var user dataprovider.User
@@ -325,6 +418,38 @@ func RemoveGroup(group dataprovider.Group, expectedStatusCode int) ([]byte, erro
 	return body, checkResponse(resp.StatusCode, expectedStatusCode)
 }
 
+// AddGroupMembers adds the specified users to an existing group and checks the received HTTP Status code
+// against expectedStatusCode.
+func AddGroupMembers(name string, usernames []string, groupType int, expectedStatusCode int) ([]byte, error) {
+	var body []byte
+	asJSON, _ := json.Marshal(map[string]any{
+		"users":      usernames,
+		"group_type": groupType,
+	})
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(groupPath, url.PathEscape(name), "members"),
+		bytes.NewBuffer(asJSON), "application/json", getDefaultToken())
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+	body, _ = getResponseBody(resp)
+	return body, checkResponse(resp.StatusCode, expectedStatusCode)
+}
+
+// ApplyGroupChanges refreshes the users of the specified group and checks the received HTTP Status code
+// against expectedStatusCode.
+func ApplyGroupChanges(name string, expectedStatusCode int) ([]byte, error) {
+	var body []byte
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(groupPath, url.PathEscape(name), "apply-changes"),
+		nil, "", getDefaultToken())
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+	body, _ = getResponseBody(resp)
+	return body, checkResponse(resp.StatusCode, expectedStatusCode)
+}
+
 // GetGroupByName gets a group by name and checks the received HTTP Status code against expectedStatusCode.
 func GetGroupByName(name string, expectedStatusCode int) (dataprovider.Group, []byte, error) {
 	var group dataprovider.Group
@@ -919,6 +1044,29 @@ func GetRetentionChecks(expectedStatusCode int) ([]common.ActiveRetentionChecks,
 	return checks, body, err
 }
 
+// ScanUserDataRetention enforces the data retention policy for the specified user.
+// If simulate is true the files to delete are returned
+func ScanUserDataRetention(username string, simulate bool, expectedStatusCode int) ([]common.RetentionPolicyFile, []byte, error) {
+	var files []common.RetentionPolicyFile
+	var body []byte
+	url, err := addSimulateQueryParam(buildURLRelativeToBase(userPath, username, "data-retention", "scan"), simulate)
+	if err != nil {
+		return files, body, err
+	}
+	resp, err := sendHTTPRequest(http.MethodPost, url.String(), nil, "", getDefaultToken())
+	if err != nil {
+		return files, body, err
+	}
+	defer resp.Body.Close()
+	err = checkResponse(resp.StatusCode, expectedStatusCode)
+	if err == nil && expectedStatusCode == http.StatusOK {
+		err = render.DecodeJSON(resp.Body, &files)
+	} else {
+		body, _ = getResponseBody(resp)
+	}
+	return files, body, err
+}
+
 // StartRetentionCheck starts a new retention check
 func StartRetentionCheck(username string, retention []dataprovider.FolderRetention, expectedStatusCode int) ([]byte, error) {
 	var body []byte
@@ -1519,6 +1667,9 @@ func checkGroup(expected, actual dataprovider.Group) error {
 	if expected.Description != actual.Description {
 		return errors.New("description mismatch")
 	}
+	if dataprovider.ConvertName(expected.ParentGroup) != actual.ParentGroup {
+		return errors.New("parent group mismatch")
+	}
 	if actual.CreatedAt == 0 {
 		return errors.New("created_at unset")
 	}
@@ -1557,6 +1708,12 @@ func checkFolder(expected *vfs.BaseVirtualFolder, actual *vfs.BaseVirtualFolder)
 	if expected.Description != actual.Description {
 		return errors.New("description mismatch")
 	}
+	if expected.AuditLog.LogFile != actual.AuditLog.LogFile {
+		return errors.New("audit log file mismatch")
+	}
+	if expected.AuditLog.RotatePolicy != "" && expected.AuditLog.RotatePolicy != actual.AuditLog.RotatePolicy {
+		return errors.New("audit log rotate policy mismatch")
+	}
 	return compareFsConfig(&expected.FsConfig, &actual.FsConfig)
 }
 
@@ -1634,6 +1791,9 @@ func compareAdminFilters(expected, actual dataprovider.AdminFilters) error {
 	if expected.AllowAPIKeyAuth != actual.AllowAPIKeyAuth {
 		return errors.New("allow_api_key_auth mismatch")
 	}
+	if expected.AllowExternalTokenAuth != actual.AllowExternalTokenAuth {
+		return errors.New("allow_external_token_auth mismatch")
+	}
 	if len(expected.AllowList) != len(actual.AllowList) {
 		return errors.New("allow list mismatch")
 	}
@@ -1695,6 +1855,94 @@ func checkUser(expected *dataprovider.User, actual *dataprovider.User) error {
 	if err := compareUserFilters(expected.Filters.BaseUserFilters, actual.Filters.BaseUserFilters); err != nil {
 		return err
 	}
+	if expected.Filters.FileNameSanitize != actual.Filters.FileNameSanitize {
+		return errors.New("file name sanitize mismatch")
+	}
+	if expected.Filters.DirListOrder != actual.Filters.DirListOrder {
+		return errors.New("dir list order mismatch")
+	}
+	if expected.Filters.DirListDirsFirst != actual.Filters.DirListDirsFirst {
+		return errors.New("dir list dirs first mismatch")
+	}
+	if expected.Filters.MaxFilesPerDir != actual.Filters.MaxFilesPerDir {
+		return errors.New("max files per dir mismatch")
+	}
+	if expected.Filters.MaxOpenHandles != actual.Filters.MaxOpenHandles {
+		return errors.New("max open handles mismatch")
+	}
+	if expected.Filters.MaxActiveSessions != actual.Filters.MaxActiveSessions {
+		return errors.New("max active sessions mismatch")
+	}
+	if expected.Filters.UploadBurstSize != actual.Filters.UploadBurstSize {
+		return errors.New("upload burst size mismatch")
+	}
+	if expected.Filters.DownloadBurstSize != actual.Filters.DownloadBurstSize {
+		return errors.New("download burst size mismatch")
+	}
+	if (expected.Filters.AllowImpersonation == nil || *expected.Filters.AllowImpersonation) !=
+		(actual.Filters.AllowImpersonation == nil || *actual.Filters.AllowImpersonation) {
+		return errors.New("allow impersonation mismatch")
+	}
+	if expected.Filters.AllowExternalTokenAuth != actual.Filters.AllowExternalTokenAuth {
+		return errors.New("allow external token auth mismatch")
+	}
+	if expected.Filters.LoginNotification != actual.Filters.LoginNotification {
+		return errors.New("login notification mismatch")
+	}
+	if expected.Filters.LoginCooldown != actual.Filters.LoginCooldown && expected.Filters.LoginCooldown.MaxAttempts > 0 {
+		return errors.New("login cooldown mismatch")
+	}
+	if expected.Filters.UploadMode != actual.Filters.UploadMode && expected.Filters.UploadMode != dataprovider.UploadModeDefault {
+		return errors.New("upload mode mismatch")
+	}
+	if len(expected.Filters.PathAliases) != len(actual.Filters.PathAliases) {
+		return errors.New("path aliases mismatch")
+	}
+	for _, alias := range expected.Filters.PathAliases {
+		if !util.Contains(actual.Filters.PathAliases, alias) {
+			return fmt.Errorf("path alias %q not found", alias.Path)
+		}
+	}
+	if err := compareAutoExtractConfig(expected.Filters.AutoExtract, actual.Filters.AutoExtract); err != nil {
+		return err
+	}
+	if err := compareDataRetentionPolicy(expected.Filters.DataRetentionPolicy, actual.Filters.DataRetentionPolicy); err != nil {
+		return err
+	}
+	if err := compareAnomalyRules(expected.Filters.AnomalyRules, actual.Filters.AnomalyRules); err != nil {
+		return err
+	}
+	if len(expected.Filters.PathRewriteRules) != len(actual.Filters.PathRewriteRules) {
+		return errors.New("path rewrite rules mismatch")
+	}
+	for idx, rule := range expected.Filters.PathRewriteRules {
+		if rule.Pattern != actual.Filters.PathRewriteRules[idx].Pattern ||
+			rule.Replacement != actual.Filters.PathRewriteRules[idx].Replacement {
+			return fmt.Errorf("path rewrite rule %q mismatch", rule.Pattern)
+		}
+		// protocols are deduplicated
+		for _, p := range rule.Protocols {
+			if !util.Contains(actual.Filters.PathRewriteRules[idx].Protocols, p) {
+				return fmt.Errorf("path rewrite rule %q protocols mismatch", rule.Pattern)
+			}
+		}
+		for _, p := range actual.Filters.PathRewriteRules[idx].Protocols {
+			if !util.Contains(rule.Protocols, p) {
+				return fmt.Errorf("path rewrite rule %q protocols mismatch", rule.Pattern)
+			}
+		}
+	}
+	// thresholds are deduplicated and sorted
+	for _, threshold := range expected.Filters.QuotaWarningThresholds {
+		if !util.Contains(actual.Filters.QuotaWarningThresholds, threshold) {
+			return fmt.Errorf("quota warning threshold %d not found", threshold)
+		}
+	}
+	for _, threshold := range actual.Filters.QuotaWarningThresholds {
+		if !util.Contains(expected.Filters.QuotaWarningThresholds, threshold) {
+			return errors.New("quota warning thresholds mismatch")
+		}
+	}
 	if err := compareFsConfig(&expected.FsConfig, &actual.FsConfig); err != nil {
 		return err
 	}
@@ -1784,6 +2032,9 @@ func compareVirtualFolders(expected []vfs.VirtualFolder, actual []vfs.VirtualFol
 				if (v.QuotaFiles) != (v1.QuotaFiles) {
 					return errors.New("vfolder quota files mismatch")
 				}
+				if v.ReadOnly != v1.ReadOnly {
+					return errors.New("vfolder read only mismatch")
+				}
 				found = true
 				break
 			}
@@ -1799,6 +2050,9 @@ func compareFsConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error {
 	if expected.Provider != actual.Provider {
 		return errors.New("fs provider mismatch")
 	}
+	if expected.OSConfig.DeduplicationEnabled != actual.OSConfig.DeduplicationEnabled {
+		return errors.New("fs deduplication mismatch")
+	}
 	if err := compareS3Config(expected, actual); err != nil {
 		return err
 	}
@@ -1817,6 +2071,23 @@ func compareFsConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error {
 	return compareHTTPFsConfig(expected, actual)
 }
 
+func compareS3ReplicationConfig(expected, actual *vfs.S3ReplicationConfig) error {
+	if expected.DestinationBucket != actual.DestinationBucket {
+		return errors.New("fs S3 replication bucket mismatch")
+	}
+	if expected.DestinationRegion != actual.DestinationRegion {
+		return errors.New("fs S3 replication region mismatch")
+	}
+	if expected.DestinationCredentials.AccessKey != actual.DestinationCredentials.AccessKey {
+		return errors.New("fs S3 replication access key mismatch")
+	}
+	if err := checkEncryptedSecret(expected.DestinationCredentials.AccessSecret,
+		actual.DestinationCredentials.AccessSecret); err != nil {
+		return fmt.Errorf("fs S3 replication access secret mismatch: %v", err)
+	}
+	return nil
+}
+
 func compareS3Config(expected *vfs.Filesystem, actual *vfs.Filesystem) error { //nolint:gocyclo
 	if expected.S3Config.Bucket != actual.S3Config.Bucket {
 		return errors.New("fs S3 bucket mismatch")
@@ -1839,6 +2110,33 @@ func compareS3Config(expected *vfs.Filesystem, actual *vfs.Filesystem) error { /
 	if expected.S3Config.StorageClass != actual.S3Config.StorageClass {
 		return errors.New("fs S3 storage class mismatch")
 	}
+	if expected.S3Config.SSEAlgorithm != actual.S3Config.SSEAlgorithm {
+		return errors.New("fs S3 server-side encryption algorithm mismatch")
+	}
+	if expected.S3Config.ContentAddressed != actual.S3Config.ContentAddressed {
+		return errors.New("fs S3 content addressed mismatch")
+	}
+	if expected.S3Config.ResumableUploads != actual.S3Config.ResumableUploads {
+		return errors.New("fs S3 resumable uploads mismatch")
+	}
+	if expected.S3Config.PrefetchEnabled != actual.S3Config.PrefetchEnabled {
+		return errors.New("fs S3 prefetch enabled mismatch")
+	}
+	if expected.S3Config.TransferAcceleration != actual.S3Config.TransferAcceleration {
+		return errors.New("fs S3 transfer acceleration mismatch")
+	}
+	if err := compareS3ReplicationConfig(&expected.S3Config.Replication, &actual.S3Config.Replication); err != nil {
+		return err
+	}
+	if expected.S3Config.ObjectLockEnabled != actual.S3Config.ObjectLockEnabled {
+		return errors.New("fs S3 object lock enabled mismatch")
+	}
+	if expected.S3Config.ObjectLockMode != actual.S3Config.ObjectLockMode {
+		return errors.New("fs S3 object lock mode mismatch")
+	}
+	if expected.S3Config.RetentionDays != actual.S3Config.RetentionDays {
+		return errors.New("fs S3 object lock retention days mismatch")
+	}
 	if expected.S3Config.ACL != actual.S3Config.ACL {
 		return errors.New("fs S3 ACL mismatch")
 	}
@@ -1887,6 +2185,15 @@ func compareGCSConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error {
 	if expected.GCSConfig.AutomaticCredentials != actual.GCSConfig.AutomaticCredentials {
 		return errors.New("GCS automatic credentials mismatch")
 	}
+	if expected.GCSConfig.ContentAddressed != actual.GCSConfig.ContentAddressed {
+		return errors.New("GCS content addressed mismatch")
+	}
+	if expected.GCSConfig.PubSubTopic != actual.GCSConfig.PubSubTopic {
+		return errors.New("GCS Pub/Sub topic mismatch")
+	}
+	if expected.GCSConfig.PubSubProjectID != actual.GCSConfig.PubSubProjectID {
+		return errors.New("GCS Pub/Sub project ID mismatch")
+	}
 	return nil
 }
 
@@ -1897,6 +2204,15 @@ func compareHTTPFsConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error
 	if expected.HTTPConfig.Username != actual.HTTPConfig.Username {
 		return errors.New("HTTPFs username mismatch")
 	}
+	if expected.HTTPConfig.PingPath != actual.HTTPConfig.PingPath {
+		return errors.New("HTTPFs ping path mismatch")
+	}
+	if expected.HTTPConfig.UseOIDCToken != actual.HTTPConfig.UseOIDCToken {
+		return errors.New("HTTPFs use_oidc_token mismatch")
+	}
+	if expected.HTTPConfig.SignatureVersion != actual.HTTPConfig.SignatureVersion {
+		return errors.New("HTTPFs signature_version mismatch")
+	}
 	if expected.HTTPConfig.SkipTLSVerify != actual.HTTPConfig.SkipTLSVerify {
 		return errors.New("HTTPFs skip_tls_verify mismatch")
 	}
@@ -1909,6 +2225,9 @@ func compareHTTPFsConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error
 	if err := checkEncryptedSecret(expected.HTTPConfig.APIKey, actual.HTTPConfig.APIKey); err != nil {
 		return fmt.Errorf("HTTPFs API key mismatch: %v", err)
 	}
+	if err := checkEncryptedSecret(expected.HTTPConfig.SigningKey, actual.HTTPConfig.SigningKey); err != nil {
+		return fmt.Errorf("HTTPFs signing key mismatch: %v", err)
+	}
 	return nil
 }
 
@@ -1928,6 +2247,12 @@ func compareSFTPFsConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error
 	if expected.SFTPConfig.EqualityCheckMode != actual.SFTPConfig.EqualityCheckMode {
 		return errors.New("SFTPFs equality_check_mode mismatch")
 	}
+	if expected.SFTPConfig.UseOIDCToken != actual.SFTPConfig.UseOIDCToken {
+		return errors.New("SFTPFs use_oidc_token mismatch")
+	}
+	if expected.SFTPConfig.LocalAddress != actual.SFTPConfig.LocalAddress {
+		return errors.New("SFTPFs local_address mismatch")
+	}
 	if err := checkEncryptedSecret(expected.SFTPConfig.Password, actual.SFTPConfig.Password); err != nil {
 		return fmt.Errorf("SFTPFs password mismatch: %v", err)
 	}
@@ -1985,6 +2310,9 @@ func compareAzBlobConfig(expected *vfs.Filesystem, actual *vfs.Filesystem) error
 		expected.AzBlobConfig.KeyPrefix+"/" != actual.AzBlobConfig.KeyPrefix {
 		return errors.New("azure Blob key prefix mismatch")
 	}
+	if expected.AzBlobConfig.ContentAddressed != actual.AzBlobConfig.ContentAddressed {
+		return errors.New("azure Blob content addressed mismatch")
+	}
 	if expected.AzBlobConfig.UseEmulator != actual.AzBlobConfig.UseEmulator {
 		return errors.New("azure Blob use emulator mismatch")
 	}
@@ -2123,6 +2451,66 @@ func compareBaseUserFilters(expected sdk.BaseUserFilters, actual sdk.BaseUserFil
 	return nil
 }
 
+func compareDataRetentionPolicy(expected, actual dataprovider.DataRetentionPolicy) error {
+	if len(expected.MaxAgeDays) != len(actual.MaxAgeDays) {
+		return errors.New("data retention max age mismatch")
+	}
+	for p, days := range expected.MaxAgeDays {
+		if val, ok := actual.MaxAgeDays[util.CleanPath(p)]; !ok || val != days {
+			return fmt.Errorf("data retention max age for path %q mismatch", p)
+		}
+	}
+	if len(expected.MinRetentionDays) != len(actual.MinRetentionDays) {
+		return errors.New("data retention min retention mismatch")
+	}
+	for p, days := range expected.MinRetentionDays {
+		if val, ok := actual.MinRetentionDays[util.CleanPath(p)]; !ok || val != days {
+			return fmt.Errorf("data retention min retention for path %q mismatch", p)
+		}
+	}
+	return nil
+}
+
+func compareAnomalyRules(expected, actual []dataprovider.AnomalyRule) error {
+	if len(expected) != len(actual) {
+		return errors.New("anomaly rules mismatch")
+	}
+	for idx, rule := range expected {
+		if rule.Type != actual[idx].Type || rule.Simulate != actual[idx].Simulate {
+			return fmt.Errorf("anomaly rule %q mismatch", rule.Type)
+		}
+		if rule.Type == dataprovider.AnomalyRuleUnusualHours {
+			if rule.StartHour != actual[idx].StartHour || rule.EndHour != actual[idx].EndHour {
+				return fmt.Errorf("anomaly rule %q hours mismatch", rule.Type)
+			}
+			continue
+		}
+		if rule.Threshold != actual[idx].Threshold || rule.Window != actual[idx].Window {
+			return fmt.Errorf("anomaly rule %q threshold mismatch", rule.Type)
+		}
+	}
+	return nil
+}
+
+func compareAutoExtractConfig(expected, actual dataprovider.AutoExtractConfig) error {
+	if expected.TriggerPath == "" {
+		return nil
+	}
+	if expected.TriggerPath != actual.TriggerPath || expected.ExtractToPath != actual.ExtractToPath {
+		return errors.New("auto extract paths mismatch")
+	}
+	if expected.DeleteZipAfterExtract != actual.DeleteZipAfterExtract ||
+		expected.MaxExtractedSize != actual.MaxExtractedSize {
+		return errors.New("auto extract options mismatch")
+	}
+	for _, email := range expected.NotifyEmails {
+		if !util.Contains(actual.NotifyEmails, email) {
+			return fmt.Errorf("auto extract notification email %q not found", email)
+		}
+	}
+	return nil
+}
+
 func compareUserFilters(expected sdk.BaseUserFilters, actual sdk.BaseUserFilters) error {
 	if err := compareBaseUserFilters(expected, actual); err != nil {
 		return err
@@ -2393,6 +2781,9 @@ func compareEventActionCmdConfigFields(expected, actual dataprovider.EventAction
 }
 
 func compareEventActionDataRetentionFields(expected, actual dataprovider.EventActionDataRetentionConfig) error {
+	if expected.UserPolicies != actual.UserPolicies {
+		return errors.New("retention user policies mismatch")
+	}
 	if len(expected.Folders) != len(actual.Folders) {
 		return errors.New("retention folders mismatch")
 	}
@@ -2551,3 +2942,16 @@ func addDisconnectQueryParam(rawurl, disconnect string) (*url.URL, error) {
 	url.RawQuery = q.Encode()
 	return url, err
 }
+
+func addSimulateQueryParam(rawurl string, simulate bool) (*url.URL, error) {
+	url, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Query()
+	if simulate {
+		q.Add("simulate", "true")
+	}
+	url.RawQuery = q.Encode()
+	return url, err
+}
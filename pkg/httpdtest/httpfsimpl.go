@@ -26,6 +26,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -52,6 +53,9 @@ const (
 	statvfsPath  = "/api/v1/statvfs"
 )
 
+// HTTPFsSigningKey is the key used by the test HTTPfs service to verify signed requests
+const HTTPFsSigningKey = "httpfs_signing_key"
+
 // StartTestHTTPFs starts a test HTTP service that implements httpfs
 // and listens on the specified port
 func StartTestHTTPFs(port int) error {
@@ -96,12 +100,12 @@ func (fs *httpFsImpl) sendAPIResponse(w http.ResponseWriter, r *http.Request, er
 }
 
 func (fs *httpFsImpl) getUsername(r *http.Request) (string, error) {
-	username, _, ok := r.BasicAuth()
-	if !ok || username == "" {
-		return "", os.ErrPermission
+	username, err := fs.authenticate(r)
+	if err != nil {
+		return "", err
 	}
 	rootPath := filepath.Join(fs.basePath, username)
-	_, err := os.Stat(rootPath)
+	_, err = os.Stat(rootPath)
 	if errors.Is(err, os.ErrNotExist) {
 		err = os.MkdirAll(rootPath, os.ModePerm)
 		if err != nil {
@@ -111,6 +115,23 @@ func (fs *httpFsImpl) getUsername(r *http.Request) (string, error) {
 	return username, nil
 }
 
+func (fs *httpFsImpl) authenticate(r *http.Request) (string, error) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), util.HTTPSignatureAlgorithm+" ") {
+		username, err := util.VerifyHTTPRequestSignature(r, 0, func(_ string) ([]byte, error) {
+			return []byte(HTTPFsSigningKey), nil
+		})
+		if err != nil || username == "" {
+			return "", os.ErrPermission
+		}
+		return username, nil
+	}
+	username, _, ok := r.BasicAuth()
+	if !ok || username == "" {
+		return "", os.ErrPermission
+	}
+	return username, nil
+}
+
 func (fs *httpFsImpl) getRespStatus(err error) int {
 	if errors.Is(err, os.ErrPermission) {
 		return http.StatusForbidden
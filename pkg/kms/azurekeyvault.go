@@ -0,0 +1,442 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+	sdkkms "github.com/sftpgo/sdk/kms"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported credential types for Azure Key Vault
+const (
+	AzureCredentialDefault          = "default"
+	AzureCredentialClientSecret     = "client_secret"
+	AzureCredentialManagedIdentity  = "managed_identity"
+	AzureCredentialWorkloadIdentity = "workload_identity"
+)
+
+const azureKeyVaultTimeout = 30 * time.Second
+
+var (
+	validAzureCredentialTypes = []string{AzureCredentialDefault, AzureCredentialClientSecret,
+		AzureCredentialManagedIdentity, AzureCredentialWorkloadIdentity}
+	validAzureKeyAlgorithms = []string{string(azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256),
+		string(azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP), string(azkeys.JSONWebKeyEncryptionAlgorithmA256KW)}
+	errAzureKeyVaultNotConfigured = errors.New("azure key vault is not configured")
+	azureKeyVault                 *azureKeyVaultWrapper
+)
+
+func init() {
+	RegisterSecretProvider(sdkkms.SchemeAzureKeyVault, sdkkms.SecretStatusAzureKeyVault, newAzureKeyVaultSecret)
+}
+
+// AzureKeyVault defines the configuration for the Azure Key Vault secret provider.
+// The secrets are encrypted locally using AES-256-GCM with a random data key and
+// the data key is wrapped using the configured Key Vault key
+type AzureKeyVault struct {
+	// Key Vault or Managed HSM URL, for example https://myvault.vault.azure.net/
+	VaultURL string `json:"vault_url" mapstructure:"vault_url"`
+	// Name of the key used to wrap the data keys
+	KeyName string `json:"key_name" mapstructure:"key_name"`
+	// Key version to use for new secrets, empty means the latest version.
+	// Existing secrets are always unwrapped with the key version used to wrap them
+	KeyVersion string `json:"key_version" mapstructure:"key_version"`
+	// Key wrapping algorithm: "RSA-OAEP-256", the default, "RSA-OAEP" or
+	// "A256KW", AES key wrap, for Managed HSM symmetric keys
+	Algorithm   string                   `json:"algorithm" mapstructure:"algorithm"`
+	Credentials AzureKeyVaultCredentials `json:"credentials" mapstructure:"credentials"`
+	// Time, in seconds, to cache the unwrapped data keys. 0 means no cache
+	CacheTTL int `json:"cache_ttl" mapstructure:"cache_ttl"`
+}
+
+// AzureKeyVaultCredentials defines the credentials to authenticate to Azure Key Vault
+type AzureKeyVaultCredentials struct {
+	// Credential type: "default", "client_secret", "managed_identity" or "workload_identity".
+	// "default" uses the environment, the workload or managed identity and the Azure CLI credentials
+	Type     string `json:"type" mapstructure:"type"`
+	TenantID string `json:"tenant_id" mapstructure:"tenant_id"`
+	// Client ID of the application, or of the user assigned managed identity
+	ClientID     string `json:"client_id" mapstructure:"client_id"`
+	ClientSecret string `json:"client_secret" mapstructure:"client_secret"`
+	// Path to the federated token for workload identity. If empty the
+	// AZURE_FEDERATED_TOKEN_FILE environment variable is used
+	TokenFilePath string `json:"token_file_path" mapstructure:"token_file_path"`
+}
+
+func (c *AzureKeyVault) isEnabled() bool {
+	return c.VaultURL != ""
+}
+
+func (c *AzureKeyVault) validate() error {
+	if !strings.HasPrefix(c.VaultURL, "https://") {
+		return fmt.Errorf("invalid azure key vault URL %q", c.VaultURL)
+	}
+	if c.KeyName == "" {
+		return errors.New("azure key vault: key name is required")
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = string(azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256)
+	}
+	if !util.Contains(validAzureKeyAlgorithms, c.Algorithm) {
+		return fmt.Errorf("azure key vault: invalid algorithm %q", c.Algorithm)
+	}
+	if c.CacheTTL < 0 {
+		return errors.New("azure key vault: cache TTL cannot be negative")
+	}
+	return c.Credentials.validate()
+}
+
+func (c *AzureKeyVaultCredentials) validate() error {
+	if c.Type == "" {
+		c.Type = AzureCredentialDefault
+	}
+	if !util.Contains(validAzureCredentialTypes, c.Type) {
+		return fmt.Errorf("azure key vault: invalid credential type %q", c.Type)
+	}
+	if c.Type == AzureCredentialClientSecret {
+		if c.TenantID == "" || c.ClientID == "" || c.ClientSecret == "" {
+			return errors.New("azure key vault: tenant ID, client ID and client secret are required")
+		}
+	}
+	return nil
+}
+
+func (c *AzureKeyVaultCredentials) getTokenCredential() (azcore.TokenCredential, error) {
+	switch c.Type {
+	case AzureCredentialClientSecret:
+		return azidentity.NewClientSecretCredential(c.TenantID, c.ClientID, c.ClientSecret, nil)
+	case AzureCredentialManagedIdentity:
+		opts := &azidentity.ManagedIdentityCredentialOptions{}
+		if c.ClientID != "" {
+			opts.ID = azidentity.ClientID(c.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(opts)
+	case AzureCredentialWorkloadIdentity:
+		tenantID := getValueOrEnv(c.TenantID, "AZURE_TENANT_ID")
+		clientID := getValueOrEnv(c.ClientID, "AZURE_CLIENT_ID")
+		tokenFilePath := getValueOrEnv(c.TokenFilePath, "AZURE_FEDERATED_TOKEN_FILE")
+		if tenantID == "" || clientID == "" || tokenFilePath == "" {
+			return nil, errors.New("azure key vault: tenant ID, client ID and token file are required for workload identity")
+		}
+		// the token file is read for each new access token, it is periodically rotated
+		return azidentity.NewClientAssertionCredential(tenantID, clientID, func(_ context.Context) (string, error) {
+			token, err := os.ReadFile(tokenFilePath)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(token)), nil
+		}, nil)
+	default:
+		return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			TenantID: c.TenantID,
+		})
+	}
+}
+
+func getValueOrEnv(value, envName string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(envName)
+}
+
+// azureKeyClient defines the Key Vault operations used to wrap and unwrap the data keys
+type azureKeyClient interface {
+	WrapKey(ctx context.Context, name string, version string, parameters azkeys.KeyOperationsParameters,
+		options *azkeys.WrapKeyOptions) (azkeys.WrapKeyResponse, error)
+	UnwrapKey(ctx context.Context, name string, version string, parameters azkeys.KeyOperationsParameters,
+		options *azkeys.UnwrapKeyOptions) (azkeys.UnwrapKeyResponse, error)
+}
+
+type cachedDataKey struct {
+	key       []byte
+	expiresAt time.Time
+}
+
+type azureKeyVaultWrapper struct {
+	config AzureKeyVault
+	client azureKeyClient
+	mu     sync.RWMutex
+	cache  map[string]cachedDataKey
+}
+
+func initializeAzureKeyVault(c AzureKeyVault) error {
+	if !c.isEnabled() {
+		azureKeyVault = nil
+		return nil
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	cred, err := c.Credentials.getTokenCredential()
+	if err != nil {
+		return fmt.Errorf("azure key vault: unable to get credentials: %w", err)
+	}
+	client, err := azkeys.NewClient(c.VaultURL, cred, nil)
+	if err != nil {
+		return fmt.Errorf("azure key vault: unable to create client: %w", err)
+	}
+	azureKeyVault = newAzureKeyVaultWrapper(c, client)
+	logger.Info(logSender, "", "azure key vault initialized, URL: %q, key: %q, algorithm: %q, credentials: %q",
+		c.VaultURL, c.KeyName, c.Algorithm, c.Credentials.Type)
+	return nil
+}
+
+func newAzureKeyVaultWrapper(c AzureKeyVault, client azureKeyClient) *azureKeyVaultWrapper {
+	return &azureKeyVaultWrapper{
+		config: c,
+		client: client,
+		cache:  make(map[string]cachedDataKey),
+	}
+}
+
+// azureWrappedKey is the wrapped data key stored as secret key
+type azureWrappedKey struct {
+	KID       string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Key       []byte `json:"key"`
+}
+
+func (w *azureKeyVaultWrapper) wrap(dataKey []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), azureKeyVaultTimeout)
+	defer cancel()
+
+	alg := azkeys.JSONWebKeyEncryptionAlgorithm(w.config.Algorithm)
+	resp, err := w.client.WrapKey(ctx, w.config.KeyName, w.config.KeyVersion, azkeys.KeyOperationsParameters{
+		Algorithm: &alg,
+		Value:     dataKey,
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("azure key vault: unable to wrap the data key: %w", err)
+	}
+	if resp.KID == nil || len(resp.Result) == 0 {
+		return "", errors.New("azure key vault: invalid wrap key response")
+	}
+	wrapped, err := json.Marshal(azureWrappedKey{
+		KID:       string(*resp.KID),
+		Algorithm: w.config.Algorithm,
+		Key:       resp.Result,
+	})
+	if err != nil {
+		return "", err
+	}
+	key := base64.StdEncoding.EncodeToString(wrapped)
+	w.addToCache(key, dataKey)
+	return key, nil
+}
+
+func (w *azureKeyVaultWrapper) unwrap(key string) ([]byte, error) {
+	if dataKey, ok := w.getFromCache(key); ok {
+		return dataKey, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped azureWrappedKey
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	kid := azkeys.ID(wrapped.KID)
+	alg := azkeys.JSONWebKeyEncryptionAlgorithm(wrapped.Algorithm)
+
+	ctx, cancel := context.WithTimeout(context.Background(), azureKeyVaultTimeout)
+	defer cancel()
+
+	resp, err := w.client.UnwrapKey(ctx, kid.Name(), kid.Version(), azkeys.KeyOperationsParameters{
+		Algorithm: &alg,
+		Value:     wrapped.Key,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("azure key vault: unable to unwrap the data key: %w", err)
+	}
+	w.addToCache(key, resp.Result)
+	return resp.Result, nil
+}
+
+func (w *azureKeyVaultWrapper) getCacheKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func (w *azureKeyVaultWrapper) addToCache(key string, dataKey []byte) {
+	if w.config.CacheTTL <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range w.cache {
+		if v.expiresAt.Before(now) {
+			delete(w.cache, k)
+		}
+	}
+	w.cache[w.getCacheKey(key)] = cachedDataKey{
+		key:       dataKey,
+		expiresAt: now.Add(time.Duration(w.config.CacheTTL) * time.Second),
+	}
+}
+
+func (w *azureKeyVaultWrapper) getFromCache(key string) ([]byte, bool) {
+	if w.config.CacheTTL <= 0 {
+		return nil, false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	cached, ok := w.cache[w.getCacheKey(key)]
+	if !ok || cached.expiresAt.Before(time.Now()) {
+		return nil, false
+	}
+	return cached.key, true
+}
+
+type azureKeyVaultSecret struct {
+	BaseSecret
+}
+
+func newAzureKeyVaultSecret(base BaseSecret, url, masterKey string) SecretProvider {
+	return &azureKeyVaultSecret{
+		BaseSecret: base,
+	}
+}
+
+func (s *azureKeyVaultSecret) Name() string {
+	return "AzureKeyVault"
+}
+
+func (s *azureKeyVaultSecret) IsEncrypted() bool {
+	return s.Status == sdkkms.SecretStatusAzureKeyVault
+}
+
+func (s *azureKeyVaultSecret) Encrypt() error {
+	if s.Status != sdkkms.SecretStatusPlain {
+		return ErrWrongSecretStatus
+	}
+	if s.Payload == "" {
+		return ErrInvalidSecret
+	}
+	wrapper := azureKeyVault
+	if wrapper == nil {
+		return errAzureKeyVaultNotConfigured
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return err
+	}
+	gcm, err := s.getAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	key, err := wrapper.wrap(dataKey)
+	if err != nil {
+		return err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, []byte(s.Payload), s.getAdditionalData())
+	s.Key = key
+	s.Payload = base64.StdEncoding.EncodeToString(ciphertext)
+	s.Status = sdkkms.SecretStatusAzureKeyVault
+	s.Mode = 0
+	return nil
+}
+
+func (s *azureKeyVaultSecret) Decrypt() error {
+	if !s.IsEncrypted() {
+		return ErrWrongSecretStatus
+	}
+	wrapper := azureKeyVault
+	if wrapper == nil {
+		return errAzureKeyVaultNotConfigured
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(s.Payload)
+	if err != nil {
+		return err
+	}
+	dataKey, err := wrapper.unwrap(s.Key)
+	if err != nil {
+		return err
+	}
+	gcm, err := s.getAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(encrypted) < nonceSize {
+		return errMalformedCiphertext
+	}
+	nonce, ciphertext := encrypted[:nonceSize], encrypted[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, s.getAdditionalData())
+	if err != nil {
+		return err
+	}
+	s.Status = sdkkms.SecretStatusPlain
+	s.Payload = string(plaintext)
+	s.Key = ""
+	s.AdditionalData = ""
+	s.Mode = 0
+	return nil
+}
+
+func (s *azureKeyVaultSecret) getAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *azureKeyVaultSecret) getAdditionalData() []byte {
+	if s.AdditionalData == "" {
+		return nil
+	}
+	return []byte(s.AdditionalData)
+}
+
+func (s *azureKeyVaultSecret) Clone() SecretProvider {
+	baseSecret := BaseSecret{
+		Status:         s.Status,
+		Payload:        s.Payload,
+		Key:            s.Key,
+		AdditionalData: s.AdditionalData,
+		Mode:           s.Mode,
+	}
+	return newAzureKeyVaultSecret(baseSecret, "", "")
+}
@@ -0,0 +1,179 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+	sdkkms "github.com/sftpgo/sdk/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAzureKeyClient struct {
+	wrapped   map[string][]byte
+	unwrapped int
+}
+
+func (c *fakeAzureKeyClient) WrapKey(_ context.Context, name string, version string,
+	parameters azkeys.KeyOperationsParameters, _ *azkeys.WrapKeyOptions,
+) (azkeys.WrapKeyResponse, error) {
+	if version == "" {
+		version = "v2"
+	}
+	kid := azkeys.ID("https://myvault.vault.azure.net/keys/" + name + "/" + version)
+	result := []byte(hex.EncodeToString(parameters.Value))
+	c.wrapped[string(kid)+string(result)] = parameters.Value
+	return azkeys.WrapKeyResponse{
+		KeyOperationResult: azkeys.KeyOperationResult{
+			KID:    &kid,
+			Result: result,
+		},
+	}, nil
+}
+
+func (c *fakeAzureKeyClient) UnwrapKey(_ context.Context, name string, version string,
+	parameters azkeys.KeyOperationsParameters, _ *azkeys.UnwrapKeyOptions,
+) (azkeys.UnwrapKeyResponse, error) {
+	if *parameters.Algorithm != azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256 {
+		return azkeys.UnwrapKeyResponse{}, errors.New("unexpected algorithm")
+	}
+	kid := "https://myvault.vault.azure.net/keys/" + name + "/" + version
+	key, ok := c.wrapped[kid+string(parameters.Value)]
+	if !ok {
+		return azkeys.UnwrapKeyResponse{}, errors.New("unable to unwrap")
+	}
+	c.unwrapped++
+	return azkeys.UnwrapKeyResponse{
+		KeyOperationResult: azkeys.KeyOperationResult{
+			Result: key,
+		},
+	}, nil
+}
+
+func TestAzureKeyVaultSecret(t *testing.T) {
+	c := AzureKeyVault{
+		VaultURL: "https://myvault.vault.azure.net/",
+		KeyName:  "sftpgo",
+	}
+	require.NoError(t, c.validate())
+	assert.Equal(t, string(azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256), c.Algorithm)
+	assert.Equal(t, AzureCredentialDefault, c.Credentials.Type)
+
+	secret := newAzureKeyVaultSecret(BaseSecret{
+		Status:         sdkkms.SecretStatusPlain,
+		Payload:        "payload",
+		AdditionalData: "username",
+	}, "", "")
+	err := secret.Encrypt()
+	assert.ErrorIs(t, err, errAzureKeyVaultNotConfigured)
+
+	client := &fakeAzureKeyClient{
+		wrapped: make(map[string][]byte),
+	}
+	azureKeyVault = newAzureKeyVaultWrapper(c, client)
+	defer func() {
+		azureKeyVault = nil
+	}()
+
+	err = secret.Encrypt()
+	require.NoError(t, err)
+	assert.True(t, secret.IsEncrypted())
+	assert.Equal(t, sdkkms.SecretStatusAzureKeyVault, secret.GetStatus())
+	assert.NotEqual(t, "payload", secret.GetPayload())
+	assert.NotEmpty(t, secret.GetKey())
+	err = secret.Encrypt()
+	assert.ErrorIs(t, err, ErrWrongSecretStatus)
+
+	cloned := secret.Clone()
+	err = cloned.Decrypt()
+	require.NoError(t, err)
+	assert.Equal(t, "payload", cloned.GetPayload())
+	assert.Empty(t, cloned.GetKey())
+	assert.Equal(t, 1, client.unwrapped)
+	err = cloned.Decrypt()
+	assert.ErrorIs(t, err, ErrWrongSecretStatus)
+	// secrets encrypted with a previous key version can still be decrypted
+	azureKeyVault.config.KeyVersion = "v3"
+	cloned = secret.Clone()
+	err = cloned.Decrypt()
+	require.NoError(t, err)
+	assert.Equal(t, "payload", cloned.GetPayload())
+	// the additional data is authenticated
+	cloned = secret.Clone()
+	cloned.SetAdditionalData("other user")
+	err = cloned.Decrypt()
+	assert.Error(t, err)
+	// the cached data key is used
+	c.CacheTTL = 60
+	azureKeyVault = newAzureKeyVaultWrapper(c, client)
+	for i := 0; i < 2; i++ {
+		cloned = secret.Clone()
+		err = cloned.Decrypt()
+		require.NoError(t, err)
+		assert.Equal(t, "payload", cloned.GetPayload())
+	}
+	assert.Equal(t, 4, client.unwrapped)
+
+	secret = newAzureKeyVaultSecret(BaseSecret{
+		Status:  sdkkms.SecretStatusAzureKeyVault,
+		Payload: secret.GetPayload(),
+		Key:     "invalid key",
+	}, "", "")
+	err = secret.Decrypt()
+	assert.Error(t, err)
+}
+
+func TestAzureKeyVaultConfig(t *testing.T) {
+	c := AzureKeyVault{
+		VaultURL: "http://myvault.vault.azure.net/",
+	}
+	assert.Error(t, c.validate())
+	c.VaultURL = "https://myvault.vault.azure.net/"
+	assert.Error(t, c.validate())
+	c.KeyName = "key"
+	c.Algorithm = "RSA1_5"
+	assert.Error(t, c.validate())
+	c.Algorithm = ""
+	c.CacheTTL = -1
+	assert.Error(t, c.validate())
+	c.CacheTTL = 0
+	c.Credentials.Type = "unknown"
+	assert.Error(t, c.validate())
+	c.Credentials.Type = AzureCredentialClientSecret
+	assert.Error(t, c.validate())
+	c.Credentials.TenantID = "tenant"
+	c.Credentials.ClientID = "client"
+	c.Credentials.ClientSecret = "secret"
+	assert.NoError(t, c.validate())
+
+	c.Credentials = AzureKeyVaultCredentials{
+		Type: AzureCredentialWorkloadIdentity,
+	}
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	_, err := c.Credentials.getTokenCredential()
+	assert.Error(t, err)
+
+	err = initializeAzureKeyVault(AzureKeyVault{})
+	assert.NoError(t, err)
+	assert.Nil(t, azureKeyVault)
+	err = initializeAzureKeyVault(AzureKeyVault{VaultURL: "https://myvault.vault.azure.net/"})
+	assert.Error(t, err)
+	assert.Nil(t, azureKeyVault)
+}
@@ -55,9 +55,11 @@ type Configuration struct {
 
 // Secrets define the KMS configuration for encryption/decryption
 type Secrets struct {
-	URL             string `json:"url" mapstructure:"url"`
-	MasterKeyPath   string `json:"master_key_path" mapstructure:"master_key_path"`
-	MasterKeyString string `json:"master_key" mapstructure:"master_key"`
+	URL             string        `json:"url" mapstructure:"url"`
+	MasterKeyPath   string        `json:"master_key_path" mapstructure:"master_key_path"`
+	MasterKeyString string        `json:"master_key" mapstructure:"master_key"`
+	AzureKeyVault   AzureKeyVault `json:"azure_key_vault" mapstructure:"azure_key_vault"`
+	Vault           Vault         `json:"vault" mapstructure:"vault"`
 	masterKey       string
 }
 
@@ -73,7 +75,8 @@ var (
 	// ErrInvalidSecret defines the error to return if a secret is not valid
 	ErrInvalidSecret    = errors.New("invalid secret")
 	validSecretStatuses = []string{sdkkms.SecretStatusPlain, sdkkms.SecretStatusAES256GCM, sdkkms.SecretStatusSecretBox,
-		sdkkms.SecretStatusVaultTransit, sdkkms.SecretStatusAWS, sdkkms.SecretStatusGCP, sdkkms.SecretStatusRedacted}
+		sdkkms.SecretStatusVaultTransit, sdkkms.SecretStatusAWS, sdkkms.SecretStatusGCP, sdkkms.SecretStatusAzureKeyVault,
+		sdkkms.SecretStatusRedacted}
 	config          Configuration
 	secretProviders = make(map[string]registeredSecretProvider)
 )
@@ -115,6 +118,12 @@ func (c *Configuration) Initialize() error {
 		}
 		c.Secrets.masterKey = strings.TrimSpace(string(mKey))
 	}
+	if err := initializeAzureKeyVault(c.Secrets.AzureKeyVault); err != nil {
+		return err
+	}
+	if err := initializeVault(c.Secrets.Vault); err != nil {
+		return err
+	}
 	config = *c
 	if config.Secrets.URL == "" {
 		config.Secrets.URL = sdkkms.SchemeLocal + "://"
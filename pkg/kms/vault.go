@@ -0,0 +1,461 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	sdkkms "github.com/sftpgo/sdk/kms"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const (
+	vaultTimeout           = 30 * time.Second
+	vaultCiphertextPrefix  = "vault:"
+	defaultVaultMountPath  = "transit"
+	defaultAppRoleAuthPath = "approle"
+)
+
+var (
+	errVaultNotConfigured = errors.New("vault is not configured")
+	// ErrVaultSealed is returned if an operation fails because Vault is sealed
+	ErrVaultSealed = errors.New("vault is sealed")
+	vaultKMS       *vaultWrapper
+)
+
+func init() {
+	RegisterSecretProvider(sdkkms.SchemeVaultTransit, sdkkms.SecretStatusVaultTransit, newVaultSecret)
+}
+
+// Vault defines the configuration for the HashiCorp Vault secret provider.
+// The secrets are encrypted and decrypted using the Vault Transit secrets engine
+type Vault struct {
+	// Vault address, for example https://vault.example.com:8200
+	Address string `json:"address" mapstructure:"address"`
+	// Vault Enterprise namespace, leave empty for open-source Vault
+	Namespace string `json:"namespace" mapstructure:"namespace"`
+	// Token to authenticate to Vault. If empty and AppRole is not configured,
+	// the VAULT_TOKEN environment variable is used
+	Token   string       `json:"token" mapstructure:"token"`
+	AppRole VaultAppRole `json:"approle" mapstructure:"approle"`
+	// Mount path for the Transit secrets engine, default "transit"
+	MountPath string `json:"mount_path" mapstructure:"mount_path"`
+	// Name of the Transit encryption key
+	KeyName string `json:"key_name" mapstructure:"key_name"`
+	// Interval, in seconds, between Vault health checks. 0 means disabled
+	HealthCheckInterval int `json:"health_check_interval" mapstructure:"health_check_interval"`
+}
+
+// VaultAppRole defines the AppRole credentials to authenticate to Vault
+type VaultAppRole struct {
+	RoleID   string `json:"role_id" mapstructure:"role_id"`
+	SecretID string `json:"secret_id" mapstructure:"secret_id"`
+	// Mount path for the AppRole auth method, default "approle"
+	MountPath string `json:"mount_path" mapstructure:"mount_path"`
+}
+
+func (c *VaultAppRole) isEnabled() bool {
+	return c.RoleID != ""
+}
+
+func (c *Vault) isEnabled() bool {
+	return c.Address != ""
+}
+
+func (c *Vault) validate() error {
+	if !strings.HasPrefix(c.Address, "http://") && !strings.HasPrefix(c.Address, "https://") {
+		return fmt.Errorf("invalid vault address %q", c.Address)
+	}
+	if c.KeyName == "" {
+		return errors.New("vault: key name is required")
+	}
+	if c.MountPath == "" {
+		c.MountPath = defaultVaultMountPath
+	}
+	c.MountPath = strings.Trim(c.MountPath, "/")
+	if c.AppRole.isEnabled() {
+		if c.AppRole.SecretID == "" {
+			return errors.New("vault: AppRole secret ID is required")
+		}
+		if c.AppRole.MountPath == "" {
+			c.AppRole.MountPath = defaultAppRoleAuthPath
+		}
+		c.AppRole.MountPath = strings.Trim(c.AppRole.MountPath, "/")
+	}
+	if c.HealthCheckInterval < 0 {
+		return errors.New("vault: health check interval cannot be negative")
+	}
+	return nil
+}
+
+type vaultWrapper struct {
+	config Vault
+	client *vault.Client
+	done   chan bool
+	mu     sync.RWMutex
+	health error
+}
+
+func initializeVault(c Vault) error {
+	if vaultKMS != nil {
+		vaultKMS.stop()
+		vaultKMS = nil
+	}
+	if !c.isEnabled() {
+		return nil
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	w, err := newVaultWrapper(c)
+	if err != nil {
+		return err
+	}
+	vaultKMS = w
+	logger.Info(logSender, "", "vault initialized, address: %q, namespace: %q, mount path: %q, key: %q, approle: %t",
+		c.Address, c.Namespace, c.MountPath, c.KeyName, c.AppRole.isEnabled())
+	return nil
+}
+
+func newVaultWrapper(c Vault) (*vaultWrapper, error) {
+	clientConfig := vault.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, fmt.Errorf("vault: unable to read the environment: %w", clientConfig.Error)
+	}
+	clientConfig.Address = c.Address
+	clientConfig.Timeout = vaultTimeout
+	client, err := vault.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("vault: unable to create client: %w", err)
+	}
+	if c.Namespace != "" {
+		client.SetNamespace(c.Namespace)
+	}
+	w := &vaultWrapper{
+		config: c,
+		client: client,
+		done:   make(chan bool),
+	}
+	authSecret, err := w.login()
+	if err != nil {
+		return nil, err
+	}
+	w.checkHealth()
+	go w.renewToken(authSecret)
+	if c.HealthCheckInterval > 0 {
+		go w.healthCheckLoop(time.Duration(c.HealthCheckInterval) * time.Second)
+	}
+	return w, nil
+}
+
+// login authenticates to Vault and returns the secret to use to renew the token.
+// A nil secret is returned for non renewable tokens
+func (w *vaultWrapper) login() (*vault.Secret, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	if w.config.AppRole.isEnabled() {
+		secret, err := w.client.Logical().WriteWithContext(ctx, path.Join("auth", w.config.AppRole.MountPath, "login"),
+			map[string]any{
+				"role_id":   w.config.AppRole.RoleID,
+				"secret_id": w.config.AppRole.SecretID,
+			})
+		if err != nil {
+			return nil, getVaultError("AppRole login", err)
+		}
+		if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+			return nil, errors.New("vault: AppRole login returned no token")
+		}
+		w.client.SetToken(secret.Auth.ClientToken)
+		return secret, nil
+	}
+	if w.config.Token != "" {
+		w.client.SetToken(w.config.Token)
+	}
+	if w.client.Token() == "" {
+		return nil, errors.New("vault: a token or AppRole credentials are required")
+	}
+	secret, err := w.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, getVaultError("token lookup", err)
+	}
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil || !renewable {
+		logger.Debug(logSender, "", "vault token is not renewable")
+		return nil, nil
+	}
+	secret, err = w.client.Auth().Token().RenewSelfWithContext(ctx, 0)
+	if err != nil {
+		return nil, getVaultError("token renewal", err)
+	}
+	return secret, nil
+}
+
+// renewToken keeps the Vault token alive. If the token can no longer be renewed
+// and AppRole is configured a new login is done, otherwise an error is logged
+func (w *vaultWrapper) renewToken(secret *vault.Secret) {
+	for {
+		if secret == nil {
+			return
+		}
+		watcher, err := w.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{
+			Secret:        secret,
+			RenewBehavior: vault.RenewBehaviorIgnoreErrors,
+		})
+		if err != nil {
+			logger.Error(logSender, "", "unable to create the vault token watcher: %v", err)
+			return
+		}
+		go watcher.Start()
+
+		if !w.watchToken(watcher) {
+			watcher.Stop()
+			return
+		}
+		watcher.Stop()
+		if !w.config.AppRole.isEnabled() {
+			logger.Error(logSender, "", "the vault token can no longer be renewed, a new token is required")
+			return
+		}
+		for {
+			secret, err = w.login()
+			if err == nil {
+				logger.Info(logSender, "", "vault AppRole login renewed")
+				break
+			}
+			logger.Error(logSender, "", "unable to renew the vault AppRole login: %v", err)
+			select {
+			case <-w.done:
+				return
+			case <-time.After(30 * time.Second):
+			}
+		}
+	}
+}
+
+// watchToken returns true if the token must be renewed and false if
+// the wrapper was stopped
+func (w *vaultWrapper) watchToken(watcher *vault.LifetimeWatcher) bool {
+	for {
+		select {
+		case <-w.done:
+			return false
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				logger.Warn(logSender, "", "vault token renewal failed: %v", err)
+			}
+			return true
+		case renewal := <-watcher.RenewCh():
+			logger.Debug(logSender, "", "vault token renewed at %v", renewal.RenewedAt)
+		}
+	}
+}
+
+func (w *vaultWrapper) healthCheckLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.checkHealth()
+		}
+	}
+}
+
+func (w *vaultWrapper) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	var healthErr error
+	resp, err := w.client.Sys().HealthWithContext(ctx)
+	switch {
+	case err != nil:
+		healthErr = fmt.Errorf("vault is unreachable: %w", err)
+	case !resp.Initialized:
+		healthErr = errors.New("vault is not initialized")
+	case resp.Sealed:
+		healthErr = ErrVaultSealed
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if healthErr == nil && w.health != nil {
+		logger.Info(logSender, "", "vault is available again")
+	}
+	if healthErr != nil && (w.health == nil || w.health.Error() != healthErr.Error()) {
+		logger.Warn(logSender, "", "vault health check failed: %v", healthErr)
+	}
+	w.health = healthErr
+}
+
+func (w *vaultWrapper) getHealth() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.health
+}
+
+func (w *vaultWrapper) stop() {
+	close(w.done)
+}
+
+func (w *vaultWrapper) write(operation string, data map[string]any) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	secret, err := w.client.Logical().WriteWithContext(ctx, path.Join(w.config.MountPath, operation, w.config.KeyName), data)
+	if err != nil {
+		return nil, getVaultError(operation, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("vault: empty response for %s operation", operation)
+	}
+	return secret.Data, nil
+}
+
+// getVaultError returns a descriptive error if Vault is sealed
+func getVaultError(operation string, err error) error {
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusServiceUnavailable {
+		for _, msg := range respErr.Errors {
+			if strings.Contains(strings.ToLower(msg), "sealed") {
+				return fmt.Errorf("vault: unable to complete the %s operation: %w", operation, ErrVaultSealed)
+			}
+		}
+	}
+	return fmt.Errorf("vault: unable to complete the %s operation: %w", operation, err)
+}
+
+// CheckHealth returns an error if the configured KMS service is not available
+func CheckHealth() error {
+	w := vaultKMS
+	if w == nil {
+		return nil
+	}
+	return w.getHealth()
+}
+
+type vaultSecret struct {
+	BaseSecret
+}
+
+func newVaultSecret(base BaseSecret, url, masterKey string) SecretProvider {
+	return &vaultSecret{
+		BaseSecret: base,
+	}
+}
+
+func (s *vaultSecret) Name() string {
+	return "VaultTransit"
+}
+
+func (s *vaultSecret) IsEncrypted() bool {
+	return s.Status == sdkkms.SecretStatusVaultTransit
+}
+
+func (s *vaultSecret) Encrypt() error {
+	if s.Status != sdkkms.SecretStatusPlain {
+		return ErrWrongSecretStatus
+	}
+	if s.Payload == "" {
+		return ErrInvalidSecret
+	}
+	w := vaultKMS
+	if w == nil {
+		return errVaultNotConfigured
+	}
+	data, err := w.write("encrypt", map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(s.Payload)),
+	})
+	if err != nil {
+		return err
+	}
+	ciphertext, ok := data["ciphertext"].(string)
+	if !ok || !strings.HasPrefix(ciphertext, vaultCiphertextPrefix) {
+		return errors.New("vault: invalid encrypt response")
+	}
+	s.Status = sdkkms.SecretStatusVaultTransit
+	s.Payload = ciphertext
+	s.Key = ""
+	s.Mode = 0
+	return nil
+}
+
+func (s *vaultSecret) Decrypt() error {
+	if !s.IsEncrypted() {
+		return ErrWrongSecretStatus
+	}
+	w := vaultKMS
+	if w == nil {
+		return errVaultNotConfigured
+	}
+	data, err := w.write("decrypt", map[string]any{
+		"ciphertext": s.getCiphertext(),
+	})
+	if err != nil {
+		return err
+	}
+	encoded, ok := data["plaintext"].(string)
+	if !ok {
+		return errors.New("vault: invalid decrypt response")
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	s.Status = sdkkms.SecretStatusPlain
+	s.Payload = string(plaintext)
+	s.Key = ""
+	s.AdditionalData = ""
+	s.Mode = 0
+	return nil
+}
+
+// getCiphertext returns the Vault ciphertext, the payload is base64 encoded
+// for secrets encrypted using the KMS plugin
+func (s *vaultSecret) getCiphertext() string {
+	if strings.HasPrefix(s.Payload, vaultCiphertextPrefix) {
+		return s.Payload
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(s.Payload); err == nil {
+		return string(decoded)
+	}
+	return s.Payload
+}
+
+func (s *vaultSecret) Clone() SecretProvider {
+	baseSecret := BaseSecret{
+		Status:         s.Status,
+		Payload:        s.Payload,
+		Key:            s.Key,
+		AdditionalData: s.AdditionalData,
+		Mode:           s.Mode,
+	}
+	return newVaultSecret(baseSecret, "", "")
+}
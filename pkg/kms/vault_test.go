@@ -0,0 +1,213 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	sdkkms "github.com/sftpgo/sdk/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testVaultToken     = "s.testtoken"
+	testVaultNamespace = "team1"
+)
+
+type fakeVault struct {
+	sealed atomic.Bool
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/sys/health" {
+		v.renderJSON(w, http.StatusOK, map[string]any{
+			"initialized": true,
+			"sealed":      v.sealed.Load(),
+		})
+		return
+	}
+	if v.sealed.Load() {
+		v.renderJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"errors": []string{"Vault is sealed"},
+		})
+		return
+	}
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["secret_id"] != "secret" {
+			v.renderJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid secret id"}})
+			return
+		}
+		v.renderJSON(w, http.StatusOK, map[string]any{
+			"auth": map[string]any{
+				"client_token":   testVaultToken,
+				"renewable":      false,
+				"lease_duration": 3600,
+			},
+		})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != testVaultToken || r.Header.Get("X-Vault-Namespace") != testVaultNamespace {
+		v.renderJSON(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	var req map[string]string
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		v.renderJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{
+				"renewable": false,
+			},
+		})
+	case "/v1/transit/encrypt/sftpgo":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			v.renderJSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		v.renderJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{
+				"ciphertext": "vault:v1:" + req["plaintext"],
+			},
+		})
+	case "/v1/transit/decrypt/sftpgo":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			v.renderJSON(w, http.StatusBadRequest, nil)
+			return
+		}
+		v.renderJSON(w, http.StatusOK, map[string]any{
+			"data": map[string]any{
+				"plaintext": strings.TrimPrefix(req["ciphertext"], "vault:v1:"),
+			},
+		})
+	default:
+		v.renderJSON(w, http.StatusNotFound, map[string]any{"errors": []string{"not found"}})
+	}
+}
+
+func (v *fakeVault) renderJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data) //nolint:errcheck
+}
+
+func TestVaultSecret(t *testing.T) {
+	fake := &fakeVault{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	c := Vault{
+		Address:   server.URL,
+		Namespace: testVaultNamespace,
+		Token:     "invalid",
+		KeyName:   "sftpgo",
+	}
+	err := initializeVault(c)
+	assert.Error(t, err)
+	assert.Nil(t, vaultKMS)
+
+	c.Token = testVaultToken
+	err = initializeVault(c)
+	require.NoError(t, err)
+	defer func() {
+		err = initializeVault(Vault{})
+		assert.NoError(t, err)
+	}()
+	assert.NoError(t, CheckHealth())
+
+	secret := newVaultSecret(BaseSecret{
+		Status:  sdkkms.SecretStatusPlain,
+		Payload: "payload",
+	}, "", "")
+	err = secret.Encrypt()
+	require.NoError(t, err)
+	assert.True(t, secret.IsEncrypted())
+	assert.True(t, strings.HasPrefix(secret.GetPayload(), vaultCiphertextPrefix))
+	err = secret.Encrypt()
+	assert.ErrorIs(t, err, ErrWrongSecretStatus)
+
+	cloned := secret.Clone()
+	err = cloned.Decrypt()
+	require.NoError(t, err)
+	assert.Equal(t, "payload", cloned.GetPayload())
+	// payload encrypted by the KMS plugin
+	cloned = newVaultSecret(BaseSecret{
+		Status:  sdkkms.SecretStatusVaultTransit,
+		Payload: base64.StdEncoding.EncodeToString([]byte(secret.GetPayload())),
+	}, "", "")
+	err = cloned.Decrypt()
+	require.NoError(t, err)
+	assert.Equal(t, "payload", cloned.GetPayload())
+
+	fake.sealed.Store(true)
+	vaultKMS.checkHealth()
+	assert.ErrorIs(t, CheckHealth(), ErrVaultSealed)
+	cloned = secret.Clone()
+	err = cloned.Decrypt()
+	assert.ErrorIs(t, err, ErrVaultSealed)
+	assert.True(t, cloned.IsEncrypted())
+	fake.sealed.Store(false)
+	vaultKMS.checkHealth()
+	assert.NoError(t, CheckHealth())
+	err = cloned.Decrypt()
+	assert.NoError(t, err)
+
+	c.Token = ""
+	c.AppRole = VaultAppRole{
+		RoleID:   "role",
+		SecretID: "invalid",
+	}
+	err = initializeVault(c)
+	assert.Error(t, err)
+	c.AppRole.SecretID = "secret"
+	err = initializeVault(c)
+	require.NoError(t, err)
+	cloned = secret.Clone()
+	err = cloned.Decrypt()
+	require.NoError(t, err)
+	assert.Equal(t, "payload", cloned.GetPayload())
+
+	err = initializeVault(Vault{})
+	assert.NoError(t, err)
+	assert.NoError(t, CheckHealth())
+	err = secret.Clone().Decrypt()
+	assert.ErrorIs(t, err, errVaultNotConfigured)
+}
+
+func TestVaultConfig(t *testing.T) {
+	c := Vault{
+		Address: "vault.example.com",
+	}
+	assert.Error(t, c.validate())
+	c.Address = "https://vault.example.com:8200"
+	assert.Error(t, c.validate())
+	c.KeyName = "key"
+	c.AppRole.RoleID = "role"
+	assert.Error(t, c.validate())
+	c.AppRole.SecretID = "secret"
+	c.HealthCheckInterval = -1
+	assert.Error(t, c.validate())
+	c.HealthCheckInterval = 0
+	c.MountPath = "/custom/transit/"
+	assert.NoError(t, c.validate())
+	assert.Equal(t, "custom/transit", c.MountPath)
+	assert.Equal(t, defaultAppRoleAuthPath, c.AppRole.MountPath)
+}
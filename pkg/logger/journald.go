@@ -24,6 +24,6 @@ import (
 
 // InitJournalDLogger configures the logger to write to journald
 func InitJournalDLogger(level zerolog.Level) {
-	logger = zerolog.New(journald.NewJournalDWriter()).Level(level)
+	logger = zerolog.New(newLogTailWriter(journald.NewJournalDWriter())).Level(level)
 	consoleLogger = zerolog.Nop()
 }
@@ -86,12 +86,12 @@ func InitLogger(logFilePath string, logMaxSize int, logMaxBackups int, logMaxAge
 			Compress:   logCompress,
 			LocalTime:  !logUTCTime,
 		}
-		logger = zerolog.New(rollingLogger)
+		logger = zerolog.New(newLogTailWriter(rollingLogger))
 		EnableConsoleLogger(level)
 	} else {
-		logger = zerolog.New(&logSyncWrapper{
+		logger = zerolog.New(newLogTailWriter(&logSyncWrapper{
 			output: os.Stdout,
-		})
+		}))
 		consoleLogger = zerolog.Nop()
 	}
 	logger = logger.Level(level)
@@ -99,9 +99,9 @@ func InitLogger(logFilePath string, logMaxSize int, logMaxBackups int, logMaxAge
 
 // InitStdErrLogger configures the logger to write to stderr
 func InitStdErrLogger(level zerolog.Level) {
-	logger = zerolog.New(&logSyncWrapper{
+	logger = zerolog.New(newLogTailWriter(&logSyncWrapper{
 		output: os.Stderr,
-	}).Level(level)
+	})).Level(level)
 	consoleLogger = zerolog.Nop()
 }
 
@@ -142,6 +142,13 @@ func SetLogTime(utc bool) {
 
 // Log logs at the specified level for the specified sender
 func Log(level LogLevel, sender string, connectionID string, format string, v ...any) {
+	LogWithRequestID(level, sender, connectionID, "", format, v...)
+}
+
+// LogWithRequestID logs at the specified level for the specified sender.
+// The request ID, if not empty, is added to the log fields so all the log
+// lines for the same request can be correlated
+func LogWithRequestID(level LogLevel, sender, connectionID, requestID, format string, v ...any) {
 	var ev *zerolog.Event
 	switch level {
 	case LevelDebug:
@@ -157,6 +164,9 @@ func Log(level LogLevel, sender string, connectionID string, format string, v ..
 	if connectionID != "" {
 		ev.Str("connection_id", connectionID)
 	}
+	if requestID != "" {
+		ev.Str("request_id", requestID)
+	}
 	ev.Msg(fmt.Sprintf(format, v...))
 }
 
@@ -221,6 +231,39 @@ func TransferLog(operation, path string, elapsed int64, size int64, user, connec
 	ev.Send()
 }
 
+// ForwardingLog logs an SSH TCP forwarding session
+func ForwardingLog(forwardingType, user, connectionID, source, destination string, bytesFromClient,
+	bytesToClient, elapsed int64,
+) {
+	logger.Info().
+		Timestamp().
+		Str("sender", forwardingType).
+		Str("username", user).
+		Str("connection_id", connectionID).
+		Str("source", source).
+		Str("destination", destination).
+		Int64("bytes_from_client", bytesFromClient).
+		Int64("bytes_to_client", bytesToClient).
+		Int64("elapsed_ms", elapsed).
+		Str("protocol", "SSH").
+		Send()
+}
+
+// SFTPVersionLog logs the SFTP protocol version requested by the client and the negotiated one
+func SFTPVersionLog(user, connectionID, localAddr, remoteAddr string, clientVersion, negotiatedVersion int) {
+	logger.Info().
+		Timestamp().
+		Str("sender", "sftp_version").
+		Str("local_addr", localAddr).
+		Str("remote_addr", remoteAddr).
+		Str("username", user).
+		Str("connection_id", connectionID).
+		Int("sftp_client_version", clientVersion).
+		Int("sftp_negotiated_version", negotiatedVersion).
+		Str("protocol", "SFTP").
+		Send()
+}
+
 // CommandLog logs an SFTP/SCP/SSH command
 func CommandLog(command, path, target, user, fileMode, connectionID, protocol string, uid, gid int, atime, mtime,
 	sshCommand string, size int64, localAddr, remoteAddr string) {
@@ -0,0 +1,279 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	logTailerSubscriberBufferSize = 256
+	// log lines waiting to be added to the ring buffer, the new lines are
+	// dropped if the queue is full
+	logTailerQueueSize = 1024
+)
+
+var (
+	logTail = &logTailer{
+		subscribers: make(map[int64]*logTailSubscriber),
+	}
+	errLogTailerDisabled = errors.New("the log tailer is disabled")
+)
+
+// LogLine defines a log line captured by the log tailer
+type LogLine struct {
+	Level LogLevel
+	// The log line, as written by the logger, without the trailing new line
+	Data []byte
+}
+
+type logTailSubscriber struct {
+	minLevel LogLevel
+	lines    chan LogLine
+}
+
+// logTailer keeps the most recent log lines in a bounded ring buffer and
+// fans out the new ones to the subscribers. The lines written by the logger
+// are queued using a buffered channel, the logger never waits for the tailer
+type logTailer struct {
+	sync.RWMutex
+	queue       chan []byte
+	lines       []LogLine
+	next        int
+	size        int
+	lastID      int64
+	subscribers map[int64]*logTailSubscriber
+}
+
+// write is called by the log writers, it never blocks: the line is dropped
+// if the queue is full
+func (t *logTailer) write(p []byte) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.queue == nil {
+		return
+	}
+	// the logger reuses its buffers
+	data := make([]byte, len(p))
+	copy(data, p)
+	select {
+	case t.queue <- data:
+	default:
+	}
+}
+
+func (t *logTailer) setBufferSize(size int) {
+	t.Lock()
+	defer t.Unlock()
+
+	if size == len(t.lines) {
+		return
+	}
+	if t.queue != nil {
+		close(t.queue)
+		t.queue = nil
+	}
+	for id, s := range t.subscribers {
+		close(s.lines)
+		delete(t.subscribers, id)
+	}
+	t.lines = nil
+	t.next = 0
+	t.size = 0
+	if size <= 0 {
+		return
+	}
+	t.lines = make([]LogLine, size)
+	t.queue = make(chan []byte, logTailerQueueSize)
+	go t.readLines(t.queue)
+}
+
+// readLines reads the log lines from the queue until it is closed.
+// Logging is not allowed here, each line would generate a new one
+func (t *logTailer) readLines(queue chan []byte) {
+	for data := range queue {
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			t.addLine(queue, bytes.TrimRight(line, "\r"))
+		}
+	}
+}
+
+func (t *logTailer) addLine(queue chan []byte, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	line := LogLine{
+		Level: getLogLineLevel(data),
+		Data:  data,
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if t.queue != queue {
+		// the tailer was reconfigured, the lines queued before are discarded
+		return
+	}
+	t.lines[t.next] = line
+	t.next = (t.next + 1) % len(t.lines)
+	if t.size < len(t.lines) {
+		t.size++
+	}
+	for id, s := range t.subscribers {
+		if line.Level < s.minLevel {
+			continue
+		}
+		select {
+		case s.lines <- line:
+		default:
+			// the subscriber cannot keep up, it will reconnect if needed
+			close(s.lines)
+			delete(t.subscribers, id)
+		}
+	}
+}
+
+// getRecentLines returns up to limit buffered lines with at least the specified level
+func (t *logTailer) getRecentLines(minLevel LogLevel, limit int) []LogLine {
+	var result []LogLine
+	for i := 1; i <= t.size && len(result) < limit; i++ {
+		line := t.lines[(t.next-i+len(t.lines))%len(t.lines)]
+		if line.Level >= minLevel {
+			result = append(result, line)
+		}
+	}
+	// oldest first
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+func (t *logTailer) subscribe(minLevel LogLevel, limit int) (int64, []LogLine, <-chan LogLine, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.queue == nil {
+		return 0, nil, nil, errLogTailerDisabled
+	}
+	t.lastID++
+	s := &logTailSubscriber{
+		minLevel: minLevel,
+		lines:    make(chan LogLine, logTailerSubscriberBufferSize),
+	}
+	t.subscribers[t.lastID] = s
+	return t.lastID, t.getRecentLines(minLevel, limit), s.lines, nil
+}
+
+func (t *logTailer) unsubscribe(id int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if s, ok := t.subscribers[id]; ok {
+		close(s.lines)
+		delete(t.subscribers, id)
+	}
+}
+
+func (t *logTailer) isEnabled() bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.queue != nil
+}
+
+func getLogLineLevel(data []byte) LogLevel {
+	var line struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(data, &line); err != nil {
+		return LevelInfo
+	}
+	level, err := zerolog.ParseLevel(line.Level)
+	if err != nil {
+		return LevelInfo
+	}
+	switch {
+	case level <= zerolog.DebugLevel:
+		return LevelDebug
+	case level == zerolog.WarnLevel:
+		return LevelWarn
+	case level >= zerolog.ErrorLevel && level <= zerolog.PanicLevel:
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// SetLogTailerBufferSize sets the number of recent log lines kept in memory
+// and enables the log tailer. 0 disables the log tailer.
+// The existing subscribers are removed if the size changes
+func SetLogTailerBufferSize(size int) {
+	logTail.setBufferSize(size)
+}
+
+// IsLogTailerEnabled returns true if the log tailer is enabled
+func IsLogTailerEnabled() bool {
+	return logTail.isEnabled()
+}
+
+// SubscribeLogs returns up to limit recent log lines and a channel to receive
+// the new ones. Only the lines with at least the specified level are returned.
+// The channel is closed if the subscriber cannot keep up
+func SubscribeLogs(minLevel LogLevel, limit int) (int64, []LogLine, <-chan LogLine, error) {
+	return logTail.subscribe(minLevel, limit)
+}
+
+// UnsubscribeLogs removes the log subscriber with the specified id
+func UnsubscribeLogs(id int64) {
+	logTail.unsubscribe(id)
+}
+
+// logTailWriter writes to the configured output and to the log tailer
+type logTailWriter struct {
+	output io.Writer
+}
+
+func newLogTailWriter(output io.Writer) *logTailWriter {
+	return &logTailWriter{
+		output: output,
+	}
+}
+
+func (w *logTailWriter) Write(p []byte) (int, error) {
+	n, err := w.output.Write(p)
+	logTail.write(p)
+	return n, err
+}
+
+// WriteLevel implements zerolog.LevelWriter, some outputs, such as journald, need the level
+func (w *logTailWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var n int
+	var err error
+	if lw, ok := w.output.(zerolog.LevelWriter); ok {
+		n, err = lw.WriteLevel(level, p)
+	} else {
+		n, err = w.output.Write(p)
+	}
+	logTail.write(p)
+	return n, err
+}
@@ -483,6 +483,18 @@ var (
 		Help: "The total number of GCS head object errors",
 	})
 
+	// totalGCSPubSubPublish is the metric that reports the total successful Pub/Sub upload notifications
+	totalGCSPubSubPublish = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_gcs_pubsub_publish",
+		Help: "The total number of successful Pub/Sub upload notifications",
+	})
+
+	// totalGCSPubSubPublishErrors is the metric that reports the total Pub/Sub upload notification errors
+	totalGCSPubSubPublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_gcs_pubsub_publish_errors",
+		Help: "The total number of Pub/Sub upload notification errors",
+	})
+
 	// totalAZUploads is the metric that reports the total number of successful Azure uploads
 	totalAZUploads = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "sftpgo_az_uploads_total",
@@ -638,6 +650,44 @@ var (
 		Name: "sftpgo_httpfs_download_size",
 		Help: "The total HTTPFs download size as bytes, partial downloads are included",
 	})
+
+	// totalDirListCacheHits is the metric that reports the total number of directory listings served from the cache
+	totalDirListCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_dir_list_cache_hits_total",
+		Help: "The total number of directory listings served from the cache",
+	})
+
+	// totalDirListCacheMisses is the metric that reports the total number of directory listings not found in the cache
+	totalDirListCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_dir_list_cache_misses_total",
+		Help: "The total number of directory listings not found in the cache",
+	})
+
+	// totalDirListPrefetched is the metric that reports the total number of pre-fetched directory listings
+	totalDirListPrefetched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_dir_list_prefetched_total",
+		Help: "The total number of pre-fetched directory listings",
+	})
+
+	// totalDirListPrefetchHits is the metric that reports the total number of pre-fetched directory listings
+	// served from the cache
+	totalDirListPrefetchHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_dir_list_prefetch_hits_total",
+		Help: "The total number of pre-fetched directory listings served from the cache",
+	})
+
+	// hookCircuitBreakerState is the metric that reports the circuit breaker state for each configured hook
+	hookCircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sftpgo_hook_circuit_breaker_state",
+		Help: "Circuit breaker state for the configured hooks, 0 means closed, 1 half-open, 2 open",
+	}, []string{"hook"})
+
+	// totalSessionLimitRejections is the metric that reports the total number of connections
+	// rejected because the user reached the maximum number of concurrent sessions
+	totalSessionLimitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_user_session_limit_rejections_total",
+		Help: "The total number of connections rejected because the user has too many open sessions",
+	})
 )
 
 // AddMetricsEndpoint exposes metrics to the specified endpoint
@@ -787,6 +837,15 @@ func GCSHeadObjectCompleted(err error) {
 	}
 }
 
+// GCSPubSubPublishCompleted updates metrics after a Pub/Sub upload notification terminates
+func GCSPubSubPublishCompleted(err error) {
+	if err == nil {
+		totalGCSPubSubPublish.Inc()
+	} else {
+		totalGCSPubSubPublishErrors.Inc()
+	}
+}
+
 // AZTransferCompleted updates metrics after a Azure upload or a download
 func AZTransferCompleted(bytes int64, transferKind int, err error) {
 	if transferKind == 0 {
@@ -1006,3 +1065,33 @@ func HTTPRequestServed(status int) {
 func UpdateActiveConnectionsSize(size int) {
 	activeConnections.Set(float64(size))
 }
+
+// DirListCacheLookup increments the metrics for directory listings cache lookups
+func DirListCacheLookup(hit bool) {
+	if hit {
+		totalDirListCacheHits.Inc()
+	} else {
+		totalDirListCacheMisses.Inc()
+	}
+}
+
+// AddDirListPrefetched increments the metric for pre-fetched directory listings
+func AddDirListPrefetched() {
+	totalDirListPrefetched.Inc()
+}
+
+// AddDirListPrefetchHit increments the metric for pre-fetched directory listings served from the cache
+func AddDirListPrefetchHit() {
+	totalDirListPrefetchHits.Inc()
+}
+
+// UpdateHookCircuitBreakerState sets the metric for the circuit breaker state of the specified hook
+func UpdateHookCircuitBreakerState(hook string, state int) {
+	hookCircuitBreakerState.WithLabelValues(hook).Set(float64(state))
+}
+
+// AddSessionLimitRejection increments the metric for the connections rejected
+// because the user has too many open sessions
+func AddSessionLimitRejection() {
+	totalSessionLimitRejections.Inc()
+}
@@ -49,6 +49,9 @@ func GCSDeleteObjectCompleted(_ error) {}
 // GCSHeadBucketCompleted updates metrics after a GCS head bucket request terminates
 func GCSHeadBucketCompleted(_ error) {}
 
+// GCSPubSubPublishCompleted updates metrics after a Pub/Sub upload notification terminates
+func GCSPubSubPublishCompleted(_ error) {}
+
 // HTTPFsTransferCompleted updates metrics after an HTTPFs upload or a download
 func HTTPFsTransferCompleted(_ int64, _ int, _ error) {}
 
@@ -73,3 +76,19 @@ func HTTPRequestServed(_ int) {}
 
 // UpdateActiveConnectionsSize sets the metric for active connections
 func UpdateActiveConnectionsSize(_ int) {}
+
+// DirListCacheLookup increments the metrics for directory listings cache lookups
+func DirListCacheLookup(_ bool) {}
+
+// AddDirListPrefetched increments the metric for pre-fetched directory listings
+func AddDirListPrefetched() {}
+
+// AddDirListPrefetchHit increments the metric for pre-fetched directory listings served from the cache
+func AddDirListPrefetchHit() {}
+
+// UpdateHookCircuitBreakerState sets the metric for the circuit breaker state of the specified hook
+func UpdateHookCircuitBreakerState(_ string, _ int) {}
+
+// AddSessionLimitRejection increments the metric for the connections rejected
+// because the user has too many open sessions
+func AddSessionLimitRejection() {}
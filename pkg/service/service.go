@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -34,7 +35,8 @@ import (
 )
 
 const (
-	logSender = "service"
+	logSender             = "service"
+	transfersCloseTimeout = 10 * time.Second
 )
 
 var (
@@ -318,9 +320,13 @@ func (s *Service) LoadInitialData() error {
 	if err != nil {
 		return fmt.Errorf("unable to stat file %#v: %w", s.LoadDataFrom, err)
 	}
-	if info.Size() > httpd.MaxRestoreSize {
+	maxRestoreSize := config.GetHTTPDConfig().RequestSizeLimits.UserBulkImport
+	if maxRestoreSize <= 0 {
+		maxRestoreSize = httpd.DefaultUserBulkImportSizeLimit
+	}
+	if info.Size() > maxRestoreSize {
 		return fmt.Errorf("unable to restore input file %#v size too big: %v/%v bytes",
-			s.LoadDataFrom, info.Size(), httpd.MaxRestoreSize)
+			s.LoadDataFrom, info.Size(), maxRestoreSize)
 	}
 	content, err := os.ReadFile(s.LoadDataFrom)
 	if err != nil {
@@ -385,6 +391,21 @@ func (s *Service) restoreDump(dump *dataprovider.BackupData) error {
 	return nil
 }
 
+// gracefulShutdown waits, up to the configured grace time, for the in-flight
+// transfers, then releases the plugins and closes the data provider.
+// Transfers forcibly closed after the grace time update quota and usage using
+// the data provider, so we wait for them to exit before closing it
+func gracefulShutdown() {
+	common.WaitForTransfers(graceTime)
+	if graceTime > 0 {
+		common.WaitForTransfersClosed(transfersCloseTimeout)
+	}
+	plugin.Handler.Cleanup()
+	if err := dataprovider.Close(); err != nil {
+		logger.Warn(logSender, "", "unable to close the data provider: %v", err)
+	}
+}
+
 // SetGraceTime sets the grace time
 func SetGraceTime(val int) {
 	graceTime = val
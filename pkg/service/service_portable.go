@@ -29,13 +29,11 @@ import (
 	"github.com/grandcat/zeroconf"
 	"github.com/sftpgo/sdk"
 
-	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/config"
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/ftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
-	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 	"github.com/drakkan/sftpgo/v2/pkg/sftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 	"github.com/drakkan/sftpgo/v2/pkg/version"
@@ -240,8 +238,7 @@ func (s *Service) advertiseServices(advertiseService, advertiseCredentials bool)
 			logger.InfoToConsole("unregistering multicast DNS WebDAV service")
 			mDNSServiceDAV.Shutdown()
 		}
-		plugin.Handler.Cleanup()
-		common.WaitForTransfers(graceTime)
+		gracefulShutdown()
 		s.Stop()
 	}()
 }
@@ -313,6 +310,8 @@ func (s *Service) configurePortableSecrets() {
 		s.PortableUser.FsConfig.HTTPConfig.Password = getSecretFromString(payload)
 		payload = s.PortableUser.FsConfig.HTTPConfig.APIKey.GetPayload()
 		s.PortableUser.FsConfig.HTTPConfig.APIKey = getSecretFromString(payload)
+		payload = s.PortableUser.FsConfig.HTTPConfig.SigningKey.GetPayload()
+		s.PortableUser.FsConfig.HTTPConfig.SigningKey = getSecretFromString(payload)
 	}
 }
 
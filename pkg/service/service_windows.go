@@ -30,7 +30,6 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/ftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/httpd"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
-	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 	"github.com/drakkan/sftpgo/v2/pkg/sftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/telemetry"
 	"github.com/drakkan/sftpgo/v2/pkg/webdavd"
@@ -128,8 +127,7 @@ loop:
 			changes <- svc.Status{State: svc.StopPending}
 			wasStopped <- true
 			s.Service.Stop()
-			plugin.Handler.Cleanup()
-			common.WaitForTransfers(graceTime)
+			gracefulShutdown()
 			break loop
 		case svc.ParamChange:
 			logger.Debug(logSender, "", "Received reload request")
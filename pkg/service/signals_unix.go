@@ -27,7 +27,6 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/ftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/httpd"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
-	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 	"github.com/drakkan/sftpgo/v2/pkg/sftpd"
 	"github.com/drakkan/sftpgo/v2/pkg/telemetry"
 	"github.com/drakkan/sftpgo/v2/pkg/webdavd"
@@ -92,7 +91,6 @@ func handleSIGUSR1() {
 
 func handleInterrupt() {
 	logger.Debug(logSender, "", "Received interrupt request")
-	plugin.Handler.Cleanup()
-	common.WaitForTransfers(graceTime)
+	gracefulShutdown()
 	os.Exit(0)
 }
@@ -18,9 +18,7 @@ import (
 	"os"
 	"os/signal"
 
-	"github.com/drakkan/sftpgo/v2/pkg/common"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
-	"github.com/drakkan/sftpgo/v2/pkg/plugin"
 )
 
 func registerSignals() {
@@ -29,8 +27,7 @@ func registerSignals() {
 	go func() {
 		for range c {
 			logger.Debug(logSender, "", "Received interrupt request")
-			plugin.Handler.Cleanup()
-			common.WaitForTransfers(graceTime)
+			gracefulShutdown()
 			os.Exit(0)
 		}
 	}()
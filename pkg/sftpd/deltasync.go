@@ -0,0 +1,187 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+const (
+	deltaSyncExtension  = "delta-sync@sftpgo.com"
+	deltaSyncMaxEntries = 10000
+)
+
+// deltaSyncEntry defines a file as seen by the client
+type deltaSyncEntry struct {
+	Path string
+	Size int64
+	// modification time as unix timestamp in seconds
+	MTime int64
+	// hex encoded SHA-256, if empty size and modification time are compared
+	SHA256 string
+}
+
+func unmarshalDeltaSyncRequest(data []byte) ([]deltaSyncEntry, error) {
+	count, data, err := unmarshalSFTPUint32(data)
+	if err != nil {
+		return nil, err
+	}
+	if count > deltaSyncMaxEntries {
+		return nil, fmt.Errorf("too many delta sync entries: %d, max allowed: %d", count, deltaSyncMaxEntries)
+	}
+	entries := make([]deltaSyncEntry, 0, count)
+	for idx := uint32(0); idx < count; idx++ {
+		var entry deltaSyncEntry
+		var size, mtime uint64
+
+		if entry.Path, data, err = unmarshalSFTPString(data); err != nil {
+			return nil, err
+		}
+		if size, data, err = unmarshalSFTPUint64(data); err != nil {
+			return nil, err
+		}
+		if mtime, data, err = unmarshalSFTPUint64(data); err != nil {
+			return nil, err
+		}
+		if entry.SHA256, data, err = unmarshalSFTPString(data); err != nil {
+			return nil, err
+		}
+		entry.Size = int64(size)
+		entry.MTime = int64(mtime)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func getDeltaSyncReply(id uint32, changed []string) []byte {
+	reply := []byte{sshFxpExtendedReply}
+	reply = marshalSFTPUint32(reply, id)
+	reply = marshalSFTPUint32(reply, uint32(len(changed)))
+	for _, p := range changed {
+		reply = marshalSFTPString(reply, p)
+	}
+	return reply
+}
+
+// handleDeltaSync handles the delta-sync@sftpgo.com extended requests. The request
+// contains the files as seen by the client, the reply contains the paths that
+// differ on the server side, so clients can avoid to stat each file before
+// deciding to transfer it
+func (c *Connection) handleDeltaSync(id uint32, data []byte) []byte {
+	c.UpdateLastActivity()
+
+	entries, err := unmarshalDeltaSyncRequest(data)
+	if err != nil {
+		c.Log(logger.LevelWarn, "invalid delta sync request: %v", err)
+		return getSFTPStatusReply(id, fmt.Errorf("%w: %v", sftp.ErrSSHFxBadMessage, err))
+	}
+	changed, err := c.getDeltaSyncChangedPaths(entries)
+	if err != nil {
+		c.Log(logger.LevelDebug, "unable to complete the delta sync: %v", err)
+		return getSFTPStatusReply(id, err)
+	}
+	c.Log(logger.LevelDebug, "delta sync completed, entries: %d, changed: %d", len(entries), len(changed))
+	return getDeltaSyncReply(id, changed)
+}
+
+// getDeltaSyncChangedPaths returns the changed paths as sent by the client
+func (c *Connection) getDeltaSyncChangedPaths(entries []deltaSyncEntry) ([]string, error) {
+	type fsEntries struct {
+		fsPaths []string
+		indexes []int
+	}
+
+	fsPaths := make(map[vfs.Fs]*fsEntries)
+	var fsOrder []vfs.Fs
+
+	for idx, entry := range entries {
+		virtualPath, err := c.getExtensionRequestPath(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, virtualPath) {
+			return nil, c.GetPermissionDeniedError()
+		}
+		if ok, policy := c.User.IsFileAllowed(virtualPath); !ok {
+			return nil, c.GetErrorForDeniedFile(policy)
+		}
+		fs, fsPath, err := c.GetFsAndResolvedPath(virtualPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fsPaths[fs]; !ok {
+			fsPaths[fs] = &fsEntries{}
+			fsOrder = append(fsOrder, fs)
+		}
+		fsPaths[fs].fsPaths = append(fsPaths[fs].fsPaths, fsPath)
+		fsPaths[fs].indexes = append(fsPaths[fs].indexes, idx)
+	}
+
+	isChanged := make([]bool, len(entries))
+	for _, fs := range fsOrder {
+		group := fsPaths[fs]
+		infos, err := fs.BatchStat(group.fsPaths)
+		if err != nil {
+			return nil, c.GetFsError(fs, err)
+		}
+		for i, info := range infos {
+			idx := group.indexes[i]
+			changed, err := isDeltaSyncEntryChanged(fs, group.fsPaths[i], info, entries[idx])
+			if err != nil {
+				return nil, c.GetFsError(fs, err)
+			}
+			isChanged[idx] = changed
+		}
+	}
+
+	var result []string
+	added := make(map[string]bool)
+	for idx, changed := range isChanged {
+		if changed && !added[entries[idx].Path] {
+			added[entries[idx].Path] = true
+			result = append(result, entries[idx].Path)
+		}
+	}
+	return result, nil
+}
+
+func isDeltaSyncEntryChanged(fs vfs.Fs, fsPath string, info os.FileInfo, entry deltaSyncEntry) (bool, error) {
+	if info == nil || !info.Mode().IsRegular() {
+		return true, nil
+	}
+	if vfs.IsCryptOsFs(fs) {
+		info = fs.(*vfs.CryptFs).ConvertFileInfo(info)
+	}
+	if info.Size() != entry.Size {
+		return true, nil
+	}
+	if entry.SHA256 == "" {
+		return info.ModTime().Unix() != entry.MTime, nil
+	}
+	hash, err := computeHashForFile(fs, sha256.New(), fsPath)
+	if err != nil {
+		return false, err
+	}
+	return !strings.EqualFold(hash, entry.SHA256), nil
+}
@@ -0,0 +1,373 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+const (
+	dirSyncExtension       = "dir-sync@sftpgo.com"
+	dirSyncMaxEntries      = 10000
+	dirSyncHashConcurrency = 8
+	dirSyncCacheSize       = 100
+)
+
+var dirSyncManifests = newDirSyncManifestCache(dirSyncCacheSize)
+
+// dirSyncEntry defines a file inside a synchronized directory
+type dirSyncEntry struct {
+	// path relative to the synchronized directory, "/" separated
+	Path string
+	// hex encoded SHA-256
+	SHA256 string
+	// modification time as unix timestamp in seconds
+	MTime int64
+	Size  int64
+}
+
+// dirSyncFile defines a file to include in the server side manifest
+type dirSyncFile struct {
+	entry   dirSyncEntry
+	modTime time.Time
+	fs      vfs.Fs
+	fsPath  string
+}
+
+// dirSyncManifest defines the server side manifest for a directory, the etag
+// changes if a file is added, removed or modified
+type dirSyncManifest struct {
+	key     string
+	etag    string
+	entries map[string]dirSyncEntry
+}
+
+// dirSyncResult defines the differences between the client and the server manifests
+type dirSyncResult struct {
+	// files to upload, the client has them and the server does not have them or they differ
+	toUpload []dirSyncEntry
+	// files to download, the server has them and the client does not have them
+	toDownload []dirSyncEntry
+	// files with different contents and different modification times
+	conflicts []dirSyncEntry
+}
+
+func (r *dirSyncResult) getReply(id uint32) []byte {
+	reply := []byte{sshFxpExtendedReply}
+	reply = marshalSFTPUint32(reply, id)
+	for _, entries := range [][]dirSyncEntry{r.toUpload, r.toDownload, r.conflicts} {
+		reply = marshalSFTPUint32(reply, uint32(len(entries)))
+		for _, entry := range entries {
+			reply = marshalSFTPString(reply, entry.Path)
+			reply = marshalSFTPString(reply, entry.SHA256)
+			reply = marshalSFTPUint64(reply, uint64(entry.MTime))
+			reply = marshalSFTPUint64(reply, uint64(entry.Size))
+		}
+	}
+	return reply
+}
+
+// dirSyncManifestCache caches the server side manifests, the file hashes are
+// computed again only if the directory etag changes
+type dirSyncManifestCache struct {
+	sync.Mutex
+	maxSize int
+	items   map[string]*list.Element
+	lru     *list.List
+}
+
+func newDirSyncManifestCache(maxSize int) *dirSyncManifestCache {
+	return &dirSyncManifestCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *dirSyncManifestCache) get(key, etag string) (*dirSyncManifest, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	manifest := elem.Value.(*dirSyncManifest)
+	if manifest.etag != etag {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return manifest, true
+}
+
+func (c *dirSyncManifestCache) add(manifest *dirSyncManifest) {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, ok := c.items[manifest.key]; ok {
+		elem.Value = manifest
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[manifest.key] = c.lru.PushFront(manifest)
+	for c.lru.Len() > c.maxSize {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.items, elem.Value.(*dirSyncManifest).key)
+	}
+}
+
+func unmarshalDirSyncRequest(data []byte) (string, []dirSyncEntry, error) {
+	dirPath, data, err := unmarshalSFTPString(data)
+	if err != nil {
+		return "", nil, err
+	}
+	count, data, err := unmarshalSFTPUint32(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if count > dirSyncMaxEntries {
+		return "", nil, fmt.Errorf("too many dir sync entries: %d, max allowed: %d", count, dirSyncMaxEntries)
+	}
+	entries := make([]dirSyncEntry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var entry dirSyncEntry
+		var mtime, size uint64
+
+		if entry.Path, data, err = unmarshalSFTPString(data); err != nil {
+			return "", nil, err
+		}
+		if entry.SHA256, data, err = unmarshalSFTPString(data); err != nil {
+			return "", nil, err
+		}
+		if mtime, data, err = unmarshalSFTPUint64(data); err != nil {
+			return "", nil, err
+		}
+		if size, data, err = unmarshalSFTPUint64(data); err != nil {
+			return "", nil, err
+		}
+		entry.Path = strings.TrimPrefix(path.Clean("/"+entry.Path), "/")
+		if entry.Path == "" {
+			return "", nil, errors.New("invalid empty dir sync path")
+		}
+		entry.MTime = int64(mtime)
+		entry.Size = int64(size)
+		entries = append(entries, entry)
+	}
+	return dirPath, entries, nil
+}
+
+// compareDirSyncManifests returns the differences between the client and the server manifests.
+// The client entries are returned for the files to upload and the server ones otherwise
+func compareDirSyncManifests(local []dirSyncEntry, remote map[string]dirSyncEntry) dirSyncResult {
+	var result dirSyncResult
+
+	localPaths := make(map[string]bool)
+	for _, entry := range local {
+		if localPaths[entry.Path] {
+			continue
+		}
+		localPaths[entry.Path] = true
+		remoteEntry, ok := remote[entry.Path]
+		switch {
+		case !ok:
+			result.toUpload = append(result.toUpload, entry)
+		case strings.EqualFold(entry.SHA256, remoteEntry.SHA256):
+			continue
+		case entry.MTime == remoteEntry.MTime:
+			result.toUpload = append(result.toUpload, entry)
+		default:
+			result.conflicts = append(result.conflicts, remoteEntry)
+		}
+	}
+	for p, entry := range remote {
+		if !localPaths[p] {
+			result.toDownload = append(result.toDownload, entry)
+		}
+	}
+	sort.Slice(result.toDownload, func(i, j int) bool {
+		return result.toDownload[i].Path < result.toDownload[j].Path
+	})
+	return result
+}
+
+func getDirSyncETag(files []dirSyncFile) string {
+	h := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", file.entry.Path, file.entry.Size, file.modTime.UnixNano())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// hashDirSyncFiles computes the SHA-256 for the specified files using at
+// most dirSyncHashConcurrency parallel calls
+func hashDirSyncFiles(files []dirSyncFile) error {
+	guard := make(chan struct{}, dirSyncHashConcurrency)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var hashError error
+
+	for idx := range files {
+		guard <- struct{}{}
+		wg.Add(1)
+		go func(file *dirSyncFile) {
+			defer func() {
+				<-guard
+				wg.Done()
+			}()
+
+			hash, err := computeHashForFile(file.fs, sha256.New(), file.fsPath)
+			if err != nil {
+				errOnce.Do(func() {
+					hashError = fmt.Errorf("unable to compute the hash for %q: %w", file.entry.Path, err)
+				})
+				return
+			}
+			file.entry.SHA256 = hash
+		}(&files[idx])
+	}
+
+	wg.Wait()
+	close(guard)
+
+	return hashError
+}
+
+// getDirSyncFiles recursively lists the specified virtual directory. Files and
+// directories that the user cannot download or list are not included
+func (c *Connection) getDirSyncFiles(virtualPath, relPath string, files []dirSyncFile) ([]dirSyncFile, error) {
+	contents, err := c.ListDir(virtualPath)
+	if err != nil {
+		return nil, err
+	}
+	canDownload := c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, virtualPath)
+	for _, info := range contents {
+		filePath := path.Join(virtualPath, info.Name())
+		if info.IsDir() {
+			if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, filePath) {
+				continue
+			}
+			dirFiles, err := c.getDirSyncFiles(filePath, path.Join(relPath, info.Name()), files)
+			if err != nil {
+				if errors.Is(err, sftp.ErrSSHFxNoSuchFile) {
+					// removed while listing
+					continue
+				}
+				return nil, err
+			}
+			files = dirFiles
+			continue
+		}
+		if !info.Mode().IsRegular() || !canDownload {
+			continue
+		}
+		if ok, _ := c.User.IsFileAllowed(filePath); !ok {
+			continue
+		}
+		fs, fsPath, err := c.GetFsAndResolvedPath(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) >= dirSyncMaxEntries {
+			return nil, fmt.Errorf("%w: too many files to synchronize, max allowed: %d", sftp.ErrSSHFxFailure,
+				dirSyncMaxEntries)
+		}
+		files = append(files, dirSyncFile{
+			entry: dirSyncEntry{
+				Path:  path.Join(relPath, info.Name()),
+				MTime: info.ModTime().Unix(),
+				Size:  info.Size(),
+			},
+			modTime: info.ModTime(),
+			fs:      fs,
+			fsPath:  fsPath,
+		})
+	}
+	return files, nil
+}
+
+// getDirSyncManifest returns the server side manifest for the specified virtual directory.
+// A missing directory has an empty manifest
+func (c *Connection) getDirSyncManifest(virtualPath string) (*dirSyncManifest, error) {
+	files, err := c.getDirSyncFiles(virtualPath, "", nil)
+	if err != nil {
+		if !errors.Is(err, sftp.ErrSSHFxNoSuchFile) {
+			return nil, err
+		}
+		files = nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].entry.Path < files[j].entry.Path
+	})
+	key := c.User.Username + ":" + virtualPath
+	etag := getDirSyncETag(files)
+	if manifest, ok := dirSyncManifests.get(key, etag); ok {
+		c.Log(logger.LevelDebug, "using the cached dir sync manifest for %q, etag %q", virtualPath, etag)
+		return manifest, nil
+	}
+	if err := hashDirSyncFiles(files); err != nil {
+		return nil, err
+	}
+	manifest := &dirSyncManifest{
+		key:     key,
+		etag:    etag,
+		entries: make(map[string]dirSyncEntry),
+	}
+	for _, file := range files {
+		manifest.entries[file.entry.Path] = file.entry
+	}
+	dirSyncManifests.add(manifest)
+	return manifest, nil
+}
+
+// handleDirSync handles the dir-sync@sftpgo.com extended requests. The request
+// contains the directory to synchronize and the client manifest, the reply
+// contains the files to upload, to download and the conflicts
+func (c *Connection) handleDirSync(id uint32, data []byte) []byte {
+	c.UpdateLastActivity()
+
+	dirPath, entries, err := unmarshalDirSyncRequest(data)
+	if err != nil {
+		c.Log(logger.LevelWarn, "invalid dir sync request: %v", err)
+		return getSFTPStatusReply(id, fmt.Errorf("%w: %v", sftp.ErrSSHFxBadMessage, err))
+	}
+	virtualPath, err := c.getExtensionRequestPath(dirPath)
+	if err != nil {
+		return getSFTPStatusReply(id, err)
+	}
+	manifest, err := c.getDirSyncManifest(virtualPath)
+	if err != nil {
+		c.Log(logger.LevelError, "unable to get the dir sync manifest for %q: %v", virtualPath, err)
+		return getSFTPStatusReply(id, err)
+	}
+	result := compareDirSyncManifests(entries, manifest.entries)
+	c.Log(logger.LevelDebug, "dir sync completed for %q, client entries: %d, to upload: %d, to download: %d, conflicts: %d",
+		virtualPath, len(entries), len(result.toUpload), len(result.toDownload), len(result.conflicts))
+	return result.getReply(id)
+}
@@ -0,0 +1,400 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const (
+	forwardingTypeLocal   = "direct-tcpip"
+	forwardingTypeRemote  = "tcpip-forward"
+	forwardingDialTimeout = 10 * time.Second
+)
+
+var (
+	activeForwardings = &forwardingsCounter{
+		users: make(map[string]int),
+	}
+	errForwardingNotAllowed = errors.New("forwarding to the requested address is not allowed")
+)
+
+// forwardingsCounter tracks the active forwardings for each user
+type forwardingsCounter struct {
+	sync.Mutex
+	users map[string]int
+}
+
+func (c *forwardingsCounter) add(username string, limit int) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	if limit > 0 && c.users[username] >= limit {
+		return false
+	}
+	c.users[username]++
+	return true
+}
+
+func (c *forwardingsCounter) remove(username string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.users[username]--
+	if c.users[username] <= 0 {
+		delete(c.users, username)
+	}
+}
+
+func (c *forwardingsCounter) get(username string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.users[username]
+}
+
+// RFC 4254, section 7.2
+type directTCPIPPayload struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// RFC 4254, section 7.1
+type remoteForwardRequest struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type remoteForwardSuccess struct {
+	BindPort uint32
+}
+
+type forwardedTCPIPPayload struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// portForwarder handles TCP forwarding for an SSH connection
+type portForwarder struct {
+	sync.Mutex
+	conn         ssh.Conn
+	user         *dataprovider.User
+	connectionID string
+	enabled      bool
+	limit        int
+	listeners    map[string]net.Listener
+}
+
+func newPortForwarder(conn ssh.Conn, user *dataprovider.User, connectionID string, enabled bool,
+	limit int,
+) *portForwarder {
+	return &portForwarder{
+		conn:         conn,
+		user:         user,
+		connectionID: connectionID,
+		enabled:      enabled,
+		limit:        limit,
+		listeners:    make(map[string]net.Listener),
+	}
+}
+
+func (f *portForwarder) log(level logger.LogLevel, format string, v ...any) {
+	logger.Log(level, common.ProtocolSSH, f.connectionID, format, v...)
+}
+
+// getDialIP returns the IP address actually used to connect to the specified
+// one: connecting to an unspecified address means connecting to the loopback
+func getDialIP(ip net.IP) net.IP {
+	if !ip.IsUnspecified() {
+		return ip
+	}
+	if ip.To4() != nil {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	return net.IPv6loopback
+}
+
+// resolveTarget returns the IP address to use for the specified host and
+// checks if forwarding is allowed for it. If isBind is false the returned
+// address is used to connect to the target, otherwise it is used to listen
+// for remote forwarding
+func (f *portForwarder) resolveTarget(host string, port uint32, isBind bool) (net.IP, error) {
+	if !f.enabled {
+		return nil, errForwardingNotAllowed
+	}
+	if port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	switch host {
+	case "", "*":
+		host = "0.0.0.0"
+	case "localhost":
+		host = "127.0.0.1"
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !isBind {
+			ip = getDialIP(ip)
+		}
+		if !f.user.IsForwardTargetAllowed(ip, int(port)) {
+			return nil, errForwardingNotAllowed
+		}
+		return ip, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), forwardingDialTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ip := addr.IP
+		if !isBind {
+			ip = getDialIP(ip)
+		}
+		if f.user.IsForwardTargetAllowed(ip, int(port)) {
+			return ip, nil
+		}
+	}
+	return nil, errForwardingNotAllowed
+}
+
+func (f *portForwarder) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload directTCPIPPayload
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		f.log(logger.LevelDebug, "invalid direct-tcpip payload: %v", err)
+		newChannel.Reject(ssh.ConnectionFailed, "invalid payload") //nolint:errcheck
+		return
+	}
+	ip, err := f.resolveTarget(payload.DestAddr, payload.DestPort, false)
+	if err != nil {
+		f.log(logger.LevelInfo, "direct-tcpip to %q port %d rejected for user %q: %v", payload.DestAddr,
+			payload.DestPort, f.user.Username, err)
+		newChannel.Reject(ssh.Prohibited, err.Error()) //nolint:errcheck
+		return
+	}
+	if !activeForwardings.add(f.user.Username, f.limit) {
+		f.log(logger.LevelInfo, "direct-tcpip rejected for user %q, too many active forwardings", f.user.Username)
+		newChannel.Reject(ssh.ResourceShortage, "too many active forwardings") //nolint:errcheck
+		return
+	}
+	destination := net.JoinHostPort(ip.String(), strconv.Itoa(int(payload.DestPort)))
+	targetConn, err := net.DialTimeout("tcp", destination, forwardingDialTimeout)
+	if err != nil {
+		activeForwardings.remove(f.user.Username)
+		f.log(logger.LevelInfo, "unable to connect to direct-tcpip destination %q: %v", destination, err)
+		newChannel.Reject(ssh.ConnectionFailed, "unable to connect to the destination") //nolint:errcheck
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		activeForwardings.remove(f.user.Username)
+		targetConn.Close()
+		f.log(logger.LevelWarn, "could not accept direct-tcpip channel: %v", err)
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	source := net.JoinHostPort(payload.OriginAddr, strconv.Itoa(int(payload.OriginPort)))
+	go func() {
+		defer activeForwardings.remove(f.user.Username)
+
+		f.bridge(channel, targetConn, forwardingTypeLocal, source, destination)
+	}()
+}
+
+func (f *portForwarder) handleGlobalRequests(requests <-chan *ssh.Request) {
+	for req := range requests {
+		switch req.Type {
+		case "tcpip-forward":
+			ok, payload := f.startRemoteForwarding(req.Payload)
+			if req.WantReply {
+				req.Reply(ok, payload) //nolint:errcheck
+			}
+		case "cancel-tcpip-forward":
+			ok := f.cancelRemoteForwarding(req.Payload)
+			if req.WantReply {
+				req.Reply(ok, nil) //nolint:errcheck
+			}
+		default:
+			if req.WantReply {
+				req.Reply(false, nil) //nolint:errcheck
+			}
+		}
+	}
+}
+
+func (f *portForwarder) startRemoteForwarding(data []byte) (bool, []byte) {
+	var req remoteForwardRequest
+	if err := ssh.Unmarshal(data, &req); err != nil {
+		f.log(logger.LevelDebug, "invalid tcpip-forward payload: %v", err)
+		return false, nil
+	}
+	ip, err := f.resolveTarget(req.BindAddr, req.BindPort, true)
+	if err != nil {
+		f.log(logger.LevelInfo, "tcpip-forward on %q port %d rejected for user %q: %v", req.BindAddr, req.BindPort,
+			f.user.Username, err)
+		return false, nil
+	}
+	if !activeForwardings.add(f.user.Username, f.limit) {
+		f.log(logger.LevelInfo, "tcpip-forward rejected for user %q, too many active forwardings", f.user.Username)
+		return false, nil
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(int(req.BindPort))))
+	if err != nil {
+		activeForwardings.remove(f.user.Username)
+		f.log(logger.LevelInfo, "unable to listen for tcpip-forward on %q port %d: %v", req.BindAddr, req.BindPort, err)
+		return false, nil
+	}
+	bindPort := uint32(listener.Addr().(*net.TCPAddr).Port)
+	key := net.JoinHostPort(req.BindAddr, strconv.Itoa(int(bindPort)))
+
+	f.Lock()
+	f.listeners[key] = listener
+	f.Unlock()
+
+	f.log(logger.LevelInfo, "tcpip-forward started for user %q, listening on %q", f.user.Username,
+		listener.Addr().String())
+	go f.acceptRemoteConnections(listener, req.BindAddr, bindPort)
+
+	if req.BindPort == 0 {
+		return true, ssh.Marshal(&remoteForwardSuccess{BindPort: bindPort})
+	}
+	return true, nil
+}
+
+func (f *portForwarder) acceptRemoteConnections(listener net.Listener, bindAddr string, bindPort uint32) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error(logSender, f.connectionID, "panic in acceptRemoteConnections: %#v stack trace: %v", r,
+				string(debug.Stack()))
+		}
+	}()
+	defer activeForwardings.remove(f.user.Username)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			f.log(logger.LevelDebug, "tcpip-forward listener on %q closed: %v", listener.Addr().String(), err)
+			return
+		}
+		// each accepted connection opens a new channel, it counts as a forwarding too
+		if !activeForwardings.add(f.user.Username, f.limit) {
+			f.log(logger.LevelInfo, "forwarded-tcpip from %q rejected for user %q, too many active forwardings",
+				conn.RemoteAddr().String(), f.user.Username)
+			conn.Close()
+			continue
+		}
+		remoteAddr := conn.RemoteAddr().(*net.TCPAddr)
+		payload := forwardedTCPIPPayload{
+			Addr:       bindAddr,
+			Port:       bindPort,
+			OriginAddr: remoteAddr.IP.String(),
+			OriginPort: uint32(remoteAddr.Port),
+		}
+		go func() {
+			defer activeForwardings.remove(f.user.Username)
+
+			channel, requests, err := f.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(&payload))
+			if err != nil {
+				f.log(logger.LevelDebug, "unable to open forwarded-tcpip channel: %v", err)
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+
+			f.bridge(channel, conn, forwardingTypeRemote, conn.RemoteAddr().String(), listener.Addr().String())
+		}()
+	}
+}
+
+func (f *portForwarder) cancelRemoteForwarding(data []byte) bool {
+	var req remoteForwardRequest
+	if err := ssh.Unmarshal(data, &req); err != nil {
+		return false
+	}
+	key := net.JoinHostPort(req.BindAddr, strconv.Itoa(int(req.BindPort)))
+
+	f.Lock()
+	defer f.Unlock()
+
+	listener, ok := f.listeners[key]
+	if !ok {
+		return false
+	}
+	delete(f.listeners, key)
+	listener.Close()
+	return true
+}
+
+// closeListeners closes the remote forwarding listeners, it is called when
+// the SSH connection ends
+func (f *portForwarder) closeListeners() {
+	f.Lock()
+	defer f.Unlock()
+
+	for key, listener := range f.listeners {
+		listener.Close()
+		delete(f.listeners, key)
+	}
+}
+
+// bridge copies data between the SSH channel and the network connection
+// until both sides are closed and then logs the forwarding session
+func (f *portForwarder) bridge(channel ssh.Channel, conn net.Conn, forwardingType, source, destination string) {
+	startTime := time.Now()
+	var bytesFromClient, bytesToClient int64
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+
+		bytesFromClient, _ = io.Copy(conn, channel)
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite() //nolint:errcheck
+		}
+	}()
+	go func() {
+		defer wg.Done()
+
+		bytesToClient, _ = io.Copy(channel, conn)
+		channel.CloseWrite() //nolint:errcheck
+	}()
+	wg.Wait()
+
+	channel.Close()
+	conn.Close()
+	logger.ForwardingLog(forwardingType, f.user.Username, f.connectionID, source, destination, bytesFromClient,
+		bytesToClient, time.Since(startTime).Milliseconds())
+}
@@ -15,6 +15,7 @@
 package sftpd
 
 import (
+	"fmt"
 	"io"
 	"net"
 	"os"
@@ -31,6 +32,15 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
+const (
+	copyFileExtension = "copy-file@sftpgo.com"
+	limitsExtension   = "limits@openssh.com"
+	// limits enforced by the SFTP server, longer reads are truncated
+	sftpMaxPacketLength = 256 * 1024
+	sftpMaxReadLength   = 32 * 1024
+	sftpMaxWriteLength  = sftpMaxPacketLength - 1024
+)
+
 // Connection details for an authenticated user
 type Connection struct {
 	*common.BaseConnection
@@ -74,9 +84,12 @@ func (c *Connection) GetCommand() string {
 func (c *Connection) Fileread(request *sftp.Request) (io.ReaderAt, error) {
 	c.UpdateLastActivity()
 
-	if !c.User.HasPerm(dataprovider.PermDownload, path.Dir(request.Filepath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(request.Filepath)) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
+	if err := c.checkOpenHandles(); err != nil {
+		return nil, err
+	}
 	transferQuota := c.GetTransferQuota()
 	if !transferQuota.HasDownloadSpace() {
 		c.Log(logger.LevelInfo, "denying file read due to quota limits")
@@ -124,18 +137,25 @@ func (c *Connection) Filewrite(request *sftp.Request) (io.WriterAt, error) {
 func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReaderAt, error) {
 	c.UpdateLastActivity()
 
-	if ok, _ := c.User.IsFileAllowed(request.Filepath); !ok {
-		c.Log(logger.LevelWarn, "writing file %#v is not allowed", request.Filepath)
+	virtualPath, err := c.GetUploadTargetPath(request.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if ok, _ := c.User.IsFileAllowed(virtualPath); !ok {
+		c.Log(logger.LevelWarn, "writing file %#v is not allowed", virtualPath)
 		return nil, c.GetPermissionDeniedError()
 	}
+	if err := c.checkOpenHandles(); err != nil {
+		return nil, err
+	}
 
-	fs, p, err := c.GetFsAndResolvedPath(request.Filepath)
+	fs, p, err := c.GetFsAndResolvedPath(virtualPath)
 	if err != nil {
 		return nil, err
 	}
 
 	filePath := p
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		filePath = fs.GetAtomicUploadPath(p)
 	}
 
@@ -144,7 +164,7 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 		// read and write mode is only supported for local filesystem
 		errForRead = sftp.ErrSSHFxOpUnsupported
 	}
-	if !c.User.HasPerm(dataprovider.PermDownload, path.Dir(request.Filepath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(virtualPath)) {
 		// we can try to read only for local fs here, see above.
 		// os.ErrPermission will become sftp.ErrSSHFxPermissionDenied when sent to
 		// the client
@@ -153,10 +173,10 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 
 	stat, statErr := fs.Lstat(p)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || fs.IsNotExist(statErr) {
-		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(request.Filepath)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(virtualPath)) {
 			return nil, sftp.ErrSSHFxPermissionDenied
 		}
-		return c.handleSFTPUploadToNewFile(fs, request.Pflags(), p, filePath, request.Filepath, errForRead)
+		return c.handleSFTPUploadToNewFile(fs, request.Pflags(), p, filePath, virtualPath, errForRead)
 	}
 
 	if statErr != nil {
@@ -170,11 +190,11 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 		return nil, sftp.ErrSSHFxOpUnsupported
 	}
 
-	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(request.Filepath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(virtualPath)) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
 
-	return c.handleSFTPUploadToExistingFile(fs, request.Pflags(), p, filePath, stat.Size(), request.Filepath, errForRead)
+	return c.handleSFTPUploadToExistingFile(fs, request.Pflags(), p, filePath, stat.Size(), virtualPath, errForRead)
 }
 
 // Filecmd hander for basic SFTP system calls related to files, but not anything to do with reading
@@ -200,6 +220,10 @@ func (c *Connection) Filecmd(request *sftp.Request) error {
 		if err := c.CreateSymlink(request.Filepath, request.Target); err != nil {
 			return err
 		}
+	case "Link":
+		if err := c.CreateHardlink(request.Filepath, request.Target); err != nil {
+			return err
+		}
 	case "Remove":
 		return c.handleSFTPRemove(request)
 	default:
@@ -216,7 +240,7 @@ func (c *Connection) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
 
 	switch request.Method {
 	case "List":
-		files, err := c.ListDir(request.Filepath)
+		files, err := c.ListDirCached(request.Filepath)
 		if err != nil {
 			return nil, err
 		}
@@ -227,7 +251,7 @@ func (c *Connection) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
 		files = util.PrependFileInfo(files, vfs.NewFileInfo(".", true, 0, modTime, false))
 		return listerAt(files), nil
 	case "Stat":
-		if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
 			return nil, sftp.ErrSSHFxPermissionDenied
 		}
 
@@ -269,7 +293,7 @@ func (c *Connection) Readlink(filePath string) (string, error) {
 func (c *Connection) Lstat(request *sftp.Request) (sftp.ListerAt, error) {
 	c.UpdateLastActivity()
 
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
 
@@ -283,7 +307,7 @@ func (c *Connection) Lstat(request *sftp.Request) (sftp.ListerAt, error) {
 
 // RealPath implements the RealPathFileLister interface
 func (c *Connection) RealPath(p string) (string, error) {
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(p)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(p)) {
 		return "", sftp.ErrSSHFxPermissionDenied
 	}
 
@@ -338,8 +362,107 @@ func (c *Connection) StatVFS(r *sftp.Request) (*sftp.StatVFS, error) {
 	return c.getStatVFSFromQuotaResult(fs, p, quotaResult)
 }
 
+// checkOpenHandles returns an error if the user cannot open more files
+// within this session. The error is sent to the client as SSH_FX_FAILURE
+func (c *Connection) checkOpenHandles() error {
+	maxHandles := c.User.Filters.MaxOpenHandles
+	if maxHandles <= 0 {
+		return nil
+	}
+	if openHandles := len(c.GetTransfers()); openHandles >= maxHandles {
+		c.Log(logger.LevelInfo, "denying file open, open handles: %d, max allowed: %d", openHandles, maxHandles)
+		return fmt.Errorf("too many open handles, the maximum allowed is %d", maxHandles)
+	}
+	return nil
+}
+
+// handleLimits handles the limits@openssh.com extended requests. The reply
+// contains the maximum packet, read and write lengths and the maximum number
+// of open handles, 0 means no limit
+func (c *Connection) handleLimits(id uint32, _ []byte) []byte {
+	c.UpdateLastActivity()
+
+	maxHandles := c.User.Filters.MaxOpenHandles
+	if maxHandles < 0 {
+		maxHandles = 0
+	}
+	reply := []byte{sshFxpExtendedReply}
+	reply = marshalSFTPUint32(reply, id)
+	reply = marshalSFTPUint64(reply, sftpMaxPacketLength)
+	reply = marshalSFTPUint64(reply, sftpMaxReadLength)
+	reply = marshalSFTPUint64(reply, sftpMaxWriteLength)
+	return marshalSFTPUint64(reply, uint64(maxHandles))
+}
+
+// getSFTPExtensionHandlers returns the handlers for the SFTP extensions not
+// supported by the SFTP server
+func (c *Connection) getSFTPExtensionHandlers() map[string]sftpExtensionHandler {
+	return map[string]sftpExtensionHandler{
+		copyFileExtension:  c.handleCopyFile,
+		deltaSyncExtension: c.handleDeltaSync,
+		dirSyncExtension:   c.handleDirSync,
+		limitsExtension:    c.handleLimits,
+	}
+}
+
+// getExtensionRequestPath returns the virtual path for a path included in an
+// extended request handled outside the SFTP server. Relative paths are resolved
+// against the start directory and the folder prefix, if any, is removed
+func (c *Connection) getExtensionRequestPath(p string) (string, error) {
+	if c.User.Filters.StartDirectory == "" {
+		p = util.CleanPath(p)
+	} else {
+		p = util.CleanPathWithBase(c.User.Filters.StartDirectory, p)
+	}
+	if c.folderPrefix == "" {
+		return p, nil
+	}
+	if getPrefixHierarchy(c.folderPrefix, p) != pathContainsPrefix {
+		return "", sftp.ErrSSHFxPermissionDenied
+	}
+	prefix := prefixMiddleware{prefix: c.folderPrefix}
+	p, _ = prefix.removeFolderPrefix(p)
+	return p, nil
+}
+
+// handleCopyFile handles the copy-file@sftpgo.com extended requests. The request
+// contains the source and the target path, directories are copied recursively
+func (c *Connection) handleCopyFile(id uint32, data []byte) []byte {
+	c.UpdateLastActivity()
+
+	source, data, err := unmarshalSFTPString(data)
+	if err != nil {
+		return getSFTPStatusReply(id, sftp.ErrSSHFxBadMessage)
+	}
+	target, _, err := unmarshalSFTPString(data)
+	if err != nil || source == "" || target == "" {
+		return getSFTPStatusReply(id, sftp.ErrSSHFxBadMessage)
+	}
+	source, err = c.getExtensionRequestPath(source)
+	if err != nil {
+		return getSFTPStatusReply(id, err)
+	}
+	target, err = c.getExtensionRequestPath(target)
+	if err != nil {
+		return getSFTPStatusReply(id, err)
+	}
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(source)) {
+		return getSFTPStatusReply(id, sftp.ErrSSHFxPermissionDenied)
+	}
+	info, err := c.DoStat(source, 0, true)
+	if err != nil {
+		return getSFTPStatusReply(id, err)
+	}
+	if info.IsDir() {
+		err = c.CopyDir(source, target)
+	} else {
+		err = c.CopyFile(source, target)
+	}
+	return getSFTPStatusReply(id, err)
+}
+
 func (c *Connection) canReadLink(name string) error {
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return sftp.ErrSSHFxPermissionDenied
 	}
 	ok, policy := c.User.IsFileAllowed(name)
@@ -405,10 +528,15 @@ func (c *Connection) handleSFTPUploadToNewFile(fs vfs.Fs, pflags sftp.FileOpenFl
 		c.Log(logger.LevelDebug, "upload for file %#v denied by pre action: %v", requestPath, err)
 		return nil, c.GetPermissionDeniedError()
 	}
+	quotaFileReserved, err := c.ReserveNewFile(requestPath)
+	if err != nil {
+		return nil, err
+	}
 
 	osFlags := getOSOpenFlags(pflags)
 	file, w, cancelFn, err := fs.Create(filePath, osFlags, c.GetCreateChecks(requestPath, true))
 	if err != nil {
+		c.ReleaseNewFile(requestPath, quotaFileReserved)
 		c.Log(logger.LevelError, "error creating file %#vm os flags %v, pflags %+v: %+v", resolvedPath, osFlags, pflags, err)
 		return nil, c.GetFsError(fs, err)
 	}
@@ -416,10 +544,11 @@ func (c *Connection) handleSFTPUploadToNewFile(fs vfs.Fs, pflags sftp.FileOpenFl
 	vfs.SetPathPermissions(fs, filePath, c.User.GetUID(), c.User.GetGID())
 
 	// we can get an error only for resume
-	maxWriteSize, _ := c.GetMaxWriteSize(diskQuota, false, 0, fs.IsUploadResumeSupported())
+	maxWriteSize, _ := c.GetMaxWriteSize(requestPath, diskQuota, false, 0, fs.IsUploadResumeSupported())
 
 	baseTransfer := common.NewBaseTransfer(file, c.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, 0, maxWriteSize, 0, true, fs, transferQuota)
+	baseTransfer.SetQuotaFileReserved(quotaFileReserved)
 	t := newTransfer(baseTransfer, w, nil, errForRead)
 
 	return t, nil
@@ -443,7 +572,7 @@ func (c *Connection) handleSFTPUploadToExistingFile(fs vfs.Fs, pflags sftp.FileO
 	// if there is a size limit the remaining size cannot be 0 here, since quotaResult.HasSpace
 	// will return false in this case and we deny the upload before.
 	// For Cloud FS GetMaxWriteSize will return unsupported operation
-	maxWriteSize, err := c.GetMaxWriteSize(diskQuota, isResume, fileSize, fs.IsUploadResumeSupported())
+	maxWriteSize, err := c.GetMaxWriteSize(requestPath, diskQuota, isResume, fileSize, fs.IsUploadResumeSupported())
 	if err != nil {
 		c.Log(logger.LevelDebug, "unable to get max write size: %v", err)
 		return nil, err
@@ -454,7 +583,7 @@ func (c *Connection) handleSFTPUploadToExistingFile(fs vfs.Fs, pflags sftp.FileO
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		err = fs.Rename(resolvedPath, filePath)
 		if err != nil {
 			c.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
@@ -463,6 +592,7 @@ func (c *Connection) handleSFTPUploadToExistingFile(fs vfs.Fs, pflags sftp.FileO
 		}
 	}
 
+	quotaSize := vfs.GetQuotaSize(fs, filePath, fileSize)
 	file, w, cancelFn, err := fs.Create(filePath, osFlags, c.GetCreateChecks(requestPath, false))
 	if err != nil {
 		c.Log(logger.LevelError, "error opening existing file, os flags %v, pflags: %+v, source: %#v, err: %+v",
@@ -479,21 +609,21 @@ func (c *Connection) handleSFTPUploadToExistingFile(fs vfs.Fs, pflags sftp.FileO
 		if pflags.Append {
 			minWriteOffset = fileSize
 		}
-		initialSize = fileSize
+		initialSize = quotaSize
 	} else {
 		if isTruncate && vfs.HasTruncateSupport(fs) {
 			vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(requestPath))
 			if err == nil {
-				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -quotaSize, false) //nolint:errcheck
 				if vfolder.IsIncludedInUserQuota() {
-					dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+					dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 				}
 			} else {
-				dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			initialSize = fileSize
-			truncatedSize = fileSize
+			initialSize = quotaSize
+			truncatedSize = quotaSize
 		}
 	}
 
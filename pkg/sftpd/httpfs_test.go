@@ -28,11 +28,13 @@ import (
 	"time"
 
 	"github.com/sftpgo/sdk"
+	sdkkms "github.com/sftpgo/sdk/kms"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/httpdtest"
+	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
@@ -293,6 +295,68 @@ func TestHTTPFsWalk(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHTTPFsSignedRequests(t *testing.T) {
+	usePubKey := false
+	u := getTestUserWithHTTPFs(usePubKey)
+	u.FsConfig.HTTPConfig.SigningKey = kms.NewPlainSecret(httpdtest.HTTPFsSigningKey)
+	u.FsConfig.HTTPConfig.Password = kms.NewPlainSecret("pwd")
+	_, _, err := httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.FsConfig.HTTPConfig.Password = kms.NewEmptySecret()
+	u.FsConfig.HTTPConfig.UseOIDCToken = true
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.FsConfig.HTTPConfig.UseOIDCToken = false
+	u.FsConfig.HTTPConfig.SignatureVersion = 2
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.FsConfig.HTTPConfig.SignatureVersion = 1
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, sdkkms.SecretStatusSecretBox, user.FsConfig.HTTPConfig.SigningKey.GetStatus())
+	assert.Empty(t, user.FsConfig.HTTPConfig.SigningKey.GetKey())
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		err = checkBasicSFTP(client)
+		assert.NoError(t, err)
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(65535)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+		err = sftpDownloadFile(testFileName, localDownloadPath, testFileSize, client)
+		assert.NoError(t, err)
+		err = client.Remove(testFileName)
+		assert.NoError(t, err)
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+		err = os.Remove(localDownloadPath)
+		assert.NoError(t, err)
+	}
+	// a wrong signing key must be rejected
+	user.FsConfig.HTTPConfig.SigningKey = kms.NewPlainSecret("wrong key")
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+	conn, client, err = getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		_, err = client.ReadDir(".")
+		assert.ErrorIs(t, err, os.ErrPermission)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestHTTPFsOverUNIXSocket(t *testing.T) {
 	if runtime.GOOS == osWindows {
 		t.Skip("UNIX domain sockets are not supported on Windows")
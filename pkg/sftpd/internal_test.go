@@ -1581,6 +1581,56 @@ func TestSCPRecursiveUploadErrors(t *testing.T) {
 	assert.Error(t, err, "recursive upload must fail, we send a fake error message")
 }
 
+func TestSCPAllowedPaths(t *testing.T) {
+	u := dataprovider.User{}
+	u.HomeDir = filepath.Join(os.TempDir(), "scp_allowed_paths")
+	u.Username = "test"
+	u.Permissions = make(map[string][]string)
+	u.Permissions["/"] = []string{dataprovider.PermAny}
+	u.Filters.SSHExec.AllowedSCPPaths = []string{"/incoming", "/shared/data"}
+	u.Filters.PathAliases = []dataprovider.PathAlias{
+		{
+			Path:   "/latest",
+			Target: "/incoming/2024",
+		},
+	}
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/incoming"))
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/incoming/"))
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/incoming/sub/file.txt"))
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/shared/data/file.txt"))
+	assert.False(t, u.Filters.SSHExec.IsSCPPathAllowed("/"))
+	assert.False(t, u.Filters.SSHExec.IsSCPPathAllowed("/incoming2"))
+	assert.False(t, u.Filters.SSHExec.IsSCPPathAllowed("/shared"))
+	assert.False(t, u.Filters.SSHExec.IsSCPPathAllowed("/incoming/../outgoing"))
+
+	mockSSHChannel := MockChannel{
+		Buffer:       bytes.NewBuffer([]byte("D0755 0 ..\n")),
+		StdErrBuffer: bytes.NewBuffer(nil),
+	}
+	connection := &Connection{
+		BaseConnection: common.NewBaseConnection("", common.ProtocolSCP, "", "", u),
+		channel:        &mockSSHChannel,
+	}
+	scpCommand := scpCommand{
+		sshCommand: sshCommand{
+			command:    "scp",
+			connection: connection,
+			args:       []string{"-r", "-t", "/incoming"},
+		},
+	}
+	assert.NoError(t, scpCommand.checkPathAllowed("/latest/file.txt"))
+	err := scpCommand.checkPathAllowed("/outgoing")
+	assert.ErrorIs(t, err, common.ErrPermissionDenied)
+	// a directory name cannot be used to escape the allowed path
+	err = scpCommand.handleRecursiveUpload()
+	assert.ErrorIs(t, err, common.ErrPermissionDenied)
+
+	u.Filters.SSHExec.AllowedSCPPaths = nil
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/"))
+	u.Filters.SSHExec.AllowedSCPPaths = []string{"/"}
+	assert.True(t, u.Filters.SSHExec.IsSCPPathAllowed("/any/path"))
+}
+
 func TestSCPCreateDirs(t *testing.T) {
 	buf := make([]byte, 65535)
 	stdErrBuf := make([]byte, 65535)
@@ -2091,6 +2141,79 @@ func TestSFTPSubSystem(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSFTPVersionNegotiation(t *testing.T) {
+	c := Configuration{}
+	assert.NoError(t, c.checkSFTPVersions())
+	c.MinSFTPVersion = 4
+	assert.Error(t, c.checkSFTPVersions())
+	c.MinSFTPVersion = 3
+	c.MaxSFTPVersion = -1
+	assert.Error(t, c.checkSFTPVersions())
+	c.MaxSFTPVersion = 2
+	assert.Error(t, c.checkSFTPVersions())
+	c.MaxSFTPVersion = 3
+	assert.NoError(t, c.checkSFTPVersions())
+
+	assert.Equal(t, 3, getNegotiatedSFTPVersion(6))
+	assert.Equal(t, 2, getNegotiatedSFTPVersion(2))
+
+	connection := &Connection{
+		BaseConnection: common.NewBaseConnection(xid.New().String(), common.ProtocolSFTP, "", "", dataprovider.User{}),
+	}
+	initPacket := []byte{0x00, 0x00, 0x00, 0x05, sshFxpInit, 0x00, 0x00, 0x00, 0x06}
+	mockSSHChannel := &MockChannel{
+		Buffer:       bytes.NewBuffer(append([]byte{}, initPacket...)),
+		StdErrBuffer: bytes.NewBuffer(nil),
+	}
+	channel, ok := c.negotiateSFTPVersion(mockSSHChannel, connection)
+	assert.True(t, ok)
+	assert.Equal(t, 3, connection.GetSFTPVersion())
+	// the consumed bytes must be returned to the SFTP server
+	data, err := io.ReadAll(channel)
+	assert.NoError(t, err)
+	assert.Equal(t, initPacket, data)
+	n, err := channel.Write([]byte{0x01})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, channel.Close())
+
+	initPacket[8] = 0x02
+	mockSSHChannel.Buffer = bytes.NewBuffer(append([]byte{}, initPacket...))
+	_, ok = c.negotiateSFTPVersion(mockSSHChannel, connection)
+	assert.False(t, ok)
+	assert.Equal(t, 2, connection.GetSFTPVersion())
+	c.MinSFTPVersion = 0
+	c.MaxSFTPVersion = 2
+	mockSSHChannel.Buffer = bytes.NewBuffer(append([]byte{}, initPacket...))
+	_, ok = c.negotiateSFTPVersion(mockSSHChannel, connection)
+	assert.True(t, ok)
+	// not an init packet, the error is handled by the SFTP server
+	c.MinSFTPVersion = 3
+	c.MaxSFTPVersion = 0
+	connection.SetSFTPVersion(0)
+	mockSSHChannel.Buffer = bytes.NewBuffer([]byte{0x00, 0x05, 0x00})
+	channel, ok = c.negotiateSFTPVersion(mockSSHChannel, connection)
+	assert.True(t, ok)
+	assert.Equal(t, 0, connection.GetSFTPVersion())
+	data, err = io.ReadAll(channel)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x05, 0x00}, data)
+
+	err = common.Connections.Add(connection)
+	assert.NoError(t, err)
+	stats := common.Connections.GetStats()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, 0, stats[0].SFTPVersion)
+	}
+	connection.SetSFTPVersion(3)
+	stats = common.Connections.GetStats()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, 3, stats[0].SFTPVersion)
+	}
+	common.Connections.Remove(connection.GetID())
+	assert.Len(t, common.Connections.GetStats(), 0)
+}
+
 func TestRecoverer(t *testing.T) {
 	c := Configuration{}
 	c.AcceptInboundConnection(nil, nil)
@@ -2322,3 +2445,292 @@ func TestAuthenticationErrors(t *testing.T) {
 	assert.ErrorIs(t, err, sftpAuthError)
 	assert.NotErrorIs(t, err, util.ErrNotFound)
 }
+
+func TestSSHExecAllowedCommandsMatch(t *testing.T) {
+	homeDir := filepath.Join(os.TempDir(), "exec_user")
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "exec_user",
+			HomeDir:  homeDir,
+		},
+	}
+	user.Filters.SSHExec.AllowedCommands = []string{"git-upload-pack *", "rsync --server ?vlogDtpre.iLsfxC . data/*",
+		"whoami", "cmd '--opt=*'", "cmd *"}
+	connection := &Connection{
+		BaseConnection: common.NewBaseConnection(xid.New().String(), common.ProtocolSSH, "", "", user),
+	}
+	assert.True(t, isSSHExecAllowed(connection, "whoami", nil))
+	assert.False(t, isSSHExecAllowed(connection, "whoami", []string{"-a"}))
+	assert.True(t, isSSHExecAllowed(connection, "git-upload-pack", []string{"repos/my repo.git"}))
+	assert.True(t, isSSHExecAllowed(connection, "git-upload-pack", []string{filepath.Join(homeDir, "repo.git")}))
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", []string{"/repos/repo.git"}))
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", []string{"~root/repo.git"}))
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", []string{"repos/../../repo.git"}))
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", []string{homeDir + "/../repo.git"}))
+	// "*" does not match additional arguments
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", []string{"repo.git", "repo1.git"}))
+	assert.False(t, isSSHExecAllowed(connection, "git-upload-pack", nil))
+	assert.False(t, isSSHExecAllowed(connection, "git-receive-pack", []string{"repos/repo.git"}))
+	assert.True(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", ".", "data/sub/dir"}))
+	assert.False(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", ".", "data/../../etc"}))
+	assert.False(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", "--delete", ".", "data/dir"}))
+	assert.False(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", ".", "/etc"}))
+	assert.False(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre1iLsfxC", ".", "data"}))
+	assert.True(t, isSSHExecAllowed(connection, "cmd", []string{"--opt=value"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"--opt=/etc/passwd"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"--opt=../passwd"}))
+	// values attached to short options
+	assert.True(t, isSSHExecAllowed(connection, "cmd", []string{"-Cdata"}))
+	assert.True(t, isSSHExecAllowed(connection, "cmd", []string{"-C" + filepath.Join(homeDir, "data")}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-C/etc"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-e/bin/sh"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-xzf/etc/passwd"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-C.."}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-C~root"}))
+	// symlinks inside the home dir pointing outside
+	err := os.MkdirAll(filepath.Join(homeDir, "data"), os.ModePerm)
+	require.NoError(t, err)
+	err = os.Symlink(os.TempDir(), filepath.Join(homeDir, "link"))
+	require.NoError(t, err)
+	err = os.Symlink(filepath.Join(homeDir, "data"), filepath.Join(homeDir, "datalink"))
+	require.NoError(t, err)
+	err = os.Symlink(filepath.Join(os.TempDir(), "missing_exec_target"), filepath.Join(homeDir, "broken"))
+	require.NoError(t, err)
+	assert.True(t, isSSHExecAllowed(connection, "cmd", []string{"data/newfile"}))
+	assert.True(t, isSSHExecAllowed(connection, "cmd", []string{"datalink/newfile"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"link"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"link/newfile"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{filepath.Join(homeDir, "link", "file")}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"--opt=link"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"-Clink"}))
+	assert.False(t, isSSHExecAllowed(connection, "cmd", []string{"broken"}))
+	assert.True(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", ".", "data/sub/dir"}))
+	assert.False(t, isSSHExecAllowed(connection, "rsync", []string{"--server", "-vlogDtpre.iLsfxC", ".", "data/../link"}))
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+}
+
+func TestTCPForwardingTargets(t *testing.T) {
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			Username: "forward_user",
+		},
+	}
+	user.Filters.AllowedForwardTargets = []string{"10.0.0.0/8:22", "127.0.0.1/32:*", "invalid"}
+	assert.False(t, user.IsForwardTargetAllowed(net.ParseIP("10.1.2.3"), 22))
+	user.Filters.AllowTCPForwarding = true
+	assert.True(t, user.IsForwardTargetAllowed(net.ParseIP("10.1.2.3"), 22))
+	assert.False(t, user.IsForwardTargetAllowed(net.ParseIP("10.1.2.3"), 80))
+	assert.False(t, user.IsForwardTargetAllowed(net.ParseIP("192.168.1.1"), 22))
+	assert.True(t, user.IsForwardTargetAllowed(net.ParseIP("127.0.0.1"), 8080))
+	assert.False(t, user.IsForwardTargetAllowed(nil, 22))
+
+	// forwarding disabled at server level
+	forwarder := newPortForwarder(nil, &user, xid.New().String(), false, 1)
+	_, err := forwarder.resolveTarget("127.0.0.1", 2222, false)
+	assert.ErrorIs(t, err, errForwardingNotAllowed)
+
+	forwarder = newPortForwarder(nil, &user, xid.New().String(), true, 1)
+	ip, err := forwarder.resolveTarget("localhost", 2222, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+	_, err = forwarder.resolveTarget("10.2.3.4", 2222, false)
+	assert.ErrorIs(t, err, errForwardingNotAllowed)
+	_, err = forwarder.resolveTarget("10.2.3.4", 70000, false)
+	assert.Error(t, err)
+	// connecting to an unspecified address means connecting to the loopback
+	for _, host := range []string{"", "*", "0.0.0.0", "::ffff:0.0.0.0"} {
+		ip, err = forwarder.resolveTarget(host, 2222, false)
+		if assert.NoError(t, err, host) {
+			assert.Equal(t, "127.0.0.1", ip.String())
+		}
+	}
+	_, err = forwarder.resolveTarget("::", 2222, false)
+	assert.ErrorIs(t, err, errForwardingNotAllowed)
+	// the bind address for remote forwarding on all interfaces is not allowed
+	_, err = forwarder.resolveTarget("", 0, true)
+	assert.ErrorIs(t, err, errForwardingNotAllowed)
+	// an unspecified address is allowed only if explicitly included in the patterns
+	user.Filters.AllowedForwardTargets = []string{"0.0.0.0/0:22"}
+	ip, err = forwarder.resolveTarget("0.0.0.0", 22, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0", ip.String())
+	user.Filters.AllowedForwardTargets = []string{"10.0.0.0/8:22", "127.0.0.1/32:*"}
+
+	assert.True(t, activeForwardings.add(user.Username, forwarder.limit))
+	assert.False(t, activeForwardings.add(user.Username, forwarder.limit))
+	assert.Equal(t, 1, activeForwardings.get(user.Username))
+	activeForwardings.remove(user.Username)
+	assert.Equal(t, 0, activeForwardings.get(user.Username))
+	assert.False(t, forwarder.cancelRemoteForwarding(ssh.Marshal(&remoteForwardRequest{BindAddr: "localhost", BindPort: 2222})))
+	forwarder.closeListeners()
+	// the remote forwarding uses the only allowed slot, the accepted connections are closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.True(t, activeForwardings.add(user.Username, forwarder.limit))
+	done := make(chan struct{})
+	go func() {
+		forwarder.acceptRemoteConnections(listener, "127.0.0.1", uint32(listener.Addr().(*net.TCPAddr).Port))
+		close(done)
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	err = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	assert.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	conn.Close()
+	assert.Equal(t, 1, activeForwardings.get(user.Username))
+	listener.Close()
+	<-done
+	assert.Equal(t, 0, activeForwardings.get(user.Username))
+}
+
+type sftpExtensionTestChannel struct {
+	reader io.Reader
+	writer bytes.Buffer
+}
+
+func (c *sftpExtensionTestChannel) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *sftpExtensionTestChannel) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+func (c *sftpExtensionTestChannel) Close() error {
+	return nil
+}
+
+func getTestSFTPPacket(packet []byte) []byte {
+	return append(marshalSFTPUint32(nil, uint32(len(packet))), packet...)
+}
+
+func TestSFTPExtensionChannel(t *testing.T) {
+	extended := []byte{sshFxpExtended}
+	extended = marshalSFTPUint32(extended, 3)
+	extended = marshalSFTPString(extended, "test@sftpgo.com")
+	extended = append(extended, []byte("data")...)
+	unhandled := []byte{sshFxpExtended}
+	unhandled = marshalSFTPUint32(unhandled, 4)
+	unhandled = marshalSFTPString(unhandled, "other@sftpgo.com")
+	open := []byte{3, 0, 0, 0, 5}
+
+	var input []byte
+	input = append(input, getTestSFTPPacket(open)...)
+	input = append(input, getTestSFTPPacket(extended)...)
+	input = append(input, getTestSFTPPacket(unhandled)...)
+	mockChannel := &sftpExtensionTestChannel{
+		reader: bytes.NewReader(input),
+	}
+	handled := make(chan []byte, 1)
+	channel := newSFTPExtensionChannel(mockChannel, map[string]sftpExtensionHandler{
+		"test@sftpgo.com": func(id uint32, data []byte) []byte {
+			handled <- data
+			return marshalSFTPUint32([]byte{sshFxpExtendedReply}, id)
+		},
+	})
+	// the handled extended request is not forwarded
+	forwarded, err := io.ReadAll(channel)
+	assert.NoError(t, err)
+	assert.Equal(t, append(getTestSFTPPacket(open), getTestSFTPPacket(unhandled)...), forwarded)
+	assert.Equal(t, []byte("data"), <-handled)
+	// wait for the handler to complete
+	channel.guard <- struct{}{}
+	<-channel.guard
+
+	// the reply is sent after the version packet is written, the extension is advertised
+	version := marshalSFTPUint32([]byte{sshFxpVersion}, 3)
+	packet := getTestSFTPPacket(version)
+	n, err := channel.Write(packet[:3])
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 0, mockChannel.writer.Len())
+	_, err = channel.Write(packet[3:])
+	assert.NoError(t, err)
+	expected := getTestSFTPPacket(marshalSFTPString(marshalSFTPString(version, "test@sftpgo.com"), "1"))
+	expected = append(expected, getTestSFTPPacket(marshalSFTPUint32([]byte{sshFxpExtendedReply}, 3))...)
+	assert.Equal(t, expected, mockChannel.writer.Bytes())
+	mockChannel.writer.Reset()
+	// a reply is not written in the middle of a packet
+	status := getSFTPStatusReply(5, nil)
+	packet = getTestSFTPPacket(status)
+	_, err = channel.Write(packet[:6])
+	assert.NoError(t, err)
+	channel.sendReply(getSFTPStatusReply(6, sftp.ErrSSHFxNoSuchFile))
+	assert.Equal(t, packet[:6], mockChannel.writer.Bytes())
+	_, err = channel.Write(packet[6:])
+	assert.NoError(t, err)
+	expected = append(packet, getTestSFTPPacket(getSFTPStatusReply(6, sftp.ErrSSHFxNoSuchFile))...)
+	assert.Equal(t, expected, mockChannel.writer.Bytes())
+	mockChannel.writer.Reset()
+	channel.sendReply(getSFTPStatusReply(7, nil))
+	assert.Equal(t, getTestSFTPPacket(getSFTPStatusReply(7, nil)), mockChannel.writer.Bytes())
+
+	assert.Equal(t, uint32(sshFxOk), getSFTPStatusCode(nil))
+	assert.Equal(t, uint32(sshFxPermissionDenied), getSFTPStatusCode(sftp.ErrSSHFxPermissionDenied))
+	assert.Equal(t, uint32(sshFxOpUnsupported), getSFTPStatusCode(sftp.ErrSSHFxOpUnsupported))
+	assert.Equal(t, uint32(sshFxFailure), getSFTPStatusCode(errors.New("generic error")))
+}
+
+func TestDirSyncManifests(t *testing.T) {
+	_, _, err := unmarshalDirSyncRequest(nil)
+	assert.Error(t, err)
+	data := marshalSFTPString(nil, "/dir")
+	_, _, err = unmarshalDirSyncRequest(data)
+	assert.Error(t, err)
+	_, _, err = unmarshalDirSyncRequest(marshalSFTPUint32(data, dirSyncMaxEntries+1))
+	assert.Error(t, err)
+	request := marshalSFTPUint32(data, 1)
+	request = marshalSFTPString(request, "/")
+	request = marshalSFTPString(request, "hash")
+	request = marshalSFTPUint64(request, 1)
+	request = marshalSFTPUint64(request, 1)
+	_, _, err = unmarshalDirSyncRequest(request)
+	assert.Error(t, err)
+	request = marshalSFTPUint32(data, 1)
+	request = marshalSFTPString(request, "/sub/../file")
+	request = marshalSFTPString(request, "hash")
+	request = marshalSFTPUint64(request, 10)
+	request = marshalSFTPUint64(request, 20)
+	dirPath, entries, err := unmarshalDirSyncRequest(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dir", dirPath)
+	assert.Equal(t, []dirSyncEntry{{Path: "file", SHA256: "hash", MTime: 10, Size: 20}}, entries)
+
+	local := []dirSyncEntry{
+		{Path: "same", SHA256: "AA", MTime: 1},
+		{Path: "same", SHA256: "BB", MTime: 1},
+		{Path: "changed", SHA256: "aa", MTime: 1},
+		{Path: "conflict", SHA256: "aa", MTime: 1},
+		{Path: "new", SHA256: "aa", MTime: 1},
+	}
+	remote := map[string]dirSyncEntry{
+		"same":     {Path: "same", SHA256: "aa", MTime: 2},
+		"changed":  {Path: "changed", SHA256: "bb", MTime: 1},
+		"conflict": {Path: "conflict", SHA256: "bb", MTime: 2},
+		"b":        {Path: "b", SHA256: "cc", MTime: 2},
+		"a":        {Path: "a", SHA256: "cc", MTime: 2},
+	}
+	result := compareDirSyncManifests(local, remote)
+	assert.Equal(t, []dirSyncEntry{local[2], local[4]}, result.toUpload)
+	assert.Equal(t, []dirSyncEntry{remote["a"], remote["b"]}, result.toDownload)
+	assert.Equal(t, []dirSyncEntry{remote["conflict"]}, result.conflicts)
+
+	cache := newDirSyncManifestCache(2)
+	cache.add(&dirSyncManifest{key: "k1", etag: "e1"})
+	cache.add(&dirSyncManifest{key: "k2", etag: "e2"})
+	_, ok := cache.get("k1", "e2")
+	assert.False(t, ok)
+	_, ok = cache.get("k1", "e1")
+	assert.True(t, ok)
+	cache.add(&dirSyncManifest{key: "k3", etag: "e3"})
+	_, ok = cache.get("k2", "e2")
+	assert.False(t, ok)
+	cache.add(&dirSyncManifest{key: "k1", etag: "e4"})
+	manifest, ok := cache.get("k1", "e4")
+	assert.True(t, ok)
+	assert.Equal(t, "e4", manifest.etag)
+	assert.Len(t, cache.items, 2)
+}
@@ -61,6 +61,9 @@ func (c *scpCommand) handle() (err error) {
 	commandType := c.getCommandType()
 	c.connection.Log(logger.LevelDebug, "handle scp command, args: %v user: %v command type: %v, dest path: %#v",
 		c.args, c.connection.User.Username, commandType, destPath)
+	if err = c.checkPathAllowed(destPath); err != nil {
+		return err
+	}
 	if commandType == "-t" {
 		// -t means "to", so upload
 		err = c.sendConfirmationMessage()
@@ -124,7 +127,14 @@ func (c *scpCommand) handleRecursiveUpload() error {
 			}
 			if strings.HasPrefix(command, "D") {
 				numDirs++
-				destPath = path.Join(destPath, name)
+				destPath, err = c.connection.SanitizeTargetPath(path.Join(destPath, name))
+				if err != nil {
+					c.sendErrorMessage(nil, err)
+					return err
+				}
+				if err = c.checkPathAllowed(destPath); err != nil {
+					return err
+				}
 				fs, err = c.connection.User.GetFilesystemForPath(destPath, c.connection.ID)
 				if err != nil {
 					c.connection.Log(logger.LevelError, "error uploading file %#v: %+v", destPath, err)
@@ -153,13 +163,13 @@ func (c *scpCommand) handleRecursiveUpload() error {
 func (c *scpCommand) handleCreateDir(fs vfs.Fs, dirPath string) error {
 	c.connection.UpdateLastActivity()
 
-	p, err := fs.ResolvePath(dirPath)
+	p, err := fs.ResolvePath(c.connection.User.ResolvePathAlias(dirPath))
 	if err != nil {
 		c.connection.Log(logger.LevelError, "error creating dir: %#v, invalid file path, err: %v", dirPath, err)
 		c.sendErrorMessage(fs, err)
 		return err
 	}
-	if !c.connection.User.HasPerm(dataprovider.PermCreateDirs, path.Dir(dirPath)) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(dirPath)) {
 		c.connection.Log(logger.LevelError, "error creating dir: %#v, permission denied", dirPath)
 		c.sendErrorMessage(fs, common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
@@ -245,10 +255,29 @@ func (c *scpCommand) handleUploadFile(fs vfs.Fs, resolvedPath, filePath string,
 		return err
 	}
 
-	maxWriteSize, _ := c.connection.GetMaxWriteSize(diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	maxWriteSize, _ := c.connection.GetMaxWriteSize(requestPath, diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	if err := c.connection.CheckUploadSpace(fs, resolvedPath, sizeToRead, maxWriteSize); err != nil {
+		if !isNewFile && filePath != resolvedPath {
+			// restore the file renamed for the atomic upload
+			fs.Rename(filePath, resolvedPath) //nolint:errcheck
+		}
+		c.sendErrorMessage(fs, err)
+		return err
+	}
 
+	quotaFileReserved := false
+	if isNewFile {
+		quotaFileReserved, err = c.connection.ReserveNewFile(requestPath)
+		if err != nil {
+			c.sendErrorMessage(fs, err)
+			return err
+		}
+	}
+
+	quotaSize := vfs.GetQuotaSize(fs, filePath, fileSize)
 	file, w, cancelFn, err := fs.Create(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.connection.GetCreateChecks(requestPath, isNewFile))
 	if err != nil {
+		c.connection.ReleaseNewFile(requestPath, quotaFileReserved)
 		c.connection.Log(logger.LevelError, "error creating file %#v: %v", resolvedPath, err)
 		c.sendErrorMessage(fs, err)
 		return err
@@ -260,15 +289,15 @@ func (c *scpCommand) handleUploadFile(fs vfs.Fs, resolvedPath, filePath string,
 		if vfs.HasTruncateSupport(fs) {
 			vfolder, err := c.connection.User.GetVirtualFolderForPath(path.Dir(requestPath))
 			if err == nil {
-				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -quotaSize, false) //nolint:errcheck
 				if vfolder.IsIncludedInUserQuota() {
-					dataprovider.UpdateUserQuota(&c.connection.User, 0, -fileSize, false) //nolint:errcheck
+					dataprovider.UpdateUserQuota(&c.connection.User, 0, -quotaSize, false) //nolint:errcheck
 				}
 			} else {
-				dataprovider.UpdateUserQuota(&c.connection.User, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.connection.User, 0, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			initialSize = fileSize
+			initialSize = quotaSize
 			truncatedSize = initialSize
 		}
 		if maxWriteSize > 0 {
@@ -280,6 +309,7 @@ func (c *scpCommand) handleUploadFile(fs vfs.Fs, resolvedPath, filePath string,
 
 	baseTransfer := common.NewBaseTransfer(file, c.connection.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, initialSize, maxWriteSize, truncatedSize, isNewFile, fs, transferQuota)
+	baseTransfer.SetQuotaFileReserved(quotaFileReserved)
 	t := newTransfer(baseTransfer, w, nil, nil)
 
 	return c.getUploadFileData(sizeToRead, t)
@@ -288,6 +318,14 @@ func (c *scpCommand) handleUploadFile(fs vfs.Fs, resolvedPath, filePath string,
 func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error {
 	c.connection.UpdateLastActivity()
 
+	uploadFilePath, err := c.connection.GetUploadTargetPath(uploadFilePath)
+	if err != nil {
+		c.sendErrorMessage(nil, err)
+		return err
+	}
+	if err = c.checkPathAllowed(uploadFilePath); err != nil {
+		return err
+	}
 	fs, p, err := c.connection.GetFsAndResolvedPath(uploadFilePath)
 	if err != nil {
 		c.connection.Log(logger.LevelError, "error uploading file: %#v, err: %v", uploadFilePath, err)
@@ -302,12 +340,12 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 	}
 
 	filePath := p
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.connection.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		filePath = fs.GetAtomicUploadPath(p)
 	}
 	stat, statErr := fs.Lstat(p)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || fs.IsNotExist(statErr) {
-		if !c.connection.User.HasPerm(dataprovider.PermUpload, path.Dir(uploadFilePath)) {
+		if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(uploadFilePath)) {
 			c.connection.Log(logger.LevelWarn, "cannot upload file: %#v, permission denied", uploadFilePath)
 			c.sendErrorMessage(fs, common.ErrPermissionDenied)
 			return common.ErrPermissionDenied
@@ -328,13 +366,13 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 		return err
 	}
 
-	if !c.connection.User.HasPerm(dataprovider.PermOverwrite, uploadFilePath) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, uploadFilePath) {
 		c.connection.Log(logger.LevelWarn, "cannot overwrite file: %#v, permission denied", uploadFilePath)
 		c.sendErrorMessage(fs, common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.connection.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		err = fs.Rename(p, filePath)
 		if err != nil {
 			c.connection.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %v",
@@ -511,7 +549,7 @@ func (c *scpCommand) handleDownload(filePath string) error {
 	}
 
 	if stat.IsDir() {
-		if !c.connection.User.HasPerm(dataprovider.PermDownload, filePath) {
+		if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermDownload, filePath) {
 			c.connection.Log(logger.LevelWarn, "error downloading dir: %#v, permission denied", filePath)
 			c.sendErrorMessage(fs, common.ErrPermissionDenied)
 			return common.ErrPermissionDenied
@@ -520,7 +558,7 @@ func (c *scpCommand) handleDownload(filePath string) error {
 		return err
 	}
 
-	if !c.connection.User.HasPerm(dataprovider.PermDownload, path.Dir(filePath)) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(filePath)) {
 		c.connection.Log(logger.LevelWarn, "error downloading dir: %#v, permission denied", filePath)
 		c.sendErrorMessage(fs, common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
@@ -561,6 +599,17 @@ func (c *scpCommand) handleDownload(filePath string) error {
 	return err
 }
 
+// checkPathAllowed sends an error message if the user's SCP paths
+// restrictions do not allow to access the specified virtual path
+func (c *scpCommand) checkPathAllowed(virtualPath string) error {
+	if c.connection.User.Filters.SSHExec.IsSCPPathAllowed(c.connection.User.ResolvePathAlias(virtualPath)) {
+		return nil
+	}
+	c.connection.Log(logger.LevelWarn, "scp access to path %q is not allowed", virtualPath)
+	c.sendErrorMessage(nil, common.ErrPermissionDenied)
+	return common.ErrPermissionDenied
+}
+
 func (c *scpCommand) getCommandType() string {
 	return c.args[len(c.args)-2]
 }
@@ -636,7 +685,7 @@ func (c *scpCommand) sendErrorMessage(fs vfs.Fs, err error) {
 	if fs != nil {
 		c.connection.channel.Write([]byte(c.connection.GetFsError(fs, err).Error()))
 	} else {
-		c.connection.channel.Write([]byte(err.Error()))
+		c.connection.channel.Write([]byte(c.connection.GetClientError(err).Error()))
 	}
 	c.connection.channel.Write(newLine)
 	c.connection.channel.Close()
@@ -744,7 +793,7 @@ func (c *scpCommand) getFileUploadDestPath(fs vfs.Fs, scpDestPath, fileName stri
 			// but if scpDestPath is an existing directory then we put the uploaded file
 			// inside that directory this is as scp command works, for example:
 			// scp fileName.txt user@127.0.0.1:/existing_dir
-			if p, err := fs.ResolvePath(scpDestPath); err == nil {
+			if p, err := fs.ResolvePath(c.connection.User.ResolvePathAlias(scpDestPath)); err == nil {
 				if stat, err := fs.Stat(p); err == nil {
 					if stat.IsDir() {
 						return path.Join(scpDestPath, fileName)
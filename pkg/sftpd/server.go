@@ -50,7 +50,7 @@ const (
 )
 
 var (
-	sftpExtensions        = []string{"statvfs@openssh.com"}
+	sftpExtensions        = []string{"statvfs@openssh.com", "hardlink@openssh.com"}
 	supportedHostKeyAlgos = []string{
 		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01,
 		ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
@@ -108,7 +108,7 @@ type Binding struct {
 
 // GetAddress returns the binding address
 func (b *Binding) GetAddress() string {
-	return fmt.Sprintf("%s:%d", b.Address, b.Port)
+	return util.JoinHostPort(b.Address, b.Port)
 }
 
 // IsValid returns true if the binding port is > 0
@@ -204,7 +204,18 @@ type Configuration struct {
 	// The prefix is only applied to SFTP requests, SCP and other SSH commands will be automatically disabled if
 	// you configure a prefix.
 	// This setting can help some migrations from OpenSSH. It is not recommended for general usage.
-	FolderPrefix     string `json:"folder_prefix" mapstructure:"folder_prefix"`
+	FolderPrefix string `json:"folder_prefix" mapstructure:"folder_prefix"`
+	// AllowTCPForwarding enables SSH TCP forwarding at server level. If disabled, the default,
+	// any forwarding request is denied. TCP forwarding must also be explicitly enabled at user level
+	AllowTCPForwarding bool `json:"allow_tcp_forwarding" mapstructure:"allow_tcp_forwarding"`
+	// Maximum number of concurrent TCP forwardings for each user, 0 means no limit.
+	MaxTCPForwardings int `json:"max_tcp_forwardings" mapstructure:"max_tcp_forwardings"`
+	// Minimum SFTP protocol version allowed, clients negotiating a lower version are rejected.
+	// 0 means no limit
+	MinSFTPVersion int `json:"min_sftp_version" mapstructure:"min_sftp_version"`
+	// Maximum SFTP protocol version allowed, clients negotiating a higher version are rejected.
+	// 0 means no limit
+	MaxSFTPVersion   int `json:"max_sftp_version" mapstructure:"max_sftp_version"`
 	certChecker      *ssh.CertChecker
 	parsedUserCAKeys []ssh.PublicKey
 }
@@ -324,6 +335,10 @@ func (c *Configuration) Initialize(configDir string) error {
 		return err
 	}
 
+	if err := c.checkSFTPVersions(); err != nil {
+		return err
+	}
+
 	if err := c.loadModuli(configDir); err != nil {
 		return err
 	}
@@ -578,10 +593,18 @@ func (c *Configuration) AcceptInboundConnection(conn net.Conn, config *ssh.Serve
 
 	defer common.Connections.RemoveSSHConnection(connectionID)
 
-	go ssh.DiscardRequests(reqs)
+	forwarder := newPortForwarder(sconn, &user, connectionID, c.AllowTCPForwarding, c.MaxTCPForwardings)
+	defer forwarder.closeListeners()
+
+	go forwarder.handleGlobalRequests(reqs)
 
 	channelCounter := int64(0)
 	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			sshConnection.UpdateLastActivity()
+			go forwarder.handleDirectTCPIP(newChannel)
+			continue
+		}
 		// If its not a session channel we just move on because its not something we
 		// know how to handle at this point.
 		if newChannel.ChannelType() != "session" {
@@ -655,8 +678,18 @@ func (c *Configuration) handleSftpConnection(channel ssh.Channel, connection *Co
 	}
 	defer common.Connections.Remove(connection.GetID())
 
+	sftpChannel, ok := c.negotiateSFTPVersion(channel, connection)
+	if !ok {
+		errClose := connection.Disconnect()
+		connection.Log(logger.LevelWarn, "SFTP version %d not allowed, min %d, max %d, connection closed, close err: %v",
+			connection.GetSFTPVersion(), c.MinSFTPVersion, c.MaxSFTPVersion, errClose)
+		return
+	}
+	sftpChannel = newSFTPExtensionChannel(sftpChannel, connection.getSFTPExtensionHandlers())
+	connection.PrefetchDirListings()
+
 	// Create the server instance for the channel using the handler we created above.
-	server := sftp.NewRequestServer(channel, c.createHandlers(connection), sftp.WithRSAllocator(),
+	server := sftp.NewRequestServer(sftpChannel, c.createHandlers(connection), sftp.WithRSAllocator(),
 		sftp.WithStartDirectory(connection.User.Filters.StartDirectory))
 
 	defer server.Close()
@@ -727,13 +760,9 @@ func loginUser(user *dataprovider.User, loginMethod, publicKey string, conn ssh.
 		logger.Info(logSender, connectionID, "cannot login user %#v, protocol SSH is not allowed", user.Username)
 		return nil, fmt.Errorf("protocol SSH is not allowed for user %#v", user.Username)
 	}
-	if user.MaxSessions > 0 {
-		activeSessions := common.Connections.GetActiveSessions(user.Username)
-		if activeSessions >= user.MaxSessions {
-			logger.Info(logSender, "", "authentication refused for user: %#v, too many open sessions: %v/%v", user.Username,
-				activeSessions, user.MaxSessions)
-			return nil, fmt.Errorf("too many open sessions: %v", activeSessions)
-		}
+	if err := common.Connections.CheckMaxSessions(user.Username, user.MaxSessions); err != nil {
+		logger.Info(logSender, connectionID, "authentication refused for user: %q, %v", user.Username, err)
+		return nil, err
 	}
 	if !user.IsLoginMethodAllowed(loginMethod, common.ProtocolSSH, conn.PartialSuccessMethods()) {
 		logger.Info(logSender, connectionID, "cannot login user %#v, login method %#v is not allowed",
@@ -513,6 +513,11 @@ func TestBasicSFTPHandling(t *testing.T) {
 		testFileSize := int64(65535)
 		expectedQuotaSize := user.UsedQuotaSize + testFileSize
 		expectedQuotaFiles := user.UsedQuotaFiles + 1
+		for _, stat := range common.Connections.GetStats() {
+			if stat.Username == user.Username && stat.Protocol == common.ProtocolSFTP {
+				assert.Equal(t, 3, stat.SFTPVersion)
+			}
+		}
 		err = createTestFile(testFilePath, testFileSize)
 		assert.NoError(t, err)
 		err = sftpUploadFile(testFilePath, path.Join("/missing_dir", testFileName), testFileSize, client)
@@ -1574,7 +1579,11 @@ func TestLink(t *testing.T) {
 		err = client.Symlink(testFileName, testFileName+".link")
 		assert.Error(t, err, "creating a symlink to an existing one must fail")
 		err = client.Link(testFileName, testFileName+".hlink")
-		assert.Error(t, err, "hard link is not supported and must fail")
+		assert.NoError(t, err)
+		err = client.Link(testFileName, testFileName+".hlink")
+		assert.Error(t, err, "creating a hard link to an existing file must fail")
+		err = client.Remove(testFileName + ".hlink")
+		assert.NoError(t, err)
 		err = client.Remove(testFileName + ".link")
 		assert.NoError(t, err)
 		err = client.Remove(testFileName)
@@ -1588,6 +1597,124 @@ func TestLink(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHardlink(t *testing.T) {
+	usePubKey := false
+	u := getTestUser(usePubKey)
+	u.QuotaFiles = 100
+	u.Permissions["/sub"] = []string{dataprovider.PermListItems, dataprovider.PermUpload}
+	u.Permissions["/nodownload"] = []string{dataprovider.PermListItems, dataprovider.PermUpload,
+		dataprovider.PermCreateSymlinks}
+	u.Filters.FilePatterns = []sdk.PatternsFilter{
+		{
+			Path:           "/denied",
+			DeniedPatterns: []string{"*.dat"},
+		},
+	}
+	mappedPath := filepath.Join(os.TempDir(), "hlinkvdir")
+	folderName := filepath.Base(mappedPath)
+	vdirPath := "/vdir"
+	u.VirtualFolders = append(u.VirtualFolders, vfs.VirtualFolder{
+		BaseVirtualFolder: vfs.BaseVirtualFolder{
+			Name:       folderName,
+			MappedPath: mappedPath,
+		},
+		VirtualPath: vdirPath,
+		QuotaFiles:  -1,
+		QuotaSize:   -1,
+	})
+	localUser, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	sftpUser, _, err := httpdtest.AddUser(getTestSFTPUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(localUser, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+		fileSize := int64(65535)
+		err = writeSFTPFile(testFileName, fileSize, client)
+		assert.NoError(t, err)
+		err = client.Mkdir("sub")
+		assert.NoError(t, err)
+		err = client.Mkdir("dir")
+		assert.NoError(t, err)
+		err = client.Link(testFileName, path.Join("dir", testFileName))
+		assert.NoError(t, err)
+		// a hard link only counts as a file
+		user, _, err := httpdtest.GetUserByUsername(localUser.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		assert.Equal(t, fileSize, user.UsedQuotaSize)
+		info, err := client.Stat(path.Join("dir", testFileName))
+		if assert.NoError(t, err) {
+			assert.Equal(t, fileSize, info.Size())
+			assert.True(t, info.Mode().IsRegular())
+		}
+		// removing a hard linked file does not free any space
+		err = client.Remove(testFileName)
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(localUser.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, user.UsedQuotaFiles)
+		assert.Equal(t, fileSize, user.UsedQuotaSize)
+		err = client.Link(path.Join("dir", testFileName), testFileName)
+		assert.NoError(t, err)
+		err = client.Remove(path.Join("dir", testFileName))
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(localUser.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, user.UsedQuotaFiles)
+		assert.Equal(t, fileSize, user.UsedQuotaSize)
+		err = client.Remove(testFileName)
+		assert.NoError(t, err)
+		user, _, err = httpdtest.GetUserByUsername(localUser.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, user.UsedQuotaFiles)
+		assert.Equal(t, int64(0), user.UsedQuotaSize)
+		err = writeSFTPFile(testFileName, fileSize, client)
+		assert.NoError(t, err)
+		err = client.Link(testFileName, path.Join("dir", testFileName))
+		assert.NoError(t, err)
+		// the source must be readable
+		err = client.Mkdir("nodownload")
+		assert.NoError(t, err)
+		err = writeSFTPFile(path.Join("nodownload", testFileName), fileSize, client)
+		assert.NoError(t, err)
+		err = client.Link(path.Join("nodownload", testFileName), path.Join("dir", testFileName+"1"))
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Mkdir("denied")
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(localUser.GetHomeDir(), "denied", "file.dat"), []byte("data"), os.ModePerm)
+		assert.NoError(t, err)
+		err = client.Link(path.Join("denied", "file.dat"), path.Join("dir", "file.dat"))
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Link(testFileName, path.Join("sub", testFileName))
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Link("dir", "dirlink")
+		assert.Error(t, err, "hard links to directories must fail")
+		err = client.Link(testFileName, path.Join(vdirPath, testFileName))
+		assert.Error(t, err, "cross folder hard links must fail")
+		err = client.Link("missing", "missinglink")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+	conn, client, err = getSftpClient(sftpUser, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+		err = client.Link(testFileName, testFileName+".hlink")
+		assert.Error(t, err, "hard links are not supported for SFTP filesystems")
+	}
+	_, err = httpdtest.RemoveUser(sftpUser, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(localUser, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveFolder(vfs.BaseVirtualFolder{Name: folderName}, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(localUser.GetHomeDir())
+	assert.NoError(t, err)
+	err = os.RemoveAll(mappedPath)
+	assert.NoError(t, err)
+}
+
 func TestStat(t *testing.T) {
 	usePubKey := false
 	localUser, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
@@ -1802,6 +1929,40 @@ func TestSFTPFsLoginWrongFingerprint(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSFTPFsLocalAddress(t *testing.T) {
+	usePubKey := true
+	localUser, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	u := getTestSFTPUser(usePubKey)
+	u.FsConfig.SFTPConfig.LocalAddress = "127.0.0.1"
+	sftpUser, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+
+	conn, client, err := getSftpClient(sftpUser, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+		err = checkBasicSFTP(client)
+		assert.NoError(t, err)
+	}
+	// the source address is not available on this host
+	sftpUser.FsConfig.SFTPConfig.LocalAddress = "192.0.2.1:0"
+	_, _, err = httpdtest.UpdateUser(sftpUser, http.StatusOK, "")
+	assert.NoError(t, err)
+	conn, client, err = getSftpClient(sftpUser, usePubKey)
+	if !assert.Error(t, err) {
+		defer conn.Close()
+		defer client.Close()
+	}
+
+	_, err = httpdtest.RemoveUser(sftpUser, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(localUser, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(localUser.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestChtimes(t *testing.T) {
 	usePubKey := false
 	localUser, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
@@ -4382,8 +4543,9 @@ func TestSupportedExtensions(t *testing.T) {
 		v, ok := client.HasExtension("statvfs@openssh.com")
 		assert.Equal(t, "2", v)
 		assert.True(t, ok)
-		_, ok = client.HasExtension("hardlink@openssh.com")
-		assert.False(t, ok)
+		v, ok = client.HasExtension("hardlink@openssh.com")
+		assert.Equal(t, "1", v)
+		assert.True(t, ok)
 		_, ok = client.HasExtension("posix-rename@openssh.com")
 		assert.False(t, ok)
 	}
@@ -4745,6 +4907,166 @@ func TestQuotaLimits(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestQuotaFilesConcurrentUploads(t *testing.T) {
+	usePubKey := false
+	u := getTestUser(usePubKey)
+	u.QuotaFiles = 2
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		// the files are reserved in the quota as soon as the uploads start
+		f1, err := client.Create("file1.txt")
+		assert.NoError(t, err)
+		f2, err := client.Create("file2.txt")
+		assert.NoError(t, err)
+		_, err = client.Create("file3.txt")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), common.ErrQuotaExceeded.Error())
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		_, err = f1.Write([]byte("content"))
+		assert.NoError(t, err)
+		err = f1.Close()
+		assert.NoError(t, err)
+		err = f2.Close()
+		assert.NoError(t, err)
+		// the reserved files are not counted twice
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		assert.Equal(t, int64(7), user.UsedQuotaSize)
+		// a failed upload releases the reservation
+		err = client.Remove("file2.txt")
+		assert.NoError(t, err)
+		_, err = client.Create("missing/file.txt")
+		assert.Error(t, err)
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, user.UsedQuotaFiles)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestMaxFilesPerDir(t *testing.T) {
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.MaxFilesPerDir = 2
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	testFileSize := int64(1024)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		err = client.Mkdir("sub")
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName+".1", testFileSize, client)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), common.ErrQuotaExceeded.Error())
+		}
+		// overwriting an existing file is allowed
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, path.Join("sub", testFileName), testFileSize, client)
+		assert.NoError(t, err)
+	}
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestMaxOpenHandles(t *testing.T) {
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.MaxOpenHandles = -1
+	_, _, err := httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.MaxOpenHandles = 1
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		f, err := client.Create(testFileName)
+		if assert.NoError(t, err) {
+			_, err = f.Write([]byte("content"))
+			assert.NoError(t, err)
+			_, err = client.Open(testFileName)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "too many open handles")
+			}
+			_, err = client.Create(testFileName + ".1")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "too many open handles")
+			}
+			// other requests are allowed
+			_, err = client.Stat(testFileName)
+			assert.NoError(t, err)
+			err = f.Close()
+			assert.NoError(t, err)
+		}
+		f, err = client.Open(testFileName)
+		if assert.NoError(t, err) {
+			err = f.Close()
+			assert.NoError(t, err)
+		}
+		// the limits are reported using the limits@openssh.com extension
+		session, err := conn.NewSession()
+		assert.NoError(t, err)
+		defer session.Close()
+		stdin, err := session.StdinPipe()
+		assert.NoError(t, err)
+		stdout, err := session.StdoutPipe()
+		assert.NoError(t, err)
+		err = session.RequestSubsystem("sftp")
+		assert.NoError(t, err)
+		err = writeSFTPPacket(stdin, []byte{1, 0, 0, 0, 3})
+		assert.NoError(t, err)
+		packet, err := readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		assert.Contains(t, string(packet), "limits@openssh.com")
+		request := []byte{200}
+		request = binary.BigEndian.AppendUint32(request, 1)
+		request = appendSFTPString(request, "limits@openssh.com")
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Len(t, packet, 37) {
+			assert.Equal(t, byte(201), packet[0])
+			assert.Equal(t, uint32(1), binary.BigEndian.Uint32(packet[1:]))
+			assert.Equal(t, uint64(262144), binary.BigEndian.Uint64(packet[5:]))
+			assert.Equal(t, uint64(32768), binary.BigEndian.Uint64(packet[13:]))
+			assert.Equal(t, uint64(261120), binary.BigEndian.Uint64(packet[21:]))
+			assert.Equal(t, uint64(1), binary.BigEndian.Uint64(packet[29:]))
+		}
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestTransferQuotaLimits(t *testing.T) {
 	usePubKey := true
 	u := getTestUser(usePubKey)
@@ -8634,6 +8956,68 @@ func TestSSHCommands(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSSHExecAllowedCommands(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.SSHExec.AllowedCommands = []string{"ls", " cat * ", "sh -c 'exit 3'", "", "ls"}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ls", "cat *", "sh -c 'exit 3'"}, user.Filters.SSHExec.AllowedCommands)
+	err = os.MkdirAll(user.GetHomeDir(), os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(user.GetHomeDir(), testFileName), []byte("test content"), os.ModePerm)
+	assert.NoError(t, err)
+
+	out, err := runSSHCommand("ls", user, usePubKey)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), testFileName)
+	}
+	out, err = runSSHCommand(fmt.Sprintf("cat '%s'", testFileName), user, usePubKey)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test content", string(out))
+	}
+	_, err = runSSHCommand("ls -la", user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand(fmt.Sprintf("cat %s %s", testFileName, testFileName), user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand("cat /etc/passwd", user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand("cat ../../etc/passwd", user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand("env", user, usePubKey)
+	assert.Error(t, err)
+
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		session, err := conn.NewSession()
+		if assert.NoError(t, err) {
+			err = session.Run("sh -c 'exit 3'")
+			var exitErr *ssh.ExitError
+			if assert.ErrorAs(t, err, &exitErr) {
+				assert.Equal(t, 3, exitErr.ExitStatus())
+			}
+		}
+	}
+	// allowed commands are not supported for non local filesystems
+	user.FsConfig.Provider = sdk.CryptedFilesystemProvider
+	user.FsConfig.CryptConfig.Passphrase = kms.NewPlainSecret(defaultPassword)
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+	_, err = runSSHCommand("ls", user, usePubKey)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestSSHFileHash(t *testing.T) {
 	usePubKey := true
 	localUser, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
@@ -9152,6 +9536,382 @@ func TestSSHCopyRemoveNonLocalFs(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSFTPDeltaSync(t *testing.T) {
+	usePubKey := false
+	user, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		testFileSize := int64(65535)
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		info, err := client.Stat(testFileName)
+		assert.NoError(t, err)
+		hash, err := computeHashForFile(sha256.New(), testFilePath)
+		assert.NoError(t, err)
+		mtime := info.ModTime().Unix()
+
+		session, err := conn.NewSession()
+		assert.NoError(t, err)
+		defer session.Close()
+		stdin, err := session.StdinPipe()
+		assert.NoError(t, err)
+		stdout, err := session.StdoutPipe()
+		assert.NoError(t, err)
+		err = session.RequestSubsystem("sftp")
+		assert.NoError(t, err)
+
+		err = writeSFTPPacket(stdin, []byte{1, 0, 0, 0, 3})
+		assert.NoError(t, err)
+		packet, err := readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		assert.Contains(t, string(packet), "delta-sync@sftpgo.com")
+
+		type deltaSyncEntry struct {
+			path  string
+			size  int64
+			mtime int64
+			hash  string
+		}
+		for idx, test := range []struct {
+			entries  []deltaSyncEntry
+			expected []string
+		}{
+			{
+				entries: []deltaSyncEntry{
+					{testFileName, testFileSize, mtime, hash},
+					{"/" + testFileName, testFileSize, mtime, ""},
+					{"missing.dat", 10, mtime, ""},
+				},
+				expected: []string{"missing.dat"},
+			},
+			{
+				entries: []deltaSyncEntry{
+					{testFileName, testFileSize, mtime, "abcd"},
+					{"/missing.dat", 10, 0, ""},
+				},
+				expected: []string{testFileName, "/missing.dat"},
+			},
+			{
+				entries: []deltaSyncEntry{
+					{testFileName, testFileSize + 1, mtime, ""},
+					{testFileName, testFileSize, mtime - 10, ""},
+				},
+				expected: []string{testFileName},
+			},
+		} {
+			request := []byte{200}
+			request = binary.BigEndian.AppendUint32(request, uint32(idx+1))
+			request = appendSFTPString(request, "delta-sync@sftpgo.com")
+			request = binary.BigEndian.AppendUint32(request, uint32(len(test.entries)))
+			for _, entry := range test.entries {
+				request = appendSFTPString(request, entry.path)
+				request = binary.BigEndian.AppendUint64(request, uint64(entry.size))
+				request = binary.BigEndian.AppendUint64(request, uint64(entry.mtime))
+				request = appendSFTPString(request, entry.hash)
+			}
+			err = writeSFTPPacket(stdin, request)
+			assert.NoError(t, err)
+			packet, err = readSFTPPacket(stdout)
+			assert.NoError(t, err)
+			if assert.Greater(t, len(packet), 9) {
+				assert.Equal(t, byte(201), packet[0])
+				assert.Equal(t, uint32(idx+1), binary.BigEndian.Uint32(packet[1:]))
+				count := binary.BigEndian.Uint32(packet[5:])
+				data := packet[9:]
+				var paths []string
+				for i := uint32(0); i < count && len(data) >= 4; i++ {
+					length := binary.BigEndian.Uint32(data)
+					paths = append(paths, string(data[4:4+length]))
+					data = data[4+length:]
+				}
+				assert.Equal(t, test.expected, paths)
+			}
+		}
+		// invalid request
+		request := []byte{200}
+		request = binary.BigEndian.AppendUint32(request, 10)
+		request = appendSFTPString(request, "delta-sync@sftpgo.com")
+		request = binary.BigEndian.AppendUint32(request, 1)
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 9) {
+			assert.Equal(t, byte(101), packet[0])
+			assert.Equal(t, uint32(5), binary.BigEndian.Uint32(packet[5:]))
+		}
+
+		user.Permissions["/"] = []string{dataprovider.PermUpload, dataprovider.PermDownload}
+		_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+		assert.NoError(t, err)
+		// the permissions are checked for the new connections
+		conn1, client1, err := getSftpClient(user, usePubKey)
+		if assert.NoError(t, err) {
+			defer conn1.Close()
+			defer client1.Close()
+
+			session1, err := conn1.NewSession()
+			assert.NoError(t, err)
+			defer session1.Close()
+			stdin1, err := session1.StdinPipe()
+			assert.NoError(t, err)
+			stdout1, err := session1.StdoutPipe()
+			assert.NoError(t, err)
+			err = session1.RequestSubsystem("sftp")
+			assert.NoError(t, err)
+			err = writeSFTPPacket(stdin1, []byte{1, 0, 0, 0, 3})
+			assert.NoError(t, err)
+			_, err = readSFTPPacket(stdout1)
+			assert.NoError(t, err)
+			request = []byte{200}
+			request = binary.BigEndian.AppendUint32(request, 11)
+			request = appendSFTPString(request, "delta-sync@sftpgo.com")
+			request = binary.BigEndian.AppendUint32(request, 1)
+			request = appendSFTPString(request, testFileName)
+			request = binary.BigEndian.AppendUint64(request, uint64(testFileSize))
+			request = binary.BigEndian.AppendUint64(request, uint64(mtime))
+			request = appendSFTPString(request, "")
+			err = writeSFTPPacket(stdin1, request)
+			assert.NoError(t, err)
+			packet, err = readSFTPPacket(stdout1)
+			assert.NoError(t, err)
+			if assert.Greater(t, len(packet), 9) {
+				assert.Equal(t, byte(101), packet[0])
+				assert.Equal(t, uint32(3), binary.BigEndian.Uint32(packet[5:]))
+			}
+		}
+
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestSFTPDirSync(t *testing.T) {
+	usePubKey := true
+	user, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		testFileSize := int64(65535)
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = client.Mkdir("sync")
+		assert.NoError(t, err)
+		modTime := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+		for _, name := range []string{"sync/same", "sync/conflict", "sync/upload", "sync/download"} {
+			err = sftpUploadFile(testFilePath, name, testFileSize, client)
+			assert.NoError(t, err)
+			err = client.Chtimes(name, modTime, modTime)
+			assert.NoError(t, err)
+		}
+		hash, err := computeHashForFile(sha256.New(), testFilePath)
+		assert.NoError(t, err)
+		mtime := modTime.Unix()
+
+		session, err := conn.NewSession()
+		assert.NoError(t, err)
+		defer session.Close()
+		stdin, err := session.StdinPipe()
+		assert.NoError(t, err)
+		stdout, err := session.StdoutPipe()
+		assert.NoError(t, err)
+		err = session.RequestSubsystem("sftp")
+		assert.NoError(t, err)
+
+		err = writeSFTPPacket(stdin, []byte{1, 0, 0, 0, 3})
+		assert.NoError(t, err)
+		packet, err := readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 5) {
+			assert.Equal(t, byte(2), packet[0])
+			assert.Contains(t, string(packet), "dir-sync@sftpgo.com")
+		}
+
+		request := []byte{200}
+		request = binary.BigEndian.AppendUint32(request, 1)
+		request = appendSFTPString(request, "dir-sync@sftpgo.com")
+		request = appendSFTPString(request, "/sync")
+		request = binary.BigEndian.AppendUint32(request, 4)
+		for _, entry := range []struct {
+			path  string
+			hash  string
+			mtime int64
+		}{
+			{"same", hash, mtime - 100},
+			{"conflict", "abcd", mtime - 100},
+			{"upload", "abcd", mtime},
+			{"new", "abcd", mtime},
+		} {
+			request = appendSFTPString(request, entry.path)
+			request = appendSFTPString(request, entry.hash)
+			request = binary.BigEndian.AppendUint64(request, uint64(entry.mtime))
+			request = binary.BigEndian.AppendUint64(request, uint64(testFileSize))
+		}
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 5) {
+			assert.Equal(t, byte(201), packet[0])
+			assert.Equal(t, uint32(1), binary.BigEndian.Uint32(packet[1:]))
+			lists, err := parseDirSyncReply(packet[5:])
+			assert.NoError(t, err)
+			assert.Equal(t, [][]string{{"upload", "new"}, {"download"}, {"conflict"}}, lists)
+		}
+		// a standard request must work after the extended one
+		request = []byte{16}
+		request = binary.BigEndian.AppendUint32(request, 2)
+		request = appendSFTPString(request, "/sync")
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 5) {
+			assert.Equal(t, byte(104), packet[0])
+			assert.Equal(t, uint32(2), binary.BigEndian.Uint32(packet[1:]))
+		}
+		// missing directory
+		request = []byte{200}
+		request = binary.BigEndian.AppendUint32(request, 3)
+		request = appendSFTPString(request, "dir-sync@sftpgo.com")
+		request = appendSFTPString(request, "/missing")
+		request = binary.BigEndian.AppendUint32(request, 0)
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 5) {
+			assert.Equal(t, byte(201), packet[0])
+			lists, err := parseDirSyncReply(packet[5:])
+			assert.NoError(t, err)
+			assert.Equal(t, [][]string{nil, nil, nil}, lists)
+		}
+		// invalid request
+		request = []byte{200}
+		request = binary.BigEndian.AppendUint32(request, 4)
+		request = appendSFTPString(request, "dir-sync@sftpgo.com")
+		request = appendSFTPString(request, "/sync")
+		request = binary.BigEndian.AppendUint32(request, 1)
+		err = writeSFTPPacket(stdin, request)
+		assert.NoError(t, err)
+		packet, err = readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 9) {
+			assert.Equal(t, byte(101), packet[0])
+			assert.Equal(t, uint32(4), binary.BigEndian.Uint32(packet[1:]))
+			assert.Equal(t, uint32(5), binary.BigEndian.Uint32(packet[5:]))
+		}
+
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestSFTPCopyFileExtension(t *testing.T) {
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.QuotaFiles = 100
+	u.Permissions["/nodownload"] = []string{dataprovider.PermListItems, dataprovider.PermUpload}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+
+		testFileSize := int64(65535)
+		err = writeSFTPFile(testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		err = client.Mkdir("dir")
+		assert.NoError(t, err)
+		err = writeSFTPFile(path.Join("dir", testFileName), testFileSize, client)
+		assert.NoError(t, err)
+		err = client.Mkdir("nodownload")
+		assert.NoError(t, err)
+		err = writeSFTPFile(path.Join("nodownload", testFileName), testFileSize, client)
+		assert.NoError(t, err)
+
+		session, err := conn.NewSession()
+		assert.NoError(t, err)
+		defer session.Close()
+		stdin, err := session.StdinPipe()
+		assert.NoError(t, err)
+		stdout, err := session.StdoutPipe()
+		assert.NoError(t, err)
+		err = session.RequestSubsystem("sftp")
+		assert.NoError(t, err)
+
+		err = writeSFTPPacket(stdin, []byte{1, 0, 0, 0, 3})
+		assert.NoError(t, err)
+		packet, err := readSFTPPacket(stdout)
+		assert.NoError(t, err)
+		if assert.Greater(t, len(packet), 5) {
+			assert.Equal(t, byte(2), packet[0])
+			assert.Contains(t, string(packet), "copy-file@sftpgo.com")
+		}
+		for idx, test := range []struct {
+			source string
+			target string
+			status uint32
+		}{
+			{testFileName, testFileName + ".copy", 0},
+			{"/dir", "/dircopy", 0},
+			{testFileName, "/dir/" + testFileName, 8},
+			{"/missing", "/missingcopy", 2},
+			{path.Join("nodownload", testFileName), testFileName + ".copy1", 3},
+			{"", testFileName + ".copy1", 5},
+		} {
+			request := []byte{200}
+			request = binary.BigEndian.AppendUint32(request, uint32(idx+1))
+			request = appendSFTPString(request, "copy-file@sftpgo.com")
+			request = appendSFTPString(request, test.source)
+			request = appendSFTPString(request, test.target)
+			err = writeSFTPPacket(stdin, request)
+			assert.NoError(t, err)
+			packet, err = readSFTPPacket(stdout)
+			assert.NoError(t, err)
+			if assert.Greater(t, len(packet), 9) {
+				assert.Equal(t, byte(101), packet[0])
+				assert.Equal(t, uint32(idx+1), binary.BigEndian.Uint32(packet[1:]))
+				assert.Equal(t, test.status, binary.BigEndian.Uint32(packet[5:]), "source %q", test.source)
+			}
+		}
+		for _, name := range []string{testFileName + ".copy", path.Join("dircopy", testFileName)} {
+			info, err := client.Stat(name)
+			if assert.NoError(t, err) {
+				assert.Equal(t, testFileSize, info.Size())
+			}
+		}
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, user.UsedQuotaFiles)
+		assert.Equal(t, 5*testFileSize, user.UsedQuotaSize)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestSSHRemove(t *testing.T) {
 	usePubKey := false
 	u := getTestUser(usePubKey)
@@ -9869,6 +10629,56 @@ func TestSCPPatternsFilter(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestSCPAllowedPathsFilter(t *testing.T) {
+	if scpPath == "" {
+		t.Skip("scp command not found, unable to execute this test")
+	}
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.SSHExec.AllowedSCPPaths = []string{"/incoming/", " ", "incoming", "/shared/../pub"}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/incoming", "/pub"}, user.Filters.SSHExec.AllowedSCPPaths)
+	err = os.MkdirAll(filepath.Join(user.GetHomeDir(), "incoming"), os.ModePerm)
+	assert.NoError(t, err)
+	testFileSize := int64(65535)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	localPath := filepath.Join(homeBasePath, "scp_download.dat")
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	err = scpUpload(testFilePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/"), false, false)
+	assert.Error(t, err, "scp upload outside the allowed paths must fail")
+	err = scpUpload(testFilePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/incoming/"), false, false)
+	assert.NoError(t, err)
+	err = scpDownload(localPath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, path.Join("/incoming", testFileName)),
+		false, false)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(user.GetHomeDir(), testFileName), []byte("test"), os.ModePerm)
+	assert.NoError(t, err)
+	err = scpDownload(localPath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, path.Join("/", testFileName)),
+		false, false)
+	assert.Error(t, err, "scp download outside the allowed paths must fail")
+	err = scpDownload(homeBasePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/"), false, true)
+	assert.Error(t, err, "scp recursive download outside the allowed paths must fail")
+	// SFTP is not restricted
+	conn, client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		defer client.Close()
+		_, err = client.Stat(testFileName)
+		assert.NoError(t, err)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	err = os.Remove(localPath)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestSCPTransferQuotaLimits(t *testing.T) {
 	usePubKey := true
 	u := getTestUser(usePubKey)
@@ -10718,6 +11528,56 @@ func runSSHCommand(command string, user dataprovider.User, usePubKey bool) ([]by
 	return stdout.Bytes(), err
 }
 
+func writeSFTPPacket(w io.Writer, packet []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(packet))), packet...))
+	return err
+}
+
+func readSFTPPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	packet := make([]byte, binary.BigEndian.Uint32(header))
+	_, err := io.ReadFull(r, packet)
+	return packet, err
+}
+
+func appendSFTPString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint32(b, uint32(len(s))), s...)
+}
+
+// parseDirSyncReply returns the paths for the files to upload, to download and the conflicts
+func parseDirSyncReply(data []byte) ([][]string, error) {
+	var result [][]string
+	for i := 0; i < 3; i++ {
+		if len(data) < 4 {
+			return nil, errors.New("short packet")
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		var paths []string
+		for j := uint32(0); j < count; j++ {
+			for k := 0; k < 2; k++ {
+				if len(data) < 4 {
+					return nil, errors.New("short packet")
+				}
+				length := binary.BigEndian.Uint32(data)
+				if uint32(len(data)) < 4+length+16 {
+					return nil, errors.New("short packet")
+				}
+				if k == 0 {
+					paths = append(paths, string(data[4:4+length]))
+				}
+				data = data[4+length:]
+			}
+			data = data[16:]
+		}
+		result = append(result, paths)
+	}
+	return result, nil
+}
+
 func getSignerForUserCert(certBytes []byte) (ssh.Signer, error) {
 	signer, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
 	if err != nil {
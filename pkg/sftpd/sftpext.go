@@ -0,0 +1,319 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	sshFxpVersion       = 2
+	sshFxpStatus        = 101
+	sshFxpExtended      = 200
+	sshFxpExtendedReply = 201
+	// max length for the extended requests handled outside the SFTP server.
+	// Longer packets are forwarded to the SFTP server that rejects them
+	sftpExtensionMaxPacketLength = 16 * 1024 * 1024
+)
+
+// SFTP status codes
+const (
+	sshFxOk               = 0
+	sshFxNoSuchFile       = 2
+	sshFxPermissionDenied = 3
+	sshFxFailure          = 4
+	sshFxBadMessage       = 5
+	sshFxOpUnsupported    = 8
+)
+
+var errShortSFTPPacket = errors.New("packet too short")
+
+// sftpExtensionHandler handles an extended request and returns the reply packet
+// without the length, the first byte is the packet type
+type sftpExtensionHandler func(id uint32, data []byte) []byte
+
+// sftpExtensionChannel handles the SFTP extensions not supported by the SFTP server.
+// The extended requests for these extensions are not forwarded to the SFTP server,
+// the replies are written between the packets sent by the SFTP server. The extensions
+// are advertised in the SSH_FXP_VERSION packet sent by the SFTP server
+type sftpExtensionChannel struct {
+	channel  io.ReadWriteCloser
+	handlers map[string]sftpExtensionHandler
+	// only one extended request is handled at a time, the next requests
+	// are read after the previous one is completed
+	guard chan struct{}
+	// the read side is used by a single goroutine, the SFTP server packet reader
+	readBuf       []byte
+	readRemaining uint32
+	readErr       error
+	// the write side is shared by the SFTP server and the extension handlers
+	mu             sync.Mutex
+	versionBuf     []byte
+	versionSent    bool
+	writeLenBuf    []byte
+	writeRemaining uint32
+	pendingReplies [][]byte
+}
+
+func newSFTPExtensionChannel(channel io.ReadWriteCloser, handlers map[string]sftpExtensionHandler) *sftpExtensionChannel {
+	return &sftpExtensionChannel{
+		channel:  channel,
+		handlers: handlers,
+		guard:    make(chan struct{}, 1),
+	}
+}
+
+func (c *sftpExtensionChannel) Read(p []byte) (int, error) {
+	for {
+		if len(c.readBuf) > 0 {
+			n := copy(p, c.readBuf)
+			c.readBuf = c.readBuf[n:]
+			return n, nil
+		}
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if c.readRemaining > 0 {
+			if uint32(len(p)) > c.readRemaining {
+				p = p[:c.readRemaining]
+			}
+			n, err := c.channel.Read(p)
+			c.readRemaining -= uint32(n)
+			return n, err
+		}
+		c.readPacket()
+	}
+}
+
+// readPacket reads the next packet header and, for the handled extended requests,
+// the full packet. The packets not handled are forwarded to the SFTP server
+func (c *sftpExtensionChannel) readPacket() {
+	header := make([]byte, 5)
+	n, err := io.ReadFull(c.channel, header)
+	if err != nil {
+		c.readBuf = header[:n]
+		c.readErr = err
+		return
+	}
+	length := binary.BigEndian.Uint32(header)
+	if header[4] != sshFxpExtended || length < 5 || length > sftpExtensionMaxPacketLength {
+		c.readBuf = header
+		if length > 0 {
+			c.readRemaining = length - 1
+		}
+		return
+	}
+	packet := make([]byte, length-1)
+	n, err = io.ReadFull(c.channel, packet)
+	if err != nil {
+		c.readBuf = append(header, packet[:n]...)
+		c.readErr = err
+		return
+	}
+	id, data, errID := unmarshalSFTPUint32(packet)
+	extension, data, errExt := unmarshalSFTPString(data)
+	handler, ok := c.handlers[extension]
+	if errID != nil || errExt != nil || !ok {
+		c.readBuf = append(header, packet...)
+		return
+	}
+	c.guard <- struct{}{}
+	go func() {
+		defer func() {
+			<-c.guard
+		}()
+
+		c.sendReply(handler(id, data))
+	}()
+}
+
+func (c *sftpExtensionChannel) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.versionSent {
+		return len(p), c.writeVersion(p)
+	}
+	if err := c.write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *sftpExtensionChannel) Close() error {
+	return c.channel.Close()
+}
+
+// writeVersion buffers the first packet, the SSH_FXP_VERSION one, and adds the
+// handled extensions before sending it
+func (c *sftpExtensionChannel) writeVersion(p []byte) error {
+	c.versionBuf = append(c.versionBuf, p...)
+	if len(c.versionBuf) < 5 {
+		return nil
+	}
+	length := int(binary.BigEndian.Uint32(c.versionBuf))
+	if len(c.versionBuf) < length+4 {
+		return nil
+	}
+	packet := c.versionBuf[:length+4]
+	next := c.versionBuf[length+4:]
+	c.versionBuf = nil
+	c.versionSent = true
+	if packet[4] == sshFxpVersion {
+		packet = append([]byte{}, packet...)
+		for name := range c.handlers {
+			packet = marshalSFTPString(packet, name)
+			packet = marshalSFTPString(packet, "1")
+		}
+		binary.BigEndian.PutUint32(packet, uint32(len(packet)-4))
+	}
+	if err := c.write(packet); err != nil {
+		return err
+	}
+	if len(next) > 0 {
+		return c.write(next)
+	}
+	return nil
+}
+
+// write sends p and then the pending replies if a packet boundary is reached.
+// The SFTP server may send a packet using multiple writes, the replies cannot
+// be written in the middle of a packet
+func (c *sftpExtensionChannel) write(p []byte) error {
+	if _, err := c.channel.Write(p); err != nil {
+		return err
+	}
+	for len(p) > 0 {
+		if c.writeRemaining == 0 {
+			needed := 4 - len(c.writeLenBuf)
+			if len(p) < needed {
+				c.writeLenBuf = append(c.writeLenBuf, p...)
+				return nil
+			}
+			c.writeLenBuf = append(c.writeLenBuf, p[:needed]...)
+			p = p[needed:]
+			c.writeRemaining = binary.BigEndian.Uint32(c.writeLenBuf)
+			c.writeLenBuf = c.writeLenBuf[:0]
+			continue
+		}
+		n := uint32(len(p))
+		if n > c.writeRemaining {
+			n = c.writeRemaining
+		}
+		c.writeRemaining -= n
+		p = p[n:]
+	}
+	if c.isAtPacketBoundary() {
+		for len(c.pendingReplies) > 0 {
+			reply := c.pendingReplies[0]
+			c.pendingReplies = c.pendingReplies[1:]
+			if _, err := c.channel.Write(reply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *sftpExtensionChannel) isAtPacketBoundary() bool {
+	return c.versionSent && c.writeRemaining == 0 && len(c.writeLenBuf) == 0
+}
+
+func (c *sftpExtensionChannel) sendReply(reply []byte) {
+	packet := make([]byte, 4, len(reply)+4)
+	binary.BigEndian.PutUint32(packet, uint32(len(reply)))
+	packet = append(packet, reply...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isAtPacketBoundary() {
+		c.pendingReplies = append(c.pendingReplies, packet)
+		return
+	}
+	c.channel.Write(packet) //nolint:errcheck // the SFTP server will get the same error
+}
+
+func getSFTPStatusCode(err error) uint32 {
+	switch {
+	case err == nil:
+		return sshFxOk
+	case errors.Is(err, sftp.ErrSSHFxNoSuchFile):
+		return sshFxNoSuchFile
+	case errors.Is(err, sftp.ErrSSHFxPermissionDenied):
+		return sshFxPermissionDenied
+	case errors.Is(err, sftp.ErrSSHFxBadMessage):
+		return sshFxBadMessage
+	case errors.Is(err, sftp.ErrSSHFxOpUnsupported):
+		return sshFxOpUnsupported
+	default:
+		return sshFxFailure
+	}
+}
+
+// getSFTPStatusReply returns an SSH_FXP_STATUS packet for the specified error
+func getSFTPStatusReply(id uint32, err error) []byte {
+	reply := []byte{sshFxpStatus}
+	reply = marshalSFTPUint32(reply, id)
+	reply = marshalSFTPUint32(reply, getSFTPStatusCode(err))
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	reply = marshalSFTPString(reply, msg)
+	return marshalSFTPString(reply, "")
+}
+
+func marshalSFTPUint32(b []byte, v uint32) []byte {
+	return binary.BigEndian.AppendUint32(b, v)
+}
+
+func marshalSFTPUint64(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+func marshalSFTPString(b []byte, v string) []byte {
+	return append(marshalSFTPUint32(b, uint32(len(v))), v...)
+}
+
+func unmarshalSFTPUint32(b []byte) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errShortSFTPPacket
+	}
+	return binary.BigEndian.Uint32(b), b[4:], nil
+}
+
+func unmarshalSFTPUint64(b []byte) (uint64, []byte, error) {
+	if len(b) < 8 {
+		return 0, nil, errShortSFTPPacket
+	}
+	return binary.BigEndian.Uint64(b), b[8:], nil
+}
+
+func unmarshalSFTPString(b []byte) (string, []byte, error) {
+	length, b, err := unmarshalSFTPUint32(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint32(len(b)) < length {
+		return "", nil, errShortSFTPPacket
+	}
+	return string(b[:length]), b[length:], nil
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const (
+	// SFTP protocol version implemented by the server
+	serverSFTPVersion = 3
+	sshFxpInit        = 1
+	// uint32 packet length, byte packet type, uint32 version
+	sftpInitHeaderLen = 9
+)
+
+// sftpVersionChannel replays the bytes consumed to read the client version
+// and then reads from the underlying channel
+type sftpVersionChannel struct {
+	io.Reader
+	channel io.ReadWriteCloser
+}
+
+func (c *sftpVersionChannel) Write(p []byte) (int, error) {
+	return c.channel.Write(p)
+}
+
+func (c *sftpVersionChannel) Close() error {
+	return c.channel.Close()
+}
+
+// readSFTPClientVersion reads the SSH_FXP_INIT packet header and returns the
+// SFTP version requested by the client, 0 if the header cannot be parsed.
+// The returned channel must be used in place of the given one, it returns
+// the consumed bytes first so the SFTP server can handle the full packet
+func readSFTPClientVersion(channel io.ReadWriteCloser) (int, io.ReadWriteCloser) {
+	header := make([]byte, sftpInitHeaderLen)
+	n, _ := io.ReadFull(channel, header)
+	header = header[:n]
+	versionChannel := &sftpVersionChannel{
+		Reader:  io.MultiReader(bytes.NewReader(header), channel),
+		channel: channel,
+	}
+	if n < sftpInitHeaderLen || header[4] != sshFxpInit {
+		// let the SFTP server handle the error
+		return 0, versionChannel
+	}
+	return int(binary.BigEndian.Uint32(header[5:])), versionChannel
+}
+
+func getNegotiatedSFTPVersion(clientVersion int) int {
+	if clientVersion > serverSFTPVersion {
+		return serverSFTPVersion
+	}
+	return clientVersion
+}
+
+func (c *Configuration) checkSFTPVersions() error {
+	if c.MinSFTPVersion < 0 || c.MinSFTPVersion > serverSFTPVersion {
+		return fmt.Errorf("invalid min SFTP version %d, it must be between 0 and %d", c.MinSFTPVersion,
+			serverSFTPVersion)
+	}
+	if c.MaxSFTPVersion < 0 || c.MaxSFTPVersion > serverSFTPVersion {
+		return fmt.Errorf("invalid max SFTP version %d, it must be between 0 and %d", c.MaxSFTPVersion,
+			serverSFTPVersion)
+	}
+	if c.MaxSFTPVersion > 0 && c.MinSFTPVersion > c.MaxSFTPVersion {
+		return fmt.Errorf("invalid SFTP versions, min %d is greater than max %d", c.MinSFTPVersion,
+			c.MaxSFTPVersion)
+	}
+	return nil
+}
+
+// isSFTPVersionAllowed returns true if the negotiated version is within the
+// configured limits, 0 means no limit
+func (c *Configuration) isSFTPVersionAllowed(version int) bool {
+	if c.MinSFTPVersion > 0 && version < c.MinSFTPVersion {
+		return false
+	}
+	if c.MaxSFTPVersion > 0 && version > c.MaxSFTPVersion {
+		return false
+	}
+	return true
+}
+
+// negotiateSFTPVersion reads the client version, logs and stores the negotiated one.
+// It returns the channel to use for the SFTP server and false if the client
+// must be rejected
+func (c *Configuration) negotiateSFTPVersion(channel io.ReadWriteCloser, connection *Connection) (io.ReadWriteCloser, bool) {
+	clientVersion, versionChannel := readSFTPClientVersion(channel)
+	if clientVersion == 0 {
+		return versionChannel, true
+	}
+	negotiatedVersion := getNegotiatedSFTPVersion(clientVersion)
+	connection.SetSFTPVersion(negotiatedVersion)
+	logger.SFTPVersionLog(connection.GetUsername(), connection.GetID(), connection.GetLocalAddress(),
+		connection.GetRemoteAddress(), clientVersion, negotiatedVersion)
+	return versionChannel, c.isSFTPVersionAllowed(negotiatedVersion)
+}
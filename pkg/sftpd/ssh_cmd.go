@@ -113,6 +113,16 @@ func processSSHCommand(payload []byte, connection *Connection, enabledSSHCommand
 				go sshCommand.handle() //nolint:errcheck
 				return true
 			}
+		} else if err == nil && isSSHExecAllowed(connection, name, args) {
+			connection.command = msg.Command
+			connection.SetProtocol(common.ProtocolSSH)
+			sshCommand := sshCommand{
+				command:    name,
+				connection: connection,
+				args:       args,
+			}
+			go sshCommand.handleAllowedExec() //nolint:errcheck
+			return true
 		} else {
 			connection.Log(logger.LevelInfo, "ssh command not enabled/supported: %#v", name)
 		}
@@ -230,7 +240,7 @@ func (c *sshCommand) handleSFTPGoRemove() error {
 	if err != nil {
 		return c.sendErrorResponse(err)
 	}
-	if !c.connection.User.HasPerm(dataprovider.PermDelete, path.Dir(sshDestPath)) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermDelete, path.Dir(sshDestPath)) {
 		return c.sendErrorResponse(common.ErrPermissionDenied)
 	}
 	fs, fsDestPath, err := c.connection.GetFsAndResolvedPath(sshDestPath)
@@ -326,10 +336,10 @@ func (c *sshCommand) handleHashCommands() error {
 		if err != nil {
 			return c.sendErrorResponse(err)
 		}
-		if !c.connection.User.HasPerm(dataprovider.PermListItems, sshPath) {
+		if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermListItems, sshPath) {
 			return c.sendErrorResponse(c.connection.GetPermissionDeniedError())
 		}
-		hash, err := c.computeHashForFile(fs, h, fsPath)
+		hash, err := computeHashForFile(fs, h, fsPath)
 		if err != nil {
 			return c.sendErrorResponse(c.connection.GetFsError(fs, err))
 		}
@@ -351,7 +361,7 @@ func (c *sshCommand) executeSystemCommand(command systemCommand) error {
 	}
 	perms := []string{dataprovider.PermDownload, dataprovider.PermUpload, dataprovider.PermCreateDirs, dataprovider.PermListItems,
 		dataprovider.PermOverwrite, dataprovider.PermDelete}
-	if !c.connection.User.HasPerms(perms, sshDestPath) {
+	if !c.connection.GetEffectiveUser().HasPerms(perms, sshDestPath) {
 		return c.sendErrorResponse(c.connection.GetPermissionDeniedError())
 	}
 
@@ -495,7 +505,7 @@ func (c *sshCommand) getSystemCommand() (systemCommand, error) {
 	}
 	if len(c.args) > 0 {
 		var err error
-		fsPath, err = fs.ResolvePath(sshPath)
+		fsPath, err = fs.ResolvePath(c.connection.User.ResolvePathAlias(sshPath))
 		if err != nil {
 			return command, c.connection.GetFsError(fs, err)
 		}
@@ -523,7 +533,7 @@ func (c *sshCommand) getSystemCommand() (systemCommand, error) {
 		// the home dir.
 		// If the user cannot create symlinks we add the option --munge-links, if it is not
 		// already set. This should make symlinks unusable (but manually recoverable)
-		if c.connection.User.HasPerm(dataprovider.PermCreateSymlinks, c.getDestPath()) {
+		if c.connection.GetEffectiveUser().HasPerm(dataprovider.PermCreateSymlinks, c.getDestPath()) {
 			if !util.Contains(args, "--safe-links") {
 				args = append([]string{"--safe-links"}, args...)
 			}
@@ -594,34 +604,34 @@ func (c *sshCommand) getFsAndCopyPaths() (vfs.Fs, vfs.Fs, string, string, string
 }
 
 func (c *sshCommand) hasCopyPermissions(sshSourcePath, sshDestPath string, srcInfo os.FileInfo) bool {
-	if !c.connection.User.HasPerm(dataprovider.PermListItems, path.Dir(sshSourcePath)) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(sshSourcePath)) {
 		return false
 	}
 	if srcInfo.IsDir() {
-		return c.connection.User.HasPerm(dataprovider.PermCreateDirs, path.Dir(sshDestPath))
+		return c.connection.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(sshDestPath))
 	} else if srcInfo.Mode()&os.ModeSymlink != 0 {
-		return c.connection.User.HasPerm(dataprovider.PermCreateSymlinks, path.Dir(sshDestPath))
+		return c.connection.GetEffectiveUser().HasPerm(dataprovider.PermCreateSymlinks, path.Dir(sshDestPath))
 	}
-	return c.connection.User.HasPerm(dataprovider.PermUpload, path.Dir(sshDestPath))
+	return c.connection.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(sshDestPath))
 }
 
 // fsSourcePath must be a directory
 func (c *sshCommand) checkRecursiveCopyPermissions(fsSrc vfs.Fs, fsDst vfs.Fs, fsSourcePath, fsDestPath,
 	sshSourcePath, sshDestPath string,
 ) error {
-	if !c.connection.User.HasPerm(dataprovider.PermCreateDirs, path.Dir(sshDestPath)) {
+	if !c.connection.GetEffectiveUser().HasPerm(dataprovider.PermCreateDirs, path.Dir(sshDestPath)) {
 		return common.ErrPermissionDenied
 	}
-	if !c.connection.User.HasPermissionsInside(sshSourcePath) &&
-		!c.connection.User.HasPermissionsInside(sshDestPath) {
+	if !c.connection.GetEffectiveUser().HasPermissionsInside(sshSourcePath) &&
+		!c.connection.GetEffectiveUser().HasPermissionsInside(sshDestPath) {
 		// if there are no subdirs with defined permissions we can just check source and destination paths
 		dstPerms := []string{
 			dataprovider.PermCreateDirs,
 			dataprovider.PermCreateSymlinks,
 			dataprovider.PermUpload,
 		}
-		if c.connection.User.HasPerm(dataprovider.PermListItems, sshSourcePath) &&
-			c.connection.User.HasPerms(dstPerms, sshDestPath) {
+		if c.connection.GetEffectiveUser().HasPerm(dataprovider.PermListItems, sshSourcePath) &&
+			c.connection.GetEffectiveUser().HasPerms(dstPerms, sshDestPath) {
 			return nil
 		}
 		// we don't return an error here because we checked all the required permissions above
@@ -742,7 +752,7 @@ func (c *sshCommand) getSizeForPath(fs vfs.Fs, name string) (int, int64, error)
 }
 
 func (c *sshCommand) sendErrorResponse(err error) error {
-	errorString := fmt.Sprintf("%v: %v %v\n", c.command, c.getDestPath(), err)
+	errorString := fmt.Sprintf("%v: %v %v\n", c.command, c.getDestPath(), c.connection.GetClientError(err))
 	c.connection.channel.Write([]byte(errorString)) //nolint:errcheck
 	c.sendExitStatus(err)
 	return err
@@ -760,6 +770,10 @@ func (c *sshCommand) sendExitStatus(err error) {
 	}
 	if err != nil {
 		status = uint32(1)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			status = uint32(exitErr.ExitCode())
+		}
 		c.connection.Log(logger.LevelError, "command failed: %#v args: %v user: %v err: %v",
 			c.command, c.args, c.connection.User.Username, err)
 	}
@@ -794,7 +808,7 @@ func (c *sshCommand) sendExitStatus(err error) {
 	}
 }
 
-func (c *sshCommand) computeHashForFile(fs vfs.Fs, hasher hash.Hash, path string) (string, error) {
+func computeHashForFile(fs vfs.Fs, hasher hash.Hash, path string) (string, error) {
 	hash := ""
 	f, r, _, err := fs.Open(path, 0)
 	if err != nil {
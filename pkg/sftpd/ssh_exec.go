@@ -0,0 +1,212 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package sftpd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/vfs"
+)
+
+// environment variables inherited by the commands allowed using the user's
+// SSH exec filters, anything else is removed
+var sshExecInheritedEnv = []string{"PATH", "LANG", "LC_ALL", "TZ", "SYSTEMROOT", "TEMP", "TMP"}
+
+func isSSHExecAllowed(connection *Connection, name string, args []string) bool {
+	if !connection.User.Filters.SSHExec.IsAllowed(name, args) {
+		return false
+	}
+	homeDir := filepath.Clean(connection.User.GetHomeDir())
+	realHomeDir, err := filepath.EvalSymlinks(homeDir)
+	if err != nil {
+		realHomeDir = homeDir
+	}
+	for _, arg := range args {
+		if !isSSHExecArgAllowed(arg, homeDir, realHomeDir) {
+			connection.Log(logger.LevelInfo, "ssh exec command %q, argument %q not allowed outside the home dir",
+				name, arg)
+			return false
+		}
+	}
+	return true
+}
+
+// isSSHExecArgAllowed returns false if the argument, the value of an option
+// such as "--opt=value" or the value attached to a short option such as
+// "-C/path", contains ".." elements, starts with "~" or refers to a path outside
+// the user's home directory, symbolic links included. Some commands, for example
+// git, expand "~user" themselves. The command is not restricted by the user's
+// permissions and virtual folders, so it must stay inside the home directory
+func isSSHExecArgAllowed(arg, homeDir, realHomeDir string) bool {
+	values := []string{arg}
+	if _, value, ok := strings.Cut(arg, "="); ok {
+		values = append(values, value)
+	}
+	if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+		// short options can be combined and the last one can have an attached
+		// value, for example "-xzf/path", we don't know the option letters so
+		// we check every suffix starting after an option letter
+		for idx := 2; idx < len(arg) && isSSHExecOptionLetter(arg[idx-1]); idx++ {
+			values = append(values, arg[idx:])
+		}
+	}
+	for _, value := range values {
+		if strings.HasPrefix(value, "~") {
+			return false
+		}
+		for _, elem := range strings.FieldsFunc(value, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if elem == ".." {
+				return false
+			}
+		}
+		name := filepath.Join(homeDir, value)
+		if filepath.IsAbs(value) || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "\\") {
+			name = filepath.Clean(value)
+			if !isSSHExecPathInside(name, homeDir) {
+				return false
+			}
+		}
+		if !isSSHExecPathResolvedInside(name, homeDir, realHomeDir) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSSHExecOptionLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isSSHExecPathInside(name, dir string) bool {
+	return name == dir || strings.HasPrefix(name, dir+string(os.PathSeparator))
+}
+
+// isSSHExecPathResolvedInside returns true if the specified path, inside the
+// home directory, does not escape it following symbolic links. The path may not
+// exist, for example a file to create, so its nearest existing parent is checked
+func isSSHExecPathResolvedInside(name, homeDir, realHomeDir string) bool {
+	for ; name != homeDir && isSSHExecPathInside(name, homeDir); name = filepath.Dir(name) {
+		if _, err := os.Lstat(name); err != nil {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			// broken symlink or loop, the target cannot be checked
+			return false
+		}
+		return isSSHExecPathInside(resolved, realHomeDir)
+	}
+	return true
+}
+
+func (c *sshCommand) getExecEnv() []string {
+	env := []string{
+		"HOME=" + c.connection.User.GetHomeDir(),
+		"USER=" + c.connection.User.Username,
+		"LOGNAME=" + c.connection.User.Username,
+	}
+	for _, name := range sshExecInheritedEnv {
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+val)
+		}
+	}
+	return env
+}
+
+// handleAllowedExec runs a command allowed by the user's SSH exec filters.
+// The command is executed without a shell, inside the user's home directory
+// and with a sanitized environment. Its standard streams are connected to the
+// SSH channel and the exit code is propagated to the client
+func (c *sshCommand) handleAllowedExec() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error(logSender, "", "panic in handle ssh exec command: %#v stack trace: %v", r, string(debug.Stack()))
+			err = common.ErrGenericFailure
+		}
+	}()
+	if err := common.Connections.Add(c.connection); err != nil {
+		logger.Info(logSender, "", "unable to add SSH exec connection: %v", err)
+		return err
+	}
+	defer common.Connections.Remove(c.connection.GetID())
+
+	c.connection.UpdateLastActivity()
+	if err := common.CheckClosing(); err != nil {
+		return c.sendErrorResponse(err)
+	}
+	fs, err := c.connection.User.GetFilesystem(c.connection.ID)
+	if err != nil {
+		return c.sendErrorResponse(err)
+	}
+	if !vfs.IsLocalOsFs(fs) {
+		return c.sendErrorResponse(errUnsupportedConfig)
+	}
+	cmd := exec.Command(c.command, c.args...)
+	cmd.Dir = c.connection.User.GetHomeDir()
+	cmd.Env = c.getExecEnv()
+	cmd = wrapCmd(cmd, c.connection.User.GetUID(), c.connection.User.GetGID())
+
+	command := systemCommand{cmd: cmd}
+	stdin, stdout, stderr, err := command.GetSTDs()
+	if err != nil {
+		return c.sendErrorResponse(err)
+	}
+	c.connection.Log(logger.LevelDebug, "starting allowed exec command %q, args: %+v", c.command, c.args)
+	if err := cmd.Start(); err != nil {
+		return c.sendErrorResponse(err)
+	}
+
+	go func() {
+		defer stdin.Close()
+
+		w, e := io.Copy(stdin, c.connection.channel)
+		c.connection.Log(logger.LevelDebug, "command: %q, copy from remote command to stdin ended, written: %v, err: %v",
+			c.connection.command, w, e)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		w, e := io.Copy(c.connection.channel, stdout)
+		c.connection.Log(logger.LevelDebug, "command: %q, copy from stdout to remote command ended, written: %v, err: %v",
+			c.connection.command, w, e)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		w, e := io.Copy(c.connection.channel.(ssh.Channel).Stderr(), stderr)
+		c.connection.Log(logger.LevelDebug, "command: %q, copy from stderr to remote command ended, written: %v, err: %v",
+			c.connection.command, w, e)
+	}()
+
+	wg.Wait()
+	err = cmd.Wait()
+	c.sendExitStatus(err)
+	return err
+}
@@ -75,7 +75,11 @@ func ServeSubSystemConnection(user *dataprovider.User, connectionID string, read
 
 	dataprovider.UpdateLastLogin(user)
 	sftp.SetSFTPExtensions(sftpExtensions...) //nolint:errcheck
-	server := sftp.NewRequestServer(connection.channel, sftp.Handlers{
+	// version limits are not enforced here, we only track the negotiated version
+	c := Configuration{}
+	sftpChannel, _ := c.negotiateSFTPVersion(connection.channel, connection)
+	sftpChannel = newSFTPExtensionChannel(sftpChannel, connection.getSFTPExtensionHandlers())
+	server := sftp.NewRequestServer(sftpChannel, sftp.Handlers{
 		FileGet:  connection,
 		FilePut:  connection,
 		FileCmd:  connection,
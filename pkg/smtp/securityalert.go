@@ -0,0 +1,203 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+// Supported security alert events
+const (
+	SecurityAlertLoginCooldown     = "Account locked"
+	SecurityAlertIPBlocked         = "IP blocked"
+	SecurityAlertAdmin2FADisabled  = "Admin 2FA disabled"
+	SecurityAlertConfigurationTest = "Configuration test"
+	SecurityAlertFileAccessAnomaly = "File access anomaly"
+)
+
+const (
+	// alerts generated within this window are sent using a single email
+	securityAlertsBatchWindow = 60 * time.Second
+	// max alerts included in a single email, a brute force attack could
+	// generate a lot of events
+	securityAlertsMaxPerBatch = 500
+)
+
+var (
+	securityAlertEmail string
+	securityAlerts     securityAlertBatcher
+)
+
+// SecurityAlert defines a security relevant event to notify
+type SecurityAlert struct {
+	Event     string
+	Timestamp time.Time
+	Username  string
+	IP        string
+	Protocol  string
+}
+
+type securityAlertSummary struct {
+	Event string
+	Count int
+}
+
+type securityAlertData struct {
+	Total   int
+	Omitted int
+	Start   string
+	End     string
+	Summary []securityAlertSummary
+	Alerts  []securityAlert
+}
+
+type securityAlert struct {
+	Event     string
+	Timestamp string
+	Username  string
+	IP        string
+	Protocol  string
+}
+
+func getSecurityAlertData(alerts []SecurityAlert, total int) securityAlertData {
+	data := securityAlertData{
+		Total:   total,
+		Omitted: total - len(alerts),
+	}
+	counters := make(map[string]int)
+	for idx, alert := range alerts {
+		counters[alert.Event]++
+		if idx == 0 {
+			data.Start = alert.Timestamp.UTC().Format(time.RFC1123)
+		}
+		data.End = alert.Timestamp.UTC().Format(time.RFC1123)
+		data.Alerts = append(data.Alerts, securityAlert{
+			Event:     alert.Event,
+			Timestamp: alert.Timestamp.UTC().Format(time.RFC3339),
+			Username:  alert.Username,
+			IP:        alert.IP,
+			Protocol:  alert.Protocol,
+		})
+	}
+	for event, count := range counters {
+		data.Summary = append(data.Summary, securityAlertSummary{
+			Event: event,
+			Count: count,
+		})
+	}
+	sort.Slice(data.Summary, func(i, j int) bool {
+		if data.Summary[i].Count == data.Summary[j].Count {
+			return data.Summary[i].Event < data.Summary[j].Event
+		}
+		return data.Summary[i].Count > data.Summary[j].Count
+	})
+	return data
+}
+
+// securityAlertBatcher collects the security alerts and sends them
+// together once the batch window expires
+type securityAlertBatcher struct {
+	mu     sync.Mutex
+	alerts []SecurityAlert
+	total  int
+	timer  *time.Timer
+}
+
+func (b *securityAlertBatcher) add(alert SecurityAlert) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.total++
+	if len(b.alerts) < securityAlertsMaxPerBatch {
+		b.alerts = append(b.alerts, alert)
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(securityAlertsBatchWindow, b.flush)
+	}
+}
+
+func (b *securityAlertBatcher) flush() {
+	b.mu.Lock()
+	alerts := b.alerts
+	total := b.total
+	b.alerts = nil
+	b.total = 0
+	b.timer = nil
+	b.mu.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	if err := sendSecurityAlerts(alerts, total); err != nil {
+		logger.Warn(logSender, "", "unable to send %d security alerts: %v", total, err)
+		return
+	}
+	logger.Debug(logSender, "", "%d security alerts sent to %q", total, securityAlertEmail)
+}
+
+// IsSecurityAlertEnabled returns true if an SMTP server and an email
+// address for the security alerts are configured
+func IsSecurityAlertEnabled() bool {
+	return smtpServer != nil && securityAlertEmail != ""
+}
+
+// AddSecurityAlert queues the specified security alert. The alerts are sent,
+// in a single email, after a batch window, so a brute force attack does
+// not flood the security team mailbox
+func AddSecurityAlert(alert SecurityAlert) {
+	if !IsSecurityAlertEnabled() {
+		return
+	}
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+	securityAlerts.add(alert)
+}
+
+// SendTestSecurityAlert sends, without batching, a test alert to the
+// configured security alert email
+func SendTestSecurityAlert(username, ip, protocol string) error {
+	if !IsSecurityAlertEnabled() {
+		return errors.New("smtp: security alerts not configured")
+	}
+	return sendSecurityAlerts([]SecurityAlert{
+		{
+			Event:     SecurityAlertConfigurationTest,
+			Timestamp: time.Now(),
+			Username:  username,
+			IP:        ip,
+			Protocol:  protocol,
+		},
+	}, 1)
+}
+
+func sendSecurityAlerts(alerts []SecurityAlert, total int) error {
+	body := new(bytes.Buffer)
+	if err := emailTemplates[templateSecurityAlert].Execute(body, getSecurityAlertData(alerts, total)); err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("SFTPGo - Security alert, %d events", total)
+	if total == 1 {
+		subject = fmt.Sprintf("SFTPGo - Security alert, %s", alerts[0].Event)
+	}
+	return SendEmail([]string{securityAlertEmail}, subject, body.String(), EmailContentTypeTextHTML)
+}
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	netmail "net/mail"
 	"path/filepath"
 	"time"
 
@@ -45,6 +46,8 @@ const (
 const (
 	templateEmailDir      = "email"
 	templatePasswordReset = "reset-password.html"
+	templateQuotaWarning  = "quota-warning.html"
+	templateSecurityAlert = "security-alert.html"
 )
 
 var (
@@ -86,11 +89,16 @@ type Config struct {
 	// Path to the email templates. This can be an absolute path or a path relative to the config dir.
 	// Templates are searched within a subdirectory named "email" in the specified path
 	TemplatesPath string `json:"templates_path" mapstructure:"templates_path"`
+	// Email address to notify about security relevant events, for example
+	// accounts locked after failed logins or blocked IP addresses.
+	// Leave empty to disable security alerts
+	SecurityAlertEmail string `json:"security_alert_email" mapstructure:"security_alert_email"`
 }
 
 // Initialize initialized and validates the SMTP configuration
 func (c *Config) Initialize(configDir string) error {
 	smtpServer = nil
+	securityAlertEmail = ""
 	if c.Host == "" {
 		logger.Debug(logSender, "", "configuration disabled, email capabilities will not be available")
 		return nil
@@ -104,12 +112,18 @@ func (c *Config) Initialize(configDir string) error {
 	if c.Encryption < 0 || c.Encryption > 2 {
 		return fmt.Errorf("smtp: invalid encryption %v", c.Encryption)
 	}
+	if c.SecurityAlertEmail != "" {
+		if _, err := netmail.ParseAddress(c.SecurityAlertEmail); err != nil {
+			return fmt.Errorf("smtp: invalid security alert email %q: %w", c.SecurityAlertEmail, err)
+		}
+	}
 	templatesPath := util.FindSharedDataPath(c.TemplatesPath, configDir)
 	if templatesPath == "" {
 		return fmt.Errorf("smtp: invalid templates path %#v", templatesPath)
 	}
 	loadTemplates(filepath.Join(templatesPath, templateEmailDir))
 	from = c.From
+	securityAlertEmail = c.SecurityAlertEmail
 	smtpServer = mail.NewSMTPClient()
 	smtpServer.Host = c.Host
 	smtpServer.Port = c.Port
@@ -123,8 +137,9 @@ func (c *Config) Initialize(configDir string) error {
 	if c.Domain != "" {
 		smtpServer.Helo = c.Domain
 	}
-	logger.Debug(logSender, "", "configuration successfully initialized, host: %#v, port: %v, username: %#v, auth: %v, encryption: %v, helo: %#v",
-		smtpServer.Host, smtpServer.Port, smtpServer.Username, smtpServer.Authentication, smtpServer.Encryption, smtpServer.Helo)
+	logger.Debug(logSender, "", "configuration successfully initialized, host: %#v, port: %v, username: %#v, auth: %v, encryption: %v, helo: %#v, security alert email: %q",
+		smtpServer.Host, smtpServer.Port, smtpServer.Username, smtpServer.Authentication, smtpServer.Encryption, smtpServer.Helo,
+		securityAlertEmail)
 	return nil
 }
 
@@ -159,7 +174,15 @@ func loadTemplates(templatesPath string) {
 	passwordResetPath := filepath.Join(templatesPath, templatePasswordReset)
 	pwdResetTmpl := util.LoadTemplate(nil, passwordResetPath)
 
+	quotaWarningPath := filepath.Join(templatesPath, templateQuotaWarning)
+	quotaWarningTmpl := util.LoadTemplate(nil, quotaWarningPath)
+
+	securityAlertPath := filepath.Join(templatesPath, templateSecurityAlert)
+	securityAlertTmpl := util.LoadTemplate(nil, securityAlertPath)
+
 	emailTemplates[templatePasswordReset] = pwdResetTmpl
+	emailTemplates[templateQuotaWarning] = quotaWarningTmpl
+	emailTemplates[templateSecurityAlert] = securityAlertTmpl
 }
 
 // RenderPasswordResetTemplate executes the password reset template
@@ -170,8 +193,24 @@ func RenderPasswordResetTemplate(buf *bytes.Buffer, data any) error {
 	return emailTemplates[templatePasswordReset].Execute(buf, data)
 }
 
+// RenderQuotaWarningTemplate executes the quota warning template
+func RenderQuotaWarningTemplate(buf *bytes.Buffer, data any) error {
+	if smtpServer == nil {
+		return errors.New("smtp: not configured")
+	}
+	return emailTemplates[templateQuotaWarning].Execute(buf, data)
+}
+
 // SendEmail tries to send an email using the specified parameters.
 func SendEmail(to []string, subject, body string, contentType EmailContentType, attachments ...mail.File) error {
+	return SendEmailWithBCC(to, nil, subject, body, contentType, attachments...)
+}
+
+// SendEmailWithBCC is like SendEmail but it also sends a blind carbon copy
+// to the specified recipients
+func SendEmailWithBCC(to, bcc []string, subject, body string, contentType EmailContentType,
+	attachments ...mail.File,
+) error {
 	if smtpServer == nil {
 		return errors.New("smtp: not configured")
 	}
@@ -188,6 +227,9 @@ func SendEmail(to []string, subject, body string, contentType EmailContentType,
 		email.SetFrom(smtpServer.Username)
 	}
 	email.AddTo(to...).SetSubject(subject)
+	if len(bcc) > 0 {
+		email.AddBcc(bcc...)
+	}
 	switch contentType {
 	case EmailContentTypeTextPlain:
 		email.SetBody(mail.TextPlain, body)
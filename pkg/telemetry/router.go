@@ -22,6 +22,7 @@ import (
 	"github.com/go-chi/render"
 
 	"github.com/drakkan/sftpgo/v2/pkg/common"
+	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/metric"
 )
@@ -34,6 +35,11 @@ func initializeRouter(enableProfiler bool) {
 
 	router.Group(func(r chi.Router) {
 		r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			if err := kms.CheckHealth(); err != nil {
+				render.Status(r, http.StatusServiceUnavailable)
+				render.PlainText(w, r, "KMS unavailable")
+				return
+			}
 			render.PlainText(w, r, "ok")
 		})
 	})
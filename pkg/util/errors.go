@@ -85,6 +85,11 @@ func (e *MethodDisabledError) Error() string {
 	return fmt.Sprintf("Method disabled error: %s", e.err)
 }
 
+// GetErrorString returns the unmodified error string
+func (e *MethodDisabledError) GetErrorString() string {
+	return e.err
+}
+
 // NewMethodDisabledError returns a method disabled error
 func NewMethodDisabledError(error string) *MethodDisabledError {
 	return &MethodDisabledError{
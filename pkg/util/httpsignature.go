@@ -0,0 +1,188 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported HTTP request signature versions
+const (
+	HTTPSignatureV1 = 1
+)
+
+const (
+	// HTTPSignatureAlgorithm is the algorithm identifier used in the Authorization header
+	HTTPSignatureAlgorithm = "SFTPGo-HMAC-SHA256"
+	// HTTPSignatureContentHashHeader is the header containing the hex encoded SHA-256
+	// of the request body
+	HTTPSignatureContentHashHeader = "X-Sftpgo-Content-Sha256"
+	// HTTPSignatureUnsignedPayload is the content hash used for streamed request bodies,
+	// the body is not included in the signature
+	HTTPSignatureUnsignedPayload = "UNSIGNED-PAYLOAD"
+	// HTTPSignatureDefaultMaxSkew is the default maximum allowed difference between
+	// the Date header of a signed request and the current time
+	HTTPSignatureDefaultMaxSkew = 5 * time.Minute
+)
+
+const (
+	httpSignatureMaxBodySize = 1048576
+)
+
+var (
+	httpSignatureEmptyPayloadHash = getSHA256Hex(nil)
+)
+
+// SignHTTPRequest signs the given request using the signature version 1.
+// It sets the Date, the content hash and the Authorization headers.
+// payloadHash is the hex encoded SHA-256 of the request body, use
+// HTTPSignatureUnsignedPayload for streamed bodies and an empty string
+// for requests without a body
+func SignHTTPRequest(req *http.Request, credential string, key []byte, payloadHash string) {
+	if payloadHash == "" {
+		payloadHash = httpSignatureEmptyPayloadHash
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set(HTTPSignatureContentHashHeader, payloadHash)
+	signature := computeHTTPSignature(req, key, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s,Signature=%s", HTTPSignatureAlgorithm,
+		url.QueryEscape(credential), hex.EncodeToString(signature)))
+}
+
+// VerifyHTTPRequestSignature verifies a request signed using SignHTTPRequest and
+// returns the credential included in the signature.
+// getKey must return the signing key for the given credential.
+// Requests whose Date header differs from the current time by more than maxSkew
+// are rejected, this limits the window in which a captured request can be replayed.
+// If maxSkew is not positive HTTPSignatureDefaultMaxSkew is used.
+// If the payload is signed the request body is read, checked and then replaced
+// so it can be read again by the caller
+func VerifyHTTPRequestSignature(req *http.Request, maxSkew time.Duration,
+	getKey func(credential string) ([]byte, error),
+) (string, error) {
+	credential, signature, err := parseHTTPSignatureHeader(req.Header.Get("Authorization"))
+	if err != nil {
+		return "", err
+	}
+	if maxSkew <= 0 {
+		maxSkew = HTTPSignatureDefaultMaxSkew
+	}
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil {
+		return credential, fmt.Errorf("invalid signature date: %w", err)
+	}
+	if skew := time.Since(date); skew > maxSkew || skew < -maxSkew {
+		return credential, fmt.Errorf("signature date %s is outside the allowed time window", date.UTC())
+	}
+	payloadHash := req.Header.Get(HTTPSignatureContentHashHeader)
+	if payloadHash == "" {
+		return credential, errors.New("missing signature content hash")
+	}
+	if payloadHash != HTTPSignatureUnsignedPayload {
+		if err := checkHTTPSignaturePayload(req, payloadHash); err != nil {
+			return credential, err
+		}
+	}
+	key, err := getKey(credential)
+	if err != nil {
+		return credential, err
+	}
+	if len(key) == 0 {
+		return credential, errors.New("invalid signing key")
+	}
+	if !hmac.Equal(signature, computeHTTPSignature(req, key, payloadHash)) {
+		return credential, errors.New("signature mismatch")
+	}
+	return credential, nil
+}
+
+func parseHTTPSignatureHeader(value string) (string, []byte, error) {
+	if !strings.HasPrefix(value, HTTPSignatureAlgorithm+" ") {
+		return "", nil, errors.New("missing or unsupported signature")
+	}
+	var credential, signature string
+	for _, param := range strings.Split(strings.TrimPrefix(value, HTTPSignatureAlgorithm+" "), ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			return "", nil, fmt.Errorf("invalid signature parameter %q", param)
+		}
+		switch key {
+		case "Credential":
+			unescaped, err := url.QueryUnescape(val)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid signature credential: %w", err)
+			}
+			credential = unescaped
+		case "Signature":
+			signature = val
+		}
+	}
+	decoded, err := hex.DecodeString(signature)
+	if err != nil || len(decoded) != sha256.Size {
+		return credential, nil, errors.New("invalid signature value")
+	}
+	return credential, decoded, nil
+}
+
+func checkHTTPSignaturePayload(req *http.Request, payloadHash string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, httpSignatureMaxBodySize+1))
+		if err != nil {
+			return fmt.Errorf("unable to read the request body: %w", err)
+		}
+		if len(body) > httpSignatureMaxBodySize {
+			return errors.New("request body too large to verify the signature")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal([]byte(payloadHash), []byte(getSHA256Hex(body))) {
+		return errors.New("content hash mismatch")
+	}
+	return nil
+}
+
+// getHTTPCanonicalRequest returns the string to sign for the signature version 1
+func getHTTPCanonicalRequest(req *http.Request, payloadHash string) string {
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		req.Header.Get("Date"),
+		payloadHash,
+	}, "\n")
+}
+
+func computeHTTPSignature(req *http.Request, key []byte, payloadHash string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(getHTTPCanonicalRequest(req, payloadHash)))
+	return mac.Sum(nil)
+}
+
+func getSHA256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
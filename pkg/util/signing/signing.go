@@ -0,0 +1,135 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package signing implements HMAC-SHA256 signed URLs. A signed upload URL
+// allows to upload a file to a single path, without any other authentication,
+// until it expires
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters embedded in a signed upload URL
+const (
+	QueryParamUsername  = "X-SFTPGo-Username"
+	QueryParamPath      = "X-SFTPGo-Path"
+	QueryParamExpires   = "X-SFTPGo-Expires"
+	QueryParamMaxSize   = "X-SFTPGo-Max-Size"
+	QueryParamSignature = "X-SFTPGo-Signature"
+)
+
+const (
+	uploadSignatureVersion = "SFTPGo-Upload-V1"
+)
+
+// Signed URL verification errors
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("the signed URL is expired")
+	ErrPathMismatch     = errors.New("the signed path does not match the requested path")
+)
+
+// UploadParams defines the parameters embedded in a signed upload URL
+type UploadParams struct {
+	Username  string
+	Path      string
+	ExpiresAt time.Time
+	// Maximum allowed size for the uploaded file, 0 means no limit other
+	// than the ones configured for the user
+	MaxSize int64
+}
+
+func (p *UploadParams) getStringToSign() string {
+	return strings.Join([]string{
+		uploadSignatureVersion,
+		url.QueryEscape(p.Username),
+		url.QueryEscape(p.Path),
+		strconv.FormatInt(p.ExpiresAt.Unix(), 10),
+		strconv.FormatInt(p.MaxSize, 10),
+	}, "\n")
+}
+
+func (p *UploadParams) getSignature(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(p.getStringToSign()))
+	return mac.Sum(nil)
+}
+
+// IsSigned returns true if the given query includes a signature
+func IsSigned(query url.Values) bool {
+	return query.Has(QueryParamSignature)
+}
+
+// SignUpload returns the query parameters, signature included, that
+// authorize the upload described by params
+func SignUpload(key []byte, params UploadParams) url.Values {
+	params.Path = cleanPath(params.Path)
+	query := url.Values{}
+	query.Set(QueryParamUsername, params.Username)
+	query.Set(QueryParamPath, params.Path)
+	query.Set(QueryParamExpires, strconv.FormatInt(params.ExpiresAt.Unix(), 10))
+	query.Set(QueryParamMaxSize, strconv.FormatInt(params.MaxSize, 10))
+	query.Set(QueryParamSignature, hex.EncodeToString(params.getSignature(key)))
+	return query
+}
+
+// VerifyUpload verifies the signed query parameters for an upload to
+// requestPath and returns the signed parameters. The signature is checked
+// before the path and the expiration, so unsigned values are never trusted
+func VerifyUpload(key []byte, requestPath string, query url.Values) (UploadParams, error) {
+	var params UploadParams
+
+	signature, err := hex.DecodeString(query.Get(QueryParamSignature))
+	if err != nil || len(signature) != sha256.Size {
+		return params, ErrInvalidSignature
+	}
+	params.Username = query.Get(QueryParamUsername)
+	params.Path = query.Get(QueryParamPath)
+	if params.Username == "" || params.Path == "" {
+		return params, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(QueryParamExpires), 10, 64)
+	if err != nil {
+		return params, ErrInvalidSignature
+	}
+	params.ExpiresAt = time.Unix(expires, 0)
+	params.MaxSize, err = strconv.ParseInt(query.Get(QueryParamMaxSize), 10, 64)
+	if err != nil || params.MaxSize < 0 {
+		return params, ErrInvalidSignature
+	}
+	if !hmac.Equal(signature, params.getSignature(key)) {
+		return params, ErrInvalidSignature
+	}
+	if params.Path != cleanPath(requestPath) {
+		return params, ErrPathMismatch
+	}
+	if time.Now().After(params.ExpiresAt) {
+		return params, fmt.Errorf("%w, expired at %s", ErrExpired, params.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return params, nil
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
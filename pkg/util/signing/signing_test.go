@@ -0,0 +1,193 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package signing
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("test signing key")
+
+func getTestParams() UploadParams {
+	return UploadParams{
+		Username:  "user",
+		Path:      "/dir/file.txt",
+		ExpiresAt: time.Now().Add(time.Hour),
+		MaxSize:   1024,
+	}
+}
+
+func TestSignAndVerifyUpload(t *testing.T) {
+	params := getTestParams()
+	query := SignUpload(testKey, params)
+	assert.True(t, IsSigned(query))
+	assert.False(t, IsSigned(url.Values{}))
+
+	verified, err := VerifyUpload(testKey, params.Path, query)
+	require.NoError(t, err)
+	assert.Equal(t, params.Username, verified.Username)
+	assert.Equal(t, params.Path, verified.Path)
+	assert.Equal(t, params.ExpiresAt.Unix(), verified.ExpiresAt.Unix())
+	assert.Equal(t, params.MaxSize, verified.MaxSize)
+	// the query survives encoding and decoding
+	decoded, err := url.ParseQuery(query.Encode())
+	require.NoError(t, err)
+	_, err = VerifyUpload(testKey, params.Path, decoded)
+	assert.NoError(t, err)
+	// a different key invalidates the signature
+	_, err = VerifyUpload([]byte("another key"), params.Path, query)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestVerifyTamperedUpload(t *testing.T) {
+	params := getTestParams()
+	testCases := []struct {
+		name  string
+		param string
+		value string
+	}{
+		{"username", QueryParamUsername, "admin"},
+		{"empty username", QueryParamUsername, ""},
+		{"path", QueryParamPath, "/dir/other.txt"},
+		{"empty path", QueryParamPath, ""},
+		{"expiration", QueryParamExpires, "4102444800"},
+		{"invalid expiration", QueryParamExpires, "invalid"},
+		{"max size", QueryParamMaxSize, "0"},
+		{"greater max size", QueryParamMaxSize, "1048576"},
+		{"negative max size", QueryParamMaxSize, "-1"},
+		{"invalid max size", QueryParamMaxSize, "invalid"},
+		{"invalid signature", QueryParamSignature, "invalid"},
+		{"short signature", QueryParamSignature, "abcd"},
+		{"empty signature", QueryParamSignature, ""},
+	}
+	for _, tc := range testCases {
+		query := SignUpload(testKey, params)
+		query.Set(tc.param, tc.value)
+		_, err := VerifyUpload(testKey, params.Path, query)
+		assert.ErrorIs(t, err, ErrInvalidSignature, tc.name)
+	}
+	// a signature copied from another URL is not valid
+	query := SignUpload(testKey, params)
+	otherParams := params
+	otherParams.Path = "/dir/other.txt"
+	query.Set(QueryParamSignature, SignUpload(testKey, otherParams).Get(QueryParamSignature))
+	_, err := VerifyUpload(testKey, params.Path, query)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	// the signature is case insensitive hex, any other change is rejected
+	query = SignUpload(testKey, params)
+	signature := query.Get(QueryParamSignature)
+	query.Set(QueryParamSignature, strings.ToUpper(signature))
+	_, err = VerifyUpload(testKey, params.Path, query)
+	assert.NoError(t, err)
+	replacement := "0"
+	if signature[0] == '0' {
+		replacement = "1"
+	}
+	query.Set(QueryParamSignature, replacement+signature[1:])
+	_, err = VerifyUpload(testKey, params.Path, query)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestVerifyUploadPathMismatch(t *testing.T) {
+	params := getTestParams()
+	query := SignUpload(testKey, params)
+	_, err := VerifyUpload(testKey, "/dir/other.txt", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+	_, err = VerifyUpload(testKey, "/dir", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+	_, err = VerifyUpload(testKey, "/dir/file.txt/sub", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+}
+
+func TestVerifyExpiredUpload(t *testing.T) {
+	params := getTestParams()
+	params.ExpiresAt = time.Now().Add(-time.Minute)
+	query := SignUpload(testKey, params)
+	verified, err := VerifyUpload(testKey, params.Path, query)
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Equal(t, params.ExpiresAt.Unix(), verified.ExpiresAt.Unix())
+	// the signature is checked before the expiration
+	query.Set(QueryParamUsername, "admin")
+	_, err = VerifyUpload(testKey, params.Path, query)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	// the path is checked before the expiration
+	query = SignUpload(testKey, params)
+	_, err = VerifyUpload(testKey, "/other.txt", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+}
+
+func TestUploadPathNormalization(t *testing.T) {
+	testCases := []struct {
+		signedPath  string
+		cleanedPath string
+		requestPath string
+	}{
+		{"dir/file.txt", "/dir/file.txt", "/dir/file.txt"},
+		{"/dir/../file.txt", "/file.txt", "/file.txt"},
+		{"//dir/./file.txt", "/dir/file.txt", "dir/sub/../file.txt"},
+		{"/../../file.txt", "/file.txt", "/file.txt"},
+		{"/dir/file.txt/", "/dir/file.txt", "/dir/file.txt"},
+	}
+	for _, tc := range testCases {
+		params := getTestParams()
+		params.Path = tc.signedPath
+		query := SignUpload(testKey, params)
+		assert.Equal(t, tc.cleanedPath, query.Get(QueryParamPath))
+		verified, err := VerifyUpload(testKey, tc.requestPath, query)
+		if assert.NoError(t, err, tc.signedPath) {
+			assert.Equal(t, tc.cleanedPath, verified.Path)
+		}
+	}
+}
+
+func TestUploadPathEscaping(t *testing.T) {
+	for _, p := range []string{"/dir/file name.txt", "/dir/a&b=c.txt", "/dir/a+b.txt", "/dir/a%2Fb.txt",
+		"/dir/file?.txt", "/dir/fïlé 文件.txt", "/dir/a\nb.txt"} {
+		params := getTestParams()
+		params.Path = p
+		query := SignUpload(testKey, params)
+		decoded, err := url.ParseQuery(query.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, p, decoded.Get(QueryParamPath))
+		_, err = VerifyUpload(testKey, p, decoded)
+		assert.NoError(t, err, p)
+	}
+	// escaped and unescaped paths are different paths
+	params := getTestParams()
+	params.Path = "/dir/a%2Fb.txt"
+	query := SignUpload(testKey, params)
+	_, err := VerifyUpload(testKey, "/dir/a/b.txt", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+	params.Path = "/dir/file name.txt"
+	query = SignUpload(testKey, params)
+	_, err = VerifyUpload(testKey, "/dir/file%20name.txt", query)
+	assert.ErrorIs(t, err, ErrPathMismatch)
+	// the separator used in the string to sign cannot be injected using the
+	// username or the path
+	params = getTestParams()
+	params.Username = "user\n/dir/file.txt"
+	params.Path = "/other.txt"
+	query = SignUpload(testKey, params)
+	query.Set(QueryParamUsername, "user")
+	query.Set(QueryParamPath, "/dir/file.txt\n/other.txt")
+	_, err = VerifyUpload(testKey, "/dir/file.txt\n/other.txt", query)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
@@ -277,13 +277,46 @@ func ParseBytes(s string) (int64, error) {
 }
 
 // GetIPFromRemoteAddress returns the IP from the remote address.
-// If the given remote address cannot be parsed it will be returned unchanged
+// IPv6 addresses can be enclosed in square brackets, for example [::1]:22 or [::1],
+// and IPv4-mapped IPv6 addresses, for example ::ffff:192.168.1.1, are returned in
+// the IPv4 form. If the given remote address cannot be parsed it will be returned unchanged
 func GetIPFromRemoteAddress(remoteAddress string) string {
 	ip, _, err := net.SplitHostPort(remoteAddress)
-	if err == nil {
-		return ip
+	if err != nil {
+		if !strings.HasPrefix(remoteAddress, "[") || !strings.HasSuffix(remoteAddress, "]") {
+			ip = remoteAddress
+		} else {
+			ip = remoteAddress[1 : len(remoteAddress)-1]
+		}
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	if err != nil {
+		return remoteAddress
+	}
+	return ip
+}
+
+// NormalizeIP returns the canonical string representation for the specified IP
+// address, so the same address is always represented in the same way: IPv6
+// addresses are lower case and compressed and IPv4-mapped IPv6 addresses are
+// returned in the IPv4 form. Invalid IP addresses are returned unchanged
+func NormalizeIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
+
+// JoinHostPort returns the listening address for the specified address and port.
+// IPv6 addresses are enclosed in square brackets, they can be specified with or
+// without the brackets
+func JoinHostPort(address string, port int) string {
+	if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+		address = address[1 : len(address)-1]
 	}
-	return remoteAddress
+	return net.JoinHostPort(address, strconv.Itoa(port))
 }
 
 // NilIfEmpty returns nil if the input string is empty
@@ -294,6 +327,11 @@ func NilIfEmpty(s string) *string {
 	return &s
 }
 
+// BoolPtr returns a pointer to the specified bool value
+func BoolPtr(val bool) *bool {
+	return &val
+}
+
 // GetStringFromPointer returns the string value or empty if nil
 func GetStringFromPointer(val *string) string {
 	if val == nil {
@@ -541,7 +579,7 @@ func HTTPListenAndServe(srv *http.Server, address string, port int, isTLS bool,
 		listener, err = newListener("unix", address, srv.ReadTimeout, srv.WriteTimeout)
 	} else {
 		CheckTCP4Port(port)
-		listener, err = newListener("tcp", fmt.Sprintf("%s:%d", address, port), srv.ReadTimeout, srv.WriteTimeout)
+		listener, err = newListener("tcp", JoinHostPort(address, port), srv.ReadTimeout, srv.WriteTimeout)
 	}
 	if err != nil {
 		return err
@@ -632,6 +670,16 @@ func GetSSHPublicKeyAsString(pubKey []byte) (string, error) {
 // GetRealIP returns the ip address as result of parsing either the
 // X-Real-IP header or the X-Forwarded-For header
 func GetRealIP(r *http.Request, header string, depth int) string {
+	return GetClientIP(r, header, depth, nil)
+}
+
+// GetClientIP returns the client ip address as result of parsing the specified
+// proxy header. Headers such as X-Forwarded-For can contain multiple IP addresses,
+// each proxy appends the address it received the request from. The addresses of
+// the trusted proxies are skipped, starting from the right, so the last untrusted
+// hop is used, and depth defines the position to use among the remaining addresses.
+// An empty string is returned if no valid IP address can be found
+func GetClientIP(r *http.Request, header string, depth int, trustedProxies []func(net.IP) bool) string {
 	if header == "" {
 		return ""
 	}
@@ -639,23 +687,38 @@ func GetRealIP(r *http.Request, header string, depth int) string {
 
 	for _, h := range r.Header.Values(header) {
 		for _, ipStr := range strings.Split(h, ",") {
-			ipStr = strings.TrimSpace(ipStr)
+			ipStr = GetIPFromRemoteAddress(strings.TrimSpace(ipStr))
 			ipAddresses = append(ipAddresses, ipStr)
 		}
 	}
 
-	idx := len(ipAddresses) - 1 - depth
-	if idx >= 0 {
-		ip := strings.TrimSpace(ipAddresses[idx])
-		if ip == "" || net.ParseIP(ip) == nil {
+	for idx := len(ipAddresses) - 1; idx >= 0; idx-- {
+		ip := net.ParseIP(ipAddresses[idx])
+		if ip != nil && isTrustedProxy(ip, trustedProxies) {
+			continue
+		}
+		if depth > 0 {
+			depth--
+			continue
+		}
+		if ip == nil {
 			return ""
 		}
-		return ip
+		return ipAddresses[idx]
 	}
 
 	return ""
 }
 
+func isTrustedProxy(ip net.IP, trustedProxies []func(net.IP) bool) bool {
+	for _, isTrusted := range trustedProxies {
+		if isTrusted(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetHTTPLocalAddress returns the local address for an http.Request
 // or empty if it cannot be determined
 func GetHTTPLocalAddress(r *http.Request) string {
@@ -33,6 +33,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
@@ -74,6 +75,14 @@ func init() {
 
 // NewAzBlobFs returns an AzBlobFs object that allows to interact with Azure Blob storage
 func NewAzBlobFs(connectionID, localTempDir, mountPath string, config AzBlobFsConfig) (Fs, error) {
+	fs, err := newAzBlobFs(connectionID, localTempDir, mountPath, config)
+	if err != nil || !fs.config.ContentAddressed {
+		return fs, err
+	}
+	return newCASFs(fs, fs.getStorageID(), fs.config.KeyPrefix, fs.localTempDir), nil
+}
+
+func newAzBlobFs(connectionID, localTempDir, mountPath string, config AzBlobFsConfig) (*AzureBlobFs, error) {
 	if localTempDir == "" {
 		if tempPath != "" {
 			localTempDir = tempPath
@@ -122,7 +131,7 @@ func NewAzBlobFs(connectionID, localTempDir, mountPath string, config AzBlobFsCo
 	return fs, err
 }
 
-func (fs *AzureBlobFs) initFromSASURL() (Fs, error) {
+func (fs *AzureBlobFs) initFromSASURL() (*AzureBlobFs, error) {
 	parts, err := blob.ParseURL(fs.config.SASURL.GetPayload())
 	if err != nil {
 		return fs, fmt.Errorf("invalid SAS URL: %w", err)
@@ -200,6 +209,12 @@ func (fs *AzureBlobFs) Stat(name string) (os.FileInfo, error) {
 	return nil, os.ErrNotExist
 }
 
+// BatchStat returns the file info for the specified paths using parallel
+// blob properties requests
+func (fs *AzureBlobFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *AzureBlobFs) Lstat(name string) (os.FileInfo, error) {
 	return fs.Stat(name)
@@ -298,45 +313,55 @@ func (fs *AzureBlobFs) Rename(source, target string) error {
 		if err := fs.mkdirInternal(target); err != nil {
 			return err
 		}
-	} else {
-		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxLongTimeout))
-		defer cancelFn()
+	} else if err := fs.copyFileInternal(source, target, fi); err != nil {
+		return err
+	}
+	return fs.Remove(source, fi.IsDir())
+}
 
-		srcBlob := fs.containerClient.NewBlockBlobClient(source)
-		dstBlob := fs.containerClient.NewBlockBlobClient(target)
-		resp, err := dstBlob.StartCopyFromURL(ctx, srcBlob.URL(), fs.getCopyOptions())
+// CopyFile copies source to target using a server side copy
+func (fs *AzureBlobFs) CopyFile(source, target string, srcInfo os.FileInfo) error {
+	return fs.copyFileInternal(source, target, srcInfo)
+}
+
+func (fs *AzureBlobFs) copyFileInternal(source, target string, fi os.FileInfo) error {
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	srcBlob := fs.containerClient.NewBlockBlobClient(source)
+	dstBlob := fs.containerClient.NewBlockBlobClient(target)
+	resp, err := dstBlob.StartCopyFromURL(ctx, srcBlob.URL(), fs.getCopyOptions())
+	if err != nil {
+		metric.AZCopyObjectCompleted(err)
+		return err
+	}
+	copyStatus := blob.CopyStatusType(util.GetStringFromPointer((*string)(resp.CopyStatus)))
+	nErrors := 0
+	for copyStatus == blob.CopyStatusTypePending {
+		// Poll until the copy is complete.
+		time.Sleep(500 * time.Millisecond)
+		resp, err := dstBlob.GetProperties(ctx, &blob.GetPropertiesOptions{})
 		if err != nil {
-			metric.AZCopyObjectCompleted(err)
-			return err
-		}
-		copyStatus := blob.CopyStatusType(util.GetStringFromPointer((*string)(resp.CopyStatus)))
-		nErrors := 0
-		for copyStatus == blob.CopyStatusTypePending {
-			// Poll until the copy is complete.
-			time.Sleep(500 * time.Millisecond)
-			resp, err := dstBlob.GetProperties(ctx, &blob.GetPropertiesOptions{})
-			if err != nil {
-				// A GetProperties failure may be transient, so allow a couple
-				// of them before giving up.
-				nErrors++
-				if ctx.Err() != nil || nErrors == 3 {
-					metric.AZCopyObjectCompleted(err)
-					return err
-				}
-			} else {
-				copyStatus = blob.CopyStatusType(util.GetStringFromPointer((*string)(resp.CopyStatus)))
+			// A GetProperties failure may be transient, so allow a couple
+			// of them before giving up.
+			nErrors++
+			if ctx.Err() != nil || nErrors == 3 {
+				metric.AZCopyObjectCompleted(err)
+				return err
 			}
+		} else {
+			copyStatus = blob.CopyStatusType(util.GetStringFromPointer((*string)(resp.CopyStatus)))
 		}
-		if copyStatus != blob.CopyStatusTypeSuccess {
-			err := fmt.Errorf("copy failed with status: %s", copyStatus)
-			metric.AZCopyObjectCompleted(err)
-			return err
-		}
-
-		metric.AZCopyObjectCompleted(nil)
-		fs.preserveModificationTime(source, target, fi)
 	}
-	return fs.Remove(source, fi.IsDir())
+	if copyStatus != blob.CopyStatusTypeSuccess {
+		err := fmt.Errorf("copy failed with status: %s", copyStatus)
+		metric.AZCopyObjectCompleted(err)
+		return err
+	}
+
+	metric.AZCopyObjectCompleted(nil)
+	fs.preserveModificationTime(source, target, fi)
+	return nil
 }
 
 // Remove removes the named file or (empty) directory.
@@ -508,6 +533,43 @@ func (fs *AzureBlobFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return result, nil
 }
 
+// CountDirEntries implements FsDirEntriesCounter. The listing stops once limit
+// is reached and the folders modification times are not loaded
+func (fs *AzureBlobFs) CountDirEntries(dirname string, limit int) (int, error) {
+	// dirname must be already cleaned
+	prefix := fs.getPrefix(dirname)
+	names := make(map[string]bool)
+
+	pager := fs.containerClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+		Prefix: &prefix,
+	})
+
+	for pager.More() && (limit <= 0 || len(names) < limit) {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		resp, err := pager.NextPage(ctx)
+		cancelFn()
+		if err != nil {
+			metric.AZListObjectsCompleted(err)
+			return 0, err
+		}
+		for _, blobPrefix := range resp.ListBlobsHierarchySegmentResponse.Segment.BlobPrefixes {
+			name := util.GetStringFromPointer(blobPrefix.Name)
+			// we don't support prefixes == "/" this will be sent if a key starts with "/"
+			if name == "" || name == "/" {
+				continue
+			}
+			names[strings.TrimSuffix(strings.TrimPrefix(name, prefix), "/")] = true
+		}
+		for _, blobItem := range resp.ListBlobsHierarchySegmentResponse.Segment.BlobItems {
+			name := strings.TrimPrefix(util.GetStringFromPointer(blobItem.Name), prefix)
+			names[name] = true
+		}
+	}
+	metric.AZListObjectsCompleted(nil)
+
+	return capDirEntriesCount(len(names), limit), nil
+}
+
 // IsUploadResumeSupported returns true if resuming uploads is supported.
 // Resuming uploads is not supported on Azure Blob
 func (*AzureBlobFs) IsUploadResumeSupported() bool {
@@ -621,6 +683,77 @@ func (fs *AzureBlobFs) getFileNamesInPrefix(fsPrefix string) (map[string]bool, e
 	return fileNames, nil
 }
 
+// ValidatePath returns an error if the given name contains control characters
+// or backslashes, Azure converts backslashes to forward slashes in blob names
+func (*AzureBlobFs) ValidatePath(name string) error {
+	return validateFileName(name, isDisallowedAzBlobRune)
+}
+
+// CheckHealth verifies the credentials listing at most one blob
+func (fs *AzureBlobFs) CheckHealth(ctx context.Context) error {
+	maxResults := int32(1)
+	prefix := fs.config.KeyPrefix
+	pager := fs.containerClient.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+		MaxResults: &maxResults,
+		Prefix:     &prefix,
+	})
+	_, err := pager.NextPage(ctx)
+	metric.AZListObjectsCompleted(err)
+	return err
+}
+
+func isDisallowedAzBlobRune(r rune) bool {
+	return r == '\\' || unicode.IsControl(r)
+}
+
+// SetMetadata replaces the user defined metadata for the specified path.
+// The directory marker is preserved
+func (fs *AzureBlobFs) SetMetadata(name string, metadata map[string]string) error {
+	if name == "" || name == "/" || name == "." || fs.config.KeyPrefix == name+"/" {
+		return ErrVfsUnsupported
+	}
+	attrs, err := fs.headObject(name)
+	if err != nil {
+		return err
+	}
+	updated := make(map[string]*string)
+	for k, v := range attrs.Metadata {
+		if strings.ToLower(k) == azFolderKey {
+			updated[k] = v
+		}
+	}
+	for k, v := range metadata {
+		updated[k] = util.NilIfEmpty(v)
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	_, err = fs.containerClient.NewBlockBlobClient(name).SetMetadata(ctx, updated, &blob.SetMetadataOptions{
+		AccessConditions: &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{
+				IfMatch: attrs.ETag,
+			},
+		},
+	})
+	return err
+}
+
+// GetMetadata returns the user defined metadata for the specified path
+func (fs *AzureBlobFs) GetMetadata(name string) (map[string]string, error) {
+	if name == "" || name == "/" || name == "." || fs.config.KeyPrefix == name+"/" {
+		return nil, ErrVfsUnsupported
+	}
+	attrs, err := fs.headObject(name)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	for k, v := range attrs.Metadata {
+		metadata[k] = util.GetStringFromPointer(v)
+	}
+	return getUserMetadata(metadata, azFolderKey), nil
+}
+
 // CheckMetadata checks the metadata consistency
 func (fs *AzureBlobFs) CheckMetadata() error {
 	return fsMetadataCheck(fs, fs.getStorageID(), fs.config.KeyPrefix)
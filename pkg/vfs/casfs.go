@@ -0,0 +1,707 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eikenb/pipeat"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	// casObjectsPrefix is the prefix, relative to the bucket root, for the
+	// objects stored by content addressed filesystems
+	casObjectsPrefix = osFsContentStoreDir + "/"
+	// unreferenced objects newer than this are never removed, they could
+	// belong to uploads not yet added to the index
+	casReconcileGracePeriod = time.Hour
+)
+
+var (
+	contentIndex ContentIndex
+	casHashLocks = newCASHashLocker()
+	// ErrContentIndexUnavailable is returned if a content addressed filesystem
+	// is used and the content index is not configured
+	ErrContentIndexUnavailable = errors.New("content index not available")
+)
+
+// ContentIndexEntry defines an entry of the index that maps the paths
+// of a content addressed filesystem to the SHA-256 of their contents
+type ContentIndexEntry struct {
+	// identifies the bucket/container
+	StorageID string `json:"storage_id"`
+	// object path, without a leading slash and relative to the bucket root
+	Path string `json:"path"`
+	// hex encoded SHA-256, empty for directories
+	Hash  string `json:"hash,omitempty"`
+	Size  int64  `json:"size"`
+	IsDir bool   `json:"is_dir"`
+	// last modification time as unix timestamp in milliseconds
+	ModTime int64 `json:"mtime"`
+}
+
+// GetParent returns the parent directory for this entry, the
+// bucket root is an empty string
+func (e *ContentIndexEntry) GetParent() string {
+	dir := path.Dir(e.Path)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// ContentIndex defines the interface to store the index for content addressed
+// filesystems. Errors for missing entries must wrap os.ErrNotExist
+type ContentIndex interface {
+	GetContentEntry(storageID, name string) (ContentIndexEntry, error)
+	// ListContentEntries returns the direct children of the specified directory
+	// or all the descendants if recursive is true
+	ListContentEntries(storageID, dirName string, recursive bool) ([]ContentIndexEntry, error)
+	// AddContentEntry adds the specified entry, an existing entry with the
+	// same path is replaced
+	AddContentEntry(entry *ContentIndexEntry) error
+	// RenameContentEntries renames the specified entry and all its
+	// descendants, an existing target entry is replaced
+	RenameContentEntries(storageID, source, target string) error
+	DeleteContentEntry(storageID, name string) error
+	// GetContentHashes returns the distinct hashes referenced by the index
+	GetContentHashes(storageID string) ([]string, error)
+	IsContentReferenced(storageID, hash string) (bool, error)
+	DeleteContentEntriesByHash(storageID, hash string) (int64, error)
+}
+
+// casHashLocker provides a lock for each stored content. The uploads hold the
+// lock from the check for an already stored object until the index entry is
+// added, so the reconciliation cannot remove an object that is about to be
+// referenced
+type casHashLocker struct {
+	mu    sync.Mutex
+	locks map[string]*casHashLock
+}
+
+type casHashLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newCASHashLocker() *casHashLocker {
+	return &casHashLocker{
+		locks: make(map[string]*casHashLock),
+	}
+}
+
+// lock acquires the lock for the specified storage and hash and returns
+// the function to release it
+func (l *casHashLocker) lock(storageID, hash string) func() {
+	key := storageID + "/" + hash
+
+	l.mu.Lock()
+	hashLock, ok := l.locks[key]
+	if !ok {
+		hashLock = &casHashLock{}
+		l.locks[key] = hashLock
+	}
+	hashLock.refs++
+	l.mu.Unlock()
+
+	hashLock.Lock()
+	return func() {
+		hashLock.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		hashLock.refs--
+		if hashLock.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
+
+// SetContentIndex sets the index to use for content addressed filesystems
+func SetContentIndex(index ContentIndex) {
+	contentIndex = index
+}
+
+// FsContentAddressed is a Fs that stores the objects using the SHA-256
+// of their contents as key
+type FsContentAddressed interface {
+	Fs
+	GetContentStorageID() string
+	// ReconcileContents removes the objects no longer referenced by the index
+	// and the index entries whose object is missing. It returns the number
+	// of removed objects and index entries
+	ReconcileContents() (int, int64, error)
+}
+
+// casFs is a content addressed Fs. The namespace is stored inside the content
+// index while the contents are stored, using their SHA-256 as key, inside the
+// wrapped object storage. Identical contents are stored only once even if
+// uploaded by different users
+type casFs struct {
+	Fs
+	storageID    string
+	rootDir      string
+	localTempDir string
+}
+
+func newCASFs(fs Fs, storageID, keyPrefix, localTempDir string) Fs {
+	return &casFs{
+		Fs:           fs,
+		storageID:    storageID,
+		rootDir:      strings.TrimSuffix(keyPrefix, "/"),
+		localTempDir: localTempDir,
+	}
+}
+
+// Name returns the name for the Fs implementation
+func (fs *casFs) Name() string {
+	return fmt.Sprintf("%s content addressed", fs.Fs.Name())
+}
+
+// GetContentStorageID returns the identifier for the bucket/container
+// used to store the contents
+func (fs *casFs) GetContentStorageID() string {
+	return fs.storageID
+}
+
+// Stat returns a FileInfo describing the named file
+func (fs *casFs) Stat(name string) (os.FileInfo, error) {
+	name = fs.cleanPath(name)
+	if name == "" || name == fs.rootDir {
+		return NewFileInfo(name, true, 0, time.Unix(0, 0), false), nil
+	}
+	index, err := fs.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := index.GetContentEntry(fs.storageID, name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.getFileInfo(&entry), nil
+}
+
+// BatchStat returns the file info for the specified paths
+func (fs *casFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
+// Lstat returns a FileInfo describing the named file
+func (fs *casFs) Lstat(name string) (os.FileInfo, error) {
+	return fs.Stat(name)
+}
+
+// Open opens the named file for reading
+func (fs *casFs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, func(), error) {
+	info, err := fs.getEntry(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if info.IsDir {
+		return nil, nil, nil, fmt.Errorf("cannot open directory %q", name)
+	}
+	return fs.Fs.Open(getCASObjectKey(info.Hash), offset)
+}
+
+// Create creates or opens the named file for writing.
+// The uploaded content is hashed while it is written to a local temporary file
+// and it is sent to the object storage only if not already stored
+func (fs *casFs) Create(name string, flag, checks int) (File, *PipeWriter, func(), error) {
+	index, err := fs.getIndex()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if checks&CheckParentDir != 0 {
+		_, err := fs.Stat(path.Dir(name))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := NewPipeWriter(w)
+	ctx, cancelFn := context.WithCancel(context.Background())
+
+	go func() {
+		defer cancelFn()
+
+		hash, size, unlock, err := fs.storeContent(ctx, r)
+		if err == nil {
+			err = fs.addParentDirs(index, name)
+			if err == nil {
+				err = index.AddContentEntry(&ContentIndexEntry{
+					StorageID: fs.storageID,
+					Path:      fs.cleanPath(name),
+					Hash:      hash,
+					Size:      size,
+					ModTime:   util.GetTimeAsMsSinceEpoch(time.Now()),
+				})
+			}
+			if err == nil {
+				err = fs.checkContentStored(ctx, r, hash, size)
+			}
+			unlock()
+		}
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "upload completed, path: %q, hash: %q, size: %d, err: %+v", name, hash, size, err)
+	}()
+	return nil, p, cancelFn, nil
+}
+
+// storeContent hashes the uploaded content and stores it if not already stored.
+// On success the lock for the hash is held and the returned function releases it
+func (fs *casFs) storeContent(ctx context.Context, r *pipeat.PipeReaderAt) (string, int64, func(), error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return "", size, nil, err
+	}
+	// a cancelled upload closes the pipe without errors
+	if err := ctx.Err(); err != nil {
+		return "", size, nil, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	unlock := casHashLocks.lock(fs.storageID, hash)
+	info, err := fs.Fs.Stat(getCASObjectKey(hash))
+	if err == nil && info.Size() == size {
+		fsLog(fs, logger.LevelDebug, "content with hash %q already stored, upload skipped", hash)
+		return hash, size, unlock, nil
+	}
+	if err != nil && !fs.Fs.IsNotExist(err) {
+		unlock()
+		return hash, size, nil, err
+	}
+	if err := fs.uploadContent(ctx, r, hash, size); err != nil {
+		unlock()
+		return hash, size, nil, err
+	}
+	return hash, size, unlock, nil
+}
+
+// checkContentStored checks that the content is still stored after adding the
+// index entry and stores it again if it was removed in the meantime, for
+// example by the reconciliation running on another node
+func (fs *casFs) checkContentStored(ctx context.Context, r *pipeat.PipeReaderAt, hash string, size int64) error {
+	info, err := fs.Fs.Stat(getCASObjectKey(hash))
+	if err == nil && info.Size() == size {
+		return nil
+	}
+	if err != nil && !fs.Fs.IsNotExist(err) {
+		return err
+	}
+	fsLog(fs, logger.LevelWarn, "content with hash %q removed while uploading, storing it again", hash)
+	return fs.uploadContent(ctx, r, hash, size)
+}
+
+func (fs *casFs) uploadContent(ctx context.Context, r *pipeat.PipeReaderAt, hash string, size int64) error {
+	_, writer, cancelUpload, err := fs.Fs.Create(getCASObjectKey(hash), 0, 0)
+	if err != nil {
+		return err
+	}
+	uploadDone := make(chan struct{})
+	defer close(uploadDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancelUpload()
+		case <-uploadDone:
+		}
+	}()
+
+	_, err = io.Copy(writer, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		cancelUpload()
+		writer.Close() //nolint:errcheck
+		return err
+	}
+	return writer.Close()
+}
+
+// Rename renames (moves) source to target. Only the index is
+// updated, so renaming directories is supported too
+func (fs *casFs) Rename(source, target string) error {
+	if source == target {
+		return nil
+	}
+	index, err := fs.getIndex()
+	if err != nil {
+		return err
+	}
+	if _, err := fs.getEntry(source); err != nil {
+		return err
+	}
+	if entry, err := fs.getEntry(target); err == nil && entry.IsDir {
+		return fmt.Errorf("cannot rename %q, the target %q is a directory", source, target)
+	}
+	if err := fs.addParentDirs(index, target); err != nil {
+		return err
+	}
+	return index.RenameContentEntries(fs.storageID, fs.cleanPath(source), fs.cleanPath(target))
+}
+
+// CopyFile copies the index entry for source to target,
+// the content is shared and so it is not copied
+func (fs *casFs) CopyFile(source, target string, srcInfo os.FileInfo) error {
+	index, err := fs.getIndex()
+	if err != nil {
+		return err
+	}
+	entry, err := fs.getEntry(source)
+	if err != nil {
+		return err
+	}
+	if entry.IsDir {
+		return fmt.Errorf("cannot copy directory %q", source)
+	}
+	if err := fs.addParentDirs(index, target); err != nil {
+		return err
+	}
+	entry.Path = fs.cleanPath(target)
+	entry.ModTime = util.GetTimeAsMsSinceEpoch(time.Now())
+	return index.AddContentEntry(&entry)
+}
+
+// Remove removes the named file or (empty) directory. The content is
+// removed by the reconciliation if it is no longer referenced
+func (fs *casFs) Remove(name string, isDir bool) error {
+	index, err := fs.getIndex()
+	if err != nil {
+		return err
+	}
+	name = fs.cleanPath(name)
+	if isDir {
+		entries, err := index.ListContentEntries(fs.storageID, name, false)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("cannot remove non empty directory: %q", name)
+		}
+	}
+	return index.DeleteContentEntry(fs.storageID, name)
+}
+
+// Mkdir creates a new directory with the specified name
+func (fs *casFs) Mkdir(name string) error {
+	_, err := fs.Stat(name)
+	if !fs.IsNotExist(err) {
+		return err
+	}
+	index, err := fs.getIndex()
+	if err != nil {
+		return err
+	}
+	if err := fs.addParentDirs(index, name); err != nil {
+		return err
+	}
+	return index.AddContentEntry(&ContentIndexEntry{
+		StorageID: fs.storageID,
+		Path:      fs.cleanPath(name),
+		IsDir:     true,
+		ModTime:   util.GetTimeAsMsSinceEpoch(time.Now()),
+	})
+}
+
+// Chtimes changes the modification time of the named file
+func (fs *casFs) Chtimes(name string, atime, mtime time.Time, isUploading bool) error {
+	index, err := fs.getIndex()
+	if err != nil {
+		return err
+	}
+	entry, err := fs.getEntry(name)
+	if err != nil {
+		return err
+	}
+	entry.ModTime = util.GetTimeAsMsSinceEpoch(mtime)
+	return index.AddContentEntry(&entry)
+}
+
+// ReadDir reads the directory named by dirname and returns
+// a list of directory entries.
+func (fs *casFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	index, err := fs.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := index.ListContentEntries(fs.storageID, fs.cleanPath(dirname), false)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]os.FileInfo, 0, len(entries))
+	for idx := range entries {
+		result = append(result, fs.getFileInfo(&entries[idx]))
+	}
+	return result, nil
+}
+
+// IsNotExist returns a boolean indicating whether the error is known to
+// report that a file or directory does not exist
+func (fs *casFs) IsNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	return fs.Fs.IsNotExist(err)
+}
+
+// ScanRootDirContents returns the number of files and their size
+func (fs *casFs) ScanRootDirContents() (int, int64, error) {
+	return fs.GetDirSize(fs.rootDir)
+}
+
+// GetDirSize returns the number of files and the size for a folder
+// including any subfolders
+func (fs *casFs) GetDirSize(dirname string) (int, int64, error) {
+	index, err := fs.getIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	entries, err := index.ListContentEntries(fs.storageID, fs.cleanPath(dirname), true)
+	if err != nil {
+		return 0, 0, err
+	}
+	numFiles := 0
+	size := int64(0)
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		numFiles++
+		size += entry.Size
+	}
+	return numFiles, size, nil
+}
+
+// Walk walks the file tree rooted at root, calling walkFn for each file or
+// directory in the tree, including root. The result are unordered
+func (fs *casFs) Walk(root string, walkFn filepath.WalkFunc) error {
+	index, err := fs.getIndex()
+	if err != nil {
+		walkFn(root, nil, err) //nolint:errcheck
+		return err
+	}
+	entries, err := index.ListContentEntries(fs.storageID, fs.cleanPath(root), true)
+	if err != nil {
+		walkFn(root, nil, err) //nolint:errcheck
+		return err
+	}
+	for idx := range entries {
+		if err := walkFn(entries[idx].Path, fs.getFileInfo(&entries[idx]), nil); err != nil {
+			return err
+		}
+	}
+	walkFn(root, NewFileInfo(root, true, 0, time.Unix(0, 0), false), nil) //nolint:errcheck
+	return nil
+}
+
+// GetMimeType returns the content type
+func (fs *casFs) GetMimeType(name string) (string, error) {
+	if _, err := fs.getEntry(name); err != nil {
+		return "", err
+	}
+	return mime.TypeByExtension(path.Ext(name)), nil
+}
+
+// CheckMetadata is a noop, the modification times are stored inside the index
+func (*casFs) CheckMetadata() error {
+	return nil
+}
+
+// SetMetadata is not supported, the stored objects are shared
+func (*casFs) SetMetadata(name string, metadata map[string]string) error {
+	return ErrVfsUnsupported
+}
+
+// GetMetadata is not supported, the stored objects are shared
+func (*casFs) GetMetadata(name string) (map[string]string, error) {
+	return nil, ErrVfsUnsupported
+}
+
+// ReconcileContents removes the objects no longer referenced by the index
+// and the index entries whose object is missing
+func (fs *casFs) ReconcileContents() (int, int64, error) {
+	index, err := fs.getIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	// the hashes must be read before listing the objects, otherwise the objects
+	// uploaded while listing could be detected as missing
+	hashes, err := index.GetContentHashes(fs.storageID)
+	if err != nil {
+		return 0, 0, err
+	}
+	objects := make(map[string]time.Time)
+	err = fs.Fs.Walk(casObjectsPrefix, func(walkedPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info == nil || info.IsDir() {
+			return nil
+		}
+		hash := path.Base(walkedPath)
+		if walkedPath == getCASObjectKey(hash) {
+			objects[hash] = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var removedEntries int64
+	for _, hash := range hashes {
+		if _, ok := objects[hash]; ok {
+			delete(objects, hash)
+			continue
+		}
+		n, err := fs.removeMissingContentEntries(index, hash)
+		if err != nil {
+			return 0, removedEntries, err
+		}
+		removedEntries += n
+	}
+	removedObjects := 0
+	for hash, modTime := range objects {
+		if time.Since(modTime) < casReconcileGracePeriod {
+			continue
+		}
+		removed, err := fs.removeUnreferencedContent(index, hash)
+		if err != nil {
+			return removedObjects, removedEntries, err
+		}
+		if removed {
+			removedObjects++
+		}
+	}
+	return removedObjects, removedEntries, nil
+}
+
+// removeMissingContentEntries removes the index entries for the specified hash
+// if the related object is missing
+func (fs *casFs) removeMissingContentEntries(index ContentIndex, hash string) (int64, error) {
+	unlock := casHashLocks.lock(fs.storageID, hash)
+	defer unlock()
+
+	// the object could be stored while listing
+	if _, err := fs.Fs.Stat(getCASObjectKey(hash)); !fs.Fs.IsNotExist(err) {
+		return 0, nil
+	}
+	n, err := index.DeleteContentEntriesByHash(fs.storageID, hash)
+	if err != nil {
+		return 0, err
+	}
+	fsLog(fs, logger.LevelWarn, "content with hash %q not found, %d index entries removed", hash, n)
+	return n, nil
+}
+
+// removeUnreferencedContent removes the object with the specified hash if it is
+// not referenced by the index. The hash lock is held so an upload reusing the
+// object cannot add its index entry between the check and the removal
+func (fs *casFs) removeUnreferencedContent(index ContentIndex, hash string) (bool, error) {
+	unlock := casHashLocks.lock(fs.storageID, hash)
+	defer unlock()
+
+	isReferenced, err := index.IsContentReferenced(fs.storageID, hash)
+	if err != nil || isReferenced {
+		return false, err
+	}
+	if err := fs.Fs.Remove(getCASObjectKey(hash), false); err != nil {
+		return false, err
+	}
+	fsLog(fs, logger.LevelDebug, "unreferenced content with hash %q removed", hash)
+	return true, nil
+}
+
+func (fs *casFs) getIndex() (ContentIndex, error) {
+	if contentIndex == nil {
+		return nil, ErrContentIndexUnavailable
+	}
+	return contentIndex, nil
+}
+
+func (fs *casFs) getEntry(name string) (ContentIndexEntry, error) {
+	index, err := fs.getIndex()
+	if err != nil {
+		return ContentIndexEntry{}, err
+	}
+	return index.GetContentEntry(fs.storageID, fs.cleanPath(name))
+}
+
+// addParentDirs adds the missing parent directories for the specified path
+func (fs *casFs) addParentDirs(index ContentIndex, name string) error {
+	var dirs []string
+	for dir := path.Dir(fs.cleanPath(name)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		entry, err := index.GetContentEntry(fs.storageID, dir)
+		if err == nil {
+			if !entry.IsDir {
+				return fmt.Errorf("%q is not a directory", dir)
+			}
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		dirs = append(dirs, dir)
+	}
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		err := index.AddContentEntry(&ContentIndexEntry{
+			StorageID: fs.storageID,
+			Path:      dirs[idx],
+			IsDir:     true,
+			ModTime:   now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *casFs) getFileInfo(entry *ContentIndexEntry) os.FileInfo {
+	return NewFileInfo(entry.Path, entry.IsDir, entry.Size, util.GetTimeFromMsecSinceEpoch(entry.ModTime), false)
+}
+
+// cleanPath returns the index path for the specified object name
+func (*casFs) cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func getCASObjectKey(hash string) string {
+	if len(hash) < 2 {
+		return casObjectsPrefix + hash
+	}
+	return casObjectsPrefix + hash[:2] + "/" + hash
+}
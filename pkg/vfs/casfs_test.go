@@ -0,0 +1,322 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eikenb/pipeat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// testObjectStore is an in memory Fs that implements the methods
+// used by casFs to store the contents
+type testObjectStore struct {
+	Fs
+	mu      sync.Mutex
+	objects map[string]testObject
+}
+
+func newTestObjectStore() *testObjectStore {
+	return &testObjectStore{
+		objects: make(map[string]testObject),
+	}
+}
+
+func (s *testObjectStore) Name() string {
+	return "testObjectStore"
+}
+
+func (s *testObjectStore) ConnectionID() string {
+	return ""
+}
+
+func (s *testObjectStore) Stat(name string) (os.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return NewFileInfo(name, false, int64(len(obj.data)), obj.modTime, false), nil
+}
+
+func (s *testObjectStore) Create(name string, flag, checks int) (File, *PipeWriter, func(), error) {
+	r, w, err := pipeat.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := NewPipeWriter(w)
+	go func() {
+		data, err := io.ReadAll(r)
+		r.CloseWithError(err) //nolint:errcheck
+		if err == nil {
+			s.set(name, data, time.Now())
+		}
+		p.Done(err)
+	}()
+	return nil, p, func() {}, nil
+}
+
+func (s *testObjectStore) Remove(name string, isDir bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(s.objects, name)
+	return nil
+}
+
+func (s *testObjectStore) Walk(root string, walkFn filepath.WalkFunc) error {
+	s.mu.Lock()
+	infos := make(map[string]os.FileInfo)
+	for name, obj := range s.objects {
+		if strings.HasPrefix(name, root) {
+			infos[name] = NewFileInfo(name, false, int64(len(obj.data)), obj.modTime, false)
+		}
+	}
+	s.mu.Unlock()
+
+	for name, info := range infos {
+		if err := walkFn(name, info, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testObjectStore) IsNotExist(err error) bool {
+	return os.IsNotExist(err)
+}
+
+func (s *testObjectStore) set(name string, data []byte, modTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[name] = testObject{
+		data:    data,
+		modTime: modTime,
+	}
+}
+
+func (s *testObjectStore) exists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.objects[name]
+	return ok
+}
+
+// testContentIndex is an in memory ContentIndex. The optional onAdd hook is
+// executed before adding a file entry
+type testContentIndex struct {
+	mu      sync.Mutex
+	entries map[string]ContentIndexEntry
+	onAdd   func(entry *ContentIndexEntry)
+}
+
+func newTestContentIndex() *testContentIndex {
+	return &testContentIndex{
+		entries: make(map[string]ContentIndexEntry),
+	}
+}
+
+func (i *testContentIndex) GetContentEntry(storageID, name string) (ContentIndexEntry, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entry, ok := i.entries[storageID+"/"+name]
+	if !ok {
+		return entry, fmt.Errorf("%w: %q", os.ErrNotExist, name)
+	}
+	return entry, nil
+}
+
+func (i *testContentIndex) ListContentEntries(storageID, dirName string, recursive bool) ([]ContentIndexEntry, error) {
+	return nil, ErrVfsUnsupported
+}
+
+func (i *testContentIndex) AddContentEntry(entry *ContentIndexEntry) error {
+	if !entry.IsDir && i.onAdd != nil {
+		i.onAdd(entry)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.entries[entry.StorageID+"/"+entry.Path] = *entry
+	return nil
+}
+
+func (i *testContentIndex) RenameContentEntries(storageID, source, target string) error {
+	return ErrVfsUnsupported
+}
+
+func (i *testContentIndex) DeleteContentEntry(storageID, name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.entries, storageID+"/"+name)
+	return nil
+}
+
+func (i *testContentIndex) GetContentHashes(storageID string) ([]string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var hashes []string
+	for _, entry := range i.entries {
+		if entry.StorageID == storageID && !entry.IsDir {
+			hashes = append(hashes, entry.Hash)
+		}
+	}
+	return hashes, nil
+}
+
+func (i *testContentIndex) IsContentReferenced(storageID, hash string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, entry := range i.entries {
+		if entry.StorageID == storageID && !entry.IsDir && entry.Hash == hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (i *testContentIndex) DeleteContentEntriesByHash(storageID, hash string) (int64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var n int64
+	for key, entry := range i.entries {
+		if entry.StorageID == storageID && !entry.IsDir && entry.Hash == hash {
+			delete(i.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func uploadTestContent(t *testing.T, fs Fs, name string, data []byte) {
+	_, w, _, err := fs.Create(name, 0, 0)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+}
+
+func getTestContentKey(data []byte) string {
+	h := sha256.Sum256(data)
+	return getCASObjectKey(hex.EncodeToString(h[:]))
+}
+
+func TestCASReconcileDuringUpload(t *testing.T) {
+	index := newTestContentIndex()
+	SetContentIndex(index)
+	defer SetContentIndex(nil)
+
+	store := newTestObjectStore()
+	fs := newCASFs(store, "storage", "", os.TempDir())
+	data := []byte("shared content")
+	key := getTestContentKey(data)
+	// an unreferenced object older than the grace period
+	store.set(key, data, time.Now().Add(-2*casReconcileGracePeriod))
+
+	type reconcileResult struct {
+		removedObjects int
+		err            error
+	}
+	resultCh := make(chan reconcileResult, 1)
+	index.onAdd = func(entry *ContentIndexEntry) {
+		// the reconciliation runs after the upload has found the stored object
+		// and before the index entry is added
+		go func() {
+			n, _, err := fs.(FsContentAddressed).ReconcileContents()
+			resultCh <- reconcileResult{removedObjects: n, err: err}
+		}()
+		time.Sleep(100 * time.Millisecond)
+	}
+	uploadTestContent(t, fs, "file.txt", data)
+	result := <-resultCh
+	assert.NoError(t, result.err)
+	assert.Equal(t, 0, result.removedObjects)
+	assert.True(t, store.exists(key))
+	_, err := index.GetContentEntry("storage", "file.txt")
+	assert.NoError(t, err)
+	// the object is removed once it is not referenced anymore
+	index.onAdd = nil
+	assert.NoError(t, fs.Remove("file.txt", false))
+	store.set(key, data, time.Now().Add(-2*casReconcileGracePeriod))
+	removedObjects, removedEntries, err := fs.(FsContentAddressed).ReconcileContents()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removedObjects)
+	assert.Equal(t, int64(0), removedEntries)
+	assert.False(t, store.exists(key))
+
+	casHashLocks.mu.Lock()
+	assert.Len(t, casHashLocks.locks, 0)
+	casHashLocks.mu.Unlock()
+}
+
+func TestCASContentRemovedDuringUpload(t *testing.T) {
+	index := newTestContentIndex()
+	SetContentIndex(index)
+	defer SetContentIndex(nil)
+
+	store := newTestObjectStore()
+	fs := newCASFs(store, "storage", "", os.TempDir())
+	data := []byte("content removed by another node")
+	key := getTestContentKey(data)
+	store.set(key, data, time.Now().Add(-2*casReconcileGracePeriod))
+	// simulate a reconciliation running on another node that removes the
+	// object before the index entry is added
+	index.onAdd = func(entry *ContentIndexEntry) {
+		assert.NoError(t, store.Remove(key, false))
+	}
+	uploadTestContent(t, fs, "file.txt", data)
+	assert.True(t, store.exists(key))
+	removedObjects, removedEntries, err := fs.(FsContentAddressed).ReconcileContents()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removedObjects)
+	assert.Equal(t, int64(0), removedEntries)
+	// index entries for missing objects are removed
+	index.onAdd = nil
+	assert.NoError(t, store.Remove(key, false))
+	removedObjects, removedEntries, err = fs.(FsContentAddressed).ReconcileContents()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removedObjects)
+	assert.Equal(t, int64(1), removedEntries)
+	_, err = index.GetContentEntry("storage", "file.txt")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -75,6 +75,11 @@ func (fs *CryptFs) Name() string {
 	return fs.name
 }
 
+// OpenRange is not supported, the encrypted contents cannot be read at arbitrary offsets
+func (*CryptFs) OpenRange(_ string, _, _ int64) (io.ReadCloser, error) {
+	return nil, ErrVfsUnsupported
+}
+
 // Open opens the named file for reading
 func (fs *CryptFs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, func(), error) {
 	f, key, err := fs.getFileAndEncryptionKey(name)
@@ -24,6 +24,7 @@ import (
 type Filesystem struct {
 	RedactedSecret string                 `json:"-"`
 	Provider       sdk.FilesystemProvider `json:"provider"`
+	OSConfig       OsFsConfig             `json:"osconfig,omitempty"`
 	S3Config       S3FsConfig             `json:"s3config,omitempty"`
 	GCSConfig      GCSFsConfig            `json:"gcsconfig,omitempty"`
 	AzBlobConfig   AzBlobFsConfig         `json:"azblobconfig,omitempty"`
@@ -35,6 +36,7 @@ type Filesystem struct {
 // SetEmptySecrets sets the secrets to empty
 func (f *Filesystem) SetEmptySecrets() {
 	f.S3Config.AccessSecret = kms.NewEmptySecret()
+	f.S3Config.Replication.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
 	f.GCSConfig.Credentials = kms.NewEmptySecret()
 	f.AzBlobConfig.AccountKey = kms.NewEmptySecret()
 	f.AzBlobConfig.SASURL = kms.NewEmptySecret()
@@ -44,6 +46,7 @@ func (f *Filesystem) SetEmptySecrets() {
 	f.SFTPConfig.KeyPassphrase = kms.NewEmptySecret()
 	f.HTTPConfig.Password = kms.NewEmptySecret()
 	f.HTTPConfig.APIKey = kms.NewEmptySecret()
+	f.HTTPConfig.SigningKey = kms.NewEmptySecret()
 }
 
 // SetEmptySecretsIfNil sets the secrets to empty if nil
@@ -51,6 +54,9 @@ func (f *Filesystem) SetEmptySecretsIfNil() {
 	if f.S3Config.AccessSecret == nil {
 		f.S3Config.AccessSecret = kms.NewEmptySecret()
 	}
+	if f.S3Config.Replication.DestinationCredentials.AccessSecret == nil {
+		f.S3Config.Replication.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
+	}
 	if f.GCSConfig.Credentials == nil {
 		f.GCSConfig.Credentials = kms.NewEmptySecret()
 	}
@@ -78,6 +84,9 @@ func (f *Filesystem) SetEmptySecretsIfNil() {
 	if f.HTTPConfig.APIKey == nil {
 		f.HTTPConfig.APIKey = kms.NewEmptySecret()
 	}
+	if f.HTTPConfig.SigningKey == nil {
+		f.HTTPConfig.SigningKey = kms.NewEmptySecret()
+	}
 }
 
 // SetNilSecretsIfEmpty set the secrets to nil if empty.
@@ -87,6 +96,10 @@ func (f *Filesystem) SetNilSecretsIfEmpty() {
 	if f.S3Config.AccessSecret != nil && f.S3Config.AccessSecret.IsEmpty() {
 		f.S3Config.AccessSecret = nil
 	}
+	replicationSecret := f.S3Config.Replication.DestinationCredentials.AccessSecret
+	if replicationSecret != nil && replicationSecret.IsEmpty() {
+		f.S3Config.Replication.DestinationCredentials.AccessSecret = nil
+	}
 	if f.GCSConfig.Credentials != nil && f.GCSConfig.Credentials.IsEmpty() {
 		f.GCSConfig.Credentials = nil
 	}
@@ -121,6 +134,8 @@ func (f *Filesystem) IsEqual(other Filesystem) bool {
 		return f.SFTPConfig.isEqual(other.SFTPConfig)
 	case sdk.HTTPFilesystemProvider:
 		return f.HTTPConfig.isEqual(other.HTTPConfig)
+	case sdk.LocalFilesystemProvider:
+		return f.OSConfig.isEqual(other.OSConfig)
 	default:
 		return true
 	}
@@ -162,6 +177,7 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.CryptConfig = CryptFsConfig{}
 		f.SFTPConfig = SFTPFsConfig{}
 		f.HTTPConfig = HTTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	case sdk.GCSFilesystemProvider:
 		if err := f.GCSConfig.ValidateAndEncryptCredentials(additionalData); err != nil {
@@ -172,6 +188,7 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.CryptConfig = CryptFsConfig{}
 		f.SFTPConfig = SFTPFsConfig{}
 		f.HTTPConfig = HTTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	case sdk.AzureBlobFilesystemProvider:
 		if err := f.AzBlobConfig.ValidateAndEncryptCredentials(additionalData); err != nil {
@@ -182,6 +199,7 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.CryptConfig = CryptFsConfig{}
 		f.SFTPConfig = SFTPFsConfig{}
 		f.HTTPConfig = HTTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	case sdk.CryptedFilesystemProvider:
 		if err := f.CryptConfig.ValidateAndEncryptCredentials(additionalData); err != nil {
@@ -192,6 +210,7 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.AzBlobConfig = AzBlobFsConfig{}
 		f.SFTPConfig = SFTPFsConfig{}
 		f.HTTPConfig = HTTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	case sdk.SFTPFilesystemProvider:
 		if err := f.SFTPConfig.ValidateAndEncryptCredentials(additionalData); err != nil {
@@ -202,6 +221,7 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.AzBlobConfig = AzBlobFsConfig{}
 		f.CryptConfig = CryptFsConfig{}
 		f.HTTPConfig = HTTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	case sdk.HTTPFilesystemProvider:
 		if err := f.HTTPConfig.ValidateAndEncryptCredentials(additionalData); err != nil {
@@ -212,8 +232,12 @@ func (f *Filesystem) Validate(additionalData string) error {
 		f.AzBlobConfig = AzBlobFsConfig{}
 		f.CryptConfig = CryptFsConfig{}
 		f.SFTPConfig = SFTPFsConfig{}
+		f.OSConfig = OsFsConfig{}
 		return nil
 	default:
+		if err := f.OSConfig.Validate(); err != nil {
+			return err
+		}
 		f.Provider = sdk.LocalFilesystemProvider
 		f.S3Config = S3FsConfig{}
 		f.GCSConfig = GCSFsConfig{}
@@ -230,7 +254,10 @@ func (f *Filesystem) HasRedactedSecret() bool {
 	// TODO move vfs specific code into each *FsConfig struct
 	switch f.Provider {
 	case sdk.S3FilesystemProvider:
-		return f.S3Config.AccessSecret.IsRedacted()
+		if f.S3Config.AccessSecret.IsRedacted() {
+			return true
+		}
+		return f.S3Config.Replication.DestinationCredentials.AccessSecret.IsRedacted()
 	case sdk.GCSFilesystemProvider:
 		return f.GCSConfig.Credentials.IsRedacted()
 	case sdk.AzureBlobFilesystemProvider:
@@ -252,7 +279,10 @@ func (f *Filesystem) HasRedactedSecret() bool {
 		if f.HTTPConfig.Password.IsRedacted() {
 			return true
 		}
-		return f.HTTPConfig.APIKey.IsRedacted()
+		if f.HTTPConfig.APIKey.IsRedacted() {
+			return true
+		}
+		return f.HTTPConfig.SigningKey.IsRedacted()
 	}
 
 	return false
@@ -276,11 +306,55 @@ func (f *Filesystem) HideConfidentialData() {
 	}
 }
 
+// GetSecrets returns the secrets for all the providers, the nil secrets are
+// initialized as empty secrets
+func (f *Filesystem) GetSecrets() []*kms.Secret {
+	f.SetEmptySecretsIfNil()
+	return []*kms.Secret{f.S3Config.AccessSecret, f.S3Config.Replication.DestinationCredentials.AccessSecret,
+		f.GCSConfig.Credentials, f.AzBlobConfig.AccountKey, f.AzBlobConfig.SASURL, f.CryptConfig.Passphrase,
+		f.SFTPConfig.Password, f.SFTPConfig.PrivateKey, f.SFTPConfig.KeyPassphrase, f.HTTPConfig.Password,
+		f.HTTPConfig.APIKey, f.HTTPConfig.SigningKey}
+}
+
+// DecryptSecrets decrypts the encrypted secrets, for example before encrypting
+// them again using different additional data
+func (f *Filesystem) DecryptSecrets() error {
+	for _, secret := range f.GetSecrets() {
+		if err := secret.TryDecrypt(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetOIDCTokenSource sets the source for the OpenID Connect access token used by
+// the SFTP and HTTP filesystems configured to use it as credential
+func (f *Filesystem) SetOIDCTokenSource(source OIDCTokenSource) {
+	f.SFTPConfig.oidcTokenSource = source
+	f.HTTPConfig.oidcTokenSource = source
+}
+
+// IsContentAddressed returns true if the filesystem stores the files
+// using the SHA-256 of their contents as key
+func (f *Filesystem) IsContentAddressed() bool {
+	switch f.Provider {
+	case sdk.S3FilesystemProvider:
+		return f.S3Config.ContentAddressed
+	case sdk.GCSFilesystemProvider:
+		return f.GCSConfig.ContentAddressed
+	case sdk.AzureBlobFilesystemProvider:
+		return f.AzBlobConfig.ContentAddressed
+	default:
+		return false
+	}
+}
+
 // GetACopy returns a filesystem copy
 func (f *Filesystem) GetACopy() Filesystem {
 	f.SetEmptySecretsIfNil()
 	fs := Filesystem{
 		Provider: f.Provider,
+		OSConfig: f.OSConfig,
 		S3Config: S3FsConfig{
 			BaseS3FsConfig: sdk.BaseS3FsConfig{
 				Bucket:              f.S3Config.Bucket,
@@ -299,7 +373,24 @@ func (f *Filesystem) GetACopy() Filesystem {
 				UploadPartMaxTime:   f.S3Config.UploadPartMaxTime,
 				ForcePathStyle:      f.S3Config.ForcePathStyle,
 			},
-			AccessSecret: f.S3Config.AccessSecret.Clone(),
+			AccessSecret:      f.S3Config.AccessSecret.Clone(),
+			SSEAlgorithm:      f.S3Config.SSEAlgorithm,
+			ObjectLockEnabled: f.S3Config.ObjectLockEnabled,
+			ObjectLockMode:    f.S3Config.ObjectLockMode,
+			RetentionDays:     f.S3Config.RetentionDays,
+			ContentAddressed:  f.S3Config.ContentAddressed,
+			ResumableUploads:  f.S3Config.ResumableUploads,
+			PrefetchEnabled:   f.S3Config.PrefetchEnabled,
+			PrefetchDepth:     f.S3Config.PrefetchDepth,
+			Replication: S3ReplicationConfig{
+				DestinationBucket: f.S3Config.Replication.DestinationBucket,
+				DestinationRegion: f.S3Config.Replication.DestinationRegion,
+				DestinationCredentials: S3ReplicationCredentials{
+					AccessKey:    f.S3Config.Replication.DestinationCredentials.AccessKey,
+					AccessSecret: f.S3Config.Replication.DestinationCredentials.AccessSecret.Clone(),
+				},
+			},
+			TransferAcceleration: f.S3Config.TransferAcceleration,
 		},
 		GCSConfig: GCSFsConfig{
 			BaseGCSFsConfig: sdk.BaseGCSFsConfig{
@@ -309,7 +400,10 @@ func (f *Filesystem) GetACopy() Filesystem {
 				ACL:                  f.GCSConfig.ACL,
 				KeyPrefix:            f.GCSConfig.KeyPrefix,
 			},
-			Credentials: f.GCSConfig.Credentials.Clone(),
+			Credentials:      f.GCSConfig.Credentials.Clone(),
+			PubSubTopic:      f.GCSConfig.PubSubTopic,
+			PubSubProjectID:  f.GCSConfig.PubSubProjectID,
+			ContentAddressed: f.GCSConfig.ContentAddressed,
 		},
 		AzBlobConfig: AzBlobFsConfig{
 			BaseAzBlobFsConfig: sdk.BaseAzBlobFsConfig{
@@ -324,8 +418,9 @@ func (f *Filesystem) GetACopy() Filesystem {
 				UseEmulator:         f.AzBlobConfig.UseEmulator,
 				AccessTier:          f.AzBlobConfig.AccessTier,
 			},
-			AccountKey: f.AzBlobConfig.AccountKey.Clone(),
-			SASURL:     f.AzBlobConfig.SASURL.Clone(),
+			AccountKey:       f.AzBlobConfig.AccountKey.Clone(),
+			SASURL:           f.AzBlobConfig.SASURL.Clone(),
+			ContentAddressed: f.AzBlobConfig.ContentAddressed,
 		},
 		CryptConfig: CryptFsConfig{
 			Passphrase: f.CryptConfig.Passphrase.Clone(),
@@ -342,6 +437,8 @@ func (f *Filesystem) GetACopy() Filesystem {
 			Password:      f.SFTPConfig.Password.Clone(),
 			PrivateKey:    f.SFTPConfig.PrivateKey.Clone(),
 			KeyPassphrase: f.SFTPConfig.KeyPassphrase.Clone(),
+			UseOIDCToken:  f.SFTPConfig.UseOIDCToken,
+			LocalAddress:  f.SFTPConfig.LocalAddress,
 		},
 		HTTPConfig: HTTPFsConfig{
 			BaseHTTPFsConfig: sdk.BaseHTTPFsConfig{
@@ -350,8 +447,12 @@ func (f *Filesystem) GetACopy() Filesystem {
 				SkipTLSVerify:     f.HTTPConfig.SkipTLSVerify,
 				EqualityCheckMode: f.HTTPConfig.EqualityCheckMode,
 			},
-			Password: f.HTTPConfig.Password.Clone(),
-			APIKey:   f.HTTPConfig.APIKey.Clone(),
+			Password:         f.HTTPConfig.Password.Clone(),
+			APIKey:           f.HTTPConfig.APIKey.Clone(),
+			PingPath:         f.HTTPConfig.PingPath,
+			UseOIDCToken:     f.HTTPConfig.UseOIDCToken,
+			SigningKey:       f.HTTPConfig.SigningKey.Clone(),
+			SignatureVersion: f.HTTPConfig.SignatureVersion,
 		},
 	}
 	if len(f.SFTPConfig.Fingerprints) > 0 {
@@ -26,6 +26,60 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/util"
 )
 
+// Supported rotation policies for the folder audit logs
+const (
+	AuditLogRotateDaily  = "daily"
+	AuditLogRotateWeekly = "weekly"
+	AuditLogRotateSize   = "size"
+)
+
+// FolderAuditLog defines a dedicated access log for a virtual folder.
+// Access events for paths inside the folder are written to this log
+// in addition to the main log
+type FolderAuditLog struct {
+	// Log file name, relative to the configured folder audit logs directory.
+	// Empty means disabled
+	LogFile string `json:"log_file,omitempty"`
+	// Rotation policy: daily, weekly or size
+	RotatePolicy string `json:"rotate_policy,omitempty"`
+	// Maximum size, in MB, before rotating the log file, used for the size policy
+	MaxSize int `json:"max_size,omitempty"`
+}
+
+// IsEnabled returns true if a dedicated audit log is configured
+func (l *FolderAuditLog) IsEnabled() bool {
+	return l.LogFile != ""
+}
+
+// Validate returns an error if the audit log configuration is not valid
+// and sets the default values for the missing fields
+func (l *FolderAuditLog) Validate() error {
+	if !l.IsEnabled() {
+		*l = FolderAuditLog{}
+		return nil
+	}
+	if l.LogFile == "." || l.LogFile == ".." || strings.ContainsAny(l.LogFile, `/\`) {
+		return util.NewValidationError(fmt.Sprintf("invalid audit log file name %q", l.LogFile))
+	}
+	if l.RotatePolicy == "" {
+		l.RotatePolicy = AuditLogRotateDaily
+	}
+	switch l.RotatePolicy {
+	case AuditLogRotateDaily, AuditLogRotateWeekly:
+		l.MaxSize = 0
+	case AuditLogRotateSize:
+		if l.MaxSize < 0 {
+			return util.NewValidationError(fmt.Sprintf("invalid audit log max size: %d", l.MaxSize))
+		}
+		if l.MaxSize == 0 {
+			l.MaxSize = 100
+		}
+	default:
+		return util.NewValidationError(fmt.Sprintf("invalid audit log rotate policy %q", l.RotatePolicy))
+	}
+	return nil
+}
+
 // BaseVirtualFolder defines the path for the virtual folder and the used quota limits.
 // The same folder can be shared among multiple users and each user can have different
 // quota limits or a different virtual path.
@@ -39,12 +93,16 @@ type BaseVirtualFolder struct {
 	UsedQuotaFiles int `json:"used_quota_files"`
 	// Last quota update as unix timestamp in milliseconds
 	LastQuotaUpdate int64 `json:"last_quota_update"`
+	// last update time as unix timestamp in milliseconds
+	UpdatedAt int64 `json:"updated_at,omitempty"`
 	// list of usernames associated with this virtual folder
 	Users []string `json:"users,omitempty"`
 	// list of group names associated with this virtual folder
 	Groups []string `json:"groups,omitempty"`
 	// Filesystem configuration details
 	FsConfig Filesystem `json:"filesystem"`
+	// Dedicated audit log configuration
+	AuditLog FolderAuditLog `json:"audit_log"`
 }
 
 // GetEncryptionAdditionalData returns the additional data to use for AEAD
@@ -66,9 +124,11 @@ func (v *BaseVirtualFolder) GetACopy() BaseVirtualFolder {
 		UsedQuotaSize:   v.UsedQuotaSize,
 		UsedQuotaFiles:  v.UsedQuotaFiles,
 		LastQuotaUpdate: v.LastQuotaUpdate,
+		UpdatedAt:       v.UpdatedAt,
 		Users:           users,
 		Groups:          v.Groups,
 		FsConfig:        v.FsConfig.GetACopy(),
+		AuditLog:        v.AuditLog,
 	}
 }
 
@@ -189,6 +249,8 @@ type VirtualFolder struct {
 	QuotaSize int64 `json:"quota_size"`
 	// Maximum number of files allowed. 0 means unlimited, -1 included in user quota
 	QuotaFiles int `json:"quota_files"`
+	// If enabled any write operation inside the virtual folder is denied
+	ReadOnly bool `json:"read_only,omitempty"`
 }
 
 // GetFilesystem returns the filesystem for this folder
@@ -207,7 +269,7 @@ func (v *VirtualFolder) GetFilesystem(connectionID string, forbiddenSelfUsers []
 	case sdk.HTTPFilesystemProvider:
 		return NewHTTPFs(connectionID, v.MappedPath, v.VirtualPath, v.FsConfig.HTTPConfig)
 	default:
-		return NewOsFs(connectionID, v.MappedPath, v.VirtualPath), nil
+		return NewOsFsWithConfig(connectionID, v.MappedPath, v.VirtualPath, v.FsConfig.OSConfig), nil
 	}
 }
 
@@ -237,6 +299,21 @@ func (v *VirtualFolder) ScanQuota() (int, int64, error) {
 	return fs.ScanRootDirContents()
 }
 
+// ScanDiskUsage scans the folder and returns the number of files and their real
+// disk usage
+func (v *VirtualFolder) ScanDiskUsage() (int, int64, error) {
+	if v.hasPathPlaceholder() {
+		return 0, 0, errors.New("cannot scan disk usage: this folder has a path placeholder")
+	}
+	fs, err := v.GetFilesystem(xid.New().String(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fs.Close()
+
+	return ScanDiskUsage(fs)
+}
+
 // IsIncludedInUserQuota returns true if the virtual folder is included in user quota
 func (v *VirtualFolder) IsIncludedInUserQuota() bool {
 	return v.QuotaFiles == -1 && v.QuotaSize == -1
@@ -257,5 +334,6 @@ func (v *VirtualFolder) GetACopy() VirtualFolder {
 		VirtualPath:       v.VirtualPath,
 		QuotaSize:         v.QuotaSize,
 		QuotaFiles:        v.QuotaFiles,
+		ReadOnly:          v.ReadOnly,
 	}
 }
@@ -19,6 +19,9 @@ package vfs
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -28,13 +31,16 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	"cloud.google.com/go/storage"
 	"github.com/eikenb/pipeat"
 	"github.com/pkg/sftp"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
 
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/metric"
@@ -61,6 +67,20 @@ type GCSFs struct {
 	svc            *storage.Client
 	ctxTimeout     time.Duration
 	ctxLongTimeout time.Duration
+	// Pub/Sub client and fully qualified topic name for upload notifications
+	pubsubSvc   *pubsub.Service
+	pubsubTopic string
+}
+
+// gcsUploadNotification defines the message published to Pub/Sub after a
+// successful upload
+type gcsUploadNotification struct {
+	Bucket      string `json:"bucket"`
+	Object      string `json:"object"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+	Username    string `json:"username,omitempty"`
+	VirtualPath string `json:"virtual_path"`
 }
 
 func init() {
@@ -69,6 +89,14 @@ func init() {
 
 // NewGCSFs returns an GCSFs object that allows to interact with Google Cloud Storage
 func NewGCSFs(connectionID, localTempDir, mountPath string, config GCSFsConfig) (Fs, error) {
+	fs, err := newGCSFs(connectionID, localTempDir, mountPath, config)
+	if err != nil || !fs.config.ContentAddressed {
+		return fs, err
+	}
+	return newCASFs(fs, fs.getStorageID(), fs.config.KeyPrefix, fs.localTempDir), nil
+}
+
+func newGCSFs(connectionID, localTempDir, mountPath string, config GCSFsConfig) (*GCSFs, error) {
 	if localTempDir == "" {
 		if tempPath != "" {
 			localTempDir = tempPath
@@ -90,18 +118,54 @@ func NewGCSFs(connectionID, localTempDir, mountPath string, config GCSFsConfig)
 		return fs, err
 	}
 	ctx := context.Background()
-	if fs.config.AutomaticCredentials > 0 {
-		fs.svc, err = storage.NewClient(ctx)
-	} else {
+	var opts []option.ClientOption
+	if fs.config.AutomaticCredentials == 0 {
 		err = fs.config.Credentials.TryDecrypt()
 		if err != nil {
 			return fs, err
 		}
-		fs.svc, err = storage.NewClient(ctx, option.WithCredentialsJSON([]byte(fs.config.Credentials.GetPayload())))
+		opts = append(opts, option.WithCredentialsJSON([]byte(fs.config.Credentials.GetPayload())))
+	}
+	fs.svc, err = storage.NewClient(ctx, opts...)
+	if err != nil {
+		return fs, err
+	}
+	if fs.config.PubSubTopic != "" {
+		err = fs.initPubSub(ctx, opts)
 	}
 	return fs, err
 }
 
+// initPubSub creates the client used to publish upload notifications.
+// If automatic credentials are enabled, the application default credentials
+// are used, so GOOGLE_APPLICATION_CREDENTIALS and Workload Identity are supported
+func (fs *GCSFs) initPubSub(ctx context.Context, opts []option.ClientOption) error {
+	projectID := fs.config.PubSubProjectID
+	if projectID == "" {
+		var creds *google.Credentials
+		var err error
+		if fs.config.AutomaticCredentials > 0 {
+			creds, err = google.FindDefaultCredentials(ctx, pubsub.PubsubScope)
+		} else {
+			creds, err = google.CredentialsFromJSON(ctx, []byte(fs.config.Credentials.GetPayload()), pubsub.PubsubScope)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to detect the Pub/Sub project ID: %w", err)
+		}
+		projectID = creds.ProjectID
+	}
+	if projectID == "" {
+		return errors.New("unable to detect the Pub/Sub project ID, please set it explicitly")
+	}
+	svc, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("unable to create the Pub/Sub client: %w", err)
+	}
+	fs.pubsubSvc = svc
+	fs.pubsubTopic = fmt.Sprintf("projects/%s/topics/%s", projectID, fs.config.PubSubTopic)
+	return nil
+}
+
 // Name returns the name for the Fs implementation
 func (fs *GCSFs) Name() string {
 	return fmt.Sprintf("%s bucket %q", gcsfsName, fs.config.Bucket)
@@ -124,6 +188,12 @@ func (fs *GCSFs) Stat(name string) (os.FileInfo, error) {
 	return info, err
 }
 
+// BatchStat returns the file info for the specified paths using parallel
+// object attributes requests
+func (fs *GCSFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *GCSFs) Lstat(name string) (os.FileInfo, error) {
 	return fs.Stat(name)
@@ -219,6 +289,9 @@ func (fs *GCSFs) Create(name string, flag, checks int) (File, *PipeWriter, func(
 		fsLog(fs, logger.LevelDebug, "upload completed, path: %#v, acl: %#v, readed bytes: %v, err: %+v",
 			name, fs.config.ACL, n, err)
 		metric.GCSTransferCompleted(n, 0, err)
+		if err == nil && flag != -1 {
+			fs.publishUploadNotification(name, n, contentType)
+		}
 	}()
 	return nil, p, cancelFn, nil
 }
@@ -228,7 +301,7 @@ func (fs *GCSFs) Create(name string, flag, checks int) (File, *PipeWriter, func(
 // rename all the contents too and this could take long time: think
 // about directories with thousands of files, for each file we should
 // execute a CopyObject call.
-func (fs *GCSFs) Rename(source, target string) error { //nolint:gocyclo
+func (fs *GCSFs) Rename(source, target string) error {
 	if source == target {
 		return nil
 	}
@@ -251,48 +324,58 @@ func (fs *GCSFs) Rename(source, target string) error { //nolint:gocyclo
 		if err := fs.mkdirInternal(target); err != nil {
 			return err
 		}
+	} else if err := fs.copyFileInternal(realSourceName, target, fi); err != nil {
+		return err
+	}
+	return fs.Remove(source, fi.IsDir())
+}
+
+// CopyFile copies source to target using a server side copy
+func (fs *GCSFs) CopyFile(source, target string, srcInfo os.FileInfo) error {
+	return fs.copyFileInternal(source, target, srcInfo)
+}
+
+func (fs *GCSFs) copyFileInternal(source, target string, fi os.FileInfo) error {
+	src := fs.svc.Bucket(fs.config.Bucket).Object(source)
+	dst := fs.svc.Bucket(fs.config.Bucket).Object(target)
+	attrs, statErr := fs.headObject(target)
+	if statErr == nil {
+		dst = dst.If(storage.Conditions{GenerationMatch: attrs.Generation})
+	} else if fs.IsNotExist(statErr) {
+		dst = dst.If(storage.Conditions{DoesNotExist: true})
 	} else {
-		src := fs.svc.Bucket(fs.config.Bucket).Object(realSourceName)
-		dst := fs.svc.Bucket(fs.config.Bucket).Object(target)
-		attrs, statErr := fs.headObject(target)
-		if statErr == nil {
-			dst = dst.If(storage.Conditions{GenerationMatch: attrs.Generation})
-		} else if fs.IsNotExist(statErr) {
-			dst = dst.If(storage.Conditions{DoesNotExist: true})
-		} else {
-			fsLog(fs, logger.LevelWarn, "unable to set precondition for rename, target %q, stat err: %v",
-				target, statErr)
-		}
+		fsLog(fs, logger.LevelWarn, "unable to set precondition for copy, target %q, stat err: %v",
+			target, statErr)
+	}
 
-		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
-		defer cancelFn()
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
 
-		copier := dst.CopierFrom(src)
-		if fs.config.StorageClass != "" {
-			copier.StorageClass = fs.config.StorageClass
-		}
-		if fs.config.ACL != "" {
-			copier.PredefinedACL = fs.config.ACL
-		}
-		contentType := mime.TypeByExtension(path.Ext(source))
-		if contentType != "" {
-			copier.ContentType = contentType
-		}
-		_, err = copier.Run(ctx)
-		metric.GCSCopyObjectCompleted(err)
+	copier := dst.CopierFrom(src)
+	if fs.config.StorageClass != "" {
+		copier.StorageClass = fs.config.StorageClass
+	}
+	if fs.config.ACL != "" {
+		copier.PredefinedACL = fs.config.ACL
+	}
+	contentType := mime.TypeByExtension(path.Ext(source))
+	if contentType != "" {
+		copier.ContentType = contentType
+	}
+	_, err := copier.Run(ctx)
+	metric.GCSCopyObjectCompleted(err)
+	if err != nil {
+		return err
+	}
+	if plugin.Handler.HasMetadater() {
+		err = plugin.Handler.SetModificationTime(fs.getStorageID(), ensureAbsPath(target),
+			util.GetTimeAsMsSinceEpoch(fi.ModTime()))
 		if err != nil {
-			return err
-		}
-		if plugin.Handler.HasMetadater() {
-			err = plugin.Handler.SetModificationTime(fs.getStorageID(), ensureAbsPath(target),
-				util.GetTimeAsMsSinceEpoch(fi.ModTime()))
-			if err != nil {
-				fsLog(fs, logger.LevelWarn, "unable to preserve modification time after renaming %#v -> %#v: %+v",
-					source, target, err)
-			}
+			fsLog(fs, logger.LevelWarn, "unable to preserve modification time after copying %#v -> %#v: %+v",
+				source, target, err)
 		}
 	}
-	return fs.Remove(source, fi.IsDir())
+	return nil
 }
 
 // Remove removes the named file or (empty) directory.
@@ -468,6 +551,55 @@ func (fs *GCSFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return result, nil
 }
 
+// CountDirEntries implements FsDirEntriesCounter. The listing stops once limit
+// is reached and the folders modification times are not loaded
+func (fs *GCSFs) CountDirEntries(dirname string, limit int) (int, error) {
+	// dirname must be already cleaned
+	prefix := fs.getPrefix(dirname)
+
+	query := &storage.Query{Prefix: prefix, Delimiter: "/"}
+	err := query.SetAttrSelection(gcsDefaultFieldsSelection)
+	if err != nil {
+		return 0, err
+	}
+	names := make(map[string]bool)
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	bkt := fs.svc.Bucket(fs.config.Bucket)
+	it := bkt.Objects(ctx, query)
+	pager := iterator.NewPager(it, defaultGCSPageSize, "")
+
+	for limit <= 0 || len(names) < limit {
+		var objects []*storage.ObjectAttrs
+		pageToken, err := pager.NextPage(&objects)
+		if err != nil {
+			metric.GCSListObjectsCompleted(err)
+			return 0, err
+		}
+		for _, attrs := range objects {
+			if attrs.Prefix != "" {
+				if name, _ := fs.resolve(attrs.Prefix, prefix, attrs.ContentType); name != "" {
+					names[name] = true
+				}
+				continue
+			}
+			if !attrs.Deleted.IsZero() {
+				continue
+			}
+			if name, _ := fs.resolve(attrs.Name, prefix, attrs.ContentType); name != "" {
+				names[name] = true
+			}
+		}
+		if pageToken == "" {
+			break
+		}
+	}
+
+	metric.GCSListObjectsCompleted(nil)
+	return capDirEntriesCount(len(names), limit), nil
+}
+
 // IsUploadResumeSupported returns true if resuming uploads is supported.
 // Resuming uploads is not supported on GCS
 func (*GCSFs) IsUploadResumeSupported() bool {
@@ -589,6 +721,82 @@ func (fs *GCSFs) getFileNamesInPrefix(fsPrefix string) (map[string]bool, error)
 	return fileNames, nil
 }
 
+// ValidatePath returns an error if the given name contains control characters,
+// GCS does not allow carriage return and line feed in object names
+func (*GCSFs) ValidatePath(name string) error {
+	return validateFileName(name, unicode.IsControl)
+}
+
+// CheckHealth verifies the credentials listing at most one object
+func (fs *GCSFs) CheckHealth(ctx context.Context) error {
+	query := &storage.Query{Prefix: fs.config.KeyPrefix}
+	if err := query.SetAttrSelection([]string{"Name"}); err != nil {
+		return err
+	}
+	it := fs.svc.Bucket(fs.config.Bucket).Objects(ctx, query)
+	_, err := it.Next()
+	if err == iterator.Done {
+		err = nil
+	}
+	metric.GCSListObjectsCompleted(err)
+	return err
+}
+
+// SetMetadata replaces the user defined metadata for the specified path
+func (fs *GCSFs) SetMetadata(name string, metadata map[string]string) error {
+	key, attrs, err := fs.getMetadataObject(name)
+	if err != nil {
+		return err
+	}
+	// GCS merges the metadata, keys with an empty value are removed
+	updated := make(map[string]string)
+	for k := range attrs.Metadata {
+		updated[k] = ""
+	}
+	for k, v := range metadata {
+		updated[k] = v
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	obj := fs.svc.Bucket(fs.config.Bucket).Object(key).If(storage.Conditions{MetagenerationMatch: attrs.Metageneration})
+	_, err = obj.Update(ctx, storage.ObjectAttrsToUpdate{
+		Metadata: updated,
+	})
+	return err
+}
+
+// GetMetadata returns the user defined metadata for the specified path
+func (fs *GCSFs) GetMetadata(name string) (map[string]string, error) {
+	_, attrs, err := fs.getMetadataObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return getUserMetadata(attrs.Metadata), nil
+}
+
+// getMetadataObject returns the name and the attributes of the object that
+// stores the metadata for the specified path. Directories are objects with
+// a trailing slash
+func (fs *GCSFs) getMetadataObject(name string) (string, *storage.ObjectAttrs, error) {
+	if name == "" || name == "/" || name == "." || fs.config.KeyPrefix == name+"/" {
+		return "", nil, ErrVfsUnsupported
+	}
+	attrs, err := fs.headObject(name)
+	if err == nil {
+		return name, attrs, nil
+	}
+	if !fs.IsNotExist(err) {
+		return "", nil, err
+	}
+	key := name + "/"
+	attrs, err = fs.headObject(key)
+	return key, attrs, err
+}
+
 // CheckMetadata checks the metadata consistency
 func (fs *GCSFs) CheckMetadata() error {
 	return fsMetadataCheck(fs, fs.getStorageID(), fs.config.KeyPrefix)
@@ -881,6 +1089,48 @@ func (*GCSFs) GetAvailableDiskSize(dirName string) (*sftp.StatVFS, error) {
 	return nil, ErrStorageSizeUnavailable
 }
 
+// publishUploadNotification publishes a message about a completed upload to
+// the configured Pub/Sub topic, if any. Errors are logged and otherwise ignored
+func (fs *GCSFs) publishUploadNotification(name string, size int64, contentType string) {
+	if fs.pubsubSvc == nil {
+		return
+	}
+	data, err := json.Marshal(gcsUploadNotification{
+		Bucket:      fs.config.Bucket,
+		Object:      name,
+		Size:        size,
+		ContentType: contentType,
+		Username:    fs.config.username,
+		VirtualPath: fs.GetRelativePath(name),
+	})
+	if err != nil {
+		fsLog(fs, logger.LevelError, "unable to marshal the Pub/Sub notification for %q: %v", name, err)
+		metric.GCSPubSubPublishCompleted(err)
+		return
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), fs.ctxTimeout)
+	defer cancelFn()
+
+	_, err = fs.pubsubSvc.Projects.Topics.Publish(fs.pubsubTopic, &pubsub.PublishRequest{
+		Messages: []*pubsub.PubsubMessage{
+			{
+				Data: base64.StdEncoding.EncodeToString(data),
+				Attributes: map[string]string{
+					"bucket": fs.config.Bucket,
+					"object": name,
+				},
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		fsLog(fs, logger.LevelError, "unable to publish the upload notification for %q to topic %q: %v",
+			name, fs.pubsubTopic, err)
+	} else {
+		fsLog(fs, logger.LevelDebug, "upload notification for %q published to topic %q", name, fs.pubsubTopic)
+	}
+	metric.GCSPubSubPublishCompleted(err)
+}
+
 func (fs *GCSFs) getStorageID() string {
 	return fmt.Sprintf("gs://%v", fs.config.Bucket)
 }
@@ -56,6 +56,18 @@ type HTTPFsConfig struct {
 	sdk.BaseHTTPFsConfig
 	Password *kms.Secret `json:"password,omitempty"`
 	APIKey   *kms.Secret `json:"api_key,omitempty"`
+	// Path, relative to the endpoint, to call to check the backend health,
+	// for example "ping". If empty the root directory is stat'ed
+	PingPath string `json:"ping_path,omitempty"`
+	// If enabled and the user logged in using OpenID Connect, the access
+	// token is sent as bearer token instead of the configured credentials
+	UseOIDCToken bool `json:"use_oidc_token,omitempty"`
+	// Key used to sign the requests with HMAC-SHA256, if empty the requests
+	// are not signed
+	SigningKey *kms.Secret `json:"signing_key,omitempty"`
+	// Version of the signature algorithm, 0 means the latest supported version
+	SignatureVersion int             `json:"signature_version,omitempty"`
+	oidcTokenSource  OIDCTokenSource `json:"-"`
 }
 
 func (c *HTTPFsConfig) isUnixDomainSocket() bool {
@@ -70,6 +82,9 @@ func (c *HTTPFsConfig) HideConfidentialData() {
 	if c.APIKey != nil {
 		c.APIKey.Hide()
 	}
+	if c.SigningKey != nil {
+		c.SigningKey.Hide()
+	}
 }
 
 func (c *HTTPFsConfig) setNilSecretsIfEmpty() {
@@ -79,6 +94,9 @@ func (c *HTTPFsConfig) setNilSecretsIfEmpty() {
 	if c.APIKey != nil && c.APIKey.IsEmpty() {
 		c.APIKey = nil
 	}
+	if c.SigningKey != nil && c.SigningKey.IsEmpty() {
+		c.SigningKey = nil
+	}
 }
 
 func (c *HTTPFsConfig) setEmptyCredentialsIfNil() {
@@ -88,6 +106,9 @@ func (c *HTTPFsConfig) setEmptyCredentialsIfNil() {
 	if c.APIKey == nil {
 		c.APIKey = kms.NewEmptySecret()
 	}
+	if c.SigningKey == nil {
+		c.SigningKey = kms.NewEmptySecret()
+	}
 }
 
 func (c *HTTPFsConfig) isEqual(other HTTPFsConfig) bool {
@@ -100,12 +121,24 @@ func (c *HTTPFsConfig) isEqual(other HTTPFsConfig) bool {
 	if c.SkipTLSVerify != other.SkipTLSVerify {
 		return false
 	}
+	if c.PingPath != other.PingPath {
+		return false
+	}
+	if c.UseOIDCToken != other.UseOIDCToken {
+		return false
+	}
+	if c.SignatureVersion != other.SignatureVersion {
+		return false
+	}
 	c.setEmptyCredentialsIfNil()
 	other.setEmptyCredentialsIfNil()
 	if !c.Password.IsEqual(other.Password) {
 		return false
 	}
-	return c.APIKey.IsEqual(other.APIKey)
+	if !c.APIKey.IsEqual(other.APIKey) {
+		return false
+	}
+	return c.SigningKey.IsEqual(other.SigningKey)
 }
 
 func (c *HTTPFsConfig) isSameResource(other HTTPFsConfig) bool {
@@ -140,6 +173,13 @@ func (c *HTTPFsConfig) validate() error {
 	if !isEqualityCheckModeValid(c.EqualityCheckMode) {
 		return errors.New("invalid equality_check_mode")
 	}
+	c.PingPath = strings.Trim(strings.TrimSpace(c.PingPath), "/")
+	if c.PingPath != "" {
+		pingURL, err := url.Parse(c.PingPath)
+		if err != nil || pingURL.IsAbs() || pingURL.Host != "" {
+			return fmt.Errorf("httpfs: invalid ping path %q, it must be relative to the endpoint", c.PingPath)
+		}
+	}
 	if c.Password.IsEncrypted() && !c.Password.IsValid() {
 		return errors.New("httpfs: invalid encrypted password")
 	}
@@ -152,6 +192,30 @@ func (c *HTTPFsConfig) validate() error {
 	if !c.APIKey.IsEmpty() && !c.APIKey.IsValidInput() {
 		return errors.New("httpfs: invalid API key")
 	}
+	return c.validateSigning()
+}
+
+func (c *HTTPFsConfig) validateSigning() error {
+	if c.SignatureVersion < 0 || c.SignatureVersion > util.HTTPSignatureV1 {
+		return fmt.Errorf("httpfs: unsupported signature version %d", c.SignatureVersion)
+	}
+	if c.SigningKey.IsEmpty() {
+		return nil
+	}
+	if c.SigningKey.IsEncrypted() && !c.SigningKey.IsValid() {
+		return errors.New("httpfs: invalid encrypted signing key")
+	}
+	if !c.SigningKey.IsValidInput() {
+		return errors.New("httpfs: invalid signing key")
+	}
+	// signed requests use the Authorization header, so they cannot be combined
+	// with basic authentication or bearer tokens
+	if !c.Password.IsEmpty() {
+		return errors.New("httpfs: password and signing key cannot be used together")
+	}
+	if c.UseOIDCToken {
+		return errors.New("httpfs: OpenID Connect token and signing key cannot be used together")
+	}
 	return nil
 }
 
@@ -172,6 +236,12 @@ func (c *HTTPFsConfig) ValidateAndEncryptCredentials(additionalData string) erro
 			return util.NewValidationError(fmt.Sprintf("could not encrypt HTTP fs API key: %v", err))
 		}
 	}
+	if c.SigningKey.IsPlain() {
+		c.SigningKey.SetAdditionalData(additionalData)
+		if err := c.SigningKey.Encrypt(); err != nil {
+			return util.NewValidationError(fmt.Sprintf("could not encrypt HTTP fs signing key: %v", err))
+		}
+	}
 	return nil
 }
 
@@ -206,6 +276,11 @@ func NewHTTPFs(connectionID, localTempDir, mountPath string, config HTTPFsConfig
 			return nil, err
 		}
 	}
+	if !config.SigningKey.IsEmpty() {
+		if err := config.SigningKey.TryDecrypt(); err != nil {
+			return nil, err
+		}
+	}
 	fs := &HTTPFs{
 		connectionID: connectionID,
 		localTempDir: localTempDir,
@@ -291,6 +366,12 @@ func (fs *HTTPFs) Stat(name string) (os.FileInfo, error) {
 	return response.getFileInfo(), nil
 }
 
+// BatchStat returns the file info for the specified paths using parallel
+// requests
+func (fs *HTTPFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *HTTPFs) Lstat(name string) (os.FileInfo, error) {
 	return fs.Stat(name)
@@ -541,6 +622,39 @@ func (*HTTPFs) CheckMetadata() error {
 	return nil
 }
 
+// ValidatePath returns an error if the given name contains characters
+// that cannot be sent to the HTTP backend
+func (*HTTPFs) ValidatePath(name string) error {
+	return validateFileName(name, isNullByte)
+}
+
+// CheckHealth calls the configured ping path or, if not set,
+// it stats the root directory
+func (fs *HTTPFs) CheckHealth(ctx context.Context) error {
+	var resp *http.Response
+	var err error
+	if fs.config.PingPath != "" {
+		resp, err = fs.doHTTPRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s", fs.config.Endpoint, fs.config.PingPath), "", nil)
+	} else {
+		resp, err = fs.sendHTTPRequest(ctx, http.MethodGet, "stat", "/", "", "", nil)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SetMetadata is not supported for HTTPFs
+func (*HTTPFs) SetMetadata(_ string, _ map[string]string) error {
+	return ErrVfsUnsupported
+}
+
+// GetMetadata is not supported for HTTPFs
+func (*HTTPFs) GetMetadata(_ string) (map[string]string, error) {
+	return nil, ErrVfsUnsupported
+}
+
 // GetDirSize returns the number of files and the size for a folder
 // including any subfolders
 func (fs *HTTPFs) GetDirSize(dirname string) (int, int64, error) {
@@ -661,6 +775,10 @@ func (fs *HTTPFs) sendHTTPRequest(ctx context.Context, method, base, name, query
 	body io.Reader,
 ) (*http.Response, error) {
 	url := fmt.Sprintf("%s/%s/%s%s", fs.config.Endpoint, base, url.PathEscape(name), queryString)
+	return fs.doHTTPRequest(ctx, method, url, contentType, body)
+}
+
+func (fs *HTTPFs) doHTTPRequest(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
@@ -668,11 +786,27 @@ func (fs *HTTPFs) sendHTTPRequest(ctx context.Context, method, base, name, query
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
-	if fs.config.APIKey.GetPayload() != "" {
-		req.Header.Set("X-API-KEY", fs.config.APIKey.GetPayload())
-	}
-	if fs.config.Username != "" || fs.config.Password.GetPayload() != "" {
-		req.SetBasicAuth(fs.config.Username, fs.config.Password.GetPayload())
+	if fs.config.UseOIDCToken {
+		// the token source refreshes the token, if expired, so we get it for each request
+		token, err := getOIDCAccessToken(fs.config.oidcTokenSource)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		if fs.config.APIKey.GetPayload() != "" {
+			req.Header.Set("X-API-KEY", fs.config.APIKey.GetPayload())
+		}
+		if fs.config.SigningKey.GetPayload() != "" {
+			var payloadHash string
+			if body != nil {
+				// uploads are streamed, the body cannot be hashed before sending it
+				payloadHash = util.HTTPSignatureUnsignedPayload
+			}
+			util.SignHTTPRequest(req, fs.config.Username, []byte(fs.config.SigningKey.GetPayload()), payloadHash)
+		} else if fs.config.Username != "" || fs.config.Password.GetPayload() != "" {
+			req.SetBasicAuth(fs.config.Username, fs.config.Password.GetPayload())
+		}
 	}
 	resp, err := fs.client.Do(req.WithContext(ctx))
 	if err != nil {
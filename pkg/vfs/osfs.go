@@ -15,6 +15,7 @@
 package vfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -38,6 +40,8 @@ import (
 const (
 	// osFsName is the name for the local Fs implementation
 	osFsName = "osfs"
+	// number of names read at once when counting the directory entries
+	osFsDirEntriesBatchSize = 1000
 )
 
 type pathResolutionError struct {
@@ -55,15 +59,23 @@ type OsFs struct {
 	rootDir      string
 	// if not empty this fs is mouted as virtual folder in the specified path
 	mountPath string
+	config    OsFsConfig
 }
 
 // NewOsFs returns an OsFs object that allows to interact with local Os filesystem
 func NewOsFs(connectionID, rootDir, mountPath string) Fs {
+	return NewOsFsWithConfig(connectionID, rootDir, mountPath, OsFsConfig{})
+}
+
+// NewOsFsWithConfig returns an OsFs object that allows to interact with local Os
+// filesystem using the specified configuration
+func NewOsFsWithConfig(connectionID, rootDir, mountPath string, config OsFsConfig) Fs {
 	return &OsFs{
 		name:         osFsName,
 		connectionID: connectionID,
 		rootDir:      rootDir,
 		mountPath:    getMountPath(mountPath),
+		config:       config,
 	}
 }
 
@@ -82,6 +94,11 @@ func (fs *OsFs) Stat(name string) (os.FileInfo, error) {
 	return os.Stat(name)
 }
 
+// BatchStat returns the file info for the specified paths
+func (fs *OsFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, 1)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *OsFs) Lstat(name string) (os.FileInfo, error) {
 	return os.Lstat(name)
@@ -103,8 +120,23 @@ func (*OsFs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, func()
 	return f, nil, nil, err
 }
 
+// OpenRange opens the named file for reading the specified byte range
+func (*OsFs) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sectionReadCloser{
+		Reader: io.NewSectionReader(f, offset, length),
+		Closer: f,
+	}, nil
+}
+
 // Create creates or opens the named file for writing
-func (*OsFs) Create(name string, flag, _ int) (File, *PipeWriter, func(), error) {
+func (fs *OsFs) Create(name string, flag, _ int) (File, *PipeWriter, func(), error) {
+	if err := fs.unshareFile(name, flag != 0 && flag&os.O_TRUNC == 0); err != nil {
+		return nil, nil, nil, err
+	}
 	var err error
 	var f *os.File
 	if flag == 0 {
@@ -120,6 +152,9 @@ func (fs *OsFs) Rename(source, target string) error {
 	if source == target {
 		return nil
 	}
+	objectPath, _ := fs.getStoredContentForPath(target)
+	defer fs.releaseStoredContent(objectPath)
+
 	err := os.Rename(source, target)
 	if err != nil && isCrossDeviceError(err) {
 		fsLog(fs, logger.LevelError, "cross device error detected while renaming %#v -> %#v. Trying a copy and remove, this could take a long time",
@@ -139,8 +174,16 @@ func (fs *OsFs) Rename(source, target string) error {
 }
 
 // Remove removes the named file or (empty) directory.
-func (*OsFs) Remove(name string, isDir bool) error {
-	return os.Remove(name)
+func (fs *OsFs) Remove(name string, isDir bool) error {
+	if isDir {
+		return os.Remove(name)
+	}
+	objectPath, _ := fs.getStoredContentForPath(name)
+	err := os.Remove(name)
+	if err == nil {
+		fs.releaseStoredContent(objectPath)
+	}
+	return err
 }
 
 // Mkdir creates a new directory with the specified name and default permissions
@@ -153,6 +196,35 @@ func (*OsFs) Symlink(source, target string) error {
 	return os.Symlink(source, target)
 }
 
+// Link creates target as a hard link to the source file.
+func (*OsFs) Link(source, target string) error {
+	return os.Link(source, target)
+}
+
+// CopyFile copies source to target, the target file must not exist.
+// The modification time is preserved
+func (*OsFs) CopyFile(source, target string, srcInfo os.FileInfo) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(target) //nolint:errcheck
+		return err
+	}
+	return os.Chtimes(target, time.Now(), srcInfo.ModTime())
+}
+
 // Readlink returns the destination of the named symbolic link
 // as absolute virtual path
 func (fs *OsFs) Readlink(name string) (string, error) {
@@ -170,12 +242,18 @@ func (fs *OsFs) Readlink(name string) (string, error) {
 }
 
 // Chown changes the numeric uid and gid of the named file.
-func (*OsFs) Chown(name string, uid int, gid int) error {
+func (fs *OsFs) Chown(name string, uid int, gid int) error {
+	if err := fs.unshareFile(name, true); err != nil {
+		return err
+	}
 	return os.Chown(name, uid, gid)
 }
 
 // Chmod changes the mode of the named file to mode
-func (*OsFs) Chmod(name string, mode os.FileMode) error {
+func (fs *OsFs) Chmod(name string, mode os.FileMode) error {
+	if err := fs.unshareFile(name, true); err != nil {
+		return err
+	}
 	return os.Chmod(name, mode)
 }
 
@@ -185,13 +263,16 @@ func (*OsFs) Chtimes(name string, atime, mtime time.Time, isUploading bool) erro
 }
 
 // Truncate changes the size of the named file
-func (*OsFs) Truncate(name string, size int64) error {
+func (fs *OsFs) Truncate(name string, size int64) error {
+	if err := fs.unshareFile(name, size > 0); err != nil {
+		return err
+	}
 	return os.Truncate(name, size)
 }
 
 // ReadDir reads the directory named by dirname and returns
 // a list of directory entries.
-func (*OsFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+func (fs *OsFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	f, err := os.Open(dirname)
 	if err != nil {
 		if isInvalidNameError(err) {
@@ -204,9 +285,50 @@ func (*OsFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if fs.config.DeduplicationEnabled && filepath.Clean(dirname) == filepath.Clean(fs.rootDir) {
+		// the content store is an implementation detail and must not be visible
+		for idx, info := range list {
+			if info.Name() == osFsContentStoreDir {
+				list = append(list[:idx], list[idx+1:]...)
+				break
+			}
+		}
+	}
 	return list, nil
 }
 
+// CountDirEntries implements FsDirEntriesCounter, only the entry names are read
+func (fs *OsFs) CountDirEntries(dirname string, limit int) (int, error) {
+	f, err := os.Open(dirname)
+	if err != nil {
+		if isInvalidNameError(err) {
+			err = os.ErrNotExist
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	// the content store is an implementation detail and must not be counted
+	isDedupRoot := fs.config.DeduplicationEnabled && filepath.Clean(dirname) == filepath.Clean(fs.rootDir)
+	count := 0
+	for limit <= 0 || count < limit {
+		names, err := f.Readdirnames(osFsDirEntriesBatchSize)
+		for _, name := range names {
+			if isDedupRoot && name == osFsContentStoreDir {
+				continue
+			}
+			count++
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, err
+		}
+	}
+	return capDirEntriesCount(count, limit), nil
+}
+
 // IsUploadResumeSupported returns true if resuming uploads is supported
 func (*OsFs) IsUploadResumeSupported() bool {
 	return true
@@ -265,6 +387,48 @@ func (*OsFs) CheckMetadata() error {
 	return nil
 }
 
+// ValidatePath returns an error if the given name contains characters
+// not allowed by the local filesystem
+func (*OsFs) ValidatePath(name string) error {
+	if runtime.GOOS == "windows" {
+		return validateFileName(name, isDisallowedWindowsRune)
+	}
+	return validateFileName(name, isNullByte)
+}
+
+// CheckHealth verifies that the root directory is accessible
+func (fs *OsFs) CheckHealth(_ context.Context) error {
+	f, err := os.Open(fs.rootDir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// SetMetadata replaces the user defined metadata for the specified path.
+// Metadata are stored as extended attributes
+func (*OsFs) SetMetadata(name string, metadata map[string]string) error {
+	return setXattrMetadata(name, metadata)
+}
+
+// GetMetadata returns the user defined metadata for the specified path
+func (*OsFs) GetMetadata(name string) (map[string]string, error) {
+	return getXattrMetadata(name)
+}
+
+func isDisallowedWindowsRune(r rune) bool {
+	if r < 32 {
+		return true
+	}
+	return strings.ContainsRune(`<>:"|?*`, r)
+}
+
 // GetAtomicUploadPath returns the path to use for an atomic upload
 func (*OsFs) GetAtomicUploadPath(name string) string {
 	dir := filepath.Dir(name)
@@ -312,6 +476,10 @@ func (fs *OsFs) ResolvePath(virtualPath string) (string, error) {
 		virtualPath = strings.TrimPrefix(virtualPath, fs.mountPath)
 	}
 	r := filepath.Clean(filepath.Join(fs.rootDir, virtualPath))
+	if fs.isContentStorePath(r) {
+		err := fmt.Errorf("path %q is reserved", virtualPath)
+		return "", &pathResolutionError{err: err.Error()}
+	}
 	p, err := filepath.EvalSymlinks(r)
 	if isInvalidNameError(err) {
 		err = os.ErrNotExist
@@ -369,20 +537,83 @@ func (fs *OsFs) RealPath(p string) (string, error) {
 	}
 }
 
+// ScanRootDirDiskUsage returns the number of files and the real disk usage for
+// the root directory. Files with multiple hard links are counted once. Symbolic
+// links to files are resolved and their targets are counted, once, as any other
+// file. Symbolic links to directories are not followed, the directories inside
+// the root are already included in the scan
+func (fs *OsFs) ScanRootDirDiskUsage() (int, int64, error) {
+	numFiles := 0
+	size := int64(0)
+	seenFiles := make(map[fileID]bool)
+
+	isDir, err := isDirectory(fs, fs.rootDir)
+	if err != nil || !isDir {
+		if fs.IsNotExist(err) {
+			// the root directory is created on first login
+			return numFiles, size, nil
+		}
+		return numFiles, size, err
+	}
+	err = filepath.Walk(fs.rootDir, func(walkedPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && fs.isContentStorePath(walkedPath) {
+			return filepath.SkipDir
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(walkedPath)
+			if err != nil {
+				fsLog(fs, logger.LevelDebug, "unable to resolve symlink %q, skipped: %v", walkedPath, err)
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if id, ok := getFileID(info); ok {
+			if seenFiles[id] {
+				return nil
+			}
+			seenFiles[id] = true
+		}
+		numFiles++
+		size += info.Size()
+		if numFiles%1000 == 0 {
+			fsLog(fs, logger.LevelDebug, "disk usage scan in progress, files: %d, size: %d", numFiles, size)
+		}
+		return nil
+	})
+	return numFiles, size, err
+}
+
 // GetDirSize returns the number of files and the size for a folder
-// including any subfolders
+// including any subfolders. Hard linked files, including the deduplicated
+// ones, are counted once for the size
 func (fs *OsFs) GetDirSize(dirname string) (int, int64, error) {
 	numFiles := 0
 	size := int64(0)
+	sharedFiles := make(map[fileID]bool)
 	isDir, err := isDirectory(fs, dirname)
 	if err == nil && isDir {
-		err = filepath.Walk(dirname, func(_ string, info os.FileInfo, err error) error {
+		err = filepath.Walk(dirname, func(walkedPath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
+			if info != nil && info.IsDir() && fs.isContentStorePath(walkedPath) {
+				return filepath.SkipDir
+			}
 			if info != nil && info.Mode().IsRegular() {
-				size += info.Size()
 				numFiles++
+				if id, ok := getSharedFileID(info); ok {
+					if !sharedFiles[id] {
+						sharedFiles[id] = true
+						size += info.Size()
+					}
+				} else {
+					size += info.Size()
+				}
 				if numFiles%1000 == 0 {
 					fsLog(fs, logger.LevelDebug, "dirname %q scan in progress, files: %d, size: %d", dirname, numFiles, size)
 				}
@@ -0,0 +1,376 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const (
+	// osFsContentStoreDir is the directory, inside the filesystem root,
+	// where deduplicated contents are stored using their SHA-256 as name
+	osFsContentStoreDir = ".sftpgo_cas"
+	// osFsContentIndexDir is the directory, inside the content store, with
+	// a symlink to the stored content for each stored inode
+	osFsContentIndexDir = "inodes"
+)
+
+// contentStoreLock serializes the changes to the content stores, the
+// contents are hashed without holding it
+var contentStoreLock sync.Mutex
+
+// fileID identifies a file inside a local filesystem
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func (fs *OsFs) getContentStorePath() string {
+	return filepath.Join(fs.rootDir, osFsContentStoreDir)
+}
+
+func (fs *OsFs) isContentStorePath(name string) bool {
+	if !fs.config.DeduplicationEnabled {
+		return false
+	}
+	storePath := fs.getContentStorePath()
+	return name == storePath || strings.HasPrefix(name, storePath+string(os.PathSeparator))
+}
+
+func (fs *OsFs) getContentIndexPath(id fileID) string {
+	return filepath.Join(fs.getContentStorePath(), osFsContentIndexDir, fmt.Sprintf("%d-%d", id.dev, id.ino))
+}
+
+// getStoredContent returns the content store path for the specified file,
+// or an empty string if the file is not in the content store, and the number
+// of files sharing the content, the content store excluded
+func (fs *OsFs) getStoredContent(info os.FileInfo) (string, uint64) {
+	numLinks := getLinkCount(info)
+	if !fs.config.DeduplicationEnabled || !info.Mode().IsRegular() || numLinks < 2 {
+		return "", numLinks
+	}
+	id, ok := getFileID(info)
+	if !ok {
+		return "", numLinks
+	}
+	indexPath := fs.getContentIndexPath(id)
+	target, err := os.Readlink(indexPath)
+	if err != nil {
+		return "", numLinks
+	}
+	objectPath := filepath.Join(filepath.Dir(indexPath), target)
+	objectInfo, err := os.Lstat(objectPath)
+	if err != nil || !os.SameFile(info, objectInfo) {
+		return "", numLinks
+	}
+	return objectPath, numLinks - 1
+}
+
+func (fs *OsFs) getStoredContentForPath(name string) (string, uint64) {
+	if !fs.config.DeduplicationEnabled {
+		return "", 0
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		return "", 0
+	}
+	return fs.getStoredContent(info)
+}
+
+// IsContentShared returns true if the named file shares its content with
+// other files, deduplicated or hard linked, removing or overwriting it does
+// not free any disk space
+func (fs *OsFs) IsContentShared(name string) bool {
+	info, err := os.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	_, numFiles := fs.getStoredContent(info)
+	return numFiles > 1
+}
+
+// addContentIndex adds the index entry for the specified stored content
+func (fs *OsFs) addContentIndex(objectPath string, info os.FileInfo) error {
+	id, ok := getFileID(info)
+	if !ok {
+		return ErrVfsUnsupported
+	}
+	indexPath := fs.getContentIndexPath(id)
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0700); err != nil {
+		return err
+	}
+	target, err := filepath.Rel(filepath.Dir(indexPath), objectPath)
+	if err != nil {
+		return err
+	}
+	os.Remove(indexPath) //nolint:errcheck
+	return os.Symlink(target, indexPath)
+}
+
+// removeStoredContent removes the specified content and its index entry from
+// the content store. The content is not removed if it is still used, unless
+// force is true
+func (fs *OsFs) removeStoredContent(objectPath string, force bool) {
+	info, err := os.Lstat(objectPath)
+	if err != nil {
+		return
+	}
+	if !force && getLinkCount(info) > 1 {
+		return
+	}
+	if id, ok := getFileID(info); ok {
+		os.Remove(fs.getContentIndexPath(id)) //nolint:errcheck
+	}
+	err = os.Remove(objectPath)
+	fsLog(fs, logger.LevelDebug, "removed content %q from the store, err: %v", objectPath, err)
+}
+
+// releaseStoredContent removes the specified content from the store if
+// no file uses it anymore
+func (fs *OsFs) releaseStoredContent(objectPath string) {
+	if objectPath == "" {
+		return
+	}
+	contentStoreLock.Lock()
+	defer contentStoreLock.Unlock()
+
+	fs.removeStoredContent(objectPath, false)
+}
+
+// DeduplicateFile adds the named file to the content store. If an identical
+// content is already stored, the named file is replaced with a hard link to
+// it and true is returned
+func (fs *OsFs) DeduplicateFile(name string) (bool, error) {
+	if !fs.config.DeduplicationEnabled {
+		return false, nil
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || info.Size() == 0 {
+		return false, nil
+	}
+	if objectPath, _ := fs.getStoredContent(info); objectPath != "" {
+		return false, nil
+	}
+	if getLinkCount(info) > 1 {
+		// hard links created by the user are not modified
+		return false, nil
+	}
+	hash, err := getFileSHA256(name)
+	if err != nil {
+		return false, err
+	}
+	objectPath := filepath.Join(fs.getContentStorePath(), hash[:2], hash)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0700); err != nil {
+		return false, err
+	}
+
+	contentStoreLock.Lock()
+	defer contentStoreLock.Unlock()
+
+	objectInfo, err := os.Lstat(objectPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.Link(name, objectPath); err != nil {
+			return false, err
+		}
+		if err := fs.addContentIndex(objectPath, info); err != nil {
+			os.Remove(objectPath) //nolint:errcheck
+			return false, err
+		}
+		fsLog(fs, logger.LevelDebug, "file %q added to the content store, hash %q", name, hash)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if objectInfo.Size() != info.Size() {
+		return false, fmt.Errorf("the stored content %q does not match the size of %q", objectPath, name)
+	}
+	if err := replaceWithLink(objectPath, name); err != nil {
+		return false, err
+	}
+	fsLog(fs, logger.LevelDebug, "file %q deduplicated, hash %q", name, hash)
+	return true, nil
+}
+
+// DeduplicateContents deduplicates the files already existing inside the root
+// directory and removes the unreferenced contents from the store.
+// It returns the number of deduplicated files and their size.
+// Uploads in progress are not detected, so it should not be executed
+// while the root directory is modified
+func (fs *OsFs) DeduplicateContents() (int, int64, error) {
+	if !fs.config.DeduplicationEnabled {
+		return 0, 0, ErrVfsUnsupported
+	}
+	numFiles := 0
+	size := int64(0)
+	err := filepath.Walk(fs.rootDir, func(walkedPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && fs.isContentStorePath(walkedPath) {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		deduplicated, err := fs.DeduplicateFile(walkedPath)
+		if err != nil {
+			fsLog(fs, logger.LevelWarn, "unable to deduplicate file %q: %v", walkedPath, err)
+			return nil
+		}
+		if deduplicated {
+			numFiles++
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return numFiles, size, err
+	}
+	return numFiles, size, fs.removeUnreferencedContents()
+}
+
+// removeUnreferencedContents removes the stored contents no longer linked by
+// any file and the stale index entries. Missing index entries are added
+func (fs *OsFs) removeUnreferencedContents() error {
+	storePath := fs.getContentStorePath()
+	if _, err := os.Stat(storePath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	contentStoreLock.Lock()
+	defer contentStoreLock.Unlock()
+
+	indexPath := filepath.Join(storePath, osFsContentIndexDir)
+	return filepath.Walk(storePath, func(walkedPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && walkedPath == indexPath {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if getLinkCount(info) < 2 {
+			fs.removeStoredContent(walkedPath, true)
+			return nil
+		}
+		if objectPath, _ := fs.getStoredContent(info); objectPath == "" {
+			if err := fs.addContentIndex(walkedPath, info); err != nil {
+				fsLog(fs, logger.LevelWarn, "unable to add the index for content %q: %v", walkedPath, err)
+			}
+		}
+		return nil
+	})
+}
+
+// unshareFile makes sure that the named file does not share its stored content
+// with other files before modifying it. If no other file uses the content, it
+// is removed from the store and the file can be modified in place, otherwise a
+// private copy replaces the named file, the content is copied only if requested
+func (fs *OsFs) unshareFile(name string, copyContent bool) error {
+	if !fs.config.DeduplicationEnabled {
+		return nil
+	}
+	info, err := os.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	contentStoreLock.Lock()
+	objectPath, numFiles := fs.getStoredContent(info)
+	if numFiles < 2 && objectPath != "" {
+		fs.removeStoredContent(objectPath, true)
+	}
+	contentStoreLock.Unlock()
+
+	if objectPath == "" || numFiles < 2 {
+		return nil
+	}
+	tempName := filepath.Join(filepath.Dir(name), ".sftpgo-unshare."+xid.New().String())
+	dst, err := os.OpenFile(tempName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if copyContent {
+		err = copyFileContent(name, dst)
+	}
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tempName, name)
+	}
+	if err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	// the other files sharing the content could be removed in the meantime
+	fs.releaseStoredContent(objectPath)
+	fsLog(fs, logger.LevelDebug, "file %q no longer shares its content, copied: %t", name, copyContent)
+	return nil
+}
+
+func copyFileContent(name string, dst io.Writer) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// replaceWithLink atomically replaces name with a hard link to target
+func replaceWithLink(target, name string) error {
+	tempName := filepath.Join(filepath.Dir(name), ".sftpgo-dedup."+xid.New().String())
+	if err := os.Link(target, tempName); err != nil {
+		return err
+	}
+	if err := os.Rename(tempName, name); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	return nil
+}
+
+func getFileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
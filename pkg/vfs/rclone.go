@@ -0,0 +1,269 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sftpgo/sdk"
+
+	"github.com/drakkan/sftpgo/v2/pkg/kms"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	rcloneEncryptedConfigPrefix = "RCLONE_ENCRYPT_V0:"
+)
+
+// rcloneObscureKey is the fixed key Rclone uses to obscure passwords in its config file
+var rcloneObscureKey = []byte{
+	0x9c, 0x93, 0x5b, 0x48, 0x73, 0x0a, 0x55, 0x4d,
+	0x6b, 0xfd, 0x7c, 0x63, 0xc8, 0x86, 0xa9, 0x2b,
+	0xd3, 0x90, 0x19, 0x8e, 0xb8, 0x12, 0x8a, 0xfb,
+	0xf4, 0xde, 0x16, 0x2b, 0x8b, 0x95, 0xf6, 0x38,
+}
+
+// ImportRcloneRemote converts the named remote from the given Rclone config
+// file contents to a filesystem configuration. The remote can include a path,
+// for example "myremote:bucket/prefix": for object storage backends the first
+// path element is the bucket/container and the remaining ones are the key
+// prefix, for SFTP the path is the prefix.
+// Supported Rclone backends: s3, gcs, azureblob, sftp, local
+func ImportRcloneRemote(remote, configContents string) (Filesystem, error) {
+	fs := Filesystem{}
+	name, remotePath, ok := strings.Cut(remote, ":")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fs, util.NewValidationError("the remote name is required")
+	}
+	if !ok {
+		remotePath = ""
+	}
+	if strings.HasPrefix(strings.TrimSpace(configContents), rcloneEncryptedConfigPrefix) {
+		return fs, util.NewValidationError("encrypted Rclone config files are not supported")
+	}
+	sections, err := parseRcloneConfig(configContents)
+	if err != nil {
+		return fs, util.NewValidationError(err.Error())
+	}
+	section, ok := sections[name]
+	if !ok {
+		return fs, util.NewValidationError(fmt.Sprintf("remote %q not found in the Rclone config", name))
+	}
+	remotePath = strings.Trim(remotePath, "/")
+
+	switch section["type"] {
+	case "s3":
+		err = rcloneS3ToFilesystem(section, remotePath, &fs)
+	case "gcs", "google cloud storage":
+		err = rcloneGCSToFilesystem(section, remotePath, &fs)
+	case "azureblob":
+		err = rcloneAzBlobToFilesystem(section, remotePath, &fs)
+	case "sftp":
+		err = rcloneSFTPToFilesystem(section, remotePath, &fs)
+	case "local":
+		fs.Provider = sdk.LocalFilesystemProvider
+	default:
+		return fs, util.NewValidationError(fmt.Sprintf("unsupported Rclone backend %q for remote %q",
+			section["type"], name))
+	}
+	if err != nil {
+		return fs, util.NewValidationError(err.Error())
+	}
+	return fs, nil
+}
+
+// parseRcloneConfig parses the INI based Rclone config file format,
+// it returns the key/value pairs for each remote
+func parseRcloneConfig(contents string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	var current map[string]string
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("invalid Rclone config, line %d: %q", lineNumber, line)
+			}
+			current = make(map[string]string)
+			sections[strings.TrimSpace(line[1:len(line)-1])] = current
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			return nil, fmt.Errorf("invalid Rclone config, line %d: %q", lineNumber, line)
+		}
+		current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the Rclone config: %w", err)
+	}
+	return sections, nil
+}
+
+// revealRclonePassword decodes a password obscured by Rclone
+func revealRclonePassword(obscured string) (string, error) {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(obscured)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode the obscured password: %w", err)
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return "", errors.New("the obscured password is too short")
+	}
+	block, err := aes.NewCipher(rcloneObscureKey)
+	if err != nil {
+		return "", err
+	}
+	buf := ciphertext[aes.BlockSize:]
+	stream := cipher.NewCTR(block, ciphertext[:aes.BlockSize])
+	stream.XORKeyStream(buf, buf)
+	return string(buf), nil
+}
+
+func splitRcloneBucketPath(remotePath string) (string, string) {
+	bucket, prefix, _ := strings.Cut(remotePath, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return bucket, prefix
+}
+
+func isRcloneOptionEnabled(value string) bool {
+	enabled, err := strconv.ParseBool(value)
+	return err == nil && enabled
+}
+
+func rcloneS3ToFilesystem(section map[string]string, remotePath string, fs *Filesystem) error {
+	bucket, prefix := splitRcloneBucketPath(remotePath)
+	if bucket == "" {
+		return errors.New("the S3 bucket is required, use a remote such as \"myremote:bucket\"")
+	}
+	fs.Provider = sdk.S3FilesystemProvider
+	fs.S3Config.Bucket = bucket
+	fs.S3Config.KeyPrefix = prefix
+	fs.S3Config.Region = section["region"]
+	fs.S3Config.Endpoint = section["endpoint"]
+	fs.S3Config.StorageClass = section["storage_class"]
+	fs.S3Config.ACL = section["acl"]
+	fs.S3Config.SSEAlgorithm = section["server_side_encryption"]
+	if val, ok := section["force_path_style"]; ok {
+		fs.S3Config.ForcePathStyle = isRcloneOptionEnabled(val)
+	} else {
+		// Rclone uses path style addressing by default for non AWS providers
+		fs.S3Config.ForcePathStyle = section["provider"] != "" && section["provider"] != "AWS"
+	}
+	if !isRcloneOptionEnabled(section["env_auth"]) {
+		fs.S3Config.AccessKey = section["access_key_id"]
+		if secret := section["secret_access_key"]; secret != "" {
+			fs.S3Config.AccessSecret = kms.NewPlainSecret(secret)
+		}
+	}
+	return nil
+}
+
+func rcloneGCSToFilesystem(section map[string]string, remotePath string, fs *Filesystem) error {
+	bucket, prefix := splitRcloneBucketPath(remotePath)
+	if bucket == "" {
+		return errors.New("the GCS bucket is required, use a remote such as \"myremote:bucket\"")
+	}
+	fs.Provider = sdk.GCSFilesystemProvider
+	fs.GCSConfig.Bucket = bucket
+	fs.GCSConfig.KeyPrefix = prefix
+	fs.GCSConfig.StorageClass = section["storage_class"]
+	fs.GCSConfig.ACL = section["object_acl"]
+	if credentials := section["service_account_credentials"]; credentials != "" {
+		fs.GCSConfig.Credentials = kms.NewPlainSecret(credentials)
+		return nil
+	}
+	if section["service_account_file"] != "" {
+		return errors.New("GCS service account files are not supported, use service_account_credentials")
+	}
+	fs.GCSConfig.AutomaticCredentials = 1
+	return nil
+}
+
+func rcloneAzBlobToFilesystem(section map[string]string, remotePath string, fs *Filesystem) error {
+	container, prefix := splitRcloneBucketPath(remotePath)
+	fs.Provider = sdk.AzureBlobFilesystemProvider
+	fs.AzBlobConfig.Container = container
+	fs.AzBlobConfig.KeyPrefix = prefix
+	fs.AzBlobConfig.AccountName = section["account"]
+	fs.AzBlobConfig.Endpoint = section["endpoint"]
+	fs.AzBlobConfig.AccessTier = section["access_tier"]
+	fs.AzBlobConfig.UseEmulator = isRcloneOptionEnabled(section["use_emulator"])
+	if key := section["key"]; key != "" {
+		fs.AzBlobConfig.AccountKey = kms.NewPlainSecret(key)
+	}
+	if sasURL := section["sas_url"]; sasURL != "" {
+		fs.AzBlobConfig.SASURL = kms.NewPlainSecret(sasURL)
+	}
+	if container == "" && section["sas_url"] == "" {
+		return errors.New("the Azure Blob container is required, use a remote such as \"myremote:container\"")
+	}
+	return nil
+}
+
+func rcloneSFTPToFilesystem(section map[string]string, remotePath string, fs *Filesystem) error {
+	host := section["host"]
+	if host == "" {
+		return errors.New("the SFTP host is required")
+	}
+	port := section["port"]
+	if port == "" {
+		port = "22"
+	}
+	fs.Provider = sdk.SFTPFilesystemProvider
+	fs.SFTPConfig.Endpoint = net.JoinHostPort(host, port)
+	fs.SFTPConfig.Username = section["user"]
+	if remotePath != "" {
+		fs.SFTPConfig.Prefix = "/" + remotePath
+	}
+	if pass := section["pass"]; pass != "" {
+		password, err := revealRclonePassword(pass)
+		if err != nil {
+			return fmt.Errorf("invalid SFTP password: %w", err)
+		}
+		fs.SFTPConfig.Password = kms.NewPlainSecret(password)
+	}
+	if keyPEM := section["key_pem"]; keyPEM != "" {
+		// Rclone stores the PEM key on a single line
+		fs.SFTPConfig.PrivateKey = kms.NewPlainSecret(strings.ReplaceAll(keyPEM, `\n`, "\n"))
+	} else if section["key_file"] != "" {
+		return errors.New("SFTP key files are not supported, use key_pem")
+	}
+	if keyPass := section["key_file_pass"]; keyPass != "" {
+		passphrase, err := revealRclonePassword(keyPass)
+		if err != nil {
+			return fmt.Errorf("invalid SFTP key passphrase: %w", err)
+		}
+		fs.SFTPConfig.KeyPassphrase = kms.NewPlainSecret(passphrase)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+// Supported replication statuses
+const (
+	ReplicationStatusPending    = "pending"
+	ReplicationStatusReplicated = "replicated"
+	ReplicationStatusFailed     = "failed"
+)
+
+const (
+	replicationRetryBaseDelay = time.Minute
+	replicationRetryMaxDelay  = 12 * time.Hour
+	// pending replications not updated within this delay are considered
+	// interrupted, for example by a restart, and are retried
+	replicationPendingTimeout = time.Hour
+)
+
+var (
+	replicationStore ReplicationStore
+	// objects with a replication in progress inside this instance
+	activeReplications sync.Map
+)
+
+// ReplicationStatus tracks the replication of an uploaded object to the
+// configured replica bucket
+type ReplicationStatus struct {
+	// SFTPGo username
+	Username string `json:"username"`
+	// Virtual path of the replicated file
+	Path string `json:"path"`
+	// Bucket where the object is replicated
+	DestinationBucket string `json:"destination_bucket"`
+	// Replication status: pending, replicated, failed
+	Status string `json:"status"`
+	// Number of replication attempts
+	Attempts int `json:"attempts"`
+	// Error for the last failed attempt
+	LastError string `json:"last_error,omitempty"`
+	// Creation time as unix timestamp in milliseconds
+	CreatedAt int64 `json:"created_at"`
+	// Last update as unix timestamp in milliseconds
+	UpdatedAt int64 `json:"updated_at"`
+	// Unix timestamp in milliseconds for the next replication attempt,
+	// 0 for replicated objects
+	NextRetryAt int64 `json:"next_retry_at,omitempty"`
+}
+
+func (s *ReplicationStatus) setPending() {
+	now := time.Now()
+	s.Status = ReplicationStatusPending
+	s.Attempts++
+	s.UpdatedAt = util.GetTimeAsMsSinceEpoch(now)
+	s.NextRetryAt = util.GetTimeAsMsSinceEpoch(now.Add(replicationPendingTimeout))
+}
+
+func (s *ReplicationStatus) setReplicated() {
+	s.Status = ReplicationStatusReplicated
+	s.LastError = ""
+	s.UpdatedAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	s.NextRetryAt = 0
+}
+
+// setFailed marks the replication as failed and schedules a new attempt
+// using an exponential backoff
+func (s *ReplicationStatus) setFailed(err error) {
+	now := time.Now()
+	s.Status = ReplicationStatusFailed
+	s.LastError = err.Error()
+	s.UpdatedAt = util.GetTimeAsMsSinceEpoch(now)
+	s.NextRetryAt = util.GetTimeAsMsSinceEpoch(now.Add(getReplicationRetryDelay(s.Attempts)))
+}
+
+func getReplicationRetryDelay(attempts int) time.Duration {
+	delay := replicationRetryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= replicationRetryMaxDelay {
+			return replicationRetryMaxDelay
+		}
+	}
+	return delay
+}
+
+// ReplicationStore defines the interface to persist the replication statuses.
+// Missing statuses must be reported using an error wrapping os.ErrNotExist
+type ReplicationStore interface {
+	SetReplicationStatus(status *ReplicationStatus) error
+	GetReplicationStatus(username, virtualPath string) (ReplicationStatus, error)
+	DeleteReplicationStatus(username, virtualPath string) error
+}
+
+// FsReplicator is a Fs that can replicate the stored objects
+type FsReplicator interface {
+	Fs
+	// ReplicateObject copies the object with the specified path to the
+	// replica and updates its replication status
+	ReplicateObject(name string) error
+}
+
+// SetReplicationStore sets the store for the replication statuses
+func SetReplicationStore(store ReplicationStore) {
+	replicationStore = store
+}
+
+func getReplicationKey(username, virtualPath string) string {
+	return username + ":" + virtualPath
+}
+
+func lockReplication(username, virtualPath string) bool {
+	_, loaded := activeReplications.LoadOrStore(getReplicationKey(username, virtualPath), true)
+	return !loaded
+}
+
+func unlockReplication(username, virtualPath string) {
+	activeReplications.Delete(getReplicationKey(username, virtualPath))
+}
+
+// IsReplicationActive returns true if the object with the specified virtual
+// path is being replicated inside this instance
+func IsReplicationActive(username, virtualPath string) bool {
+	_, ok := activeReplications.Load(getReplicationKey(username, virtualPath))
+	return ok
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
 	"net"
 	"net/http"
@@ -33,6 +34,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
@@ -72,6 +74,8 @@ type S3Fs struct {
 	config     *S3FsConfig
 	svc        *s3.Client
 	ctxTimeout time.Duration
+	// client for the replica bucket, nil if replication is disabled
+	replicaSvc *s3.Client
 }
 
 func init() {
@@ -81,6 +85,14 @@ func init() {
 // NewS3Fs returns an S3Fs object that allows to interact with an s3 compatible
 // object storage
 func NewS3Fs(connectionID, localTempDir, mountPath string, s3Config S3FsConfig) (Fs, error) {
+	fs, err := newS3Fs(connectionID, localTempDir, mountPath, s3Config)
+	if err != nil || !fs.config.ContentAddressed {
+		return fs, err
+	}
+	return newCASFs(fs, fs.getStorageID(), fs.config.KeyPrefix, fs.localTempDir), nil
+}
+
+func newS3Fs(connectionID, localTempDir, mountPath string, s3Config S3FsConfig) (*S3Fs, error) {
 	if localTempDir == "" {
 		if tempPath != "" {
 			localTempDir = tempPath
@@ -137,7 +149,17 @@ func NewS3Fs(connectionID, localTempDir, mountPath string, s3Config S3FsConfig)
 	}
 	fs.svc = s3.NewFromConfig(awsConfig, func(o *s3.Options) {
 		o.UsePathStyle = fs.config.ForcePathStyle
+		o.UseAccelerate = fs.config.TransferAcceleration
 	})
+	if fs.config.TransferAcceleration && !fs.config.isTransferAccelerationRegion() {
+		fsLog(fs, logger.LevelWarn, "transfer acceleration is not available in region %q, requests will fail",
+			fs.config.Region)
+	}
+	if fs.config.Replication.IsEnabled() {
+		if err := fs.setReplicaClient(awsConfig); err != nil {
+			return fs, err
+		}
+	}
 	return fs, nil
 }
 
@@ -151,6 +173,11 @@ func (fs *S3Fs) ConnectionID() string {
 	return fs.connectionID
 }
 
+// UseAcceleratedEndpoint returns true if the S3 Transfer Acceleration endpoint is used
+func (fs *S3Fs) UseAcceleratedEndpoint() bool {
+	return fs.config.TransferAcceleration
+}
+
 // Stat returns a FileInfo describing the named file
 func (fs *S3Fs) Stat(name string) (os.FileInfo, error) {
 	var result *FileInfo
@@ -186,7 +213,14 @@ func (fs *S3Fs) Stat(name string) (os.FileInfo, error) {
 	// with a trailing forward slash (created using mkdir).
 	// S3 doesn't return content type when listing objects, so we have
 	// create "dirs" adding a trailing "/" to the key
-	return fs.getStatForDir(name)
+	info, err := fs.getStatForDir(name)
+	if err != nil && fs.IsNotExist(err) {
+		// the object does not exist, an interrupted upload may be resumed
+		if sessionInfo, ok := fs.getUploadSessionInfo(name); ok {
+			return sessionInfo, nil
+		}
+	}
+	return info, err
 }
 
 func (fs *S3Fs) getStatForDir(name string) (os.FileInfo, error) {
@@ -199,6 +233,12 @@ func (fs *S3Fs) getStatForDir(name string) (os.FileInfo, error) {
 		util.GetTimeFromPointer(obj.LastModified), false))
 }
 
+// BatchStat returns the file info for the specified paths using parallel
+// HeadObject calls
+func (fs *S3Fs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *S3Fs) Lstat(name string) (os.FileInfo, error) {
 	return fs.Stat(name)
@@ -241,6 +281,27 @@ func (fs *S3Fs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, fun
 	return nil, r, cancelFn, nil
 }
 
+// OpenRange opens the named object for reading the specified byte range
+func (fs *S3Fs) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	if length <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	ctx, cancelFn := context.WithCancel(context.Background())
+	obj, err := fs.svc.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(name),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		cancelFn()
+		return nil, err
+	}
+	return &cancelReadCloser{
+		ReadCloser: obj.Body,
+		cancelFn:   cancelFn,
+	}, nil
+}
+
 // Create creates or opens the named file for writing
 func (fs *S3Fs) Create(name string, flag, checks int) (File, *PipeWriter, func(), error) {
 	if checks&CheckParentDir != 0 {
@@ -249,6 +310,14 @@ func (fs *S3Fs) Create(name string, flag, checks int) (File, *PipeWriter, func()
 			return nil, nil, nil, err
 		}
 	}
+	if flag != -1 {
+		if err := fs.checkObjectLock(name); err != nil {
+			return nil, nil, nil, err
+		}
+		if fs.hasResumableUploads() {
+			return fs.createResumable(name, flag)
+		}
+	}
 	r, w, err := pipeat.PipeInDir(fs.localTempDir)
 	if err != nil {
 		return nil, nil, nil, err
@@ -274,19 +343,30 @@ func (fs *S3Fs) Create(name string, flag, checks int) (File, *PipeWriter, func()
 		} else {
 			contentType = mime.TypeByExtension(path.Ext(name))
 		}
-		_, err := uploader.Upload(ctx, &s3.PutObjectInput{
-			Bucket:       aws.String(fs.config.Bucket),
-			Key:          aws.String(name),
-			Body:         r,
-			ACL:          types.ObjectCannedACL(fs.config.ACL),
-			StorageClass: types.StorageClass(fs.config.StorageClass),
-			ContentType:  util.NilIfEmpty(contentType),
-		})
+		input := &s3.PutObjectInput{
+			Bucket:               aws.String(fs.config.Bucket),
+			Key:                  aws.String(name),
+			Body:                 r,
+			ACL:                  types.ObjectCannedACL(fs.config.ACL),
+			StorageClass:         types.StorageClass(fs.config.StorageClass),
+			ServerSideEncryption: types.ServerSideEncryption(fs.config.SSEAlgorithm),
+			ContentType:          util.NilIfEmpty(contentType),
+		}
+		if fs.config.ObjectLockEnabled && flag != -1 {
+			// S3 requires an integrity check for requests with object lock parameters
+			input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+			input.ObjectLockMode = types.ObjectLockMode(fs.config.ObjectLockMode)
+			input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(time.Duration(fs.config.RetentionDays) * 24 * time.Hour))
+		}
+		_, err := uploader.Upload(ctx, input)
 		r.CloseWithError(err) //nolint:errcheck
 		p.Done(err)
 		fsLog(fs, logger.LevelDebug, "upload completed, path: %#v, acl: %#v, readed bytes: %v, err: %+v",
 			name, fs.config.ACL, r.GetReadedBytes(), err)
 		metric.S3TransferCompleted(r.GetReadedBytes(), 0, err)
+		if err == nil && flag != -1 {
+			fs.startReplication(name)
+		}
 	}()
 	return nil, p, cancelFn, nil
 }
@@ -320,50 +400,80 @@ func (fs *S3Fs) Rename(source, target string) error {
 			return err
 		}
 	} else {
-		contentType := mime.TypeByExtension(path.Ext(source))
-		copySource := pathEscape(fs.Join(fs.config.Bucket, source))
-
-		if fi.Size() > 500*1024*1024 {
-			fsLog(fs, logger.LevelDebug, "renaming file %q with size %d using multipart copy",
-				source, fi.Size())
-			err = fs.doMultipartCopy(copySource, target, contentType, fi.Size())
-		} else {
-			ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
-			defer cancelFn()
-
-			_, err = fs.svc.CopyObject(ctx, &s3.CopyObjectInput{
-				Bucket:       aws.String(fs.config.Bucket),
-				CopySource:   aws.String(copySource),
-				Key:          aws.String(target),
-				StorageClass: types.StorageClass(fs.config.StorageClass),
-				ACL:          types.ObjectCannedACL(fs.config.ACL),
-				ContentType:  util.NilIfEmpty(contentType),
-			})
+		if err := fs.checkObjectLock(source); err != nil {
+			return err
 		}
-		if err != nil {
-			metric.S3CopyObjectCompleted(err)
+		if err := fs.checkObjectLock(target); err != nil {
+			return err
+		}
+		if err := fs.copyFileInternal(source, target, fi); err != nil {
 			return err
 		}
+		fs.startReplication(target)
+	}
+	return fs.Remove(source, fi.IsDir())
+}
 
-		waiter := s3.NewObjectExistsWaiter(fs.svc)
-		err = waiter.Wait(context.Background(), &s3.HeadObjectInput{
-			Bucket: aws.String(fs.config.Bucket),
-			Key:    aws.String(target),
-		}, 10*time.Second)
+// CopyFile copies source to target using a server side copy
+func (fs *S3Fs) CopyFile(source, target string, srcInfo os.FileInfo) error {
+	if err := fs.copyFileInternal(source, target, srcInfo); err != nil {
+		return err
+	}
+	fs.startReplication(target)
+	return nil
+}
+
+func (fs *S3Fs) copyFileInternal(source, target string, fi os.FileInfo) error {
+	var err error
+	contentType := mime.TypeByExtension(path.Ext(source))
+	copySource := pathEscape(fs.Join(fs.config.Bucket, source))
+
+	if fi.Size() > 500*1024*1024 {
+		fsLog(fs, logger.LevelDebug, "copying file %q with size %d using multipart copy",
+			source, fi.Size())
+		// a multipart copy does not preserve the user defined metadata
+		var metadata map[string]string
+		if obj, errHead := fs.headObject(source); errHead == nil {
+			metadata = obj.Metadata
+		}
+		err = fs.doMultipartCopy(fs.svc, fs.config.Bucket, copySource, target, contentType, fi.Size(), metadata)
+	} else {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		defer cancelFn()
+
+		_, err = fs.svc.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               aws.String(fs.config.Bucket),
+			CopySource:           aws.String(copySource),
+			Key:                  aws.String(target),
+			StorageClass:         types.StorageClass(fs.config.StorageClass),
+			ServerSideEncryption: types.ServerSideEncryption(fs.config.SSEAlgorithm),
+			ACL:                  types.ObjectCannedACL(fs.config.ACL),
+			ContentType:          util.NilIfEmpty(contentType),
+		})
+	}
+	if err != nil {
 		metric.S3CopyObjectCompleted(err)
+		return err
+	}
+
+	waiter := s3.NewObjectExistsWaiter(fs.svc)
+	err = waiter.Wait(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(target),
+	}, 10*time.Second)
+	metric.S3CopyObjectCompleted(err)
+	if err != nil {
+		return err
+	}
+	if plugin.Handler.HasMetadater() {
+		err = plugin.Handler.SetModificationTime(fs.getStorageID(), ensureAbsPath(target),
+			util.GetTimeAsMsSinceEpoch(fi.ModTime()))
 		if err != nil {
-			return err
-		}
-		if plugin.Handler.HasMetadater() {
-			err = plugin.Handler.SetModificationTime(fs.getStorageID(), ensureAbsPath(target),
-				util.GetTimeAsMsSinceEpoch(fi.ModTime()))
-			if err != nil {
-				fsLog(fs, logger.LevelWarn, "unable to preserve modification time after renaming %#v -> %#v: %+v",
-					source, target, err)
-			}
+			fsLog(fs, logger.LevelWarn, "unable to preserve modification time after copying %#v -> %#v: %+v",
+				source, target, err)
 		}
 	}
-	return fs.Remove(source, fi.IsDir())
+	return nil
 }
 
 // Remove removes the named file or (empty) directory.
@@ -379,6 +489,18 @@ func (fs *S3Fs) Remove(name string, isDir bool) error {
 		if !strings.HasSuffix(name, "/") {
 			name += "/"
 		}
+	} else if err := fs.checkObjectLock(name); err != nil {
+		return err
+	} else if fs.hasResumableUploads() {
+		session, ok, err := fs.getUploadSession(name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := fs.AbortUploadSession(&session); err != nil {
+				return err
+			}
+		}
 	}
 	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 	defer cancelFn()
@@ -388,6 +510,9 @@ func (fs *S3Fs) Remove(name string, isDir bool) error {
 		Key:    aws.String(name),
 	})
 	metric.S3DeleteObjectCompleted(err)
+	if err == nil && !isDir {
+		fs.startReplicaRemoval(name)
+	}
 	if plugin.Handler.HasMetadater() && err == nil && !isDir {
 		if errMetadata := plugin.Handler.RemoveMetadata(fs.getStorageID(), ensureAbsPath(name)); errMetadata != nil {
 			fsLog(fs, logger.LevelWarn, "unable to remove metadata for path %#v: %+v", name, errMetadata)
@@ -514,10 +639,47 @@ func (fs *S3Fs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return result, nil
 }
 
+// CountDirEntries implements FsDirEntriesCounter. The listing stops once limit
+// is reached and the folders modification times are not loaded
+func (fs *S3Fs) CountDirEntries(dirname string, limit int) (int, error) {
+	// dirname must be already cleaned
+	prefix := fs.getPrefix(dirname)
+	names := make(map[string]bool)
+
+	paginator := s3.NewListObjectsV2Paginator(fs.svc, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(fs.config.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+
+	for paginator.HasMorePages() && (limit <= 0 || len(names) < limit) {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		page, err := paginator.NextPage(ctx)
+		cancelFn()
+		if err != nil {
+			metric.S3ListObjectsCompleted(err)
+			return 0, err
+		}
+		for _, p := range page.CommonPrefixes {
+			if name, _ := fs.resolve(p.Prefix, prefix); name != "" {
+				names[name] = true
+			}
+		}
+		for _, fileObject := range page.Contents {
+			if name, _ := fs.resolve(fileObject.Key, prefix); name != "" && name != "/" {
+				names[name] = true
+			}
+		}
+	}
+
+	metric.S3ListObjectsCompleted(nil)
+	return capDirEntriesCount(len(names), limit), nil
+}
+
 // IsUploadResumeSupported returns true if resuming uploads is supported.
-// Resuming uploads is not supported on S3
-func (*S3Fs) IsUploadResumeSupported() bool {
-	return false
+// Resuming uploads is supported on S3 only if resumable uploads are enabled
+func (fs *S3Fs) IsUploadResumeSupported() bool {
+	return fs.hasResumableUploads()
 }
 
 // IsAtomicUploadSupported returns true if atomic upload is supported.
@@ -550,6 +712,9 @@ func (*S3Fs) IsPermission(err error) bool {
 		return false
 	}
 
+	if errors.Is(err, ErrObjectLocked) {
+		return true
+	}
 	var re *awshttp.ResponseError
 	if errors.As(err, &re) {
 		if re.Response != nil {
@@ -619,6 +784,87 @@ func (fs *S3Fs) getFileNamesInPrefix(fsPrefix string) (map[string]bool, error) {
 	return fileNames, nil
 }
 
+// ValidatePath returns an error if the given name contains control characters,
+// they are allowed in S3 object keys but are not safe for most clients
+func (*S3Fs) ValidatePath(name string) error {
+	return validateFileName(name, unicode.IsControl)
+}
+
+// CheckHealth verifies the credentials listing at most one object
+func (fs *S3Fs) CheckHealth(ctx context.Context) error {
+	_, err := fs.svc.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(fs.config.Bucket),
+		Prefix:  aws.String(fs.config.KeyPrefix),
+		MaxKeys: 1,
+	})
+	metric.S3ListObjectsCompleted(err)
+	return err
+}
+
+// SetMetadata replaces the user defined metadata for the specified path.
+// S3 object metadata cannot be modified, so the object is copied over itself
+// and its last modification time is updated
+func (fs *S3Fs) SetMetadata(name string, metadata map[string]string) error {
+	key, obj, err := fs.getMetadataObject(name)
+	if err != nil {
+		return err
+	}
+	copySource := pathEscape(fs.Join(fs.config.Bucket, key))
+	contentType := util.GetStringFromPointer(obj.ContentType)
+
+	if obj.ContentLength > 500*1024*1024 {
+		err = fs.doMultipartCopy(fs.svc, fs.config.Bucket, copySource, key, contentType, obj.ContentLength, metadata)
+	} else {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		defer cancelFn()
+
+		_, err = fs.svc.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:               aws.String(fs.config.Bucket),
+			CopySource:           aws.String(copySource),
+			Key:                  aws.String(key),
+			StorageClass:         types.StorageClass(fs.config.StorageClass),
+			ServerSideEncryption: types.ServerSideEncryption(fs.config.SSEAlgorithm),
+			ACL:                  types.ObjectCannedACL(fs.config.ACL),
+			ContentType:          util.NilIfEmpty(contentType),
+			Metadata:             metadata,
+			MetadataDirective:    types.MetadataDirectiveReplace,
+		})
+	}
+	metric.S3CopyObjectCompleted(err)
+	if err == nil {
+		fs.startReplication(key)
+	}
+	return err
+}
+
+// GetMetadata returns the user defined metadata for the specified path
+func (fs *S3Fs) GetMetadata(name string) (map[string]string, error) {
+	_, obj, err := fs.getMetadataObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return getUserMetadata(obj.Metadata), nil
+}
+
+// getMetadataObject returns the key and the attributes of the object that
+// stores the metadata for the specified path. Directories are zero bytes
+// objects with a trailing slash
+func (fs *S3Fs) getMetadataObject(name string) (string, *s3.HeadObjectOutput, error) {
+	if name == "" || name == "/" || name == "." || fs.config.KeyPrefix == name+"/" {
+		return "", nil, ErrVfsUnsupported
+	}
+	obj, err := fs.headObject(name)
+	if err == nil {
+		return name, obj, nil
+	}
+	if !fs.IsNotExist(err) {
+		return "", nil, err
+	}
+	key := name + "/"
+	obj, err = fs.headObject(key)
+	return key, obj, err
+}
+
 // CheckMetadata checks the metadata consistency
 func (fs *S3Fs) CheckMetadata() error {
 	return fsMetadataCheck(fs, fs.getStorageID(), fs.config.KeyPrefix)
@@ -824,16 +1070,22 @@ func (fs *S3Fs) hasContents(name string) (bool, error) {
 	return false, nil
 }
 
-func (fs *S3Fs) doMultipartCopy(source, target, contentType string, fileSize int64) error {
+// doMultipartCopy copies source to the target key inside the specified bucket,
+// svc must be the client for the bucket region
+func (fs *S3Fs) doMultipartCopy(svc *s3.Client, bucket, source, target, contentType string, fileSize int64,
+	metadata map[string]string,
+) error {
 	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 	defer cancelFn()
 
-	res, err := fs.svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket:       aws.String(fs.config.Bucket),
-		Key:          aws.String(target),
-		StorageClass: types.StorageClass(fs.config.StorageClass),
-		ACL:          types.ObjectCannedACL(fs.config.ACL),
-		ContentType:  util.NilIfEmpty(contentType),
+	res, err := svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(target),
+		StorageClass:         types.StorageClass(fs.config.StorageClass),
+		ServerSideEncryption: types.ServerSideEncryption(fs.config.SSEAlgorithm),
+		ACL:                  types.ObjectCannedACL(fs.config.ACL),
+		ContentType:          util.NilIfEmpty(contentType),
+		Metadata:             metadata,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to create multipart copy request: %w", err)
@@ -887,8 +1139,8 @@ func (fs *S3Fs) doMultipartCopy(source, target, contentType string, fileSize int
 			innerCtx, innerCancelFn := context.WithDeadline(opCtx, time.Now().Add(fs.ctxTimeout))
 			defer innerCancelFn()
 
-			partResp, err := fs.svc.UploadPartCopy(innerCtx, &s3.UploadPartCopyInput{
-				Bucket:          aws.String(fs.config.Bucket),
+			partResp, err := svc.UploadPartCopy(innerCtx, &s3.UploadPartCopyInput{
+				Bucket:          aws.String(bucket),
 				CopySource:      aws.String(source),
 				Key:             aws.String(target),
 				PartNumber:      partNum,
@@ -905,8 +1157,8 @@ func (fs *S3Fs) doMultipartCopy(source, target, contentType string, fileSize int
 					abortCtx, abortCancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 					defer abortCancelFn()
 
-					_, errAbort := fs.svc.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
-						Bucket:   aws.String(fs.config.Bucket),
+					_, errAbort := svc.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+						Bucket:   aws.String(bucket),
 						Key:      aws.String(target),
 						UploadId: aws.String(uploadID),
 					})
@@ -939,8 +1191,8 @@ func (fs *S3Fs) doMultipartCopy(source, target, contentType string, fileSize int
 	completeCtx, completeCancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 	defer completeCancelFn()
 
-	_, err = fs.svc.CompleteMultipartUpload(completeCtx, &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(fs.config.Bucket),
+	_, err = svc.CompleteMultipartUpload(completeCtx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(bucket),
 		Key:      aws.String(target),
 		UploadId: aws.String(uploadID),
 		MultipartUpload: &types.CompletedMultipartUpload{
@@ -976,6 +1228,83 @@ func (fs *S3Fs) headObject(name string) (*s3.HeadObjectOutput, error) {
 	return obj, err
 }
 
+// isObjectLocked returns true if the specified object is protected by an active
+// retention period or by a legal hold
+func (fs *S3Fs) isObjectLocked(name string) (bool, error) {
+	obj, err := fs.headObject(name)
+	if err != nil {
+		if fs.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if obj.ObjectLockLegalHoldStatus == types.ObjectLockLegalHoldStatusOn {
+		return true, nil
+	}
+	if obj.ObjectLockMode != "" && obj.ObjectLockRetainUntilDate != nil {
+		return obj.ObjectLockRetainUntilDate.After(time.Now()), nil
+	}
+	return false, nil
+}
+
+// checkObjectLock returns ErrObjectLocked if object lock is enabled and
+// the specified object cannot be modified or removed
+func (fs *S3Fs) checkObjectLock(name string) error {
+	if !fs.config.ObjectLockEnabled {
+		return nil
+	}
+	locked, err := fs.isObjectLocked(name)
+	if err != nil {
+		return err
+	}
+	if locked {
+		fsLog(fs, logger.LevelDebug, "object %q is locked", name)
+		return ErrObjectLocked
+	}
+	return nil
+}
+
+// HasLockedObjects returns true if object lock is enabled and the specified
+// directory contains at least an object that cannot be removed
+func (fs *S3Fs) HasLockedObjects(dirName string) (bool, error) {
+	if !fs.config.ObjectLockEnabled {
+		return false, nil
+	}
+	prefix := fs.getPrefix(dirName)
+	paginator := s3.NewListObjectsV2Paginator(fs.svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(fs.config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		defer cancelFn()
+
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			metric.S3ListObjectsCompleted(err)
+			return false, err
+		}
+		for _, fileObject := range page.Contents {
+			key := util.GetStringFromPointer(fileObject.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			locked, err := fs.isObjectLocked(key)
+			if err != nil {
+				return false, err
+			}
+			if locked {
+				metric.S3ListObjectsCompleted(nil)
+				fsLog(fs, logger.LevelDebug, "directory %q contains the locked object %q", dirName, key)
+				return true, nil
+			}
+		}
+	}
+	metric.S3ListObjectsCompleted(nil)
+	return false, nil
+}
+
 // GetMimeType returns the content type
 func (fs *S3Fs) GetMimeType(name string) (string, error) {
 	obj, err := fs.headObject(name)
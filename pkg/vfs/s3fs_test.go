@@ -0,0 +1,108 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3TransferAcceleration(t *testing.T) {
+	config := S3FsConfig{
+		BaseS3FsConfig: sdk.BaseS3FsConfig{
+			Bucket: "bucket",
+			Region: "us-east-1",
+		},
+		TransferAcceleration: true,
+	}
+	fs, err := NewS3Fs("connID", os.TempDir(), "", config)
+	require.NoError(t, err)
+	s3Fs, ok := fs.(*S3Fs)
+	require.True(t, ok)
+	assert.True(t, s3Fs.UseAcceleratedEndpoint())
+	// regions without transfer acceleration are allowed, a warning is logged
+	config.Region = "cn-north-1"
+	_, err = NewS3Fs("connID", os.TempDir(), "", config)
+	assert.NoError(t, err)
+	config.TransferAcceleration = false
+	fs, err = NewS3Fs("connID", os.TempDir(), "", config)
+	require.NoError(t, err)
+	s3Fs, ok = fs.(*S3Fs)
+	require.True(t, ok)
+	assert.False(t, s3Fs.UseAcceleratedEndpoint())
+}
+
+// BenchmarkS3TransferAcceleration uploads and downloads a test file with and without
+// S3 Transfer Acceleration. It requires AWS credentials and a bucket with transfer
+// acceleration enabled, for example:
+//
+//	SFTPGO_BENCH_S3_BUCKET=bucket SFTPGO_BENCH_S3_REGION=us-east-1 AWS_ACCESS_KEY_ID=key \
+//	AWS_SECRET_ACCESS_KEY=secret go test -run=NONE -bench=S3TransferAcceleration ./pkg/vfs
+func BenchmarkS3TransferAcceleration(b *testing.B) {
+	bucket := os.Getenv("SFTPGO_BENCH_S3_BUCKET")
+	region := os.Getenv("SFTPGO_BENCH_S3_REGION")
+	if bucket == "" || region == "" || os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		b.Skip("AWS credentials and the benchmark bucket and region are required")
+	}
+	content := make([]byte, 16*1024*1024)
+	_, err := rand.Read(content)
+	require.NoError(b, err)
+
+	for _, accelerated := range []bool{false, true} {
+		b.Run(fmt.Sprintf("accelerated=%t", accelerated), func(b *testing.B) {
+			config := S3FsConfig{
+				BaseS3FsConfig: sdk.BaseS3FsConfig{
+					Bucket: bucket,
+					Region: region,
+				},
+				TransferAcceleration: accelerated,
+			}
+			fs, err := NewS3Fs("bench", b.TempDir(), "", config)
+			require.NoError(b, err)
+			name := fmt.Sprintf("/sftpgo_bench_accelerated_%t", accelerated)
+			b.SetBytes(2 * int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, w, cancelFn, err := fs.Create(name, 0, 0)
+				require.NoError(b, err)
+				_, err = w.Write(content)
+				if err == nil {
+					err = w.Close()
+				}
+				cancelFn()
+				require.NoError(b, err)
+
+				_, r, cancelFn, err := fs.Open(name, 0)
+				require.NoError(b, err)
+				_, err = io.Copy(io.Discard, r)
+				r.Close()
+				cancelFn()
+				require.NoError(b, err)
+			}
+			b.StopTimer()
+			assert.NoError(b, fs.Remove(name, false))
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/metric"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	// a server side copy between regions can take long time for big objects
+	s3ReplicationTimeout = 15 * time.Minute
+	// objects bigger than this size cannot be copied using a single CopyObject request
+	s3MaxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// interval to check if a replication in progress is completed
+	s3ReplicationWaitInterval = time.Second
+)
+
+var errReplicationInProgress = errors.New("a replication for the same object is already in progress")
+
+func (fs *S3Fs) hasReplication() bool {
+	return fs.replicaSvc != nil && replicationStore != nil
+}
+
+// setReplicaClient initializes the client for the replica bucket, the source
+// configuration is used, overriding the region and, if set, the credentials
+func (fs *S3Fs) setReplicaClient(awsConfig aws.Config) error {
+	replication := &fs.config.Replication
+	var creds aws.CredentialsProvider
+	if !replication.DestinationCredentials.AccessSecret.IsEmpty() {
+		if err := replication.DestinationCredentials.AccessSecret.TryDecrypt(); err != nil {
+			return err
+		}
+		creds = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+			replication.DestinationCredentials.AccessKey, replication.DestinationCredentials.AccessSecret.GetPayload(), ""))
+	}
+	fs.replicaSvc = s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.UsePathStyle = fs.config.ForcePathStyle
+		o.Region = replication.DestinationRegion
+		if creds != nil {
+			o.Credentials = creds
+		}
+	})
+	return nil
+}
+
+// startReplication replicates, in background, a newly uploaded object
+func (fs *S3Fs) startReplication(name string) {
+	if !fs.hasReplication() {
+		return
+	}
+	go func() {
+		if err := fs.replicate(name, true); err != nil {
+			fsLog(fs, logger.LevelWarn, "unable to replicate object %q to bucket %q: %v", name,
+				fs.config.Replication.DestinationBucket, err)
+		}
+	}()
+}
+
+// startReplicaRemoval removes, in background, the replica for a removed object
+func (fs *S3Fs) startReplicaRemoval(name string) {
+	if !fs.hasReplication() {
+		return
+	}
+	go func() {
+		if err := fs.removeReplica(name); err != nil {
+			fsLog(fs, logger.LevelWarn, "unable to remove replica %q from bucket %q: %v", name,
+				fs.config.Replication.DestinationBucket, err)
+		}
+	}()
+}
+
+// ReplicateObject copies the object with the specified path to the replica
+// bucket and updates its replication status
+func (fs *S3Fs) ReplicateObject(name string) error {
+	if !fs.hasReplication() {
+		return ErrVfsUnsupported
+	}
+	return fs.replicate(name, false)
+}
+
+func (fs *S3Fs) replicate(name string, isNewUpload bool) error {
+	username := fs.config.username
+	virtualPath := fs.GetRelativePath(name)
+	if !lockReplication(username, virtualPath) {
+		return errReplicationInProgress
+	}
+	defer unlockReplication(username, virtualPath)
+
+	var status ReplicationStatus
+	if !isNewUpload {
+		var err error
+		status, err = replicationStore.GetReplicationStatus(username, virtualPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if status.CreatedAt == 0 {
+		status = ReplicationStatus{
+			Username:  username,
+			Path:      virtualPath,
+			CreatedAt: util.GetTimeAsMsSinceEpoch(time.Now()),
+		}
+	}
+	status.DestinationBucket = fs.config.Replication.DestinationBucket
+	status.setPending()
+	if err := replicationStore.SetReplicationStatus(&status); err != nil {
+		return err
+	}
+	obj, err := fs.headObject(name)
+	if err != nil {
+		if fs.IsNotExist(err) {
+			// the object was removed or renamed, there is nothing to replicate
+			fsLog(fs, logger.LevelDebug, "object %q no longer exists, removing its replication status", name)
+			if errDel := replicationStore.DeleteReplicationStatus(username, virtualPath); errDel != nil &&
+				!errors.Is(errDel, os.ErrNotExist) {
+				fsLog(fs, logger.LevelError, "unable to remove replication status for %q: %v", virtualPath, errDel)
+			}
+			return err
+		}
+		return fs.setReplicationResult(&status, err)
+	}
+	return fs.setReplicationResult(&status, fs.copyToReplica(name, obj))
+}
+
+// removeReplica removes the replica and the replication status for the specified
+// object. A replication in progress for the same object could create the replica
+// again so we wait for it to complete
+func (fs *S3Fs) removeReplica(name string) error {
+	username := fs.config.username
+	virtualPath := fs.GetRelativePath(name)
+	for !lockReplication(username, virtualPath) {
+		time.Sleep(s3ReplicationWaitInterval)
+	}
+	defer unlockReplication(username, virtualPath)
+
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	_, err := fs.replicaSvc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(fs.config.Replication.DestinationBucket),
+		Key:    aws.String(name),
+	})
+	metric.S3DeleteObjectCompleted(err)
+	if err != nil && !fs.IsNotExist(err) {
+		return err
+	}
+	fsLog(fs, logger.LevelDebug, "replica %q removed from bucket %q", name, fs.config.Replication.DestinationBucket)
+	if err := replicationStore.DeleteReplicationStatus(username, virtualPath); err != nil &&
+		!errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (fs *S3Fs) setReplicationResult(status *ReplicationStatus, err error) error {
+	if err != nil {
+		status.setFailed(err)
+	} else {
+		status.setReplicated()
+	}
+	fsLog(fs, logger.LevelDebug, "replication completed, path: %q, destination bucket: %q, attempt: %d, err: %v",
+		status.Path, status.DestinationBucket, status.Attempts, err)
+	if errSet := replicationStore.SetReplicationStatus(status); errSet != nil {
+		fsLog(fs, logger.LevelError, "unable to update replication status for %q: %v", status.Path, errSet)
+		if err == nil {
+			err = errSet
+		}
+	}
+	return err
+}
+
+func (fs *S3Fs) copyToReplica(name string, obj *s3.HeadObjectOutput) error {
+	copySource := pathEscape(fs.Join(fs.config.Bucket, name))
+	if obj.ContentLength > s3MaxCopyObjectSize {
+		fsLog(fs, logger.LevelDebug, "replicating object %q with size %d using multipart copy", name,
+			obj.ContentLength)
+		err := fs.doMultipartCopy(fs.replicaSvc, fs.config.Replication.DestinationBucket, copySource, name,
+			util.GetStringFromPointer(obj.ContentType), obj.ContentLength, obj.Metadata)
+		metric.S3CopyObjectCompleted(err)
+		return err
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(s3ReplicationTimeout))
+	defer cancelFn()
+
+	_, err := fs.replicaSvc.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(fs.config.Replication.DestinationBucket),
+		CopySource: aws.String(copySource),
+		Key:        aws.String(name),
+	})
+	metric.S3CopyObjectCompleted(err)
+	return err
+}
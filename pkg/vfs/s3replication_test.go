@@ -0,0 +1,180 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testS3ReplicaBucket = "replica"
+
+// testReplicationStore is an in memory ReplicationStore
+type testReplicationStore struct {
+	mu       sync.Mutex
+	statuses map[string]ReplicationStatus
+}
+
+func newTestReplicationStore() *testReplicationStore {
+	return &testReplicationStore{
+		statuses: make(map[string]ReplicationStatus),
+	}
+}
+
+func (s *testReplicationStore) SetReplicationStatus(status *ReplicationStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[getReplicationKey(status.Username, status.Path)] = *status
+	return nil
+}
+
+func (s *testReplicationStore) GetReplicationStatus(username, virtualPath string) (ReplicationStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[getReplicationKey(username, virtualPath)]
+	if !ok {
+		return status, fmt.Errorf("%w: %q", os.ErrNotExist, virtualPath)
+	}
+	return status, nil
+}
+
+func (s *testReplicationStore) DeleteReplicationStatus(username, virtualPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := getReplicationKey(username, virtualPath)
+	if _, ok := s.statuses[key]; !ok {
+		return fmt.Errorf("%w: %q", os.ErrNotExist, virtualPath)
+	}
+	delete(s.statuses, key)
+	return nil
+}
+
+func (s *testReplicationStore) isReplicated(virtualPath string) bool {
+	status, err := s.GetReplicationStatus(testS3Username, virtualPath)
+	return err == nil && status.Status == ReplicationStatusReplicated
+}
+
+func (s *testReplicationStore) exists(virtualPath string) bool {
+	_, err := s.GetReplicationStatus(testS3Username, virtualPath)
+	return err == nil
+}
+
+func TestS3ReplicationCopyRenameRemove(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestReplicationStore()
+	SetReplicationStore(store)
+	defer SetReplicationStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.Replication = S3ReplicationConfig{
+		DestinationBucket: testS3ReplicaBucket,
+		DestinationRegion: "us-west-2",
+	}
+	fs := newTestS3Fs(t, config)
+	data := []byte("replicated content")
+	server.setObject(testS3Bucket, "file1.dat", data)
+
+	isReplicated := func(name string) bool {
+		replica, ok := server.getObject(testS3ReplicaBucket, name)
+		return ok && string(replica) == string(data) && store.isReplicated(fs.GetRelativePath(name))
+	}
+	isReplicaRemoved := func(name string) bool {
+		_, ok := server.getObject(testS3ReplicaBucket, name)
+		return !ok && !store.exists(fs.GetRelativePath(name))
+	}
+
+	info, err := fs.Stat("file1.dat")
+	require.NoError(t, err)
+	err = fs.CopyFile("file1.dat", "file2.dat", info)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return isReplicated("file2.dat")
+	}, 2*time.Second, 50*time.Millisecond)
+	// the source object was not modified and so it is not replicated
+	_, ok := server.getObject(testS3ReplicaBucket, "file1.dat")
+	assert.False(t, ok)
+
+	err = fs.Rename("file2.dat", "file3.dat")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return isReplicated("file3.dat") && isReplicaRemoved("file2.dat")
+	}, 2*time.Second, 50*time.Millisecond)
+
+	err = fs.Remove("file3.dat", false)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return isReplicaRemoved("file3.dat")
+	}, 2*time.Second, 50*time.Millisecond)
+	// removing an object never replicated is not an error
+	err = fs.removeReplica("file1.dat")
+	assert.NoError(t, err)
+	_, ok = server.getObject(testS3Bucket, "file1.dat")
+	assert.True(t, ok)
+}
+
+func TestS3RemoveReplicaWaitsForReplication(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestReplicationStore()
+	SetReplicationStore(store)
+	defer SetReplicationStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.Replication = S3ReplicationConfig{
+		DestinationBucket: testS3ReplicaBucket,
+		DestinationRegion: "us-west-2",
+	}
+	fs := newTestS3Fs(t, config)
+	name := "file.dat"
+	virtualPath := fs.GetRelativePath(name)
+	server.setObject(testS3ReplicaBucket, name, []byte("replica"))
+	// simulate a replication in progress
+	require.True(t, lockReplication(testS3Username, virtualPath))
+	removed := make(chan error, 1)
+	go func() {
+		removed <- fs.removeReplica(name)
+	}()
+	time.Sleep(2 * s3ReplicationWaitInterval)
+	_, ok := server.getObject(testS3ReplicaBucket, name)
+	assert.True(t, ok)
+	unlockReplication(testS3Username, virtualPath)
+	select {
+	case err := <-removed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replica was not removed")
+	}
+	_, ok = server.getObject(testS3ReplicaBucket, name)
+	assert.False(t, ok)
+	assert.False(t, IsReplicationActive(testS3Username, virtualPath))
+}
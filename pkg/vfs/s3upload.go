@@ -0,0 +1,387 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/eikenb/pipeat"
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+	"github.com/drakkan/sftpgo/v2/pkg/metric"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+func (fs *S3Fs) hasResumableUploads() bool {
+	return fs.config.ResumableUploads && uploadSessionStore != nil
+}
+
+// getUploadSession returns the upload session for the specified object key, if any
+func (fs *S3Fs) getUploadSession(name string) (UploadSession, bool, error) {
+	session, err := uploadSessionStore.GetUploadSession(fs.config.username, fs.GetRelativePath(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return session, false, nil
+		}
+		return session, false, err
+	}
+	return session, true, nil
+}
+
+// getUploadSessionInfo returns a FileInfo for an interrupted upload, the size
+// is the number of bytes already stored
+func (fs *S3Fs) getUploadSessionInfo(name string) (os.FileInfo, bool) {
+	if !fs.hasResumableUploads() {
+		return nil, false
+	}
+	session, ok, err := fs.getUploadSession(name)
+	if err != nil || !ok {
+		return nil, false
+	}
+	return NewFileInfo(name, false, session.UploadedBytes, util.GetTimeFromMsecSinceEpoch(session.LastSeenAt), false), true
+}
+
+// createResumable starts or resumes a multipart upload tracked inside the
+// upload sessions store. An upload is resumed if the O_TRUNC flag is not set
+// and an upload session exists for the specified object
+func (fs *S3Fs) createResumable(name string, flag int) (File, *PipeWriter, func(), error) {
+	session, hasSession, err := fs.getUploadSession(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	isResume := flag&os.O_TRUNC == 0
+	if hasSession && !isResume {
+		// a new upload replaces the interrupted one
+		if err := fs.AbortUploadSession(&session); err != nil {
+			return nil, nil, nil, err
+		}
+		hasSession = false
+	}
+	// the owner identifies this upload while claiming the session
+	owner := xid.New().String()
+	if hasSession {
+		if err := lockUploadSession(session.ID, owner); err != nil {
+			return nil, nil, nil, err
+		}
+		if err := fs.checkUploadSessionParts(&session, name); err != nil {
+			fsLog(fs, logger.LevelWarn, "unable to resume upload session %q for path %q: %v", session.ID, name, err)
+			if errAbort := fs.abortUploadSession(&session, owner); errAbort != nil {
+				fsLog(fs, logger.LevelError, "unable to abort upload session %q: %v", session.ID, errAbort)
+			}
+			return nil, nil, nil, err
+		}
+	} else {
+		if isResume {
+			// appending to an existing object is not supported
+			if _, err := fs.headObject(name); err == nil {
+				return nil, nil, nil, ErrVfsUnsupported
+			} else if !fs.IsNotExist(err) {
+				return nil, nil, nil, err
+			}
+		}
+		session, err = fs.createUploadSession(name, owner)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		fs.releaseUploadSession(session.ID, owner)
+		return nil, nil, nil, err
+	}
+	p := NewPipeWriterAtOffset(w, session.UploadedBytes)
+	ctx, cancelFn := context.WithCancel(context.Background())
+
+	go func() {
+		defer cancelFn()
+
+		stopLeaseRenewal := fs.startUploadSessionLeaseRenewal(session.ID, owner)
+		err := fs.uploadSessionParts(ctx, name, &session, owner, r)
+		stopLeaseRenewal()
+		// the session must be released before signaling the end of the upload
+		// so it can be resumed as soon as Close returns
+		fs.releaseUploadSession(session.ID, owner)
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "resumable upload completed, path: %q, upload session: %q, readed bytes: %d, "+
+			"uploaded bytes: %d, err: %+v", name, session.ID, r.GetReadedBytes(), session.UploadedBytes, err)
+		metric.S3TransferCompleted(r.GetReadedBytes(), 0, err)
+		if err == nil {
+			fs.startReplication(name)
+		}
+	}()
+	return nil, p, cancelFn, nil
+}
+
+func (fs *S3Fs) createUploadSession(name, owner string) (UploadSession, error) {
+	var session UploadSession
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	res, err := fs.svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(fs.config.Bucket),
+		Key:                  aws.String(name),
+		ACL:                  types.ObjectCannedACL(fs.config.ACL),
+		StorageClass:         types.StorageClass(fs.config.StorageClass),
+		ServerSideEncryption: types.ServerSideEncryption(fs.config.SSEAlgorithm),
+		ContentType:          util.NilIfEmpty(mime.TypeByExtension(path.Ext(name))),
+	})
+	if err != nil {
+		return session, fmt.Errorf("unable to create multipart upload: %w", err)
+	}
+	now := util.GetTimeAsMsSinceEpoch(time.Now())
+	session = UploadSession{
+		ID:           xid.New().String(),
+		Username:     fs.config.username,
+		Path:         fs.GetRelativePath(name),
+		StartedAt:    now,
+		LastSeenAt:   now,
+		BackendToken: util.GetStringFromPointer(res.UploadId),
+	}
+	if err := uploadSessionStore.AddUploadSession(&session, owner, getUploadSessionLeaseExpiration()); err != nil {
+		if errAbort := fs.abortMultipartUpload(name, session.BackendToken); errAbort != nil {
+			fsLog(fs, logger.LevelError, "unable to abort multipart upload for path %q: %v", name, errAbort)
+		}
+		return session, fmt.Errorf("unable to save upload session: %w", err)
+	}
+	fsLog(fs, logger.LevelDebug, "upload session %q created for path %q", session.ID, name)
+	return session, nil
+}
+
+// checkUploadSessionParts compares the parts recorded for the session with the
+// ones stored inside the bucket, the upload can be resumed only if they match
+func (fs *S3Fs) checkUploadSessionParts(session *UploadSession, name string) error {
+	stored := make(map[int32]types.Part)
+	var partNumberMarker *string
+
+	for {
+		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+		res, err := fs.svc.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           aws.String(fs.config.Bucket),
+			Key:              aws.String(name),
+			UploadId:         aws.String(session.BackendToken),
+			PartNumberMarker: partNumberMarker,
+		})
+		cancelFn()
+		if err != nil {
+			return fmt.Errorf("unable to list the uploaded parts: %w", err)
+		}
+		for _, part := range res.Parts {
+			stored[part.PartNumber] = part
+		}
+		if !res.IsTruncated {
+			break
+		}
+		partNumberMarker = res.NextPartNumberMarker
+	}
+	for _, part := range session.Parts {
+		storedPart, ok := stored[part.Number]
+		if !ok {
+			return fmt.Errorf("part %d not found", part.Number)
+		}
+		if util.GetStringFromPointer(storedPart.ETag) != part.ETag || storedPart.Size != part.Size {
+			return fmt.Errorf("part %d does not match, ETag %q size %d, expected ETag %q size %d", part.Number,
+				util.GetStringFromPointer(storedPart.ETag), storedPart.Size, part.ETag, part.Size)
+		}
+	}
+	return nil
+}
+
+// uploadSessionParts reads the data to upload and stores them as parts of the
+// session's multipart upload. The multipart upload is completed when all the
+// data are read. If the upload is interrupted the session is kept, the data
+// not yet stored as a full part will be sent again when the upload is resumed
+func (fs *S3Fs) uploadSessionParts(ctx context.Context, name string, session *UploadSession, owner string,
+	r io.Reader,
+) error {
+	buf := make([]byte, fs.config.UploadPartSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == nil {
+			if errUpload := fs.uploadSessionPart(ctx, name, session, owner, buf[:n]); errUpload != nil {
+				return errUpload
+			}
+			continue
+		}
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		if ctx.Err() != nil {
+			// the upload was aborted, keep the session so it can be resumed
+			return ctx.Err()
+		}
+		if n > 0 || len(session.Parts) == 0 {
+			if errUpload := fs.uploadSessionPart(ctx, name, session, owner, buf[:n]); errUpload != nil {
+				return errUpload
+			}
+		}
+		return fs.completeUploadSession(ctx, name, session)
+	}
+}
+
+func (fs *S3Fs) uploadSessionPart(ctx context.Context, name string, session *UploadSession, owner string,
+	data []byte,
+) error {
+	partNumber := session.GetNextPartNumber()
+	res, err := fs.svc.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(fs.config.Bucket),
+		Key:        aws.String(name),
+		UploadId:   aws.String(session.BackendToken),
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to upload part %d: %w", partNumber, err)
+	}
+	session.AddPart(UploadSessionPart{
+		Number: partNumber,
+		ETag:   util.GetStringFromPointer(res.ETag),
+		Size:   int64(len(data)),
+	})
+	session.LastSeenAt = util.GetTimeAsMsSinceEpoch(time.Now())
+	// the update fails if the lease was lost, the session is now used by another upload
+	if err := uploadSessionStore.UpdateUploadSession(session, owner); err != nil {
+		return fmt.Errorf("unable to update upload session: %w", err)
+	}
+	return nil
+}
+
+func (fs *S3Fs) completeUploadSession(ctx context.Context, name string, session *UploadSession) error {
+	parts := make([]types.CompletedPart, 0, len(session.Parts))
+	for _, part := range session.Parts {
+		parts = append(parts, types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: part.Number,
+		})
+	}
+	_, err := fs.svc.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(fs.config.Bucket),
+		Key:      aws.String(name),
+		UploadId: aws.String(session.BackendToken),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: parts,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to complete multipart upload: %w", err)
+	}
+	if err := uploadSessionStore.DeleteUploadSession(session.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fsLog(fs, logger.LevelError, "unable to delete completed upload session %q: %v", session.ID, err)
+	}
+	return nil
+}
+
+func (fs *S3Fs) abortMultipartUpload(name, uploadID string) error {
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	_, err := fs.svc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(fs.config.Bucket),
+		Key:      aws.String(name),
+		UploadId: aws.String(uploadID),
+	})
+	var noSuchUpload *types.NoSuchUpload
+	if err != nil && (errors.As(err, &noSuchUpload) || fs.IsNotExist(err)) {
+		// already completed, aborted or expired
+		return nil
+	}
+	return err
+}
+
+// AbortUploadSession aborts the multipart upload for the specified session
+// and removes the session from the store. Sessions claimed by an upload in
+// progress, inside this or another instance, are not aborted
+func (fs *S3Fs) AbortUploadSession(session *UploadSession) error {
+	if uploadSessionStore == nil {
+		return ErrVfsUnsupported
+	}
+	return fs.abortUploadSession(session, xid.New().String())
+}
+
+func (fs *S3Fs) abortUploadSession(session *UploadSession, owner string) error {
+	if err := lockUploadSession(session.ID, owner); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// already completed or aborted
+			return nil
+		}
+		return err
+	}
+	name, err := fs.ResolvePath(session.Path)
+	if err != nil {
+		fs.releaseUploadSession(session.ID, owner)
+		return err
+	}
+	if err := fs.abortMultipartUpload(name, session.BackendToken); err != nil {
+		fs.releaseUploadSession(session.ID, owner)
+		return fmt.Errorf("unable to abort multipart upload: %w", err)
+	}
+	fsLog(fs, logger.LevelDebug, "upload session %q aborted for path %q", session.ID, name)
+	if err := uploadSessionStore.DeleteUploadSession(session.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (fs *S3Fs) releaseUploadSession(id, owner string) {
+	if err := unlockUploadSession(id, owner); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fsLog(fs, logger.LevelWarn, "unable to release upload session %q: %v", id, err)
+	}
+}
+
+// startUploadSessionLeaseRenewal periodically renews the lease for the
+// specified session. The returned function stops the renewal and waits for
+// it to exit, so the lease cannot be renewed after being released
+func (fs *S3Fs) startUploadSessionLeaseRenewal(id, owner string) func() {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(uploadSessionLeaseInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := lockUploadSession(id, owner); err != nil {
+					fsLog(fs, logger.LevelWarn, "unable to renew the lease for upload session %q: %v", id, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancelFn()
+		<-done
+	}
+}
@@ -0,0 +1,558 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sftpgo/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/v2/pkg/kms"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	testS3Bucket   = "bucket"
+	testS3Username = "s3user"
+)
+
+type testS3Part struct {
+	etag string
+	data []byte
+}
+
+// testS3Server is a minimal path style S3 server that supports the requests
+// used for resumable uploads and replication. The objects are stored using
+// "bucket/key" as map key
+type testS3Server struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int32]testS3Part
+	uploadID int
+}
+
+func newTestS3Server() *testS3Server {
+	return &testS3Server{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int32]testS3Part),
+	}
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	objectKey := bucket + "/" + key
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		writeTestS3XML(w, struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string   `xml:"Name"`
+			KeyCount    int      `xml:"KeyCount"`
+			IsTruncated bool     `xml:"IsTruncated"`
+		}{Name: bucket})
+	case r.Method == http.MethodHead:
+		data, ok := s.objects[objectKey]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.uploadID++
+		id := fmt.Sprintf("upload%d", s.uploadID)
+		s.uploads[id] = make(map[int32]testS3Part)
+		writeTestS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && uploadID != "":
+		parts, ok := s.uploads[uploadID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var partNumber int32
+		fmt.Sscanf(query.Get("partNumber"), "%d", &partNumber) //nolint:errcheck
+		etag := fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(data)))
+		parts[partNumber] = testS3Part{etag: etag, data: data}
+		w.Header().Set("ETag", etag)
+	case r.Method == http.MethodGet && uploadID != "":
+		parts, ok := s.uploads[uploadID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		type part struct {
+			PartNumber int32  `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+			Size       int    `xml:"Size"`
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListPartsResult"`
+			Bucket      string   `xml:"Bucket"`
+			Key         string   `xml:"Key"`
+			UploadID    string   `xml:"UploadId"`
+			IsTruncated bool     `xml:"IsTruncated"`
+			Parts       []part   `xml:"Part"`
+		}{Bucket: bucket, Key: key, UploadID: uploadID}
+		for _, n := range getTestS3PartNumbers(parts) {
+			result.Parts = append(result.Parts, part{PartNumber: n, ETag: parts[n].etag, Size: len(parts[n].data)})
+		}
+		writeTestS3XML(w, result)
+	case r.Method == http.MethodPost && uploadID != "":
+		parts, ok := s.uploads[uploadID]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var data []byte
+		for _, n := range getTestS3PartNumbers(parts) {
+			data = append(data, parts[n].data...)
+		}
+		s.objects[objectKey] = data
+		delete(s.uploads, uploadID)
+		writeTestS3XML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string   `xml:"Bucket"`
+			Key     string   `xml:"Key"`
+			ETag    string   `xml:"ETag"`
+		}{Bucket: bucket, Key: key, ETag: `"etag"`})
+	case r.Method == http.MethodDelete && uploadID != "":
+		if _, ok := s.uploads[uploadID]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		source, err := url.PathUnescape(r.Header.Get("x-amz-copy-source"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, ok := s.objects[strings.TrimPrefix(source, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.objects[objectKey] = data
+		writeTestS3XML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string   `xml:"ETag"`
+			LastModified string   `xml:"LastModified"`
+		}{ETag: `"etag"`, LastModified: time.Now().UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodDelete:
+		delete(s.objects, objectKey)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (s *testS3Server) getObject(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[bucket+"/"+key]
+	return data, ok
+}
+
+func (s *testS3Server) setObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[bucket+"/"+key] = data
+}
+
+func (s *testS3Server) hasUpload(uploadID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.uploads[uploadID]
+	return ok
+}
+
+// setPartETag simulates a part replaced after the session was saved
+func (s *testS3Server) setPartETag(uploadID string, partNumber int32, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	part := s.uploads[uploadID][partNumber]
+	part.etag = etag
+	s.uploads[uploadID][partNumber] = part
+}
+
+func getTestS3PartNumbers(parts map[int32]testS3Part) []int32 {
+	numbers := make([]int32, 0, len(parts))
+	for n := range parts {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+func writeTestS3XML(w http.ResponseWriter, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data) //nolint:errcheck
+}
+
+type testUploadSessionLease struct {
+	owner     string
+	expiresAt int64
+}
+
+// testUploadSessionStore is an in memory UploadSessionStore
+type testUploadSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]UploadSession
+	leases   map[string]testUploadSessionLease
+}
+
+func newTestUploadSessionStore() *testUploadSessionStore {
+	return &testUploadSessionStore{
+		sessions: make(map[string]UploadSession),
+		leases:   make(map[string]testUploadSessionLease),
+	}
+}
+
+func (s *testUploadSessionStore) AddUploadSession(session *UploadSession, owner string, leaseExpiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("upload session %q already exists", session.ID)
+	}
+	s.sessions[session.ID] = getTestUploadSessionCopy(session)
+	s.leases[session.ID] = testUploadSessionLease{owner: owner, expiresAt: leaseExpiresAt}
+	return nil
+}
+
+func (s *testUploadSessionStore) UpdateUploadSession(session *UploadSession, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; !ok || s.leases[session.ID].owner != owner {
+		return fmt.Errorf("%w: %q", os.ErrNotExist, session.ID)
+	}
+	s.sessions[session.ID] = getTestUploadSessionCopy(session)
+	return nil
+}
+
+func (s *testUploadSessionStore) ClaimUploadSession(id, owner string, leaseExpiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return fmt.Errorf("%w: %q", os.ErrNotExist, id)
+	}
+	lease := s.leases[id]
+	if lease.owner != owner && lease.expiresAt >= util.GetTimeAsMsSinceEpoch(time.Now()) {
+		return ErrUploadSessionInUse
+	}
+	s.leases[id] = testUploadSessionLease{owner: owner, expiresAt: leaseExpiresAt}
+	return nil
+}
+
+func (s *testUploadSessionStore) ReleaseUploadSession(id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return fmt.Errorf("%w: %q", os.ErrNotExist, id)
+	}
+	if s.leases[id].owner == owner {
+		delete(s.leases, id)
+	}
+	return nil
+}
+
+func (s *testUploadSessionStore) isClaimed(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.leases[id]
+	return ok && lease.expiresAt >= util.GetTimeAsMsSinceEpoch(time.Now())
+}
+
+func (s *testUploadSessionStore) GetUploadSession(username, virtualPath string) (UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.Username == username && session.Path == virtualPath {
+			return getTestUploadSessionCopy(&session), nil
+		}
+	}
+	return UploadSession{}, fmt.Errorf("%w: %q", os.ErrNotExist, virtualPath)
+}
+
+func (s *testUploadSessionStore) DeleteUploadSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return fmt.Errorf("%w: %q", os.ErrNotExist, id)
+	}
+	delete(s.sessions, id)
+	delete(s.leases, id)
+	return nil
+}
+
+func (s *testUploadSessionStore) get(virtualPath string) (UploadSession, bool) {
+	session, err := s.GetUploadSession(testS3Username, virtualPath)
+	return session, err == nil
+}
+
+func getTestUploadSessionCopy(session *UploadSession) UploadSession {
+	c := *session
+	c.Parts = append([]UploadSessionPart(nil), session.Parts...)
+	return c
+}
+
+func getTestS3FsConfig(endpoint string) S3FsConfig {
+	return S3FsConfig{
+		BaseS3FsConfig: sdk.BaseS3FsConfig{
+			Bucket:         testS3Bucket,
+			Region:         "us-east-1",
+			AccessKey:      "access key",
+			Endpoint:       endpoint,
+			ForcePathStyle: true,
+			UploadPartSize: 5,
+		},
+		AccessSecret: kms.NewPlainSecret("access secret"),
+	}
+}
+
+func newTestS3Fs(t *testing.T, config S3FsConfig) *S3Fs {
+	config.SetUsername(testS3Username)
+	fs, err := newS3Fs("", t.TempDir(), "", config)
+	require.NoError(t, err)
+	return fs
+}
+
+// interruptTestUpload uploads a full part and some more data and then
+// interrupts the upload
+func interruptTestUpload(t *testing.T, fs *S3Fs, store *testUploadSessionStore, name string, data []byte) {
+	partSize := fs.config.UploadPartSize
+	_, w, cancelFn, err := fs.Create(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0)
+	require.NoError(t, err)
+	_, err = w.Write(data[:partSize+100])
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		session, ok := store.get(fs.GetRelativePath(name))
+		return ok && len(session.Parts) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	session, ok := store.get(fs.GetRelativePath(name))
+	require.True(t, ok)
+	assert.True(t, store.isClaimed(session.ID))
+	cancelFn()
+	assert.Error(t, w.Close())
+	assert.False(t, store.isClaimed(session.ID))
+}
+
+func getTestUploadData(t *testing.T, size int64) []byte {
+	data := make([]byte, size)
+	_, err := io.ReadFull(rand.Reader, data)
+	require.NoError(t, err)
+	return data
+}
+
+func TestS3ResumeUpload(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestUploadSessionStore()
+	SetUploadSessionStore(store)
+	defer SetUploadSessionStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.ResumableUploads = true
+	fs := newTestS3Fs(t, config)
+	name := "file.dat"
+	data := getTestUploadData(t, fs.config.UploadPartSize+1024)
+	interruptTestUpload(t, fs, store, name, data)
+	// only the data stored as full parts are reported
+	info, err := fs.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, fs.config.UploadPartSize, info.Size())
+	assert.False(t, info.IsDir())
+	// appending to a partial upload is only allowed starting from the stored size
+	_, w, _, err := fs.Create(name, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = w.WriteAt(data[:10], 0)
+	assert.Error(t, err)
+	_, err = w.WriteAt(data[info.Size():], info.Size())
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	stored, ok := server.getObject(testS3Bucket, name)
+	require.True(t, ok)
+	assert.True(t, bytes.Equal(data, stored))
+	_, ok = store.get(fs.GetRelativePath(name))
+	assert.False(t, ok)
+	info, err = fs.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size())
+	// appending to an existing object is not supported
+	_, _, _, err = fs.Create(name, os.O_WRONLY, 0)
+	assert.ErrorIs(t, err, ErrVfsUnsupported)
+}
+
+func TestS3ResumeUploadETagMismatch(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestUploadSessionStore()
+	SetUploadSessionStore(store)
+	defer SetUploadSessionStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.ResumableUploads = true
+	fs := newTestS3Fs(t, config)
+	name := "file.dat"
+	data := getTestUploadData(t, fs.config.UploadPartSize+1024)
+	interruptTestUpload(t, fs, store, name, data)
+	session, ok := store.get(fs.GetRelativePath(name))
+	require.True(t, ok)
+	require.Len(t, session.Parts, 1)
+	server.setPartETag(session.BackendToken, 1, `"modified"`)
+	// the upload cannot be resumed and the session is aborted
+	_, _, _, err := fs.Create(name, os.O_WRONLY, 0)
+	assert.ErrorContains(t, err, "does not match")
+	_, ok = store.get(fs.GetRelativePath(name))
+	assert.False(t, ok)
+	assert.False(t, server.hasUpload(session.BackendToken))
+	assert.False(t, store.isClaimed(session.ID))
+	_, err = fs.Stat(name)
+	assert.True(t, fs.IsNotExist(err))
+}
+
+func TestS3UploadSessionClaimedByAnotherOwner(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestUploadSessionStore()
+	SetUploadSessionStore(store)
+	defer SetUploadSessionStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.ResumableUploads = true
+	fs := newTestS3Fs(t, config)
+	name := "file.dat"
+	data := getTestUploadData(t, fs.config.UploadPartSize+1024)
+	interruptTestUpload(t, fs, store, name, data)
+	session, ok := store.get(fs.GetRelativePath(name))
+	require.True(t, ok)
+	// the session is claimed by another instance
+	otherOwner := "other_owner"
+	err := store.ClaimUploadSession(session.ID, otherOwner, util.GetTimeAsMsSinceEpoch(time.Now().Add(time.Minute)))
+	require.NoError(t, err)
+	_, _, _, err = fs.Create(name, os.O_WRONLY, 0)
+	assert.ErrorIs(t, err, ErrUploadSessionInUse)
+	_, _, _, err = fs.Create(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0)
+	assert.ErrorIs(t, err, ErrUploadSessionInUse)
+	err = fs.AbortUploadSession(&session)
+	assert.ErrorIs(t, err, ErrUploadSessionInUse)
+	assert.True(t, server.hasUpload(session.BackendToken))
+	// the lease was lost, the parts cannot be recorded anymore
+	err = store.UpdateUploadSession(&session, "")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	// an expired lease can be claimed
+	err = store.ClaimUploadSession(session.ID, otherOwner, util.GetTimeAsMsSinceEpoch(time.Now().Add(-time.Second)))
+	require.NoError(t, err)
+	_, w, _, err := fs.Create(name, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = w.WriteAt(data[fs.config.UploadPartSize:], fs.config.UploadPartSize)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	stored, ok := server.getObject(testS3Bucket, name)
+	require.True(t, ok)
+	assert.True(t, bytes.Equal(data, stored))
+	// the session is completed
+	err = store.ClaimUploadSession(session.ID, otherOwner, util.GetTimeAsMsSinceEpoch(time.Now().Add(time.Minute)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoError(t, fs.AbortUploadSession(&session))
+}
+
+func TestS3StatWithUploadSession(t *testing.T) {
+	server := newTestS3Server()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := newTestUploadSessionStore()
+	SetUploadSessionStore(store)
+	defer SetUploadSessionStore(nil)
+
+	config := getTestS3FsConfig(ts.URL)
+	config.ResumableUploads = true
+	fs := newTestS3Fs(t, config)
+	name := "file.dat"
+	session := UploadSession{
+		ID:            "id",
+		Username:      testS3Username,
+		Path:          fs.GetRelativePath(name),
+		UploadedBytes: 100,
+		BackendToken:  "token",
+	}
+	require.NoError(t, store.AddUploadSession(&session, "", 0))
+	info, err := fs.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), info.Size())
+	// the stored object takes precedence over a stale upload session
+	server.setObject(testS3Bucket, name, []byte("content"))
+	info, err = fs.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size())
+}
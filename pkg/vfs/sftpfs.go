@@ -17,6 +17,7 @@ package vfs
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"hash/fnv"
@@ -62,10 +63,17 @@ var (
 // SFTPFsConfig defines the configuration for SFTP based filesystem
 type SFTPFsConfig struct {
 	sdk.BaseSFTPFsConfig
-	Password               *kms.Secret `json:"password,omitempty"`
-	PrivateKey             *kms.Secret `json:"private_key,omitempty"`
-	KeyPassphrase          *kms.Secret `json:"key_passphrase,omitempty"`
-	forbiddenSelfUsernames []string    `json:"-"`
+	Password      *kms.Secret `json:"password,omitempty"`
+	PrivateKey    *kms.Secret `json:"private_key,omitempty"`
+	KeyPassphrase *kms.Secret `json:"key_passphrase,omitempty"`
+	// If enabled and the user logged in using OpenID Connect, the access
+	// token is used as password to authenticate to the SFTP server
+	UseOIDCToken bool `json:"use_oidc_token,omitempty"`
+	// Local IP address, and optional port, to bind to before connecting to the
+	// SFTP server. Leave empty to let the OS choose the source address
+	LocalAddress           string          `json:"local_address,omitempty"`
+	forbiddenSelfUsernames []string        `json:"-"`
+	oidcTokenSource        OIDCTokenSource `json:"-"`
 }
 
 // HideConfidentialData hides confidential data
@@ -109,6 +117,12 @@ func (c *SFTPFsConfig) isEqual(other SFTPFsConfig) bool {
 	if c.BufferSize != other.BufferSize {
 		return false
 	}
+	if c.UseOIDCToken != other.UseOIDCToken {
+		return false
+	}
+	if c.LocalAddress != other.LocalAddress {
+		return false
+	}
 	if len(c.Fingerprints) != len(other.Fingerprints) {
 		return false
 	}
@@ -171,6 +185,9 @@ func (c *SFTPFsConfig) validate() error {
 	if !isEqualityCheckModeValid(c.EqualityCheckMode) {
 		return errors.New("invalid equality_check_mode")
 	}
+	if err := c.validateLocalAddress(); err != nil {
+		return err
+	}
 	if err := c.validateCredentials(); err != nil {
 		return err
 	}
@@ -182,8 +199,36 @@ func (c *SFTPFsConfig) validate() error {
 	return nil
 }
 
+func (c *SFTPFsConfig) validateLocalAddress() error {
+	c.LocalAddress = strings.TrimSpace(c.LocalAddress)
+	if c.LocalAddress == "" {
+		return nil
+	}
+	if _, err := getSFTPLocalTCPAddr(c.LocalAddress); err != nil {
+		return fmt.Errorf("invalid local_address: %v", err)
+	}
+	return nil
+}
+
+// getSFTPLocalTCPAddr parses an IP address, with or without a port, as TCP address
+func getSFTPLocalTCPAddr(address string) (*net.TCPAddr, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// no port specified
+		host = address
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		port = "0"
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("%q is not an IP address", address)
+	}
+	return net.ResolveTCPAddr("tcp", net.JoinHostPort(host, port))
+}
+
 func (c *SFTPFsConfig) validateCredentials() error {
-	if c.Password.IsEmpty() && c.PrivateKey.IsEmpty() {
+	if c.Password.IsEmpty() && c.PrivateKey.IsEmpty() && !c.UseOIDCToken {
 		return errors.New("credentials cannot be empty")
 	}
 	if c.Password.IsEncrypted() && !c.Password.IsValid() {
@@ -246,6 +291,7 @@ func (c *SFTPFsConfig) getUniqueID(partition int) uint64 {
 	b.WriteString(c.Password.GetPayload())
 	b.WriteString(c.PrivateKey.GetPayload())
 	b.WriteString(c.KeyPassphrase.GetPayload())
+	b.WriteString(c.LocalAddress)
 	if allowSelfConnections != 0 {
 		b.WriteString(strings.Join(c.forbiddenSelfUsernames, ""))
 	}
@@ -292,6 +338,13 @@ func NewSFTPFs(connectionID, mountPath, localTempDir string, forbiddenSelfUserna
 			return nil, err
 		}
 	}
+	if config.UseOIDCToken {
+		token, err := getOIDCAccessToken(config.oidcTokenSource)
+		if err != nil {
+			return nil, err
+		}
+		config.Password = kms.NewPlainSecret(token)
+	}
 	config.forbiddenSelfUsernames = forbiddenSelfUsernames
 	sftpFs := &SFTPFs{
 		connectionID: connectionID,
@@ -326,6 +379,12 @@ func (fs *SFTPFs) Stat(name string) (os.FileInfo, error) {
 	return client.Stat(name)
 }
 
+// BatchStat returns the file info for the specified paths, the requests
+// are pipelined over the same SFTP connection
+func (fs *SFTPFs) BatchStat(names []string) ([]os.FileInfo, error) {
+	return batchStat(fs, names, batchStatConcurrency)
+}
+
 // Lstat returns a FileInfo describing the named file
 func (fs *SFTPFs) Lstat(name string) (os.FileInfo, error) {
 	client, err := fs.conn.getClient()
@@ -598,6 +657,37 @@ func (*SFTPFs) CheckMetadata() error {
 	return nil
 }
 
+// ValidatePath returns an error if the given name contains characters
+// not allowed by the SFTP protocol
+func (*SFTPFs) ValidatePath(name string) error {
+	return validateFileName(name, isNullByte)
+}
+
+// CheckHealth verifies that the connection to the SFTP server can be
+// established and the root directory is accessible
+func (fs *SFTPFs) CheckHealth(_ context.Context) error {
+	client, err := fs.conn.getClient()
+	if err != nil {
+		return err
+	}
+	root := fs.config.Prefix
+	if root == "" {
+		root = "/"
+	}
+	_, err = client.Stat(root)
+	return err
+}
+
+// SetMetadata is not supported for SFTPFs
+func (*SFTPFs) SetMetadata(_ string, _ map[string]string) error {
+	return ErrVfsUnsupported
+}
+
+// GetMetadata is not supported for SFTPFs
+func (*SFTPFs) GetMetadata(_ string) (map[string]string, error) {
+	return nil, ErrVfsUnsupported
+}
+
 // GetAtomicUploadPath returns the path to use for an atomic upload
 func (*SFTPFs) GetAtomicUploadPath(name string) string {
 	dir := path.Dir(name)
@@ -975,7 +1065,7 @@ func (c *sftpConnection) openConnNoLock() error {
 	clientConfig.MACs = []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256",
 		"hmac-sha2-512-etm@openssh.com", "hmac-sha2-512",
 		"hmac-sha1", "hmac-sha1-96"}
-	sshClient, err := ssh.Dial("tcp", c.config.Endpoint, clientConfig)
+	sshClient, err := c.dial(clientConfig)
 	if err != nil {
 		return fmt.Errorf("sftpfs: unable to connect: %w", err)
 	}
@@ -991,6 +1081,30 @@ func (c *sftpConnection) openConnNoLock() error {
 	return nil
 }
 
+func (c *sftpConnection) dial(clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	if c.config.LocalAddress == "" {
+		return ssh.Dial("tcp", c.config.Endpoint, clientConfig)
+	}
+	localAddr, err := getSFTPLocalTCPAddr(c.config.LocalAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local address %q: %w", c.config.LocalAddress, err)
+	}
+	dialer := net.Dialer{
+		LocalAddr: localAddr,
+		Timeout:   clientConfig.Timeout,
+	}
+	conn, err := dialer.Dial("tcp", c.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.config.Endpoint, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
 func (c *sftpConnection) getClientOptions() []sftp.ClientOption {
 	var options []sftp.ClientOption
 	if c.config.DisableCouncurrentReads {
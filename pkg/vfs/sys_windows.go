@@ -16,6 +16,7 @@ package vfs
 
 import (
 	"errors"
+	"os"
 
 	"golang.org/x/sys/windows"
 )
@@ -30,3 +31,19 @@ func isInvalidNameError(err error) bool {
 	}
 	return errors.Is(err, windows.ERROR_INVALID_NAME)
 }
+
+func isLinkCountSupported() bool {
+	return false
+}
+
+func getLinkCount(_ os.FileInfo) uint64 {
+	return 1
+}
+
+func getFileID(_ os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func getSharedFileID(_ os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
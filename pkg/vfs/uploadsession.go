@@ -0,0 +1,121 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package vfs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	// an upload session is claimed for this time, the lease is renewed while
+	// the upload is in progress and released when it ends
+	uploadSessionLease         = 2 * time.Minute
+	uploadSessionLeaseInterval = 30 * time.Second
+)
+
+var (
+	uploadSessionStore UploadSessionStore
+	// ErrUploadSessionInUse is returned if an upload session is resumed while
+	// another upload for the same session is still in progress
+	ErrUploadSessionInUse = errors.New("the upload session is already in use")
+)
+
+// UploadSessionPart defines a part already uploaded for a resumable upload
+type UploadSessionPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// UploadSession tracks a resumable multipart upload to a cloud storage backend.
+// Interrupted uploads can be resumed, from the end of the last uploaded part,
+// until the session is completed, aborted or removed as stale
+type UploadSession struct {
+	// Unique identifier for the session
+	ID string `json:"upload_id"`
+	// SFTPGo username
+	Username string `json:"username"`
+	// Virtual path of the file being uploaded
+	Path string `json:"path"`
+	// Creation time as unix timestamp in milliseconds
+	StartedAt int64 `json:"started_at"`
+	// Last update as unix timestamp in milliseconds
+	LastSeenAt int64 `json:"last_seen_at"`
+	// Bytes stored within the backend, a resumed upload restarts from here
+	UploadedBytes int64 `json:"uploaded_bytes"`
+	// Expected file size, 0 means unknown
+	TotalBytes int64 `json:"total_bytes"`
+	// Backend specific identifier, for S3 the multipart upload ID
+	BackendToken string `json:"backend_token"`
+	// Parts uploaded so far, their ETags are checked before resuming
+	Parts []UploadSessionPart `json:"parts,omitempty"`
+}
+
+// GetNextPartNumber returns the number for the next part to upload
+func (s *UploadSession) GetNextPartNumber() int32 {
+	return int32(len(s.Parts)) + 1
+}
+
+// AddPart records an uploaded part
+func (s *UploadSession) AddPart(part UploadSessionPart) {
+	s.Parts = append(s.Parts, part)
+	s.UploadedBytes += part.Size
+}
+
+// UploadSessionStore defines the interface to persist the resumable upload sessions.
+// Missing sessions must be reported using an error wrapping os.ErrNotExist.
+// A session is claimed by an owner, until the lease expires, before using it.
+// The store is shared among the SFTPGo instances so the claim must be atomic
+type UploadSessionStore interface {
+	// AddUploadSession adds a new session claimed by the specified owner
+	AddUploadSession(session *UploadSession, owner string, leaseExpiresAt int64) error
+	// UpdateUploadSession updates a session, the specified owner must hold the lease
+	UpdateUploadSession(session *UploadSession, owner string) error
+	GetUploadSession(username, virtualPath string) (UploadSession, error)
+	DeleteUploadSession(id string) error
+	// ClaimUploadSession acquires, or renews, the lease for the specified owner.
+	// It returns ErrUploadSessionInUse if a different owner holds an unexpired lease
+	ClaimUploadSession(id, owner string, leaseExpiresAt int64) error
+	// ReleaseUploadSession releases the lease if held by the specified owner
+	ReleaseUploadSession(id, owner string) error
+}
+
+// FsUploadSessionAborter is a Fs that can abort resumable upload sessions
+type FsUploadSessionAborter interface {
+	Fs
+	// AbortUploadSession releases the backend resources for the specified session
+	AbortUploadSession(session *UploadSession) error
+}
+
+// SetUploadSessionStore sets the store for the resumable upload sessions
+func SetUploadSessionStore(store UploadSessionStore) {
+	uploadSessionStore = store
+}
+
+func getUploadSessionLeaseExpiration() int64 {
+	return util.GetTimeAsMsSinceEpoch(time.Now().Add(uploadSessionLease))
+}
+
+// lockUploadSession claims the session with the specified id for the given owner
+func lockUploadSession(id, owner string) error {
+	return uploadSessionStore.ClaimUploadSession(id, owner, getUploadSessionLeaseExpiration())
+}
+
+func unlockUploadSession(id, owner string) error {
+	return uploadSessionStore.ReleaseUploadSession(id, owner)
+}
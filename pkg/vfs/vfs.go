@@ -16,6 +16,7 @@
 package vfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -25,7 +26,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/eikenb/pipeat"
 	"github.com/pkg/sftp"
@@ -43,6 +47,10 @@ const (
 	s3fsName     = "S3Fs"
 	gcsfsName    = "GCSFs"
 	azBlobFsName = "AzureBlobFs"
+	// maximum number of parallel stat calls for remote backends
+	batchStatConcurrency = 10
+	// maximum number of directory levels to pre-fetch for S3
+	maxS3PrefetchDepth = 5
 )
 
 // Additional checks for files
@@ -50,17 +58,49 @@ const (
 	CheckParentDir = 1
 )
 
+// Limits for the user defined metadata
+const (
+	// MaxMetadataSize is the maximum allowed size, in bytes, for all the
+	// metadata keys and values of a file or directory
+	MaxMetadataSize = 2048
+	// MaxMetadataKeyLength is the maximum allowed length for a metadata key
+	MaxMetadataKeyLength = 64
+)
+
 var (
-	validAzAccessTier = []string{"", "Archive", "Hot", "Cool"}
+	validAzAccessTier     = []string{"", "Archive", "Hot", "Cool"}
+	validS3StorageClasses = []string{"", "STANDARD", "INTELLIGENT_TIERING", "STANDARD_IA", "ONEZONE_IA", "GLACIER",
+		"GLACIER_IR", "DEEP_ARCHIVE", "REDUCED_REDUNDANCY"}
+	validS3SSEAlgorithms   = []string{"", "AES256", "aws:kms"}
+	validS3ObjectLockModes = []string{"GOVERNANCE", "COMPLIANCE"}
 	// ErrStorageSizeUnavailable is returned if the storage backend does not support getting the size
 	ErrStorageSizeUnavailable = errors.New("unable to get available size for this storage backend")
 	// ErrVfsUnsupported defines the error for an unsupported VFS operation
-	ErrVfsUnsupported    = errors.New("not supported")
-	tempPath             string
-	sftpFingerprints     []string
-	allowSelfConnections int
+	ErrVfsUnsupported = errors.New("not supported")
+	// ErrInvalidFileName defines the error for a file name with characters not allowed by the storage backend
+	ErrInvalidFileName = errors.New("invalid file name")
+	// ErrObjectLocked defines the error for an object that cannot be modified or removed
+	// because it is protected by a retention period or a legal hold
+	ErrObjectLocked = errors.New("object is locked")
+	// ErrOIDCTokenUnavailable is returned if a filesystem is configured to use the OpenID Connect
+	// access token as credential and the connection was not established using OpenID Connect
+	ErrOIDCTokenUnavailable = errors.New("OpenID Connect access token not available")
+	tempPath                string
+	sftpFingerprints        []string
+	allowSelfConnections    int
 )
 
+// OIDCTokenSource returns the access token for the OpenID Connect session the
+// connection was established with. The token is refreshed, if expired, before returning it
+type OIDCTokenSource func() (string, error)
+
+func getOIDCAccessToken(source OIDCTokenSource) (string, error) {
+	if source == nil {
+		return "", ErrOIDCTokenUnavailable
+	}
+	return source()
+}
+
 // SetAllowSelfConnections sets the desired behaviour for self connections
 func SetAllowSelfConnections(value int) {
 	allowSelfConnections = value
@@ -86,6 +126,9 @@ type Fs interface {
 	Name() string
 	ConnectionID() string
 	Stat(name string) (os.FileInfo, error)
+	// BatchStat returns the file info for the specified paths, the results have
+	// the same order as the paths. Missing paths have a nil entry
+	BatchStat(names []string) ([]os.FileInfo, error)
 	Lstat(name string) (os.FileInfo, error)
 	Open(name string, offset int64) (File, *pipeat.PipeReaderAt, func(), error)
 	Create(name string, flag, checks int) (File, *PipeWriter, func(), error)
@@ -116,6 +159,17 @@ type Fs interface {
 	GetMimeType(name string) (string, error)
 	GetAvailableDiskSize(dirName string) (*sftp.StatVFS, error)
 	CheckMetadata() error
+	// ValidatePath returns ErrInvalidFileName if the given name contains
+	// characters not allowed by the storage backend
+	ValidatePath(name string) error
+	// CheckHealth performs a lightweight check to verify that the storage
+	// backend is reachable and the configured credentials are valid
+	CheckHealth(ctx context.Context) error
+	// SetMetadata replaces the user defined metadata for the specified path,
+	// an empty map removes them
+	SetMetadata(name string, metadata map[string]string) error
+	// GetMetadata returns the user defined metadata for the specified path
+	GetMetadata(name string) (map[string]string, error)
 	Close() error
 }
 
@@ -125,6 +179,53 @@ type FsRealPather interface {
 	RealPath(p string) (string, error)
 }
 
+// FsHardLinker is a Fs that implements the Link method.
+type FsHardLinker interface {
+	Fs
+	Link(source, target string) error
+}
+
+// FsFileCopier is a Fs that implements the CopyFile method to copy a file
+// without transferring its contents to the client.
+type FsFileCopier interface {
+	Fs
+	CopyFile(source, target string, srcInfo os.FileInfo) error
+}
+
+// FsDeduplicator is a Fs that implements the DeduplicateFile and IsContentShared methods.
+type FsDeduplicator interface {
+	Fs
+	DeduplicateFile(name string) (bool, error)
+	IsContentShared(name string) bool
+}
+
+// FsDiskUsageScanner is a Fs that can compute the real disk usage for its root
+// directory, resolving symbolic links and counting hard linked files once
+type FsDiskUsageScanner interface {
+	Fs
+	ScanRootDirDiskUsage() (int, int64, error)
+}
+
+// FsDirEntriesCounter is a Fs that can count the entries of a directory without
+// loading their details. The count stops once limit is reached, if limit is
+// greater than 0, so the returned value is never greater than limit
+type FsDirEntriesCounter interface {
+	Fs
+	CountDirEntries(dirname string, limit int) (int, error)
+}
+
+// FsRangeReader is a Fs that can read a byte range of a file
+type FsRangeReader interface {
+	Fs
+	OpenRange(name string, offset, length int64) (io.ReadCloser, error)
+}
+
+// FsObjectLocker is a Fs that can protect objects from being modified or removed
+type FsObjectLocker interface {
+	Fs
+	HasLockedObjects(dirName string) (bool, error)
+}
+
 // fsMetadataChecker is a Fs that implements the getFileNamesInPrefix method.
 // This interface is used to abstract metadata consistency checks
 type fsMetadataChecker interface {
@@ -176,6 +277,41 @@ func (q *QuotaCheckResult) GetRemainingFiles() int {
 type S3FsConfig struct {
 	sdk.BaseS3FsConfig
 	AccessSecret *kms.Secret `json:"access_secret,omitempty"`
+	// Server-side encryption algorithm to use for uploaded objects: "AES256" or "aws:kms".
+	// Leave empty to use the bucket default
+	SSEAlgorithm string `json:"sse_algorithm,omitempty"`
+	// Apply an object lock to the uploaded objects. The bucket must have
+	// object lock enabled
+	ObjectLockEnabled bool `json:"object_lock_enabled,omitempty"`
+	// Object lock retention mode: "GOVERNANCE" or "COMPLIANCE"
+	ObjectLockMode string `json:"object_lock_mode,omitempty"`
+	// Uploaded objects are locked for the specified number of days
+	RetentionDays int `json:"object_lock_retention_days,omitempty"`
+	// Store the files using the SHA-256 of their contents as object key.
+	// The paths are stored inside the data provider and identical contents
+	// are stored only once
+	ContentAddressed bool `json:"content_addressed,omitempty"`
+	// Track the multipart uploads inside the data provider so interrupted
+	// uploads can be resumed
+	ResumableUploads bool `json:"resumable_uploads,omitempty"`
+	// Pre-fetch, in background, the directory listings when a connection
+	// is established. The listings are stored in the directory listings cache
+	PrefetchEnabled bool `json:"prefetch_enabled,omitempty"`
+	// Number of directory levels to pre-fetch, starting from the root
+	PrefetchDepth int `json:"prefetch_depth,omitempty"`
+	// Replicate the uploaded objects to a bucket in a different region
+	Replication S3ReplicationConfig `json:"replication,omitempty"`
+	// Use the S3 Transfer Acceleration endpoint, {bucket}.s3-accelerate.amazonaws.com.
+	// The bucket must have transfer acceleration enabled
+	TransferAcceleration bool `json:"transfer_acceleration,omitempty"`
+	// username owning the upload sessions and the replicated objects
+	username string `json:"-"`
+}
+
+// SetUsername sets the SFTPGo username owning the resumable upload sessions
+// and the replicated objects
+func (c *S3FsConfig) SetUsername(username string) {
+	c.username = username
 }
 
 // HideConfidentialData hides confidential data
@@ -183,6 +319,9 @@ func (c *S3FsConfig) HideConfidentialData() {
 	if c.AccessSecret != nil {
 		c.AccessSecret.Hide()
 	}
+	if c.Replication.DestinationCredentials.AccessSecret != nil {
+		c.Replication.DestinationCredentials.AccessSecret.Hide()
+	}
 }
 
 func (c *S3FsConfig) isEqual(other S3FsConfig) bool {
@@ -210,6 +349,30 @@ func (c *S3FsConfig) isEqual(other S3FsConfig) bool {
 	if c.ACL != other.ACL {
 		return false
 	}
+	if c.SSEAlgorithm != other.SSEAlgorithm {
+		return false
+	}
+	if c.ObjectLockEnabled != other.ObjectLockEnabled || c.ObjectLockMode != other.ObjectLockMode {
+		return false
+	}
+	if c.RetentionDays != other.RetentionDays {
+		return false
+	}
+	if c.ContentAddressed != other.ContentAddressed {
+		return false
+	}
+	if c.ResumableUploads != other.ResumableUploads {
+		return false
+	}
+	if c.PrefetchEnabled != other.PrefetchEnabled || c.PrefetchDepth != other.PrefetchDepth {
+		return false
+	}
+	if !c.Replication.isEqual(other.Replication) {
+		return false
+	}
+	if c.TransferAcceleration != other.TransferAcceleration {
+		return false
+	}
 	if !c.areMultipartFieldsEqual(other) {
 		return false
 	}
@@ -280,6 +443,14 @@ func (c *S3FsConfig) ValidateAndEncryptCredentials(additionalData string) error
 			return util.NewValidationError(fmt.Sprintf("could not encrypt s3 access secret: %v", err))
 		}
 	}
+	replicationSecret := c.Replication.DestinationCredentials.AccessSecret
+	if replicationSecret.IsPlain() {
+		replicationSecret.SetAdditionalData(additionalData)
+		err := replicationSecret.Encrypt()
+		if err != nil {
+			return util.NewValidationError(fmt.Sprintf("could not encrypt s3 replication access secret: %v", err))
+		}
+	}
 	return nil
 }
 
@@ -334,15 +505,228 @@ func (c *S3FsConfig) validate() error {
 			c.KeyPrefix += "/"
 		}
 	}
-	c.StorageClass = strings.TrimSpace(c.StorageClass)
+	if err := c.validateStorageClassAndSSE(); err != nil {
+		return err
+	}
 	c.ACL = strings.TrimSpace(c.ACL)
+	if err := c.validateObjectLock(); err != nil {
+		return err
+	}
+	if c.ResumableUploads && (c.ContentAddressed || c.ObjectLockEnabled) {
+		return errors.New("resumable uploads are not supported in content addressed mode or with object lock")
+	}
+	if err := c.validatePrefetch(); err != nil {
+		return err
+	}
+	if err := c.validateTransferAcceleration(); err != nil {
+		return err
+	}
+	if err := c.validateReplication(); err != nil {
+		return err
+	}
 	return c.checkPartSizeAndConcurrency()
 }
 
+// validateStorageClassAndSSE validates the storage class and the server-side
+// encryption algorithm and converts them to the case expected by AWS S3.
+// S3 compatible object storages, configured using a custom endpoint, may
+// support different values so they are used as is
+func (c *S3FsConfig) validateStorageClassAndSSE() error {
+	c.StorageClass = strings.TrimSpace(c.StorageClass)
+	c.SSEAlgorithm = strings.TrimSpace(c.SSEAlgorithm)
+	if c.Endpoint != "" {
+		return nil
+	}
+	c.StorageClass = strings.ToUpper(c.StorageClass)
+	if !util.Contains(validS3StorageClasses, c.StorageClass) {
+		return fmt.Errorf("invalid storage class %#v, valid values: \"''%v\"", c.StorageClass,
+			strings.Join(validS3StorageClasses, ", "))
+	}
+	for _, algo := range validS3SSEAlgorithms {
+		if strings.EqualFold(algo, c.SSEAlgorithm) {
+			c.SSEAlgorithm = algo
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid server-side encryption algorithm %#v, valid values: \"''%v\"", c.SSEAlgorithm,
+		strings.Join(validS3SSEAlgorithms, ", "))
+}
+
+func (c *S3FsConfig) validateReplication() error {
+	if err := c.Replication.validate(); err != nil {
+		return err
+	}
+	if !c.Replication.IsEnabled() {
+		return nil
+	}
+	if c.ContentAddressed {
+		// the object keys are the content hashes and not the file paths
+		return errors.New("replication is not supported in content addressed mode")
+	}
+	if c.Replication.DestinationBucket == c.Bucket && c.Replication.DestinationRegion == c.Region {
+		return errors.New("the replication destination must be different from the source bucket")
+	}
+	return nil
+}
+
+func (c *S3FsConfig) validateTransferAcceleration() error {
+	if !c.TransferAcceleration {
+		return nil
+	}
+	if c.Endpoint != "" {
+		return errors.New("transfer acceleration is only supported for AWS S3, the endpoint must be empty")
+	}
+	// the accelerate endpoint is a bucket subdomain
+	if c.ForcePathStyle {
+		return errors.New("transfer acceleration requires virtual-hosted-style addressing, path-style is not supported")
+	}
+	if strings.Contains(c.Bucket, ".") {
+		return errors.New("transfer acceleration is not supported for bucket names containing periods")
+	}
+	return nil
+}
+
+// isTransferAccelerationRegion returns false for the regions where S3 Transfer
+// Acceleration is not available
+func (c *S3FsConfig) isTransferAccelerationRegion() bool {
+	for _, prefix := range []string{"cn-", "us-gov-", "us-iso"} {
+		if strings.HasPrefix(c.Region, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *S3FsConfig) validatePrefetch() error {
+	if !c.PrefetchEnabled {
+		c.PrefetchDepth = 0
+		return nil
+	}
+	if c.PrefetchDepth == 0 {
+		c.PrefetchDepth = 1
+	}
+	if c.PrefetchDepth < 0 || c.PrefetchDepth > maxS3PrefetchDepth {
+		return fmt.Errorf("invalid prefetch depth %d, it must be between 1 and %d", c.PrefetchDepth,
+			maxS3PrefetchDepth)
+	}
+	return nil
+}
+
+func (c *S3FsConfig) validateObjectLock() error {
+	if !c.ObjectLockEnabled {
+		c.ObjectLockMode = ""
+		c.RetentionDays = 0
+		return nil
+	}
+	if c.ContentAddressed {
+		// the stored contents are shared and the unreferenced ones must be removable
+		return errors.New("object lock is not supported in content addressed mode")
+	}
+	c.ObjectLockMode = strings.ToUpper(strings.TrimSpace(c.ObjectLockMode))
+	if !util.Contains(validS3ObjectLockModes, c.ObjectLockMode) {
+		return fmt.Errorf("invalid object lock mode %q, valid values: %v", c.ObjectLockMode,
+			strings.Join(validS3ObjectLockModes, ", "))
+	}
+	if c.RetentionDays <= 0 {
+		return fmt.Errorf("invalid object lock retention days: %d", c.RetentionDays)
+	}
+	return nil
+}
+
+// S3ReplicationCredentials defines the credentials for the replica bucket
+type S3ReplicationCredentials struct {
+	AccessKey    string      `json:"access_key,omitempty"`
+	AccessSecret *kms.Secret `json:"access_secret,omitempty"`
+}
+
+// S3ReplicationConfig defines the replication of the uploaded objects to a
+// bucket in a different region. The objects are copied, asynchronously, after
+// each completed upload, copy or rename and the failed copies are retried in
+// background. The replicas for the removed objects are removed too.
+// This replication complements, and does not replace, the S3 native
+// cross-region replication
+type S3ReplicationConfig struct {
+	// Replica bucket, empty means disabled
+	DestinationBucket string `json:"destination_bucket,omitempty"`
+	// Region for the replica bucket
+	DestinationRegion string `json:"destination_region,omitempty"`
+	// Credentials for the replica bucket, they must allow to read the source
+	// objects. If empty the credentials for the source bucket are used
+	DestinationCredentials S3ReplicationCredentials `json:"destination_credentials,omitempty"`
+}
+
+// IsEnabled returns true if the replication is enabled
+func (c *S3ReplicationConfig) IsEnabled() bool {
+	return c.DestinationBucket != ""
+}
+
+func (c *S3ReplicationConfig) isEqual(other S3ReplicationConfig) bool {
+	if c.DestinationBucket != other.DestinationBucket || c.DestinationRegion != other.DestinationRegion {
+		return false
+	}
+	if c.DestinationCredentials.AccessKey != other.DestinationCredentials.AccessKey {
+		return false
+	}
+	if c.DestinationCredentials.AccessSecret == nil {
+		c.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
+	}
+	if other.DestinationCredentials.AccessSecret == nil {
+		other.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
+	}
+	return c.DestinationCredentials.AccessSecret.IsEqual(other.DestinationCredentials.AccessSecret)
+}
+
+func (c *S3ReplicationConfig) validate() error {
+	c.DestinationBucket = strings.TrimSpace(c.DestinationBucket)
+	if c.DestinationBucket == "" {
+		*c = S3ReplicationConfig{}
+		c.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
+		return nil
+	}
+	if c.DestinationCredentials.AccessSecret == nil {
+		c.DestinationCredentials.AccessSecret = kms.NewEmptySecret()
+	}
+	c.DestinationRegion = strings.TrimSpace(c.DestinationRegion)
+	if c.DestinationRegion == "" {
+		return errors.New("the replication destination region cannot be empty")
+	}
+	accessKey := c.DestinationCredentials.AccessKey
+	accessSecret := c.DestinationCredentials.AccessSecret
+	if accessKey == "" && !accessSecret.IsEmpty() {
+		return errors.New("replication access_key cannot be empty with access_secret not empty")
+	}
+	if accessSecret.IsEmpty() && accessKey != "" {
+		return errors.New("replication access_secret cannot be empty with access_key not empty")
+	}
+	if accessSecret.IsEncrypted() && !accessSecret.IsValid() {
+		return errors.New("invalid encrypted replication access_secret")
+	}
+	if !accessSecret.IsEmpty() && !accessSecret.IsValidInput() {
+		return errors.New("invalid replication access_secret")
+	}
+	return nil
+}
+
 // GCSFsConfig defines the configuration for Google Cloud Storage based filesystem
 type GCSFsConfig struct {
 	sdk.BaseGCSFsConfig
 	Credentials *kms.Secret `json:"credentials,omitempty"`
+	// Pub/Sub topic ID to notify about completed uploads. Leave empty to disable
+	PubSubTopic string `json:"pubsub_topic,omitempty"`
+	// Google Cloud project ID for the Pub/Sub topic. If empty the project
+	// is detected from the configured credentials
+	PubSubProjectID string `json:"pubsub_project_id,omitempty"`
+	// Store the files using the SHA-256 of their contents as object key.
+	// The paths are stored inside the data provider and identical contents
+	// are stored only once
+	ContentAddressed bool `json:"content_addressed,omitempty"`
+	// username to include in Pub/Sub notifications
+	username string `json:"-"`
+}
+
+// SetUsername sets the SFTPGo username to include in Pub/Sub notifications
+func (c *GCSFsConfig) SetUsername(username string) {
+	c.username = username
 }
 
 // HideConfidentialData hides confidential data
@@ -383,6 +767,15 @@ func (c *GCSFsConfig) isEqual(other GCSFsConfig) bool {
 	if c.ACL != other.ACL {
 		return false
 	}
+	if c.PubSubTopic != other.PubSubTopic {
+		return false
+	}
+	if c.PubSubProjectID != other.PubSubProjectID {
+		return false
+	}
+	if c.ContentAddressed != other.ContentAddressed {
+		return false
+	}
 	if c.Credentials == nil {
 		c.Credentials = kms.NewEmptySecret()
 	}
@@ -421,6 +814,25 @@ func (c *GCSFsConfig) validate() error {
 	}
 	c.StorageClass = strings.TrimSpace(c.StorageClass)
 	c.ACL = strings.TrimSpace(c.ACL)
+	return c.validatePubSub()
+}
+
+func (c *GCSFsConfig) validatePubSub() error {
+	c.PubSubTopic = strings.TrimSpace(c.PubSubTopic)
+	c.PubSubProjectID = strings.TrimSpace(c.PubSubProjectID)
+	if c.PubSubTopic == "" {
+		c.PubSubProjectID = ""
+		return nil
+	}
+	if c.ContentAddressed {
+		return errors.New("pubsub notifications are not supported in content addressed mode")
+	}
+	if strings.Contains(c.PubSubTopic, "/") {
+		return errors.New("pubsub_topic must be a topic ID, not a path")
+	}
+	if strings.Contains(c.PubSubProjectID, "/") {
+		return errors.New("pubsub_project_id must be a project ID, not a path")
+	}
 	return nil
 }
 
@@ -432,6 +844,10 @@ type AzBlobFsConfig struct {
 	AccountKey *kms.Secret `json:"account_key,omitempty"`
 	// Shared access signature URL, leave blank if using account/key
 	SASURL *kms.Secret `json:"sas_url,omitempty"`
+	// Store the files using the SHA-256 of their contents as object key.
+	// The paths are stored inside the data provider and identical contents
+	// are stored only once
+	ContentAddressed bool `json:"content_addressed,omitempty"`
 }
 
 // HideConfidentialData hides confidential data
@@ -484,6 +900,9 @@ func (c *AzBlobFsConfig) isEqual(other AzBlobFsConfig) bool {
 	if c.AccessTier != other.AccessTier {
 		return false
 	}
+	if c.ContentAddressed != other.ContentAddressed {
+		return false
+	}
 	return c.isSecretEqual(other)
 }
 
@@ -606,6 +1025,26 @@ func (c *AzBlobFsConfig) validate() error {
 	return nil
 }
 
+// OsFsConfig defines the configuration for the local filesystem
+type OsFsConfig struct {
+	// If enabled, uploaded files with the same content are replaced with
+	// hard links to a single copy stored in the content store, a hidden
+	// directory inside the filesystem root
+	DeduplicationEnabled bool `json:"deduplication_enabled,omitempty"`
+}
+
+func (c *OsFsConfig) isEqual(other OsFsConfig) bool {
+	return c.DeduplicationEnabled == other.DeduplicationEnabled
+}
+
+// Validate returns an error if the configuration is not valid
+func (c *OsFsConfig) Validate() error {
+	if c.DeduplicationEnabled && !isLinkCountSupported() {
+		return util.NewValidationError("deduplication is not supported on this platform")
+	}
+	return nil
+}
+
 // CryptFsConfig defines the configuration to store local files as encrypted
 type CryptFsConfig struct {
 	Passphrase *kms.Secret `json:"passphrase,omitempty"`
@@ -660,11 +1099,31 @@ func (c *CryptFsConfig) validate() error {
 	return nil
 }
 
+// sectionReadCloser reads a section of a file and closes the file
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cancelReadCloser cancels the associated context after closing the reader
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancelFn func()
+}
+
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancelFn()
+	return err
+}
+
 // PipeWriter defines a wrapper for pipeat.PipeWriterAt.
 type PipeWriter struct {
 	writer *pipeat.PipeWriterAt
 	err    error
 	done   chan bool
+	// offset of the first byte written to the pipe, not zero for resumed uploads
+	offset int64
 }
 
 // NewPipeWriter initializes a new PipeWriter
@@ -676,6 +1135,14 @@ func NewPipeWriter(w *pipeat.PipeWriterAt) *PipeWriter {
 	}
 }
 
+// NewPipeWriterAtOffset initializes a new PipeWriter for a resumed upload.
+// The pipe starts at the specified file offset
+func NewPipeWriterAtOffset(w *pipeat.PipeWriterAt, offset int64) *PipeWriter {
+	p := NewPipeWriter(w)
+	p.offset = offset
+	return p
+}
+
 // Close waits for the upload to end, closes the pipeat.PipeWriterAt and returns an error if any.
 func (p *PipeWriter) Close() error {
 	p.writer.Close() //nolint:errcheck // the returned error is always null
@@ -692,7 +1159,10 @@ func (p *PipeWriter) Done(err error) {
 
 // WriteAt is a wrapper for pipeat WriteAt
 func (p *PipeWriter) WriteAt(data []byte, off int64) (int, error) {
-	return p.writer.WriteAt(data, off)
+	if off < p.offset {
+		return 0, fmt.Errorf("invalid write offset %d, the upload resumes from offset %d", off, p.offset)
+	}
+	return p.writer.WriteAt(data, off-p.offset)
 }
 
 // Write is a wrapper for pipeat Write
@@ -713,6 +1183,111 @@ func isDirectory(fs Fs, path string) (bool, error) {
 	return fileInfo.IsDir(), err
 }
 
+// validateFileName returns ErrInvalidFileName if name is not a valid
+// UTF-8 string or if it contains a rune for which isDisallowed returns true
+func validateFileName(name string, isDisallowed func(r rune) bool) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: %q is not a valid UTF-8 string", ErrInvalidFileName, name)
+	}
+	for _, r := range name {
+		if isDisallowed(r) {
+			return fmt.Errorf("%w: %q contains the disallowed character %U", ErrInvalidFileName, name, r)
+		}
+	}
+	return nil
+}
+
+func isNullByte(r rune) bool {
+	return r == 0
+}
+
+// ValidateMetadata returns a validation error if the given user defined
+// metadata cannot be stored on all the supported storage backends.
+// Keys must start with a lowercase letter or an underscore and contain only
+// lowercase letters, digits and underscores, values must be non-empty
+// printable ASCII strings
+func ValidateMetadata(metadata map[string]string) error {
+	size := 0
+	for k, v := range metadata {
+		if !isValidMetadataKey(k) {
+			return util.NewValidationError(fmt.Sprintf("invalid metadata key %q", k))
+		}
+		if v == "" {
+			return util.NewValidationError(fmt.Sprintf("empty value for metadata key %q", k))
+		}
+		for i := 0; i < len(v); i++ {
+			if v[i] < 32 || v[i] > 126 {
+				return util.NewValidationError(fmt.Sprintf("invalid value for metadata key %q, only printable ASCII "+
+					"characters are allowed", k))
+			}
+		}
+		size += len(k) + len(v)
+	}
+	if size > MaxMetadataSize {
+		return util.NewValidationError(fmt.Sprintf("metadata size %d exceeds the limit of %d bytes", size,
+			MaxMetadataSize))
+	}
+	return nil
+}
+
+func isValidMetadataKey(key string) bool {
+	if key == "" || len(key) > MaxMetadataKeyLength {
+		return false
+	}
+	for idx, r := range key {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && idx > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// getUserMetadata returns the valid user defined metadata from the given
+// object metadata, the keys are converted to lowercase
+func getUserMetadata(metadata map[string]string, excludedKeys ...string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range metadata {
+		k = strings.ToLower(k)
+		if !isValidMetadataKey(k) || util.Contains(excludedKeys, k) {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// StripControlChars removes control characters and invalid UTF-8 bytes from the given name
+func StripControlChars(name string) string {
+	var result strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		if !unicode.IsControl(r) && (r != utf8.RuneError || size > 1) {
+			result.WriteRune(r)
+		}
+		name = name[size:]
+	}
+	return result.String()
+}
+
+// ReplaceDisallowedChars replaces control characters, invalid UTF-8 bytes
+// and the characters not allowed by the given Fs with "_"
+func ReplaceDisallowedChars(fs Fs, name string) string {
+	var result strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		if unicode.IsControl(r) || (r == utf8.RuneError && size == 1) || fs.ValidatePath(string(r)) != nil {
+			result.WriteRune('_')
+		} else {
+			result.WriteRune(r)
+		}
+		name = name[size:]
+	}
+	return result.String()
+}
+
 // IsLocalOsFs returns true if fs is a local filesystem implementation
 func IsLocalOsFs(fs Fs) bool {
 	return fs.Name() == osFsName
@@ -757,6 +1332,37 @@ func IsLocalOrSFTPFs(fs Fs) bool {
 	return IsLocalOsFs(fs) || IsSFTPFs(fs)
 }
 
+// ScanDiskUsage returns the number of files and the real disk usage for the root
+// directory of the specified filesystem. The filesystems that don't implement
+// FsDiskUsageScanner, for example the Cloud based ones, list all their objects
+func ScanDiskUsage(fs Fs) (int, int64, error) {
+	if scanner, ok := fs.(FsDiskUsageScanner); ok {
+		return scanner.ScanRootDirDiskUsage()
+	}
+	return fs.ScanRootDirContents()
+}
+
+// CountDirEntries returns the number of entries in the specified directory, up
+// to limit if it is greater than 0. The filesystems that don't implement
+// FsDirEntriesCounter list the whole directory
+func CountDirEntries(fs Fs, dirname string, limit int) (int, error) {
+	if counter, ok := fs.(FsDirEntriesCounter); ok {
+		return counter.CountDirEntries(dirname, limit)
+	}
+	list, err := fs.ReadDir(dirname)
+	if err != nil {
+		return 0, err
+	}
+	return capDirEntriesCount(len(list), limit), nil
+}
+
+func capDirEntriesCount(count, limit int) int {
+	if limit > 0 && count > limit {
+		return limit
+	}
+	return count
+}
+
 // HasTruncateSupport returns true if the fs supports truncate files
 func HasTruncateSupport(fs Fs) bool {
 	return IsLocalOsFs(fs) || IsSFTPFs(fs) || IsHTTPFs(fs)
@@ -788,6 +1394,16 @@ func HasOpenRWSupport(fs Fs) bool {
 	return false
 }
 
+// GetQuotaSize returns the size to use in quota accounting when the named file,
+// with the specified size, is removed or overwritten. A file sharing its content
+// with other files does not use additional disk space
+func GetQuotaSize(fs Fs, name string, size int64) int64 {
+	if deduplicator, ok := fs.(FsDeduplicator); ok && deduplicator.IsContentShared(name) {
+		return 0
+	}
+	return size
+}
+
 // IsLocalOrCryptoFs returns true if fs is local or local encrypted
 func IsLocalOrCryptoFs(fs Fs) bool {
 	return IsLocalOsFs(fs) || IsCryptOsFs(fs)
@@ -912,6 +1528,80 @@ func getMountPath(mountPath string) string {
 	return mountPath
 }
 
+// batchStat executes Stat for the specified paths using at most concurrency
+// parallel calls. Missing paths have a nil entry in the results
+func batchStat(fs Fs, names []string, concurrency int) ([]os.FileInfo, error) {
+	results := make([]os.FileInfo, len(names))
+	if concurrency <= 1 {
+		for idx, name := range names {
+			info, err := fs.Stat(name)
+			if err != nil {
+				if fs.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			results[idx] = info
+		}
+		return results, nil
+	}
+
+	guard := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var statError error
+
+	for idx, name := range names {
+		guard <- struct{}{}
+		wg.Add(1)
+		go func(idx int, name string) {
+			defer func() {
+				<-guard
+				wg.Done()
+			}()
+
+			info, err := fs.Stat(name)
+			if err != nil {
+				if !fs.IsNotExist(err) {
+					errOnce.Do(func() {
+						statError = fmt.Errorf("unable to stat %q: %w", name, err)
+					})
+				}
+				return
+			}
+			results[idx] = info
+		}(idx, name)
+	}
+
+	wg.Wait()
+	close(guard)
+
+	if statError != nil {
+		return nil, statError
+	}
+	return results, nil
+}
+
 func fsLog(fs Fs, level logger.LogLevel, format string, v ...any) {
 	logger.Log(level, fs.Name(), fs.ConnectionID(), format, v...)
 }
+
+// CheckFsHealth runs the health check for the given filesystem.
+// An error is returned if the check does not complete within the specified timeout
+func CheckFsHealth(fs Fs, timeout time.Duration) error {
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+
+	errCh := make(chan error, 1)
+	// some backends cannot be interrupted, we don't wait for them after the timeout
+	go func() {
+		errCh <- fs.CheckHealth(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("the health check did not complete within %v", timeout)
+	}
+}
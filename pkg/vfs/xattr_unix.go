@@ -0,0 +1,130 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+//go:build linux || darwin || freebsd || netbsd
+// +build linux darwin freebsd netbsd
+
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// user defined metadata are stored as extended attributes with this prefix
+const xattrMetadataPrefix = "user.sftpgo."
+
+func getXattrMetadata(name string) (map[string]string, error) {
+	attrs, err := listXattrs(name)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	for _, attr := range attrs {
+		key := strings.TrimPrefix(attr, xattrMetadataPrefix)
+		if key == attr || !isValidMetadataKey(key) {
+			continue
+		}
+		value, err := getXattr(name, attr)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func setXattrMetadata(name string, metadata map[string]string) error {
+	current, err := getXattrMetadata(name)
+	if err != nil {
+		return err
+	}
+	for k, v := range metadata {
+		if current[k] == v {
+			continue
+		}
+		if err := unix.Setxattr(name, xattrMetadataPrefix+k, []byte(v), 0); err != nil {
+			return convertXattrError("setxattr", name, err)
+		}
+	}
+	for k := range current {
+		if _, ok := metadata[k]; ok {
+			continue
+		}
+		if err := unix.Removexattr(name, xattrMetadataPrefix+k); err != nil {
+			return convertXattrError("removexattr", name, err)
+		}
+	}
+	return nil
+}
+
+func listXattrs(name string) ([]string, error) {
+	for {
+		size, err := unix.Listxattr(name, nil)
+		if err != nil {
+			return nil, convertXattrError("listxattr", name, err)
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		size, err = unix.Listxattr(name, buf)
+		if err != nil {
+			if errors.Is(err, unix.ERANGE) {
+				// the attributes list changed, try again
+				continue
+			}
+			return nil, convertXattrError("listxattr", name, err)
+		}
+		var attrs []string
+		for _, attr := range bytes.Split(buf[:size], []byte{0}) {
+			if len(attr) > 0 {
+				attrs = append(attrs, string(attr))
+			}
+		}
+		return attrs, nil
+	}
+}
+
+func getXattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := unix.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, convertXattrError("getxattr", name, err)
+		}
+		buf := make([]byte, size)
+		if size == 0 {
+			return buf, nil
+		}
+		size, err = unix.Getxattr(name, attr, buf)
+		if err != nil {
+			if errors.Is(err, unix.ERANGE) {
+				continue
+			}
+			return nil, convertXattrError("getxattr", name, err)
+		}
+		return buf[:size], nil
+	}
+}
+
+func convertXattrError(op, name string, err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return ErrVfsUnsupported
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
@@ -15,6 +15,7 @@
 package webdavd
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"errors"
@@ -36,6 +37,10 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
+// metadataPropNamespace is the XML namespace for the properties mapped to the
+// user defined metadata
+const metadataPropNamespace = "urn:sftpgo:metadata"
+
 var (
 	errTransferAborted = errors.New("transfer aborted")
 	lastModifiedProps  = []string{"Win32LastModifiedTime", "getlastmodified"}
@@ -105,12 +110,18 @@ func (fi *webDavFileInfo) ContentType(ctx context.Context) (string, error) {
 
 // Readdir reads directory entries from the handle
 func (f *webDavFile) Readdir(count int) ([]os.FileInfo, error) {
-	if !f.Connection.User.HasPerm(dataprovider.PermListItems, f.GetVirtualPath()) {
+	if !f.Connection.GetEffectiveUser().HasPerm(dataprovider.PermListItems, f.GetVirtualPath()) {
 		return nil, f.Connection.GetPermissionDeniedError()
 	}
-	entries, err := f.Connection.ListDir(f.GetVirtualPath())
-	if err != nil {
-		return nil, err
+	entries, ok := common.GetCachedDirListing(f.Connection.User.ID, f.GetVirtualPath())
+	if !ok {
+		var err error
+		entries, err = f.Connection.ListDir(f.GetVirtualPath())
+		if err != nil {
+			return nil, err
+		}
+		f.Connection.SortDirListing(entries)
+		common.CacheDirListing(&f.Connection.User, f.GetVirtualPath(), entries)
 	}
 	for idx, info := range entries {
 		entries[idx] = &webDavFileInfo{
@@ -125,7 +136,7 @@ func (f *webDavFile) Readdir(count int) ([]os.FileInfo, error) {
 
 // Stat the handle
 func (f *webDavFile) Stat() (os.FileInfo, error) {
-	if f.GetType() == common.TransferDownload && !f.Connection.User.HasPerm(dataprovider.PermListItems, path.Dir(f.GetVirtualPath())) {
+	if f.GetType() == common.TransferDownload && !f.Connection.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(f.GetVirtualPath())) {
 		return nil, f.Connection.GetPermissionDeniedError()
 	}
 	f.Lock()
@@ -157,7 +168,7 @@ func (f *webDavFile) Stat() (os.FileInfo, error) {
 }
 
 func (f *webDavFile) checkFirstRead() error {
-	if !f.Connection.User.HasPerm(dataprovider.PermDownload, path.Dir(f.GetVirtualPath())) {
+	if !f.Connection.GetEffectiveUser().HasPerm(dataprovider.PermDownload, path.Dir(f.GetVirtualPath())) {
 		return f.Connection.GetPermissionDeniedError()
 	}
 	transferQuota := f.BaseTransfer.GetTransferQuota()
@@ -420,51 +431,124 @@ func (f *webDavFile) isTransfer() bool {
 }
 
 // DeadProps returns a copy of the dead properties held.
-// We always return nil for now, we only support the last modification time
-// and it is already included in "live" properties
+// The user defined metadata are returned as properties in the
+// metadataPropNamespace, the last modification time is already included
+// in "live" properties
 func (f *webDavFile) DeadProps() (map[xml.Name]webdav.Property, error) {
-	return nil, nil
+	metadata, err := f.Connection.GetMetadata(f.GetVirtualPath())
+	if err != nil || len(metadata) == 0 {
+		return nil, nil
+	}
+	props := make(map[xml.Name]webdav.Property)
+	for k, v := range metadata {
+		var value bytes.Buffer
+		if err := xml.EscapeText(&value, []byte(v)); err != nil {
+			return nil, err
+		}
+		name := xml.Name{Space: metadataPropNamespace, Local: k}
+		props[name] = webdav.Property{
+			XMLName:  name,
+			InnerXML: value.Bytes(),
+		}
+	}
+	return props, nil
 }
 
 // Patch patches the dead properties held.
-// In our minimal implementation we just support Win32LastModifiedTime and
-// getlastmodified to set the the modification time.
+// We support Win32LastModifiedTime and getlastmodified to set the modification
+// time and the properties in the metadataPropNamespace to set or remove the
+// user defined metadata.
 // We ignore any other property and just return an OK response if the patch sets
-// the modification time, otherwise a Forbidden response
+// the modification time or the metadata, otherwise a Forbidden response
 func (f *webDavFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
 	resp := make([]webdav.Propstat, 0, len(patches))
 	hasError := false
+	var metadata map[string]string
+	var metadataPstats []int
 	for _, patch := range patches {
 		status := http.StatusForbidden
+		timesPatched := false
 		pstat := webdav.Propstat{}
 		for _, p := range patch.Props {
-			if status == http.StatusForbidden && !hasError {
-				if !patch.Remove && util.Contains(lastModifiedProps, p.XMLName.Local) {
-					parsed, err := http.ParseTime(string(p.InnerXML))
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+			if hasError {
+				continue
+			}
+			if p.XMLName.Space == metadataPropNamespace {
+				if metadata == nil {
+					md, err := f.Connection.GetMetadata(f.GetVirtualPath())
 					if err != nil {
-						f.Connection.Log(logger.LevelWarn, "unsupported last modification time: %q, err: %v",
-							string(p.InnerXML), err)
+						f.Connection.Log(logger.LevelWarn, "unable to get metadata for %q, err: %v", f.GetVirtualPath(), err)
 						hasError = true
 						continue
 					}
-					attrs := &common.StatAttributes{
-						Flags: common.StatAttrTimes,
-						Atime: parsed,
-						Mtime: parsed,
-					}
-					if err := f.Connection.SetStat(f.GetVirtualPath(), attrs); err != nil {
-						f.Connection.Log(logger.LevelWarn, "unable to set modification time for %q, err :%v",
-							f.GetVirtualPath(), err)
+					metadata = md
+				}
+				if patch.Remove {
+					delete(metadata, p.XMLName.Local)
+				} else {
+					value, err := getPropertyValue(p)
+					if err != nil {
+						f.Connection.Log(logger.LevelWarn, "unsupported value for metadata key %q: %q, err: %v",
+							p.XMLName.Local, string(p.InnerXML), err)
 						hasError = true
 						continue
 					}
-					status = http.StatusOK
+					metadata[p.XMLName.Local] = value
 				}
+				if status != http.StatusOK {
+					metadataPstats = append(metadataPstats, len(resp))
+				}
+				status = http.StatusOK
+				continue
+			}
+			if !timesPatched && !patch.Remove && util.Contains(lastModifiedProps, p.XMLName.Local) {
+				parsed, err := http.ParseTime(string(p.InnerXML))
+				if err != nil {
+					f.Connection.Log(logger.LevelWarn, "unsupported last modification time: %q, err: %v",
+						string(p.InnerXML), err)
+					hasError = true
+					continue
+				}
+				attrs := &common.StatAttributes{
+					Flags: common.StatAttrTimes,
+					Atime: parsed,
+					Mtime: parsed,
+				}
+				if err := f.Connection.SetStat(f.GetVirtualPath(), attrs); err != nil {
+					f.Connection.Log(logger.LevelWarn, "unable to set modification time for %q, err :%v",
+						f.GetVirtualPath(), err)
+					hasError = true
+					continue
+				}
+				timesPatched = true
+				status = http.StatusOK
 			}
-			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
 		}
 		pstat.Status = status
 		resp = append(resp, pstat)
 	}
+	if len(metadataPstats) > 0 && !hasError {
+		if err := f.Connection.SetMetadata(f.GetVirtualPath(), metadata); err != nil {
+			f.Connection.Log(logger.LevelWarn, "unable to set metadata for %q, err: %v", f.GetVirtualPath(), err)
+			hasError = true
+		}
+	}
+	if hasError {
+		for _, idx := range metadataPstats {
+			resp[idx].Status = http.StatusForbidden
+		}
+	}
 	return resp, nil
 }
+
+// getPropertyValue returns the text value for the given property
+func getPropertyValue(p webdav.Property) (string, error) {
+	var value string
+	data := make([]byte, 0, len(p.InnerXML)+7)
+	data = append(data, "<v>"...)
+	data = append(data, p.InnerXML...)
+	data = append(data, "</v>"...)
+	err := xml.Unmarshal(data, &value)
+	return value, err
+}
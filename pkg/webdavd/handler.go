@@ -57,6 +57,14 @@ func (c *Connection) GetRemoteAddress() string {
 	return ""
 }
 
+// getUploadSize returns the size of the uploaded content or -1 if it is unknown
+func (c *Connection) getUploadSize() int64 {
+	if c.request != nil {
+		return c.request.ContentLength
+	}
+	return -1
+}
+
 // Disconnect closes the active transfer
 func (c *Connection) Disconnect() error {
 	return c.SignalTransfersAbort()
@@ -70,6 +78,14 @@ func (c *Connection) GetCommand() string {
 	return ""
 }
 
+// getExpectedChecksum returns the SHA256 checksum, if any, provided by the client for an upload
+func (c *Connection) getExpectedChecksum() string {
+	if c.request != nil {
+		return c.request.Header.Get(common.ChecksumSHA256Header)
+	}
+	return ""
+}
+
 // Mkdir creates a directory using the connection filesystem
 func (c *Connection) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	c.UpdateLastActivity()
@@ -94,7 +110,7 @@ func (c *Connection) Stat(ctx context.Context, name string) (os.FileInfo, error)
 	c.UpdateLastActivity()
 
 	name = util.CleanPath(name)
-	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
@@ -120,12 +136,20 @@ func (c *Connection) OpenFile(ctx context.Context, name string, flag int, perm o
 	c.UpdateLastActivity()
 
 	name = util.CleanPath(name)
+	isWrite := flag != os.O_RDONLY && c.request.Method != "PROPPATCH"
+	if isWrite {
+		var err error
+		name, err = c.GetUploadTargetPath(name)
+		if err != nil {
+			return nil, err
+		}
+	}
 	fs, p, err := c.GetFsAndResolvedPath(name)
 	if err != nil {
 		return nil, err
 	}
 
-	if flag == os.O_RDONLY || c.request.Method == "PROPPATCH" {
+	if !isWrite {
 		// Download, Stat, Readdir or simply open/close
 		return c.getFile(fs, p, name)
 	}
@@ -149,13 +173,13 @@ func (c *Connection) putFile(fs vfs.Fs, fsPath, virtualPath string) (webdav.File
 	}
 
 	filePath := fsPath
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		filePath = fs.GetAtomicUploadPath(fsPath)
 	}
 
 	stat, statErr := fs.Lstat(fsPath)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || fs.IsNotExist(statErr) {
-		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(virtualPath)) {
+		if !c.GetEffectiveUser().HasPerm(dataprovider.PermUpload, path.Dir(virtualPath)) {
 			return nil, c.GetPermissionDeniedError()
 		}
 		return c.handleUploadToNewFile(fs, fsPath, filePath, virtualPath)
@@ -172,7 +196,7 @@ func (c *Connection) putFile(fs vfs.Fs, fsPath, virtualPath string) (webdav.File
 		return nil, c.GetOpUnsupportedError()
 	}
 
-	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(virtualPath)) {
+	if !c.GetEffectiveUser().HasPerm(dataprovider.PermOverwrite, path.Dir(virtualPath)) {
 		return nil, c.GetPermissionDeniedError()
 	}
 
@@ -189,19 +213,29 @@ func (c *Connection) handleUploadToNewFile(fs vfs.Fs, resolvedPath, filePath, re
 		c.Log(logger.LevelDebug, "upload for file %#v denied by pre action: %v", requestPath, err)
 		return nil, c.GetPermissionDeniedError()
 	}
+	// we can get an error only for resume
+	maxWriteSize, _ := c.GetMaxWriteSize(requestPath, diskQuota, false, 0, fs.IsUploadResumeSupported())
+	if err := c.CheckUploadSpace(fs, resolvedPath, c.getUploadSize(), maxWriteSize); err != nil {
+		return nil, err
+	}
+
+	quotaFileReserved, err := c.ReserveNewFile(requestPath)
+	if err != nil {
+		return nil, err
+	}
 	file, w, cancelFn, err := fs.Create(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.GetCreateChecks(requestPath, true))
 	if err != nil {
+		c.ReleaseNewFile(requestPath, quotaFileReserved)
 		c.Log(logger.LevelError, "error creating file %#v: %+v", resolvedPath, err)
 		return nil, c.GetFsError(fs, err)
 	}
 
 	vfs.SetPathPermissions(fs, filePath, c.User.GetUID(), c.User.GetGID())
 
-	// we can get an error only for resume
-	maxWriteSize, _ := c.GetMaxWriteSize(diskQuota, false, 0, fs.IsUploadResumeSupported())
-
 	baseTransfer := common.NewBaseTransfer(file, c.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, 0, maxWriteSize, 0, true, fs, transferQuota)
+	baseTransfer.SetQuotaFileReserved(quotaFileReserved)
+	baseTransfer.SetExpectedChecksum(c.getExpectedChecksum())
 
 	return newWebDavFile(baseTransfer, w, nil), nil
 }
@@ -223,9 +257,12 @@ func (c *Connection) handleUploadToExistingFile(fs vfs.Fs, resolvedPath, filePat
 
 	// if there is a size limit remaining size cannot be 0 here, since quotaResult.HasSpace
 	// will return false in this case and we deny the upload before
-	maxWriteSize, _ := c.GetMaxWriteSize(diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	maxWriteSize, _ := c.GetMaxWriteSize(requestPath, diskQuota, false, fileSize, fs.IsUploadResumeSupported())
+	if err := c.CheckUploadSpace(fs, resolvedPath, c.getUploadSize(), maxWriteSize); err != nil {
+		return nil, err
+	}
 
-	if common.Config.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
+	if c.IsAtomicUploadEnabled() && fs.IsAtomicUploadSupported() {
 		err = fs.Rename(resolvedPath, filePath)
 		if err != nil {
 			c.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
@@ -234,6 +271,7 @@ func (c *Connection) handleUploadToExistingFile(fs vfs.Fs, resolvedPath, filePat
 		}
 	}
 
+	quotaSize := vfs.GetQuotaSize(fs, filePath, fileSize)
 	file, w, cancelFn, err := fs.Create(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, c.GetCreateChecks(requestPath, false))
 	if err != nil {
 		c.Log(logger.LevelError, "error creating file %#v: %+v", resolvedPath, err)
@@ -244,22 +282,23 @@ func (c *Connection) handleUploadToExistingFile(fs vfs.Fs, resolvedPath, filePat
 	if vfs.HasTruncateSupport(fs) {
 		vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(requestPath))
 		if err == nil {
-			dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -fileSize, false) //nolint:errcheck
+			dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, 0, -quotaSize, false) //nolint:errcheck
 			if vfolder.IsIncludedInUserQuota() {
-				dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+				dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 			}
 		} else {
-			dataprovider.UpdateUserQuota(&c.User, 0, -fileSize, false) //nolint:errcheck
+			dataprovider.UpdateUserQuota(&c.User, 0, -quotaSize, false) //nolint:errcheck
 		}
 	} else {
-		initialSize = fileSize
-		truncatedSize = fileSize
+		initialSize = quotaSize
+		truncatedSize = quotaSize
 	}
 
 	vfs.SetPathPermissions(fs, filePath, c.User.GetUID(), c.User.GetGID())
 
 	baseTransfer := common.NewBaseTransfer(file, c.BaseConnection, cancelFn, resolvedPath, filePath, requestPath,
 		common.TransferUpload, 0, initialSize, maxWriteSize, truncatedSize, false, fs, transferQuota)
+	baseTransfer.SetExpectedChecksum(c.getExpectedChecksum())
 
 	return newWebDavFile(baseTransfer, w, nil), nil
 }
@@ -39,6 +39,7 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
 	"github.com/drakkan/sftpgo/v2/pkg/kms"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/util/signing"
 	"github.com/drakkan/sftpgo/v2/pkg/vfs"
 )
 
@@ -457,6 +458,20 @@ func TestRemoteAddress(t *testing.T) {
 	assert.Equal(t, "10.8.0.3", ip)
 	assert.Equal(t, ip, req.RemoteAddr)
 
+	// the trusted proxies are skipped
+	req.RemoteAddr = remoteAddr2
+	req.Header.Set(xff, fmt.Sprintf("%v, 10.8.0.1, %v", remoteAddr1, remoteAddr2))
+	ip = server.checkRemoteAddress(req)
+	assert.Equal(t, remoteAddr1, ip)
+	assert.Equal(t, ip, req.RemoteAddr)
+	// a spoofed address set by the client is not used
+	req.RemoteAddr = remoteAddr2
+	req.Header.Set(xff, fmt.Sprintf("%v, 192.168.1.5, 10.8.0.1", remoteAddr1))
+	ip = server.checkRemoteAddress(req)
+	assert.Equal(t, "192.168.1.5", ip)
+	ip = util.GetClientIP(req, xff, 1, nil)
+	assert.Equal(t, "192.168.1.5", ip)
+
 	req.Header.Del(xff)
 	req.RemoteAddr = ""
 	req.Header.Set(xRealIP, remoteAddr1)
@@ -636,6 +651,99 @@ func TestFileAccessErrors(t *testing.T) {
 	}
 }
 
+func TestPropPatchMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("this test is not available on Windows")
+	}
+	user := dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			HomeDir: filepath.Join(os.TempDir(), "proppatch_home"),
+		},
+	}
+	user.Permissions = make(map[string][]string)
+	user.Permissions["/"] = []string{dataprovider.PermAny}
+	err := os.MkdirAll(user.HomeDir, os.ModePerm)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(user.HomeDir, testFile), []byte("content"), os.ModePerm)
+	assert.NoError(t, err)
+	fs := vfs.NewOsFs("connID", user.HomeDir, "")
+	connection := &Connection{
+		BaseConnection: common.NewBaseConnection(fs.ConnectionID(), common.ProtocolWebDAV, "", "", user),
+	}
+	davFile, err := connection.getFile(fs, filepath.Join(user.HomeDir, testFile), "/"+testFile)
+	if assert.NoError(t, err) {
+		transfer := davFile.(*webDavFile)
+		props, err := transfer.DeadProps()
+		assert.NoError(t, err)
+		assert.Len(t, props, 0)
+		pstats, err := transfer.Patch([]webdav.Proppatch{
+			{
+				Props: []webdav.Property{
+					{
+						XMLName:  xml.Name{Space: metadataPropNamespace, Local: "key1"},
+						InnerXML: []byte(`value &amp; 1`),
+					},
+					{
+						XMLName:  xml.Name{Space: metadataPropNamespace, Local: "key2"},
+						InnerXML: []byte(`value2`),
+					},
+				},
+			},
+			{
+				Remove: true,
+				Props: []webdav.Property{
+					{
+						XMLName: xml.Name{Space: metadataPropNamespace, Local: "key2"},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, pstats, 2) {
+			for _, pstat := range pstats {
+				assert.Equal(t, http.StatusOK, pstat.Status)
+			}
+		}
+		metadata, err := connection.GetMetadata("/" + testFile)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"key1": "value & 1"}, metadata)
+		props, err = transfer.DeadProps()
+		assert.NoError(t, err)
+		if assert.Len(t, props, 1) {
+			prop := props[xml.Name{Space: metadataPropNamespace, Local: "key1"}]
+			assert.Equal(t, "value &amp; 1", string(prop.InnerXML))
+		}
+		// invalid metadata key, nothing is changed
+		pstats, err = transfer.Patch([]webdav.Proppatch{
+			{
+				Props: []webdav.Property{
+					{
+						XMLName:  xml.Name{Space: metadataPropNamespace, Local: "key3"},
+						InnerXML: []byte(`value3`),
+					},
+					{
+						XMLName:  xml.Name{Space: metadataPropNamespace, Local: "Invalid-Key"},
+						InnerXML: []byte(`value`),
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		for _, pstat := range pstats {
+			assert.Equal(t, http.StatusForbidden, pstat.Status)
+		}
+		metadata, err = connection.GetMetadata("/" + testFile)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"key1": "value & 1"}, metadata)
+
+		err = transfer.Close()
+		assert.NoError(t, err)
+	}
+
+	err = os.RemoveAll(user.HomeDir)
+	assert.NoError(t, err)
+}
+
 func TestContentType(t *testing.T) {
 	user := dataprovider.User{
 		BaseUser: sdk.BaseUser{
@@ -1570,3 +1678,148 @@ func TestMisc(t *testing.T) {
 
 	certMgr = oldCertMgr
 }
+
+func TestLockSystemsCleanup(t *testing.T) {
+	user := &dataprovider.User{
+		BaseUser: sdk.BaseUser{
+			ID:       1,
+			Username: "lock_user",
+		},
+	}
+	ls, ok := getLockSystem(user).(*userLockSystem)
+	if !assert.True(t, ok) {
+		return
+	}
+	now := time.Now()
+	token1, err := ls.Create(now, webdav.LockDetails{
+		Root:      "/file1",
+		Duration:  time.Minute,
+		ZeroDepth: true,
+	})
+	assert.NoError(t, err)
+	token2, err := ls.Create(now, webdav.LockDetails{
+		Root:      "/file2",
+		Duration:  -1,
+		ZeroDepth: true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ls.locks, 2)
+	_, err = ls.Refresh(now, token1, 2*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Minute), ls.locks[token1].expiration)
+	assert.True(t, ls.locks[token2].expiration.IsZero())
+	// the lock for file1 is expired
+	assert.Equal(t, 1, ls.removeExpiredLocks(now.Add(3*time.Minute)))
+	_, err = ls.Create(now.Add(3*time.Minute), webdav.LockDetails{
+		Root:      "/file1",
+		Duration:  time.Minute,
+		ZeroDepth: true,
+	})
+	assert.NoError(t, err)
+	lockSystems.cleanup(now.Add(10 * time.Minute))
+	_, ok = lockSystems.get(user.Username)
+	assert.True(t, ok)
+	assert.Len(t, ls.locks, 1)
+	// deleting a resource removes its locks
+	err = ls.Delete(now, "/file2")
+	assert.NoError(t, err)
+	assert.Len(t, ls.locks, 0)
+	err = ls.Unlock(now, token2)
+	assert.ErrorIs(t, err, webdav.ErrNoSuchLock)
+	// the lock system is not removed if used recently
+	lockSystems.cleanup(now)
+	_, ok = lockSystems.get(user.Username)
+	assert.True(t, ok)
+	// a new lock system is returned for a different user with the same username
+	user.ID = 2
+	ls1, ok := getLockSystem(user).(*userLockSystem)
+	if assert.True(t, ok) {
+		assert.NotSame(t, ls, ls1)
+		assert.Equal(t, user.ID, ls1.userID)
+	}
+	lockSystems.cleanup(now.Add(2 * lockSystemsCleanupInterval))
+	_, ok = lockSystems.get(user.Username)
+	assert.False(t, ok)
+}
+
+func TestPresignedUploadErrors(t *testing.T) {
+	oldSigner := presignedUploads
+	defer func() {
+		presignedUploads = oldSigner
+	}()
+
+	c := &Configuration{
+		Bindings: []Binding{
+			{
+				Port:   9000,
+				Prefix: "/dav",
+			},
+		},
+	}
+	c.PresignedUploads.MaxExpiration = -1
+	assert.Error(t, c.PresignedUploads.validate())
+	c.PresignedUploads.MaxExpiration = 0
+	presignedUploads = c.PresignedUploads.getSigner()
+	assert.False(t, presignedUploads.enabled)
+	_, _, err := SignUploadURL("user", "/file", 0, 0)
+	assert.ErrorAs(t, err, new(*util.MethodDisabledError))
+
+	server := webDavServer{
+		config:  c,
+		binding: c.Bindings[0],
+	}
+	req, err := http.NewRequest(http.MethodPut, "/dav/file?X-SFTPGo-Signature=abc", nil)
+	assert.NoError(t, err)
+	_, _, err = server.authenticatePresignedUpload(req, "127.0.0.1")
+	assert.ErrorIs(t, err, errPresignedUploadNotAllowed)
+
+	c.PresignedUploads.Enabled = true
+	c.PresignedUploads.SigningKey = "secret key"
+	presignedUploads = c.PresignedUploads.getSigner()
+	assert.True(t, presignedUploads.enabled)
+	assert.Equal(t, []byte("secret key"), presignedUploads.key)
+	assert.Equal(t, defaultPresignedUploadExpiration, presignedUploads.maxExpiration)
+	assert.Equal(t, "[redacted]", c.getRedacted().PresignedUploads.SigningKey)
+
+	signedURL, expiresAt, err := SignUploadURL("user", "file", 0, 10)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(defaultPresignedUploadURLLifetime), expiresAt, 2*time.Second)
+	req, err = http.NewRequest(http.MethodPut, signedURL, nil)
+	assert.NoError(t, err)
+	// the binding prefix is missing
+	_, _, err = server.authenticatePresignedUpload(req, "127.0.0.1")
+	assert.ErrorIs(t, err, errPresignedUploadNotAllowed)
+	assert.Contains(t, err.Error(), signing.ErrPathMismatch.Error())
+	req, err = http.NewRequest(http.MethodPut, "/dav"+signedURL, nil)
+	assert.NoError(t, err)
+	// the user does not exist
+	_, _, err = server.authenticatePresignedUpload(req, "127.0.0.1")
+	assert.ErrorIs(t, err, errPresignedUploadNotAllowed)
+	assert.Contains(t, err.Error(), dataprovider.ErrInvalidCredentials.Error())
+
+	query := signing.SignUpload(presignedUploads.key, signing.UploadParams{
+		Username:  "user",
+		Path:      "/file",
+		ExpiresAt: time.Now().Add(-1 * time.Minute),
+	})
+	req, err = http.NewRequest(http.MethodPut, "/dav/file?"+query.Encode(), nil)
+	assert.NoError(t, err)
+	_, _, err = server.authenticatePresignedUpload(req, "127.0.0.1")
+	assert.ErrorIs(t, err, errPresignedUploadNotAllowed)
+	assert.Contains(t, err.Error(), signing.ErrExpired.Error())
+
+	presignedUploads.key = []byte("another key")
+	req, err = http.NewRequest(http.MethodPut, "/dav"+signedURL, nil)
+	assert.NoError(t, err)
+	_, _, err = server.authenticatePresignedUpload(req, "127.0.0.1")
+	assert.ErrorIs(t, err, errPresignedUploadNotAllowed)
+	assert.Contains(t, err.Error(), signing.ErrInvalidSignature.Error())
+
+	c.PresignedUploads.SigningKey = ""
+	c.PresignedUploads.MaxExpiration = 60
+	presignedUploads = c.PresignedUploads.getSigner()
+	assert.Len(t, presignedUploads.key, 32)
+	_, expiresAt, err = SignUploadURL("user", "file", 0, 0)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 2*time.Second)
+}
@@ -0,0 +1,212 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webdavd
+
+import (
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drakkan/webdav"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/logger"
+)
+
+const lockSystemsCleanupInterval = 5 * time.Minute
+
+var (
+	// lock systems for the users, keyed by username. They are not stored
+	// with the cached users so the locks are not lost if a cached user is
+	// invalidated, for example after an update, or evicted
+	lockSystems        = newLockSystemsMap()
+	lockSystemsCleanup sync.Once
+)
+
+type lockInfo struct {
+	root string
+	// zero means no expiration
+	expiration time.Time
+}
+
+// userLockSystem wraps an in-memory lock system and tracks the
+// expiration of the active locks so the expired ones can be removed
+type userLockSystem struct {
+	webdav.LockSystem
+	// the lock system is bound to a specific user, a new one is created
+	// if the user is deleted and then added again with the same username
+	userID   int64
+	lastUsed atomic.Int64
+	mu       sync.Mutex
+	locks    map[string]lockInfo
+}
+
+func newUserLockSystem(userID int64) *userLockSystem {
+	return &userLockSystem{
+		LockSystem: webdav.NewMemLS(),
+		userID:     userID,
+		locks:      make(map[string]lockInfo),
+	}
+}
+
+func getLockExpiration(now time.Time, duration time.Duration) time.Time {
+	if duration < 0 {
+		return time.Time{}
+	}
+	return now.Add(duration)
+}
+
+// Create implements webdav.LockSystem
+func (ls *userLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	token, err := ls.LockSystem.Create(now, details)
+	if err == nil {
+		ls.mu.Lock()
+		ls.locks[token] = lockInfo{
+			root:       path.Clean(details.Root),
+			expiration: getLockExpiration(now, details.Duration),
+		}
+		ls.mu.Unlock()
+	}
+	return token, err
+}
+
+// Refresh implements webdav.LockSystem
+func (ls *userLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	details, err := ls.LockSystem.Refresh(now, token, duration)
+	if err == nil {
+		ls.mu.Lock()
+		ls.locks[token] = lockInfo{
+			root:       path.Clean(details.Root),
+			expiration: getLockExpiration(now, duration),
+		}
+		ls.mu.Unlock()
+	}
+	return details, err
+}
+
+// Unlock implements webdav.LockSystem
+func (ls *userLockSystem) Unlock(now time.Time, token string) error {
+	err := ls.LockSystem.Unlock(now, token)
+	if err == nil || err == webdav.ErrNoSuchLock {
+		ls.mu.Lock()
+		delete(ls.locks, token)
+		ls.mu.Unlock()
+	}
+	return err
+}
+
+// Delete implements webdav.LockDeleter, it is called after a resource is deleted
+func (ls *userLockSystem) Delete(now time.Time, name string) error {
+	if deleter, ok := ls.LockSystem.(webdav.LockDeleter); ok {
+		if err := deleter.Delete(now, name); err != nil {
+			return err
+		}
+	}
+	name = path.Clean(name)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for token, info := range ls.locks {
+		if info.root == name {
+			delete(ls.locks, token)
+		}
+	}
+	return nil
+}
+
+// removeExpiredLocks removes the expired locks and returns the number of active ones
+func (ls *userLockSystem) removeExpiredLocks(now time.Time) int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for token, info := range ls.locks {
+		if !info.expiration.IsZero() && info.expiration.Before(now) {
+			// the in-memory lock system removes the expired locks before
+			// unlocking, so we get ErrNoSuchLock here but the lock is released
+			ls.LockSystem.Unlock(now, token) //nolint:errcheck
+			delete(ls.locks, token)
+		}
+	}
+	return len(ls.locks)
+}
+
+type lockSystemsMap struct {
+	sync.RWMutex
+	systems map[string]*userLockSystem
+}
+
+func newLockSystemsMap() *lockSystemsMap {
+	return &lockSystemsMap{
+		systems: make(map[string]*userLockSystem),
+	}
+}
+
+func (m *lockSystemsMap) get(username string) (*userLockSystem, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	ls, ok := m.systems[username]
+	return ls, ok
+}
+
+func (m *lockSystemsMap) getOrCreate(username string, userID int64) *userLockSystem {
+	if ls, ok := m.get(username); ok && ls.userID == userID {
+		return ls
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	ls, ok := m.systems[username]
+	if !ok || ls.userID != userID {
+		ls = newUserLockSystem(userID)
+		m.systems[username] = ls
+	}
+	return ls
+}
+
+func (m *lockSystemsMap) cleanup(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	for username, ls := range m.systems {
+		numLocks := ls.removeExpiredLocks(now)
+		// the lock systems without active locks are removed if not used recently,
+		// this way we don't remove a lock system while a request is using it
+		if numLocks == 0 && now.Sub(time.Unix(0, ls.lastUsed.Load())) > lockSystemsCleanupInterval {
+			delete(m.systems, username)
+			logger.Debug(logSender, "", "lock system removed for user %q", username)
+		}
+	}
+}
+
+func getLockSystem(user *dataprovider.User) webdav.LockSystem {
+	lockSystemsCleanup.Do(func() {
+		go startLockSystemsCleanup()
+	})
+	ls := lockSystems.getOrCreate(user.Username, user.ID)
+	ls.lastUsed.Store(time.Now().UnixNano())
+	return ls
+}
+
+func startLockSystemsCleanup() {
+	ticker := time.NewTicker(lockSystemsCleanupInterval)
+	defer ticker.Stop()
+
+	for t := range ticker.C {
+		lockSystems.cleanup(t)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webdavd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drakkan/webdav"
+
+	"github.com/drakkan/sftpgo/v2/pkg/dataprovider"
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/util/signing"
+)
+
+const (
+	loginMethodPresignedUpload        = "presigned-upload"
+	defaultPresignedUploadExpiration  = time.Hour
+	defaultPresignedUploadURLLifetime = 15 * time.Minute
+)
+
+var (
+	presignedUploads             presignedUploadsSigner
+	errPresignedUploadNotAllowed = errors.New("presigned upload not allowed")
+)
+
+type presignedUploadsSigner struct {
+	enabled       bool
+	key           []byte
+	maxExpiration time.Duration
+}
+
+// SignUploadURL returns a URL, relative to the WebDAV bindings root, that allows to
+// upload a file to the specified virtual path, without authentication, until it expires.
+// If expiration is 0 the URL is valid for 15 minutes, or for the configured max expiration
+// if lower. maxSize is the maximum allowed size for the uploaded file, 0 means no limit
+// other than the ones configured for the user
+func SignUploadURL(username, virtualPath string, expiration time.Duration, maxSize int64) (string, time.Time, error) {
+	if !presignedUploads.enabled {
+		return "", time.Time{}, util.NewMethodDisabledError("WebDAV presigned uploads are disabled")
+	}
+	if expiration < 0 || expiration > presignedUploads.maxExpiration {
+		return "", time.Time{}, util.NewValidationError(fmt.Sprintf("invalid expiration, the maximum allowed value is %d seconds",
+			int64(presignedUploads.maxExpiration/time.Second)))
+	}
+	if expiration == 0 {
+		expiration = defaultPresignedUploadURLLifetime
+		if expiration > presignedUploads.maxExpiration {
+			expiration = presignedUploads.maxExpiration
+		}
+	}
+	if maxSize < 0 {
+		return "", time.Time{}, util.NewValidationError(fmt.Sprintf("invalid max size: %d", maxSize))
+	}
+	virtualPath = util.CleanPath(virtualPath)
+	if virtualPath == "/" {
+		return "", time.Time{}, util.NewValidationError("please set the path of the file to upload")
+	}
+	params := signing.UploadParams{
+		Username:  username,
+		Path:      virtualPath,
+		ExpiresAt: time.Now().Add(expiration).Truncate(time.Second),
+		MaxSize:   maxSize,
+	}
+	u := url.URL{
+		Path:     virtualPath,
+		RawQuery: signing.SignUpload(presignedUploads.key, params).Encode(),
+	}
+	return u.String(), params.ExpiresAt, nil
+}
+
+func (s *webDavServer) getRequestVirtualPath(r *http.Request) (string, bool) {
+	p := r.URL.Path
+	if s.binding.Prefix != "" {
+		if !strings.HasPrefix(p, s.binding.Prefix) {
+			return "", false
+		}
+		p = strings.TrimPrefix(p, s.binding.Prefix)
+	}
+	return util.CleanPath(p), true
+}
+
+// authenticatePresignedUpload authenticates an upload request using the signature
+// embedded in its URL. The returned user can only upload files up to the signed
+// max size
+func (s *webDavServer) authenticatePresignedUpload(r *http.Request, ip string) (dataprovider.User, webdav.LockSystem, error) {
+	var user dataprovider.User
+
+	if !presignedUploads.enabled {
+		return user, nil, fmt.Errorf("%w: presigned uploads are disabled", errPresignedUploadNotAllowed)
+	}
+	if r.Method != http.MethodPut {
+		return user, nil, fmt.Errorf("%w: method %s not allowed", errPresignedUploadNotAllowed, r.Method)
+	}
+	virtualPath, ok := s.getRequestVirtualPath(r)
+	if !ok {
+		return user, nil, fmt.Errorf("%w: %v", errPresignedUploadNotAllowed, signing.ErrPathMismatch)
+	}
+	params, err := signing.VerifyUpload(presignedUploads.key, virtualPath, r.URL.Query())
+	if err != nil {
+		user.Username = params.Username
+		updateLoginMetrics(&user, ip, loginMethodPresignedUpload, err)
+		return user, nil, fmt.Errorf("%w: %v", errPresignedUploadNotAllowed, err)
+	}
+	user, err = dataprovider.GetUserWithGroupSettings(params.Username)
+	if err == nil {
+		err = user.CheckLoginConditions()
+	}
+	if err != nil {
+		user.Username = params.Username
+		updateLoginMetrics(&user, ip, loginMethodPresignedUpload, err)
+		return user, nil, fmt.Errorf("%w: %v", errPresignedUploadNotAllowed, dataprovider.ErrInvalidCredentials)
+	}
+	if params.MaxSize > 0 {
+		maxSize := user.GetMaxUploadFileSize(params.Path)
+		if maxSize == 0 || params.MaxSize < maxSize {
+			// the exact path has the precedence over any other upload limit
+			user.Filters.PathUploadLimits = append(user.Filters.PathUploadLimits, dataprovider.PathUploadLimit{
+				Path:              params.Path,
+				MaxUploadFileSize: params.MaxSize,
+			})
+		}
+	}
+	return user, getLockSystem(&user), nil
+}
@@ -0,0 +1,418 @@
+// Copyright (C) 2019-2022  Nicola Murino
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published
+// by the Free Software Foundation, version 3.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package webdavd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/drakkan/sftpgo/v2/pkg/util"
+)
+
+const (
+	reportMethod         = "REPORT"
+	reportExpandProperty = "expand-property"
+	reportSyncCollection = "sync-collection"
+	reportMaxBodySize    = 1048576
+	reportSyncTokenURN   = "urn:sftpgo:sync:"
+	davNamespace         = "DAV:"
+)
+
+var errUnsupportedReport = errors.New("unsupported report type")
+
+type reportPropName struct {
+	XMLName xml.Name
+}
+
+type syncCollectionRequest struct {
+	SyncToken string `xml:"DAV: sync-token"`
+	SyncLevel string `xml:"DAV: sync-level"`
+	Prop      *struct {
+		Names []reportPropName `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+type expandPropertyRequest struct {
+	Properties []struct {
+		Name      string `xml:"name,attr"`
+		Namespace string `xml:"namespace,attr"`
+	} `xml:"DAV: property"`
+}
+
+type reportPropValue struct {
+	XMLName  xml.Name
+	InnerXML []byte `xml:",innerxml"`
+}
+
+type reportPropstat struct {
+	Props  []reportPropValue
+	Status string
+}
+
+type reportResponse struct {
+	Href      string           `xml:"D:href"`
+	Propstats []reportPropstat `xml:"D:propstat"`
+}
+
+type reportMultistatus struct {
+	XMLName   xml.Name         `xml:"D:multistatus"`
+	Namespace string           `xml:"xmlns:D,attr"`
+	Responses []reportResponse `xml:"D:response"`
+	SyncToken string           `xml:"D:sync-token,omitempty"`
+}
+
+// MarshalXML implements the xml.Marshaler interface, the properties
+// are rendered as direct children of the prop element
+func (p reportPropstat) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	prop := xml.StartElement{Name: xml.Name{Local: "D:prop"}}
+	if err := e.EncodeToken(prop); err != nil {
+		return err
+	}
+	for _, v := range p.Props {
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(prop.End()); err != nil {
+		return err
+	}
+	if err := e.EncodeElement(p.Status, xml.StartElement{Name: xml.Name{Local: "D:status"}}); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+type reportError struct {
+	status       int
+	precondition string
+	err          error
+}
+
+func (e *reportError) Error() string {
+	return e.err.Error()
+}
+
+// handleReport handles the REPORT method. Only the DAV:expand-property
+// and DAV:sync-collection report types are supported
+func handleReport(w http.ResponseWriter, r *http.Request, connection *Connection, prefix string) {
+	status, err := serveReport(w, r, connection, prefix)
+	if err != nil {
+		var reportErr *reportError
+		if errors.As(err, &reportErr) && reportErr.precondition != "" {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><D:error xmlns:D="DAV:"><D:%s/></D:error>`,
+				reportErr.precondition)
+		} else {
+			http.Error(w, http.StatusText(status), status)
+		}
+	}
+	writeLog(r, status, err)
+}
+
+func serveReport(w http.ResponseWriter, r *http.Request, connection *Connection, prefix string) (int, error) {
+	connection.UpdateLastActivity()
+
+	name := r.URL.Path
+	if prefix != "" {
+		name = strings.TrimPrefix(name, prefix)
+		if len(name) == len(r.URL.Path) {
+			return http.StatusNotFound, errors.New("prefix mismatch")
+		}
+	}
+	name = util.CleanPath(name)
+
+	decoder := xml.NewDecoder(io.LimitReader(r.Body, reportMaxBodySize))
+	start, err := getReportStartElement(decoder)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	var ms *reportMultistatus
+	switch start.Name {
+	case xml.Name{Space: davNamespace, Local: reportExpandProperty}:
+		var req expandPropertyRequest
+		if err := decoder.DecodeElement(&req, &start); err != nil {
+			return http.StatusBadRequest, err
+		}
+		ms, err = getExpandPropertyReport(r.Context(), connection, name, prefix, &req)
+	case xml.Name{Space: davNamespace, Local: reportSyncCollection}:
+		if depth := r.Header.Get("Depth"); depth != "" && depth != "0" {
+			return http.StatusBadRequest, fmt.Errorf("invalid depth %q for sync-collection report", depth)
+		}
+		var req syncCollectionRequest
+		if err := decoder.DecodeElement(&req, &start); err != nil {
+			return http.StatusBadRequest, err
+		}
+		ms, err = getSyncCollectionReport(r.Context(), connection, name, prefix, &req)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("%w: %q %q", errUnsupportedReport, start.Name.Space, start.Name.Local)
+	}
+	if err != nil {
+		var reportErr *reportError
+		if errors.As(err, &reportErr) {
+			return reportErr.status, err
+		}
+		return getReportErrorStatus(err), err
+	}
+	ms.Namespace = davNamespace
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(ms); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(buf.Bytes()) //nolint:errcheck
+	return http.StatusMultiStatus, nil
+}
+
+func getReportStartElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.StartElement{}, errors.New("missing report body")
+			}
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+func getExpandPropertyReport(ctx context.Context, connection *Connection, name, prefix string,
+	req *expandPropertyRequest,
+) (*reportMultistatus, error) {
+	info, err := connection.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]xml.Name, 0, len(req.Properties))
+	for _, p := range req.Properties {
+		namespace := p.Namespace
+		if namespace == "" {
+			namespace = davNamespace
+		}
+		props = append(props, xml.Name{Space: namespace, Local: p.Name})
+	}
+	// our properties have no href values so there is nothing to expand
+	// and the requested properties are simply returned
+	response := getReportResponse(ctx, connection, name, prefix, info, props)
+	return &reportMultistatus{
+		Responses: []reportResponse{response},
+	}, nil
+}
+
+func getSyncCollectionReport(ctx context.Context, connection *Connection, name, prefix string,
+	req *syncCollectionRequest,
+) (*reportMultistatus, error) {
+	if req.Prop == nil {
+		return nil, &reportError{
+			status: http.StatusBadRequest,
+			err:    errors.New("missing prop element"),
+		}
+	}
+	if strings.TrimSpace(req.SyncLevel) != "1" {
+		return nil, &reportError{
+			status:       http.StatusForbidden,
+			precondition: "sync-traversal-supported",
+			err:          fmt.Errorf("unsupported sync level %q", req.SyncLevel),
+		}
+	}
+	info, err := connection.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &reportError{
+			status: http.StatusForbidden,
+			err:    fmt.Errorf("%q is not a collection", name),
+		}
+	}
+	entries, err := connection.ListDir(name)
+	if err != nil {
+		return nil, err
+	}
+	connection.SortDirListing(entries)
+	syncToken := getSyncToken(entries)
+	clientToken := strings.TrimSpace(req.SyncToken)
+	if clientToken == syncToken {
+		return &reportMultistatus{
+			SyncToken: syncToken,
+		}, nil
+	}
+	if clientToken != "" {
+		// we don't track the changes so the client must do a full sync
+		return nil, &reportError{
+			status:       http.StatusForbidden,
+			precondition: "valid-sync-token",
+			err:          fmt.Errorf("invalid or expired sync token %q", clientToken),
+		}
+	}
+	props := make([]xml.Name, 0, len(req.Prop.Names))
+	for _, p := range req.Prop.Names {
+		props = append(props, p.XMLName)
+	}
+	responses := make([]reportResponse, 0, len(entries))
+	for _, entry := range entries {
+		responses = append(responses, getReportResponse(ctx, connection, path.Join(name, entry.Name()), prefix,
+			entry, props))
+	}
+	return &reportMultistatus{
+		Responses: responses,
+		SyncToken: syncToken,
+	}, nil
+}
+
+// getSyncToken returns a token representing the current state of the
+// collection, it changes if a member is added, removed or modified
+func getSyncToken(entries []os.FileInfo) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s\x00%t\x00%d\x00%d\n", entry.Name(), entry.IsDir(), entry.Size(), entry.ModTime().UnixNano())
+	}
+	return reportSyncTokenURN + hex.EncodeToString(h.Sum(nil))
+}
+
+func getReportResponse(ctx context.Context, connection *Connection, name, prefix string, info os.FileInfo,
+	props []xml.Name,
+) reportResponse {
+	href := path.Join("/", prefix, name)
+	if info.IsDir() && href != "/" {
+		href += "/"
+	}
+	response := reportResponse{
+		Href: (&url.URL{Path: href}).EscapedPath(),
+	}
+	var found, notFound []reportPropValue
+	for _, prop := range props {
+		value, ok := getLivePropValue(ctx, connection, name, info, prop)
+		if ok {
+			found = append(found, value)
+		} else {
+			notFound = append(notFound, getReportPropName(prop, nil))
+		}
+	}
+	if len(found) > 0 {
+		response.Propstats = append(response.Propstats, reportPropstat{
+			Props:  found,
+			Status: getReportStatusLine(http.StatusOK),
+		})
+	}
+	if len(notFound) > 0 {
+		response.Propstats = append(response.Propstats, reportPropstat{
+			Props:  notFound,
+			Status: getReportStatusLine(http.StatusNotFound),
+		})
+	}
+	return response
+}
+
+func getLivePropValue(ctx context.Context, connection *Connection, name string, info os.FileInfo,
+	prop xml.Name,
+) (reportPropValue, bool) {
+	if prop.Space != davNamespace {
+		return reportPropValue{}, false
+	}
+	var value string
+	switch prop.Local {
+	case "resourcetype":
+		if info.IsDir() {
+			return getReportPropName(prop, []byte("<D:collection/>")), true
+		}
+		return getReportPropName(prop, nil), true
+	case "displayname":
+		value = path.Base(name)
+	case "getlastmodified":
+		value = info.ModTime().UTC().Format(http.TimeFormat)
+	case "getcontentlength":
+		if info.IsDir() {
+			return reportPropValue{}, false
+		}
+		value = fmt.Sprintf("%d", info.Size())
+	case "getcontenttype":
+		if info.IsDir() {
+			return reportPropValue{}, false
+		}
+		value = getReportContentType(ctx, connection, name, info)
+	case "getetag":
+		if info.IsDir() {
+			return reportPropValue{}, false
+		}
+		value = fmt.Sprintf(`"%x%x"`, info.ModTime().UnixNano(), info.Size())
+	default:
+		return reportPropValue{}, false
+	}
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value)) //nolint:errcheck
+	return getReportPropName(prop, buf.Bytes()), true
+}
+
+func getReportContentType(ctx context.Context, connection *Connection, name string, info os.FileInfo) string {
+	fs, fsPath, err := connection.GetFsAndResolvedPath(name)
+	if err == nil {
+		fi := &webDavFileInfo{
+			FileInfo:    info,
+			Fs:          fs,
+			virtualPath: name,
+			fsPath:      fsPath,
+		}
+		if contentType, err := fi.ContentType(ctx); err == nil && contentType != "" {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+func getReportPropName(prop xml.Name, value []byte) reportPropValue {
+	if prop.Space == davNamespace {
+		// use the prefix defined in the multistatus element
+		prop = xml.Name{Local: "D:" + prop.Local}
+	}
+	return reportPropValue{
+		XMLName:  prop,
+		InnerXML: value,
+	}
+}
+
+func getReportStatusLine(status int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
+}
+
+func getReportErrorStatus(err error) int {
+	if errors.Is(err, os.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
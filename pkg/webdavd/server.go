@@ -26,6 +26,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/drakkan/webdav"
@@ -38,6 +39,7 @@ import (
 	"github.com/drakkan/sftpgo/v2/pkg/logger"
 	"github.com/drakkan/sftpgo/v2/pkg/metric"
 	"github.com/drakkan/sftpgo/v2/pkg/util"
+	"github.com/drakkan/sftpgo/v2/pkg/util/signing"
 )
 
 type webDavServer struct {
@@ -47,6 +49,9 @@ type webDavServer struct {
 
 func (s *webDavServer) listenAndServe(compressor *middleware.Compressor) error {
 	handler := compressor.Handler(s)
+	if s.binding.SecurityHeaders.IsEnabled() {
+		handler = s.binding.SecurityHeaders.Handler(handler)
+	}
 	httpServer := &http.Server{
 		ReadHeaderTimeout: 30 * time.Second,
 		ReadTimeout:       60 * time.Second,
@@ -188,6 +193,16 @@ func (s *webDavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	user, isCached, lockSystem, loginMethod, err := s.authenticate(r, ipAddr)
 	if err != nil {
+		if errors.Is(err, errPresignedUploadNotAllowed) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var cooldownErr *dataprovider.LoginCooldownError
+		if errors.As(err, &cooldownErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(cooldownErr.GetRetryAfterSeconds()))
+			http.Error(w, fmt.Sprintf("Authentication error: %v", err), http.StatusTooManyRequests)
+			return
+		}
 		if !s.binding.DisableWWWAuthHeader {
 			w.Header().Set("WWW-Authenticate", "Basic realm=\"SFTPGo WebDAV\"")
 		}
@@ -226,7 +241,7 @@ func (s *webDavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		errClose := user.CloseFs()
 		logger.Warn(logSender, connectionID, "unable add connection: %v close fs error: %v", err, errClose)
 		updateLoginMetrics(&user, ipAddr, loginMethod, err)
-		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 	defer common.Connections.Remove(connection.GetID())
@@ -246,6 +261,16 @@ func (s *webDavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == reportMethod && s.config.EnableReport {
+		handleReport(w, r.WithContext(ctx), connection, s.binding.Prefix)
+		return
+	}
+
+	if r.Method == "PROPFIND" && common.Config.DirListCache.IsEnabled() {
+		// listings are user specific so they can be cached by the client only
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", common.Config.DirListCache.TTL))
+	}
+
 	handler := webdav.Handler{
 		Prefix:     s.binding.Prefix,
 		FileSystem: connection,
@@ -278,6 +303,10 @@ func (s *webDavServer) getCredentialsAndLoginMethod(r *http.Request) (string, st
 func (s *webDavServer) authenticate(r *http.Request, ip string) (dataprovider.User, bool, webdav.LockSystem, string, error) {
 	var user dataprovider.User
 	var err error
+	if signing.IsSigned(r.URL.Query()) {
+		user, lockSystem, err := s.authenticatePresignedUpload(r, ip)
+		return user, false, lockSystem, loginMethodPresignedUpload, err
+	}
 	username, password, loginMethod, tlsCert, ok := s.getCredentialsAndLoginMethod(r)
 	if !ok {
 		user.Username = username
@@ -293,11 +322,15 @@ func (s *webDavServer) authenticate(r *http.Request, ip string) (dataprovider.Us
 				tlsCert = nil
 				loginMethod = dataprovider.LoginMethodPassword
 			}
-			if err := dataprovider.CheckCachedUserCredentials(cachedUser, password, loginMethod, common.ProtocolWebDAV, tlsCert); err == nil {
-				return cachedUser.User, true, cachedUser.LockSystem, loginMethod, nil
+			err := dataprovider.CheckCachedUserCredentials(cachedUser, password, loginMethod, common.ProtocolWebDAV, tlsCert)
+			if err == nil {
+				return cachedUser.User, true, getLockSystem(&cachedUser.User), loginMethod, nil
+			}
+			if !errors.As(err, new(*dataprovider.LoginCooldownError)) {
+				err = dataprovider.ErrInvalidCredentials
 			}
-			updateLoginMetrics(&cachedUser.User, ip, loginMethod, dataprovider.ErrInvalidCredentials)
-			return user, false, nil, loginMethod, dataprovider.ErrInvalidCredentials
+			updateLoginMetrics(&cachedUser.User, ip, loginMethod, err)
+			return user, false, nil, loginMethod, err
 		}
 	}
 	user, loginMethod, err = dataprovider.CheckCompositeCredentials(username, password, ip, loginMethod,
@@ -305,9 +338,12 @@ func (s *webDavServer) authenticate(r *http.Request, ip string) (dataprovider.Us
 	if err != nil {
 		user.Username = username
 		updateLoginMetrics(&user, ip, loginMethod, err)
+		if errors.As(err, new(*dataprovider.LoginCooldownError)) {
+			return user, false, nil, loginMethod, err
+		}
 		return user, false, nil, loginMethod, dataprovider.ErrInvalidCredentials
 	}
-	lockSystem := webdav.NewMemLS()
+	lockSystem := getLockSystem(&user)
 	cachedUser = &dataprovider.CachedUser{
 		User:       user,
 		Password:   password,
@@ -356,7 +392,8 @@ func (s *webDavServer) checkRemoteAddress(r *http.Request) string {
 	if isUnixSocket || ip != nil {
 		for _, allow := range s.binding.allowHeadersFrom {
 			if allow(ip) {
-				parsedIP := util.GetRealIP(r, s.binding.ClientIPProxyHeader, s.binding.ClientIPHeaderDepth)
+				parsedIP := util.GetClientIP(r, s.binding.ClientIPProxyHeader, s.binding.ClientIPHeaderDepth,
+					s.binding.getTrustedProxies())
 				if parsedIP != "" {
 					ipAddr = parsedIP
 					r.RemoteAddr = ipAddr
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"path/filepath"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 
@@ -125,7 +126,10 @@ type Binding struct {
 	// Do not add the WWW-Authenticate header after an authentication error,
 	// only the 401 status code will be sent
 	DisableWWWAuthHeader bool `json:"disable_www_auth_header" mapstructure:"disable_www_auth_header"`
-	allowHeadersFrom     []func(net.IP) bool
+	// SecurityHeaders defines the headers to add to every WebDAV response. WebDAV clients
+	// are not browsers, so these headers are configured independently from the HTTP server ones
+	SecurityHeaders  common.SecurityHeaders `json:"security_headers" mapstructure:"security_headers"`
+	allowHeadersFrom []func(net.IP) bool
 }
 
 func (b *Binding) parseAllowedProxy() error {
@@ -142,13 +146,23 @@ func (b *Binding) parseAllowedProxy() error {
 	return nil
 }
 
+// getTrustedProxies returns the functions to check if an IP address, included
+// in the client IP proxy header, is a trusted proxy that must be skipped
+func (b *Binding) getTrustedProxies() []func(net.IP) bool {
+	if filepath.IsAbs(b.Address) {
+		// unix domain socket, any address is allowed to set the proxy headers
+		return nil
+	}
+	return b.allowHeadersFrom
+}
+
 func (b *Binding) isMutualTLSEnabled() bool {
 	return b.ClientAuthType == 1 || b.ClientAuthType == 2
 }
 
 // GetAddress returns the binding address
 func (b *Binding) GetAddress() string {
-	return fmt.Sprintf("%s:%d", b.Address, b.Port)
+	return util.JoinHostPort(b.Address, b.Port)
 }
 
 // IsValid returns true if the binding port is > 0
@@ -156,6 +170,45 @@ func (b *Binding) IsValid() bool {
 	return b.Port > 0
 }
 
+// PresignedUploadsConfig defines the configuration for the presigned upload URLs.
+// A presigned URL allows to upload a file, using a WebDAV PUT request, to a single
+// pre-approved path without any other authentication
+type PresignedUploadsConfig struct {
+	// Set to true to accept the upload URLs signed using the REST API
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// Key used to sign the upload URLs. If empty a random key is generated at
+	// startup, so the URLs signed before a restart are rejected. Set the same
+	// key for all the instances sharing the same data provider
+	SigningKey string `json:"signing_key" mapstructure:"signing_key"`
+	// Maximum validity, as seconds, for the signed URLs. 0 means 3600
+	MaxExpiration int `json:"max_expiration" mapstructure:"max_expiration"`
+}
+
+func (c *PresignedUploadsConfig) validate() error {
+	if c.MaxExpiration < 0 {
+		return fmt.Errorf("invalid presigned uploads max expiration: %d", c.MaxExpiration)
+	}
+	return nil
+}
+
+func (c *PresignedUploadsConfig) getSigner() presignedUploadsSigner {
+	if !c.Enabled {
+		return presignedUploadsSigner{}
+	}
+	signer := presignedUploadsSigner{
+		enabled:       true,
+		key:           []byte(c.SigningKey),
+		maxExpiration: time.Duration(c.MaxExpiration) * time.Second,
+	}
+	if c.SigningKey == "" {
+		signer.key = util.GenerateRandomBytes(32)
+	}
+	if signer.maxExpiration == 0 {
+		signer.maxExpiration = defaultPresignedUploadExpiration
+	}
+	return signer
+}
+
 // Configuration defines the configuration for the WevDAV server
 type Configuration struct {
 	// Addresses and ports to bind to
@@ -175,6 +228,12 @@ type Configuration struct {
 	Cors CorsConfig `json:"cors" mapstructure:"cors"`
 	// Cache configuration
 	Cache Cache `json:"cache" mapstructure:"cache"`
+	// EnableReport enables a minimal support for the REPORT method, only the
+	// DAV:expand-property and DAV:sync-collection report types are supported.
+	// If disabled, REPORT requests are rejected
+	EnableReport bool `json:"enable_report" mapstructure:"enable_report"`
+	// Configuration for the presigned upload URLs
+	PresignedUploads PresignedUploadsConfig `json:"presigned_uploads" mapstructure:"presigned_uploads"`
 }
 
 // GetStatus returns the server status
@@ -182,6 +241,14 @@ func GetStatus() ServiceStatus {
 	return serviceStatus
 }
 
+func (c *Configuration) getRedacted() Configuration {
+	conf := *c
+	if conf.PresignedUploads.SigningKey != "" {
+		conf.PresignedUploads.SigningKey = "[redacted]"
+	}
+	return conf
+}
+
 // ShouldBind returns true if there is at least a valid binding
 func (c *Configuration) ShouldBind() bool {
 	for _, binding := range c.Bindings {
@@ -221,7 +288,7 @@ func (c *Configuration) getKeyPairs(configDir string) []common.TLSKeyPair {
 
 // Initialize configures and starts the WebDAV server
 func (c *Configuration) Initialize(configDir string) error {
-	logger.Info(logSender, "", "initializing WebDAV server with config %+v", *c)
+	logger.Info(logSender, "", "initializing WebDAV server with config %+v", c.getRedacted())
 	mimeTypeCache = mimeCache{
 		maxSize:   c.Cache.MimeTypes.MaxSize,
 		mimeTypes: make(map[string]string),
@@ -232,6 +299,9 @@ func (c *Configuration) Initialize(configDir string) error {
 	if !c.ShouldBind() {
 		return common.ErrNoBinding
 	}
+	if err := c.PresignedUploads.validate(); err != nil {
+		return err
+	}
 
 	keyPairs := c.getKeyPairs(configDir)
 	if len(keyPairs) > 0 {
@@ -265,6 +335,9 @@ func (c *Configuration) Initialize(configDir string) error {
 		if err := binding.parseAllowedProxy(); err != nil {
 			return err
 		}
+		if err := binding.SecurityHeaders.Validate(); err != nil {
+			return fmt.Errorf("binding %q: %w", binding.GetAddress(), err)
+		}
 
 		go func(binding Binding) {
 			server := webDavServer{
@@ -275,6 +348,7 @@ func (c *Configuration) Initialize(configDir string) error {
 		}(binding)
 	}
 
+	presignedUploads = c.PresignedUploads.getSigner()
 	serviceStatus.IsActive = true
 
 	return <-exitChannel
@@ -288,6 +362,14 @@ func ReloadCertificateMgr() error {
 	return nil
 }
 
+// GetCertificatesInfo returns the metadata for the loaded TLS certificates
+func GetCertificatesInfo() []common.TLSCertificateInfo {
+	if certMgr != nil {
+		return certMgr.GetCertificatesInfo()
+	}
+	return nil
+}
+
 func getConfigPath(name, configDir string) string {
 	if !util.IsFileInputValid(name) {
 		return ""
@@ -380,6 +380,11 @@ func TestMain(m *testing.M) {
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
 	}
+	webDavConf.EnableReport = true
+	webDavConf.PresignedUploads = webdavd.PresignedUploadsConfig{
+		Enabled:       true,
+		MaxExpiration: 600,
+	}
 
 	status := webdavd.GetStatus()
 	if status.IsActive {
@@ -451,6 +456,10 @@ func TestInitialization(t *testing.T) {
 		},
 		CertificateFile:    "missing path",
 		CertificateKeyFile: "bad path",
+		PresignedUploads: webdavd.PresignedUploadsConfig{
+			Enabled:       true,
+			MaxExpiration: 600,
+		},
 	}
 	err := cfg.Initialize(configDir)
 	assert.Error(t, err)
@@ -820,6 +829,86 @@ func TestLockAfterDelete(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestLockAfterUserUpdate(t *testing.T) {
+	u := getTestUser()
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+
+	client := getWebDavClient(user, false, nil)
+	assert.NoError(t, checkBasicFunc(client))
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	err = uploadFileWithRawClient(testFilePath, testFileName, user.Username, defaultPassword,
+		false, testFileSize, client)
+	assert.NoError(t, err)
+
+	lockBody := `<?xml version="1.0" encoding="utf-8" ?><d:lockinfo xmlns:d="DAV:"><d:lockscope><d:exclusive/></d:lockscope><d:locktype><d:write/></d:locktype></d:lockinfo>`
+	req, err := http.NewRequest("LOCK", fmt.Sprintf("http://%v/%v", webDavServerAddr, testFileName), bytes.NewReader([]byte(lockBody)))
+	assert.NoError(t, err)
+	req.SetBasicAuth(u.Username, u.Password)
+	req.Header.Set("Timeout", "Second-3600")
+	httpClient := httpclient.GetHTTPClient()
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	lockToken := resp.Header.Get("Lock-Token")
+	assert.NotEmpty(t, lockToken)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+	// the cached user is invalidated after an update, the lock must be preserved
+	user, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest(http.MethodPut, fmt.Sprintf("http://%v/%v", webDavServerAddr, testFileName),
+		bytes.NewReader([]byte("content")))
+	assert.NoError(t, err)
+	req.SetBasicAuth(u.Username, u.Password)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest(http.MethodPut, fmt.Sprintf("http://%v/%v", webDavServerAddr, testFileName),
+		bytes.NewReader([]byte("content")))
+	assert.NoError(t, err)
+	req.Header.Set("If", fmt.Sprintf("(%v)", lockToken))
+	req.SetBasicAuth(u.Username, u.Password)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest("UNLOCK", fmt.Sprintf("http://%v/%v", webDavServerAddr, testFileName), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Lock-Token", lockToken)
+	req.SetBasicAuth(u.Username, u.Password)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+
+	req, err = http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%v/%v", webDavServerAddr, testFileName), nil)
+	assert.NoError(t, err)
+	req.SetBasicAuth(u.Username, u.Password)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	err = resp.Body.Close()
+	assert.NoError(t, err)
+
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestRenameWithLock(t *testing.T) {
 	u := getTestUser()
 	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
@@ -2241,6 +2330,159 @@ func TestGETAsPROPFIND(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPresignedUpload(t *testing.T) {
+	u := getTestUser()
+	u.Filters.MaxUploadFileSize = 1000
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+
+	_, _, err = httpdtest.PresignUpload("missing user", "/file.dat", 0, 0, http.StatusNotFound)
+	assert.NoError(t, err)
+	_, resp, err := httpdtest.PresignUpload(user.Username, "/", 0, 0, http.StatusBadRequest)
+	assert.NoError(t, err)
+	assert.Contains(t, string(resp), "please set the path")
+	_, resp, err = httpdtest.PresignUpload(user.Username, "/file.dat", 601, 0, http.StatusBadRequest)
+	assert.NoError(t, err)
+	assert.Contains(t, string(resp), "the maximum allowed value is 600 seconds")
+	_, _, err = httpdtest.PresignUpload(user.Username, "/file.dat", -1, 0, http.StatusBadRequest)
+	assert.NoError(t, err)
+	_, _, err = httpdtest.PresignUpload(user.Username, "/file.dat", 0, -1, http.StatusBadRequest)
+	assert.NoError(t, err)
+
+	signedURL, _, err := httpdtest.PresignUpload(user.Username, "upload/file.dat", 60, 100, http.StatusOK)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(signedURL, "/upload/file.dat?"), signedURL)
+	assert.Contains(t, signedURL, "X-SFTPGo-Signature=")
+
+	doRequest := func(method, rawURL string, size int) int {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%v%v", webDavServerAddr, rawURL),
+			bytes.NewReader(bytes.Repeat([]byte("a"), size)))
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp, err := httpclient.GetHTTPClient().Do(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	// the parent directory does not exist
+	assert.Equal(t, http.StatusNotFound, doRequest(http.MethodPut, signedURL, 50))
+	err = os.MkdirAll(filepath.Join(user.GetHomeDir(), "upload"), os.ModePerm)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, doRequest(http.MethodPut, signedURL, 50))
+	info, err := os.Stat(filepath.Join(user.GetHomeDir(), "upload", "file.dat"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(50), info.Size())
+	}
+	// the signed URL can only be used for uploads to the signed path
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodGet, signedURL, 0))
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodPut, strings.Replace(signedURL, "/upload/file.dat",
+		"/upload/file1.dat", 1), 50))
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodPut, strings.Replace(signedURL, "X-SFTPGo-Max-Size=100",
+		"X-SFTPGo-Max-Size=1000", 1), 50))
+	assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "upload", "file1.dat"))
+	// the signed max size is enforced
+	assert.NotEqual(t, http.StatusCreated, doRequest(http.MethodPut, signedURL, 200))
+	// a signed max size greater than the user limit does not override it
+	signedURL, _, err = httpdtest.PresignUpload(user.Username, "/upload/file.dat", 0, 2000, http.StatusOK)
+	assert.NoError(t, err)
+	assert.NotEqual(t, http.StatusCreated, doRequest(http.MethodPut, signedURL, 1500))
+	assert.Equal(t, http.StatusCreated, doRequest(http.MethodPut, signedURL, 500))
+	// the user must be allowed to login
+	user.Status = 0
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodPut, signedURL, 50))
+	user.Status = 1
+	user.Filters.DeniedProtocols = []string{common.ProtocolWebDAV}
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodPut, signedURL, 50))
+	_, resp, err = httpdtest.PresignUpload(user.Username, "/file.dat", 0, 0, http.StatusBadRequest)
+	assert.NoError(t, err)
+	assert.Contains(t, string(resp), "is not allowed for user")
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, doRequest(http.MethodPut, signedURL, 50))
+}
+
+func TestReport(t *testing.T) {
+	user, _, err := httpdtest.AddUser(getTestUser(), http.StatusCreated)
+	assert.NoError(t, err)
+	client := getWebDavClient(user, false, nil)
+	err = client.Mkdir("sub", os.ModePerm)
+	assert.NoError(t, err)
+	err = client.Write(path.Join("sub", "file.txt"), []byte("content"), os.ModePerm)
+	assert.NoError(t, err)
+
+	httpClient := httpclient.GetHTTPClient()
+	doReport := func(p, body string) (int, string) {
+		req, err := http.NewRequest("REPORT", fmt.Sprintf("http://%v%v", webDavServerAddr, p),
+			bytes.NewBuffer([]byte(body)))
+		assert.NoError(t, err)
+		req.SetBasicAuth(user.Username, defaultPassword)
+		resp, err := httpClient.Do(req)
+		if !assert.NoError(t, err) {
+			return 0, ""
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+
+	syncBody := `<?xml version="1.0" encoding="utf-8"?><D:sync-collection xmlns:D="DAV:"><D:sync-token>%s</D:sync-token>
+<D:sync-level>%s</D:sync-level><D:prop><D:getetag/><D:getcontentlength/><D:resourcetype/><X:custom xmlns:X="urn:x"/></D:prop>
+</D:sync-collection>`
+	status, body := doReport("/sub", fmt.Sprintf(syncBody, "", "1"))
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "<D:href>/sub/file.txt</D:href>")
+	assert.Contains(t, body, "<D:getcontentlength>7</D:getcontentlength>")
+	assert.Contains(t, body, "HTTP/1.1 404 Not Found")
+	assert.Contains(t, body, "<D:sync-token>urn:sftpgo:sync:")
+	token := body[strings.Index(body, "<D:sync-token>")+len("<D:sync-token>") : strings.Index(body, "</D:sync-token>")]
+	// no changes
+	status, body = doReport("/sub", fmt.Sprintf(syncBody, token, "1"))
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.NotContains(t, body, "<D:response>")
+	assert.Contains(t, body, token)
+	// the token changes if the collection is modified
+	err = client.Write(path.Join("sub", "file1.txt"), []byte("content1"), os.ModePerm)
+	assert.NoError(t, err)
+	status, body = doReport("/sub", fmt.Sprintf(syncBody, token, "1"))
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Contains(t, body, "<D:valid-sync-token/>")
+	status, body = doReport("/sub", fmt.Sprintf(syncBody, "", "infinite"))
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Contains(t, body, "<D:sync-traversal-supported/>")
+	status, _ = doReport("/sub/file.txt", fmt.Sprintf(syncBody, "", "1"))
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doReport("/missing", fmt.Sprintf(syncBody, "", "1"))
+	assert.Equal(t, http.StatusNotFound, status)
+
+	expandBody := `<?xml version="1.0" encoding="utf-8"?><D:expand-property xmlns:D="DAV:">
+<D:property name="displayname"/><D:property name="getcontenttype"/></D:expand-property>`
+	status, body = doReport("/sub/file.txt", expandBody)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "<D:displayname>file.txt</D:displayname>")
+	assert.Contains(t, body, "<D:getcontenttype>text/plain; charset=utf-8</D:getcontenttype>")
+
+	status, _ = doReport("/sub", `<?xml version="1.0" encoding="utf-8"?><D:version-tree xmlns:D="DAV:"/>`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doReport("/sub", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestStat(t *testing.T) {
 	u := getTestUser()
 	u.Permissions["/subdir"] = []string{dataprovider.PermUpload, dataprovider.PermListItems, dataprovider.PermDownload}